@@ -54,7 +54,7 @@ func (m *mockAcmeAuthority) DeactivateAccount(p provisioner.Interface, id string
 	return m.ret1.(*acme.Account), m.err
 }
 
-func (m *mockAcmeAuthority) FinalizeOrder(p provisioner.Interface, accID, id string, csr *x509.CertificateRequest) (*acme.Order, error) {
+func (m *mockAcmeAuthority) FinalizeOrder(ctx context.Context, p provisioner.Interface, accID, id string, csr *x509.CertificateRequest) (*acme.Order, error) {
 	if m.finalizeOrder != nil {
 		return m.finalizeOrder(p, accID, id, csr)
 	} else if m.err != nil {
@@ -150,7 +150,7 @@ func (h *Handler) FinalizeOrder(w http.ResponseWriter, r *http.Request) {
 	}
 
 	oid := chi.URLParam(r, "ordID")
-	o, err := h.Auth.FinalizeOrder(prov, acc.GetID(), oid, fr.csr)
+	o, err := h.Auth.FinalizeOrder(r.Context(), prov, acc.GetID(), oid, fr.csr)
 	if err != nil {
 		api.WriteError(w, err)
 		return
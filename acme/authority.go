@@ -1,6 +1,7 @@
 package acme
 
 import (
+	"context"
 	"crypto"
 	"crypto/x509"
 	"encoding/base64"
@@ -19,7 +20,7 @@ import (
 // Interface is the acme authority interface.
 type Interface interface {
 	DeactivateAccount(provisioner.Interface, string) (*Account, error)
-	FinalizeOrder(provisioner.Interface, string, string, *x509.CertificateRequest) (*Order, error)
+	FinalizeOrder(context.Context, provisioner.Interface, string, string, *x509.CertificateRequest) (*Order, error)
 	GetAccount(provisioner.Interface, string) (*Account, error)
 	GetAccountByKey(provisioner.Interface, *jose.JSONWebKey) (*Account, error)
 	GetAuthz(provisioner.Interface, string, string) (*Authz, error)
@@ -211,6 +212,13 @@ func (a *Authority) GetOrdersByAccount(p provisioner.Interface, id string) ([]st
 	return ret, nil
 }
 
+// PruneOrders deletes the orders that expired before the given time, with
+// their authorizations, challenges and certificate. It implements a
+// db.PruneFunc for the garbage collector of the database.
+func (a *Authority) PruneOrders(before time.Time) (*database.PruneResult, error) {
+	return pruneOrders(a.db, before)
+}
+
 // NewOrder generates, stores, and returns a new ACME order.
 func (a *Authority) NewOrder(p provisioner.Interface, ops OrderOptions) (*Order, error) {
 	order, err := newOrder(a.db, ops)
@@ -221,7 +229,7 @@ func (a *Authority) NewOrder(p provisioner.Interface, ops OrderOptions) (*Order,
 }
 
 // FinalizeOrder attempts to finalize an order and generate a new certificate.
-func (a *Authority) FinalizeOrder(p provisioner.Interface, accID, orderID string, csr *x509.CertificateRequest) (*Order, error) {
+func (a *Authority) FinalizeOrder(ctx context.Context, p provisioner.Interface, accID, orderID string, csr *x509.CertificateRequest) (*Order, error) {
 	o, err := getOrder(a.db, orderID)
 	if err != nil {
 		return nil, err
@@ -229,7 +237,7 @@ func (a *Authority) FinalizeOrder(p provisioner.Interface, accID, orderID string
 	if accID != o.AccountID {
 		return nil, UnauthorizedErr(errors.New("account does not own order"))
 	}
-	o, err = o.finalize(a.db, csr, a.signAuth, p)
+	o, err = o.finalize(ctx, a.db, csr, a.signAuth, p)
 	if err != nil {
 		return nil, Wrap(err, "error finalizing order")
 	}
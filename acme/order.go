@@ -4,10 +4,12 @@ import (
 	"context"
 	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"reflect"
 	"time"
 
 	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	database "github.com/RTradeLtd/ca-certificates/db"
 	"github.com/pkg/errors"
 	"github.com/smallstep/nosql"
 )
@@ -235,7 +237,7 @@ func (o *order) updateStatus(db nosql.DB) (*order, error) {
 
 // finalize signs a certificate if the necessary conditions for Order completion
 // have been met.
-func (o *order) finalize(db nosql.DB, csr *x509.CertificateRequest, auth SignAuthority, p provisioner.Interface) (*order, error) {
+func (o *order) finalize(ctx context.Context, db nosql.DB, csr *x509.CertificateRequest, auth SignAuthority, p provisioner.Interface) (*order, error) {
 	var err error
 	if o, err = o.updateStatus(db); err != nil {
 		return nil, err
@@ -267,14 +269,13 @@ func (o *order) finalize(db nosql.DB, csr *x509.CertificateRequest, auth SignAut
 	}
 
 	// Get authorizations from the ACME provisioner.
-	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
-	signOps, err := p.AuthorizeSign(ctx, "")
+	signOps, err := p.AuthorizeSign(provisioner.NewContextWithMethod(ctx, provisioner.SignMethod), "")
 	if err != nil {
 		return nil, ServerInternalErr(errors.Wrapf(err, "error retrieving authorization options from ACME provisioner"))
 	}
 
 	// Create and store a new certificate.
-	certChain, err := auth.Sign(csr, provisioner.Options{
+	certChain, err := auth.Sign(ctx, csr, provisioner.Options{
 		NotBefore: provisioner.NewTimeDuration(o.NotBefore),
 		NotAfter:  provisioner.NewTimeDuration(o.NotAfter),
 	}, signOps...)
@@ -340,3 +341,90 @@ func (o *order) toACME(db nosql.DB, dir *directory, p provisioner.Interface) (*O
 	}
 	return ao, nil
 }
+
+// pruneOrders deletes the orders that expired before the given time, with
+// their authorizations, challenges and certificate. The orders with a
+// certificate are kept until the certificate expires.
+func pruneOrders(db nosql.DB, before time.Time) (*database.PruneResult, error) {
+	entries, err := db.List(orderTable)
+	if err != nil {
+		return nil, ServerInternalErr(errors.Wrap(err, "error listing orders"))
+	}
+	res := new(database.PruneResult)
+	del := func(table, key []byte) error {
+		b, err := db.Get(table, key)
+		switch {
+		case nosql.IsErrNotFound(err):
+			return nil
+		case err != nil:
+			return ServerInternalErr(errors.Wrapf(err, "error loading %s/%s", string(table), string(key)))
+		}
+		if err := db.Del(table, key); err != nil {
+			return ServerInternalErr(errors.Wrapf(err, "error deleting %s/%s", string(table), string(key)))
+		}
+		res.Records++
+		res.Bytes += int64(len(key) + len(b))
+		return nil
+	}
+
+	for _, e := range entries {
+		var o order
+		if err := json.Unmarshal(e.Value, &o); err != nil {
+			return res, ServerInternalErr(errors.Wrapf(err, "error unmarshaling order %s", string(e.Key)))
+		}
+		if !o.Expires.Before(before) {
+			continue
+		}
+		if o.Certificate != "" {
+			cert, err := getCert(db, o.Certificate)
+			if err == nil {
+				block, _ := pem.Decode(cert.Leaf)
+				if block == nil {
+					continue
+				}
+				leaf, err := x509.ParseCertificate(block.Bytes)
+				if err != nil || !leaf.NotAfter.Before(before) {
+					continue
+				}
+			}
+			if err := del(certTable, []byte(o.Certificate)); err != nil {
+				return res, err
+			}
+		}
+
+		// Remove the order from the index before deleting it, the orders of
+		// the index must exist.
+		oids, err := getOrderIDsByAccount(db, o.AccountID)
+		if err != nil {
+			return res, err
+		}
+		newOids := make(orderIDs, 0, len(oids))
+		for _, oid := range oids {
+			if oid != o.ID {
+				newOids = append(newOids, oid)
+			}
+		}
+		if len(newOids) != len(oids) {
+			if err := newOids.save(db, oids, o.AccountID); err != nil {
+				return res, err
+			}
+		}
+
+		for _, azID := range o.Authorizations {
+			if az, err := getAuthz(db, azID); err == nil {
+				for _, chID := range az.getChallenges() {
+					if err := del(challengeTable, []byte(chID)); err != nil {
+						return res, err
+					}
+				}
+			}
+			if err := del(authzTable, []byte(azID)); err != nil {
+				return res, err
+			}
+		}
+		if err := del(orderTable, e.Key); err != nil {
+			return res, err
+		}
+	}
+	return res, nil
+}
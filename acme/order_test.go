@@ -2,10 +2,16 @@ package acme
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"math/big"
+	"sort"
 	"testing"
 	"time"
 
@@ -795,7 +801,7 @@ type mockSignAuth struct {
 	err                 error
 }
 
-func (m *mockSignAuth) Sign(csr *x509.CertificateRequest, signOpts provisioner.Options, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+func (m *mockSignAuth) Sign(ctx context.Context, csr *x509.CertificateRequest, signOpts provisioner.Options, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
 	if m.sign != nil {
 		return m.sign(csr, signOpts, extraOpts...)
 	} else if m.err != nil {
@@ -1106,7 +1112,7 @@ func TestOrderFinalize(t *testing.T) {
 			if p == nil {
 				p = prov
 			}
-			o, err := tc.o.finalize(tc.db, tc.csr, tc.sa, p)
+			o, err := tc.o.finalize(context.Background(), tc.db, tc.csr, tc.sa, p)
 			if err != nil {
 				if assert.NotNil(t, tc.err) {
 					ae, ok := err.(*Error)
@@ -1127,3 +1133,98 @@ func TestOrderFinalize(t *testing.T) {
 		})
 	}
 }
+
+func TestPruneOrders(t *testing.T) {
+	now := clock.Now()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "acme.example.com"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	assert.FatalError(t, err)
+
+	values := map[string]interface{}{
+		"acme_orders/o1":                  &order{ID: "o1", AccountID: "accID", Expires: now.Add(-time.Minute), Authorizations: []string{"az1"}},
+		"acme_orders/o2":                  &order{ID: "o2", AccountID: "accID", Expires: now.Add(-time.Minute), Certificate: "c2"},
+		"acme_orders/o3":                  &order{ID: "o3", AccountID: "accID", Expires: now.Add(time.Minute)},
+		"acme_authzs/az1":                 &baseAuthz{ID: "az1", Identifier: Identifier{Type: "dns", Value: "acme.example.com"}, Challenges: []string{"ch1", "ch2"}},
+		"acme_challenges/ch1":             &baseChallenge{ID: "ch1"},
+		"acme_challenges/ch2":             &baseChallenge{ID: "ch2"},
+		"acme_certs/c2":                   &certificate{ID: "c2", Leaf: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})},
+		"acme_account-orders-index/accID": []string{"o1", "o2", "o3"},
+	}
+	store := map[string][]byte{}
+	for k, v := range values {
+		b, err := json.Marshal(v)
+		assert.FatalError(t, err)
+		store[k] = b
+	}
+	mockdb := &db.MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			if b, ok := store[string(bucket)+"/"+string(key)]; ok {
+				return b, nil
+			}
+			return nil, database.ErrNotFound
+		},
+		MDel: func(bucket, key []byte) error {
+			delete(store, string(bucket)+"/"+string(key))
+			return nil
+		},
+		MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+			assert.Equals(t, ordersByAccountIDTable, bucket)
+			store[string(bucket)+"/"+string(key)] = newval
+			return newval, true, nil
+		},
+		MList: func(bucket []byte) ([]*database.Entry, error) {
+			assert.Equals(t, orderTable, bucket)
+			var entries []*database.Entry
+			for _, id := range []string{"o1", "o2", "o3"} {
+				if b, ok := store["acme_orders/"+id]; ok {
+					entries = append(entries, &database.Entry{Bucket: bucket, Key: []byte(id), Value: b})
+				}
+			}
+			return entries, nil
+		},
+	}
+
+	a := &Authority{db: mockdb}
+	res, err := a.PruneOrders(now)
+	assert.FatalError(t, err)
+	assert.Equals(t, 4, res.Records)
+	assert.True(t, res.Bytes > 0)
+	assert.Equals(t, []string{"acme_account-orders-index/accID", "acme_certs/c2", "acme_orders/o2", "acme_orders/o3"}, sortedKeys(store))
+	oids, err := getOrderIDsByAccount(mockdb, "accID")
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"o2", "o3"}, oids)
+
+	// The order with a certificate is pruned after the certificate expires.
+	res, err = a.PruneOrders(now.Add(2 * time.Hour))
+	assert.FatalError(t, err)
+	assert.Equals(t, 3, res.Records)
+	assert.Equals(t, []string{"acme_account-orders-index/accID"}, sortedKeys(store))
+	oids, err = getOrderIDsByAccount(mockdb, "accID")
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{}, oids)
+
+	_, err = pruneOrders(&db.MockNoSQLDB{
+		MList: func(bucket []byte) ([]*database.Entry, error) {
+			return nil, errors.New("force")
+		},
+	}, now)
+	if assert.NotNil(t, err) {
+		assert.HasPrefix(t, err.Error(), "error listing orders: force")
+	}
+}
+
+func sortedKeys(m map[string][]byte) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"crypto/x509"
+	"net/http"
+	"strings"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/pkg/errors"
+)
+
+// AdminAuthority is the interface implemented by a CA authority that can
+// authenticate admin requests.
+type AdminAuthority interface {
+	AuthorizeAdmin(ott string) (string, error)
+	AuthorizeAdminCertificate(crt *x509.Certificate) (string, error)
+	AuthorizeAdminSSO(token string) (string, authority.AdminRole, error)
+	IntrospectToken(ott string) (*authority.TokenIntrospection, error)
+	MintToken(opts authority.MintOptions) (string, error)
+	GetSanitizedConfig() (map[string]interface{}, error)
+	ImportCA(opts authority.ImportCAOptions) error
+}
+
+// requireAdmin is a middleware that only calls the next handler if the request
+// is authenticated as an admin request. Admin requests can be authenticated
+// with an admin token in the Authorization header using the Bearer scheme, or
+// using an admin certificate in the TLS connection. If single sign-on is
+// configured, the Bearer token can also be an ID token of the OIDC provisioner,
+// and the role of the user must allow the given role of the route.
+func (h *caHandler) requireAdmin(required authority.AdminRole, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var (
+			admin string
+			role  authority.AdminRole
+			err   error
+		)
+		if ott, ok := getBearerToken(r); ok {
+			logOtt(w, ott)
+			admin, role, err = h.Authority.AuthorizeAdminSSO(ott)
+			if err == authority.ErrNotAdminSSOToken {
+				admin, err = h.Authority.AuthorizeAdmin(ott)
+			} else if err == nil && !role.Allows(required) {
+				WriteError(w, Forbidden(errors.Errorf("role %s of admin %s does not allow %s %s", role, admin, r.Method, r.URL.Path)))
+				return
+			}
+		} else if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+			admin, err = h.Authority.AuthorizeAdminCertificate(r.TLS.PeerCertificates[0])
+		} else {
+			err = errors.New("missing admin token or certificate")
+		}
+		if err != nil {
+			WriteError(w, Unauthorized(err))
+			return
+		}
+
+		logAdmin(w, admin)
+		next(w, r.WithContext(logging.WithUserID(r.Context(), admin)))
+	}
+}
+
+// AdminConfig is an HTTP handler that returns the configuration loaded by the
+// CA, with the default values applied and the secrets redacted.
+func (h *caHandler) AdminConfig(w http.ResponseWriter, r *http.Request) {
+	config, err := h.Authority.GetSanitizedConfig()
+	if err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+	JSON(w, config)
+}
+
+// getBearerToken returns the token in the Authorization header if the Bearer
+// scheme is used.
+func getBearerToken(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		if tok := strings.TrimSpace(auth[7:]); tok != "" {
+			return tok, true
+		}
+	}
+	return "", false
+}
+
+func logAdmin(w http.ResponseWriter, admin string) {
+	if rl, ok := w.(logging.ResponseLogger); ok {
+		rl.WithFields(map[string]interface{}{
+			"admin": admin,
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/go-chi/chi"
+	"github.com/smallstep/assert"
+)
+
+func Test_caHandler_requireAdmin(t *testing.T) {
+	cs := &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{parseCertificate(certPEM)},
+	}
+	tests := []struct {
+		name       string
+		header     string
+		tls        *tls.ConnectionState
+		auth       *mockAuthority
+		statusCode int
+		admin      string
+	}{
+		{"ok-token", "Bearer the-token", nil, &mockAuthority{
+			authorizeAdmin: func(ott string) (string, error) {
+				assert.Equals(t, "the-token", ott)
+				return "admin@smallstep.com", nil
+			},
+		}, http.StatusOK, "admin@smallstep.com"},
+		{"ok-token-case", "bearer the-token", cs, &mockAuthority{
+			authorizeAdmin: func(ott string) (string, error) {
+				return "admin@smallstep.com", nil
+			},
+		}, http.StatusOK, "admin@smallstep.com"},
+		{"ok-certificate", "", cs, &mockAuthority{
+			authorizeAdminCertificate: func(crt *x509.Certificate) (string, error) {
+				assert.Equals(t, cs.PeerCertificates[0], crt)
+				return "admin", nil
+			},
+		}, http.StatusOK, "admin"},
+		{"fail-no-credentials", "", nil, &mockAuthority{}, http.StatusUnauthorized, ""},
+		{"fail-no-peer-certificates", "", &tls.ConnectionState{}, &mockAuthority{}, http.StatusUnauthorized, ""},
+		{"fail-basic", "Basic Zm9vOmJhcg==", nil, &mockAuthority{}, http.StatusUnauthorized, ""},
+		{"fail-empty-bearer", "Bearer ", nil, &mockAuthority{}, http.StatusUnauthorized, ""},
+		{"fail-token", "Bearer the-token", nil, &mockAuthority{ret1: "", err: fmt.Errorf("an error")}, http.StatusUnauthorized, ""},
+		{"fail-certificate", "", cs, &mockAuthority{ret1: "", err: fmt.Errorf("an error")}, http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var called bool
+			h := New(tt.auth).(*caHandler)
+			next := func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				admin, ok := logging.GetUserID(r.Context())
+				assert.True(t, ok)
+				assert.Equals(t, tt.admin, admin)
+				w.WriteHeader(http.StatusOK)
+			}
+			req := httptest.NewRequest("GET", "http://example.com/admin", nil)
+			req.TLS = tt.tls
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			h.requireAdmin(authority.AdminRoleAdmin, next)(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			assert.Equals(t, tt.statusCode == http.StatusOK, called)
+		})
+	}
+}
+
+func Test_caHandler_requireAdmin_sso(t *testing.T) {
+	sso := func(role authority.AdminRole, err error) *mockAuthority {
+		return &mockAuthority{
+			authorizeAdminSSO: func(token string) (string, authority.AdminRole, error) {
+				assert.Equals(t, "the-id-token", token)
+				if err != nil {
+					return "", "", err
+				}
+				return "jane@example.com", role, nil
+			},
+			authorizeAdmin: func(ott string) (string, error) {
+				return "admin@smallstep.com", nil
+			},
+		}
+	}
+	tests := []struct {
+		name       string
+		method     string
+		required   authority.AdminRole
+		auth       *mockAuthority
+		statusCode int
+		admin      string
+	}{
+		{"ok-admin", "POST", authority.AdminRoleAdmin, sso(authority.AdminRoleAdmin, nil), http.StatusOK, "jane@example.com"},
+		{"ok-admin-read-only", "GET", authority.AdminRoleReadOnly, sso(authority.AdminRoleAdmin, nil), http.StatusOK, "jane@example.com"},
+		{"ok-read-only", "GET", authority.AdminRoleReadOnly, sso(authority.AdminRoleReadOnly, nil), http.StatusOK, "jane@example.com"},
+		{"ok-read-only-post", "POST", authority.AdminRoleReadOnly, sso(authority.AdminRoleReadOnly, nil), http.StatusOK, "jane@example.com"},
+		{"ok-not-sso", "POST", authority.AdminRoleAdmin, sso("", authority.ErrNotAdminSSOToken), http.StatusOK, "admin@smallstep.com"},
+		{"fail-read-only", "POST", authority.AdminRoleAdmin, sso(authority.AdminRoleReadOnly, nil), http.StatusForbidden, ""},
+		{"fail-read-only-get", "GET", authority.AdminRoleAdmin, sso(authority.AdminRoleReadOnly, nil), http.StatusForbidden, ""},
+		{"fail-token", "GET", authority.AdminRoleReadOnly, sso("", fmt.Errorf("an error")), http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var called bool
+			h := New(tt.auth).(*caHandler)
+			next := func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				admin, ok := logging.GetUserID(r.Context())
+				assert.True(t, ok)
+				assert.Equals(t, tt.admin, admin)
+				w.WriteHeader(http.StatusOK)
+			}
+			req := httptest.NewRequest(tt.method, "http://example.com/admin", nil)
+			req.Header.Set("Authorization", "Bearer the-id-token")
+			w := httptest.NewRecorder()
+			h.requireAdmin(tt.required, next)(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			assert.Equals(t, tt.statusCode == http.StatusOK, called)
+		})
+	}
+}
+
+func Test_caHandler_AdminConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     map[string]interface{}
+		err        error
+		statusCode int
+		expected   string
+	}{
+		{"ok", map[string]interface{}{"address": ":443", "password": "*****"}, nil, http.StatusOK, `{"address":":443","password":"*****"}`},
+		{"fail", nil, fmt.Errorf("an error"), http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{ret1: tt.config, err: tt.err}).(*caHandler)
+			req := httptest.NewRequest("GET", "http://example.com/admin/config", nil)
+			w := httptest.NewRecorder()
+			h.AdminConfig(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			body, err := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+			if tt.expected != "" {
+				assert.Equals(t, tt.expected, strings.TrimSpace(string(body)))
+			}
+		})
+	}
+}
+
+func Test_adminHandler_Route(t *testing.T) {
+	mux := chi.NewRouter()
+	NewAdmin(&mockAuthority{
+		authorizeAdmin: func(ott string) (string, error) {
+			if ott == "admin-token" {
+				return "admin", nil
+			}
+			return "", errors.New("not an admin")
+		},
+		checkHealth: func(ctx context.Context) *authority.Health {
+			return &authority.Health{Status: authority.HealthOK}
+		},
+		getSanitizedConfig: func() (map[string]interface{}, error) {
+			return map[string]interface{}{"address": ":443"}, nil
+		},
+	}).Route(mux)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		statusCode int
+	}{
+		{"ok-health", "GET", "/health", "", http.StatusOK},
+		{"ok-admin", "GET", "/admin/config", "admin-token", http.StatusOK},
+		{"fail-admin-token", "GET", "/admin/config", "other-token", http.StatusUnauthorized},
+		{"fail-sign", "POST", "/sign", "admin-token", http.StatusNotFound},
+		{"fail-roots", "GET", "/roots", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+			assert.Equals(t, tt.statusCode, w.Code)
+		})
+	}
+}
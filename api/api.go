@@ -2,13 +2,16 @@ package api
 
 import (
 	"context"
+	"crypto"
 	"crypto/dsa"
 	"crypto/ecdsa"
 	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/asn1"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
@@ -28,20 +31,47 @@ import (
 // Authority is the interface implemented by a CA authority.
 type Authority interface {
 	SSHAuthority
+	AdminAuthority
+	PendingAuthority
+	CertificatesAuthority
+	EventsAuthority
+	CacheAuthority
+	RateLimitAuthority
+	CORSAuthority
+	BodyLimitAuthority
+	TimeoutAuthority
+	RetentionAuthority
+	BackupAuthority
+	HealthAuthority
+	JournalAuthority
+	TransparencyAuthority
+	DiscoveryAuthority
+	JWTSVIDAuthority
+	NonceAuthority
+	CRLAuthority
+	InventoryAuthority
+	AuditAuthority
 	// context specifies the Authorize[Sign|Revoke|etc.] method.
 	Authorize(ctx context.Context, ott string) ([]provisioner.SignOption, error)
 	AuthorizeSign(ott string) ([]provisioner.SignOption, error)
 	GetTLSOptions() *tlsutil.TLSOptions
 	Root(shasum string) (*x509.Certificate, error)
-	Sign(cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
-	Renew(peer *x509.Certificate) ([]*x509.Certificate, error)
+	Sign(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
+	Renew(ctx context.Context, peer *x509.Certificate) ([]*x509.Certificate, error)
+	Rekey(ctx context.Context, peer *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error)
+	AuthorizeRenewToken(ctx context.Context, ott string) (*x509.Certificate, error)
+	RenewAfter(crt *x509.Certificate) time.Time
+	GenerateKey(signOpts []provisioner.SignOption, kty, crv string, size int) (crypto.Signer, error)
 	LoadProvisionerByCertificate(*x509.Certificate) (provisioner.Interface, error)
 	LoadProvisionerByID(string) (provisioner.Interface, error)
 	GetProvisioners(cursor string, limit int) (provisioner.List, string, error)
-	Revoke(*authority.RevokeOptions) error
+	GetProvisionersByType(typ provisioner.Type, cursor string, limit int) (provisioner.List, string, error)
+	Revoke(context.Context, *authority.RevokeOptions) error
 	GetEncryptedKey(kid string) (string, error)
 	GetRoots() (federation []*x509.Certificate, err error)
 	GetFederation() ([]*x509.Certificate, error)
+	GetIntermediates() ([]*x509.Certificate, error)
+	GetIssuingRoot(intermediate *x509.Certificate) (*x509.Certificate, error)
 }
 
 // TimeDuration is an alias of provisioner.TimeDuration
@@ -162,11 +192,6 @@ type RouterHandler interface {
 	Route(r Router)
 }
 
-// HealthResponse is the response object that returns the health of the server.
-type HealthResponse struct {
-	Status string `json:"status"`
-}
-
 // RootResponse is the response object that returns the PEM of a root certificate.
 type RootResponse struct {
 	RootPEM Certificate `json:"ca"`
@@ -174,10 +199,34 @@ type RootResponse struct {
 
 // SignRequest is the request body for a certificate signature request.
 type SignRequest struct {
-	CsrPEM    CertificateRequest `json:"csr"`
-	OTT       string             `json:"ott"`
-	NotAfter  TimeDuration       `json:"notAfter"`
-	NotBefore TimeDuration       `json:"notBefore"`
+	CsrPEM         CertificateRequest `json:"csr"`
+	OTT            string             `json:"ott"`
+	NotAfter       TimeDuration       `json:"notAfter"`
+	NotBefore      TimeDuration       `json:"notBefore"`
+	PKCS12Password string             `json:"pkcs12Password,omitempty"`
+	KeyGeneration  *KeyGeneration     `json:"keyGeneration,omitempty"`
+}
+
+// RekeyRequest is the request body for a certificate rekey request.
+type RekeyRequest struct {
+	CsrPEM         CertificateRequest `json:"csr"`
+	PKCS12Password string             `json:"pkcs12Password,omitempty"`
+}
+
+// Validate checks the fields of the RekeyRequest and returns nil if they are
+// ok or an error if something is wrong.
+func (s *RekeyRequest) Validate() error {
+	if s.CsrPEM.CertificateRequest == nil {
+		return BadRequest(errors.New("missing csr"))
+	}
+	if err := s.CsrPEM.CertificateRequest.CheckSignature(); err != nil {
+		return BadRequest(errors.Wrap(err, "invalid csr"))
+	}
+	if _, err := bmpString(s.PKCS12Password); err != nil {
+		return BadRequest(err)
+	}
+
+	return nil
 }
 
 // ProvisionersResponse is the response object that returns the list of
@@ -196,15 +245,30 @@ type ProvisionerKeyResponse struct {
 // Validate checks the fields of the SignRequest and returns nil if they are ok
 // or an error if something is wrong.
 func (s *SignRequest) Validate() error {
-	if s.CsrPEM.CertificateRequest == nil {
-		return BadRequest(errors.New("missing csr"))
-	}
-	if err := s.CsrPEM.CertificateRequest.CheckSignature(); err != nil {
-		return BadRequest(errors.Wrap(err, "invalid csr"))
+	if s.KeyGeneration != nil {
+		if err := s.KeyGeneration.Validate(); err != nil {
+			return err
+		}
+		if s.CsrPEM.CertificateRequest != nil {
+			return BadRequest(errors.New("csr cannot be used with keyGeneration"))
+		}
+		if s.PKCS12Password == "" {
+			return BadRequest(errors.New("keyGeneration requires a pkcs12Password"))
+		}
+	} else {
+		if s.CsrPEM.CertificateRequest == nil {
+			return BadRequest(errors.New("missing csr"))
+		}
+		if err := s.CsrPEM.CertificateRequest.CheckSignature(); err != nil {
+			return BadRequest(errors.Wrap(err, "invalid csr"))
+		}
 	}
 	if s.OTT == "" {
 		return BadRequest(errors.New("missing ott"))
 	}
+	if _, err := bmpString(s.PKCS12Password); err != nil {
+		return BadRequest(err)
+	}
 
 	return nil
 }
@@ -215,50 +279,226 @@ type SignResponse struct {
 	CaPEM        Certificate          `json:"ca"`
 	CertChainPEM []Certificate        `json:"certChain"`
 	TLSOptions   *tlsutil.TLSOptions  `json:"tlsOptions,omitempty"`
+	RenewAfter   *time.Time           `json:"renewAfter,omitempty"`
+	Warnings     []string             `json:"warnings,omitempty"`
 	TLS          *tls.ConnectionState `json:"-"`
 }
 
 // RootsResponse is the response object of the roots request.
 type RootsResponse struct {
 	Certificates []Certificate `json:"crts"`
+	NextCursor   string        `json:"nextCursor,omitempty"`
 }
 
 // FederationResponse is the response object of the federation request.
 type FederationResponse struct {
 	Certificates []Certificate `json:"crts"`
+	NextCursor   string        `json:"nextCursor,omitempty"`
+}
+
+// IntermediatesResponse is the response object of the intermediates request.
+type IntermediatesResponse struct {
+	Certificates []Certificate `json:"crts"`
 }
 
 // caHandler is the type used to implement the different CA HTTP endpoints.
 type caHandler struct {
 	Authority Authority
+	limiter   *rateLimiter
+	responses *responseCache
+	options
+}
+
+// Middleware wraps the handler of the route with the given pattern, e.g.
+// "/sign" or "/certificates/{serial}".
+type Middleware func(pattern string, next http.HandlerFunc) http.HandlerFunc
+
+type options struct {
+	pre    []Middleware
+	post   []Middleware
+	routes []func(r Router)
+}
+
+// Option is the type of the options passed to New and NewAdmin.
+type Option func(o *options)
+
+// WithPreMiddleware adds a middleware that runs before the body limits, the
+// rate limits and the timeouts of the CA, e.g. to authorize the requests. The
+// first middleware added is the first one to run.
+func WithPreMiddleware(m Middleware) Option {
+	return func(o *options) {
+		o.pre = append(o.pre, m)
+	}
+}
+
+// WithPostMiddleware adds a middleware that runs after the body limits, the
+// rate limits and the timeouts of the CA, right before the handler of the
+// route. The first middleware added is the first one to run.
+func WithPostMiddleware(m Middleware) Option {
+	return func(o *options) {
+		o.post = append(o.post, m)
+	}
+}
+
+// WithRoutes adds the routes added by the given function to the endpoints of
+// the CA. The handlers of these routes are wrapped by the same middlewares as
+// the CA endpoints. They are not added to the handler returned by NewAdmin.
+func WithRoutes(fn func(r Router)) Option {
+	return func(o *options) {
+		o.routes = append(o.routes, fn)
+	}
 }
 
 // New creates a new RouterHandler with the CA endpoints.
-func New(authority Authority) RouterHandler {
-	return &caHandler{
+func New(authority Authority, opts ...Option) RouterHandler {
+	h := &caHandler{
 		Authority: authority,
+		limiter:   newRateLimiter(authority),
+		responses: newResponseCache(),
 	}
+	for _, fn := range opts {
+		fn(&h.options)
+	}
+	return h
 }
 
-func (h *caHandler) Route(r Router) {
+// adminHandler serves only the health and admin endpoints of the CA API.
+type adminHandler struct {
+	*caHandler
+}
+
+// NewAdmin returns the handler of the health and admin endpoints of the CA
+// API, without the endpoints used to sign, renew or revoke certificates. It is
+// intended to be served in a separate listener.
+func NewAdmin(authority Authority, opts ...Option) RouterHandler {
+	return &adminHandler{
+		caHandler: New(authority, opts...).(*caHandler),
+	}
+}
+
+func (h *adminHandler) Route(r Router) {
+	r = h.wrapRouter(r)
 	r.MethodFunc("GET", "/health", h.Health)
-	r.MethodFunc("GET", "/root/{sha}", h.Root)
+	h.routeAdmin(r)
+}
+
+// middlewareRouter is a Router that wraps the handlers of all the routes with
+// a middleware that depends on the route pattern.
+type middlewareRouter struct {
+	Router
+	middleware func(pattern string, next http.HandlerFunc) http.HandlerFunc
+}
+
+// MethodFunc adds the route with the handler wrapped by the middleware.
+func (r *middlewareRouter) MethodFunc(method, pattern string, h http.HandlerFunc) {
+	r.Router.MethodFunc(method, pattern, r.middleware(pattern, h))
+}
+
+// wrapRouter returns a Router that applies the body limits, the rate limits
+// and the timeouts to all the routes. The body limits are applied before the
+// rate limits, and the timeouts only to the requests that are not limited. The
+// middlewares added with WithPreMiddleware run before them, and the ones added
+// with WithPostMiddleware after them.
+func (h *caHandler) wrapRouter(r Router) Router {
+	for _, m := range h.pre {
+		r = &middlewareRouter{Router: r, middleware: m}
+	}
+	r = &middlewareRouter{Router: r, middleware: h.limitBody}
+	if h.limiter != nil {
+		r = &middlewareRouter{Router: r, middleware: h.limiter.middleware}
+	}
+	r = &middlewareRouter{Router: r, middleware: h.timeout}
+	for _, m := range h.post {
+		r = &middlewareRouter{Router: r, middleware: m}
+	}
+	return r
+}
+
+// routeExtra adds the routes added with WithRoutes.
+func (h *caHandler) routeExtra(r Router) {
+	for _, fn := range h.routes {
+		fn(r)
+	}
+}
+
+func (h *caHandler) Route(r Router) {
+	h.route(h.wrapRouter(r))
+}
+
+// route adds the CA endpoints to the given router. It is also used to generate
+// the OpenAPI specification of the API.
+func (h *caHandler) route(r Router) {
+	r.MethodFunc("GET", "/health", h.cors(h.Health))
+	r.MethodFunc("GET", "/versions", h.cors(h.Versions))
+	r.MethodFunc("GET", "/root/{sha}", h.cors(h.Root))
+	r.MethodFunc("GET", "/bootstrap", h.cors(h.Bootstrap))
+	r.MethodFunc("GET", DiscoveryPath, h.cors(h.Discovery))
+	r.MethodFunc("GET", OpenAPIPath, h.cors(h.OpenAPI))
+	r.MethodFunc("POST", "/nonce", h.Nonce)
 	r.MethodFunc("POST", "/sign", h.Sign)
 	r.MethodFunc("POST", "/renew", h.Renew)
+	r.MethodFunc("POST", "/rekey", h.Rekey)
 	r.MethodFunc("POST", "/revoke", h.Revoke)
-	r.MethodFunc("GET", "/provisioners", h.Provisioners)
-	r.MethodFunc("GET", "/provisioners/{kid}/encrypted-key", h.ProvisionerKey)
-	r.MethodFunc("GET", "/roots", h.Roots)
-	r.MethodFunc("GET", "/federation", h.Federation)
+	r.MethodFunc("GET", "/provisioners", h.cors(h.Provisioners))
+	r.MethodFunc("GET", "/provisioners/{kid}/encrypted-key", h.cors(h.ProvisionerKey))
+	r.MethodFunc("GET", "/roots", h.cors(h.Roots))
+	r.MethodFunc("GET", "/roots.pem", h.cors(h.RootsPEM))
+	r.MethodFunc("GET", "/roots.p7b", h.cors(h.RootsPKCS7))
+	r.MethodFunc("POST", "/roots.p12", h.RootsPKCS12)
+	r.MethodFunc("POST", "/roots.jks", h.RootsJKS)
+	r.MethodFunc("GET", "/federation", h.cors(h.Federation))
+	r.MethodFunc("GET", "/federation.p7b", h.cors(h.FederationPKCS7))
+	r.MethodFunc("POST", "/federation.p12", h.FederationPKCS12)
+	r.MethodFunc("POST", "/federation.jks", h.FederationJKS)
+	r.MethodFunc("GET", "/intermediates", h.cors(h.Intermediates))
+	r.MethodFunc("GET", "/transparency/sth", h.cors(h.SignedTreeHead))
+	r.MethodFunc("GET", "/transparency/entries", h.cors(h.LogEntries))
+	r.MethodFunc("GET", "/transparency/proof/{serial}", h.cors(h.InclusionProof))
+	r.MethodFunc("POST", "/jwt-svid", h.JWTSVID)
+	r.MethodFunc("GET", "/jwt-svid/keys", h.cors(h.JWTSVIDKeys))
+	r.MethodFunc("GET", "/crl", h.cors(h.CRL))
+	// CORS preflight requests of the read-only endpoints
+	h.routeCORS(r)
 	// For compatibility with old code:
 	r.MethodFunc("POST", "/re-sign", h.Renew)
 	// SSH CA
 	r.MethodFunc("POST", "/sign-ssh", h.SignSSH)
+	// Certificate requests waiting for approval
+	r.MethodFunc("GET", "/pending/{id}", h.Pending)
+	// Admin
+	h.routeAdmin(r)
+	// Routes added by the programs embedding the CA
+	h.routeExtra(r)
 }
 
-// Health is an HTTP handler that returns the status of the server.
-func (h *caHandler) Health(w http.ResponseWriter, r *http.Request) {
-	JSON(w, HealthResponse{Status: "ok"})
+// routeAdmin adds the endpoints that require an admin token or certificate.
+func (h *caHandler) routeAdmin(r Router) {
+	r.MethodFunc("GET", "/certificates", h.requireAdmin(authority.AdminRoleReadOnly, h.Certificates))
+	r.MethodFunc("GET", "/certificates/expiring", h.requireAdmin(authority.AdminRoleReadOnly, h.ExpiringCertificates))
+	r.MethodFunc("GET", "/certificates/{serial}", h.requireAdmin(authority.AdminRoleReadOnly, h.CertificateDetails))
+	r.MethodFunc("GET", "/stats", h.requireAdmin(authority.AdminRoleReadOnly, h.Stats))
+	r.MethodFunc("GET", "/events", h.requireAdmin(authority.AdminRoleReadOnly, h.Events))
+	r.MethodFunc("POST", "/admin/introspect", h.requireAdmin(authority.AdminRoleReadOnly, h.Introspect))
+	r.MethodFunc("POST", "/admin/token", h.requireAdmin(authority.AdminRoleAdmin, h.MintToken))
+	r.MethodFunc("GET", "/admin/config", h.requireAdmin(authority.AdminRoleReadOnly, h.AdminConfig))
+	r.MethodFunc("POST", "/admin/ca/import", h.requireAdmin(authority.AdminRoleAdmin, h.ImportCA))
+	r.MethodFunc("GET", "/admin/ratelimit", h.requireAdmin(authority.AdminRoleReadOnly, h.RateLimitStats))
+	r.MethodFunc("GET", "/admin/retention", h.requireAdmin(authority.AdminRoleReadOnly, h.RetentionStats))
+	r.MethodFunc("GET", "/admin/backup", h.requireAdmin(authority.AdminRoleAdmin, h.Backup))
+	r.MethodFunc("POST", "/admin/restore", h.requireAdmin(authority.AdminRoleAdmin, h.Restore))
+	r.MethodFunc("GET", "/admin/journal", h.requireAdmin(authority.AdminRoleReadOnly, h.Journal))
+	r.MethodFunc("GET", "/admin/audit", h.requireAdmin(authority.AdminRoleReadOnly, h.Audit))
+	// Certificate requests waiting for approval
+	r.MethodFunc("GET", "/admin/pending", h.requireAdmin(authority.AdminRoleReadOnly, h.AdminPendingRequests))
+	r.MethodFunc("GET", "/admin/pending/{id}", h.requireAdmin(authority.AdminRoleReadOnly, h.AdminPendingRequest))
+	r.MethodFunc("POST", "/admin/pending/{id}/approve", h.requireAdmin(authority.AdminRoleAdmin, h.AdminApprovePendingRequest))
+	r.MethodFunc("POST", "/admin/pending/{id}/deny", h.requireAdmin(authority.AdminRoleAdmin, h.AdminDenyPendingRequest))
+	// Inventory of hosts and workloads
+	r.MethodFunc("GET", "/admin/inventory", h.requireAdmin(authority.AdminRoleReadOnly, h.Inventory))
+	r.MethodFunc("GET", "/admin/inventory/{name}", h.requireAdmin(authority.AdminRoleReadOnly, h.InventoryEntry))
+	r.MethodFunc("PUT", "/admin/inventory/{name}", h.requireAdmin(authority.AdminRoleAdmin, h.RegisterInventoryEntry))
+	r.MethodFunc("DELETE", "/admin/inventory/{name}", h.requireAdmin(authority.AdminRoleAdmin, h.DeleteInventoryEntry))
+	r.MethodFunc("POST", "/admin/inventory/{name}/certificates", h.requireAdmin(authority.AdminRoleAdmin, h.LinkInventoryCertificate))
 }
 
 // Root is an HTTP handler that using the SHA256 from the URL, returns the root
@@ -273,7 +513,17 @@ func (h *caHandler) Root(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	JSON(w, &RootResponse{RootPEM: Certificate{cert}})
+	contentType, b, err := encodeCertificates(r, []*x509.Certificate{cert})
+	if err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+	w.Header().Add("Vary", "Accept")
+	if contentType == "" {
+		h.writeCacheableJSON(w, r, &RootResponse{RootPEM: Certificate{cert}}, http.StatusOK)
+	} else {
+		h.writeCacheable(w, r, contentType, b, http.StatusOK)
+	}
 }
 
 func certChainToPEM(certChain []*x509.Certificate) []Certificate {
@@ -288,6 +538,12 @@ func certChainToPEM(certChain []*x509.Certificate) []Certificate {
 // one-time-token (ott) from the body and creates a new certificate with the
 // information in the certificate request.
 func (h *caHandler) Sign(w http.ResponseWriter, r *http.Request) {
+	includeRoot, err := parseChain(r)
+	if err != nil {
+		WriteError(w, BadRequest(err))
+		return
+	}
+
 	var body SignRequest
 	if err := ReadJSON(r.Body, &body); err != nil {
 		WriteError(w, BadRequest(errors.Wrap(err, "error reading request body")))
@@ -305,57 +561,250 @@ func (h *caHandler) Sign(w http.ResponseWriter, r *http.Request) {
 		NotAfter:  body.NotAfter,
 	}
 
-	signOpts, err := h.Authority.AuthorizeSign(body.OTT)
+	signOpts, err := h.Authority.Authorize(provisioner.NewContextWithMethod(r.Context(), provisioner.SignMethod), body.OTT)
 	if err != nil {
 		WriteError(w, Unauthorized(err))
 		return
 	}
 
-	certChain, err := h.Authority.Sign(body.CsrPEM.CertificateRequest, opts, signOpts...)
+	// Queue the request if an admin must approve it. The generated keys are
+	// only returned with the certificate, so they cannot wait for approval.
+	approvalRequired := h.Authority.IsApprovalRequired(signOpts)
+	if approvalRequired && body.KeyGeneration != nil {
+		WriteError(w, BadRequest(errors.New("keyGeneration cannot be used with a provisioner that requires approval")))
+		return
+	}
+
+	// Generate the key and the certificate request if the client asks for it.
+	// The key is only returned in the PKCS#12 response, it is never stored.
+	var key crypto.Signer
+	if kg := body.KeyGeneration; kg != nil {
+		if key, err = h.Authority.GenerateKey(signOpts, kg.KeyType, kg.Curve, kg.Size); err != nil {
+			WriteError(w, Forbidden(err))
+			return
+		}
+		csr, err := kg.newCertificateRequest(key)
+		if err != nil {
+			WriteError(w, InternalServerError(err))
+			return
+		}
+		body.CsrPEM = CertificateRequest{csr}
+	}
+
+	if approvalRequired {
+		pr, err := h.Authority.CreatePendingRequest(body.CsrPEM.CertificateRequest, opts, signOpts...)
+		if err != nil {
+			WriteError(w, Forbidden(err))
+			return
+		}
+		JSONStatus(w, &PendingResponse{
+			ID:     pr.ID,
+			Status: pr.Status,
+		}, http.StatusAccepted)
+		return
+	}
+
+	certChain, err := h.Authority.Sign(r.Context(), body.CsrPEM.CertificateRequest, opts, signOpts...)
 	if err != nil {
 		WriteError(w, Forbidden(err))
 		return
 	}
+	if includeRoot {
+		if certChain, err = h.appendRoot(certChain); err != nil {
+			WriteError(w, InternalServerError(err))
+			return
+		}
+	}
+	logCertificate(w, certChain[0])
+	if body.PKCS12Password != "" {
+		h.writePKCS12SignResponse(w, certChain, key, body.PKCS12Password)
+		return
+	}
+	h.writeSignResponse(w, r, certChain)
+}
+
+// issuerExpiryWarning is the warning sent with a certificate that expires with
+// its issuer, usually because its validity has been truncated.
+const issuerExpiryWarning = "the certificate expires with its issuer, its validity has been truncated"
+
+// signWarnings returns the warnings about the given certificate chain.
+func signWarnings(certChain []*x509.Certificate) []string {
+	if len(certChain) > 1 && certChain[0].NotAfter.Equal(certChain[1].NotAfter) {
+		return []string{issuerExpiryWarning}
+	}
+	return nil
+}
+
+// writeSignResponse writes the given certificate chain with the format
+// negotiated with the request, by default the SignResponse is written. The
+// warnings are also sent in Warning headers, for the other formats.
+func (h *caHandler) writeSignResponse(w http.ResponseWriter, r *http.Request, certChain []*x509.Certificate) {
+	for _, warning := range signWarnings(certChain) {
+		w.Header().Add("Warning", `299 - "`+warning+`"`)
+	}
+	if !writeCertificates(w, r, certChain, http.StatusCreated) {
+		JSONStatus(w, h.newSignResponse(certChain), http.StatusCreated)
+	}
+}
+
+// writePKCS12SignResponse writes the given certificate chain and, if it is not
+// nil, its private key as a PKCS#12 key store protected with the given
+// password.
+func (h *caHandler) writePKCS12SignResponse(w http.ResponseWriter, certChain []*x509.Certificate, key crypto.PrivateKey, password string) {
+	b, err := encodePKCS12KeyStore(certChain, key, password)
+	if err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+	for _, warning := range signWarnings(certChain) {
+		w.Header().Add("Warning", `299 - "`+warning+`"`)
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Disposition", `attachment; filename="certificate.p12"`)
+	writeBody(w, PKCS12ContentType, b, http.StatusCreated)
+}
+
+// newSignResponse returns the SignResponse for the given certificate chain.
+func (h *caHandler) newSignResponse(certChain []*x509.Certificate) *SignResponse {
 	certChainPEM := certChainToPEM(certChain)
 	var caPEM Certificate
 	if len(certChainPEM) > 0 {
 		caPEM = certChainPEM[1]
 	}
-	logCertificate(w, certChain[0])
-	JSONStatus(w, &SignResponse{
+	res := &SignResponse{
 		ServerPEM:    certChainPEM[0],
 		CaPEM:        caPEM,
 		CertChainPEM: certChainPEM,
 		TLSOptions:   h.Authority.GetTLSOptions(),
-	}, http.StatusCreated)
+		Warnings:     signWarnings(certChain),
+	}
+	// Hint when the certificate should be renewed.
+	if renewAfter := h.Authority.RenewAfter(certChain[0]); !renewAfter.IsZero() {
+		renewAfter = renewAfter.UTC().Truncate(time.Second)
+		res.RenewAfter = &renewAfter
+	}
+	return res
 }
 
 // Renew uses the information of certificate in the TLS connection to create a
-// new one.
+// new one. Instead of the TLS connection, the certificate can be sent in a
+// token in the Authorization header using the Bearer scheme; this allows the
+// renewal of a certificate that expired within the renewal grace period.
 func (h *caHandler) Renew(w http.ResponseWriter, r *http.Request) {
+	ott, hasToken := getBearerToken(r)
+	if !hasToken && (r.TLS == nil || len(r.TLS.PeerCertificates) == 0) {
+		WriteError(w, BadRequest(errors.New("missing peer certificate")))
+		return
+	}
+
+	includeRoot, err := parseChain(r)
+	if err != nil {
+		WriteError(w, BadRequest(err))
+		return
+	}
+
+	var peer *x509.Certificate
+	if hasToken {
+		logOtt(w, ott)
+		if peer, err = h.Authority.AuthorizeRenewToken(r.Context(), ott); err != nil {
+			WriteError(w, Unauthorized(err))
+			return
+		}
+	} else {
+		peer = r.TLS.PeerCertificates[0]
+	}
+
+	// A token can renew a certificate different from the one in the TLS
+	// connection, the provisioners pinning the renewal key reject them and
+	// the renewals without mTLS.
+	ctx := r.Context()
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		ctx = authority.NewContextWithRenewalKey(ctx, r.TLS.PeerCertificates[0].PublicKey)
+	}
+	certChain, err := h.Authority.Renew(ctx, peer)
+	if err != nil {
+		WriteError(w, Forbidden(err))
+		return
+	}
+	if includeRoot {
+		if certChain, err = h.appendRoot(certChain); err != nil {
+			WriteError(w, InternalServerError(err))
+			return
+		}
+	}
+
+	logCertificate(w, certChain[0])
+	h.writeSignResponse(w, r, certChain)
+}
+
+// Rekey is similar to Renew, but it uses the public key of the CSR in the
+// request body for the new certificate. The identity of the certificate is
+// the one of the peer certificate, the subject and SANs of the CSR are
+// ignored.
+func (h *caHandler) Rekey(w http.ResponseWriter, r *http.Request) {
 	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
 		WriteError(w, BadRequest(errors.New("missing peer certificate")))
 		return
 	}
 
-	certChain, err := h.Authority.Renew(r.TLS.PeerCertificates[0])
+	includeRoot, err := parseChain(r)
+	if err != nil {
+		WriteError(w, BadRequest(err))
+		return
+	}
+
+	var body RekeyRequest
+	if err := ReadJSON(r.Body, &body); err != nil {
+		WriteError(w, BadRequest(errors.Wrap(err, "error reading request body")))
+		return
+	}
+	if err := body.Validate(); err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	certChain, err := h.Authority.Rekey(r.Context(), r.TLS.PeerCertificates[0], body.CsrPEM.PublicKey)
 	if err != nil {
 		WriteError(w, Forbidden(err))
 		return
 	}
-	certChainPEM := certChainToPEM(certChain)
-	var caPEM Certificate
-	if len(certChainPEM) > 0 {
-		caPEM = certChainPEM[1]
+	if includeRoot {
+		if certChain, err = h.appendRoot(certChain); err != nil {
+			WriteError(w, InternalServerError(err))
+			return
+		}
 	}
 
 	logCertificate(w, certChain[0])
-	JSONStatus(w, &SignResponse{
-		ServerPEM:    certChainPEM[0],
-		CaPEM:        caPEM,
-		CertChainPEM: certChainPEM,
-		TLSOptions:   h.Authority.GetTLSOptions(),
-	}, http.StatusCreated)
+	if body.PKCS12Password != "" {
+		h.writePKCS12SignResponse(w, certChain, nil, body.PKCS12Password)
+		return
+	}
+	h.writeSignResponse(w, r, certChain)
+}
+
+// parseChain parses the chain query parameter of the sign, renew and rekey
+// requests. It returns true if the root must be included in the certificate
+// chain of the response. By default the chain includes the leaf and the
+// intermediates.
+func parseChain(r *http.Request) (bool, error) {
+	switch chain := r.URL.Query().Get("chain"); chain {
+	case "", "intermediates":
+		return false, nil
+	case "root":
+		return true, nil
+	default:
+		return false, errors.Errorf("unsupported chain %s, use intermediates or root", chain)
+	}
+}
+
+// appendRoot appends the root that signed the last certificate of the chain.
+func (h *caHandler) appendRoot(certChain []*x509.Certificate) ([]*x509.Certificate, error) {
+	root, err := h.Authority.GetIssuingRoot(certChain[len(certChain)-1])
+	if err != nil {
+		return nil, err
+	}
+	return append(certChain, root), nil
 }
 
 // Provisioners returns the list of provisioners configured in the authority.
@@ -366,15 +815,33 @@ func (h *caHandler) Provisioners(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	p, next, err := h.Authority.GetProvisioners(cursor, limit)
+	var p provisioner.List
+	var next string
+	if v := r.URL.Query().Get("type"); v != "" {
+		typ, err := parseProvisionerType(v)
+		if err != nil {
+			WriteError(w, BadRequest(err))
+			return
+		}
+		p, next, err = h.Authority.GetProvisionersByType(typ, cursor, limit)
+	} else {
+		p, next, err = h.Authority.GetProvisioners(cursor, limit)
+	}
 	if err != nil {
 		WriteError(w, InternalServerError(err))
 		return
 	}
-	JSON(w, &ProvisionersResponse{
+	resp := &ProvisionersResponse{
 		Provisioners: p,
 		NextCursor:   next,
-	})
+	}
+	// The first page is the most requested one, it is only encoded when it
+	// changes.
+	if cursor == "" && limit == 0 && r.URL.Query().Get("type") == "" {
+		h.writeStaticJSON(w, r, "provisioners", provisionersSource(p, next), resp, http.StatusOK)
+	} else {
+		h.writeCacheableJSON(w, r, resp, http.StatusOK)
+	}
 }
 
 // ProvisionerKey returns the encrypted key of a provisioner by it's key id.
@@ -388,40 +855,106 @@ func (h *caHandler) ProvisionerKey(w http.ResponseWriter, r *http.Request) {
 	JSON(w, &ProvisionerKeyResponse{key})
 }
 
-// Roots returns all the root certificates for the CA.
+// Roots returns all the root certificates for the CA. The response is
+// paginated if the cursor or limit parameters are set.
 func (h *caHandler) Roots(w http.ResponseWriter, r *http.Request) {
+	cursor, limit, err := parseCursor(r)
+	if err != nil {
+		WriteError(w, BadRequest(err))
+		return
+	}
+
 	roots, err := h.Authority.GetRoots()
 	if err != nil {
 		WriteError(w, Forbidden(err))
 		return
 	}
+	roots, next, err := paginateCertificates(roots, cursor, limit)
+	if err != nil {
+		WriteError(w, BadRequest(err))
+		return
+	}
+
+	// Large bundles are streamed, and the unpaginated response is only
+	// encoded when it changes.
+	unpaginated := cursor == "" && limit == 0
+	if unpaginated && len(roots) > streamThreshold {
+		streamCertificates(w, roots, http.StatusCreated)
+		return
+	}
 
 	certs := make([]Certificate, len(roots))
 	for i := range roots {
 		certs[i] = Certificate{roots[i]}
 	}
 
-	JSONStatus(w, &RootsResponse{
+	resp := &RootsResponse{
 		Certificates: certs,
-	}, http.StatusCreated)
+		NextCursor:   next,
+	}
+	if unpaginated {
+		h.writeStaticJSON(w, r, "roots", certificatesSource(roots), resp, http.StatusCreated)
+	} else {
+		h.writeCacheableJSON(w, r, resp, http.StatusCreated)
+	}
+}
+
+// Intermediates returns the chain of intermediate certificates used to sign
+// new certificates.
+func (h *caHandler) Intermediates(w http.ResponseWriter, r *http.Request) {
+	intermediates, err := h.Authority.GetIntermediates()
+	if err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+
+	JSON(w, &IntermediatesResponse{
+		Certificates: certChainToPEM(intermediates),
+	})
 }
 
-// Federation returns all the public certificates in the federation.
+// Federation returns all the public certificates in the federation. The
+// response is paginated if the cursor or limit parameters are set.
 func (h *caHandler) Federation(w http.ResponseWriter, r *http.Request) {
+	cursor, limit, err := parseCursor(r)
+	if err != nil {
+		WriteError(w, BadRequest(err))
+		return
+	}
+
 	federated, err := h.Authority.GetFederation()
 	if err != nil {
 		WriteError(w, Forbidden(err))
 		return
 	}
+	federated, next, err := paginateCertificates(federated, cursor, limit)
+	if err != nil {
+		WriteError(w, BadRequest(err))
+		return
+	}
+
+	// Large bundles are streamed, and the unpaginated response is only
+	// encoded when it changes.
+	unpaginated := cursor == "" && limit == 0
+	if unpaginated && len(federated) > streamThreshold {
+		streamCertificates(w, federated, http.StatusCreated)
+		return
+	}
 
 	certs := make([]Certificate, len(federated))
 	for i := range federated {
 		certs[i] = Certificate{federated[i]}
 	}
 
-	JSONStatus(w, &FederationResponse{
+	resp := &FederationResponse{
 		Certificates: certs,
-	}, http.StatusCreated)
+		NextCursor:   next,
+	}
+	if unpaginated {
+		h.writeStaticJSON(w, r, "federation", certificatesSource(federated), resp, http.StatusCreated)
+	} else {
+		h.writeCacheableJSON(w, r, resp, http.StatusCreated)
+	}
 }
 
 var oidStepProvisioner = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 37476, 9000, 64, 1}
@@ -478,6 +1011,56 @@ func parseCursor(r *http.Request) (cursor string, limit int, err error) {
 	return
 }
 
+// paginateCertificates returns the page of the given certificates that starts
+// with the certificate whose SHA-256 fingerprint is the cursor. The cursor of
+// the next page is empty in the last page. For backwards compatibility all the
+// certificates are returned if the cursor and limit are not set.
+func paginateCertificates(certs []*x509.Certificate, cursor string, limit int) ([]*x509.Certificate, string, error) {
+	if cursor == "" && limit == 0 {
+		return certs, "", nil
+	}
+	switch {
+	case limit <= 0:
+		limit = authority.DefaultCertificatesLimit
+	case limit > authority.DefaultCertificatesMax:
+		limit = authority.DefaultCertificatesMax
+	}
+
+	start := 0
+	if cursor != "" {
+		start = -1
+		for i, crt := range certs {
+			if fingerprint(crt) == strings.ToLower(cursor) {
+				start = i
+				break
+			}
+		}
+		if start == -1 {
+			return nil, "", errors.Errorf("cursor %s was not found", cursor)
+		}
+	}
+
+	end := start + limit
+	if end >= len(certs) {
+		return certs[start:], "", nil
+	}
+	return certs[start:end], fingerprint(certs[end]), nil
+}
+
+// fingerprint returns the hex encoded SHA-256 of the certificate.
+func fingerprint(crt *x509.Certificate) string {
+	sum := sha256.Sum256(crt.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// parseProvisionerType returns the provisioner type with the given name.
+func parseProvisionerType(name string) (provisioner.Type, error) {
+	if typ, ok := provisioner.TypeByName(name); ok {
+		return typ, nil
+	}
+	return 0, errors.Errorf("unsupported provisioner type %s", name)
+}
+
 // TODO: add support for Ed25519 once it's supported
 func fmtPublicKey(cert *x509.Certificate) string {
 	var params string
@@ -3,6 +3,7 @@ package api
 import (
 	"bytes"
 	"context"
+	"crypto"
 	"crypto/dsa"
 	"crypto/ecdsa"
 	"crypto/elliptic"
@@ -23,14 +24,18 @@ import (
 	"testing"
 	"time"
 
+	"github.com/RTradeLtd/ca-certificates/audit"
 	"github.com/RTradeLtd/ca-certificates/authority"
 	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/RTradeLtd/ca-certificates/events"
 	"github.com/RTradeLtd/ca-certificates/logging"
 	"github.com/RTradeLtd/ca-cli/crypto/tlsutil"
 	"github.com/RTradeLtd/ca-cli/jose"
 	"github.com/go-chi/chi"
 	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
+	"golang.org/x/crypto/pkcs12"
 	"golang.org/x/crypto/ssh"
 )
 
@@ -415,6 +420,33 @@ func TestSignRequest_Validate(t *testing.T) {
 	}
 }
 
+func TestRekeyRequest_Validate(t *testing.T) {
+	csr := parseCertificateRequest(csrPEM)
+	bad := parseCertificateRequest(csrPEM)
+	bad.Signature[0]++
+	tests := []struct {
+		name   string
+		csrPEM CertificateRequest
+		err    error
+	}{
+		{"ok", CertificateRequest{csr}, nil},
+		{"missing csr", CertificateRequest{}, errors.New("missing csr")},
+		{"invalid csr", CertificateRequest{bad}, errors.New("invalid csr")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &RekeyRequest{CsrPEM: tt.csrPEM}
+			if err := s.Validate(); err != nil {
+				if assert.NotNil(t, tt.err) {
+					assert.HasPrefix(t, err.Error(), tt.err.Error())
+				}
+			} else {
+				assert.Nil(t, tt.err)
+			}
+		})
+	}
+}
+
 type mockProvisioner struct {
 	ret1, ret2, ret3 interface{}
 	err              error
@@ -505,13 +537,63 @@ type mockAuthority struct {
 	signSSH                      func(key ssh.PublicKey, opts provisioner.SSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error)
 	signSSHAddUser               func(key ssh.PublicKey, cert *ssh.Certificate) (*ssh.Certificate, error)
 	renew                        func(cert *x509.Certificate) ([]*x509.Certificate, error)
+	rekey                        func(cert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error)
+	authorizeRenewToken          func(ott string) (*x509.Certificate, error)
+	renewAfter                   func(crt *x509.Certificate) time.Time
 	loadProvisionerByCertificate func(cert *x509.Certificate) (provisioner.Interface, error)
 	loadProvisionerByID          func(provID string) (provisioner.Interface, error)
+	loadProvisionerByToken       func(ott string) (provisioner.Interface, error)
 	getProvisioners              func(nextCursor string, limit int) (provisioner.List, string, error)
+	getProvisionersByType        func(typ provisioner.Type, nextCursor string, limit int) (provisioner.List, string, error)
 	revoke                       func(*authority.RevokeOptions) error
 	getEncryptedKey              func(kid string) (string, error)
 	getRoots                     func() ([]*x509.Certificate, error)
 	getFederation                func() ([]*x509.Certificate, error)
+	getIntermediates             func() ([]*x509.Certificate, error)
+	getIssuingRoot               func(intermediate *x509.Certificate) (*x509.Certificate, error)
+	authorizeAdmin               func(ott string) (string, error)
+	authorizeAdminCertificate    func(crt *x509.Certificate) (string, error)
+	authorizeAdminSSO            func(token string) (string, authority.AdminRole, error)
+	introspectToken              func(ott string) (*authority.TokenIntrospection, error)
+	mintToken                    func(opts authority.MintOptions) (string, error)
+	getSanitizedConfig           func() (map[string]interface{}, error)
+	importCA                     func(opts authority.ImportCAOptions) error
+	isApprovalRequired           func(signOpts []provisioner.SignOption) bool
+	generateKey                  func(signOpts []provisioner.SignOption, kty, crv string, size int) (crypto.Signer, error)
+	createPendingRequest         func(cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) (*authority.PendingRequest, error)
+	getPendingRequest            func(id string) (*authority.PendingRequest, error)
+	getPendingRequests           func(status authority.PendingStatus) ([]*authority.PendingRequest, error)
+	approvePendingRequest        func(id, reviewer string) (*authority.PendingRequest, error)
+	denyPendingRequest           func(id, reviewer, reason string) (*authority.PendingRequest, error)
+	getCertificates              func(filter authority.CertificateFilter, cursor string, limit int) ([]*authority.CertificateInfo, string, error)
+	getCertificate               func(serial string) (*authority.CertificateInfo, error)
+	getExpiringCertificates      func(filter authority.CertificateFilter, within time.Duration) ([]*authority.CertificateInfo, error)
+	getStats                     func(from, to time.Time) ([]*authority.ProvisionerStats, error)
+	subscribeEvents              func(lastID string) (<-chan *events.Event, func())
+	getCacheControl              func() string
+	getRateLimitConfig           func() *authority.RateLimitConfig
+	getCORSConfig                func() *authority.CORSConfig
+	getBodyLimits                func() *authority.BodyLimitConfig
+	getTimeouts                  func() *authority.TimeoutConfig
+	getRetentionStats            func() []*db.PrunerStats
+	backup                       func() (*authority.Backup, error)
+	restore                      func(b *authority.Backup) error
+	checkHealth                  func(ctx context.Context) *authority.Health
+	getJournal                   func(from, to time.Time) ([]*db.JournalEntry, error)
+	getSignedTreeHead            func() (*authority.SignedTreeHead, error)
+	getLogEntries                func(start, end int64) ([]*db.LogEntry, error)
+	getInclusionProof            func(serial string, treeSize int64) (*authority.InclusionProof, error)
+	getDiscovery                 func() *authority.Discovery
+	signJWTSVID                  func(ctx context.Context, spiffeID string, audience []string, signOpts ...provisioner.SignOption) (string, time.Time, error)
+	getJWTSVIDKeys               func() jose.JSONWebKeySet
+	newNonce                     func() (string, time.Time, error)
+	getCRL                       func() (*db.CRLInfo, error)
+	registerInventoryEntry       func(name string, opts authority.InventoryOptions) (*db.InventoryEntry, error)
+	getInventoryEntry            func(name string) (*db.InventoryEntry, error)
+	getInventoryEntries          func(filter authority.InventoryFilter, cursor string, limit int) ([]*db.InventoryEntry, string, error)
+	deleteInventoryEntry         func(name string) error
+	linkInventoryCertificate     func(name, serial string) (*db.InventoryEntry, error)
+	getAuditEntries              func(filter audit.Filter, cursor string, limit int) ([]*audit.Entry, string, error)
 }
 
 // TODO: remove once Authorize is deprecated.
@@ -540,34 +622,55 @@ func (m *mockAuthority) Root(shasum string) (*x509.Certificate, error) {
 	return m.ret1.(*x509.Certificate), m.err
 }
 
-func (m *mockAuthority) Sign(cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+func (m *mockAuthority) Sign(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
 	if m.sign != nil {
 		return m.sign(cr, opts, signOpts...)
 	}
 	return []*x509.Certificate{m.ret1.(*x509.Certificate), m.ret2.(*x509.Certificate)}, m.err
 }
 
-func (m *mockAuthority) SignSSH(key ssh.PublicKey, opts provisioner.SSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
+func (m *mockAuthority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisioner.SSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
 	if m.signSSH != nil {
 		return m.signSSH(key, opts, signOpts...)
 	}
 	return m.ret1.(*ssh.Certificate), m.err
 }
 
-func (m *mockAuthority) SignSSHAddUser(key ssh.PublicKey, cert *ssh.Certificate) (*ssh.Certificate, error) {
+func (m *mockAuthority) SignSSHAddUser(ctx context.Context, key ssh.PublicKey, cert *ssh.Certificate) (*ssh.Certificate, error) {
 	if m.signSSHAddUser != nil {
 		return m.signSSHAddUser(key, cert)
 	}
 	return m.ret1.(*ssh.Certificate), m.err
 }
 
-func (m *mockAuthority) Renew(cert *x509.Certificate) ([]*x509.Certificate, error) {
+func (m *mockAuthority) Renew(ctx context.Context, cert *x509.Certificate) ([]*x509.Certificate, error) {
 	if m.renew != nil {
 		return m.renew(cert)
 	}
 	return []*x509.Certificate{m.ret1.(*x509.Certificate), m.ret2.(*x509.Certificate)}, m.err
 }
 
+func (m *mockAuthority) Rekey(ctx context.Context, cert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error) {
+	if m.rekey != nil {
+		return m.rekey(cert, pk)
+	}
+	return []*x509.Certificate{m.ret1.(*x509.Certificate), m.ret2.(*x509.Certificate)}, m.err
+}
+
+func (m *mockAuthority) AuthorizeRenewToken(ctx context.Context, ott string) (*x509.Certificate, error) {
+	if m.authorizeRenewToken != nil {
+		return m.authorizeRenewToken(ott)
+	}
+	return m.ret1.(*x509.Certificate), m.err
+}
+
+func (m *mockAuthority) RenewAfter(crt *x509.Certificate) time.Time {
+	if m.renewAfter != nil {
+		return m.renewAfter(crt)
+	}
+	return time.Time{}
+}
+
 func (m *mockAuthority) GetProvisioners(nextCursor string, limit int) (provisioner.List, string, error) {
 	if m.getProvisioners != nil {
 		return m.getProvisioners(nextCursor, limit)
@@ -575,6 +678,13 @@ func (m *mockAuthority) GetProvisioners(nextCursor string, limit int) (provision
 	return m.ret1.(provisioner.List), m.ret2.(string), m.err
 }
 
+func (m *mockAuthority) GetProvisionersByType(typ provisioner.Type, nextCursor string, limit int) (provisioner.List, string, error) {
+	if m.getProvisionersByType != nil {
+		return m.getProvisionersByType(typ, nextCursor, limit)
+	}
+	return m.ret1.(provisioner.List), m.ret2.(string), m.err
+}
+
 func (m *mockAuthority) LoadProvisionerByCertificate(cert *x509.Certificate) (provisioner.Interface, error) {
 	if m.loadProvisionerByCertificate != nil {
 		return m.loadProvisionerByCertificate(cert)
@@ -582,6 +692,13 @@ func (m *mockAuthority) LoadProvisionerByCertificate(cert *x509.Certificate) (pr
 	return m.ret1.(provisioner.Interface), m.err
 }
 
+func (m *mockAuthority) LoadProvisionerByToken(ott string) (provisioner.Interface, error) {
+	if m.loadProvisionerByToken != nil {
+		return m.loadProvisionerByToken(ott)
+	}
+	return m.ret1.(provisioner.Interface), m.err
+}
+
 func (m *mockAuthority) LoadProvisionerByID(provID string) (provisioner.Interface, error) {
 	if m.loadProvisionerByID != nil {
 		return m.loadProvisionerByID(provID)
@@ -589,7 +706,7 @@ func (m *mockAuthority) LoadProvisionerByID(provID string) (provisioner.Interfac
 	return m.ret1.(provisioner.Interface), m.err
 }
 
-func (m *mockAuthority) Revoke(opts *authority.RevokeOptions) error {
+func (m *mockAuthority) Revoke(ctx context.Context, opts *authority.RevokeOptions) error {
 	if m.revoke != nil {
 		return m.revoke(opts)
 	}
@@ -617,6 +734,321 @@ func (m *mockAuthority) GetFederation() ([]*x509.Certificate, error) {
 	return m.ret1.([]*x509.Certificate), m.err
 }
 
+func (m *mockAuthority) GetIntermediates() ([]*x509.Certificate, error) {
+	if m.getIntermediates != nil {
+		return m.getIntermediates()
+	}
+	return m.ret1.([]*x509.Certificate), m.err
+}
+
+func (m *mockAuthority) GetIssuingRoot(intermediate *x509.Certificate) (*x509.Certificate, error) {
+	if m.getIssuingRoot != nil {
+		return m.getIssuingRoot(intermediate)
+	}
+	return m.ret1.(*x509.Certificate), m.err
+}
+
+func (m *mockAuthority) AuthorizeAdmin(ott string) (string, error) {
+	if m.authorizeAdmin != nil {
+		return m.authorizeAdmin(ott)
+	}
+	return m.ret1.(string), m.err
+}
+
+func (m *mockAuthority) AuthorizeAdminCertificate(crt *x509.Certificate) (string, error) {
+	if m.authorizeAdminCertificate != nil {
+		return m.authorizeAdminCertificate(crt)
+	}
+	return m.ret1.(string), m.err
+}
+
+func (m *mockAuthority) AuthorizeAdminSSO(token string) (string, authority.AdminRole, error) {
+	if m.authorizeAdminSSO != nil {
+		return m.authorizeAdminSSO(token)
+	}
+	return "", "", authority.ErrNotAdminSSOToken
+}
+
+func (m *mockAuthority) IntrospectToken(ott string) (*authority.TokenIntrospection, error) {
+	if m.introspectToken != nil {
+		return m.introspectToken(ott)
+	}
+	return m.ret1.(*authority.TokenIntrospection), m.err
+}
+
+func (m *mockAuthority) MintToken(opts authority.MintOptions) (string, error) {
+	if m.mintToken != nil {
+		return m.mintToken(opts)
+	}
+	return m.ret1.(string), m.err
+}
+
+func (m *mockAuthority) GetSanitizedConfig() (map[string]interface{}, error) {
+	if m.getSanitizedConfig != nil {
+		return m.getSanitizedConfig()
+	}
+	return m.ret1.(map[string]interface{}), m.err
+}
+
+func (m *mockAuthority) ImportCA(opts authority.ImportCAOptions) error {
+	if m.importCA != nil {
+		return m.importCA(opts)
+	}
+	return m.err
+}
+
+func (m *mockAuthority) IsApprovalRequired(signOpts []provisioner.SignOption) bool {
+	if m.isApprovalRequired != nil {
+		return m.isApprovalRequired(signOpts)
+	}
+	return false
+}
+
+func (m *mockAuthority) GenerateKey(signOpts []provisioner.SignOption, kty, crv string, size int) (crypto.Signer, error) {
+	if m.generateKey != nil {
+		return m.generateKey(signOpts, kty, crv, size)
+	}
+	return m.ret1.(crypto.Signer), m.err
+}
+
+func (m *mockAuthority) CreatePendingRequest(cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) (*authority.PendingRequest, error) {
+	if m.createPendingRequest != nil {
+		return m.createPendingRequest(cr, opts, signOpts...)
+	}
+	return m.ret1.(*authority.PendingRequest), m.err
+}
+
+func (m *mockAuthority) GetPendingRequest(id string) (*authority.PendingRequest, error) {
+	if m.getPendingRequest != nil {
+		return m.getPendingRequest(id)
+	}
+	return m.ret1.(*authority.PendingRequest), m.err
+}
+
+func (m *mockAuthority) GetPendingRequests(status authority.PendingStatus) ([]*authority.PendingRequest, error) {
+	if m.getPendingRequests != nil {
+		return m.getPendingRequests(status)
+	}
+	return m.ret1.([]*authority.PendingRequest), m.err
+}
+
+func (m *mockAuthority) ApprovePendingRequest(ctx context.Context, id, reviewer string) (*authority.PendingRequest, error) {
+	if m.approvePendingRequest != nil {
+		return m.approvePendingRequest(id, reviewer)
+	}
+	return m.ret1.(*authority.PendingRequest), m.err
+}
+
+func (m *mockAuthority) DenyPendingRequest(id, reviewer, reason string) (*authority.PendingRequest, error) {
+	if m.denyPendingRequest != nil {
+		return m.denyPendingRequest(id, reviewer, reason)
+	}
+	return m.ret1.(*authority.PendingRequest), m.err
+}
+
+func (m *mockAuthority) GetCertificates(filter authority.CertificateFilter, cursor string, limit int) ([]*authority.CertificateInfo, string, error) {
+	if m.getCertificates != nil {
+		return m.getCertificates(filter, cursor, limit)
+	}
+	return m.ret1.([]*authority.CertificateInfo), "", m.err
+}
+
+func (m *mockAuthority) GetCertificate(serial string) (*authority.CertificateInfo, error) {
+	if m.getCertificate != nil {
+		return m.getCertificate(serial)
+	}
+	return m.ret1.(*authority.CertificateInfo), m.err
+}
+
+func (m *mockAuthority) GetExpiringCertificates(filter authority.CertificateFilter, within time.Duration) ([]*authority.CertificateInfo, error) {
+	if m.getExpiringCertificates != nil {
+		return m.getExpiringCertificates(filter, within)
+	}
+	return m.ret1.([]*authority.CertificateInfo), m.err
+}
+
+func (m *mockAuthority) GetStats(from, to time.Time) ([]*authority.ProvisionerStats, error) {
+	if m.getStats != nil {
+		return m.getStats(from, to)
+	}
+	return m.ret1.([]*authority.ProvisionerStats), m.err
+}
+
+func (m *mockAuthority) GetCacheControl() string {
+	if m.getCacheControl != nil {
+		return m.getCacheControl()
+	}
+	return ""
+}
+
+func (m *mockAuthority) GetRateLimitConfig() *authority.RateLimitConfig {
+	if m.getRateLimitConfig != nil {
+		return m.getRateLimitConfig()
+	}
+	return nil
+}
+
+func (m *mockAuthority) GetDiscovery() *authority.Discovery {
+	if m.getDiscovery != nil {
+		return m.getDiscovery()
+	}
+	return &authority.Discovery{}
+}
+
+func (m *mockAuthority) SignJWTSVID(ctx context.Context, spiffeID string, audience []string, signOpts ...provisioner.SignOption) (string, time.Time, error) {
+	if m.signJWTSVID != nil {
+		return m.signJWTSVID(ctx, spiffeID, audience, signOpts...)
+	}
+	return m.ret1.(string), time.Time{}, m.err
+}
+
+func (m *mockAuthority) GetCRL() (*db.CRLInfo, error) {
+	if m.getCRL != nil {
+		return m.getCRL()
+	}
+	return m.ret1.(*db.CRLInfo), m.err
+}
+
+func (m *mockAuthority) RegisterInventoryEntry(name string, opts authority.InventoryOptions) (*db.InventoryEntry, error) {
+	if m.registerInventoryEntry != nil {
+		return m.registerInventoryEntry(name, opts)
+	}
+	return m.ret1.(*db.InventoryEntry), m.err
+}
+
+func (m *mockAuthority) GetInventoryEntry(name string) (*db.InventoryEntry, error) {
+	if m.getInventoryEntry != nil {
+		return m.getInventoryEntry(name)
+	}
+	return m.ret1.(*db.InventoryEntry), m.err
+}
+
+func (m *mockAuthority) GetInventoryEntries(filter authority.InventoryFilter, cursor string, limit int) ([]*db.InventoryEntry, string, error) {
+	if m.getInventoryEntries != nil {
+		return m.getInventoryEntries(filter, cursor, limit)
+	}
+	return m.ret1.([]*db.InventoryEntry), m.ret2.(string), m.err
+}
+
+func (m *mockAuthority) DeleteInventoryEntry(name string) error {
+	if m.deleteInventoryEntry != nil {
+		return m.deleteInventoryEntry(name)
+	}
+	return m.err
+}
+
+func (m *mockAuthority) LinkInventoryCertificate(name, serial string) (*db.InventoryEntry, error) {
+	if m.linkInventoryCertificate != nil {
+		return m.linkInventoryCertificate(name, serial)
+	}
+	return m.ret1.(*db.InventoryEntry), m.err
+}
+
+func (m *mockAuthority) GetAuditEntries(filter audit.Filter, cursor string, limit int) ([]*audit.Entry, string, error) {
+	if m.getAuditEntries != nil {
+		return m.getAuditEntries(filter, cursor, limit)
+	}
+	return m.ret1.([]*audit.Entry), m.ret2.(string), m.err
+}
+
+func (m *mockAuthority) GetJWTSVIDKeys() jose.JSONWebKeySet {
+	if m.getJWTSVIDKeys != nil {
+		return m.getJWTSVIDKeys()
+	}
+	return jose.JSONWebKeySet{Keys: []jose.JSONWebKey{}}
+}
+
+func (m *mockAuthority) NewNonce() (string, time.Time, error) {
+	if m.newNonce != nil {
+		return m.newNonce()
+	}
+	return m.ret1.(string), time.Time{}, m.err
+}
+
+func (m *mockAuthority) GetCORSConfig() *authority.CORSConfig {
+	if m.getCORSConfig != nil {
+		return m.getCORSConfig()
+	}
+	return nil
+}
+
+func (m *mockAuthority) GetBodyLimits() *authority.BodyLimitConfig {
+	if m.getBodyLimits != nil {
+		return m.getBodyLimits()
+	}
+	return nil
+}
+
+func (m *mockAuthority) GetTimeouts() *authority.TimeoutConfig {
+	if m.getTimeouts != nil {
+		return m.getTimeouts()
+	}
+	return nil
+}
+
+func (m *mockAuthority) GetRetentionStats() []*db.PrunerStats {
+	if m.getRetentionStats != nil {
+		return m.getRetentionStats()
+	}
+	return []*db.PrunerStats{}
+}
+
+func (m *mockAuthority) Backup() (*authority.Backup, error) {
+	if m.backup != nil {
+		return m.backup()
+	}
+	return m.ret1.(*authority.Backup), m.err
+}
+
+func (m *mockAuthority) Restore(b *authority.Backup) error {
+	if m.restore != nil {
+		return m.restore(b)
+	}
+	return m.err
+}
+
+func (m *mockAuthority) CheckHealth(ctx context.Context) *authority.Health {
+	if m.checkHealth != nil {
+		return m.checkHealth(ctx)
+	}
+	return nil
+}
+
+func (m *mockAuthority) GetJournal(from, to time.Time) ([]*db.JournalEntry, error) {
+	if m.getJournal != nil {
+		return m.getJournal(from, to)
+	}
+	return m.ret1.([]*db.JournalEntry), m.err
+}
+
+func (m *mockAuthority) GetSignedTreeHead() (*authority.SignedTreeHead, error) {
+	if m.getSignedTreeHead != nil {
+		return m.getSignedTreeHead()
+	}
+	return m.ret1.(*authority.SignedTreeHead), m.err
+}
+
+func (m *mockAuthority) GetLogEntries(start, end int64) ([]*db.LogEntry, error) {
+	if m.getLogEntries != nil {
+		return m.getLogEntries(start, end)
+	}
+	return m.ret1.([]*db.LogEntry), m.err
+}
+
+func (m *mockAuthority) GetInclusionProof(serial string, treeSize int64) (*authority.InclusionProof, error) {
+	if m.getInclusionProof != nil {
+		return m.getInclusionProof(serial, treeSize)
+	}
+	return m.ret1.(*authority.InclusionProof), m.err
+}
+
+func (m *mockAuthority) SubscribeEvents(lastID string) (<-chan *events.Event, func()) {
+	if m.subscribeEvents != nil {
+		return m.subscribeEvents(lastID)
+	}
+	return m.ret1.(<-chan *events.Event), func() {}
+}
+
 func Test_caHandler_Route(t *testing.T) {
 	type fields struct {
 		Authority Authority
@@ -780,6 +1212,196 @@ func Test_caHandler_Sign(t *testing.T) {
 	}
 }
 
+func Test_caHandler_Sign_pkcs12(t *testing.T) {
+	csr := parseCertificateRequest(csrPEM)
+	crt, root := parseCertificate(certPEM), parseCertificate(rootPEM)
+	tests := []struct {
+		name       string
+		password   string
+		statusCode int
+	}{
+		{"ok", "changeit", http.StatusCreated},
+		{"fail-password", "\U0001F511", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, err := json.Marshal(SignRequest{
+				CsrPEM:         CertificateRequest{csr},
+				OTT:            "foobarzar",
+				PKCS12Password: tt.password,
+			})
+			assert.FatalError(t, err)
+			h := New(&mockAuthority{
+				ret1: crt, ret2: root,
+				authorizeSign: func(ott string) ([]provisioner.SignOption, error) {
+					return nil, nil
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("POST", "http://example.com/sign", bytes.NewReader(input))
+			w := httptest.NewRecorder()
+			h.Sign(logging.NewResponseLogger(w), req)
+			res := w.Result()
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			if tt.statusCode != http.StatusCreated {
+				return
+			}
+
+			assert.Equals(t, PKCS12ContentType, res.Header.Get("Content-Type"))
+			assert.Equals(t, "no-store", res.Header.Get("Cache-Control"))
+			body, err := ioutil.ReadAll(res.Body)
+			assert.FatalError(t, err)
+			verifyPKCS12KeyStore(t, body, tt.password, []*x509.Certificate{crt, root})
+		})
+	}
+}
+
+func Test_caHandler_Sign_keyGeneration(t *testing.T) {
+	crt, root := parseCertificate(certPEM), parseCertificate(rootPEM)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	kg := &KeyGeneration{KeyType: "EC", Subject: "test.smallstep.com", SANs: []string{"test.smallstep.com"}}
+	tests := []struct {
+		name       string
+		body       SignRequest
+		genErr     error
+		approval   bool
+		statusCode int
+	}{
+		{"ok", SignRequest{OTT: "foobarzar", PKCS12Password: "changeit", KeyGeneration: kg}, nil, false, http.StatusCreated},
+		{"fail-subject", SignRequest{OTT: "foobarzar", PKCS12Password: "changeit", KeyGeneration: &KeyGeneration{}}, nil, false, http.StatusBadRequest},
+		{"fail-password", SignRequest{OTT: "foobarzar", KeyGeneration: kg}, nil, false, http.StatusBadRequest},
+		{"fail-csr", SignRequest{CsrPEM: CertificateRequest{parseCertificateRequest(csrPEM)}, OTT: "foobarzar", PKCS12Password: "changeit", KeyGeneration: kg}, nil, false, http.StatusBadRequest},
+		{"fail-generateKey", SignRequest{OTT: "foobarzar", PKCS12Password: "changeit", KeyGeneration: kg}, errors.New("force"), false, http.StatusForbidden},
+		{"fail-approval", SignRequest{OTT: "foobarzar", PKCS12Password: "changeit", KeyGeneration: kg}, nil, true, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Clients that ask for a key do not send the csr.
+			b, err := json.Marshal(tt.body)
+			assert.FatalError(t, err)
+			var m map[string]interface{}
+			assert.FatalError(t, json.Unmarshal(b, &m))
+			if tt.body.CsrPEM.CertificateRequest == nil {
+				delete(m, "csr")
+			}
+			input, err := json.Marshal(m)
+			assert.FatalError(t, err)
+			h := New(&mockAuthority{
+				authorizeSign: func(ott string) ([]provisioner.SignOption, error) {
+					return nil, nil
+				},
+				isApprovalRequired: func(signOpts []provisioner.SignOption) bool {
+					return tt.approval
+				},
+				generateKey: func(signOpts []provisioner.SignOption, kty, crv string, size int) (crypto.Signer, error) {
+					assert.False(t, tt.approval)
+					assert.Equals(t, "EC", kty)
+					return key, tt.genErr
+				},
+				createPendingRequest: func(cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) (*authority.PendingRequest, error) {
+					t.Error("the request with keyGeneration must not be queued")
+					return nil, errors.New("force")
+				},
+				sign: func(cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+					// The request is signed with the generated key.
+					assert.FatalError(t, cr.CheckSignature())
+					assert.Equals(t, key.Public(), cr.PublicKey)
+					assert.Equals(t, "test.smallstep.com", cr.Subject.CommonName)
+					assert.Equals(t, []string{"test.smallstep.com"}, cr.DNSNames)
+					return []*x509.Certificate{crt, root}, nil
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("POST", "http://example.com/sign", bytes.NewReader(input))
+			w := httptest.NewRecorder()
+			h.Sign(logging.NewResponseLogger(w), req)
+			res := w.Result()
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			if tt.statusCode != http.StatusCreated {
+				return
+			}
+
+			body, err := ioutil.ReadAll(res.Body)
+			assert.FatalError(t, err)
+			blocks, err := pkcs12.ToPEM(body, "changeit")
+			assert.FatalError(t, err)
+			assert.Equals(t, 3, len(blocks))
+			assert.Equals(t, crt.Raw, blocks[0].Bytes)
+			assert.Equals(t, root.Raw, blocks[1].Bytes)
+			priv, err := x509.ParseECPrivateKey(blocks[2].Bytes)
+			assert.FatalError(t, err)
+			assert.Equals(t, key.D, priv.D)
+		})
+	}
+}
+
+func Test_caHandler_options(t *testing.T) {
+	var calls []string
+	middleware := func(name string) Middleware {
+		return func(pattern string, next http.HandlerFunc) http.HandlerFunc {
+			return func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, name+" "+pattern)
+				if r.Header.Get("X-Deny") == name {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				next(w, r)
+			}
+		}
+	}
+	h := New(&mockAuthority{},
+		WithPreMiddleware(middleware("pre1")),
+		WithPreMiddleware(middleware("pre2")),
+		WithPostMiddleware(middleware("post")),
+		WithRoutes(func(r Router) {
+			r.MethodFunc("GET", "/custom/{id}", func(w http.ResponseWriter, r *http.Request) {
+				calls = append(calls, "handler "+chi.URLParam(r, "id"))
+				w.WriteHeader(http.StatusNoContent)
+			})
+		}),
+	)
+	mux := chi.NewRouter()
+	h.Route(mux)
+
+	tests := []struct {
+		name       string
+		deny       string
+		statusCode int
+		calls      []string
+	}{
+		{"ok", "", http.StatusNoContent, []string{"pre1 /custom/{id}", "pre2 /custom/{id}", "post /custom/{id}", "handler foo"}},
+		{"deny-pre", "pre2", http.StatusForbidden, []string{"pre1 /custom/{id}", "pre2 /custom/{id}"}},
+		{"deny-post", "post", http.StatusForbidden, []string{"pre1 /custom/{id}", "pre2 /custom/{id}", "post /custom/{id}"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = nil
+			req := httptest.NewRequest("GET", "http://example.com/custom/foo", nil)
+			req.Header.Set("X-Deny", tt.deny)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+			assert.Equals(t, tt.statusCode, w.Code)
+			assert.Equals(t, tt.calls, calls)
+		})
+	}
+
+	// The admin handler uses the middlewares but not the extra routes.
+	mux = chi.NewRouter()
+	NewAdmin(&mockAuthority{}, WithPreMiddleware(middleware("pre")),
+		WithRoutes(func(r Router) {
+			r.MethodFunc("GET", "/custom", func(w http.ResponseWriter, r *http.Request) {})
+		})).Route(mux)
+	calls = nil
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/custom", nil))
+	assert.Equals(t, http.StatusNotFound, w.Code)
+	req := httptest.NewRequest("GET", "http://example.com/admin/pending", nil)
+	req.Header.Set("X-Deny", "pre")
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	assert.Equals(t, http.StatusForbidden, w.Code)
+	assert.Equals(t, []string{"pre /admin/pending"}, calls)
+}
+
 func Test_caHandler_Renew(t *testing.T) {
 	cs := &tls.ConnectionState{
 		PeerCertificates: []*x509.Certificate{parseCertificate(certPEM)},
@@ -832,6 +1454,64 @@ func Test_caHandler_Renew(t *testing.T) {
 	}
 }
 
+func Test_caHandler_Rekey(t *testing.T) {
+	cs := &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{parseCertificate(certPEM)},
+	}
+	csr := parseCertificateRequest(csrPEM)
+	valid, err := json.Marshal(RekeyRequest{
+		CsrPEM: CertificateRequest{csr},
+	})
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name       string
+		input      string
+		tls        *tls.ConnectionState
+		cert       *x509.Certificate
+		root       *x509.Certificate
+		err        error
+		statusCode int
+	}{
+		{"ok", string(valid), cs, parseCertificate(certPEM), parseCertificate(rootPEM), nil, http.StatusCreated},
+		{"no tls", string(valid), nil, nil, nil, nil, http.StatusBadRequest},
+		{"no peer certificates", string(valid), &tls.ConnectionState{}, nil, nil, nil, http.StatusBadRequest},
+		{"json read error", "{", cs, nil, nil, nil, http.StatusBadRequest},
+		{"missing csr", "{}", cs, nil, nil, nil, http.StatusBadRequest},
+		{"rekey error", string(valid), cs, nil, nil, fmt.Errorf("an error"), http.StatusForbidden},
+	}
+
+	expected := []byte(`{"crt":"` + strings.Replace(certPEM, "\n", `\n`, -1) + `\n","ca":"` + strings.Replace(rootPEM, "\n", `\n`, -1) + `\n","certChain":["` + strings.Replace(certPEM, "\n", `\n`, -1) + `\n","` + strings.Replace(rootPEM, "\n", `\n`, -1) + `\n"]}`)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				rekey: func(cert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error) {
+					assert.Equals(t, cs.PeerCertificates[0], cert)
+					assert.Equals(t, csr.PublicKey, pk)
+					return []*x509.Certificate{tt.cert, tt.root}, tt.err
+				},
+				getTLSOptions: func() *tlsutil.TLSOptions {
+					return nil
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("POST", "http://example.com/rekey", strings.NewReader(tt.input))
+			req.TLS = tt.tls
+			w := httptest.NewRecorder()
+			h.Rekey(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			body, err := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+			if tt.statusCode < http.StatusBadRequest {
+				assert.Equals(t, expected, bytes.TrimSpace(body))
+			}
+		})
+	}
+}
+
 func Test_caHandler_Provisioners(t *testing.T) {
 	type fields struct {
 		Authority Authority
@@ -851,6 +1531,16 @@ func Test_caHandler_Provisioners(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	reqType, err := http.NewRequest("GET", "http://example.com/provisioners?type=jwk&cursor=foo&limit=20", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reqTypeFail, err := http.NewRequest("GET", "http://example.com/provisioners?type=foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	var key jose.JSONWebKey
 	if err := json.Unmarshal([]byte(pubKey), &key); err != nil {
 		t.Fatal(err)
@@ -883,6 +1573,13 @@ func Test_caHandler_Provisioners(t *testing.T) {
 		{"ok", fields{&mockAuthority{ret1: p, ret2: ""}}, args{httptest.NewRecorder(), req}, 200},
 		{"fail", fields{&mockAuthority{ret1: p, ret2: "", err: fmt.Errorf("the error")}}, args{httptest.NewRecorder(), req}, 500},
 		{"limit fail", fields{&mockAuthority{ret1: p, ret2: ""}}, args{httptest.NewRecorder(), reqLimitFail}, 400},
+		{"type", fields{&mockAuthority{getProvisionersByType: func(typ provisioner.Type, nextCursor string, limit int) (provisioner.List, string, error) {
+			assert.Equals(t, provisioner.TypeJWK, typ)
+			assert.Equals(t, "foo", nextCursor)
+			assert.Equals(t, 20, limit)
+			return p, "", nil
+		}}}, args{httptest.NewRecorder(), reqType}, 200},
+		{"type fail", fields{&mockAuthority{ret1: p, ret2: ""}}, args{httptest.NewRecorder(), reqTypeFail}, 400},
 	}
 
 	expected, err := json.Marshal(pr)
@@ -890,8 +1587,8 @@ func Test_caHandler_Provisioners(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	expectedError400 := []byte(`{"status":400,"message":"Bad Request"}`)
-	expectedError500 := []byte(`{"status":500,"message":"Internal Server Error"}`)
+	expectedError400 := []byte(`{"status":400,"code":"request.invalid","message":"Bad Request"}`)
+	expectedError500 := []byte(`{"status":500,"code":"server.internal","message":"Internal Server Error"}`)
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			h := &caHandler{
@@ -958,7 +1655,7 @@ func Test_caHandler_ProvisionerKey(t *testing.T) {
 	}
 
 	expected := []byte(`{"key":"` + privKey + `"}`)
-	expectedError := []byte(`{"status":404,"message":"Not Found"}`)
+	expectedError := []byte(`{"status":404,"code":"request.notFound","message":"Not Found"}`)
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -1082,6 +1779,266 @@ func Test_caHandler_Federation(t *testing.T) {
 	}
 }
 
+func Test_caHandler_Intermediates(t *testing.T) {
+	tests := []struct {
+		name       string
+		crt        *x509.Certificate
+		err        error
+		statusCode int
+	}{
+		{"ok", parseCertificate(rootPEM), nil, http.StatusOK},
+		{"fail", nil, fmt.Errorf("an error"), http.StatusInternalServerError},
+	}
+
+	expected := []byte(`{"crts":["` + strings.Replace(rootPEM, "\n", `\n`, -1) + `\n"]}`)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{ret1: []*x509.Certificate{tt.crt}, err: tt.err}).(*caHandler)
+			req := httptest.NewRequest("GET", "http://example.com/intermediates", nil)
+			w := httptest.NewRecorder()
+			h.Intermediates(w, req)
+			res := w.Result()
+
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			body, err := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+			if tt.statusCode < http.StatusBadRequest {
+				assert.Equals(t, expected, bytes.TrimSpace(body))
+			}
+		})
+	}
+}
+
+func Test_caHandler_Renew_chain(t *testing.T) {
+	cs := &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{parseCertificate(certPEM)},
+	}
+	crt, intermediate, root := parseCertificate(certPEM), parseCertificate(stepCertPEM), parseCertificate(rootPEM)
+
+	tests := []struct {
+		name       string
+		query      string
+		rootErr    error
+		statusCode int
+		want       []*x509.Certificate
+	}{
+		{"ok", "", nil, http.StatusCreated, []*x509.Certificate{crt, intermediate}},
+		{"ok-intermediates", "?chain=intermediates", nil, http.StatusCreated, []*x509.Certificate{crt, intermediate}},
+		{"ok-root", "?chain=root", nil, http.StatusCreated, []*x509.Certificate{crt, intermediate, root}},
+		{"fail-chain", "?chain=foo", nil, http.StatusBadRequest, nil},
+		{"fail-root", "?chain=root", fmt.Errorf("an error"), http.StatusInternalServerError, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				renew: func(cert *x509.Certificate) ([]*x509.Certificate, error) {
+					return []*x509.Certificate{crt, intermediate}, nil
+				},
+				getIssuingRoot: func(cert *x509.Certificate) (*x509.Certificate, error) {
+					assert.Equals(t, intermediate, cert)
+					return root, tt.rootErr
+				},
+				getTLSOptions: func() *tlsutil.TLSOptions {
+					return nil
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("POST", "http://example.com/renew"+tt.query, nil)
+			req.TLS = cs
+			w := httptest.NewRecorder()
+			h.Renew(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			if tt.statusCode < http.StatusBadRequest {
+				var body SignResponse
+				assert.FatalError(t, ReadJSON(res.Body, &body))
+				assert.Equals(t, tt.want, certChainFromPEM(body.CertChainPEM))
+				assert.Equals(t, intermediate, body.CaPEM.Certificate)
+			}
+		})
+	}
+}
+
+func Test_caHandler_Renew_renewAfter(t *testing.T) {
+	crt, root := parseCertificate(certPEM), parseCertificate(rootPEM)
+	renewAfter := time.Date(2020, 1, 2, 3, 4, 5, 600, time.FixedZone("CET", 3600))
+	h := New(&mockAuthority{
+		renew: func(cert *x509.Certificate) ([]*x509.Certificate, error) {
+			return []*x509.Certificate{crt, root}, nil
+		},
+		renewAfter: func(cert *x509.Certificate) time.Time {
+			assert.Equals(t, crt, cert)
+			return renewAfter
+		},
+		getTLSOptions: func() *tlsutil.TLSOptions {
+			return nil
+		},
+	}).(*caHandler)
+	req := httptest.NewRequest("POST", "http://example.com/renew", nil)
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{crt}}
+	w := httptest.NewRecorder()
+	h.Renew(logging.NewResponseLogger(w), req)
+	res := w.Result()
+	assert.Equals(t, http.StatusCreated, res.StatusCode)
+
+	var body map[string]interface{}
+	assert.FatalError(t, ReadJSON(res.Body, &body))
+	assert.Equals(t, "2020-01-02T02:04:05Z", body["renewAfter"])
+}
+
+func Test_caHandler_Renew_warnings(t *testing.T) {
+	crt, root := parseCertificate(certPEM), parseCertificate(rootPEM)
+	truncated := *crt
+	truncated.NotAfter = root.NotAfter
+
+	tests := []struct {
+		name         string
+		crt          *x509.Certificate
+		wantWarnings []string
+	}{
+		{"ok", crt, nil},
+		{"ok-truncated", &truncated, []string{issuerExpiryWarning}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				renew: func(cert *x509.Certificate) ([]*x509.Certificate, error) {
+					return []*x509.Certificate{tt.crt, root}, nil
+				},
+				getTLSOptions: func() *tlsutil.TLSOptions {
+					return nil
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("POST", "http://example.com/renew", nil)
+			req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{crt}}
+			w := httptest.NewRecorder()
+			h.Renew(logging.NewResponseLogger(w), req)
+			res := w.Result()
+			assert.Equals(t, http.StatusCreated, res.StatusCode)
+
+			var body SignResponse
+			assert.FatalError(t, ReadJSON(res.Body, &body))
+			assert.Equals(t, tt.wantWarnings, body.Warnings)
+			if tt.wantWarnings == nil {
+				assert.Equals(t, "", res.Header.Get("Warning"))
+			} else {
+				assert.Equals(t, `299 - "`+issuerExpiryWarning+`"`, res.Header.Get("Warning"))
+			}
+		})
+	}
+}
+
+func Test_caHandler_Renew_token(t *testing.T) {
+	crt, root := parseCertificate(certPEM), parseCertificate(rootPEM)
+	tests := []struct {
+		name       string
+		header     string
+		err        error
+		statusCode int
+	}{
+		{"ok", "Bearer the-token", nil, http.StatusCreated},
+		{"fail-token", "Bearer the-token", fmt.Errorf("an error"), http.StatusUnauthorized},
+		{"fail-scheme", "Basic the-token", nil, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				authorizeRenewToken: func(ott string) (*x509.Certificate, error) {
+					assert.Equals(t, "the-token", ott)
+					return crt, tt.err
+				},
+				renew: func(cert *x509.Certificate) ([]*x509.Certificate, error) {
+					assert.Equals(t, crt, cert)
+					return []*x509.Certificate{crt, root}, nil
+				},
+				getTLSOptions: func() *tlsutil.TLSOptions {
+					return nil
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("POST", "http://example.com/renew", nil)
+			req.Header.Set("Authorization", tt.header)
+			w := httptest.NewRecorder()
+			h.Renew(logging.NewResponseLogger(w), req)
+			assert.Equals(t, tt.statusCode, w.Result().StatusCode)
+		})
+	}
+}
+
+func certChainFromPEM(certChainPEM []Certificate) []*x509.Certificate {
+	certChain := make([]*x509.Certificate, len(certChainPEM))
+	for i := range certChainPEM {
+		certChain[i] = certChainPEM[i].Certificate
+	}
+	return certChain
+}
+
+func Test_paginateCertificates(t *testing.T) {
+	c1, c2, c3 := parseCertificate(rootPEM), parseCertificate(certPEM), parseCertificate(stepCertPEM)
+	certs := []*x509.Certificate{c1, c2, c3}
+
+	tests := []struct {
+		name     string
+		cursor   string
+		limit    int
+		want     []*x509.Certificate
+		wantNext string
+		wantErr  bool
+	}{
+		{"all", "", 0, certs, "", false},
+		{"first", "", 1, []*x509.Certificate{c1}, fingerprint(c2), false},
+		{"second", fingerprint(c2), 1, []*x509.Certificate{c2}, fingerprint(c3), false},
+		{"last", fingerprint(c3), 1, []*x509.Certificate{c3}, "", false},
+		{"cursor", strings.ToUpper(fingerprint(c2)), 0, []*x509.Certificate{c2, c3}, "", false},
+		{"max", "", 1000, certs, "", false},
+		{"fail-cursor", "foo", 1, nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, next, err := paginateCertificates(certs, tt.cursor, tt.limit)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("paginateCertificates() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equals(t, tt.want, got)
+			assert.Equals(t, tt.wantNext, next)
+		})
+	}
+}
+
+func Test_caHandler_Roots_pagination(t *testing.T) {
+	c1, c2 := parseCertificate(rootPEM), parseCertificate(certPEM)
+	h := New(&mockAuthority{ret1: []*x509.Certificate{c1, c2}}).(*caHandler)
+
+	tests := []struct {
+		name       string
+		query      string
+		statusCode int
+		want       *RootsResponse
+	}{
+		{"ok", "?limit=1", http.StatusCreated, &RootsResponse{Certificates: []Certificate{{c1}}, NextCursor: fingerprint(c2)}},
+		{"ok-cursor", "?limit=1&cursor=" + fingerprint(c2), http.StatusCreated, &RootsResponse{Certificates: []Certificate{{c2}}}},
+		{"fail-cursor", "?cursor=foo", http.StatusBadRequest, nil},
+		{"fail-limit", "?limit=foo", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com/roots"+tt.query, nil)
+			w := httptest.NewRecorder()
+			h.Roots(w, req)
+			res := w.Result()
+
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			if tt.want != nil {
+				var got RootsResponse
+				assert.FatalError(t, ReadJSON(res.Body, &got))
+				assert.Equals(t, tt.want, &got)
+			}
+		})
+	}
+}
+
 func Test_fmtPublicKey(t *testing.T) {
 	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 	if err != nil {
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/audit"
+	"github.com/pkg/errors"
+)
+
+// AuditAuthority is the interface implemented by a CA authority that can
+// query its audit log.
+type AuditAuthority interface {
+	GetAuditEntries(filter audit.Filter, cursor string, limit int) ([]*audit.Entry, string, error)
+}
+
+// AuditResponse is the response object of the audit log query.
+type AuditResponse struct {
+	Entries    []*audit.Entry `json:"entries"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+}
+
+// Audit is an HTTP handler that returns the entries of the audit log in the
+// order they were written. The entries can be filtered using the provisioner,
+// subject, san and action (issue, renew or revoke) query parameters, and by
+// time with from and to, using an RFC 3339 time or a duration relative to the
+// current time, e.g. -24h.
+func (h *caHandler) Audit(w http.ResponseWriter, r *http.Request) {
+	cursor, limit, err := parseCursor(r)
+	if err != nil {
+		WriteError(w, BadRequest(err))
+		return
+	}
+
+	q := r.URL.Query()
+	filter := audit.Filter{
+		Action:      audit.Action(q.Get("action")),
+		Provisioner: q.Get("provisioner"),
+		Subject:     q.Get("subject"),
+		SAN:         q.Get("san"),
+	}
+	switch filter.Action {
+	case "", audit.Issue, audit.Renew, audit.Revoke:
+	default:
+		WriteError(w, BadRequest(errors.Errorf("unsupported action %s", filter.Action)))
+		return
+	}
+	for key, t := range map[string]*time.Time{
+		"from": &filter.From,
+		"to":   &filter.To,
+	} {
+		if v := q.Get(key); v != "" {
+			td, err := ParseTimeDuration(v)
+			if err != nil {
+				WriteError(w, BadRequest(errors.Wrapf(err, "error parsing %s", key)))
+				return
+			}
+			*t = td.Time()
+		}
+	}
+
+	list, next, err := h.Authority.GetAuditEntries(filter, cursor, limit)
+	if err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+	JSON(w, &AuditResponse{Entries: list, NextCursor: next})
+}
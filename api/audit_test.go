@@ -0,0 +1,65 @@
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/audit"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+func Test_caHandler_Audit(t *testing.T) {
+	t0, err := time.Parse(time.RFC3339, "2019-10-01T00:00:00Z")
+	assert.FatalError(t, err)
+	entries := []*audit.Entry{
+		{Time: t0, Action: audit.Issue, Serial: "1", Subject: "foo.smallstep.com", Provisioner: "max"},
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		filter     audit.Filter
+		err        error
+		statusCode int
+		expected   string
+	}{
+		{"ok", "", audit.Filter{}, nil, http.StatusOK,
+			`{"entries":[{"time":"2019-10-01T00:00:00Z","action":"issue","serial":"1","subject":"foo.smallstep.com","provisioner":"max"}],"nextCursor":"123"}`},
+		{"ok-filter", "?provisioner=max&subject=foo&san=foo.smallstep.com&action=issue&from=2019-10-01T00:00:00Z&to=2019-10-01T00:00:00Z&cursor=0&limit=10",
+			audit.Filter{Action: audit.Issue, Provisioner: "max", Subject: "foo", SAN: "foo.smallstep.com", From: t0, To: t0}, nil, http.StatusOK, ""},
+		{"fail-action", "?action=seal", audit.Filter{}, nil, http.StatusBadRequest, ""},
+		{"fail-from", "?from=foo", audit.Filter{}, nil, http.StatusBadRequest, ""},
+		{"fail-to", "?to=foo", audit.Filter{}, nil, http.StatusBadRequest, ""},
+		{"fail-limit", "?limit=foo", audit.Filter{}, nil, http.StatusBadRequest, ""},
+		{"fail-not-implemented", "", audit.Filter{}, statusError{errors.New("not implemented"), http.StatusNotImplemented}, http.StatusNotImplemented, ""},
+		{"fail", "", audit.Filter{}, errors.New("an error"), http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				getAuditEntries: func(filter audit.Filter, cursor string, limit int) ([]*audit.Entry, string, error) {
+					assert.Equals(t, tt.filter, filter)
+					return entries, "123", tt.err
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("GET", "http://example.com/admin/audit"+tt.query, nil)
+			w := httptest.NewRecorder()
+			h.Audit(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			body, err := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+			if tt.expected != "" {
+				assert.Equals(t, tt.expected, strings.TrimSpace(string(body)))
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/pkg/errors"
+)
+
+// BackupAuthority is the interface implemented by a CA authority that can
+// backup and restore its state.
+type BackupAuthority interface {
+	Backup() (*authority.Backup, error)
+	Restore(b *authority.Backup) error
+}
+
+// RestoreResponse is the response object of the restore request.
+type RestoreResponse struct {
+	Status   string `json:"status"`
+	Checksum string `json:"checksum"`
+}
+
+// Backup is an HTTP handler that returns a consistent copy of the
+// configuration and the database of the CA.
+func (h *caHandler) Backup(w http.ResponseWriter, r *http.Request) {
+	b, err := h.Authority.Backup()
+	if err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+	JSON(w, b)
+}
+
+// Restore is an HTTP handler that imports the database of a backup in a
+// fresh CA.
+func (h *caHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	var body authority.Backup
+	if err := ReadJSON(r.Body, &body); err != nil {
+		WriteError(w, BadRequest(errors.Wrap(err, "error reading request body")))
+		return
+	}
+	if err := h.Authority.Restore(&body); err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+	JSON(w, &RestoreResponse{Status: "ok", Checksum: body.Checksum})
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/smallstep/assert"
+)
+
+func Test_caHandler_Backup(t *testing.T) {
+	backup := &authority.Backup{
+		Version:   authority.BackupVersion,
+		CreatedAt: time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC),
+		Config:    map[string]interface{}{"address": ":443"},
+		DB: &db.Snapshot{Version: db.SnapshotVersion, Tables: []*db.SnapshotTable{
+			{Name: "x509_certs", Entries: []*db.SnapshotEntry{{Key: []byte("1"), Value: []byte("foo")}}},
+		}, Checksum: "sha256:db"},
+		Checksum: "sha256:backup",
+	}
+	tests := []struct {
+		name       string
+		backup     *authority.Backup
+		err        error
+		statusCode int
+		expected   string
+	}{
+		{"ok", backup, nil, http.StatusOK, `{"version":1,"createdAt":"2019-10-01T00:00:00Z","config":{"address":":443"},` +
+			`"db":{"version":1,"tables":[{"name":"x509_certs","entries":[{"key":"MQ==","value":"Zm9v"}]}],"checksum":"sha256:db"},"checksum":"sha256:backup"}` + "\n"},
+		{"fail", nil, statusError{errors.New("backup: no persistence layer configured"), http.StatusNotImplemented}, http.StatusNotImplemented, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				backup: func() (*authority.Backup, error) {
+					return tt.backup, tt.err
+				},
+			}).(*caHandler)
+			w := httptest.NewRecorder()
+			h.Backup(w, httptest.NewRequest("GET", "http://example.com/admin/backup", nil))
+			assert.Equals(t, tt.statusCode, w.Code)
+			if tt.expected != "" {
+				assert.Equals(t, tt.expected, w.Body.String())
+			}
+		})
+	}
+}
+
+func Test_caHandler_Restore(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		err        error
+		statusCode int
+		expected   string
+	}{
+		{"ok", `{"version":1,"checksum":"sha256:backup"}`, nil, http.StatusOK, `{"status":"ok","checksum":"sha256:backup"}` + "\n"},
+		{"fail-body", `{`, nil, http.StatusBadRequest, ""},
+		{"fail-conflict", `{"version":1}`, statusError{errors.New("restore: table x509_certs is not empty"), http.StatusConflict}, http.StatusConflict, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				restore: func(b *authority.Backup) error {
+					assert.Equals(t, 1, b.Version)
+					return tt.err
+				},
+			}).(*caHandler)
+			w := httptest.NewRecorder()
+			h.Restore(w, httptest.NewRequest("POST", "http://example.com/admin/restore", strings.NewReader(tt.body)))
+			assert.Equals(t, tt.statusCode, w.Code)
+			if tt.expected != "" {
+				assert.Equals(t, tt.expected, w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+)
+
+// BodyLimitAuthority is the interface implemented by a CA authority that
+// configures the maximum size of the body of the requests.
+type BodyLimitAuthority interface {
+	GetBodyLimits() *authority.BodyLimitConfig
+}
+
+// BodyTooLargeError is the error returned when the body of a request exceeds
+// the limit of the endpoint. It is returned with the status 413 Request Entity
+// Too Large.
+type BodyTooLargeError struct {
+	Limit int64
+}
+
+// Error implements the error interface.
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("request body larger than %d bytes", e.Limit)
+}
+
+// StatusCode implements the StatusCoder interface.
+func (e *BodyTooLargeError) StatusCode() int {
+	return http.StatusRequestEntityTooLarge
+}
+
+// ErrorCode implements the ErrorCoder interface.
+func (e *BodyTooLargeError) ErrorCode() string {
+	return ErrCodeBodyTooLarge
+}
+
+// ErrorDetails implements the ErrorDetailer interface.
+func (e *BodyTooLargeError) ErrorDetails() map[string]interface{} {
+	return map[string]interface{}{"limit": e.Limit}
+}
+
+// limitBody is a middleware that limits the size of the body of the requests
+// to the given pattern. Requests with a larger Content-Length are rejected
+// before calling the handler, and reading past the limit fails with a
+// BodyTooLargeError.
+func (h *caHandler) limitBody(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	limit := h.Authority.GetBodyLimits().Limit(pattern)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > limit {
+			WriteError(w, NewError(http.StatusRequestEntityTooLarge, &BodyTooLargeError{Limit: limit}))
+			return
+		}
+		if r.Body != nil && r.Body != http.NoBody {
+			r.Body = &limitedBody{ReadCloser: r.Body, limit: limit, n: limit}
+		}
+		next(w, r)
+	}
+}
+
+// limitedBody is an io.ReadCloser that fails with a BodyTooLargeError after
+// reading limit bytes if there is more data.
+type limitedBody struct {
+	io.ReadCloser
+	limit int64
+	n     int64
+	err   error
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.err != nil {
+		return 0, l.err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	// Read one more byte to detect larger bodies.
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.ReadCloser.Read(p)
+	if int64(n) <= l.n {
+		l.n -= int64(n)
+		l.err = err
+		return n, err
+	}
+	n = int(l.n)
+	l.n = 0
+	l.err = &BodyTooLargeError{Limit: l.limit}
+	return n, l.err
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/smallstep/assert"
+)
+
+func Test_caHandler_limitBody(t *testing.T) {
+	h := New(&mockAuthority{
+		getBodyLimits: func() *authority.BodyLimitConfig {
+			return &authority.BodyLimitConfig{Endpoints: map[string]int64{"/test": 10}}
+		},
+	}).(*caHandler)
+	next := h.limitBody("/test", func(w http.ResponseWriter, r *http.Request) {
+		var v map[string]interface{}
+		if err := ReadJSON(r.Body, &v); err != nil {
+			WriteError(w, BadRequest(err))
+			return
+		}
+		JSON(w, v)
+	})
+
+	tests := []struct {
+		name       string
+		body       string
+		chunked    bool
+		statusCode int
+		expected   string
+	}{
+		{"ok", `{"a":"b"}`, false, http.StatusOK, "{\"a\":\"b\"}\n"},
+		{"ok-chunked", `{"a":"bc"}`, true, http.StatusOK, "{\"a\":\"bc\"}\n"},
+		{"fail-content-length", `{"a":"bcd"}`, false, http.StatusRequestEntityTooLarge,
+			"{\"status\":413,\"code\":\"request.bodyTooLarge\",\"message\":\"Request Entity Too Large\",\"details\":{\"limit\":10}}\n"},
+		{"fail-chunked", `{"a":"bcd"}`, true, http.StatusRequestEntityTooLarge,
+			"{\"status\":413,\"code\":\"request.bodyTooLarge\",\"message\":\"Request Entity Too Large\",\"details\":{\"limit\":10}}\n"},
+		{"fail-bad-json", `{"a"`, false, http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "http://example.com/test", strings.NewReader(tt.body))
+			if tt.chunked {
+				// Hide the length of the body.
+				req.Body = ioutil.NopCloser(bytes.NewBufferString(tt.body))
+				req.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			next(logging.NewResponseLogger(w), req)
+			res := w.Result()
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			if tt.expected != "" {
+				body, err := ioutil.ReadAll(res.Body)
+				assert.FatalError(t, err)
+				assert.Equals(t, tt.expected, string(body))
+			}
+		})
+	}
+}
+
+func Test_limitedBody(t *testing.T) {
+	l := &limitedBody{ReadCloser: ioutil.NopCloser(strings.NewReader("0123456789")), limit: 10, n: 10}
+	b, err := ioutil.ReadAll(l)
+	assert.FatalError(t, err)
+	assert.Equals(t, "0123456789", string(b))
+
+	l = &limitedBody{ReadCloser: ioutil.NopCloser(strings.NewReader("0123456789a")), limit: 10, n: 10}
+	b, err = ioutil.ReadAll(l)
+	assert.Equals(t, &BodyTooLargeError{Limit: 10}, err)
+	assert.Equals(t, "0123456789", string(b))
+	_, err = l.Read(make([]byte, 1))
+	assert.Equals(t, &BodyTooLargeError{Limit: 10}, err)
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/RTradeLtd/ca-cli/crypto/tlsutil"
+	"github.com/pkg/errors"
+)
+
+// BootstrapResponse is the response object of the bootstrap request. It has
+// everything a new client needs to trust the CA: the root with the fingerprint
+// given out-of-band, all the roots and federated roots, and the defaults
+// recommended for the clients.
+type BootstrapResponse struct {
+	RootPEM    Certificate       `json:"ca"`
+	Roots      []Certificate     `json:"roots"`
+	Federation []Certificate     `json:"federation"`
+	Defaults   BootstrapDefaults `json:"defaults"`
+}
+
+// BootstrapDefaults are the client defaults recommended by the CA.
+type BootstrapDefaults struct {
+	APIVersion string              `json:"apiVersion"`
+	TLSOptions *tlsutil.TLSOptions `json:"tlsOptions,omitempty"`
+}
+
+// Bootstrap is an HTTP handler that returns the roots, the federation and the
+// client defaults of the CA. The fingerprint parameter must be the SHA256 of
+// one of the roots, the clients get it out-of-band and verify that the
+// response, requested without TLS verification, has the same root.
+func (h *caHandler) Bootstrap(w http.ResponseWriter, r *http.Request) {
+	fingerprint := r.URL.Query().Get("fingerprint")
+	if fingerprint == "" {
+		WriteError(w, BadRequest(errors.New("missing fingerprint")))
+		return
+	}
+	sum := strings.ToLower(strings.Replace(fingerprint, "-", "", -1))
+	root, err := h.Authority.Root(sum)
+	if err != nil {
+		WriteError(w, NotFound(errors.Wrapf(err, "root %s was not found", sum)))
+		return
+	}
+	roots, err := h.Authority.GetRoots()
+	if err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+	federation, err := h.Authority.GetFederation()
+	if err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+
+	h.writeCacheableJSON(w, r, &BootstrapResponse{
+		RootPEM:    Certificate{root},
+		Roots:      certChainToPEM(roots),
+		Federation: certChainToPEM(federation),
+		Defaults: BootstrapDefaults{
+			APIVersion: CurrentVersion,
+			TLSOptions: h.Authority.GetTLSOptions(),
+		},
+	}, http.StatusOK)
+}
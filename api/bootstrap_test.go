@@ -0,0 +1,79 @@
+package api
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RTradeLtd/ca-cli/crypto/tlsutil"
+	"github.com/smallstep/assert"
+)
+
+func Test_caHandler_Bootstrap(t *testing.T) {
+	root := parseCertificate(rootPEM)
+	federated := parseCertificate(certPEM)
+	sha := "efc7d6b475a56fe587650bcdb999a4a308f815ba44db4bf0371ea68a786ccd36"
+	tlsOptions := &tlsutil.TLSOptions{
+		MinVersion: 1.2,
+		MaxVersion: 1.2,
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		root       func(string) (*x509.Certificate, error)
+		roots      []*x509.Certificate
+		federation []*x509.Certificate
+		err        error
+		statusCode int
+	}{
+		{"ok", "?fingerprint=" + sha, nil, []*x509.Certificate{root}, []*x509.Certificate{root, federated}, nil, http.StatusOK},
+		{"ok-dashes", "?fingerprint=EFC7D6B4-75A5", func(sum string) (*x509.Certificate, error) {
+			assert.Equals(t, "efc7d6b475a5", sum)
+			return root, nil
+		}, []*x509.Certificate{root}, []*x509.Certificate{root, federated}, nil, http.StatusOK},
+		{"fail-missing", "", nil, nil, nil, nil, http.StatusBadRequest},
+		{"fail-not-found", "?fingerprint=" + sha, func(string) (*x509.Certificate, error) {
+			return nil, errors.New("not found")
+		}, nil, nil, nil, http.StatusNotFound},
+		{"fail-roots", "?fingerprint=" + sha, nil, nil, nil, errors.New("an error"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				root: func(sum string) (*x509.Certificate, error) {
+					if tt.root != nil {
+						return tt.root(sum)
+					}
+					assert.Equals(t, sha, sum)
+					return root, nil
+				},
+				getRoots: func() ([]*x509.Certificate, error) {
+					return tt.roots, tt.err
+				},
+				getFederation: func() ([]*x509.Certificate, error) {
+					return tt.federation, tt.err
+				},
+				getTLSOptions: func() *tlsutil.TLSOptions {
+					return tlsOptions
+				},
+			}).(*caHandler)
+			w := httptest.NewRecorder()
+			h.Bootstrap(w, httptest.NewRequest("GET", "http://example.com/bootstrap"+tt.query, nil))
+			assert.Equals(t, tt.statusCode, w.Code)
+			if tt.statusCode != http.StatusOK {
+				return
+			}
+
+			var resp BootstrapResponse
+			assert.FatalError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equals(t, root.Raw, resp.RootPEM.Raw)
+			assert.Equals(t, certChainToPEM(tt.roots), resp.Roots)
+			assert.Equals(t, certChainToPEM(tt.federation), resp.Federation)
+			assert.Equals(t, BootstrapDefaults{APIVersion: CurrentVersion, TLSOptions: tlsOptions}, resp.Defaults)
+		})
+	}
+}
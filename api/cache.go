@@ -0,0 +1,71 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CacheAuthority is the interface implemented by a CA authority that
+// configures the caching of the read endpoints.
+type CacheAuthority interface {
+	GetCacheControl() string
+}
+
+// writeCacheableJSON is like JSONStatus, but it adds an ETag header and
+// responds with a 304 Not Modified if the request has a matching
+// If-None-Match header.
+func (h *caHandler) writeCacheableJSON(w http.ResponseWriter, r *http.Request, v interface{}, status int) {
+	buf, err := encodeJSON(v)
+	if err != nil {
+		WriteError(w, InternalServerError(errors.Wrap(err, "error marshaling response")))
+		return
+	}
+	defer putBuffer(buf)
+	if h.writeCacheable(w, r, "application/json", buf.Bytes(), status) {
+		LogEnabledResponse(w, v)
+	}
+}
+
+// writeCacheable writes the given body with an ETag and the configured
+// Cache-Control header. If the request has an If-None-Match header matching
+// the ETag, the body is not written and the status is 304 Not Modified. It
+// returns true if the body has been written.
+func (h *caHandler) writeCacheable(w http.ResponseWriter, r *http.Request, contentType string, b []byte, status int) bool {
+	return h.writeCacheableWithETag(w, r, contentType, b, newETag(b), status)
+}
+
+// writeCacheableWithETag is like writeCacheable, but it uses the given ETag.
+func (h *caHandler) writeCacheableWithETag(w http.ResponseWriter, r *http.Request, contentType string, b []byte, etag string, status int) bool {
+	w.Header().Set("ETag", etag)
+	if cc := h.Authority.GetCacheControl(); cc != "" {
+		w.Header().Set("Cache-Control", cc)
+	}
+	if matchesETag(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return false
+	}
+	writeBody(w, contentType, b, status)
+	return true
+}
+
+// newETag returns a strong ETag for the given body.
+func newETag(b []byte) string {
+	sum := sha256.Sum256(b)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// matchesETag returns true if the value of an If-None-Match header matches the
+// given ETag using the weak comparison.
+func matchesETag(ifNoneMatch, etag string) bool {
+	for _, v := range strings.Split(ifNoneMatch, ",") {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+		if v == "*" || v == etag {
+			return true
+		}
+	}
+	return false
+}
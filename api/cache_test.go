@@ -0,0 +1,90 @@
+package api
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/smallstep/assert"
+)
+
+func Test_matchesETag(t *testing.T) {
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        bool
+	}{
+		{"empty", "", false},
+		{"match", `"abc"`, true},
+		{"weak", `W/"abc"`, true},
+		{"any", "*", true},
+		{"list", `"foo", "abc"`, true},
+		{"no-match", `"foo", W/"bar"`, false},
+		{"unquoted", "abc", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equals(t, tt.want, matchesETag(tt.ifNoneMatch, `"abc"`))
+		})
+	}
+}
+
+func Test_caHandler_cache(t *testing.T) {
+	root := parseCertificate(rootPEM)
+	h := New(&mockAuthority{
+		getCacheControl: func() string {
+			return "public, max-age=60"
+		},
+		getRoots: func() ([]*x509.Certificate, error) {
+			return []*x509.Certificate{root}, nil
+		},
+		getProvisioners: func(nextCursor string, limit int) (provisioner.List, string, error) {
+			return provisioner.List{}, "", nil
+		},
+	}).(*caHandler)
+
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		statusCode int
+	}{
+		{"roots", h.Roots, http.StatusCreated},
+		{"provisioners", h.Provisioners, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com/", nil)
+			w := httptest.NewRecorder()
+			tt.handler(w, req)
+			res := w.Result()
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			assert.Equals(t, "public, max-age=60", res.Header.Get("Cache-Control"))
+			body, err := ioutil.ReadAll(res.Body)
+			assert.FatalError(t, err)
+			etag := res.Header.Get("ETag")
+			assert.Equals(t, newETag(body), etag)
+
+			// Same ETag
+			req = httptest.NewRequest("GET", "http://example.com/", nil)
+			req.Header.Set("If-None-Match", etag)
+			w = httptest.NewRecorder()
+			tt.handler(w, req)
+			res = w.Result()
+			assert.Equals(t, http.StatusNotModified, res.StatusCode)
+			assert.Equals(t, etag, res.Header.Get("ETag"))
+			body, err = ioutil.ReadAll(res.Body)
+			assert.FatalError(t, err)
+			assert.Len(t, 0, body)
+
+			// Different ETag
+			req = httptest.NewRequest("GET", "http://example.com/", nil)
+			req.Header.Set("If-None-Match", `"foo"`)
+			w = httptest.NewRecorder()
+			tt.handler(w, req)
+			assert.Equals(t, tt.statusCode, w.Result().StatusCode)
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+)
+
+// CertificatesAuthority is the interface implemented by a CA authority that
+// keeps an inventory of the issued certificates.
+type CertificatesAuthority interface {
+	GetCertificates(filter authority.CertificateFilter, cursor string, limit int) ([]*authority.CertificateInfo, string, error)
+	GetCertificate(serial string) (*authority.CertificateInfo, error)
+	GetExpiringCertificates(filter authority.CertificateFilter, within time.Duration) ([]*authority.CertificateInfo, error)
+	GetStats(from, to time.Time) ([]*authority.ProvisionerStats, error)
+}
+
+// DefaultExpiringDays is the default number of days used to list the
+// certificates that are about to expire.
+const DefaultExpiringDays = 30
+
+// CertificateResponse is the representation of an issued certificate.
+type CertificateResponse struct {
+	Serial         string                      `json:"serial"`
+	CommonName     string                      `json:"commonName"`
+	DNSNames       []string                    `json:"dnsNames,omitempty"`
+	EmailAddresses []string                    `json:"emailAddresses,omitempty"`
+	IPAddresses    []string                    `json:"ipAddresses,omitempty"`
+	URIs           []string                    `json:"uris,omitempty"`
+	Provisioner    string                      `json:"provisioner,omitempty"`
+	Status         authority.CertificateStatus `json:"status"`
+	NotBefore      time.Time                   `json:"notBefore"`
+	NotAfter       time.Time                   `json:"notAfter"`
+	CertificatePEM Certificate                 `json:"crt"`
+}
+
+// CertificatesResponse is the response object of the certificates list.
+type CertificatesResponse struct {
+	Certificates []*CertificateResponse `json:"certificates"`
+	NextCursor   string                 `json:"nextCursor"`
+}
+
+// CertificateDetailsResponse is the response object of a certificate lookup.
+// It adds to the certificate the issuance metadata and the revocation
+// information.
+type CertificateDetailsResponse struct {
+	CertificateResponse
+	ProvisionerID   string              `json:"provisionerID,omitempty"`
+	ProvisionerType string              `json:"provisionerType,omitempty"`
+	TokenSubject    string              `json:"tokenSubject,omitempty"`
+	TokenID         string              `json:"tokenID,omitempty"`
+	Revocation      *RevocationResponse `json:"revocation,omitempty"`
+}
+
+// RevocationResponse contains the revocation information of a certificate.
+type RevocationResponse struct {
+	ReasonCode    int       `json:"reasonCode"`
+	Reason        string    `json:"reason,omitempty"`
+	RevokedAt     time.Time `json:"revokedAt"`
+	ProvisionerID string    `json:"provisionerID,omitempty"`
+	TokenID       string    `json:"tokenID,omitempty"`
+	MTLS          bool      `json:"mTLS"`
+}
+
+func newCertificateResponse(ci *authority.CertificateInfo) *CertificateResponse {
+	crt := ci.Certificate
+	res := &CertificateResponse{
+		Serial:         crt.SerialNumber.String(),
+		CommonName:     crt.Subject.CommonName,
+		DNSNames:       crt.DNSNames,
+		EmailAddresses: crt.EmailAddresses,
+		Provisioner:    ci.Provisioner,
+		Status:         ci.Status,
+		NotBefore:      crt.NotBefore,
+		NotAfter:       crt.NotAfter,
+		CertificatePEM: Certificate{crt},
+	}
+	for _, ip := range crt.IPAddresses {
+		res.IPAddresses = append(res.IPAddresses, ip.String())
+	}
+	for _, u := range crt.URIs {
+		res.URIs = append(res.URIs, u.String())
+	}
+	return res
+}
+
+func newCertificateDetailsResponse(ci *authority.CertificateInfo) *CertificateDetailsResponse {
+	res := &CertificateDetailsResponse{
+		CertificateResponse: *newCertificateResponse(ci),
+	}
+	if ci.Data != nil {
+		if ci.Data.Provisioner != nil {
+			res.ProvisionerID = ci.Data.Provisioner.ID
+			res.ProvisionerType = ci.Data.Provisioner.Type
+		}
+		res.TokenSubject = ci.Data.TokenSubject
+		res.TokenID = ci.Data.TokenID
+	}
+	if rci := ci.Revocation; rci != nil {
+		res.Revocation = &RevocationResponse{
+			ReasonCode:    rci.ReasonCode,
+			Reason:        rci.Reason,
+			RevokedAt:     rci.RevokedAt,
+			ProvisionerID: rci.ProvisionerID,
+			TokenID:       rci.TokenID,
+			MTLS:          rci.MTLS,
+		}
+	}
+	return res
+}
+
+// Certificates is an HTTP handler that returns the issued certificates. The
+// list can be filtered using the san, cn, provisioner, status, issuedAfter,
+// issuedBefore and expiresBefore query parameters, and paginated using the
+// cursor and limit parameters. The time parameters accept an RFC 3339 time or
+// a duration relative to the current time, e.g. -24h.
+func (h *caHandler) Certificates(w http.ResponseWriter, r *http.Request) {
+	cursor, limit, err := parseCursor(r)
+	if err != nil {
+		WriteError(w, BadRequest(err))
+		return
+	}
+	filter, err := parseCertificateFilter(r)
+	if err != nil {
+		WriteError(w, BadRequest(err))
+		return
+	}
+
+	list, next, err := h.Authority.GetCertificates(filter, cursor, limit)
+	if err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+	res := &CertificatesResponse{
+		Certificates: make([]*CertificateResponse, len(list)),
+		NextCursor:   next,
+	}
+	for i, ci := range list {
+		res.Certificates[i] = newCertificateResponse(ci)
+	}
+	JSON(w, res)
+}
+
+// ExpiringCertificates is an HTTP handler that returns the active certificates
+// that expire within the number of days in the days query parameter, 30 by
+// default, sorted by expiration date. The list can be filtered using the san,
+// cn and provisioner query parameters.
+func (h *caHandler) ExpiringCertificates(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	days := DefaultExpiringDays
+	if v := q.Get("days"); v != "" {
+		var err error
+		if days, err = strconv.Atoi(v); err != nil || days <= 0 {
+			WriteError(w, BadRequest(errors.Errorf("days must be a positive integer, got %s", v)))
+			return
+		}
+	}
+	filter := authority.CertificateFilter{
+		SAN:         q.Get("san"),
+		CommonName:  q.Get("cn"),
+		Provisioner: q.Get("provisioner"),
+	}
+
+	list, err := h.Authority.GetExpiringCertificates(filter, time.Duration(days)*24*time.Hour)
+	if err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+
+	// The list is not paginated, so it is streamed like a CertificatesResponse.
+	s := newJSONStream(w, http.StatusOK, "certificates")
+	for _, ci := range list {
+		if err := s.Encode(newCertificateResponse(ci)); err != nil {
+			LogError(w, err)
+			return
+		}
+	}
+	if err := s.Close(jsonField{Name: "nextCursor", Value: ""}); err != nil {
+		LogError(w, err)
+	}
+}
+
+// CertificateDetails is an HTTP handler that returns an issued certificate by
+// its serial number, with the provisioner and token used to issue it and its
+// revocation status.
+func (h *caHandler) CertificateDetails(w http.ResponseWriter, r *http.Request) {
+	ci, err := h.Authority.GetCertificate(chi.URLParam(r, "serial"))
+	if err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+	JSON(w, newCertificateDetailsResponse(ci))
+}
+
+func parseCertificateFilter(r *http.Request) (authority.CertificateFilter, error) {
+	q := r.URL.Query()
+	filter := authority.CertificateFilter{
+		SAN:         q.Get("san"),
+		CommonName:  q.Get("cn"),
+		Provisioner: q.Get("provisioner"),
+		Status:      authority.CertificateStatus(q.Get("status")),
+	}
+	for key, t := range map[string]*time.Time{
+		"issuedAfter":   &filter.IssuedAfter,
+		"issuedBefore":  &filter.IssuedBefore,
+		"expiresBefore": &filter.ExpiresBefore,
+	} {
+		if v := q.Get(key); v != "" {
+			td, err := ParseTimeDuration(v)
+			if err != nil {
+				return filter, errors.Wrapf(err, "error parsing %s", key)
+			}
+			*t = td.Time()
+		}
+	}
+	return filter, nil
+}
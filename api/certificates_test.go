@@ -0,0 +1,201 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/go-chi/chi"
+	"github.com/smallstep/assert"
+)
+
+func Test_caHandler_Certificates(t *testing.T) {
+	crt := parseCertificate(certPEM)
+	issuedAfter, err := time.Parse(time.RFC3339, "2019-10-01T00:00:00Z")
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name       string
+		query      string
+		filter     authority.CertificateFilter
+		cursor     string
+		limit      int
+		err        error
+		statusCode int
+	}{
+		{"ok", "", authority.CertificateFilter{}, "", 0, nil, http.StatusOK},
+		{"ok-filter", "?san=test.smallstep.com&cn=foo&provisioner=step-cli&status=active&issuedAfter=2019-10-01T00:00:00Z&cursor=1234&limit=10",
+			authority.CertificateFilter{
+				SAN:         "test.smallstep.com",
+				CommonName:  "foo",
+				Provisioner: "step-cli",
+				Status:      authority.CertificateActive,
+				IssuedAfter: issuedAfter,
+			}, "1234", 10, nil, http.StatusOK},
+		{"fail-limit", "?limit=foo", authority.CertificateFilter{}, "", 0, nil, http.StatusBadRequest},
+		{"ok-expires-before", "?expiresBefore=2019-10-01T00:00:00Z", authority.CertificateFilter{ExpiresBefore: issuedAfter}, "", 0, nil, http.StatusOK},
+		{"fail-time", "?issuedBefore=foo", authority.CertificateFilter{}, "", 0, nil, http.StatusBadRequest},
+		{"fail", "", authority.CertificateFilter{}, "", 0, fmt.Errorf("an error"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				getCertificates: func(filter authority.CertificateFilter, cursor string, limit int) ([]*authority.CertificateInfo, string, error) {
+					assert.Equals(t, tt.filter, filter)
+					assert.Equals(t, tt.cursor, cursor)
+					assert.Equals(t, tt.limit, limit)
+					return []*authority.CertificateInfo{
+						{Certificate: crt, Provisioner: "step-cli", Status: authority.CertificateActive},
+					}, "5678", tt.err
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("GET", "http://example.com/certificates"+tt.query, nil)
+			w := httptest.NewRecorder()
+			h.Certificates(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			if tt.statusCode == http.StatusOK {
+				var body CertificatesResponse
+				assert.FatalError(t, ReadJSON(res.Body, &body))
+				assert.Equals(t, "5678", body.NextCursor)
+				if assert.Len(t, 1, body.Certificates) {
+					c := body.Certificates[0]
+					assert.Equals(t, crt.SerialNumber.String(), c.Serial)
+					assert.Equals(t, crt.Subject.CommonName, c.CommonName)
+					assert.Equals(t, crt.DNSNames, c.DNSNames)
+					assert.Equals(t, "step-cli", c.Provisioner)
+					assert.Equals(t, authority.CertificateActive, c.Status)
+					assert.Equals(t, crt.Raw, c.CertificatePEM.Raw)
+				}
+			}
+		})
+	}
+}
+
+func Test_caHandler_CertificateDetails(t *testing.T) {
+	crt := parseCertificate(certPEM)
+	revokedAt := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+	ci := &authority.CertificateInfo{
+		Certificate: crt,
+		Provisioner: "step-cli",
+		Status:      authority.CertificateRevoked,
+		Data: &db.CertificateData{
+			Provisioner:  &db.ProvisionerData{ID: "step-cli:kid", Name: "step-cli", Type: "JWK"},
+			TokenSubject: "test.smallstep.com",
+			TokenID:      "token-id",
+		},
+		Revocation: &db.RevokedCertificateInfo{
+			Serial:     crt.SerialNumber.String(),
+			ReasonCode: 1,
+			Reason:     "key compromise",
+			RevokedAt:  revokedAt,
+		},
+	}
+
+	tests := []struct {
+		name       string
+		ci         *authority.CertificateInfo
+		err        error
+		statusCode int
+	}{
+		{"ok", ci, nil, http.StatusOK},
+		{"ok-no-metadata", &authority.CertificateInfo{Certificate: crt, Status: authority.CertificateActive}, nil, http.StatusOK},
+		{"fail", nil, fmt.Errorf("an error"), http.StatusInternalServerError},
+	}
+
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add("serial", "1234")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				getCertificate: func(serial string) (*authority.CertificateInfo, error) {
+					assert.Equals(t, "1234", serial)
+					return tt.ci, tt.err
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("GET", "http://example.com/certificates/1234", nil)
+			req = req.WithContext(context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx))
+			w := httptest.NewRecorder()
+			h.CertificateDetails(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			if tt.statusCode == http.StatusOK {
+				var body CertificateDetailsResponse
+				assert.FatalError(t, ReadJSON(res.Body, &body))
+				assert.Equals(t, crt.SerialNumber.String(), body.Serial)
+				assert.Equals(t, crt.Raw, body.CertificatePEM.Raw)
+				assert.Equals(t, tt.ci.Status, body.Status)
+				if tt.ci.Data != nil {
+					assert.Equals(t, "step-cli", body.Provisioner)
+					assert.Equals(t, "step-cli:kid", body.ProvisionerID)
+					assert.Equals(t, "JWK", body.ProvisionerType)
+					assert.Equals(t, "test.smallstep.com", body.TokenSubject)
+					assert.Equals(t, "token-id", body.TokenID)
+					assert.Equals(t, &RevocationResponse{
+						ReasonCode: 1,
+						Reason:     "key compromise",
+						RevokedAt:  revokedAt,
+					}, body.Revocation)
+				} else {
+					assert.Equals(t, "", body.TokenSubject)
+					assert.Nil(t, body.Revocation)
+				}
+			}
+		})
+	}
+}
+
+func Test_caHandler_ExpiringCertificates(t *testing.T) {
+	crt := parseCertificate(certPEM)
+	tests := []struct {
+		name       string
+		query      string
+		filter     authority.CertificateFilter
+		within     time.Duration
+		err        error
+		statusCode int
+	}{
+		{"ok", "", authority.CertificateFilter{}, 30 * 24 * time.Hour, nil, http.StatusOK},
+		{"ok-filter", "?days=7&san=test.smallstep.com&cn=foo&provisioner=step-cli",
+			authority.CertificateFilter{SAN: "test.smallstep.com", CommonName: "foo", Provisioner: "step-cli"},
+			7 * 24 * time.Hour, nil, http.StatusOK},
+		{"fail-days", "?days=foo", authority.CertificateFilter{}, 0, nil, http.StatusBadRequest},
+		{"fail-negative-days", "?days=-1", authority.CertificateFilter{}, 0, nil, http.StatusBadRequest},
+		{"fail", "", authority.CertificateFilter{}, 30 * 24 * time.Hour, fmt.Errorf("an error"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				getExpiringCertificates: func(filter authority.CertificateFilter, within time.Duration) ([]*authority.CertificateInfo, error) {
+					assert.Equals(t, tt.filter, filter)
+					assert.Equals(t, tt.within, within)
+					return []*authority.CertificateInfo{
+						{Certificate: crt, Provisioner: "step-cli", Status: authority.CertificateActive},
+					}, tt.err
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("GET", "http://example.com/certificates/expiring"+tt.query, nil)
+			w := httptest.NewRecorder()
+			h.ExpiringCertificates(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			if tt.statusCode == http.StatusOK {
+				var body CertificatesResponse
+				assert.FatalError(t, ReadJSON(res.Body, &body))
+				assert.Equals(t, "", body.NextCursor)
+				if assert.Len(t, 1, body.Certificates) {
+					assert.Equals(t, crt.SerialNumber.String(), body.Certificates[0].Serial)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+)
+
+// CORSAuthority is the interface implemented by a CA authority that allows
+// cross-origin requests to the read-only endpoints.
+type CORSAuthority interface {
+	GetCORSConfig() *authority.CORSConfig
+}
+
+// corsRoutes are the read-only endpoints that allow cross-origin requests.
+var corsRoutes = []string{
+	"/health",
+	"/versions",
+	"/root/{sha}",
+	"/bootstrap",
+	DiscoveryPath,
+	OpenAPIPath,
+	"/roots",
+	"/federation",
+	"/intermediates",
+	"/transparency/sth",
+	"/transparency/entries",
+	"/transparency/proof/{serial}",
+	"/jwt-svid/keys",
+	"/crl",
+	"/provisioners",
+	"/provisioners/{kid}/encrypted-key",
+}
+
+// routeCORS adds the handlers of the CORS preflight requests of the read-only
+// endpoints if CORS is configured.
+func (h *caHandler) routeCORS(r Router) {
+	if h.Authority.GetCORSConfig() == nil {
+		return
+	}
+	for _, pattern := range corsRoutes {
+		r.MethodFunc("OPTIONS", pattern, h.CORSPreflight)
+	}
+}
+
+// cors is a middleware that adds the CORS headers to the responses of the
+// requests from an allowed origin.
+func (h *caHandler) cors(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if config := h.Authority.GetCORSConfig(); config != nil {
+			setAllowOrigin(w, r, config)
+		}
+		next(w, r)
+	}
+}
+
+// CORSPreflight is an HTTP handler that responds to the CORS preflight
+// requests of the read-only endpoints. The CORS headers are only added if the
+// origin, method and headers requested are allowed.
+func (h *caHandler) CORSPreflight(w http.ResponseWriter, r *http.Request) {
+	config := h.Authority.GetCORSConfig()
+	if config != nil && isAllowedMethod(r.Header.Get("Access-Control-Request-Method"), config) &&
+		areAllowedHeaders(r.Header.Get("Access-Control-Request-Headers"), config) &&
+		setAllowOrigin(w, r, config) {
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(config.AllowedMethods, ", "))
+		if len(config.AllowedHeaders) > 0 {
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(config.AllowedHeaders, ", "))
+		}
+		if config.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(config.MaxAge))
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// setAllowOrigin sets the Access-Control-Allow-Origin header if the origin of
+// the request is allowed, and returns true if it is.
+func setAllowOrigin(w http.ResponseWriter, r *http.Request, config *authority.CORSConfig) bool {
+	// The response depends on the origin of the request.
+	w.Header().Add("Vary", "Origin")
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	for _, o := range config.AllowedOrigins {
+		switch o {
+		case "*":
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			return true
+		case origin:
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			return true
+		}
+	}
+	return false
+}
+
+func isAllowedMethod(method string, config *authority.CORSConfig) bool {
+	for _, m := range config.AllowedMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+func areAllowedHeaders(headers string, config *authority.CORSConfig) bool {
+	for _, h := range strings.Split(headers, ",") {
+		if h = strings.TrimSpace(h); h == "" {
+			continue
+		}
+		var ok bool
+		for _, ah := range config.AllowedHeaders {
+			if strings.EqualFold(h, ah) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
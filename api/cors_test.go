@@ -0,0 +1,112 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/smallstep/assert"
+)
+
+func Test_caHandler_cors(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *authority.CORSConfig
+		origin      string
+		allowOrigin string
+		vary        []string
+	}{
+		{"disabled", nil, "https://tools.smallstep.com", "", nil},
+		{"ok", &authority.CORSConfig{AllowedOrigins: []string{"https://tools.smallstep.com"}}, "https://tools.smallstep.com", "https://tools.smallstep.com", []string{"Origin"}},
+		{"ok-any", &authority.CORSConfig{AllowedOrigins: []string{"*"}}, "https://tools.smallstep.com", "*", []string{"Origin"}},
+		{"not-allowed", &authority.CORSConfig{AllowedOrigins: []string{"https://tools.smallstep.com"}}, "https://evil.com", "", []string{"Origin"}},
+		{"no-origin", &authority.CORSConfig{AllowedOrigins: []string{"*"}}, "", "", []string{"Origin"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				getCORSConfig: func() *authority.CORSConfig { return tt.config },
+			}).(*caHandler)
+			req := httptest.NewRequest("GET", "http://example.com/health", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			h.cors(h.Health)(w, req)
+			res := w.Result()
+			assert.Equals(t, http.StatusOK, res.StatusCode)
+			assert.Equals(t, tt.allowOrigin, res.Header.Get("Access-Control-Allow-Origin"))
+			assert.Equals(t, tt.vary, res.Header["Vary"])
+		})
+	}
+}
+
+func Test_caHandler_CORSPreflight(t *testing.T) {
+	config := &authority.CORSConfig{
+		AllowedOrigins: []string{"https://tools.smallstep.com"},
+		AllowedHeaders: []string{"if-none-match"},
+		MaxAge:         600,
+	}
+	assert.FatalError(t, config.Validate())
+
+	tests := []struct {
+		name    string
+		origin  string
+		method  string
+		headers string
+		allowed bool
+	}{
+		{"ok", "https://tools.smallstep.com", "GET", "", true},
+		{"ok-headers", "https://tools.smallstep.com", "GET", "If-None-Match", true},
+		{"fail-origin", "https://evil.com", "GET", "", false},
+		{"fail-method", "https://tools.smallstep.com", "POST", "", false},
+		{"fail-headers", "https://tools.smallstep.com", "GET", "If-None-Match, Authorization", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				getCORSConfig: func() *authority.CORSConfig { return config },
+			}).(*caHandler)
+			req := httptest.NewRequest("OPTIONS", "http://example.com/roots", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", tt.method)
+			if tt.headers != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.headers)
+			}
+			w := httptest.NewRecorder()
+			h.CORSPreflight(w, req)
+			res := w.Result()
+			assert.Equals(t, http.StatusNoContent, res.StatusCode)
+			if tt.allowed {
+				assert.Equals(t, tt.origin, res.Header.Get("Access-Control-Allow-Origin"))
+				assert.Equals(t, "GET, HEAD", res.Header.Get("Access-Control-Allow-Methods"))
+				assert.Equals(t, "If-None-Match", res.Header.Get("Access-Control-Allow-Headers"))
+				assert.Equals(t, "600", res.Header.Get("Access-Control-Max-Age"))
+			} else {
+				assert.Equals(t, "", res.Header.Get("Access-Control-Allow-Origin"))
+				assert.Equals(t, "", res.Header.Get("Access-Control-Allow-Methods"))
+			}
+		})
+	}
+}
+
+func Test_caHandler_routeCORS(t *testing.T) {
+	r := testRouter{}
+	New(&mockAuthority{}).(*caHandler).Route(r)
+	_, ok := r["OPTIONS /roots"]
+	assert.False(t, ok)
+
+	r = testRouter{}
+	New(&mockAuthority{
+		getCORSConfig: func() *authority.CORSConfig {
+			return &authority.CORSConfig{AllowedOrigins: []string{"*"}}
+		},
+	}).(*caHandler).Route(r)
+	for _, pattern := range corsRoutes {
+		_, ok := r["OPTIONS "+pattern]
+		assert.True(t, ok, pattern)
+	}
+	_, ok = r["OPTIONS /sign"]
+	assert.False(t, ok)
+}
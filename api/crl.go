@@ -0,0 +1,27 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/RTradeLtd/ca-certificates/db"
+)
+
+// CRLAuthority is the interface implemented by a CA authority that publishes
+// a certificate revocation list.
+type CRLAuthority interface {
+	GetCRL() (*db.CRLInfo, error)
+}
+
+// CRL is an HTTP handler that returns the latest CRL of the CA in DER format.
+// The CRL is also served by the insecure handler, so it can be used in the
+// CRL distribution points of the certificates.
+func (h *caHandler) CRL(w http.ResponseWriter, r *http.Request) {
+	crl, err := h.Authority.GetCRL()
+	if err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+	w.Header().Set("Last-Modified", crl.ThisUpdate.UTC().Format(http.TimeFormat))
+	w.Header().Set("Expires", crl.NextUpdate.UTC().Format(http.TimeFormat))
+	h.writeCacheableWithETag(w, r, PKIXCRLContentType, crl.DER, newETag(crl.DER), http.StatusOK)
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/smallstep/assert"
+)
+
+func Test_caHandler_CRL(t *testing.T) {
+	thisUpdate := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	crl := &db.CRLInfo{
+		Number:     1,
+		ThisUpdate: thisUpdate,
+		NextUpdate: thisUpdate.Add(24 * time.Hour),
+		DER:        []byte("the-crl"),
+	}
+	tests := []struct {
+		name       string
+		crl        *db.CRLInfo
+		err        error
+		statusCode int
+	}{
+		{"ok", crl, nil, http.StatusOK},
+		{"fail", nil, fmt.Errorf("an error"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				getCRL: func() (*db.CRLInfo, error) {
+					return tt.crl, tt.err
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("GET", "http://example.com/crl", nil)
+			w := httptest.NewRecorder()
+			h.CRL(w, req)
+
+			assert.Equals(t, tt.statusCode, w.Code)
+			if tt.err == nil {
+				assert.Equals(t, PKIXCRLContentType, w.Header().Get("Content-Type"))
+				assert.Equals(t, "Wed, 01 Jan 2020 00:00:00 GMT", w.Header().Get("Last-Modified"))
+				assert.Equals(t, "Thu, 02 Jan 2020 00:00:00 GMT", w.Header().Get("Expires"))
+				assert.Equals(t, []byte("the-crl"), w.Body.Bytes())
+
+				// The CRL is not sent again if it has not changed.
+				req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+				w = httptest.NewRecorder()
+				h.CRL(w, req)
+				assert.Equals(t, http.StatusNotModified, w.Code)
+			}
+		})
+	}
+}
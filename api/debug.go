@@ -0,0 +1,107 @@
+package api
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/go-chi/chi"
+)
+
+// startTime is used to report the uptime of the CA.
+var startTime = time.Now()
+
+// debugHandler serves the profiling and runtime endpoints. All of them require
+// an admin token or certificate.
+type debugHandler struct {
+	*caHandler
+}
+
+// NewDebug returns the handler of the debug endpoints, the pprof profiles in
+// /debug/pprof/ and the runtime statistics in /debug/runtime. It is intended
+// to be served in a separate listener.
+func NewDebug(authority Authority) RouterHandler {
+	return &debugHandler{
+		caHandler: &caHandler{Authority: authority},
+	}
+}
+
+func (h *debugHandler) Route(r Router) {
+	r.MethodFunc("GET", "/debug/pprof/", h.requireAdmin(authority.AdminRoleReadOnly, pprof.Index))
+	r.MethodFunc("GET", "/debug/pprof/cmdline", h.requireAdmin(authority.AdminRoleReadOnly, pprof.Cmdline))
+	r.MethodFunc("GET", "/debug/pprof/profile", h.requireAdmin(authority.AdminRoleReadOnly, pprof.Profile))
+	r.MethodFunc("GET", "/debug/pprof/symbol", h.requireAdmin(authority.AdminRoleReadOnly, pprof.Symbol))
+	r.MethodFunc("POST", "/debug/pprof/symbol", h.requireAdmin(authority.AdminRoleReadOnly, pprof.Symbol))
+	r.MethodFunc("GET", "/debug/pprof/trace", h.requireAdmin(authority.AdminRoleReadOnly, pprof.Trace))
+	r.MethodFunc("GET", "/debug/pprof/{profile}", h.requireAdmin(authority.AdminRoleReadOnly, h.Profile))
+	r.MethodFunc("GET", "/debug/runtime", h.requireAdmin(authority.AdminRoleReadOnly, h.Runtime))
+}
+
+// Profile is an HTTP handler that writes the pprof profile with the given
+// name, e.g. heap or goroutine.
+func (h *debugHandler) Profile(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "profile")
+	pprof.Handler(name).ServeHTTP(w, r)
+}
+
+// RuntimeStats is the response of the runtime statistics endpoint.
+type RuntimeStats struct {
+	GoVersion    string      `json:"goVersion"`
+	Uptime       string      `json:"uptime"`
+	NumCPU       int         `json:"numCPU"`
+	GOMAXPROCS   int         `json:"gomaxprocs"`
+	NumGoroutine int         `json:"numGoroutine"`
+	NumCgoCall   int64       `json:"numCgoCall"`
+	Memory       MemoryStats `json:"memory"`
+}
+
+// MemoryStats is the subset of runtime.MemStats returned by the runtime
+// statistics endpoint. Sizes are in bytes.
+type MemoryStats struct {
+	Alloc        uint64     `json:"alloc"`
+	TotalAlloc   uint64     `json:"totalAlloc"`
+	Sys          uint64     `json:"sys"`
+	Mallocs      uint64     `json:"mallocs"`
+	Frees        uint64     `json:"frees"`
+	HeapAlloc    uint64     `json:"heapAlloc"`
+	HeapInuse    uint64     `json:"heapInuse"`
+	HeapObjects  uint64     `json:"heapObjects"`
+	StackInuse   uint64     `json:"stackInuse"`
+	NumGC        uint32     `json:"numGC"`
+	PauseTotalNs uint64     `json:"pauseTotalNs"`
+	LastGC       *time.Time `json:"lastGC,omitempty"`
+}
+
+// Runtime is an HTTP handler that returns the statistics of the Go runtime.
+func (h *debugHandler) Runtime(w http.ResponseWriter, r *http.Request) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	stats := &RuntimeStats{
+		GoVersion:    runtime.Version(),
+		Uptime:       time.Since(startTime).Truncate(time.Second).String(),
+		NumCPU:       runtime.NumCPU(),
+		GOMAXPROCS:   runtime.GOMAXPROCS(0),
+		NumGoroutine: runtime.NumGoroutine(),
+		NumCgoCall:   runtime.NumCgoCall(),
+		Memory: MemoryStats{
+			Alloc:        m.Alloc,
+			TotalAlloc:   m.TotalAlloc,
+			Sys:          m.Sys,
+			Mallocs:      m.Mallocs,
+			Frees:        m.Frees,
+			HeapAlloc:    m.HeapAlloc,
+			HeapInuse:    m.HeapInuse,
+			HeapObjects:  m.HeapObjects,
+			StackInuse:   m.StackInuse,
+			NumGC:        m.NumGC,
+			PauseTotalNs: m.PauseTotalNs,
+		},
+	}
+	if m.LastGC > 0 {
+		t := time.Unix(0, int64(m.LastGC)).UTC()
+		stats.Memory.LastGC = &t
+	}
+	JSON(w, stats)
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/smallstep/assert"
+)
+
+func Test_debugHandler_Route(t *testing.T) {
+	mux := chi.NewRouter()
+	NewDebug(&mockAuthority{
+		authorizeAdmin: func(ott string) (string, error) {
+			if ott == "admin-token" {
+				return "admin", nil
+			}
+			return "", errors.New("not an admin")
+		},
+	}).Route(mux)
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		statusCode int
+	}{
+		{"ok-index", "/debug/pprof/", "admin-token", http.StatusOK},
+		{"ok-heap", "/debug/pprof/heap", "admin-token", http.StatusOK},
+		{"ok-cmdline", "/debug/pprof/cmdline", "admin-token", http.StatusOK},
+		{"ok-runtime", "/debug/runtime", "admin-token", http.StatusOK},
+		{"fail-profile", "/debug/pprof/foo", "admin-token", http.StatusNotFound},
+		{"fail-no-token", "/debug/pprof/heap", "", http.StatusUnauthorized},
+		{"fail-token", "/debug/runtime", "other-token", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+			assert.Equals(t, tt.statusCode, w.Code)
+		})
+	}
+}
+
+func Test_debugHandler_Runtime(t *testing.T) {
+	h := NewDebug(&mockAuthority{}).(*debugHandler)
+	w := httptest.NewRecorder()
+	h.Runtime(w, httptest.NewRequest("GET", "/debug/runtime", nil))
+	assert.Equals(t, http.StatusOK, w.Code)
+
+	var stats RuntimeStats
+	assert.FatalError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equals(t, runtime.Version(), stats.GoVersion)
+	assert.Equals(t, runtime.NumCPU(), stats.NumCPU)
+	assert.True(t, stats.NumGoroutine > 0)
+	assert.True(t, stats.Memory.Sys > 0)
+}
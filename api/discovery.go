@@ -0,0 +1,99 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+)
+
+// DiscoveryPath is the path of the discovery document of the CA.
+const DiscoveryPath = "/.well-known/step-ca"
+
+// DiscoveryAuthority is the interface implemented by a CA authority that
+// describes its capabilities in the discovery document.
+type DiscoveryAuthority interface {
+	GetDiscovery() *authority.Discovery
+}
+
+// DiscoveryResponse is the discovery document of the CA. Generic clients can
+// use it to configure themselves against any deployment of the CA.
+type DiscoveryResponse struct {
+	Issuer           string                       `json:"issuer"`
+	APIVersions      []string                     `json:"apiVersions"`
+	Endpoints        DiscoveryEndpoints           `json:"endpoints"`
+	KeyTypes         []authority.DiscoveryKeyType `json:"keyTypes"`
+	ProvisionerTypes []string                     `json:"provisionerTypes"`
+}
+
+// DiscoveryEndpoints are the URLs of the endpoints of the CA. The optional
+// endpoints are only present if the CA serves them.
+type DiscoveryEndpoints struct {
+	Bootstrap       string            `json:"bootstrap"`
+	Roots           string            `json:"roots"`
+	Federation      string            `json:"federation"`
+	Provisioners    string            `json:"provisioners"`
+	Sign            string            `json:"sign"`
+	Renew           string            `json:"renew"`
+	Rekey           string            `json:"rekey"`
+	Revoke          string            `json:"revoke"`
+	SSHSign         string            `json:"sshSign,omitempty"`
+	JWTSVID         string            `json:"jwtSVID,omitempty"`
+	JWTSVIDKeys     string            `json:"jwtSVIDKeys,omitempty"`
+	Nonce           string            `json:"nonce,omitempty"`
+	ACMEDirectories map[string]string `json:"acmeDirectories,omitempty"`
+	CRL             string            `json:"crl,omitempty"`
+	OCSP            string            `json:"ocsp,omitempty"`
+}
+
+// Discovery is an HTTP handler that returns the discovery document of the CA.
+// The URLs use the host of the request, and the paths of the current version
+// of the API.
+func (h *caHandler) Discovery(w http.ResponseWriter, r *http.Request) {
+	d := h.Authority.GetDiscovery()
+	base := (&url.URL{Scheme: "https", Host: r.Host}).String()
+	resolve := func(path string) string {
+		return base + path
+	}
+	versioned := func(path string) string {
+		return resolve("/" + CurrentVersion + path)
+	}
+
+	endpoints := DiscoveryEndpoints{
+		Bootstrap:    versioned("/bootstrap"),
+		Roots:        versioned("/roots"),
+		Federation:   versioned("/federation"),
+		Provisioners: versioned("/provisioners"),
+		Sign:         versioned("/sign"),
+		Renew:        versioned("/renew"),
+		Rekey:        versioned("/rekey"),
+		Revoke:       versioned("/revoke"),
+	}
+	if d.SSH {
+		endpoints.SSHSign = versioned("/sign-ssh")
+	}
+	if d.JWTSVID {
+		endpoints.JWTSVID = versioned("/jwt-svid")
+		endpoints.JWTSVIDKeys = versioned("/jwt-svid/keys")
+	}
+	if d.Nonce {
+		endpoints.Nonce = versioned("/nonce")
+	}
+	if d.CRL {
+		endpoints.CRL = versioned("/crl")
+	}
+	if len(d.ACMEProvisioners) > 0 {
+		endpoints.ACMEDirectories = make(map[string]string, len(d.ACMEProvisioners))
+		for _, name := range d.ACMEProvisioners {
+			endpoints.ACMEDirectories[name] = resolve("/acme/" + url.PathEscape(name) + "/directory")
+		}
+	}
+
+	h.writeCacheableJSON(w, r, &DiscoveryResponse{
+		Issuer:           base,
+		APIVersions:      SupportedVersions,
+		Endpoints:        endpoints,
+		KeyTypes:         d.KeyTypes,
+		ProvisionerTypes: d.ProvisionerTypes,
+	}, http.StatusOK)
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/go-chi/chi"
+	"github.com/smallstep/assert"
+)
+
+func Test_caHandler_Discovery(t *testing.T) {
+	keyTypes := []authority.DiscoveryKeyType{{Kty: "EC", Crv: []string{"P-256"}}}
+	tests := []struct {
+		name      string
+		discovery *authority.Discovery
+		want      DiscoveryResponse
+	}{
+		{"ok", &authority.Discovery{
+			ProvisionerTypes: []string{"JWK"},
+			KeyTypes:         keyTypes,
+		}, DiscoveryResponse{
+			Issuer:      "https://ca.example.com:9000",
+			APIVersions: SupportedVersions,
+			Endpoints: DiscoveryEndpoints{
+				Bootstrap:    "https://ca.example.com:9000/v1/bootstrap",
+				Roots:        "https://ca.example.com:9000/v1/roots",
+				Federation:   "https://ca.example.com:9000/v1/federation",
+				Provisioners: "https://ca.example.com:9000/v1/provisioners",
+				Sign:         "https://ca.example.com:9000/v1/sign",
+				Renew:        "https://ca.example.com:9000/v1/renew",
+				Rekey:        "https://ca.example.com:9000/v1/rekey",
+				Revoke:       "https://ca.example.com:9000/v1/revoke",
+			},
+			KeyTypes:         keyTypes,
+			ProvisionerTypes: []string{"JWK"},
+		}},
+		{"ok-ssh-acme", &authority.Discovery{
+			SSH:              true,
+			JWTSVID:          true,
+			Nonce:            true,
+			CRL:              true,
+			ProvisionerTypes: []string{"JWK", "ACME"},
+			ACMEProvisioners: []string{"acme", "my acme"},
+			KeyTypes:         keyTypes,
+		}, DiscoveryResponse{
+			Issuer:      "https://ca.example.com:9000",
+			APIVersions: SupportedVersions,
+			Endpoints: DiscoveryEndpoints{
+				Bootstrap:    "https://ca.example.com:9000/v1/bootstrap",
+				Roots:        "https://ca.example.com:9000/v1/roots",
+				Federation:   "https://ca.example.com:9000/v1/federation",
+				Provisioners: "https://ca.example.com:9000/v1/provisioners",
+				Sign:         "https://ca.example.com:9000/v1/sign",
+				Renew:        "https://ca.example.com:9000/v1/renew",
+				Rekey:        "https://ca.example.com:9000/v1/rekey",
+				Revoke:       "https://ca.example.com:9000/v1/revoke",
+				SSHSign:      "https://ca.example.com:9000/v1/sign-ssh",
+				JWTSVID:      "https://ca.example.com:9000/v1/jwt-svid",
+				JWTSVIDKeys:  "https://ca.example.com:9000/v1/jwt-svid/keys",
+				Nonce:        "https://ca.example.com:9000/v1/nonce",
+				CRL:          "https://ca.example.com:9000/v1/crl",
+				ACMEDirectories: map[string]string{
+					"acme":    "https://ca.example.com:9000/acme/acme/directory",
+					"my acme": "https://ca.example.com:9000/acme/my%20acme/directory",
+				},
+			},
+			KeyTypes:         keyTypes,
+			ProvisionerTypes: []string{"JWK", "ACME"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := chi.NewRouter()
+			New(&mockAuthority{
+				getDiscovery: func() *authority.Discovery {
+					return tt.discovery
+				},
+			}).Route(mux)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest("GET", "https://ca.example.com:9000/.well-known/step-ca", nil))
+			assert.Equals(t, http.StatusOK, w.Code)
+			assert.Equals(t, "application/json", w.Header().Get("Content-Type"))
+
+			var got DiscoveryResponse
+			assert.FatalError(t, json.Unmarshal(w.Body.Bytes(), &got))
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
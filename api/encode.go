@@ -0,0 +1,142 @@
+package api
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/pkg/errors"
+)
+
+// maxPooledBufferSize is the maximum capacity of the buffers returned to the
+// pool, larger buffers are left to the garbage collector.
+const maxPooledBufferSize = 1 << 20
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// encodeJSON encodes the given value, followed by a new line, in a buffer of
+// the pool. The buffer must be returned with putBuffer once it is written.
+func encodeJSON(v interface{}) (*bytes.Buffer, error) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		putBuffer(buf)
+		return nil, err
+	}
+	return buf, nil
+}
+
+// putBuffer returns a buffer to the pool.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= maxPooledBufferSize {
+		bufferPool.Put(buf)
+	}
+}
+
+// staticResponse is an encoded response and the values used to build it.
+type staticResponse struct {
+	source []interface{}
+	body   []byte
+	etag   string
+}
+
+// responseCache keeps the encoded responses of the endpoints that only change
+// when the configuration of the CA changes, like the roots or the
+// provisioners. A response is reused while it is built from the same values.
+// A nil cache does not store anything.
+type responseCache struct {
+	mu        sync.RWMutex
+	responses map[string]*staticResponse
+}
+
+func newResponseCache() *responseCache {
+	return &responseCache{
+		responses: make(map[string]*staticResponse),
+	}
+}
+
+// load returns the response with the given name if it was built from the same
+// source, otherwise it encodes a new one and stores it. The values in the
+// source must be comparable, e.g. pointers or strings.
+func (c *responseCache) load(name string, source []interface{}, encode func() ([]byte, error)) (*staticResponse, error) {
+	if c != nil {
+		c.mu.RLock()
+		sr, ok := c.responses[name]
+		c.mu.RUnlock()
+		if ok && sameSource(sr.source, source) {
+			return sr, nil
+		}
+	}
+	b, err := encode()
+	if err != nil {
+		return nil, err
+	}
+	sr := &staticResponse{
+		source: source,
+		body:   b,
+		etag:   newETag(b),
+	}
+	if c != nil {
+		c.mu.Lock()
+		c.responses[name] = sr
+		c.mu.Unlock()
+	}
+	return sr, nil
+}
+
+func sameSource(a, b []interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// certificatesSource returns the source of a response built from the given
+// certificates.
+func certificatesSource(certs []*x509.Certificate) []interface{} {
+	source := make([]interface{}, len(certs))
+	for i, crt := range certs {
+		source[i] = crt
+	}
+	return source
+}
+
+// provisionersSource returns the source of a response built from the given
+// provisioners and cursor.
+func provisionersSource(list provisioner.List, next string) []interface{} {
+	source := make([]interface{}, len(list)+1)
+	for i, p := range list {
+		source[i] = p
+	}
+	source[len(list)] = next
+	return source
+}
+
+// writeStaticJSON is like writeCacheableJSON, but the encoded response is
+// reused while the source does not change.
+func (h *caHandler) writeStaticJSON(w http.ResponseWriter, r *http.Request, name string, source []interface{}, v interface{}, status int) {
+	sr, err := h.responses.load(name, source, func() ([]byte, error) {
+		b, err := json.Marshal(v)
+		// Keep the new line added by json.Encoder in JSONStatus.
+		return append(b, '\n'), err
+	})
+	if err != nil {
+		WriteError(w, InternalServerError(errors.Wrap(err, "error marshaling response")))
+		return
+	}
+	if h.writeCacheableWithETag(w, r, "application/json", sr.body, sr.etag, status) {
+		LogEnabledResponse(w, v)
+	}
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/smallstep/assert"
+)
+
+func Test_encodeJSON(t *testing.T) {
+	buf, err := encodeJSON(map[string]string{"foo": "bar"})
+	assert.FatalError(t, err)
+	assert.Equals(t, "{\"foo\":\"bar\"}\n", buf.String())
+	putBuffer(buf)
+
+	_, err = encodeJSON(make(chan int))
+	assert.NotNil(t, err)
+}
+
+func Test_responseCache(t *testing.T) {
+	root := parseCertificate(rootPEM)
+	federated := parseCertificate(certPEM)
+	var calls int
+	encode := func(s string) func() ([]byte, error) {
+		return func() ([]byte, error) {
+			calls++
+			return []byte(s), nil
+		}
+	}
+
+	c := newResponseCache()
+	sr, err := c.load("roots", certificatesSource([]*x509.Certificate{root}), encode("foo"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("foo"), sr.body)
+	assert.Equals(t, newETag([]byte("foo")), sr.etag)
+
+	// Same source
+	sr, err = c.load("roots", certificatesSource([]*x509.Certificate{root}), encode("bar"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("foo"), sr.body)
+	assert.Equals(t, 1, calls)
+
+	// Different source
+	sr, err = c.load("roots", certificatesSource([]*x509.Certificate{root, federated}), encode("bar"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("bar"), sr.body)
+	sr, err = c.load("provisioners", provisionersSource(provisioner.List{}, ""), encode("zar"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("zar"), sr.body)
+	sr, err = c.load("provisioners", provisionersSource(provisioner.List{}, "next"), encode("baz"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("baz"), sr.body)
+	assert.Equals(t, 4, calls)
+
+	// A nil cache always encodes the response
+	var nilCache *responseCache
+	for i := 0; i < 2; i++ {
+		sr, err = nilCache.load("roots", certificatesSource([]*x509.Certificate{root}), encode("foo"))
+		assert.FatalError(t, err)
+		assert.Equals(t, []byte("foo"), sr.body)
+	}
+	assert.Equals(t, 6, calls)
+}
+
+func Test_caHandler_Roots_static(t *testing.T) {
+	root := parseCertificate(rootPEM)
+	federated := parseCertificate(certPEM)
+	roots := []*x509.Certificate{root}
+	h := New(&mockAuthority{
+		getRoots: func() ([]*x509.Certificate, error) {
+			return roots, nil
+		},
+	}).(*caHandler)
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.Roots(w, httptest.NewRequest("GET", target, nil))
+		assert.Equals(t, http.StatusCreated, w.Code)
+		return w
+	}
+	w1 := get("http://example.com/roots")
+	assert.Equals(t, 1, len(h.responses.responses))
+	w2 := get("http://example.com/roots")
+	assert.Equals(t, w1.Body.String(), w2.Body.String())
+	assert.Equals(t, w1.Header().Get("ETag"), w2.Header().Get("ETag"))
+
+	// Paginated responses are not stored
+	get("http://example.com/roots?limit=1")
+	assert.Equals(t, 1, len(h.responses.responses))
+
+	// New roots are encoded again
+	roots = []*x509.Certificate{root, federated}
+	w3 := get("http://example.com/roots")
+	assert.NotEquals(t, w1.Body.String(), w3.Body.String())
+	assert.Equals(t, newETag(w3.Body.Bytes()), w3.Header().Get("ETag"))
+}
@@ -21,16 +21,47 @@ type StackTracer interface {
 	StackTrace() errors.StackTrace
 }
 
+// ErrorCoder is the interface implemented by errors that have a stable
+// machine-readable code, e.g. provisioner.token.expired.
+type ErrorCoder interface {
+	ErrorCode() string
+}
+
+// ErrorDetailer is the interface implemented by errors that add details to
+// the error response.
+type ErrorDetailer interface {
+	ErrorDetails() map[string]interface{}
+}
+
+// Generic error codes used when an error does not define a more specific one.
+// Error codes are stable, clients must use them instead of the error messages.
+const (
+	ErrCodeBadRequest     = "request.invalid"
+	ErrCodeUnauthorized   = "request.unauthorized"
+	ErrCodeForbidden      = "request.forbidden"
+	ErrCodeNotFound       = "request.notFound"
+	ErrCodeRateLimited    = "request.rateLimited"
+	ErrCodeBodyTooLarge   = "request.bodyTooLarge"
+	ErrCodeInternal       = "server.internal"
+	ErrCodeNotImplemented = "server.notImplemented"
+	ErrCodeUnavailable    = "server.unavailable"
+	ErrCodeTimeout        = "server.timeout"
+)
+
 // Error represents the CA API errors.
 type Error struct {
-	Status int
-	Err    error
+	Status  int
+	Code    string
+	Details map[string]interface{}
+	Err     error
 }
 
 // ErrorResponse represents an error in JSON format.
 type ErrorResponse struct {
-	Status  int    `json:"status"`
-	Message string `json:"message"`
+	Status  int                    `json:"status"`
+	Code    string                 `json:"code,omitempty"`
+	Message string                 `json:"message"`
+	Details map[string]interface{} `json:"details,omitempty"`
 }
 
 // Cause implements the errors.Causer interface and returns the original error.
@@ -49,9 +80,30 @@ func (e *Error) StatusCode() int {
 	return e.Status
 }
 
+// ErrorCode implements the ErrorCoder interface and returns the code of the
+// error.
+func (e *Error) ErrorCode() string {
+	return e.Code
+}
+
+// ErrorDetails implements the ErrorDetailer interface and returns the details
+// of the error.
+func (e *Error) ErrorDetails() map[string]interface{} {
+	return e.Details
+}
+
 // MarshalJSON implements json.Marshaller interface for the Error struct.
 func (e *Error) MarshalJSON() ([]byte, error) {
-	return json.Marshal(&ErrorResponse{Status: e.Status, Message: http.StatusText(e.Status)})
+	code := e.Code
+	if code == "" {
+		code = statusErrorCode(e.Status)
+	}
+	return json.Marshal(&ErrorResponse{
+		Status:  e.Status,
+		Code:    code,
+		Message: http.StatusText(e.Status),
+		Details: e.Details,
+	})
 }
 
 // UnmarshalJSON implements json.Unmarshaler interface for the Error struct.
@@ -61,21 +113,68 @@ func (e *Error) UnmarshalJSON(data []byte) error {
 		return err
 	}
 	e.Status = er.Status
+	e.Code = er.Code
+	e.Details = er.Details
 	e.Err = fmt.Errorf(er.Message)
 	return nil
 }
 
 // NewError returns a new Error. If the given error implements the StatusCoder
-// interface we will ignore the given status.
+// interface we will ignore the given status. The code and details of the error
+// are those of the first error in the chain of causes implementing the
+// ErrorCoder interface, or a generic code for the status.
 func NewError(status int, err error) error {
 	if sc, ok := err.(StatusCoder); ok {
-		return &Error{Status: sc.StatusCode(), Err: err}
+		status = sc.StatusCode()
+	} else if sc, ok := errors.Cause(err).(StatusCoder); ok {
+		status = sc.StatusCode()
 	}
-	cause := errors.Cause(err)
-	if sc, ok := cause.(StatusCoder); ok {
-		return &Error{Status: sc.StatusCode(), Err: err}
+	e := &Error{Status: status, Code: statusErrorCode(status), Err: err}
+	for err != nil {
+		if ec, ok := err.(ErrorCoder); ok && ec.ErrorCode() != "" {
+			e.Code = ec.ErrorCode()
+			if ed, ok := err.(ErrorDetailer); ok {
+				e.Details = ed.ErrorDetails()
+			}
+			break
+		}
+		c, ok := err.(causer)
+		if !ok {
+			break
+		}
+		err = c.Cause()
+	}
+	return e
+}
+
+type causer interface {
+	Cause() error
+}
+
+// statusErrorCode returns the generic error code for the given HTTP status.
+func statusErrorCode(status int) string {
+	switch {
+	case status == http.StatusBadRequest:
+		return ErrCodeBadRequest
+	case status == http.StatusUnauthorized:
+		return ErrCodeUnauthorized
+	case status == http.StatusForbidden:
+		return ErrCodeForbidden
+	case status == http.StatusNotFound:
+		return ErrCodeNotFound
+	case status == http.StatusRequestEntityTooLarge:
+		return ErrCodeBodyTooLarge
+	case status == http.StatusTooManyRequests:
+		return ErrCodeRateLimited
+	case status == http.StatusNotImplemented:
+		return ErrCodeNotImplemented
+	case status == http.StatusServiceUnavailable:
+		return ErrCodeUnavailable
+	case status < http.StatusInternalServerError:
+		return ErrCodeBadRequest
+	default:
+		return ErrCodeInternal
 	}
-	return &Error{Status: status, Err: err}
 }
 
 // InternalServerError returns a 500 error with the given error.
@@ -108,14 +207,23 @@ func NotFound(err error) error {
 	return NewError(http.StatusNotFound, err)
 }
 
+// TooManyRequests returns an 429 error with the given error.
+func TooManyRequests(err error) error {
+	return NewError(http.StatusTooManyRequests, err)
+}
+
 // WriteError writes to w a JSON representation of the given error.
 func WriteError(w http.ResponseWriter, err error) {
 	switch k := err.(type) {
 	case *acme.Error:
 		w.Header().Set("Content-Type", "application/problem+json")
 		err = k.ToACME()
+	case *Error:
+		w.Header().Set("Content-Type", "application/json")
 	default:
+		// Use the same representation for all the errors.
 		w.Header().Set("Content-Type", "application/json")
+		err = InternalServerError(err)
 	}
 	cause := errors.Cause(err)
 	if sc, ok := err.(StatusCoder); ok {
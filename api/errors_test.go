@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+type statusError struct {
+	error
+	status int
+}
+
+func (e statusError) StatusCode() int {
+	return e.status
+}
+
+func TestNewError(t *testing.T) {
+	policyErr := provisioner.NewError(provisioner.ErrCodePolicySANDenied, fmt.Errorf("certificate request does not contain the valid DNS names")).
+		WithDetail("got", []string{"foo.smallstep.com"})
+
+	tests := []struct {
+		name    string
+		status  int
+		err     error
+		want    int
+		code    string
+		details map[string]interface{}
+	}{
+		{"bad-request", http.StatusBadRequest, fmt.Errorf("an error"), http.StatusBadRequest, ErrCodeBadRequest, nil},
+		{"unauthorized", http.StatusUnauthorized, fmt.Errorf("an error"), http.StatusUnauthorized, ErrCodeUnauthorized, nil},
+		{"forbidden", http.StatusForbidden, fmt.Errorf("an error"), http.StatusForbidden, ErrCodeForbidden, nil},
+		{"not-found", http.StatusNotFound, fmt.Errorf("an error"), http.StatusNotFound, ErrCodeNotFound, nil},
+		{"conflict", http.StatusConflict, fmt.Errorf("an error"), http.StatusConflict, ErrCodeBadRequest, nil},
+		{"internal", http.StatusInternalServerError, fmt.Errorf("an error"), http.StatusInternalServerError, ErrCodeInternal, nil},
+		{"not-implemented", http.StatusNotImplemented, fmt.Errorf("an error"), http.StatusNotImplemented, ErrCodeNotImplemented, nil},
+		{"status-coder", http.StatusInternalServerError, statusError{fmt.Errorf("an error"), http.StatusForbidden}, http.StatusForbidden, ErrCodeForbidden, nil},
+		{"error-coder", http.StatusUnauthorized, policyErr, http.StatusUnauthorized, provisioner.ErrCodePolicySANDenied, policyErr.Details},
+		{"error-coder-wrapped", http.StatusUnauthorized, errors.Wrap(errors.Wrap(policyErr, "sign"), "authorizeSign"),
+			http.StatusUnauthorized, provisioner.ErrCodePolicySANDenied, policyErr.Details},
+		{"error-coder-status", http.StatusBadRequest, statusError{provisioner.NewError(provisioner.ErrCodeTokenExpired, fmt.Errorf("token is expired")), http.StatusUnauthorized},
+			http.StatusUnauthorized, ErrCodeUnauthorized, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewError(tt.status, tt.err)
+			e, ok := err.(*Error)
+			if assert.True(t, ok) {
+				assert.Equals(t, tt.want, e.Status)
+				assert.Equals(t, tt.code, e.Code)
+				assert.Equals(t, tt.details, e.Details)
+				assert.Equals(t, tt.err.Error(), e.Error())
+			}
+		})
+	}
+}
+
+func TestError_JSON(t *testing.T) {
+	err := NewError(http.StatusUnauthorized, errors.Wrap(provisioner.NewError(provisioner.ErrCodeTokenExpired, fmt.Errorf("token is expired")), "authorizeToken"))
+	b, jerr := json.Marshal(err)
+	assert.FatalError(t, jerr)
+	assert.Equals(t, `{"status":401,"code":"provisioner.token.expired","message":"Unauthorized"}`, string(b))
+
+	b, jerr = json.Marshal(&Error{Status: http.StatusForbidden, Details: map[string]interface{}{"foo": "bar"}, Err: fmt.Errorf("an error")})
+	assert.FatalError(t, jerr)
+	assert.Equals(t, `{"status":403,"code":"request.forbidden","message":"Forbidden","details":{"foo":"bar"}}`, string(b))
+
+	var e Error
+	assert.FatalError(t, json.Unmarshal(b, &e))
+	assert.Equals(t, http.StatusForbidden, e.Status)
+	assert.Equals(t, ErrCodeForbidden, e.Code)
+	assert.Equals(t, map[string]interface{}{"foo": "bar"}, e.Details)
+	assert.Equals(t, "Forbidden", e.Error())
+}
+
+func TestWriteError(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteError(w, fmt.Errorf("an error"))
+	assert.Equals(t, http.StatusInternalServerError, w.Code)
+	assert.Equals(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equals(t, "{\"status\":500,\"code\":\"server.internal\",\"message\":\"Internal Server Error\"}\n", w.Body.String())
+}
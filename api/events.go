@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/RTradeLtd/ca-certificates/events"
+	"github.com/pkg/errors"
+)
+
+// EventsAuthority is the interface implemented by a CA authority that
+// publishes events.
+type EventsAuthority interface {
+	SubscribeEvents(lastID string) (<-chan *events.Event, func())
+}
+
+// Events is an HTTP handler that streams the events published by the CA using
+// server-sent events. Each message contains the id and type of the event and
+// the JSON representation of the event as data. A client can resume the
+// stream after a disconnection sending the id of the last event received in
+// the Last-Event-ID header or in the lastEventID query parameter.
+func (h *caHandler) Events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		WriteError(w, InternalServerError(errors.New("streaming is not supported")))
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("lastEventID")
+	}
+	ch, cancel := h.Authority.SubscribeEvents(lastID)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			b, err := json.Marshal(e)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, b); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/events"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/smallstep/assert"
+)
+
+type nonFlusher struct {
+	http.ResponseWriter
+}
+
+func Test_caHandler_Events(t *testing.T) {
+	tm, err := time.Parse(time.RFC3339, "2019-10-01T00:00:00Z")
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name       string
+		header     string
+		query      string
+		lastID     string
+		statusCode int
+		expected   string
+	}{
+		{"ok", "", "", "", http.StatusOK,
+			"id: 1\nevent: certificate.issued\ndata: {\"id\":\"1\",\"type\":\"certificate.issued\",\"time\":\"2019-10-01T00:00:00Z\",\"data\":{\"serial\":\"1234\",\"subject\":\"test.smallstep.com\",\"notBefore\":\"2019-10-01T00:00:00Z\",\"notAfter\":\"2019-10-01T00:00:00Z\"}}\n\n" +
+				"id: 2\nevent: certificate.revoked\ndata: {\"id\":\"2\",\"type\":\"certificate.revoked\",\"time\":\"2019-10-01T00:00:00Z\",\"data\":{\"serial\":\"1234\",\"reasonCode\":0,\"mTLS\":false}}\n\n"},
+		{"ok-header", "1", "", "1", http.StatusOK, ""},
+		{"ok-query", "", "?lastEventID=2", "2", http.StatusOK, ""},
+		{"ok-header-and-query", "1", "?lastEventID=2", "1", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				subscribeEvents: func(lastID string) (<-chan *events.Event, func()) {
+					assert.Equals(t, tt.lastID, lastID)
+					ch := make(chan *events.Event, 2)
+					ch <- &events.Event{ID: "1", Type: events.CertificateIssued, Time: tm, Data: &events.CertificateData{
+						Serial: "1234", Subject: "test.smallstep.com", NotBefore: tm, NotAfter: tm,
+					}}
+					ch <- &events.Event{ID: "2", Type: events.CertificateRevoked, Time: tm, Data: &events.RevocationData{
+						Serial: "1234",
+					}}
+					close(ch)
+					return ch, func() {}
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("GET", "http://example.com/events"+tt.query, nil)
+			if tt.header != "" {
+				req.Header.Set("Last-Event-ID", tt.header)
+			}
+			w := httptest.NewRecorder()
+			h.Events(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			assert.Equals(t, "text/event-stream", res.Header.Get("Content-Type"))
+			body, err := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+			if tt.expected != "" {
+				assert.Equals(t, tt.expected, string(body))
+			}
+		})
+	}
+}
+
+func Test_caHandler_Events_notFlusher(t *testing.T) {
+	h := New(&mockAuthority{}).(*caHandler)
+	req := httptest.NewRequest("GET", "http://example.com/events", nil)
+	w := httptest.NewRecorder()
+	h.Events(nonFlusher{w}, req)
+	assert.Equals(t, http.StatusInternalServerError, w.Result().StatusCode)
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// PKIXCertContentType is the media type of a DER encoded certificate.
+	PKIXCertContentType = "application/pkix-cert"
+	// PKCS7ContentType is the media type of a DER encoded PKCS#7 certs-only
+	// message.
+	PKCS7ContentType = "application/pkcs7-mime"
+	// PEMContentType is the media type of PEM encoded certificates.
+	PEMContentType = "application/x-pem-file"
+	// PKIXCRLContentType is the media type of a DER encoded CRL.
+	PKIXCRLContentType = "application/pkix-crl"
+)
+
+var (
+	oidData       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+// negotiateCertificateFormat returns the media type used to write
+// certificates in the response using the Accept header of the request. It
+// returns an empty string if the response must be JSON.
+func negotiateCertificateFormat(r *http.Request) string {
+	var format string
+	var best float64
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		q := 1.0
+		for _, p := range params[1:] {
+			if kv := strings.SplitN(strings.TrimSpace(p), "=", 2); len(kv) == 2 && kv[0] == "q" {
+				if v, err := strconv.ParseFloat(kv[1], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q <= best {
+			continue
+		}
+		switch mediaType {
+		case PKIXCertContentType, PKCS7ContentType:
+			format, best = mediaType, q
+		case "application/json", "application/*", "*/*":
+			format, best = "", q
+		}
+	}
+	return format
+}
+
+// writeCertificates writes the given certificates using the format negotiated
+// with the request. It returns false if the response must be JSON.
+func writeCertificates(w http.ResponseWriter, r *http.Request, certs []*x509.Certificate, status int) bool {
+	contentType, b, err := encodeCertificates(r, certs)
+	switch {
+	case err != nil:
+		WriteError(w, InternalServerError(err))
+	case contentType == "":
+		return false
+	default:
+		writeBody(w, contentType, b, status)
+	}
+	return true
+}
+
+// encodeCertificates encodes the given certificates using the format
+// negotiated with the request. It returns an empty content type if the
+// response must be JSON. With application/pkix-cert only the first certificate
+// is encoded, with application/pkcs7-mime all of them are encoded.
+func encodeCertificates(r *http.Request, certs []*x509.Certificate) (string, []byte, error) {
+	switch contentType := negotiateCertificateFormat(r); contentType {
+	case PKIXCertContentType:
+		return contentType, certs[0].Raw, nil
+	case PKCS7ContentType:
+		b, err := encodePKCS7(certs)
+		if err != nil {
+			return "", nil, err
+		}
+		return contentType + "; smime-type=certs-only", b, nil
+	default:
+		return "", nil, nil
+	}
+}
+
+// writeBody writes the given body with the given content type and status.
+func writeBody(w http.ResponseWriter, contentType string, b []byte, status int) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	if _, err := w.Write(b); err != nil {
+		LogError(w, err)
+	}
+}
+
+type pkcs7ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"optional"`
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      pkcs7ContentInfo
+	Certificates     asn1.RawValue
+	SignerInfos      []asn1.RawValue `asn1:"set"`
+}
+
+// encodePKCS7 returns the DER encoding of a degenerate PKCS#7 signed-data
+// message with the given certificates and without signers (RFC 2315).
+func encodePKCS7(certs []*x509.Certificate) ([]byte, error) {
+	var raw []byte
+	for _, crt := range certs {
+		raw = append(raw, crt.Raw...)
+	}
+	sd, err := asn1.Marshal(pkcs7SignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{},
+		ContentInfo:      pkcs7ContentInfo{ContentType: oidData},
+		Certificates: asn1.RawValue{
+			Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: raw,
+		},
+		SignerInfos: []asn1.RawValue{},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling pkcs7 signed data")
+	}
+	b, err := asn1.Marshal(pkcs7ContentInfo{
+		ContentType: oidSignedData,
+		Content: asn1.RawValue{
+			Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd,
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling pkcs7 content info")
+	}
+	return b, nil
+}
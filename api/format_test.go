@@ -0,0 +1,122 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/RTradeLtd/ca-cli/crypto/tlsutil"
+	"github.com/go-chi/chi"
+	"github.com/smallstep/assert"
+)
+
+func Test_negotiateCertificateFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		accept string
+		want   string
+	}{
+		{"empty", "", ""},
+		{"json", "application/json", ""},
+		{"any", "*/*", ""},
+		{"pkix-cert", "application/pkix-cert", PKIXCertContentType},
+		{"pkcs7-mime", "application/pkcs7-mime", PKCS7ContentType},
+		{"case", "Application/PKCS7-MIME", PKCS7ContentType},
+		{"first", "application/pkix-cert, application/json", PKIXCertContentType},
+		{"quality", "application/pkix-cert;q=0.5, application/pkcs7-mime", PKCS7ContentType},
+		{"quality-json", "application/pkix-cert;q=0.5, application/json;q=0.9", ""},
+		{"quality-zero", "application/pkix-cert;q=0", ""},
+		{"unsupported", "text/html", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "http://example.com/", nil)
+			req.Header.Set("Accept", tt.accept)
+			assert.Equals(t, tt.want, negotiateCertificateFormat(req))
+		})
+	}
+}
+
+func Test_encodePKCS7(t *testing.T) {
+	certs := []*x509.Certificate{parseCertificate(certPEM), parseCertificate(rootPEM)}
+	b, err := encodePKCS7(certs)
+	assert.FatalError(t, err)
+
+	var ci pkcs7ContentInfo
+	rest, err := asn1.Unmarshal(b, &ci)
+	assert.FatalError(t, err)
+	assert.Len(t, 0, rest)
+	assert.Equals(t, oidSignedData, ci.ContentType)
+
+	var sd pkcs7SignedData
+	_, err = asn1.Unmarshal(ci.Content.Bytes, &sd)
+	assert.FatalError(t, err)
+	assert.Equals(t, 1, sd.Version)
+	assert.Equals(t, oidData, sd.ContentInfo.ContentType)
+	assert.Len(t, 0, sd.SignerInfos)
+	got, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	assert.FatalError(t, err)
+	assert.Equals(t, certs, got)
+}
+
+func Test_caHandler_formats(t *testing.T) {
+	crt, root := parseCertificate(certPEM), parseCertificate(rootPEM)
+	pkcs7, err := encodePKCS7([]*x509.Certificate{crt, root})
+	assert.FatalError(t, err)
+
+	h := New(&mockAuthority{
+		root: func(shasum string) (*x509.Certificate, error) {
+			return root, nil
+		},
+		renew: func(cert *x509.Certificate) ([]*x509.Certificate, error) {
+			return []*x509.Certificate{crt, root}, nil
+		},
+		getTLSOptions: func() *tlsutil.TLSOptions {
+			return nil
+		},
+	}).(*caHandler)
+
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		accept      string
+		statusCode  int
+		contentType string
+		body        []byte
+	}{
+		{"root-json", h.Root, "", http.StatusOK, "application/json", nil},
+		{"root-pkix-cert", h.Root, PKIXCertContentType, http.StatusOK, PKIXCertContentType, root.Raw},
+		{"root-pkcs7-mime", h.Root, PKCS7ContentType, http.StatusOK, PKCS7ContentType + "; smime-type=certs-only", nil},
+		{"renew-json", h.Renew, "application/json", http.StatusCreated, "application/json", nil},
+		{"renew-pkix-cert", h.Renew, PKIXCertContentType, http.StatusCreated, PKIXCertContentType, crt.Raw},
+		{"renew-pkcs7-mime", h.Renew, PKCS7ContentType, http.StatusCreated, PKCS7ContentType + "; smime-type=certs-only", pkcs7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chiCtx := chi.NewRouteContext()
+			chiCtx.URLParams.Add("sha", "efc7d6b475a56fe587650bcdb999a4a308f815ba44db4bf0371ea68a786ccd36")
+			req := httptest.NewRequest("POST", "http://example.com/", nil)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, chiCtx))
+			req.Header.Set("Accept", tt.accept)
+			req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{crt}}
+			w := httptest.NewRecorder()
+			tt.handler(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			assert.Equals(t, tt.contentType, res.Header.Get("Content-Type"))
+			body, err := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+			if tt.body != nil {
+				assert.Equals(t, tt.body, body)
+			}
+		})
+	}
+}
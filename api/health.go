@@ -0,0 +1,37 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+)
+
+// HealthAuthority is the interface implemented by a CA authority that can
+// probe its dependencies.
+type HealthAuthority interface {
+	CheckHealth(ctx context.Context) *authority.Health
+}
+
+// HealthResponse is the response object that returns the health of the server.
+type HealthResponse struct {
+	Status string                            `json:"status"`
+	Checks map[string]*authority.HealthCheck `json:"checks,omitempty"`
+}
+
+// Health is an HTTP handler that returns the status of the server and its
+// dependencies. It returns 503 Service Unavailable if a dependency has failed,
+// so load balancers stop sending requests to this instance; degraded
+// dependencies are reported with a 200 OK.
+func (h *caHandler) Health(w http.ResponseWriter, r *http.Request) {
+	health := h.Authority.CheckHealth(r.Context())
+	if health == nil {
+		JSON(w, HealthResponse{Status: authority.HealthOK})
+		return
+	}
+	status := http.StatusOK
+	if health.Status == authority.HealthFailed {
+		status = http.StatusServiceUnavailable
+	}
+	JSONStatus(w, HealthResponse{Status: health.Status, Checks: health.Checks}, status)
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/smallstep/assert"
+)
+
+func Test_caHandler_Health_checks(t *testing.T) {
+	tests := []struct {
+		name       string
+		health     *authority.Health
+		statusCode int
+		expected   string
+	}{
+		{"ok", &authority.Health{Status: authority.HealthOK, Checks: map[string]*authority.HealthCheck{
+			"db": {Status: authority.HealthOK},
+		}}, http.StatusOK, `{"status":"ok","checks":{"db":{"status":"ok"}}}` + "\n"},
+		{"degraded", &authority.Health{Status: authority.HealthDegraded, Checks: map[string]*authority.HealthCheck{
+			"db":          {Status: authority.HealthOK},
+			"oidc:Google": {Status: authority.HealthDegraded, Error: "failed to connect"},
+		}}, http.StatusOK, `{"status":"degraded","checks":{"db":{"status":"ok"},"oidc:Google":{"status":"degraded","error":"failed to connect"}}}` + "\n"},
+		{"failed", &authority.Health{Status: authority.HealthFailed, Checks: map[string]*authority.HealthCheck{
+			"db": {Status: authority.HealthFailed, Error: "error writing health probe"},
+		}}, http.StatusServiceUnavailable, `{"status":"failed","checks":{"db":{"status":"failed","error":"error writing health probe"}}}` + "\n"},
+		{"no checks", nil, http.StatusOK, `{"status":"ok"}` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				checkHealth: func(ctx context.Context) *authority.Health {
+					return tt.health
+				},
+			}).(*caHandler)
+			w := httptest.NewRecorder()
+			h.Health(w, httptest.NewRequest("GET", "http://example.com/health", nil))
+			assert.Equals(t, tt.statusCode, w.Code)
+			assert.Equals(t, tt.expected, w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/pkg/errors"
+)
+
+// ImportCARequest is the request body used to import an external CA. The
+// root is optional, if it is not set the intermediate must chain to one of
+// the current roots.
+type ImportCARequest struct {
+	Root         *Certificate `json:"root,omitempty"`
+	Intermediate Certificate  `json:"crt"`
+	Key          string       `json:"key"`
+	Password     string       `json:"password,omitempty"`
+}
+
+// Validate checks the fields of the ImportCARequest.
+func (i *ImportCARequest) Validate() error {
+	if i.Intermediate.Certificate == nil {
+		return BadRequest(errors.New("missing crt"))
+	}
+	if i.Key == "" {
+		return BadRequest(errors.New("missing key"))
+	}
+	return nil
+}
+
+// ImportCAResponse is the response object of the import CA request.
+type ImportCAResponse struct {
+	Intermediate Certificate   `json:"crt"`
+	Roots        []Certificate `json:"roots"`
+}
+
+// ImportCA is an HTTP handler that replaces the intermediate used to sign
+// certificates with the one of an external CA.
+func (h *caHandler) ImportCA(w http.ResponseWriter, r *http.Request) {
+	var body ImportCARequest
+	if err := ReadJSON(r.Body, &body); err != nil {
+		WriteError(w, BadRequest(errors.Wrap(err, "error reading request body")))
+		return
+	}
+	if err := body.Validate(); err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	opts := authority.ImportCAOptions{
+		Intermediate: body.Intermediate.Certificate,
+		Key:          []byte(body.Key),
+		Password:     []byte(body.Password),
+	}
+	if body.Root != nil {
+		opts.Root = body.Root.Certificate
+	}
+	if err := h.Authority.ImportCA(opts); err != nil {
+		WriteError(w, BadRequest(err))
+		return
+	}
+
+	roots, err := h.Authority.GetRoots()
+	if err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+	logCertificate(w, body.Intermediate.Certificate)
+	JSON(w, &ImportCAResponse{
+		Intermediate: body.Intermediate,
+		Roots:        certChainToPEM(roots),
+	})
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/smallstep/assert"
+)
+
+func Test_caHandler_ImportCA(t *testing.T) {
+	root := parseCertificate(rootPEM)
+	crt := parseCertificate(certPEM)
+	withRoot, err := json.Marshal(ImportCARequest{
+		Root:         &Certificate{root},
+		Intermediate: Certificate{crt},
+		Key:          "the-key",
+		Password:     "the-password",
+	})
+	assert.FatalError(t, err)
+	withoutRoot, err := json.Marshal(ImportCARequest{
+		Intermediate: Certificate{crt},
+		Key:          "the-key",
+	})
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name       string
+		input      string
+		opts       authority.ImportCAOptions
+		err        error
+		statusCode int
+	}{
+		{"ok", string(withRoot), authority.ImportCAOptions{
+			Root: root, Intermediate: crt, Key: []byte("the-key"), Password: []byte("the-password"),
+		}, nil, http.StatusOK},
+		{"ok-without-root", string(withoutRoot), authority.ImportCAOptions{
+			Intermediate: crt, Key: []byte("the-key"), Password: []byte{},
+		}, nil, http.StatusOK},
+		{"fail-json", "{", authority.ImportCAOptions{}, nil, http.StatusBadRequest},
+		{"fail-missing-crt", `{"key":"the-key"}`, authority.ImportCAOptions{}, nil, http.StatusBadRequest},
+		{"fail-missing-key", `{"crt":"` + strings.Replace(certPEM, "\n", `\n`, -1) + `"}`, authority.ImportCAOptions{}, nil, http.StatusBadRequest},
+		{"fail-import", string(withoutRoot), authority.ImportCAOptions{
+			Intermediate: crt, Key: []byte("the-key"), Password: []byte{},
+		}, fmt.Errorf("an error"), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				importCA: func(opts authority.ImportCAOptions) error {
+					assert.Equals(t, tt.opts, opts)
+					return tt.err
+				},
+				getRoots: func() ([]*x509.Certificate, error) {
+					return []*x509.Certificate{root}, nil
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("POST", "http://example.com/admin/ca/import", strings.NewReader(tt.input))
+			w := httptest.NewRecorder()
+			h.ImportCA(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			if tt.statusCode == http.StatusOK {
+				var body ImportCAResponse
+				assert.FatalError(t, ReadJSON(res.Body, &body))
+				assert.Equals(t, crt, body.Intermediate.Certificate)
+				if assert.Len(t, 1, body.Roots) {
+					assert.Equals(t, root, body.Roots[0].Certificate)
+				}
+			}
+		})
+	}
+}
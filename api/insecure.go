@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+)
+
+// acmeTokenRegexp matches the tokens of the ACME HTTP-01 challenges, they are
+// base64url encoded without padding.
+var acmeTokenRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// insecureHandler serves the endpoints that clients can use before they trust
+// the CA: the health, the root certificates in PEM and PKCS#7 format, the CRL
+// and, if configured, the responses of the ACME HTTP-01 challenges.
+type insecureHandler struct {
+	*caHandler
+	challengeDir string
+}
+
+// NewInsecure returns the handler of the endpoints served over plain HTTP. If
+// challengeDir is not empty, the key authorizations of the ACME HTTP-01
+// challenges are served from the files in that directory, named by token. It
+// is intended to be served in a separate listener.
+func NewInsecure(authority Authority, challengeDir string) RouterHandler {
+	return &insecureHandler{
+		caHandler: &caHandler{
+			Authority: authority,
+			limiter:   newRateLimiter(authority),
+			responses: newResponseCache(),
+		},
+		challengeDir: challengeDir,
+	}
+}
+
+func (h *insecureHandler) Route(r Router) {
+	r = h.wrapRouter(r)
+	r.MethodFunc("GET", "/health", h.Health)
+	r.MethodFunc("GET", "/roots.pem", h.RootsPEM)
+	r.MethodFunc("GET", "/roots.p7b", h.RootsPKCS7)
+	r.MethodFunc("GET", "/crl", h.CRL)
+	if h.challengeDir != "" {
+		r.MethodFunc("GET", "/.well-known/acme-challenge/{token}", h.ACMEChallenge)
+	}
+}
+
+// RootsPEM is an HTTP handler that returns all the root certificates of the
+// CA in PEM format.
+func (h *caHandler) RootsPEM(w http.ResponseWriter, r *http.Request) {
+	roots, err := h.Authority.GetRoots()
+	if err != nil {
+		WriteError(w, Forbidden(err))
+		return
+	}
+
+	if len(roots) > streamThreshold {
+		streamPEM(w, roots, http.StatusOK)
+		return
+	}
+	sr, _ := h.responses.load("roots.pem", certificatesSource(roots), func() ([]byte, error) {
+		var b []byte
+		for _, crt := range roots {
+			b = append(b, pem.EncodeToMemory(&pem.Block{
+				Type:  "CERTIFICATE",
+				Bytes: crt.Raw,
+			})...)
+		}
+		return b, nil
+	})
+	h.writeCacheableWithETag(w, r, PEMContentType, sr.body, sr.etag, http.StatusOK)
+}
+
+// ACMEChallenge is an HTTP handler that returns the key authorization of an
+// ACME HTTP-01 challenge, written by an ACME client to the challenge
+// directory.
+func (h *insecureHandler) ACMEChallenge(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+	if !acmeTokenRegexp.MatchString(token) {
+		WriteError(w, NotFound(errors.Errorf("invalid token %s", token)))
+		return
+	}
+	b, err := ioutil.ReadFile(filepath.Join(h.challengeDir, token))
+	switch {
+	case os.IsNotExist(err):
+		WriteError(w, NotFound(errors.Errorf("token %s not found", token)))
+	case err != nil:
+		WriteError(w, InternalServerError(errors.Wrap(err, "error reading challenge")))
+	default:
+		writeBody(w, "application/octet-stream", b, http.StatusOK)
+	}
+}
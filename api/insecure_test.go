@@ -0,0 +1,89 @@
+package api
+
+import (
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/smallstep/assert"
+)
+
+func Test_insecureHandler_Route(t *testing.T) {
+	dir, err := ioutil.TempDir("", "acme-challenge")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+	assert.FatalError(t, ioutil.WriteFile(filepath.Join(dir, "tok_en-1"), []byte("tok_en-1.thumbprint"), 0600))
+	assert.FatalError(t, ioutil.WriteFile(filepath.Join(dir, "..secret"), []byte("secret"), 0600))
+
+	mux := chi.NewRouter()
+	NewInsecure(&mockAuthority{
+		getRoots: func() ([]*x509.Certificate, error) {
+			return []*x509.Certificate{parseCertificate(rootPEM)}, nil
+		},
+	}, dir).Route(mux)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		statusCode int
+		body       string
+	}{
+		{"ok-health", "GET", "/health", http.StatusOK, "{\"status\":\"ok\"}\n"},
+		{"ok-roots", "GET", "/roots.pem", http.StatusOK, rootPEM + "\n"},
+		{"ok-roots-pkcs7", "GET", "/roots.p7b", http.StatusOK, ""},
+		{"ok-challenge", "GET", "/.well-known/acme-challenge/tok_en-1", http.StatusOK, "tok_en-1.thumbprint"},
+		{"fail-challenge", "GET", "/.well-known/acme-challenge/missing", http.StatusNotFound, ""},
+		{"fail-challenge-token", "GET", "/.well-known/acme-challenge/..secret", http.StatusNotFound, ""},
+		{"fail-roots", "GET", "/roots", http.StatusNotFound, ""},
+		{"fail-sign", "POST", "/sign", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, req)
+			assert.Equals(t, tt.statusCode, w.Code)
+			if tt.body != "" {
+				assert.Equals(t, tt.body, w.Body.String())
+			}
+		})
+	}
+
+	// Without a challenge directory the challenges are not served.
+	mux = chi.NewRouter()
+	NewInsecure(&mockAuthority{}, "").Route(mux)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/.well-known/acme-challenge/tok_en-1", nil))
+	assert.Equals(t, http.StatusNotFound, w.Code)
+}
+
+func Test_caHandler_RootsPEM(t *testing.T) {
+	tests := []struct {
+		name       string
+		roots      []*x509.Certificate
+		err        error
+		statusCode int
+	}{
+		{"ok", []*x509.Certificate{parseCertificate(rootPEM)}, nil, http.StatusOK},
+		{"fail", nil, errors.New("an error"), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{ret1: tt.roots, err: tt.err}).(*caHandler)
+			w := httptest.NewRecorder()
+			h.RootsPEM(w, httptest.NewRequest("GET", "/roots.pem", nil))
+			assert.Equals(t, tt.statusCode, w.Code)
+			if tt.err == nil {
+				assert.Equals(t, PEMContentType, w.Header().Get("Content-Type"))
+				assert.Equals(t, rootPEM+"\n", w.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// IntrospectRequest is the request body of a token introspection request.
+type IntrospectRequest struct {
+	OTT string `json:"ott"`
+}
+
+// Validate checks the fields of the IntrospectRequest.
+func (i *IntrospectRequest) Validate() error {
+	if i.OTT == "" {
+		return BadRequest(errors.New("missing ott"))
+	}
+	return nil
+}
+
+// Introspect is an HTTP handler that reports how the CA would process a
+// one-time token: the matching provisioner, the parsed claims, the result of
+// the audience validation and the sign options that would apply. The token is
+// not consumed.
+func (h *caHandler) Introspect(w http.ResponseWriter, r *http.Request) {
+	var body IntrospectRequest
+	if err := ReadJSON(r.Body, &body); err != nil {
+		WriteError(w, BadRequest(errors.Wrap(err, "error reading request body")))
+		return
+	}
+	if err := body.Validate(); err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	ti, err := h.Authority.IntrospectToken(body.OTT)
+	if err != nil {
+		WriteError(w, BadRequest(err))
+		return
+	}
+	JSON(w, ti)
+}
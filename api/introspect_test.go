@@ -0,0 +1,67 @@
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/smallstep/assert"
+)
+
+func Test_caHandler_Introspect(t *testing.T) {
+	ti := &authority.TokenIntrospection{
+		KeyID:     "the-kid",
+		Algorithm: "ES256",
+		Claims:    map[string]interface{}{"iss": "step-cli"},
+		Audiences: map[string]bool{"sign": true, "revoke": false, "admin": false},
+		Provisioner: &authority.IntrospectedProvisioner{
+			ID: "step-cli:the-kid", Name: "step-cli", Type: "JWK",
+		},
+		SignOptions: []string{"provisioner.profileDefaultDuration"},
+		Valid:       true,
+	}
+	expected := `{"kid":"the-kid","alg":"ES256","claims":{"iss":"step-cli"},"audiences":{"admin":false,"revoke":false,"sign":true},"provisioner":{"id":"step-cli:the-kid","name":"step-cli","type":"JWK"},"signOptions":["provisioner.profileDefaultDuration"],"valid":true}`
+
+	tests := []struct {
+		name       string
+		input      string
+		err        error
+		statusCode int
+		expected   string
+	}{
+		{"ok", `{"ott":"the-ott"}`, nil, http.StatusOK, expected},
+		{"fail-json", "{", nil, http.StatusBadRequest, ""},
+		{"fail-missing-ott", "{}", nil, http.StatusBadRequest, ""},
+		{"fail-introspect", `{"ott":"the-ott"}`, fmt.Errorf("an error"), http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				introspectToken: func(ott string) (*authority.TokenIntrospection, error) {
+					assert.Equals(t, "the-ott", ott)
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return ti, nil
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("POST", "http://example.com/admin/introspect", strings.NewReader(tt.input))
+			w := httptest.NewRecorder()
+			h.Introspect(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			body, err := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+			if tt.expected != "" {
+				assert.Equals(t, tt.expected, strings.TrimSpace(string(body)))
+			}
+		})
+	}
+}
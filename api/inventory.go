@@ -0,0 +1,135 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+)
+
+// InventoryAuthority is the interface implemented by a CA authority that
+// keeps an inventory of hosts and workloads.
+type InventoryAuthority interface {
+	RegisterInventoryEntry(name string, opts authority.InventoryOptions) (*db.InventoryEntry, error)
+	GetInventoryEntry(name string) (*db.InventoryEntry, error)
+	GetInventoryEntries(filter authority.InventoryFilter, cursor string, limit int) ([]*db.InventoryEntry, string, error)
+	DeleteInventoryEntry(name string) error
+	LinkInventoryCertificate(name, serial string) (*db.InventoryEntry, error)
+}
+
+// InventoryRequest is the request body used to register a host or a
+// workload in the inventory.
+type InventoryRequest struct {
+	Kind  string   `json:"kind,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+	Owner string   `json:"owner,omitempty"`
+}
+
+// InventoryCertificateRequest is the request body used to link a certificate
+// to an inventory entry.
+type InventoryCertificateRequest struct {
+	Serial string `json:"serial"`
+}
+
+// Validate validates the link request.
+func (r *InventoryCertificateRequest) Validate() error {
+	if r.Serial == "" {
+		return BadRequest(errors.New("missing serial"))
+	}
+	return nil
+}
+
+// InventoryResponse is the response object of the inventory list.
+type InventoryResponse struct {
+	Entries    []*db.InventoryEntry `json:"entries"`
+	NextCursor string               `json:"nextCursor,omitempty"`
+}
+
+// Inventory is an HTTP handler that returns the hosts and workloads
+// registered in the inventory sorted by name. The list can be filtered using
+// the tag query parameter, that can be repeated, and the kind and owner query
+// parameters.
+func (h *caHandler) Inventory(w http.ResponseWriter, r *http.Request) {
+	cursor, limit, err := parseCursor(r)
+	if err != nil {
+		WriteError(w, BadRequest(err))
+		return
+	}
+	q := r.URL.Query()
+	filter := authority.InventoryFilter{
+		Tags:  q["tag"],
+		Kind:  q.Get("kind"),
+		Owner: q.Get("owner"),
+	}
+
+	list, next, err := h.Authority.GetInventoryEntries(filter, cursor, limit)
+	if err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+	JSON(w, &InventoryResponse{Entries: list, NextCursor: next})
+}
+
+// InventoryEntry is an HTTP handler that returns an inventory entry.
+func (h *caHandler) InventoryEntry(w http.ResponseWriter, r *http.Request) {
+	e, err := h.Authority.GetInventoryEntry(chi.URLParam(r, "name"))
+	if err != nil {
+		WriteError(w, NotFound(err))
+		return
+	}
+	JSON(w, e)
+}
+
+// RegisterInventoryEntry is an HTTP handler that registers a host or a
+// workload in the inventory, or updates an existing one.
+func (h *caHandler) RegisterInventoryEntry(w http.ResponseWriter, r *http.Request) {
+	var body InventoryRequest
+	if err := ReadJSON(r.Body, &body); err != nil {
+		WriteError(w, BadRequest(errors.Wrap(err, "error reading request body")))
+		return
+	}
+
+	e, err := h.Authority.RegisterInventoryEntry(chi.URLParam(r, "name"), authority.InventoryOptions{
+		Kind:  body.Kind,
+		Tags:  body.Tags,
+		Owner: body.Owner,
+	})
+	if err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+	JSON(w, e)
+}
+
+// DeleteInventoryEntry is an HTTP handler that removes an entry from the
+// inventory.
+func (h *caHandler) DeleteInventoryEntry(w http.ResponseWriter, r *http.Request) {
+	if err := h.Authority.DeleteInventoryEntry(chi.URLParam(r, "name")); err != nil {
+		WriteError(w, NotFound(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// LinkInventoryCertificate is an HTTP handler that links an issued
+// certificate to an inventory entry.
+func (h *caHandler) LinkInventoryCertificate(w http.ResponseWriter, r *http.Request) {
+	var body InventoryCertificateRequest
+	if err := ReadJSON(r.Body, &body); err != nil {
+		WriteError(w, BadRequest(errors.Wrap(err, "error reading request body")))
+		return
+	}
+	if err := body.Validate(); err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	e, err := h.Authority.LinkInventoryCertificate(chi.URLParam(r, "name"), body.Serial)
+	if err != nil {
+		WriteError(w, NotFound(err))
+		return
+	}
+	JSON(w, e)
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+func Test_caHandler_Inventory(t *testing.T) {
+	now, err := time.Parse(time.RFC3339, "2019-10-01T00:00:00Z")
+	assert.FatalError(t, err)
+	entries := []*db.InventoryEntry{
+		{Name: "web1", Kind: "host", Tags: []string{"web", "prod"}, Owner: "ops", Serials: []string{"1234"}, CreatedAt: now, UpdatedAt: now},
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		filter     authority.InventoryFilter
+		err        error
+		statusCode int
+		expected   string
+	}{
+		{"ok", "", authority.InventoryFilter{}, nil, http.StatusOK,
+			`{"entries":[{"name":"web1","kind":"host","tags":["web","prod"],"owner":"ops","serials":["1234"],"createdAt":"2019-10-01T00:00:00Z","updatedAt":"2019-10-01T00:00:00Z"}],"nextCursor":"web2"}`},
+		{"ok-filter", "?tag=web&tag=prod&kind=host&owner=ops&limit=1&cursor=web1",
+			authority.InventoryFilter{Tags: []string{"web", "prod"}, Kind: "host", Owner: "ops"}, nil, http.StatusOK, ""},
+		{"fail-limit", "?limit=foo", authority.InventoryFilter{}, nil, http.StatusBadRequest, ""},
+		{"fail", "", authority.InventoryFilter{}, errors.New("an error"), http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				getInventoryEntries: func(filter authority.InventoryFilter, cursor string, limit int) ([]*db.InventoryEntry, string, error) {
+					assert.Equals(t, tt.filter, filter)
+					return entries, "web2", tt.err
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("GET", "http://example.com/admin/inventory"+tt.query, nil)
+			w := httptest.NewRecorder()
+			h.Inventory(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			body, err := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+			if tt.expected != "" {
+				assert.Equals(t, tt.expected, strings.TrimSpace(string(body)))
+			}
+		})
+	}
+}
+
+func Test_caHandler_InventoryEntry(t *testing.T) {
+	entry := &db.InventoryEntry{Name: "web1", Kind: "host"}
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add("name", "web1")
+	notFound := statusError{errors.New("not found"), http.StatusNotFound}
+
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		handler    func(h *caHandler) http.HandlerFunc
+		err        error
+		statusCode int
+	}{
+		{"get", "GET", "", func(h *caHandler) http.HandlerFunc { return h.InventoryEntry }, nil, http.StatusOK},
+		{"get-not-found", "GET", "", func(h *caHandler) http.HandlerFunc { return h.InventoryEntry }, notFound, http.StatusNotFound},
+		{"register", "PUT", `{"kind":"host","tags":["web"],"owner":"ops"}`, func(h *caHandler) http.HandlerFunc { return h.RegisterInventoryEntry }, nil, http.StatusOK},
+		{"register-bad-json", "PUT", `{`, func(h *caHandler) http.HandlerFunc { return h.RegisterInventoryEntry }, nil, http.StatusBadRequest},
+		{"register-fail", "PUT", `{}`, func(h *caHandler) http.HandlerFunc { return h.RegisterInventoryEntry }, errors.New("an error"), http.StatusInternalServerError},
+		{"delete", "DELETE", "", func(h *caHandler) http.HandlerFunc { return h.DeleteInventoryEntry }, nil, http.StatusNoContent},
+		{"delete-not-found", "DELETE", "", func(h *caHandler) http.HandlerFunc { return h.DeleteInventoryEntry }, notFound, http.StatusNotFound},
+		{"link", "POST", `{"serial":"1234"}`, func(h *caHandler) http.HandlerFunc { return h.LinkInventoryCertificate }, nil, http.StatusOK},
+		{"link-missing-serial", "POST", `{}`, func(h *caHandler) http.HandlerFunc { return h.LinkInventoryCertificate }, nil, http.StatusBadRequest},
+		{"link-not-found", "POST", `{"serial":"1234"}`, func(h *caHandler) http.HandlerFunc { return h.LinkInventoryCertificate }, notFound, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				getInventoryEntry: func(name string) (*db.InventoryEntry, error) {
+					assert.Equals(t, "web1", name)
+					return entry, tt.err
+				},
+				registerInventoryEntry: func(name string, opts authority.InventoryOptions) (*db.InventoryEntry, error) {
+					assert.Equals(t, "web1", name)
+					if tt.name == "register" {
+						assert.Equals(t, authority.InventoryOptions{Kind: "host", Tags: []string{"web"}, Owner: "ops"}, opts)
+					}
+					return entry, tt.err
+				},
+				deleteInventoryEntry: func(name string) error {
+					assert.Equals(t, "web1", name)
+					return tt.err
+				},
+				linkInventoryCertificate: func(name, serial string) (*db.InventoryEntry, error) {
+					assert.Equals(t, "web1", name)
+					assert.Equals(t, "1234", serial)
+					return entry, tt.err
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest(tt.method, "http://example.com/admin/inventory/web1", strings.NewReader(tt.body))
+			req = req.WithContext(context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx))
+			w := httptest.NewRecorder()
+			tt.handler(h)(logging.NewResponseLogger(w), req)
+			res := w.Result()
+			res.Body.Close()
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+		})
+	}
+}
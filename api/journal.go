@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/pkg/errors"
+)
+
+// JournalAuthority is the interface implemented by a CA authority that keeps
+// a journal of the changes of its database.
+type JournalAuthority interface {
+	GetJournal(from, to time.Time) ([]*db.JournalEntry, error)
+}
+
+// JournalResponse is the response object of the journal request.
+type JournalResponse struct {
+	Entries []*db.JournalEntry `json:"entries"`
+}
+
+// Journal is an HTTP handler that returns the revocations and the deletions
+// of records made in the database, with the identity of who made them. The
+// from and to query parameters limit the entries returned, they accept an
+// RFC 3339 time or a duration relative to the current time, e.g. -24h.
+func (h *caHandler) Journal(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var from, to time.Time
+	for key, t := range map[string]*time.Time{
+		"from": &from,
+		"to":   &to,
+	} {
+		if v := q.Get(key); v != "" {
+			td, err := ParseTimeDuration(v)
+			if err != nil {
+				WriteError(w, BadRequest(errors.Wrapf(err, "error parsing %s", key)))
+				return
+			}
+			*t = td.Time()
+		}
+	}
+
+	entries, err := h.Authority.GetJournal(from, to)
+	if err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+	JSON(w, &JournalResponse{Entries: entries})
+}
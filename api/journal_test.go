@@ -0,0 +1,62 @@
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/smallstep/assert"
+)
+
+func Test_caHandler_Journal(t *testing.T) {
+	from, err := time.Parse(time.RFC3339, "2019-10-01T00:00:00Z")
+	assert.FatalError(t, err)
+	entries := []*db.JournalEntry{
+		{ID: "1", Time: from, Actor: "retention", Operation: db.JournalDelete, Table: "x509_certs", Key: "1", Digest: "sha256:abc"},
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		from, to   time.Time
+		err        error
+		statusCode int
+		expected   string
+	}{
+		{"ok", "", time.Time{}, time.Time{}, nil, http.StatusOK,
+			`{"entries":[{"id":"1","time":"2019-10-01T00:00:00Z","actor":"retention","operation":"delete","table":"x509_certs","key":"1","digest":"sha256:abc"}]}`},
+		{"ok-range", "?from=2019-10-01T00:00:00Z&to=2019-10-01T00:00:00Z", from, from, nil, http.StatusOK, ""},
+		{"fail-from", "?from=foo", time.Time{}, time.Time{}, nil, http.StatusBadRequest, ""},
+		{"fail-to", "?to=foo", time.Time{}, time.Time{}, nil, http.StatusBadRequest, ""},
+		{"fail", "", time.Time{}, time.Time{}, fmt.Errorf("an error"), http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				getJournal: func(from, to time.Time) ([]*db.JournalEntry, error) {
+					assert.Equals(t, tt.from, from)
+					assert.Equals(t, tt.to, to)
+					return entries, tt.err
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("GET", "http://example.com/admin/journal"+tt.query, nil)
+			w := httptest.NewRecorder()
+			h.Journal(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			body, err := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+			if tt.expected != "" {
+				assert.Equals(t, tt.expected, strings.TrimSpace(string(body)))
+			}
+		})
+	}
+}
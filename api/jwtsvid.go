@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/pkg/errors"
+)
+
+// JWTSVIDAuthority is the interface implemented by a CA authority that issues
+// JWT-SVIDs.
+type JWTSVIDAuthority interface {
+	SignJWTSVID(ctx context.Context, spiffeID string, audience []string, signOpts ...provisioner.SignOption) (string, time.Time, error)
+	GetJWTSVIDKeys() jose.JSONWebKeySet
+}
+
+// JWTSVIDRequest is the request body of a JWT-SVID request. The one-time token
+// is the same used to sign a certificate for the SPIFFE ID.
+type JWTSVIDRequest struct {
+	OTT      string   `json:"ott"`
+	SPIFFEID string   `json:"spiffeID"`
+	Audience []string `json:"audience"`
+}
+
+// Validate checks the fields of the JWTSVIDRequest.
+func (s *JWTSVIDRequest) Validate() error {
+	if s.OTT == "" {
+		return BadRequest(errors.New("missing ott"))
+	}
+	if s.SPIFFEID == "" {
+		return BadRequest(errors.New("missing spiffeID"))
+	}
+	if len(s.Audience) == 0 {
+		return BadRequest(errors.New("missing audience"))
+	}
+	return nil
+}
+
+// JWTSVIDResponse is the response object of a JWT-SVID request.
+type JWTSVIDResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// JWTSVID is an HTTP handler that authorizes a one-time token as a sign
+// request and returns a JWT-SVID for the SPIFFE ID that the certificate would
+// have.
+func (h *caHandler) JWTSVID(w http.ResponseWriter, r *http.Request) {
+	var body JWTSVIDRequest
+	if err := ReadJSON(r.Body, &body); err != nil {
+		WriteError(w, BadRequest(errors.Wrap(err, "error reading request body")))
+		return
+	}
+
+	logOtt(w, body.OTT)
+	if err := body.Validate(); err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	signOpts, err := h.Authority.Authorize(provisioner.NewContextWithMethod(r.Context(), provisioner.SignMethod), body.OTT)
+	if err != nil {
+		WriteError(w, Unauthorized(err))
+		return
+	}
+
+	token, expiresAt, err := h.Authority.SignJWTSVID(r.Context(), body.SPIFFEID, body.Audience, signOpts...)
+	if err != nil {
+		WriteError(w, Forbidden(err))
+		return
+	}
+	logJWTSVID(w, body.SPIFFEID, body.Audience)
+	JSONStatus(w, &JWTSVIDResponse{Token: token, ExpiresAt: expiresAt}, http.StatusCreated)
+}
+
+func logJWTSVID(w http.ResponseWriter, spiffeID string, audience []string) {
+	if rl, ok := w.(logging.ResponseLogger); ok {
+		rl.WithFields(map[string]interface{}{
+			"spiffe-id": spiffeID,
+			"audience":  audience,
+		})
+	}
+}
+
+// JWTSVIDKeys is an HTTP handler that returns the JSON Web Key Set used to
+// verify the JWT-SVIDs.
+func (h *caHandler) JWTSVIDKeys(w http.ResponseWriter, r *http.Request) {
+	keys := h.Authority.GetJWTSVIDKeys()
+	h.writeCacheableJSON(w, r, &keys, http.StatusOK)
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/smallstep/assert"
+)
+
+func Test_caHandler_JWTSVID(t *testing.T) {
+	expiresAt := time.Date(2020, 1, 1, 0, 5, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		input      string
+		authErr    error
+		signErr    error
+		statusCode int
+		expected   string
+	}{
+		{"ok", `{"ott":"the-ott","spiffeID":"spiffe://example.org/web","audience":["api"]}`, nil, nil,
+			http.StatusCreated, `{"token":"the-token","expiresAt":"2020-01-01T00:05:00Z"}`},
+		{"fail-json", "{", nil, nil, http.StatusBadRequest, ""},
+		{"fail-missing-ott", `{"spiffeID":"spiffe://example.org/web","audience":["api"]}`, nil, nil, http.StatusBadRequest, ""},
+		{"fail-missing-spiffe-id", `{"ott":"the-ott","audience":["api"]}`, nil, nil, http.StatusBadRequest, ""},
+		{"fail-missing-audience", `{"ott":"the-ott","spiffeID":"spiffe://example.org/web"}`, nil, nil, http.StatusBadRequest, ""},
+		{"fail-authorize", `{"ott":"the-ott","spiffeID":"spiffe://example.org/web","audience":["api"]}`, fmt.Errorf("an error"), nil,
+			http.StatusUnauthorized, ""},
+		{"fail-sign", `{"ott":"the-ott","spiffeID":"spiffe://example.org/web","audience":["api"]}`, nil, fmt.Errorf("an error"),
+			http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				authorizeSign: func(ott string) ([]provisioner.SignOption, error) {
+					assert.Equals(t, "the-ott", ott)
+					return []provisioner.SignOption{}, tt.authErr
+				},
+				signJWTSVID: func(ctx context.Context, spiffeID string, audience []string, signOpts ...provisioner.SignOption) (string, time.Time, error) {
+					assert.Equals(t, "spiffe://example.org/web", spiffeID)
+					assert.Equals(t, []string{"api"}, audience)
+					return "the-token", expiresAt, tt.signErr
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("POST", "http://example.com/jwt-svid", strings.NewReader(tt.input))
+			w := httptest.NewRecorder()
+			h.JWTSVID(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			body, err := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+			if tt.expected != "" {
+				assert.Equals(t, tt.expected, strings.TrimSpace(string(body)))
+			}
+		})
+	}
+}
+
+func Test_caHandler_JWTSVIDKeys(t *testing.T) {
+	key, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	h := New(&mockAuthority{
+		getJWTSVIDKeys: func() jose.JSONWebKeySet {
+			return jose.JSONWebKeySet{Keys: []jose.JSONWebKey{key.Public()}}
+		},
+	}).(*caHandler)
+	req := httptest.NewRequest("GET", "http://example.com/jwt-svid/keys", nil)
+	w := httptest.NewRecorder()
+	h.JWTSVIDKeys(w, req)
+	assert.Equals(t, http.StatusOK, w.Code)
+
+	var keys jose.JSONWebKeySet
+	assert.FatalError(t, json.Unmarshal(w.Body.Bytes(), &keys))
+	if assert.Len(t, 1, keys.Keys) {
+		assert.Equals(t, key.KeyID, keys.Keys[0].KeyID)
+		assert.True(t, keys.Keys[0].IsPublic())
+	}
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// KeyGeneration asks the CA to generate the key of the certificate, for the
+// clients that cannot generate good keys. The CA creates the certificate
+// request with the given subject and SANs and signs it with the new key. The
+// key type is EC, RSA or OKP, EC with the curve P-256 by default.
+type KeyGeneration struct {
+	KeyType string   `json:"kty,omitempty"`
+	Curve   string   `json:"crv,omitempty"`
+	Size    int      `json:"size,omitempty"`
+	Subject string   `json:"subject"`
+	SANs    []string `json:"sans,omitempty"`
+}
+
+// Validate checks the fields of the KeyGeneration and returns nil if they are
+// ok or an error if something is wrong.
+func (k *KeyGeneration) Validate() error {
+	if k.Subject == "" {
+		return BadRequest(errors.New("missing keyGeneration subject"))
+	}
+	return nil
+}
+
+// newCertificateRequest returns a certificate request with the subject and
+// SANs of the key generation request signed with the given key.
+func (k *KeyGeneration) newCertificateRequest(key crypto.Signer) (*x509.CertificateRequest, error) {
+	tmpl := &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: k.Subject},
+	}
+	for _, san := range k.SANs {
+		if strings.Contains(san, "://") {
+			if u, err := url.Parse(san); err == nil && u.Scheme != "" {
+				tmpl.URIs = append(tmpl.URIs, u)
+				continue
+			}
+		}
+		if ip := net.ParseIP(san); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else if strings.Contains(san, "@") {
+			tmpl.EmailAddresses = append(tmpl.EmailAddresses, san)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, san)
+		}
+	}
+	b, err := x509.CreateCertificateRequest(rand.Reader, tmpl, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating certificate request")
+	}
+	csr, err := x509.ParseCertificateRequest(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing certificate request")
+	}
+	return csr, nil
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestKeyGeneration_newCertificateRequest(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	kg := &KeyGeneration{
+		Subject: "test.smallstep.com",
+		SANs:    []string{"test.smallstep.com", "127.0.0.1", "::1", "jane@smallstep.com", "spiffe://smallstep.com/test"},
+	}
+	csr, err := kg.newCertificateRequest(key)
+	assert.FatalError(t, err)
+	assert.FatalError(t, csr.CheckSignature())
+	assert.Equals(t, "test.smallstep.com", csr.Subject.CommonName)
+	assert.Equals(t, []string{"test.smallstep.com"}, csr.DNSNames)
+	assert.Equals(t, 2, len(csr.IPAddresses))
+	assert.True(t, csr.IPAddresses[0].Equal(net.ParseIP("127.0.0.1")))
+	assert.True(t, csr.IPAddresses[1].Equal(net.ParseIP("::1")))
+	assert.Equals(t, []string{"jane@smallstep.com"}, csr.EmailAddresses)
+	if assert.Equals(t, 1, len(csr.URIs)) {
+		assert.Equals(t, "spiffe://smallstep.com/test", csr.URIs[0].String())
+	}
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/pkg/errors"
+)
+
+// MintTokenRequest is the request body of a token minting request.
+type MintTokenRequest struct {
+	Provisioner string               `json:"provisioner"`
+	Subject     string               `json:"subject"`
+	SANs        []string             `json:"sans,omitempty"`
+	Lifetime    provisioner.Duration `json:"lifetime,omitempty"`
+}
+
+// Validate checks the fields of the MintTokenRequest.
+func (m *MintTokenRequest) Validate() error {
+	if m.Provisioner == "" {
+		return BadRequest(errors.New("missing provisioner"))
+	}
+	if m.Subject == "" {
+		return BadRequest(errors.New("missing subject"))
+	}
+	return nil
+}
+
+// MintTokenResponse is the response object of a token minting request.
+type MintTokenResponse struct {
+	OTT string `json:"ott"`
+}
+
+// MintToken is an HTTP handler that generates a one-time token using the key
+// of a provisioner stored in the CA.
+func (h *caHandler) MintToken(w http.ResponseWriter, r *http.Request) {
+	var body MintTokenRequest
+	if err := ReadJSON(r.Body, &body); err != nil {
+		WriteError(w, BadRequest(errors.Wrap(err, "error reading request body")))
+		return
+	}
+	if err := body.Validate(); err != nil {
+		WriteError(w, err)
+		return
+	}
+
+	ott, err := h.Authority.MintToken(authority.MintOptions{
+		Provisioner: body.Provisioner,
+		Subject:     body.Subject,
+		SANs:        body.SANs,
+		Lifetime:    body.Lifetime.Duration,
+	})
+	if err != nil {
+		WriteError(w, Forbidden(err))
+		return
+	}
+	logMintToken(w, body.Provisioner, body.Subject)
+	JSONStatus(w, &MintTokenResponse{OTT: ott}, http.StatusCreated)
+}
+
+func logMintToken(w http.ResponseWriter, provisioner, subject string) {
+	if rl, ok := w.(logging.ResponseLogger); ok {
+		rl.WithFields(map[string]interface{}{
+			"provisioner": provisioner,
+			"subject":     subject,
+		})
+	}
+}
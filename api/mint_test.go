@@ -0,0 +1,62 @@
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/smallstep/assert"
+)
+
+func Test_caHandler_MintToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		opts       authority.MintOptions
+		err        error
+		statusCode int
+		expected   string
+	}{
+		{"ok", `{"provisioner":"Max","subject":"test.smallstep.com"}`,
+			authority.MintOptions{Provisioner: "Max", Subject: "test.smallstep.com"},
+			nil, http.StatusCreated, `{"ott":"the-ott"}`},
+		{"ok-sans-lifetime", `{"provisioner":"Max","subject":"test","sans":["test.smallstep.com"],"lifetime":"1m"}`,
+			authority.MintOptions{Provisioner: "Max", Subject: "test", SANs: []string{"test.smallstep.com"}, Lifetime: time.Minute},
+			nil, http.StatusCreated, `{"ott":"the-ott"}`},
+		{"fail-json", "{", authority.MintOptions{}, nil, http.StatusBadRequest, ""},
+		{"fail-lifetime", `{"provisioner":"Max","subject":"test","lifetime":"foo"}`, authority.MintOptions{}, nil, http.StatusBadRequest, ""},
+		{"fail-missing-provisioner", `{"subject":"test"}`, authority.MintOptions{}, nil, http.StatusBadRequest, ""},
+		{"fail-missing-subject", `{"provisioner":"Max"}`, authority.MintOptions{}, nil, http.StatusBadRequest, ""},
+		{"fail-mint", `{"provisioner":"Max","subject":"test"}`,
+			authority.MintOptions{Provisioner: "Max", Subject: "test"},
+			fmt.Errorf("an error"), http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				mintToken: func(opts authority.MintOptions) (string, error) {
+					assert.Equals(t, tt.opts, opts)
+					return "the-ott", tt.err
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("POST", "http://example.com/admin/token", strings.NewReader(tt.input))
+			w := httptest.NewRecorder()
+			h.MintToken(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			body, err := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+			if tt.expected != "" {
+				assert.Equals(t, tt.expected, strings.TrimSpace(string(body)))
+			}
+		})
+	}
+}
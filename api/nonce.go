@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+// NonceAuthority is the interface implemented by a CA authority that issues
+// nonces for the tokens of the provisioners that require them.
+type NonceAuthority interface {
+	NewNonce() (string, time.Time, error)
+}
+
+// NonceResponse is the response object of the nonce request.
+type NonceResponse struct {
+	Nonce     string    `json:"nonce"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Nonce is an HTTP handler that returns a new nonce. The nonce must be added
+// to the nonce claim of the tokens of the provisioners that require it, and
+// it can only be used once.
+func (h *caHandler) Nonce(w http.ResponseWriter, r *http.Request) {
+	nonce, expiresAt, err := h.Authority.NewNonce()
+	if err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	JSONStatus(w, &NonceResponse{Nonce: nonce, ExpiresAt: expiresAt}, http.StatusCreated)
+}
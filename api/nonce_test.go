@@ -0,0 +1,43 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func Test_caHandler_Nonce(t *testing.T) {
+	expiresAt := time.Date(2020, 1, 1, 0, 5, 0, 0, time.UTC)
+	tests := []struct {
+		name       string
+		err        error
+		statusCode int
+		expected   string
+	}{
+		{"ok", nil, http.StatusCreated, `{"nonce":"the-nonce","expiresAt":"2020-01-01T00:05:00Z"}`},
+		{"fail", fmt.Errorf("an error"), http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				newNonce: func() (string, time.Time, error) {
+					return "the-nonce", expiresAt, tt.err
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("POST", "http://example.com/nonce", nil)
+			w := httptest.NewRecorder()
+			h.Nonce(w, req)
+
+			assert.Equals(t, tt.statusCode, w.Code)
+			if tt.expected != "" {
+				assert.Equals(t, "no-store", w.Header().Get("Cache-Control"))
+				assert.Equals(t, tt.expected, strings.TrimSpace(w.Body.String()))
+			}
+		})
+	}
+}
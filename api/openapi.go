@@ -0,0 +1,348 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/RTradeLtd/ca-cli/jose"
+)
+
+// OpenAPIPath is the path of the OpenAPI specification of the CA API.
+const OpenAPIPath = "/openapi.json"
+
+// openAPIOperation describes an endpoint of the CA API in the OpenAPI
+// specification. The request and response are the values of the types
+// decoded from the body and encoded in the response, nil if the endpoint does
+// not use a JSON body, and the binary fields are used for the endpoints that
+// respond with a non-JSON body.
+type openAPIOperation struct {
+	summary   string
+	request   interface{}
+	response  interface{}
+	status    int
+	binary    string
+	admin     bool
+	responses map[int]interface{}
+}
+
+// openAPIOperations are the descriptions of the endpoints added by Route,
+// indexed by method and pattern. The routes without description, e.g. the
+// routes added with WithRoutes, are added to the specification with a generic
+// response.
+var openAPIOperations = map[string]openAPIOperation{
+	"GET /health":                           {summary: "Returns the health of the CA.", response: HealthResponse{}},
+	"GET /versions":                         {summary: "Returns the versions of the API.", response: VersionsResponse{}},
+	"GET /root/{sha}":                       {summary: "Returns the root certificate with the given SHA256 fingerprint.", response: RootResponse{}},
+	"GET /bootstrap":                        {summary: "Returns the information required to bootstrap a client.", response: BootstrapResponse{}},
+	"GET " + DiscoveryPath:                  {summary: "Returns the configuration of the CA for automatic discovery.", response: DiscoveryResponse{}},
+	"GET " + OpenAPIPath:                    {summary: "Returns this specification.", response: map[string]interface{}{}},
+	"POST /nonce":                           {summary: "Returns a new nonce for the tokens of the provisioners that require one.", response: NonceResponse{}, status: http.StatusCreated},
+	"POST /sign":                            {summary: "Signs a certificate request using a one-time token.", request: SignRequest{}, response: SignResponse{}, status: http.StatusCreated, responses: map[int]interface{}{http.StatusAccepted: PendingResponse{}}},
+	"POST /renew":                           {summary: "Renews the client certificate used in the TLS connection.", response: SignResponse{}, status: http.StatusCreated},
+	"POST /re-sign":                         {summary: "Renews the client certificate, deprecated alias of /renew.", response: SignResponse{}, status: http.StatusCreated},
+	"POST /rekey":                           {summary: "Renews the client certificate with a new key.", request: RekeyRequest{}, response: SignResponse{}, status: http.StatusCreated},
+	"POST /revoke":                          {summary: "Revokes a certificate.", request: RevokeRequest{}, response: RevokeResponse{}},
+	"GET /provisioners":                     {summary: "Returns the list of provisioners.", response: ProvisionersResponse{}},
+	"GET /provisioners/{kid}/encrypted-key": {summary: "Returns the encrypted key of a provisioner.", response: ProvisionerKeyResponse{}},
+	"GET /roots":                            {summary: "Returns the root certificates.", response: RootsResponse{}, status: http.StatusCreated},
+	"GET /roots.pem":                        {summary: "Returns the root certificates in PEM format.", binary: "application/x-pem-file"},
+	"GET /roots.p7b":                        {summary: "Returns the root certificates in a PKCS #7 bundle.", binary: "application/x-pkcs7-certificates"},
+	"POST /roots.p12":                       {summary: "Returns the root certificates in a PKCS #12 trust store.", request: TrustStoreRequest{}, binary: "application/x-pkcs12"},
+	"POST /roots.jks":                       {summary: "Returns the root certificates in a Java KeyStore.", request: TrustStoreRequest{}, binary: "application/x-java-keystore"},
+	"GET /federation":                       {summary: "Returns the federated root certificates.", response: FederationResponse{}, status: http.StatusCreated},
+	"GET /federation.p7b":                   {summary: "Returns the federated root certificates in a PKCS #7 bundle.", binary: "application/x-pkcs7-certificates"},
+	"POST /federation.p12":                  {summary: "Returns the federated root certificates in a PKCS #12 trust store.", request: TrustStoreRequest{}, binary: "application/x-pkcs12"},
+	"POST /federation.jks":                  {summary: "Returns the federated root certificates in a Java KeyStore.", request: TrustStoreRequest{}, binary: "application/x-java-keystore"},
+	"GET /intermediates":                    {summary: "Returns the intermediate certificates.", response: IntermediatesResponse{}},
+	"GET /transparency/sth":                 {summary: "Returns the signed tree head of the transparency log.", response: authority.SignedTreeHead{}},
+	"GET /transparency/entries":             {summary: "Returns the entries of the transparency log.", response: LogEntriesResponse{}},
+	"GET /transparency/proof/{serial}":      {summary: "Returns the inclusion proof of a certificate in the transparency log.", response: authority.InclusionProof{}},
+	"POST /jwt-svid":                        {summary: "Returns a JWT-SVID for a SPIFFE ID using a one-time token.", request: JWTSVIDRequest{}, response: JWTSVIDResponse{}, status: http.StatusCreated},
+	"GET /jwt-svid/keys":                    {summary: "Returns the JSON Web Key Set used to verify the JWT-SVIDs.", response: jose.JSONWebKeySet{}},
+	"GET /crl":                              {summary: "Returns the latest certificate revocation list in DER format.", binary: PKIXCRLContentType},
+	"POST /sign-ssh":                        {summary: "Signs an SSH public key using a one-time token.", request: SignSSHRequest{}, response: SignSSHResponse{}, status: http.StatusCreated},
+	"GET /pending/{id}":                     {summary: "Returns the certificate of a request waiting for approval.", response: SignResponse{}, status: http.StatusCreated, responses: map[int]interface{}{http.StatusAccepted: PendingResponse{}}},
+	"GET /certificates":                     {summary: "Returns the certificates issued by the CA.", response: CertificatesResponse{}, admin: true},
+	"GET /certificates/expiring":            {summary: "Returns the certificates about to expire.", response: CertificatesResponse{}, admin: true},
+	"GET /certificates/{serial}":            {summary: "Returns the details of a certificate.", response: CertificateDetailsResponse{}, admin: true},
+	"GET /stats":                            {summary: "Returns the statistics of the CA.", response: StatsResponse{}, admin: true},
+	"GET /events":                           {summary: "Streams the events of the CA.", binary: "text/event-stream", admin: true},
+	"POST /admin/introspect":                {summary: "Returns the claims of a token.", request: IntrospectRequest{}, response: authority.TokenIntrospection{}, admin: true},
+	"POST /admin/token":                     {summary: "Returns a new one-time token.", request: MintTokenRequest{}, response: MintTokenResponse{}, status: http.StatusCreated, admin: true},
+	"GET /admin/config":                     {summary: "Returns the configuration of the CA without secrets.", response: map[string]interface{}{}, admin: true},
+	"POST /admin/ca/import":                 {summary: "Imports a new intermediate certificate authority.", request: ImportCARequest{}, response: ImportCAResponse{}, admin: true},
+	"GET /admin/ratelimit":                  {summary: "Returns the statistics of the rate limits.", response: RateLimitStatsResponse{}, admin: true},
+	"GET /admin/retention":                  {summary: "Returns the statistics of the retention of the database.", response: RetentionStatsResponse{}, admin: true},
+	"GET /admin/backup":                     {summary: "Returns a backup of the database.", response: authority.Backup{}, admin: true},
+	"POST /admin/restore":                   {summary: "Restores a backup of the database.", request: authority.Backup{}, response: RestoreResponse{}, admin: true},
+	"GET /admin/journal":                    {summary: "Returns the journal of the database.", response: JournalResponse{}, admin: true},
+	"GET /admin/audit":                      {summary: "Returns the entries of the audit log.", response: AuditResponse{}, admin: true},
+	"GET /admin/pending":                    {summary: "Returns the certificate requests waiting for approval.", response: PendingRequestsResponse{}, admin: true},
+	"GET /admin/pending/{id}":               {summary: "Returns a certificate request waiting for approval.", response: PendingRequestResponse{}, admin: true},
+	"POST /admin/pending/{id}/approve":      {summary: "Approves a certificate request.", response: PendingRequestResponse{}, admin: true},
+	"POST /admin/pending/{id}/deny":         {summary: "Denies a certificate request.", request: DenyPendingRequest{}, response: PendingRequestResponse{}, admin: true},
+
+	"GET /admin/inventory":                      {summary: "Returns the hosts and workloads of the inventory.", response: InventoryResponse{}, admin: true},
+	"GET /admin/inventory/{name}":               {summary: "Returns a host or workload of the inventory.", response: db.InventoryEntry{}, admin: true},
+	"PUT /admin/inventory/{name}":               {summary: "Registers a host or workload in the inventory.", request: InventoryRequest{}, response: db.InventoryEntry{}, admin: true},
+	"DELETE /admin/inventory/{name}":            {summary: "Removes a host or workload from the inventory.", status: http.StatusNoContent, admin: true},
+	"POST /admin/inventory/{name}/certificates": {summary: "Links a certificate to a host or workload of the inventory.", request: InventoryCertificateRequest{}, response: db.InventoryEntry{}, admin: true},
+}
+
+// OpenAPI is an HTTP handler that returns the OpenAPI 3.0 specification of the
+// CA API. The specification is generated from the routes added by Route and
+// the types of the requests and responses.
+func (h *caHandler) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	JSON(w, h.openAPISpec())
+}
+
+// openAPIRoute is a route added to the openAPIRouter.
+type openAPIRoute struct {
+	method, pattern string
+}
+
+// openAPIRouter is a Router that records the routes added to it.
+type openAPIRouter struct {
+	routes []openAPIRoute
+}
+
+func (r *openAPIRouter) MethodFunc(method, pattern string, h http.HandlerFunc) {
+	r.routes = append(r.routes, openAPIRoute{method, pattern})
+}
+
+var openAPIPathParam = regexp.MustCompile(`{([^}/]+)}`)
+
+// openAPISpec returns the OpenAPI specification of the routes of the handler.
+// The CORS preflight requests are not included.
+func (h *caHandler) openAPISpec() map[string]interface{} {
+	rr := new(openAPIRouter)
+	h.route(rr)
+
+	g := &openAPIGenerator{schemas: map[string]interface{}{}, types: map[reflect.Type]string{}}
+	paths := map[string]interface{}{}
+	for _, rt := range rr.routes {
+		if rt.method == "OPTIONS" {
+			continue
+		}
+		item, ok := paths[rt.pattern].(map[string]interface{})
+		if !ok {
+			item = map[string]interface{}{}
+			paths[rt.pattern] = item
+		}
+		item[strings.ToLower(rt.method)] = g.operation(rt, openAPIOperations[rt.method+" "+rt.pattern])
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Certificate Authority API",
+			"version": CurrentVersion,
+		},
+		"servers": []map[string]interface{}{
+			{"url": "/" + CurrentVersion},
+			{"url": "/"},
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]interface{}{
+				"adminToken": map[string]interface{}{
+					"type":   "http",
+					"scheme": "bearer",
+				},
+			},
+		},
+	}
+}
+
+// openAPIGenerator generates the OpenAPI operations and the schemas of the
+// types they use.
+type openAPIGenerator struct {
+	schemas map[string]interface{}
+	types   map[reflect.Type]string
+}
+
+func (g *openAPIGenerator) operation(rt openAPIRoute, op openAPIOperation) map[string]interface{} {
+	o := map[string]interface{}{}
+	if op.summary != "" {
+		o["summary"] = op.summary
+	}
+	var params []interface{}
+	for _, m := range openAPIPathParam.FindAllStringSubmatch(rt.pattern, -1) {
+		params = append(params, map[string]interface{}{
+			"name":     m[1],
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]interface{}{"type": "string"},
+		})
+	}
+	if len(params) > 0 {
+		o["parameters"] = params
+	}
+	if op.request != nil {
+		o["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": g.schema(reflect.TypeOf(op.request)),
+				},
+			},
+		}
+	}
+
+	status := op.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	responses := map[string]interface{}{}
+	switch {
+	case op.response != nil:
+		responses[strconv.Itoa(status)] = g.response(op.response)
+	case op.binary != "":
+		responses[strconv.Itoa(status)] = map[string]interface{}{
+			"description": http.StatusText(status),
+			"content": map[string]interface{}{
+				op.binary: map[string]interface{}{
+					"schema": map[string]interface{}{"type": "string", "format": "binary"},
+				},
+			},
+		}
+	default:
+		responses[strconv.Itoa(status)] = map[string]interface{}{
+			"description": http.StatusText(status),
+		}
+	}
+	for code, v := range op.responses {
+		responses[strconv.Itoa(code)] = g.response(v)
+	}
+	responses["default"] = map[string]interface{}{
+		"description": "Error",
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema": g.schema(reflect.TypeOf(ErrorResponse{})),
+			},
+		},
+	}
+	o["responses"] = responses
+	if op.admin {
+		o["security"] = []map[string]interface{}{
+			{"adminToken": []string{}},
+		}
+	}
+	return o
+}
+
+func (g *openAPIGenerator) response(v interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"description": "OK",
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{
+				"schema": g.schema(reflect.TypeOf(v)),
+			},
+		},
+	}
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+// schema returns the schema of the JSON encoding of the given type. Named
+// structs are added to the components and referenced.
+func (g *openAPIGenerator) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t {
+	case reflect.TypeOf(Certificate{}), reflect.TypeOf(CertificateRequest{}):
+		return map[string]interface{}{"type": "string", "description": "PEM encoded"}
+	case reflect.TypeOf(SSHCertificate{}):
+		return map[string]interface{}{"type": "string", "format": "byte"}
+	case reflect.TypeOf(TimeDuration{}):
+		return map[string]interface{}{"type": "string", "description": "RFC 3339 time or duration"}
+	case timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	if t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType) {
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		name, ok := g.types[t]
+		if !ok {
+			name = t.Name()
+			if _, exists := g.schemas[name]; exists {
+				name = strings.Title(t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]) + name
+			}
+			g.types[t] = name
+			g.schemas[name] = g.object(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// object returns the schema of a struct, the embedded structs without a JSON
+// name are inlined like encoding/json does.
+func (g *openAPIGenerator) object(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	g.fields(t, properties)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+func (g *openAPIGenerator) fields(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.fields(ft, properties)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = g.schema(f.Type)
+	}
+}
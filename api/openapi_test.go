@@ -0,0 +1,98 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func Test_openAPIOperations(t *testing.T) {
+	// All the routes must be described, and all the descriptions must match a
+	// route.
+	rr := new(openAPIRouter)
+	New(&mockAuthority{}).(*caHandler).route(rr)
+	routes := map[string]bool{}
+	for _, rt := range rr.routes {
+		if rt.method == "OPTIONS" {
+			continue
+		}
+		key := rt.method + " " + rt.pattern
+		routes[key] = true
+		if _, ok := openAPIOperations[key]; !ok {
+			t.Errorf("route %s is not in openAPIOperations", key)
+		}
+	}
+	for key := range openAPIOperations {
+		if !routes[key] {
+			t.Errorf("openAPIOperations %s is not a route", key)
+		}
+	}
+}
+
+func Test_caHandler_OpenAPI(t *testing.T) {
+	h := New(&mockAuthority{}, WithRoutes(func(r Router) {
+		r.MethodFunc("GET", "/custom/{name}", func(w http.ResponseWriter, r *http.Request) {})
+	})).(*caHandler)
+	req := httptest.NewRequest("GET", "http://example.com/openapi.json", nil)
+	w := httptest.NewRecorder()
+	h.OpenAPI(w, req)
+	assert.Equals(t, http.StatusOK, w.Code)
+
+	var spec struct {
+		OpenAPI    string                                       `json:"openapi"`
+		Paths      map[string]map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]map[string]interface{} `json:"schemas"`
+		} `json:"components"`
+	}
+	assert.FatalError(t, json.Unmarshal(w.Body.Bytes(), &spec))
+	assert.Equals(t, "3.0.3", spec.OpenAPI)
+
+	sign := spec.Paths["/sign"]["post"]
+	assert.NotNil(t, sign)
+	assert.Equals(t, "Signs a certificate request using a one-time token.", sign["summary"])
+	responses := sign["responses"].(map[string]interface{})
+	assert.NotNil(t, responses["201"])
+	assert.NotNil(t, responses["202"])
+	assert.NotNil(t, responses["default"])
+
+	// Admin endpoints require the admin token.
+	assert.Nil(t, spec.Paths["/health"]["get"]["security"])
+	assert.NotNil(t, spec.Paths["/certificates"]["get"]["security"])
+
+	// Routes added by the programs embedding the CA.
+	custom := spec.Paths["/custom/{name}"]["get"]
+	if assert.NotNil(t, custom) {
+		params := custom["parameters"].([]interface{})
+		assert.Len(t, 1, params)
+		assert.Equals(t, "name", params[0].(map[string]interface{})["name"])
+	}
+
+	// CORS preflight routes are not included.
+	for path, item := range spec.Paths {
+		if _, ok := item["options"]; ok {
+			t.Errorf("path %s has an options operation", path)
+		}
+	}
+
+	// Schemas of the requests and responses.
+	signRequest := spec.Components.Schemas["SignRequest"]
+	if assert.NotNil(t, signRequest) {
+		properties := signRequest["properties"].(map[string]interface{})
+		assert.Equals(t, map[string]interface{}{"type": "string", "description": "PEM encoded"}, properties["csr"])
+		assert.Equals(t, map[string]interface{}{"type": "string"}, properties["ott"])
+	}
+	assert.NotNil(t, spec.Components.Schemas["ErrorResponse"])
+
+	// All the references are defined.
+	re := regexp.MustCompile(`"#/components/schemas/([^"]+)"`)
+	for _, m := range re.FindAllStringSubmatch(w.Body.String(), -1) {
+		if _, ok := spec.Components.Schemas[m[1]]; !ok {
+			t.Errorf("schema %s is not defined", m[1])
+		}
+	}
+}
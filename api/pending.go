@@ -0,0 +1,182 @@
+package api
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+)
+
+// PendingAuthority is the interface implemented by a CA authority that can
+// queue certificate requests until an admin approves them.
+type PendingAuthority interface {
+	IsApprovalRequired(signOpts []provisioner.SignOption) bool
+	CreatePendingRequest(cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) (*authority.PendingRequest, error)
+	GetPendingRequest(id string) (*authority.PendingRequest, error)
+	GetPendingRequests(status authority.PendingStatus) ([]*authority.PendingRequest, error)
+	ApprovePendingRequest(ctx context.Context, id, reviewer string) (*authority.PendingRequest, error)
+	DenyPendingRequest(id, reviewer, reason string) (*authority.PendingRequest, error)
+}
+
+// PendingResponse is the response object returned when a certificate request
+// requires the approval of an admin. The client can poll the status of the
+// request using the id.
+type PendingResponse struct {
+	ID     string                  `json:"id"`
+	Status authority.PendingStatus `json:"status"`
+	Reason string                  `json:"reason,omitempty"`
+}
+
+// PendingRequestResponse is the admin view of a pending certificate request.
+type PendingRequestResponse struct {
+	ID           string                  `json:"id"`
+	Status       authority.PendingStatus `json:"status"`
+	Provisioner  string                  `json:"provisioner"`
+	CsrPEM       CertificateRequest      `json:"csr"`
+	CreatedAt    time.Time               `json:"createdAt"`
+	UpdatedAt    time.Time               `json:"updatedAt"`
+	ExpiresAt    time.Time               `json:"expiresAt"`
+	Reviewer     string                  `json:"reviewer,omitempty"`
+	Reason       string                  `json:"reason,omitempty"`
+	CertChainPEM []Certificate           `json:"certChain,omitempty"`
+}
+
+// PendingRequestsResponse is the response object of the pending requests list.
+type PendingRequestsResponse struct {
+	Requests []*PendingRequestResponse `json:"requests"`
+}
+
+// DenyPendingRequest is the request body used to deny a pending request.
+type DenyPendingRequest struct {
+	Reason string `json:"reason"`
+}
+
+func newPendingRequestResponse(pr *authority.PendingRequest) *PendingRequestResponse {
+	res := &PendingRequestResponse{
+		ID:          pr.ID,
+		Status:      pr.Status,
+		Provisioner: pr.Provisioner,
+		CsrPEM:      NewCertificateRequest(pr.CSR),
+		CreatedAt:   pr.CreatedAt,
+		UpdatedAt:   pr.UpdatedAt,
+		ExpiresAt:   pr.ExpiresAt,
+		Reviewer:    pr.Reviewer,
+		Reason:      pr.Reason,
+	}
+	if len(pr.CertChain) > 0 {
+		res.CertChainPEM = certChainToPEM(pr.CertChain)
+	}
+	return res
+}
+
+// Pending is an HTTP handler that returns the status of a pending certificate
+// request. It returns the signed certificate once the request is approved.
+func (h *caHandler) Pending(w http.ResponseWriter, r *http.Request) {
+	includeRoot, err := parseChain(r)
+	if err != nil {
+		WriteError(w, BadRequest(err))
+		return
+	}
+
+	pr, err := h.Authority.GetPendingRequest(chi.URLParam(r, "id"))
+	if err != nil {
+		WriteError(w, NotFound(err))
+		return
+	}
+
+	switch pr.Status {
+	case authority.StatusApproved:
+		certChain := pr.CertChain
+		if includeRoot {
+			if certChain, err = h.appendRoot(certChain); err != nil {
+				WriteError(w, InternalServerError(err))
+				return
+			}
+		}
+		logCertificate(w, certChain[0])
+		h.writeSignResponse(w, r, certChain)
+	case authority.StatusDenied:
+		WriteError(w, Forbidden(errors.Errorf("certificate request %s has been denied", pr.ID)))
+	default:
+		JSONStatus(w, &PendingResponse{
+			ID:     pr.ID,
+			Status: pr.Status,
+		}, http.StatusAccepted)
+	}
+}
+
+// AdminPendingRequests is an HTTP handler that returns the list of pending
+// certificate requests. The status query parameter can be used to filter the
+// requests.
+func (h *caHandler) AdminPendingRequests(w http.ResponseWriter, r *http.Request) {
+	status := authority.PendingStatus(r.URL.Query().Get("status"))
+	switch status {
+	case "", authority.StatusPending, authority.StatusApproved, authority.StatusDenied:
+	default:
+		WriteError(w, BadRequest(errors.Errorf("unsupported status %s", status)))
+		return
+	}
+
+	list, err := h.Authority.GetPendingRequests(status)
+	if err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+	res := &PendingRequestsResponse{
+		Requests: make([]*PendingRequestResponse, len(list)),
+	}
+	for i, pr := range list {
+		res.Requests[i] = newPendingRequestResponse(pr)
+	}
+	JSON(w, res)
+}
+
+// AdminPendingRequest is an HTTP handler that returns a pending certificate
+// request.
+func (h *caHandler) AdminPendingRequest(w http.ResponseWriter, r *http.Request) {
+	pr, err := h.Authority.GetPendingRequest(chi.URLParam(r, "id"))
+	if err != nil {
+		WriteError(w, NotFound(err))
+		return
+	}
+	JSON(w, newPendingRequestResponse(pr))
+}
+
+// AdminApprovePendingRequest is an HTTP handler that approves a pending
+// certificate request and issues the certificate.
+func (h *caHandler) AdminApprovePendingRequest(w http.ResponseWriter, r *http.Request) {
+	reviewer, _ := logging.GetUserID(r.Context())
+	pr, err := h.Authority.ApprovePendingRequest(r.Context(), chi.URLParam(r, "id"), reviewer)
+	if err != nil {
+		WriteError(w, Forbidden(err))
+		return
+	}
+	logCertificate(w, pr.CertChain[0])
+	JSON(w, newPendingRequestResponse(pr))
+}
+
+// AdminDenyPendingRequest is an HTTP handler that denies a pending certificate
+// request.
+func (h *caHandler) AdminDenyPendingRequest(w http.ResponseWriter, r *http.Request) {
+	var body DenyPendingRequest
+	if r.ContentLength != 0 {
+		if err := ReadJSON(r.Body, &body); err != nil {
+			WriteError(w, BadRequest(errors.Wrap(err, "error reading request body")))
+			return
+		}
+	}
+
+	reviewer, _ := logging.GetUserID(r.Context())
+	pr, err := h.Authority.DenyPendingRequest(chi.URLParam(r, "id"), reviewer, body.Reason)
+	if err != nil {
+		WriteError(w, Forbidden(err))
+		return
+	}
+	JSON(w, newPendingRequestResponse(pr))
+}
@@ -0,0 +1,262 @@
+package api
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/RTradeLtd/ca-cli/crypto/tlsutil"
+	"github.com/go-chi/chi"
+	"github.com/smallstep/assert"
+)
+
+func Test_caHandler_Sign_pending(t *testing.T) {
+	csr := parseCertificateRequest(csrPEM)
+	valid, err := json.Marshal(SignRequest{
+		CsrPEM: CertificateRequest{csr},
+		OTT:    "foobarzar",
+	})
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name       string
+		err        error
+		statusCode int
+		expected   string
+	}{
+		{"ok", nil, http.StatusAccepted, `{"id":"the-id","status":"pending"}`},
+		{"fail", fmt.Errorf("an error"), http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				authorizeSign: func(ott string) ([]provisioner.SignOption, error) {
+					return []provisioner.SignOption{"the-option"}, nil
+				},
+				isApprovalRequired: func(signOpts []provisioner.SignOption) bool {
+					return true
+				},
+				createPendingRequest: func(cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) (*authority.PendingRequest, error) {
+					assert.Equals(t, csr, cr)
+					assert.Equals(t, []provisioner.SignOption{"the-option"}, signOpts)
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return &authority.PendingRequest{ID: "the-id", Status: authority.StatusPending}, nil
+				},
+				sign: func(cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+					t.Error("caHandler.Sign should not sign a pending request")
+					return nil, nil
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("POST", "http://example.com/sign", strings.NewReader(string(valid)))
+			w := httptest.NewRecorder()
+			h.Sign(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			body, err := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+			if tt.expected != "" {
+				assert.Equals(t, tt.expected, strings.TrimSpace(string(body)))
+			}
+		})
+	}
+}
+
+func Test_caHandler_Pending(t *testing.T) {
+	certChain := []*x509.Certificate{parseCertificate(certPEM), parseCertificate(rootPEM)}
+	expected := `{"crt":"` + strings.Replace(certPEM, "\n", `\n`, -1) + `\n","ca":"` + strings.Replace(rootPEM, "\n", `\n`, -1) + `\n","certChain":["` + strings.Replace(certPEM, "\n", `\n`, -1) + `\n","` + strings.Replace(rootPEM, "\n", `\n`, -1) + `\n"]}`
+
+	tests := []struct {
+		name       string
+		pr         *authority.PendingRequest
+		err        error
+		statusCode int
+		expected   string
+	}{
+		{"pending", &authority.PendingRequest{ID: "the-id", Status: authority.StatusPending}, nil, http.StatusAccepted, `{"id":"the-id","status":"pending"}`},
+		{"approved", &authority.PendingRequest{ID: "the-id", Status: authority.StatusApproved, CertChain: certChain}, nil, http.StatusCreated, expected},
+		{"denied", &authority.PendingRequest{ID: "the-id", Status: authority.StatusDenied}, nil, http.StatusForbidden, ""},
+		{"not found", nil, fmt.Errorf("not found"), http.StatusNotFound, ""},
+	}
+
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add("id", "the-id")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				getPendingRequest: func(id string) (*authority.PendingRequest, error) {
+					assert.Equals(t, "the-id", id)
+					return tt.pr, tt.err
+				},
+				getTLSOptions: func() *tlsutil.TLSOptions {
+					return nil
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("GET", "http://example.com/pending/the-id", nil)
+			req = req.WithContext(context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx))
+			w := httptest.NewRecorder()
+			h.Pending(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			body, err := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+			if tt.expected != "" {
+				assert.Equals(t, tt.expected, strings.TrimSpace(string(body)))
+			}
+		})
+	}
+}
+
+func Test_caHandler_AdminPendingRequests(t *testing.T) {
+	csr := parseCertificateRequest(csrPEM)
+	tests := []struct {
+		name       string
+		query      string
+		status     authority.PendingStatus
+		err        error
+		statusCode int
+	}{
+		{"ok", "", "", nil, http.StatusOK},
+		{"ok-status", "?status=denied", authority.StatusDenied, nil, http.StatusOK},
+		{"fail-status", "?status=foo", "", nil, http.StatusBadRequest},
+		{"fail", "", "", fmt.Errorf("an error"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				getPendingRequests: func(status authority.PendingStatus) ([]*authority.PendingRequest, error) {
+					assert.Equals(t, tt.status, status)
+					return []*authority.PendingRequest{
+						{ID: "the-id", Status: authority.StatusDenied, Provisioner: "step-cli", CSR: csr},
+					}, tt.err
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("GET", "http://example.com/admin/pending"+tt.query, nil)
+			w := httptest.NewRecorder()
+			h.AdminPendingRequests(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			if tt.statusCode == http.StatusOK {
+				var body PendingRequestsResponse
+				assert.FatalError(t, ReadJSON(res.Body, &body))
+				if assert.Len(t, 1, body.Requests) {
+					assert.Equals(t, "the-id", body.Requests[0].ID)
+					assert.Equals(t, "step-cli", body.Requests[0].Provisioner)
+					assert.Equals(t, csr.Raw, body.Requests[0].CsrPEM.Raw)
+				}
+			}
+		})
+	}
+}
+
+func Test_caHandler_AdminApprovePendingRequest(t *testing.T) {
+	certChain := []*x509.Certificate{parseCertificate(certPEM), parseCertificate(rootPEM)}
+	tests := []struct {
+		name       string
+		err        error
+		statusCode int
+	}{
+		{"ok", nil, http.StatusOK},
+		{"fail", fmt.Errorf("an error"), http.StatusForbidden},
+	}
+
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add("id", "the-id")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				approvePendingRequest: func(id, reviewer string) (*authority.PendingRequest, error) {
+					assert.Equals(t, "the-id", id)
+					assert.Equals(t, "admin", reviewer)
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return &authority.PendingRequest{
+						ID: id, Status: authority.StatusApproved, Reviewer: reviewer,
+						CSR: parseCertificateRequest(csrPEM), CertChain: certChain,
+					}, nil
+				},
+			}).(*caHandler)
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			req := httptest.NewRequest("POST", "http://example.com/admin/pending/the-id/approve", nil)
+			req = req.WithContext(logging.WithUserID(ctx, "admin"))
+			w := httptest.NewRecorder()
+			h.AdminApprovePendingRequest(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			if tt.statusCode == http.StatusOK {
+				var body PendingRequestResponse
+				assert.FatalError(t, ReadJSON(res.Body, &body))
+				assert.Equals(t, authority.StatusApproved, body.Status)
+				assert.Equals(t, "admin", body.Reviewer)
+				assert.Len(t, 2, body.CertChainPEM)
+			}
+		})
+	}
+}
+
+func Test_caHandler_AdminDenyPendingRequest(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		reason     string
+		err        error
+		statusCode int
+	}{
+		{"ok", `{"reason":"not allowed"}`, "not allowed", nil, http.StatusOK},
+		{"ok-no-body", "", "", nil, http.StatusOK},
+		{"fail-json", "{", "", nil, http.StatusBadRequest},
+		{"fail", "", "", fmt.Errorf("an error"), http.StatusForbidden},
+	}
+
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add("id", "the-id")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				denyPendingRequest: func(id, reviewer, reason string) (*authority.PendingRequest, error) {
+					assert.Equals(t, "the-id", id)
+					assert.Equals(t, "admin", reviewer)
+					assert.Equals(t, tt.reason, reason)
+					if tt.err != nil {
+						return nil, tt.err
+					}
+					return &authority.PendingRequest{
+						ID: id, Status: authority.StatusDenied, Reviewer: reviewer, Reason: reason,
+						CSR: parseCertificateRequest(csrPEM),
+					}, nil
+				},
+			}).(*caHandler)
+			ctx := context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx)
+			req := httptest.NewRequest("POST", "http://example.com/admin/pending/the-id/deny", strings.NewReader(tt.input))
+			req = req.WithContext(logging.WithUserID(ctx, "admin"))
+			w := httptest.NewRecorder()
+			h.AdminDenyPendingRequest(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			if tt.statusCode == http.StatusOK {
+				var body PendingRequestResponse
+				assert.FatalError(t, ReadJSON(res.Body, &body))
+				assert.Equals(t, authority.StatusDenied, body.Status)
+				assert.Equals(t, tt.reason, body.Reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,349 @@
+package api
+
+import (
+	"crypto"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"math/big"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+)
+
+// pkcs12Iterations is the iteration count of the key derivation of the MAC,
+// the default of OpenSSL and Java.
+const pkcs12Iterations = 2048
+
+var (
+	oidSHA1                  = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidCertBag               = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidPKCS8ShroudedKeyBag   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidPBEWithSHAAnd3KeyTDES = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidX509Certificate       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidFriendlyName          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidLocalKeyID            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+	oidJavaTrustedUsage      = asn1.ObjectIdentifier{2, 16, 840, 1, 113894, 746875, 1, 1}
+	oidAnyExtKeyUsage        = asn1.ObjectIdentifier{2, 5, 29, 37, 0}
+)
+
+type pfxPDU struct {
+	Version  int
+	AuthSafe pkcs7ContentInfo
+	MacData  pkcs12MacData
+}
+
+type pkcs12MacData struct {
+	Mac        pkcs12DigestInfo
+	MacSalt    []byte
+	Iterations int
+}
+
+type pkcs12DigestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type pkcs12SafeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12CertBag struct {
+	ID   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type pkcs12Attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+type pkcs12PBEParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+type pkcs8EncryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// encodePKCS12 returns a PKCS#12 trust store with the given certificates,
+// protected with a MAC derived from the given password (RFC 7292). The
+// certificates are not encrypted, they are public. Each certificate has its
+// SHA-256 fingerprint as friendly name, and it is marked as trusted for any
+// purpose so Java loads it as a trusted certificate entry.
+func encodePKCS12(certs []*x509.Certificate, password string) ([]byte, error) {
+	bmpPassword, err := bmpString(password)
+	if err != nil {
+		return nil, err
+	}
+	trustedUsage, err := asn1.Marshal(oidAnyExtKeyUsage)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling pkcs12 attribute")
+	}
+
+	bags := make([]pkcs12SafeBag, len(certs))
+	for i, crt := range certs {
+		if bags[i], err = pkcs12NewCertBag(crt, pkcs12Attribute{ID: oidJavaTrustedUsage, Value: pkcs12Set(trustedUsage)}); err != nil {
+			return nil, err
+		}
+	}
+	return marshalPKCS12(bmpPassword, bags)
+}
+
+// encodePKCS12KeyStore returns a PKCS#12 key store with the given certificate
+// chain and, if it is not nil, the private key of the first certificate,
+// protected with the given password. The key is encrypted with
+// pbeWithSHAAnd3-KeyTripleDES-CBC, the algorithm supported by Windows and
+// Java, and the certificate is linked to it with a local key id.
+func encodePKCS12KeyStore(certChain []*x509.Certificate, key crypto.PrivateKey, password string) ([]byte, error) {
+	bmpPassword, err := bmpString(password)
+	if err != nil {
+		return nil, err
+	}
+
+	var keyBags, certBags []pkcs12SafeBag
+	var leafAttrs []pkcs12Attribute
+	if key != nil {
+		sum := sha1.Sum(certChain[0].Raw)
+		localKeyID, err := asn1.Marshal(sum[:])
+		if err != nil {
+			return nil, errors.Wrap(err, "error marshaling pkcs12 attribute")
+		}
+		leafAttrs = append(leafAttrs, pkcs12Attribute{ID: oidLocalKeyID, Value: pkcs12Set(localKeyID)})
+		keyBag, err := pkcs12NewKeyBag(key, bmpPassword, leafAttrs...)
+		if err != nil {
+			return nil, err
+		}
+		keyBags = append(keyBags, keyBag)
+	}
+	for i, crt := range certChain {
+		var attrs []pkcs12Attribute
+		if i == 0 {
+			attrs = leafAttrs
+		}
+		bag, err := pkcs12NewCertBag(crt, attrs...)
+		if err != nil {
+			return nil, err
+		}
+		certBags = append(certBags, bag)
+	}
+	// The certificates and the key are in different safes, the layout used
+	// by most implementations.
+	if len(keyBags) == 0 {
+		return marshalPKCS12(bmpPassword, certBags)
+	}
+	return marshalPKCS12(bmpPassword, certBags, keyBags)
+}
+
+// pkcs12NewCertBag returns a certificate bag with the given certificate, its
+// SHA-256 fingerprint as friendly name, and the given attributes.
+func pkcs12NewCertBag(crt *x509.Certificate, attrs ...pkcs12Attribute) (pkcs12SafeBag, error) {
+	certBag, err := asn1.Marshal(pkcs12CertBag{ID: oidX509Certificate, Data: crt.Raw})
+	if err != nil {
+		return pkcs12SafeBag{}, errors.Wrap(err, "error marshaling pkcs12 cert bag")
+	}
+	name, err := bmpString(trustStoreAlias(crt))
+	if err != nil {
+		return pkcs12SafeBag{}, err
+	}
+	friendlyName, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagBMPString, Bytes: name[:len(name)-2]})
+	if err != nil {
+		return pkcs12SafeBag{}, errors.Wrap(err, "error marshaling pkcs12 attribute")
+	}
+	return pkcs12SafeBag{
+		ID: oidCertBag,
+		Value: asn1.RawValue{
+			Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certBag,
+		},
+		Attributes: append([]pkcs12Attribute{{ID: oidFriendlyName, Value: pkcs12Set(friendlyName)}}, attrs...),
+	}, nil
+}
+
+// pkcs12NewKeyBag returns a shrouded key bag with the given key encrypted with
+// the given BMPString password, and the given attributes.
+func pkcs12NewKeyBag(key crypto.PrivateKey, bmpPassword []byte, attrs ...pkcs12Attribute) (pkcs12SafeBag, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return pkcs12SafeBag{}, errors.Wrap(err, "error marshaling private key")
+	}
+	salt := make([]byte, 8)
+	if _, err := rand.Read(salt); err != nil {
+		return pkcs12SafeBag{}, errors.Wrap(err, "error generating pkcs12 salt")
+	}
+	params, err := asn1.Marshal(pkcs12PBEParams{Salt: salt, Iterations: pkcs12Iterations})
+	if err != nil {
+		return pkcs12SafeBag{}, errors.Wrap(err, "error marshaling pkcs12 parameters")
+	}
+
+	block, err := des.NewTripleDESCipher(pkcs12KDF(salt, bmpPassword, pkcs12Iterations, 1, 24))
+	if err != nil {
+		return pkcs12SafeBag{}, errors.Wrap(err, "error creating pkcs12 cipher")
+	}
+	// PKCS#7 padding.
+	n := block.BlockSize() - len(der)%block.BlockSize()
+	for i := 0; i < n; i++ {
+		der = append(der, byte(n))
+	}
+	iv := pkcs12KDF(salt, bmpPassword, pkcs12Iterations, 2, block.BlockSize())
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(der, der)
+
+	keyBag, err := asn1.Marshal(pkcs8EncryptedPrivateKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPBEWithSHAAnd3KeyTDES,
+			Parameters: asn1.RawValue{FullBytes: params},
+		},
+		EncryptedData: der,
+	})
+	if err != nil {
+		return pkcs12SafeBag{}, errors.Wrap(err, "error marshaling pkcs12 key bag")
+	}
+	return pkcs12SafeBag{
+		ID: oidPKCS8ShroudedKeyBag,
+		Value: asn1.RawValue{
+			Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: keyBag,
+		},
+		Attributes: attrs,
+	}, nil
+}
+
+// marshalPKCS12 returns a PKCS#12 with a safe for each list of bags,
+// protected with a MAC derived from the given BMPString password.
+func marshalPKCS12(bmpPassword []byte, safes ...[]pkcs12SafeBag) ([]byte, error) {
+	contents := make([]pkcs7ContentInfo, len(safes))
+	for i, bags := range safes {
+		safeContents, err := asn1.Marshal(bags)
+		if err != nil {
+			return nil, errors.Wrap(err, "error marshaling pkcs12 safe contents")
+		}
+		contents[i] = pkcs12Data(safeContents)
+	}
+	authSafe, err := asn1.Marshal(contents)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling pkcs12 authenticated safe")
+	}
+
+	salt := make([]byte, 8)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, errors.Wrap(err, "error generating pkcs12 salt")
+	}
+	key := pkcs12KDF(salt, bmpPassword, pkcs12Iterations, 3, sha1.Size)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(authSafe)
+
+	b, err := asn1.Marshal(pfxPDU{
+		Version:  3,
+		AuthSafe: pkcs12Data(authSafe),
+		MacData: pkcs12MacData{
+			Mac: pkcs12DigestInfo{
+				Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue},
+				Digest:    mac.Sum(nil),
+			},
+			MacSalt:    salt,
+			Iterations: pkcs12Iterations,
+		},
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling pkcs12")
+	}
+	return b, nil
+}
+
+// pkcs12Data returns a PKCS#7 data content info with the given content.
+func pkcs12Data(content []byte) pkcs7ContentInfo {
+	b, _ := asn1.Marshal(content)
+	return pkcs7ContentInfo{
+		ContentType: oidData,
+		Content: asn1.RawValue{
+			Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b,
+		},
+	}
+}
+
+// pkcs12Set returns a SET with the given DER encoded value.
+func pkcs12Set(value []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: value}
+}
+
+// bmpString returns the password encoded as a null terminated BMPString, as
+// required by the PKCS#12 key derivation.
+func bmpString(s string) ([]byte, error) {
+	b := make([]byte, 0, 2*len(s)+2)
+	for _, r := range s {
+		if r > 0xFFFF || utf16.IsSurrogate(r) {
+			return nil, errors.Errorf("character %q cannot be encoded in a pkcs12 password", r)
+		}
+		b = append(b, byte(r>>8), byte(r))
+	}
+	return append(b, 0, 0), nil
+}
+
+// pkcs12KDF derives size bytes with SHA-1 from the given salt and BMPString
+// password, for the given purpose: 1 for keys, 2 for IVs and 3 for MAC keys
+// (RFC 7292, appendix B.2).
+func pkcs12KDF(salt, password []byte, iterations int, id byte, size int) []byte {
+	const u, v = sha1.Size, 64
+	fill := func(b []byte) []byte {
+		if len(b) == 0 {
+			return nil
+		}
+		out := make([]byte, v*((len(b)+v-1)/v))
+		for i := range out {
+			out[i] = b[i%len(b)]
+		}
+		return out
+	}
+	d := make([]byte, v)
+	for i := range d {
+		d[i] = id
+	}
+	I := append(fill(salt), fill(password)...)
+
+	one := big.NewInt(1)
+	key := make([]byte, 0, size+u)
+	for len(key) < size {
+		h := sha1.Sum(append(d, I...))
+		a := h[:]
+		for j := 1; j < iterations; j++ {
+			h = sha1.Sum(a)
+			a = h[:]
+		}
+		key = append(key, a...)
+		if len(key) >= size {
+			break
+		}
+		// I_j = (I_j + B + 1) mod 2^v for each v-bit block of I.
+		b := new(big.Int).SetBytes(fill(a))
+		for j := 0; j < len(I); j += v {
+			ij := new(big.Int).SetBytes(I[j : j+v])
+			ij.Add(ij, b).Add(ij, one)
+			sum := ij.Bytes()
+			if len(sum) > v {
+				sum = sum[len(sum)-v:]
+			}
+			block := I[j : j+v]
+			for k := range block {
+				block[k] = 0
+			}
+			copy(block[v-len(sum):], sum)
+		}
+	}
+	return key[:size]
+}
+
+// trustStoreAlias returns the name of a certificate in the trust stores, the
+// hex encoded SHA-256 fingerprint.
+func trustStoreAlias(crt *x509.Certificate) string {
+	sum := sha256.Sum256(crt.Raw)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,285 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/pkg/errors"
+)
+
+// maxRateLimitBody is the maximum number of bytes of the body read to find the
+// provisioner of a request.
+const maxRateLimitBody = 1 << 20
+
+// sweepInterval is the minimum interval between the removals of the idle
+// buckets.
+const sweepInterval = time.Minute
+
+// RateLimitAuthority is the interface implemented by a CA authority that
+// limits the rate of the requests.
+type RateLimitAuthority interface {
+	GetRateLimitConfig() *authority.RateLimitConfig
+	LoadProvisionerByToken(ott string) (provisioner.Interface, error)
+}
+
+// RateLimitStatsResponse is the response object of the rate limit stats
+// request. Limited is the number of requests rejected by each of the limits:
+// ip, provisioner and endpoint.
+type RateLimitStatsResponse struct {
+	Limited map[string]uint64 `json:"limited"`
+}
+
+// RateLimitStats is an HTTP handler that returns the number of requests
+// rejected by the rate limits since the CA started.
+func (h *caHandler) RateLimitStats(w http.ResponseWriter, r *http.Request) {
+	res := &RateLimitStatsResponse{Limited: map[string]uint64{}}
+	if l := h.limiter; l != nil {
+		res.Limited["ip"] = atomic.LoadUint64(&l.limitedIP)
+		res.Limited["provisioner"] = atomic.LoadUint64(&l.limitedProvisioner)
+		res.Limited["endpoint"] = atomic.LoadUint64(&l.limitedEndpoint)
+	}
+	JSON(w, res)
+}
+
+// rateLimiter is the middleware that applies the configured rate limits to
+// the requests.
+type rateLimiter struct {
+	auth               Authority
+	perIP              *limiter
+	perProvisioner     *limiter
+	endpoints          map[string]*limiter
+	limitedIP          uint64
+	limitedProvisioner uint64
+	limitedEndpoint    uint64
+}
+
+// newRateLimiter returns the rate limiter for the configuration of the given
+// authority. It returns nil if rate limiting is not configured.
+func newRateLimiter(auth Authority) *rateLimiter {
+	if auth == nil {
+		return nil
+	}
+	config := auth.GetRateLimitConfig()
+	if config == nil {
+		return nil
+	}
+	l := &rateLimiter{
+		auth:           auth,
+		perIP:          newLimiter(config.PerIP),
+		perProvisioner: newLimiter(config.PerProvisioner),
+		endpoints:      make(map[string]*limiter),
+	}
+	for pattern, rl := range config.Endpoints {
+		l.endpoints[pattern] = newLimiter(rl)
+	}
+	return l
+}
+
+// middleware returns a handler that applies the rate limits to the requests
+// to the given pattern. The per client IP and per endpoint limits are charged
+// on every request. The per provisioner limit is checked before the request,
+// but it is charged only if the request succeeds, so requests with a forged
+// token cannot exhaust the limit of a provisioner.
+func (l *rateLimiter) middleware(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	el := l.endpoints[pattern]
+	return func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		if ok, retry := l.perIP.allow(clientIP(r), now); !ok {
+			atomic.AddUint64(&l.limitedIP, 1)
+			writeRateLimited(w, "ip", retry)
+			return
+		}
+		if ok, retry := el.allow(pattern, now); !ok {
+			atomic.AddUint64(&l.limitedEndpoint, 1)
+			writeRateLimited(w, "endpoint", retry)
+			return
+		}
+
+		var key string
+		if l.perProvisioner != nil {
+			key = l.provisionerKey(r)
+			if ok, retry := l.perProvisioner.check(key, now); !ok {
+				atomic.AddUint64(&l.limitedProvisioner, 1)
+				writeRateLimited(w, "provisioner", retry)
+				return
+			}
+		}
+
+		next(w, r)
+
+		if key != "" {
+			if rl, ok := w.(logging.ResponseLogger); !ok || rl.StatusCode() < http.StatusBadRequest {
+				l.perProvisioner.consume(key, time.Now())
+			}
+		}
+	}
+}
+
+// provisionerKey returns the id of the provisioner of the request, using the
+// client certificate or the token in the body. It returns an empty string if
+// the provisioner cannot be found.
+func (l *rateLimiter) provisionerKey(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		if p, err := l.auth.LoadProvisionerByCertificate(r.TLS.PeerCertificates[0]); err == nil {
+			return p.GetID()
+		}
+	}
+	if r.Method != "POST" || r.Body == nil {
+		return ""
+	}
+
+	// Read the beginning of the body and restore it for the handler.
+	b, err := ioutil.ReadAll(io.LimitReader(r.Body, maxRateLimitBody))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(b), r.Body), r.Body}
+	if err != nil {
+		return ""
+	}
+	var body struct {
+		OTT string `json:"ott"`
+	}
+	if err := json.Unmarshal(b, &body); err != nil || body.OTT == "" {
+		return ""
+	}
+	p, err := l.auth.LoadProvisionerByToken(body.OTT)
+	if err != nil {
+		return ""
+	}
+	return p.GetID()
+}
+
+// writeRateLimited writes a 429 Too Many Requests error with the Retry-After
+// header.
+func writeRateLimited(w http.ResponseWriter, scope string, retry time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.Seconds()))))
+	if rl, ok := w.(logging.ResponseLogger); ok {
+		rl.WithFields(map[string]interface{}{
+			"rate-limit": scope,
+		})
+	}
+	WriteError(w, TooManyRequests(errors.Errorf("rate limit per %s exceeded", scope)))
+}
+
+// clientIP returns the IP address of the client of the request.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// bucket is a token bucket.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// limiter implements a token bucket rate limit per key. The methods of a nil
+// limiter allow all the requests.
+type limiter struct {
+	rate      float64
+	burst     float64
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func newLimiter(rl *authority.RateLimit) *limiter {
+	if rl == nil {
+		return nil
+	}
+	return &limiter{
+		rate:    rl.Rate,
+		burst:   float64(rl.Burst),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// allow takes a token from the bucket of the given key. If the bucket is empty
+// it returns false and the time until a new token is available.
+func (l *limiter) allow(key string, now time.Time) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.get(key, now)
+	if b.tokens < 1 {
+		return false, l.wait(b)
+	}
+	b.tokens--
+	return true, 0
+}
+
+// check is like allow, but it does not take the token.
+func (l *limiter) check(key string, now time.Time) (bool, time.Duration) {
+	if l == nil || key == "" {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.get(key, now)
+	if b.tokens < 1 {
+		return false, l.wait(b)
+	}
+	return true, 0
+}
+
+// consume takes a token from the bucket of the given key even if it is empty.
+func (l *limiter) consume(key string, now time.Time) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.get(key, now).tokens--
+	l.mu.Unlock()
+}
+
+// get returns the refilled bucket of the given key. It must be called with
+// the lock held.
+func (l *limiter) get(key string, now time.Time) *bucket {
+	if now.Sub(l.lastSweep) > sweepInterval {
+		l.sweep(now)
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+		return b
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+elapsed.Seconds()*l.rate)
+		b.last = now
+	}
+	return b
+}
+
+// wait returns the time until the given bucket has a token.
+func (l *limiter) wait(b *bucket) time.Duration {
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// sweep removes the buckets that would be full, they are equivalent to new
+// ones. It must be called with the lock held.
+func (l *limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
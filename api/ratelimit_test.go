@@ -0,0 +1,168 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/smallstep/assert"
+)
+
+type testRouter map[string]http.HandlerFunc
+
+func (r testRouter) MethodFunc(method, pattern string, h http.HandlerFunc) {
+	r[method+" "+pattern] = h
+}
+
+func Test_limiter(t *testing.T) {
+	now := time.Now()
+	l := newLimiter(&authority.RateLimit{Rate: 2, Burst: 2})
+
+	ok, _ := l.allow("foo", now)
+	assert.True(t, ok)
+	ok, _ = l.allow("foo", now)
+	assert.True(t, ok)
+	ok, retry := l.allow("foo", now)
+	assert.False(t, ok)
+	assert.Equals(t, 500*time.Millisecond, retry)
+
+	// Other keys use other buckets.
+	ok, _ = l.allow("bar", now)
+	assert.True(t, ok)
+
+	// Refill
+	ok, _ = l.allow("foo", now.Add(500*time.Millisecond))
+	assert.True(t, ok)
+	ok, _ = l.allow("foo", now.Add(500*time.Millisecond))
+	assert.False(t, ok)
+
+	// Check and consume
+	now = now.Add(time.Second)
+	ok, _ = l.check("foo", now)
+	assert.True(t, ok)
+	l.consume("foo", now)
+	l.consume("foo", now)
+	l.consume("foo", now)
+	ok, retry = l.check("foo", now)
+	assert.False(t, ok)
+	assert.Equals(t, 1500*time.Millisecond, retry)
+
+	// Sweep the idle buckets
+	l.allow("foo", now.Add(2*sweepInterval))
+	assert.Len(t, 1, l.buckets)
+
+	// A nil limiter allows everything.
+	var nl *limiter
+	ok, _ = nl.allow("foo", now)
+	assert.True(t, ok)
+	ok, _ = nl.check("foo", now)
+	assert.True(t, ok)
+	nl.consume("foo", now)
+}
+
+func Test_caHandler_rateLimit(t *testing.T) {
+	crt := parseCertificate(certPEM)
+	prov := &mockProvisioner{getID: func() string { return "prov" }}
+	config := &authority.RateLimitConfig{
+		PerIP:          &authority.RateLimit{Rate: 0.1, Burst: 3},
+		PerProvisioner: &authority.RateLimit{Rate: 0.1, Burst: 1},
+		Endpoints: map[string]*authority.RateLimit{
+			"/health": {Rate: 0.1, Burst: 1},
+		},
+	}
+	newHandler := func() (*caHandler, testRouter) {
+		h := New(&mockAuthority{
+			getRateLimitConfig: func() *authority.RateLimitConfig {
+				return config
+			},
+			loadProvisionerByToken: func(ott string) (provisioner.Interface, error) {
+				assert.Equals(t, "the-token", ott)
+				return prov, nil
+			},
+			loadProvisionerByCertificate: func(cert *x509.Certificate) (provisioner.Interface, error) {
+				return prov, nil
+			},
+		}).(*caHandler)
+		r := testRouter{}
+		h.Route(r)
+		return h, r
+	}
+	do := func(h http.HandlerFunc, method, remoteAddr, body string, peer bool) *http.Response {
+		req := httptest.NewRequest(method, "http://example.com/", strings.NewReader(body))
+		req.RemoteAddr = remoteAddr
+		if peer {
+			req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{crt}}
+		}
+		w := httptest.NewRecorder()
+		h(logging.NewResponseLogger(w), req)
+		return w.Result()
+	}
+
+	t.Run("ip", func(t *testing.T) {
+		_, r := newHandler()
+		for i := 0; i < 3; i++ {
+			assert.Equals(t, http.StatusOK, do(r["GET /versions"], "GET", "10.0.0.1:1000", "", false).StatusCode)
+		}
+		res := do(r["GET /versions"], "GET", "10.0.0.1:1001", "", false)
+		assert.Equals(t, http.StatusTooManyRequests, res.StatusCode)
+		assert.Equals(t, "10", res.Header.Get("Retry-After"))
+		body, err := ioutil.ReadAll(res.Body)
+		assert.FatalError(t, err)
+		assert.Equals(t, "{\"status\":429,\"code\":\"request.rateLimited\",\"message\":\"Too Many Requests\"}\n", string(body))
+		// Other clients are not limited
+		assert.Equals(t, http.StatusOK, do(r["GET /versions"], "GET", "10.0.0.2:1000", "", false).StatusCode)
+	})
+
+	t.Run("endpoint", func(t *testing.T) {
+		_, r := newHandler()
+		assert.Equals(t, http.StatusOK, do(r["GET /health"], "GET", "10.0.0.1:1000", "", false).StatusCode)
+		assert.Equals(t, http.StatusTooManyRequests, do(r["GET /health"], "GET", "10.0.0.2:1000", "", false).StatusCode)
+		assert.Equals(t, http.StatusOK, do(r["GET /versions"], "GET", "10.0.0.2:1000", "", false).StatusCode)
+	})
+
+	t.Run("provisioner", func(t *testing.T) {
+		h, r := newHandler()
+		var bodies []string
+		r["POST /test"] = h.limiter.middleware("/test", func(w http.ResponseWriter, r *http.Request) {
+			b, err := ioutil.ReadAll(r.Body)
+			assert.FatalError(t, err)
+			bodies = append(bodies, string(b))
+			if strings.Contains(string(b), "fail") {
+				WriteError(w, Unauthorized(fmt.Errorf("an error")))
+				return
+			}
+			JSON(w, HealthResponse{Status: "ok"})
+		})
+		// Failed requests are not charged.
+		assert.Equals(t, http.StatusUnauthorized, do(r["POST /test"], "POST", "10.0.0.1:1000", `{"ott":"the-token","fail":true}`, false).StatusCode)
+		assert.Equals(t, http.StatusOK, do(r["POST /test"], "POST", "10.0.0.2:1000", `{"ott":"the-token"}`, false).StatusCode)
+		assert.Equals(t, http.StatusTooManyRequests, do(r["POST /test"], "POST", "10.0.0.3:1000", `{"ott":"the-token"}`, false).StatusCode)
+		assert.Equals(t, http.StatusTooManyRequests, do(r["POST /test"], "POST", "10.0.0.3:1000", "", true).StatusCode)
+		// Requests without provisioner are not limited by provisioner.
+		assert.Equals(t, http.StatusOK, do(r["POST /test"], "POST", "10.0.0.3:1000", `{}`, false).StatusCode)
+		assert.Equals(t, []string{`{"ott":"the-token","fail":true}`, `{"ott":"the-token"}`, `{}`}, bodies)
+
+		w := httptest.NewRecorder()
+		h.RateLimitStats(w, httptest.NewRequest("GET", "http://example.com/admin/ratelimit", nil))
+		assert.Equals(t, "{\"limited\":{\"endpoint\":0,\"ip\":0,\"provisioner\":2}}\n", w.Body.String())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		h := New(&mockAuthority{}).(*caHandler)
+		assert.Nil(t, h.limiter)
+		r := testRouter{}
+		h.Route(r)
+		for i := 0; i < 10; i++ {
+			assert.Equals(t, http.StatusOK, do(r["GET /versions"], "GET", "10.0.0.1:1000", "", false).StatusCode)
+		}
+	})
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/RTradeLtd/ca-certificates/db"
+)
+
+// RetentionAuthority is the interface implemented by a CA authority that
+// prunes the expired records of the database.
+type RetentionAuthority interface {
+	GetRetentionStats() []*db.PrunerStats
+}
+
+// RetentionStatsResponse is the response object of the retention stats
+// request.
+type RetentionStatsResponse struct {
+	Pruners []*db.PrunerStats `json:"pruners"`
+}
+
+// RetentionStats is an HTTP handler that returns the number of records and
+// bytes deleted by the garbage collector of the database since the CA
+// started.
+func (h *caHandler) RetentionStats(w http.ResponseWriter, r *http.Request) {
+	JSON(w, &RetentionStatsResponse{Pruners: h.Authority.GetRetentionStats()})
+}
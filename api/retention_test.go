@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/smallstep/assert"
+)
+
+func Test_caHandler_RetentionStats(t *testing.T) {
+	lastRun := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		stats    []*db.PrunerStats
+		expected string
+	}{
+		{"ok", []*db.PrunerStats{
+			{Name: "certificates", Retention: "720h0m0s", Runs: 2, Records: 10, Bytes: 4096, LastRun: &lastRun},
+			{Name: "tokens", Retention: "0s", Runs: 2, LastRun: &lastRun, LastError: "force"},
+		}, `{"pruners":[{"name":"certificates","retention":"720h0m0s","runs":2,"records":10,"bytes":4096,"lastRun":"2019-10-01T00:00:00Z"},` +
+			`{"name":"tokens","retention":"0s","runs":2,"records":0,"bytes":0,"lastRun":"2019-10-01T00:00:00Z","lastError":"force"}]}`},
+		{"ok-disabled", []*db.PrunerStats{}, `{"pruners":[]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				getRetentionStats: func() []*db.PrunerStats {
+					return tt.stats
+				},
+			}).(*caHandler)
+			w := httptest.NewRecorder()
+			h.RetentionStats(w, httptest.NewRequest("GET", "http://example.com/admin/retention", nil))
+			assert.Equals(t, http.StatusOK, w.Code)
+			assert.Equals(t, tt.expected+"\n", w.Body.String())
+		})
+	}
+}
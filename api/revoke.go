@@ -43,7 +43,7 @@ func (r *RevokeRequest) Validate() (err error) {
 //
 // NOTE: currently only Passive revocation is supported.
 //
-// TODO: Add CRL and OCSP support.
+// TODO: Add OCSP support.
 func (h *caHandler) Revoke(w http.ResponseWriter, r *http.Request) {
 	var body RevokeRequest
 	if err := ReadJSON(r.Body, &body); err != nil {
@@ -81,7 +81,7 @@ func (h *caHandler) Revoke(w http.ResponseWriter, r *http.Request) {
 		opts.MTLS = true
 	}
 
-	if err := h.Authority.Revoke(opts); err != nil {
+	if err := h.Authority.Revoke(r.Context(), opts); err != nil {
 		WriteError(w, Forbidden(err))
 		return
 	}
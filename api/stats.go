@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/pkg/errors"
+)
+
+// StatsResponse is the response object of the stats request.
+type StatsResponse struct {
+	Stats []*authority.ProvisionerStats `json:"stats"`
+}
+
+// Stats is an HTTP handler that returns the number of certificates issued,
+// renewed and revoked per provisioner and day. The from and to query
+// parameters limit the days returned, they accept an RFC 3339 time or a
+// duration relative to the current time, e.g. -168h.
+func (h *caHandler) Stats(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var from, to time.Time
+	for key, t := range map[string]*time.Time{
+		"from": &from,
+		"to":   &to,
+	} {
+		if v := q.Get(key); v != "" {
+			td, err := ParseTimeDuration(v)
+			if err != nil {
+				WriteError(w, BadRequest(errors.Wrapf(err, "error parsing %s", key)))
+				return
+			}
+			*t = td.Time()
+		}
+	}
+
+	stats, err := h.Authority.GetStats(from, to)
+	if err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+	JSON(w, &StatsResponse{Stats: stats})
+}
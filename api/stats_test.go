@@ -0,0 +1,62 @@
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/smallstep/assert"
+)
+
+func Test_caHandler_Stats(t *testing.T) {
+	from, err := time.Parse(time.RFC3339, "2019-10-01T00:00:00Z")
+	assert.FatalError(t, err)
+	stats := []*authority.ProvisionerStats{
+		{Day: "2019-10-01", Provisioner: "step-cli", Issued: 3, Renewed: 2, Revoked: 1},
+	}
+
+	tests := []struct {
+		name       string
+		query      string
+		from, to   time.Time
+		err        error
+		statusCode int
+		expected   string
+	}{
+		{"ok", "", time.Time{}, time.Time{}, nil, http.StatusOK,
+			`{"stats":[{"day":"2019-10-01","provisioner":"step-cli","issued":3,"renewed":2,"revoked":1}]}`},
+		{"ok-range", "?from=2019-10-01T00:00:00Z&to=2019-10-01T00:00:00Z", from, from, nil, http.StatusOK, ""},
+		{"fail-from", "?from=foo", time.Time{}, time.Time{}, nil, http.StatusBadRequest, ""},
+		{"fail-to", "?to=foo", time.Time{}, time.Time{}, nil, http.StatusBadRequest, ""},
+		{"fail", "", time.Time{}, time.Time{}, fmt.Errorf("an error"), http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				getStats: func(from, to time.Time) ([]*authority.ProvisionerStats, error) {
+					assert.Equals(t, tt.from, from)
+					assert.Equals(t, tt.to, to)
+					return stats, tt.err
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("GET", "http://example.com/stats"+tt.query, nil)
+			w := httptest.NewRecorder()
+			h.Stats(logging.NewResponseLogger(w), req)
+			res := w.Result()
+
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			body, err := ioutil.ReadAll(res.Body)
+			res.Body.Close()
+			assert.FatalError(t, err)
+			if tt.expected != "" {
+				assert.Equals(t, tt.expected, strings.TrimSpace(string(body)))
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+)
+
+// streamThreshold is the number of certificates from which the bundles are
+// streamed instead of encoded in memory. Streamed responses do not have an
+// ETag.
+var streamThreshold = 1000
+
+// streamFlushSize is the number of elements written between flushes of a
+// streamed response.
+const streamFlushSize = 100
+
+// jsonField is a field written after the array of a jsonStream.
+type jsonField struct {
+	Name  string
+	Value interface{}
+}
+
+// jsonStream writes a JSON object with an array field element by element, so
+// the response is never encoded in memory. The output is the same as the one
+// of json.Encoder with a struct with the array and the extra fields.
+type jsonStream struct {
+	w       io.Writer
+	flusher http.Flusher
+	n       int
+	err     error
+}
+
+// newJSONStream writes the headers of the response and the beginning of the
+// object with the given array field.
+func newJSONStream(w http.ResponseWriter, status int, field string) *jsonStream {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	s := &jsonStream{w: w}
+	s.flusher, _ = w.(http.Flusher)
+	s.writeString(`{`)
+	s.writeJSON(field)
+	s.writeString(`:[`)
+	return s
+}
+
+// Encode writes an element of the array.
+func (s *jsonStream) Encode(v interface{}) error {
+	if s.n > 0 {
+		s.writeString(",")
+	}
+	s.writeJSON(v)
+	s.n++
+	if s.n%streamFlushSize == 0 && s.flusher != nil && s.err == nil {
+		s.flusher.Flush()
+	}
+	return s.err
+}
+
+// Close ends the array and writes the given fields.
+func (s *jsonStream) Close(fields ...jsonField) error {
+	s.writeString("]")
+	for _, f := range fields {
+		s.writeString(",")
+		s.writeJSON(f.Name)
+		s.writeString(":")
+		s.writeJSON(f.Value)
+	}
+	s.writeString("}\n")
+	return s.err
+}
+
+func (s *jsonStream) writeJSON(v interface{}) {
+	if s.err != nil {
+		return
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		s.err = err
+		return
+	}
+	_, s.err = s.w.Write(b)
+}
+
+func (s *jsonStream) writeString(v string) {
+	if s.err == nil {
+		_, s.err = io.WriteString(s.w, v)
+	}
+}
+
+// streamCertificates writes the given certificates as a JSON object with the
+// crts field, like RootsResponse and FederationResponse.
+func streamCertificates(w http.ResponseWriter, certs []*x509.Certificate, status int) {
+	s := newJSONStream(w, status, "crts")
+	for _, crt := range certs {
+		if err := s.Encode(Certificate{crt}); err != nil {
+			LogError(w, err)
+			return
+		}
+	}
+	if err := s.Close(); err != nil {
+		LogError(w, err)
+	}
+}
+
+// streamPEM writes the given certificates in PEM format.
+func streamPEM(w http.ResponseWriter, certs []*x509.Certificate, status int) {
+	w.Header().Set("Content-Type", PEMContentType)
+	w.WriteHeader(status)
+	flusher, _ := w.(http.Flusher)
+	for i, crt := range certs {
+		if err := pem.Encode(w, &pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: crt.Raw,
+		}); err != nil {
+			LogError(w, err)
+			return
+		}
+		if flusher != nil && (i+1)%streamFlushSize == 0 {
+			flusher.Flush()
+		}
+	}
+}
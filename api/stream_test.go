@@ -0,0 +1,95 @@
+package api
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func Test_jsonStream(t *testing.T) {
+	root := parseCertificate(rootPEM)
+	federated := parseCertificate(certPEM)
+	tests := []struct {
+		name   string
+		certs  []*x509.Certificate
+		fields []jsonField
+		want   interface{}
+	}{
+		{"empty", []*x509.Certificate{}, nil, &FederationResponse{Certificates: []Certificate{}}},
+		{"one", []*x509.Certificate{root}, nil, &FederationResponse{Certificates: []Certificate{{root}}}},
+		{"fields", []*x509.Certificate{root, federated}, []jsonField{{"nextCursor", "foo"}}, &RootsResponse{
+			Certificates: []Certificate{{root}, {federated}},
+			NextCursor:   "foo",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s := newJSONStream(w, http.StatusCreated, "crts")
+			for _, crt := range tt.certs {
+				assert.FatalError(t, s.Encode(Certificate{crt}))
+			}
+			assert.FatalError(t, s.Close(tt.fields...))
+
+			var want bytes.Buffer
+			assert.FatalError(t, json.NewEncoder(&want).Encode(tt.want))
+			assert.Equals(t, http.StatusCreated, w.Code)
+			assert.Equals(t, "application/json", w.Header().Get("Content-Type"))
+			assert.Equals(t, want.String(), w.Body.String())
+		})
+	}
+
+	// Encoding errors are returned
+	s := newJSONStream(httptest.NewRecorder(), http.StatusOK, "crts")
+	assert.NotNil(t, s.Encode(make(chan int)))
+	assert.NotNil(t, s.Close())
+}
+
+func Test_caHandler_stream(t *testing.T) {
+	defer func(n int) { streamThreshold = n }(streamThreshold)
+	streamThreshold = 1
+
+	root := parseCertificate(rootPEM)
+	federated := parseCertificate(certPEM)
+	certs := []*x509.Certificate{root, federated}
+	h := New(&mockAuthority{
+		getRoots: func() ([]*x509.Certificate, error) {
+			return certs, nil
+		},
+		getFederation: func() ([]*x509.Certificate, error) {
+			return certs, nil
+		},
+	}).(*caHandler)
+
+	var want bytes.Buffer
+	assert.FatalError(t, json.NewEncoder(&want).Encode(&FederationResponse{
+		Certificates: []Certificate{{root}, {federated}},
+	}))
+	for _, handler := range []http.HandlerFunc{h.Roots, h.Federation} {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", "http://example.com/", nil))
+		assert.Equals(t, http.StatusCreated, w.Code)
+		assert.Equals(t, "", w.Header().Get("ETag"))
+		assert.Equals(t, want.String(), w.Body.String())
+	}
+
+	// Paginated responses are not streamed
+	w := httptest.NewRecorder()
+	h.Federation(w, httptest.NewRequest("GET", "http://example.com/?limit=1", nil))
+	assert.Equals(t, http.StatusCreated, w.Code)
+	assert.NotEquals(t, "", w.Header().Get("ETag"))
+
+	w = httptest.NewRecorder()
+	h.RootsPEM(w, httptest.NewRequest("GET", "http://example.com/roots.pem", nil))
+	assert.Equals(t, http.StatusOK, w.Code)
+	assert.Equals(t, PEMContentType, w.Header().Get("Content-Type"))
+	assert.Equals(t, "", w.Header().Get("ETag"))
+	assert.Equals(t, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.Raw}))+
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: federated.Raw})), w.Body.String())
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/pkg/errors"
+)
+
+// TimeoutAuthority is the interface implemented by a CA authority that
+// configures the timeouts of the requests.
+type TimeoutAuthority interface {
+	GetTimeouts() *authority.TimeoutConfig
+}
+
+// TimeoutError is the error returned when a request does not finish before
+// the timeout of the endpoint. It is returned with the status 503 Service
+// Unavailable.
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+// Error implements the error interface.
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("request timed out after %s", e.Timeout)
+}
+
+// StatusCode implements the StatusCoder interface.
+func (e *TimeoutError) StatusCode() int {
+	return http.StatusServiceUnavailable
+}
+
+// ErrorCode implements the ErrorCoder interface.
+func (e *TimeoutError) ErrorCode() string {
+	return ErrCodeTimeout
+}
+
+// ErrorDetails implements the ErrorDetailer interface.
+func (e *TimeoutError) ErrorDetails() map[string]interface{} {
+	return map[string]interface{}{"timeout": e.Timeout.String()}
+}
+
+// timeout is a middleware that limits the time to handle the requests to the
+// given pattern. The context of the request is canceled after the timeout, and
+// if the handler has not finished the response is a TimeoutError, the output
+// of the handler is discarded.
+func (h *caHandler) timeout(pattern string, next http.HandlerFunc) http.HandlerFunc {
+	d := h.Authority.GetTimeouts().Timeout(pattern)
+	if d <= 0 {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+
+		tw := &timeoutWriter{header: make(http.Header)}
+		done := make(chan struct{})
+		panicCh := make(chan interface{}, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicCh <- p
+				}
+			}()
+			next(tw, r.WithContext(ctx))
+			close(done)
+		}()
+
+		select {
+		case p := <-panicCh:
+			panic(p)
+		case <-done:
+			tw.writeTo(w)
+		case <-ctx.Done():
+			tw.discard()
+			// The client has gone away.
+			if r.Context().Err() != nil {
+				WriteError(w, NewError(http.StatusServiceUnavailable, errors.Wrap(ctx.Err(), "request canceled")))
+				return
+			}
+			if rl, ok := w.(logging.ResponseLogger); ok {
+				rl.WithFields(map[string]interface{}{
+					"timeout": d.String(),
+				})
+			}
+			WriteError(w, NewError(http.StatusServiceUnavailable, &TimeoutError{Timeout: d}))
+		}
+	}
+}
+
+// timeoutWriter is the logging.ResponseLogger used by the handlers with a
+// timeout. It buffers the response until the handler finishes.
+type timeoutWriter struct {
+	header      http.Header
+	mu          sync.Mutex
+	buf         bytes.Buffer
+	code        int
+	wroteHeader bool
+	timedOut    bool
+	fields      map[string]interface{}
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeader(http.StatusOK)
+	}
+	return tw.buf.Write(p)
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.writeHeader(code)
+}
+
+func (tw *timeoutWriter) writeHeader(code int) {
+	tw.wroteHeader = true
+	tw.code = code
+}
+
+func (tw *timeoutWriter) Size() int {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.buf.Len()
+}
+
+func (tw *timeoutWriter) StatusCode() int {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if !tw.wroteHeader {
+		return http.StatusOK
+	}
+	return tw.code
+}
+
+func (tw *timeoutWriter) Fields() map[string]interface{} {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	return tw.fields
+}
+
+func (tw *timeoutWriter) WithFields(fields map[string]interface{}) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.fields == nil {
+		tw.fields = make(map[string]interface{})
+	}
+	for k, v := range fields {
+		tw.fields[k] = v
+	}
+}
+
+// writeTo writes the buffered response and log fields to the given response
+// writer. It must be called after the handler finishes.
+func (tw *timeoutWriter) writeTo(w http.ResponseWriter) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	dst := w.Header()
+	for k, v := range tw.header {
+		dst[k] = v
+	}
+	if rl, ok := w.(logging.ResponseLogger); ok && tw.fields != nil {
+		rl.WithFields(tw.fields)
+	}
+	if !tw.wroteHeader {
+		tw.code = http.StatusOK
+	}
+	w.WriteHeader(tw.code)
+	w.Write(tw.buf.Bytes())
+}
+
+// discard marks the response as timed out, the writes of the handler are
+// ignored from now on.
+func (tw *timeoutWriter) discard() {
+	tw.mu.Lock()
+	tw.timedOut = true
+	tw.mu.Unlock()
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/smallstep/assert"
+)
+
+func Test_caHandler_timeout(t *testing.T) {
+	h := New(&mockAuthority{
+		getTimeouts: func() *authority.TimeoutConfig {
+			return &authority.TimeoutConfig{
+				Endpoints: map[string]*provisioner.Duration{
+					"/test": {Duration: 50 * time.Millisecond},
+				},
+			}
+		},
+	}).(*caHandler)
+
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		statusCode int
+		expected   string
+		fields     map[string]interface{}
+	}{
+		{"ok", func(w http.ResponseWriter, r *http.Request) {
+			w.(logging.ResponseLogger).WithFields(map[string]interface{}{"foo": "bar"})
+			JSONStatus(w, HealthResponse{Status: "ok"}, http.StatusCreated)
+		}, http.StatusCreated, "{\"status\":\"ok\"}\n", map[string]interface{}{"foo": "bar"}},
+		{"fail", func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+			time.Sleep(10 * time.Millisecond)
+			JSON(w, HealthResponse{Status: "ok"})
+		}, http.StatusServiceUnavailable, "{\"status\":503,\"code\":\"server.timeout\",\"message\":\"Service Unavailable\",\"details\":{\"timeout\":\"50ms\"}}\n", map[string]interface{}{"timeout": "50ms"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			rl := logging.NewResponseLogger(w)
+			h.timeout("/test", tt.handler)(rl, httptest.NewRequest("GET", "http://example.com/test", nil))
+			res := w.Result()
+			assert.Equals(t, tt.statusCode, res.StatusCode)
+			assert.Equals(t, "application/json", res.Header.Get("Content-Type"))
+			body, err := ioutil.ReadAll(res.Body)
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.expected, string(body))
+			for k, v := range tt.fields {
+				assert.Equals(t, v, rl.Fields()[k])
+			}
+		})
+	}
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		w := httptest.NewRecorder()
+		h.timeout("/test", func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		})(w, httptest.NewRequest("GET", "http://example.com/test", nil).WithContext(ctx))
+		assert.Equals(t, http.StatusServiceUnavailable, w.Code)
+		assert.Equals(t, "{\"status\":503,\"code\":\"server.unavailable\",\"message\":\"Service Unavailable\"}\n", w.Body.String())
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		defer func() {
+			assert.Equals(t, "foo", recover())
+		}()
+		h.timeout("/test", func(w http.ResponseWriter, r *http.Request) {
+			panic("foo")
+		})(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/test", nil))
+		t.Error("the panic was not propagated")
+	})
+}
@@ -0,0 +1,84 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+)
+
+// TransparencyAuthority is the interface implemented by a CA authority that
+// keeps a transparency log of the issued certificates.
+type TransparencyAuthority interface {
+	GetSignedTreeHead() (*authority.SignedTreeHead, error)
+	GetLogEntries(start, end int64) ([]*db.LogEntry, error)
+	GetInclusionProof(serial string, treeSize int64) (*authority.InclusionProof, error)
+}
+
+// LogEntriesResponse is the response object of the transparency log entries
+// request.
+type LogEntriesResponse struct {
+	Entries []*db.LogEntry `json:"entries"`
+}
+
+// SignedTreeHead is an HTTP handler that returns the current tree head of the
+// transparency log signed by the intermediate certificate.
+func (h *caHandler) SignedTreeHead(w http.ResponseWriter, r *http.Request) {
+	sth, err := h.Authority.GetSignedTreeHead()
+	if err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+	JSON(w, sth)
+}
+
+// LogEntries is an HTTP handler that returns the entries of the transparency
+// log between the start and end query parameters, both included.
+func (h *caHandler) LogEntries(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var start, end int64
+	for key, v := range map[string]*int64{
+		"start": &start,
+		"end":   &end,
+	} {
+		i, err := strconv.ParseInt(q.Get(key), 10, 64)
+		if err != nil {
+			WriteError(w, BadRequest(errors.Wrapf(err, "error parsing %s", key)))
+			return
+		}
+		*v = i
+	}
+
+	entries, err := h.Authority.GetLogEntries(start, end)
+	if err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+	JSON(w, &LogEntriesResponse{Entries: entries})
+}
+
+// InclusionProof is an HTTP handler that returns the proof that the
+// certificate with the given serial number is in the transparency log, and
+// the signed tree head of the proof. The optional treeSize query parameter
+// selects the size of the tree, the current one by default.
+func (h *caHandler) InclusionProof(w http.ResponseWriter, r *http.Request) {
+	var treeSize int64
+	if v := r.URL.Query().Get("treeSize"); v != "" {
+		i, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			WriteError(w, BadRequest(errors.Wrap(err, "error parsing treeSize")))
+			return
+		}
+		treeSize = i
+	}
+
+	proof, err := h.Authority.GetInclusionProof(chi.URLParam(r, "serial"), treeSize)
+	if err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+	JSON(w, proof)
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/go-chi/chi"
+	"github.com/smallstep/assert"
+)
+
+func Test_caHandler_SignedTreeHead(t *testing.T) {
+	sth := &authority.SignedTreeHead{TreeSize: 1, Timestamp: 1569888000000, RootHash: []byte{1, 2}, Signature: []byte{3, 4}}
+	tests := []struct {
+		name       string
+		sth        *authority.SignedTreeHead
+		err        error
+		statusCode int
+		expected   string
+	}{
+		{"ok", sth, nil, http.StatusOK, `{"treeSize":1,"timestamp":1569888000000,"rootHash":"AQI=","signature":"AwQ="}`},
+		{"fail", nil, fmt.Errorf("an error"), http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				getSignedTreeHead: func() (*authority.SignedTreeHead, error) {
+					return tt.sth, tt.err
+				},
+			}).(*caHandler)
+			w := httptest.NewRecorder()
+			h.SignedTreeHead(w, httptest.NewRequest("GET", "http://example.com/transparency/sth", nil))
+			assert.Equals(t, tt.statusCode, w.Code)
+			if tt.expected != "" {
+				assert.Equals(t, tt.expected, strings.TrimSpace(w.Body.String()))
+			}
+		})
+	}
+}
+
+func Test_caHandler_LogEntries(t *testing.T) {
+	entries := []*db.LogEntry{{Index: 0, Serial: "1", LeafHash: []byte{1, 2}}}
+	tests := []struct {
+		name       string
+		query      string
+		start, end int64
+		err        error
+		statusCode int
+		expected   string
+	}{
+		{"ok", "?start=0&end=9", 0, 9, nil, http.StatusOK,
+			`{"entries":[{"index":0,"serial":"1","leafHash":"AQI=","timestamp":"0001-01-01T00:00:00Z"}]}`},
+		{"fail-start", "?start=foo&end=9", 0, 0, nil, http.StatusBadRequest, ""},
+		{"fail-end", "?start=0", 0, 0, nil, http.StatusBadRequest, ""},
+		{"fail", "?start=0&end=9", 0, 9, fmt.Errorf("an error"), http.StatusInternalServerError, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				getLogEntries: func(start, end int64) ([]*db.LogEntry, error) {
+					assert.Equals(t, tt.start, start)
+					assert.Equals(t, tt.end, end)
+					return entries, tt.err
+				},
+			}).(*caHandler)
+			w := httptest.NewRecorder()
+			h.LogEntries(w, httptest.NewRequest("GET", "http://example.com/transparency/entries"+tt.query, nil))
+			assert.Equals(t, tt.statusCode, w.Code)
+			if tt.expected != "" {
+				assert.Equals(t, tt.expected, strings.TrimSpace(w.Body.String()))
+			}
+		})
+	}
+}
+
+func Test_caHandler_InclusionProof(t *testing.T) {
+	proof := &authority.InclusionProof{
+		LeafIndex: 1,
+		LeafHash:  []byte{1},
+		AuditPath: [][]byte{{2}},
+		SignedTreeHead: &authority.SignedTreeHead{
+			TreeSize: 2, Timestamp: 1569888000000, RootHash: []byte{3}, Signature: []byte{4},
+		},
+	}
+	tests := []struct {
+		name       string
+		query      string
+		treeSize   int64
+		err        error
+		statusCode int
+		expected   string
+	}{
+		{"ok", "", 0, nil, http.StatusOK,
+			`{"leafIndex":1,"leafHash":"AQ==","auditPath":["Ag=="],"sth":{"treeSize":2,"timestamp":1569888000000,"rootHash":"Aw==","signature":"BA=="}}`},
+		{"ok-tree-size", "?treeSize=2", 2, nil, http.StatusOK, ""},
+		{"fail-tree-size", "?treeSize=foo", 0, nil, http.StatusBadRequest, ""},
+		{"fail", "", 0, statusError{fmt.Errorf("not found"), http.StatusNotFound}, http.StatusNotFound, ""},
+	}
+
+	chiCtx := chi.NewRouteContext()
+	chiCtx.URLParams.Add("serial", "1234")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New(&mockAuthority{
+				getInclusionProof: func(serial string, treeSize int64) (*authority.InclusionProof, error) {
+					assert.Equals(t, "1234", serial)
+					assert.Equals(t, tt.treeSize, treeSize)
+					return proof, tt.err
+				},
+			}).(*caHandler)
+			req := httptest.NewRequest("GET", "http://example.com/transparency/proof/1234"+tt.query, nil)
+			req = req.WithContext(context.WithValue(context.Background(), chi.RouteCtxKey, chiCtx))
+			w := httptest.NewRecorder()
+			h.InclusionProof(w, req)
+			assert.Equals(t, tt.statusCode, w.Code)
+			if tt.expected != "" {
+				assert.Equals(t, tt.expected, strings.TrimSpace(w.Body.String()))
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/binary"
+	"net/http"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// PKCS12ContentType is the media type of a PKCS#12 trust store.
+	PKCS12ContentType = "application/x-pkcs12"
+	// JKSContentType is the media type of a Java keystore.
+	JKSContentType = "application/x-java-keystore"
+)
+
+// TrustStoreRequest is the request body of the trust store exports protected
+// with a password.
+type TrustStoreRequest struct {
+	Password string `json:"password"`
+}
+
+// Validate validates the trust store request body.
+func (r *TrustStoreRequest) Validate() error {
+	if r.Password == "" {
+		return BadRequest(errors.New("missing password"))
+	}
+	if _, err := bmpString(r.Password); err != nil {
+		return BadRequest(err)
+	}
+	return nil
+}
+
+// RootsPKCS7 is an HTTP handler that returns the root certificates of the CA
+// as a PKCS#7 certs-only message, the format installed by Windows.
+func (h *caHandler) RootsPKCS7(w http.ResponseWriter, r *http.Request) {
+	h.writePKCS7Bundle(w, r, "roots.p7b", h.Authority.GetRoots)
+}
+
+// FederationPKCS7 is an HTTP handler that returns all the certificates in the
+// federation as a PKCS#7 certs-only message.
+func (h *caHandler) FederationPKCS7(w http.ResponseWriter, r *http.Request) {
+	h.writePKCS7Bundle(w, r, "federation.p7b", h.Authority.GetFederation)
+}
+
+// RootsPKCS12 is an HTTP handler that returns the root certificates of the CA
+// as a PKCS#12 trust store protected with the password of the request.
+func (h *caHandler) RootsPKCS12(w http.ResponseWriter, r *http.Request) {
+	h.writeTrustStore(w, r, "roots.p12", PKCS12ContentType, h.Authority.GetRoots, encodePKCS12)
+}
+
+// FederationPKCS12 is an HTTP handler that returns all the certificates in
+// the federation as a PKCS#12 trust store protected with the password of the
+// request.
+func (h *caHandler) FederationPKCS12(w http.ResponseWriter, r *http.Request) {
+	h.writeTrustStore(w, r, "federation.p12", PKCS12ContentType, h.Authority.GetFederation, encodePKCS12)
+}
+
+// RootsJKS is an HTTP handler that returns the root certificates of the CA as
+// a Java keystore protected with the password of the request.
+func (h *caHandler) RootsJKS(w http.ResponseWriter, r *http.Request) {
+	h.writeTrustStore(w, r, "roots.jks", JKSContentType, h.Authority.GetRoots, encodeJKS)
+}
+
+// FederationJKS is an HTTP handler that returns all the certificates in the
+// federation as a Java keystore protected with the password of the request.
+func (h *caHandler) FederationJKS(w http.ResponseWriter, r *http.Request) {
+	h.writeTrustStore(w, r, "federation.jks", JKSContentType, h.Authority.GetFederation, encodeJKS)
+}
+
+// writePKCS7Bundle writes the given bundle as a PKCS#7 certs-only message. The
+// message is only encoded when the bundle changes.
+func (h *caHandler) writePKCS7Bundle(w http.ResponseWriter, r *http.Request, name string, bundle func() ([]*x509.Certificate, error)) {
+	certs, err := bundle()
+	if err != nil {
+		WriteError(w, Forbidden(err))
+		return
+	}
+	sr, err := h.responses.load(name, certificatesSource(certs), func() ([]byte, error) {
+		return encodePKCS7(certs)
+	})
+	if err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	h.writeCacheableWithETag(w, r, PKCS7ContentType+"; smime-type=certs-only", sr.body, sr.etag, http.StatusOK)
+}
+
+// writeTrustStore writes the given bundle encoded with the password of the
+// request. The trust stores are never cached, they depend on the password.
+func (h *caHandler) writeTrustStore(w http.ResponseWriter, r *http.Request, name, contentType string,
+	bundle func() ([]*x509.Certificate, error), encode func([]*x509.Certificate, string) ([]byte, error)) {
+	var body TrustStoreRequest
+	if err := ReadJSON(r.Body, &body); err != nil {
+		WriteError(w, err)
+		return
+	}
+	if err := body.Validate(); err != nil {
+		WriteError(w, err)
+		return
+	}
+	certs, err := bundle()
+	if err != nil {
+		WriteError(w, Forbidden(err))
+		return
+	}
+	b, err := encode(certs, body.Password)
+	if err != nil {
+		WriteError(w, InternalServerError(err))
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	writeBody(w, contentType, b, http.StatusOK)
+}
+
+// jksMagic and jksVersion identify a Java keystore, and jksTrustedCert is the
+// tag of its trusted certificate entries.
+const (
+	jksMagic       = 0xfeedfeed
+	jksVersion     = 2
+	jksTrustedCert = 2
+)
+
+// encodeJKS returns a Java keystore with the given certificates as trusted
+// certificate entries, named by their SHA-256 fingerprint. The keystore is
+// protected with the keyed SHA-1 digest of the format.
+func encodeJKS(certs []*x509.Certificate, password string) ([]byte, error) {
+	var buf bytes.Buffer
+	write := func(v interface{}) {
+		binary.Write(&buf, binary.BigEndian, v)
+	}
+	writeUTF := func(s string) {
+		write(uint16(len(s)))
+		buf.WriteString(s)
+	}
+
+	write(uint32(jksMagic))
+	write(uint32(jksVersion))
+	write(uint32(len(certs)))
+	for _, crt := range certs {
+		write(uint32(jksTrustedCert))
+		// The aliases are ASCII, the same in the modified UTF-8 of Java.
+		writeUTF(trustStoreAlias(crt))
+		// The creation date in milliseconds, the start of the validity makes
+		// the keystore reproducible.
+		write(crt.NotBefore.UnixNano() / 1e6)
+		writeUTF("X.509")
+		write(uint32(len(crt.Raw)))
+		buf.Write(crt.Raw)
+	}
+
+	h := sha1.New()
+	for _, c := range utf16.Encode([]rune(password)) {
+		h.Write([]byte{byte(c >> 8), byte(c)})
+	}
+	h.Write([]byte("Mighty Aphrodite"))
+	h.Write(buf.Bytes())
+	buf.Write(h.Sum(nil))
+	return buf.Bytes(), nil
+}
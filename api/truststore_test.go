@@ -0,0 +1,351 @@
+package api
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/smallstep/assert"
+	"golang.org/x/crypto/pkcs12"
+)
+
+func TestTrustStoreRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     *TrustStoreRequest
+		wantErr bool
+	}{
+		{"ok", &TrustStoreRequest{Password: "changeit"}, false},
+		{"ok-unicode", &TrustStoreRequest{Password: "contraseña"}, false},
+		{"fail-empty", &TrustStoreRequest{}, true},
+		{"fail-non-bmp", &TrustStoreRequest{Password: "pass\U0001F511"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.req.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("TrustStoreRequest.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_caHandler_PKCS7(t *testing.T) {
+	roots := []*x509.Certificate{parseCertificate(rootPEM)}
+	federation := []*x509.Certificate{parseCertificate(rootPEM), parseCertificate(certPEM)}
+	h := New(&mockAuthority{
+		getRoots:      func() ([]*x509.Certificate, error) { return roots, nil },
+		getFederation: func() ([]*x509.Certificate, error) { return federation, nil },
+	}).(*caHandler)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		certs   []*x509.Certificate
+		file    string
+	}{
+		{"roots", h.RootsPKCS7, roots, "roots.p7b"},
+		{"federation", h.FederationPKCS7, federation, "federation.p7b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := encodePKCS7(tt.certs)
+			assert.FatalError(t, err)
+			w := httptest.NewRecorder()
+			tt.handler(w, httptest.NewRequest("GET", "/"+tt.file, nil))
+			assert.Equals(t, http.StatusOK, w.Code)
+			assert.Equals(t, "application/pkcs7-mime; smime-type=certs-only", w.Header().Get("Content-Type"))
+			assert.Equals(t, `attachment; filename="`+tt.file+`"`, w.Header().Get("Content-Disposition"))
+			assert.Equals(t, want, w.Body.Bytes())
+
+			// The same bundle has the same ETag.
+			req := httptest.NewRequest("GET", "/"+tt.file, nil)
+			req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+			w = httptest.NewRecorder()
+			tt.handler(w, req)
+			assert.Equals(t, http.StatusNotModified, w.Code)
+		})
+	}
+
+	h = New(&mockAuthority{ret1: []*x509.Certificate(nil), err: errors.New("an error")}).(*caHandler)
+	w := httptest.NewRecorder()
+	h.RootsPKCS7(w, httptest.NewRequest("GET", "/roots.p7b", nil))
+	assert.Equals(t, http.StatusForbidden, w.Code)
+}
+
+func Test_caHandler_trustStores(t *testing.T) {
+	roots := []*x509.Certificate{parseCertificate(rootPEM)}
+	federation := []*x509.Certificate{parseCertificate(rootPEM), parseCertificate(certPEM)}
+	h := New(&mockAuthority{
+		getRoots:      func() ([]*x509.Certificate, error) { return roots, nil },
+		getFederation: func() ([]*x509.Certificate, error) { return federation, nil },
+	}).(*caHandler)
+	fail := New(&mockAuthority{
+		getRoots:      func() ([]*x509.Certificate, error) { return nil, errors.New("an error") },
+		getFederation: func() ([]*x509.Certificate, error) { return nil, errors.New("an error") },
+	}).(*caHandler)
+
+	type handlers struct {
+		ok, fail http.HandlerFunc
+	}
+	tests := []struct {
+		name        string
+		handlers    handlers
+		contentType string
+		certs       []*x509.Certificate
+		verify      func(t *testing.T, b []byte, password string, certs []*x509.Certificate)
+	}{
+		{"roots.p12", handlers{h.RootsPKCS12, fail.RootsPKCS12}, PKCS12ContentType, roots, verifyPKCS12},
+		{"federation.p12", handlers{h.FederationPKCS12, fail.FederationPKCS12}, PKCS12ContentType, federation, verifyPKCS12},
+		{"roots.jks", handlers{h.RootsJKS, fail.RootsJKS}, JKSContentType, roots, verifyJKS},
+		{"federation.jks", handlers{h.FederationJKS, fail.FederationJKS}, JKSContentType, federation, verifyJKS},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.handlers.ok(w, httptest.NewRequest("POST", "/"+tt.name, strings.NewReader(`{"password":"changeit"}`)))
+			assert.Equals(t, http.StatusOK, w.Code)
+			assert.Equals(t, tt.contentType, w.Header().Get("Content-Type"))
+			assert.Equals(t, "no-store", w.Header().Get("Cache-Control"))
+			assert.Equals(t, `attachment; filename="`+tt.name+`"`, w.Header().Get("Content-Disposition"))
+			tt.verify(t, w.Body.Bytes(), "changeit", tt.certs)
+
+			for _, body := range []string{`{}`, `{"password":`} {
+				w = httptest.NewRecorder()
+				tt.handlers.ok(w, httptest.NewRequest("POST", "/"+tt.name, strings.NewReader(body)))
+				assert.Equals(t, http.StatusBadRequest, w.Code)
+			}
+
+			w = httptest.NewRecorder()
+			tt.handlers.fail(w, httptest.NewRequest("POST", "/"+tt.name, strings.NewReader(`{"password":"changeit"}`)))
+			assert.Equals(t, http.StatusForbidden, w.Code)
+		})
+	}
+}
+
+func Test_pkcs12KDF(t *testing.T) {
+	// Test vector of golang.org/x/crypto/pkcs12, with a leading zero in I_j.
+	key := pkcs12KDF([]byte("\xf3\x7e\x05\xb5\x18\x32\x4b\x4b"), []byte("\x00\x00"), 2048, 1, 24)
+	assert.Equals(t, []byte("\x00\xf7\x59\xff\x47\xd1\x4d\xd0\x36\x65\xd5\x94\x3c\xb3\xc4\xa3\x9a\x25\x55\xc0\x2a\xed\x66\xe1"), key)
+
+	password, err := bmpString("sesame")
+	assert.FatalError(t, err)
+	key = pkcs12KDF([]byte("\xff\xff\xff\xff\xff\xff\xff\xff"), password, 2048, 1, 24)
+	assert.Equals(t, []byte("\x7c\xd9\xfd\x3e\x2b\x3b\xe7\x69\x1a\x44\xe3\xbe\xf0\xf9\xea\x0f\xb9\xb8\x97\xd4\xe3\x25\xd9\xd1"), key)
+}
+
+func Test_bmpString(t *testing.T) {
+	b, err := bmpString("añ")
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte{0, 'a', 0, 0xf1, 0, 0}, b)
+	b, err = bmpString("")
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte{0, 0}, b)
+	_, err = bmpString("\U0001F511")
+	assert.Error(t, err)
+}
+
+func Test_encodePKCS12(t *testing.T) {
+	certs := []*x509.Certificate{parseCertificate(rootPEM), parseCertificate(certPEM)}
+	b, err := encodePKCS12(certs, "changeit")
+	assert.FatalError(t, err)
+	verifyPKCS12(t, b, "changeit", certs)
+
+	// The salt is random.
+	b2, err := encodePKCS12(certs, "changeit")
+	assert.FatalError(t, err)
+	assert.NotEquals(t, b, b2)
+}
+
+func Test_encodePKCS12KeyStore(t *testing.T) {
+	certs := []*x509.Certificate{parseCertificate(certPEM), parseCertificate(rootPEM)}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+
+	b, err := encodePKCS12KeyStore(certs, key, "changeit")
+	assert.FatalError(t, err)
+	blocks, err := pkcs12.ToPEM(b, "changeit")
+	assert.FatalError(t, err)
+	assert.Equals(t, 3, len(blocks))
+	for i, crt := range certs {
+		assert.Equals(t, "CERTIFICATE", blocks[i].Type)
+		assert.Equals(t, crt.Raw, blocks[i].Bytes)
+	}
+	assert.Equals(t, "PRIVATE KEY", blocks[2].Type)
+	priv, err := x509.ParseECPrivateKey(blocks[2].Bytes)
+	assert.FatalError(t, err)
+	assert.Equals(t, key.D, priv.D)
+	// The leaf is linked to the key.
+	assert.NotEquals(t, "", blocks[2].Headers["localKeyId"])
+	assert.Equals(t, blocks[2].Headers["localKeyId"], blocks[0].Headers["localKeyId"])
+	assert.Equals(t, "", blocks[1].Headers["localKeyId"])
+
+	_, err = pkcs12.ToPEM(b, "foobar")
+	assert.Error(t, err)
+
+	// Without a key.
+	b, err = encodePKCS12KeyStore(certs, nil, "changeit")
+	assert.FatalError(t, err)
+	verifyPKCS12KeyStore(t, b, "changeit", certs)
+}
+
+func Test_encodeJKS(t *testing.T) {
+	certs := []*x509.Certificate{parseCertificate(rootPEM), parseCertificate(certPEM)}
+	b, err := encodeJKS(certs, "changeit")
+	assert.FatalError(t, err)
+	verifyJKS(t, b, "changeit", certs)
+
+	// The keystore is reproducible.
+	b2, err := encodeJKS(certs, "changeit")
+	assert.FatalError(t, err)
+	assert.Equals(t, b, b2)
+}
+
+// verifyPKCS12 checks the MAC of the PKCS#12 trust store and its
+// certificates.
+func verifyPKCS12(t *testing.T, b []byte, password string, certs []*x509.Certificate) {
+	t.Helper()
+	bags := decodePKCS12Bags(t, b, password)
+	assert.Equals(t, len(certs), len(bags))
+	for i, bag := range bags {
+		assert.Equals(t, oidCertBag, bag.ID)
+		var certBag pkcs12CertBag
+		_, err := asn1.Unmarshal(bag.Value.Bytes, &certBag)
+		assert.FatalError(t, err)
+		assert.Equals(t, oidX509Certificate, certBag.ID)
+		assert.Equals(t, certs[i].Raw, certBag.Data)
+
+		// The attributes are a SET, sorted by their encoding.
+		attrs := make(map[string]asn1.RawValue)
+		for _, attr := range bag.Attributes {
+			attrs[attr.ID.String()] = attr.Value
+		}
+		assert.Equals(t, 2, len(attrs))
+		var name asn1.RawValue
+		_, err = asn1.Unmarshal(attrs[oidFriendlyName.String()].Bytes, &name)
+		assert.FatalError(t, err)
+		assert.Equals(t, asn1.TagBMPString, name.Tag)
+		alias, err := bmpString(trustStoreAlias(certs[i]))
+		assert.FatalError(t, err)
+		assert.Equals(t, alias[:len(alias)-2], name.Bytes)
+		var usage asn1.ObjectIdentifier
+		_, err = asn1.Unmarshal(attrs[oidJavaTrustedUsage.String()].Bytes, &usage)
+		assert.FatalError(t, err)
+		assert.Equals(t, oidAnyExtKeyUsage, usage)
+	}
+}
+
+// verifyPKCS12KeyStore checks the MAC of a PKCS#12 key store without a key and
+// its certificates.
+func verifyPKCS12KeyStore(t *testing.T, b []byte, password string, certs []*x509.Certificate) {
+	t.Helper()
+	bags := decodePKCS12Bags(t, b, password)
+	assert.Equals(t, len(certs), len(bags))
+	for i, bag := range bags {
+		assert.Equals(t, oidCertBag, bag.ID)
+		var certBag pkcs12CertBag
+		_, err := asn1.Unmarshal(bag.Value.Bytes, &certBag)
+		assert.FatalError(t, err)
+		assert.Equals(t, certs[i].Raw, certBag.Data)
+		assert.Equals(t, 1, len(bag.Attributes))
+		assert.Equals(t, oidFriendlyName, bag.Attributes[0].ID)
+	}
+}
+
+// decodePKCS12Bags checks the MAC of a PKCS#12 and returns the bags of all
+// its safes.
+func decodePKCS12Bags(t *testing.T, b []byte, password string) []pkcs12SafeBag {
+	t.Helper()
+	var pfx pfxPDU
+	rest, err := asn1.Unmarshal(b, &pfx)
+	assert.FatalError(t, err)
+	assert.Equals(t, 0, len(rest))
+	assert.Equals(t, 3, pfx.Version)
+	assert.Equals(t, oidData, pfx.AuthSafe.ContentType)
+	assert.Equals(t, oidSHA1, pfx.MacData.Mac.Algorithm.Algorithm)
+
+	var authSafe []byte
+	_, err = asn1.Unmarshal(pfx.AuthSafe.Content.Bytes, &authSafe)
+	assert.FatalError(t, err)
+	bmpPassword, err := bmpString(password)
+	assert.FatalError(t, err)
+	mac := hmac.New(sha1.New, pkcs12KDF(pfx.MacData.MacSalt, bmpPassword, pfx.MacData.Iterations, 3, sha1.Size))
+	mac.Write(authSafe)
+	assert.Equals(t, mac.Sum(nil), pfx.MacData.Mac.Digest)
+
+	var contents []pkcs7ContentInfo
+	_, err = asn1.Unmarshal(authSafe, &contents)
+	assert.FatalError(t, err)
+	var bags []pkcs12SafeBag
+	for _, c := range contents {
+		assert.Equals(t, oidData, c.ContentType)
+		var safeContents []byte
+		_, err = asn1.Unmarshal(c.Content.Bytes, &safeContents)
+		assert.FatalError(t, err)
+		var safe []pkcs12SafeBag
+		_, err = asn1.Unmarshal(safeContents, &safe)
+		assert.FatalError(t, err)
+		bags = append(bags, safe...)
+	}
+	return bags
+}
+
+// verifyJKS checks the digest of the Java keystore and its certificates.
+func verifyJKS(t *testing.T, b []byte, password string, certs []*x509.Certificate) {
+	t.Helper()
+	assert.True(t, len(b) > sha1.Size)
+	data, digest := b[:len(b)-sha1.Size], b[len(b)-sha1.Size:]
+	h := sha1.New()
+	for _, c := range utf16.Encode([]rune(password)) {
+		h.Write([]byte{byte(c >> 8), byte(c)})
+	}
+	h.Write([]byte("Mighty Aphrodite"))
+	h.Write(data)
+	assert.Equals(t, h.Sum(nil), digest)
+
+	r := bytes.NewReader(data)
+	read := func(v interface{}) {
+		assert.FatalError(t, binary.Read(r, binary.BigEndian, v))
+	}
+	readUTF := func() string {
+		var n uint16
+		read(&n)
+		s := make([]byte, n)
+		read(s)
+		return string(s)
+	}
+	var magic, version, count uint32
+	read(&magic)
+	read(&version)
+	read(&count)
+	assert.Equals(t, uint32(0xfeedfeed), magic)
+	assert.Equals(t, uint32(2), version)
+	assert.Equals(t, uint32(len(certs)), count)
+	for _, crt := range certs {
+		var tag uint32
+		var created int64
+		read(&tag)
+		assert.Equals(t, uint32(2), tag)
+		assert.Equals(t, trustStoreAlias(crt), readUTF())
+		read(&created)
+		assert.Equals(t, crt.NotBefore.UnixNano()/1e6, created)
+		assert.Equals(t, "X.509", readUTF())
+		var n uint32
+		read(&n)
+		raw := make([]byte, n)
+		read(raw)
+		assert.Equals(t, crt.Raw, raw)
+	}
+	assert.Equals(t, 0, r.Len())
+}
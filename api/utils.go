@@ -55,9 +55,15 @@ func JSON(w http.ResponseWriter, v interface{}) {
 // JSONStatus writes the given value into the http.ResponseWriter and the
 // given status is written as the status code of the response.
 func JSONStatus(w http.ResponseWriter, v interface{}, status int) {
+	buf, err := encodeJSON(v)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	if err := json.NewEncoder(w).Encode(v); err != nil {
+	if err != nil {
+		LogError(w, err)
+		return
+	}
+	defer putBuffer(buf)
+	if _, err := w.Write(buf.Bytes()); err != nil {
 		LogError(w, err)
 		return
 	}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+)
+
+// The CA API is versioned using a path prefix, e.g. /v1/sign. The endpoints of
+// a version are stable, and the following rules apply to all of them:
+//
+//   - New endpoints, new optional request fields and parameters, and new
+//     response fields can be added to an existing version.
+//   - Response fields are never removed or renamed, and their type and meaning
+//     do not change. Clients must ignore the fields they do not know.
+//   - The status codes of the successful responses do not change.
+//
+// Any other change is a breaking change and it requires a new version. A new
+// version is served alongside the previous ones, so clients can upgrade at
+// their own pace, and the supported versions are listed by the /versions
+// endpoint. Version v1 is also served without prefix and with the legacy /1.0
+// prefix for backwards compatibility.
+const (
+	// V1 is the first version of the CA API.
+	V1 = "v1"
+)
+
+// CurrentVersion is the latest version of the CA API.
+const CurrentVersion = V1
+
+// SupportedVersions is the list of versions of the CA API served by the CA.
+var SupportedVersions = []string{V1}
+
+// VersionsResponse is the response object of the versions request.
+type VersionsResponse struct {
+	Versions []string `json:"versions"`
+	Current  string   `json:"current"`
+}
+
+// Versions is an HTTP handler that returns the versions of the API supported
+// by the CA.
+func (h *caHandler) Versions(w http.ResponseWriter, r *http.Request) {
+	JSON(w, &VersionsResponse{
+		Versions: SupportedVersions,
+		Current:  CurrentVersion,
+	})
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/smallstep/assert"
+)
+
+func Test_caHandler_Versions(t *testing.T) {
+	h := New(&mockAuthority{}).(*caHandler)
+	req := httptest.NewRequest("GET", "http://example.com/versions", nil)
+	w := httptest.NewRecorder()
+	h.Versions(logging.NewResponseLogger(w), req)
+	res := w.Result()
+
+	assert.Equals(t, http.StatusOK, res.StatusCode)
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	assert.FatalError(t, err)
+	assert.Equals(t, "{\"versions\":[\"v1\"],\"current\":\"v1\"}\n", string(body))
+}
@@ -0,0 +1,311 @@
+package audit
+
+import (
+	"encoding/json"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/pkg/errors"
+)
+
+// Action is the operation recorded in an audit entry.
+type Action string
+
+const (
+	// Issue is the action of the entries of signed certificates.
+	Issue Action = "issue"
+	// Renew is the action of the entries of renewed and rekeyed certificates.
+	Renew Action = "renew"
+	// Revoke is the action of the entries of revoked certificates.
+	Revoke Action = "revoke"
+	// Seal is the action of the entries that sign a batch of entries.
+	Seal Action = "seal"
+)
+
+// Sink types.
+const (
+	FileSink    = "file"
+	SyslogSink  = "syslog"
+	WebhookSink = "webhook"
+)
+
+// Entry is the record of an issuance, renewal or revocation. It is written as
+// one line of JSON; new attributes can be added, but the existing ones do not
+// change.
+type Entry struct {
+	Time         time.Time   `json:"time"`
+	Action       Action      `json:"action"`
+	Serial       string      `json:"serial"`
+	Subject      string      `json:"subject,omitempty"`
+	SANs         []string    `json:"sans,omitempty"`
+	NotBefore    *time.Time  `json:"notBefore,omitempty"`
+	NotAfter     *time.Time  `json:"notAfter,omitempty"`
+	Provisioner  string      `json:"provisioner,omitempty"`
+	TokenSubject string      `json:"tokenSubject,omitempty"`
+	TokenID      string      `json:"tokenID,omitempty"`
+	RenewedFrom  string      `json:"renewedFrom,omitempty"`
+	Revocation   *Revocation `json:"revocation,omitempty"`
+	RequesterIP  string      `json:"requesterIP,omitempty"`
+	RequestID    string      `json:"requestID,omitempty"`
+	Batch        *Batch      `json:"batch,omitempty"`
+}
+
+// Revocation is the information of a revocation entry.
+type Revocation struct {
+	ReasonCode int    `json:"reasonCode"`
+	Reason     string `json:"reason,omitempty"`
+	MTLS       bool   `json:"mTLS"`
+	Actor      string `json:"actor,omitempty"`
+}
+
+// Config is the configuration of the audit log. If Signing is set the entries
+// are sealed in signed batches.
+type Config struct {
+	Sinks   []*SinkConfig  `json:"sinks"`
+	Signing *SigningConfig `json:"signing,omitempty"`
+}
+
+// SinkConfig is the configuration of a destination of the audit log. File
+// sinks append the entries to the file at Path. Syslog sinks send them to the
+// server at Address using Network, udp, tcp, unix or unixgram, or to the local
+// syslog if the network is empty, with the given Facility and Tag. Webhook
+// sinks POST them to the URL signed with the Secret like the event webhooks.
+type SinkConfig struct {
+	Type     string `json:"type"`
+	Path     string `json:"path,omitempty"`
+	Network  string `json:"network,omitempty"`
+	Address  string `json:"address,omitempty"`
+	Facility string `json:"facility,omitempty"`
+	Tag      string `json:"tag,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Secret   string `json:"secret,omitempty"`
+}
+
+// Validate validates the audit configuration.
+func (c *Config) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if len(c.Sinks) == 0 {
+		return errors.New("audit.sinks cannot be empty")
+	}
+	for i, s := range c.Sinks {
+		if s == nil {
+			return errors.Errorf("audit.sinks[%d] cannot be empty", i)
+		}
+		switch strings.ToLower(s.Type) {
+		case FileSink:
+			if s.Path == "" {
+				return errors.Errorf("audit.sinks[%d].path cannot be empty", i)
+			}
+		case SyslogSink:
+			if _, err := logging.ParseSyslogFacility(s.Facility); err != nil {
+				return errors.Wrapf(err, "audit.sinks[%d]", i)
+			}
+			if s.Network != "" && s.Address == "" {
+				return errors.Errorf("audit.sinks[%d].address cannot be empty", i)
+			}
+		case WebhookSink:
+			u, err := url.Parse(s.URL)
+			if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+				return errors.Errorf("audit.sinks[%d].url %s is not a valid http or https url", i, s.URL)
+			}
+			if s.Secret == "" {
+				return errors.Errorf("audit.sinks[%d].secret cannot be empty", i)
+			}
+		default:
+			return errors.Errorf("audit.sinks[%d].type '%s' is not supported", i, s.Type)
+		}
+	}
+	return c.Signing.Validate()
+}
+
+// sink is a destination of the audit entries.
+type sink interface {
+	Write(e *Entry, line []byte) error
+	Close() error
+}
+
+// Logger writes the audit entries to the configured sinks. It is separate
+// from the access log, so the entries are not mixed with the requests. The
+// methods of a nil Logger are no-ops.
+type Logger struct {
+	mutex  sync.Mutex
+	sinks  []sink
+	names  []string
+	path   string
+	chain  *chain
+	stop   chan struct{}
+	done   chan struct{}
+	closed bool
+}
+
+// New creates a Logger with the given configuration. It returns nil if the
+// configuration is nil.
+func New(c *Config) (*Logger, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	l := new(Logger)
+	for _, sc := range c.Sinks {
+		s, err := newSink(sc)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		l.sinks = append(l.sinks, s)
+		l.names = append(l.names, strings.ToLower(sc.Type))
+		if l.path == "" && strings.ToLower(sc.Type) == FileSink {
+			l.path = sc.Path
+		}
+	}
+	if c.Signing != nil {
+		if err := l.initChain(c); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// initChain loads the signing key and continues the chain of the first file
+// sink, if any. Batches are sealed when they are full and periodically.
+func (l *Logger) initChain(c *Config) error {
+	ch, err := newChain(c.Signing)
+	if err != nil {
+		return err
+	}
+	for _, sc := range c.Sinks {
+		if strings.ToLower(sc.Type) == FileSink {
+			if err := ch.recover(sc.Path); err != nil {
+				return err
+			}
+			break
+		}
+	}
+	l.chain = ch
+	l.stop = make(chan struct{})
+	l.done = make(chan struct{})
+	go l.run(c.Signing.GetInterval())
+	return nil
+}
+
+func (l *Logger) run(interval time.Duration) {
+	defer close(l.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.mutex.Lock()
+			l.seal()
+			l.mutex.Unlock()
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+func newSink(c *SinkConfig) (sink, error) {
+	switch strings.ToLower(c.Type) {
+	case FileSink:
+		return newFileSink(c.Path)
+	case SyslogSink:
+		return newSyslogSink(c)
+	default:
+		return newWebhookSink(c), nil
+	}
+}
+
+// Log writes the given entry to all the sinks. Errors are logged, an entry
+// that cannot be written does not fail the operation it records.
+func (l *Logger) Log(e *Entry) {
+	if l == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("audit: error marshaling entry of %s %s: %v", e.Action, e.Serial, err)
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.closed {
+		return
+	}
+	l.write(e, line)
+	if l.chain != nil && l.chain.add(line) {
+		l.seal()
+	}
+}
+
+// write writes the line of an entry to all the sinks.
+func (l *Logger) write(e *Entry, line []byte) {
+	for i, s := range l.sinks {
+		if err := s.Write(e, line); err != nil {
+			log.Printf("audit: error writing entry of %s %s to %s sink: %v", e.Action, e.Serial, l.names[i], err)
+		}
+	}
+}
+
+// seal writes the seal entry of the current batch. It must be called with
+// the mutex locked.
+func (l *Logger) seal() {
+	if l.closed || l.chain == nil {
+		return
+	}
+	e, err := l.chain.seal()
+	if err != nil {
+		log.Printf("audit: %v", err)
+		return
+	}
+	if e == nil {
+		return
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("audit: error marshaling seal of batch %d: %v", e.Batch.Sequence, err)
+		return
+	}
+	l.write(e, line)
+}
+
+// Close seals the last batch, and flushes and closes the sinks.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	if l.stop != nil {
+		select {
+		case <-l.stop:
+		default:
+			close(l.stop)
+		}
+		<-l.done
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.seal()
+	l.closed = true
+	var err error
+	for _, s := range l.sinks {
+		if e := s.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
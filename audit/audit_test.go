@@ -0,0 +1,133 @@
+package audit
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/events"
+	"github.com/smallstep/assert"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Config
+		wantErr bool
+	}{
+		{"ok-nil", nil, false},
+		{"ok", &Config{Sinks: []*SinkConfig{
+			{Type: "file", Path: "/var/log/step-ca/audit.log"},
+			{Type: "syslog"},
+			{Type: "SYSLOG", Network: "udp", Address: "localhost:514", Facility: "local0"},
+			{Type: "webhook", URL: "https://example.com/audit", Secret: "secret"},
+		}}, false},
+		{"fail-empty", &Config{}, true},
+		{"fail-nil-sink", &Config{Sinks: []*SinkConfig{nil}}, true},
+		{"fail-type", &Config{Sinks: []*SinkConfig{{Type: "foo"}}}, true},
+		{"fail-path", &Config{Sinks: []*SinkConfig{{Type: "file"}}}, true},
+		{"fail-facility", &Config{Sinks: []*SinkConfig{{Type: "syslog", Facility: "foo"}}}, true},
+		{"fail-address", &Config{Sinks: []*SinkConfig{{Type: "syslog", Network: "tcp"}}}, true},
+		{"fail-url", &Config{Sinks: []*SinkConfig{{Type: "webhook", URL: "example.com", Secret: "secret"}}}, true},
+		{"fail-secret", &Config{Sinks: []*SinkConfig{{Type: "webhook", URL: "https://example.com"}}}, true},
+		{"ok-signing", &Config{Sinks: []*SinkConfig{{Type: "syslog"}}, Signing: &SigningConfig{Key: "audit.key", BatchSize: 10, Interval: "30s"}}, false},
+		{"fail-signing-key", &Config{Sinks: []*SinkConfig{{Type: "syslog"}}, Signing: &SigningConfig{}}, true},
+		{"fail-signing-batchSize", &Config{Sinks: []*SinkConfig{{Type: "syslog"}}, Signing: &SigningConfig{Key: "audit.key", BatchSize: -1}}, true},
+		{"fail-signing-interval", &Config{Sinks: []*SinkConfig{{Type: "syslog"}}, Signing: &SigningConfig{Key: "audit.key", Interval: "foo"}}, true},
+		{"fail-signing-interval-negative", &Config{Sinks: []*SinkConfig{{Type: "syslog"}}, Signing: &SigningConfig{Key: "audit.key", Interval: "-1s"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Config.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLogger_nil(t *testing.T) {
+	l, err := New(nil)
+	assert.FatalError(t, err)
+	assert.Nil(t, l)
+	l.Log(&Entry{Action: Issue, Serial: "1"})
+	assert.NoError(t, l.Close())
+}
+
+func TestLogger_file(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	l, err := New(&Config{Sinks: []*SinkConfig{{Type: "file", Path: path}}})
+	assert.FatalError(t, err)
+	notAfter := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	l.Log(&Entry{Action: Issue, Serial: "1", Subject: "foo.smallstep.com", NotAfter: &notAfter, Provisioner: "max"})
+	l.Log(&Entry{Action: Revoke, Serial: "1", Revocation: &Revocation{ReasonCode: 1, Reason: "key compromise", Actor: "max"}})
+	assert.NoError(t, l.Close())
+	// Entries after close are ignored
+	l.Log(&Entry{Action: Renew, Serial: "2"})
+
+	b, err := ioutil.ReadFile(path)
+	assert.FatalError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	assert.Len(t, 2, lines)
+
+	var e Entry
+	assert.FatalError(t, json.Unmarshal([]byte(lines[0]), &e))
+	assert.Equals(t, Issue, e.Action)
+	assert.Equals(t, "1", e.Serial)
+	assert.Equals(t, "foo.smallstep.com", e.Subject)
+	assert.Equals(t, notAfter, *e.NotAfter)
+	assert.Equals(t, "max", e.Provisioner)
+	assert.False(t, e.Time.IsZero())
+
+	e = Entry{}
+	assert.FatalError(t, json.Unmarshal([]byte(lines[1]), &e))
+	assert.Equals(t, Revoke, e.Action)
+	assert.Equals(t, &Revocation{ReasonCode: 1, Reason: "key compromise", Actor: "max"}, e.Revocation)
+}
+
+func TestLogger_webhook(t *testing.T) {
+	old := webhookRetryDelay
+	webhookRetryDelay = time.Millisecond
+	defer func() { webhookRetryDelay = old }()
+
+	var attempts int
+	bodies := make(chan []byte, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.FatalError(t, err)
+		assert.Equals(t, events.Sign("secret", body), r.Header.Get(events.SignatureHeader))
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	l, err := New(&Config{Sinks: []*SinkConfig{{Type: "webhook", URL: srv.URL, Secret: "secret"}}})
+	assert.FatalError(t, err)
+	l.Log(&Entry{Action: Renew, Serial: "2", RenewedFrom: "1"})
+	assert.NoError(t, l.Close())
+
+	select {
+	case body := <-bodies:
+		var e Entry
+		assert.FatalError(t, json.Unmarshal(body, &e))
+		assert.Equals(t, Renew, e.Action)
+		assert.Equals(t, "2", e.Serial)
+		assert.Equals(t, "1", e.RenewedFrom)
+	default:
+		t.Fatal("entry was not delivered")
+	}
+	assert.Equals(t, 2, attempts)
+}
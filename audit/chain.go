@@ -0,0 +1,396 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/RTradeLtd/ca-cli/crypto/pemutil"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultBatchSize is the default maximum number of entries in a signed
+	// batch.
+	DefaultBatchSize = 100
+	// DefaultBatchInterval is the default maximum time an entry waits to be
+	// signed.
+	DefaultBatchInterval = time.Minute
+)
+
+// SigningConfig is the configuration of the signed audit log. The entries are
+// grouped in batches of at most BatchSize entries, or the entries written in
+// the Interval, and each batch is sealed with an entry signed with the private
+// key in the Key file, encrypted with the optional Password.
+type SigningConfig struct {
+	Key       string `json:"key"`
+	Password  string `json:"password,omitempty"`
+	BatchSize int    `json:"batchSize,omitempty"`
+	Interval  string `json:"interval,omitempty"`
+}
+
+// Validate validates the signing configuration.
+func (c *SigningConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.Key == "" {
+		return errors.New("audit.signing.key cannot be empty")
+	}
+	if c.BatchSize < 0 {
+		return errors.New("audit.signing.batchSize cannot be negative")
+	}
+	if c.Interval != "" {
+		d, err := time.ParseDuration(c.Interval)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing audit.signing.interval %s", c.Interval)
+		}
+		if d <= 0 {
+			return errors.Errorf("audit.signing.interval %s must be positive", c.Interval)
+		}
+	}
+	return nil
+}
+
+// GetBatchSize returns the maximum number of entries in a batch.
+func (c *SigningConfig) GetBatchSize() int {
+	if c.BatchSize == 0 {
+		return DefaultBatchSize
+	}
+	return c.BatchSize
+}
+
+// GetInterval returns the maximum time an entry waits to be signed. The
+// interval is parsed on every call, so the configuration can be compared on
+// reloads.
+func (c *SigningConfig) GetInterval() time.Duration {
+	if d, err := time.ParseDuration(c.Interval); err == nil && d > 0 {
+		return d
+	}
+	return DefaultBatchInterval
+}
+
+// Batch is the information of a seal entry. Hash is the SHA-256 of the
+// Previous hash followed by the SHA-256 of the lines of the entries of the
+// batch, each one terminated by a new line. The Signature is the base64
+// encoded signature of the Hash, PKCS #1 v1.5 for RSA keys, ASN.1 for ECDSA
+// keys and Ed25519 for Ed25519 keys. The first batch has a Previous hash of
+// zeros.
+type Batch struct {
+	Sequence  uint64 `json:"sequence"`
+	Entries   int    `json:"entries"`
+	Previous  string `json:"previous"`
+	Hash      string `json:"hash"`
+	KeyID     string `json:"keyID"`
+	Signature string `json:"signature"`
+}
+
+// chain seals the entries written by a Logger.
+type chain struct {
+	signer   crypto.Signer
+	keyID    string
+	size     int
+	sequence uint64
+	previous []byte
+	batch    hash.Hash
+	entries  int
+}
+
+func newChain(c *SigningConfig) (*chain, error) {
+	var opts []pemutil.Options
+	if c.Password != "" {
+		opts = append(opts, pemutil.WithPassword([]byte(c.Password)))
+	}
+	key, err := pemutil.Read(c.Key, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading audit signing key %s", c.Key)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.Errorf("audit signing key %s of type %T cannot be used for signing operations", c.Key, key)
+	}
+	kid, err := keyID(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	return &chain{
+		signer:   signer,
+		keyID:    kid,
+		size:     c.GetBatchSize(),
+		previous: make([]byte, sha256.Size),
+		batch:    sha256.New(),
+	}, nil
+}
+
+// recover continues the chain of the audit log at the given path. The entries
+// after the last seal are added to the first batch.
+func (c *chain) recover(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "error opening audit log %s", path)
+	}
+	defer f.Close()
+
+	err = readLines(f, func(n int, line []byte) error {
+		b, err := parseBatch(line)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing audit log %s line %d", path, n)
+		}
+		if b == nil {
+			c.add(line)
+			return nil
+		}
+		h, err := hex.DecodeString(b.Hash)
+		if err != nil || len(h) != sha256.Size {
+			return errors.Errorf("error parsing audit log %s line %d: invalid hash", path, n)
+		}
+		c.sequence = b.Sequence + 1
+		c.previous = h
+		c.batch.Reset()
+		c.entries = 0
+		return nil
+	})
+	return err
+}
+
+// add adds the line of an entry to the current batch and returns true if the
+// batch is full.
+func (c *chain) add(line []byte) bool {
+	c.batch.Write(line)
+	c.batch.Write([]byte{'\n'})
+	c.entries++
+	return c.entries >= c.size
+}
+
+// seal signs the current batch and returns the seal entry. It returns nil if
+// the batch is empty.
+func (c *chain) seal() (*Entry, error) {
+	if c.entries == 0 {
+		return nil, nil
+	}
+	sum := chainHash(c.previous, c.batch.Sum(nil))
+	sig, err := sign(c.signer, sum)
+	if err != nil {
+		return nil, errors.Wrap(err, "error signing audit batch")
+	}
+	e := &Entry{
+		Time:   time.Now().UTC(),
+		Action: Seal,
+		Batch: &Batch{
+			Sequence:  c.sequence,
+			Entries:   c.entries,
+			Previous:  hex.EncodeToString(c.previous),
+			Hash:      hex.EncodeToString(sum),
+			KeyID:     c.keyID,
+			Signature: base64.StdEncoding.EncodeToString(sig),
+		},
+	}
+	c.sequence++
+	c.previous = sum
+	c.batch.Reset()
+	c.entries = 0
+	return e, nil
+}
+
+// Verification is the result of the verification of a signed audit log.
+// Previous is the previous hash of the first batch, zeros if the log starts
+// the chain; to verify a rotated log it must match the Hash of the Last batch
+// of the log before it. Unsealed is the number of entries after the last
+// seal, they are not verified.
+type Verification struct {
+	Batches  int
+	Entries  int
+	Unsealed int
+	Previous string
+	Last     *Batch
+}
+
+// Verify reads a signed audit log and verifies the hash chain and the
+// signatures of all the batches with the given public key. It returns an
+// error with the line of the first seal that does not verify, a modified,
+// added or removed entry or batch breaks the chain.
+func Verify(r io.Reader, pub crypto.PublicKey) (*Verification, error) {
+	kid, err := keyID(pub)
+	if err != nil {
+		return nil, err
+	}
+
+	v := new(Verification)
+	batch := sha256.New()
+	var previous []byte
+	err = readLines(r, func(n int, line []byte) error {
+		b, err := parseBatch(line)
+		if err != nil {
+			return errors.Wrapf(err, "line %d", n)
+		}
+		if b == nil {
+			batch.Write(line)
+			batch.Write([]byte{'\n'})
+			v.Unsealed++
+			return nil
+		}
+
+		prev, err := hex.DecodeString(b.Previous)
+		if err != nil || len(prev) != sha256.Size {
+			return errors.Errorf("line %d: batch %d has an invalid previous hash", n, b.Sequence)
+		}
+		if v.Last == nil {
+			v.Previous = b.Previous
+		} else {
+			if b.Sequence != v.Last.Sequence+1 {
+				return errors.Errorf("line %d: batch %d does not follow batch %d", n, b.Sequence, v.Last.Sequence)
+			}
+			if !bytes.Equal(prev, previous) {
+				return errors.Errorf("line %d: batch %d does not chain to batch %d", n, b.Sequence, v.Last.Sequence)
+			}
+		}
+		if b.Entries != v.Unsealed {
+			return errors.Errorf("line %d: batch %d has %d entries, found %d", n, b.Sequence, b.Entries, v.Unsealed)
+		}
+		sum := chainHash(prev, batch.Sum(nil))
+		if hex.EncodeToString(sum) != b.Hash {
+			return errors.Errorf("line %d: batch %d hash does not match its entries", n, b.Sequence)
+		}
+		if b.KeyID != kid {
+			return errors.Errorf("line %d: batch %d is signed with key %s", n, b.Sequence, b.KeyID)
+		}
+		sig, err := base64.StdEncoding.DecodeString(b.Signature)
+		if err != nil {
+			return errors.Errorf("line %d: batch %d has an invalid signature", n, b.Sequence)
+		}
+		if err := verify(pub, sum, sig); err != nil {
+			return errors.Wrapf(err, "line %d: batch %d", n, b.Sequence)
+		}
+
+		v.Batches++
+		v.Entries += v.Unsealed
+		v.Unsealed = 0
+		v.Last = b
+		previous = sum
+		batch.Reset()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// VerifyFile verifies the signed audit log at the given path.
+func VerifyFile(path string, pub crypto.PublicKey) (*Verification, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error opening audit log %s", path)
+	}
+	defer f.Close()
+	return Verify(f, pub)
+}
+
+// readLines calls fn with every non empty line of r, without the new line.
+// Line numbers start at 1.
+func readLines(r io.Reader, fn func(n int, line []byte) error) error {
+	br := bufio.NewReader(r)
+	for n := 1; ; n++ {
+		line, err := br.ReadBytes('\n')
+		if len(line) > 0 {
+			line = bytes.TrimSuffix(line, []byte{'\n'})
+			if len(line) > 0 {
+				if err := fn(n, line); err != nil {
+					return err
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "error reading audit log")
+		}
+	}
+}
+
+// parseBatch returns the batch of a seal entry, or nil if the line is not a
+// seal entry.
+func parseBatch(line []byte) (*Batch, error) {
+	var e struct {
+		Action Action `json:"action"`
+		Batch  *Batch `json:"batch"`
+	}
+	if err := json.Unmarshal(line, &e); err != nil {
+		return nil, err
+	}
+	if e.Action != Seal {
+		return nil, nil
+	}
+	if e.Batch == nil {
+		return nil, errors.New("seal entry without a batch")
+	}
+	return e.Batch, nil
+}
+
+// chainHash returns the hash of a batch.
+func chainHash(previous, batch []byte) []byte {
+	h := sha256.New()
+	h.Write(previous)
+	h.Write(batch)
+	return h.Sum(nil)
+}
+
+// keyID returns the hex encoded SHA-256 of the PKIX encoding of the public
+// key.
+func keyID(pub crypto.PublicKey) (string, error) {
+	b, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", errors.Wrap(err, "error marshaling audit public key")
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func sign(signer crypto.Signer, sum []byte) ([]byte, error) {
+	if _, ok := signer.Public().(ed25519.PublicKey); ok {
+		return signer.Sign(rand.Reader, sum, crypto.Hash(0))
+	}
+	return signer.Sign(rand.Reader, sum, crypto.SHA256)
+}
+
+func verify(pub crypto.PublicKey, sum, sig []byte) error {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, sum, sig); err != nil {
+			return errors.New("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		var es struct {
+			R, S *big.Int
+		}
+		if _, err := asn1.Unmarshal(sig, &es); err != nil || !ecdsa.Verify(k, sum, es.R, es.S) {
+			return errors.New("invalid signature")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, sum, sig) {
+			return errors.New("invalid signature")
+		}
+	default:
+		return errors.Errorf("unsupported public key type %T", pub)
+	}
+	return nil
+}
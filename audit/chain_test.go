@@ -0,0 +1,202 @@
+package audit
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func writeSigningKey(t *testing.T, dir string) (string, crypto.PublicKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	der, err := x509.MarshalECPrivateKey(key)
+	assert.FatalError(t, err)
+	path := filepath.Join(dir, "audit.key")
+	assert.FatalError(t, ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600))
+	return path, key.Public()
+}
+
+func readAuditLines(t *testing.T, path string) []string {
+	b, err := ioutil.ReadFile(path)
+	assert.FatalError(t, err)
+	return strings.Split(strings.TrimSpace(string(b)), "\n")
+}
+
+func verifyLines(lines []string, pub crypto.PublicKey) (*Verification, error) {
+	return Verify(strings.NewReader(strings.Join(lines, "\n")+"\n"), pub)
+}
+
+func TestLogger_signed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+	keyPath, pub := writeSigningKey(t, dir)
+	config := &Config{
+		Sinks:   []*SinkConfig{{Type: "file", Path: path}},
+		Signing: &SigningConfig{Key: keyPath, BatchSize: 2},
+	}
+
+	l, err := New(config)
+	assert.FatalError(t, err)
+	l.Log(&Entry{Action: Issue, Serial: "1"})
+	l.Log(&Entry{Action: Issue, Serial: "2"})
+	l.Log(&Entry{Action: Revoke, Serial: "1"})
+	assert.NoError(t, l.Close())
+
+	// Full batches and the last batch on close are sealed.
+	lines := readAuditLines(t, path)
+	if !assert.Len(t, 5, lines) {
+		return
+	}
+	v, err := VerifyFile(path, pub)
+	assert.FatalError(t, err)
+	assert.Equals(t, 2, v.Batches)
+	assert.Equals(t, 3, v.Entries)
+	assert.Equals(t, 0, v.Unsealed)
+	assert.Equals(t, strings.Repeat("0", 64), v.Previous)
+	assert.Equals(t, uint64(1), v.Last.Sequence)
+	assert.Equals(t, 1, v.Last.Entries)
+
+	// The chain continues after a restart, including the entries that were
+	// not sealed.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	assert.FatalError(t, err)
+	_, err = f.WriteString(`{"time":"2019-01-01T00:00:00Z","action":"issue","serial":"3"}` + "\n")
+	assert.FatalError(t, err)
+	assert.FatalError(t, f.Close())
+	v, err = VerifyFile(path, pub)
+	assert.FatalError(t, err)
+	assert.Equals(t, 1, v.Unsealed)
+
+	l, err = New(config)
+	assert.FatalError(t, err)
+	l.Log(&Entry{Action: Renew, Serial: "4", RenewedFrom: "2"})
+	assert.NoError(t, l.Close())
+	v, err = VerifyFile(path, pub)
+	assert.FatalError(t, err)
+	assert.Equals(t, 3, v.Batches)
+	assert.Equals(t, 5, v.Entries)
+	assert.Equals(t, 0, v.Unsealed)
+	assert.Equals(t, uint64(2), v.Last.Sequence)
+	assert.Equals(t, 2, v.Last.Entries)
+
+	// Tampering breaks the chain.
+	lines = readAuditLines(t, path)
+	modify := func(fn func(lines []string) []string) []string {
+		return fn(append([]string{}, lines...))
+	}
+	tests := map[string][]string{
+		"modified": modify(func(l []string) []string {
+			l[0] = strings.Replace(l[0], `"serial":"1"`, `"serial":"9"`, 1)
+			return l
+		}),
+		"removed-entry": modify(func(l []string) []string {
+			return append(l[:1], l[2:]...)
+		}),
+		"added-entry": modify(func(l []string) []string {
+			return append(l[:1], append([]string{`{"action":"issue","serial":"9"}`}, l[1:]...)...)
+		}),
+		"removed-seal": modify(func(l []string) []string {
+			return append(l[:2], l[3:]...)
+		}),
+		"removed-batch": modify(func(l []string) []string {
+			return append(l[:3], l[5:]...)
+		}),
+		"modified-seal": modify(func(l []string) []string {
+			l[2] = strings.Replace(l[2], `"sequence":0`, `"sequence":7`, 1)
+			return l
+		}),
+	}
+	for name, lines := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := verifyLines(lines, pub)
+			assert.NotNil(t, err)
+		})
+	}
+
+	// A rotated log is verified from its first batch.
+	v, err = verifyLines(lines[3:], pub)
+	assert.FatalError(t, err)
+	assert.Equals(t, 2, v.Batches)
+	assert.Equals(t, strings.Split(strings.Split(lines[2], `"hash":"`)[1], `"`)[0], v.Previous)
+
+	// Other keys do not verify the log.
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	_, err = VerifyFile(path, other.Public())
+	assert.NotNil(t, err)
+}
+
+func TestLogger_signedInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+	keyPath, pub := writeSigningKey(t, dir)
+	config := &Config{
+		Sinks:   []*SinkConfig{{Type: "file", Path: path}},
+		Signing: &SigningConfig{Key: keyPath, Interval: "10ms"},
+	}
+	assert.FatalError(t, config.Validate())
+
+	l, err := New(config)
+	assert.FatalError(t, err)
+	defer l.Close()
+	l.Log(&Entry{Action: Issue, Serial: "1"})
+
+	for i := 0; i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+		if v, err := VerifyFile(path, pub); err == nil && v.Batches == 1 {
+			assert.Equals(t, 1, v.Entries)
+			return
+		}
+	}
+	t.Fatal("batch was not sealed")
+}
+
+func TestNew_signingKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	_, err = New(&Config{
+		Sinks:   []*SinkConfig{{Type: "file", Path: path}},
+		Signing: &SigningConfig{Key: filepath.Join(dir, "missing.key")},
+	})
+	assert.NotNil(t, err)
+}
+
+func Test_signVerify(t *testing.T) {
+	ec, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.FatalError(t, err)
+	rs, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	_, ed, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+
+	sum := chainHash(make([]byte, 32), []byte("batch"))
+	for _, signer := range []crypto.Signer{ec, rs, ed} {
+		sig, err := sign(signer, sum)
+		assert.FatalError(t, err)
+		assert.NoError(t, verify(signer.Public(), sum, sig))
+		assert.NotNil(t, verify(signer.Public(), chainHash(sum, nil), sig))
+		assert.NotNil(t, verify(signer.Public(), sum, bytes.Repeat([]byte{1}, len(sig))))
+	}
+	assert.NotNil(t, verify("foo", sum, nil))
+}
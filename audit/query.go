@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrQueryNotSupported is returned by Query if the audit log does not have a
+// file sink.
+var ErrQueryNotSupported = errors.New("audit log query requires a file sink")
+
+// ErrInvalidCursor is returned by Query if the cursor is not the offset of a
+// line of the audit log.
+var ErrInvalidCursor = errors.New("invalid audit log cursor")
+
+// Filter contains the conditions that the entries returned by Query must
+// match. The Subject matches the common name of the certificate or the
+// subject of the token used, and the Subject and SAN are case insensitive.
+// Empty fields are ignored.
+type Filter struct {
+	Action      Action
+	Provisioner string
+	Subject     string
+	SAN         string
+	From        time.Time
+	To          time.Time
+}
+
+func (f *Filter) match(e *Entry) bool {
+	if f.Action != "" && f.Action != e.Action {
+		return false
+	}
+	if f.Provisioner != "" && f.Provisioner != e.Provisioner {
+		return false
+	}
+	if f.Subject != "" && !strings.EqualFold(f.Subject, e.Subject) && !strings.EqualFold(f.Subject, e.TokenSubject) {
+		return false
+	}
+	if (!f.From.IsZero() && e.Time.Before(f.From)) || (!f.To.IsZero() && e.Time.After(f.To)) {
+		return false
+	}
+	if f.SAN != "" {
+		for _, san := range e.SANs {
+			if strings.EqualFold(f.SAN, san) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Query returns the entries of the first file sink that match the filter. See
+// QueryFile.
+func (l *Logger) Query(filter Filter, cursor string, limit int) ([]*Entry, string, error) {
+	if l == nil || l.path == "" {
+		return nil, "", ErrQueryNotSupported
+	}
+	return QueryFile(l.path, filter, cursor, limit)
+}
+
+// QueryFile returns at most limit entries of the audit log at the given path
+// that match the filter, in the order they were written, without the seal
+// entries. The cursor is the offset of the first line to read, empty for the
+// start of the log, and the returned cursor can be used to get the next page.
+// A limit of 0 returns all the entries.
+func QueryFile(path string, filter Filter, cursor string, limit int) ([]*Entry, string, error) {
+	var offset int64
+	if cursor != "" {
+		var err error
+		if offset, err = strconv.ParseInt(cursor, 10, 64); err != nil || offset < 0 {
+			return nil, "", ErrInvalidCursor
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*Entry{}, "", nil
+		}
+		return nil, "", errors.Wrapf(err, "error opening audit log %s", path)
+	}
+	defer f.Close()
+
+	// The cursor must be the start of a line.
+	if offset > 0 {
+		b := make([]byte, 1)
+		if _, err := f.ReadAt(b, offset-1); err != nil || b[0] != '\n' {
+			return nil, "", ErrInvalidCursor
+		}
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return nil, "", errors.Wrapf(err, "error reading audit log %s", path)
+		}
+	}
+
+	list := []*Entry{}
+	br := bufio.NewReader(f)
+	for {
+		line, err := br.ReadBytes('\n')
+		switch {
+		case err == io.EOF:
+			// A line without a new line is still being written.
+			return list, "", nil
+		case err != nil:
+			return nil, "", errors.Wrapf(err, "error reading audit log %s", path)
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			e := new(Entry)
+			if err := json.Unmarshal(line, e); err != nil {
+				return nil, "", errors.Wrapf(err, "error parsing audit log %s at offset %d", path, offset)
+			}
+			if e.Action != Seal && filter.match(e) {
+				if limit > 0 && len(list) == limit {
+					return list, strconv.FormatInt(offset, 10), nil
+				}
+				list = append(list, e)
+			}
+		}
+		offset += int64(len(line))
+	}
+}
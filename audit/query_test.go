@@ -0,0 +1,100 @@
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func TestLogger_Query(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	// Only the file sinks can be queried.
+	var nilLogger *Logger
+	_, _, err = nilLogger.Query(Filter{}, "", 0)
+	assert.Equals(t, ErrQueryNotSupported, err)
+	l, err := New(&Config{Sinks: []*SinkConfig{{Type: "webhook", URL: "https://example.com", Secret: "secret"}}})
+	assert.FatalError(t, err)
+	_, _, err = l.Query(Filter{}, "", 0)
+	assert.Equals(t, ErrQueryNotSupported, err)
+	assert.FatalError(t, l.Close())
+
+	l, err = New(&Config{Sinks: []*SinkConfig{{Type: "file", Path: path}}})
+	assert.FatalError(t, err)
+	list, next, err := l.Query(Filter{}, "", 0)
+	assert.FatalError(t, err)
+	assert.Len(t, 0, list)
+	assert.Equals(t, "", next)
+
+	t0 := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+	l.Log(&Entry{Time: t0, Action: Issue, Serial: "1", Subject: "foo.smallstep.com", SANs: []string{"foo.smallstep.com"}, Provisioner: "max"})
+	l.Log(&Entry{Time: t0.Add(time.Hour), Action: Issue, Serial: "2", Subject: "bar.smallstep.com", SANs: []string{"bar.smallstep.com", "10.0.0.1"}, Provisioner: "max", TokenSubject: "mariano"})
+	l.Log(&Entry{Time: t0.Add(2 * time.Hour), Action: Renew, Serial: "3", Subject: "foo.smallstep.com", SANs: []string{"foo.smallstep.com"}, Provisioner: "ops"})
+	l.Log(&Entry{Time: t0.Add(3 * time.Hour), Action: Revoke, Serial: "1", Provisioner: "max"})
+	l.Log(&Entry{Time: t0.Add(3 * time.Hour), Action: Seal, Batch: &Batch{}})
+
+	serials := func(list []*Entry) []string {
+		s := []string{}
+		for _, e := range list {
+			s = append(s, e.Serial)
+		}
+		return s
+	}
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"all", Filter{}, []string{"1", "2", "3", "1"}},
+		{"provisioner", Filter{Provisioner: "max"}, []string{"1", "2", "1"}},
+		{"action", Filter{Action: Issue, Provisioner: "max"}, []string{"1", "2"}},
+		{"subject", Filter{Subject: "FOO.smallstep.com"}, []string{"1", "3"}},
+		{"token-subject", Filter{Subject: "mariano"}, []string{"2"}},
+		{"san", Filter{SAN: "10.0.0.1"}, []string{"2"}},
+		{"range", Filter{From: t0.Add(time.Hour), To: t0.Add(2 * time.Hour)}, []string{"2", "3"}},
+		{"none", Filter{Provisioner: "foo"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, next, err := l.Query(tt.filter, "", 0)
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.want, serials(list))
+			assert.Equals(t, "", next)
+		})
+	}
+
+	// Pagination.
+	list, next, err = l.Query(Filter{Provisioner: "max"}, "", 2)
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"1", "2"}, serials(list))
+	assert.NotEquals(t, "", next)
+	list, next, err = l.Query(Filter{Provisioner: "max"}, next, 2)
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"1"}, serials(list))
+	assert.Equals(t, Revoke, list[0].Action)
+	assert.Equals(t, "", next)
+
+	// The cursor must be the start of a line.
+	for _, cursor := range []string{"foo", "-1", "1", "100000"} {
+		_, _, err = l.Query(Filter{}, cursor, 0)
+		assert.Equals(t, ErrInvalidCursor, err)
+	}
+	assert.FatalError(t, l.Close())
+
+	// A line being written is ignored.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	assert.FatalError(t, err)
+	_, err = f.Write([]byte(`{"time":"2019-10-01T04:00:00Z","action":"iss`))
+	assert.FatalError(t, err)
+	assert.FatalError(t, f.Close())
+	list, _, err = QueryFile(path, Filter{}, "", 0)
+	assert.FatalError(t, err)
+	assert.Len(t, 4, list)
+}
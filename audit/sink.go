@@ -0,0 +1,151 @@
+package audit
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/events"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/pkg/errors"
+)
+
+// fileSink appends the entries to a file, one JSON object per line.
+type fileSink struct {
+	file *os.File
+}
+
+func newFileSink(path string) (*fileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error opening audit log %s", path)
+	}
+	return &fileSink{file: f}, nil
+}
+
+func (s *fileSink) Write(e *Entry, line []byte) error {
+	_, err := s.file.Write(append(line, '\n'))
+	return err
+}
+
+func (s *fileSink) Close() error {
+	return s.file.Close()
+}
+
+// syslogSink sends the entries to syslog with the notice severity.
+type syslogSink struct {
+	writer *logging.SyslogWriter
+}
+
+func newSyslogSink(c *SinkConfig) (*syslogSink, error) {
+	facility, err := logging.ParseSyslogFacility(c.Facility)
+	if err != nil {
+		return nil, err
+	}
+	w, err := logging.NewSyslogWriter(strings.ToLower(c.Network), c.Address, facility, c.Tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{writer: w}, nil
+}
+
+func (s *syslogSink) Write(e *Entry, line []byte) error {
+	return s.writer.WriteSeverity(logging.SeverityNotice, string(line))
+}
+
+func (s *syslogSink) Close() error {
+	return s.writer.Close()
+}
+
+const (
+	webhookQueueSize   = 1000
+	webhookMaxAttempts = 3
+	webhookTimeout     = 10 * time.Second
+)
+
+// webhookRetryDelay is the delay before the second attempt to deliver an
+// entry, the delay increases linearly with the number of attempts.
+var webhookRetryDelay = time.Second
+
+// webhookSink delivers the entries in the background, in order, to a webhook.
+// The body is signed like the body of the event webhooks.
+type webhookSink struct {
+	url    string
+	secret string
+	client *http.Client
+	queue  chan []byte
+	wg     sync.WaitGroup
+}
+
+func newWebhookSink(c *SinkConfig) *webhookSink {
+	s := &webhookSink{
+		url:    c.URL,
+		secret: c.Secret,
+		client: &http.Client{Timeout: webhookTimeout},
+		queue:  make(chan []byte, webhookQueueSize),
+	}
+	s.wg.Add(1)
+	go s.run()
+	return s
+}
+
+// Write queues the entry. It fails if the queue is full.
+func (s *webhookSink) Write(e *Entry, line []byte) error {
+	select {
+	case s.queue <- line:
+		return nil
+	default:
+		return errors.New("queue is full")
+	}
+}
+
+func (s *webhookSink) run() {
+	defer s.wg.Done()
+	for body := range s.queue {
+		var err error
+		for i := 0; i < webhookMaxAttempts; i++ {
+			if i > 0 {
+				time.Sleep(time.Duration(i) * webhookRetryDelay)
+			}
+			if err = s.send(body); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			log.Printf("audit: error sending entry to webhook %s: %v", s.url, err)
+		}
+	}
+}
+
+func (s *webhookSink) send(body []byte) error {
+	req, err := http.NewRequest("POST", s.url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "error creating request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(events.SignatureHeader, events.Sign(s.secret, body))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "error sending request")
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Close waits until the queued entries are delivered.
+func (s *webhookSink) Close() error {
+	close(s.queue)
+	s.wg.Wait()
+	return nil
+}
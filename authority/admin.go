@@ -0,0 +1,143 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/pkg/errors"
+)
+
+// defaultAdminTokenLifetime is the maximum validity period of an admin token
+// if authority.admin.maxTokenLifetime is not set.
+const defaultAdminTokenLifetime = 5 * time.Minute
+
+// findProvisionerByName returns the first provisioner in the list with the
+// given name.
+func findProvisionerByName(provisioners provisioner.List, name string) (provisioner.Interface, bool) {
+	for _, p := range provisioners {
+		if p.GetName() == name {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// isAdminEnabled returns true if the admin api has been configured.
+func (a *Authority) isAdminEnabled() bool {
+	return a.config.AuthorityConfig != nil && a.config.AuthorityConfig.Admin != nil
+}
+
+// isAdminProvisioner returns true if the given provisioner has been designated
+// to authenticate admin requests.
+func (a *Authority) isAdminProvisioner(p provisioner.Interface) bool {
+	return a.isAdminEnabled() && a.config.AuthorityConfig.Admin.hasProvisioner(p.GetName())
+}
+
+// AuthorizeAdmin authorizes an admin request by validating the given token. The
+// token must be generated by one of the admin provisioners, using the admin
+// audience, and its validity period cannot be greater than the configured
+// maximum token lifetime. Returns the subject of the token.
+func (a *Authority) AuthorizeAdmin(ott string) (string, error) {
+	var errContext = apiCtx{"ott": ott}
+	if !a.isAdminEnabled() {
+		return "", &apiError{errors.New("authorizeAdmin: admin api is not enabled"),
+			http.StatusNotImplemented, errContext}
+	}
+
+	// Reject long lived tokens before marking them as used.
+	token, err := jose.ParseSigned(ott)
+	if err != nil {
+		return "", &apiError{errors.Wrap(err, "authorizeAdmin: error parsing token"),
+			http.StatusUnauthorized, errContext}
+	}
+	var claims jose.Claims
+	if err = token.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return "", &apiError{errors.Wrap(err, "authorizeAdmin"), http.StatusUnauthorized, errContext}
+	}
+	if err := validateAdminTokenLifetime(&claims, a.config.AuthorityConfig.Admin.MaxTokenLifetime.Duration); err != nil {
+		return "", &apiError{errors.Wrap(err, "authorizeAdmin"), http.StatusUnauthorized, errContext}
+	}
+
+	p, err := a.authorizeToken(context.Background(), ott)
+	if err != nil {
+		return "", &apiError{errors.Wrap(err, "authorizeAdmin"), http.StatusUnauthorized, errContext}
+	}
+	if !a.isAdminProvisioner(p) {
+		return "", &apiError{errors.Errorf("authorizeAdmin: provisioner %s is not an admin provisioner", p.GetName()),
+			http.StatusForbidden, errContext}
+	}
+	ap, ok := p.(provisioner.AdminAuthorizer)
+	if !ok {
+		return "", &apiError{errors.Errorf("authorizeAdmin: provisioner %s cannot authorize admin tokens", p.GetName()),
+			http.StatusForbidden, errContext}
+	}
+	sub, err := ap.AuthorizeAdmin(ott)
+	if err != nil {
+		return "", &apiError{errors.Wrap(err, "authorizeAdmin"), http.StatusUnauthorized, errContext}
+	}
+	return sub, nil
+}
+
+// AuthorizeAdminCertificate authorizes an admin request using a client
+// certificate. The certificate must contain the admin extension, it cannot be
+// revoked, and the provisioner that issued it must still be an admin
+// provisioner. Returns the common name of the certificate.
+//
+// The certificate chain is expected to be verified by the TLS layer.
+func (a *Authority) AuthorizeAdminCertificate(crt *x509.Certificate) (string, error) {
+	var errContext = apiCtx{"serialNumber": crt.SerialNumber.String()}
+	if !a.isAdminEnabled() {
+		return "", &apiError{errors.New("authorizeAdminCertificate: admin api is not enabled"),
+			http.StatusNotImplemented, errContext}
+	}
+	if !provisioner.IsAdminCertificate(crt) {
+		return "", &apiError{errors.New("authorizeAdminCertificate: certificate is not an admin certificate"),
+			http.StatusForbidden, errContext}
+	}
+
+	isRevoked, err := a.db.IsRevoked(crt.SerialNumber.String())
+	if err != nil {
+		return "", &apiError{errors.Wrap(err, "authorizeAdminCertificate"),
+			http.StatusInternalServerError, errContext}
+	}
+	if isRevoked {
+		return "", &apiError{errors.New("authorizeAdminCertificate: certificate has been revoked"),
+			http.StatusUnauthorized, errContext}
+	}
+
+	p, ok := a.getProvisioners().LoadByCertificate(crt)
+	if !ok {
+		return "", &apiError{errors.New("authorizeAdminCertificate: provisioner not found"),
+			http.StatusForbidden, errContext}
+	}
+	if !a.isAdminProvisioner(p) {
+		return "", &apiError{errors.Errorf("authorizeAdminCertificate: provisioner %s is not an admin provisioner", p.GetName()),
+			http.StatusForbidden, errContext}
+	}
+	return crt.Subject.CommonName, nil
+}
+
+// validateAdminTokenLifetime checks that the validity period of an admin token
+// is not greater than the given maximum.
+func validateAdminTokenLifetime(claims *jose.Claims, max time.Duration) error {
+	if claims.Expiry == nil {
+		return errors.New("admin token must contain an expiration claim (exp)")
+	}
+	var start time.Time
+	switch {
+	case claims.NotBefore != nil:
+		start = claims.NotBefore.Time()
+	case claims.IssuedAt != nil:
+		start = claims.IssuedAt.Time()
+	default:
+		return errors.New("admin token must contain a not before (nbf) or issued at (iat) claim")
+	}
+	if d := claims.Expiry.Time().Sub(start); d > max {
+		return errors.Errorf("admin token lifetime of %v is greater than the maximum of %v", d, max)
+	}
+	return nil
+}
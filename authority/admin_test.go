@@ -0,0 +1,269 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/crypto/keys"
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+func testAdminAuthority(t *testing.T) *Authority {
+	a := testAuthority(t)
+	a.config.AuthorityConfig.Admin = &AdminConfig{
+		Provisioners:     []string{"step-cli"},
+		MaxTokenLifetime: &provisioner.Duration{Duration: defaultAdminTokenLifetime},
+	}
+	return a
+}
+
+func TestAuthority_AuthorizeAdmin(t *testing.T) {
+	jwk, err := jose.ParseKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", jwk.KeyID))
+	assert.FatalError(t, err)
+	maxjwk, err := jose.ParseKey("testdata/secrets/max_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+	maxSig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: maxjwk.Key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", maxjwk.KeyID))
+	assert.FatalError(t, err)
+
+	now := time.Now().UTC()
+	adminAudience := []string{"https://test.ca.smallstep.com/admin"}
+	newClaims := func(iss string, aud []string, d time.Duration) jwt.Claims {
+		return jwt.Claims{
+			Subject:   "admin@smallstep.com",
+			Issuer:    iss,
+			NotBefore: jwt.NewNumericDate(now),
+			Expiry:    jwt.NewNumericDate(now.Add(d)),
+			Audience:  aud,
+			ID:        now.String() + iss + aud[0] + d.String(),
+		}
+	}
+
+	type test struct {
+		auth *Authority
+		ott  string
+		sub  string
+		err  error
+		code int
+	}
+	tests := map[string]func(t *testing.T) *test{
+		"fail/not-enabled": func(t *testing.T) *test {
+			raw, err := jwt.Signed(sig).Claims(newClaims("step-cli", adminAudience, time.Minute)).CompactSerialize()
+			assert.FatalError(t, err)
+			return &test{
+				auth: testAuthority(t),
+				ott:  raw,
+				err:  errors.New("authorizeAdmin: admin api is not enabled"),
+				code: http.StatusNotImplemented,
+			}
+		},
+		"fail/invalid-ott": func(t *testing.T) *test {
+			return &test{
+				auth: testAdminAuthority(t),
+				ott:  "foo",
+				err:  errors.New("authorizeAdmin: error parsing token"),
+				code: http.StatusUnauthorized,
+			}
+		},
+		"fail/lifetime": func(t *testing.T) *test {
+			raw, err := jwt.Signed(sig).Claims(newClaims("step-cli", adminAudience, time.Hour)).CompactSerialize()
+			assert.FatalError(t, err)
+			return &test{
+				auth: testAdminAuthority(t),
+				ott:  raw,
+				err:  errors.New("authorizeAdmin: admin token lifetime of 1h0m0s is greater than the maximum of 5m0s"),
+				code: http.StatusUnauthorized,
+			}
+		},
+		"fail/not-admin-provisioner": func(t *testing.T) *test {
+			raw, err := jwt.Signed(maxSig).Claims(newClaims("Max", adminAudience, time.Minute)).CompactSerialize()
+			assert.FatalError(t, err)
+			return &test{
+				auth: testAdminAuthority(t),
+				ott:  raw,
+				err:  errors.New("authorizeAdmin: provisioner Max is not an admin provisioner"),
+				code: http.StatusForbidden,
+			}
+		},
+		"fail/sign-audience": func(t *testing.T) *test {
+			raw, err := jwt.Signed(sig).Claims(newClaims("step-cli", []string{"https://test.ca.smallstep.com/sign"}, time.Minute)).CompactSerialize()
+			assert.FatalError(t, err)
+			return &test{
+				auth: testAdminAuthority(t),
+				ott:  raw,
+				err:  errors.New("authorizeAdmin: invalid token: invalid audience claim (aud)"),
+				code: http.StatusUnauthorized,
+			}
+		},
+		"ok": func(t *testing.T) *test {
+			raw, err := jwt.Signed(sig).Claims(newClaims("step-cli", adminAudience, time.Minute)).CompactSerialize()
+			assert.FatalError(t, err)
+			return &test{
+				auth: testAdminAuthority(t),
+				ott:  raw,
+				sub:  "admin@smallstep.com",
+			}
+		},
+	}
+	for name, genTestCase := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc := genTestCase(t)
+			sub, err := tc.auth.AuthorizeAdmin(tc.ott)
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					switch v := err.(type) {
+					case *apiError:
+						assert.HasPrefix(t, v.err.Error(), tc.err.Error())
+						assert.Equals(t, v.code, tc.code)
+					default:
+						t.Errorf("unexpected error type: %T", v)
+					}
+				}
+			} else {
+				assert.Nil(t, tc.err)
+				assert.Equals(t, tc.sub, sub)
+			}
+		})
+	}
+}
+
+func TestAuthority_AuthorizeAdminCertificate(t *testing.T) {
+	_, priv, err := keys.GenerateDefaultKeyPair()
+	assert.FatalError(t, err)
+
+	jwk, err := jose.ParseKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+	maxjwk, err := jose.ParseKey("testdata/secrets/max_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+
+	// Signs a certificate using the flow of the given provisioner.
+	sign := func(t *testing.T, a *Authority, iss string, key *jose.JSONWebKey) *x509.Certificate {
+		token, err := generateToken("smallstep test", iss, "https://test.ca.smallstep.com/sign",
+			[]string{"test.smallstep.com"}, time.Now(), key)
+		assert.FatalError(t, err)
+		ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+		signOpts, err := a.Authorize(ctx, token)
+		assert.FatalError(t, err)
+		certChain, err := a.Sign(context.Background(), getCSR(t, priv), provisioner.Options{}, signOpts...)
+		assert.FatalError(t, err)
+		return certChain[0]
+	}
+
+	type test struct {
+		auth *Authority
+		crt  *x509.Certificate
+		sub  string
+		err  error
+		code int
+	}
+	tests := map[string]func(t *testing.T) *test{
+		"fail/not-enabled": func(t *testing.T) *test {
+			return &test{
+				auth: testAuthority(t),
+				crt:  &x509.Certificate{SerialNumber: big.NewInt(1)},
+				err:  errors.New("authorizeAdminCertificate: admin api is not enabled"),
+				code: http.StatusNotImplemented,
+			}
+		},
+		"fail/not-admin-certificate": func(t *testing.T) *test {
+			a := testAdminAuthority(t)
+			return &test{
+				auth: a,
+				crt:  sign(t, a, "Max", maxjwk),
+				err:  errors.New("authorizeAdminCertificate: certificate is not an admin certificate"),
+				code: http.StatusForbidden,
+			}
+		},
+		"fail/revoked": func(t *testing.T) *test {
+			a := testAdminAuthority(t)
+			crt := sign(t, a, "step-cli", jwk)
+			a.db = &MockAuthDB{
+				isRevoked: func(sn string) (bool, error) {
+					return true, nil
+				},
+			}
+			return &test{
+				auth: a,
+				crt:  crt,
+				err:  errors.New("authorizeAdminCertificate: certificate has been revoked"),
+				code: http.StatusUnauthorized,
+			}
+		},
+		"fail/no-longer-admin": func(t *testing.T) *test {
+			a := testAdminAuthority(t)
+			crt := sign(t, a, "step-cli", jwk)
+			a.config.AuthorityConfig.Admin.Provisioners = []string{"Max"}
+			return &test{
+				auth: a,
+				crt:  crt,
+				err:  errors.New("authorizeAdminCertificate: provisioner step-cli is not an admin provisioner"),
+				code: http.StatusForbidden,
+			}
+		},
+		"ok": func(t *testing.T) *test {
+			a := testAdminAuthority(t)
+			return &test{
+				auth: a,
+				crt:  sign(t, a, "step-cli", jwk),
+				sub:  "smallstep test",
+			}
+		},
+	}
+	for name, genTestCase := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc := genTestCase(t)
+			sub, err := tc.auth.AuthorizeAdminCertificate(tc.crt)
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					switch v := err.(type) {
+					case *apiError:
+						assert.HasPrefix(t, v.err.Error(), tc.err.Error())
+						assert.Equals(t, v.code, tc.code)
+					default:
+						t.Errorf("unexpected error type: %T", v)
+					}
+				}
+			} else {
+				assert.Nil(t, tc.err)
+				assert.Equals(t, tc.sub, sub)
+			}
+		})
+	}
+}
+
+func Test_validateAdminTokenLifetime(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		claims jose.Claims
+		err    error
+	}{
+		{"ok-nbf", jose.Claims{NotBefore: jose.NewNumericDate(now), Expiry: jose.NewNumericDate(now.Add(5 * time.Minute))}, nil},
+		{"ok-iat", jose.Claims{IssuedAt: jose.NewNumericDate(now), Expiry: jose.NewNumericDate(now.Add(time.Minute))}, nil},
+		{"fail-no-exp", jose.Claims{NotBefore: jose.NewNumericDate(now)}, errors.New("admin token must contain an expiration claim (exp)")},
+		{"fail-no-nbf", jose.Claims{Expiry: jose.NewNumericDate(now)}, errors.New("admin token must contain a not before (nbf) or issued at (iat) claim")},
+		{"fail-lifetime", jose.Claims{NotBefore: jose.NewNumericDate(now), Expiry: jose.NewNumericDate(now.Add(6 * time.Minute))},
+			errors.New("admin token lifetime of 6m0s is greater than the maximum of 5m0s")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAdminTokenLifetime(&tt.claims, 5*time.Minute)
+			if tt.err == nil {
+				assert.Nil(t, err)
+			} else if assert.NotNil(t, err) {
+				assert.Equals(t, tt.err.Error(), err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package authority
+
+import (
+	"net/http"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/pkg/errors"
+)
+
+// AdminRole is the role given to the admins authenticated with single sign-on.
+type AdminRole string
+
+const (
+	// AdminRoleAdmin allows all the admin requests.
+	AdminRoleAdmin AdminRole = "admin"
+	// AdminRoleReadOnly only allows the admin requests that do not modify the
+	// state of the CA or export its secrets.
+	AdminRoleReadOnly AdminRole = "readOnly"
+)
+
+// isValid returns true if the role is supported.
+func (r AdminRole) isValid() bool {
+	return r == AdminRoleAdmin || r == AdminRoleReadOnly
+}
+
+// Allows returns true if an admin with the role can make a request that
+// requires the given role.
+func (r AdminRole) Allows(required AdminRole) bool {
+	switch r {
+	case AdminRoleAdmin:
+		return required.isValid()
+	case AdminRoleReadOnly:
+		return required == AdminRoleReadOnly
+	default:
+		return false
+	}
+}
+
+// ErrNotAdminSSOToken is the error returned by AuthorizeAdminSSO if single
+// sign-on is not configured or the token is not an ID token of the configured
+// OIDC provisioner. The token can still be an admin token.
+var ErrNotAdminSSOToken = errors.New("token is not an admin single sign-on token")
+
+// AuthorizeAdminSSO authorizes an admin request by validating an ID token of
+// the OIDC provisioner configured in authority.admin.sso. Returns the email of
+// the user and the role of its groups; if the user is in multiple groups the
+// admin role takes precedence. ErrNotAdminSSOToken is returned if the token
+// is not for the OIDC provisioner, i.e. its audience is not the client id.
+func (a *Authority) AuthorizeAdminSSO(token string) (string, AdminRole, error) {
+	if !a.isAdminEnabled() || a.config.AuthorityConfig.Admin.SSO == nil {
+		return "", "", ErrNotAdminSSOToken
+	}
+	sso := a.config.AuthorityConfig.Admin.SSO
+	a.provisionersMutex.RLock()
+	p, ok := findProvisionerByName(a.config.AuthorityConfig.Provisioners, sso.Provisioner)
+	a.provisionersMutex.RUnlock()
+	if !ok {
+		return "", "", ErrNotAdminSSOToken
+	}
+	o, ok := p.(*provisioner.OIDC)
+	if !ok {
+		return "", "", ErrNotAdminSSOToken
+	}
+
+	jwt, err := jose.ParseSigned(token)
+	if err != nil {
+		return "", "", ErrNotAdminSSOToken
+	}
+	var claims jose.Claims
+	if err := jwt.UnsafeClaimsWithoutVerification(&claims); err != nil || !claims.Audience.Contains(o.ClientID) {
+		return "", "", ErrNotAdminSSOToken
+	}
+
+	errContext := apiCtx{"provisioner": o.GetName()}
+	email, groups, err := o.AuthorizeSSO(token)
+	if err != nil {
+		return "", "", &apiError{errors.Wrap(err, "authorizeAdminSSO"), http.StatusUnauthorized, errContext}
+	}
+	errContext["email"] = email
+	var role AdminRole
+	for _, g := range groups {
+		switch sso.Groups[g] {
+		case AdminRoleAdmin:
+			role = AdminRoleAdmin
+		case AdminRoleReadOnly:
+			if role == "" {
+				role = AdminRoleReadOnly
+			}
+		}
+	}
+	if role == "" {
+		return "", "", &apiError{errors.Errorf("authorizeAdminSSO: user %s is not in an admin group", email),
+			http.StatusForbidden, errContext}
+	}
+	return email, role, nil
+}
@@ -0,0 +1,186 @@
+package authority
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+// testOIDCServer returns a server with the OpenID configuration and the keys
+// of an identity provider, and the private key used to sign its ID tokens.
+func testOIDCServer(t *testing.T) (*httptest.Server, *jose.JSONWebKey) {
+	key, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+	srv := httptest.NewUnstartedServer(nil)
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var v interface{}
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			v = map[string]string{"issuer": "https://idp.example.com", "jwks_uri": srv.URL + "/jwks"}
+		case "/jwks":
+			v = jose.JSONWebKeySet{Keys: []jose.JSONWebKey{key.Public()}}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(v)
+	})
+	srv.Start()
+	return srv, key
+}
+
+func generateIDToken(t *testing.T, key *jose.JSONWebKey, aud, email string, groups []string, exp time.Time) string {
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key.Key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", key.KeyID))
+	assert.FatalError(t, err)
+	claims := struct {
+		jose.Claims
+		Email  string   `json:"email"`
+		Groups []string `json:"groups"`
+	}{
+		Claims: jose.Claims{
+			Subject:   "1234567890",
+			Issuer:    "https://idp.example.com",
+			IssuedAt:  jose.NewNumericDate(exp.Add(-time.Hour)),
+			NotBefore: jose.NewNumericDate(exp.Add(-time.Hour)),
+			Expiry:    jose.NewNumericDate(exp),
+			Audience:  []string{aud},
+		},
+		Email:  email,
+		Groups: groups,
+	}
+	tok, err := jose.Signed(sig).Claims(claims).CompactSerialize()
+	assert.FatalError(t, err)
+	return tok
+}
+
+func TestAuthority_AuthorizeAdminSSO(t *testing.T) {
+	srv, key := testOIDCServer(t)
+	defer srv.Close()
+	otherKey, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	assert.FatalError(t, err)
+
+	a := testAuthority(t)
+	o := &provisioner.OIDC{
+		Type:                  "OIDC",
+		Name:                  "sso",
+		ClientID:              "ca-admin",
+		ConfigurationEndpoint: srv.URL,
+	}
+	assert.FatalError(t, o.Init(provisioner.Config{Claims: globalProvisionerClaims, Audiences: a.config.getAudiences()}))
+	a.config.AuthorityConfig.Provisioners = append(a.config.AuthorityConfig.Provisioners, o)
+	a.config.AuthorityConfig.Admin = &AdminConfig{
+		SSO: &AdminSSOConfig{
+			Provisioner: "sso",
+			Groups: map[string]AdminRole{
+				"ca-admins":   AdminRoleAdmin,
+				"ca-auditors": AdminRoleReadOnly,
+			},
+		},
+	}
+
+	exp := time.Now().Add(time.Hour)
+	tests := []struct {
+		name  string
+		auth  *Authority
+		token string
+		email string
+		role  AdminRole
+		err   error
+		code  int
+	}{
+		{"ok-admin", a, generateIDToken(t, key, "ca-admin", "jane@example.com", []string{"ca-admins"}, exp), "jane@example.com", AdminRoleAdmin, nil, 0},
+		{"ok-read-only", a, generateIDToken(t, key, "ca-admin", "jane@example.com", []string{"ca-auditors"}, exp), "jane@example.com", AdminRoleReadOnly, nil, 0},
+		{"ok-multiple-groups", a, generateIDToken(t, key, "ca-admin", "jane@example.com", []string{"ca-auditors", "ca-admins", "dev"}, exp), "jane@example.com", AdminRoleAdmin, nil, 0},
+		{"fail-not-enabled", testAuthority(t), generateIDToken(t, key, "ca-admin", "jane@example.com", []string{"ca-admins"}, exp), "", "", ErrNotAdminSSOToken, 0},
+		{"fail-not-sso", testAdminAuthority(t), generateIDToken(t, key, "ca-admin", "jane@example.com", []string{"ca-admins"}, exp), "", "", ErrNotAdminSSOToken, 0},
+		{"fail-audience", a, generateIDToken(t, key, "https://test.ca.smallstep.com/admin", "jane@example.com", []string{"ca-admins"}, exp), "", "", ErrNotAdminSSOToken, 0},
+		{"fail-parse", a, "foo", "", "", ErrNotAdminSSOToken, 0},
+		{"fail-no-group", a, generateIDToken(t, key, "ca-admin", "jane@example.com", []string{"dev"}, exp), "", "", errors.New("authorizeAdminSSO: user jane@example.com is not in an admin group"), http.StatusForbidden},
+		{"fail-signature", a, generateIDToken(t, otherKey, "ca-admin", "jane@example.com", []string{"ca-admins"}, exp), "", "", errors.New("authorizeAdminSSO: cannot validate token"), http.StatusUnauthorized},
+		{"fail-expired", a, generateIDToken(t, key, "ca-admin", "jane@example.com", []string{"ca-admins"}, time.Now().Add(-time.Hour)), "", "", errors.New("authorizeAdminSSO: failed to validate payload: square/go-jose/jwt: validation failed, token is expired (exp)"), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			email, role, err := tt.auth.AuthorizeAdminSSO(tt.token)
+			if tt.err != nil {
+				if assert.NotNil(t, err) {
+					switch v := err.(type) {
+					case *apiError:
+						assert.HasPrefix(t, v.err.Error(), tt.err.Error())
+						assert.Equals(t, tt.code, v.code)
+					default:
+						assert.Equals(t, tt.err, err)
+					}
+				}
+			} else {
+				assert.FatalError(t, err)
+			}
+			assert.Equals(t, tt.email, email)
+			assert.Equals(t, tt.role, role)
+		})
+	}
+
+	// ID tokens can be used multiple times.
+	token := generateIDToken(t, key, "ca-admin", "jane@example.com", []string{"ca-admins"}, exp)
+	for i := 0; i < 2; i++ {
+		_, _, err := a.AuthorizeAdminSSO(token)
+		assert.FatalError(t, err)
+	}
+}
+
+func TestAdminRole_Allows(t *testing.T) {
+	tests := []struct {
+		role     AdminRole
+		required AdminRole
+		want     bool
+	}{
+		{AdminRoleAdmin, AdminRoleAdmin, true},
+		{AdminRoleAdmin, AdminRoleReadOnly, true},
+		{AdminRoleReadOnly, AdminRoleReadOnly, true},
+		{AdminRoleReadOnly, AdminRoleAdmin, false},
+		{AdminRoleAdmin, "foo", false},
+		{"foo", AdminRoleReadOnly, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.role)+"-"+string(tt.required), func(t *testing.T) {
+			assert.Equals(t, tt.want, tt.role.Allows(tt.required))
+		})
+	}
+}
+
+func TestAdminSSOConfig_Validate(t *testing.T) {
+	provisioners := provisioner.List{
+		&provisioner.OIDC{Type: "OIDC", Name: "sso", ClientID: "ca-admin"},
+	}
+	tests := []struct {
+		name   string
+		config *AdminSSOConfig
+		err    error
+	}{
+		{"ok", &AdminSSOConfig{Provisioner: "sso", Groups: map[string]AdminRole{"ca-admins": AdminRoleAdmin, "ca-auditors": AdminRoleReadOnly}}, nil},
+		{"ok-nil", nil, nil},
+		{"fail-empty-groups", &AdminSSOConfig{Provisioner: "sso"}, errors.New("authority.admin.sso.groups cannot be empty")},
+		{"fail-role", &AdminSSOConfig{Provisioner: "sso", Groups: map[string]AdminRole{"ca-admins": "root"}}, errors.New("authority.admin.sso.groups: unsupported role root of group ca-admins")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate(provisioners)
+			if tt.err != nil {
+				if assert.NotNil(t, err) {
+					assert.Equals(t, tt.err.Error(), err.Error())
+				}
+			} else {
+				assert.Nil(t, err)
+			}
+		})
+	}
+}
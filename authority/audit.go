@@ -0,0 +1,95 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+
+	"github.com/RTradeLtd/ca-certificates/audit"
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/pkg/errors"
+)
+
+// WithAuditLogger sets an already initialized audit logger to a new
+// authority. This option is intended to be use on graceful reloads, the audit
+// configuration cannot change.
+func WithAuditLogger(l *audit.Logger) Option {
+	return func(a *Authority) {
+		a.audit = l
+	}
+}
+
+// GetAuditLogger returns the audit logger of the authority, or nil if the
+// audit log is not configured.
+func (a *Authority) GetAuditLogger() *audit.Logger {
+	return a.audit
+}
+
+// GetAuditEntries returns the entries of the audit log that match the given
+// filter in the order they were written. The cursor is the one returned with
+// the previous page. It requires a file sink.
+func (a *Authority) GetAuditEntries(filter audit.Filter, cursor string, limit int) ([]*audit.Entry, string, error) {
+	errContext := apiCtx{"cursor": cursor, "limit": limit}
+	switch {
+	case limit <= 0:
+		limit = DefaultCertificatesLimit
+	case limit > DefaultCertificatesMax:
+		limit = DefaultCertificatesMax
+	}
+
+	list, next, err := a.audit.Query(filter, cursor, limit)
+	switch err {
+	case nil:
+		return list, next, nil
+	case audit.ErrQueryNotSupported:
+		return nil, "", &apiError{errors.Wrap(err, "getAuditEntries"), http.StatusNotImplemented, errContext}
+	case audit.ErrInvalidCursor:
+		return nil, "", &apiError{errors.Wrap(err, "getAuditEntries"), http.StatusBadRequest, errContext}
+	default:
+		return nil, "", &apiError{errors.Wrap(err, "getAuditEntries"), http.StatusInternalServerError, errContext}
+	}
+}
+
+// newAuditEntry returns an entry with the requester of the given context.
+func newAuditEntry(ctx context.Context, action audit.Action, serial string) *audit.Entry {
+	e := &audit.Entry{Action: action, Serial: serial}
+	e.RequesterIP, _ = logging.GetRemoteAddress(ctx)
+	e.RequestID, _ = logging.GetRequestID(ctx)
+	return e
+}
+
+// auditCertificate records a signed or renewed certificate in the audit log.
+func (a *Authority) auditCertificate(ctx context.Context, action audit.Action, crt *x509.Certificate, provisionerName string, data *db.CertificateData) {
+	if a.audit == nil {
+		return
+	}
+	e := newAuditEntry(ctx, action, crt.SerialNumber.String())
+	e.Subject = crt.Subject.CommonName
+	e.SANs = certificateSANs(crt)
+	e.NotBefore, e.NotAfter = &crt.NotBefore, &crt.NotAfter
+	e.Provisioner = provisionerName
+	if data != nil {
+		e.TokenSubject = data.TokenSubject
+		e.TokenID = data.TokenID
+		e.RenewedFrom = data.RenewedFrom
+	}
+	a.audit.Log(e)
+}
+
+// auditRevocation records a revoked certificate in the audit log.
+func (a *Authority) auditRevocation(ctx context.Context, rci *db.RevokedCertificateInfo, provisionerName string) {
+	if a.audit == nil {
+		return
+	}
+	e := newAuditEntry(ctx, audit.Revoke, rci.Serial)
+	e.Provisioner = provisionerName
+	e.TokenID = rci.TokenID
+	e.Revocation = &audit.Revocation{
+		ReasonCode: rci.ReasonCode,
+		Reason:     rci.Reason,
+		MTLS:       rci.MTLS,
+		Actor:      rci.RevokedBy,
+	}
+	a.audit.Log(e)
+}
@@ -0,0 +1,118 @@
+package authority
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/audit"
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/smallstep/assert"
+)
+
+func TestAuthority_audit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	a := testAuthority(t)
+	// Without an audit logger nothing is recorded.
+	a.auditRevocation(context.Background(), &db.RevokedCertificateInfo{Serial: "1"}, "step-cli")
+
+	l, err := audit.New(&audit.Config{Sinks: []*audit.SinkConfig{{Type: "file", Path: path}}})
+	assert.FatalError(t, err)
+	WithAuditLogger(l)(a)
+	assert.Equals(t, l, a.GetAuditLogger())
+
+	now := time.Now()
+	crt := generateIssuedCertificate(t, a, "a.smallstep.com", "step-cli", now.Add(-time.Minute), now.Add(time.Hour))
+	ctx := logging.WithRemoteAddress(context.Background(), "10.0.0.1")
+	a.auditCertificate(ctx, audit.Renew, crt, "step-cli", &db.CertificateData{
+		TokenSubject: "a.smallstep.com",
+		TokenID:      "token-id",
+		RenewedFrom:  "1234",
+	})
+	a.auditRevocation(ctx, &db.RevokedCertificateInfo{
+		Serial:     crt.SerialNumber.String(),
+		ReasonCode: 1,
+		Reason:     "key compromise",
+		TokenID:    "revoke-token-id",
+		RevokedBy:  "mariano",
+	}, "step-cli")
+	assert.NoError(t, a.Shutdown())
+
+	b, err := ioutil.ReadFile(path)
+	assert.FatalError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if !assert.Len(t, 2, lines) {
+		return
+	}
+
+	var e audit.Entry
+	assert.FatalError(t, json.Unmarshal([]byte(lines[0]), &e))
+	assert.Equals(t, audit.Renew, e.Action)
+	assert.Equals(t, crt.SerialNumber.String(), e.Serial)
+	assert.Equals(t, "a.smallstep.com", e.Subject)
+	assert.Equals(t, []string{"a.smallstep.com"}, e.SANs)
+	assert.True(t, crt.NotAfter.Equal(*e.NotAfter))
+	assert.Equals(t, "step-cli", e.Provisioner)
+	assert.Equals(t, "a.smallstep.com", e.TokenSubject)
+	assert.Equals(t, "token-id", e.TokenID)
+	assert.Equals(t, "1234", e.RenewedFrom)
+	assert.Equals(t, "10.0.0.1", e.RequesterIP)
+	assert.Nil(t, e.Revocation)
+
+	e = audit.Entry{}
+	assert.FatalError(t, json.Unmarshal([]byte(lines[1]), &e))
+	assert.Equals(t, audit.Revoke, e.Action)
+	assert.Equals(t, crt.SerialNumber.String(), e.Serial)
+	assert.Equals(t, "revoke-token-id", e.TokenID)
+	assert.Equals(t, &audit.Revocation{ReasonCode: 1, Reason: "key compromise", Actor: "mariano"}, e.Revocation)
+	assert.Equals(t, "10.0.0.1", e.RequesterIP)
+}
+
+func TestAuthority_GetAuditEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	a := testAuthority(t)
+	_, _, err = a.GetAuditEntries(audit.Filter{}, "", 0)
+	if assert.NotNil(t, err) {
+		assert.Equals(t, http.StatusNotImplemented, err.(*apiError).code)
+	}
+
+	l, err := audit.New(&audit.Config{Sinks: []*audit.SinkConfig{{Type: "file", Path: path}}})
+	assert.FatalError(t, err)
+	defer l.Close()
+	WithAuditLogger(l)(a)
+	for i := 0; i < DefaultCertificatesLimit+1; i++ {
+		l.Log(&audit.Entry{Action: audit.Issue, Serial: strconv.Itoa(i), Provisioner: "step-cli"})
+	}
+	l.Log(&audit.Entry{Action: audit.Issue, Serial: "other", Provisioner: "Max"})
+
+	list, next, err := a.GetAuditEntries(audit.Filter{Provisioner: "step-cli"}, "", 0)
+	assert.FatalError(t, err)
+	assert.Len(t, DefaultCertificatesLimit, list)
+	list, next, err = a.GetAuditEntries(audit.Filter{Provisioner: "step-cli"}, next, 0)
+	assert.FatalError(t, err)
+	if assert.Len(t, 1, list) {
+		assert.Equals(t, strconv.Itoa(DefaultCertificatesLimit), list[0].Serial)
+	}
+	assert.Equals(t, "", next)
+
+	_, _, err = a.GetAuditEntries(audit.Filter{}, "foo", 0)
+	if assert.NotNil(t, err) {
+		assert.Equals(t, http.StatusBadRequest, err.(*apiError).code)
+	}
+}
@@ -5,13 +5,20 @@ import (
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/hex"
+	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/RTradeLtd/ca-certificates/audit"
 	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
 	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/RTradeLtd/ca-certificates/events"
+	"github.com/RTradeLtd/ca-certificates/federation"
+	"github.com/RTradeLtd/ca-certificates/notify"
 	"github.com/RTradeLtd/ca-cli/crypto/pemutil"
 	"github.com/RTradeLtd/ca-cli/crypto/x509util"
+	"github.com/RTradeLtd/ca-cli/jose"
 	"github.com/pkg/errors"
 )
 
@@ -24,12 +31,42 @@ type Authority struct {
 	config               *Config
 	rootX509Certs        []*x509.Certificate
 	intermediateIdentity *x509util.Identity
+	// caMutex protects the roots and the intermediate that can be replaced
+	// at runtime.
+	caMutex              sync.RWMutex
 	sshCAUserCertSignKey crypto.Signer
 	sshCAHostCertSignKey crypto.Signer
+	sshCAUserSigner      *sshSigner
+	sshCAHostSigner      *sshSigner
 	certificates         *sync.Map
 	startTime            time.Time
-	provisioners         *provisioner.Collection
-	db                   db.AuthDB
+	// provisioners is the *provisioner.Collection in use, it is replaced
+	// atomically by ReloadProvisioners.
+	provisioners atomic.Value
+	// provisionersMutex serializes the reloads of the provisioners and
+	// protects the provisioners in the configuration and the mint keys.
+	provisionersMutex sync.RWMutex
+	db                db.AuthDB
+	readDB            db.AuthDB
+	pending           *pendingStore
+	mintKeys          map[string]*jose.JSONWebKey
+	jwtSVIDKey        *jose.JSONWebKey
+	nonceSecret       []byte
+	renewals          *renewalCoalescer
+	signOptions       []configuredSignOption
+	events            *events.Publisher
+	audit             *audit.Logger
+	gc                *db.GarbageCollector
+	writer            *db.BatchWriter
+	notifier          *notify.Notifier
+	federation        *federation.Syncer
+	crl               *crlScheduler
+	// crlMutex serializes the generation of the CRLs.
+	crlMutex sync.Mutex
+	// federationMutex protects the roots synchronized from the peers.
+	federationMutex    sync.Mutex
+	staticCertificates map[string]bool
+	syncedRoots        map[string]map[string]bool
 	// Do not re-initialize
 	initOnce bool
 }
@@ -53,9 +90,11 @@ func New(config *Config, opts ...Option) (*Authority, error) {
 	}
 
 	var a = &Authority{
-		config:       config,
-		certificates: new(sync.Map),
-		provisioners: provisioner.NewCollection(config.getAudiences()),
+		config:             config,
+		certificates:       new(sync.Map),
+		pending:            newPendingStore(),
+		staticCertificates: make(map[string]bool),
+		syncedRoots:        make(map[string]map[string]bool),
 	}
 	for _, opt := range opts {
 		opt(a)
@@ -82,28 +121,42 @@ func (a *Authority) init() error {
 		}
 	}
 
-	// Load the root certificates and add them to the certificate store
-	a.rootX509Certs = make([]*x509.Certificate, len(a.config.Root))
-	for i, path := range a.config.Root {
-		crt, err := pemutil.ReadCertificate(path)
-		if err != nil {
+	// Open the read replica of the database if it's not already initialized
+	// with WithReadDatabase.
+	if a.readDB == nil && a.config.DB != nil && a.config.DB.ReadReplica != nil {
+		if a.readDB, err = db.NewReadReplica(a.config.DB); err != nil {
 			return err
 		}
-		// Add root certificate to the certificate map
-		sum := sha256.Sum256(crt.Raw)
-		a.certificates.Store(hex.EncodeToString(sum[:]), crt)
-		a.rootX509Certs[i] = crt
 	}
 
-	// Add federated roots
-	for _, path := range a.config.FederatedRoots {
-		crt, err := pemutil.ReadCertificate(path)
-		if err != nil {
+	// Initialize the event publisher if it's not already initialized with
+	// WithEventPublisher.
+	if a.events == nil {
+		if a.events, err = events.New(a.config.Events); err != nil {
 			return err
 		}
+	}
+
+	// Load the root and federated certificates and add them to the
+	// certificate store
+	paths := append(append([]string{}, a.config.Root...), a.config.FederatedRoots...)
+	items := make([]string, len(paths))
+	for i, path := range paths {
+		items[i] = "certificate " + path
+	}
+	certs := make([]*x509.Certificate, len(paths))
+	if err := loadConcurrently(items, func(i int) (err error) {
+		certs[i], err = pemutil.ReadCertificate(paths[i])
+		return
+	}); err != nil {
+		return err
+	}
+	for _, crt := range certs {
 		sum := sha256.Sum256(crt.Raw)
 		a.certificates.Store(hex.EncodeToString(sum[:]), crt)
+		a.staticCertificates[hex.EncodeToString(sum[:])] = true
 	}
+	a.rootX509Certs = certs[:len(a.config.Root):len(a.config.Root)]
 
 	// Decrypt and load intermediate public / private key pair.
 	if len(a.config.Password) > 0 {
@@ -121,6 +174,10 @@ func (a *Authority) init() error {
 			return err
 		}
 	}
+	if a.intermediateIdentity, err = newIntermediateIdentity(a.intermediateIdentity.Crt,
+		a.intermediateIdentity.Key, a.config.Signer); err != nil {
+		return err
+	}
 
 	// Decrypt and load SSH keys
 	if a.config.SSH != nil {
@@ -129,22 +186,132 @@ func (a *Authority) init() error {
 			if err != nil {
 				return err
 			}
+			if a.sshCAHostSigner, err = newSSHSigner(a.sshCAHostCertSignKey); err != nil {
+				return errors.Wrap(err, "error creating ssh host signer")
+			}
 		}
 		if a.config.SSH.UserKey != "" {
 			a.sshCAUserCertSignKey, err = parseCryptoSigner(a.config.SSH.UserKey, a.config.Password)
 			if err != nil {
 				return err
 			}
+			if a.sshCAUserSigner, err = newSSHSigner(a.sshCAUserCertSignKey); err != nil {
+				return errors.Wrap(err, "error creating ssh user signer")
+			}
 		}
 	}
 
 	// Store all the provisioners
+	provisioners := provisioner.NewCollection(a.config.getAudiences())
 	for _, p := range a.config.AuthorityConfig.Provisioners {
-		if err := a.provisioners.Store(p); err != nil {
+		if err := provisioners.Store(p); err != nil {
+			return err
+		}
+	}
+	a.provisioners.Store(provisioners)
+
+	// Decrypt the provisioner keys used to mint one-time tokens
+	if a.config.AuthorityConfig.Mint != nil {
+		if a.mintKeys, err = loadMintKeys(a.config.AuthorityConfig); err != nil {
 			return err
 		}
 	}
 
+	// Load the key used to sign the JWT-SVIDs.
+	if a.config.AuthorityConfig.JWTSVID != nil {
+		if a.jwtSVIDKey, err = loadJWTSVIDKey(a.config.AuthorityConfig.JWTSVID, a.config.Password); err != nil {
+			return err
+		}
+	}
+
+	// Create the key used to authenticate the nonces.
+	if a.config.AuthorityConfig.Nonce != nil {
+		if a.nonceSecret, err = loadNonceSecret(a.config.AuthorityConfig.Nonce); err != nil {
+			return err
+		}
+	}
+
+	// Coalesce the renewals of the same certificate in the short-lived mode.
+	if sl := a.config.AuthorityConfig.ShortLived; sl != nil {
+		a.renewals = newRenewalCoalescer(sl.CoalesceWindow.Duration)
+	}
+
+	// Create the sign options registered by the programs embedding the CA.
+	if a.signOptions, err = loadSignOptions(a.config.AuthorityConfig); err != nil {
+		return err
+	}
+
+	// Open the audit log if it's not already initialized with
+	// WithAuditLogger.
+	if a.audit == nil {
+		if a.audit, err = audit.New(a.config.Audit); err != nil {
+			return err
+		}
+	}
+
+	// Start the garbage collector of the database if it's not already
+	// initialized with WithGarbageCollector.
+	if a.gc == nil && a.config.DB != nil && a.config.DB.Retention != nil {
+		a.gc = db.NewGarbageCollector(a.config.DB.Retention, a.db)
+		// Only one of the instances sharing the database runs the pruners.
+		if l, ok := a.db.(db.Leaser); ok && a.config.DB.HA != nil {
+			ttl := 2 * a.config.DB.Retention.GetInterval()
+			a.gc.SetElector(db.NewElector(l, "gc", a.config.DB.HA.GetInstanceID(), ttl))
+		}
+		a.gc.Start()
+	}
+
+	// Start the asynchronous writer of the issued certificates if it's not
+	// already initialized with WithBatchWriter. The short-lived mode always
+	// uses it.
+	if a.writer == nil && a.config.DB != nil && a.config.DB.AsyncWrites != nil {
+		a.writer = db.NewBatchWriter(a.config.DB.AsyncWrites, a.db)
+	} else if sl := a.config.AuthorityConfig.ShortLived; a.writer == nil && sl != nil {
+		a.writer = db.NewBatchWriter(sl.asyncWritesConfig(), a.db)
+	}
+
+	// Start the notifications of the expiring certificates. The notifier is
+	// not shared on reloads, the configuration can change.
+	if a.config.Notifications != nil {
+		store, ok := a.db.(db.NotificationStore)
+		if !ok {
+			return errors.New("notifications require a database")
+		}
+		if a.notifier, err = notify.New(a.config.Notifications, a.expiringCertificates, store); err != nil {
+			return err
+		}
+		// Only one of the instances sharing the database sends them.
+		if l, ok := a.db.(db.Leaser); ok && a.config.DB.HA != nil {
+			ttl := 2 * a.config.Notifications.GetInterval()
+			a.notifier.SetElector(db.NewElector(l, "notify", a.config.DB.HA.GetInstanceID(), ttl))
+		}
+		a.notifier.Start()
+	}
+
+	// Generate the CRL if the database does not have a recent one, and start
+	// its regeneration. Like the notifier, it is not shared on reloads.
+	if a.config.CRL != nil {
+		if err := a.initCRL(); err != nil {
+			return err
+		}
+		var elector *db.Elector
+		if l, ok := a.db.(db.Leaser); ok && a.config.DB.HA != nil {
+			ttl := 2 * a.config.CRL.Interval.Duration
+			elector = db.NewElector(l, "crl", a.config.DB.HA.GetInstanceID(), ttl)
+		}
+		a.crl = newCRLScheduler(a.config.CRL.Interval.Duration, a.generateCRL, elector)
+		a.crl.Start()
+	}
+
+	// Start the synchronization of the federated roots. Like the notifier,
+	// it is not shared on reloads.
+	if a.config.Federation != nil {
+		if a.federation, err = federation.New(a.config.Federation, a.setFederatedRoots); err != nil {
+			return err
+		}
+		a.federation.Start()
+	}
+
 	// JWT numeric dates are seconds.
 	a.startTime = time.Now().Truncate(time.Second)
 	// Set flag indicating that initialization has been completed, and should
@@ -160,8 +327,32 @@ func (a *Authority) GetDatabase() db.AuthDB {
 	return a.db
 }
 
+// GetCacheControl returns the value of the Cache-Control header used in the
+// responses of the read endpoints. It is empty if it is not configured.
+func (a *Authority) GetCacheControl() string {
+	return a.config.CacheControl
+}
+
 // Shutdown safely shuts down any clients, databases, etc. held by the Authority.
 func (a *Authority) Shutdown() error {
+	if a.gc != nil {
+		a.gc.Stop()
+	}
+	a.notifier.Stop()
+	a.crl.Stop()
+	a.federation.Stop()
+	if a.writer != nil {
+		a.writer.Close()
+	}
+	a.events.Close()
+	if err := a.audit.Close(); err != nil {
+		log.Printf("error closing the audit log: %v", err)
+	}
+	if a.readDB != nil {
+		if err := a.readDB.Shutdown(); err != nil {
+			return err
+		}
+	}
 	return a.db.Shutdown()
 }
 
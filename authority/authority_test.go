@@ -13,7 +13,7 @@ import (
 	"github.com/smallstep/assert"
 )
 
-func testAuthority(t *testing.T) *Authority {
+func testAuthority(t testing.TB) *Authority {
 	maxjwk, err := stepJOSE.ParseKey("testdata/secrets/max_pub.jwk")
 	assert.FatalError(t, err)
 	clijwk, err := stepJOSE.ParseKey("testdata/secrets/step_cli_key_pub.jwk")
@@ -125,19 +125,19 @@ func TestAuthorityNew(t *testing.T) {
 					assert.NotNil(t, auth.intermediateIdentity)
 					for _, p := range tc.config.AuthorityConfig.Provisioners {
 						var _p provisioner.Interface
-						_p, ok = auth.provisioners.Load(p.GetID())
+						_p, ok = auth.getProvisioners().Load(p.GetID())
 						assert.True(t, ok)
 						assert.Equals(t, p, _p)
 						var kid, encryptedKey string
 						if kid, encryptedKey, ok = p.GetEncryptedKey(); ok {
 							var key string
-							key, ok = auth.provisioners.LoadEncryptedKey(kid)
+							key, ok = auth.getProvisioners().LoadEncryptedKey(kid)
 							assert.True(t, ok)
 							assert.Equals(t, encryptedKey, key)
 						}
 					}
 					// sanity check
-					_, ok = auth.provisioners.Load("fooo")
+					_, ok = auth.getProvisioners().Load("fooo")
 					assert.False(t, ok)
 				}
 			}
@@ -22,7 +22,7 @@ type Claims struct {
 // authorizeToken parses the token and returns the provisioner used to generate
 // the token. This method enforces the One-Time use policy (tokens can only be
 // used once).
-func (a *Authority) authorizeToken(ott string) (provisioner.Interface, error) {
+func (a *Authority) authorizeToken(ctx context.Context, ott string) (provisioner.Interface, error) {
 	var errContext = map[string]interface{}{"ott": ott}
 
 	// Validate payload
@@ -51,22 +51,49 @@ func (a *Authority) authorizeToken(ott string) (provisioner.Interface, error) {
 	}
 
 	// This method will also validate the audiences for JWK provisioners.
-	p, ok := a.provisioners.LoadByToken(token, &claims.Claims)
+	p, ok := a.getProvisioners().LoadByToken(token, &claims.Claims)
 	if !ok {
 		return nil, &apiError{
 			errors.Errorf("authorizeToken: provisioner not found or invalid audience (%s)", strings.Join(claims.Audience, ", ")),
 			http.StatusUnauthorized, errContext}
 	}
 
+	// The tokens of these provisioners must contain a nonce issued by the CA.
+	// It is validated before storing the token, so a token with a bad nonce
+	// does not use its id.
+	requireNonce := a.isNonceProvisioner(p)
+	nonceError := func(err error) error {
+		status := http.StatusUnauthorized
+		if _, ok := err.(*provisioner.Error); !ok {
+			status = http.StatusInternalServerError
+		}
+		return &apiError{errors.Wrap(err, "authorizeToken"), status, errContext}
+	}
+	if requireNonce {
+		if err := a.checkNonce(claims.Nonce); err != nil {
+			return nil, nonceError(err)
+		}
+	}
+
 	// Store the token to protect against reuse.
 	if reuseKey, err := p.GetTokenID(ott); err == nil {
+		if err := checkContext(ctx, "authorizeToken", errContext); err != nil {
+			return nil, err
+		}
 		ok, err := a.db.UseToken(reuseKey, ott)
 		if err != nil {
 			return nil, &apiError{errors.Wrap(err, "authorizeToken: failed when checking if token already used"),
 				http.StatusInternalServerError, errContext}
 		}
 		if !ok {
-			return nil, &apiError{errors.Errorf("authorizeToken: token already used"), http.StatusUnauthorized, errContext}
+			return nil, &apiError{provisioner.NewError(provisioner.ErrCodeTokenReused, errors.New("authorizeToken: token already used")),
+				http.StatusUnauthorized, errContext}
+		}
+	}
+
+	if requireNonce {
+		if err := a.useNonce(claims.Nonce, ott); err != nil {
+			return nil, nonceError(err)
 		}
 	}
 
@@ -97,17 +124,57 @@ func (a *Authority) Authorize(ctx context.Context, ott string) ([]provisioner.Si
 // list of methods to apply to the signing flow.
 func (a *Authority) authorizeSign(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
 	var errContext = apiCtx{"ott": ott}
-	p, err := a.authorizeToken(ott)
+	p, err := a.authorizeToken(ctx, ott)
 	if err != nil {
 		return nil, &apiError{errors.Wrap(err, "authorizeSign"), http.StatusUnauthorized, errContext}
 	}
 	opts, err := p.AuthorizeSign(ctx, ott)
+	recordAuthorization(ctx, p, err)
 	if err != nil {
 		return nil, &apiError{errors.Wrap(err, "authorizeSign"), http.StatusUnauthorized, errContext}
 	}
+	opts = a.appendSignOptions(ctx, p, opts)
+	// Keep the provisioner and token information with the certificate.
+	if provisioner.MethodFromContext(ctx) == provisioner.SignMethod {
+		opts = append(opts, newCertificateDataOption(p, ott))
+	}
 	return opts, nil
 }
 
+// appendSignOptions adds to the sign options returned by the provisioner the
+// options that depend on the authority configuration.
+func (a *Authority) appendSignOptions(ctx context.Context, p provisioner.Interface, opts []provisioner.SignOption) []provisioner.SignOption {
+	method := provisioner.MethodFromContext(ctx)
+	// Sign options configured in authority.signOptions.
+	for _, o := range a.signOptions {
+		if o.method == method && o.appliesTo(p) {
+			opts = append(opts, o.option)
+		}
+	}
+	if method != provisioner.SignMethod {
+		return opts
+	}
+	// Certificates issued by admin provisioners can authenticate admin requests.
+	if a.isAdminProvisioner(p) {
+		opts = append(opts, provisioner.NewAdminExtensionOption())
+	}
+	// Sign requests of these provisioners are queued until an admin approves
+	// them.
+	if a.isApprovalProvisioner(p) {
+		opts = append(opts, approvalRequiredOption{provisioner: p.GetName()})
+	}
+	// Sign requests of these provisioners can ask the authority to generate
+	// the key of the certificate.
+	if a.isKeyGenerationProvisioner(p) {
+		opts = append(opts, keyGenerationOption{provisioner: p.GetName()})
+	}
+	// Sign requests of these provisioners can get JWT-SVIDs.
+	if a.isJWTSVIDProvisioner(p) {
+		opts = append(opts, jwtSVIDOption{provisioner: p.GetName()})
+	}
+	return opts
+}
+
 // AuthorizeSign authorizes a signature request by validating and authenticating
 // a OTT that must be sent w/ the request.
 //
@@ -121,7 +188,7 @@ func (a *Authority) AuthorizeSign(ott string) ([]provisioner.SignOption, error)
 // authorizeRevoke authorizes a revocation request by validating and authenticating
 // the RevokeOptions POSTed with the request.
 // Returns a tuple of the provisioner ID and error, if one occurred.
-func (a *Authority) authorizeRevoke(opts *RevokeOptions) (p provisioner.Interface, err error) {
+func (a *Authority) authorizeRevoke(ctx context.Context, opts *RevokeOptions) (p provisioner.Interface, err error) {
 	if opts.MTLS {
 		if opts.Crt.SerialNumber.String() != opts.Serial {
 			return nil, errors.New("authorizeRevoke: serial number in certificate different than body")
@@ -133,13 +200,14 @@ func (a *Authority) authorizeRevoke(opts *RevokeOptions) (p provisioner.Interfac
 		}
 	} else {
 		// Gets the token provisioner and validates common token fields.
-		p, err = a.authorizeToken(opts.OTT)
+		p, err = a.authorizeToken(ctx, opts.OTT)
 		if err != nil {
 			return nil, errors.Wrap(err, "authorizeRevoke")
 		}
 
 		// Call the provisioner AuthorizeRevoke to apply provisioner specific auth claims.
 		err = p.AuthorizeRevoke(opts.OTT)
+		recordAuthorization(provisioner.NewContextWithMethod(ctx, provisioner.RevokeMethod), p, err)
 		if err != nil {
 			return nil, errors.Wrap(err, "authorizeRevoke")
 		}
@@ -172,7 +240,7 @@ func (a *Authority) authorizeRenewal(crt *x509.Certificate) error {
 		}
 	}
 
-	p, ok := a.provisioners.LoadByCertificate(crt)
+	p, ok := a.getProvisioners().LoadByCertificate(crt)
 	if !ok {
 		return &apiError{
 			err:     errors.New("renew: provisioner not found"),
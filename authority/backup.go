@@ -0,0 +1,120 @@
+package authority
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/pkg/errors"
+)
+
+// BackupVersion is the version of the format of the backups.
+const BackupVersion = 1
+
+// Backup is a consistent copy of the state of the CA: its configuration, with
+// the secrets redacted, and a snapshot of the database. The checksum covers
+// all the other attributes.
+type Backup struct {
+	Version   int                    `json:"version"`
+	CreatedAt time.Time              `json:"createdAt"`
+	Config    map[string]interface{} `json:"config"`
+	DB        *db.Snapshot           `json:"db"`
+	Checksum  string                 `json:"checksum"`
+}
+
+// Sum returns the SHA-256 checksum of the backup.
+func (b *Backup) Sum() (string, error) {
+	var dbChecksum string
+	if b.DB != nil {
+		dbChecksum = b.DB.Checksum
+	}
+	data, err := json.Marshal(struct {
+		Version    int                    `json:"version"`
+		CreatedAt  time.Time              `json:"createdAt"`
+		Config     map[string]interface{} `json:"config"`
+		DBChecksum string                 `json:"dbChecksum"`
+	}{b.Version, b.CreatedAt.UTC(), b.Config, dbChecksum})
+	if err != nil {
+		return "", errors.Wrap(err, "error marshaling backup")
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// Verify checks the version and the checksums of the backup and its database
+// snapshot.
+func (b *Backup) Verify() error {
+	if b.Version != BackupVersion {
+		return errors.Errorf("unsupported backup version %d", b.Version)
+	}
+	sum, err := b.Sum()
+	if err != nil {
+		return err
+	}
+	if b.Checksum != sum {
+		return errors.New("backup checksum does not match")
+	}
+	return b.DB.Verify()
+}
+
+// Backup returns a copy of the configuration and the database of the CA.
+// Writes to the database are blocked while the snapshot is taken.
+func (a *Authority) Backup() (*Backup, error) {
+	config, err := a.GetSanitizedConfig()
+	if err != nil {
+		return nil, err
+	}
+	snap, err := a.db.Export()
+	switch err {
+	case nil:
+	case db.ErrNotImplemented:
+		return nil, &apiError{errors.New("backup: no persistence layer configured"),
+			http.StatusNotImplemented, apiCtx{}}
+	default:
+		return nil, &apiError{errors.Wrap(err, "backup"),
+			http.StatusInternalServerError, apiCtx{}}
+	}
+
+	b := &Backup{
+		Version:   BackupVersion,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		Config:    config,
+		DB:        snap,
+	}
+	if b.Checksum, err = b.Sum(); err != nil {
+		return nil, &apiError{errors.Wrap(err, "backup"),
+			http.StatusInternalServerError, apiCtx{}}
+	}
+	return b, nil
+}
+
+// Restore verifies the given backup and imports its database snapshot. The
+// database must not contain any of the records of the snapshot, so it is
+// intended to be used on a fresh instance. The configuration of the backup is
+// not applied, it must be installed, with its secrets, before starting the
+// CA.
+func (a *Authority) Restore(b *Backup) error {
+	if b == nil {
+		return &apiError{errors.New("restore: backup cannot be empty"),
+			http.StatusBadRequest, apiCtx{}}
+	}
+	errContext := apiCtx{"checksum": b.Checksum}
+	if err := b.Verify(); err != nil {
+		return &apiError{errors.Wrap(err, "restore"), http.StatusBadRequest, errContext}
+	}
+	err := a.db.Import(b.DB)
+	switch {
+	case err == nil:
+		return nil
+	case err == db.ErrNotImplemented:
+		return &apiError{errors.New("restore: no persistence layer configured"),
+			http.StatusNotImplemented, errContext}
+	case errors.Cause(err) == db.ErrAlreadyExists:
+		return &apiError{errors.Wrap(err, "restore"), http.StatusConflict, errContext}
+	default:
+		return &apiError{errors.Wrap(err, "restore"), http.StatusInternalServerError, errContext}
+	}
+}
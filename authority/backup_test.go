@@ -0,0 +1,90 @@
+package authority
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+func TestAuthority_Backup(t *testing.T) {
+	snap := &db.Snapshot{Version: db.SnapshotVersion, Tables: []*db.SnapshotTable{
+		{Name: "x509_certs", Entries: []*db.SnapshotEntry{{Key: []byte("1"), Value: []byte("foo")}}},
+	}}
+	snap.Checksum = snap.Sum()
+
+	a := testAuthority(t)
+	a.db = &MockAuthDB{ret1: snap}
+	b, err := a.Backup()
+	assert.FatalError(t, err)
+	assert.Equals(t, BackupVersion, b.Version)
+	assert.Equals(t, snap, b.DB)
+	assert.Equals(t, a.config.Address, b.Config["address"])
+	assert.NoError(t, b.Verify())
+
+	// The backup survives a JSON round trip.
+	data, err := json.Marshal(b)
+	assert.FatalError(t, err)
+	var got Backup
+	assert.FatalError(t, json.Unmarshal(data, &got))
+	assert.NoError(t, got.Verify())
+
+	got.Config["address"] = ":8443"
+	if err := got.Verify(); assert.NotNil(t, err) {
+		assert.Equals(t, "backup checksum does not match", err.Error())
+	}
+
+	a.db = &MockAuthDB{err: db.ErrNotImplemented}
+	_, err = a.Backup()
+	if assert.NotNil(t, err) {
+		assert.Equals(t, http.StatusNotImplemented, err.(*apiError).code)
+	}
+}
+
+func TestAuthority_Restore(t *testing.T) {
+	snap := &db.Snapshot{Version: db.SnapshotVersion, Tables: []*db.SnapshotTable{}}
+	snap.Checksum = snap.Sum()
+	a := testAuthority(t)
+	a.db = &MockAuthDB{ret1: snap}
+	b, err := a.Backup()
+	assert.FatalError(t, err)
+
+	tampered := *b
+	tampered.DB = &db.Snapshot{Version: db.SnapshotVersion, Checksum: b.Checksum}
+
+	tests := []struct {
+		name   string
+		backup *Backup
+		err    error
+		code   int
+	}{
+		{"ok", b, nil, 0},
+		{"fail-nil", nil, nil, http.StatusBadRequest},
+		{"fail-version", &Backup{Version: 2}, nil, http.StatusBadRequest},
+		{"fail-checksum", &tampered, nil, http.StatusBadRequest},
+		{"fail-not-empty", b, errors.Wrap(db.ErrAlreadyExists, "table x509_certs is not empty"), http.StatusConflict},
+		{"fail-not-implemented", b, db.ErrNotImplemented, http.StatusNotImplemented},
+		{"fail-import", b, errors.New("force"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a.db = &MockAuthDB{
+				importSnapshot: func(s *db.Snapshot) error {
+					assert.Equals(t, snap, s)
+					return tt.err
+				},
+			}
+			err := a.Restore(tt.backup)
+			if tt.code == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			if assert.NotNil(t, err) {
+				assert.Equals(t, tt.code, err.(*apiError).code)
+			}
+		})
+	}
+}
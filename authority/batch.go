@@ -0,0 +1,21 @@
+package authority
+
+import (
+	"github.com/RTradeLtd/ca-certificates/db"
+)
+
+// WithBatchWriter sets an already started writer of the issued certificates
+// to a new authority. This option is intended to be use on graceful reloads,
+// the asynchronous writes are part of the database configuration that cannot
+// change.
+func WithBatchWriter(w *db.BatchWriter) Option {
+	return func(a *Authority) {
+		a.writer = w
+	}
+}
+
+// GetBatchWriter returns the writer of the issued certificates, or nil if the
+// writes are synchronous.
+func (a *Authority) GetBatchWriter() *db.BatchWriter {
+	return a.writer
+}
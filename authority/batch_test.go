@@ -0,0 +1,47 @@
+package authority
+
+import (
+	"crypto/x509"
+	"math/big"
+	"testing"
+
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/smallstep/assert"
+)
+
+func TestAuthority_storeCertificate_async(t *testing.T) {
+	batches := make(chan []*db.CertificateRecord, 1)
+	var stored []*x509.Certificate
+	mdb := &MockAuthDB{
+		storeCerts: func(records []*db.CertificateRecord) error {
+			batches <- records
+			return nil
+		},
+		storeCertificate: func(crt *x509.Certificate) error {
+			stored = append(stored, crt)
+			return nil
+		},
+		storeCertData: func(sn string, data *db.CertificateData) error {
+			return nil
+		},
+	}
+	a := testAuthority(t)
+	a.db = mdb
+	w := db.NewBatchWriter(&db.AsyncWritesConfig{BatchSize: 1}, mdb)
+	WithBatchWriter(w)(a)
+	assert.True(t, w == a.GetBatchWriter())
+
+	crt := &x509.Certificate{SerialNumber: big.NewInt(1)}
+	assert.FatalError(t, a.storeCertificate(crt, &db.CertificateData{TokenID: "1"}))
+	records := <-batches
+	if assert.Len(t, 1, records) {
+		assert.Equals(t, crt, records[0].Certificate)
+		assert.Equals(t, "1", records[0].Data.TokenID)
+	}
+	assert.Len(t, 0, stored)
+
+	// Certificates are stored synchronously after closing the writer.
+	w.Close()
+	assert.FatalError(t, a.storeCertificate(crt, nil))
+	assert.Equals(t, []*x509.Certificate{crt}, stored)
+}
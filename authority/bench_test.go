@@ -0,0 +1,207 @@
+package authority
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/crypto/keys"
+	"github.com/RTradeLtd/ca-cli/crypto/randutil"
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/smallstep/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// The allocation budgets of the sign path, from the token to the encoded
+// response. They are a bit over the current allocations, so a regression in
+// the SignOption pipeline makes TestSignAllocations fail. Update them if a
+// change adds allocations on purpose.
+const (
+	signAllocsBudget    = 1250
+	signSSHAllocsBudget = 1100
+)
+
+// signBench is an authority ready to sign certificates with the JWK
+// provisioner step-cli, with the SSH CA enabled.
+type signBench struct {
+	a     *Authority
+	jwk   *jose.JSONWebKey
+	csr   *x509.CertificateRequest
+	sshPK ssh.PublicKey
+}
+
+func newSignBench(t testing.TB) *signBench {
+	a := testAuthority(t)
+
+	// Enable the SSH CA on all the provisioners.
+	enabled := true
+	list := a.config.AuthorityConfig.Provisioners
+	for _, p := range list {
+		if jwk, ok := p.(*provisioner.JWK); ok {
+			jwk.Claims = &provisioner.Claims{EnableSSHCA: &enabled}
+		}
+	}
+	assert.FatalError(t, a.ReloadProvisioners(list))
+	signKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	a.sshCAUserCertSignKey = signKey
+	a.sshCAHostCertSignKey = signKey
+	a.sshCAUserSigner, err = newSSHSigner(signKey)
+	assert.FatalError(t, err)
+	a.sshCAHostSigner = a.sshCAUserSigner
+
+	jwk, err := jose.ParseKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+	pub, priv, err := keys.GenerateDefaultKeyPair()
+	assert.FatalError(t, err)
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		DNSNames: []string{"test.smallstep.com"},
+	}, priv)
+	assert.FatalError(t, err)
+	csr, err := x509.ParseCertificateRequest(csrDER)
+	assert.FatalError(t, err)
+	csr.Subject.CommonName = "test.smallstep.com"
+	sshPK, err := ssh.NewPublicKey(pub)
+	assert.FatalError(t, err)
+	return &signBench{a: a, jwk: jwk, csr: csr, sshPK: sshPK}
+}
+
+// tokens returns n tokens for the given step claims, they must be generated
+// in advance because they can only be used once.
+func (s *signBench) tokens(t testing.TB, n int, step map[string]interface{}) []string {
+	sig, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.ES256, Key: s.jwk.Key},
+		new(jose.SignerOptions).WithType("JWT").WithHeader("kid", s.jwk.KeyID),
+	)
+	assert.FatalError(t, err)
+	now := time.Now()
+	tokens := make([]string, n)
+	for i := range tokens {
+		id, err := randutil.ASCII(64)
+		assert.FatalError(t, err)
+		tokens[i], err = jose.Signed(sig).Claims(struct {
+			jose.Claims
+			SANs []string               `json:"sans,omitempty"`
+			Step map[string]interface{} `json:"step,omitempty"`
+		}{
+			Claims: jose.Claims{
+				ID:        id,
+				Subject:   "test.smallstep.com",
+				Issuer:    "step-cli",
+				IssuedAt:  jose.NewNumericDate(now),
+				NotBefore: jose.NewNumericDate(now),
+				Expiry:    jose.NewNumericDate(now.Add(5 * time.Minute)),
+				Audience:  []string{"https://test.ca.smallstep.com/sign"},
+			},
+			SANs: []string{"test.smallstep.com"},
+			Step: step,
+		}).CompactSerialize()
+		assert.FatalError(t, err)
+	}
+	return tokens
+}
+
+// sign authorizes the token, signs the CSR and encodes the response.
+func (s *signBench) sign(t testing.TB, token string) {
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+	opts, err := s.a.Authorize(ctx, token)
+	assert.FatalError(t, err)
+	certs, err := s.a.Sign(ctx, s.csr, provisioner.Options{}, opts...)
+	assert.FatalError(t, err)
+	chain := make([]string, len(certs))
+	for i, crt := range certs {
+		chain[i] = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw}))
+	}
+	_, err = json.Marshal(map[string]interface{}{"crt": chain[0], "ca": chain[1], "certChain": chain})
+	assert.FatalError(t, err)
+}
+
+// signSSH authorizes the token, signs the SSH key and encodes the response.
+func (s *signBench) signSSH(t testing.TB, token string) {
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignSSHMethod)
+	opts, err := s.a.Authorize(ctx, token)
+	assert.FatalError(t, err)
+	cert, err := s.a.SignSSH(ctx, s.sshPK, provisioner.SSHOptions{CertType: "user", Principals: []string{"user"}}, opts...)
+	assert.FatalError(t, err)
+	_, err = json.Marshal(map[string]interface{}{"crt": string(ssh.MarshalAuthorizedKey(cert))})
+	assert.FatalError(t, err)
+}
+
+var sshStep = map[string]interface{}{
+	"ssh": map[string]interface{}{
+		"certType":   "user",
+		"principals": []string{"user"},
+	},
+}
+
+func BenchmarkAuthority_Sign(b *testing.B) {
+	s := newSignBench(b)
+	tokens := s.tokens(b, b.N, nil)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.sign(b, tokens[i])
+	}
+}
+
+func BenchmarkAuthority_Sign_parallel(b *testing.B) {
+	s := newSignBench(b)
+	ch := make(chan string, b.N)
+	for _, tok := range s.tokens(b, b.N, nil) {
+		ch <- tok
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.sign(b, <-ch)
+		}
+	})
+}
+
+func BenchmarkAuthority_SignSSH(b *testing.B) {
+	s := newSignBench(b)
+	tokens := s.tokens(b, b.N, sshStep)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s.signSSH(b, tokens[i])
+	}
+}
+
+func TestSignAllocations(t *testing.T) {
+	const runs = 20
+	s := newSignBench(t)
+
+	tests := []struct {
+		name   string
+		step   map[string]interface{}
+		fn     func(testing.TB, string)
+		budget float64
+	}{
+		{"sign", nil, s.sign, signAllocsBudget},
+		{"sign-ssh", sshStep, s.signSSH, signSSHAllocsBudget},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// AllocsPerRun calls the function one more time to warm up.
+			tokens := s.tokens(t, runs+1, tt.step)
+			var i int
+			allocs := testing.AllocsPerRun(runs, func() {
+				tt.fn(t, tokens[i])
+				i++
+			})
+			t.Logf("%s: %.0f allocations, budget %.0f", tt.name, allocs, tt.budget)
+			if allocs > tt.budget {
+				t.Errorf("%s allocations = %.0f, want <= %.0f", tt.name, allocs, tt.budget)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package authority
+
+import (
+	"github.com/pkg/errors"
+)
+
+// DefaultMaxBodySize is the default maximum size in bytes of the body of the
+// requests to the endpoints without a specific limit.
+const DefaultMaxBodySize = 1 << 20
+
+// DefaultBodyLimits are the default maximum sizes in bytes of the body of the
+// requests to some endpoints. They are large enough for certificate requests
+// with big keys and tokens with certificate chains.
+var DefaultBodyLimits = map[string]int64{
+	"/sign":     256 << 10,
+	"/rekey":    256 << 10,
+	"/sign-ssh": 256 << 10,
+	"/revoke":   64 << 10,
+	"/renew":    64 << 10,
+}
+
+// BodyLimitConfig is the configuration of the maximum size of the body of the
+// requests to the CA API. MaxBodySize is the limit used by the endpoints not
+// in Endpoints, where the key is the route pattern, e.g. /sign.
+type BodyLimitConfig struct {
+	MaxBodySize int64            `json:"maxBodySize,omitempty"`
+	Endpoints   map[string]int64 `json:"endpoints,omitempty"`
+}
+
+// Validate validates the body limits configuration.
+func (c *BodyLimitConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.MaxBodySize < 0 {
+		return errors.New("bodyLimits.maxBodySize cannot be negative")
+	}
+	for path, n := range c.Endpoints {
+		if n <= 0 {
+			return errors.Errorf("bodyLimits.endpoints.%s must be greater than 0", path)
+		}
+	}
+	return nil
+}
+
+// Limit returns the maximum size of the body of the requests to the given
+// route pattern. The default limits of the endpoints never exceed the
+// configured MaxBodySize.
+func (c *BodyLimitConfig) Limit(pattern string) int64 {
+	max := int64(DefaultMaxBodySize)
+	if c != nil {
+		if n, ok := c.Endpoints[pattern]; ok {
+			return n
+		}
+		if c.MaxBodySize > 0 {
+			max = c.MaxBodySize
+		}
+	}
+	if n, ok := DefaultBodyLimits[pattern]; ok && n < max {
+		return n
+	}
+	return max
+}
+
+// GetBodyLimits returns the configuration of the maximum size of the body of
+// the requests. It returns nil if it is not configured and the defaults must
+// be used.
+func (a *Authority) GetBodyLimits() *BodyLimitConfig {
+	return a.config.BodyLimits
+}
@@ -0,0 +1,53 @@
+package authority
+
+import (
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestBodyLimitConfig_Limit(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *BodyLimitConfig
+		pattern string
+		want    int64
+	}{
+		{"nil", nil, "/admin/ca/import", DefaultMaxBodySize},
+		{"nil-endpoint", nil, "/sign", DefaultBodyLimits["/sign"]},
+		{"max", &BodyLimitConfig{MaxBodySize: 2 << 20}, "/admin/ca/import", 2 << 20},
+		{"max-endpoint", &BodyLimitConfig{MaxBodySize: 2 << 20}, "/sign", DefaultBodyLimits["/sign"]},
+		{"max-lower", &BodyLimitConfig{MaxBodySize: 1024}, "/sign", 1024},
+		{"endpoint", &BodyLimitConfig{MaxBodySize: 1024, Endpoints: map[string]int64{"/sign": 4096}}, "/sign", 4096},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equals(t, tt.want, tt.config.Limit(tt.pattern))
+		})
+	}
+}
+
+func TestBodyLimitConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *BodyLimitConfig
+		err    string
+	}{
+		{"nil", nil, ""},
+		{"ok", &BodyLimitConfig{MaxBodySize: 1024, Endpoints: map[string]int64{"/sign": 4096}}, ""},
+		{"fail-max", &BodyLimitConfig{MaxBodySize: -1}, "bodyLimits.maxBodySize cannot be negative"},
+		{"fail-endpoint", &BodyLimitConfig{Endpoints: map[string]int64{"/sign": 0}}, "bodyLimits.endpoints./sign must be greater than 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.err != "" {
+				if assert.NotNil(t, err) {
+					assert.Equals(t, tt.err, err.Error())
+				}
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
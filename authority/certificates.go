@@ -0,0 +1,358 @@
+package authority
+
+import (
+	"crypto/x509"
+	"math/big"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/pkg/errors"
+)
+
+// CertificateStatus is the status of an issued certificate.
+type CertificateStatus string
+
+const (
+	// CertificateActive is the status of a valid certificate.
+	CertificateActive CertificateStatus = "active"
+	// CertificateExpired is the status of a certificate after its NotAfter.
+	CertificateExpired CertificateStatus = "expired"
+	// CertificateRevoked is the status of a revoked certificate.
+	CertificateRevoked CertificateStatus = "revoked"
+)
+
+// DefaultCertificatesLimit is the default limit for listing certificates.
+const DefaultCertificatesLimit = 20
+
+// DefaultCertificatesMax is the maximum limit for listing certificates.
+const DefaultCertificatesMax = 100
+
+// CertificateInfo is an issued certificate with the information known by the
+// authority. Data and Revocation are only set when a single certificate is
+// requested, and they are nil if the information is not available.
+type CertificateInfo struct {
+	Certificate *x509.Certificate
+	Provisioner string
+	Status      CertificateStatus
+	Data        *db.CertificateData
+	Revocation  *db.RevokedCertificateInfo
+}
+
+// certificateDataOption is the sign option used to pass the issuance metadata
+// of the certificate from the authorization of the token to Sign.
+type certificateDataOption struct {
+	data *db.CertificateData
+}
+
+// newCertificateDataOption returns the sign option with the metadata of a
+// certificate authorized with the given provisioner and token. The token must
+// have been validated.
+func newCertificateDataOption(p provisioner.Interface, ott string) certificateDataOption {
+	data := &db.CertificateData{
+		Provisioner: &db.ProvisionerData{
+			ID:   p.GetID(),
+			Name: p.GetName(),
+			Type: p.GetType().String(),
+		},
+	}
+	if token, err := jose.ParseSigned(ott); err == nil {
+		var claims jose.Claims
+		if err := token.UnsafeClaimsWithoutVerification(&claims); err == nil {
+			data.TokenSubject = claims.Subject
+		}
+	}
+	if id, err := p.GetTokenID(ott); err == nil {
+		data.TokenID = id
+	}
+	return certificateDataOption{data: data}
+}
+
+// storeCertificate stores an issued certificate and its issuance metadata. The
+// metadata is completed with the validity of the certificate and, if it is
+// not known, the provisioner in the certificate extension. Nothing is stored
+// if the database does not support certificates. If the writes are
+// asynchronous the certificate is queued and stored later in a batch.
+func (a *Authority) storeCertificate(crt *x509.Certificate, data *db.CertificateData) error {
+	if data == nil {
+		data = new(db.CertificateData)
+	}
+	if data.Provisioner == nil {
+		if p, ok := a.getProvisioners().LoadByCertificate(crt); ok && p.GetType().String() != "" {
+			data.Provisioner = &db.ProvisionerData{
+				ID:   p.GetID(),
+				Name: p.GetName(),
+				Type: p.GetType().String(),
+			}
+		}
+	}
+	data.NotBefore = crt.NotBefore
+	data.NotAfter = crt.NotAfter
+	a.linkInventory(crt)
+
+	// Store it synchronously if the writer is closed.
+	if a.writer != nil {
+		if err := a.writer.Write(&db.CertificateRecord{Certificate: crt, Data: data}); err == nil {
+			return nil
+		}
+	}
+
+	if err := a.db.StoreCertificate(crt); err != nil {
+		if err == db.ErrNotImplemented {
+			return nil
+		}
+		return errors.Wrap(err, "error storing certificate in db")
+	}
+	if err := a.db.StoreCertificateData(crt.SerialNumber.String(), data); err != nil && err != db.ErrNotImplemented {
+		return errors.Wrap(err, "error storing certificate data in db")
+	}
+	return nil
+}
+
+// CertificateFilter contains the conditions that the issued certificates
+// must match. Empty fields are ignored.
+type CertificateFilter struct {
+	SAN           string
+	CommonName    string
+	Provisioner   string
+	Status        CertificateStatus
+	IssuedAfter   time.Time
+	IssuedBefore  time.Time
+	ExpiresBefore time.Time
+}
+
+// matchCertificate returns true if the fields of the certificate known
+// without checking the database match the filter.
+func (f *CertificateFilter) matchCertificate(crt *x509.Certificate, provisionerName string) bool {
+	if f.CommonName != "" && !strings.EqualFold(f.CommonName, crt.Subject.CommonName) {
+		return false
+	}
+	if f.Provisioner != "" && f.Provisioner != provisionerName {
+		return false
+	}
+	if !f.IssuedAfter.IsZero() && crt.NotBefore.Before(f.IssuedAfter) {
+		return false
+	}
+	if !f.IssuedBefore.IsZero() && !crt.NotBefore.Before(f.IssuedBefore) {
+		return false
+	}
+	if !f.ExpiresBefore.IsZero() && !crt.NotAfter.Before(f.ExpiresBefore) {
+		return false
+	}
+	if f.SAN != "" {
+		for _, san := range certificateSANs(crt) {
+			if strings.EqualFold(f.SAN, san) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// findCertificates returns the candidate certificates for the given filter.
+// The SAN and common name indexes are used if the filter has a SAN or a
+// common name, otherwise all the certificates are returned.
+func (a *Authority) findCertificates(filter CertificateFilter) ([]*x509.Certificate, error) {
+	switch {
+	case filter.SAN != "":
+		return a.getReadDB().GetCertificatesBySAN(filter.SAN)
+	case filter.CommonName != "":
+		return a.getReadDB().GetCertificatesByCommonName(filter.CommonName)
+	default:
+		return a.getReadDB().GetCertificates()
+	}
+}
+
+// GetCertificates returns the issued certificates that match the given filter
+// sorted by serial number. The cursor is the serial number of the first
+// certificate to return, and the returned cursor can be used to get the next
+// page.
+func (a *Authority) GetCertificates(filter CertificateFilter, cursor string, limit int) ([]*CertificateInfo, string, error) {
+	errContext := apiCtx{"cursor": cursor, "limit": limit}
+
+	switch filter.Status {
+	case "", CertificateActive, CertificateExpired, CertificateRevoked:
+	default:
+		return nil, "", &apiError{errors.Errorf("getCertificates: unsupported status %s", filter.Status),
+			http.StatusBadRequest, errContext}
+	}
+
+	var start *big.Int
+	if cursor != "" {
+		var ok bool
+		if start, ok = new(big.Int).SetString(cursor, 10); !ok {
+			return nil, "", &apiError{errors.Errorf("getCertificates: invalid cursor %s", cursor),
+				http.StatusBadRequest, errContext}
+		}
+	}
+	switch {
+	case limit <= 0:
+		limit = DefaultCertificatesLimit
+	case limit > DefaultCertificatesMax:
+		limit = DefaultCertificatesMax
+	}
+
+	certs, err := a.findCertificates(filter)
+	switch err {
+	case nil:
+	case db.ErrNotImplemented:
+		return nil, "", &apiError{errors.New("getCertificates: no persistence layer configured"),
+			http.StatusNotImplemented, errContext}
+	default:
+		return nil, "", &apiError{errors.Wrap(err, "getCertificates"),
+			http.StatusInternalServerError, errContext}
+	}
+
+	sort.Slice(certs, func(i, j int) bool {
+		return certs[i].SerialNumber.Cmp(certs[j].SerialNumber) < 0
+	})
+
+	now := time.Now()
+	list := []*CertificateInfo{}
+	for _, crt := range certs {
+		if start != nil && crt.SerialNumber.Cmp(start) < 0 {
+			continue
+		}
+		provisionerName := a.getCertificateProvisionerName(crt)
+		if !filter.matchCertificate(crt, provisionerName) {
+			continue
+		}
+		isRevoked, err := a.getReadDB().IsRevoked(crt.SerialNumber.String())
+		if err != nil {
+			return nil, "", &apiError{errors.Wrap(err, "getCertificates"),
+				http.StatusInternalServerError, errContext}
+		}
+		status := certificateStatus(crt, isRevoked, now)
+		if filter.Status != "" && filter.Status != status {
+			continue
+		}
+		if len(list) == limit {
+			return list, crt.SerialNumber.String(), nil
+		}
+		list = append(list, &CertificateInfo{
+			Certificate: crt,
+			Provisioner: provisionerName,
+			Status:      status,
+		})
+	}
+	return list, "", nil
+}
+
+// GetExpiringCertificates returns the active certificates that match the given
+// filter and expire within the given duration, sorted by expiration date. The
+// status and expiration conditions of the filter are ignored.
+func (a *Authority) GetExpiringCertificates(filter CertificateFilter, within time.Duration) ([]*CertificateInfo, error) {
+	filter.Status = CertificateActive
+	filter.ExpiresBefore = time.Now().Add(within)
+
+	var (
+		cursor string
+		list   = []*CertificateInfo{}
+	)
+	for {
+		page, next, err := a.GetCertificates(filter, cursor, DefaultCertificatesMax)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, page...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].Certificate.NotAfter.Before(list[j].Certificate.NotAfter)
+	})
+	return list, nil
+}
+
+// GetCertificate returns the issued certificate with the given serial number,
+// its issuance metadata and its revocation information.
+func (a *Authority) GetCertificate(serial string) (*CertificateInfo, error) {
+	errContext := apiCtx{"serialNumber": serial}
+
+	crt, err := a.getReadDB().GetCertificate(serial)
+	switch err {
+	case nil:
+	case db.ErrNotFound:
+		return nil, &apiError{errors.Errorf("getCertificate: certificate with serial number %s was not found", serial),
+			http.StatusNotFound, errContext}
+	case db.ErrNotImplemented:
+		return nil, &apiError{errors.New("getCertificate: no persistence layer configured"),
+			http.StatusNotImplemented, errContext}
+	default:
+		return nil, &apiError{errors.Wrap(err, "getCertificate"),
+			http.StatusInternalServerError, errContext}
+	}
+
+	data, err := a.getReadDB().GetCertificateData(serial)
+	if err != nil {
+		return nil, &apiError{errors.Wrap(err, "getCertificate"),
+			http.StatusInternalServerError, errContext}
+	}
+	rci, err := a.getReadDB().GetRevokedCertificateInfo(serial)
+	if err != nil {
+		return nil, &apiError{errors.Wrap(err, "getCertificate"),
+			http.StatusInternalServerError, errContext}
+	}
+
+	ci := &CertificateInfo{
+		Certificate: crt,
+		Status:      certificateStatus(crt, rci != nil, time.Now()),
+		Data:        data,
+		Revocation:  rci,
+	}
+	if data != nil && data.Provisioner != nil {
+		ci.Provisioner = data.Provisioner.Name
+	} else {
+		ci.Provisioner = a.getCertificateProvisionerName(crt)
+	}
+	return ci, nil
+}
+
+// getCertificateProvisionerName returns the name of the provisioner in the
+// provisioner extension of the given certificate. It returns an empty string
+// if the provisioner is not configured or the certificate does not have the
+// extension, in the latter case LoadByCertificate returns a provisioner
+// without type.
+func (a *Authority) getCertificateProvisionerName(crt *x509.Certificate) string {
+	p, ok := a.getProvisioners().LoadByCertificate(crt)
+	if !ok || p.GetType().String() == "" {
+		return ""
+	}
+	return p.GetName()
+}
+
+// certificateStatus returns the status of the given certificate at the given
+// time.
+func certificateStatus(crt *x509.Certificate, isRevoked bool, now time.Time) CertificateStatus {
+	switch {
+	case isRevoked:
+		return CertificateRevoked
+	case now.After(crt.NotAfter):
+		return CertificateExpired
+	default:
+		return CertificateActive
+	}
+}
+
+// certificateSANs returns all the subject alternative names in the given
+// certificate.
+func certificateSANs(crt *x509.Certificate) []string {
+	sans := make([]string, 0, len(crt.DNSNames)+len(crt.EmailAddresses)+len(crt.IPAddresses)+len(crt.URIs))
+	sans = append(sans, crt.DNSNames...)
+	sans = append(sans, crt.EmailAddresses...)
+	for _, ip := range crt.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, u := range crt.URIs {
+		sans = append(sans, u.String())
+	}
+	return sans
+}
@@ -0,0 +1,447 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/RTradeLtd/ca-cli/crypto/keys"
+	"github.com/RTradeLtd/ca-cli/crypto/x509util"
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+func generateIssuedCertificate(t *testing.T, a *Authority, cn, provisionerName string, nb, na time.Time) *x509.Certificate {
+	pub, _, err := keys.GenerateDefaultKeyPair()
+	assert.FatalError(t, err)
+	opts := []x509util.WithOption{
+		x509util.WithNotBeforeAfterDuration(nb, na, 0),
+		x509util.WithPublicKey(pub), x509util.WithHosts(cn),
+	}
+	if provisionerName != "" {
+		p, ok := findProvisionerByName(a.config.AuthorityConfig.Provisioners, provisionerName)
+		assert.Fatal(t, ok, "provisioner %s not found", provisionerName)
+		opts = append(opts, withProvisionerOID(provisionerName, p.(*provisioner.JWK).Key.KeyID))
+	}
+	leaf, err := x509util.NewLeafProfile(cn, a.intermediateIdentity.Crt, a.intermediateIdentity.Key, opts...)
+	assert.FatalError(t, err)
+	crtBytes, err := leaf.CreateCertificate()
+	assert.FatalError(t, err)
+	crt, err := x509.ParseCertificate(crtBytes)
+	assert.FatalError(t, err)
+	return crt
+}
+
+func TestAuthority_GetCertificates(t *testing.T) {
+	a := testAuthority(t)
+	now := time.Now()
+	certs := []*x509.Certificate{
+		generateIssuedCertificate(t, a, "a.smallstep.com", "step-cli", now.Add(-time.Hour), now.Add(time.Hour)),
+		generateIssuedCertificate(t, a, "b.smallstep.com", "step-cli", now.Add(-time.Hour), now.Add(time.Hour)),
+		generateIssuedCertificate(t, a, "c.smallstep.com", "Max", now.Add(-time.Minute), now.Add(time.Hour)),
+		generateIssuedCertificate(t, a, "d.smallstep.com", "", now.Add(-2*time.Hour), now.Add(-time.Hour)),
+	}
+	revoked := certs[1].SerialNumber.String()
+	a.db = &MockAuthDB{
+		getCertificates: func() ([]*x509.Certificate, error) {
+			return append([]*x509.Certificate{}, certs...), nil
+		},
+		isRevoked: func(sn string) (bool, error) {
+			return sn == revoked, nil
+		},
+	}
+
+	tests := []struct {
+		name   string
+		filter CertificateFilter
+		want   []string
+	}{
+		{"all", CertificateFilter{}, []string{"a.smallstep.com", "b.smallstep.com", "c.smallstep.com", "d.smallstep.com"}},
+		{"san", CertificateFilter{SAN: "A.smallstep.com"}, []string{"a.smallstep.com"}},
+		{"common-name", CertificateFilter{CommonName: "c.smallstep.com"}, []string{"c.smallstep.com"}},
+		{"provisioner", CertificateFilter{Provisioner: "step-cli"}, []string{"a.smallstep.com", "b.smallstep.com"}},
+		{"active", CertificateFilter{Status: CertificateActive}, []string{"a.smallstep.com", "c.smallstep.com"}},
+		{"expired", CertificateFilter{Status: CertificateExpired}, []string{"d.smallstep.com"}},
+		{"revoked", CertificateFilter{Status: CertificateRevoked}, []string{"b.smallstep.com"}},
+		{"issued-after", CertificateFilter{IssuedAfter: now.Add(-30 * time.Minute)}, []string{"c.smallstep.com"}},
+		{"issued-before", CertificateFilter{IssuedBefore: now.Add(-30 * time.Minute)}, []string{"a.smallstep.com", "b.smallstep.com", "d.smallstep.com"}},
+		{"expires-before", CertificateFilter{ExpiresBefore: now}, []string{"d.smallstep.com"}},
+		{"no-match", CertificateFilter{SAN: "foo.smallstep.com", Provisioner: "Max"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, next, err := a.GetCertificates(tt.filter, "", 0)
+			assert.FatalError(t, err)
+			assert.Equals(t, "", next)
+			got := []string{}
+			for _, ci := range list {
+				got = append(got, ci.Certificate.Subject.CommonName)
+			}
+			sort.Strings(got)
+			assert.Equals(t, tt.want, got)
+		})
+	}
+
+	t.Run("metadata", func(t *testing.T) {
+		list, _, err := a.GetCertificates(CertificateFilter{SAN: "b.smallstep.com"}, "", 0)
+		assert.FatalError(t, err)
+		if assert.Len(t, 1, list) {
+			assert.Equals(t, certs[1], list[0].Certificate)
+			assert.Equals(t, "step-cli", list[0].Provisioner)
+			assert.Equals(t, CertificateRevoked, list[0].Status)
+		}
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		sorted := append([]*x509.Certificate{}, certs...)
+		sort.Slice(sorted, func(i, j int) bool {
+			return sorted[i].SerialNumber.Cmp(sorted[j].SerialNumber) < 0
+		})
+		var cursor string
+		for i, crt := range sorted {
+			list, next, err := a.GetCertificates(CertificateFilter{}, cursor, 1)
+			assert.FatalError(t, err)
+			if assert.Len(t, 1, list) {
+				assert.Equals(t, crt, list[0].Certificate)
+			}
+			if i < len(sorted)-1 {
+				assert.Equals(t, sorted[i+1].SerialNumber.String(), next)
+			} else {
+				assert.Equals(t, "", next)
+			}
+			cursor = next
+		}
+	})
+
+	t.Run("indexes", func(t *testing.T) {
+		_a := testAuthority(t)
+		_a.db = &MockAuthDB{
+			getCertificates: func() ([]*x509.Certificate, error) {
+				return nil, errors.New("full scan")
+			},
+			getCertsBySAN: func(san string) ([]*x509.Certificate, error) {
+				assert.Equals(t, "A.smallstep.com", san)
+				return []*x509.Certificate{certs[0]}, nil
+			},
+			getCertsByCN: func(cn string) ([]*x509.Certificate, error) {
+				assert.Equals(t, "c.smallstep.com", cn)
+				// Stale entries are filtered out.
+				return []*x509.Certificate{certs[0], certs[2]}, nil
+			},
+			isRevoked: func(sn string) (bool, error) {
+				return false, nil
+			},
+		}
+		list, _, err := _a.GetCertificates(CertificateFilter{SAN: "A.smallstep.com"}, "", 0)
+		assert.FatalError(t, err)
+		if assert.Len(t, 1, list) {
+			assert.Equals(t, certs[0], list[0].Certificate)
+		}
+		list, _, err = _a.GetCertificates(CertificateFilter{CommonName: "c.smallstep.com"}, "", 0)
+		assert.FatalError(t, err)
+		if assert.Len(t, 1, list) {
+			assert.Equals(t, certs[2], list[0].Certificate)
+		}
+	})
+
+	failTests := []struct {
+		name   string
+		db     db.AuthDB
+		filter CertificateFilter
+		cursor string
+		code   int
+	}{
+		{"fail/status", a.db, CertificateFilter{Status: "foo"}, "", http.StatusBadRequest},
+		{"fail/cursor", a.db, CertificateFilter{}, "foo", http.StatusBadRequest},
+		{"fail/not-implemented", &MockAuthDB{err: db.ErrNotImplemented}, CertificateFilter{}, "", http.StatusNotImplemented},
+		{"fail/db", &MockAuthDB{err: errors.New("force")}, CertificateFilter{}, "", http.StatusInternalServerError},
+		{"fail/is-revoked", &MockAuthDB{
+			getCertificates: func() ([]*x509.Certificate, error) {
+				return certs, nil
+			},
+			isRevoked: func(sn string) (bool, error) {
+				return false, errors.New("force")
+			},
+		}, CertificateFilter{}, "", http.StatusInternalServerError},
+	}
+	for _, tt := range failTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_a := testAuthority(t)
+			_a.db = tt.db
+			_, _, err := _a.GetCertificates(tt.filter, tt.cursor, 0)
+			if assert.NotNil(t, err) {
+				if v, ok := err.(*apiError); assert.True(t, ok) {
+					assert.Equals(t, tt.code, v.code)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthority_GetExpiringCertificates(t *testing.T) {
+	a := testAuthority(t)
+	now := time.Now()
+	day := 24 * time.Hour
+	certs := []*x509.Certificate{
+		generateIssuedCertificate(t, a, "a.smallstep.com", "step-cli", now.Add(-day), now.Add(10*day)),
+		generateIssuedCertificate(t, a, "b.smallstep.com", "Max", now.Add(-day), now.Add(2*day)),
+		generateIssuedCertificate(t, a, "c.smallstep.com", "step-cli", now.Add(-day), now.Add(40*day)),
+		generateIssuedCertificate(t, a, "d.smallstep.com", "step-cli", now.Add(-2*day), now.Add(-day)),
+		generateIssuedCertificate(t, a, "e.smallstep.com", "step-cli", now.Add(-day), now.Add(day)),
+	}
+	revoked := certs[4].SerialNumber.String()
+	a.db = &MockAuthDB{
+		getCertificates: func() ([]*x509.Certificate, error) {
+			return append([]*x509.Certificate{}, certs...), nil
+		},
+		isRevoked: func(sn string) (bool, error) {
+			return sn == revoked, nil
+		},
+	}
+
+	tests := []struct {
+		name   string
+		filter CertificateFilter
+		within time.Duration
+		want   []string
+	}{
+		{"ok", CertificateFilter{}, 30 * day, []string{"b.smallstep.com", "a.smallstep.com"}},
+		{"ok/within", CertificateFilter{}, 5 * day, []string{"b.smallstep.com"}},
+		{"ok/ignore-status", CertificateFilter{Status: CertificateExpired}, 60 * day, []string{"b.smallstep.com", "a.smallstep.com", "c.smallstep.com"}},
+		{"ok/provisioner", CertificateFilter{Provisioner: "step-cli"}, 30 * day, []string{"a.smallstep.com"}},
+		{"ok/san", CertificateFilter{SAN: "b.smallstep.com"}, 30 * day, []string{"b.smallstep.com"}},
+		{"ok/none", CertificateFilter{}, time.Hour, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := a.GetExpiringCertificates(tt.filter, tt.within)
+			assert.FatalError(t, err)
+			got := []string{}
+			for _, ci := range list {
+				got = append(got, ci.Certificate.Subject.CommonName)
+				assert.Equals(t, CertificateActive, ci.Status)
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+
+	a.db = &MockAuthDB{err: db.ErrNotImplemented}
+	_, err := a.GetExpiringCertificates(CertificateFilter{}, day)
+	if assert.NotNil(t, err) {
+		if v, ok := err.(*apiError); assert.True(t, ok) {
+			assert.Equals(t, http.StatusNotImplemented, v.code)
+		}
+	}
+}
+
+func TestAuthority_Sign_certificateData(t *testing.T) {
+	_, priv, err := keys.GenerateDefaultKeyPair()
+	assert.FatalError(t, err)
+	jwk, err := jose.ParseKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+
+	var (
+		storedSerial string
+		storedData   *db.CertificateData
+		stats        []string
+	)
+	a := testAuthority(t)
+	a.db = &MockAuthDB{
+		useToken: func(id, tok string) (bool, error) {
+			return true, nil
+		},
+		storeCertData: func(sn string, data *db.CertificateData) error {
+			storedSerial, storedData = sn, data
+			return nil
+		},
+		incrementStats: func(t time.Time, provisioner, event string) error {
+			stats = append(stats, provisioner+"/"+event)
+			return nil
+		},
+	}
+
+	token, err := generateToken("smallstep test", "step-cli", "https://test.ca.smallstep.com/sign",
+		[]string{"test.smallstep.com"}, time.Now(), jwk)
+	assert.FatalError(t, err)
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+	signOpts, err := a.Authorize(ctx, token)
+	assert.FatalError(t, err)
+	certChain, err := a.Sign(context.Background(), getCSR(t, priv), provisioner.Options{}, signOpts...)
+	assert.FatalError(t, err)
+
+	p, ok := findProvisionerByName(a.config.AuthorityConfig.Provisioners, "step-cli")
+	assert.Fatal(t, ok)
+	tokenID, err := p.GetTokenID(token)
+	assert.FatalError(t, err)
+	assert.Equals(t, certChain[0].SerialNumber.String(), storedSerial)
+	assert.Equals(t, &db.CertificateData{
+		Provisioner:  &db.ProvisionerData{ID: p.GetID(), Name: "step-cli", Type: "JWK"},
+		TokenSubject: "smallstep test",
+		TokenID:      tokenID,
+		NotBefore:    certChain[0].NotBefore,
+		NotAfter:     certChain[0].NotAfter,
+	}, storedData)
+	assert.Equals(t, []string{"step-cli/issued"}, stats)
+
+	// Errors storing the data are reported.
+	a.db = &MockAuthDB{
+		useToken: func(id, tok string) (bool, error) {
+			return true, nil
+		},
+		storeCertData: func(sn string, data *db.CertificateData) error {
+			return errors.New("force")
+		},
+	}
+	_, err = a.Sign(context.Background(), getCSR(t, priv), provisioner.Options{}, signOpts...)
+	if assert.NotNil(t, err) {
+		if v, ok := err.(*apiError); assert.True(t, ok) {
+			assert.Equals(t, http.StatusInternalServerError, v.code)
+		}
+	}
+}
+
+func TestAuthority_Renew_certificateData(t *testing.T) {
+	_, priv, err := keys.GenerateDefaultKeyPair()
+	assert.FatalError(t, err)
+	jwk, err := jose.ParseKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+
+	stored := map[string]*db.CertificateData{}
+	a := testAuthority(t)
+	a.db = &MockAuthDB{
+		useToken: func(id, tok string) (bool, error) {
+			return true, nil
+		},
+		isRevoked: func(sn string) (bool, error) {
+			return false, nil
+		},
+		storeCertData: func(sn string, data *db.CertificateData) error {
+			stored[sn] = data
+			return nil
+		},
+		getCertData: func(sn string) (*db.CertificateData, error) {
+			return stored[sn], nil
+		},
+	}
+
+	token, err := generateToken("smallstep test", "step-cli", "https://test.ca.smallstep.com/sign",
+		[]string{"test.smallstep.com"}, time.Now(), jwk)
+	assert.FatalError(t, err)
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+	signOpts, err := a.Authorize(ctx, token)
+	assert.FatalError(t, err)
+	certChain, err := a.Sign(context.Background(), getCSR(t, priv), provisioner.Options{}, signOpts...)
+	assert.FatalError(t, err)
+	oldSerial := certChain[0].SerialNumber.String()
+
+	certChain, err = a.Renew(context.Background(), certChain[0])
+	assert.FatalError(t, err)
+	p, ok := findProvisionerByName(a.config.AuthorityConfig.Provisioners, "step-cli")
+	assert.Fatal(t, ok)
+	assert.Equals(t, &db.CertificateData{
+		Provisioner:  &db.ProvisionerData{ID: p.GetID(), Name: "step-cli", Type: "JWK"},
+		TokenSubject: "smallstep test",
+		NotBefore:    certChain[0].NotBefore,
+		NotAfter:     certChain[0].NotAfter,
+		RenewedFrom:  oldSerial,
+	}, stored[certChain[0].SerialNumber.String()])
+}
+
+func TestAuthority_GetCertificate(t *testing.T) {
+	a := testAuthority(t)
+	now := time.Now()
+	crt := generateIssuedCertificate(t, a, "a.smallstep.com", "step-cli", now.Add(-time.Hour), now.Add(time.Hour))
+	expired := generateIssuedCertificate(t, a, "b.smallstep.com", "", now.Add(-2*time.Hour), now.Add(-time.Hour))
+	serial := crt.SerialNumber.String()
+	data := &db.CertificateData{
+		Provisioner:  &db.ProvisionerData{ID: "id", Name: "foo", Type: "JWK"},
+		TokenSubject: "a.smallstep.com",
+	}
+	rci := &db.RevokedCertificateInfo{Serial: serial, Reason: "key compromise"}
+
+	tests := []struct {
+		name string
+		db   *MockAuthDB
+		want *CertificateInfo
+		code int
+	}{
+		{"ok", &MockAuthDB{
+			getCertificate: func(sn string) (*x509.Certificate, error) {
+				assert.Equals(t, serial, sn)
+				return crt, nil
+			},
+			getCertData: func(sn string) (*db.CertificateData, error) {
+				return data, nil
+			},
+			getRevokedInfo: func(sn string) (*db.RevokedCertificateInfo, error) {
+				return nil, nil
+			},
+		}, &CertificateInfo{Certificate: crt, Provisioner: "foo", Status: CertificateActive, Data: data}, 0},
+		{"ok/revoked-without-data", &MockAuthDB{
+			getCertificate: func(sn string) (*x509.Certificate, error) {
+				return crt, nil
+			},
+			getCertData: func(sn string) (*db.CertificateData, error) {
+				return nil, nil
+			},
+			getRevokedInfo: func(sn string) (*db.RevokedCertificateInfo, error) {
+				return rci, nil
+			},
+		}, &CertificateInfo{Certificate: crt, Provisioner: "step-cli", Status: CertificateRevoked, Revocation: rci}, 0},
+		{"ok/expired", &MockAuthDB{
+			getCertificate: func(sn string) (*x509.Certificate, error) {
+				return expired, nil
+			},
+			getCertData: func(sn string) (*db.CertificateData, error) {
+				return nil, nil
+			},
+			getRevokedInfo: func(sn string) (*db.RevokedCertificateInfo, error) {
+				return nil, nil
+			},
+		}, &CertificateInfo{Certificate: expired, Status: CertificateExpired}, 0},
+		{"fail/not-found", &MockAuthDB{err: db.ErrNotFound}, nil, http.StatusNotFound},
+		{"fail/not-implemented", &MockAuthDB{err: db.ErrNotImplemented}, nil, http.StatusNotImplemented},
+		{"fail/db", &MockAuthDB{err: errors.New("force")}, nil, http.StatusInternalServerError},
+		{"fail/data", &MockAuthDB{
+			getCertificate: func(sn string) (*x509.Certificate, error) {
+				return crt, nil
+			},
+			getCertData: func(sn string) (*db.CertificateData, error) {
+				return nil, errors.New("force")
+			},
+		}, nil, http.StatusInternalServerError},
+		{"fail/revoked-info", &MockAuthDB{
+			getCertificate: func(sn string) (*x509.Certificate, error) {
+				return crt, nil
+			},
+			getCertData: func(sn string) (*db.CertificateData, error) {
+				return nil, nil
+			},
+			getRevokedInfo: func(sn string) (*db.RevokedCertificateInfo, error) {
+				return nil, errors.New("force")
+			},
+		}, nil, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a.db = tt.db
+			got, err := a.GetCertificate(serial)
+			if tt.code != 0 {
+				if assert.NotNil(t, err) {
+					if v, ok := err.(*apiError); assert.True(t, ok) {
+						assert.Equals(t, tt.code, v.code)
+					}
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
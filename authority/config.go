@@ -3,12 +3,18 @@ package authority
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net"
 	"os"
 	"time"
 
+	"github.com/RTradeLtd/ca-certificates/audit"
 	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/configsource"
 	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/RTradeLtd/ca-certificates/events"
+	"github.com/RTradeLtd/ca-certificates/federation"
+	"github.com/RTradeLtd/ca-certificates/notify"
 	"github.com/RTradeLtd/ca-cli/crypto/tlsutil"
 	"github.com/RTradeLtd/ca-cli/crypto/x509util"
 	"github.com/pkg/errors"
@@ -30,17 +36,20 @@ var (
 	defaultDisableRenewal   = false
 	defaultEnableSSHCA      = false
 	globalProvisionerClaims = provisioner.Claims{
-		MinTLSDur:         &provisioner.Duration{Duration: 5 * time.Minute}, // TLS certs
-		MaxTLSDur:         &provisioner.Duration{Duration: 24 * time.Hour},
-		DefaultTLSDur:     &provisioner.Duration{Duration: 24 * time.Hour},
-		DisableRenewal:    &defaultDisableRenewal,
-		MinUserSSHDur:     &provisioner.Duration{Duration: 5 * time.Minute}, // User SSH certs
-		MaxUserSSHDur:     &provisioner.Duration{Duration: 24 * time.Hour},
-		DefaultUserSSHDur: &provisioner.Duration{Duration: 4 * time.Hour},
-		MinHostSSHDur:     &provisioner.Duration{Duration: 5 * time.Minute}, // Host SSH certs
-		MaxHostSSHDur:     &provisioner.Duration{Duration: 30 * 24 * time.Hour},
-		DefaultHostSSHDur: &provisioner.Duration{Duration: 30 * 24 * time.Hour},
-		EnableSSHCA:       &defaultEnableSSHCA,
+		MinTLSDur:          &provisioner.Duration{Duration: 5 * time.Minute}, // TLS certs
+		MaxTLSDur:          &provisioner.Duration{Duration: 24 * time.Hour},
+		DefaultTLSDur:      &provisioner.Duration{Duration: 24 * time.Hour},
+		DisableRenewal:     &defaultDisableRenewal,
+		RenewalGracePeriod: &provisioner.Duration{Duration: 0},
+		RenewalWindow:      &provisioner.Duration{Duration: 0},
+		ClockSkew:          &provisioner.Duration{Duration: provisioner.DefaultClockSkew},
+		MinUserSSHDur:      &provisioner.Duration{Duration: 5 * time.Minute}, // User SSH certs
+		MaxUserSSHDur:      &provisioner.Duration{Duration: 24 * time.Hour},
+		DefaultUserSSHDur:  &provisioner.Duration{Duration: 4 * time.Hour},
+		MinHostSSHDur:      &provisioner.Duration{Duration: 5 * time.Minute}, // Host SSH certs
+		MaxHostSSHDur:      &provisioner.Duration{Duration: 30 * 24 * time.Hour},
+		DefaultHostSSHDur:  &provisioner.Duration{Duration: 30 * 24 * time.Hour},
+		EnableSSHCA:        &defaultEnableSSHCA,
 	}
 )
 
@@ -48,25 +57,67 @@ var (
 type Config struct {
 	Root             multiString         `json:"root"`
 	FederatedRoots   []string            `json:"federatedRoots"`
+	Federation       *federation.Config  `json:"federation,omitempty"`
 	IntermediateCert string              `json:"crt"`
 	IntermediateKey  string              `json:"key"`
 	Address          string              `json:"address"`
+	GRPCAddress      string              `json:"grpcAddress,omitempty"`
+	MetricsAddress   string              `json:"metricsAddress,omitempty"`
+	DebugAddress     string              `json:"debugAddress,omitempty"`
+	UnixSocket       *UnixSocketConfig   `json:"unixSocket,omitempty"`
+	InsecureAddress  string              `json:"insecureAddress,omitempty"`
+	ACMEChallengeDir string              `json:"acmeChallengeDir,omitempty"`
 	DNSNames         []string            `json:"dnsNames"`
 	SSH              *SSHConfig          `json:"ssh,omitempty"`
 	Logger           json.RawMessage     `json:"logger,omitempty"`
 	DB               *db.Config          `json:"db,omitempty"`
 	Monitoring       json.RawMessage     `json:"monitoring,omitempty"`
+	Events           *events.Config      `json:"events,omitempty"`
+	Audit            *audit.Config       `json:"audit,omitempty"`
+	Notifications    *notify.Config      `json:"notifications,omitempty"`
+	CRL              *CRLConfig          `json:"crl,omitempty"`
+	CacheControl     string              `json:"cacheControl,omitempty"`
+	RateLimit        *RateLimitConfig    `json:"rateLimit,omitempty"`
+	CORS             *CORSConfig         `json:"cors,omitempty"`
+	BodyLimits       *BodyLimitConfig    `json:"bodyLimits,omitempty"`
+	Timeouts         *TimeoutConfig      `json:"timeouts,omitempty"`
+	Signer           *SignerConfig       `json:"signer,omitempty"`
+	HTTP             *HTTPConfig         `json:"http,omitempty"`
 	AuthorityConfig  *AuthConfig         `json:"authority,omitempty"`
 	TLS              *tlsutil.TLSOptions `json:"tls,omitempty"`
+	ServerTLS        *ServerTLSConfig    `json:"serverTLS,omitempty"`
+	SDS              *SDSConfig          `json:"sds,omitempty"`
+	WorkloadAPI      *WorkloadAPIConfig  `json:"workloadAPI,omitempty"`
+	Kubernetes       *KubernetesConfig   `json:"kubernetes,omitempty"`
+	Tenants          []*TenantConfig     `json:"tenants,omitempty"`
 	Password         string              `json:"password,omitempty"`
 }
 
 // AuthConfig represents the configuration options for the authority.
 type AuthConfig struct {
-	Provisioners         provisioner.List    `json:"provisioners"`
-	Template             *x509util.ASN1DN    `json:"template,omitempty"`
-	Claims               *provisioner.Claims `json:"claims,omitempty"`
-	DisableIssuedAtCheck bool                `json:"disableIssuedAtCheck,omitempty"`
+	Provisioners         provisioner.List     `json:"provisioners"`
+	Template             *x509util.ASN1DN     `json:"template,omitempty"`
+	Claims               *provisioner.Claims  `json:"claims,omitempty"`
+	DisableIssuedAtCheck bool                 `json:"disableIssuedAtCheck,omitempty"`
+	Admin                *AdminConfig         `json:"admin,omitempty"`
+	Approval             *ApprovalConfig      `json:"approval,omitempty"`
+	Mint                 *MintConfig          `json:"mint,omitempty"`
+	IssuerExpiry         string               `json:"issuerExpiry,omitempty"`
+	KeyGeneration        *KeyGenerationConfig `json:"keyGeneration,omitempty"`
+	SignOptions          []*SignOptionConfig  `json:"signOptions,omitempty"`
+	JWTSVID              *JWTSVIDConfig       `json:"jwtSVID,omitempty"`
+	Nonce                *NonceConfig         `json:"nonce,omitempty"`
+	ShortLived           *ShortLivedConfig    `json:"shortLived,omitempty"`
+}
+
+// globalClaims returns the default claims of the authority, the short-lived
+// mode relaxes the minimum duration of the certificates.
+func (c *AuthConfig) globalClaims() provisioner.Claims {
+	global := globalProvisionerClaims
+	if c != nil && c.ShortLived != nil && c.ShortLived.MinCertDuration != nil {
+		global.MinTLSDur = c.ShortLived.MinCertDuration
+	}
+	return global
 }
 
 // Validate validates the authority configuration.
@@ -78,27 +129,78 @@ func (c *AuthConfig) Validate(audiences provisioner.Audiences) error {
 		return errors.New("authority.provisioners cannot be empty")
 	}
 
+	if err := c.ShortLived.Validate(); err != nil {
+		return err
+	}
+
 	// Merge global and configuration claims
-	claimer, err := provisioner.NewClaimer(c.Claims, globalProvisionerClaims)
+	claimer, err := provisioner.NewClaimer(c.Claims, c.globalClaims())
 	if err != nil {
 		return err
 	}
 
-	// Initialize provisioners
 	config := provisioner.Config{
 		Claims:    claimer.Claims(),
 		Audiences: audiences,
 	}
+	// Initialize provisioners concurrently, a provisioner repeated in the list
+	// is only initialized once.
+	var (
+		list  provisioner.List
+		items []string
+		seen  = make(map[provisioner.Interface]bool)
+	)
 	for _, p := range c.Provisioners {
-		if err := p.Init(config); err != nil {
-			return err
+		if !seen[p] {
+			seen[p] = true
+			list = append(list, p)
+			items = append(items, "provisioner "+p.GetName())
 		}
 	}
+	if err := loadConcurrently(items, func(i int) error {
+		return list[i].Init(config)
+	}); err != nil {
+		return err
+	}
 
 	if c.Template == nil {
 		c.Template = &x509util.ASN1DN{}
 	}
-	return nil
+
+	switch c.IssuerExpiry {
+	case "", IssuerExpiryTruncate, IssuerExpiryReject:
+	default:
+		return errors.Errorf("authority.issuerExpiry %s is not valid, it must be %s or %s",
+			c.IssuerExpiry, IssuerExpiryTruncate, IssuerExpiryReject)
+	}
+
+	if err := c.Admin.Validate(c.Provisioners); err != nil {
+		return err
+	}
+	if c.Approval != nil && c.Admin == nil {
+		return errors.New("authority.approval requires authority.admin")
+	}
+	if err := c.Approval.Validate(c.Provisioners); err != nil {
+		return err
+	}
+	if err := c.KeyGeneration.Validate(c.Provisioners, c.Approval); err != nil {
+		return err
+	}
+	for i, o := range c.SignOptions {
+		if err := o.Validate(i, c.Provisioners); err != nil {
+			return err
+		}
+	}
+	if err := c.JWTSVID.Validate(c.Provisioners); err != nil {
+		return err
+	}
+	if err := c.Nonce.Validate(c.Provisioners); err != nil {
+		return err
+	}
+	if c.Mint != nil && c.Admin == nil {
+		return errors.New("authority.mint requires authority.admin")
+	}
+	return c.Mint.Validate(c.Provisioners, c.Admin)
 }
 
 // SSHConfig contains the user and host keys.
@@ -109,8 +211,245 @@ type SSHConfig struct {
 	AddUserCommand   string `json:"addUserCommand"`
 }
 
+// AdminConfig contains the provisioners that can be used to authenticate
+// requests to the admin api.
+type AdminConfig struct {
+	Provisioners     []string              `json:"provisioners"`
+	MaxTokenLifetime *provisioner.Duration `json:"maxTokenLifetime,omitempty"`
+	SSO              *AdminSSOConfig       `json:"sso,omitempty"`
+}
+
+// Validate validates the admin configuration and sets the default values.
+func (c *AdminConfig) Validate(provisioners provisioner.List) error {
+	if c == nil {
+		return nil
+	}
+	if len(c.Provisioners) == 0 && c.SSO == nil {
+		return errors.New("authority.admin.provisioners cannot be empty")
+	}
+	for _, name := range c.Provisioners {
+		p, ok := findProvisionerByName(provisioners, name)
+		if !ok {
+			return errors.Errorf("authority.admin.provisioners: provisioner %s not found", name)
+		}
+		if _, ok := p.(provisioner.AdminAuthorizer); !ok {
+			return errors.Errorf("authority.admin.provisioners: provisioner %s of type %s cannot be an admin provisioner",
+				name, p.GetType())
+		}
+	}
+	if c.MaxTokenLifetime == nil {
+		c.MaxTokenLifetime = &provisioner.Duration{Duration: defaultAdminTokenLifetime}
+	} else if c.MaxTokenLifetime.Duration <= 0 {
+		return errors.New("authority.admin.maxTokenLifetime must be greater than 0")
+	}
+	return c.SSO.Validate(provisioners)
+}
+
+// hasProvisioner returns true if the provisioner with the given name is an
+// admin provisioner.
+func (c *AdminConfig) hasProvisioner(name string) bool {
+	if c == nil {
+		return false
+	}
+	for _, n := range c.Provisioners {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminSSOConfig allows to authenticate the admin requests with the ID tokens
+// of the users of an OIDC provisioner, mapping the groups of the users to
+// admin roles.
+type AdminSSOConfig struct {
+	Provisioner string               `json:"provisioner"`
+	Groups      map[string]AdminRole `json:"groups"`
+}
+
+// Validate validates the admin single sign-on configuration.
+func (c *AdminSSOConfig) Validate(provisioners provisioner.List) error {
+	if c == nil {
+		return nil
+	}
+	if c.Provisioner == "" {
+		return errors.New("authority.admin.sso.provisioner cannot be empty")
+	}
+	p, ok := findProvisionerByName(provisioners, c.Provisioner)
+	if !ok {
+		return errors.Errorf("authority.admin.sso.provisioner: provisioner %s not found", c.Provisioner)
+	}
+	if _, ok := p.(*provisioner.OIDC); !ok {
+		return errors.Errorf("authority.admin.sso.provisioner: provisioner %s of type %s is not an OIDC provisioner",
+			c.Provisioner, p.GetType())
+	}
+	if len(c.Groups) == 0 {
+		return errors.New("authority.admin.sso.groups cannot be empty")
+	}
+	for group, role := range c.Groups {
+		if !role.isValid() {
+			return errors.Errorf("authority.admin.sso.groups: unsupported role %s of group %s", role, group)
+		}
+	}
+	return nil
+}
+
+// ApprovalConfig contains the provisioners whose certificate requests must be
+// approved by an admin before the certificate is issued. TTL is the time a
+// request waits for a decision, and the time its result is kept after it,
+// and MaxPending the number of requests of each provisioner that can wait at
+// the same time.
+type ApprovalConfig struct {
+	Provisioners []string              `json:"provisioners"`
+	TTL          *provisioner.Duration `json:"ttl,omitempty"`
+	MaxPending   int                   `json:"maxPending,omitempty"`
+}
+
+// Validate validates the approval configuration.
+func (c *ApprovalConfig) Validate(provisioners provisioner.List) error {
+	if c == nil {
+		return nil
+	}
+	if len(c.Provisioners) == 0 {
+		return errors.New("authority.approval.provisioners cannot be empty")
+	}
+	for _, name := range c.Provisioners {
+		if _, ok := findProvisionerByName(provisioners, name); !ok {
+			return errors.Errorf("authority.approval.provisioners: provisioner %s not found", name)
+		}
+	}
+	if c.TTL != nil && c.TTL.Duration <= 0 {
+		return errors.New("authority.approval.ttl must be greater than 0")
+	}
+	if c.MaxPending < 0 {
+		return errors.New("authority.approval.maxPending cannot be negative")
+	}
+	return nil
+}
+
+// ttl returns the lifetime of the pending requests.
+func (c *ApprovalConfig) ttl() time.Duration {
+	if c == nil || c.TTL == nil {
+		return defaultApprovalTTL
+	}
+	return c.TTL.Duration
+}
+
+// maxPending returns the number of requests of a provisioner that can wait
+// for a decision.
+func (c *ApprovalConfig) maxPending() int {
+	if c == nil || c.MaxPending == 0 {
+		return defaultApprovalMaxPending
+	}
+	return c.MaxPending
+}
+
+// KeyGenerationConfig contains the provisioners whose sign requests can ask
+// the authority to generate the key of the certificate.
+type KeyGenerationConfig struct {
+	Provisioners []string `json:"provisioners"`
+}
+
+// Validate validates the key generation configuration. The provisioners that
+// require approval cannot be used, the generated keys are only returned with
+// the certificate.
+func (c *KeyGenerationConfig) Validate(provisioners provisioner.List, approval *ApprovalConfig) error {
+	if c == nil {
+		return nil
+	}
+	if len(c.Provisioners) == 0 {
+		return errors.New("authority.keyGeneration.provisioners cannot be empty")
+	}
+	for _, name := range c.Provisioners {
+		if _, ok := findProvisionerByName(provisioners, name); !ok {
+			return errors.Errorf("authority.keyGeneration.provisioners: provisioner %s not found", name)
+		}
+		if approval != nil {
+			for _, n := range approval.Provisioners {
+				if n == name {
+					return errors.Errorf("authority.keyGeneration.provisioners: provisioner %s requires approval", name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// SignOptionConfig adds a sign option registered with
+// provisioner.RegisterSignOption to the sign requests of some provisioners, or
+// of all of them if the list of provisioners is empty.
+type SignOptionConfig struct {
+	Name         string          `json:"name"`
+	Provisioners []string        `json:"provisioners,omitempty"`
+	Options      json.RawMessage `json:"options,omitempty"`
+}
+
+// Validate validates the sign option in the given position of the list.
+func (c *SignOptionConfig) Validate(i int, provisioners provisioner.List) error {
+	if c == nil {
+		return errors.Errorf("authority.signOptions[%d] cannot be empty", i)
+	}
+	if c.Name == "" {
+		return errors.Errorf("authority.signOptions[%d].name cannot be empty", i)
+	}
+	for _, name := range c.Provisioners {
+		if _, ok := findProvisionerByName(provisioners, name); !ok {
+			return errors.Errorf("authority.signOptions[%d].provisioners: provisioner %s not found", i, name)
+		}
+	}
+	if _, _, err := provisioner.NewSignOption(c.Name, c.Options); err != nil {
+		return errors.Wrapf(err, "authority.signOptions[%d]", i)
+	}
+	return nil
+}
+
+// MintConfig contains the JWK provisioners whose keys can be used by the
+// authority to mint one-time tokens.
+type MintConfig struct {
+	Provisioners []*MintProvisioner `json:"provisioners"`
+}
+
+// MintProvisioner contains the name of a JWK provisioner and the password used
+// to decrypt its encrypted key.
+type MintProvisioner struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+// Validate validates the mint configuration. The admin provisioners cannot be
+// used to mint tokens, the certificates signed with them would be admin
+// certificates.
+func (c *MintConfig) Validate(provisioners provisioner.List, admin *AdminConfig) error {
+	if c == nil {
+		return nil
+	}
+	if len(c.Provisioners) == 0 {
+		return errors.New("authority.mint.provisioners cannot be empty")
+	}
+	for _, mp := range c.Provisioners {
+		if mp == nil || mp.Name == "" {
+			return errors.New("authority.mint.provisioners: name cannot be empty")
+		}
+		p, ok := findProvisionerByName(provisioners, mp.Name)
+		if !ok {
+			return errors.Errorf("authority.mint.provisioners: provisioner %s not found", mp.Name)
+		}
+		if admin.hasProvisioner(mp.Name) {
+			return errors.Errorf("authority.mint.provisioners: provisioner %s is an admin provisioner", mp.Name)
+		}
+		if p.GetType() != provisioner.TypeJWK {
+			return errors.Errorf("authority.mint.provisioners: provisioner %s is not a JWK provisioner", mp.Name)
+		}
+		if _, _, ok := p.GetEncryptedKey(); !ok {
+			return errors.Errorf("authority.mint.provisioners: provisioner %s does not have an encrypted key", mp.Name)
+		}
+	}
+	return nil
+}
+
 // LoadConfiguration parses the given filename in JSON format and returns the
-// configuration struct.
+// configuration struct. The references to environment variables, Consul keys
+// and Vault secrets in the file are replaced by their values.
 func LoadConfiguration(filename string) (*Config, error) {
 	f, err := os.Open(filename)
 	if err != nil {
@@ -118,8 +457,22 @@ func LoadConfiguration(filename string) (*Config, error) {
 	}
 	defer f.Close()
 
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", filename)
+	}
+	if refs := configsource.References(b); len(refs) > 0 {
+		resolver, err := configsource.NewResolver()
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s", filename)
+		}
+		if b, err = resolver.Resolve(b); err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s", filename)
+		}
+	}
+
 	var c Config
-	if err := json.NewDecoder(f).Decode(&c); err != nil {
+	if err := json.Unmarshal(b, &c); err != nil {
 		return nil, errors.Wrapf(err, "error parsing %s", filename)
 	}
 
@@ -162,6 +515,44 @@ func (c *Config) Validate() error {
 	if _, _, err := net.SplitHostPort(c.Address); err != nil {
 		return errors.Errorf("invalid address %s", c.Address)
 	}
+	if c.GRPCAddress != "" {
+		if _, _, err := net.SplitHostPort(c.GRPCAddress); err != nil {
+			return errors.Errorf("invalid grpcAddress %s", c.GRPCAddress)
+		}
+	}
+	if c.DebugAddress != "" {
+		if _, _, err := net.SplitHostPort(c.DebugAddress); err != nil {
+			return errors.Errorf("invalid debugAddress %s", c.DebugAddress)
+		}
+		// The debug endpoints are only available to admins.
+		if c.AuthorityConfig != nil && c.AuthorityConfig.Admin == nil {
+			return errors.New("debugAddress requires authority.admin")
+		}
+	}
+	if err := c.UnixSocket.Validate(); err != nil {
+		return err
+	}
+	if c.UnixSocket != nil && c.UnixSocket.AdminOnly && c.AuthorityConfig != nil && c.AuthorityConfig.Admin == nil {
+		return errors.New("unixSocket.adminOnly requires authority.admin")
+	}
+	if c.InsecureAddress != "" {
+		if _, _, err := net.SplitHostPort(c.InsecureAddress); err != nil {
+			return errors.Errorf("invalid insecureAddress %s", c.InsecureAddress)
+		}
+	}
+	// The challenges are only served on the insecure address.
+	if c.ACMEChallengeDir != "" && c.InsecureAddress == "" {
+		return errors.New("acmeChallengeDir requires insecureAddress")
+	}
+	if err := c.SDS.Validate(c); err != nil {
+		return err
+	}
+	if err := c.WorkloadAPI.Validate(c); err != nil {
+		return err
+	}
+	if err := c.Kubernetes.Validate(c); err != nil {
+		return err
+	}
 
 	if c.TLS == nil {
 		c.TLS = &DefaultTLSOptions
@@ -180,6 +571,101 @@ func (c *Config) Validate() error {
 		}
 		c.TLS.Renegotiation = c.TLS.Renegotiation || DefaultTLSOptions.Renegotiation
 	}
+	if err := c.TLS.MinVersion.Validate(); err != nil {
+		return errors.Wrap(err, "tls minVersion is not valid")
+	}
+	if err := c.TLS.MaxVersion.Validate(); err != nil {
+		return errors.Wrap(err, "tls maxVersion is not valid")
+	}
+	if err := c.TLS.CipherSuites.Validate(); err != nil {
+		return errors.Wrap(err, "tls cipherSuites is not valid")
+	}
+	if err := c.ServerTLS.Validate(c.TLS); err != nil {
+		return err
+	}
+
+	if err := c.Events.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Audit.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Notifications.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Federation.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.CRL.Validate(); err != nil {
+		return err
+	}
+	if c.CRL != nil && c.DB == nil {
+		return errors.New("crl requires a database")
+	}
+
+	if c.DB != nil {
+		if err := c.DB.Retention.Validate(); err != nil {
+			return err
+		}
+		if err := c.DB.Encryption.Validate(); err != nil {
+			return err
+		}
+		if err := c.DB.AsyncWrites.Validate(); err != nil {
+			return err
+		}
+		if err := c.DB.Pool.Validate(); err != nil {
+			return err
+		}
+		if err := c.DB.ReadReplica.Validate(); err != nil {
+			return err
+		}
+		if err := db.ValidateTablePrefix(c.DB.TablePrefix); err != nil {
+			return err
+		}
+	}
+
+	if err := c.RateLimit.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.CORS.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Signer.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.BodyLimits.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Timeouts.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.HTTP.Validate(); err != nil {
+		return err
+	}
+
+	if err := validateTenants(c.Tenants); err != nil {
+		return err
+	}
+	if c.HTTP != nil && c.HTTP.H2C != nil && c.InsecureAddress == "" {
+		return errors.New("http.h2c requires insecureAddress")
+	}
+	// The code-signing certificates must be in the transparency log.
+	if c.DB == nil && c.AuthorityConfig != nil {
+		for _, p := range c.AuthorityConfig.Provisioners {
+			if o, ok := p.(*provisioner.OIDC); ok && o.CodeSigning != nil {
+				return errors.Errorf("provisioner %s: codeSigning requires a db", o.Name)
+			}
+		}
+	}
 
 	return c.AuthorityConfig.Validate(c.getAudiences())
 }
@@ -198,6 +684,10 @@ func (c *Config) getAudiences() provisioner.Audiences {
 			fmt.Sprintf("https://%s/sign", name), fmt.Sprintf("https://%s/1.0/sign", name))
 		audiences.Revoke = append(audiences.Revoke,
 			fmt.Sprintf("https://%s/revoke", name), fmt.Sprintf("https://%s/1.0/revoke", name))
+		audiences.Admin = append(audiences.Admin,
+			fmt.Sprintf("https://%s/admin", name), fmt.Sprintf("https://%s/1.0/admin", name))
+		audiences.Renew = append(audiences.Renew,
+			fmt.Sprintf("https://%s/renew", name), fmt.Sprintf("https://%s/1.0/renew", name))
 	}
 
 	return audiences
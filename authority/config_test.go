@@ -1,6 +1,10 @@
 package authority
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
@@ -65,6 +69,192 @@ func TestConfigValidate(t *testing.T) {
 				err: errors.New("invalid address 127.0.0.1"),
 			}
 		},
+		"invalid-grpc-address": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					GRPCAddress:      "127.0.0.1",
+					Root:             []string{"testdata/secrets/root_ca.crt"},
+					IntermediateCert: "testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+				},
+				err: errors.New("invalid grpcAddress 127.0.0.1"),
+			}
+		},
+		"invalid-debug-address": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					DebugAddress:     "127.0.0.1",
+					Root:             []string{"testdata/secrets/root_ca.crt"},
+					IntermediateCert: "testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+				},
+				err: errors.New("invalid debugAddress 127.0.0.1"),
+			}
+		},
+		"debug-address-without-admin": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					DebugAddress:     "127.0.0.1:9443",
+					Root:             []string{"testdata/secrets/root_ca.crt"},
+					IntermediateCert: "testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+				},
+				err: errors.New("debugAddress requires authority.admin"),
+			}
+		},
+		"invalid-unix-socket-mode": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					UnixSocket:       &UnixSocketConfig{Path: "/run/step-ca/ca.sock", Mode: "0999"},
+					Root:             []string{"testdata/secrets/root_ca.crt"},
+					IntermediateCert: "testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+				},
+				err: errors.New("unixSocket.mode 0999 is not valid"),
+			}
+		},
+		"unix-socket-admin-only-without-admin": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					UnixSocket:       &UnixSocketConfig{Path: "/run/step-ca/ca.sock", AdminOnly: true},
+					Root:             []string{"testdata/secrets/root_ca.crt"},
+					IntermediateCert: "testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+				},
+				err: errors.New("unixSocket.adminOnly requires authority.admin"),
+			}
+		},
+		"invalid-insecure-address": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					InsecureAddress:  "127.0.0.1",
+					Root:             []string{"testdata/secrets/root_ca.crt"},
+					IntermediateCert: "testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+				},
+				err: errors.New("invalid insecureAddress 127.0.0.1"),
+			}
+		},
+		"code-signing-without-db": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					Root:             []string{"testdata/secrets/root_ca.crt"},
+					IntermediateCert: "testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig: &AuthConfig{
+						Provisioners: provisioner.List{&provisioner.OIDC{
+							Type:        "OIDC",
+							Name:        "ci",
+							CodeSigning: &provisioner.CodeSigningConfig{},
+						}},
+					},
+				},
+				err: errors.New("provisioner ci: codeSigning requires a db"),
+			}
+		},
+		"acme-challenge-dir-without-insecure-address": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					ACMEChallengeDir: "/var/lib/step-ca/acme-challenge",
+					Root:             []string{"testdata/secrets/root_ca.crt"},
+					IntermediateCert: "testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+				},
+				err: errors.New("acmeChallengeDir requires insecureAddress"),
+			}
+		},
+		"sds-without-grpc-address": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					SDS:              &SDSConfig{Provisioner: "Max"},
+					Root:             []string{"testdata/secrets/root_ca.crt"},
+					IntermediateCert: "testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+				},
+				err: errors.New("sds requires grpcAddress"),
+			}
+		},
+		"sds-provisioner-without-mint": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					GRPCAddress:      "127.0.0.1:9443",
+					SDS:              &SDSConfig{Provisioner: "Max"},
+					Root:             []string{"testdata/secrets/root_ca.crt"},
+					IntermediateCert: "testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+				},
+				err: errors.New("sds.provisioner Max is not in authority.mint"),
+			}
+		},
+		"workload-api-invalid-trust-domain": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					WorkloadAPI:      &WorkloadAPIConfig{Socket: "/run/step-ca/workload.sock", TrustDomain: "spiffe://example.org", Provisioner: "Max"},
+					Root:             []string{"testdata/secrets/root_ca.crt"},
+					IntermediateCert: "testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+				},
+				err: errors.New("workloadAPI.trustDomain spiffe://example.org is not valid"),
+			}
+		},
+		"workload-api-provisioner-without-mint": func(t *testing.T) ConfigValidateTest {
+			return ConfigValidateTest{
+				config: &Config{
+					Address:          "127.0.0.1:443",
+					WorkloadAPI:      &WorkloadAPIConfig{Socket: "/run/step-ca/workload.sock", TrustDomain: "example.org", Provisioner: "Max"},
+					Root:             []string{"testdata/secrets/root_ca.crt"},
+					IntermediateCert: "testdata/secrets/intermediate_ca.crt",
+					IntermediateKey:  "testdata/secrets/intermediate_ca_key",
+					DNSNames:         []string{"test.smallstep.com"},
+					Password:         "pass",
+					AuthorityConfig:  ac,
+				},
+				err: errors.New("workloadAPI.provisioner Max is not in authority.mint"),
+			}
+		},
 		"empty-root": func(t *testing.T) ConfigValidateTest {
 			return ConfigValidateTest{
 				config: &Config{
@@ -283,6 +473,268 @@ func TestAuthConfigValidate(t *testing.T) {
 				err: errors.New("claims: MinTLSCertDuration must be greater than 0"),
 			}
 		},
+		"fail-issuer-expiry": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					IssuerExpiry: "foo",
+				},
+				err: errors.New("authority.issuerExpiry foo is not valid, it must be truncate or reject"),
+			}
+		},
+		"fail-admin-empty-provisioners": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Admin:        &AdminConfig{},
+				},
+				err: errors.New("authority.admin.provisioners cannot be empty"),
+			}
+		},
+		"fail-admin-provisioner-not-found": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Admin:        &AdminConfig{Provisioners: []string{"foo"}},
+				},
+				err: errors.New("authority.admin.provisioners: provisioner foo not found"),
+			}
+		},
+		"fail-admin-max-token-lifetime": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Admin: &AdminConfig{
+						Provisioners:     []string{"step-cli"},
+						MaxTokenLifetime: &provisioner.Duration{Duration: -1},
+					},
+				},
+				err: errors.New("authority.admin.maxTokenLifetime must be greater than 0"),
+			}
+		},
+		"fail-admin-sso-empty-provisioner": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Admin:        &AdminConfig{SSO: &AdminSSOConfig{}},
+				},
+				err: errors.New("authority.admin.sso.provisioner cannot be empty"),
+			}
+		},
+		"fail-admin-sso-provisioner-not-found": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Admin:        &AdminConfig{SSO: &AdminSSOConfig{Provisioner: "foo"}},
+				},
+				err: errors.New("authority.admin.sso.provisioner: provisioner foo not found"),
+			}
+		},
+		"fail-admin-sso-not-oidc": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Admin:        &AdminConfig{SSO: &AdminSSOConfig{Provisioner: "step-cli"}},
+				},
+				err: errors.New("authority.admin.sso.provisioner: provisioner step-cli of type JWK is not an OIDC provisioner"),
+			}
+		},
+		"ok-admin": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Admin:        &AdminConfig{Provisioners: []string{"step-cli"}},
+				},
+				asn1dn: x509util.ASN1DN{},
+			}
+		},
+		"fail-approval-without-admin": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Approval:     &ApprovalConfig{Provisioners: []string{"step-cli"}},
+				},
+				err: errors.New("authority.approval requires authority.admin"),
+			}
+		},
+		"fail-approval-empty-provisioners": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Admin:        &AdminConfig{Provisioners: []string{"step-cli"}},
+					Approval:     &ApprovalConfig{},
+				},
+				err: errors.New("authority.approval.provisioners cannot be empty"),
+			}
+		},
+		"fail-approval-provisioner-not-found": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Admin:        &AdminConfig{Provisioners: []string{"step-cli"}},
+					Approval:     &ApprovalConfig{Provisioners: []string{"foo"}},
+				},
+				err: errors.New("authority.approval.provisioners: provisioner foo not found"),
+			}
+		},
+		"fail-approval-ttl": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Admin:        &AdminConfig{Provisioners: []string{"step-cli"}},
+					Approval: &ApprovalConfig{Provisioners: []string{"step-cli"},
+						TTL: &provisioner.Duration{}},
+				},
+				err: errors.New("authority.approval.ttl must be greater than 0"),
+			}
+		},
+		"fail-approval-maxPending": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Admin:        &AdminConfig{Provisioners: []string{"step-cli"}},
+					Approval:     &ApprovalConfig{Provisioners: []string{"step-cli"}, MaxPending: -1},
+				},
+				err: errors.New("authority.approval.maxPending cannot be negative"),
+			}
+		},
+		"ok-approval": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Admin:        &AdminConfig{Provisioners: []string{"step-cli"}},
+					Approval:     &ApprovalConfig{Provisioners: []string{"step-cli"}},
+				},
+				asn1dn: x509util.ASN1DN{},
+			}
+		},
+		"fail-keyGeneration-empty-provisioners": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners:  p,
+					KeyGeneration: &KeyGenerationConfig{},
+				},
+				err: errors.New("authority.keyGeneration.provisioners cannot be empty"),
+			}
+		},
+		"fail-keyGeneration-provisioner-not-found": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners:  p,
+					KeyGeneration: &KeyGenerationConfig{Provisioners: []string{"foo"}},
+				},
+				err: errors.New("authority.keyGeneration.provisioners: provisioner foo not found"),
+			}
+		},
+		"fail-keyGeneration-approval": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners:  p,
+					Admin:         &AdminConfig{Provisioners: []string{"Max"}},
+					Approval:      &ApprovalConfig{Provisioners: []string{"step-cli"}},
+					KeyGeneration: &KeyGenerationConfig{Provisioners: []string{"step-cli"}},
+				},
+				err: errors.New("authority.keyGeneration.provisioners: provisioner step-cli requires approval"),
+			}
+		},
+		"ok-keyGeneration": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners:  p,
+					KeyGeneration: &KeyGenerationConfig{Provisioners: []string{"step-cli"}},
+				},
+				asn1dn: x509util.ASN1DN{},
+			}
+		},
+		"fail-signOptions-name": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					SignOptions:  []*SignOptionConfig{{Provisioners: []string{"step-cli"}}},
+				},
+				err: errors.New("authority.signOptions[0].name cannot be empty"),
+			}
+		},
+		"fail-signOptions-provisioner-not-found": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					SignOptions:  []*SignOptionConfig{{Name: "commonNameValidator", Provisioners: []string{"foo"}}},
+				},
+				err: errors.New("authority.signOptions[0].provisioners: provisioner foo not found"),
+			}
+		},
+		"fail-signOptions-not-registered": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					SignOptions:  []*SignOptionConfig{{Name: "foo"}},
+				},
+				err: errors.New("authority.signOptions[0]: sign option foo is not registered"),
+			}
+		},
+		"ok-signOptions": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					SignOptions: []*SignOptionConfig{{
+						Name:         "commonNameValidator",
+						Provisioners: []string{"step-cli"},
+						Options:      json.RawMessage(`{"commonName": "foo"}`),
+					}},
+				},
+				asn1dn: x509util.ASN1DN{},
+			}
+		},
+		"fail-mint-without-admin": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Mint:         &MintConfig{Provisioners: []*MintProvisioner{{Name: "step-cli"}}},
+				},
+				err: errors.New("authority.mint requires authority.admin"),
+			}
+		},
+		"fail-mint-empty-provisioners": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Admin:        &AdminConfig{Provisioners: []string{"step-cli"}},
+					Mint:         &MintConfig{},
+				},
+				err: errors.New("authority.mint.provisioners cannot be empty"),
+			}
+		},
+		"fail-mint-provisioner-not-found": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Admin:        &AdminConfig{Provisioners: []string{"step-cli"}},
+					Mint:         &MintConfig{Provisioners: []*MintProvisioner{{Name: "foo"}}},
+				},
+				err: errors.New("authority.mint.provisioners: provisioner foo not found"),
+			}
+		},
+		"fail-mint-admin-provisioner": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Admin:        &AdminConfig{Provisioners: []string{"step-cli"}},
+					Mint:         &MintConfig{Provisioners: []*MintProvisioner{{Name: "step-cli"}}},
+				},
+				err: errors.New("authority.mint.provisioners: provisioner step-cli is an admin provisioner"),
+			}
+		},
+		"fail-mint-no-encrypted-key": func(t *testing.T) AuthConfigValidateTest {
+			return AuthConfigValidateTest{
+				ac: &AuthConfig{
+					Provisioners: p,
+					Admin:        &AdminConfig{Provisioners: []string{"Max"}},
+					Mint:         &MintConfig{Provisioners: []*MintProvisioner{{Name: "step-cli"}}},
+				},
+				err: errors.New("authority.mint.provisioners: provisioner step-cli does not have an encrypted key"),
+			}
+		},
 		"ok-empty-asn1dn-template": func(t *testing.T) AuthConfigValidateTest {
 			return AuthConfigValidateTest{
 				ac: &AuthConfig{
@@ -318,3 +770,24 @@ func TestAuthConfigValidate(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadConfiguration_references(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "ca.json")
+	assert.FatalError(t, ioutil.WriteFile(filename, []byte(`{"address":"${env:STEP_CA_TEST_ADDRESS}","password":"${env:STEP_CA_TEST_PASSWORD}"}`), 0600))
+
+	os.Setenv("STEP_CA_TEST_ADDRESS", ":443")
+	os.Setenv("STEP_CA_TEST_PASSWORD", `pa"ss`)
+	defer os.Unsetenv("STEP_CA_TEST_ADDRESS")
+	defer os.Unsetenv("STEP_CA_TEST_PASSWORD")
+	c, err := LoadConfiguration(filename)
+	assert.FatalError(t, err)
+	assert.Equals(t, ":443", c.Address)
+	assert.Equals(t, `pa"ss`, c.Password)
+
+	os.Unsetenv("STEP_CA_TEST_PASSWORD")
+	_, err = LoadConfiguration(filename)
+	assert.NotNil(t, err)
+}
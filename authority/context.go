@@ -0,0 +1,18 @@
+package authority
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// checkContext returns an error if the given context has been canceled or its
+// deadline has been exceeded. It is used before the expensive operations and
+// the database writes, so the work of abandoned requests is not done.
+func checkContext(ctx context.Context, op string, errContext apiCtx) error {
+	if err := ctx.Err(); err != nil {
+		return &apiError{errors.Wrap(err, op), http.StatusServiceUnavailable, errContext}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package authority
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// CORSConfig is the configuration of the cross-origin resource sharing of the
+// read-only endpoints of the CA API.
+type CORSConfig struct {
+	AllowedOrigins []string `json:"allowedOrigins"`
+	AllowedMethods []string `json:"allowedMethods,omitempty"`
+	AllowedHeaders []string `json:"allowedHeaders,omitempty"`
+	MaxAge         int      `json:"maxAge,omitempty"`
+}
+
+// Validate validates the CORS configuration and sets the default values.
+func (c *CORSConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if len(c.AllowedOrigins) == 0 {
+		return errors.New("cors.allowedOrigins cannot be empty")
+	}
+	for _, o := range c.AllowedOrigins {
+		if o == "" {
+			return errors.New("cors.allowedOrigins cannot contain an empty origin")
+		}
+	}
+	if len(c.AllowedMethods) == 0 {
+		c.AllowedMethods = []string{"GET", "HEAD"}
+	}
+	for i, m := range c.AllowedMethods {
+		switch m = strings.ToUpper(m); m {
+		case "GET", "HEAD":
+			c.AllowedMethods[i] = m
+		default:
+			return errors.Errorf("cors.allowedMethods contains an unsupported method %s", m)
+		}
+	}
+	for i, h := range c.AllowedHeaders {
+		if h == "" {
+			return errors.New("cors.allowedHeaders cannot contain an empty header")
+		}
+		c.AllowedHeaders[i] = http.CanonicalHeaderKey(h)
+	}
+	if c.MaxAge < 0 {
+		return errors.New("cors.maxAge cannot be negative")
+	}
+	return nil
+}
+
+// GetCORSConfig returns the CORS configuration of the read-only endpoints. It
+// returns nil if CORS is not configured.
+func (a *Authority) GetCORSConfig() *CORSConfig {
+	return a.config.CORS
+}
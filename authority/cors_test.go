@@ -0,0 +1,40 @@
+package authority
+
+import (
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestCORSConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *CORSConfig
+		want   *CORSConfig
+		err    string
+	}{
+		{"nil", nil, nil, ""},
+		{"ok", &CORSConfig{AllowedOrigins: []string{"*"}},
+			&CORSConfig{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET", "HEAD"}}, ""},
+		{"ok-full", &CORSConfig{AllowedOrigins: []string{"https://tools.smallstep.com"}, AllowedMethods: []string{"get"}, AllowedHeaders: []string{"if-none-match"}, MaxAge: 60},
+			&CORSConfig{AllowedOrigins: []string{"https://tools.smallstep.com"}, AllowedMethods: []string{"GET"}, AllowedHeaders: []string{"If-None-Match"}, MaxAge: 60}, ""},
+		{"fail-origins", &CORSConfig{}, nil, "cors.allowedOrigins cannot be empty"},
+		{"fail-empty-origin", &CORSConfig{AllowedOrigins: []string{""}}, nil, "cors.allowedOrigins cannot contain an empty origin"},
+		{"fail-method", &CORSConfig{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"POST"}}, nil, "cors.allowedMethods contains an unsupported method POST"},
+		{"fail-header", &CORSConfig{AllowedOrigins: []string{"*"}, AllowedHeaders: []string{""}}, nil, "cors.allowedHeaders cannot contain an empty header"},
+		{"fail-max-age", &CORSConfig{AllowedOrigins: []string{"*"}, MaxAge: -1}, nil, "cors.maxAge cannot be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.err != "" {
+				if assert.NotNil(t, err) {
+					assert.Equals(t, tt.err, err.Error())
+				}
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equals(t, tt.want, tt.config)
+		})
+	}
+}
@@ -0,0 +1,354 @@
+package authority
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultCRLInterval is how often the CRL is regenerated if crl.interval
+	// is not set.
+	defaultCRLInterval = time.Hour
+	// defaultCRLLifetime is the time between the thisUpdate and nextUpdate
+	// of the CRL if crl.lifetime is not set.
+	defaultCRLLifetime = 24 * time.Hour
+	// maxCRLAttempts is the number of times a CRL is generated again if
+	// another instance stores one concurrently.
+	maxCRLAttempts = 3
+)
+
+var (
+	oidCRLNumber     = asn1.ObjectIdentifier{2, 5, 29, 20}
+	oidCRLReasonCode = asn1.ObjectIdentifier{2, 5, 29, 21}
+)
+
+// CRLConfig enables the certificate revocation list of the CA. The CRL is
+// stored in the database, regenerated every Interval, 1h by default, and after
+// each revocation. Its nextUpdate is Lifetime, 24h by default, after its
+// generation.
+type CRLConfig struct {
+	Interval *provisioner.Duration `json:"interval,omitempty"`
+	Lifetime *provisioner.Duration `json:"lifetime,omitempty"`
+}
+
+// Validate validates the CRL configuration and sets the default values.
+func (c *CRLConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.Interval == nil {
+		c.Interval = &provisioner.Duration{Duration: defaultCRLInterval}
+	} else if c.Interval.Duration <= 0 {
+		return errors.New("crl.interval must be greater than 0")
+	}
+	if c.Lifetime == nil {
+		c.Lifetime = &provisioner.Duration{Duration: defaultCRLLifetime}
+	}
+	if c.Lifetime.Duration <= c.Interval.Duration {
+		return errors.New("crl.lifetime must be greater than crl.interval")
+	}
+	return nil
+}
+
+// GetCRL returns the latest CRL of the CA. The CRL is generated if the
+// database does not have one yet.
+func (a *Authority) GetCRL() (*db.CRLInfo, error) {
+	if a.config.CRL == nil {
+		return nil, &apiError{errors.New("getCRL: crl is not enabled"), http.StatusNotImplemented, apiCtx{}}
+	}
+	store, ok := a.db.(db.CRLStore)
+	if !ok {
+		return nil, &apiError{errors.New("getCRL: crl requires a database"), http.StatusNotImplemented, apiCtx{}}
+	}
+	crl, err := store.GetCRL()
+	if err != nil {
+		return nil, &apiError{errors.Wrap(err, "getCRL"), http.StatusInternalServerError, apiCtx{}}
+	}
+	if crl == nil {
+		if crl, err = a.generateCRL(); err != nil {
+			return nil, &apiError{errors.Wrap(err, "getCRL"), http.StatusInternalServerError, apiCtx{}}
+		}
+	}
+	return crl, nil
+}
+
+// initCRL generates a CRL on startup if the database does not have one or it
+// is older than the interval, otherwise the stored one is served.
+func (a *Authority) initCRL() error {
+	store, ok := a.db.(db.CRLStore)
+	if !ok {
+		return errors.New("crl requires a database")
+	}
+	crl, err := store.GetCRL()
+	if err != nil {
+		return err
+	}
+	if crl == nil || time.Now().After(crl.ThisUpdate.Add(a.config.CRL.Interval.Duration)) {
+		_, err = a.generateCRL()
+	}
+	return err
+}
+
+// regenerateCRL generates a new CRL after a revocation, the errors are
+// logged, the CRL is generated again on the next interval.
+func (a *Authority) regenerateCRL() {
+	if a.config.CRL == nil {
+		return
+	}
+	if _, err := a.generateCRL(); err != nil {
+		log.Printf("error generating crl: %v", err)
+	}
+}
+
+// generateCRL generates and stores a new CRL with the revoked certificates
+// that have not expired. If another instance stores a CRL concurrently, the
+// CRL is generated again with the next number.
+func (a *Authority) generateCRL() (*db.CRLInfo, error) {
+	store, ok := a.db.(db.CRLStore)
+	if !ok {
+		return nil, errors.New("crl requires a database")
+	}
+	a.crlMutex.Lock()
+	defer a.crlMutex.Unlock()
+
+	for i := 0; i < maxCRLAttempts; i++ {
+		current, err := store.GetCRL()
+		if err != nil {
+			return nil, err
+		}
+		revoked, err := store.GetRevokedCertificates()
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now().UTC().Truncate(time.Second)
+		crl := &db.CRLInfo{
+			Number:     1,
+			ThisUpdate: now,
+			NextUpdate: now.Add(a.config.CRL.Lifetime.Duration),
+		}
+		if current != nil {
+			crl.Number = current.Number + 1
+		}
+		issIdentity := a.getIntermediateIdentity()
+		signer, ok := issIdentity.Key.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("error generating crl: intermediate key is not a crypto.Signer")
+		}
+		if crl.DER, err = createCRL(issIdentity.Crt, signer, crl.Number, a.crlEntries(revoked, now),
+			crl.ThisUpdate, crl.NextUpdate); err != nil {
+			return nil, err
+		}
+		switch err := store.StoreCRL(crl); err {
+		case nil:
+			return crl, nil
+		case db.ErrAlreadyExists:
+			continue
+		default:
+			return nil, errors.Wrap(err, "error storing crl")
+		}
+	}
+	return nil, errors.New("error storing crl: too many concurrent updates")
+}
+
+// crlEntries returns the entries of the CRL for the given revoked
+// certificates, skipping the ones that have expired.
+func (a *Authority) crlEntries(revoked []*db.RevokedCertificateInfo, now time.Time) []pkix.RevokedCertificate {
+	entries := make([]pkix.RevokedCertificate, 0, len(revoked))
+	for _, rci := range revoked {
+		sn, ok := new(big.Int).SetString(rci.Serial, 10)
+		if !ok {
+			continue
+		}
+		if data, err := a.db.GetCertificateData(rci.Serial); err == nil && data != nil &&
+			!data.NotAfter.IsZero() && data.NotAfter.Before(now) {
+			continue
+		}
+		entry := pkix.RevokedCertificate{
+			SerialNumber:   sn,
+			RevocationTime: rci.RevokedAt.UTC(),
+		}
+		if rci.ReasonCode > 0 {
+			b, err := asn1.Marshal(asn1.Enumerated(rci.ReasonCode))
+			if err == nil {
+				entry.Extensions = []pkix.Extension{{Id: oidCRLReasonCode, Value: b}}
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// tbsCertList is the TBSCertList of RFC 5280. Unlike pkix.TBSCertificateList
+// the issuer is the raw subject of the certificate, so it always matches it.
+type tbsCertList struct {
+	Version             int
+	Signature           pkix.AlgorithmIdentifier
+	Issuer              asn1.RawValue
+	ThisUpdate          time.Time
+	NextUpdate          time.Time                 `asn1:"optional"`
+	RevokedCertificates []pkix.RevokedCertificate `asn1:"optional"`
+	Extensions          []pkix.Extension          `asn1:"tag:0,optional,explicit"`
+}
+
+type certificateList struct {
+	TBSCertList        asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+}
+
+type authorityKeyID struct {
+	ID []byte `asn1:"optional,tag:0"`
+}
+
+// createCRL returns a v2 CRL signed by the given issuer with the CRL number
+// and authority key identifier extensions. It does not use the functions of
+// the x509 package because they do not support the CRL number in go 1.13.
+func createCRL(issuer *x509.Certificate, signer crypto.Signer, number int64, revoked []pkix.RevokedCertificate, thisUpdate, nextUpdate time.Time) ([]byte, error) {
+	sigAlg, hash, err := crlSignatureAlgorithm(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	numberBytes, err := asn1.Marshal(big.NewInt(number))
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling crl number")
+	}
+	tbs := tbsCertList{
+		Version:             1,
+		Signature:           sigAlg,
+		Issuer:              asn1.RawValue{FullBytes: issuer.RawSubject},
+		ThisUpdate:          thisUpdate.UTC(),
+		NextUpdate:          nextUpdate.UTC(),
+		RevokedCertificates: revoked,
+		Extensions:          []pkix.Extension{{Id: oidCRLNumber, Value: numberBytes}},
+	}
+	if len(issuer.SubjectKeyId) > 0 {
+		b, err := asn1.Marshal(authorityKeyID{ID: issuer.SubjectKeyId})
+		if err != nil {
+			return nil, errors.Wrap(err, "error marshaling authority key identifier")
+		}
+		tbs.Extensions = append(tbs.Extensions, pkix.Extension{Id: oidAuthorityKeyIdentifier, Value: b})
+	}
+	tbsBytes, err := asn1.Marshal(tbs)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling crl")
+	}
+
+	digest := tbsBytes
+	if hash != 0 {
+		h := hash.New()
+		h.Write(tbsBytes)
+		digest = h.Sum(nil)
+	}
+	signature, err := signer.Sign(rand.Reader, digest, hash)
+	if err != nil {
+		return nil, errors.Wrap(err, "error signing crl")
+	}
+	b, err := asn1.Marshal(certificateList{
+		TBSCertList:        asn1.RawValue{FullBytes: tbsBytes},
+		SignatureAlgorithm: sigAlg,
+		SignatureValue:     asn1.BitString{Bytes: signature, BitLength: len(signature) * 8},
+	})
+	return b, errors.Wrap(err, "error marshaling crl")
+}
+
+// crlSignatureAlgorithm returns the signature algorithm and hash used to sign
+// a CRL with the given key.
+func crlSignatureAlgorithm(pub crypto.PublicKey) (pkix.AlgorithmIdentifier, crypto.Hash, error) {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}}, crypto.SHA256, nil
+		case elliptic.P384():
+			return pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}}, crypto.SHA384, nil
+		case elliptic.P521():
+			return pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}}, crypto.SHA512, nil
+		default:
+			return pkix.AlgorithmIdentifier{}, 0, errors.New("error generating crl: unsupported elliptic curve")
+		}
+	case *rsa.PublicKey:
+		return pkix.AlgorithmIdentifier{
+			Algorithm:  asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11},
+			Parameters: asn1.NullRawValue,
+		}, crypto.SHA256, nil
+	case ed25519.PublicKey:
+		return pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 3, 101, 112}}, 0, nil
+	default:
+		return pkix.AlgorithmIdentifier{}, 0, errors.Errorf("error generating crl: unsupported key type %T", pub)
+	}
+}
+
+// crlScheduler regenerates the CRL on every interval. With an elector only
+// the leader regenerates it.
+type crlScheduler struct {
+	interval time.Duration
+	generate func() (*db.CRLInfo, error)
+	elector  *db.Elector
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+func newCRLScheduler(interval time.Duration, generate func() (*db.CRLInfo, error), elector *db.Elector) *crlScheduler {
+	return &crlScheduler{
+		interval: interval,
+		generate: generate,
+		elector:  elector,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start regenerates the CRL in the background until Stop is called.
+func (s *crlScheduler) Start() {
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				if s.elector == nil || s.elector.IsLeader() {
+					if _, err := s.generate(); err != nil {
+						log.Printf("error generating crl: %v", err)
+					}
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops the background generation and releases the lease of the
+// elector. It can be called on a nil scheduler.
+func (s *crlScheduler) Stop() {
+	if s == nil {
+		return
+	}
+	s.once.Do(func() {
+		close(s.stop)
+		<-s.done
+		if s.elector != nil {
+			if err := s.elector.Resign(); err != nil {
+				log.Printf("error releasing lease: %v", err)
+			}
+		}
+	})
+}
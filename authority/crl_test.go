@@ -0,0 +1,187 @@
+package authority
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+// parseTestCRL parses the given CRL, verifies it with the given issuer and
+// returns it with its number.
+func parseTestCRL(t *testing.T, der []byte, issuer *x509.Certificate) (*pkix.CertificateList, int64) {
+	crl, err := x509.ParseCRL(der)
+	assert.FatalError(t, err)
+	assert.FatalError(t, issuer.CheckCRLSignature(crl))
+	assert.Equals(t, 1, crl.TBSCertList.Version)
+	var number int64 = -1
+	for _, ext := range crl.TBSCertList.Extensions {
+		if ext.Id.Equal(oidCRLNumber) {
+			var n *big.Int
+			_, err := asn1.Unmarshal(ext.Value, &n)
+			assert.FatalError(t, err)
+			number = n.Int64()
+		}
+	}
+	return crl, number
+}
+
+func TestCRLConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *CRLConfig
+		err    error
+	}{
+		{"ok", &CRLConfig{}, nil},
+		{"ok-nil", nil, nil},
+		{"fail-interval", &CRLConfig{Interval: &provisioner.Duration{}}, errors.New("crl.interval must be greater than 0")},
+		{"fail-lifetime", &CRLConfig{Interval: &provisioner.Duration{Duration: 2 * time.Hour}, Lifetime: &provisioner.Duration{Duration: time.Hour}},
+			errors.New("crl.lifetime must be greater than crl.interval")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.err != nil {
+				if assert.NotNil(t, err) {
+					assert.Equals(t, tt.err.Error(), err.Error())
+				}
+				return
+			}
+			assert.Nil(t, err)
+			if tt.config != nil {
+				assert.Equals(t, defaultCRLInterval, tt.config.Interval.Duration)
+				assert.Equals(t, defaultCRLLifetime, tt.config.Lifetime.Duration)
+			}
+		})
+	}
+}
+
+func TestAuthority_GetCRL(t *testing.T) {
+	a := testAuthority(t)
+	_, err := a.GetCRL()
+	if assert.NotNil(t, err) {
+		assert.Equals(t, http.StatusNotImplemented, err.(*apiError).code)
+	}
+
+	memory, err := db.New(&db.Config{Type: db.MemoryType})
+	assert.FatalError(t, err)
+	a.db = memory
+	a.config.CRL = &CRLConfig{}
+	assert.FatalError(t, a.config.CRL.Validate())
+	issuer := a.intermediateIdentity.Crt
+
+	// The first CRL is generated on demand.
+	info, err := a.GetCRL()
+	assert.FatalError(t, err)
+	assert.Equals(t, int64(1), info.Number)
+	assert.Equals(t, defaultCRLLifetime, info.NextUpdate.Sub(info.ThisUpdate))
+	crl, number := parseTestCRL(t, info.DER, issuer)
+	assert.Equals(t, int64(1), number)
+	assert.Len(t, 0, crl.TBSCertList.RevokedCertificates)
+
+	// The revocations generate a new CRL without the expired certificates.
+	now := time.Now().UTC().Truncate(time.Second)
+	assert.FatalError(t, memory.StoreCertificateData("1", &db.CertificateData{NotAfter: now.Add(-time.Hour)}))
+	assert.FatalError(t, memory.Revoke(&db.RevokedCertificateInfo{Serial: "1", RevokedAt: now.Add(-2 * time.Hour)}))
+	assert.FatalError(t, memory.Revoke(&db.RevokedCertificateInfo{Serial: "2", ReasonCode: 1, RevokedAt: now}))
+	a.regenerateCRL()
+	info, err = a.GetCRL()
+	assert.FatalError(t, err)
+	assert.Equals(t, int64(2), info.Number)
+	crl, number = parseTestCRL(t, info.DER, issuer)
+	assert.Equals(t, int64(2), number)
+	if assert.Len(t, 1, crl.TBSCertList.RevokedCertificates) {
+		rc := crl.TBSCertList.RevokedCertificates[0]
+		assert.Equals(t, big.NewInt(2), rc.SerialNumber)
+		assert.True(t, rc.RevocationTime.Equal(now))
+		if assert.Len(t, 1, rc.Extensions) {
+			var reason asn1.Enumerated
+			_, err := asn1.Unmarshal(rc.Extensions[0].Value, &reason)
+			assert.FatalError(t, err)
+			assert.Equals(t, asn1.Enumerated(1), reason)
+		}
+	}
+
+	// A restart serves the stored CRL until the interval expires.
+	assert.FatalError(t, a.initCRL())
+	info, err = a.GetCRL()
+	assert.FatalError(t, err)
+	assert.Equals(t, int64(2), info.Number)
+	a.config.CRL.Interval.Duration = 0
+	assert.FatalError(t, a.initCRL())
+	info, err = a.GetCRL()
+	assert.FatalError(t, err)
+	assert.Equals(t, int64(3), info.Number)
+}
+
+func Test_createCRL(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.FatalError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.FatalError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.FatalError(t, err)
+
+	now := time.Now()
+	for name, key := range map[string]crypto.Signer{"ecdsa": ecKey, "rsa": rsaKey, "ed25519": edKey} {
+		t.Run(name, func(t *testing.T) {
+			tmpl := &x509.Certificate{
+				SerialNumber:          big.NewInt(1),
+				Subject:               pkix.Name{CommonName: "Intermediate CA"},
+				NotBefore:             now,
+				NotAfter:              now.Add(time.Hour),
+				KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+				BasicConstraintsValid: true,
+				IsCA:                  true,
+				SubjectKeyId:          []byte("key-id"),
+			}
+			der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+			assert.FatalError(t, err)
+			issuer, err := x509.ParseCertificate(der)
+			assert.FatalError(t, err)
+
+			b, err := createCRL(issuer, key, 42, nil, now, now.Add(time.Hour))
+			assert.FatalError(t, err)
+			crl, number := parseTestCRL(t, b, issuer)
+			assert.Equals(t, int64(42), number)
+			assert.Equals(t, issuer.Subject.String(), crl.TBSCertList.Issuer.String())
+		})
+	}
+
+	_, err = createCRL(&x509.Certificate{}, unsupportedSigner{}, 1, nil, now, now)
+	assert.Error(t, err)
+}
+
+func Test_crlScheduler(t *testing.T) {
+	var runs int32
+	s := newCRLScheduler(10*time.Millisecond, func() (*db.CRLInfo, error) {
+		atomic.AddInt32(&runs, 1)
+		return nil, nil
+	}, nil)
+	s.Start()
+	time.Sleep(55 * time.Millisecond)
+	s.Stop()
+	n := atomic.LoadInt32(&runs)
+	assert.True(t, n >= 2)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equals(t, n, atomic.LoadInt32(&runs))
+	// Stop can be called again and on a nil scheduler.
+	s.Stop()
+	var nilScheduler *crlScheduler
+	nilScheduler.Stop()
+}
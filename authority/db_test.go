@@ -2,6 +2,7 @@ package authority
 
 import (
 	"crypto/x509"
+	"time"
 
 	"github.com/RTradeLtd/ca-certificates/db"
 )
@@ -13,7 +14,27 @@ type MockAuthDB struct {
 	isRevoked        func(string) (bool, error)
 	revoke           func(rci *db.RevokedCertificateInfo) error
 	storeCertificate func(crt *x509.Certificate) error
+	storeCerts       func(records []*db.CertificateRecord) error
+	getCertificate   func(sn string) (*x509.Certificate, error)
+	getCertificates  func() ([]*x509.Certificate, error)
+	getCertsBySAN    func(san string) ([]*x509.Certificate, error)
+	getCertsByCN     func(cn string) ([]*x509.Certificate, error)
+	rebuildIndexes   func() (int, error)
+	storeCertData    func(sn string, data *db.CertificateData) error
+	getCertData      func(sn string) (*db.CertificateData, error)
+	getRevokedInfo   func(sn string) (*db.RevokedCertificateInfo, error)
+	incrementStats   func(t time.Time, provisioner, event string) error
+	getStats         func() ([]*db.StatsEntry, error)
+	getJournal       func() ([]*db.JournalEntry, error)
+	getLogEntries    func(start, end int64) ([]*db.LogEntry, error)
+	getTreeHead      func() (*db.TreeHead, error)
+	getProof         func(sn string, treeSize int64) (*db.InclusionProof, error)
 	useToken         func(id, tok string) (bool, error)
+	isTokenUsed      func(id string) (bool, error)
+	pruneCerts       func(before time.Time) (*db.PruneResult, error)
+	pruneTokens      func(before time.Time) (*db.PruneResult, error)
+	export           func() (*db.Snapshot, error)
+	importSnapshot   func(snap *db.Snapshot) error
 	shutdown         func() error
 }
 
@@ -44,6 +65,16 @@ func (m *MockAuthDB) UseToken(id, tok string) (bool, error) {
 	return m.ret1.(bool), m.err
 }
 
+func (m *MockAuthDB) IsTokenUsed(id string) (bool, error) {
+	if m.isTokenUsed != nil {
+		return m.isTokenUsed(id)
+	}
+	if m.ret1 == nil {
+		return false, m.err
+	}
+	return m.ret1.(bool), m.err
+}
+
 func (m *MockAuthDB) Revoke(rci *db.RevokedCertificateInfo) error {
 	if m.revoke != nil {
 		return m.revoke(rci)
@@ -58,6 +89,175 @@ func (m *MockAuthDB) StoreCertificate(crt *x509.Certificate) error {
 	return m.err
 }
 
+func (m *MockAuthDB) GetCertificate(sn string) (*x509.Certificate, error) {
+	if m.getCertificate != nil {
+		return m.getCertificate(sn)
+	}
+	if m.ret1 == nil {
+		return nil, m.err
+	}
+	return m.ret1.(*x509.Certificate), m.err
+}
+
+func (m *MockAuthDB) GetCertificates() ([]*x509.Certificate, error) {
+	if m.getCertificates != nil {
+		return m.getCertificates()
+	}
+	if m.ret1 == nil {
+		return nil, m.err
+	}
+	return m.ret1.([]*x509.Certificate), m.err
+}
+
+func (m *MockAuthDB) GetCertificatesBySAN(san string) ([]*x509.Certificate, error) {
+	if m.getCertsBySAN != nil {
+		return m.getCertsBySAN(san)
+	}
+	return m.GetCertificates()
+}
+
+func (m *MockAuthDB) GetCertificatesByCommonName(cn string) ([]*x509.Certificate, error) {
+	if m.getCertsByCN != nil {
+		return m.getCertsByCN(cn)
+	}
+	return m.GetCertificates()
+}
+
+func (m *MockAuthDB) RebuildIndexes() (int, error) {
+	if m.rebuildIndexes != nil {
+		return m.rebuildIndexes()
+	}
+	return 0, m.err
+}
+
+func (m *MockAuthDB) StoreCertificateData(sn string, data *db.CertificateData) error {
+	if m.storeCertData != nil {
+		return m.storeCertData(sn, data)
+	}
+	return m.err
+}
+
+func (m *MockAuthDB) GetCertificateData(sn string) (*db.CertificateData, error) {
+	if m.getCertData != nil {
+		return m.getCertData(sn)
+	}
+	if m.ret1 == nil {
+		return nil, m.err
+	}
+	return m.ret1.(*db.CertificateData), m.err
+}
+
+func (m *MockAuthDB) GetRevokedCertificateInfo(sn string) (*db.RevokedCertificateInfo, error) {
+	if m.getRevokedInfo != nil {
+		return m.getRevokedInfo(sn)
+	}
+	if m.ret1 == nil {
+		return nil, m.err
+	}
+	return m.ret1.(*db.RevokedCertificateInfo), m.err
+}
+
+func (m *MockAuthDB) IncrementStats(t time.Time, provisioner, event string) error {
+	if m.incrementStats != nil {
+		return m.incrementStats(t, provisioner, event)
+	}
+	return m.err
+}
+
+func (m *MockAuthDB) GetStats() ([]*db.StatsEntry, error) {
+	if m.getStats != nil {
+		return m.getStats()
+	}
+	if m.ret1 == nil {
+		return nil, m.err
+	}
+	return m.ret1.([]*db.StatsEntry), m.err
+}
+
+func (m *MockAuthDB) GetJournal() ([]*db.JournalEntry, error) {
+	if m.getJournal != nil {
+		return m.getJournal()
+	}
+	if m.ret1 == nil {
+		return nil, m.err
+	}
+	return m.ret1.([]*db.JournalEntry), m.err
+}
+
+func (m *MockAuthDB) GetLogEntries(start, end int64) ([]*db.LogEntry, error) {
+	if m.getLogEntries != nil {
+		return m.getLogEntries(start, end)
+	}
+	if m.ret1 == nil {
+		return nil, m.err
+	}
+	return m.ret1.([]*db.LogEntry), m.err
+}
+
+func (m *MockAuthDB) GetTreeHead() (*db.TreeHead, error) {
+	if m.getTreeHead != nil {
+		return m.getTreeHead()
+	}
+	if m.ret1 == nil {
+		return nil, m.err
+	}
+	return m.ret1.(*db.TreeHead), m.err
+}
+
+func (m *MockAuthDB) GetInclusionProof(sn string, treeSize int64) (*db.InclusionProof, error) {
+	if m.getProof != nil {
+		return m.getProof(sn, treeSize)
+	}
+	if m.ret1 == nil {
+		return nil, m.err
+	}
+	return m.ret1.(*db.InclusionProof), m.err
+}
+
+func (m *MockAuthDB) PruneCertificates(before time.Time) (*db.PruneResult, error) {
+	if m.pruneCerts != nil {
+		return m.pruneCerts(before)
+	}
+	if m.ret1 == nil {
+		return nil, m.err
+	}
+	return m.ret1.(*db.PruneResult), m.err
+}
+
+func (m *MockAuthDB) PruneTokens(before time.Time) (*db.PruneResult, error) {
+	if m.pruneTokens != nil {
+		return m.pruneTokens(before)
+	}
+	if m.ret1 == nil {
+		return nil, m.err
+	}
+	return m.ret1.(*db.PruneResult), m.err
+}
+
+func (m *MockAuthDB) StoreCertificates(records []*db.CertificateRecord) error {
+	if m.storeCerts != nil {
+		return m.storeCerts(records)
+	}
+	return m.err
+}
+
+func (m *MockAuthDB) Export() (*db.Snapshot, error) {
+	if m.export != nil {
+		return m.export()
+	}
+	if m.ret1 == nil {
+		return nil, m.err
+	}
+	return m.ret1.(*db.Snapshot), m.err
+}
+
+func (m *MockAuthDB) Import(snap *db.Snapshot) error {
+	if m.importSnapshot != nil {
+		return m.importSnapshot(snap)
+	}
+	return m.err
+}
+
 func (m *MockAuthDB) Shutdown() error {
 	if m.shutdown != nil {
 		return m.shutdown()
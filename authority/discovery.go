@@ -0,0 +1,70 @@
+package authority
+
+import (
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+)
+
+// DiscoveryKeyType is a type of key accepted in the certificate requests.
+type DiscoveryKeyType struct {
+	Kty     string   `json:"kty"`
+	Crv     []string `json:"crv,omitempty"`
+	MinSize int      `json:"minSize,omitempty"`
+}
+
+// discoveryKeyTypes are the keys accepted by the default public key validator
+// of the provisioners.
+var discoveryKeyTypes = []DiscoveryKeyType{
+	{Kty: "EC", Crv: []string{"P-256", "P-384", "P-521"}},
+	{Kty: "RSA", MinSize: 2048},
+	{Kty: "OKP", Crv: []string{"Ed25519"}},
+}
+
+// Discovery describes the capabilities of the CA, it is used to build the
+// discovery document of the CA API.
+type Discovery struct {
+	// SSH is true if the CA signs SSH certificates.
+	SSH bool
+	// JWTSVID is true if the CA issues JWT-SVIDs.
+	JWTSVID bool
+	// Nonce is true if the CA issues nonces.
+	Nonce bool
+	// CRL is true if the CA publishes a CRL.
+	CRL bool
+	// ProvisionerTypes are the types of the configured provisioners.
+	ProvisionerTypes []string
+	// ACMEProvisioners are the names of the ACME provisioners.
+	ACMEProvisioners []string
+	// KeyTypes are the keys accepted in the certificate requests.
+	KeyTypes []DiscoveryKeyType
+}
+
+// GetDiscovery returns the capabilities of the CA.
+func (a *Authority) GetDiscovery() *Discovery {
+	d := &Discovery{
+		SSH:      a.sshCAUserCertSignKey != nil || a.sshCAHostCertSignKey != nil,
+		JWTSVID:  a.jwtSVIDKey != nil,
+		Nonce:    a.nonceSecret != nil,
+		CRL:      a.config.CRL != nil,
+		KeyTypes: discoveryKeyTypes,
+	}
+	seen := make(map[provisioner.Type]bool)
+	provisioners := a.getProvisioners()
+	cursor := ""
+	for {
+		list, next := provisioners.Find(cursor, provisioner.DefaultProvisionersMax)
+		for _, p := range list {
+			typ := p.GetType()
+			if !seen[typ] {
+				seen[typ] = true
+				d.ProvisionerTypes = append(d.ProvisionerTypes, typ.String())
+			}
+			if typ == provisioner.TypeACME {
+				d.ACMEProvisioners = append(d.ACMEProvisioners, p.GetName())
+			}
+		}
+		if next == "" {
+			return d
+		}
+		cursor = next
+	}
+}
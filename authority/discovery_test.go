@@ -0,0 +1,32 @@
+package authority
+
+import (
+	"crypto"
+	"testing"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/smallstep/assert"
+)
+
+func TestAuthority_GetDiscovery(t *testing.T) {
+	a := testAuthority(t)
+	d := a.GetDiscovery()
+	assert.False(t, d.SSH)
+	assert.Equals(t, []string{"JWK"}, d.ProvisionerTypes)
+	assert.Len(t, 0, d.ACMEProvisioners)
+	assert.Equals(t, discoveryKeyTypes, d.KeyTypes)
+
+	list := append(provisioner.List{
+		&provisioner.ACME{Name: "acme", Type: "ACME"},
+		&provisioner.ACME{Name: "acme 2", Type: "ACME"},
+	}, a.config.AuthorityConfig.Provisioners...)
+	assert.FatalError(t, a.ReloadProvisioners(list))
+	d = a.GetDiscovery()
+	assert.Len(t, 2, d.ProvisionerTypes)
+	assert.True(t, (d.ProvisionerTypes[0] == "JWK" && d.ProvisionerTypes[1] == "ACME") ||
+		(d.ProvisionerTypes[0] == "ACME" && d.ProvisionerTypes[1] == "JWK"))
+	assert.Len(t, 2, d.ACMEProvisioners)
+
+	a.sshCAHostCertSignKey = a.intermediateIdentity.Key.(crypto.Signer)
+	assert.True(t, a.GetDiscovery().SSH)
+}
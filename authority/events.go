@@ -0,0 +1,98 @@
+package authority
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"reflect"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/events"
+)
+
+// WithEventPublisher sets an already initialized event publisher to a new
+// authority. This option is intended to be use on graceful reloads, so the
+// subscribers and the queued webhooks are not lost.
+func WithEventPublisher(p *events.Publisher) Option {
+	return func(a *Authority) {
+		a.events = p
+	}
+}
+
+// GetEventPublisher returns the publisher of the authority events.
+func (a *Authority) GetEventPublisher() *events.Publisher {
+	return a.events
+}
+
+// SubscribeEvents returns a channel with the events published by the
+// authority and a function to cancel the subscription. If lastID is set, the
+// events in the history published after that id are sent first.
+func (a *Authority) SubscribeEvents(lastID string) (<-chan *events.Event, func()) {
+	return a.events.Subscribe(lastID)
+}
+
+// publishCertificateEvent publishes an event of the given type for a signed
+// or renewed certificate.
+func (a *Authority) publishCertificateEvent(typ events.Type, crt *x509.Certificate, provisionerName string) {
+	a.events.Publish(typ, &events.CertificateData{
+		Serial:      crt.SerialNumber.String(),
+		Subject:     crt.Subject.CommonName,
+		SANs:        certificateSANs(crt),
+		Provisioner: provisionerName,
+		NotBefore:   crt.NotBefore,
+		NotAfter:    crt.NotAfter,
+	})
+}
+
+// PublishProvisionerEvents publishes an event for each provisioner added,
+// updated or removed in the authority with respect to the given list. It is
+// used after a reload of the configuration.
+func (a *Authority) PublishProvisionerEvents(previous provisioner.List) {
+	a.provisionersMutex.RLock()
+	current := a.config.AuthorityConfig.Provisioners
+	a.provisionersMutex.RUnlock()
+	a.publishProvisionerEvents(previous, current)
+}
+
+// publishProvisionerEvents publishes an event for each provisioner added,
+// updated or removed in the current list with respect to the previous one.
+func (a *Authority) publishProvisionerEvents(previous, current provisioner.List) {
+	publish := func(p provisioner.Interface, action string) {
+		a.events.Publish(events.ProvisionerChanged, &events.ProvisionerData{
+			ID:     p.GetID(),
+			Name:   p.GetName(),
+			Type:   p.GetType().String(),
+			Action: action,
+		})
+	}
+
+	old := make(map[string]provisioner.Interface, len(previous))
+	for _, p := range previous {
+		old[p.GetID()] = p
+	}
+	for _, p := range current {
+		prev, ok := old[p.GetID()]
+		switch {
+		case !ok:
+			publish(p, "added")
+		case !equalProvisioners(prev, p):
+			publish(p, "updated")
+		}
+		delete(old, p.GetID())
+	}
+	for _, p := range previous {
+		if _, ok := old[p.GetID()]; ok {
+			publish(p, "removed")
+		}
+	}
+}
+
+// equalProvisioners returns true if the JSON representation of both
+// provisioners is the same.
+func equalProvisioners(a, b provisioner.Interface) bool {
+	ba, errA := json.Marshal(a)
+	bb, errB := json.Marshal(b)
+	if errA != nil || errB != nil {
+		return reflect.DeepEqual(a, b)
+	}
+	return string(ba) == string(bb)
+}
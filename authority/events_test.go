@@ -0,0 +1,127 @@
+package authority
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/RTradeLtd/ca-certificates/events"
+	"github.com/RTradeLtd/ca-cli/crypto/keys"
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/smallstep/assert"
+)
+
+func receiveEvent(t *testing.T, ch <-chan *events.Event) *events.Event {
+	select {
+	case e := <-ch:
+		return e
+	case <-time.After(time.Second):
+		t.Fatal("timeout waiting for event")
+		return nil
+	}
+}
+
+func TestAuthority_events(t *testing.T) {
+	_, priv, err := keys.GenerateDefaultKeyPair()
+	assert.FatalError(t, err)
+	jwk, err := jose.ParseKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+
+	a := testAuthority(t)
+	a.db = &MockAuthDB{
+		isRevoked: func(sn string) (bool, error) {
+			return false, nil
+		},
+		useToken: func(id, tok string) (bool, error) {
+			return true, nil
+		},
+		revoke: func(rci *db.RevokedCertificateInfo) error {
+			return nil
+		},
+	}
+	ch, cancel := a.SubscribeEvents("")
+	defer cancel()
+
+	// Sign
+	token, err := generateToken("smallstep test", "step-cli", "https://test.ca.smallstep.com/sign",
+		[]string{"test.smallstep.com"}, time.Now(), jwk)
+	assert.FatalError(t, err)
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+	signOpts, err := a.Authorize(ctx, token)
+	assert.FatalError(t, err)
+	certChain, err := a.Sign(context.Background(), getCSR(t, priv), provisioner.Options{}, signOpts...)
+	assert.FatalError(t, err)
+	crt := certChain[0]
+
+	e := receiveEvent(t, ch)
+	assert.Equals(t, events.CertificateIssued, e.Type)
+	assert.Equals(t, &events.CertificateData{
+		Serial:      crt.SerialNumber.String(),
+		Subject:     "smallstep test",
+		SANs:        []string{"test.smallstep.com"},
+		Provisioner: "step-cli",
+		NotBefore:   crt.NotBefore,
+		NotAfter:    crt.NotAfter,
+	}, e.Data)
+
+	// Renew
+	certChain, err = a.Renew(context.Background(), crt)
+	assert.FatalError(t, err)
+	e = receiveEvent(t, ch)
+	assert.Equals(t, events.CertificateRenewed, e.Type)
+	assert.Equals(t, certChain[0].SerialNumber.String(), e.Data.(*events.CertificateData).Serial)
+	assert.Equals(t, "step-cli", e.Data.(*events.CertificateData).Provisioner)
+
+	// Revoke
+	token, err = generateToken(crt.SerialNumber.String(), "step-cli", "https://test.ca.smallstep.com/revoke",
+		nil, time.Now(), jwk)
+	assert.FatalError(t, err)
+	assert.FatalError(t, a.Revoke(context.Background(), &RevokeOptions{
+		Serial:     crt.SerialNumber.String(),
+		ReasonCode: 1,
+		Reason:     "key compromise",
+		OTT:        token,
+	}))
+	e = receiveEvent(t, ch)
+	assert.Equals(t, events.CertificateRevoked, e.Type)
+	assert.Equals(t, &events.RevocationData{
+		Serial:      crt.SerialNumber.String(),
+		Provisioner: "step-cli",
+		ReasonCode:  1,
+		Reason:      "key compromise",
+	}, e.Data)
+}
+
+func TestAuthority_PublishProvisionerEvents(t *testing.T) {
+	a := testAuthority(t)
+	current := a.config.AuthorityConfig.Provisioners
+	assert.True(t, len(current) > 2)
+
+	jwk, ok := current[1].(*provisioner.JWK)
+	assert.Fatal(t, ok)
+	modified := *jwk
+	modified.EncryptedKey = "modified"
+	removed := &provisioner.OIDC{Type: "OIDC", Name: "google", ClientID: "client-id"}
+
+	// current[0] is added, current[1] is updated, and removed is removed.
+	previous := provisioner.List{&modified, removed}
+	previous = append(previous, current[2:]...)
+
+	ch, cancel := a.SubscribeEvents("")
+	defer cancel()
+	a.PublishProvisionerEvents(previous)
+
+	want := []*events.ProvisionerData{
+		{ID: current[0].GetID(), Name: current[0].GetName(), Type: current[0].GetType().String(), Action: "added"},
+		{ID: current[1].GetID(), Name: current[1].GetName(), Type: current[1].GetType().String(), Action: "updated"},
+		{ID: "client-id", Name: "google", Type: "OIDC", Action: "removed"},
+	}
+	for _, w := range want {
+		e := receiveEvent(t, ch)
+		assert.Equals(t, events.ProvisionerChanged, e.Type)
+		assert.Equals(t, w, e.Data)
+	}
+	assert.Len(t, 0, ch)
+}
@@ -0,0 +1,70 @@
+package authority
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"log"
+
+	"github.com/RTradeLtd/ca-certificates/federation"
+)
+
+// GetFederationSyncer returns the synchronizer of the federated roots, or nil
+// if it is not configured.
+func (a *Authority) GetFederationSyncer() *federation.Syncer {
+	return a.federation
+}
+
+// setFederatedRoots replaces the roots synchronized from the given peer. The
+// roots of the configuration, and the ones still served by other peers, are
+// never removed.
+func (a *Authority) setFederatedRoots(peer string, roots []*x509.Certificate) {
+	a.federationMutex.Lock()
+	defer a.federationMutex.Unlock()
+
+	sums := make(map[string]bool, len(roots))
+	var added int
+	for _, crt := range roots {
+		sum := sha256.Sum256(crt.Raw)
+		fp := hex.EncodeToString(sum[:])
+		sums[fp] = true
+		if _, ok := a.certificates.Load(fp); !ok {
+			added++
+		}
+		a.certificates.Store(fp, crt)
+	}
+	prev := a.syncedRoots[peer]
+	a.syncedRoots[peer] = sums
+
+	var removed int
+	for fp := range prev {
+		if !sums[fp] && !a.isFederatedRootInUse(fp) {
+			a.certificates.Delete(fp)
+			removed++
+		}
+	}
+	if added > 0 || removed > 0 {
+		log.Printf("federated roots from %s: %d added, %d removed", peer, added, removed)
+	}
+}
+
+// isFederatedRootInUse returns true if the certificate with the given
+// fingerprint is in the configuration, is a root of the authority or is
+// served by a peer. It must be called with the federationMutex held.
+func (a *Authority) isFederatedRootInUse(fp string) bool {
+	if a.staticCertificates[fp] {
+		return true
+	}
+	for _, sums := range a.syncedRoots {
+		if sums[fp] {
+			return true
+		}
+	}
+	for _, crt := range a.GetRootCertificates() {
+		sum := sha256.Sum256(crt.Raw)
+		if hex.EncodeToString(sum[:]) == fp {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package authority
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"testing"
+
+	"github.com/RTradeLtd/ca-cli/crypto/pemutil"
+	"github.com/smallstep/assert"
+)
+
+func TestAuthority_setFederatedRoots(t *testing.T) {
+	a := testAuthority(t)
+	root, err := pemutil.ReadCertificate("testdata/certs/root_ca.crt")
+	assert.FatalError(t, err)
+	intermediate, err := pemutil.ReadCertificate("testdata/certs/intermediate_ca.crt")
+	assert.FatalError(t, err)
+	foo, err := pemutil.ReadCertificate("testdata/certs/foo.crt")
+	assert.FatalError(t, err)
+
+	static, err := a.GetFederation()
+	assert.FatalError(t, err)
+	contains := func(crt *x509.Certificate) bool {
+		federation, err := a.GetFederation()
+		assert.FatalError(t, err)
+		return containsCertificate(federation, crt)
+	}
+	count := func() int {
+		federation, err := a.GetFederation()
+		assert.FatalError(t, err)
+		return len(federation)
+	}
+
+	a.setFederatedRoots("a", []*x509.Certificate{intermediate, root})
+	assert.True(t, contains(intermediate))
+	assert.Equals(t, len(static)+1, count())
+	a.setFederatedRoots("b", []*x509.Certificate{intermediate, foo})
+	assert.True(t, contains(foo))
+	assert.Equals(t, len(static)+2, count())
+
+	// The intermediate is still served by b, and the root is not removed.
+	a.setFederatedRoots("a", nil)
+	assert.True(t, contains(intermediate))
+	assert.True(t, contains(root))
+	assert.Equals(t, len(static)+2, count())
+
+	a.setFederatedRoots("b", []*x509.Certificate{foo})
+	assert.False(t, contains(intermediate))
+	assert.True(t, contains(foo))
+	assert.Equals(t, len(static)+1, count())
+
+	sum := sha256.Sum256(foo.Raw)
+	_, err = a.Root(hex.EncodeToString(sum[:]))
+	assert.FatalError(t, err)
+	a.setFederatedRoots("b", nil)
+	assert.Equals(t, static, func() []*x509.Certificate {
+		federation, err := a.GetFederation()
+		assert.FatalError(t, err)
+		return federation
+	}())
+}
@@ -0,0 +1,88 @@
+package authority
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/pkg/errors"
+)
+
+// Health statuses of the CA and its dependencies. A degraded dependency only
+// affects some requests, a failed one affects all of them.
+const (
+	HealthOK       = "ok"
+	HealthDegraded = "degraded"
+	HealthFailed   = "failed"
+)
+
+// healthCheckTimeout is the maximum time a dependency can take to respond to
+// a health probe.
+const healthCheckTimeout = 5 * time.Second
+
+// HealthCheck is the status of one dependency of the CA.
+type HealthCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Health is the status of the CA, the worst status of its dependencies, and
+// the status of every dependency checked.
+type Health struct {
+	Status string                  `json:"status"`
+	Checks map[string]*HealthCheck `json:"checks,omitempty"`
+}
+
+// add sets the check of a dependency and updates the status of the CA.
+func (h *Health) add(name string, err error, status string) {
+	if err == nil {
+		h.Checks[name] = &HealthCheck{Status: HealthOK}
+		return
+	}
+	h.Checks[name] = &HealthCheck{Status: status, Error: err.Error()}
+	if h.Status == HealthOK || status == HealthFailed {
+		h.Status = status
+	}
+}
+
+// CheckHealth probes the dependencies of the CA. A database that cannot be
+// read or written fails the CA, an identity provider whose keys cannot be
+// refreshed degrades it, as only the tokens of its provisioner are affected.
+func (a *Authority) CheckHealth(ctx context.Context) *Health {
+	h := &Health{Status: HealthOK, Checks: make(map[string]*HealthCheck)}
+	if hc, ok := a.db.(db.HealthChecker); ok {
+		h.add("db", checkWithTimeout(ctx, hc.CheckHealth), HealthFailed)
+	}
+	var list provisioner.List
+	for cursor := ""; ; {
+		list, cursor = a.getProvisioners().Find(cursor, provisioner.DefaultProvisionersMax)
+		for _, p := range list {
+			if hc, ok := p.(provisioner.HealthChecker); ok {
+				name := strings.ToLower(p.GetType().String()) + ":" + p.GetName()
+				h.add(name, hc.CheckHealth(), HealthDegraded)
+			}
+		}
+		if cursor == "" {
+			return h
+		}
+	}
+}
+
+// checkWithTimeout runs the given probe and fails if it does not finish before
+// the context is done or the health check timeout.
+func checkWithTimeout(ctx context.Context, fn func() error) error {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	ch := make(chan error, 1)
+	go func() {
+		ch <- fn()
+	}()
+	select {
+	case err := <-ch:
+		return err
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "health check did not finish")
+	}
+}
@@ -0,0 +1,78 @@
+package authority
+
+import (
+	"context"
+	"testing"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+type healthCheckerDB struct {
+	*MockAuthDB
+	err error
+}
+
+func (m *healthCheckerDB) CheckHealth() error {
+	return m.err
+}
+
+type healthCheckerProvisioner struct {
+	*provisioner.JWK
+	err error
+}
+
+func (p *healthCheckerProvisioner) CheckHealth() error {
+	return p.err
+}
+
+func TestAuthority_CheckHealth(t *testing.T) {
+	a := testAuthority(t)
+	assert.Equals(t, &Health{Status: HealthOK, Checks: map[string]*HealthCheck{}}, a.CheckHealth(context.Background()))
+
+	memory, err := db.New(&db.Config{Type: db.MemoryType})
+	assert.FatalError(t, err)
+	a.db = memory
+	assert.Equals(t, &Health{Status: HealthOK, Checks: map[string]*HealthCheck{
+		"db": {Status: HealthOK},
+	}}, a.CheckHealth(context.Background()))
+
+	// Identity providers degrade the CA.
+	jwk := a.config.AuthorityConfig.Provisioners[0].(*provisioner.JWK)
+	idp := &healthCheckerProvisioner{&provisioner.JWK{Name: "idp", Type: "JWK", Key: jwk.Key}, errors.New("failed to connect")}
+	assert.FatalError(t, a.getProvisioners().Store(idp))
+	assert.Equals(t, &Health{Status: HealthDegraded, Checks: map[string]*HealthCheck{
+		"db":      {Status: HealthOK},
+		"jwk:idp": {Status: HealthDegraded, Error: "failed to connect"},
+	}}, a.CheckHealth(context.Background()))
+
+	// The database fails the CA.
+	a.db = &healthCheckerDB{&MockAuthDB{}, errors.New("error writing health probe")}
+	assert.Equals(t, &Health{Status: HealthFailed, Checks: map[string]*HealthCheck{
+		"db":      {Status: HealthFailed, Error: "error writing health probe"},
+		"jwk:idp": {Status: HealthDegraded, Error: "failed to connect"},
+	}}, a.CheckHealth(context.Background()))
+	idp.err = nil
+	assert.Equals(t, HealthFailed, a.CheckHealth(context.Background()).Status)
+}
+
+func Test_checkWithTimeout(t *testing.T) {
+	assert.NoError(t, checkWithTimeout(context.Background(), func() error { return nil }))
+	assert.Equals(t, "force", checkWithTimeout(context.Background(), func() error {
+		return errors.New("force")
+	}).Error())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	block := make(chan struct{})
+	defer close(block)
+	err := checkWithTimeout(ctx, func() error {
+		<-block
+		return nil
+	})
+	if assert.NotNil(t, err) {
+		assert.Equals(t, context.Canceled, errors.Cause(err))
+	}
+}
@@ -0,0 +1,137 @@
+package authority
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/pkg/errors"
+)
+
+// HTTPConfig tunes the connections of the HTTP servers of the CA. Long lived
+// connections reduce the TLS handshakes of clients that renew often.
+// KeepAlivePeriod is the period of the TCP keep-alives, IdleTimeout the
+// maximum time an idle connection is kept open and ReadHeaderTimeout the
+// maximum time to read the headers of a request. HTTP/2 is supported over TLS
+// unless DisableHTTP2 is set. H2C enables HTTP/2 without TLS on the insecure
+// address for the proxies in its trusted networks.
+type HTTPConfig struct {
+	KeepAlivePeriod      *provisioner.Duration `json:"keepAlivePeriod,omitempty"`
+	IdleTimeout          *provisioner.Duration `json:"idleTimeout,omitempty"`
+	ReadHeaderTimeout    *provisioner.Duration `json:"readHeaderTimeout,omitempty"`
+	MaxConcurrentStreams uint32                `json:"maxConcurrentStreams,omitempty"`
+	DisableHTTP2         bool                  `json:"disableHTTP2,omitempty"`
+	H2C                  *H2CConfig            `json:"h2c,omitempty"`
+}
+
+// H2CConfig is the configuration of HTTP/2 without TLS. TrustedProxies is the
+// list of IP addresses or CIDR networks allowed to use it.
+type H2CConfig struct {
+	TrustedProxies []string `json:"trustedProxies"`
+}
+
+// Validate validates the HTTP configuration.
+func (c *HTTPConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.GetKeepAlivePeriod() < 0:
+		return errors.New("http.keepAlivePeriod cannot be negative")
+	case c.GetIdleTimeout() < 0:
+		return errors.New("http.idleTimeout cannot be negative")
+	case c.GetReadHeaderTimeout() < 0:
+		return errors.New("http.readHeaderTimeout cannot be negative")
+	}
+	if c.H2C != nil {
+		if c.DisableHTTP2 {
+			return errors.New("http.h2c cannot be used with http.disableHTTP2")
+		}
+		if len(c.H2C.TrustedProxies) == 0 {
+			return errors.New("http.h2c.trustedProxies cannot be empty")
+		}
+		if _, err := parseNetworks(c.H2C.TrustedProxies); err != nil {
+			return errors.Wrap(err, "http.h2c.trustedProxies is not valid")
+		}
+	}
+	return nil
+}
+
+// GetKeepAlivePeriod returns the period of the TCP keep-alives, 0 if it's
+// not configured.
+func (c *HTTPConfig) GetKeepAlivePeriod() time.Duration {
+	if c == nil || c.KeepAlivePeriod == nil {
+		return 0
+	}
+	return c.KeepAlivePeriod.Duration
+}
+
+// GetIdleTimeout returns the idle timeout of the connections, 0 if it's not
+// configured.
+func (c *HTTPConfig) GetIdleTimeout() time.Duration {
+	if c == nil || c.IdleTimeout == nil {
+		return 0
+	}
+	return c.IdleTimeout.Duration
+}
+
+// GetReadHeaderTimeout returns the timeout to read the headers of a request,
+// 0 if it's not configured.
+func (c *HTTPConfig) GetReadHeaderTimeout() time.Duration {
+	if c == nil || c.ReadHeaderTimeout == nil {
+		return 0
+	}
+	return c.ReadHeaderTimeout.Duration
+}
+
+// GetMaxConcurrentStreams returns the maximum number of concurrent HTTP/2
+// streams per connection, 0 if it's not configured.
+func (c *HTTPConfig) GetMaxConcurrentStreams() uint32 {
+	if c == nil {
+		return 0
+	}
+	return c.MaxConcurrentStreams
+}
+
+// IsHTTP2Disabled returns true if the servers only support HTTP/1.1.
+func (c *HTTPConfig) IsHTTP2Disabled() bool {
+	return c != nil && c.DisableHTTP2
+}
+
+// GetH2CTrustedProxies returns the networks allowed to use HTTP/2 without
+// TLS, nil if h2c is not enabled.
+func (c *HTTPConfig) GetH2CTrustedProxies() []*net.IPNet {
+	if c == nil || c.H2C == nil {
+		return nil
+	}
+	nets, err := parseNetworks(c.H2C.TrustedProxies)
+	if err != nil {
+		return nil
+	}
+	return nets
+}
+
+// parseNetworks parses a list of IP addresses or CIDR networks.
+func parseNetworks(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, errors.Errorf("%s is not a valid IP address", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, errors.Errorf("%s is not a valid CIDR network", s)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
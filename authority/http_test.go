@@ -0,0 +1,64 @@
+package authority
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/smallstep/assert"
+)
+
+func TestHTTPConfig_Validate(t *testing.T) {
+	minute := &provisioner.Duration{Duration: time.Minute}
+	negative := &provisioner.Duration{Duration: -time.Second}
+	tests := []struct {
+		name    string
+		config  *HTTPConfig
+		wantErr bool
+	}{
+		{"ok-nil", nil, false},
+		{"ok-empty", &HTTPConfig{}, false},
+		{"ok", &HTTPConfig{KeepAlivePeriod: minute, IdleTimeout: minute, ReadHeaderTimeout: minute, MaxConcurrentStreams: 100}, false},
+		{"ok-h2c", &HTTPConfig{H2C: &H2CConfig{TrustedProxies: []string{"10.0.0.0/8", "127.0.0.1", "::1", "fd00::/8"}}}, false},
+		{"fail-keepAlivePeriod", &HTTPConfig{KeepAlivePeriod: negative}, true},
+		{"fail-idleTimeout", &HTTPConfig{IdleTimeout: negative}, true},
+		{"fail-readHeaderTimeout", &HTTPConfig{ReadHeaderTimeout: negative}, true},
+		{"fail-h2c-disabled", &HTTPConfig{DisableHTTP2: true, H2C: &H2CConfig{TrustedProxies: []string{"10.0.0.0/8"}}}, true},
+		{"fail-h2c-empty", &HTTPConfig{H2C: &H2CConfig{}}, true},
+		{"fail-h2c-ip", &HTTPConfig{H2C: &H2CConfig{TrustedProxies: []string{"10.0.0.300"}}}, true},
+		{"fail-h2c-cidr", &HTTPConfig{H2C: &H2CConfig{TrustedProxies: []string{"10.0.0.0/33"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("HTTPConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHTTPConfig_getters(t *testing.T) {
+	var c *HTTPConfig
+	assert.Equals(t, time.Duration(0), c.GetKeepAlivePeriod())
+	assert.Equals(t, time.Duration(0), c.GetIdleTimeout())
+	assert.Equals(t, time.Duration(0), c.GetReadHeaderTimeout())
+	assert.Equals(t, uint32(0), c.GetMaxConcurrentStreams())
+	assert.False(t, c.IsHTTP2Disabled())
+	assert.Nil(t, c.GetH2CTrustedProxies())
+
+	c = &HTTPConfig{
+		KeepAlivePeriod:      &provisioner.Duration{Duration: time.Minute},
+		IdleTimeout:          &provisioner.Duration{Duration: 2 * time.Minute},
+		ReadHeaderTimeout:    &provisioner.Duration{Duration: 10 * time.Second},
+		MaxConcurrentStreams: 100,
+		H2C:                  &H2CConfig{TrustedProxies: []string{"127.0.0.1", "10.0.0.0/8"}},
+	}
+	assert.Equals(t, time.Minute, c.GetKeepAlivePeriod())
+	assert.Equals(t, 2*time.Minute, c.GetIdleTimeout())
+	assert.Equals(t, 10*time.Second, c.GetReadHeaderTimeout())
+	assert.Equals(t, uint32(100), c.GetMaxConcurrentStreams())
+	nets := c.GetH2CTrustedProxies()
+	assert.Len(t, 2, nets)
+	assert.Equals(t, "127.0.0.1/32", nets[0].String())
+	assert.Equals(t, "10.0.0.0/8", nets[1].String())
+}
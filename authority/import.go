@@ -0,0 +1,161 @@
+package authority
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/RTradeLtd/ca-cli/crypto/pemutil"
+	"github.com/RTradeLtd/ca-cli/crypto/x509util"
+	"github.com/pkg/errors"
+)
+
+// ImportCAOptions contains the certificates and key of an external CA.
+type ImportCAOptions struct {
+	// Root is an optional root certificate. If it is not set, the
+	// intermediate must chain to one of the current roots.
+	Root *x509.Certificate
+	// Intermediate is the certificate that will be used to sign new
+	// certificates.
+	Intermediate *x509.Certificate
+	// Key is the PEM encoded private key of the intermediate certificate.
+	Key []byte
+	// Password is the optional password used to decrypt the key.
+	Password []byte
+}
+
+// getIntermediateIdentity returns the identity used to sign certificates.
+func (a *Authority) getIntermediateIdentity() *x509util.Identity {
+	a.caMutex.RLock()
+	defer a.caMutex.RUnlock()
+	return a.intermediateIdentity
+}
+
+// ImportCA replaces the intermediate used to sign certificates with the one of
+// an external CA. If a new root is given it is added to the list of roots, the
+// current roots are kept so previously issued certificates are still trusted.
+// The import is not persisted, the configuration has to be updated to keep
+// using the imported CA after a restart.
+func (a *Authority) ImportCA(opts ImportCAOptions) error {
+	var errContext = apiCtx{}
+	if opts.Intermediate == nil {
+		return &apiError{errors.New("importCA: intermediate certificate cannot be empty"),
+			http.StatusBadRequest, errContext}
+	}
+	errContext["intermediate"] = opts.Intermediate.Subject.String()
+
+	if err := validateCACertificate(opts.Intermediate); err != nil {
+		return &apiError{errors.Wrap(err, "importCA: invalid intermediate certificate"),
+			http.StatusBadRequest, errContext}
+	}
+
+	// Validate the key and that it matches the certificate
+	key, err := parseImportKey(opts.Key, opts.Password)
+	if err != nil {
+		return &apiError{errors.Wrap(err, "importCA"), http.StatusBadRequest, errContext}
+	}
+	pub, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return &apiError{errors.Wrap(err, "importCA: error marshaling public key"),
+			http.StatusBadRequest, errContext}
+	}
+	if !bytes.Equal(pub, opts.Intermediate.RawSubjectPublicKeyInfo) {
+		return &apiError{errors.New("importCA: key does not match the intermediate certificate"),
+			http.StatusBadRequest, errContext}
+	}
+
+	a.caMutex.Lock()
+	defer a.caMutex.Unlock()
+
+	// Validate the chain
+	roots := a.rootX509Certs
+	if opts.Root != nil {
+		errContext["root"] = opts.Root.Subject.String()
+		if err := validateCACertificate(opts.Root); err != nil {
+			return &apiError{errors.Wrap(err, "importCA: invalid root certificate"),
+				http.StatusBadRequest, errContext}
+		}
+		if err := opts.Root.CheckSignatureFrom(opts.Root); err != nil {
+			return &apiError{errors.Wrap(err, "importCA: root certificate is not self-signed"),
+				http.StatusBadRequest, errContext}
+		}
+		roots = []*x509.Certificate{opts.Root}
+	}
+	pool := x509.NewCertPool()
+	for _, crt := range roots {
+		pool.AddCert(crt)
+	}
+	if _, err := opts.Intermediate.Verify(x509.VerifyOptions{
+		Roots:     pool,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return &apiError{errors.Wrap(err, "importCA: error verifying intermediate certificate"),
+			http.StatusBadRequest, errContext}
+	}
+
+	// Switch issuance to the new intermediate
+	if opts.Root != nil && !containsCertificate(a.rootX509Certs, opts.Root) {
+		rootCerts := make([]*x509.Certificate, len(a.rootX509Certs), len(a.rootX509Certs)+1)
+		copy(rootCerts, a.rootX509Certs)
+		a.rootX509Certs = append(rootCerts, opts.Root)
+		sum := sha256.Sum256(opts.Root.Raw)
+		a.certificates.Store(hex.EncodeToString(sum[:]), opts.Root)
+	}
+	identity, err := newIntermediateIdentity(opts.Intermediate, key, a.config.Signer)
+	if err != nil {
+		return &apiError{errors.Wrap(err, "importCA"), http.StatusBadRequest, errContext}
+	}
+	a.intermediateIdentity = identity
+	return nil
+}
+
+// validateCACertificate checks that the given certificate is a valid CA
+// certificate that can sign other certificates.
+func validateCACertificate(crt *x509.Certificate) error {
+	now := time.Now()
+	switch {
+	case !crt.BasicConstraintsValid || !crt.IsCA:
+		return errors.New("certificate is not a CA")
+	case crt.KeyUsage != 0 && crt.KeyUsage&x509.KeyUsageCertSign == 0:
+		return errors.New("certificate key usage does not allow signing certificates")
+	case now.Before(crt.NotBefore):
+		return errors.Errorf("certificate is not valid until %s", crt.NotBefore)
+	case now.After(crt.NotAfter):
+		return errors.Errorf("certificate expired on %s", crt.NotAfter)
+	}
+	return nil
+}
+
+// parseImportKey parses a PEM encoded private key, decrypting it with the
+// given password if necessary.
+func parseImportKey(b, password []byte) (crypto.Signer, error) {
+	if len(b) == 0 {
+		return nil, errors.New("key cannot be empty")
+	}
+	var opts []pemutil.Options
+	if len(password) > 0 {
+		opts = append(opts, pemutil.WithPassword(password))
+	}
+	key, err := pemutil.ParseKey(b, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing key")
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.Errorf("key of type %T is not a private key", key)
+	}
+	return signer, nil
+}
+
+func containsCertificate(list []*x509.Certificate, crt *x509.Certificate) bool {
+	for _, c := range list {
+		if c.Equal(crt) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package authority
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/crypto/keys"
+	"github.com/RTradeLtd/ca-cli/crypto/pemutil"
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+// generateCACertificate creates a CA certificate signed by the given parent.
+// If parent is nil the certificate is self-signed.
+func generateCACertificate(t *testing.T, cn string, parent *x509.Certificate, parentKey crypto.Signer, notAfter time.Time) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), parentKey)
+	assert.FatalError(t, err)
+	crt, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+	return crt, key
+}
+
+func encodeKey(t *testing.T, key *ecdsa.PrivateKey) []byte {
+	b, err := x509.MarshalECPrivateKey(key)
+	assert.FatalError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b})
+}
+
+func TestAuthority_ImportCA(t *testing.T) {
+	notAfter := time.Now().Add(24 * time.Hour)
+	root, rootKey := generateCACertificate(t, "External Root", nil, nil, notAfter)
+	intermediate, intermediateKey := generateCACertificate(t, "External Intermediate", root, rootKey, notAfter)
+	expired, expiredKey := generateCACertificate(t, "Expired Intermediate", root, rootKey, time.Now().Add(-time.Second))
+
+	currentCrt, err := pemutil.ReadCertificate("testdata/certs/intermediate_ca.crt")
+	assert.FatalError(t, err)
+	currentKey, err := ioutil.ReadFile("testdata/secrets/intermediate_ca_key")
+	assert.FatalError(t, err)
+
+	type test struct {
+		opts ImportCAOptions
+		err  error
+	}
+	tests := map[string]func(t *testing.T) *test{
+		"fail/no-intermediate": func(t *testing.T) *test {
+			return &test{
+				opts: ImportCAOptions{Key: encodeKey(t, intermediateKey)},
+				err:  errors.New("importCA: intermediate certificate cannot be empty"),
+			}
+		},
+		"fail/expired": func(t *testing.T) *test {
+			return &test{
+				opts: ImportCAOptions{Root: root, Intermediate: expired, Key: encodeKey(t, expiredKey)},
+				err:  errors.New("importCA: invalid intermediate certificate: certificate expired on"),
+			}
+		},
+		"fail/not-ca": func(t *testing.T) *test {
+			crt := *intermediate
+			crt.IsCA = false
+			return &test{
+				opts: ImportCAOptions{Root: root, Intermediate: &crt, Key: encodeKey(t, intermediateKey)},
+				err:  errors.New("importCA: invalid intermediate certificate: certificate is not a CA"),
+			}
+		},
+		"fail/no-key": func(t *testing.T) *test {
+			return &test{
+				opts: ImportCAOptions{Root: root, Intermediate: intermediate},
+				err:  errors.New("importCA: key cannot be empty"),
+			}
+		},
+		"fail/bad-password": func(t *testing.T) *test {
+			return &test{
+				opts: ImportCAOptions{Intermediate: currentCrt, Key: currentKey, Password: []byte("foo")},
+				err:  errors.New("importCA: error parsing key"),
+			}
+		},
+		"fail/key-mismatch": func(t *testing.T) *test {
+			return &test{
+				opts: ImportCAOptions{Root: root, Intermediate: intermediate, Key: encodeKey(t, expiredKey)},
+				err:  errors.New("importCA: key does not match the intermediate certificate"),
+			}
+		},
+		"fail/root-not-self-signed": func(t *testing.T) *test {
+			return &test{
+				opts: ImportCAOptions{Root: intermediate, Intermediate: intermediate, Key: encodeKey(t, intermediateKey)},
+				err:  errors.New("importCA: root certificate is not self-signed"),
+			}
+		},
+		"fail/unknown-root": func(t *testing.T) *test {
+			return &test{
+				opts: ImportCAOptions{Intermediate: intermediate, Key: encodeKey(t, intermediateKey)},
+				err:  errors.New("importCA: error verifying intermediate certificate"),
+			}
+		},
+		"ok/current-root": func(t *testing.T) *test {
+			return &test{
+				opts: ImportCAOptions{Intermediate: currentCrt, Key: currentKey, Password: []byte("pass")},
+			}
+		},
+		"ok/new-root": func(t *testing.T) *test {
+			return &test{
+				opts: ImportCAOptions{Root: root, Intermediate: intermediate, Key: encodeKey(t, intermediateKey)},
+			}
+		},
+	}
+	for name, genTestCase := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc := genTestCase(t)
+			a := testAuthority(t)
+			oldRoots := a.GetRootCertificates()
+			oldIdentity := a.getIntermediateIdentity()
+
+			err := a.ImportCA(tc.opts)
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					switch v := err.(type) {
+					case *apiError:
+						assert.HasPrefix(t, v.err.Error(), tc.err.Error())
+						assert.Equals(t, http.StatusBadRequest, v.code)
+					default:
+						t.Errorf("unexpected error type: %T", v)
+					}
+				}
+				assert.Equals(t, oldRoots, a.GetRootCertificates())
+				assert.Equals(t, oldIdentity, a.getIntermediateIdentity())
+				return
+			}
+			if !assert.Nil(t, tc.err) {
+				return
+			}
+
+			roots, err := a.GetRoots()
+			assert.FatalError(t, err)
+			if tc.opts.Root != nil {
+				assert.Equals(t, append(oldRoots, tc.opts.Root), roots)
+				sum := sha256.Sum256(tc.opts.Root.Raw)
+				_, err := a.Root(hex.EncodeToString(sum[:]))
+				assert.FatalError(t, err)
+			} else {
+				assert.Equals(t, oldRoots, roots)
+			}
+
+			// New certificates are signed by the imported intermediate.
+			_, priv, err := keys.GenerateDefaultKeyPair()
+			assert.FatalError(t, err)
+			certChain, err := a.Sign(context.Background(), getCSR(t, priv), provisioner.Options{})
+			assert.FatalError(t, err)
+			// The chain is the same one served after a restart.
+			intermediate, err := x509.ParseCertificate(tc.opts.Intermediate.Raw)
+			assert.FatalError(t, err)
+			assert.Equals(t, intermediate, certChain[1])
+			assert.FatalError(t, certChain[0].CheckSignatureFrom(tc.opts.Intermediate))
+		})
+	}
+}
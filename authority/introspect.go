@@ -0,0 +1,116 @@
+package authority
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/pkg/errors"
+)
+
+// TokenIntrospection is the result of the introspection of a one-time token.
+type TokenIntrospection struct {
+	KeyID       string                   `json:"kid,omitempty"`
+	Algorithm   string                   `json:"alg,omitempty"`
+	Claims      map[string]interface{}   `json:"claims"`
+	Audiences   map[string]bool          `json:"audiences"`
+	Provisioner *IntrospectedProvisioner `json:"provisioner,omitempty"`
+	SignOptions []string                 `json:"signOptions,omitempty"`
+	Valid       bool                     `json:"valid"`
+	Errors      []string                 `json:"errors,omitempty"`
+}
+
+// IntrospectedProvisioner contains the provisioner that matches an introspected
+// token.
+type IntrospectedProvisioner struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// IntrospectToken reports how the authority would process the given one-time
+// token in a sign request: the provisioner that matches the token, the
+// request types whose audiences match, and the sign options that would be
+// applied. The token and its nonce are not marked as used, so it is still
+// valid after the introspection, but a token or a nonce that has already been
+// used makes it invalid. Validation errors are reported in the returned
+// introspection, an error is only returned if the token cannot be parsed.
+func (a *Authority) IntrospectToken(ott string) (*TokenIntrospection, error) {
+	token, err := jose.ParseSigned(ott)
+	if err != nil {
+		return nil, &apiError{errors.Wrap(err, "introspectToken: error parsing token"),
+			http.StatusBadRequest, apiCtx{"ott": ott}}
+	}
+
+	ti := &TokenIntrospection{}
+	if len(token.Headers) > 0 {
+		ti.KeyID = token.Headers[0].KeyID
+		ti.Algorithm = token.Headers[0].Algorithm
+	}
+	if err := token.UnsafeClaimsWithoutVerification(&ti.Claims); err != nil {
+		return nil, &apiError{errors.Wrap(err, "introspectToken: error parsing token claims"),
+			http.StatusBadRequest, apiCtx{"ott": ott}}
+	}
+	var claims Claims
+	if err := token.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return nil, &apiError{errors.Wrap(err, "introspectToken: error parsing token claims"),
+			http.StatusBadRequest, apiCtx{"ott": ott}}
+	}
+
+	ti.Audiences = a.config.getAudiences().Match(claims.Audience)
+	if a.config.AuthorityConfig != nil && !a.config.AuthorityConfig.DisableIssuedAtCheck {
+		if claims.IssuedAt != nil && claims.IssuedAt.Time().Before(a.startTime) {
+			ti.Errors = append(ti.Errors, "token issued before the bootstrap of certificate authority")
+		}
+	}
+
+	p, ok := a.getProvisioners().LoadByToken(token, &claims.Claims)
+	if !ok {
+		ti.Errors = append(ti.Errors, fmt.Sprintf("provisioner not found or invalid audience (%s)", strings.Join(claims.Audience, ", ")))
+		return ti, nil
+	}
+	ti.Provisioner = &IntrospectedProvisioner{
+		ID:   p.GetID(),
+		Name: p.GetName(),
+		Type: p.GetType().String(),
+	}
+
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+	opts, err := p.AuthorizeSign(ctx, ott)
+	if err != nil {
+		ti.Errors = append(ti.Errors, err.Error())
+		return ti, nil
+	}
+	for _, op := range a.appendSignOptions(ctx, p, opts) {
+		ti.SignOptions = append(ti.SignOptions, strings.TrimPrefix(fmt.Sprintf("%T", op), "*"))
+	}
+
+	// The checks of authorizeToken that use the token.
+	if reuseKey, err := p.GetTokenID(ott); err == nil {
+		ti.checkUsed(a, reuseKey, "token already used")
+	}
+	if a.isNonceProvisioner(p) {
+		if err := a.checkNonce(claims.Nonce); err != nil {
+			ti.Errors = append(ti.Errors, err.Error())
+		} else {
+			ti.checkUsed(a, nonceTokenIDPrefix+claims.Nonce, "nonce already used")
+		}
+	}
+	ti.Valid = len(ti.Errors) == 0
+	return ti, nil
+}
+
+// checkUsed adds the given message to the errors if the token with the given
+// id has already been used.
+func (ti *TokenIntrospection) checkUsed(a *Authority, id, msg string) {
+	used, err := a.db.IsTokenUsed(id)
+	switch {
+	case err != nil:
+		ti.Errors = append(ti.Errors, errors.Wrap(err, "error checking if token already used").Error())
+	case used:
+		ti.Errors = append(ti.Errors, msg)
+	}
+}
@@ -0,0 +1,217 @@
+package authority
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+func TestAuthority_IntrospectToken(t *testing.T) {
+	jwk, err := jose.ParseKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+
+	signAudience := "https://test.ca.smallstep.com/sign"
+	sans := []string{"test.smallstep.com"}
+	noAudiences := map[string]bool{"sign": false, "revoke": false, "admin": false}
+	signAudiences := map[string]bool{"sign": true, "revoke": false, "admin": false}
+	stepCLI := &IntrospectedProvisioner{
+		ID:   "step-cli:" + jwk.KeyID,
+		Name: "step-cli",
+		Type: "JWK",
+	}
+
+	nonceAuthority := func(t *testing.T) *Authority {
+		a := testAuthority(t)
+		a.config.AuthorityConfig.Nonce = &NonceConfig{Provisioners: []string{"step-cli"}}
+		assert.FatalError(t, a.config.AuthorityConfig.Nonce.Validate(a.config.AuthorityConfig.Provisioners))
+		a.nonceSecret, err = loadNonceSecret(a.config.AuthorityConfig.Nonce)
+		assert.FatalError(t, err)
+		return a
+	}
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+
+	type test struct {
+		auth        *Authority
+		ott         string
+		audiences   map[string]bool
+		provisioner *IntrospectedProvisioner
+		valid       bool
+		errors      []string
+		signOption  string
+		err         error
+		code        int
+	}
+	tests := map[string]func(t *testing.T) *test{
+		"fail/invalid-ott": func(t *testing.T) *test {
+			return &test{
+				auth: testAuthority(t),
+				ott:  "foo",
+				err:  errors.New("introspectToken: error parsing token"),
+				code: http.StatusBadRequest,
+			}
+		},
+		"ok/provisioner-not-found": func(t *testing.T) *test {
+			raw, err := generateToken("test.smallstep.com", "foo", signAudience, sans, time.Now(), jwk)
+			assert.FatalError(t, err)
+			return &test{
+				auth:      testAuthority(t),
+				ott:       raw,
+				audiences: signAudiences,
+				errors:    []string{"provisioner not found or invalid audience (https://test.ca.smallstep.com/sign)"},
+			}
+		},
+		"ok/invalid-audience": func(t *testing.T) *test {
+			raw, err := generateToken("test.smallstep.com", "step-cli", "https://foo.smallstep.com/sign", sans, time.Now(), jwk)
+			assert.FatalError(t, err)
+			return &test{
+				auth:      testAuthority(t),
+				ott:       raw,
+				audiences: noAudiences,
+				errors:    []string{"provisioner not found or invalid audience (https://foo.smallstep.com/sign)"},
+			}
+		},
+		"ok/revoke-audience": func(t *testing.T) *test {
+			raw, err := generateToken("test.smallstep.com", "step-cli", "https://test.ca.smallstep.com/revoke", sans, time.Now(), jwk)
+			assert.FatalError(t, err)
+			return &test{
+				auth:        testAuthority(t),
+				ott:         raw,
+				audiences:   map[string]bool{"sign": false, "revoke": true, "admin": false},
+				provisioner: stepCLI,
+				errors:      []string{"invalid token: invalid audience claim (aud)"},
+			}
+		},
+		"ok/issued-before-start": func(t *testing.T) *test {
+			raw, err := generateToken("test.smallstep.com", "step-cli", signAudience, sans, time.Now().Add(-time.Minute), jwk)
+			assert.FatalError(t, err)
+			a := testAuthority(t)
+			a.startTime = time.Now()
+			return &test{
+				auth:        a,
+				ott:         raw,
+				audiences:   signAudiences,
+				provisioner: stepCLI,
+				errors:      []string{"token issued before the bootstrap of certificate authority"},
+			}
+		},
+		"ok": func(t *testing.T) *test {
+			raw, err := generateToken("test.smallstep.com", "step-cli", signAudience, sans, time.Now(), jwk)
+			assert.FatalError(t, err)
+			return &test{
+				auth:        testAuthority(t),
+				ott:         raw,
+				audiences:   signAudiences,
+				provisioner: stepCLI,
+				valid:       true,
+				signOption:  "provisioner.profileDefaultDuration",
+			}
+		},
+		"ok/token-already-used": func(t *testing.T) *test {
+			raw, err := generateToken("test.smallstep.com", "step-cli", signAudience, sans, time.Now(), jwk)
+			assert.FatalError(t, err)
+			a := testAuthority(t)
+			_, err = a.Authorize(ctx, raw)
+			assert.FatalError(t, err)
+			return &test{
+				auth:        a,
+				ott:         raw,
+				audiences:   signAudiences,
+				provisioner: stepCLI,
+				errors:      []string{"token already used"},
+			}
+		},
+		"ok/nonce-missing": func(t *testing.T) *test {
+			return &test{
+				auth:        nonceAuthority(t),
+				ott:         generateNonceToken(t, "", jwk),
+				audiences:   signAudiences,
+				provisioner: stepCLI,
+				errors:      []string{"token does not contain a nonce"},
+			}
+		},
+		"ok/nonce-already-used": func(t *testing.T) *test {
+			a := nonceAuthority(t)
+			nonce, _, err := a.NewNonce()
+			assert.FatalError(t, err)
+			_, err = a.Authorize(ctx, generateNonceToken(t, nonce, jwk))
+			assert.FatalError(t, err)
+			return &test{
+				auth:        a,
+				ott:         generateNonceToken(t, nonce, jwk),
+				audiences:   signAudiences,
+				provisioner: stepCLI,
+				errors:      []string{"nonce already used"},
+			}
+		},
+		"ok/nonce": func(t *testing.T) *test {
+			a := nonceAuthority(t)
+			nonce, _, err := a.NewNonce()
+			assert.FatalError(t, err)
+			return &test{
+				auth:        a,
+				ott:         generateNonceToken(t, nonce, jwk),
+				audiences:   signAudiences,
+				provisioner: stepCLI,
+				valid:       true,
+				signOption:  "provisioner.profileDefaultDuration",
+			}
+		},
+		"ok/admin": func(t *testing.T) *test {
+			raw, err := generateToken("test.smallstep.com", "step-cli", signAudience, sans, time.Now(), jwk)
+			assert.FatalError(t, err)
+			return &test{
+				auth:        testAdminAuthority(t),
+				ott:         raw,
+				audiences:   signAudiences,
+				provisioner: stepCLI,
+				valid:       true,
+				signOption:  "provisioner.adminExtensionOption",
+			}
+		},
+	}
+	for name, genTestCase := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc := genTestCase(t)
+			ti, err := tc.auth.IntrospectToken(tc.ott)
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					switch v := err.(type) {
+					case *apiError:
+						assert.HasPrefix(t, v.err.Error(), tc.err.Error())
+						assert.Equals(t, v.code, tc.code)
+					default:
+						t.Errorf("unexpected error type: %T", v)
+					}
+				}
+				return
+			}
+			if assert.Nil(t, tc.err) {
+				assert.Equals(t, jwk.KeyID, ti.KeyID)
+				assert.Equals(t, "ES256", ti.Algorithm)
+				assert.Equals(t, "test.smallstep.com", ti.Claims["sub"])
+				assert.Equals(t, tc.audiences, ti.Audiences)
+				assert.Equals(t, tc.provisioner, ti.Provisioner)
+				assert.Equals(t, tc.valid, ti.Valid)
+				assert.Equals(t, tc.errors, ti.Errors)
+				if tc.signOption != "" {
+					var found bool
+					for _, s := range ti.SignOptions {
+						found = found || s == tc.signOption
+					}
+					assert.True(t, found, "sign option %s not found in %v", tc.signOption, ti.SignOptions)
+				}
+				if tc.valid {
+					// The token and its nonce can still be used.
+					_, err := tc.auth.Authorize(ctx, tc.ott)
+					assert.FatalError(t, err)
+				}
+			}
+		})
+	}
+}
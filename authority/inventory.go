@@ -0,0 +1,259 @@
+package authority
+
+import (
+	"crypto/x509"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/pkg/errors"
+)
+
+// Kinds of the inventory entries.
+const (
+	InventoryHost     = "host"
+	InventoryWorkload = "workload"
+)
+
+// maxInventorySerials is the number of certificates kept in an inventory
+// entry, the oldest are removed first.
+const maxInventorySerials = 100
+
+// errInventoryNotFound aborts the update of an entry that does not exist.
+var errInventoryNotFound = errors.New("inventory entry not found")
+
+// InventoryOptions are the attributes of a host or a workload registered in
+// the inventory.
+type InventoryOptions struct {
+	Kind  string
+	Tags  []string
+	Owner string
+}
+
+// InventoryFilter contains the conditions that the inventory entries must
+// match. An entry must have all the tags. Empty fields are ignored.
+type InventoryFilter struct {
+	Tags  []string
+	Kind  string
+	Owner string
+}
+
+func (f *InventoryFilter) match(e *db.InventoryEntry) bool {
+	if f.Kind != "" && f.Kind != e.Kind {
+		return false
+	}
+	if f.Owner != "" && f.Owner != e.Owner {
+		return false
+	}
+	for _, tag := range f.Tags {
+		if !containsString(e.Tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// getInventoryStore returns the database as an InventoryStore.
+func (a *Authority) getInventoryStore(op string, errContext apiCtx) (db.InventoryStore, error) {
+	store, ok := a.db.(db.InventoryStore)
+	if !ok {
+		return nil, &apiError{errors.Errorf("%s: no persistence layer configured", op),
+			http.StatusNotImplemented, errContext}
+	}
+	return store, nil
+}
+
+// inventoryError converts the errors of the inventory store.
+func inventoryError(op, name string, err error, errContext apiCtx) error {
+	switch err {
+	case db.ErrNotFound, errInventoryNotFound:
+		return &apiError{errors.Errorf("%s: inventory entry %s was not found", op, name),
+			http.StatusNotFound, errContext}
+	default:
+		return &apiError{errors.Wrap(err, op), http.StatusInternalServerError, errContext}
+	}
+}
+
+// validateInventoryName returns an error if the name cannot be used in the
+// path of the inventory endpoints.
+func validateInventoryName(op, name string, errContext apiCtx) error {
+	if name == "" || strings.Contains(name, "/") {
+		return &apiError{errors.Errorf("%s: invalid inventory name '%s'", op, name),
+			http.StatusBadRequest, errContext}
+	}
+	return nil
+}
+
+// RegisterInventoryEntry registers a host or a workload in the inventory, or
+// updates the kind, tags and owner of an existing one. The certificates
+// linked to it are kept.
+func (a *Authority) RegisterInventoryEntry(name string, opts InventoryOptions) (*db.InventoryEntry, error) {
+	errContext := apiCtx{"name": name}
+	if err := validateInventoryName("registerInventoryEntry", name, errContext); err != nil {
+		return nil, err
+	}
+	switch opts.Kind {
+	case "":
+		opts.Kind = InventoryHost
+	case InventoryHost, InventoryWorkload:
+	default:
+		return nil, &apiError{errors.Errorf("registerInventoryEntry: unsupported kind %s", opts.Kind),
+			http.StatusBadRequest, errContext}
+	}
+	store, err := a.getInventoryStore("registerInventoryEntry", errContext)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	e, err := store.UpdateInventoryEntry(name, func(e *db.InventoryEntry) (*db.InventoryEntry, error) {
+		if e == nil {
+			e = &db.InventoryEntry{Name: name, CreatedAt: now}
+		}
+		e.Kind = opts.Kind
+		e.Tags = opts.Tags
+		e.Owner = opts.Owner
+		e.UpdatedAt = now
+		return e, nil
+	})
+	if err != nil {
+		return nil, inventoryError("registerInventoryEntry", name, err, errContext)
+	}
+	return e, nil
+}
+
+// GetInventoryEntry returns the inventory entry with the given name.
+func (a *Authority) GetInventoryEntry(name string) (*db.InventoryEntry, error) {
+	errContext := apiCtx{"name": name}
+	store, err := a.getInventoryStore("getInventoryEntry", errContext)
+	if err != nil {
+		return nil, err
+	}
+	e, err := store.GetInventoryEntry(name)
+	if err != nil {
+		return nil, inventoryError("getInventoryEntry", name, err, errContext)
+	}
+	return e, nil
+}
+
+// GetInventoryEntries returns the inventory entries that match the given
+// filter sorted by name. The cursor is the name of the first entry to
+// return, and the returned cursor can be used to get the next page.
+func (a *Authority) GetInventoryEntries(filter InventoryFilter, cursor string, limit int) ([]*db.InventoryEntry, string, error) {
+	errContext := apiCtx{"cursor": cursor, "limit": limit}
+	store, err := a.getInventoryStore("getInventoryEntries", errContext)
+	if err != nil {
+		return nil, "", err
+	}
+	switch {
+	case limit <= 0:
+		limit = DefaultCertificatesLimit
+	case limit > DefaultCertificatesMax:
+		limit = DefaultCertificatesMax
+	}
+
+	entries, err := store.GetInventoryEntries()
+	if err != nil {
+		return nil, "", &apiError{errors.Wrap(err, "getInventoryEntries"),
+			http.StatusInternalServerError, errContext}
+	}
+	list := []*db.InventoryEntry{}
+	for _, e := range entries {
+		if e.Name < cursor || !filter.match(e) {
+			continue
+		}
+		if len(list) == limit {
+			return list, e.Name, nil
+		}
+		list = append(list, e)
+	}
+	return list, "", nil
+}
+
+// DeleteInventoryEntry removes the entry with the given name from the
+// inventory. The certificates linked to it are not modified.
+func (a *Authority) DeleteInventoryEntry(name string) error {
+	errContext := apiCtx{"name": name}
+	store, err := a.getInventoryStore("deleteInventoryEntry", errContext)
+	if err != nil {
+		return err
+	}
+	if err := store.DeleteInventoryEntry(name); err != nil {
+		return inventoryError("deleteInventoryEntry", name, err, errContext)
+	}
+	return nil
+}
+
+// LinkInventoryCertificate links the issued certificate with the given serial
+// number to the inventory entry with the given name.
+func (a *Authority) LinkInventoryCertificate(name, serial string) (*db.InventoryEntry, error) {
+	errContext := apiCtx{"name": name, "serialNumber": serial}
+	store, err := a.getInventoryStore("linkInventoryCertificate", errContext)
+	if err != nil {
+		return nil, err
+	}
+	switch _, err := a.getReadDB().GetCertificate(serial); err {
+	case nil:
+	case db.ErrNotFound:
+		return nil, &apiError{errors.Errorf("linkInventoryCertificate: certificate with serial number %s was not found", serial),
+			http.StatusNotFound, errContext}
+	default:
+		return nil, &apiError{errors.Wrap(err, "linkInventoryCertificate"),
+			http.StatusInternalServerError, errContext}
+	}
+	e, err := linkInventorySerial(store, name, serial)
+	if err != nil {
+		return nil, inventoryError("linkInventoryCertificate", name, err, errContext)
+	}
+	return e, nil
+}
+
+// linkInventory links a new certificate to the inventory entries named after
+// its common name or one of its DNS names, IP addresses or email addresses.
+// The errors are logged, the certificate can be linked later.
+func (a *Authority) linkInventory(crt *x509.Certificate) {
+	store, ok := a.db.(db.InventoryStore)
+	if !ok {
+		return
+	}
+	serial := crt.SerialNumber.String()
+	var names []string
+	for _, name := range append([]string{crt.Subject.CommonName}, certificateSANs(crt)...) {
+		if name != "" && !strings.Contains(name, "/") && !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+	for _, name := range names {
+		if _, err := linkInventorySerial(store, name, serial); err != nil && err != errInventoryNotFound {
+			log.Printf("error linking certificate %s to inventory entry %s: %v", serial, name, err)
+		}
+	}
+}
+
+// linkInventorySerial adds the serial number to an existing inventory entry.
+func linkInventorySerial(store db.InventoryStore, name, serial string) (*db.InventoryEntry, error) {
+	return store.UpdateInventoryEntry(name, func(e *db.InventoryEntry) (*db.InventoryEntry, error) {
+		if e == nil {
+			return nil, errInventoryNotFound
+		}
+		if !containsString(e.Serials, serial) {
+			e.Serials = append(e.Serials, serial)
+			if n := len(e.Serials); n > maxInventorySerials {
+				e.Serials = e.Serials[n-maxInventorySerials:]
+			}
+			e.UpdatedAt = time.Now().UTC()
+		}
+		return e, nil
+	})
+}
@@ -0,0 +1,125 @@
+package authority
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/smallstep/assert"
+)
+
+func TestAuthority_Inventory(t *testing.T) {
+	a := testAuthority(t)
+	_, err := a.RegisterInventoryEntry("web1", InventoryOptions{})
+	if assert.NotNil(t, err) {
+		assert.Equals(t, http.StatusNotImplemented, err.(*apiError).code)
+	}
+
+	memory, err := db.New(&db.Config{Type: db.MemoryType})
+	assert.FatalError(t, err)
+	a.db = memory
+
+	// Registration and validation.
+	e, err := a.RegisterInventoryEntry("web1", InventoryOptions{Tags: []string{"web", "prod"}, Owner: "ops"})
+	assert.FatalError(t, err)
+	assert.Equals(t, InventoryHost, e.Kind)
+	createdAt := e.CreatedAt
+	_, err = a.RegisterInventoryEntry("api", InventoryOptions{Kind: InventoryWorkload, Tags: []string{"prod"}})
+	assert.FatalError(t, err)
+	for name, opts := range map[string]InventoryOptions{
+		"":      {},
+		"a/b":   {},
+		"other": {Kind: "vm"},
+	} {
+		_, err := a.RegisterInventoryEntry(name, opts)
+		if assert.NotNil(t, err) {
+			assert.Equals(t, http.StatusBadRequest, err.(*apiError).code)
+		}
+	}
+
+	// Certificates are linked on issuance and on demand.
+	now := time.Now()
+	crt := generateIssuedCertificate(t, a, "web1", "", now, now.Add(time.Hour))
+	other := generateIssuedCertificate(t, a, "other.smallstep.com", "", now, now.Add(time.Hour))
+	serial, otherSerial := crt.SerialNumber.String(), other.SerialNumber.String()
+	assert.FatalError(t, a.storeCertificate(crt, nil))
+	e, err = a.GetInventoryEntry("web1")
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{serial}, e.Serials)
+	e, err = a.GetInventoryEntry("api")
+	assert.FatalError(t, err)
+	assert.Len(t, 0, e.Serials)
+	_, err = a.LinkInventoryCertificate("web1", otherSerial)
+	if assert.NotNil(t, err) {
+		assert.Equals(t, http.StatusNotFound, err.(*apiError).code)
+	}
+	assert.FatalError(t, a.storeCertificate(other, nil))
+	e, err = a.LinkInventoryCertificate("web1", otherSerial)
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{serial, otherSerial}, e.Serials)
+	_, err = a.LinkInventoryCertificate("web2", otherSerial)
+	if assert.NotNil(t, err) {
+		assert.Equals(t, http.StatusNotFound, err.(*apiError).code)
+	}
+
+	// An update keeps the certificates.
+	e, err = a.RegisterInventoryEntry("web1", InventoryOptions{Tags: []string{"web"}, Owner: "ops"})
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"web"}, e.Tags)
+	assert.Equals(t, []string{serial, otherSerial}, e.Serials)
+	assert.Equals(t, createdAt, e.CreatedAt)
+
+	// Filters and pagination.
+	list, next, err := a.GetInventoryEntries(InventoryFilter{Tags: []string{"prod"}}, "", 0)
+	assert.FatalError(t, err)
+	if assert.Len(t, 1, list) {
+		assert.Equals(t, "api", list[0].Name)
+	}
+	assert.Equals(t, "", next)
+	list, next, err = a.GetInventoryEntries(InventoryFilter{}, "", 1)
+	assert.FatalError(t, err)
+	if assert.Len(t, 1, list) {
+		assert.Equals(t, "api", list[0].Name)
+	}
+	assert.Equals(t, "web1", next)
+	list, next, err = a.GetInventoryEntries(InventoryFilter{Kind: InventoryHost, Owner: "ops"}, next, 1)
+	assert.FatalError(t, err)
+	if assert.Len(t, 1, list) {
+		assert.Equals(t, "web1", list[0].Name)
+	}
+	assert.Equals(t, "", next)
+
+	assert.FatalError(t, a.DeleteInventoryEntry("web1"))
+	_, err = a.GetInventoryEntry("web1")
+	if assert.NotNil(t, err) {
+		assert.Equals(t, http.StatusNotFound, err.(*apiError).code)
+	}
+	err = a.DeleteInventoryEntry("web1")
+	if assert.NotNil(t, err) {
+		assert.Equals(t, http.StatusNotFound, err.(*apiError).code)
+	}
+}
+
+func Test_linkInventorySerial(t *testing.T) {
+	memory, err := db.New(&db.Config{Type: db.MemoryType})
+	assert.FatalError(t, err)
+	store := memory.(db.InventoryStore)
+	_, err = store.UpdateInventoryEntry("web1", func(e *db.InventoryEntry) (*db.InventoryEntry, error) {
+		return &db.InventoryEntry{Name: "web1"}, nil
+	})
+	assert.FatalError(t, err)
+
+	// Only the newest certificates are kept.
+	var e *db.InventoryEntry
+	for i := 0; i < maxInventorySerials+2; i++ {
+		e, err = linkInventorySerial(store, "web1", strconv.Itoa(i))
+		assert.FatalError(t, err)
+	}
+	assert.Len(t, maxInventorySerials, e.Serials)
+	assert.Equals(t, "2", e.Serials[0])
+
+	_, err = linkInventorySerial(store, "web2", "1")
+	assert.Equals(t, errInventoryNotFound, err)
+}
@@ -0,0 +1,58 @@
+package authority
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/pkg/errors"
+)
+
+// revokeActor returns the identity recorded in the journal for a revocation:
+// the admin if the request was authenticated as an admin request, the
+// subject of the token and its provisioner, or the common name of the
+// certificate revoking itself over mTLS.
+func revokeActor(ctx context.Context, p provisioner.Interface, opts *RevokeOptions) string {
+	if admin, ok := logging.GetUserID(ctx); ok && admin != "" {
+		return "admin:" + admin
+	}
+	if opts.MTLS {
+		return "certificate:" + opts.Crt.Subject.CommonName
+	}
+	var subject string
+	if token, err := jose.ParseSigned(opts.OTT); err == nil {
+		var claims jose.Claims
+		if err := token.UnsafeClaimsWithoutVerification(&claims); err == nil {
+			subject = claims.Subject
+		}
+	}
+	return "provisioner:" + p.GetName() + ":" + subject
+}
+
+// GetJournal returns the changes of the database between from and to, both
+// included, sorted by time; a zero time does not limit the range.
+func (a *Authority) GetJournal(from, to time.Time) ([]*db.JournalEntry, error) {
+	entries, err := a.getReadDB().GetJournal()
+	switch err {
+	case nil:
+	case db.ErrNotImplemented:
+		return nil, &apiError{errors.New("getJournal: no persistence layer configured"),
+			http.StatusNotImplemented, apiCtx{}}
+	default:
+		return nil, &apiError{errors.Wrap(err, "getJournal"),
+			http.StatusInternalServerError, apiCtx{}}
+	}
+
+	journal := []*db.JournalEntry{}
+	for _, e := range entries {
+		if (!from.IsZero() && e.Time.Before(from)) || (!to.IsZero() && e.Time.After(to)) {
+			continue
+		}
+		journal = append(journal, e)
+	}
+	return journal, nil
+}
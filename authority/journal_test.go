@@ -0,0 +1,68 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+func TestAuthority_GetJournal(t *testing.T) {
+	t0 := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+	entries := []*db.JournalEntry{
+		{ID: "1", Time: t0, Actor: "provisioner:step-cli:foo", Operation: db.JournalRevoke, Table: "revoked_x509_certs", Key: "1"},
+		{ID: "2", Time: t0.Add(time.Hour), Actor: db.JournalRetention, Operation: db.JournalDelete, Table: "x509_certs", Key: "1", Digest: "sha256:abc"},
+	}
+
+	tests := []struct {
+		name     string
+		db       *MockAuthDB
+		from, to time.Time
+		want     []*db.JournalEntry
+		code     int
+	}{
+		{"ok", &MockAuthDB{ret1: entries}, time.Time{}, time.Time{}, entries, 0},
+		{"ok/from", &MockAuthDB{ret1: entries}, t0.Add(time.Minute), time.Time{}, entries[1:], 0},
+		{"ok/to", &MockAuthDB{ret1: entries}, time.Time{}, t0, entries[:1], 0},
+		{"ok/empty", &MockAuthDB{ret1: []*db.JournalEntry{}}, time.Time{}, time.Time{}, []*db.JournalEntry{}, 0},
+		{"fail/not-implemented", &MockAuthDB{err: db.ErrNotImplemented}, time.Time{}, time.Time{}, nil, http.StatusNotImplemented},
+		{"fail/db", &MockAuthDB{err: errors.New("force")}, time.Time{}, time.Time{}, nil, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t)
+			a.db = tt.db
+			got, err := a.GetJournal(tt.from, tt.to)
+			if tt.code != 0 {
+				if assert.NotNil(t, err) {
+					if v, ok := err.(*apiError); assert.True(t, ok) {
+						assert.Equals(t, tt.code, v.code)
+					}
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
+
+func Test_revokeActor(t *testing.T) {
+	a := testAuthority(t)
+	p, ok := findProvisionerByName(a.config.AuthorityConfig.Provisioners, "step-cli")
+	assert.Fatal(t, ok)
+
+	ctx := logging.WithUserID(context.Background(), "admin@example.com")
+	assert.Equals(t, "admin:admin@example.com", revokeActor(ctx, p, &RevokeOptions{MTLS: true}))
+
+	crt := &x509.Certificate{Subject: pkix.Name{CommonName: "foo.internal"}}
+	assert.Equals(t, "certificate:foo.internal", revokeActor(context.Background(), p, &RevokeOptions{MTLS: true, Crt: crt}))
+	assert.Equals(t, "provisioner:step-cli:", revokeActor(context.Background(), p, &RevokeOptions{OTT: "foo"}))
+}
@@ -0,0 +1,247 @@
+package authority
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/crypto/x509util"
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/pkg/errors"
+)
+
+// defaultJWTSVIDDuration is the validity of the JWT-SVIDs if
+// authority.jwtSVID.duration is not set.
+const defaultJWTSVIDDuration = 5 * time.Minute
+
+// JWTSVIDConfig enables the issuance of JWT-SVIDs, short-lived JWTs asserting
+// a SPIFFE ID in TrustDomain, for the systems that authenticate with bearer
+// tokens instead of mTLS. The sign requests of the Provisioners can get a
+// JWT-SVID for the SPIFFE ID that the certificate would have. The tokens are
+// signed with Key, a JWK or PEM file decrypted with the password of the CA,
+// and they are valid for Duration, 5m by default.
+type JWTSVIDConfig struct {
+	Key          string                `json:"key"`
+	TrustDomain  string                `json:"trustDomain"`
+	Provisioners []string              `json:"provisioners"`
+	Duration     *provisioner.Duration `json:"duration,omitempty"`
+}
+
+// Validate validates the JWT-SVID configuration and sets the default values.
+func (c *JWTSVIDConfig) Validate(provisioners provisioner.List) error {
+	if c == nil {
+		return nil
+	}
+	if c.Key == "" {
+		return errors.New("authority.jwtSVID.key cannot be empty")
+	}
+	if c.TrustDomain == "" || strings.ContainsAny(c.TrustDomain, ":/") {
+		return errors.Errorf("authority.jwtSVID.trustDomain %s is not valid", c.TrustDomain)
+	}
+	if len(c.Provisioners) == 0 {
+		return errors.New("authority.jwtSVID.provisioners cannot be empty")
+	}
+	for _, name := range c.Provisioners {
+		if _, ok := findProvisionerByName(provisioners, name); !ok {
+			return errors.Errorf("authority.jwtSVID.provisioners: provisioner %s not found", name)
+		}
+	}
+	if c.Duration == nil {
+		c.Duration = &provisioner.Duration{Duration: defaultJWTSVIDDuration}
+	} else if c.Duration.Duration <= 0 {
+		return errors.New("authority.jwtSVID.duration must be greater than 0")
+	}
+	return nil
+}
+
+// jwtSVIDOption is a SignOption added to the sign requests of the
+// provisioners that can get JWT-SVIDs.
+type jwtSVIDOption struct {
+	provisioner string
+}
+
+// isJWTSVIDProvisioner returns true if the sign requests of the given
+// provisioner can get JWT-SVIDs.
+func (a *Authority) isJWTSVIDProvisioner(p provisioner.Interface) bool {
+	if a.config.AuthorityConfig == nil || a.config.AuthorityConfig.JWTSVID == nil {
+		return false
+	}
+	for _, name := range a.config.AuthorityConfig.JWTSVID.Provisioners {
+		if p.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// loadJWTSVIDKey reads the key used to sign the JWT-SVIDs. The key id
+// defaults to the thumbprint of the key.
+func loadJWTSVIDKey(c *JWTSVIDConfig, password string) (*jose.JSONWebKey, error) {
+	var opts []jose.Option
+	if password != "" {
+		opts = append(opts, jose.WithPassword([]byte(password)))
+	}
+	jwk, err := jose.ParseKey(c.Key, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading authority.jwtSVID.key %s", c.Key)
+	}
+	if jwk.IsPublic() {
+		return nil, errors.Errorf("authority.jwtSVID.key %s is not a private key", c.Key)
+	}
+	if jwk.Algorithm == "" {
+		switch jwk.Key.(type) {
+		case *ecdsa.PrivateKey:
+			jwk.Algorithm = jose.ES256
+		case *rsa.PrivateKey:
+			jwk.Algorithm = jose.RS256
+		case ed25519.PrivateKey:
+			jwk.Algorithm = jose.EdDSA
+		default:
+			return nil, errors.Errorf("authority.jwtSVID.key %s of type %T is not supported", c.Key, jwk.Key)
+		}
+	}
+	if jwk.KeyID == "" {
+		pub := jwk.Public()
+		b, err := pub.Thumbprint(crypto.SHA256)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error generating the thumbprint of authority.jwtSVID.key %s", c.Key)
+		}
+		jwk.KeyID = base64.RawURLEncoding.EncodeToString(b)
+	}
+	return jwk, nil
+}
+
+// GetJWTSVIDKeys returns the public keys used to verify the JWT-SVIDs. The
+// set is empty if the issuance of JWT-SVIDs is not enabled.
+func (a *Authority) GetJWTSVIDKeys() jose.JSONWebKeySet {
+	if a.jwtSVIDKey == nil {
+		return jose.JSONWebKeySet{Keys: []jose.JSONWebKey{}}
+	}
+	return jose.JSONWebKeySet{Keys: []jose.JSONWebKey{a.jwtSVIDKey.Public()}}
+}
+
+// SignJWTSVID creates a JWT-SVID for the given SPIFFE ID and audience using
+// the sign options of a sign request. The SPIFFE ID must be in the trust
+// domain, and it must be a URI SAN of the certificate that the sign request
+// would get for it, so the provisioner validations and modifiers apply as if
+// the certificate was signed. The token expires after the configured
+// duration, or with the certificate if it expires first.
+func (a *Authority) SignJWTSVID(ctx context.Context, spiffeID string, audience []string, signOpts ...provisioner.SignOption) (string, time.Time, error) {
+	var errContext = apiCtx{"spiffeID": spiffeID, "audience": audience}
+	if a.jwtSVIDKey == nil {
+		return "", time.Time{}, &apiError{errors.New("signJWTSVID: jwt-svid issuance is not enabled"),
+			http.StatusNotImplemented, errContext}
+	}
+	config := a.config.AuthorityConfig.JWTSVID
+	u, err := url.Parse(spiffeID)
+	if err != nil || u.Scheme != "spiffe" || u.Host != config.TrustDomain || u.Path == "" || u.RawQuery != "" || u.Fragment != "" {
+		return "", time.Time{}, &apiError{errors.Errorf("signJWTSVID: spiffeID %s is not valid in the trust domain %s", spiffeID, config.TrustDomain),
+			http.StatusBadRequest, errContext}
+	}
+	if len(audience) == 0 {
+		return "", time.Time{}, &apiError{errors.New("signJWTSVID: audience cannot be empty"),
+			http.StatusBadRequest, errContext}
+	}
+
+	// The certificate request that the sign request would have.
+	key, err := generateKey("EC", "P-256", 0)
+	if err != nil {
+		return "", time.Time{}, &apiError{errors.Wrap(err, "signJWTSVID"), http.StatusInternalServerError, errContext}
+	}
+	csr := &x509.CertificateRequest{
+		PublicKey:          key.Public(),
+		PublicKeyAlgorithm: x509.ECDSA,
+		URIs:               []*url.URL{u},
+	}
+	csr.Subject.CommonName = spiffeID
+
+	var (
+		allowed        bool
+		mods           = []x509util.WithOption{withDefaultASN1DN(a.config.AuthorityConfig.Template)}
+		certValidators []provisioner.CertificateValidator
+	)
+	for _, op := range signOpts {
+		switch k := op.(type) {
+		case jwtSVIDOption:
+			allowed = true
+		case approvalRequiredOption:
+			return "", time.Time{}, &apiError{errors.Errorf("signJWTSVID: certificate requests from provisioner %s require approval", k.provisioner),
+				http.StatusForbidden, errContext}
+		case certificateDataOption, keyGenerationOption:
+		case provisioner.CertificateValidator:
+			certValidators = append(certValidators, k)
+		case provisioner.CertificateRequestValidator:
+			if err := k.Valid(csr); err != nil {
+				return "", time.Time{}, &apiError{errors.Wrap(err, "signJWTSVID"), http.StatusUnauthorized, errContext}
+			}
+		case provisioner.ProfileModifier:
+			mods = append(mods, k.Option(provisioner.Options{}))
+		}
+	}
+	if !allowed {
+		return "", time.Time{}, &apiError{errors.New("signJWTSVID: provisioner does not allow jwt-svid issuance"),
+			http.StatusForbidden, errContext}
+	}
+
+	issIdentity := a.getIntermediateIdentity()
+	leaf, err := x509util.NewLeafProfileWithCSR(csr, issIdentity.Crt, issIdentity.Key, mods...)
+	if err != nil {
+		return "", time.Time{}, &apiError{errors.Wrap(err, "signJWTSVID"), http.StatusInternalServerError, errContext}
+	}
+	crt := leaf.Subject()
+	for _, v := range certValidators {
+		if err := v.Valid(crt); err != nil {
+			return "", time.Time{}, &apiError{errors.Wrap(err, "signJWTSVID"), http.StatusUnauthorized, errContext}
+		}
+	}
+	var found bool
+	for _, uri := range crt.URIs {
+		if uri.String() == spiffeID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return "", time.Time{}, &apiError{errors.Errorf("signJWTSVID: spiffeID %s is not in the certificate of the sign request", spiffeID),
+			http.StatusForbidden, errContext}
+	}
+
+	now := time.Now()
+	expiry := now.Add(config.Duration.Duration)
+	if !crt.NotAfter.IsZero() && crt.NotAfter.Before(expiry) {
+		expiry = crt.NotAfter
+	}
+	if err := checkContext(ctx, "signJWTSVID", errContext); err != nil {
+		return "", time.Time{}, err
+	}
+
+	so := new(jose.SignerOptions).WithType("JWT").WithHeader("kid", a.jwtSVIDKey.KeyID)
+	signer, err := jose.NewSigner(jose.SigningKey{
+		Algorithm: jose.SignatureAlgorithm(a.jwtSVIDKey.Algorithm),
+		Key:       a.jwtSVIDKey.Key,
+	}, so)
+	if err != nil {
+		return "", time.Time{}, &apiError{errors.Wrap(err, "signJWTSVID: error creating signer"),
+			http.StatusInternalServerError, errContext}
+	}
+	tok, err := jose.Signed(signer).Claims(jose.Claims{
+		Subject:  spiffeID,
+		Audience: jose.Audience(audience),
+		IssuedAt: jose.NewNumericDate(now),
+		Expiry:   jose.NewNumericDate(expiry),
+	}).CompactSerialize()
+	if err != nil {
+		return "", time.Time{}, &apiError{errors.Wrap(err, "signJWTSVID: error signing token"),
+			http.StatusInternalServerError, errContext}
+	}
+	return tok, expiry.Truncate(time.Second), nil
+}
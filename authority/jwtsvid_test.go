@@ -0,0 +1,115 @@
+package authority
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+func TestJWTSVIDConfig_Validate(t *testing.T) {
+	provisioners := provisioner.List{
+		&provisioner.JWK{Type: "JWK", Name: "step-cli"},
+	}
+	tests := []struct {
+		name   string
+		config *JWTSVIDConfig
+		err    error
+	}{
+		{"ok", &JWTSVIDConfig{Key: "jwt.key", TrustDomain: "example.org", Provisioners: []string{"step-cli"}}, nil},
+		{"ok-nil", nil, nil},
+		{"fail-key", &JWTSVIDConfig{TrustDomain: "example.org", Provisioners: []string{"step-cli"}}, errors.New("authority.jwtSVID.key cannot be empty")},
+		{"fail-trust-domain", &JWTSVIDConfig{Key: "jwt.key", TrustDomain: "spiffe://example.org", Provisioners: []string{"step-cli"}}, errors.New("authority.jwtSVID.trustDomain spiffe://example.org is not valid")},
+		{"fail-empty-provisioners", &JWTSVIDConfig{Key: "jwt.key", TrustDomain: "example.org"}, errors.New("authority.jwtSVID.provisioners cannot be empty")},
+		{"fail-provisioner", &JWTSVIDConfig{Key: "jwt.key", TrustDomain: "example.org", Provisioners: []string{"foo"}}, errors.New("authority.jwtSVID.provisioners: provisioner foo not found")},
+		{"fail-duration", &JWTSVIDConfig{Key: "jwt.key", TrustDomain: "example.org", Provisioners: []string{"step-cli"}, Duration: &provisioner.Duration{Duration: -time.Minute}}, errors.New("authority.jwtSVID.duration must be greater than 0")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate(provisioners)
+			if tt.err != nil {
+				if assert.NotNil(t, err) {
+					assert.Equals(t, tt.err.Error(), err.Error())
+				}
+			} else {
+				assert.Nil(t, err)
+				if tt.config != nil {
+					assert.Equals(t, defaultJWTSVIDDuration, tt.config.Duration.Duration)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthority_SignJWTSVID(t *testing.T) {
+	jwk, err := jose.ParseKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+	authorize := func(t *testing.T, a *Authority, sub string) []provisioner.SignOption {
+		token, err := generateToken(sub, "step-cli", "https://test.ca.smallstep.com/sign",
+			[]string{sub}, time.Now(), jwk)
+		assert.FatalError(t, err)
+		ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+		signOpts, err := a.Authorize(ctx, token)
+		assert.FatalError(t, err)
+		return signOpts
+	}
+	assertCode := func(t *testing.T, err error, code int) {
+		if assert.NotNil(t, err) {
+			if v, ok := err.(*apiError); assert.True(t, ok) {
+				assert.Equals(t, code, v.code)
+			}
+		}
+	}
+	const spiffeID = "spiffe://example.org/web"
+	audience := []string{"https://api.example.org"}
+
+	// JWT-SVIDs are not enabled by default.
+	a := testAuthority(t)
+	_, _, err = a.SignJWTSVID(context.Background(), spiffeID, audience, authorize(t, a, spiffeID)...)
+	assertCode(t, err, http.StatusNotImplemented)
+
+	a.config.AuthorityConfig.JWTSVID = &JWTSVIDConfig{
+		Key:          "testdata/secrets/max_priv.jwk",
+		TrustDomain:  "example.org",
+		Provisioners: []string{"step-cli"},
+	}
+	assert.FatalError(t, a.config.AuthorityConfig.JWTSVID.Validate(a.config.AuthorityConfig.Provisioners))
+	a.jwtSVIDKey, err = loadJWTSVIDKey(a.config.AuthorityConfig.JWTSVID, "pass")
+	assert.FatalError(t, err)
+	keys := a.GetJWTSVIDKeys()
+	assert.Len(t, 1, keys.Keys)
+	assert.True(t, keys.Keys[0].IsPublic())
+
+	signOpts := authorize(t, a, spiffeID)
+	token, expiresAt, err := a.SignJWTSVID(context.Background(), spiffeID, audience, signOpts...)
+	assert.FatalError(t, err)
+	assert.True(t, expiresAt.After(time.Now()))
+	assert.False(t, expiresAt.After(time.Now().Add(defaultJWTSVIDDuration)))
+
+	tok, err := jose.ParseSigned(token)
+	assert.FatalError(t, err)
+	var claims jose.Claims
+	assert.FatalError(t, tok.Claims(keys.Keys[0], &claims))
+	assert.FatalError(t, claims.Validate(jose.Expected{Subject: spiffeID, Audience: audience, Time: time.Now()}))
+	assert.Equals(t, keys.Keys[0].KeyID, tok.Headers[0].KeyID)
+
+	// The SPIFFE ID must be in the trust domain.
+	_, _, err = a.SignJWTSVID(context.Background(), "spiffe://example.com/web", audience, signOpts...)
+	assertCode(t, err, http.StatusBadRequest)
+	_, _, err = a.SignJWTSVID(context.Background(), spiffeID, nil, signOpts...)
+	assertCode(t, err, http.StatusBadRequest)
+
+	// The SPIFFE ID must be allowed by the token.
+	_, _, err = a.SignJWTSVID(context.Background(), "spiffe://example.org/db", audience, signOpts...)
+	assertCode(t, err, http.StatusUnauthorized)
+
+	// Only the configured provisioners can get JWT-SVIDs.
+	a.config.AuthorityConfig.JWTSVID.Provisioners = []string{"Max"}
+	_, _, err = a.SignJWTSVID(context.Background(), spiffeID, audience, authorize(t, a, spiffeID)...)
+	assertCode(t, err, http.StatusForbidden)
+}
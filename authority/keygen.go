@@ -0,0 +1,102 @@
+package authority
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/pkg/errors"
+)
+
+// keyGenerationOption is a SignOption added to the sign requests of the
+// provisioners that allow the server-side generation of keys.
+type keyGenerationOption struct {
+	provisioner string
+}
+
+// isKeyGenerationProvisioner returns true if the sign requests of the given
+// provisioner can ask the authority to generate the key of the certificate.
+func (a *Authority) isKeyGenerationProvisioner(p provisioner.Interface) bool {
+	if a.config.AuthorityConfig == nil || a.config.AuthorityConfig.KeyGeneration == nil {
+		return false
+	}
+	for _, name := range a.config.AuthorityConfig.KeyGeneration.Provisioners {
+		if p.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateKey generates the key pair of the certificate of a sign request
+// authorized with the given sign options. The key type is EC, RSA or OKP, and
+// the curve and size default to P-256, 2048 bits and Ed25519. The key is never
+// stored by the authority, and it cannot be generated for the requests that
+// must be approved by an admin.
+func (a *Authority) GenerateKey(signOpts []provisioner.SignOption, kty, crv string, size int) (crypto.Signer, error) {
+	var errContext = apiCtx{"kty": kty, "crv": crv, "size": size}
+
+	var allowed bool
+	for _, op := range signOpts {
+		switch k := op.(type) {
+		case keyGenerationOption:
+			allowed = true
+		case approvalRequiredOption:
+			return nil, &apiError{errors.Errorf("generateKey: certificate requests from provisioner %s require approval", k.provisioner),
+				http.StatusForbidden, errContext}
+		}
+	}
+	if !allowed {
+		return nil, &apiError{errors.New("generateKey: provisioner does not allow server-side key generation"),
+			http.StatusForbidden, errContext}
+	}
+
+	key, err := generateKey(kty, crv, size)
+	if err != nil {
+		return nil, &apiError{errors.Wrap(err, "generateKey"), http.StatusBadRequest, errContext}
+	}
+	return key, nil
+}
+
+// generateKey generates a key that complies with the key policy of the
+// provisioners.
+func generateKey(kty, crv string, size int) (crypto.Signer, error) {
+	switch kty {
+	case "EC", "":
+		var curve elliptic.Curve
+		switch crv {
+		case "P-256", "":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, errors.Errorf("invalid curve %s for key type EC", crv)
+		}
+		return ecdsa.GenerateKey(curve, rand.Reader)
+	case "RSA":
+		switch {
+		case size == 0:
+			size = 2048
+		case size < 2048:
+			return nil, errors.New("rsa key size must be at least 2048 bits")
+		case size > 8192:
+			return nil, errors.New("rsa key size cannot be greater than 8192 bits")
+		}
+		return rsa.GenerateKey(rand.Reader, size)
+	case "OKP":
+		if crv != "Ed25519" && crv != "" {
+			return nil, errors.Errorf("invalid curve %s for key type OKP", crv)
+		}
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	default:
+		return nil, errors.Errorf("invalid key type %s", kty)
+	}
+}
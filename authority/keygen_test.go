@@ -0,0 +1,115 @@
+package authority
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/smallstep/assert"
+)
+
+func TestAuthority_GenerateKey(t *testing.T) {
+	jwk, err := jose.ParseKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+	authorize := func(t *testing.T, a *Authority) []provisioner.SignOption {
+		token, err := generateToken("smallstep test", "step-cli", "https://test.ca.smallstep.com/sign",
+			[]string{"test.smallstep.com"}, time.Now(), jwk)
+		assert.FatalError(t, err)
+		ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+		signOpts, err := a.Authorize(ctx, token)
+		assert.FatalError(t, err)
+		return signOpts
+	}
+	assertCode := func(t *testing.T, err error, code int) {
+		if assert.NotNil(t, err) {
+			if v, ok := err.(*apiError); assert.True(t, ok) {
+				assert.Equals(t, code, v.code)
+			}
+		}
+	}
+
+	// Provisioners cannot request keys by default.
+	a := testAuthority(t)
+	_, err = a.GenerateKey(authorize(t, a), "EC", "", 0)
+	assertCode(t, err, http.StatusForbidden)
+
+	a.config.AuthorityConfig.KeyGeneration = &KeyGenerationConfig{
+		Provisioners: []string{"step-cli"},
+	}
+	signOpts := authorize(t, a)
+	key, err := a.GenerateKey(signOpts, "EC", "P-384", 0)
+	assert.FatalError(t, err)
+	if k, ok := key.(*ecdsa.PrivateKey); assert.True(t, ok) {
+		assert.Equals(t, elliptic.P384(), k.Curve)
+	}
+	_, err = a.GenerateKey(signOpts, "EC", "P-224", 0)
+	assertCode(t, err, http.StatusBadRequest)
+
+	// The certificate is signed as usual.
+	certChain, err := a.Sign(context.Background(), getCSR(t, key), provisioner.Options{}, signOpts...)
+	assert.FatalError(t, err)
+	assert.Equals(t, key.Public(), certChain[0].PublicKey)
+
+	// The keys of requests that must be approved are never generated.
+	a = testApprovalAuthority(t)
+	a.config.AuthorityConfig.KeyGeneration = &KeyGenerationConfig{
+		Provisioners: []string{"step-cli"},
+	}
+	_, err = a.GenerateKey(authorize(t, a), "EC", "", 0)
+	assertCode(t, err, http.StatusForbidden)
+}
+
+func Test_generateKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		kty     string
+		crv     string
+		size    int
+		wantErr bool
+	}{
+		{"ok-default", "", "", 0, false},
+		{"ok-ec", "EC", "P-256", 0, false},
+		{"ok-ec-p521", "EC", "P-521", 0, false},
+		{"ok-rsa", "RSA", "", 0, false},
+		{"ok-rsa-3072", "RSA", "", 3072, false},
+		{"ok-okp", "OKP", "Ed25519", 0, false},
+		{"fail-ec-curve", "EC", "Ed25519", 0, true},
+		{"fail-rsa-small", "RSA", "", 1024, true},
+		{"fail-rsa-large", "RSA", "", 16384, true},
+		{"fail-okp-curve", "OKP", "X25519", 0, true},
+		{"fail-kty", "oct", "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := generateKey(tt.kty, tt.crv, tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("generateKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			switch k := got.(type) {
+			case *ecdsa.PrivateKey:
+				assert.True(t, tt.kty == "EC" || tt.kty == "")
+			case *rsa.PrivateKey:
+				assert.Equals(t, "RSA", tt.kty)
+				if tt.size == 0 {
+					assert.Equals(t, 2048, k.N.BitLen())
+				} else {
+					assert.Equals(t, tt.size, k.N.BitLen())
+				}
+			case ed25519.PrivateKey:
+				assert.Equals(t, "OKP", tt.kty)
+			default:
+				t.Errorf("generateKey() = %T, not expected", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package authority
+
+import (
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/pkg/errors"
+)
+
+// Defaults of the Kubernetes controller.
+const (
+	DefaultKubernetesClusterDomain = "cluster.local"
+	DefaultKubernetesResync        = time.Minute
+)
+
+// KubernetesConfig is the configuration of the controller that issues
+// certificates for the annotated Services and Ingresses of a Kubernetes
+// cluster and writes them in TLS Secrets. The certificates are signed with
+// Provisioner, a JWK provisioner in authority.mint or a K8sSA provisioner that
+// validates the service account token of the CA. By default the controller
+// uses the in-cluster configuration, watches all the namespaces, and checks
+// the Secrets every minute.
+type KubernetesConfig struct {
+	Provisioner   string                `json:"provisioner"`
+	Namespaces    []string              `json:"namespaces,omitempty"`
+	ClusterDomain string                `json:"clusterDomain,omitempty"`
+	CertDuration  *provisioner.Duration `json:"certDuration,omitempty"`
+	RenewBefore   *provisioner.Duration `json:"renewBefore,omitempty"`
+	Resync        *provisioner.Duration `json:"resync,omitempty"`
+	APIServer     string                `json:"apiServer,omitempty"`
+	TokenFile     string                `json:"tokenFile,omitempty"`
+	CAFile        string                `json:"caFile,omitempty"`
+}
+
+// Validate validates the Kubernetes controller configuration.
+func (c *KubernetesConfig) Validate(config *Config) error {
+	if c == nil {
+		return nil
+	}
+	if c.Provisioner == "" {
+		return errors.New("kubernetes.provisioner cannot be empty")
+	}
+	if !config.AuthorityConfig.canMint(c.Provisioner) && !c.IsK8sSA(config) {
+		return errors.Errorf("kubernetes.provisioner %s is not in authority.mint or a K8sSA provisioner", c.Provisioner)
+	}
+	for name, d := range map[string]*provisioner.Duration{
+		"certDuration": c.CertDuration,
+		"renewBefore":  c.RenewBefore,
+		"resync":       c.Resync,
+	} {
+		if d != nil && d.Duration <= 0 {
+			return errors.Errorf("kubernetes.%s must be greater than 0", name)
+		}
+	}
+	if c.CertDuration != nil && c.RenewBefore != nil && c.RenewBefore.Duration >= c.CertDuration.Duration {
+		return errors.New("kubernetes.renewBefore must be less than kubernetes.certDuration")
+	}
+	return nil
+}
+
+// IsK8sSA returns true if the provisioner of the controller is a K8sSA
+// provisioner.
+func (c *KubernetesConfig) IsK8sSA(config *Config) bool {
+	if config.AuthorityConfig == nil {
+		return false
+	}
+	p, ok := findProvisionerByName(config.AuthorityConfig.Provisioners, c.Provisioner)
+	return ok && p.GetType() == provisioner.TypeK8sSA
+}
+
+// GetClusterDomain returns the DNS domain of the cluster.
+func (c *KubernetesConfig) GetClusterDomain() string {
+	if c.ClusterDomain == "" {
+		return DefaultKubernetesClusterDomain
+	}
+	return c.ClusterDomain
+}
+
+// GetCertDuration returns the validity of the certificates, or 0 to use the
+// default of the provisioner.
+func (c *KubernetesConfig) GetCertDuration() time.Duration {
+	if c.CertDuration == nil {
+		return 0
+	}
+	return c.CertDuration.Duration
+}
+
+// GetRenewBefore returns how long before the expiration the certificates are
+// renewed, or 0 to renew them after two thirds of their validity.
+func (c *KubernetesConfig) GetRenewBefore() time.Duration {
+	if c.RenewBefore == nil {
+		return 0
+	}
+	return c.RenewBefore.Duration
+}
+
+// GetResync returns the interval between the checks of the Secrets.
+func (c *KubernetesConfig) GetResync() time.Duration {
+	if c.Resync == nil {
+		return DefaultKubernetesResync
+	}
+	return c.Resync.Duration
+}
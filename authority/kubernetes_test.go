@@ -0,0 +1,55 @@
+package authority
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/smallstep/assert"
+)
+
+func TestKubernetesConfig_Validate(t *testing.T) {
+	config := &Config{
+		AuthorityConfig: &AuthConfig{
+			Provisioners: provisioner.List{
+				&provisioner.K8sSA{Type: "K8sSA", Name: "k8s"},
+				&provisioner.JWK{Type: "JWK", Name: "jwk"},
+			},
+			Mint: &MintConfig{Provisioners: []*MintProvisioner{{Name: "mint"}}},
+		},
+	}
+	duration := func(d time.Duration) *provisioner.Duration {
+		return &provisioner.Duration{Duration: d}
+	}
+
+	tests := []struct {
+		name    string
+		config  *KubernetesConfig
+		wantErr bool
+	}{
+		{"ok-mint", &KubernetesConfig{Provisioner: "mint"}, false},
+		{"ok-k8sSA", &KubernetesConfig{Provisioner: "k8s", CertDuration: duration(time.Hour), RenewBefore: duration(time.Minute), Resync: duration(time.Second)}, false},
+		{"fail-provisioner", &KubernetesConfig{}, true},
+		{"fail-jwk-without-mint", &KubernetesConfig{Provisioner: "jwk"}, true},
+		{"fail-cert-duration", &KubernetesConfig{Provisioner: "mint", CertDuration: duration(0)}, true},
+		{"fail-renew-before", &KubernetesConfig{Provisioner: "mint", RenewBefore: duration(-time.Minute)}, true},
+		{"fail-resync", &KubernetesConfig{Provisioner: "mint", Resync: duration(0)}, true},
+		{"fail-renew-before-cert-duration", &KubernetesConfig{Provisioner: "mint", CertDuration: duration(time.Hour), RenewBefore: duration(time.Hour)}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(config); (err != nil) != tt.wantErr {
+				t.Errorf("KubernetesConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	assert.NoError(t, (*KubernetesConfig)(nil).Validate(config))
+
+	c := &KubernetesConfig{Provisioner: "k8s"}
+	assert.True(t, c.IsK8sSA(config))
+	assert.False(t, (&KubernetesConfig{Provisioner: "jwk"}).IsK8sSA(config))
+	assert.Equals(t, DefaultKubernetesClusterDomain, c.GetClusterDomain())
+	assert.Equals(t, DefaultKubernetesResync, c.GetResync())
+	assert.Equals(t, time.Duration(0), c.GetCertDuration())
+	assert.Equals(t, time.Duration(0), c.GetRenewBefore())
+}
@@ -0,0 +1,70 @@
+package authority
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// DefaultLoadConcurrency is the maximum number of roots, federated roots or
+// provisioners loaded at the same time when the authority starts or the
+// provisioners are reloaded. Loading a provisioner might require requests to
+// an identity provider, e.g. to get the OIDC configuration.
+const DefaultLoadConcurrency = 8
+
+// LoadError is the error returned when some of the roots, federated roots or
+// provisioners cannot be loaded. It contains the error of each item that
+// failed, in the order of the configuration.
+type LoadError struct {
+	Items  []string
+	Errors []error
+}
+
+// Error implements the error interface. With a single error the message is
+// the one of that error.
+func (e *LoadError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = e.Items[i] + ": " + err.Error()
+	}
+	return fmt.Sprintf("%d errors loading the authority: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// loadConcurrently calls load for each one of the given items, with at most
+// DefaultLoadConcurrency calls at the same time. It waits for all the calls
+// and it returns a *LoadError with the items that failed, or nil.
+func loadConcurrently(items []string, load func(i int) error) error {
+	errs := make([]error, len(items))
+	sem := make(chan struct{}, DefaultLoadConcurrency)
+	var wg sync.WaitGroup
+	for i := range items {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[i] = load(i)
+		}(i)
+	}
+	wg.Wait()
+
+	var loadErr *LoadError
+	for i, err := range errs {
+		if err != nil {
+			if loadErr == nil {
+				loadErr = new(LoadError)
+			}
+			loadErr.Items = append(loadErr.Items, items[i])
+			loadErr.Errors = append(loadErr.Errors, err)
+		}
+	}
+	if loadErr == nil {
+		return nil
+	}
+	return loadErr
+}
@@ -0,0 +1,76 @@
+package authority
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+func Test_loadConcurrently(t *testing.T) {
+	items := make([]string, 3*DefaultLoadConcurrency)
+	for i := range items {
+		items[i] = "item"
+	}
+
+	var mu sync.Mutex
+	var inFlight, max int
+	loaded := make([]bool, len(items))
+	assert.FatalError(t, loadConcurrently(items, func(i int) error {
+		mu.Lock()
+		inFlight++
+		if inFlight > max {
+			max = inFlight
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		loaded[i] = true
+		mu.Unlock()
+		return nil
+	}))
+	assert.True(t, max <= DefaultLoadConcurrency)
+	for _, ok := range loaded {
+		assert.True(t, ok)
+	}
+
+	// A single error keeps its message
+	err := loadConcurrently([]string{"a", "b"}, func(i int) error {
+		if i == 1 {
+			return errors.New("an error")
+		}
+		return nil
+	})
+	if assert.NotNil(t, err) {
+		assert.Equals(t, "an error", err.Error())
+		assert.Equals(t, []string{"b"}, err.(*LoadError).Items)
+	}
+
+	// All the errors are reported in order
+	err = loadConcurrently([]string{"a", "b", "c"}, func(i int) error {
+		if i == 1 {
+			return nil
+		}
+		time.Sleep(time.Duration(3-i) * time.Millisecond)
+		return errors.Errorf("error %d", i)
+	})
+	if assert.NotNil(t, err) {
+		assert.Equals(t, "2 errors loading the authority: a: error 0; c: error 2", err.Error())
+		assert.Equals(t, []string{"a", "c"}, err.(*LoadError).Items)
+	}
+}
+
+func TestNew_loadErrors(t *testing.T) {
+	a := testAuthority(t)
+	c := *a.config
+	c.FederatedRoots = []string{"testdata/certs/root_ca.crt", "testdata/missing.crt", "testdata/missing2.crt"}
+	_, err := New(&c)
+	if assert.NotNil(t, err) {
+		loadErr, ok := err.(*LoadError)
+		assert.Fatal(t, ok)
+		assert.Equals(t, []string{"certificate testdata/missing.crt", "certificate testdata/missing2.crt"}, loadErr.Items)
+	}
+}
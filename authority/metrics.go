@@ -0,0 +1,37 @@
+package authority
+
+import (
+	"context"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/metrics"
+	"golang.org/x/crypto/ssh"
+)
+
+// recordAuthorization counts a token of the given provisioner accepted or
+// rejected by the provisioner for the method in the context.
+func recordAuthorization(ctx context.Context, p provisioner.Interface, err error) {
+	var method string
+	switch provisioner.MethodFromContext(ctx) {
+	case provisioner.SignSSHMethod:
+		method = "sshSign"
+	case provisioner.RevokeMethod:
+		method = "revoke"
+	default:
+		method = "sign"
+	}
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	metrics.Authorizations.Inc(p.GetName(), method, result)
+}
+
+// recordSSHCertificate counts a signed SSH certificate.
+func recordSSHCertificate(cert *ssh.Certificate) {
+	if cert.CertType == ssh.HostCert {
+		metrics.SSHCertificates.Inc("host")
+	} else {
+		metrics.SSHCertificates.Inc("user")
+	}
+}
@@ -0,0 +1,37 @@
+package authority
+
+import (
+	"context"
+	"testing"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/metrics"
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestAuthority_metrics(t *testing.T) {
+	a := testAuthority(t)
+	p, ok := findProvisionerByName(a.config.AuthorityConfig.Provisioners, "step-cli")
+	assert.Fatal(t, ok)
+
+	sshCtx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignSSHMethod)
+	ok0 := metrics.Authorizations.Value("step-cli", "sign", "ok")
+	err0 := metrics.Authorizations.Value("step-cli", "sshSign", "error")
+	recordAuthorization(context.Background(), p, nil)
+	recordAuthorization(sshCtx, p, errors.New("force"))
+	assert.Equals(t, ok0+1, metrics.Authorizations.Value("step-cli", "sign", "ok"))
+	assert.Equals(t, err0+1, metrics.Authorizations.Value("step-cli", "sshSign", "error"))
+
+	host0 := metrics.SSHCertificates.Value("host")
+	user0 := metrics.SSHCertificates.Value("user")
+	recordSSHCertificate(&ssh.Certificate{CertType: ssh.HostCert})
+	recordSSHCertificate(&ssh.Certificate{CertType: ssh.UserCert})
+	assert.Equals(t, host0+1, metrics.SSHCertificates.Value("host"))
+	assert.Equals(t, user0+1, metrics.SSHCertificates.Value("user"))
+
+	issued0 := metrics.X509Certificates.Value("step-cli", "issued")
+	a.incrementStats("step-cli", "issued")
+	assert.Equals(t, issued0+1, metrics.X509Certificates.Value("step-cli", "issued"))
+}
@@ -0,0 +1,128 @@
+package authority
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/RTradeLtd/ca-cli/crypto/randutil"
+	"github.com/RTradeLtd/ca-cli/crypto/x509util"
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/RTradeLtd/ca-cli/token"
+	"github.com/RTradeLtd/ca-cli/token/provision"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultMintTokenLifetime = 5 * time.Minute
+	maxMintTokenLifetime     = time.Hour
+)
+
+// MintOptions are the options used to mint a one-time token.
+type MintOptions struct {
+	Provisioner string
+	Subject     string
+	SANs        []string
+	Lifetime    time.Duration
+}
+
+// loadMintKeys decrypts the keys of the provisioners that can be used to mint
+// one-time tokens.
+func loadMintKeys(c *AuthConfig) (map[string]*jose.JSONWebKey, error) {
+	keys := make(map[string]*jose.JSONWebKey, len(c.Mint.Provisioners))
+	for _, mp := range c.Mint.Provisioners {
+		p, ok := findProvisionerByName(c.Provisioners, mp.Name)
+		if !ok {
+			return nil, errors.Errorf("provisioner %s not found", mp.Name)
+		}
+		_, encryptedKey, ok := p.GetEncryptedKey()
+		if !ok {
+			return nil, errors.Errorf("provisioner %s does not have an encrypted key", mp.Name)
+		}
+		jwk, err := decryptJWK(encryptedKey, []byte(mp.Password))
+		if err != nil {
+			return nil, errors.Wrapf(err, "error decrypting the key of provisioner %s", mp.Name)
+		}
+		keys[mp.Name] = jwk
+	}
+	return keys, nil
+}
+
+func decryptJWK(encryptedKey string, password []byte) (*jose.JSONWebKey, error) {
+	enc, err := jose.ParseEncrypted(encryptedKey)
+	if err != nil {
+		return nil, err
+	}
+	data, err := enc.Decrypt(password)
+	if err != nil {
+		return nil, err
+	}
+	jwk := new(jose.JSONWebKey)
+	if err := json.Unmarshal(data, jwk); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling provisioning key")
+	}
+	return jwk, nil
+}
+
+// MintToken generates a one-time token for a sign request using the key of
+// the given provisioner. Only the provisioners in the mint configuration that
+// are not admin provisioners can be used.
+func (a *Authority) MintToken(opts MintOptions) (string, error) {
+	var errContext = apiCtx{"provisioner": opts.Provisioner, "subject": opts.Subject}
+	a.provisionersMutex.RLock()
+	mintKeys := a.mintKeys
+	a.provisionersMutex.RUnlock()
+	if mintKeys == nil {
+		return "", &apiError{errors.New("mintToken: token minting is not enabled"),
+			http.StatusNotImplemented, errContext}
+	}
+	if opts.Subject == "" {
+		return "", &apiError{errors.New("mintToken: subject cannot be empty"),
+			http.StatusBadRequest, errContext}
+	}
+	jwk, ok := mintKeys[opts.Provisioner]
+	if !ok || (a.isAdminEnabled() && a.config.AuthorityConfig.Admin.hasProvisioner(opts.Provisioner)) {
+		return "", &apiError{errors.Errorf("mintToken: provisioner %s cannot be used to mint tokens", opts.Provisioner),
+			http.StatusForbidden, errContext}
+	}
+
+	lifetime := opts.Lifetime
+	switch {
+	case lifetime == 0:
+		lifetime = defaultMintTokenLifetime
+	case lifetime < 0 || lifetime > maxMintTokenLifetime:
+		return "", &apiError{errors.Errorf("mintToken: token lifetime must be greater than 0 and less than or equal to %s", maxMintTokenLifetime),
+			http.StatusBadRequest, errContext}
+	}
+	sans := opts.SANs
+	if len(sans) == 0 {
+		sans = []string{opts.Subject}
+	}
+
+	// A random jwt id will be used to identify duplicated tokens
+	jwtID, err := randutil.Hex(64) // 256 bits
+	if err != nil {
+		return "", &apiError{errors.Wrap(err, "mintToken"), http.StatusInternalServerError, errContext}
+	}
+
+	notBefore := time.Now()
+	tokOptions := []token.Options{
+		token.WithJWTID(jwtID),
+		token.WithKid(jwk.KeyID),
+		token.WithIssuer(opts.Provisioner),
+		token.WithAudience(fmt.Sprintf("https://%s/1.0/sign", a.config.DNSNames[0])),
+		token.WithValidity(notBefore, notBefore.Add(lifetime)),
+		token.WithSANS(sans),
+		token.WithSHA(x509util.Fingerprint(a.GetRootCertificate())),
+	}
+	tok, err := provision.New(opts.Subject, tokOptions...)
+	if err != nil {
+		return "", &apiError{errors.Wrap(err, "mintToken"), http.StatusInternalServerError, errContext}
+	}
+	ott, err := tok.SignedString(jwk.Algorithm, jwk.Key)
+	if err != nil {
+		return "", &apiError{errors.Wrap(err, "mintToken"), http.StatusInternalServerError, errContext}
+	}
+	return ott, nil
+}
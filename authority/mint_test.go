@@ -0,0 +1,156 @@
+package authority
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+func testMintConfig(t *testing.T, password string) *Config {
+	maxjwk, err := jose.ParseKey("testdata/secrets/max_pub.jwk")
+	assert.FatalError(t, err)
+	clijwk, err := jose.ParseKey("testdata/secrets/step_cli_key_pub.jwk")
+	assert.FatalError(t, err)
+	encryptedKey, err := ioutil.ReadFile("testdata/secrets/max_priv.jwk")
+	assert.FatalError(t, err)
+	return &Config{
+		Address:          "127.0.0.1:443",
+		Root:             []string{"testdata/certs/root_ca.crt"},
+		IntermediateCert: "testdata/certs/intermediate_ca.crt",
+		IntermediateKey:  "testdata/secrets/intermediate_ca_key",
+		DNSNames:         []string{"test.ca.smallstep.com"},
+		Password:         "pass",
+		AuthorityConfig: &AuthConfig{
+			Provisioners: provisioner.List{
+				&provisioner.JWK{Name: "Max", Type: "JWK", Key: maxjwk, EncryptedKey: string(encryptedKey)},
+				&provisioner.JWK{Name: "step-cli", Type: "JWK", Key: clijwk},
+			},
+			Admin: &AdminConfig{Provisioners: []string{"step-cli"}},
+			Mint: &MintConfig{
+				Provisioners: []*MintProvisioner{{Name: "Max", Password: password}},
+			},
+		},
+	}
+}
+
+func TestNew_mint(t *testing.T) {
+	_, err := New(testMintConfig(t, "foo"))
+	if assert.NotNil(t, err) {
+		assert.HasPrefix(t, err.Error(), "error decrypting the key of provisioner Max")
+	}
+	a, err := New(testMintConfig(t, "pass"))
+	assert.FatalError(t, err)
+	assert.Len(t, 1, a.mintKeys)
+}
+
+func TestAuthority_MintToken(t *testing.T) {
+	a, err := New(testMintConfig(t, "pass"))
+	assert.FatalError(t, err)
+
+	type test struct {
+		auth *Authority
+		opts MintOptions
+		sans []string
+		err  error
+		code int
+	}
+	tests := map[string]func(t *testing.T) *test{
+		"fail/not-enabled": func(t *testing.T) *test {
+			return &test{
+				auth: testAuthority(t),
+				opts: MintOptions{Provisioner: "Max", Subject: "test.smallstep.com"},
+				err:  errors.New("mintToken: token minting is not enabled"),
+				code: http.StatusNotImplemented,
+			}
+		},
+		"fail/empty-subject": func(t *testing.T) *test {
+			return &test{
+				auth: a,
+				opts: MintOptions{Provisioner: "Max"},
+				err:  errors.New("mintToken: subject cannot be empty"),
+				code: http.StatusBadRequest,
+			}
+		},
+		"fail/provisioner": func(t *testing.T) *test {
+			return &test{
+				auth: a,
+				opts: MintOptions{Provisioner: "step-cli", Subject: "test.smallstep.com"},
+				err:  errors.New("mintToken: provisioner step-cli cannot be used to mint tokens"),
+				code: http.StatusForbidden,
+			}
+		},
+		"fail/admin-provisioner": func(t *testing.T) *test {
+			// Added to the admin provisioners after the validation.
+			b, err := New(testMintConfig(t, "pass"))
+			assert.FatalError(t, err)
+			b.config.AuthorityConfig.Admin.Provisioners = []string{"Max"}
+			return &test{
+				auth: b,
+				opts: MintOptions{Provisioner: "Max", Subject: "test.smallstep.com"},
+				err:  errors.New("mintToken: provisioner Max cannot be used to mint tokens"),
+				code: http.StatusForbidden,
+			}
+		},
+		"fail/lifetime": func(t *testing.T) *test {
+			return &test{
+				auth: a,
+				opts: MintOptions{Provisioner: "Max", Subject: "test.smallstep.com", Lifetime: 2 * time.Hour},
+				err:  errors.New("mintToken: token lifetime must be greater than 0 and less than or equal to 1h0m0s"),
+				code: http.StatusBadRequest,
+			}
+		},
+		"ok": func(t *testing.T) *test {
+			return &test{
+				auth: a,
+				opts: MintOptions{Provisioner: "Max", Subject: "test.smallstep.com"},
+				sans: []string{"test.smallstep.com"},
+			}
+		},
+		"ok/sans": func(t *testing.T) *test {
+			return &test{
+				auth: a,
+				opts: MintOptions{Provisioner: "Max", Subject: "test", SANs: []string{"foo.smallstep.com", "127.0.0.1"}, Lifetime: time.Minute},
+				sans: []string{"foo.smallstep.com", "127.0.0.1"},
+			}
+		},
+	}
+	for name, genTestCase := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc := genTestCase(t)
+			ott, err := tc.auth.MintToken(tc.opts)
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					switch v := err.(type) {
+					case *apiError:
+						assert.HasPrefix(t, v.err.Error(), tc.err.Error())
+						assert.Equals(t, v.code, tc.code)
+					default:
+						t.Errorf("unexpected error type: %T", v)
+					}
+				}
+				return
+			}
+			if assert.Nil(t, tc.err) {
+				tok, err := jose.ParseSigned(ott)
+				assert.FatalError(t, err)
+				var claims Claims
+				assert.FatalError(t, tok.UnsafeClaimsWithoutVerification(&claims))
+				assert.Equals(t, "Max", claims.Issuer)
+				assert.Equals(t, tc.opts.Subject, claims.Subject)
+				assert.Equals(t, tc.sans, claims.SANs)
+
+				// The token must be accepted by the authority.
+				ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+				_, err = tc.auth.Authorize(ctx, ott)
+				assert.FatalError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package authority
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"net/http"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultNonceLifetime is the time a nonce can be used if
+	// authority.nonce.lifetime is not set.
+	defaultNonceLifetime = 5 * time.Minute
+	// minNonceSecretLength is the minimum length of authority.nonce.secret.
+	minNonceSecretLength = 32
+	// nonceRandomSize is the number of random bytes of a nonce.
+	nonceRandomSize = 16
+	// nonceTokenIDPrefix is the prefix of the ids used to store the used
+	// nonces with the used tokens.
+	nonceTokenIDPrefix = "nonce:"
+)
+
+// NonceConfig contains the provisioners whose tokens must contain a nonce
+// issued by the CA in the nonce claim. A nonce can only be used once and
+// before its Lifetime, 5m by default, expires. The nonces are authenticated
+// with Secret, it must be the same in all the instances of the CA sharing a
+// database, otherwise a random secret is generated on startup.
+type NonceConfig struct {
+	Provisioners []string              `json:"provisioners"`
+	Lifetime     *provisioner.Duration `json:"lifetime,omitempty"`
+	Secret       string                `json:"secret,omitempty"`
+}
+
+// Validate validates the nonce configuration and sets the default values.
+func (c *NonceConfig) Validate(provisioners provisioner.List) error {
+	if c == nil {
+		return nil
+	}
+	if len(c.Provisioners) == 0 {
+		return errors.New("authority.nonce.provisioners cannot be empty")
+	}
+	for _, name := range c.Provisioners {
+		if _, ok := findProvisionerByName(provisioners, name); !ok {
+			return errors.Errorf("authority.nonce.provisioners: provisioner %s not found", name)
+		}
+	}
+	if c.Lifetime == nil {
+		c.Lifetime = &provisioner.Duration{Duration: defaultNonceLifetime}
+	} else if c.Lifetime.Duration <= 0 {
+		return errors.New("authority.nonce.lifetime must be greater than 0")
+	}
+	if c.Secret != "" && len(c.Secret) < minNonceSecretLength {
+		return errors.Errorf("authority.nonce.secret must have at least %d characters", minNonceSecretLength)
+	}
+	return nil
+}
+
+// loadNonceSecret returns the key used to authenticate the nonces.
+func loadNonceSecret(c *NonceConfig) ([]byte, error) {
+	if c.Secret != "" {
+		return []byte(c.Secret), nil
+	}
+	b := make([]byte, sha256.Size)
+	if _, err := rand.Read(b); err != nil {
+		return nil, errors.Wrap(err, "error generating nonce secret")
+	}
+	return b, nil
+}
+
+// isNonceProvisioner returns true if the tokens of the given provisioner must
+// contain a nonce.
+func (a *Authority) isNonceProvisioner(p provisioner.Interface) bool {
+	if a.config.AuthorityConfig == nil || a.config.AuthorityConfig.Nonce == nil {
+		return false
+	}
+	for _, name := range a.config.AuthorityConfig.Nonce.Provisioners {
+		if p.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// NewNonce returns a new nonce and the time it expires. The nonce is the
+// expiration time, random bytes and the HMAC-SHA256 of both, so it can be
+// validated by any instance with the same secret without storing it.
+func (a *Authority) NewNonce() (string, time.Time, error) {
+	if a.nonceSecret == nil {
+		return "", time.Time{}, &apiError{errors.New("newNonce: nonces are not enabled"),
+			http.StatusNotImplemented, apiCtx{}}
+	}
+	expiresAt := time.Now().Add(a.config.AuthorityConfig.Nonce.Lifetime.Duration).Truncate(time.Second)
+	b := make([]byte, 8+nonceRandomSize, 8+nonceRandomSize+sha256.Size)
+	binary.BigEndian.PutUint64(b, uint64(expiresAt.Unix()))
+	if _, err := rand.Read(b[8:]); err != nil {
+		return "", time.Time{}, &apiError{errors.Wrap(err, "newNonce"), http.StatusInternalServerError, apiCtx{}}
+	}
+	mac := hmac.New(sha256.New, a.nonceSecret)
+	mac.Write(b)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(b)), expiresAt, nil
+}
+
+// checkNonce validates a nonce issued by NewNonce without using it. The
+// errors of invalid nonces are *provisioner.Error.
+func (a *Authority) checkNonce(nonce string) error {
+	if nonce == "" {
+		return provisioner.NewError(provisioner.ErrCodeTokenBadNonce, errors.New("token does not contain a nonce"))
+	}
+	b, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil || len(b) != 8+nonceRandomSize+sha256.Size {
+		return provisioner.NewError(provisioner.ErrCodeTokenBadNonce, errors.New("nonce is not valid"))
+	}
+	mac := hmac.New(sha256.New, a.nonceSecret)
+	mac.Write(b[:8+nonceRandomSize])
+	if !hmac.Equal(mac.Sum(nil), b[8+nonceRandomSize:]) {
+		return provisioner.NewError(provisioner.ErrCodeTokenBadNonce, errors.New("nonce is not valid"))
+	}
+	if time.Now().Unix() > int64(binary.BigEndian.Uint64(b)) {
+		return provisioner.NewError(provisioner.ErrCodeTokenBadNonce, errors.New("nonce has expired"))
+	}
+	return nil
+}
+
+// useNonce validates a nonce issued by NewNonce and marks it as used. The
+// errors of invalid nonces are *provisioner.Error.
+func (a *Authority) useNonce(nonce, ott string) error {
+	if err := a.checkNonce(nonce); err != nil {
+		return err
+	}
+	ok, err := a.db.UseToken(nonceTokenIDPrefix+nonce, ott)
+	if err != nil {
+		return errors.Wrap(err, "failed when checking if nonce already used")
+	}
+	if !ok {
+		return provisioner.NewError(provisioner.ErrCodeTokenBadNonce, errors.New("nonce already used"))
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package authority
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/crypto/randutil"
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+func generateNonceToken(t *testing.T, nonce string, jwk *jose.JSONWebKey) string {
+	id, err := randutil.ASCII(64)
+	assert.FatalError(t, err)
+	return generateNonceTokenWithID(t, id, nonce, jwk)
+}
+
+func generateNonceTokenWithID(t *testing.T, id, nonce string, jwk *jose.JSONWebKey) string {
+	sig, err := jose.NewSigner(
+		jose.SigningKey{Algorithm: jose.ES256, Key: jwk.Key},
+		new(jose.SignerOptions).WithType("JWT").WithHeader("kid", jwk.KeyID),
+	)
+	assert.FatalError(t, err)
+	now := time.Now()
+	tok, err := jose.Signed(sig).Claims(jose.Claims{
+		ID:        id,
+		Subject:   "test.smallstep.com",
+		Issuer:    "step-cli",
+		IssuedAt:  jose.NewNumericDate(now),
+		NotBefore: jose.NewNumericDate(now),
+		Expiry:    jose.NewNumericDate(now.Add(5 * time.Minute)),
+		Audience:  []string{"https://test.ca.smallstep.com/sign"},
+	}).Claims(map[string]interface{}{
+		"sans":  []string{"test.smallstep.com"},
+		"nonce": nonce,
+	}).CompactSerialize()
+	assert.FatalError(t, err)
+	return tok
+}
+
+func TestNonceConfig_Validate(t *testing.T) {
+	provisioners := provisioner.List{
+		&provisioner.JWK{Type: "JWK", Name: "step-cli"},
+	}
+	tests := []struct {
+		name   string
+		config *NonceConfig
+		err    error
+	}{
+		{"ok", &NonceConfig{Provisioners: []string{"step-cli"}}, nil},
+		{"ok-secret", &NonceConfig{Provisioners: []string{"step-cli"}, Secret: strings.Repeat("x", 32)}, nil},
+		{"ok-nil", nil, nil},
+		{"fail-empty-provisioners", &NonceConfig{}, errors.New("authority.nonce.provisioners cannot be empty")},
+		{"fail-provisioner", &NonceConfig{Provisioners: []string{"foo"}}, errors.New("authority.nonce.provisioners: provisioner foo not found")},
+		{"fail-lifetime", &NonceConfig{Provisioners: []string{"step-cli"}, Lifetime: &provisioner.Duration{Duration: -time.Minute}}, errors.New("authority.nonce.lifetime must be greater than 0")},
+		{"fail-secret", &NonceConfig{Provisioners: []string{"step-cli"}, Secret: "short"}, errors.New("authority.nonce.secret must have at least 32 characters")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate(provisioners)
+			if tt.err != nil {
+				if assert.NotNil(t, err) {
+					assert.Equals(t, tt.err.Error(), err.Error())
+				}
+			} else {
+				assert.Nil(t, err)
+				if tt.config != nil {
+					assert.Equals(t, defaultNonceLifetime, tt.config.Lifetime.Duration)
+				}
+			}
+		})
+	}
+}
+
+func TestAuthority_NewNonce(t *testing.T) {
+	jwk, err := jose.ParseKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+	assertCode := func(t *testing.T, err error, code int) {
+		if assert.NotNil(t, err) {
+			if v, ok := err.(*apiError); assert.True(t, ok) {
+				assert.Equals(t, code, v.code)
+			}
+		}
+	}
+
+	// Nonces are not enabled by default, and the tokens do not need them.
+	a := testAuthority(t)
+	_, _, err = a.NewNonce()
+	assertCode(t, err, http.StatusNotImplemented)
+	_, err = a.Authorize(ctx, generateNonceToken(t, "", jwk))
+	assert.FatalError(t, err)
+
+	a.config.AuthorityConfig.Nonce = &NonceConfig{Provisioners: []string{"step-cli"}}
+	assert.FatalError(t, a.config.AuthorityConfig.Nonce.Validate(a.config.AuthorityConfig.Provisioners))
+	a.nonceSecret, err = loadNonceSecret(a.config.AuthorityConfig.Nonce)
+	assert.FatalError(t, err)
+
+	nonce, expiresAt, err := a.NewNonce()
+	assert.FatalError(t, err)
+	assert.True(t, expiresAt.After(time.Now()))
+	_, err = a.Authorize(ctx, generateNonceToken(t, nonce, jwk))
+	assert.FatalError(t, err)
+
+	// The nonces can only be used once.
+	_, err = a.Authorize(ctx, generateNonceToken(t, nonce, jwk))
+	assertCode(t, err, http.StatusUnauthorized)
+
+	// The tokens must contain a nonce issued by the CA.
+	_, err = a.Authorize(ctx, generateNonceToken(t, "", jwk))
+	assertCode(t, err, http.StatusUnauthorized)
+	_, err = a.Authorize(ctx, generateNonceToken(t, "foo", jwk))
+	assertCode(t, err, http.StatusUnauthorized)
+	other := &Authority{config: a.config, nonceSecret: []byte(strings.Repeat("x", 32))}
+	otherNonce, _, err := other.NewNonce()
+	assert.FatalError(t, err)
+	_, err = a.Authorize(ctx, generateNonceToken(t, otherNonce, jwk))
+	assertCode(t, err, http.StatusUnauthorized)
+
+	// A token rejected for its nonce does not use its id, it can be sent
+	// again with a valid nonce.
+	nonce, _, err = a.NewNonce()
+	assert.FatalError(t, err)
+	_, err = a.Authorize(ctx, generateNonceTokenWithID(t, "retried-id", "foo", jwk))
+	assertCode(t, err, http.StatusUnauthorized)
+	_, err = a.Authorize(ctx, generateNonceTokenWithID(t, "retried-id", "", jwk))
+	assertCode(t, err, http.StatusUnauthorized)
+	_, err = a.Authorize(ctx, generateNonceTokenWithID(t, "retried-id", nonce, jwk))
+	assert.FatalError(t, err)
+	_, err = a.Authorize(ctx, generateNonceTokenWithID(t, "retried-id", nonce, jwk))
+	assertCode(t, err, http.StatusUnauthorized)
+
+	// Expired nonces are rejected.
+	a.config.AuthorityConfig.Nonce.Lifetime.Duration = -time.Minute
+	nonce, _, err = a.NewNonce()
+	assert.FatalError(t, err)
+	err = a.useNonce(nonce, "ott")
+	if assert.NotNil(t, err) {
+		assert.Equals(t, "nonce has expired", err.Error())
+	}
+
+	// Other provisioners do not need them.
+	a.config.AuthorityConfig.Nonce.Provisioners = []string{"Max"}
+	_, err = a.Authorize(ctx, generateNonceToken(t, "", jwk))
+	assert.FatalError(t, err)
+}
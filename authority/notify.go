@@ -0,0 +1,33 @@
+package authority
+
+import (
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/notify"
+)
+
+// GetNotifier returns the notifier of the expiring certificates, or nil if
+// the notifications are not configured.
+func (a *Authority) GetNotifier() *notify.Notifier {
+	return a.notifier
+}
+
+// expiringCertificates returns the active certificates that expire within the
+// given duration, it is the source of the notifier.
+func (a *Authority) expiringCertificates(within time.Duration) ([]*notify.Certificate, error) {
+	list, err := a.GetExpiringCertificates(CertificateFilter{}, within)
+	if err != nil {
+		return nil, err
+	}
+	certs := make([]*notify.Certificate, len(list))
+	for i, ci := range list {
+		certs[i] = &notify.Certificate{
+			Serial:      ci.Certificate.SerialNumber.String(),
+			Subject:     ci.Certificate.Subject.CommonName,
+			SANs:        certificateSANs(ci.Certificate),
+			NotAfter:    ci.Certificate.NotAfter,
+			Provisioner: ci.Provisioner,
+		}
+	}
+	return certs, nil
+}
@@ -0,0 +1,55 @@
+package authority
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/RTradeLtd/ca-certificates/notify"
+	"github.com/smallstep/assert"
+)
+
+func TestAuthority_expiringCertificates(t *testing.T) {
+	a := testAuthority(t)
+	assert.Nil(t, a.GetNotifier())
+
+	now := time.Now()
+	day := 24 * time.Hour
+	certs := []*x509.Certificate{
+		generateIssuedCertificate(t, a, "a.smallstep.com", "step-cli", now.Add(-day), now.Add(10*day)),
+		generateIssuedCertificate(t, a, "b.smallstep.com", "Max", now.Add(-day), now.Add(2*day)),
+		generateIssuedCertificate(t, a, "c.smallstep.com", "step-cli", now.Add(-day), now.Add(40*day)),
+	}
+	a.db = &MockAuthDB{
+		getCertificates: func() ([]*x509.Certificate, error) {
+			return append([]*x509.Certificate{}, certs...), nil
+		},
+		isRevoked: func(sn string) (bool, error) {
+			return false, nil
+		},
+	}
+
+	list, err := a.expiringCertificates(30 * day)
+	assert.FatalError(t, err)
+	assert.Equals(t, []*notify.Certificate{
+		{
+			Serial:      certs[1].SerialNumber.String(),
+			Subject:     "b.smallstep.com",
+			SANs:        []string{"b.smallstep.com"},
+			NotAfter:    certs[1].NotAfter,
+			Provisioner: "Max",
+		},
+		{
+			Serial:      certs[0].SerialNumber.String(),
+			Subject:     "a.smallstep.com",
+			SANs:        []string{"a.smallstep.com"},
+			NotAfter:    certs[0].NotAfter,
+			Provisioner: "step-cli",
+		},
+	}, list)
+
+	a.db = &MockAuthDB{err: db.ErrNotImplemented}
+	_, err = a.expiringCertificates(day)
+	assert.NotNil(t, err)
+}
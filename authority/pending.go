@@ -0,0 +1,319 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/crypto/randutil"
+	"github.com/pkg/errors"
+)
+
+// PendingStatus is the status of a pending certificate request.
+type PendingStatus string
+
+const (
+	// StatusPending is the status of a request waiting for an admin decision.
+	StatusPending PendingStatus = "pending"
+	// StatusApproved is the status of a request approved by an admin. The
+	// certificate has already been issued.
+	StatusApproved PendingStatus = "approved"
+	// StatusDenied is the status of a request denied by an admin.
+	StatusDenied PendingStatus = "denied"
+)
+
+const (
+	// defaultApprovalTTL is the default lifetime of the pending requests.
+	defaultApprovalTTL = 24 * time.Hour
+	// defaultApprovalMaxPending is the default number of requests of each
+	// provisioner that can wait for a decision.
+	defaultApprovalMaxPending = 100
+)
+
+// PendingRequest is a certificate request that requires the approval of an
+// admin before the certificate is issued.
+type PendingRequest struct {
+	ID          string
+	Status      PendingStatus
+	Provisioner string
+	CSR         *x509.CertificateRequest
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	ExpiresAt   time.Time
+	Reviewer    string
+	Reason      string
+	CertChain   []*x509.Certificate
+	opts        provisioner.Options
+	signOpts    []provisioner.SignOption
+	approving   bool
+}
+
+// approvalRequiredOption is a SignOption added to the sign requests of the
+// provisioners that require approval. Sign will not issue a certificate if
+// this option is present.
+type approvalRequiredOption struct {
+	provisioner string
+}
+
+// pendingStore is the in memory storage of pending requests. Sign options
+// cannot be serialized, so pending requests are not stored in the database
+// and do not survive a restart or a reload of the CA. Requests are removed
+// once they expire, a pending request expires if it is not reviewed in time,
+// and a reviewed one once its client had time to get the result.
+type pendingStore struct {
+	sync.RWMutex
+	requests map[string]*PendingRequest
+}
+
+func newPendingStore() *pendingStore {
+	return &pendingStore{
+		requests: make(map[string]*PendingRequest),
+	}
+}
+
+// prune removes the expired requests. The requests being approved are kept
+// until the certificate is signed. It must be called with the lock held.
+func (s *pendingStore) prune(now time.Time) {
+	for id, pr := range s.requests {
+		if !pr.approving && !now.Before(pr.ExpiresAt) {
+			delete(s.requests, id)
+		}
+	}
+}
+
+// countPending returns the number of requests of the given provisioner
+// waiting for a decision. It must be called with the lock held.
+func (s *pendingStore) countPending(provName string) int {
+	var n int
+	for _, pr := range s.requests {
+		if pr.Provisioner == provName && pr.Status == StatusPending {
+			n++
+		}
+	}
+	return n
+}
+
+// get returns the request with the given id if it has not expired. It must be
+// called with the lock held.
+func (s *pendingStore) get(id string, now time.Time) (*PendingRequest, bool) {
+	pr, ok := s.requests[id]
+	if !ok || (!pr.approving && !now.Before(pr.ExpiresAt)) {
+		return nil, false
+	}
+	return pr, true
+}
+
+// isApprovalProvisioner returns true if the sign requests of the given
+// provisioner must be approved by an admin.
+func (a *Authority) isApprovalProvisioner(p provisioner.Interface) bool {
+	if a.config.AuthorityConfig == nil || a.config.AuthorityConfig.Approval == nil {
+		return false
+	}
+	for _, name := range a.config.AuthorityConfig.Approval.Provisioners {
+		if p.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// IsApprovalRequired returns true if the given sign options require the
+// approval of an admin before the certificate can be issued.
+func (a *Authority) IsApprovalRequired(signOpts []provisioner.SignOption) bool {
+	for _, op := range signOpts {
+		if _, ok := op.(approvalRequiredOption); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// CreatePendingRequest validates the certificate request and stores it until
+// an admin approves or denies it.
+func (a *Authority) CreatePendingRequest(csr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) (*PendingRequest, error) {
+	var errContext = apiCtx{"csr": csr, "signOptions": opts}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, &apiError{errors.Wrap(err, "createPendingRequest: invalid certificate request"),
+			http.StatusBadRequest, errContext}
+	}
+
+	// Remove the approval option and validate the request before storing it.
+	var provName string
+	filtered := make([]provisioner.SignOption, 0, len(signOpts))
+	for _, op := range signOpts {
+		switch k := op.(type) {
+		case approvalRequiredOption:
+			provName = k.provisioner
+			continue
+		case provisioner.CertificateRequestValidator:
+			if err := k.Valid(csr); err != nil {
+				return nil, &apiError{errors.Wrap(err, "createPendingRequest"), http.StatusUnauthorized, errContext}
+			}
+		}
+		filtered = append(filtered, op)
+	}
+
+	id, err := randutil.Alphanumeric(32)
+	if err != nil {
+		return nil, &apiError{errors.Wrap(err, "createPendingRequest: error generating id"),
+			http.StatusInternalServerError, errContext}
+	}
+
+	approval := a.config.AuthorityConfig.Approval
+	now := time.Now().UTC()
+	pr := &PendingRequest{
+		ID:          id,
+		Status:      StatusPending,
+		Provisioner: provName,
+		CSR:         csr,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		ExpiresAt:   now.Add(approval.ttl()),
+		opts:        opts,
+		signOpts:    filtered,
+	}
+
+	a.pending.Lock()
+	defer a.pending.Unlock()
+	a.pending.prune(now)
+	if max := approval.maxPending(); a.pending.countPending(provName) >= max {
+		return nil, &apiError{errors.Errorf("createPendingRequest: provisioner %s has %d pending requests", provName, max),
+			http.StatusTooManyRequests, errContext}
+	}
+	a.pending.requests[id] = pr
+
+	return pr.clone(), nil
+}
+
+// GetPendingRequest returns the pending request with the given id.
+func (a *Authority) GetPendingRequest(id string) (*PendingRequest, error) {
+	a.pending.RLock()
+	defer a.pending.RUnlock()
+	pr, ok := a.pending.get(id, time.Now())
+	if !ok {
+		return nil, &apiError{errors.Errorf("pending request %s not found", id),
+			http.StatusNotFound, apiCtx{"id": id}}
+	}
+	return pr.clone(), nil
+}
+
+// GetPendingRequests returns all the pending requests sorted by creation
+// time. If status is not empty only the requests with the given status are
+// returned.
+func (a *Authority) GetPendingRequests(status PendingStatus) ([]*PendingRequest, error) {
+	now := time.Now()
+	a.pending.RLock()
+	list := make([]*PendingRequest, 0, len(a.pending.requests))
+	for id := range a.pending.requests {
+		pr, ok := a.pending.get(id, now)
+		if !ok {
+			continue
+		}
+		if status == "" || pr.Status == status {
+			list = append(list, pr.clone())
+		}
+	}
+	a.pending.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+	return list, nil
+}
+
+// ApprovePendingRequest issues the certificate of the pending request with the
+// given id. The reviewer is the admin approving the request. The request is
+// marked as being approved while the certificate is signed, so other reviews
+// of the same request fail without waiting for the signer.
+func (a *Authority) ApprovePendingRequest(ctx context.Context, id, reviewer string) (*PendingRequest, error) {
+	var errContext = apiCtx{"id": id, "reviewer": reviewer}
+	a.pending.Lock()
+	pr, ok := a.pending.get(id, time.Now())
+	if !ok {
+		a.pending.Unlock()
+		return nil, &apiError{errors.Errorf("approvePendingRequest: pending request %s not found", id),
+			http.StatusNotFound, errContext}
+	}
+	if err := pr.checkReviewable("approvePendingRequest"); err != nil {
+		a.pending.Unlock()
+		return nil, &apiError{err, http.StatusConflict, errContext}
+	}
+	pr.approving = true
+	csr, opts, signOpts := pr.CSR, pr.opts, pr.signOpts
+	a.pending.Unlock()
+
+	certChain, err := a.Sign(ctx, csr, opts, signOpts...)
+
+	a.pending.Lock()
+	defer a.pending.Unlock()
+	pr.approving = false
+	if err != nil {
+		return nil, &apiError{errors.Wrap(err, "approvePendingRequest"), http.StatusForbidden, errContext}
+	}
+
+	now := time.Now().UTC()
+	pr.Status = StatusApproved
+	pr.Reviewer = reviewer
+	pr.UpdatedAt = now
+	pr.ExpiresAt = now.Add(a.config.AuthorityConfig.Approval.ttl())
+	pr.CertChain = certChain
+	return pr.clone(), nil
+}
+
+// DenyPendingRequest denies the pending request with the given id. The
+// reviewer is the admin denying the request.
+func (a *Authority) DenyPendingRequest(id, reviewer, reason string) (*PendingRequest, error) {
+	var errContext = apiCtx{"id": id, "reviewer": reviewer}
+	a.pending.Lock()
+	defer a.pending.Unlock()
+
+	pr, ok := a.pending.get(id, time.Now())
+	if !ok {
+		return nil, &apiError{errors.Errorf("denyPendingRequest: pending request %s not found", id),
+			http.StatusNotFound, errContext}
+	}
+	if err := pr.checkReviewable("denyPendingRequest"); err != nil {
+		return nil, &apiError{err, http.StatusConflict, errContext}
+	}
+
+	now := time.Now().UTC()
+	pr.Status = StatusDenied
+	pr.Reviewer = reviewer
+	pr.Reason = reason
+	pr.UpdatedAt = now
+	pr.ExpiresAt = now.Add(a.config.AuthorityConfig.Approval.ttl())
+	return pr.clone(), nil
+}
+
+// checkReviewable returns an error if the request has already been reviewed
+// or is being approved.
+func (pr *PendingRequest) checkReviewable(op string) error {
+	switch {
+	case pr.approving:
+		return errors.Errorf("%s: pending request %s is being approved", op, pr.ID)
+	case pr.Status != StatusPending:
+		return errors.Errorf("%s: pending request %s is already %s", op, pr.ID, pr.Status)
+	default:
+		return nil
+	}
+}
+
+// clone returns a copy of the pending request without the sign options.
+func (pr *PendingRequest) clone() *PendingRequest {
+	return &PendingRequest{
+		ID:          pr.ID,
+		Status:      pr.Status,
+		Provisioner: pr.Provisioner,
+		CSR:         pr.CSR,
+		CreatedAt:   pr.CreatedAt,
+		UpdatedAt:   pr.UpdatedAt,
+		ExpiresAt:   pr.ExpiresAt,
+		Reviewer:    pr.Reviewer,
+		Reason:      pr.Reason,
+		CertChain:   append([]*x509.Certificate(nil), pr.CertChain...),
+	}
+}
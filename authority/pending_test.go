@@ -0,0 +1,217 @@
+package authority
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/crypto/keys"
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/smallstep/assert"
+)
+
+func testApprovalAuthority(t *testing.T) *Authority {
+	a := testAdminAuthority(t)
+	a.config.AuthorityConfig.Approval = &ApprovalConfig{
+		Provisioners: []string{"step-cli"},
+	}
+	return a
+}
+
+func TestAuthority_PendingRequest(t *testing.T) {
+	_, priv, err := keys.GenerateDefaultKeyPair()
+	assert.FatalError(t, err)
+	jwk, err := jose.ParseKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+
+	a := testApprovalAuthority(t)
+	authorize := func(t *testing.T) []provisioner.SignOption {
+		token, err := generateToken("smallstep test", "step-cli", "https://test.ca.smallstep.com/sign",
+			[]string{"test.smallstep.com"}, time.Now(), jwk)
+		assert.FatalError(t, err)
+		ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+		signOpts, err := a.Authorize(ctx, token)
+		assert.FatalError(t, err)
+		return signOpts
+	}
+	assertCode := func(t *testing.T, err error, code int) {
+		if assert.NotNil(t, err) {
+			if v, ok := err.(*apiError); assert.True(t, ok) {
+				assert.Equals(t, code, v.code)
+			}
+		}
+	}
+
+	// Sign refuses to issue certificates that require approval.
+	signOpts := authorize(t)
+	assert.True(t, a.IsApprovalRequired(signOpts))
+	_, err = a.Sign(context.Background(), getCSR(t, priv), provisioner.Options{}, signOpts...)
+	assertCode(t, err, http.StatusForbidden)
+
+	// Approve a request.
+	pr, err := a.CreatePendingRequest(getCSR(t, priv), provisioner.Options{}, authorize(t)...)
+	assert.FatalError(t, err)
+	assert.Equals(t, StatusPending, pr.Status)
+	assert.Equals(t, "step-cli", pr.Provisioner)
+	assert.Equals(t, 32, len(pr.ID))
+
+	got, err := a.GetPendingRequest(pr.ID)
+	assert.FatalError(t, err)
+	assert.Equals(t, pr, got)
+
+	approved, err := a.ApprovePendingRequest(context.Background(), pr.ID, "admin")
+	assert.FatalError(t, err)
+	assert.Equals(t, StatusApproved, approved.Status)
+	assert.Equals(t, "admin", approved.Reviewer)
+	if assert.Len(t, 2, approved.CertChain) {
+		assert.Equals(t, "smallstep test", approved.CertChain[0].Subject.CommonName)
+	}
+
+	_, err = a.ApprovePendingRequest(context.Background(), pr.ID, "admin")
+	assertCode(t, err, http.StatusConflict)
+	_, err = a.DenyPendingRequest(pr.ID, "admin", "too late")
+	assertCode(t, err, http.StatusConflict)
+
+	// Deny a request.
+	pr, err = a.CreatePendingRequest(getCSR(t, priv), provisioner.Options{}, authorize(t)...)
+	assert.FatalError(t, err)
+	denied, err := a.DenyPendingRequest(pr.ID, "admin", "not allowed")
+	assert.FatalError(t, err)
+	assert.Equals(t, StatusDenied, denied.Status)
+	assert.Equals(t, "not allowed", denied.Reason)
+	assert.Len(t, 0, denied.CertChain)
+
+	_, err = a.ApprovePendingRequest(context.Background(), pr.ID, "admin")
+	assertCode(t, err, http.StatusConflict)
+
+	// List requests.
+	list, err := a.GetPendingRequests("")
+	assert.FatalError(t, err)
+	if assert.Len(t, 2, list) {
+		assert.Equals(t, StatusApproved, list[0].Status)
+		assert.Equals(t, StatusDenied, list[1].Status)
+	}
+	list, err = a.GetPendingRequests(StatusDenied)
+	assert.FatalError(t, err)
+	if assert.Len(t, 1, list) {
+		assert.Equals(t, pr.ID, list[0].ID)
+	}
+	list, err = a.GetPendingRequests(StatusPending)
+	assert.FatalError(t, err)
+	assert.Len(t, 0, list)
+
+	// Not found.
+	_, err = a.GetPendingRequest("foo")
+	assertCode(t, err, http.StatusNotFound)
+	_, err = a.ApprovePendingRequest(context.Background(), "foo", "admin")
+	assertCode(t, err, http.StatusNotFound)
+	_, err = a.DenyPendingRequest("foo", "admin", "")
+	assertCode(t, err, http.StatusNotFound)
+}
+
+func TestAuthority_PendingRequest_limits(t *testing.T) {
+	_, priv, err := keys.GenerateDefaultKeyPair()
+	assert.FatalError(t, err)
+	jwk, err := jose.ParseKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+
+	a := testApprovalAuthority(t)
+	a.config.AuthorityConfig.Approval.MaxPending = 2
+	create := func(t *testing.T) (*PendingRequest, error) {
+		token, err := generateToken("smallstep test", "step-cli", "https://test.ca.smallstep.com/sign",
+			[]string{"test.smallstep.com"}, time.Now(), jwk)
+		assert.FatalError(t, err)
+		ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+		signOpts, err := a.Authorize(ctx, token)
+		assert.FatalError(t, err)
+		return a.CreatePendingRequest(getCSR(t, priv), provisioner.Options{}, signOpts...)
+	}
+	assertCode := func(t *testing.T, err error, code int) {
+		if assert.NotNil(t, err) {
+			if v, ok := err.(*apiError); assert.True(t, ok) {
+				assert.Equals(t, code, v.code)
+			}
+		}
+	}
+
+	first, err := create(t)
+	assert.FatalError(t, err)
+	assert.Equals(t, first.CreatedAt.Add(defaultApprovalTTL), first.ExpiresAt)
+	second, err := create(t)
+	assert.FatalError(t, err)
+
+	// Only MaxPending requests of a provisioner can wait for a decision.
+	_, err = create(t)
+	assertCode(t, err, http.StatusTooManyRequests)
+	_, err = a.DenyPendingRequest(second.ID, "admin", "")
+	assert.FatalError(t, err)
+	third, err := create(t)
+	assert.FatalError(t, err)
+
+	// A request being approved cannot be reviewed again, but it can be read.
+	a.pending.Lock()
+	a.pending.requests[first.ID].approving = true
+	a.pending.Unlock()
+	_, err = a.ApprovePendingRequest(context.Background(), first.ID, "admin")
+	assertCode(t, err, http.StatusConflict)
+	_, err = a.DenyPendingRequest(first.ID, "admin", "")
+	assertCode(t, err, http.StatusConflict)
+	got, err := a.GetPendingRequest(first.ID)
+	assert.FatalError(t, err)
+	assert.Equals(t, StatusPending, got.Status)
+	a.pending.Lock()
+	a.pending.requests[first.ID].approving = false
+	a.pending.Unlock()
+
+	// Expired requests cannot be reviewed and are removed from the store.
+	a.pending.Lock()
+	a.pending.requests[first.ID].ExpiresAt = time.Now().Add(-time.Second)
+	a.pending.requests[second.ID].ExpiresAt = time.Now().Add(-time.Second)
+	a.pending.Unlock()
+	_, err = a.GetPendingRequest(first.ID)
+	assertCode(t, err, http.StatusNotFound)
+	_, err = a.ApprovePendingRequest(context.Background(), first.ID, "admin")
+	assertCode(t, err, http.StatusNotFound)
+	list, err := a.GetPendingRequests("")
+	assert.FatalError(t, err)
+	if assert.Len(t, 1, list) {
+		assert.Equals(t, third.ID, list[0].ID)
+	}
+	_, err = create(t)
+	assert.FatalError(t, err)
+	a.pending.RLock()
+	assert.Len(t, 2, a.pending.requests)
+	a.pending.RUnlock()
+}
+
+func TestAuthority_IsApprovalRequired(t *testing.T) {
+	jwk, err := jose.ParseKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+	maxjwk, err := jose.ParseKey("testdata/secrets/max_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name string
+		auth *Authority
+		iss  string
+		key  *jose.JSONWebKey
+		want bool
+	}{
+		{"disabled", testAuthority(t), "step-cli", jwk, false},
+		{"other-provisioner", testApprovalAuthority(t), "Max", maxjwk, false},
+		{"approval-provisioner", testApprovalAuthority(t), "step-cli", jwk, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := generateToken("smallstep test", tt.iss, "https://test.ca.smallstep.com/sign",
+				[]string{"test.smallstep.com"}, time.Now(), tt.key)
+			assert.FatalError(t, err)
+			ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+			signOpts, err := tt.auth.Authorize(ctx, token)
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.want, tt.auth.IsApprovalRequired(signOpts))
+		})
+	}
+}
@@ -3,6 +3,7 @@ package provisioner
 import (
 	"context"
 	"crypto/x509"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -74,7 +75,7 @@ func (p *ACME) AuthorizeSign(ctx context.Context, _ string) ([]SignOption, error
 		profileDefaultDuration(p.claimer.DefaultTLSCertDuration()),
 		// validators
 		defaultPublicKeyValidator{},
-		newValidityValidator(p.claimer.MinTLSCertDuration(), p.claimer.MaxTLSCertDuration()),
+		newValidityValidator(p.claimer.MinTLSCertDuration(), p.claimer.MaxTLSCertDuration(), p.claimer.ClockSkew()),
 	}, nil
 }
 
@@ -85,3 +86,21 @@ func (p *ACME) AuthorizeRenewal(cert *x509.Certificate) error {
 	}
 	return nil
 }
+
+// AuthorizeExpiredRenewal returns an error if the certificate expired before
+// the renewal grace period of the provisioner.
+func (p *ACME) AuthorizeExpiredRenewal(cert *x509.Certificate) error {
+	return p.claimer.authorizeExpiredRenewal(cert)
+}
+
+// RenewalWindow returns how long before their expiration the certificates of
+// the provisioner should be renewed.
+func (p *ACME) RenewalWindow() time.Duration {
+	return p.claimer.RenewalWindow()
+}
+
+// IsRenewalKeyPinned returns if the renewals of the certificates of the
+// provisioner must keep the key of the certificate.
+func (p *ACME) IsRenewalKeyPinned() bool {
+	return p.claimer.IsRenewalKeyPinned()
+}
@@ -0,0 +1,54 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+
+	"github.com/RTradeLtd/ca-cli/crypto/x509util"
+)
+
+// stepOIDAdmin is the object identifier of the extension that identifies a
+// certificate that can be used to authenticate admin requests.
+var stepOIDAdmin = append(asn1.ObjectIdentifier(nil), append(stepOIDRoot, 2)...)
+
+// AdminAuthorizer is the interface implemented by the provisioners that can be
+// designated to generate admin tokens.
+type AdminAuthorizer interface {
+	// AuthorizeAdmin validates the given admin token and returns the subject
+	// of the token.
+	AuthorizeAdmin(token string) (string, error)
+}
+
+// adminExtensionOption is a ProfileModifier that adds the admin extension to a
+// certificate.
+type adminExtensionOption struct{}
+
+// NewAdminExtensionOption returns a SignOption that marks the signed
+// certificate as an admin certificate.
+func NewAdminExtensionOption() SignOption {
+	return adminExtensionOption{}
+}
+
+func (o adminExtensionOption) Option(Options) x509util.WithOption {
+	return func(p x509util.Profile) error {
+		crt := p.Subject()
+		crt.ExtraExtensions = append(crt.ExtraExtensions, pkix.Extension{
+			Id:       stepOIDAdmin,
+			Critical: false,
+			Value:    asn1.NullBytes,
+		})
+		return nil
+	}
+}
+
+// IsAdminCertificate returns true if the given certificate contains the admin
+// extension.
+func IsAdminCertificate(crt *x509.Certificate) bool {
+	for _, e := range crt.Extensions {
+		if e.Id.Equal(stepOIDAdmin) {
+			return true
+		}
+	}
+	return false
+}
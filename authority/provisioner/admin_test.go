@@ -0,0 +1,36 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"testing"
+
+	"github.com/RTradeLtd/ca-cli/crypto/x509util"
+	"github.com/smallstep/assert"
+)
+
+func Test_adminExtensionOption_Option(t *testing.T) {
+	prof := &x509util.Leaf{}
+	prof.SetSubject(&x509.Certificate{})
+	o := NewAdminExtensionOption().(ProfileModifier)
+	assert.FatalError(t, o.Option(Options{})(prof))
+	assert.Equals(t, []pkix.Extension{{Id: stepOIDAdmin, Value: asn1.NullBytes}}, prof.Subject().ExtraExtensions)
+}
+
+func TestIsAdminCertificate(t *testing.T) {
+	tests := []struct {
+		name string
+		crt  *x509.Certificate
+		want bool
+	}{
+		{"ok", &x509.Certificate{Extensions: []pkix.Extension{{Id: stepOIDProvisioner}, {Id: stepOIDAdmin}}}, true},
+		{"fail-no-extensions", &x509.Certificate{}, false},
+		{"fail-provisioner-only", &x509.Certificate{Extensions: []pkix.Extension{{Id: stepOIDProvisioner}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equals(t, tt.want, IsAdminCertificate(tt.crt))
+		})
+	}
+}
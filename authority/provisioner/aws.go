@@ -302,7 +302,7 @@ func (p *AWS) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 		// validators
 		defaultPublicKeyValidator{},
 		commonNameValidator(payload.Claims.Subject),
-		newValidityValidator(p.claimer.MinTLSCertDuration(), p.claimer.MaxTLSCertDuration()),
+		newValidityValidator(p.claimer.MinTLSCertDuration(), p.claimer.MaxTLSCertDuration(), p.claimer.ClockSkew()),
 	), nil
 }
 
@@ -314,6 +314,24 @@ func (p *AWS) AuthorizeRenewal(cert *x509.Certificate) error {
 	return nil
 }
 
+// AuthorizeExpiredRenewal returns an error if the certificate expired before
+// the renewal grace period of the provisioner.
+func (p *AWS) AuthorizeExpiredRenewal(cert *x509.Certificate) error {
+	return p.claimer.authorizeExpiredRenewal(cert)
+}
+
+// RenewalWindow returns how long before their expiration the certificates of
+// the provisioner should be renewed.
+func (p *AWS) RenewalWindow() time.Duration {
+	return p.claimer.RenewalWindow()
+}
+
+// IsRenewalKeyPinned returns if the renewals of the certificates of the
+// provisioner must keep the key of the certificate.
+func (p *AWS) IsRenewalKeyPinned() bool {
+	return p.claimer.IsRenewalKeyPinned()
+}
+
 // AuthorizeRevoke returns an error because revoke is not supported on AWS
 // provisioners.
 func (p *AWS) AuthorizeRevoke(token string) error {
@@ -396,19 +414,17 @@ func (p *AWS) authorizeToken(token string) (*awsPayload, error) {
 		return nil, errors.New("identity document region cannot be empty")
 	}
 
-	// According to "rfc7519 JSON Web Token" acceptable skew should be no
-	// more than a few minutes.
 	now := time.Now().UTC()
 	if err = payload.ValidateWithLeeway(jose.Expected{
 		Issuer: awsIssuer,
 		Time:   now,
-	}, time.Minute); err != nil {
-		return nil, errors.Wrapf(err, "invalid token")
+	}, p.claimer.ClockSkew()); err != nil {
+		return nil, errors.Wrapf(tokenError(err), "invalid token")
 	}
 
 	// validate audiences with the defaults
 	if !matchesAudience(payload.Audience, p.audiences.Sign) {
-		return nil, errors.New("invalid token: invalid audience claim (aud)")
+		return nil, NewError(ErrCodeTokenInvalid, errors.New("invalid token: invalid audience claim (aud)"))
 	}
 
 	// Validate subject, it has to be known if disableCustomSANs is enabled
@@ -477,6 +493,6 @@ func (p *AWS) authorizeSSHSign(claims *awsPayload) ([]SignOption, error) {
 		// Validate the validity period.
 		&sshCertificateValidityValidator{p.claimer},
 		// Require all the fields in the SSH certificate
-		&sshCertificateDefaultValidator{},
+		&sshCertificateDefaultValidator{p.claimer.ClockSkew()},
 	), nil
 }
@@ -221,7 +221,7 @@ func (p *Azure) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 
 	var found bool
 	var claims azurePayload
-	keys := p.keyStore.Get(jwt.Headers[0].KeyID)
+	keys := p.keyStore.Get(ctx, jwt.Headers[0].KeyID)
 	for _, key := range keys {
 		if err := jwt.Claims(key.Public(), &claims); err == nil {
 			found = true
@@ -236,8 +236,8 @@ func (p *Azure) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 		Audience: []string{p.Audience},
 		Issuer:   p.oidcConfig.Issuer,
 		Time:     time.Now(),
-	}, 1*time.Minute); err != nil {
-		return nil, errors.Wrap(err, "failed to validate payload")
+	}, p.claimer.ClockSkew()); err != nil {
+		return nil, errors.Wrap(tokenError(err), "failed to validate payload")
 	}
 
 	// Validate TenantID
@@ -289,7 +289,7 @@ func (p *Azure) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 		profileDefaultDuration(p.claimer.DefaultTLSCertDuration()),
 		// validators
 		defaultPublicKeyValidator{},
-		newValidityValidator(p.claimer.MinTLSCertDuration(), p.claimer.MaxTLSCertDuration()),
+		newValidityValidator(p.claimer.MinTLSCertDuration(), p.claimer.MaxTLSCertDuration(), p.claimer.ClockSkew()),
 	), nil
 }
 
@@ -301,6 +301,24 @@ func (p *Azure) AuthorizeRenewal(cert *x509.Certificate) error {
 	return nil
 }
 
+// AuthorizeExpiredRenewal returns an error if the certificate expired before
+// the renewal grace period of the provisioner.
+func (p *Azure) AuthorizeExpiredRenewal(cert *x509.Certificate) error {
+	return p.claimer.authorizeExpiredRenewal(cert)
+}
+
+// RenewalWindow returns how long before their expiration the certificates of
+// the provisioner should be renewed.
+func (p *Azure) RenewalWindow() time.Duration {
+	return p.claimer.RenewalWindow()
+}
+
+// IsRenewalKeyPinned returns if the renewals of the certificates of the
+// provisioner must keep the key of the certificate.
+func (p *Azure) IsRenewalKeyPinned() bool {
+	return p.claimer.IsRenewalKeyPinned()
+}
+
 // AuthorizeRevoke returns an error because revoke is not supported on Azure
 // provisioners.
 func (p *Azure) AuthorizeRevoke(token string) error {
@@ -334,7 +352,7 @@ func (p *Azure) authorizeSSHSign(claims azurePayload, name string) ([]SignOption
 		// Validate the validity period.
 		&sshCertificateValidityValidator{p.claimer},
 		// Require all the fields in the SSH certificate
-		&sshCertificateDefaultValidator{},
+		&sshCertificateDefaultValidator{p.claimer.ClockSkew()},
 	), nil
 }
 
@@ -1,18 +1,28 @@
 package provisioner
 
 import (
+	"crypto/x509"
 	"time"
 
 	"github.com/pkg/errors"
 )
 
+// DefaultClockSkew is the default tolerance applied to the validation of the
+// times of the tokens and certificates. According to "rfc7519 JSON Web Token"
+// acceptable skew should be no more than a few minutes.
+const DefaultClockSkew = time.Minute
+
 // Claims so that individual provisioners can override global claims.
 type Claims struct {
 	// TLS CA properties
-	MinTLSDur      *Duration `json:"minTLSCertDuration,omitempty"`
-	MaxTLSDur      *Duration `json:"maxTLSCertDuration,omitempty"`
-	DefaultTLSDur  *Duration `json:"defaultTLSCertDuration,omitempty"`
-	DisableRenewal *bool     `json:"disableRenewal,omitempty"`
+	MinTLSDur          *Duration `json:"minTLSCertDuration,omitempty"`
+	MaxTLSDur          *Duration `json:"maxTLSCertDuration,omitempty"`
+	DefaultTLSDur      *Duration `json:"defaultTLSCertDuration,omitempty"`
+	DisableRenewal     *bool     `json:"disableRenewal,omitempty"`
+	RenewalGracePeriod *Duration `json:"renewalGracePeriod,omitempty"`
+	RenewalWindow      *Duration `json:"renewalWindow,omitempty"`
+	PinRenewalKey      *bool     `json:"pinRenewalKey,omitempty"`
+	ClockSkew          *Duration `json:"clockSkew,omitempty"`
 	// SSH CA properties
 	MinUserSSHDur     *Duration `json:"minUserSSHCertDuration,omitempty"`
 	MaxUserSSHDur     *Duration `json:"maxUserSSHCertDuration,omitempty"`
@@ -39,19 +49,24 @@ func NewClaimer(claims *Claims, global Claims) (*Claimer, error) {
 // Claims returns the merge of the inner and global claims.
 func (c *Claimer) Claims() Claims {
 	disableRenewal := c.IsDisableRenewal()
+	pinRenewalKey := c.IsRenewalKeyPinned()
 	enableSSHCA := c.IsSSHCAEnabled()
 	return Claims{
-		MinTLSDur:         &Duration{c.MinTLSCertDuration()},
-		MaxTLSDur:         &Duration{c.MaxTLSCertDuration()},
-		DefaultTLSDur:     &Duration{c.DefaultTLSCertDuration()},
-		DisableRenewal:    &disableRenewal,
-		MinUserSSHDur:     &Duration{c.MinUserSSHCertDuration()},
-		MaxUserSSHDur:     &Duration{c.MaxUserSSHCertDuration()},
-		DefaultUserSSHDur: &Duration{c.DefaultUserSSHCertDuration()},
-		MinHostSSHDur:     &Duration{c.MinHostSSHCertDuration()},
-		MaxHostSSHDur:     &Duration{c.MaxHostSSHCertDuration()},
-		DefaultHostSSHDur: &Duration{c.DefaultHostSSHCertDuration()},
-		EnableSSHCA:       &enableSSHCA,
+		MinTLSDur:          &Duration{c.MinTLSCertDuration()},
+		MaxTLSDur:          &Duration{c.MaxTLSCertDuration()},
+		DefaultTLSDur:      &Duration{c.DefaultTLSCertDuration()},
+		DisableRenewal:     &disableRenewal,
+		RenewalGracePeriod: &Duration{c.RenewalGracePeriod()},
+		RenewalWindow:      &Duration{c.RenewalWindow()},
+		PinRenewalKey:      &pinRenewalKey,
+		ClockSkew:          &Duration{c.ClockSkew()},
+		MinUserSSHDur:      &Duration{c.MinUserSSHCertDuration()},
+		MaxUserSSHDur:      &Duration{c.MaxUserSSHCertDuration()},
+		DefaultUserSSHDur:  &Duration{c.DefaultUserSSHCertDuration()},
+		MinHostSSHDur:      &Duration{c.MinHostSSHCertDuration()},
+		MaxHostSSHDur:      &Duration{c.MaxHostSSHCertDuration()},
+		DefaultHostSSHDur:  &Duration{c.DefaultHostSSHCertDuration()},
+		EnableSSHCA:        &enableSSHCA,
 	}
 }
 
@@ -95,6 +110,73 @@ func (c *Claimer) IsDisableRenewal() bool {
 	return *c.claims.DisableRenewal
 }
 
+// RenewalGracePeriod returns how long after its expiration a certificate can
+// be renewed. If the property is not set within the provisioner, then the
+// global value from the authority configuration will be used. It defaults to
+// 0, expired certificates cannot be renewed.
+func (c *Claimer) RenewalGracePeriod() time.Duration {
+	if c.claims == nil || c.claims.RenewalGracePeriod == nil {
+		if c.global.RenewalGracePeriod == nil {
+			return 0
+		}
+		return c.global.RenewalGracePeriod.Duration
+	}
+	return c.claims.RenewalGracePeriod.Duration
+}
+
+// authorizeExpiredRenewal returns an error if the given certificate expired
+// before the renewal grace period.
+func (c *Claimer) authorizeExpiredRenewal(crt *x509.Certificate) error {
+	if now().After(crt.NotAfter.Add(c.RenewalGracePeriod() + c.ClockSkew())) {
+		return errors.Errorf("certificate expired on %s, the renewal grace period is %s",
+			crt.NotAfter.UTC().Format(time.RFC3339), c.RenewalGracePeriod())
+	}
+	return nil
+}
+
+// RenewalWindow returns how long before its expiration a certificate should be
+// renewed. If the property is not set within the provisioner, then the global
+// value from the authority configuration will be used. It defaults to 0, the
+// certificates should be renewed after two thirds of their validity.
+func (c *Claimer) RenewalWindow() time.Duration {
+	if c.claims == nil || c.claims.RenewalWindow == nil {
+		if c.global.RenewalWindow == nil {
+			return 0
+		}
+		return c.global.RenewalWindow.Duration
+	}
+	return c.claims.RenewalWindow.Duration
+}
+
+// IsRenewalKeyPinned returns if the renewals must present the key of the
+// certificate, a different key can only be used with a rekey. If the property
+// is not set within the provisioner, then the global value from the authority
+// configuration will be used. It defaults to false.
+func (c *Claimer) IsRenewalKeyPinned() bool {
+	if c.claims == nil || c.claims.PinRenewalKey == nil {
+		if c.global.PinRenewalKey == nil {
+			return false
+		}
+		return *c.global.PinRenewalKey
+	}
+	return *c.claims.PinRenewalKey
+}
+
+// ClockSkew returns the tolerance applied to the validation of the times of
+// the tokens and certificates, the maximum difference expected between the
+// clocks of the CA and its clients. If the property is not set within the
+// provisioner, then the global value from the authority configuration will be
+// used. It defaults to DefaultClockSkew.
+func (c *Claimer) ClockSkew() time.Duration {
+	if c.claims == nil || c.claims.ClockSkew == nil {
+		if c.global.ClockSkew == nil {
+			return DefaultClockSkew
+		}
+		return c.global.ClockSkew.Duration
+	}
+	return c.claims.ClockSkew.Duration
+}
+
 // DefaultUserSSHCertDuration returns the default SSH user cert duration for the
 // provisioner. If the default is not set within the provisioner, then the
 // global default from the authority configuration will be used.
@@ -186,6 +268,12 @@ func (c *Claimer) Validate() error {
 		return errors.Errorf("claims: DefaultCertDuration cannot be less than MinCertDuration: DefaultCertDuration - %v, MinCertDuration - %v", def, min)
 	case max < def:
 		return errors.Errorf("claims: MaxCertDuration cannot be less than DefaultCertDuration: MaxCertDuration - %v, DefaultCertDuration - %v", max, def)
+	case c.RenewalGracePeriod() < 0:
+		return errors.Errorf("claims: RenewalGracePeriod cannot be negative")
+	case c.RenewalWindow() < 0:
+		return errors.Errorf("claims: RenewalWindow cannot be negative")
+	case c.ClockSkew() < 0:
+		return errors.Errorf("claims: ClockSkew cannot be negative")
 	default:
 		return nil
 	}
@@ -0,0 +1,114 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"time"
+
+	"github.com/RTradeLtd/ca-cli/crypto/x509util"
+	"github.com/pkg/errors"
+)
+
+// defaultCodeSigningDuration is the validity period of the code-signing
+// certificates if codeSigning.duration is not set.
+const defaultCodeSigningDuration = 10 * time.Minute
+
+// stepOIDCodeSigningIdentity is the object identifier of the extension that
+// contains the OIDC identity authenticated to issue a code-signing
+// certificate.
+var stepOIDCodeSigningIdentity = append(asn1.ObjectIdentifier(nil), append(stepOIDRoot, 3)...)
+
+// CodeSigningConfig enables the keyless code-signing mode of an OIDC
+// provisioner. In this mode the provisioner issues short-lived code-signing
+// certificates for the identity in the ID token instead of the names in the
+// certificate request.
+type CodeSigningConfig struct {
+	Duration *Duration `json:"duration,omitempty"`
+}
+
+// Validate validates the code-signing configuration and sets the default
+// values.
+func (c *CodeSigningConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.Duration == nil {
+		c.Duration = &Duration{Duration: defaultCodeSigningDuration}
+	} else if c.Duration.Duration <= 0 {
+		return errors.New("codeSigning.duration must be greater than 0")
+	}
+	return nil
+}
+
+// CodeSigningIdentity is the OIDC identity embedded in a code-signing
+// certificate: the issuer and subject of the ID token, and its email if
+// present.
+type CodeSigningIdentity struct {
+	Issuer  string `asn1:"utf8"`
+	Subject string `asn1:"utf8"`
+	Email   string `asn1:"optional,omitempty,utf8"`
+}
+
+// GetCodeSigningIdentity returns the OIDC identity embedded in a code-signing
+// certificate, or false if the certificate does not contain it.
+func GetCodeSigningIdentity(crt *x509.Certificate) (*CodeSigningIdentity, bool) {
+	for _, e := range crt.Extensions {
+		if e.Id.Equal(stepOIDCodeSigningIdentity) {
+			id := new(CodeSigningIdentity)
+			if _, err := asn1.Unmarshal(e.Value, id); err != nil {
+				return nil, false
+			}
+			return id, true
+		}
+	}
+	return nil, false
+}
+
+// codeSigningIdentityModifier is a ProfileModifier that replaces the subject,
+// SANs and key usages of a certificate with the ones of a code-signing
+// certificate for the given identity. The subject alternative name is the
+// email, and without email the common name is the subject of the token.
+type codeSigningIdentityModifier CodeSigningIdentity
+
+func (o codeSigningIdentityModifier) Option(Options) x509util.WithOption {
+	return func(p x509util.Profile) error {
+		b, err := asn1.Marshal(CodeSigningIdentity(o))
+		if err != nil {
+			return errors.Wrap(err, "error marshaling code-signing identity extension")
+		}
+		crt := p.Subject()
+		crt.Subject = pkix.Name{}
+		crt.DNSNames = nil
+		crt.IPAddresses = nil
+		crt.EmailAddresses = nil
+		crt.URIs = nil
+		if o.Email != "" {
+			crt.EmailAddresses = []string{o.Email}
+		} else {
+			crt.Subject.CommonName = o.Subject
+		}
+		crt.KeyUsage = x509.KeyUsageDigitalSignature
+		crt.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}
+		crt.ExtraExtensions = append(crt.ExtraExtensions, pkix.Extension{
+			Id:       stepOIDCodeSigningIdentity,
+			Critical: false,
+			Value:    b,
+		})
+		return nil
+	}
+}
+
+// codeSigningDuration is a ProfileModifier that sets the validity period of
+// a code-signing certificate, starting now, ignoring the requested one.
+type codeSigningDuration time.Duration
+
+func (v codeSigningDuration) Option(so Options) x509util.WithOption {
+	return func(p x509util.Profile) error {
+		now := time.Now()
+		crt := p.Subject()
+		crt.NotBefore = now
+		crt.NotAfter = now.Add(time.Duration(v))
+		return nil
+	}
+}
@@ -0,0 +1,111 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-cli/crypto/x509util"
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/smallstep/assert"
+)
+
+func TestCodeSigningConfig_Validate(t *testing.T) {
+	var c *CodeSigningConfig
+	assert.Nil(t, c.Validate())
+
+	c = &CodeSigningConfig{}
+	assert.Nil(t, c.Validate())
+	assert.Equals(t, &Duration{Duration: defaultCodeSigningDuration}, c.Duration)
+
+	c = &CodeSigningConfig{Duration: &Duration{Duration: -time.Minute}}
+	assert.Equals(t, "codeSigning.duration must be greater than 0", c.Validate().Error())
+}
+
+func TestOIDC_AuthorizeSign_codeSigning(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	var keys jose.JSONWebKeySet
+	assert.FatalError(t, getAndDecode(srv.URL+"/private", &keys))
+
+	p, err := generateOIDC()
+	assert.FatalError(t, err)
+	p.ConfigurationEndpoint = srv.URL + "/.well-known/openid-configuration"
+	p.CodeSigning = &CodeSigningConfig{Duration: &Duration{Duration: 5 * time.Minute}}
+	assert.FatalError(t, p.Init(Config{Claims: globalProvisionerClaims}))
+
+	withEmail, err := generateToken("subject", "the-issuer", p.ClientID, "name@smallstep.com", []string{"test.smallstep.com"}, time.Now(), &keys.Keys[0])
+	assert.FatalError(t, err)
+	withoutEmail, err := generateToken("repo:smallstep/certificates:ref:refs/heads/master", "the-issuer", p.ClientID, "", nil, time.Now(), &keys.Keys[0])
+	assert.FatalError(t, err)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name       string
+		token      string
+		commonName string
+		emails     []string
+		want       *CodeSigningIdentity
+	}{
+		{"ok-email", withEmail, "", []string{"name@smallstep.com"}, &CodeSigningIdentity{Issuer: "the-issuer", Subject: "subject", Email: "name@smallstep.com"}},
+		{"ok-subject", withoutEmail, "repo:smallstep/certificates:ref:refs/heads/master", nil, &CodeSigningIdentity{Issuer: "the-issuer", Subject: "repo:smallstep/certificates:ref:refs/heads/master"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := NewContextWithMethod(context.Background(), SignMethod)
+			opts, err := p.AuthorizeSign(ctx, tt.token)
+			assert.FatalError(t, err)
+
+			// The names in the request are ignored.
+			tmpl := &x509.Certificate{
+				SerialNumber: big.NewInt(1),
+				DNSNames:     []string{"test.smallstep.com"},
+				NotAfter:     time.Now().Add(24 * time.Hour),
+			}
+			tmpl.Subject.CommonName = "test.smallstep.com"
+			prof := &x509util.Leaf{}
+			prof.SetSubject(tmpl)
+			for _, o := range opts {
+				if m, ok := o.(ProfileModifier); ok {
+					assert.FatalError(t, m.Option(Options{})(prof))
+				}
+			}
+			b, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+			assert.FatalError(t, err)
+			crt, err := x509.ParseCertificate(b)
+			assert.FatalError(t, err)
+
+			assert.Equals(t, tt.commonName, crt.Subject.CommonName)
+			assert.Equals(t, tt.emails, crt.EmailAddresses)
+			assert.Len(t, 0, crt.DNSNames)
+			assert.Equals(t, x509.KeyUsageDigitalSignature, crt.KeyUsage)
+			assert.Equals(t, []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}, crt.ExtKeyUsage)
+			assert.True(t, crt.NotAfter.Sub(crt.NotBefore) <= 5*time.Minute)
+
+			id, ok := GetCodeSigningIdentity(crt)
+			assert.True(t, ok)
+			assert.Equals(t, tt.want, id)
+		})
+	}
+
+	// Code-signing certificates cannot be renewed.
+	assert.NotNil(t, p.AuthorizeRenewal(&x509.Certificate{}))
+
+	// The email is required if the provisioner has domains.
+	p.Domains = []string{"smallstep.com"}
+	_, err = p.AuthorizeSign(NewContextWithMethod(context.Background(), SignMethod), withoutEmail)
+	assert.NotNil(t, err)
+}
+
+func TestGetCodeSigningIdentity(t *testing.T) {
+	_, ok := GetCodeSigningIdentity(&x509.Certificate{})
+	assert.False(t, ok)
+}
@@ -46,16 +46,26 @@ type loadByTokenPayload struct {
 type Collection struct {
 	byID      *sync.Map
 	byKey     *sync.Map
+	byToken   *lruCache
 	sorted    provisionerSlice
 	audiences Audiences
 }
 
+// tokenResolution is the result of matching the audience of a token, it is
+// cached by issuer, key id and audience. If the audience matches the CA
+// audiences the provisioner is the one loaded using the key id.
+type tokenResolution struct {
+	matched     bool
+	provisioner Interface
+}
+
 // NewCollection initializes a collection of provisioners. The given list of
 // audiences are the audiences used by the JWT provisioner.
 func NewCollection(audiences Audiences) *Collection {
 	return &Collection{
 		byID:      new(sync.Map),
 		byKey:     new(sync.Map),
+		byToken:   newLRUCache(DefaultCacheSize),
 		audiences: audiences,
 	}
 }
@@ -66,25 +76,26 @@ func (c *Collection) Load(id string) (Interface, bool) {
 }
 
 // LoadByToken parses the token claims and loads the provisioner associated.
+// The resolution of the tokens with the CA audiences is cached by issuer, key
+// id and audience.
 func (c *Collection) LoadByToken(token *jose.JSONWebToken, claims *jose.Claims) (Interface, bool) {
-	var audiences []string
-	// Get all audiences with the given fragment
-	fragment := extractFragment(claims.Audience)
-	if fragment == "" {
-		audiences = c.audiences.All()
-	} else {
-		audiences = c.audiences.WithFragment(fragment).All()
+	var kid string
+	if len(token.Headers) > 0 {
+		kid = token.Headers[0].KeyID
 	}
-
-	// match with server audiences
-	if matchesAudience(claims.Audience, audiences) {
-		// Use fragment to get provisioner name (GCP, AWS)
-		if fragment != "" {
-			return c.Load(fragment)
+	key := strings.Join(append([]string{claims.Issuer, kid}, claims.Audience...), "\x00")
+	var r tokenResolution
+	if v, ok := c.byToken.Get(key); ok {
+		r = v.(tokenResolution)
+	} else {
+		r = c.loadByAudience(claims, kid)
+		// Unknown key ids are not cached, they would evict valid entries.
+		if !r.matched || r.provisioner != nil {
+			c.byToken.Add(key, r)
 		}
-		// If matches with stored audiences it will be a JWT token (default), and
-		// the id would be <issuer>:<kid>.
-		return c.Load(claims.Issuer + ":" + token.Headers[0].KeyID)
+	}
+	if r.matched {
+		return r.provisioner, r.provisioner != nil
 	}
 
 	// The ID will be just the clientID stored in azp, aud or tid.
@@ -123,6 +134,32 @@ func (c *Collection) LoadByToken(token *jose.JSONWebToken, claims *jose.Claims)
 	return c.Load(payload.Audience[0])
 }
 
+// loadByAudience loads the provisioner of a token with the CA audiences.
+func (c *Collection) loadByAudience(claims *jose.Claims, kid string) tokenResolution {
+	var audiences []string
+	// Get all audiences with the given fragment
+	fragment := extractFragment(claims.Audience)
+	if fragment == "" {
+		audiences = c.audiences.All()
+	} else {
+		audiences = c.audiences.WithFragment(fragment).All()
+	}
+
+	// match with server audiences
+	if !matchesAudience(claims.Audience, audiences) {
+		return tokenResolution{}
+	}
+	// Use fragment to get provisioner name (GCP, AWS)
+	if fragment != "" {
+		p, _ := c.Load(fragment)
+		return tokenResolution{matched: true, provisioner: p}
+	}
+	// If matches with stored audiences it will be a JWT token (default), and
+	// the id would be <issuer>:<kid>.
+	p, _ := c.Load(claims.Issuer + ":" + kid)
+	return tokenResolution{matched: true, provisioner: p}
+}
+
 // LoadByCertificate looks for the provisioner extension and extracts the
 // proper id to load the provisioner.
 func (c *Collection) LoadByCertificate(cert *x509.Certificate) (Interface, bool) {
@@ -175,6 +212,9 @@ func (c *Collection) Store(p Interface) error {
 		return errors.New("cannot add multiple provisioners with the same id")
 	}
 
+	// The cached resolutions might not include the new provisioner.
+	c.byToken.Purge()
+
 	// Store provisioner in byKey if EncryptedKey is defined.
 	if kid, _, ok := p.GetEncryptedKey(); ok {
 		c.byKey.Store(kid, p)
@@ -198,6 +238,16 @@ func (c *Collection) Store(p Interface) error {
 
 // Find implements pagination on a list of sorted provisioners.
 func (c *Collection) Find(cursor string, limit int) (List, string) {
+	return c.find(cursor, limit, func(Interface) bool { return true })
+}
+
+// FindByType is like Find, but it only returns the provisioners of the given
+// type.
+func (c *Collection) FindByType(typ Type, cursor string, limit int) (List, string) {
+	return c.find(cursor, limit, func(p Interface) bool { return p.GetType() == typ })
+}
+
+func (c *Collection) find(cursor string, limit int, match func(Interface) bool) (List, string) {
 	switch {
 	case limit <= 0:
 		limit = DefaultProvisionersLimit
@@ -211,7 +261,14 @@ func (c *Collection) Find(cursor string, limit int) (List, string) {
 
 	slice := List{}
 	for ; i < n && len(slice) < limit; i++ {
-		slice = append(slice, c.sorted[i].provisioner)
+		if match(c.sorted[i].provisioner) {
+			slice = append(slice, c.sorted[i].provisioner)
+		}
+	}
+	// Skip the provisioners that do not match, so the cursor is only returned
+	// if there are more results.
+	for i < n && !match(c.sorted[i].provisioner) {
+		i++
 	}
 
 	if i < n {
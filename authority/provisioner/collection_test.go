@@ -145,6 +145,49 @@ func TestCollection_LoadByToken(t *testing.T) {
 	}
 }
 
+func TestCollection_LoadByToken_cache(t *testing.T) {
+	p1, err := generateJWK()
+	assert.FatalError(t, err)
+	p2, err := generateJWK()
+	assert.FatalError(t, err)
+
+	c := NewCollection(testAudiences)
+	assert.FatalError(t, c.Store(p1))
+
+	jwk, err := decryptJSONWebKey(p1.EncryptedKey)
+	assert.FatalError(t, err)
+	token, err := generateSimpleToken(p1.Name, testAudiences.Sign[0], jwk)
+	assert.FatalError(t, err)
+	t1, c1, err := parseToken(token)
+	assert.FatalError(t, err)
+
+	jwk, err = decryptJSONWebKey(p2.EncryptedKey)
+	assert.FatalError(t, err)
+	token, err = generateSimpleToken(p2.Name, testAudiences.Sign[0], jwk)
+	assert.FatalError(t, err)
+	t2, c2, err := parseToken(token)
+	assert.FatalError(t, err)
+
+	for i := 0; i < 2; i++ {
+		p, ok := c.LoadByToken(t1, c1)
+		assert.True(t, ok)
+		assert.Equals(t, p1, p)
+		assert.Equals(t, 1, c.byToken.Len())
+	}
+
+	// Unknown key ids are not cached
+	_, ok := c.LoadByToken(t2, c2)
+	assert.False(t, ok)
+	assert.Equals(t, 1, c.byToken.Len())
+
+	// New provisioners purge the cache
+	assert.FatalError(t, c.Store(p2))
+	assert.Equals(t, 0, c.byToken.Len())
+	p, ok := c.LoadByToken(t2, c2)
+	assert.True(t, ok)
+	assert.Equals(t, p2, p)
+}
+
 func TestCollection_LoadByCertificate(t *testing.T) {
 	p1, err := generateJWK()
 	assert.FatalError(t, err)
@@ -339,6 +382,61 @@ func TestCollection_Find(t *testing.T) {
 	}
 }
 
+func TestCollection_FindByType(t *testing.T) {
+	c, err := generateCollection(10, 10)
+	assert.FatalError(t, err)
+
+	var jwks, oidcs provisionerSlice
+	for _, p := range c.sorted {
+		if p.provisioner.GetType() == TypeJWK {
+			jwks = append(jwks, p)
+		} else {
+			oidcs = append(oidcs, p)
+		}
+	}
+	trim := func(s string) string {
+		return strings.TrimLeft(s, "0")
+	}
+	toList := func(ps provisionerSlice) List {
+		l := List{}
+		for _, p := range ps {
+			l = append(l, p.provisioner)
+		}
+		return l
+	}
+
+	type args struct {
+		typ    Type
+		cursor string
+		limit  int
+	}
+	tests := []struct {
+		name  string
+		args  args
+		want  List
+		want1 string
+	}{
+		{"all jwk", args{TypeJWK, "", 0}, toList(jwks), ""},
+		{"all oidc", args{TypeOIDC, "", 0}, toList(oidcs), ""},
+		{"none", args{TypeAWS, "", 0}, List{}, ""},
+		{"jwk 0 to 4", args{TypeJWK, "", 5}, toList(jwks[0:5]), trim(jwks[5].uid)},
+		{"jwk 5 to 9", args{TypeJWK, trim(jwks[5].uid), 5}, toList(jwks[5:10]), ""},
+		{"oidc 0 to 9", args{TypeOIDC, "", 10}, toList(oidcs), ""},
+		{"oidc 9", args{TypeOIDC, trim(oidcs[9].uid), 10}, toList(oidcs[9:]), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, got1 := c.FindByType(tt.args.typ, tt.args.cursor, tt.args.limit)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Collection.FindByType() got = %v, want %v", got, tt.want)
+			}
+			if got1 != tt.want1 {
+				t.Errorf("Collection.FindByType() got1 = %v, want %v", got1, tt.want1)
+			}
+		})
+	}
+}
+
 func Test_matchesAudience(t *testing.T) {
 	type matchesTest struct {
 		a, b []string
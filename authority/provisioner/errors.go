@@ -0,0 +1,97 @@
+package provisioner
+
+import (
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/pkg/errors"
+)
+
+// Error codes of the errors returned by the provisioners. The codes are
+// stable and they are part of the CA API.
+const (
+	// ErrCodeTokenInvalid is the code used when a token cannot be parsed,
+	// verified or has invalid claims.
+	ErrCodeTokenInvalid = "provisioner.token.invalid"
+	// ErrCodeTokenExpired is the code used when a token has expired.
+	ErrCodeTokenExpired = "provisioner.token.expired"
+	// ErrCodeTokenNotYetValid is the code used when a token is used before
+	// its not before claim.
+	ErrCodeTokenNotYetValid = "provisioner.token.notYetValid"
+	// ErrCodeTokenReused is the code used when a one-time token has already
+	// been used.
+	ErrCodeTokenReused = "provisioner.token.reused"
+	// ErrCodeTokenBadNonce is the code used when a token does not contain a
+	// valid nonce issued by the CA, or the nonce has already been used.
+	ErrCodeTokenBadNonce = "provisioner.token.badNonce"
+	// ErrCodeCertificateRevoked is the code used when a certificate presented
+	// to a provisioner has been revoked.
+	ErrCodeCertificateRevoked = "provisioner.certificate.revoked"
+	// ErrCodePolicyCommonNameDenied is the code used when the common name of
+	// a certificate request is not allowed.
+	ErrCodePolicyCommonNameDenied = "policy.commonName.denied"
+	// ErrCodePolicySANDenied is the code used when the subject alternative
+	// names of a certificate request are not allowed.
+	ErrCodePolicySANDenied = "policy.san.denied"
+	// ErrCodePolicyKeyDenied is the code used when the public key of a
+	// certificate request is not allowed.
+	ErrCodePolicyKeyDenied = "policy.key.denied"
+	// ErrCodePolicyValidityDenied is the code used when the requested validity
+	// period is not allowed.
+	ErrCodePolicyValidityDenied = "policy.validity.denied"
+)
+
+// Error is an error with a stable machine-readable code and optional details.
+// It implements the api.ErrorCoder and api.ErrorDetailer interfaces, the
+// message of the wrapped error is not modified.
+type Error struct {
+	Code    string
+	Details map[string]interface{}
+	Err     error
+}
+
+// NewError returns a new Error with the given code wrapping the given error.
+func NewError(code string, err error) *Error {
+	return &Error{Code: code, Err: err}
+}
+
+// WithDetail adds the given key and value to the details of the error and
+// returns the error.
+func (e *Error) WithDetail(key string, value interface{}) *Error {
+	if e.Details == nil {
+		e.Details = make(map[string]interface{})
+	}
+	e.Details[key] = value
+	return e
+}
+
+// Error implements the error interface and returns the error string.
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Cause implements the errors.Causer interface and returns the original error.
+func (e *Error) Cause() error {
+	return e.Err
+}
+
+// ErrorCode returns the machine-readable code of the error.
+func (e *Error) ErrorCode() string {
+	return e.Code
+}
+
+// ErrorDetails returns the details of the error.
+func (e *Error) ErrorDetails() map[string]interface{} {
+	return e.Details
+}
+
+// tokenError returns an Error with the code matching the given error returned
+// by the validation of the claims of a token.
+func tokenError(err error) *Error {
+	switch errors.Cause(err) {
+	case jose.ErrExpired:
+		return NewError(ErrCodeTokenExpired, err)
+	case jose.ErrNotValidYet:
+		return NewError(ErrCodeTokenNotYetValid, err)
+	default:
+		return NewError(ErrCodeTokenInvalid, err)
+	}
+}
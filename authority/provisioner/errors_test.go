@@ -0,0 +1,50 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"testing"
+
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+func Test_tokenError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"expired", jose.ErrExpired, ErrCodeTokenExpired},
+		{"expired-wrapped", errors.Wrap(jose.ErrExpired, "validation failed"), ErrCodeTokenExpired},
+		{"not-yet-valid", jose.ErrNotValidYet, ErrCodeTokenNotYetValid},
+		{"invalid", jose.ErrInvalidIssuer, ErrCodeTokenInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tokenError(tt.err)
+			assert.Equals(t, tt.want, err.ErrorCode())
+			assert.Equals(t, tt.err.Error(), err.Error())
+			assert.Equals(t, errors.Cause(tt.err), errors.Cause(err))
+		})
+	}
+}
+
+func TestError_WithDetail(t *testing.T) {
+	err := NewError(ErrCodePolicySANDenied, errors.New("an error"))
+	assert.Nil(t, err.ErrorDetails())
+	err = err.WithDetail("got", []string{"foo"}).WithDetail("want", []string{"bar"})
+	assert.Equals(t, map[string]interface{}{"got": []string{"foo"}, "want": []string{"bar"}}, err.ErrorDetails())
+}
+
+func Test_dnsNamesValidator_errorCode(t *testing.T) {
+	err := dnsNamesValidator{"foo.smallstep.com"}.Valid(&x509.CertificateRequest{DNSNames: []string{"bar.smallstep.com"}})
+	if assert.NotNil(t, err) {
+		e, ok := err.(*Error)
+		if assert.True(t, ok) {
+			assert.Equals(t, ErrCodePolicySANDenied, e.ErrorCode())
+			assert.Equals(t, []string{"bar.smallstep.com"}, e.Details["got"])
+			assert.Equals(t, []string{"foo.smallstep.com"}, e.Details["want"])
+		}
+	}
+}
@@ -207,7 +207,7 @@ func (p *GCP) Init(config Config) error {
 // AuthorizeSign validates the given token and returns the sign options that
 // will be used on certificate creation.
 func (p *GCP) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
-	claims, err := p.authorizeToken(token)
+	claims, err := p.authorizeToken(ctx, token)
 	if err != nil {
 		return nil, err
 	}
@@ -242,7 +242,7 @@ func (p *GCP) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 		profileDefaultDuration(p.claimer.DefaultTLSCertDuration()),
 		// validators
 		defaultPublicKeyValidator{},
-		newValidityValidator(p.claimer.MinTLSCertDuration(), p.claimer.MaxTLSCertDuration()),
+		newValidityValidator(p.claimer.MinTLSCertDuration(), p.claimer.MaxTLSCertDuration(), p.claimer.ClockSkew()),
 	), nil
 }
 
@@ -254,6 +254,24 @@ func (p *GCP) AuthorizeRenewal(cert *x509.Certificate) error {
 	return nil
 }
 
+// AuthorizeExpiredRenewal returns an error if the certificate expired before
+// the renewal grace period of the provisioner.
+func (p *GCP) AuthorizeExpiredRenewal(cert *x509.Certificate) error {
+	return p.claimer.authorizeExpiredRenewal(cert)
+}
+
+// RenewalWindow returns how long before their expiration the certificates of
+// the provisioner should be renewed.
+func (p *GCP) RenewalWindow() time.Duration {
+	return p.claimer.RenewalWindow()
+}
+
+// IsRenewalKeyPinned returns if the renewals of the certificates of the
+// provisioner must keep the key of the certificate.
+func (p *GCP) IsRenewalKeyPinned() bool {
+	return p.claimer.IsRenewalKeyPinned()
+}
+
 // AuthorizeRevoke returns an error because revoke is not supported on GCP
 // provisioners.
 func (p *GCP) AuthorizeRevoke(token string) error {
@@ -270,7 +288,7 @@ func (p *GCP) assertConfig() {
 // authorizeToken performs common jwt authorization actions and returns the
 // claims for case specific downstream parsing.
 // e.g. a Sign request will auth/validate different fields than a Revoke request.
-func (p *GCP) authorizeToken(token string) (*gcpPayload, error) {
+func (p *GCP) authorizeToken(ctx context.Context, token string) (*gcpPayload, error) {
 	jwt, err := jose.ParseSigned(token)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error parsing token")
@@ -282,7 +300,7 @@ func (p *GCP) authorizeToken(token string) (*gcpPayload, error) {
 	var found bool
 	var claims gcpPayload
 	kid := jwt.Headers[0].KeyID
-	keys := p.keyStore.Get(kid)
+	keys := p.keyStore.Get(ctx, kid)
 	for _, key := range keys {
 		if err := jwt.Claims(key.Public(), &claims); err == nil {
 			found = true
@@ -293,19 +311,17 @@ func (p *GCP) authorizeToken(token string) (*gcpPayload, error) {
 		return nil, errors.Errorf("failed to validate payload: cannot find key for kid %s", kid)
 	}
 
-	// According to "rfc7519 JSON Web Token" acceptable skew should be no
-	// more than a few minutes.
 	now := time.Now().UTC()
 	if err = claims.ValidateWithLeeway(jose.Expected{
 		Issuer: "https://accounts.google.com",
 		Time:   now,
-	}, time.Minute); err != nil {
-		return nil, errors.Wrapf(err, "invalid token")
+	}, p.claimer.ClockSkew()); err != nil {
+		return nil, errors.Wrapf(tokenError(err), "invalid token")
 	}
 
 	// validate audiences with the defaults
 	if !matchesAudience(claims.Audience, p.audiences.Sign) {
-		return nil, errors.New("invalid token: invalid audience claim (aud)")
+		return nil, NewError(ErrCodeTokenInvalid, errors.New("invalid token: invalid audience claim (aud)"))
 	}
 
 	// validate subject (service account)
@@ -389,6 +405,6 @@ func (p *GCP) authorizeSSHSign(claims *gcpPayload) ([]SignOption, error) {
 		// Validate the validity period.
 		&sshCertificateValidityValidator{p.claimer},
 		// Require all the fields in the SSH certificate
-		&sshCertificateDefaultValidator{},
+		&sshCertificateDefaultValidator{p.claimer.ClockSkew()},
 	), nil
 }
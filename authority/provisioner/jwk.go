@@ -5,7 +5,6 @@ import (
 	"crypto/x509"
 	"time"
 
-	"github.com/RTradeLtd/ca-cli/crypto/x509util"
 	"github.com/RTradeLtd/ca-cli/jose"
 	"github.com/pkg/errors"
 )
@@ -106,18 +105,16 @@ func (p *JWK) authorizeToken(token string, audiences []string) (*jwtPayload, err
 		return nil, errors.Wrap(err, "error parsing claims")
 	}
 
-	// According to "rfc7519 JSON Web Token" acceptable skew should be no
-	// more than a few minutes.
 	if err = claims.ValidateWithLeeway(jose.Expected{
 		Issuer: p.Name,
 		Time:   time.Now().UTC(),
-	}, time.Minute); err != nil {
-		return nil, errors.Wrapf(err, "invalid token")
+	}, p.claimer.ClockSkew()); err != nil {
+		return nil, errors.Wrapf(tokenError(err), "invalid token")
 	}
 
 	// validate audiences with the defaults
 	if !matchesAudience(claims.Audience, audiences) {
-		return nil, errors.New("invalid token: invalid audience claim (aud)")
+		return nil, NewError(ErrCodeTokenInvalid, errors.New("invalid token: invalid audience claim (aud)"))
 	}
 
 	if claims.Subject == "" {
@@ -134,6 +131,15 @@ func (p *JWK) AuthorizeRevoke(token string) error {
 	return err
 }
 
+// AuthorizeAdmin validates the given admin token and returns its subject.
+func (p *JWK) AuthorizeAdmin(token string) (string, error) {
+	claims, err := p.authorizeToken(token, p.audiences.Admin)
+	if err != nil {
+		return "", err
+	}
+	return claims.Subject, nil
+}
+
 // AuthorizeSign validates the given token.
 func (p *JWK) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
 	claims, err := p.authorizeToken(token, p.audiences.Sign)
@@ -156,8 +162,8 @@ func (p *JWK) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 		claims.SANs = []string{claims.Subject}
 	}
 
-	dnsNames, ips, emails := x509util.SplitSANs(claims.SANs)
-	return []SignOption{
+	dnsNames, ips, emails, uris := splitSANs(claims.SANs)
+	signOptions := []SignOption{
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeJWK, p.Name, p.Key.KeyID),
 		profileDefaultDuration(p.claimer.DefaultTLSCertDuration()),
@@ -167,8 +173,14 @@ func (p *JWK) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 		dnsNamesValidator(dnsNames),
 		emailAddressesValidator(emails),
 		ipAddressesValidator(ips),
-		newValidityValidator(p.claimer.MinTLSCertDuration(), p.claimer.MaxTLSCertDuration()),
-	}, nil
+		newValidityValidator(p.claimer.MinTLSCertDuration(), p.claimer.MaxTLSCertDuration(), p.claimer.ClockSkew()),
+	}
+	// The URIs, e.g. SPIFFE IDs, are only validated if the token has them, for
+	// compatibility with the clients that add other URIs.
+	if len(uris) > 0 {
+		signOptions = append(signOptions, urisValidator(uris))
+	}
+	return signOptions, nil
 }
 
 // AuthorizeRenewal returns an error if the renewal is disabled.
@@ -179,6 +191,24 @@ func (p *JWK) AuthorizeRenewal(cert *x509.Certificate) error {
 	return nil
 }
 
+// AuthorizeExpiredRenewal returns an error if the certificate expired before
+// the renewal grace period of the provisioner.
+func (p *JWK) AuthorizeExpiredRenewal(cert *x509.Certificate) error {
+	return p.claimer.authorizeExpiredRenewal(cert)
+}
+
+// RenewalWindow returns how long before their expiration the certificates of
+// the provisioner should be renewed.
+func (p *JWK) RenewalWindow() time.Duration {
+	return p.claimer.RenewalWindow()
+}
+
+// IsRenewalKeyPinned returns if the renewals of the certificates of the
+// provisioner must keep the key of the certificate.
+func (p *JWK) IsRenewalKeyPinned() bool {
+	return p.claimer.IsRenewalKeyPinned()
+}
+
 // authorizeSSHSign returns the list of SignOption for a SignSSH request.
 func (p *JWK) authorizeSSHSign(claims *jwtPayload) ([]SignOption, error) {
 	t := now()
@@ -220,6 +250,6 @@ func (p *JWK) authorizeSSHSign(claims *jwtPayload) ([]SignOption, error) {
 		// Validate the validity period.
 		&sshCertificateValidityValidator{p.claimer},
 		// Require and validate all the default fields in the SSH certificate.
-		&sshCertificateDefaultValidator{},
+		&sshCertificateDefaultValidator{p.claimer.ClockSkew()},
 	), nil
 }
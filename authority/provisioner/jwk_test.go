@@ -224,6 +224,47 @@ func TestJWK_AuthorizeRevoke(t *testing.T) {
 	}
 }
 
+func TestJWK_AuthorizeAdmin(t *testing.T) {
+	p1, err := generateJWK()
+	assert.FatalError(t, err)
+	key1, err := decryptJSONWebKey(p1.EncryptedKey)
+	assert.FatalError(t, err)
+	t1, err := generateSimpleToken(p1.Name, testAudiences.Admin[0], key1)
+	assert.FatalError(t, err)
+	t2, err := generateSimpleToken(p1.Name, testAudiences.Sign[0], key1)
+	assert.FatalError(t, err)
+	// invalid signature
+	failSig := t1[0 : len(t1)-2]
+
+	type args struct {
+		token string
+	}
+	tests := []struct {
+		name string
+		prov *JWK
+		args args
+		want string
+		err  error
+	}{
+		{"fail-signature", p1, args{failSig}, "", errors.New("error parsing claims: square/go-jose: error in cryptographic primitive")},
+		{"fail-audience", p1, args{t2}, "", errors.New("invalid token: invalid audience claim (aud)")},
+		{"ok", p1, args{t1}, "subject", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.prov.AuthorizeAdmin(tt.args.token)
+			if err != nil {
+				if assert.NotNil(t, tt.err) {
+					assert.HasPrefix(t, err.Error(), tt.err.Error())
+				}
+			} else {
+				assert.Nil(t, tt.err)
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
+
 func TestJWK_AuthorizeSign(t *testing.T) {
 	p1, err := generateJWK()
 	assert.FatalError(t, err)
@@ -329,6 +370,45 @@ func TestJWK_AuthorizeRenewal(t *testing.T) {
 	}
 }
 
+func TestJWK_AuthorizeExpiredRenewal(t *testing.T) {
+	p1, err := generateJWK()
+	assert.FatalError(t, err)
+	p2, err := generateJWK()
+	assert.FatalError(t, err)
+
+	// allow renewals up to an hour after the expiration
+	p2.Claims = &Claims{RenewalGracePeriod: &Duration{time.Hour}}
+	p2.claimer, err = NewClaimer(p2.Claims, globalProvisionerClaims)
+	assert.FatalError(t, err)
+
+	now := time.Now()
+	valid := &x509.Certificate{NotAfter: now.Add(time.Minute)}
+	expired := &x509.Certificate{NotAfter: now.Add(-time.Minute)}
+	tooOld := &x509.Certificate{NotAfter: now.Add(-2 * time.Hour)}
+
+	type args struct {
+		cert *x509.Certificate
+	}
+	tests := []struct {
+		name    string
+		prov    *JWK
+		args    args
+		wantErr bool
+	}{
+		{"ok", p1, args{valid}, false},
+		{"ok-grace-period", p2, args{expired}, false},
+		{"fail-expired", p1, args{expired}, true},
+		{"fail-grace-period", p2, args{tooOld}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.prov.AuthorizeExpiredRenewal(tt.args.cert); (err != nil) != tt.wantErr {
+				t.Errorf("JWK.AuthorizeExpiredRenewal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestJWK_AuthorizeSign_SSH(t *testing.T) {
 	tm, fn := mockNow()
 	defer fn()
@@ -6,6 +6,7 @@ import (
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"time"
 
 	"github.com/RTradeLtd/ca-cli/crypto/pemutil"
 	"github.com/RTradeLtd/ca-cli/jose"
@@ -182,12 +183,11 @@ func (p *K8sSA) authorizeToken(token string, audiences []string) (*k8sSAPayload,
 		return nil, errors.New("error validating token and extracting claims")
 	}
 
-	// According to "rfc7519 JSON Web Token" acceptable skew should be no
-	// more than a few minutes.
-	if err = claims.Validate(jose.Expected{
+	if err = claims.ValidateWithLeeway(jose.Expected{
 		Issuer: k8sSAIssuer,
-	}); err != nil {
-		return nil, errors.Wrapf(err, "invalid token claims")
+		Time:   time.Now().UTC(),
+	}, p.claimer.ClockSkew()); err != nil {
+		return nil, errors.Wrapf(tokenError(err), "invalid token claims")
 	}
 
 	if claims.Subject == "" {
@@ -222,7 +222,7 @@ func (p *K8sSA) AuthorizeSign(ctx context.Context, token string) ([]SignOption,
 		profileDefaultDuration(p.claimer.DefaultTLSCertDuration()),
 		// validators
 		defaultPublicKeyValidator{},
-		newValidityValidator(p.claimer.MinTLSCertDuration(), p.claimer.MaxTLSCertDuration()),
+		newValidityValidator(p.claimer.MinTLSCertDuration(), p.claimer.MaxTLSCertDuration(), p.claimer.ClockSkew()),
 	}, nil
 }
 
@@ -234,6 +234,24 @@ func (p *K8sSA) AuthorizeRenewal(cert *x509.Certificate) error {
 	return nil
 }
 
+// AuthorizeExpiredRenewal returns an error if the certificate expired before
+// the renewal grace period of the provisioner.
+func (p *K8sSA) AuthorizeExpiredRenewal(cert *x509.Certificate) error {
+	return p.claimer.authorizeExpiredRenewal(cert)
+}
+
+// RenewalWindow returns how long before their expiration the certificates of
+// the provisioner should be renewed.
+func (p *K8sSA) RenewalWindow() time.Duration {
+	return p.claimer.RenewalWindow()
+}
+
+// IsRenewalKeyPinned returns if the renewals of the certificates of the
+// provisioner must keep the key of the certificate.
+func (p *K8sSA) IsRenewalKeyPinned() bool {
+	return p.claimer.IsRenewalKeyPinned()
+}
+
 /*
 func checkAccess(authz kauthz.AuthorizationV1Interface) error {
 	r := &kauthzApi.SelfSubjectAccessReview{
@@ -1,6 +1,7 @@
 package provisioner
 
 import (
+	"context"
 	"encoding/json"
 	"math/rand"
 	"net/http"
@@ -24,24 +25,29 @@ type keyStore struct {
 	sync.RWMutex
 	uri    string
 	keySet jose.JSONWebKeySet
+	byKid  *lruCache
 	timer  *time.Timer
 	expiry time.Time
 	jitter time.Duration
+	err    error
 }
 
 func newKeyStore(uri string) (*keyStore, error) {
-	keys, age, err := getKeysFromJWKsURI(uri)
+	keys, age, err := getKeysFromJWKsURI(context.Background(), uri)
 	if err != nil {
 		return nil, err
 	}
 	ks := &keyStore{
 		uri:    uri,
 		keySet: keys,
+		byKid:  newLRUCache(DefaultCacheSize),
 		expiry: getExpirationTime(age),
 		jitter: getCacheJitter(age),
 	}
 	next := ks.nextReloadDuration(age)
-	ks.timer = time.AfterFunc(next, ks.reload)
+	ks.timer = time.AfterFunc(next, func() {
+		ks.reload(context.Background())
+	})
 	return ks, nil
 }
 
@@ -49,27 +55,39 @@ func (ks *keyStore) Close() {
 	ks.timer.Stop()
 }
 
-func (ks *keyStore) Get(kid string) (keys []jose.JSONWebKey) {
+// Get returns the keys with the given kid. If the keys have expired they are
+// reloaded using the given context, so the request can be abandoned. The keys
+// found are cached by kid until the next reload.
+func (ks *keyStore) Get(ctx context.Context, kid string) (keys []jose.JSONWebKey) {
 	ks.RLock()
 	// Force reload if expiration has passed
 	if time.Now().After(ks.expiry) {
 		ks.RUnlock()
-		ks.reload()
+		ks.reload(ctx)
 		ks.RLock()
 	}
-	keys = ks.keySet.Key(kid)
+	if v, ok := ks.byKid.Get(kid); ok {
+		keys = v.([]jose.JSONWebKey)
+	} else if keys = ks.keySet.Key(kid); len(keys) > 0 {
+		ks.byKid.Add(kid, keys)
+	}
 	ks.RUnlock()
 	return
 }
 
-func (ks *keyStore) reload() {
+func (ks *keyStore) reload(ctx context.Context) {
 	var next time.Duration
-	keys, age, err := getKeysFromJWKsURI(ks.uri)
+	keys, age, err := getKeysFromJWKsURI(ctx, ks.uri)
 	if err != nil {
+		ks.Lock()
+		ks.err = err
+		ks.Unlock()
 		next = ks.nextReloadDuration(ks.jitter / 2)
 	} else {
 		ks.Lock()
+		ks.err = nil
 		ks.keySet = keys
+		ks.byKid.Purge()
 		ks.expiry = getExpirationTime(age)
 		ks.jitter = getCacheJitter(age)
 		next = ks.nextReloadDuration(age)
@@ -81,6 +99,14 @@ func (ks *keyStore) reload() {
 	ks.Unlock()
 }
 
+// Err returns the error of the last reload, or nil if it succeeded. The keys
+// loaded before the error are still used until they expire.
+func (ks *keyStore) Err() error {
+	ks.RLock()
+	defer ks.RUnlock()
+	return ks.err
+}
+
 // nextReloadDuration would return the duration for the next rotation. If age is
 // 0 it will randomly rotate between 0-12 hours, but every time we call to Get
 // it will automatically rotate.
@@ -90,9 +116,13 @@ func (ks *keyStore) nextReloadDuration(age time.Duration) time.Duration {
 	return abs(age)
 }
 
-func getKeysFromJWKsURI(uri string) (jose.JSONWebKeySet, time.Duration, error) {
+func getKeysFromJWKsURI(ctx context.Context, uri string) (jose.JSONWebKeySet, time.Duration, error) {
 	var keys jose.JSONWebKeySet
-	resp, err := http.Get(uri)
+	req, err := http.NewRequest("GET", uri, nil)
+	if err != nil {
+		return keys, 0, errors.Wrapf(err, "error creating request for %s", uri)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
 	if err != nil {
 		return keys, 0, errors.Wrapf(err, "failed to connect to %s", uri)
 	}
@@ -1,6 +1,7 @@
 package provisioner
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"reflect"
@@ -59,9 +60,9 @@ func Test_keyStore(t *testing.T) {
 	ks.RUnlock()
 	// Check contents
 	assert.Len(t, 2, keySet1.Keys)
-	assert.Len(t, 1, ks.Get(keySet1.Keys[0].KeyID))
-	assert.Len(t, 1, ks.Get(keySet1.Keys[1].KeyID))
-	assert.Len(t, 0, ks.Get("foobar"))
+	assert.Len(t, 1, ks.Get(context.Background(), keySet1.Keys[0].KeyID))
+	assert.Len(t, 1, ks.Get(context.Background(), keySet1.Keys[1].KeyID))
+	assert.Len(t, 0, ks.Get(context.Background(), "foobar"))
 
 	// Wait for rotation
 	time.Sleep(5 * time.Second)
@@ -75,9 +76,9 @@ func Test_keyStore(t *testing.T) {
 
 	// Check contents
 	assert.Len(t, 2, keySet2.Keys)
-	assert.Len(t, 1, ks.Get(keySet2.Keys[0].KeyID))
-	assert.Len(t, 1, ks.Get(keySet2.Keys[1].KeyID))
-	assert.Len(t, 0, ks.Get("foobar"))
+	assert.Len(t, 1, ks.Get(context.Background(), keySet2.Keys[0].KeyID))
+	assert.Len(t, 1, ks.Get(context.Background(), keySet2.Keys[1].KeyID))
+	assert.Len(t, 0, ks.Get(context.Background(), "foobar"))
 
 	// Check hits
 	resp, err := srv.Client().Get(srv.URL + "/hits")
@@ -104,9 +105,9 @@ func Test_keyStore_noCache(t *testing.T) {
 	// The keys will rotate on Get.
 	// So we won't be able to find the cached ones
 	assert.Len(t, 2, keySet1.Keys)
-	assert.Len(t, 0, ks.Get(keySet1.Keys[0].KeyID))
-	assert.Len(t, 0, ks.Get(keySet1.Keys[1].KeyID))
-	assert.Len(t, 0, ks.Get("foobar"))
+	assert.Len(t, 0, ks.Get(context.Background(), keySet1.Keys[0].KeyID))
+	assert.Len(t, 0, ks.Get(context.Background(), keySet1.Keys[1].KeyID))
+	assert.Len(t, 0, ks.Get(context.Background(), "foobar"))
 
 	ks.RLock()
 	keySet2 := ks.keySet
@@ -118,9 +119,9 @@ func Test_keyStore_noCache(t *testing.T) {
 	// The keys will rotate on Get.
 	// So we won't be able to find the cached ones
 	assert.Len(t, 2, keySet2.Keys)
-	assert.Len(t, 0, ks.Get(keySet2.Keys[0].KeyID))
-	assert.Len(t, 0, ks.Get(keySet2.Keys[1].KeyID))
-	assert.Len(t, 0, ks.Get("foobar"))
+	assert.Len(t, 0, ks.Get(context.Background(), keySet2.Keys[0].KeyID))
+	assert.Len(t, 0, ks.Get(context.Background(), keySet2.Keys[1].KeyID))
+	assert.Len(t, 0, ks.Get(context.Background(), "foobar"))
 
 	// Check hits
 	resp, err := srv.Client().Get(srv.URL + "/hits")
@@ -134,6 +135,26 @@ func Test_keyStore_noCache(t *testing.T) {
 	assert.True(t, hits.Hits > 1, fmt.Sprintf("invalid number of hits: %d is not greater than 1", hits.Hits))
 }
 
+func Test_keyStore_canceled(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	ks, err := newKeyStore(srv.URL + "/no-cache")
+	assert.FatalError(t, err)
+	defer ks.Close()
+	ks.RLock()
+	keySet1 := ks.keySet
+	ks.RUnlock()
+
+	// The reload fails with a canceled context and the old keys are used.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Len(t, 1, ks.Get(ctx, keySet1.Keys[0].KeyID))
+	ks.RLock()
+	assert.Equals(t, keySet1, ks.keySet)
+	ks.RUnlock()
+}
+
 func Test_keyStore_Get(t *testing.T) {
 	srv := generateJWKServer(2)
 	defer srv.Close()
@@ -156,13 +177,35 @@ func Test_keyStore_Get(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if gotKeys := tt.ks.Get(tt.args.kid); !reflect.DeepEqual(gotKeys, tt.wantKeys) {
+			if gotKeys := tt.ks.Get(context.Background(), tt.args.kid); !reflect.DeepEqual(gotKeys, tt.wantKeys) {
 				t.Errorf("keyStore.Get() = %v, want %v", gotKeys, tt.wantKeys)
 			}
 		})
 	}
 }
 
+func Test_keyStore_Get_cache(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+	ks, err := newKeyStore(srv.URL)
+	assert.FatalError(t, err)
+	defer ks.Close()
+
+	kid := ks.keySet.Keys[0].KeyID
+	keys := ks.Get(context.Background(), kid)
+	assert.Equals(t, []jose.JSONWebKey{ks.keySet.Keys[0]}, keys)
+	assert.Equals(t, 1, ks.byKid.Len())
+	assert.Equals(t, keys, ks.Get(context.Background(), kid))
+
+	// Unknown keys are not cached
+	assert.Len(t, 0, ks.Get(context.Background(), "foo"))
+	assert.Equals(t, 1, ks.byKid.Len())
+
+	// Reloads purge the cache
+	ks.reload(context.Background())
+	assert.Equals(t, 0, ks.byKid.Len())
+}
+
 func Test_abs(t *testing.T) {
 	maxInt64 := time.Duration(1<<63 - 1)
 	minInt64 := time.Duration(-1 << 63)
@@ -0,0 +1,45 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func Test_lruCache(t *testing.T) {
+	c := newLRUCache(2)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equals(t, 1, v)
+
+	// b is the least recently used
+	c.Add("c", 3)
+	assert.Equals(t, 2, c.Len())
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+	v, ok = c.Get("c")
+	assert.True(t, ok)
+	assert.Equals(t, 3, v)
+
+	// Updates do not evict
+	c.Add("a", 4)
+	assert.Equals(t, 2, c.Len())
+	v, ok = c.Get("a")
+	assert.True(t, ok)
+	assert.Equals(t, 4, v)
+
+	c.Purge()
+	assert.Equals(t, 0, c.Len())
+	_, ok = c.Get("a")
+	assert.False(t, ok)
+
+	// A nil cache does not store anything
+	var nilCache *lruCache
+	nilCache.Add("a", 1)
+	nilCache.Purge()
+	_, ok = nilCache.Get("a")
+	assert.False(t, ok)
+	assert.Equals(t, 0, nilCache.Len())
+}
@@ -50,16 +50,17 @@ type openIDPayload struct {
 //
 // ClientSecret is mandatory, but it can be an empty string.
 type OIDC struct {
-	Type                  string   `json:"type"`
-	Name                  string   `json:"name"`
-	ClientID              string   `json:"clientID"`
-	ClientSecret          string   `json:"clientSecret"`
-	ConfigurationEndpoint string   `json:"configurationEndpoint"`
-	Admins                []string `json:"admins,omitempty"`
-	Domains               []string `json:"domains,omitempty"`
-	Groups                []string `json:"groups,omitempty"`
-	ListenAddress         string   `json:"listenAddress,omitempty"`
-	Claims                *Claims  `json:"claims,omitempty"`
+	Type                  string             `json:"type"`
+	Name                  string             `json:"name"`
+	ClientID              string             `json:"clientID"`
+	ClientSecret          string             `json:"clientSecret"`
+	ConfigurationEndpoint string             `json:"configurationEndpoint"`
+	Admins                []string           `json:"admins,omitempty"`
+	Domains               []string           `json:"domains,omitempty"`
+	Groups                []string           `json:"groups,omitempty"`
+	ListenAddress         string             `json:"listenAddress,omitempty"`
+	Claims                *Claims            `json:"claims,omitempty"`
+	CodeSigning           *CodeSigningConfig `json:"codeSigning,omitempty"`
 	configuration         openIDConfiguration
 	keyStore              *keyStore
 	claimer               *Claimer
@@ -106,6 +107,10 @@ func (o *OIDC) GetTokenID(ott string) (string, error) {
 	if err = token.UnsafeClaimsWithoutVerification(&claims); err != nil {
 		return "", errors.Wrap(err, "error verifying claims")
 	}
+	// The tokens of CI systems used for code signing might not have a nonce.
+	if claims.Nonce == "" && o.CodeSigning != nil {
+		return claims.ID, nil
+	}
 	return claims.Nonce, nil
 }
 
@@ -149,6 +154,10 @@ func (o *OIDC) Init(config Config) (err error) {
 		return err
 	}
 
+	if err := o.CodeSigning.Validate(); err != nil {
+		return err
+	}
+
 	// Decode and validate openid-configuration endpoint
 	u, err := url.Parse(o.ConfigurationEndpoint)
 	if err != nil {
@@ -171,16 +180,23 @@ func (o *OIDC) Init(config Config) (err error) {
 	return nil
 }
 
+// CheckHealth returns the error of the last refresh of the keys of the
+// identity provider, or nil if it succeeded.
+func (o *OIDC) CheckHealth() error {
+	if o.keyStore == nil {
+		return errors.New("oidc provisioner is not initialized")
+	}
+	return o.keyStore.Err()
+}
+
 // ValidatePayload validates the given token payload.
 func (o *OIDC) ValidatePayload(p openIDPayload) error {
-	// According to "rfc7519 JSON Web Token" acceptable skew should be no more
-	// than a few minutes.
 	if err := p.ValidateWithLeeway(jose.Expected{
 		Issuer:   o.configuration.Issuer,
 		Audience: jose.Audience{o.ClientID},
 		Time:     time.Now().UTC(),
-	}, time.Minute); err != nil {
-		return errors.Wrap(err, "failed to validate payload")
+	}, o.claimer.ClockSkew()); err != nil {
+		return errors.Wrap(tokenError(err), "failed to validate payload")
 	}
 
 	// Validate azp if present
@@ -188,8 +204,9 @@ func (o *OIDC) ValidatePayload(p openIDPayload) error {
 		return errors.New("failed to validate payload: invalid azp")
 	}
 
-	// Enforce an email claim
-	if p.Email == "" {
+	// Enforce an email claim, the identity of the code-signing certificates
+	// can be the subject.
+	if p.Email == "" && (o.CodeSigning == nil || len(o.Domains) > 0) {
 		return errors.New("failed to validate payload: email not found")
 	}
 
@@ -229,7 +246,7 @@ func (o *OIDC) ValidatePayload(p openIDPayload) error {
 
 // authorizeToken applies the most common provisioner authorization claims,
 // leaving the rest to context specific methods.
-func (o *OIDC) authorizeToken(token string) (*openIDPayload, error) {
+func (o *OIDC) authorizeToken(ctx context.Context, token string) (*openIDPayload, error) {
 	jwt, err := jose.ParseSigned(token)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error parsing token")
@@ -243,7 +260,7 @@ func (o *OIDC) authorizeToken(token string) (*openIDPayload, error) {
 
 	found := false
 	kid := jwt.Headers[0].KeyID
-	keys := o.keyStore.Get(kid)
+	keys := o.keyStore.Get(ctx, kid)
 	for _, key := range keys {
 		if err := jwt.Claims(key, &claims); err == nil {
 			found = true
@@ -261,11 +278,23 @@ func (o *OIDC) authorizeToken(token string) (*openIDPayload, error) {
 	return &claims, nil
 }
 
+// AuthorizeSSO validates an ID token used to authenticate admin requests with
+// single sign-on and returns the email and groups of the user. Unlike the
+// tokens used to sign certificates, an ID token can be used multiple times
+// until it expires.
+func (o *OIDC) AuthorizeSSO(token string) (string, []string, error) {
+	claims, err := o.authorizeToken(context.Background(), token)
+	if err != nil {
+		return "", nil, err
+	}
+	return claims.Email, claims.Groups, nil
+}
+
 // AuthorizeRevoke returns an error if the provisioner does not have rights to
 // revoke the certificate with serial number in the `sub` property.
 // Only tokens generated by an admin have the right to revoke a certificate.
 func (o *OIDC) AuthorizeRevoke(token string) error {
-	claims, err := o.authorizeToken(token)
+	claims, err := o.authorizeToken(context.Background(), token)
 	if err != nil {
 		return err
 	}
@@ -279,7 +308,7 @@ func (o *OIDC) AuthorizeRevoke(token string) error {
 
 // AuthorizeSign validates the given token.
 func (o *OIDC) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
-	claims, err := o.authorizeToken(token)
+	claims, err := o.authorizeToken(ctx, token)
 	if err != nil {
 		return nil, err
 	}
@@ -292,13 +321,27 @@ func (o *OIDC) AuthorizeSign(ctx context.Context, token string) ([]SignOption, e
 		return o.authorizeSSHSign(claims)
 	}
 
+	// Keyless code signing, the identity comes from the token.
+	if o.CodeSigning != nil {
+		return []SignOption{
+			newProvisionerExtensionOption(TypeOIDC, o.Name, o.ClientID),
+			codeSigningIdentityModifier{
+				Issuer:  claims.Issuer,
+				Subject: claims.Subject,
+				Email:   claims.Email,
+			},
+			codeSigningDuration(o.CodeSigning.Duration.Duration),
+			defaultPublicKeyValidator{},
+		}, nil
+	}
+
 	so := []SignOption{
 		// modifiers / withOptions
 		newProvisionerExtensionOption(TypeOIDC, o.Name, o.ClientID),
 		profileDefaultDuration(o.claimer.DefaultTLSCertDuration()),
 		// validators
 		defaultPublicKeyValidator{},
-		newValidityValidator(o.claimer.MinTLSCertDuration(), o.claimer.MaxTLSCertDuration()),
+		newValidityValidator(o.claimer.MinTLSCertDuration(), o.claimer.MaxTLSCertDuration(), o.claimer.ClockSkew()),
 	}
 	// Admins should be able to authorize any SAN
 	if o.IsAdmin(claims.Email) {
@@ -308,14 +351,36 @@ func (o *OIDC) AuthorizeSign(ctx context.Context, token string) ([]SignOption, e
 	return append(so, emailOnlyIdentity(claims.Email)), nil
 }
 
-// AuthorizeRenewal returns an error if the renewal is disabled.
+// AuthorizeRenewal returns an error if the renewal is disabled. The
+// code-signing certificates cannot be renewed.
 func (o *OIDC) AuthorizeRenewal(cert *x509.Certificate) error {
+	if o.CodeSigning != nil {
+		return errors.Errorf("renew is disabled for code-signing provisioner %s", o.GetID())
+	}
 	if o.claimer.IsDisableRenewal() {
 		return errors.Errorf("renew is disabled for provisioner %s", o.GetID())
 	}
 	return nil
 }
 
+// AuthorizeExpiredRenewal returns an error if the certificate expired before
+// the renewal grace period of the provisioner.
+func (o *OIDC) AuthorizeExpiredRenewal(cert *x509.Certificate) error {
+	return o.claimer.authorizeExpiredRenewal(cert)
+}
+
+// RenewalWindow returns how long before their expiration the certificates of
+// the provisioner should be renewed.
+func (o *OIDC) RenewalWindow() time.Duration {
+	return o.claimer.RenewalWindow()
+}
+
+// IsRenewalKeyPinned returns if the renewals of the certificates of the
+// provisioner must keep the key of the certificate.
+func (o *OIDC) IsRenewalKeyPinned() bool {
+	return o.claimer.IsRenewalKeyPinned()
+}
+
 // authorizeSSHSign returns the list of SignOption for a SignSSH request.
 func (o *OIDC) authorizeSSHSign(claims *openIDPayload) ([]SignOption, error) {
 	signOptions := []SignOption{
@@ -352,7 +417,7 @@ func (o *OIDC) authorizeSSHSign(claims *openIDPayload) ([]SignOption, error) {
 		// Validate the validity period.
 		&sshCertificateValidityValidator{o.claimer},
 		// Require all the fields in the SSH certificate
-		&sshCertificateDefaultValidator{},
+		&sshCertificateDefaultValidator{o.claimer.ClockSkew()},
 	), nil
 }
 
@@ -223,7 +223,7 @@ func TestOIDC_authorizeToken(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := tt.prov.authorizeToken(tt.args.token)
+			got, err := tt.prov.authorizeToken(context.Background(), tt.args.token)
 			if (err != nil) != tt.wantErr {
 				fmt.Println(tt)
 				t.Errorf("OIDC.Authorize() error = %v, wantErr %v", err, tt.wantErr)
@@ -540,6 +540,28 @@ func TestOIDC_AuthorizeRenewal(t *testing.T) {
 	}
 }
 
+func TestOIDC_CheckHealth(t *testing.T) {
+	srv := generateJWKServer(2)
+	defer srv.Close()
+
+	ks, err := newKeyStore(srv.URL)
+	assert.FatalError(t, err)
+	defer ks.Close()
+	p := &OIDC{keyStore: ks}
+	assert.NoError(t, p.CheckHealth())
+
+	// The keys cannot be refreshed.
+	ks.uri = srv.URL + "/error"
+	ks.reload(context.Background())
+	assert.Error(t, p.CheckHealth())
+
+	ks.uri = srv.URL
+	ks.reload(context.Background())
+	assert.NoError(t, p.CheckHealth())
+
+	assert.Error(t, (&OIDC{}).CheckHealth())
+}
+
 func Test_sanitizeEmail(t *testing.T) {
 	tests := []struct {
 		name  string
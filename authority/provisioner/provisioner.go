@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -24,36 +25,81 @@ type Interface interface {
 	AuthorizeRevoke(token string) error
 }
 
+// HealthChecker is the interface implemented by the provisioners that depend
+// on an external service, like an identity provider.
+type HealthChecker interface {
+	CheckHealth() error
+}
+
+// ExpiredRenewalAuthorizer is the interface implemented by the provisioners
+// that allow the renewal of expired certificates within a grace period.
+type ExpiredRenewalAuthorizer interface {
+	AuthorizeExpiredRenewal(cert *x509.Certificate) error
+}
+
+// RenewalWindower is the interface implemented by the provisioners that
+// configure how long before their expiration the certificates should be
+// renewed.
+type RenewalWindower interface {
+	RenewalWindow() time.Duration
+}
+
+// RenewalKeyPinner is the interface implemented by the provisioners that can
+// require the renewals to keep the key of the certificate. A different key
+// can only be used with a rekey.
+type RenewalKeyPinner interface {
+	IsRenewalKeyPinned() bool
+}
+
 // Audiences stores all supported audiences by request type.
 type Audiences struct {
 	Sign   []string
 	Revoke []string
+	Admin  []string
+	Renew  []string
 }
 
 // All returns all supported audiences across all request types in one list.
-func (a Audiences) All() []string {
-	return append(a.Sign, a.Revoke...)
+func (a Audiences) All() (auds []string) {
+	auds = append(auds, a.Sign...)
+	auds = append(auds, a.Revoke...)
+	return append(auds, a.Admin...)
 }
 
 // WithFragment returns a copy of audiences where the url audiences contains the
 // given fragment.
 func (a Audiences) WithFragment(fragment string) Audiences {
-	ret := Audiences{
-		Sign:   make([]string, len(a.Sign)),
-		Revoke: make([]string, len(a.Revoke)),
+	return Audiences{
+		Sign:   withFragment(a.Sign, fragment),
+		Revoke: withFragment(a.Revoke, fragment),
+		Admin:  withFragment(a.Admin, fragment),
+		Renew:  withFragment(a.Renew, fragment),
 	}
-	for i, s := range a.Sign {
-		if u, err := url.Parse(s); err == nil {
-			ret.Sign[i] = u.ResolveReference(&url.URL{Fragment: fragment}).String()
-		} else {
-			ret.Sign[i] = s
-		}
+}
+
+// Match returns for each request type if any of the given audiences matches
+// one of the supported audiences. The keys of the returned map are the
+// audience keys, e.g. SignAudienceKey.
+func (a Audiences) Match(audience []string) map[string]bool {
+	if fragment := extractFragment(audience); fragment != "" {
+		a = a.WithFragment(fragment)
+	}
+	return map[string]bool{
+		SignAudienceKey:   matchesAudience(audience, a.Sign),
+		RevokeAudienceKey: matchesAudience(audience, a.Revoke),
+		AdminAudienceKey:  matchesAudience(audience, a.Admin),
 	}
-	for i, s := range a.Revoke {
+}
+
+// withFragment returns a copy of the given audiences adding the fragment to
+// the url audiences.
+func withFragment(audiences []string, fragment string) []string {
+	ret := make([]string, len(audiences))
+	for i, s := range audiences {
 		if u, err := url.Parse(s); err == nil {
-			ret.Revoke[i] = u.ResolveReference(&url.URL{Fragment: fragment}).String()
+			ret[i] = u.ResolveReference(&url.URL{Fragment: fragment}).String()
 		} else {
-			ret.Revoke[i] = s
+			ret[i] = s
 		}
 	}
 	return ret
@@ -95,6 +141,8 @@ const (
 	RevokeAudienceKey = "revoke"
 	// SignAudienceKey is the key for the 'sign' audiences in the audiences map.
 	SignAudienceKey = "sign"
+	// AdminAudienceKey is the key for the 'admin' audiences in the audiences map.
+	AdminAudienceKey = "admin"
 )
 
 // String returns the string representation of the type.
@@ -117,7 +165,7 @@ func (t Type) String() string {
 	case TypeK8sSA:
 		return "K8sSA"
 	default:
-		return ""
+		return registeredTypeName(t)
 	}
 }
 
@@ -170,6 +218,10 @@ func (l *List) UnmarshalJSON(data []byte) error {
 		case "k8ssa":
 			p = &K8sSA{}
 		default:
+			if factory, ok := lookupFactory(typ.Type); ok {
+				p = factory()
+				break
+			}
 			// Skip unsupported provisioners. A client using this method may be
 			// compiled with a version of smallstep/certificates that does not
 			// support a specific provisioner type. If we don't skip unknown
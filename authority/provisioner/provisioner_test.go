@@ -1,6 +1,7 @@
 package provisioner
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -52,3 +53,32 @@ func TestSanitizeSSHUserPrincipal(t *testing.T) {
 		})
 	}
 }
+
+func TestAudiences_Match(t *testing.T) {
+	audiences := Audiences{
+		Sign:   []string{"https://ca.smallstep.com/sign", "https://ca.smallstep.com/1.0/sign"},
+		Revoke: []string{"https://ca.smallstep.com/revoke"},
+		Admin:  []string{"https://ca.smallstep.com/admin"},
+	}
+	tests := []struct {
+		name     string
+		audience []string
+		want     map[string]bool
+	}{
+		{"sign", []string{"https://ca.smallstep.com/1.0/sign"}, map[string]bool{"sign": true, "revoke": false, "admin": false}},
+		{"sign-port", []string{"https://ca.smallstep.com:9000/sign"}, map[string]bool{"sign": true, "revoke": false, "admin": false}},
+		{"sign-fragment", []string{"https://ca.smallstep.com/sign#gcp/name"}, map[string]bool{"sign": true, "revoke": false, "admin": false}},
+		{"revoke", []string{"https://ca.smallstep.com/revoke"}, map[string]bool{"sign": false, "revoke": true, "admin": false}},
+		{"admin", []string{"https://ca.smallstep.com/admin"}, map[string]bool{"sign": false, "revoke": false, "admin": true}},
+		{"multiple", []string{"https://ca.smallstep.com/sign", "https://ca.smallstep.com/admin"}, map[string]bool{"sign": true, "revoke": false, "admin": true}},
+		{"none", []string{"https://foo.smallstep.com/sign"}, map[string]bool{"sign": false, "revoke": false, "admin": false}},
+		{"empty", nil, map[string]bool{"sign": false, "revoke": false, "admin": false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := audiences.Match(tt.audience); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Audiences.Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
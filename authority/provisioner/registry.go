@@ -0,0 +1,187 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Factory returns a new and empty provisioner of a registered type. The
+// provisioner is then populated with the JSON of its configuration and
+// initialized by the authority with Init.
+type Factory func() Interface
+
+// builtinTypes are the names of the provisioner types implemented by this
+// package, they cannot be registered again.
+var builtinTypes = map[string]Type{
+	"jwk":   TypeJWK,
+	"oidc":  TypeOIDC,
+	"gcp":   TypeGCP,
+	"aws":   TypeAWS,
+	"azure": TypeAzure,
+	"acme":  TypeACME,
+	"x5c":   TypeX5C,
+	"k8ssa": TypeK8sSA,
+}
+
+type registration struct {
+	name    string
+	typ     Type
+	factory Factory
+}
+
+var registry = struct {
+	sync.RWMutex
+	byName map[string]registration
+	byType map[Type]registration
+}{
+	byName: make(map[string]registration),
+	byType: make(map[Type]registration),
+}
+
+// Register makes a custom provisioner type available to the configuration of
+// the authority and to the lists of provisioners returned by the CA. The name
+// is the case-insensitive value of the "type" attribute, and the Type returned
+// by the GetType method of the provisioners created by the factory must not be
+// used by another provisioner type. It is intended to be called from the init
+// function of the package implementing the provisioner, and it panics if the
+// name or the type are already registered.
+//
+// The certificates signed by custom provisioners can be renewed if the
+// credential id of the extension added with NewProvisionerExtensionOption is
+// the id of the provisioner.
+func Register(name string, factory Factory) {
+	if factory == nil {
+		panic("provisioner: Register factory is nil")
+	}
+	key := strings.ToLower(name)
+	if key == "" {
+		panic("provisioner: Register name is empty")
+	}
+	typ := factory().GetType()
+
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := builtinTypes[key]; ok {
+		panic("provisioner: Register called twice for type " + name)
+	}
+	if _, ok := registry.byName[key]; ok {
+		panic("provisioner: Register called twice for type " + name)
+	}
+	if _, ok := registry.byType[typ]; ok || typ <= TypeK8sSA {
+		panic("provisioner: Register type of " + name + " is already in use")
+	}
+	r := registration{name: name, typ: typ, factory: factory}
+	registry.byName[key] = r
+	registry.byType[typ] = r
+}
+
+// TypeByName returns the provisioner type with the given case-insensitive
+// name, e.g. "jwk" or the name of a registered type.
+func TypeByName(name string) (Type, bool) {
+	key := strings.ToLower(name)
+	if typ, ok := builtinTypes[key]; ok {
+		return typ, true
+	}
+	registry.RLock()
+	defer registry.RUnlock()
+	r, ok := registry.byName[key]
+	return r.typ, ok
+}
+
+// lookupFactory returns the factory of the registered type with the given
+// case-insensitive name.
+func lookupFactory(name string) (Factory, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	r, ok := registry.byName[strings.ToLower(name)]
+	return r.factory, ok
+}
+
+// registeredTypeName returns the name used to register the given type, or an
+// empty string if it is not registered.
+func registeredTypeName(typ Type) string {
+	registry.RLock()
+	defer registry.RUnlock()
+	return registry.byType[typ].name
+}
+
+// SignOptionFactory returns a new sign option configured with the given JSON
+// options, the "options" attribute of the configuration referencing it. It
+// might be called more than once for the same configuration, e.g. to validate
+// it, so it should not have side effects.
+type SignOptionFactory func(options json.RawMessage) (SignOption, error)
+
+type signOptionRegistration struct {
+	method  Method
+	factory SignOptionFactory
+}
+
+var signOptionRegistry = struct {
+	sync.RWMutex
+	byName map[string]signOptionRegistration
+}{
+	byName: make(map[string]signOptionRegistration),
+}
+
+// RegisterSignOption makes a custom sign option available to the configuration
+// of the authority with the given name. The method is SignMethod for the
+// options that modify or validate X.509 certificates, that must implement
+// ProfileModifier, CertificateValidator or CertificateRequestValidator, and
+// SignSSHMethod for the options that modify or validate SSH certificates, that
+// must implement SSHCertificateModifier, SSHCertificateOptionModifier,
+// SSHCertificateValidator or SSHCertificateOptionsValidator. It is intended to
+// be called from an init function, and it panics if the name is already
+// registered.
+func RegisterSignOption(name string, method Method, factory SignOptionFactory) {
+	if factory == nil {
+		panic("provisioner: RegisterSignOption factory is nil")
+	}
+	if name == "" {
+		panic("provisioner: RegisterSignOption name is empty")
+	}
+	if method != SignMethod && method != SignSSHMethod {
+		panic("provisioner: RegisterSignOption method of " + name + " is not supported")
+	}
+	signOptionRegistry.Lock()
+	defer signOptionRegistry.Unlock()
+	if _, ok := signOptionRegistry.byName[name]; ok {
+		panic("provisioner: RegisterSignOption called twice for " + name)
+	}
+	signOptionRegistry.byName[name] = signOptionRegistration{method: method, factory: factory}
+}
+
+// NewSignOption returns a new instance of the registered sign option with the
+// given name and the method of the requests it applies to.
+func NewSignOption(name string, options json.RawMessage) (SignOption, Method, error) {
+	signOptionRegistry.RLock()
+	r, ok := signOptionRegistry.byName[name]
+	signOptionRegistry.RUnlock()
+	if !ok {
+		return nil, 0, errors.Errorf("sign option %s is not registered", name)
+	}
+	o, err := r.factory(options)
+	if err != nil {
+		return nil, 0, errors.Wrapf(err, "error creating sign option %s", name)
+	}
+
+	var valid bool
+	switch r.method {
+	case SignMethod:
+		switch o.(type) {
+		case ProfileModifier, CertificateValidator, CertificateRequestValidator:
+			valid = true
+		}
+	case SignSSHMethod:
+		switch o.(type) {
+		case SSHCertificateModifier, SSHCertificateOptionModifier, SSHCertificateValidator, SSHCertificateOptionsValidator:
+			valid = true
+		}
+	}
+	if !valid {
+		return nil, 0, errors.Errorf("sign option %s of type %T is not supported", name, o)
+	}
+	return o, r.method, nil
+}
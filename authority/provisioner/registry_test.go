@@ -0,0 +1,145 @@
+package provisioner
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+const typeCustom Type = 100
+
+// customProvisioner is a provisioner type implemented outside this package.
+type customProvisioner struct {
+	noop
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+func (p *customProvisioner) GetName() string {
+	return p.Name
+}
+
+func (p *customProvisioner) GetType() Type {
+	return typeCustom
+}
+
+func init() {
+	Register("Custom", func() Interface {
+		return &customProvisioner{}
+	})
+}
+
+func TestRegister(t *testing.T) {
+	var l List
+	assert.FatalError(t, json.Unmarshal([]byte(`[
+		{"type": "jwk", "name": "max"},
+		{"type": "custom", "name": "foo"},
+		{"type": "unknown", "name": "bar"}
+	]`), &l))
+	if assert.Len(t, 2, l) {
+		assert.Equals(t, TypeJWK, l[0].GetType())
+		if p, ok := l[1].(*customProvisioner); assert.True(t, ok) {
+			assert.Equals(t, "foo", p.GetName())
+		}
+	}
+	assert.Equals(t, "Custom", typeCustom.String())
+
+	mustPanic := func(name string, factory Factory) {
+		defer func() {
+			assert.NotNil(t, recover())
+		}()
+		Register(name, factory)
+	}
+	mustPanic("custom", func() Interface { return &customProvisioner{} })
+	mustPanic("JWK", func() Interface { return &customProvisioner{} })
+	mustPanic("other", func() Interface { return &customProvisioner{} })
+	mustPanic("other", func() Interface { return &JWK{} })
+	mustPanic("", func() Interface { return &customProvisioner{} })
+	mustPanic("other", nil)
+}
+
+func TestTypeByName(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   Type
+		wantOk bool
+	}{
+		{"jwk", TypeJWK, true},
+		{"K8sSA", TypeK8sSA, true},
+		{"custom", typeCustom, true},
+		{"CUSTOM", typeCustom, true},
+		{"unknown", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := TypeByName(tt.name)
+			assert.Equals(t, tt.want, got)
+			assert.Equals(t, tt.wantOk, ok)
+		})
+	}
+}
+
+// customValidator rejects the certificates with the given common name.
+type customValidator struct {
+	CommonName string `json:"commonName"`
+}
+
+func (v *customValidator) Valid(crt *x509.Certificate) error {
+	if crt.Subject.CommonName == v.CommonName {
+		return errors.Errorf("common name %s is not allowed", v.CommonName)
+	}
+	return nil
+}
+
+func init() {
+	RegisterSignOption("customValidator", SignMethod, func(options json.RawMessage) (SignOption, error) {
+		v := new(customValidator)
+		if err := json.Unmarshal(options, v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	})
+	RegisterSignOption("customSSH", SignSSHMethod, func(options json.RawMessage) (SignOption, error) {
+		return &customValidator{}, nil
+	})
+}
+
+func TestNewSignOption(t *testing.T) {
+	tests := []struct {
+		name       string
+		options    string
+		want       SignOption
+		wantMethod Method
+		wantErr    bool
+	}{
+		{"customValidator", `{"commonName": "foo"}`, &customValidator{CommonName: "foo"}, SignMethod, false},
+		{"customValidator", `{"commonName": 1}`, nil, 0, true},
+		{"customSSH", ``, nil, 0, true},
+		{"unknown", ``, nil, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, method, err := NewSignOption(tt.name, json.RawMessage(tt.options))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewSignOption() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equals(t, tt.want, got)
+			assert.Equals(t, tt.wantMethod, method)
+		})
+	}
+
+	mustPanic := func(name string, method Method, factory SignOptionFactory) {
+		defer func() {
+			assert.NotNil(t, recover())
+		}()
+		RegisterSignOption(name, method, factory)
+	}
+	factory := func(json.RawMessage) (SignOption, error) { return &customValidator{}, nil }
+	mustPanic("customValidator", SignMethod, factory)
+	mustPanic("", SignMethod, factory)
+	mustPanic("other", RevokeMethod, factory)
+	mustPanic("other", SignMethod, nil)
+}
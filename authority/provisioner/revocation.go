@@ -0,0 +1,292 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	// defaultRevocationTimeout is the default time to wait for a CRL or an
+	// OCSP response.
+	defaultRevocationTimeout = 10 * time.Second
+	// defaultRevocationCacheDuration is the time a CRL or an OCSP response
+	// without a next update is cached.
+	defaultRevocationCacheDuration = time.Hour
+	// maxRevocationResponseSize is the maximum size of a CRL or an OCSP
+	// response.
+	maxRevocationResponseSize = 10 << 20
+	// maxCachedOCSPResponses is the number of OCSP responses cached before
+	// the expired ones are removed.
+	maxCachedOCSPResponses = 1024
+)
+
+// RevocationCheck configures the revocation checks of the certificates
+// presented to a provisioner. The CRLs are only used to check the
+// certificates of their issuer, and the responses are cached until their next
+// update.
+type RevocationCheck struct {
+	// CRLs are the URLs of the CRLs to check.
+	CRLs []string `json:"crls,omitempty"`
+	// UseCRLDistributionPoints also checks the CRLs of the distribution points
+	// of the certificates.
+	UseCRLDistributionPoints bool `json:"useCRLDistributionPoints,omitempty"`
+	// OCSP checks the certificates with the OCSP responders of their authority
+	// information access extension.
+	OCSP bool `json:"ocsp,omitempty"`
+	// OCSPResponder is the URL of the OCSP responder used instead of the
+	// ones of the certificates.
+	OCSPResponder string `json:"ocspResponder,omitempty"`
+	// SoftFail accepts the certificates if their status cannot be determined,
+	// e.g. if a CRL or an OCSP responder cannot be reached, or if no CRL or
+	// OCSP response covers them. By default they are rejected.
+	SoftFail bool `json:"softFail,omitempty"`
+	// Timeout is the time to wait for a CRL or an OCSP response, 10s by
+	// default.
+	Timeout *Duration `json:"timeout,omitempty"`
+}
+
+// Validate validates the revocation checks.
+func (c *RevocationCheck) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case len(c.CRLs) == 0 && !c.UseCRLDistributionPoints && !c.OCSP:
+		return errors.New("revocation requires crls, useCRLDistributionPoints or ocsp")
+	case c.OCSPResponder != "" && !c.OCSP:
+		return errors.New("revocation.ocspResponder requires ocsp")
+	case c.Timeout != nil && c.Timeout.Duration <= 0:
+		return errors.New("revocation.timeout must be greater than 0")
+	default:
+		return nil
+	}
+}
+
+// revocationChecker checks the revocation status of the certificate chains.
+type revocationChecker struct {
+	config *RevocationCheck
+	client *http.Client
+	mu     sync.Mutex
+	crls   map[string]*cachedCRL
+	ocsp   map[string]*cachedOCSP
+}
+
+type cachedCRL struct {
+	crl       *pkix.CertificateList
+	expiresAt time.Time
+}
+
+type cachedOCSP struct {
+	resp      *ocsp.Response
+	expiresAt time.Time
+}
+
+// newRevocationChecker returns the checker of the given configuration, or nil
+// if it is not configured.
+func newRevocationChecker(config *RevocationCheck) *revocationChecker {
+	if config == nil {
+		return nil
+	}
+	timeout := defaultRevocationTimeout
+	if config.Timeout != nil {
+		timeout = config.Timeout.Duration
+	}
+	return &revocationChecker{
+		config: config,
+		client: &http.Client{Timeout: timeout},
+		crls:   make(map[string]*cachedCRL),
+		ocsp:   make(map[string]*cachedOCSP),
+	}
+}
+
+// check returns an error if a certificate of the chain, but the root, is
+// revoked, or if its status cannot be determined and the checks do not
+// soft fail.
+func (c *revocationChecker) check(ctx context.Context, chain []*x509.Certificate) error {
+	if c == nil {
+		return nil
+	}
+	for i := 0; i < len(chain)-1; i++ {
+		crt, issuer := chain[i], chain[i+1]
+		revoked, err := c.checkCertificate(ctx, crt, issuer)
+		switch {
+		case revoked:
+			return NewError(ErrCodeCertificateRevoked, errors.Errorf("certificate %s has been revoked", crt.SerialNumber)).
+				WithDetail("serial", crt.SerialNumber.String())
+		case err != nil && !c.config.SoftFail:
+			return errors.Wrapf(err, "error checking the revocation of certificate %s", crt.SerialNumber)
+		}
+	}
+	return nil
+}
+
+// checkCertificate returns true if the certificate is revoked in any of the
+// CRLs or OCSP responses. It returns an error if a source could not be
+// checked, or if no CRL of its issuer or OCSP response covers it.
+func (c *revocationChecker) checkCertificate(ctx context.Context, crt, issuer *x509.Certificate) (bool, error) {
+	var covered bool
+	var firstErr error
+	fail := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	urls := c.config.CRLs
+	if c.config.UseCRLDistributionPoints {
+		urls = append(append([]string{}, urls...), crt.CRLDistributionPoints...)
+	}
+	for _, u := range urls {
+		crl, err := c.getCRL(ctx, u)
+		if err != nil {
+			fail(err)
+			continue
+		}
+		// The configured CRLs can be of other issuers.
+		if issuer.CheckCRLSignature(crl) != nil {
+			continue
+		}
+		covered = true
+		for _, rc := range crl.TBSCertList.RevokedCertificates {
+			if rc.SerialNumber.Cmp(crt.SerialNumber) == 0 {
+				return true, nil
+			}
+		}
+	}
+
+	if c.config.OCSP {
+		responders := crt.OCSPServer
+		if c.config.OCSPResponder != "" {
+			responders = []string{c.config.OCSPResponder}
+		}
+		for _, u := range responders {
+			resp, err := c.getOCSP(ctx, u, crt, issuer)
+			if err != nil {
+				fail(err)
+				continue
+			}
+			switch resp.Status {
+			case ocsp.Revoked:
+				return true, nil
+			case ocsp.Good:
+				// The other responders do not need to be checked.
+				return false, firstErr
+			default:
+				fail(errors.Errorf("ocsp responder %s does not know the certificate", u))
+			}
+		}
+	}
+	if !covered && firstErr == nil {
+		firstErr = errors.New("no crl or ocsp responder covers the certificate")
+	}
+	return false, firstErr
+}
+
+// getCRL returns the CRL in the given URL, it is cached until its next update.
+func (c *revocationChecker) getCRL(ctx context.Context, u string) (*pkix.CertificateList, error) {
+	t := now()
+	c.mu.Lock()
+	cached, ok := c.crls[u]
+	c.mu.Unlock()
+	if ok && t.Before(cached.expiresAt) {
+		return cached.crl, nil
+	}
+
+	b, err := c.do(ctx, "GET", u, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	crl, err := x509.ParseCRL(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing crl %s", u)
+	}
+	if crl.HasExpired(t) {
+		return nil, errors.Errorf("crl %s has expired", u)
+	}
+	expiresAt := crl.TBSCertList.NextUpdate
+	if expiresAt.IsZero() {
+		expiresAt = t.Add(defaultRevocationCacheDuration)
+	}
+	c.mu.Lock()
+	c.crls[u] = &cachedCRL{crl: crl, expiresAt: expiresAt}
+	c.mu.Unlock()
+	return crl, nil
+}
+
+// getOCSP returns the OCSP response of the given responder for the
+// certificate, it is cached until its next update.
+func (c *revocationChecker) getOCSP(ctx context.Context, u string, crt, issuer *x509.Certificate) (*ocsp.Response, error) {
+	t := now()
+	key := u + "/" + string(issuer.RawSubjectPublicKeyInfo) + "/" + crt.SerialNumber.String()
+	c.mu.Lock()
+	cached, ok := c.ocsp[key]
+	c.mu.Unlock()
+	if ok && t.Before(cached.expiresAt) {
+		return cached.resp, nil
+	}
+
+	req, err := ocsp.CreateRequest(crt, issuer, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating ocsp request")
+	}
+	b, err := c.do(ctx, "POST", u, "application/ocsp-request", req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := ocsp.ParseResponseForCert(b, crt, issuer)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing ocsp response of %s", u)
+	}
+	if !resp.NextUpdate.IsZero() && t.After(resp.NextUpdate) {
+		return nil, errors.Errorf("ocsp response of %s has expired", u)
+	}
+	expiresAt := resp.NextUpdate
+	if expiresAt.IsZero() {
+		expiresAt = t.Add(defaultRevocationCacheDuration)
+	}
+	c.mu.Lock()
+	// The responses are cached by leaf, remove the expired ones.
+	if len(c.ocsp) >= maxCachedOCSPResponses {
+		for k, v := range c.ocsp {
+			if !t.Before(v.expiresAt) {
+				delete(c.ocsp, k)
+			}
+		}
+	}
+	c.ocsp[key] = &cachedOCSP{resp: resp, expiresAt: expiresAt}
+	c.mu.Unlock()
+	return resp, nil
+}
+
+// do sends a request and returns the body of the response.
+func (c *revocationChecker) do(ctx context.Context, method, u, contentType string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error creating request to %s", u)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error requesting %s", u)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("error requesting %s: status code %d", u, resp.StatusCode)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxRevocationResponseSize))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", u)
+	}
+	return b, nil
+}
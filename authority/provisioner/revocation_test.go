@@ -0,0 +1,254 @@
+package provisioner
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"golang.org/x/crypto/ocsp"
+)
+
+type revocationTestCA struct {
+	root, intermediate, leaf          *x509.Certificate
+	rootKey, intermediateKey, leafKey crypto.Signer
+}
+
+func newRevocationTestCA(t *testing.T, crlURL, ocspURL string) *revocationTestCA {
+	now := time.Now()
+	create := func(cn string, serial int64, isCA bool, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, crypto.Signer) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.FatalError(t, err)
+		tmpl := &x509.Certificate{
+			SerialNumber:          big.NewInt(serial),
+			Subject:               pkix.Name{CommonName: cn},
+			NotBefore:             now.Add(-time.Minute),
+			NotAfter:              now.Add(time.Hour),
+			KeyUsage:              x509.KeyUsageDigitalSignature,
+			BasicConstraintsValid: true,
+			IsCA:                  isCA,
+		}
+		if isCA {
+			tmpl.KeyUsage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		}
+		if crlURL != "" {
+			tmpl.CRLDistributionPoints = []string{crlURL}
+		}
+		if ocspURL != "" {
+			tmpl.OCSPServer = []string{ocspURL}
+		}
+		if parent == nil {
+			parent, parentKey = tmpl, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+		assert.FatalError(t, err)
+		crt, err := x509.ParseCertificate(der)
+		assert.FatalError(t, err)
+		return crt, key
+	}
+	ca := new(revocationTestCA)
+	ca.root, ca.rootKey = create("Root CA", 1, true, nil, nil)
+	ca.intermediate, ca.intermediateKey = create("Intermediate CA", 2, true, ca.root, ca.rootKey)
+	ca.leaf, ca.leafKey = create("leaf", 3, false, ca.intermediate, ca.intermediateKey)
+	return ca
+}
+
+func (ca *revocationTestCA) chain() []*x509.Certificate {
+	return []*x509.Certificate{ca.leaf, ca.intermediate, ca.root}
+}
+
+func (ca *revocationTestCA) crl(t *testing.T, issuer *x509.Certificate, key crypto.Signer, serials ...int64) []byte {
+	now := time.Now()
+	revoked := make([]pkix.RevokedCertificate, len(serials))
+	for i, sn := range serials {
+		revoked[i] = pkix.RevokedCertificate{SerialNumber: big.NewInt(sn), RevocationTime: now}
+	}
+	b, err := issuer.CreateCRL(rand.Reader, key, revoked, now, now.Add(time.Hour))
+	assert.FatalError(t, err)
+	return b
+}
+
+func TestRevocationCheck_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *RevocationCheck
+		err    error
+	}{
+		{"ok-nil", nil, nil},
+		{"ok-crls", &RevocationCheck{CRLs: []string{"https://ca.example.com/crl"}}, nil},
+		{"ok-distribution-points", &RevocationCheck{UseCRLDistributionPoints: true}, nil},
+		{"ok-ocsp", &RevocationCheck{OCSP: true, OCSPResponder: "https://ocsp.example.com", Timeout: &Duration{Duration: time.Second}}, nil},
+		{"fail-empty", &RevocationCheck{SoftFail: true}, errors.New("revocation requires crls, useCRLDistributionPoints or ocsp")},
+		{"fail-responder", &RevocationCheck{UseCRLDistributionPoints: true, OCSPResponder: "https://ocsp.example.com"}, errors.New("revocation.ocspResponder requires ocsp")},
+		{"fail-timeout", &RevocationCheck{OCSP: true, Timeout: &Duration{}}, errors.New("revocation.timeout must be greater than 0")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.err == nil {
+				assert.Nil(t, err)
+			} else if assert.NotNil(t, err) {
+				assert.Equals(t, tt.err.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func TestX5C_Init_revocation(t *testing.T) {
+	ca := newRevocationTestCA(t, "", "")
+	roots := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.root.Raw})
+	config := Config{Claims: globalProvisionerClaims, Audiences: testAudiences}
+
+	p := &X5C{Type: "X5C", Name: "x5c", Roots: roots}
+	assert.FatalError(t, p.Init(config))
+	assert.Nil(t, p.revocation)
+
+	p = &X5C{Type: "X5C", Name: "x5c", Roots: roots, Revocation: &RevocationCheck{OCSP: true}}
+	assert.FatalError(t, p.Init(config))
+	assert.NotNil(t, p.revocation)
+
+	p = &X5C{Type: "X5C", Name: "x5c", Roots: roots, Revocation: &RevocationCheck{}}
+	err := p.Init(config)
+	if assert.NotNil(t, err) {
+		assert.Equals(t, "error validating provisioner x5c: revocation requires crls, useCRLDistributionPoints or ocsp", err.Error())
+	}
+}
+
+func Test_revocationChecker_crl(t *testing.T) {
+	var hits int32
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if body == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(body)
+	}))
+	defer srv.Close()
+	ca := newRevocationTestCA(t, srv.URL+"/crl", "")
+
+	// Without CRL the status is unknown.
+	c := newRevocationChecker(&RevocationCheck{UseCRLDistributionPoints: true})
+	assert.Error(t, c.check(context.Background(), ca.chain()))
+	c = newRevocationChecker(&RevocationCheck{UseCRLDistributionPoints: true, SoftFail: true})
+	assert.NoError(t, c.check(context.Background(), ca.chain()))
+
+	// The CRLs of other issuers are skipped, the leaf is not covered by any
+	// CRL.
+	body = ca.crl(t, ca.root, ca.rootKey, 3)
+	c = newRevocationChecker(&RevocationCheck{CRLs: []string{srv.URL + "/crl"}})
+	err := c.check(context.Background(), ca.chain())
+	if assert.NotNil(t, err) {
+		assert.Equals(t, "error checking the revocation of certificate 3: no crl or ocsp responder covers the certificate", err.Error())
+	}
+	c = newRevocationChecker(&RevocationCheck{CRLs: []string{srv.URL + "/crl"}, SoftFail: true})
+	assert.NoError(t, c.check(context.Background(), ca.chain()))
+
+	// The CRL of the issuer of each certificate is used.
+	body = ca.crl(t, ca.intermediate, ca.intermediateKey)
+	c = newRevocationChecker(&RevocationCheck{CRLs: []string{srv.URL + "/crl"}})
+	err = c.check(context.Background(), []*x509.Certificate{ca.leaf, ca.intermediate})
+	assert.NoError(t, err)
+
+	// The revoked leaf is rejected, the CRL is cached.
+	body = ca.crl(t, ca.intermediate, ca.intermediateKey, 3)
+	c = newRevocationChecker(&RevocationCheck{CRLs: []string{srv.URL + "/crl"}})
+	atomic.StoreInt32(&hits, 0)
+	for i := 0; i < 2; i++ {
+		err := c.check(context.Background(), ca.chain())
+		if assert.NotNil(t, err) {
+			assert.Equals(t, ErrCodeCertificateRevoked, err.(*Error).Code)
+			assert.Equals(t, "certificate 3 has been revoked", err.Error())
+		}
+	}
+	assert.Equals(t, int32(1), atomic.LoadInt32(&hits))
+
+	// The revoked intermediate is rejected, even if the status of the leaf
+	// is unknown.
+	body = ca.crl(t, ca.root, ca.rootKey, 2)
+	c = newRevocationChecker(&RevocationCheck{UseCRLDistributionPoints: true, SoftFail: true})
+	err = c.check(context.Background(), ca.chain())
+	if assert.NotNil(t, err) {
+		assert.Equals(t, "certificate 2 has been revoked", err.Error())
+	}
+
+	// Not configured.
+	c = newRevocationChecker(nil)
+	assert.NoError(t, c.check(context.Background(), ca.chain()))
+}
+
+func Test_revocationChecker_ocsp(t *testing.T) {
+	var hits int32
+	status := ocsp.Good
+	var ca *revocationTestCA
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		b, err := ioutil.ReadAll(r.Body)
+		assert.FatalError(t, err)
+		req, err := ocsp.ParseRequest(b)
+		assert.FatalError(t, err)
+		issuer, key := ca.intermediate, ca.intermediateKey
+		if req.SerialNumber.Cmp(ca.intermediate.SerialNumber) == 0 {
+			issuer, key = ca.root, ca.rootKey
+		}
+		now := time.Now()
+		resp, err := ocsp.CreateResponse(issuer, issuer, ocsp.Response{
+			Status:       status,
+			SerialNumber: req.SerialNumber,
+			ThisUpdate:   now,
+			NextUpdate:   now.Add(time.Hour),
+			RevokedAt:    now,
+		}, key)
+		assert.FatalError(t, err)
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(resp)
+	}))
+	defer srv.Close()
+	ca = newRevocationTestCA(t, "", srv.URL)
+
+	// The good responses are cached.
+	c := newRevocationChecker(&RevocationCheck{OCSP: true})
+	assert.NoError(t, c.check(context.Background(), ca.chain()))
+	assert.NoError(t, c.check(context.Background(), ca.chain()))
+	assert.Equals(t, int32(2), atomic.LoadInt32(&hits))
+
+	status = ocsp.Revoked
+	c = newRevocationChecker(&RevocationCheck{OCSP: true})
+	err := c.check(context.Background(), ca.chain())
+	if assert.NotNil(t, err) {
+		assert.Equals(t, ErrCodeCertificateRevoked, err.(*Error).Code)
+	}
+
+	// Unknown certificates and unreachable responders.
+	status = ocsp.Unknown
+	c = newRevocationChecker(&RevocationCheck{OCSP: true})
+	assert.Error(t, c.check(context.Background(), ca.chain()))
+	c = newRevocationChecker(&RevocationCheck{OCSP: true, OCSPResponder: "http://127.0.0.1:1"})
+	assert.Error(t, c.check(context.Background(), ca.chain()))
+	c = newRevocationChecker(&RevocationCheck{OCSP: true, OCSPResponder: "http://127.0.0.1:1", SoftFail: true})
+	assert.NoError(t, c.check(context.Background(), ca.chain()))
+
+	// Certificates without OCSP responders.
+	noOCSP := newRevocationTestCA(t, "", "")
+	c = newRevocationChecker(&RevocationCheck{OCSP: true})
+	err = c.check(context.Background(), noOCSP.chain())
+	if assert.NotNil(t, err) {
+		assert.Equals(t, "error checking the revocation of certificate 3: no crl or ocsp responder covers the certificate", err.Error())
+	}
+	c = newRevocationChecker(&RevocationCheck{OCSP: true, SoftFail: true})
+	assert.NoError(t, c.check(context.Background(), noOCSP.chain()))
+}
@@ -7,7 +7,9 @@ import (
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"net"
+	"net/url"
 	"reflect"
+	"strings"
 	"time"
 
 	"github.com/RTradeLtd/ca-cli/crypto/x509util"
@@ -60,19 +62,20 @@ type emailOnlyIdentity string
 func (e emailOnlyIdentity) Valid(req *x509.CertificateRequest) error {
 	switch {
 	case len(req.DNSNames) > 0:
-		return errors.New("certificate request cannot contain DNS names")
+		return NewError(ErrCodePolicySANDenied, errors.New("certificate request cannot contain DNS names"))
 	case len(req.IPAddresses) > 0:
-		return errors.New("certificate request cannot contain IP addresses")
+		return NewError(ErrCodePolicySANDenied, errors.New("certificate request cannot contain IP addresses"))
 	case len(req.URIs) > 0:
-		return errors.New("certificate request cannot contain URIs")
+		return NewError(ErrCodePolicySANDenied, errors.New("certificate request cannot contain URIs"))
 	case len(req.EmailAddresses) == 0:
-		return errors.New("certificate request does not contain any email address")
+		return NewError(ErrCodePolicySANDenied, errors.New("certificate request does not contain any email address"))
 	case len(req.EmailAddresses) > 1:
-		return errors.New("certificate request contains too many email addresses")
+		return NewError(ErrCodePolicySANDenied, errors.New("certificate request contains too many email addresses"))
 	case req.EmailAddresses[0] == "":
-		return errors.New("certificate request cannot contain an empty email address")
+		return NewError(ErrCodePolicySANDenied, errors.New("certificate request cannot contain an empty email address"))
 	case req.EmailAddresses[0] != string(e):
-		return errors.Errorf("certificate request does not contain the valid email address, got %s, want %s", req.EmailAddresses[0], e)
+		return NewError(ErrCodePolicySANDenied, errors.Errorf("certificate request does not contain the valid email address, got %s, want %s", req.EmailAddresses[0], e)).
+			WithDetail("got", req.EmailAddresses).WithDetail("want", []string{string(e)})
 	default:
 		return nil
 	}
@@ -86,11 +89,11 @@ func (v defaultPublicKeyValidator) Valid(req *x509.CertificateRequest) error {
 	switch k := req.PublicKey.(type) {
 	case *rsa.PublicKey:
 		if k.Size() < 256 {
-			return errors.New("rsa key in CSR must be at least 2048 bits (256 bytes)")
+			return NewError(ErrCodePolicyKeyDenied, errors.New("rsa key in CSR must be at least 2048 bits (256 bytes)"))
 		}
 	case *ecdsa.PublicKey, ed25519.PublicKey:
 	default:
-		return errors.Errorf("unrecognized public key of type '%T' in CSR", k)
+		return NewError(ErrCodePolicyKeyDenied, errors.Errorf("unrecognized public key of type '%T' in CSR", k))
 	}
 	return nil
 }
@@ -101,10 +104,11 @@ type commonNameValidator string
 // Valid checks that certificate request common name matches the one configured.
 func (v commonNameValidator) Valid(req *x509.CertificateRequest) error {
 	if req.Subject.CommonName == "" {
-		return errors.New("certificate request cannot contain an empty common name")
+		return NewError(ErrCodePolicyCommonNameDenied, errors.New("certificate request cannot contain an empty common name"))
 	}
 	if req.Subject.CommonName != string(v) {
-		return errors.Errorf("certificate request does not contain the valid common name, got %s, want %s", req.Subject.CommonName, v)
+		return NewError(ErrCodePolicyCommonNameDenied, errors.Errorf("certificate request does not contain the valid common name, got %s, want %s", req.Subject.CommonName, v)).
+			WithDetail("got", req.Subject.CommonName).WithDetail("want", []string{string(v)})
 	}
 	return nil
 }
@@ -114,14 +118,15 @@ type commonNameSliceValidator []string
 
 func (v commonNameSliceValidator) Valid(req *x509.CertificateRequest) error {
 	if req.Subject.CommonName == "" {
-		return errors.New("certificate request cannot contain an empty common name")
+		return NewError(ErrCodePolicyCommonNameDenied, errors.New("certificate request cannot contain an empty common name"))
 	}
 	for _, cn := range v {
 		if req.Subject.CommonName == cn {
 			return nil
 		}
 	}
-	return errors.Errorf("certificate request does not contain the valid common name, got %s, want %s", req.Subject.CommonName, v)
+	return NewError(ErrCodePolicyCommonNameDenied, errors.Errorf("certificate request does not contain the valid common name, got %s, want %s", req.Subject.CommonName, v)).
+		WithDetail("got", req.Subject.CommonName).WithDetail("want", []string(v))
 }
 
 // dnsNamesValidator validates the DNS names SAN of a certificate request.
@@ -139,7 +144,8 @@ func (v dnsNamesValidator) Valid(req *x509.CertificateRequest) error {
 		got[s] = true
 	}
 	if !reflect.DeepEqual(want, got) {
-		return errors.Errorf("certificate request does not contain the valid DNS names - got %v, want %v", req.DNSNames, v)
+		return NewError(ErrCodePolicySANDenied, errors.Errorf("certificate request does not contain the valid DNS names - got %v, want %v", req.DNSNames, v)).
+			WithDetail("got", req.DNSNames).WithDetail("want", []string(v))
 	}
 	return nil
 }
@@ -159,7 +165,8 @@ func (v ipAddressesValidator) Valid(req *x509.CertificateRequest) error {
 		got[ip.String()] = true
 	}
 	if !reflect.DeepEqual(want, got) {
-		return errors.Errorf("IP Addresses claim failed - got %v, want %v", req.IPAddresses, v)
+		return NewError(ErrCodePolicySANDenied, errors.Errorf("IP Addresses claim failed - got %v, want %v", req.IPAddresses, v)).
+			WithDetail("got", req.IPAddresses).WithDetail("want", []net.IP(v))
 	}
 	return nil
 }
@@ -179,11 +186,51 @@ func (v emailAddressesValidator) Valid(req *x509.CertificateRequest) error {
 		got[s] = true
 	}
 	if !reflect.DeepEqual(want, got) {
-		return errors.Errorf("certificate request does not contain the valid Email Addresses - got %v, want %v", req.EmailAddresses, v)
+		return NewError(ErrCodePolicySANDenied, errors.Errorf("certificate request does not contain the valid Email Addresses - got %v, want %v", req.EmailAddresses, v)).
+			WithDetail("got", req.EmailAddresses).WithDetail("want", []string(v))
 	}
 	return nil
 }
 
+// urisValidator validates the URI SANs of a certificate request.
+type urisValidator []*url.URL
+
+// Valid checks that certificate request URIs match those configured in the
+// bootstrap (token) flow.
+func (v urisValidator) Valid(req *x509.CertificateRequest) error {
+	want := make(map[string]bool)
+	for _, u := range v {
+		want[u.String()] = true
+	}
+	got := make(map[string]bool)
+	for _, u := range req.URIs {
+		got[u.String()] = true
+	}
+	if !reflect.DeepEqual(want, got) {
+		return NewError(ErrCodePolicySANDenied, errors.Errorf("certificate request does not contain the valid URIs - got %v, want %v", req.URIs, v)).
+			WithDetail("got", req.URIs).WithDetail("want", []*url.URL(v))
+	}
+	return nil
+}
+
+// splitSANs splits the SANs of a token like x509util.SplitSANs, but the SANs
+// with a scheme, e.g. spiffe://example.org/web, are returned as URIs instead
+// of DNS names.
+func splitSANs(sans []string) (dnsNames []string, ips []net.IP, emails []string, uris []*url.URL) {
+	var rest []string
+	for _, s := range sans {
+		if strings.Contains(s, "://") {
+			if u, err := url.Parse(s); err == nil && u.Scheme != "" {
+				uris = append(uris, u)
+				continue
+			}
+		}
+		rest = append(rest, s)
+	}
+	dnsNames, ips, emails = x509util.SplitSANs(rest)
+	return
+}
+
 // profileDefaultDuration is a wrapper against x509util.WithOption to conform
 // the SignOption interface.
 type profileDefaultDuration time.Duration
@@ -214,14 +261,14 @@ func (v profileLimitDuration) Option(so Options) x509util.WithOption {
 			notBefore = n
 		}
 		if notBefore.After(v.notAfter) {
-			return errors.Errorf("provisioning credential expiration (%s) is before "+
-				"requested certificate notBefore (%s)", v.notAfter, notBefore)
+			return NewError(ErrCodePolicyValidityDenied, errors.Errorf("provisioning credential expiration (%s) is before "+
+				"requested certificate notBefore (%s)", v.notAfter, notBefore))
 		}
 
 		notAfter := so.NotAfter.RelativeTime(notBefore)
 		if notAfter.After(v.notAfter) {
-			return errors.Errorf("provisioning credential expiration (%s) is before "+
-				"requested certificate notAfter (%s)", v.notAfter, notBefore)
+			return NewError(ErrCodePolicyValidityDenied, errors.Errorf("provisioning credential expiration (%s) is before "+
+				"requested certificate notAfter (%s)", v.notAfter, notBefore))
 		}
 		if notAfter.IsZero() {
 			t := notBefore.Add(v.def)
@@ -240,13 +287,15 @@ func (v profileLimitDuration) Option(so Options) x509util.WithOption {
 
 // validityValidator validates the certificate validity settings.
 type validityValidator struct {
-	min time.Duration
-	max time.Duration
+	min  time.Duration
+	max  time.Duration
+	skew time.Duration
 }
 
-// newValidityValidator return a new validity validator.
-func newValidityValidator(min, max time.Duration) *validityValidator {
-	return &validityValidator{min: min, max: max}
+// newValidityValidator return a new validity validator. The given clock skew
+// is tolerated when the expiration is compared with the current time.
+func newValidityValidator(min, max, skew time.Duration) *validityValidator {
+	return &validityValidator{min: min, max: max, skew: skew}
 }
 
 // Valid validates the certificate validity settings (notBefore/notAfter) and
@@ -259,19 +308,19 @@ func (v *validityValidator) Valid(crt *x509.Certificate) error {
 		now = time.Now()
 	)
 
-	if na.Before(now) {
-		return errors.Errorf("NotAfter: %v cannot be in the past", na)
+	if na.Before(now.Add(-v.skew)) {
+		return NewError(ErrCodePolicyValidityDenied, errors.Errorf("NotAfter: %v cannot be in the past", na))
 	}
 	if na.Before(nb) {
-		return errors.Errorf("NotAfter: %v cannot be before NotBefore: %v", na, nb)
+		return NewError(ErrCodePolicyValidityDenied, errors.Errorf("NotAfter: %v cannot be before NotBefore: %v", na, nb))
 	}
 	if d < v.min {
-		return errors.Errorf("requested duration of %v is less than the authorized minimum certificate duration of %v",
-			d, v.min)
+		return NewError(ErrCodePolicyValidityDenied, errors.Errorf("requested duration of %v is less than the authorized minimum certificate duration of %v",
+			d, v.min)).WithDetail("min", v.min.String())
 	}
 	if d > v.max {
-		return errors.Errorf("requested duration of %v is more than the authorized maximum certificate duration of %v",
-			d, v.max)
+		return NewError(ErrCodePolicyValidityDenied, errors.Errorf("requested duration of %v is more than the authorized maximum certificate duration of %v",
+			d, v.max)).WithDetail("max", v.max.String())
 	}
 	return nil
 }
@@ -304,6 +353,13 @@ func newProvisionerExtensionOption(typ Type, name, credentialID string, keyValue
 	}
 }
 
+// NewProvisionerExtensionOption returns a ProfileModifier that adds the
+// provisioner extension to the certificate. It is used by the AuthorizeSign
+// method of custom provisioners, see Register.
+func NewProvisionerExtensionOption(typ Type, name, credentialID string, keyValuePairs ...string) ProfileModifier {
+	return newProvisionerExtensionOption(typ, name, credentialID, keyValuePairs...)
+}
+
 func (o *provisionerExtensionOption) Option(Options) x509util.WithOption {
 	return func(p x509util.Profile) error {
 		crt := p.Subject()
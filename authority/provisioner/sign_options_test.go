@@ -245,27 +245,72 @@ func Test_ipAddressesValidator_Valid(t *testing.T) {
 	}
 }
 
+func Test_urisValidator_Valid(t *testing.T) {
+	u1, err := url.Parse("spiffe://example.org/web")
+	assert.FatalError(t, err)
+	u2, err := url.Parse("spiffe://example.org/db")
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name    string
+		v       urisValidator
+		req     *x509.CertificateRequest
+		wantErr bool
+	}{
+		{"ok1", []*url.URL{u1}, &x509.CertificateRequest{URIs: []*url.URL{u1}}, false},
+		{"ok2", []*url.URL{u1, u2}, &x509.CertificateRequest{URIs: []*url.URL{u2, u1}}, false},
+		{"fail-missing", []*url.URL{u1}, &x509.CertificateRequest{}, true},
+		{"fail-other", []*url.URL{u1}, &x509.CertificateRequest{URIs: []*url.URL{u2}}, true},
+		{"fail-extra", []*url.URL{u1}, &x509.CertificateRequest{URIs: []*url.URL{u1, u2}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.v.Valid(tt.req); (err != nil) != tt.wantErr {
+				t.Errorf("urisValidator.Valid() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_splitSANs(t *testing.T) {
+	dnsNames, ips, emails, uris := splitSANs([]string{"foo.smallstep.com", "127.0.0.1", "max@smallstep.com", "spiffe://example.org/web"})
+	assert.Equals(t, []string{"foo.smallstep.com"}, dnsNames)
+	assert.Equals(t, []net.IP{net.ParseIP("127.0.0.1")}, ips)
+	assert.Equals(t, []string{"max@smallstep.com"}, emails)
+	assert.Len(t, 1, uris)
+	assert.Equals(t, "spiffe://example.org/web", uris[0].String())
+}
+
 func Test_validityValidator_Valid(t *testing.T) {
 	type fields struct {
-		min time.Duration
-		max time.Duration
+		min  time.Duration
+		max  time.Duration
+		skew time.Duration
 	}
 	type args struct {
 		crt *x509.Certificate
 	}
+	now := time.Now()
 	tests := []struct {
 		name    string
 		fields  fields
 		args    args
 		wantErr bool
 	}{
-		// TODO: Add test cases.
+		{"ok", fields{time.Minute, time.Hour, 0}, args{&x509.Certificate{NotBefore: now, NotAfter: now.Add(10 * time.Minute)}}, false},
+		{"ok/skew", fields{time.Minute, time.Hour, time.Minute}, args{&x509.Certificate{NotBefore: now.Add(-10 * time.Minute), NotAfter: now.Add(-30 * time.Second)}}, false},
+		{"fail/past", fields{time.Minute, time.Hour, 0}, args{&x509.Certificate{NotBefore: now.Add(-10 * time.Minute), NotAfter: now.Add(-30 * time.Second)}}, true},
+		{"fail/past-skew", fields{time.Minute, time.Hour, time.Minute}, args{&x509.Certificate{NotBefore: now.Add(-10 * time.Minute), NotAfter: now.Add(-2 * time.Minute)}}, true},
+		{"fail/before", fields{time.Minute, time.Hour, 0}, args{&x509.Certificate{NotBefore: now.Add(20 * time.Minute), NotAfter: now.Add(10 * time.Minute)}}, true},
+		{"fail/min", fields{time.Minute, time.Hour, 0}, args{&x509.Certificate{NotBefore: now, NotAfter: now.Add(30 * time.Second)}}, true},
+		{"fail/max", fields{time.Minute, time.Hour, 0}, args{&x509.Certificate{NotBefore: now, NotAfter: now.Add(2 * time.Hour)}}, true},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			v := &validityValidator{
-				min: tt.fields.min,
-				max: tt.fields.max,
+				min:  tt.fields.min,
+				max:  tt.fields.max,
+				skew: tt.fields.skew,
 			}
 			if err := v.Valid(tt.args.crt); (err != nil) != tt.wantErr {
 				t.Errorf("validityValidator.Valid() error = %v, wantErr %v", err, tt.wantErr)
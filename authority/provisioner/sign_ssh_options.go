@@ -273,7 +273,7 @@ func (v *sshCertificateValidityValidator) Valid(cert *ssh.Certificate) error {
 	switch {
 	case cert.ValidAfter == 0:
 		return errors.New("ssh certificate validAfter cannot be 0")
-	case cert.ValidBefore < uint64(now().Unix()):
+	case cert.ValidBefore < uint64(now().Add(-v.ClockSkew()).Unix()):
 		return errors.New("ssh certificate validBefore cannot be in the past")
 	case cert.ValidBefore < cert.ValidAfter:
 		return errors.New("ssh certificate validBefore cannot be before validAfter")
@@ -308,8 +308,11 @@ func (v *sshCertificateValidityValidator) Valid(cert *ssh.Certificate) error {
 }
 
 // sshCertificateDefaultValidator implements a simple validator for all the
-// fields in the SSH certificate.
-type sshCertificateDefaultValidator struct{}
+// fields in the SSH certificate. The clock skew is tolerated when the
+// expiration is compared with the current time.
+type sshCertificateDefaultValidator struct {
+	clockSkew time.Duration
+}
 
 // Valid returns an error if the given certificate does not contain the necessary fields.
 func (v *sshCertificateDefaultValidator) Valid(cert *ssh.Certificate) error {
@@ -328,7 +331,7 @@ func (v *sshCertificateDefaultValidator) Valid(cert *ssh.Certificate) error {
 		return errors.New("ssh certificate valid principals cannot be empty")
 	case cert.ValidAfter == 0:
 		return errors.New("ssh certificate validAfter cannot be 0")
-	case cert.ValidBefore < uint64(now().Unix()):
+	case cert.ValidBefore < uint64(now().Add(-v.clockSkew).Unix()):
 		return errors.New("ssh certificate validBefore cannot be in the past")
 	case cert.ValidBefore < cert.ValidAfter:
 		return errors.New("ssh certificate validBefore cannot be before validAfter")
@@ -208,9 +208,14 @@ func Test_sshCertificateValidityValidator(t *testing.T) {
 		},
 		{
 			"fail/validBefore-in-past",
-			&ssh.Certificate{CertType: ssh.UserCert, ValidAfter: uint64(now().Unix()), ValidBefore: uint64(now().Add(-time.Minute).Unix())},
+			&ssh.Certificate{CertType: ssh.UserCert, ValidAfter: uint64(now().Unix()), ValidBefore: uint64(now().Add(-5 * time.Minute).Unix())},
 			errors.New("ssh certificate validBefore cannot be in the past"),
 		},
+		{
+			"ok/validBefore-within-clock-skew",
+			&ssh.Certificate{CertType: ssh.UserCert, ValidAfter: uint64(now().Add(-10 * time.Minute).Unix()), ValidBefore: uint64(now().Add(-30 * time.Second).Unix())},
+			nil,
+		},
 		{
 			"fail/validBefore-before-validAfter",
 			&ssh.Certificate{CertType: ssh.UserCert, ValidAfter: uint64(now().Add(5 * time.Minute).Unix()), ValidBefore: uint64(now().Add(3 * time.Minute).Unix())},
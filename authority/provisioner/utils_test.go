@@ -40,6 +40,7 @@ var (
 	testAudiences = Audiences{
 		Sign:   []string{"https://ca.smallstep.com/sign", "https://ca.smallstep.com/1.0/sign"},
 		Revoke: []string{"https://ca.smallstep.com/revoke", "https://ca.smallstep.com/1.0/revoke"},
+		Admin:  []string{"https://ca.smallstep.com/admin", "https://ca.smallstep.com/1.0/admin"},
 	}
 )
 
@@ -22,13 +22,15 @@ type x5cPayload struct {
 // X5C is the default provisioner, an entity that can sign tokens necessary for
 // signature requests.
 type X5C struct {
-	Type      string  `json:"type"`
-	Name      string  `json:"name"`
-	Roots     []byte  `json:"roots"`
-	Claims    *Claims `json:"claims,omitempty"`
-	claimer   *Claimer
-	audiences Audiences
-	rootPool  *x509.CertPool
+	Type       string           `json:"type"`
+	Name       string           `json:"name"`
+	Roots      []byte           `json:"roots"`
+	Claims     *Claims          `json:"claims,omitempty"`
+	Revocation *RevocationCheck `json:"revocation,omitempty"`
+	claimer    *Claimer
+	audiences  Audiences
+	rootPool   *x509.CertPool
+	revocation *revocationChecker
 }
 
 // GetID returns the provisioner unique identifier. The name and credential id
@@ -104,6 +106,11 @@ func (p *X5C) Init(config Config) error {
 		return errors.Errorf("no x509 certificates found in roots attribute for provisioner %s", p.GetName())
 	}
 
+	if err := p.Revocation.Validate(); err != nil {
+		return errors.Wrapf(err, "error validating provisioner %s", p.GetName())
+	}
+	p.revocation = newRevocationChecker(p.Revocation)
+
 	// Update claims with global ones
 	var err error
 	if p.claimer, err = NewClaimer(p.Claims, config.Claims); err != nil {
@@ -117,7 +124,7 @@ func (p *X5C) Init(config Config) error {
 // authorizeToken performs common jwt authorization actions and returns the
 // claims for case specific downstream parsing.
 // e.g. a Sign request will auth/validate different fields than a Revoke request.
-func (p *X5C) authorizeToken(token string, audiences []string) (*x5cPayload, error) {
+func (p *X5C) authorizeToken(ctx context.Context, token string, audiences []string) (*x5cPayload, error) {
 	jwt, err := jose.ParseSigned(token)
 	if err != nil {
 		return nil, errors.Wrapf(err, "error parsing token")
@@ -135,6 +142,11 @@ func (p *X5C) authorizeToken(token string, audiences []string) (*x5cPayload, err
 		return nil, errors.New("certificate used to sign x5c token cannot be used for digital signature")
 	}
 
+	// Reject the revoked leaf and intermediates if configured.
+	if err := p.revocation.check(ctx, verifiedChains[0]); err != nil {
+		return nil, err
+	}
+
 	// Using the leaf certificates key to validate the claims accomplishes two
 	// things:
 	//   1. Asserts that the private key used to sign the token corresponds
@@ -145,18 +157,16 @@ func (p *X5C) authorizeToken(token string, audiences []string) (*x5cPayload, err
 		return nil, errors.Wrap(err, "error parsing claims")
 	}
 
-	// According to "rfc7519 JSON Web Token" acceptable skew should be no
-	// more than a few minutes.
 	if err = claims.ValidateWithLeeway(jose.Expected{
 		Issuer: p.Name,
 		Time:   time.Now().UTC(),
-	}, time.Minute); err != nil {
-		return nil, errors.Wrapf(err, "invalid token")
+	}, p.claimer.ClockSkew()); err != nil {
+		return nil, errors.Wrapf(tokenError(err), "invalid token")
 	}
 
 	// validate audiences with the defaults
 	if !matchesAudience(claims.Audience, audiences) {
-		return nil, errors.New("invalid token: invalid audience claim (aud)")
+		return nil, NewError(ErrCodeTokenInvalid, errors.New("invalid token: invalid audience claim (aud)"))
 	}
 
 	if claims.Subject == "" {
@@ -171,13 +181,22 @@ func (p *X5C) authorizeToken(token string, audiences []string) (*x5cPayload, err
 // AuthorizeRevoke returns an error if the provisioner does not have rights to
 // revoke the certificate with serial number in the `sub` property.
 func (p *X5C) AuthorizeRevoke(token string) error {
-	_, err := p.authorizeToken(token, p.audiences.Revoke)
+	_, err := p.authorizeToken(context.Background(), token, p.audiences.Revoke)
 	return err
 }
 
+// AuthorizeAdmin validates the given admin token and returns its subject.
+func (p *X5C) AuthorizeAdmin(token string) (string, error) {
+	claims, err := p.authorizeToken(context.Background(), token, p.audiences.Admin)
+	if err != nil {
+		return "", err
+	}
+	return claims.Subject, nil
+}
+
 // AuthorizeSign validates the given token.
 func (p *X5C) AuthorizeSign(ctx context.Context, token string) ([]SignOption, error) {
-	claims, err := p.authorizeToken(token, p.audiences.Sign)
+	claims, err := p.authorizeToken(ctx, token, p.audiences.Sign)
 	if err != nil {
 		return nil, err
 	}
@@ -209,7 +228,7 @@ func (p *X5C) AuthorizeSign(ctx context.Context, token string) ([]SignOption, er
 		dnsNamesValidator(dnsNames),
 		emailAddressesValidator(emails),
 		ipAddressesValidator(ips),
-		newValidityValidator(p.claimer.MinTLSCertDuration(), p.claimer.MaxTLSCertDuration()),
+		newValidityValidator(p.claimer.MinTLSCertDuration(), p.claimer.MaxTLSCertDuration(), p.claimer.ClockSkew()),
 	}, nil
 }
 
@@ -221,6 +240,24 @@ func (p *X5C) AuthorizeRenewal(cert *x509.Certificate) error {
 	return nil
 }
 
+// AuthorizeExpiredRenewal returns an error if the certificate expired before
+// the renewal grace period of the provisioner.
+func (p *X5C) AuthorizeExpiredRenewal(cert *x509.Certificate) error {
+	return p.claimer.authorizeExpiredRenewal(cert)
+}
+
+// RenewalWindow returns how long before their expiration the certificates of
+// the provisioner should be renewed.
+func (p *X5C) RenewalWindow() time.Duration {
+	return p.claimer.RenewalWindow()
+}
+
+// IsRenewalKeyPinned returns if the renewals of the certificates of the
+// provisioner must keep the key of the certificate.
+func (p *X5C) IsRenewalKeyPinned() bool {
+	return p.claimer.IsRenewalKeyPinned()
+}
+
 // authorizeSSHSign returns the list of SignOption for a SignSSH request.
 func (p *X5C) authorizeSSHSign(claims *x5cPayload) ([]SignOption, error) {
 	if claims.Step == nil || claims.Step.SSH == nil {
@@ -262,6 +299,6 @@ func (p *X5C) authorizeSSHSign(claims *x5cPayload) ([]SignOption, error) {
 		// Validate the validity period.
 		&sshCertificateValidityValidator{p.claimer},
 		// Require all the fields in the SSH certificate
-		&sshCertificateDefaultValidator{},
+		&sshCertificateDefaultValidator{p.claimer.ClockSkew()},
 	), nil
 }
@@ -387,7 +387,7 @@ lgsqsR63is+0YQ==
 	for name, tt := range tests {
 		t.Run(name, func(t *testing.T) {
 			tc := tt(t)
-			if claims, err := tc.p.authorizeToken(tc.token, testAudiences.Sign); err != nil {
+			if claims, err := tc.p.authorizeToken(context.Background(), tc.token, testAudiences.Sign); err != nil {
 				if assert.NotNil(t, tc.err) {
 					assert.HasPrefix(t, err.Error(), tc.err.Error())
 				}
@@ -526,7 +526,7 @@ func TestX5C_AuthorizeSign(t *testing.T) {
 							case profileLimitDuration:
 								assert.Equals(t, v.def, tc.p.claimer.DefaultTLSCertDuration())
 
-								claims, err := tc.p.authorizeToken(tc.token, tc.p.audiences.Sign)
+								claims, err := tc.p.authorizeToken(context.Background(), tc.token, tc.p.audiences.Sign)
 								assert.FatalError(t, err)
 								assert.Equals(t, v.notAfter, claims.chains[0][0].NotAfter)
 							case commonNameValidator:
@@ -5,12 +5,55 @@ import (
 	"net/http"
 
 	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/jose"
 	"github.com/pkg/errors"
 )
 
+// getProvisioners returns the collection of provisioners in use.
+func (a *Authority) getProvisioners() *provisioner.Collection {
+	return a.provisioners.Load().(*provisioner.Collection)
+}
+
+// ReloadProvisioners replaces the provisioners of the authority with the given
+// list without restarting the CA. The new provisioners are initialized and
+// validated with the admin, approval and mint configuration before the
+// collection is swapped; on error the current provisioners are kept. Requests
+// in flight finish with the provisioners they started with. An event is
+// published for every provisioner added, updated or removed.
+func (a *Authority) ReloadProvisioners(list provisioner.List) error {
+	a.provisionersMutex.Lock()
+	defer a.provisionersMutex.Unlock()
+
+	config := *a.config.AuthorityConfig
+	config.Provisioners = list
+	if err := config.Validate(a.config.getAudiences()); err != nil {
+		return errors.Wrap(err, "error reloading provisioners")
+	}
+	provisioners := provisioner.NewCollection(a.config.getAudiences())
+	for _, p := range list {
+		if err := provisioners.Store(p); err != nil {
+			return errors.Wrap(err, "error reloading provisioners")
+		}
+	}
+	var mintKeys map[string]*jose.JSONWebKey
+	if config.Mint != nil {
+		var err error
+		if mintKeys, err = loadMintKeys(&config); err != nil {
+			return errors.Wrap(err, "error reloading provisioners")
+		}
+	}
+
+	previous := a.config.AuthorityConfig.Provisioners
+	a.provisioners.Store(provisioners)
+	a.config.AuthorityConfig.Provisioners = list
+	a.mintKeys = mintKeys
+	a.publishProvisionerEvents(previous, list)
+	return nil
+}
+
 // GetEncryptedKey returns the JWE key corresponding to the given kid argument.
 func (a *Authority) GetEncryptedKey(kid string) (string, error) {
-	key, ok := a.provisioners.LoadEncryptedKey(kid)
+	key, ok := a.getProvisioners().LoadEncryptedKey(kid)
 	if !ok {
 		return "", &apiError{errors.Errorf("encrypted key with kid %s was not found", kid),
 			http.StatusNotFound, apiCtx{}}
@@ -21,14 +64,42 @@ func (a *Authority) GetEncryptedKey(kid string) (string, error) {
 // GetProvisioners returns a map listing each provisioner and the JWK Key Set
 // with their public keys.
 func (a *Authority) GetProvisioners(cursor string, limit int) (provisioner.List, string, error) {
-	provisioners, nextCursor := a.provisioners.Find(cursor, limit)
+	provisioners, nextCursor := a.getProvisioners().Find(cursor, limit)
+	return provisioners, nextCursor, nil
+}
+
+// GetProvisionersByType returns a list of provisioners of the given type
+// using the given cursor and limit.
+func (a *Authority) GetProvisionersByType(typ provisioner.Type, cursor string, limit int) (provisioner.List, string, error) {
+	provisioners, nextCursor := a.getProvisioners().FindByType(typ, cursor, limit)
 	return provisioners, nextCursor, nil
 }
 
 // LoadProvisionerByCertificate returns an interface to the provisioner that
 // provisioned the certificate.
 func (a *Authority) LoadProvisionerByCertificate(crt *x509.Certificate) (provisioner.Interface, error) {
-	p, ok := a.provisioners.LoadByCertificate(crt)
+	p, ok := a.getProvisioners().LoadByCertificate(crt)
+	if !ok {
+		return nil, &apiError{errors.Errorf("provisioner not found"),
+			http.StatusNotFound, apiCtx{}}
+	}
+	return p, nil
+}
+
+// LoadProvisionerByToken returns an interface to the provisioner that
+// generated the given token. The token is not verified.
+func (a *Authority) LoadProvisionerByToken(ott string) (provisioner.Interface, error) {
+	token, err := jose.ParseSigned(ott)
+	if err != nil {
+		return nil, &apiError{errors.Wrap(err, "error parsing token"),
+			http.StatusUnauthorized, apiCtx{}}
+	}
+	var claims jose.Claims
+	if err := token.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return nil, &apiError{errors.Wrap(err, "error parsing token claims"),
+			http.StatusUnauthorized, apiCtx{}}
+	}
+	p, ok := a.getProvisioners().LoadByToken(token, &claims)
 	if !ok {
 		return nil, &apiError{errors.Errorf("provisioner not found"),
 			http.StatusNotFound, apiCtx{}}
@@ -38,7 +109,7 @@ func (a *Authority) LoadProvisionerByCertificate(crt *x509.Certificate) (provisi
 
 // LoadProvisionerByID returns an interface to the provisioner with the given ID.
 func (a *Authority) LoadProvisionerByID(id string) (provisioner.Interface, error) {
-	p, ok := a.provisioners.Load(id)
+	p, ok := a.getProvisioners().Load(id)
 	if !ok {
 		return nil, &apiError{errors.Errorf("provisioner not found"),
 			http.StatusNotFound, apiCtx{}}
@@ -3,8 +3,11 @@ package authority
 import (
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/events"
+	"github.com/RTradeLtd/ca-cli/jose"
 	"github.com/pkg/errors"
 	"github.com/smallstep/assert"
 )
@@ -58,7 +61,7 @@ func TestGetEncryptedKey(t *testing.T) {
 				}
 			} else {
 				if assert.Nil(t, tc.err) {
-					val, ok := tc.a.provisioners.Load("max:" + tc.kid)
+					val, ok := tc.a.getProvisioners().Load("max:" + tc.kid)
 					assert.Fatal(t, ok)
 					p, ok := val.(*provisioner.JWK)
 					assert.Fatal(t, ok)
@@ -109,3 +112,104 @@ func TestGetProvisioners(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthority_GetProvisionersByType(t *testing.T) {
+	a := testAuthority(t)
+	var jwks provisioner.List
+	for _, p := range a.config.AuthorityConfig.Provisioners {
+		if p.GetType() == provisioner.TypeJWK {
+			jwks = append(jwks, p)
+		}
+	}
+	assert.True(t, len(jwks) > 0)
+
+	ps, next, err := a.GetProvisionersByType(provisioner.TypeJWK, "", 0)
+	assert.FatalError(t, err)
+	assert.Equals(t, "", next)
+	assert.Len(t, len(jwks), ps)
+	for _, p := range ps {
+		assert.Equals(t, provisioner.TypeJWK, p.GetType())
+	}
+
+	ps, next, err = a.GetProvisionersByType(provisioner.TypeK8sSA, "", 0)
+	assert.FatalError(t, err)
+	assert.Equals(t, "", next)
+	assert.Equals(t, provisioner.List{}, ps)
+}
+
+func TestAuthority_LoadProvisionerByToken(t *testing.T) {
+	a := testAuthority(t)
+	jwk, err := jose.ParseKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+
+	ok, err := generateToken("test.smallstep.com", "step-cli", "https://test.ca.smallstep.com/sign", nil, time.Now(), jwk)
+	assert.FatalError(t, err)
+	notFound, err := generateToken("test.smallstep.com", "foo", "https://test.ca.smallstep.com/sign", nil, time.Now(), jwk)
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name   string
+		ott    string
+		wantID string
+		code   int
+	}{
+		{"ok", ok, "step-cli:" + jwk.KeyID, 0},
+		{"fail-parse", "foo", "", http.StatusUnauthorized},
+		{"fail-not-found", notFound, "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := a.LoadProvisionerByToken(tt.ott)
+			if tt.code != 0 {
+				if assert.NotNil(t, err) {
+					assert.Equals(t, tt.code, err.(*apiError).StatusCode())
+				}
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equals(t, tt.wantID, p.GetID())
+			}
+		})
+	}
+}
+
+func TestAuthority_ReloadProvisioners(t *testing.T) {
+	a := testAuthority(t)
+	current := a.config.AuthorityConfig.Provisioners
+	removed := current[0].(*provisioner.JWK)
+	added := &provisioner.JWK{Name: "new", Type: "JWK", Key: removed.Key}
+
+	ch, cancel := a.SubscribeEvents("")
+	defer cancel()
+
+	// Invalid lists do not replace the provisioners.
+	assert.NotNil(t, a.ReloadProvisioners(provisioner.List{}))
+	assert.NotNil(t, a.ReloadProvisioners(provisioner.List{current[1], current[1]}))
+	_, err := a.LoadProvisionerByID(removed.GetID())
+	assert.FatalError(t, err)
+	assert.Len(t, len(current), a.config.AuthorityConfig.Provisioners)
+	assert.Len(t, 0, ch)
+
+	list := append(provisioner.List{added}, current[1:]...)
+	assert.FatalError(t, a.ReloadProvisioners(list))
+	_, err = a.LoadProvisionerByID(removed.GetID())
+	assert.NotNil(t, err)
+	p, err := a.LoadProvisionerByID(added.GetID())
+	assert.FatalError(t, err)
+	assert.Equals(t, added, p)
+	provisioners, _, err := a.GetProvisioners("", 0)
+	assert.FatalError(t, err)
+	assert.Len(t, len(list), provisioners)
+	assert.Equals(t, list, a.config.AuthorityConfig.Provisioners)
+
+	want := []*events.ProvisionerData{
+		{ID: added.GetID(), Name: "new", Type: "JWK", Action: "added"},
+		{ID: removed.GetID(), Name: removed.Name, Type: "JWK", Action: "removed"},
+	}
+	for _, w := range want {
+		e := receiveEvent(t, ch)
+		assert.Equals(t, events.ProvisionerChanged, e.Type)
+		assert.Equals(t, w, e.Data)
+	}
+	assert.Len(t, 0, ch)
+}
@@ -0,0 +1,67 @@
+package authority
+
+import (
+	"github.com/pkg/errors"
+)
+
+// RateLimitConfig is the configuration of the rate limits of the CA API.
+// Requests are limited per client IP, per provisioner and per endpoint, and
+// the limits not configured are not applied.
+type RateLimitConfig struct {
+	PerIP          *RateLimit            `json:"perIP,omitempty"`
+	PerProvisioner *RateLimit            `json:"perProvisioner,omitempty"`
+	Endpoints      map[string]*RateLimit `json:"endpoints,omitempty"`
+}
+
+// RateLimit is a token bucket rate limit. Rate is the number of requests per
+// second allowed in average, and Burst is the maximum number of requests
+// allowed at once; it defaults to the rate rounded up.
+type RateLimit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst,omitempty"`
+}
+
+// Validate validates the rate limit configuration and sets the default values.
+func (c *RateLimitConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if err := c.PerIP.validate("rateLimit.perIP"); err != nil {
+		return err
+	}
+	if err := c.PerProvisioner.validate("rateLimit.perProvisioner"); err != nil {
+		return err
+	}
+	for path, l := range c.Endpoints {
+		if l == nil {
+			return errors.Errorf("rateLimit.endpoints.%s cannot be empty", path)
+		}
+		if err := l.validate("rateLimit.endpoints." + path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *RateLimit) validate(name string) error {
+	switch {
+	case l == nil:
+		return nil
+	case l.Rate <= 0:
+		return errors.Errorf("%s.rate must be greater than 0", name)
+	case l.Burst < 0:
+		return errors.Errorf("%s.burst cannot be negative", name)
+	case l.Burst == 0:
+		l.Burst = int(l.Rate)
+		if float64(l.Burst) < l.Rate {
+			l.Burst++
+		}
+	}
+	return nil
+}
+
+// GetRateLimitConfig returns the rate limits of the CA API. It returns nil if
+// rate limiting is not configured.
+func (a *Authority) GetRateLimitConfig() *RateLimitConfig {
+	return a.config.RateLimit
+}
@@ -0,0 +1,41 @@
+package authority
+
+import (
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestRateLimitConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *RateLimitConfig
+		err    string
+		burst  int
+	}{
+		{"nil", nil, "", 0},
+		{"ok", &RateLimitConfig{PerIP: &RateLimit{Rate: 10, Burst: 20}}, "", 20},
+		{"ok-default-burst", &RateLimitConfig{PerIP: &RateLimit{Rate: 2.5}}, "", 3},
+		{"ok-default-burst-exact", &RateLimitConfig{PerIP: &RateLimit{Rate: 2}}, "", 2},
+		{"ok-default-burst-small", &RateLimitConfig{PerIP: &RateLimit{Rate: 0.1}}, "", 1},
+		{"fail-rate", &RateLimitConfig{PerIP: &RateLimit{Rate: 0}}, "rateLimit.perIP.rate must be greater than 0", 0},
+		{"fail-burst", &RateLimitConfig{PerProvisioner: &RateLimit{Rate: 1, Burst: -1}}, "rateLimit.perProvisioner.burst cannot be negative", 0},
+		{"fail-endpoint", &RateLimitConfig{Endpoints: map[string]*RateLimit{"/sign": {Rate: -1}}}, "rateLimit.endpoints./sign.rate must be greater than 0", 0},
+		{"fail-endpoint-empty", &RateLimitConfig{Endpoints: map[string]*RateLimit{"/sign": nil}}, "rateLimit.endpoints./sign cannot be empty", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.err != "" {
+				if assert.NotNil(t, err) {
+					assert.Equals(t, tt.err, err.Error())
+				}
+				return
+			}
+			assert.NoError(t, err)
+			if tt.config != nil && tt.config.PerIP != nil {
+				assert.Equals(t, tt.burst, tt.config.PerIP.Burst)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package authority
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"hash/fnv"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/pkg/errors"
+)
+
+// AuthorizeRenewToken authorizes a renewal using a token instead of the
+// certificate in the TLS connection. The token must be signed with the key of
+// the certificate, include the certificate chain in the x5c header and use the
+// renew audience. Because the chain is verified at the time the certificate
+// expires, this allows the renewal of a certificate that expired within the
+// renewal grace period of its provisioner. Returns the certificate to renew.
+func (a *Authority) AuthorizeRenewToken(ctx context.Context, ott string) (*x509.Certificate, error) {
+	var errContext = apiCtx{"ott": ott}
+
+	token, err := jose.ParseSigned(ott)
+	if err != nil {
+		return nil, &apiError{errors.Wrap(err, "authorizeRenewToken: error parsing token"),
+			http.StatusUnauthorized, errContext}
+	}
+	chain, err := parseX5CHeader(ott)
+	if err != nil {
+		return nil, &apiError{errors.Wrap(err, "authorizeRenewToken"), http.StatusUnauthorized, errContext}
+	}
+	leaf := chain[0]
+	errContext["serialNumber"] = leaf.SerialNumber.String()
+
+	// The chain is verified when the certificate is still valid, the
+	// expiration is checked against the grace period below.
+	roots := x509.NewCertPool()
+	for _, crt := range a.GetRootCertificates() {
+		roots.AddCert(crt)
+	}
+	intermediates := x509.NewCertPool()
+	for _, crt := range chain[1:] {
+		intermediates.AddCert(crt)
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   leaf.NotAfter,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return nil, &apiError{errors.Wrap(err, "authorizeRenewToken: error verifying x5c certificate chain"),
+			http.StatusUnauthorized, errContext}
+	}
+
+	var claims jose.Claims
+	if err := token.Claims(leaf.PublicKey, &claims); err != nil {
+		return nil, &apiError{errors.Wrap(err, "authorizeRenewToken: error parsing claims"),
+			http.StatusUnauthorized, errContext}
+	}
+	skew := a.clockSkew()
+	if err := claims.ValidateWithLeeway(jose.Expected{
+		Time: time.Now().UTC(),
+	}, skew); err != nil {
+		return nil, &apiError{errors.Wrapf(err, "authorizeRenewToken: invalid token"),
+			http.StatusUnauthorized, errContext}
+	}
+	if !containsAudience(claims.Audience, a.config.getAudiences().Renew) {
+		return nil, &apiError{errors.New("authorizeRenewToken: invalid token: invalid audience claim (aud)"),
+			http.StatusUnauthorized, errContext}
+	}
+	if claims.ID == "" {
+		return nil, &apiError{errors.New("authorizeRenewToken: token id cannot be empty"),
+			http.StatusUnauthorized, errContext}
+	}
+
+	if time.Now().After(leaf.NotAfter.Add(skew)) {
+		p, ok := a.getProvisioners().LoadByCertificate(leaf)
+		if !ok {
+			return nil, &apiError{errors.New("authorizeRenewToken: provisioner not found"),
+				http.StatusUnauthorized, errContext}
+		}
+		ea, ok := p.(provisioner.ExpiredRenewalAuthorizer)
+		if !ok {
+			return nil, &apiError{errors.New("authorizeRenewToken: certificate has expired"),
+				http.StatusUnauthorized, errContext}
+		}
+		if err := ea.AuthorizeExpiredRenewal(leaf); err != nil {
+			return nil, &apiError{errors.Wrap(err, "authorizeRenewToken"), http.StatusUnauthorized, errContext}
+		}
+	}
+
+	// Store the token to protect against reuse.
+	if err := checkContext(ctx, "authorizeRenewToken", errContext); err != nil {
+		return nil, err
+	}
+	ok, err := a.db.UseToken(claims.ID, ott)
+	if err != nil {
+		return nil, &apiError{errors.Wrap(err, "authorizeRenewToken: failed when checking if token already used"),
+			http.StatusInternalServerError, errContext}
+	}
+	if !ok {
+		return nil, &apiError{errors.New("authorizeRenewToken: token already used"),
+			http.StatusUnauthorized, errContext}
+	}
+	return leaf, nil
+}
+
+// renewalKeyKey is the key used to store in the context the public key
+// presented in a renewal.
+type renewalKeyKey struct{}
+
+// NewContextWithRenewalKey returns a new context with the public key of the
+// certificate presented in the TLS handshake of a renewal. Renewals of the
+// provisioners with the pinRenewalKey claim fail if it is not present or if it
+// is not the key of the certificate to renew.
+func NewContextWithRenewalKey(ctx context.Context, pub crypto.PublicKey) context.Context {
+	return context.WithValue(ctx, renewalKeyKey{}, pub)
+}
+
+// authorizeRenewalKey returns an error if the provisioner of the given
+// certificate pins the renewal key and the public key in the context is not
+// the key of the certificate. The key must be in the context, so the renewals
+// of pinned certificates with a token must also use mTLS with the certificate
+// in the token.
+func (a *Authority) authorizeRenewalKey(ctx context.Context, crt *x509.Certificate) error {
+	p, ok := a.getProvisioners().LoadByCertificate(crt)
+	if !ok {
+		return nil
+	}
+	if kp, ok := p.(provisioner.RenewalKeyPinner); !ok || !kp.IsRenewalKeyPinned() {
+		return nil
+	}
+	errContext := apiCtx{"serialNumber": crt.SerialNumber.String()}
+	pub, ok := ctx.Value(renewalKeyKey{}).(crypto.PublicKey)
+	if !ok || pub == nil {
+		return &apiError{errors.New("renew: the renewal key is pinned, the certificate must be presented with mTLS"),
+			http.StatusForbidden, errContext}
+	}
+	b, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return &apiError{errors.Wrap(err, "renew: error marshaling public key"), http.StatusBadRequest, errContext}
+	}
+	if !bytes.Equal(b, crt.RawSubjectPublicKeyInfo) {
+		return &apiError{errors.New("renew: public key does not match the certificate key, use rekey to change it"),
+			http.StatusForbidden, errContext}
+	}
+	return nil
+}
+
+// RenewAfter returns when the given certificate should be renewed. The time is
+// the renewal window of its provisioner before the expiration, or two thirds
+// of the validity if the window is not configured, minus a jitter of up to a
+// twentieth of the validity. The jitter is derived from the serial number, so
+// the hint of a certificate does not change while the renewals of a fleet are
+// spread.
+func (a *Authority) RenewAfter(crt *x509.Certificate) time.Time {
+	period := crt.NotAfter.Sub(crt.NotBefore)
+	if period <= 0 {
+		return crt.NotAfter
+	}
+	window := period / 3
+	if p, ok := a.getProvisioners().LoadByCertificate(crt); ok {
+		if rw, ok := p.(provisioner.RenewalWindower); ok && rw.RenewalWindow() > 0 {
+			window = rw.RenewalWindow()
+		}
+	}
+	if window > period {
+		window = period
+	}
+
+	renewAfter := crt.NotAfter.Add(-window)
+	if jitter := int64(period / 20); jitter > 0 {
+		h := fnv.New64a()
+		h.Write(crt.SerialNumber.Bytes())
+		renewAfter = renewAfter.Add(-time.Duration(h.Sum64() % uint64(jitter)))
+	}
+	if renewAfter.Before(crt.NotBefore) {
+		return crt.NotBefore
+	}
+	return renewAfter
+}
+
+// clockSkew returns the clock skew tolerance in the global claims of the
+// authority.
+func (a *Authority) clockSkew() time.Duration {
+	var claims *provisioner.Claims
+	if a.config.AuthorityConfig != nil {
+		claims = a.config.AuthorityConfig.Claims
+	}
+	claimer, err := provisioner.NewClaimer(claims, a.config.AuthorityConfig.globalClaims())
+	if err != nil {
+		return provisioner.DefaultClockSkew
+	}
+	return claimer.ClockSkew()
+}
+
+// parseX5CHeader returns the certificates in the x5c header of the given token
+// without verifying them.
+func parseX5CHeader(ott string) ([]*x509.Certificate, error) {
+	parts := strings.Split(ott, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("error parsing token: invalid format")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing token header")
+	}
+	var header struct {
+		X5C []string `json:"x5c"`
+	}
+	if err := json.Unmarshal(b, &header); err != nil {
+		return nil, errors.Wrap(err, "error parsing token header")
+	}
+	if len(header.X5C) == 0 {
+		return nil, errors.New("token does not contain an x5c header")
+	}
+	chain := make([]*x509.Certificate, len(header.X5C))
+	for i, s := range header.X5C {
+		der, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, errors.Wrap(err, "error parsing x5c header")
+		}
+		if chain[i], err = x509.ParseCertificate(der); err != nil {
+			return nil, errors.Wrap(err, "error parsing x5c header")
+		}
+	}
+	return chain, nil
+}
+
+// containsAudience returns true if one of the audiences of a token is in the
+// list of the valid ones.
+func containsAudience(audience []string, valid []string) bool {
+	for _, aud := range audience {
+		for _, v := range valid {
+			if aud == v {
+				return true
+			}
+		}
+	}
+	return false
+}
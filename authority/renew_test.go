@@ -0,0 +1,238 @@
+package authority
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/crypto/randutil"
+	"github.com/RTradeLtd/ca-cli/crypto/x509util"
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/smallstep/assert"
+)
+
+func generateRenewToken(t *testing.T, aud string, key *ecdsa.PrivateKey, chain ...*x509.Certificate) string {
+	x5c := make([]string, len(chain))
+	for i, crt := range chain {
+		x5c[i] = base64.StdEncoding.EncodeToString(crt.Raw)
+	}
+	so := new(jose.SignerOptions)
+	so.WithType("JWT")
+	so.WithHeader("x5c", x5c)
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, so)
+	assert.FatalError(t, err)
+	id, err := randutil.ASCII(64)
+	assert.FatalError(t, err)
+	now := time.Now()
+	tok, err := jose.Signed(sig).Claims(jose.Claims{
+		ID:        id,
+		Subject:   chain[0].Subject.CommonName,
+		IssuedAt:  jose.NewNumericDate(now),
+		NotBefore: jose.NewNumericDate(now),
+		Expiry:    jose.NewNumericDate(now.Add(5 * time.Minute)),
+		Audience:  []string{aud},
+	}).CompactSerialize()
+	assert.FatalError(t, err)
+	return tok
+}
+
+func TestAuthority_AuthorizeRenewToken(t *testing.T) {
+	a := testAuthority(t)
+	// Allow the renewal of the certificates of Max up to an hour after they
+	// expire.
+	max := a.config.AuthorityConfig.Provisioners[0].(*provisioner.JWK)
+	max.Claims = &provisioner.Claims{RenewalGracePeriod: &provisioner.Duration{Duration: time.Hour}}
+	assert.FatalError(t, max.Init(provisioner.Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: a.config.getAudiences(),
+	}))
+	cli := a.config.AuthorityConfig.Provisioners[1].(*provisioner.JWK)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+
+	now := time.Now()
+	newCert := func(p *provisioner.JWK, notBefore, notAfter time.Time) *x509.Certificate {
+		leaf, err := x509util.NewLeafProfile("renew", a.intermediateIdentity.Crt,
+			a.intermediateIdentity.Key,
+			x509util.WithNotBeforeAfterDuration(notBefore, notAfter, 0),
+			x509util.WithPublicKey(key.Public()), x509util.WithHosts("test.smallstep.com"),
+			withProvisionerOID(p.Name, p.Key.KeyID))
+		assert.FatalError(t, err)
+		b, err := leaf.CreateCertificate()
+		assert.FatalError(t, err)
+		crt, err := x509.ParseCertificate(b)
+		assert.FatalError(t, err)
+		return crt
+	}
+	valid := newCert(cli, now.Add(-time.Hour), now.Add(time.Hour))
+	inGrace := newCert(max, now.Add(-2*time.Hour), now.Add(-30*time.Minute))
+	afterGrace := newCert(max, now.Add(-3*time.Hour), now.Add(-2*time.Hour))
+	noGrace := newCert(cli, now.Add(-2*time.Hour), now.Add(-30*time.Minute))
+	intermediate := a.intermediateIdentity.Crt
+
+	aud := "https://test.ca.smallstep.com/renew"
+	tests := []struct {
+		name    string
+		token   string
+		want    *x509.Certificate
+		wantErr bool
+	}{
+		{"ok", generateRenewToken(t, aud, key, valid, intermediate), valid, false},
+		{"ok-1.0", generateRenewToken(t, "https://test.ca.smallstep.com/1.0/renew", key, valid, intermediate), valid, false},
+		{"ok-grace-period", generateRenewToken(t, aud, key, inGrace, intermediate), inGrace, false},
+		{"fail-after-grace-period", generateRenewToken(t, aud, key, afterGrace, intermediate), nil, true},
+		{"fail-no-grace-period", generateRenewToken(t, aud, key, noGrace, intermediate), nil, true},
+		{"fail-audience", generateRenewToken(t, "https://test.ca.smallstep.com/sign", key, valid), nil, true},
+		{"fail-signature", generateRenewToken(t, aud, otherKey, valid), nil, true},
+		{"fail-untrusted", generateRenewToken(t, aud, key, intermediate), nil, true},
+		{"fail-token", "foo", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := a.AuthorizeRenewToken(context.Background(), tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Authority.AuthorizeRenewToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+
+	// Tokens can only be used once.
+	tok := generateRenewToken(t, aud, key, valid, intermediate)
+	_, err = a.AuthorizeRenewToken(context.Background(), tok)
+	assert.FatalError(t, err)
+	_, err = a.AuthorizeRenewToken(context.Background(), tok)
+	assert.Error(t, err)
+}
+
+func TestAuthority_RenewAfter(t *testing.T) {
+	a := testAuthority(t)
+	// The certificates of Max should be renewed an hour before they expire.
+	max := a.config.AuthorityConfig.Provisioners[0].(*provisioner.JWK)
+	max.Claims = &provisioner.Claims{RenewalWindow: &provisioner.Duration{Duration: time.Hour}}
+	assert.FatalError(t, max.Init(provisioner.Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: a.config.getAudiences(),
+	}))
+	cli := a.config.AuthorityConfig.Provisioners[1].(*provisioner.JWK)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	now := time.Now().Truncate(time.Second)
+	newCert := func(p *provisioner.JWK, notAfter time.Time) *x509.Certificate {
+		leaf, err := x509util.NewLeafProfile("renew", a.intermediateIdentity.Crt,
+			a.intermediateIdentity.Key,
+			x509util.WithNotBeforeAfterDuration(now, notAfter, 0),
+			x509util.WithPublicKey(key.Public()), x509util.WithHosts("test.smallstep.com"),
+			withProvisionerOID(p.Name, p.Key.KeyID))
+		assert.FatalError(t, err)
+		b, err := leaf.CreateCertificate()
+		assert.FatalError(t, err)
+		crt, err := x509.ParseCertificate(b)
+		assert.FatalError(t, err)
+		return crt
+	}
+
+	// The jitter is up to a twentieth of the validity.
+	tests := []struct {
+		name     string
+		crt      *x509.Certificate
+		min, max time.Time
+	}{
+		{"window", newCert(max, now.Add(20*time.Hour)), now.Add(18 * time.Hour), now.Add(19 * time.Hour)},
+		{"window-too-large", newCert(max, now.Add(30*time.Minute)), now, now},
+		{"default", newCert(cli, now.Add(30*time.Hour)), now.Add(18*time.Hour + 30*time.Minute), now.Add(20 * time.Hour)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := a.RenewAfter(tt.crt)
+			if got.Before(tt.min) || got.After(tt.max) {
+				t.Errorf("Authority.RenewAfter() = %v, want between %v and %v", got, tt.min, tt.max)
+			}
+			// The hint of a certificate is always the same.
+			assert.Equals(t, got, a.RenewAfter(tt.crt))
+		})
+	}
+
+	// Certificates with different serial numbers get a different jitter.
+	seen := make(map[time.Time]bool)
+	for i := 0; i < 10; i++ {
+		seen[a.RenewAfter(newCert(cli, now.Add(30*time.Hour)))] = true
+	}
+	assert.True(t, len(seen) > 1)
+}
+
+func Test_parseX5CHeader(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key}, nil)
+	assert.FatalError(t, err)
+	noX5C, err := jose.Signed(sig).Claims(jose.Claims{Subject: "foo"}).CompactSerialize()
+	assert.FatalError(t, err)
+
+	for _, tok := range []string{"foo", "foo.bar.baz", noX5C} {
+		_, err := parseX5CHeader(tok)
+		assert.Error(t, err)
+	}
+}
+
+func TestAuthority_authorizeRenewalKey(t *testing.T) {
+	a := testAuthority(t)
+	// The renewals of the certificates of Max must keep the key.
+	max := a.config.AuthorityConfig.Provisioners[0].(*provisioner.JWK)
+	pin := true
+	max.Claims = &provisioner.Claims{PinRenewalKey: &pin}
+	assert.FatalError(t, max.Init(provisioner.Config{
+		Claims:    globalProvisionerClaims,
+		Audiences: a.config.getAudiences(),
+	}))
+	cli := a.config.AuthorityConfig.Provisioners[1].(*provisioner.JWK)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	now := time.Now()
+	newCert := func(p *provisioner.JWK) *x509.Certificate {
+		leaf, err := x509util.NewLeafProfile("renew", a.intermediateIdentity.Crt,
+			a.intermediateIdentity.Key,
+			x509util.WithNotBeforeAfterDuration(now, now.Add(time.Hour), 0),
+			x509util.WithPublicKey(key.Public()), x509util.WithHosts("test.smallstep.com"),
+			withProvisionerOID(p.Name, p.Key.KeyID))
+		assert.FatalError(t, err)
+		b, err := leaf.CreateCertificate()
+		assert.FatalError(t, err)
+		crt, err := x509.ParseCertificate(b)
+		assert.FatalError(t, err)
+		return crt
+	}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		crt     *x509.Certificate
+		wantErr bool
+	}{
+		{"ok", NewContextWithRenewalKey(context.Background(), key.Public()), newCert(max), false},
+		{"ok-not-pinned", NewContextWithRenewalKey(context.Background(), otherKey.Public()), newCert(cli), false},
+		{"ok-not-pinned-token", context.Background(), newCert(cli), false},
+		{"fail-token", context.Background(), newCert(max), true},
+		{"fail-other-key", NewContextWithRenewalKey(context.Background(), otherKey.Public()), newCert(max), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := a.authorizeRenewalKey(tt.ctx, tt.crt); (err != nil) != tt.wantErr {
+				t.Errorf("Authority.authorizeRenewalKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
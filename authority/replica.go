@@ -0,0 +1,32 @@
+package authority
+
+import (
+	"github.com/RTradeLtd/ca-certificates/db"
+)
+
+// WithReadDatabase sets an already initialized read replica of the database
+// to a new authority. This option is intended to be use on graceful reloads,
+// the replica is part of the database configuration that cannot change.
+func WithReadDatabase(db db.AuthDB) Option {
+	return func(a *Authority) {
+		a.readDB = db
+	}
+}
+
+// GetReadDatabase returns the read replica of the database, or nil if a
+// replica is not configured.
+func (a *Authority) GetReadDatabase() db.AuthDB {
+	return a.readDB
+}
+
+// getReadDB returns the database used by the endpoints that report the
+// issued certificates, the stats, the journal and the transparency log: the
+// read replica if one is configured, the authority database otherwise. The
+// sign, renew and revoke paths always use the authority database, they must
+// see the latest writes.
+func (a *Authority) getReadDB() db.AuthDB {
+	if a.readDB != nil {
+		return a.readDB
+	}
+	return a.db
+}
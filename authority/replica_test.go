@@ -0,0 +1,49 @@
+package authority
+
+import (
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+func TestAuthority_ReadReplica(t *testing.T) {
+	a := testAuthority(t)
+	assert.Nil(t, a.GetReadDatabase())
+	now := time.Now()
+	crt := generateIssuedCertificate(t, a, "a.smallstep.com", "step-cli", now.Add(-time.Hour), now.Add(time.Hour))
+
+	var replicaClosed bool
+	a.db = &MockAuthDB{err: errors.New("primary database used")}
+	WithReadDatabase(&MockAuthDB{
+		getCertificates: func() ([]*x509.Certificate, error) {
+			return []*x509.Certificate{crt}, nil
+		},
+		isRevoked: func(sn string) (bool, error) {
+			return false, nil
+		},
+		getStats: func() ([]*db.StatsEntry, error) {
+			return []*db.StatsEntry{}, nil
+		},
+		shutdown: func() error {
+			replicaClosed = true
+			return nil
+		},
+	})(a)
+	assert.NotNil(t, a.GetReadDatabase())
+
+	list, _, err := a.GetCertificates(CertificateFilter{}, "", 0)
+	assert.FatalError(t, err)
+	if assert.Len(t, 1, list) {
+		assert.Equals(t, crt, list[0].Certificate)
+	}
+	stats, err := a.GetStats(time.Time{}, time.Time{})
+	assert.FatalError(t, err)
+	assert.Equals(t, []*ProvisionerStats{}, stats)
+
+	assert.Equals(t, "primary database used", a.Shutdown().Error())
+	assert.True(t, replicaClosed)
+}
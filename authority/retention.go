@@ -0,0 +1,29 @@
+package authority
+
+import (
+	"github.com/RTradeLtd/ca-certificates/db"
+)
+
+// WithGarbageCollector sets an already started garbage collector to a new
+// authority. This option is intended to be use on graceful reloads, the
+// retention policy is part of the database configuration that cannot change.
+func WithGarbageCollector(gc *db.GarbageCollector) Option {
+	return func(a *Authority) {
+		a.gc = gc
+	}
+}
+
+// GetGarbageCollector returns the garbage collector of the database, or nil
+// if a retention policy is not configured.
+func (a *Authority) GetGarbageCollector() *db.GarbageCollector {
+	return a.gc
+}
+
+// GetRetentionStats returns the metrics of the garbage collector. It returns
+// an empty list if a retention policy is not configured.
+func (a *Authority) GetRetentionStats() []*db.PrunerStats {
+	if a.gc == nil {
+		return []*db.PrunerStats{}
+	}
+	return a.gc.Stats()
+}
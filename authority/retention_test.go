@@ -0,0 +1,47 @@
+package authority
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/smallstep/assert"
+)
+
+func TestAuthority_GetRetentionStats(t *testing.T) {
+	a := testAuthority(t)
+	assert.Nil(t, a.GetGarbageCollector())
+	assert.Equals(t, []*db.PrunerStats{}, a.GetRetentionStats())
+
+	c := a.config
+	c.DB = &db.Config{Type: "badger", Retention: &db.RetentionConfig{Certificates: "foo"}}
+	_, err := New(c, WithDatabase(&MockAuthDB{}))
+	if assert.NotNil(t, err) {
+		assert.HasPrefix(t, err.Error(), "error parsing certificates retention foo")
+	}
+
+	pruned := make(chan time.Time, 1)
+	c.DB.Retention = &db.RetentionConfig{Certificates: "720h"}
+	a, err = New(c, WithDatabase(&MockAuthDB{
+		pruneCerts: func(before time.Time) (*db.PruneResult, error) {
+			pruned <- before
+			return &db.PruneResult{Records: 1, Bytes: 512}, nil
+		},
+	}))
+	assert.FatalError(t, err)
+	gc := a.GetGarbageCollector()
+	if assert.NotNil(t, gc) {
+		now := time.Now()
+		gc.Run(now)
+		assert.Equals(t, now.Add(-720*time.Hour), <-pruned)
+		assert.Equals(t, []*db.PrunerStats{
+			{Name: db.RetentionCertificates, Retention: "720h0m0s", Runs: 1, Records: 1, Bytes: 512, LastRun: &now},
+		}, a.GetRetentionStats())
+	}
+
+	// The garbage collector is shared on reloads.
+	b, err := New(c, WithDatabase(a.GetDatabase()), WithGarbageCollector(gc))
+	assert.FatalError(t, err)
+	assert.True(t, gc == b.GetGarbageCollector())
+	assert.NoError(t, a.Shutdown())
+}
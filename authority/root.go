@@ -3,6 +3,7 @@ package authority
 import (
 	"crypto/x509"
 	"net/http"
+	"sort"
 
 	"github.com/pkg/errors"
 )
@@ -25,6 +26,8 @@ func (a *Authority) Root(sum string) (*x509.Certificate, error) {
 
 // GetRootCertificate returns the server root certificate.
 func (a *Authority) GetRootCertificate() *x509.Certificate {
+	a.caMutex.RLock()
+	defer a.caMutex.RUnlock()
 	return a.rootX509Certs[0]
 }
 
@@ -36,28 +39,71 @@ func (a *Authority) GetRootCertificate() *x509.Certificate {
 // that will be set in the tls.Config while GetRoots will be used by the
 // Authority interface and might have extra checks in the future.
 func (a *Authority) GetRootCertificates() []*x509.Certificate {
+	a.caMutex.RLock()
+	defer a.caMutex.RUnlock()
 	return a.rootX509Certs
 }
 
 // GetRoots returns all the root certificates for this CA.
 // This method implements the Authority interface.
 func (a *Authority) GetRoots() ([]*x509.Certificate, error) {
-	return a.rootX509Certs, nil
+	return a.GetRootCertificates(), nil
 }
 
-// GetFederation returns all the root certificates in the federation.
+// GetFederation returns all the root certificates in the federation sorted
+// by fingerprint.
 // This method implements the Authority interface.
 func (a *Authority) GetFederation() (federation []*x509.Certificate, err error) {
+	var sums []string
 	a.certificates.Range(func(k, v interface{}) bool {
 		crt, ok := v.(*x509.Certificate)
 		if !ok {
-			federation = nil
+			federation, sums = nil, nil
 			err = &apiError{errors.Errorf("stored value is not a *x509.Certificate"),
 				http.StatusInternalServerError, apiCtx{}}
 			return false
 		}
 		federation = append(federation, crt)
+		sums = append(sums, k.(string))
 		return true
 	})
+	sort.Sort(byFingerprint{federation, sums})
 	return
 }
+
+// byFingerprint sorts a list of certificates using their fingerprints.
+type byFingerprint struct {
+	certs []*x509.Certificate
+	sums  []string
+}
+
+func (b byFingerprint) Len() int           { return len(b.certs) }
+func (b byFingerprint) Less(i, j int) bool { return b.sums[i] < b.sums[j] }
+func (b byFingerprint) Swap(i, j int) {
+	b.certs[i], b.certs[j] = b.certs[j], b.certs[i]
+	b.sums[i], b.sums[j] = b.sums[j], b.sums[i]
+}
+
+// GetIntermediates returns the chain of intermediate certificates used to sign
+// new certificates, starting with the issuing intermediate. The roots are not
+// included.
+func (a *Authority) GetIntermediates() ([]*x509.Certificate, error) {
+	crt, err := x509.ParseCertificate(a.getIntermediateIdentity().Crt.Raw)
+	if err != nil {
+		return nil, &apiError{errors.Wrap(err, "error parsing intermediate certificate"),
+			http.StatusInternalServerError, apiCtx{}}
+	}
+	return []*x509.Certificate{crt}, nil
+}
+
+// GetIssuingRoot returns the root certificate that signed the given
+// intermediate certificate.
+func (a *Authority) GetIssuingRoot(intermediate *x509.Certificate) (*x509.Certificate, error) {
+	for _, root := range a.GetRootCertificates() {
+		if intermediate.CheckSignatureFrom(root) == nil {
+			return root, nil
+		}
+	}
+	return nil, &apiError{errors.Errorf("root of certificate %s was not found", intermediate.Subject.CommonName),
+		http.StatusNotFound, apiCtx{}}
+}
@@ -153,3 +153,46 @@ func TestAuthority_GetFederation(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthority_GetIntermediates(t *testing.T) {
+	cert, err := pemutil.ReadCertificate("testdata/certs/intermediate_ca.crt")
+	assert.FatalError(t, err)
+
+	a := testAuthority(t)
+	got, err := a.GetIntermediates()
+	assert.FatalError(t, err)
+	assert.Equals(t, []*x509.Certificate{cert}, got)
+}
+
+func TestAuthority_GetIssuingRoot(t *testing.T) {
+	root, err := pemutil.ReadCertificate("testdata/certs/root_ca.crt")
+	assert.FatalError(t, err)
+	intermediate, err := pemutil.ReadCertificate("testdata/certs/intermediate_ca.crt")
+	assert.FatalError(t, err)
+	leaf, err := pemutil.ReadCertificate("testdata/certs/foo.crt")
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name string
+		crt  *x509.Certificate
+		want *x509.Certificate
+		code int
+	}{
+		{"ok", intermediate, root, 0},
+		{"fail-not-found", leaf, nil, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t)
+			got, err := a.GetIssuingRoot(tt.crt)
+			if tt.code != 0 {
+				if assert.NotNil(t, err) {
+					assert.Equals(t, tt.code, err.(*apiError).code)
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
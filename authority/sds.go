@@ -0,0 +1,75 @@
+package authority
+
+import (
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/pkg/errors"
+)
+
+// DefaultSDSRootCAName is the default name of the secret with the root
+// certificates served by the SDS service.
+const DefaultSDSRootCAName = "ROOTCA"
+
+// SDSConfig is the configuration of the Envoy Secret Discovery Service served
+// on the gRPC address. The certificates are signed with one-time tokens minted
+// with Provisioner, that must be in authority.mint. CertDuration is the
+// validity of the certificates, the default of the provisioner if it is not
+// set, and RootCAName is the name of the secret with the root certificates,
+// ROOTCA by default.
+type SDSConfig struct {
+	Provisioner  string                `json:"provisioner"`
+	CertDuration *provisioner.Duration `json:"certDuration,omitempty"`
+	RootCAName   string                `json:"rootCAName,omitempty"`
+}
+
+// Validate validates the SDS configuration.
+func (c *SDSConfig) Validate(config *Config) error {
+	if c == nil {
+		return nil
+	}
+	if config.GRPCAddress == "" {
+		return errors.New("sds requires grpcAddress")
+	}
+	if c.Provisioner == "" {
+		return errors.New("sds.provisioner cannot be empty")
+	}
+	if !config.AuthorityConfig.canMint(c.Provisioner) {
+		return errors.Errorf("sds.provisioner %s is not in authority.mint", c.Provisioner)
+	}
+	if c.CertDuration != nil && c.CertDuration.Duration <= 0 {
+		return errors.New("sds.certDuration must be greater than 0")
+	}
+	return nil
+}
+
+// GetCertDuration returns the validity of the certificates, or 0 to use the
+// default of the provisioner.
+func (c *SDSConfig) GetCertDuration() time.Duration {
+	if c == nil || c.CertDuration == nil {
+		return 0
+	}
+	return c.CertDuration.Duration
+}
+
+// GetRootCAName returns the name of the secret with the root certificates.
+func (c *SDSConfig) GetRootCAName() string {
+	if c == nil || c.RootCAName == "" {
+		return DefaultSDSRootCAName
+	}
+	return c.RootCAName
+}
+
+// canMint returns true if the given provisioner can be used to mint one-time
+// tokens.
+func (c *AuthConfig) canMint(name string) bool {
+	if c == nil || c.Mint == nil {
+		return false
+	}
+	for _, mp := range c.Mint.Provisioners {
+		if mp != nil && mp.Name == name {
+			return true
+		}
+	}
+	return false
+}
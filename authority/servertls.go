@@ -0,0 +1,201 @@
+package authority
+
+import (
+	"crypto/tls"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/crypto/tlsutil"
+	"github.com/RTradeLtd/ca-cli/crypto/x509util"
+	"github.com/pkg/errors"
+)
+
+// Client authentication policies of the CA listeners.
+const (
+	// ClientAuthNone does not request client certificates, so the renewals
+	// and the admin endpoints cannot be authenticated with certificates.
+	ClientAuthNone = "none"
+	// ClientAuthOptional verifies the client certificate if the client sends
+	// one. It is the default.
+	ClientAuthOptional = "optional"
+	// ClientAuthRequired requires a valid client certificate signed by the CA
+	// in all the requests.
+	ClientAuthRequired = "required"
+)
+
+// DefaultServerCertDuration is the default validity of the certificate of the
+// CA listeners.
+const DefaultServerCertDuration = 24 * time.Hour
+
+// minServerCertDuration is the minimum validity of the certificate of the CA
+// listeners.
+const minServerCertDuration = 5 * time.Minute
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	ClientAuthNone:     tls.NoClientCert,
+	ClientAuthOptional: tls.VerifyClientCertIfGiven,
+	ClientAuthRequired: tls.RequireAndVerifyClientCert,
+}
+
+// serverTLSVersions are the TLS versions of the CA listeners. Unlike the ones
+// in the tls attribute, they include TLS 1.3.
+var serverTLSVersions = map[x509util.TLSVersion]uint16{
+	1.0: tls.VersionTLS10,
+	1.1: tls.VersionTLS11,
+	1.2: tls.VersionTLS12,
+	1.3: tls.VersionTLS13,
+}
+
+// insecureCipherSuites are the cipher suites rejected on the CA listeners.
+var insecureCipherSuites = map[uint16]bool{
+	tls.TLS_RSA_WITH_RC4_128_SHA:            true,
+	tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA:    true,
+	tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA:      true,
+	tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA:       true,
+	tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA: true,
+}
+
+var curveIDs = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P256":   tls.CurveP256,
+	"P384":   tls.CurveP384,
+	"P521":   tls.CurveP521,
+}
+
+// ServerTLSConfig is the TLS configuration of the listeners of the CA. Unlike
+// the tls attribute, it is not sent to the clients. The versions and the
+// cipher suites default to the ones in the tls attribute, the curves to the
+// defaults of Go, and the client authentication to optional.
+//
+// The CA issues the certificate of its listeners with its intermediate and
+// renews it in the background. CertDuration is the validity of the
+// certificate, 24h by default, and RenewBefore is how long before the
+// expiration it is renewed, a third of the validity by default.
+type ServerTLSConfig struct {
+	MinVersion   x509util.TLSVersion   `json:"minVersion,omitempty"`
+	MaxVersion   x509util.TLSVersion   `json:"maxVersion,omitempty"`
+	CipherSuites x509util.CipherSuites `json:"cipherSuites,omitempty"`
+	Curves       []string              `json:"curves,omitempty"`
+	ClientAuth   string                `json:"clientAuth,omitempty"`
+	CertDuration *provisioner.Duration `json:"certDuration,omitempty"`
+	RenewBefore  *provisioner.Duration `json:"renewBefore,omitempty"`
+}
+
+// Validate validates the server TLS configuration using the given options for
+// the versions and cipher suites not configured.
+func (c *ServerTLSConfig) Validate(opts *tlsutil.TLSOptions) error {
+	if c == nil {
+		return nil
+	}
+	if c.MinVersion != 0 {
+		if _, ok := serverTLSVersions[c.MinVersion]; !ok {
+			return errors.Errorf("serverTLS.minVersion is not valid: %v is not a supported tls version", c.MinVersion)
+		}
+	}
+	if c.MaxVersion != 0 {
+		if _, ok := serverTLSVersions[c.MaxVersion]; !ok {
+			return errors.Errorf("serverTLS.maxVersion is not valid: %v is not a supported tls version", c.MaxVersion)
+		}
+	}
+	if min, max := c.getMinVersion(opts), c.getMaxVersion(opts); min != 0 && max != 0 && min > max {
+		return errors.New("serverTLS minVersion cannot exceed serverTLS maxVersion")
+	}
+	if err := c.CipherSuites.Validate(); err != nil {
+		return errors.Wrap(err, "serverTLS.cipherSuites is not valid")
+	}
+	for i, id := range c.CipherSuites.Value() {
+		if insecureCipherSuites[id] {
+			return errors.Errorf("serverTLS.cipherSuites is not valid: %s is not secure", c.CipherSuites[i])
+		}
+	}
+	for _, name := range c.Curves {
+		if _, ok := curveIDs[name]; !ok {
+			return errors.Errorf("serverTLS.curves %s is not supported", name)
+		}
+	}
+	if c.ClientAuth != "" {
+		if _, ok := clientAuthTypes[c.ClientAuth]; !ok {
+			return errors.Errorf("serverTLS.clientAuth %s is not supported", c.ClientAuth)
+		}
+	}
+	if d := c.GetCertDuration(); d < minServerCertDuration {
+		return errors.Errorf("serverTLS.certDuration cannot be less than %s", minServerCertDuration)
+	}
+	if c.RenewBefore != nil {
+		if c.RenewBefore.Duration <= 0 || c.RenewBefore.Duration >= c.GetCertDuration() {
+			return errors.New("serverTLS.renewBefore must be greater than 0 and less than serverTLS.certDuration")
+		}
+	}
+	return nil
+}
+
+// GetCertDuration returns the validity of the certificate of the CA
+// listeners.
+func (c *ServerTLSConfig) GetCertDuration() time.Duration {
+	if c == nil || c.CertDuration == nil {
+		return DefaultServerCertDuration
+	}
+	return c.CertDuration.Duration
+}
+
+// GetRenewBefore returns how long before the expiration the certificate of
+// the CA listeners is renewed, or 0 to use the default of the renewer.
+func (c *ServerTLSConfig) GetRenewBefore() time.Duration {
+	if c == nil || c.RenewBefore == nil {
+		return 0
+	}
+	return c.RenewBefore.Duration
+}
+
+// TLSConfig returns the tls.Config of the listeners of the CA, without
+// certificates, using the given options for the versions and cipher suites
+// not configured.
+func (c *ServerTLSConfig) TLSConfig(opts *tlsutil.TLSOptions) *tls.Config {
+	var tlsConfig *tls.Config
+	if opts != nil {
+		tlsConfig = opts.TLSConfig()
+	} else {
+		tlsConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+
+	// Add support for mutual tls to renew certificates
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	// Use server's most preferred ciphersuite
+	tlsConfig.PreferServerCipherSuites = true
+	if c == nil {
+		return tlsConfig
+	}
+
+	if c.MinVersion != 0 {
+		tlsConfig.MinVersion = serverTLSVersions[c.MinVersion]
+	}
+	if c.MaxVersion != 0 {
+		tlsConfig.MaxVersion = serverTLSVersions[c.MaxVersion]
+	}
+	if len(c.CipherSuites) > 0 {
+		tlsConfig.CipherSuites = c.CipherSuites.Value()
+	}
+	for _, name := range c.Curves {
+		tlsConfig.CurvePreferences = append(tlsConfig.CurvePreferences, curveIDs[name])
+	}
+	if c.ClientAuth != "" {
+		tlsConfig.ClientAuth = clientAuthTypes[c.ClientAuth]
+	}
+	return tlsConfig
+}
+
+func (c *ServerTLSConfig) getMinVersion(opts *tlsutil.TLSOptions) x509util.TLSVersion {
+	if c.MinVersion != 0 || opts == nil {
+		return c.MinVersion
+	}
+	return opts.MinVersion
+}
+
+func (c *ServerTLSConfig) getMaxVersion(opts *tlsutil.TLSOptions) x509util.TLSVersion {
+	if c.MaxVersion != 0 || opts == nil {
+		return c.MaxVersion
+	}
+	return opts.MaxVersion
+}
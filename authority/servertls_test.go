@@ -0,0 +1,100 @@
+package authority
+
+import (
+	"crypto/tls"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/crypto/tlsutil"
+	"github.com/RTradeLtd/ca-cli/crypto/x509util"
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+func TestServerTLSConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *ServerTLSConfig
+		opts   *tlsutil.TLSOptions
+		err    error
+	}{
+		{"nil", nil, &DefaultTLSOptions, nil},
+		{"empty", &ServerTLSConfig{}, &DefaultTLSOptions, nil},
+		{"ok", &ServerTLSConfig{
+			MinVersion:   1.2,
+			MaxVersion:   1.3,
+			CipherSuites: x509util.CipherSuites{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+			Curves:       []string{"X25519", "P256"},
+			ClientAuth:   ClientAuthRequired,
+		}, &DefaultTLSOptions, nil},
+		{"ok-max-version", &ServerTLSConfig{MaxVersion: 1.3}, &DefaultTLSOptions, nil},
+		{"fail-min-version", &ServerTLSConfig{MinVersion: 1.5}, &DefaultTLSOptions, errors.New("serverTLS.minVersion is not valid")},
+		{"fail-max-version", &ServerTLSConfig{MaxVersion: 2}, &DefaultTLSOptions, errors.New("serverTLS.maxVersion is not valid")},
+		{"fail-versions", &ServerTLSConfig{MinVersion: 1.3}, &DefaultTLSOptions, errors.New("serverTLS minVersion cannot exceed serverTLS maxVersion")},
+		{"fail-cipher-suites", &ServerTLSConfig{CipherSuites: x509util.CipherSuites{"TLS_RSA_WITH_RC4_128_SHA"}}, &DefaultTLSOptions, errors.New("serverTLS.cipherSuites is not valid")},
+		{"fail-curves", &ServerTLSConfig{Curves: []string{"P224"}}, &DefaultTLSOptions, errors.New("serverTLS.curves P224 is not supported")},
+		{"fail-client-auth", &ServerTLSConfig{ClientAuth: "always"}, &DefaultTLSOptions, errors.New("serverTLS.clientAuth always is not supported")},
+		{"ok-cert-duration", &ServerTLSConfig{
+			CertDuration: &provisioner.Duration{Duration: time.Hour},
+			RenewBefore:  &provisioner.Duration{Duration: 30 * time.Minute},
+		}, &DefaultTLSOptions, nil},
+		{"fail-cert-duration", &ServerTLSConfig{CertDuration: &provisioner.Duration{Duration: time.Minute}}, &DefaultTLSOptions, errors.New("serverTLS.certDuration cannot be less than 5m0s")},
+		{"fail-renew-before", &ServerTLSConfig{RenewBefore: &provisioner.Duration{Duration: 24 * time.Hour}}, &DefaultTLSOptions, errors.New("serverTLS.renewBefore must be greater than 0 and less than serverTLS.certDuration")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate(tt.opts)
+			if tt.err != nil {
+				if assert.NotNil(t, err) {
+					assert.HasPrefix(t, err.Error(), tt.err.Error())
+				}
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestServerTLSConfig_TLSConfig(t *testing.T) {
+	// Defaults
+	var c *ServerTLSConfig
+	tlsConfig := c.TLSConfig(&DefaultTLSOptions)
+	assert.Equals(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+	assert.Equals(t, uint16(tls.VersionTLS12), tlsConfig.MaxVersion)
+	assert.Equals(t, DefaultTLSOptions.CipherSuites.Value(), tlsConfig.CipherSuites)
+	assert.Len(t, 0, tlsConfig.CurvePreferences)
+	assert.Equals(t, tls.VerifyClientCertIfGiven, tlsConfig.ClientAuth)
+	assert.True(t, tlsConfig.PreferServerCipherSuites)
+
+	tlsConfig = c.TLSConfig(nil)
+	assert.Equals(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+	assert.Equals(t, tls.VerifyClientCertIfGiven, tlsConfig.ClientAuth)
+
+	// Configured
+	c = &ServerTLSConfig{
+		MaxVersion:   1.3,
+		CipherSuites: x509util.CipherSuites{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+		Curves:       []string{"X25519", "P384"},
+		ClientAuth:   ClientAuthNone,
+	}
+	tlsConfig = c.TLSConfig(&DefaultTLSOptions)
+	assert.Equals(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+	assert.Equals(t, uint16(tls.VersionTLS13), tlsConfig.MaxVersion)
+	assert.Equals(t, []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}, tlsConfig.CipherSuites)
+	assert.Equals(t, []tls.CurveID{tls.X25519, tls.CurveP384}, tlsConfig.CurvePreferences)
+	assert.Equals(t, tls.NoClientCert, tlsConfig.ClientAuth)
+}
+
+func TestServerTLSConfig_durations(t *testing.T) {
+	var c *ServerTLSConfig
+	assert.Equals(t, DefaultServerCertDuration, c.GetCertDuration())
+	assert.Equals(t, time.Duration(0), c.GetRenewBefore())
+
+	c = &ServerTLSConfig{
+		CertDuration: &provisioner.Duration{Duration: time.Hour},
+		RenewBefore:  &provisioner.Duration{Duration: 10 * time.Minute},
+	}
+	assert.Equals(t, time.Hour, c.GetCertDuration())
+	assert.Equals(t, 10*time.Minute, c.GetRenewBefore())
+}
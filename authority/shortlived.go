@@ -0,0 +1,151 @@
+package authority
+
+import (
+	"crypto/x509"
+	"sync"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/pkg/errors"
+)
+
+const (
+	// defaultShortLivedMinCertDuration is the default minimum duration of the
+	// certificates in the short-lived mode, instead of the 5m of the global
+	// claims.
+	defaultShortLivedMinCertDuration = time.Minute
+	// defaultShortLivedCoalesceWindow is how long the certificate issued in a
+	// renewal is returned to the renewals of the same certificate if
+	// authority.shortLived.coalesceWindow is not set.
+	defaultShortLivedCoalesceWindow = 10 * time.Second
+	// defaultShortLivedFlushInterval is how often the issued certificates are
+	// stored if authority.shortLived.flushInterval is not set.
+	defaultShortLivedFlushInterval = time.Second
+)
+
+// ShortLivedConfig enables a mode for fleets that renew their certificates
+// every few minutes:
+//
+//   - The default minimum duration of the certificates is MinCertDuration, 1m
+//     by default. Provisioners and global claims can still set other values.
+//   - The issued certificates are kept in memory and stored every
+//     FlushInterval, 1s by default, if the database does not already use
+//     asynchronous writes. Certificates not yet stored are lost if the CA
+//     crashes.
+//   - Concurrent renewals of the same certificate, and the renewals within
+//     CoalesceWindow, 10s by default, of the last one, return the same new
+//     certificate instead of issuing one for each request. Rekeys are never
+//     coalesced.
+type ShortLivedConfig struct {
+	MinCertDuration *provisioner.Duration `json:"minCertDuration,omitempty"`
+	CoalesceWindow  *provisioner.Duration `json:"coalesceWindow,omitempty"`
+	FlushInterval   *provisioner.Duration `json:"flushInterval,omitempty"`
+}
+
+// Validate validates the short-lived configuration and sets the default
+// values.
+func (c *ShortLivedConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.MinCertDuration == nil {
+		c.MinCertDuration = &provisioner.Duration{Duration: defaultShortLivedMinCertDuration}
+	} else if c.MinCertDuration.Duration <= 0 {
+		return errors.New("authority.shortLived.minCertDuration must be greater than 0")
+	}
+	if c.CoalesceWindow == nil {
+		c.CoalesceWindow = &provisioner.Duration{Duration: defaultShortLivedCoalesceWindow}
+	} else if c.CoalesceWindow.Duration < 0 {
+		return errors.New("authority.shortLived.coalesceWindow cannot be negative")
+	}
+	if c.FlushInterval == nil {
+		c.FlushInterval = &provisioner.Duration{Duration: defaultShortLivedFlushInterval}
+	} else if c.FlushInterval.Duration <= 0 {
+		return errors.New("authority.shortLived.flushInterval must be greater than 0")
+	}
+	return nil
+}
+
+// asyncWritesConfig returns the configuration of the writer of the issued
+// certificates used in the short-lived mode.
+func (c *ShortLivedConfig) asyncWritesConfig() *db.AsyncWritesConfig {
+	return &db.AsyncWritesConfig{FlushInterval: c.FlushInterval.Duration.String()}
+}
+
+// renewalCoalescer issues only one certificate for the concurrent renewals of
+// the same certificate, and returns it to the renewals of that certificate
+// until the window expires.
+type renewalCoalescer struct {
+	window    time.Duration
+	mu        sync.Mutex
+	calls     map[string]*renewalCall
+	lastPrune time.Time
+}
+
+type renewalCall struct {
+	done      chan struct{}
+	chain     []*x509.Certificate
+	err       error
+	expiresAt time.Time
+}
+
+func newRenewalCoalescer(window time.Duration) *renewalCoalescer {
+	return &renewalCoalescer{
+		window: window,
+		calls:  make(map[string]*renewalCall),
+	}
+}
+
+// do calls renew for the certificate with the given serial number, unless a
+// renewal of it is in flight or finished within the window. In that case it
+// returns the same chain. Failed renewals are not kept, the next renewal
+// calls renew again.
+func (c *renewalCoalescer) do(sn string, renew func() ([]*x509.Certificate, error)) ([]*x509.Certificate, error) {
+	now := time.Now()
+	c.mu.Lock()
+	c.prune(now)
+	if call, ok := c.calls[sn]; ok && (call.expiresAt.IsZero() || now.Before(call.expiresAt)) {
+		c.mu.Unlock()
+		<-call.done
+		return copyChain(call.chain), call.err
+	}
+	call := &renewalCall{done: make(chan struct{})}
+	c.calls[sn] = call
+	c.mu.Unlock()
+
+	call.chain, call.err = renew()
+
+	c.mu.Lock()
+	if call.err != nil {
+		delete(c.calls, sn)
+	} else {
+		call.expiresAt = time.Now().Add(c.window)
+	}
+	c.mu.Unlock()
+	close(call.done)
+	return copyChain(call.chain), call.err
+}
+
+// prune removes the expired renewals, at most once per window. It must be
+// called with the lock held.
+func (c *renewalCoalescer) prune(now time.Time) {
+	if now.Sub(c.lastPrune) < c.window {
+		return
+	}
+	c.lastPrune = now
+	for sn, call := range c.calls {
+		if !call.expiresAt.IsZero() && !now.Before(call.expiresAt) {
+			delete(c.calls, sn)
+		}
+	}
+}
+
+// copyChain returns a copy of the given slice, so a coalesced chain can be
+// modified by the callers.
+func copyChain(chain []*x509.Certificate) []*x509.Certificate {
+	if chain == nil {
+		return nil
+	}
+	return append([]*x509.Certificate(nil), chain...)
+}
@@ -0,0 +1,258 @@
+package authority
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/crypto/x509util"
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+// shortLivedRenewalsPerSecond is the minimum throughput of the renewals in
+// the short-lived mode per CPU, with the in-memory database and no
+// coalescing. It is the target documented in GETTING_STARTED.md, checked by
+// BenchmarkAuthority_Renew_shortLived.
+const shortLivedRenewalsPerSecond = 250
+
+// newShortLivedCert returns a certificate of the provisioner Max valid for the
+// given duration.
+func newShortLivedCert(t testing.TB, a *Authority, d time.Duration) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	p := a.config.AuthorityConfig.Provisioners[0].(*provisioner.JWK)
+	now := time.Now()
+	leaf, err := x509util.NewLeafProfile("renew", a.intermediateIdentity.Crt,
+		a.intermediateIdentity.Key,
+		x509util.WithNotBeforeAfterDuration(now, now.Add(d), 0),
+		x509util.WithPublicKey(key.Public()), x509util.WithHosts("test.smallstep.com"),
+		withProvisionerOID(p.Name, p.Key.KeyID))
+	assert.FatalError(t, err)
+	b, err := leaf.CreateCertificate()
+	assert.FatalError(t, err)
+	crt, err := x509.ParseCertificate(b)
+	assert.FatalError(t, err)
+	return crt
+}
+
+func TestShortLivedConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *ShortLivedConfig
+		err    error
+	}{
+		{"ok", &ShortLivedConfig{}, nil},
+		{"ok-nil", nil, nil},
+		{"ok-no-coalescing", &ShortLivedConfig{CoalesceWindow: &provisioner.Duration{}}, nil},
+		{"fail-min-cert-duration", &ShortLivedConfig{MinCertDuration: &provisioner.Duration{}}, errors.New("authority.shortLived.minCertDuration must be greater than 0")},
+		{"fail-coalesce-window", &ShortLivedConfig{CoalesceWindow: &provisioner.Duration{Duration: -time.Second}}, errors.New("authority.shortLived.coalesceWindow cannot be negative")},
+		{"fail-flush-interval", &ShortLivedConfig{FlushInterval: &provisioner.Duration{}}, errors.New("authority.shortLived.flushInterval must be greater than 0")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.err != nil {
+				if assert.NotNil(t, err) {
+					assert.Equals(t, tt.err.Error(), err.Error())
+				}
+				return
+			}
+			assert.Nil(t, err)
+			if tt.config != nil {
+				assert.Equals(t, defaultShortLivedMinCertDuration, tt.config.MinCertDuration.Duration)
+				assert.Equals(t, defaultShortLivedFlushInterval, tt.config.FlushInterval.Duration)
+				assert.Equals(t, "1s", tt.config.asyncWritesConfig().FlushInterval)
+			}
+		})
+	}
+}
+
+func TestAuthConfig_globalClaims(t *testing.T) {
+	var c *AuthConfig
+	assert.Equals(t, 5*time.Minute, c.globalClaims().MinTLSDur.Duration)
+	c = &AuthConfig{ShortLived: &ShortLivedConfig{}}
+	assert.FatalError(t, c.ShortLived.Validate())
+	assert.Equals(t, time.Minute, c.globalClaims().MinTLSDur.Duration)
+	// The global claims are not modified.
+	assert.Equals(t, 5*time.Minute, globalProvisionerClaims.MinTLSDur.Duration)
+}
+
+func Test_renewalCoalescer(t *testing.T) {
+	var calls int32
+	c := newRenewalCoalescer(time.Minute)
+	renew := func(crt *x509.Certificate, err error) func() ([]*x509.Certificate, error) {
+		return func() ([]*x509.Certificate, error) {
+			atomic.AddInt32(&calls, 1)
+			time.Sleep(10 * time.Millisecond)
+			return []*x509.Certificate{crt}, err
+		}
+	}
+
+	// Concurrent renewals of the same certificate.
+	crt := &x509.Certificate{Raw: []byte("new")}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			chain, err := c.do("1", renew(crt, nil))
+			assert.FatalError(t, err)
+			assert.True(t, chain[0] == crt)
+		}()
+	}
+	wg.Wait()
+	assert.Equals(t, int32(1), atomic.LoadInt32(&calls))
+
+	// Renewals within the window.
+	chain, err := c.do("1", renew(&x509.Certificate{}, nil))
+	assert.FatalError(t, err)
+	assert.True(t, chain[0] == crt)
+	assert.Equals(t, int32(1), atomic.LoadInt32(&calls))
+
+	// Other certificates.
+	_, err = c.do("2", renew(&x509.Certificate{}, nil))
+	assert.FatalError(t, err)
+	assert.Equals(t, int32(2), atomic.LoadInt32(&calls))
+
+	// Errors are not kept.
+	_, err = c.do("3", renew(nil, errors.New("an error")))
+	assert.Error(t, err)
+	_, err = c.do("3", renew(&x509.Certificate{}, nil))
+	assert.FatalError(t, err)
+	assert.Equals(t, int32(4), atomic.LoadInt32(&calls))
+
+	// Expired renewals are pruned.
+	c.mu.Lock()
+	for _, call := range c.calls {
+		call.expiresAt = time.Now().Add(-time.Second)
+	}
+	c.lastPrune = time.Time{}
+	c.mu.Unlock()
+	_, err = c.do("1", renew(&x509.Certificate{}, nil))
+	assert.FatalError(t, err)
+	assert.Equals(t, int32(5), atomic.LoadInt32(&calls))
+	assert.Len(t, 1, c.calls)
+}
+
+func TestAuthority_Renew_shortLived(t *testing.T) {
+	a := testAuthority(t)
+	a.config.AuthorityConfig.ShortLived = &ShortLivedConfig{}
+	assert.FatalError(t, a.config.AuthorityConfig.ShortLived.Validate())
+	a.renewals = newRenewalCoalescer(a.config.AuthorityConfig.ShortLived.CoalesceWindow.Duration)
+
+	crt := newShortLivedCert(t, a, 2*time.Minute)
+	chain1, err := a.Renew(context.Background(), crt)
+	assert.FatalError(t, err)
+	chain2, err := a.Renew(context.Background(), crt)
+	assert.FatalError(t, err)
+	assert.Equals(t, chain1[0].SerialNumber, chain2[0].SerialNumber)
+	assert.Equals(t, crt.NotAfter.Sub(crt.NotBefore), chain1[0].NotAfter.Sub(chain1[0].NotBefore))
+
+	// Rekeys are not coalesced.
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	chain3, err := a.Rekey(context.Background(), crt, key.Public())
+	assert.FatalError(t, err)
+	assert.NotEquals(t, chain1[0].SerialNumber, chain3[0].SerialNumber)
+}
+
+// TestAuthority_Renew_shortLivedConcurrent renews distinct certificates, and
+// the same certificate, from concurrent clients.
+func TestAuthority_Renew_shortLivedConcurrent(t *testing.T) {
+	a := testAuthority(t)
+	a.config.AuthorityConfig.ShortLived = &ShortLivedConfig{}
+	assert.FatalError(t, a.config.AuthorityConfig.ShortLived.Validate())
+	a.renewals = newRenewalCoalescer(a.config.AuthorityConfig.ShortLived.CoalesceWindow.Duration)
+
+	const clients, renewals = 8, 10
+	certs := make([]*x509.Certificate, clients*renewals)
+	for i := range certs {
+		certs[i] = newShortLivedCert(t, a, 2*time.Minute)
+	}
+	shared := newShortLivedCert(t, a, 2*time.Minute)
+
+	var mu sync.Mutex
+	serials := make(map[string]int)
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*clients)
+	renew := func(crt *x509.Certificate) bool {
+		chain, err := a.Renew(context.Background(), crt)
+		if err != nil {
+			errs <- err
+			return false
+		}
+		mu.Lock()
+		serials[chain[0].SerialNumber.String()]++
+		mu.Unlock()
+		return true
+	}
+	for i := 0; i < clients; i++ {
+		wg.Add(2)
+		go func(certs []*x509.Certificate) {
+			defer wg.Done()
+			for _, crt := range certs {
+				if !renew(crt) {
+					return
+				}
+			}
+		}(certs[i*renewals : (i+1)*renewals])
+		go func() {
+			defer wg.Done()
+			renew(shared)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	// Distinct certificates get one new certificate each, the renewals of
+	// the shared one are coalesced.
+	assert.Len(t, len(certs)+1, serials)
+	var coalesced int
+	for _, n := range serials {
+		if n > 1 {
+			coalesced = n
+		}
+	}
+	assert.Equals(t, clients, coalesced)
+}
+
+// BenchmarkAuthority_Renew_shortLived measures the renewals in the
+// short-lived mode. Without coalescing it fails if the throughput is below
+// the target of shortLivedRenewalsPerSecond per CPU.
+func BenchmarkAuthority_Renew_shortLived(b *testing.B) {
+	for _, window := range []time.Duration{0, 10 * time.Second} {
+		b.Run(fmt.Sprintf("coalesceWindow=%s", window), func(b *testing.B) {
+			a := testAuthority(b)
+			a.renewals = newRenewalCoalescer(window)
+			crt := newShortLivedCert(b, a, 2*time.Minute)
+			b.ReportAllocs()
+			b.ResetTimer()
+			start := time.Now()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if _, err := a.Renew(context.Background(), crt); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+			rate := float64(b.N) / time.Since(start).Seconds()
+			b.ReportMetric(rate, "renewals/s")
+			if target := float64(shortLivedRenewalsPerSecond * runtime.GOMAXPROCS(0)); window == 0 && b.N > 1 && rate < target {
+				b.Errorf("renewal throughput = %.0f/s, want >= %.0f/s", rate, target)
+			}
+		})
+	}
+}
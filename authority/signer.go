@@ -0,0 +1,138 @@
+package authority
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/crypto/x509util"
+	"github.com/pkg/errors"
+)
+
+// errSignerBusy is the error returned when the intermediate key cannot sign
+// before the queue timeout because all the signatures in flight are in use.
+var errSignerBusy = errors.New("signer is busy")
+
+// errSignerCanceled is the error returned when the request is canceled while
+// it waits for a signature.
+var errSignerCanceled = errors.New("request canceled while waiting for the signer")
+
+// SignerConfig limits the signatures done concurrently with the intermediate
+// key. It is useful with HSM backends that only support a limited number of
+// sessions. MaxConcurrency is the maximum number of signatures in flight, and
+// QueueTimeout is the maximum time a request waits for one, by default there
+// is no limit.
+type SignerConfig struct {
+	MaxConcurrency int                   `json:"maxConcurrency"`
+	QueueTimeout   *provisioner.Duration `json:"queueTimeout,omitempty"`
+}
+
+// Validate validates the signer configuration.
+func (c *SignerConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.MaxConcurrency <= 0:
+		return errors.New("signer.maxConcurrency must be greater than 0")
+	case c.QueueTimeout != nil && c.QueueTimeout.Duration < 0:
+		return errors.New("signer.queueTimeout cannot be negative")
+	default:
+		return nil
+	}
+}
+
+// limitedSigner is a crypto.Signer that limits the number of concurrent
+// signatures of the wrapped signer.
+type limitedSigner struct {
+	crypto.Signer
+	sem     chan struct{}
+	timeout time.Duration
+	ctx     context.Context
+}
+
+// newIntermediateIdentity returns the identity used to sign certificates with
+// the given intermediate and key. The intermediate is parsed again with the
+// standard library, it is returned as is in the chain of the signed
+// certificates, and the key is wrapped with the limits in the configuration.
+func newIntermediateIdentity(crt *x509.Certificate, key interface{}, c *SignerConfig) (*x509util.Identity, error) {
+	crt, err := x509.ParseCertificate(crt.Raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing intermediate certificate")
+	}
+	return x509util.NewIdentity(crt, newLimitedSigner(key, c)), nil
+}
+
+// newLimitedSigner wraps the given key with the limits in the configuration.
+// The key is returned as it is if there are no limits or it's not a signer.
+func newLimitedSigner(key interface{}, c *SignerConfig) interface{} {
+	signer, ok := key.(crypto.Signer)
+	if c == nil || !ok {
+		return key
+	}
+	if ls, ok := signer.(*limitedSigner); ok {
+		signer = ls.Signer
+	}
+	var timeout time.Duration
+	if c.QueueTimeout != nil {
+		timeout = c.QueueTimeout.Duration
+	}
+	return &limitedSigner{
+		Signer:  signer,
+		sem:     make(chan struct{}, c.MaxConcurrency),
+		timeout: timeout,
+	}
+}
+
+// signerWithContext returns the given key bound to the context of a request,
+// so a limited signer stops waiting for a signature if the request is
+// canceled. Other keys are returned as they are.
+func signerWithContext(ctx context.Context, key interface{}) interface{} {
+	if s, ok := key.(*limitedSigner); ok {
+		return &limitedSigner{
+			Signer:  s.Signer,
+			sem:     s.sem,
+			timeout: s.timeout,
+			ctx:     ctx,
+		}
+	}
+	return key
+}
+
+// Sign signs the digest with the wrapped signer once there is a signature
+// available. It returns errSignerBusy if none is available before the queue
+// timeout, and errSignerCanceled if the context of the signer is done first.
+func (s *limitedSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	var timeout <-chan time.Time
+	if s.timeout > 0 {
+		t := time.NewTimer(s.timeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	var done <-chan struct{}
+	if s.ctx != nil {
+		done = s.ctx.Done()
+	}
+	select {
+	case s.sem <- struct{}{}:
+	case <-timeout:
+		return nil, errSignerBusy
+	case <-done:
+		return nil, errSignerCanceled
+	}
+	defer func() { <-s.sem }()
+	return s.Signer.Sign(rand, digest, opts)
+}
+
+// signerErrorStatus returns the HTTP status of an error signing a
+// certificate. Busy signers, and the requests canceled waiting for them,
+// return a 503 so the clients can retry later.
+func signerErrorStatus(err error) int {
+	if cause := errors.Cause(err); cause == errSignerBusy || cause == errSignerCanceled {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
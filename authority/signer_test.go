@@ -0,0 +1,168 @@
+package authority
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/crypto/keys"
+	"github.com/smallstep/assert"
+)
+
+func TestSignerConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *SignerConfig
+		err    string
+	}{
+		{"nil", nil, ""},
+		{"ok", &SignerConfig{MaxConcurrency: 4, QueueTimeout: &provisioner.Duration{Duration: time.Second}}, ""},
+		{"fail-concurrency", &SignerConfig{}, "signer.maxConcurrency must be greater than 0"},
+		{"fail-timeout", &SignerConfig{MaxConcurrency: 1, QueueTimeout: &provisioner.Duration{Duration: -1}}, "signer.queueTimeout cannot be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.err != "" {
+				if assert.NotNil(t, err) {
+					assert.Equals(t, tt.err, err.Error())
+				}
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+// blockingSigner is a signer that waits for a signal before signing.
+type blockingSigner struct {
+	crypto.Signer
+	mu       sync.Mutex
+	inFlight int
+	max      int
+	release  chan struct{}
+}
+
+func (s *blockingSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.mu.Lock()
+	s.inFlight++
+	if s.inFlight > s.max {
+		s.max = s.inFlight
+	}
+	s.mu.Unlock()
+	<-s.release
+	s.mu.Lock()
+	s.inFlight--
+	s.mu.Unlock()
+	return s.Signer.Sign(rand, digest, opts)
+}
+
+func Test_limitedSigner(t *testing.T) {
+	_, priv, err := keys.GenerateDefaultKeyPair()
+	assert.FatalError(t, err)
+	key := priv.(crypto.Signer)
+
+	// No limits
+	assert.Equals(t, priv, newLimitedSigner(priv, nil))
+	assert.Equals(t, "foo", newLimitedSigner("foo", &SignerConfig{MaxConcurrency: 1}))
+
+	// Signatures over the limit wait
+	bs := &blockingSigner{Signer: key, release: make(chan struct{})}
+	signer := newLimitedSigner(bs, &SignerConfig{MaxConcurrency: 2}).(crypto.Signer)
+	assert.Equals(t, key.Public(), signer.Public())
+	sum := sha256.Sum256([]byte("data"))
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := signer.Sign(rand.Reader, sum[:], crypto.SHA256)
+			assert.NoError(t, err)
+		}()
+	}
+	// Wait until the limit is reached before releasing the signatures.
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		bs.mu.Lock()
+		n := bs.inFlight
+		bs.mu.Unlock()
+		if n == 2 {
+			break
+		}
+	}
+	for i := 0; i < 5; i++ {
+		bs.release <- struct{}{}
+	}
+	wg.Wait()
+	assert.Equals(t, 2, bs.max)
+
+	// Wrapping again replaces the limits
+	signer = newLimitedSigner(signer, &SignerConfig{MaxConcurrency: 1, QueueTimeout: &provisioner.Duration{Duration: 10 * time.Millisecond}}).(crypto.Signer)
+	assert.Equals(t, bs, signer.(*limitedSigner).Signer)
+
+	// Busy signers fail after the queue timeout
+	go signer.Sign(rand.Reader, sum[:], crypto.SHA256)
+	time.Sleep(50 * time.Millisecond)
+	_, err = signer.Sign(rand.Reader, sum[:], crypto.SHA256)
+	assert.Equals(t, errSignerBusy, err)
+	bs.release <- struct{}{}
+
+	// Canceled requests stop waiting without a queue timeout
+	signer = newLimitedSigner(bs, &SignerConfig{MaxConcurrency: 1}).(crypto.Signer)
+	go signer.Sign(rand.Reader, sum[:], crypto.SHA256)
+	time.Sleep(50 * time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err = signerWithContext(ctx, signer).(crypto.Signer).Sign(rand.Reader, sum[:], crypto.SHA256)
+	assert.Equals(t, errSignerCanceled, err)
+	bs.release <- struct{}{}
+	assert.Equals(t, "foo", signerWithContext(ctx, "foo"))
+}
+
+func TestAuthority_Sign_busySigner(t *testing.T) {
+	_, priv, err := keys.GenerateDefaultKeyPair()
+	assert.FatalError(t, err)
+
+	a := testAuthority(t)
+	signer := newLimitedSigner(a.intermediateIdentity.Key, &SignerConfig{
+		MaxConcurrency: 1,
+		QueueTimeout:   &provisioner.Duration{Duration: 10 * time.Millisecond},
+	}).(*limitedSigner)
+	a.intermediateIdentity.Key = signer
+
+	nb := time.Now()
+	signOpts := provisioner.Options{
+		NotBefore: provisioner.NewTimeDuration(nb),
+		NotAfter:  provisioner.NewTimeDuration(nb.Add(5 * time.Minute)),
+	}
+	certs, err := a.Sign(context.Background(), getCSR(t, priv), signOpts)
+	assert.FatalError(t, err)
+	assert.Equals(t, a.intermediateIdentity.Crt, certs[1])
+
+	// All the signatures are in use
+	signer.sem <- struct{}{}
+	defer func() { <-signer.sem }()
+	_, err = a.Sign(context.Background(), getCSR(t, priv), signOpts)
+	if assert.NotNil(t, err) {
+		assert.Equals(t, http.StatusServiceUnavailable, err.(*apiError).code)
+	}
+	_, err = a.Renew(context.Background(), certs[0])
+	if assert.NotNil(t, err) {
+		assert.Equals(t, http.StatusServiceUnavailable, err.(*apiError).code)
+	}
+
+	// Without a queue timeout the requests wait until they are canceled
+	signer.timeout = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = a.Sign(ctx, getCSR(t, priv), signOpts)
+	if assert.NotNil(t, err) {
+		assert.Equals(t, http.StatusServiceUnavailable, err.(*apiError).code)
+	}
+}
@@ -0,0 +1,46 @@
+package authority
+
+import (
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/pkg/errors"
+)
+
+// configuredSignOption is a sign option created from the authority.signOptions
+// configuration.
+type configuredSignOption struct {
+	provisioners []string
+	method       provisioner.Method
+	option       provisioner.SignOption
+}
+
+// appliesTo returns true if the sign option must be added to the sign
+// requests of the given provisioner.
+func (o configuredSignOption) appliesTo(p provisioner.Interface) bool {
+	if len(o.provisioners) == 0 {
+		return true
+	}
+	for _, name := range o.provisioners {
+		if p.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// loadSignOptions creates the registered sign options referenced in the
+// configuration.
+func loadSignOptions(c *AuthConfig) ([]configuredSignOption, error) {
+	var opts []configuredSignOption
+	for _, sc := range c.SignOptions {
+		op, method, err := provisioner.NewSignOption(sc.Name, sc.Options)
+		if err != nil {
+			return nil, errors.Wrap(err, "error loading authority.signOptions")
+		}
+		opts = append(opts, configuredSignOption{
+			provisioners: sc.Provisioners,
+			method:       method,
+			option:       op,
+		})
+	}
+	return opts, nil
+}
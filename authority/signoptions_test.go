@@ -0,0 +1,97 @@
+package authority
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/crypto/keys"
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+// commonNameValidator rejects the certificates with the given common name.
+type commonNameValidator struct {
+	CommonName string `json:"commonName"`
+}
+
+func (v *commonNameValidator) Valid(crt *x509.Certificate) error {
+	if crt.Subject.CommonName == v.CommonName {
+		return errors.Errorf("common name %s is not allowed", v.CommonName)
+	}
+	return nil
+}
+
+func init() {
+	provisioner.RegisterSignOption("commonNameValidator", provisioner.SignMethod, func(options json.RawMessage) (provisioner.SignOption, error) {
+		v := new(commonNameValidator)
+		if err := json.Unmarshal(options, v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	})
+}
+
+func TestAuthority_signOptions(t *testing.T) {
+	_, priv, err := keys.GenerateDefaultKeyPair()
+	assert.FatalError(t, err)
+	jwk, err := jose.ParseKey("testdata/secrets/step_cli_key_priv.jwk", jose.WithPassword([]byte("pass")))
+	assert.FatalError(t, err)
+
+	tests := []struct {
+		name    string
+		config  []*SignOptionConfig
+		wantErr bool
+	}{
+		{"ok-no-options", nil, false},
+		{"ok-other-provisioner", []*SignOptionConfig{{
+			Name:         "commonNameValidator",
+			Provisioners: []string{"Max"},
+			Options:      json.RawMessage(`{"commonName": "smallstep test"}`),
+		}}, false},
+		{"fail-provisioner", []*SignOptionConfig{{
+			Name:         "commonNameValidator",
+			Provisioners: []string{"step-cli"},
+			Options:      json.RawMessage(`{"commonName": "smallstep test"}`),
+		}}, true},
+		{"fail-all-provisioners", []*SignOptionConfig{{
+			Name:    "commonNameValidator",
+			Options: json.RawMessage(`{"commonName": "smallstep test"}`),
+		}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t)
+			a.config.AuthorityConfig.SignOptions = tt.config
+			a.signOptions, err = loadSignOptions(a.config.AuthorityConfig)
+			assert.FatalError(t, err)
+
+			token, err := generateToken("smallstep test", "step-cli", "https://test.ca.smallstep.com/sign",
+				[]string{"test.smallstep.com"}, time.Now(), jwk)
+			assert.FatalError(t, err)
+			ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+			signOpts, err := a.Authorize(ctx, token)
+			assert.FatalError(t, err)
+			_, err = a.Sign(context.Background(), getCSR(t, priv), provisioner.Options{}, signOpts...)
+			if tt.wantErr {
+				if assert.NotNil(t, err) {
+					assert.Equals(t, http.StatusUnauthorized, err.(*apiError).code)
+				}
+			} else {
+				assert.FatalError(t, err)
+			}
+		})
+	}
+}
+
+func Test_loadSignOptions(t *testing.T) {
+	_, err := loadSignOptions(&AuthConfig{SignOptions: []*SignOptionConfig{{Name: "unknown"}}})
+	assert.Error(t, err)
+	_, err = loadSignOptions(&AuthConfig{SignOptions: []*SignOptionConfig{{Name: "commonNameValidator", Options: json.RawMessage(`[]`)}}})
+	assert.Error(t, err)
+}
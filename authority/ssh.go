@@ -1,6 +1,7 @@
 package authority
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/binary"
 	"net/http"
@@ -25,7 +26,8 @@ const (
 )
 
 // SignSSH creates a signed SSH certificate with the given public key and options.
-func (a *Authority) SignSSH(key ssh.PublicKey, opts provisioner.SSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
+// The certificate is not signed if the context is done.
+func (a *Authority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisioner.SSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
 	var mods []provisioner.SSHCertificateModifier
 	var validators []provisioner.SSHCertificateValidator
 
@@ -95,7 +97,7 @@ func (a *Authority) SignSSH(key ssh.PublicKey, opts provisioner.SSHOptions, sign
 				code: http.StatusNotImplemented,
 			}
 		}
-		if signer, err = ssh.NewSignerFromSigner(a.sshCAUserCertSignKey); err != nil {
+		if signer, err = getSSHSigner(a.sshCAUserSigner, a.sshCAUserCertSignKey); err != nil {
 			return nil, &apiError{
 				err:  errors.Wrap(err, "signSSH: error creating signer"),
 				code: http.StatusInternalServerError,
@@ -108,7 +110,7 @@ func (a *Authority) SignSSH(key ssh.PublicKey, opts provisioner.SSHOptions, sign
 				code: http.StatusNotImplemented,
 			}
 		}
-		if signer, err = ssh.NewSignerFromSigner(a.sshCAHostCertSignKey); err != nil {
+		if signer, err = getSSHSigner(a.sshCAHostSigner, a.sshCAHostCertSignKey); err != nil {
 			return nil, &apiError{
 				err:  errors.Wrap(err, "signSSH: error creating signer"),
 				code: http.StatusInternalServerError,
@@ -127,6 +129,9 @@ func (a *Authority) SignSSH(key ssh.PublicKey, opts provisioner.SSHOptions, sign
 	data = data[:len(data)-4]
 
 	// Sign the certificate
+	if err := checkContext(ctx, "signSSH", apiCtx{}); err != nil {
+		return nil, err
+	}
 	sig, err := signer.Sign(rand.Reader, data)
 	if err != nil {
 		return nil, &apiError{
@@ -143,11 +148,12 @@ func (a *Authority) SignSSH(key ssh.PublicKey, opts provisioner.SSHOptions, sign
 		}
 	}
 
+	recordSSHCertificate(cert)
 	return cert, nil
 }
 
 // SignSSHAddUser signs a certificate that provisions a new user in a server.
-func (a *Authority) SignSSHAddUser(key ssh.PublicKey, subject *ssh.Certificate) (*ssh.Certificate, error) {
+func (a *Authority) SignSSHAddUser(ctx context.Context, key ssh.PublicKey, subject *ssh.Certificate) (*ssh.Certificate, error) {
 	if a.sshCAUserCertSignKey == nil {
 		return nil, &apiError{
 			err:  errors.New("signSSHAddUser: user certificate signing is not enabled"),
@@ -180,7 +186,7 @@ func (a *Authority) SignSSHAddUser(key ssh.PublicKey, subject *ssh.Certificate)
 		}
 	}
 
-	signer, err := ssh.NewSignerFromSigner(a.sshCAUserCertSignKey)
+	signer, err := getSSHSigner(a.sshCAUserSigner, a.sshCAUserCertSignKey)
 	if err != nil {
 		return nil, &apiError{
 			err:  errors.Wrap(err, "signSSHProxy: error creating signer"),
@@ -213,11 +219,15 @@ func (a *Authority) SignSSHAddUser(key ssh.PublicKey, subject *ssh.Certificate)
 	data = data[:len(data)-4]
 
 	// Sign the certificate
+	if err := checkContext(ctx, "signSSHAddUser", apiCtx{}); err != nil {
+		return nil, err
+	}
 	sig, err := signer.Sign(rand.Reader, data)
 	if err != nil {
 		return nil, err
 	}
 	cert.Signature = sig
+	recordSSHCertificate(cert)
 	return cert, nil
 }
 
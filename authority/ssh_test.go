@@ -1,6 +1,7 @@
 package authority
 
 import (
+	"context"
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
@@ -141,7 +142,7 @@ func TestAuthority_SignSSH(t *testing.T) {
 			a.sshCAUserCertSignKey = tt.fields.sshCAUserCertSignKey
 			a.sshCAHostCertSignKey = tt.fields.sshCAHostCertSignKey
 
-			got, err := a.SignSSH(tt.args.key, tt.args.opts, tt.args.signOpts...)
+			got, err := a.SignSSH(context.Background(), tt.args.key, tt.args.opts, tt.args.signOpts...)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Authority.SignSSH() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -228,7 +229,7 @@ func TestAuthority_SignSSHAddUser(t *testing.T) {
 				AddUserPrincipal: tt.fields.addUserPrincipal,
 				AddUserCommand:   tt.fields.addUserCommand,
 			}
-			got, err := a.SignSSHAddUser(tt.args.key, tt.args.subject)
+			got, err := a.SignSSHAddUser(context.Background(), tt.args.key, tt.args.subject)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Authority.SignSSHAddUser() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -0,0 +1,53 @@
+package authority
+
+import (
+	"crypto"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshSigner is the ssh.Signer of an SSH CA key. It is created once when the
+// authority is initialized, and its public key keeps the wire format, so it
+// is not encoded again in every certificate.
+type sshSigner struct {
+	ssh.Signer
+	publicKey ssh.PublicKey
+}
+
+// newSSHSigner returns the ssh.Signer of the given key.
+func newSSHSigner(key crypto.Signer) (*sshSigner, error) {
+	signer, err := ssh.NewSignerFromSigner(key)
+	if err != nil {
+		return nil, err
+	}
+	pub := signer.PublicKey()
+	return &sshSigner{
+		Signer:    signer,
+		publicKey: marshaledPublicKey{PublicKey: pub, wire: pub.Marshal()},
+	}, nil
+}
+
+// PublicKey implements the ssh.Signer interface.
+func (s *sshSigner) PublicKey() ssh.PublicKey {
+	return s.publicKey
+}
+
+// marshaledPublicKey is an ssh.PublicKey with its wire format already
+// encoded.
+type marshaledPublicKey struct {
+	ssh.PublicKey
+	wire []byte
+}
+
+// Marshal implements the ssh.PublicKey interface.
+func (k marshaledPublicKey) Marshal() []byte {
+	return k.wire
+}
+
+// getSSHSigner returns the signer created on initialization if there is one,
+// or a new signer of the given key.
+func getSSHSigner(signer *sshSigner, key crypto.Signer) (ssh.Signer, error) {
+	if signer != nil {
+		return signer, nil
+	}
+	return newSSHSigner(key)
+}
@@ -0,0 +1,83 @@
+package authority
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/smallstep/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// unsupportedSigner is a crypto.Signer with a public key not supported by
+// SSH.
+type unsupportedSigner struct{}
+
+func (unsupportedSigner) Public() crypto.PublicKey { return "foo" }
+
+func (unsupportedSigner) Sign(io.Reader, []byte, crypto.SignerOpts) ([]byte, error) {
+	return nil, nil
+}
+
+func Test_newSSHSigner(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	want, err := ssh.NewSignerFromSigner(key)
+	assert.FatalError(t, err)
+
+	signer, err := newSSHSigner(key)
+	assert.FatalError(t, err)
+	pub := signer.PublicKey()
+	assert.Equals(t, want.PublicKey().Type(), pub.Type())
+	assert.Equals(t, want.PublicKey().Marshal(), pub.Marshal())
+	assert.Equals(t, ssh.FingerprintSHA256(want.PublicKey()), ssh.FingerprintSHA256(pub))
+
+	sig, err := signer.Sign(rand.Reader, []byte("data"))
+	assert.FatalError(t, err)
+	assert.NoError(t, pub.Verify([]byte("data"), sig))
+
+	// The signer is reused if there is one.
+	got, err := getSSHSigner(signer, key)
+	assert.FatalError(t, err)
+	assert.True(t, got == signer)
+	got, err = getSSHSigner(nil, key)
+	assert.FatalError(t, err)
+	assert.Equals(t, pub.Marshal(), got.PublicKey().Marshal())
+
+	_, err = newSSHSigner(unsupportedSigner{})
+	assert.NotNil(t, err)
+}
+
+func TestAuthority_SignSSH_cachedSigner(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	signer, err := newSSHSigner(key)
+	assert.FatalError(t, err)
+	pub, err := ssh.NewPublicKey(key.Public())
+	assert.FatalError(t, err)
+
+	a := testAuthority(t)
+	a.sshCAUserCertSignKey = key
+	a.sshCAUserSigner = signer
+	cert, err := a.SignSSH(context.Background(), pub, provisioner.SSHOptions{
+		CertType:    "user",
+		Principals:  []string{"user"},
+		ValidBefore: provisioner.NewTimeDuration(time.Now().Add(time.Hour)),
+	})
+	assert.FatalError(t, err)
+	assert.Equals(t, signer.PublicKey(), cert.SignatureKey)
+
+	// The certificate is valid for the CA key.
+	parsed, err := ssh.ParsePublicKey(cert.Marshal())
+	assert.FatalError(t, err)
+	checker := ssh.CertChecker{IsUserAuthority: func(auth ssh.PublicKey) bool {
+		return string(auth.Marshal()) == string(signer.PublicKey().Marshal())
+	}}
+	assert.NoError(t, checker.CheckCert("user", parsed.(*ssh.Certificate)))
+}
@@ -0,0 +1,93 @@
+package authority
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/RTradeLtd/ca-certificates/metrics"
+	"github.com/pkg/errors"
+)
+
+// ProvisionerStats is the number of certificates issued, renewed and revoked
+// using a provisioner in one day.
+type ProvisionerStats struct {
+	Day         string `json:"day"`
+	Provisioner string `json:"provisioner"`
+	Issued      int64  `json:"issued"`
+	Renewed     int64  `json:"renewed"`
+	Revoked     int64  `json:"revoked"`
+}
+
+// incrementStats updates the counter of the given event in the database and in
+// the metrics. The stats are not critical, so errors are logged instead of
+// failing the request. With asynchronous writes the counters are aggregated
+// and stored with the next batch of certificates.
+func (a *Authority) incrementStats(provisionerName, event string) {
+	metrics.X509Certificates.Inc(provisionerName, event)
+	now := time.Now()
+	if a.writer != nil && a.writer.IncrementStats(now, provisionerName, event) == nil {
+		return
+	}
+	if err := a.db.IncrementStats(now, provisionerName, event); err != nil && err != db.ErrNotImplemented {
+		log.Printf("error updating %s stats of provisioner %s: %v", event, provisionerName, err)
+	}
+}
+
+// GetStats returns the number of certificates issued, renewed and revoked per
+// provisioner and day, in UTC, sorted by day and provisioner name. Only the
+// days between from and to, both included, are returned; a zero time does not
+// limit the range.
+func (a *Authority) GetStats(from, to time.Time) ([]*ProvisionerStats, error) {
+	entries, err := a.getReadDB().GetStats()
+	switch err {
+	case nil:
+	case db.ErrNotImplemented:
+		return nil, &apiError{errors.New("getStats: no persistence layer configured"),
+			http.StatusNotImplemented, apiCtx{}}
+	default:
+		return nil, &apiError{errors.Wrap(err, "getStats"),
+			http.StatusInternalServerError, apiCtx{}}
+	}
+
+	var fromDay, toDay string
+	if !from.IsZero() {
+		fromDay = from.UTC().Format("2006-01-02")
+	}
+	if !to.IsZero() {
+		toDay = to.UTC().Format("2006-01-02")
+	}
+
+	index := make(map[string]*ProvisionerStats)
+	stats := []*ProvisionerStats{}
+	for _, e := range entries {
+		if (fromDay != "" && e.Day < fromDay) || (toDay != "" && e.Day > toDay) {
+			continue
+		}
+		key := e.Day + "/" + e.Provisioner
+		ps, ok := index[key]
+		if !ok {
+			ps = &ProvisionerStats{Day: e.Day, Provisioner: e.Provisioner}
+			index[key] = ps
+			stats = append(stats, ps)
+		}
+		switch e.Event {
+		case db.StatsIssued:
+			ps.Issued += e.Count
+		case db.StatsRenewed:
+			ps.Renewed += e.Count
+		case db.StatsRevoked:
+			ps.Revoked += e.Count
+		}
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Day == stats[j].Day {
+			return stats[i].Provisioner < stats[j].Provisioner
+		}
+		return stats[i].Day < stats[j].Day
+	})
+	return stats, nil
+}
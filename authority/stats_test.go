@@ -0,0 +1,66 @@
+package authority
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+func TestAuthority_GetStats(t *testing.T) {
+	entries := []*db.StatsEntry{
+		{Day: "2019-10-02", Provisioner: "step-cli", Event: db.StatsIssued, Count: 3},
+		{Day: "2019-10-01", Provisioner: "step-cli", Event: db.StatsIssued, Count: 5},
+		{Day: "2019-10-02", Provisioner: "step-cli", Event: db.StatsRenewed, Count: 2},
+		{Day: "2019-10-02", Provisioner: "Max", Event: db.StatsRevoked, Count: 1},
+		{Day: "2019-10-03", Provisioner: "Max", Event: db.StatsIssued, Count: 7},
+		{Day: "2019-10-03", Provisioner: "Max", Event: "foo", Count: 9},
+	}
+	day := func(s string) time.Time {
+		d, err := time.Parse("2006-01-02", s)
+		assert.FatalError(t, err)
+		return d
+	}
+
+	tests := []struct {
+		name     string
+		db       *MockAuthDB
+		from, to time.Time
+		want     []*ProvisionerStats
+		code     int
+	}{
+		{"ok", &MockAuthDB{ret1: entries}, time.Time{}, time.Time{}, []*ProvisionerStats{
+			{Day: "2019-10-01", Provisioner: "step-cli", Issued: 5},
+			{Day: "2019-10-02", Provisioner: "Max", Revoked: 1},
+			{Day: "2019-10-02", Provisioner: "step-cli", Issued: 3, Renewed: 2},
+			{Day: "2019-10-03", Provisioner: "Max", Issued: 7},
+		}, 0},
+		{"ok/range", &MockAuthDB{ret1: entries}, day("2019-10-02"), day("2019-10-02").Add(12 * time.Hour), []*ProvisionerStats{
+			{Day: "2019-10-02", Provisioner: "Max", Revoked: 1},
+			{Day: "2019-10-02", Provisioner: "step-cli", Issued: 3, Renewed: 2},
+		}, 0},
+		{"ok/empty", &MockAuthDB{ret1: []*db.StatsEntry{}}, time.Time{}, time.Time{}, []*ProvisionerStats{}, 0},
+		{"fail/not-implemented", &MockAuthDB{err: db.ErrNotImplemented}, time.Time{}, time.Time{}, nil, http.StatusNotImplemented},
+		{"fail/db", &MockAuthDB{err: errors.New("force")}, time.Time{}, time.Time{}, nil, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t)
+			a.db = tt.db
+			got, err := a.GetStats(tt.from, tt.to)
+			if tt.code != 0 {
+				if assert.NotNil(t, err) {
+					if v, ok := err.(*apiError); assert.True(t, ok) {
+						assert.Equals(t, tt.code, v.code)
+					}
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
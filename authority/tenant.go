@@ -0,0 +1,87 @@
+package authority
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// TenantPathPrefix is the prefix of the paths routed to the tenants, the
+// endpoints of the tenant foo are served under /tenants/foo.
+const TenantPathPrefix = "/tenants/"
+
+var tenantNameRegexp = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// TenantConfig is the configuration of an independent authority served by the
+// same process. Config is the path to the configuration file of the tenant,
+// with its own roots, intermediate, provisioners, claims and database; the
+// addresses and servers of that file are ignored. The requests are routed to
+// the tenant by its name in the path, /tenants/<name>, or by the server name
+// or host of the request if it is one of the Hosts.
+type TenantConfig struct {
+	Name   string   `json:"name"`
+	Config string   `json:"config"`
+	Hosts  []string `json:"hosts,omitempty"`
+}
+
+// Validate validates the tenant configuration.
+func (c *TenantConfig) Validate() error {
+	switch {
+	case c == nil:
+		return errors.New("tenants cannot contain empty values")
+	case !tenantNameRegexp.MatchString(c.Name):
+		return errors.Errorf("tenant name %s is not valid, it can only contain lowercase letters, numbers and hyphens", c.Name)
+	case c.Config == "":
+		return errors.Errorf("tenant %s config cannot be empty", c.Name)
+	}
+	for _, h := range c.Hosts {
+		if h == "" || strings.ContainsAny(h, ":/") {
+			return errors.Errorf("tenant %s host %s is not valid", c.Name, h)
+		}
+	}
+	return nil
+}
+
+// GetPathPrefix returns the prefix of the paths of the tenant.
+func (c *TenantConfig) GetPathPrefix() string {
+	return TenantPathPrefix + c.Name
+}
+
+// Load loads the configuration of the tenant. The address of the tenant is
+// the one of the given parent configuration.
+func (c *TenantConfig) Load(parent *Config) (*Config, error) {
+	config, err := LoadConfiguration(c.Config)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error loading tenant %s", c.Name)
+	}
+	if len(config.Tenants) > 0 {
+		return nil, errors.Errorf("error loading tenant %s: tenants cannot be nested", c.Name)
+	}
+	config.Address = parent.Address
+	return config, nil
+}
+
+// validateTenants validates the tenants, their names and hosts must be
+// unique.
+func validateTenants(tenants []*TenantConfig) error {
+	names := make(map[string]bool)
+	hosts := make(map[string]bool)
+	for _, t := range tenants {
+		if err := t.Validate(); err != nil {
+			return err
+		}
+		if names[t.Name] {
+			return errors.Errorf("tenant %s is duplicated", t.Name)
+		}
+		names[t.Name] = true
+		for _, h := range t.Hosts {
+			h = strings.ToLower(h)
+			if hosts[h] {
+				return errors.Errorf("tenant host %s is duplicated", h)
+			}
+			hosts[h] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package authority
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestTenantConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *TenantConfig
+		wantErr bool
+	}{
+		{"ok", &TenantConfig{Name: "acme-1", Config: "tenant.json"}, false},
+		{"ok-hosts", &TenantConfig{Name: "a", Config: "tenant.json", Hosts: []string{"ca.acme.com"}}, false},
+		{"fail-nil", nil, true},
+		{"fail-name-empty", &TenantConfig{Config: "tenant.json"}, true},
+		{"fail-name-upper", &TenantConfig{Name: "Acme", Config: "tenant.json"}, true},
+		{"fail-name-slash", &TenantConfig{Name: "acme/1", Config: "tenant.json"}, true},
+		{"fail-name-hyphen", &TenantConfig{Name: "acme-", Config: "tenant.json"}, true},
+		{"fail-config", &TenantConfig{Name: "acme"}, true},
+		{"fail-host-empty", &TenantConfig{Name: "acme", Config: "tenant.json", Hosts: []string{""}}, true},
+		{"fail-host-port", &TenantConfig{Name: "acme", Config: "tenant.json", Hosts: []string{"ca.acme.com:443"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("TenantConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_validateTenants(t *testing.T) {
+	assert.NoError(t, validateTenants(nil))
+	assert.NoError(t, validateTenants([]*TenantConfig{
+		{Name: "a", Config: "a.json", Hosts: []string{"a.example.com"}},
+		{Name: "b", Config: "b.json", Hosts: []string{"b.example.com"}},
+	}))
+	assert.Error(t, validateTenants([]*TenantConfig{
+		{Name: "a", Config: "a.json"},
+		{Name: "a", Config: "b.json"},
+	}))
+	assert.Error(t, validateTenants([]*TenantConfig{
+		{Name: "a", Config: "a.json", Hosts: []string{"ca.example.com"}},
+		{Name: "b", Config: "b.json", Hosts: []string{"CA.example.com"}},
+	}))
+	assert.Error(t, validateTenants([]*TenantConfig{{Name: "a"}}))
+}
+
+func TestTenantConfig_Load(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tenants")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+	write := func(name, data string) string {
+		fn := filepath.Join(dir, name)
+		assert.FatalError(t, ioutil.WriteFile(fn, []byte(data), 0600))
+		return fn
+	}
+
+	parent := &Config{Address: "127.0.0.1:9000"}
+	tc := &TenantConfig{Name: "a", Config: write("a.json", `{"address":":443","dnsNames":["a.example.com"]}`)}
+	config, err := tc.Load(parent)
+	assert.FatalError(t, err)
+	assert.Equals(t, "127.0.0.1:9000", config.Address)
+	assert.Equals(t, []string{"a.example.com"}, config.DNSNames)
+	assert.Equals(t, "/tenants/a", tc.GetPathPrefix())
+
+	tc = &TenantConfig{Name: "b", Config: write("b.json", `{"tenants":[{"name":"c","config":"c.json"}]}`)}
+	_, err = tc.Load(parent)
+	assert.Error(t, err)
+
+	tc = &TenantConfig{Name: "c", Config: filepath.Join(dir, "missing.json")}
+	_, err = tc.Load(parent)
+	assert.Error(t, err)
+}
@@ -0,0 +1,112 @@
+package authority
+
+import (
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultSignTimeout is the default timeout of the requests to the
+	// endpoints that sign or revoke certificates.
+	DefaultSignTimeout = 30 * time.Second
+	// DefaultReadTimeout is the default timeout of the requests to the
+	// lightweight endpoints.
+	DefaultReadTimeout = 10 * time.Second
+)
+
+// SignEndpoints are the route patterns of the endpoints that use the sign
+// timeout. These endpoints might use an HSM or a remote database and they can
+// take longer than the rest.
+var SignEndpoints = map[string]bool{
+	"/sign":                       true,
+	"/renew":                      true,
+	"/re-sign":                    true,
+	"/rekey":                      true,
+	"/revoke":                     true,
+	"/sign-ssh":                   true,
+	"/admin/ca/import":            true,
+	"/admin/pending/{id}/approve": true,
+}
+
+// streamingEndpoints are the route patterns of the endpoints that keep the
+// connection open, they don't have a timeout unless it is configured.
+var streamingEndpoints = map[string]bool{
+	"/events": true,
+}
+
+// TimeoutConfig is the configuration of the timeouts of the requests to the
+// CA API. Sign is the timeout of the endpoints in SignEndpoints, Read is the
+// timeout of the rest of endpoints and Endpoints overrides the timeout of an
+// endpoint, where the key is the route pattern, e.g. /health. A timeout of 0
+// disables it.
+type TimeoutConfig struct {
+	Sign      *provisioner.Duration            `json:"sign,omitempty"`
+	Read      *provisioner.Duration            `json:"read,omitempty"`
+	Endpoints map[string]*provisioner.Duration `json:"endpoints,omitempty"`
+}
+
+// Validate validates the timeouts configuration.
+func (c *TimeoutConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.Sign != nil && c.Sign.Duration < 0:
+		return errors.New("timeouts.sign cannot be negative")
+	case c.Read != nil && c.Read.Duration < 0:
+		return errors.New("timeouts.read cannot be negative")
+	}
+	for path, d := range c.Endpoints {
+		if d == nil || d.Duration < 0 {
+			return errors.Errorf("timeouts.endpoints.%s cannot be empty or negative", path)
+		}
+	}
+	return nil
+}
+
+// Timeout returns the timeout of the requests to the given route pattern. It
+// returns 0 if the requests do not have a timeout.
+func (c *TimeoutConfig) Timeout(pattern string) time.Duration {
+	if c != nil {
+		if d, ok := c.Endpoints[pattern]; ok {
+			return d.Duration
+		}
+	}
+	switch {
+	case streamingEndpoints[pattern]:
+		return 0
+	case SignEndpoints[pattern]:
+		if c != nil && c.Sign != nil {
+			return c.Sign.Duration
+		}
+		return DefaultSignTimeout
+	default:
+		if c != nil && c.Read != nil {
+			return c.Read.Duration
+		}
+		return DefaultReadTimeout
+	}
+}
+
+// Max returns the longest timeout of the requests to the CA API.
+func (c *TimeoutConfig) Max() time.Duration {
+	max := c.Timeout("/sign")
+	if d := c.Timeout("/health"); d > max {
+		max = d
+	}
+	if c != nil {
+		for _, d := range c.Endpoints {
+			if d.Duration > max {
+				max = d.Duration
+			}
+		}
+	}
+	return max
+}
+
+// GetTimeouts returns the configuration of the timeouts of the requests. It
+// returns nil if it is not configured and the defaults must be used.
+func (a *Authority) GetTimeouts() *TimeoutConfig {
+	return a.config.Timeouts
+}
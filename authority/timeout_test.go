@@ -0,0 +1,74 @@
+package authority
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/smallstep/assert"
+)
+
+func TestTimeoutConfig_Timeout(t *testing.T) {
+	d := func(d time.Duration) *provisioner.Duration {
+		return &provisioner.Duration{Duration: d}
+	}
+	tests := []struct {
+		name    string
+		config  *TimeoutConfig
+		pattern string
+		want    time.Duration
+	}{
+		{"nil-read", nil, "/health", DefaultReadTimeout},
+		{"nil-sign", nil, "/sign", DefaultSignTimeout},
+		{"nil-streaming", nil, "/events", 0},
+		{"read", &TimeoutConfig{Read: d(time.Second)}, "/roots", time.Second},
+		{"sign", &TimeoutConfig{Sign: d(time.Minute)}, "/sign-ssh", time.Minute},
+		{"disabled", &TimeoutConfig{Sign: d(0)}, "/sign", 0},
+		{"endpoint", &TimeoutConfig{Read: d(time.Second), Endpoints: map[string]*provisioner.Duration{"/health": d(100 * time.Millisecond)}}, "/health", 100 * time.Millisecond},
+		{"endpoint-streaming", &TimeoutConfig{Endpoints: map[string]*provisioner.Duration{"/events": d(time.Hour)}}, "/events", time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equals(t, tt.want, tt.config.Timeout(tt.pattern))
+		})
+	}
+}
+
+func TestTimeoutConfig_Max(t *testing.T) {
+	var nilConfig *TimeoutConfig
+	assert.Equals(t, DefaultSignTimeout, nilConfig.Max())
+	config := &TimeoutConfig{
+		Read: &provisioner.Duration{Duration: time.Minute},
+	}
+	assert.Equals(t, time.Minute, config.Max())
+	config.Endpoints = map[string]*provisioner.Duration{
+		"/events": {Duration: time.Hour},
+	}
+	assert.Equals(t, time.Hour, config.Max())
+}
+
+func TestTimeoutConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *TimeoutConfig
+		err    string
+	}{
+		{"nil", nil, ""},
+		{"ok", &TimeoutConfig{Sign: &provisioner.Duration{Duration: time.Minute}, Endpoints: map[string]*provisioner.Duration{"/health": {Duration: 0}}}, ""},
+		{"fail-sign", &TimeoutConfig{Sign: &provisioner.Duration{Duration: -1}}, "timeouts.sign cannot be negative"},
+		{"fail-read", &TimeoutConfig{Read: &provisioner.Duration{Duration: -1}}, "timeouts.read cannot be negative"},
+		{"fail-endpoint", &TimeoutConfig{Endpoints: map[string]*provisioner.Duration{"/sign": nil}}, "timeouts.endpoints./sign cannot be empty or negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.err != "" {
+				if assert.NotNil(t, err) {
+					assert.Equals(t, tt.err, err.Error())
+				}
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package authority
 
 import (
+	"context"
+	"crypto"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/asn1"
@@ -10,8 +12,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/RTradeLtd/ca-certificates/audit"
 	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
 	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/RTradeLtd/ca-certificates/events"
 	"github.com/RTradeLtd/ca-cli/crypto/pemutil"
 	"github.com/RTradeLtd/ca-cli/crypto/tlsutil"
 	"github.com/RTradeLtd/ca-cli/crypto/x509util"
@@ -23,7 +27,10 @@ func (a *Authority) GetTLSOptions() *tlsutil.TLSOptions {
 	return a.config.TLS
 }
 
-var oidAuthorityKeyIdentifier = asn1.ObjectIdentifier{2, 5, 29, 35}
+var (
+	oidAuthorityKeyIdentifier = asn1.ObjectIdentifier{2, 5, 29, 35}
+	oidSubjectKeyIdentifier   = asn1.ObjectIdentifier{2, 5, 29, 14}
+)
 
 func withDefaultASN1DN(def *x509util.ASN1DN) x509util.WithOption {
 	return func(p x509util.Profile) error {
@@ -55,16 +62,52 @@ func withDefaultASN1DN(def *x509util.ASN1DN) x509util.WithOption {
 	}
 }
 
-// Sign creates a signed certificate from a certificate signing request.
-func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.Options, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+const (
+	// IssuerExpiryTruncate caps the expiration of the new certificates at the
+	// expiration of their issuer. It is the default.
+	IssuerExpiryTruncate = "truncate"
+	// IssuerExpiryReject rejects the certificates that would expire after
+	// their issuer.
+	IssuerExpiryReject = "reject"
+)
+
+// applyIssuerExpiry applies the authority.issuerExpiry policy to a new
+// certificate that would expire after its issuer, an expiration that clients
+// cannot use. By default the expiration is truncated, with the reject policy
+// an error is returned.
+func (a *Authority) applyIssuerExpiry(crt, issuer *x509.Certificate) error {
+	if !crt.NotAfter.After(issuer.NotAfter) {
+		return nil
+	}
+	if a.config.AuthorityConfig != nil && a.config.AuthorityConfig.IssuerExpiry == IssuerExpiryReject {
+		return errors.Errorf("certificate would expire on %s, after its issuer expires on %s",
+			crt.NotAfter.UTC().Format(time.RFC3339), issuer.NotAfter.UTC().Format(time.RFC3339))
+	}
+	crt.NotAfter = issuer.NotAfter
+	return nil
+}
+
+// Sign creates a signed certificate from a certificate signing request. The
+// certificate is not signed nor stored if the context is done.
+func (a *Authority) Sign(ctx context.Context, csr *x509.CertificateRequest, signOpts provisioner.Options, extraOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
 	var (
 		errContext     = apiCtx{"csr": csr, "signOptions": signOpts}
 		mods           = []x509util.WithOption{withDefaultASN1DN(a.config.AuthorityConfig.Template)}
 		certValidators = []provisioner.CertificateValidator{}
-		issIdentity    = a.intermediateIdentity
+		issIdentity    = a.getIntermediateIdentity()
+		certData       *db.CertificateData
 	)
 	for _, op := range extraOpts {
 		switch k := op.(type) {
+		case approvalRequiredOption:
+			return nil, &apiError{errors.Errorf("sign: certificate requests from provisioner %s require approval", k.provisioner),
+				http.StatusForbidden, errContext}
+		case certificateDataOption:
+			certData = k.data
+		case keyGenerationOption:
+			// The key has already been generated by GenerateKey.
+		case jwtSVIDOption:
+			// Only used by SignJWTSVID.
 		case provisioner.CertificateValidator:
 			certValidators = append(certValidators, k)
 		case provisioner.CertificateRequestValidator:
@@ -84,7 +127,8 @@ func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.Opti
 			http.StatusBadRequest, errContext}
 	}
 
-	leaf, err := x509util.NewLeafProfileWithCSR(csr, issIdentity.Crt, issIdentity.Key, mods...)
+	leaf, err := x509util.NewLeafProfileWithCSR(csr, issIdentity.Crt,
+		signerWithContext(ctx, issIdentity.Key), mods...)
 	if err != nil {
 		return nil, &apiError{errors.Wrapf(err, "sign"), http.StatusInternalServerError, errContext}
 	}
@@ -94,11 +138,17 @@ func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.Opti
 			return nil, &apiError{errors.Wrap(err, "sign"), http.StatusUnauthorized, errContext}
 		}
 	}
+	if err := a.applyIssuerExpiry(leaf.Subject(), issIdentity.Crt); err != nil {
+		return nil, &apiError{errors.Wrap(err, "sign"), http.StatusBadRequest, errContext}
+	}
 
+	if err := checkContext(ctx, "sign", errContext); err != nil {
+		return nil, err
+	}
 	crtBytes, err := leaf.CreateCertificate()
 	if err != nil {
 		return nil, &apiError{errors.Wrap(err, "sign: error creating new leaf certificate"),
-			http.StatusInternalServerError, errContext}
+			signerErrorStatus(err), errContext}
 	}
 
 	serverCert, err := x509.ParseCertificate(crtBytes)
@@ -107,37 +157,61 @@ func (a *Authority) Sign(csr *x509.CertificateRequest, signOpts provisioner.Opti
 			http.StatusInternalServerError, errContext}
 	}
 
-	caCert, err := x509.ParseCertificate(issIdentity.Crt.Raw)
-	if err != nil {
-		return nil, &apiError{errors.Wrap(err, "sign: error parsing intermediate certificate"),
-			http.StatusInternalServerError, errContext}
+	if err := checkContext(ctx, "sign", errContext); err != nil {
+		return nil, err
 	}
-
-	if err = a.db.StoreCertificate(serverCert); err != nil {
-		if err != db.ErrNotImplemented {
-			return nil, &apiError{errors.Wrap(err, "sign: error storing certificate in db"),
-				http.StatusInternalServerError, errContext}
-		}
+	if err = a.storeCertificate(serverCert, certData); err != nil {
+		return nil, &apiError{errors.Wrap(err, "sign"), http.StatusInternalServerError, errContext}
 	}
+	provisionerName := a.getCertificateProvisionerName(serverCert)
+	a.incrementStats(provisionerName, db.StatsIssued)
+	a.publishCertificateEvent(events.CertificateIssued, serverCert, provisionerName)
+	a.auditCertificate(ctx, audit.Issue, serverCert, provisionerName, certData)
 
-	return []*x509.Certificate{serverCert, caCert}, nil
+	return []*x509.Certificate{serverCert, issIdentity.Crt}, nil
 }
 
 // Renew creates a new Certificate identical to the old certificate, except
 // with a validity window that begins 'now'.
-func (a *Authority) Renew(oldCert *x509.Certificate) ([]*x509.Certificate, error) {
+func (a *Authority) Renew(ctx context.Context, oldCert *x509.Certificate) ([]*x509.Certificate, error) {
+	return a.Rekey(ctx, oldCert, nil)
+}
+
+// Rekey creates a new Certificate identical to the old certificate, except
+// with a validity window that begins 'now' and the given public key. If the
+// public key is nil the key of the old certificate is used.
+func (a *Authority) Rekey(ctx context.Context, oldCert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error) {
 	// Check step provisioner extensions
 	if err := a.authorizeRenewal(oldCert); err != nil {
 		return nil, err
 	}
 
+	isRekey := (pk != nil)
+	if !isRekey {
+		if err := a.authorizeRenewalKey(ctx, oldCert); err != nil {
+			return nil, err
+		}
+		// In the short-lived mode the renewals of the same certificate
+		// return the same new certificate.
+		if a.renewals != nil {
+			return a.renewals.do(oldCert.SerialNumber.String(), func() ([]*x509.Certificate, error) {
+				return a.rekey(ctx, oldCert, oldCert.PublicKey, false)
+			})
+		}
+		pk = oldCert.PublicKey
+	}
+	return a.rekey(ctx, oldCert, pk, isRekey)
+}
+
+// rekey issues the new certificate of an authorized renewal or rekey.
+func (a *Authority) rekey(ctx context.Context, oldCert *x509.Certificate, pk crypto.PublicKey, isRekey bool) ([]*x509.Certificate, error) {
 	// Issuer
-	issIdentity := a.intermediateIdentity
+	issIdentity := a.getIntermediateIdentity()
 
 	now := time.Now().UTC()
 	duration := oldCert.NotAfter.Sub(oldCert.NotBefore)
 	newCert := &x509.Certificate{
-		PublicKey:                   oldCert.PublicKey,
+		PublicKey:                   pk,
 		Issuer:                      issIdentity.Crt.Subject,
 		Subject:                     oldCert.Subject,
 		NotBefore:                   now,
@@ -171,22 +245,34 @@ func (a *Authority) Renew(oldCert *x509.Certificate) ([]*x509.Certificate, error
 
 	// Copy all extensions except for Authority Key Identifier. This one might
 	// be different if we rotate the intermediate certificate and it will cause
-	// a TLS bad certificate error.
+	// a TLS bad certificate error. On a rekey the Subject Key Identifier is
+	// also skipped, the new one is generated from the new key.
 	for _, ext := range oldCert.Extensions {
-		if !ext.Id.Equal(oidAuthorityKeyIdentifier) {
-			newCert.ExtraExtensions = append(newCert.ExtraExtensions, ext)
+		if ext.Id.Equal(oidAuthorityKeyIdentifier) {
+			continue
 		}
+		if isRekey && ext.Id.Equal(oidSubjectKeyIdentifier) {
+			continue
+		}
+		newCert.ExtraExtensions = append(newCert.ExtraExtensions, ext)
+	}
+
+	if err := a.applyIssuerExpiry(newCert, issIdentity.Crt); err != nil {
+		return nil, &apiError{errors.Wrap(err, "renew"), http.StatusBadRequest, apiCtx{}}
 	}
 
 	leaf, err := x509util.NewLeafProfileWithTemplate(newCert,
-		issIdentity.Crt, issIdentity.Key)
+		issIdentity.Crt, signerWithContext(ctx, issIdentity.Key))
 	if err != nil {
 		return nil, &apiError{err, http.StatusInternalServerError, apiCtx{}}
 	}
+	if err := checkContext(ctx, "renew", apiCtx{}); err != nil {
+		return nil, err
+	}
 	crtBytes, err := leaf.CreateCertificate()
 	if err != nil {
 		return nil, &apiError{errors.Wrap(err, "error renewing certificate from existing server certificate"),
-			http.StatusInternalServerError, apiCtx{}}
+			signerErrorStatus(err), apiCtx{}}
 	}
 
 	serverCert, err := x509.ParseCertificate(crtBytes)
@@ -194,13 +280,23 @@ func (a *Authority) Renew(oldCert *x509.Certificate) ([]*x509.Certificate, error
 		return nil, &apiError{errors.Wrap(err, "error parsing new server certificate"),
 			http.StatusInternalServerError, apiCtx{}}
 	}
-	caCert, err := x509.ParseCertificate(issIdentity.Crt.Raw)
-	if err != nil {
-		return nil, &apiError{errors.Wrap(err, "error parsing intermediate certificate"),
-			http.StatusInternalServerError, apiCtx{}}
+
+	if err := checkContext(ctx, "renew", apiCtx{}); err != nil {
+		return nil, err
 	}
+	certData := &db.CertificateData{RenewedFrom: oldCert.SerialNumber.String()}
+	if oldData, err := a.db.GetCertificateData(certData.RenewedFrom); err == nil && oldData != nil {
+		certData.TokenSubject = oldData.TokenSubject
+	}
+	if err = a.storeCertificate(serverCert, certData); err != nil {
+		return nil, &apiError{err, http.StatusInternalServerError, apiCtx{}}
+	}
+	provisionerName := a.getCertificateProvisionerName(serverCert)
+	a.incrementStats(provisionerName, db.StatsRenewed)
+	a.publishCertificateEvent(events.CertificateRenewed, serverCert, provisionerName)
+	a.auditCertificate(ctx, audit.Renew, serverCert, provisionerName, certData)
 
-	return []*x509.Certificate{serverCert, caCert}, nil
+	return []*x509.Certificate{serverCert, issIdentity.Crt}, nil
 }
 
 // RevokeOptions are the options for the Revoke API.
@@ -219,8 +315,8 @@ type RevokeOptions struct {
 // NOTE: Only supports passive revocation - prevent existing certificates from
 // being renewed.
 //
-// TODO: Add OCSP and CRL support.
-func (a *Authority) Revoke(opts *RevokeOptions) error {
+// TODO: Add OCSP support.
+func (a *Authority) Revoke(ctx context.Context, opts *RevokeOptions) error {
 	errContext := apiCtx{
 		"serialNumber": opts.Serial,
 		"reasonCode":   opts.ReasonCode,
@@ -243,7 +339,7 @@ func (a *Authority) Revoke(opts *RevokeOptions) error {
 	}
 
 	// Authorize mTLS or token request and get back a provisioner interface.
-	p, err := a.authorizeRevoke(opts)
+	p, err := a.authorizeRevoke(ctx, opts)
 	if err != nil {
 		return &apiError{errors.Wrap(err, "revoke"),
 			http.StatusUnauthorized, errContext}
@@ -259,11 +355,25 @@ func (a *Authority) Revoke(opts *RevokeOptions) error {
 		errContext["tokenID"] = rci.TokenID
 	}
 	rci.ProvisionerID = p.GetID()
+	rci.RevokedBy = revokeActor(ctx, p, opts)
 	errContext["provisionerID"] = rci.ProvisionerID
 
+	if err := checkContext(ctx, "revoke", errContext); err != nil {
+		return err
+	}
 	err = a.db.Revoke(rci)
 	switch err {
 	case nil:
+		a.incrementStats(p.GetName(), db.StatsRevoked)
+		a.events.Publish(events.CertificateRevoked, &events.RevocationData{
+			Serial:      rci.Serial,
+			Provisioner: p.GetName(),
+			ReasonCode:  rci.ReasonCode,
+			Reason:      rci.Reason,
+			MTLS:        rci.MTLS,
+		})
+		a.auditRevocation(ctx, rci, p.GetName())
+		a.regenerateCRL()
 		return nil
 	case db.ErrNotImplemented:
 		return &apiError{errors.New("revoke: no persistence layer configured"),
@@ -276,11 +386,14 @@ func (a *Authority) Revoke(opts *RevokeOptions) error {
 	}
 }
 
-// GetTLSCertificate creates a new leaf certificate to be used by the CA HTTPS server.
+// GetTLSCertificate creates a new leaf certificate to be used by the CA HTTPS
+// server, with a new key and signed by the current intermediate.
 func (a *Authority) GetTLSCertificate() (*tls.Certificate, error) {
+	issIdentity := a.getIntermediateIdentity()
 	profile, err := x509util.NewLeafProfile("Step Online CA",
-		a.intermediateIdentity.Crt, a.intermediateIdentity.Key,
-		x509util.WithHosts(strings.Join(a.config.DNSNames, ",")))
+		issIdentity.Crt, issIdentity.Key,
+		x509util.WithHosts(strings.Join(a.config.DNSNames, ",")),
+		x509util.WithNotBeforeAfterDuration(time.Time{}, time.Time{}, a.config.ServerTLS.GetCertDuration()))
 	if err != nil {
 		return nil, err
 	}
@@ -302,7 +415,7 @@ func (a *Authority) GetTLSCertificate() (*tls.Certificate, error) {
 
 	// Load the x509 key pair (combining server and intermediate blocks)
 	// to a tls.Certificate.
-	intermediatePEM, err := pemutil.Serialize(a.intermediateIdentity.Crt)
+	intermediatePEM, err := pemutil.Serialize(issIdentity.Crt)
 	if err != nil {
 		return nil, err
 	}
@@ -2,6 +2,7 @@ package authority
 
 import (
 	"context"
+	"crypto"
 	"crypto/rand"
 	"crypto/sha1"
 	"crypto/x509"
@@ -110,6 +111,7 @@ func TestSign(t *testing.T) {
 
 	type signTest struct {
 		auth      *Authority
+		ctx       context.Context
 		csr       *x509.CertificateRequest
 		signOpts  provisioner.Options
 		extraOpts []provisioner.SignOption
@@ -255,6 +257,29 @@ ZYtQ9Ot36qc=
 				},
 			}
 		},
+		"fail canceled context": func(t *testing.T) *signTest {
+			csr := getCSR(t, priv)
+			_a := testAuthority(t)
+			_a.db = &MockAuthDB{
+				storeCertificate: func(crt *x509.Certificate) error {
+					t.Error("certificate stored with a canceled context")
+					return nil
+				},
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			return &signTest{
+				auth:      _a,
+				ctx:       ctx,
+				csr:       csr,
+				extraOpts: extraOpts,
+				signOpts:  signOpts,
+				err: &apiError{errors.New("sign: context canceled"),
+					http.StatusServiceUnavailable,
+					apiCtx{"csr": csr, "signOptions": signOpts},
+				},
+			}
+		},
 		"ok": func(t *testing.T) *signTest {
 			csr := getCSR(t, priv)
 			_a := testAuthority(t)
@@ -276,8 +301,11 @@ ZYtQ9Ot36qc=
 	for name, genTestCase := range tests {
 		t.Run(name, func(t *testing.T) {
 			tc := genTestCase(t)
+			if tc.ctx == nil {
+				tc.ctx = context.Background()
+			}
 
-			certChain, err := tc.auth.Sign(tc.csr, tc.signOpts, tc.extraOpts...)
+			certChain, err := tc.auth.Sign(tc.ctx, tc.csr, tc.signOpts, tc.extraOpts...)
 			if err != nil {
 				if assert.NotNil(t, tc.err) {
 					switch v := err.(type) {
@@ -458,9 +486,9 @@ func TestRenew(t *testing.T) {
 
 			var certChain []*x509.Certificate
 			if tc.auth != nil {
-				certChain, err = tc.auth.Renew(tc.crt)
+				certChain, err = tc.auth.Renew(context.Background(), tc.crt)
 			} else {
-				certChain, err = a.Renew(tc.crt)
+				certChain, err = a.Renew(context.Background(), tc.crt)
 			}
 			if err != nil {
 				if assert.NotNil(t, tc.err) {
@@ -560,6 +588,103 @@ func TestRenew(t *testing.T) {
 	}
 }
 
+func TestRekey(t *testing.T) {
+	pub, _, err := keys.GenerateDefaultKeyPair()
+	assert.FatalError(t, err)
+	newPub, _, err := keys.GenerateDefaultKeyPair()
+	assert.FatalError(t, err)
+
+	a := testAuthority(t)
+	now := time.Now().UTC()
+	newCertificate := func(name string, p *provisioner.JWK) *x509.Certificate {
+		leaf, err := x509util.NewLeafProfile(name, a.intermediateIdentity.Crt,
+			a.intermediateIdentity.Key,
+			x509util.WithNotBeforeAfterDuration(now.Add(-time.Minute*7), now, 0),
+			x509util.WithPublicKey(pub), x509util.WithHosts("test.smallstep.com,test"),
+			withProvisionerOID(p.Name, p.Key.KeyID))
+		assert.FatalError(t, err)
+		crtBytes, err := leaf.CreateCertificate()
+		assert.FatalError(t, err)
+		crt, err := x509.ParseCertificate(crtBytes)
+		assert.FatalError(t, err)
+		return crt
+	}
+	crt := newCertificate("rekey", a.config.AuthorityConfig.Provisioners[0].(*provisioner.JWK))
+	crtNoRenew := newCertificate("norenew", a.config.AuthorityConfig.Provisioners[2].(*provisioner.JWK))
+
+	tests := []struct {
+		name     string
+		crt      *x509.Certificate
+		pk       crypto.PublicKey
+		wantCode int
+	}{
+		{"ok", crt, newPub, 0},
+		{"ok-renew", crt, nil, 0},
+		{"fail-unauthorized", crtNoRenew, newPub, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certChain, err := a.Rekey(context.Background(), tt.crt, tt.pk)
+			if tt.wantCode != 0 {
+				if assert.NotNil(t, err) {
+					assert.Equals(t, tt.wantCode, err.(*apiError).code)
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			leaf := certChain[0]
+			assert.Equals(t, tt.crt.Subject, leaf.Subject)
+			assert.Equals(t, tt.crt.DNSNames, leaf.DNSNames)
+			assert.Equals(t, tt.crt.NotAfter.Sub(tt.crt.NotBefore), leaf.NotAfter.Sub(leaf.NotBefore))
+			assert.True(t, leaf.NotBefore.After(now.Add(-time.Minute)))
+
+			wantPub := tt.pk
+			if wantPub == nil {
+				wantPub = pub
+			}
+			assert.Equals(t, wantPub, leaf.PublicKey)
+			pubBytes, err := x509.MarshalPKIXPublicKey(wantPub)
+			assert.FatalError(t, err)
+			hash := sha1.Sum(pubBytes)
+			assert.Equals(t, hash[:], leaf.SubjectKeyId)
+
+			// The provisioner extension is kept.
+			p, err := a.LoadProvisionerByCertificate(leaf)
+			assert.FatalError(t, err)
+			assert.Equals(t, "Max", p.GetName())
+		})
+	}
+}
+
+func TestAuthority_applyIssuerExpiry(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	issuer := &x509.Certificate{NotAfter: now.Add(time.Hour)}
+	tests := []struct {
+		name     string
+		policy   string
+		notAfter time.Time
+		want     time.Time
+		wantErr  bool
+	}{
+		{"ok", "", now.Add(time.Minute), now.Add(time.Minute), false},
+		{"ok-same-expiration", IssuerExpiryReject, now.Add(time.Hour), now.Add(time.Hour), false},
+		{"ok-truncate-default", "", now.Add(2 * time.Hour), now.Add(time.Hour), false},
+		{"ok-truncate", IssuerExpiryTruncate, now.Add(2 * time.Hour), now.Add(time.Hour), false},
+		{"fail-reject", IssuerExpiryReject, now.Add(2 * time.Hour), now.Add(2 * time.Hour), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t)
+			a.config.AuthorityConfig.IssuerExpiry = tt.policy
+			crt := &x509.Certificate{NotAfter: tt.notAfter}
+			if err := a.applyIssuerExpiry(crt, issuer); (err != nil) != tt.wantErr {
+				t.Errorf("Authority.applyIssuerExpiry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			assert.Equals(t, tt.want, crt.NotAfter)
+		})
+	}
+}
+
 func TestGetTLSOptions(t *testing.T) {
 	type renewTest struct {
 		auth *Authority
@@ -748,6 +873,10 @@ func TestRevoke(t *testing.T) {
 				useToken: func(id, tok string) (bool, error) {
 					return true, nil
 				},
+				revoke: func(rci *db.RevokedCertificateInfo) error {
+					assert.Equals(t, "provisioner:step-cli:sn", rci.RevokedBy)
+					return nil
+				},
 			}
 
 			cl := jwt.Claims{
@@ -816,7 +945,7 @@ func TestRevoke(t *testing.T) {
 	for name, f := range tests {
 		tc := f()
 		t.Run(name, func(t *testing.T) {
-			if err := tc.a.Revoke(tc.opts); err != nil {
+			if err := tc.a.Revoke(context.Background(), tc.opts); err != nil {
 				if assert.NotNil(t, tc.err) {
 					switch v := err.(type) {
 					case *apiError:
@@ -833,3 +962,21 @@ func TestRevoke(t *testing.T) {
 		})
 	}
 }
+
+func TestAuthority_GetTLSCertificate(t *testing.T) {
+	a := testAuthority(t)
+	crt, err := a.GetTLSCertificate()
+	assert.FatalError(t, err)
+	assert.Equals(t, a.config.DNSNames, crt.Leaf.DNSNames)
+	assert.Equals(t, DefaultServerCertDuration, crt.Leaf.NotAfter.Sub(crt.Leaf.NotBefore))
+	assert.Len(t, 2, crt.Certificate)
+
+	// Renewals use a new key.
+	a.config.ServerTLS = &ServerTLSConfig{
+		CertDuration: &provisioner.Duration{Duration: time.Hour},
+	}
+	renewed, err := a.GetTLSCertificate()
+	assert.FatalError(t, err)
+	assert.Equals(t, time.Hour, renewed.Leaf.NotAfter.Sub(renewed.Leaf.NotBefore))
+	assert.NotEquals(t, crt.Leaf.PublicKey, renewed.Leaf.PublicKey)
+}
@@ -0,0 +1,165 @@
+package authority
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"net/http"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ed25519"
+)
+
+// MaxLogEntries is the maximum number of entries of the transparency log
+// returned at once.
+const MaxLogEntries = 1000
+
+// SignedTreeHead is the size and the root hash of the transparency log at a
+// time, signed by the intermediate certificate of the CA. The signature
+// covers the RFC 6962 TreeHeadSignature structure, with the timestamp in
+// milliseconds since the epoch.
+type SignedTreeHead struct {
+	TreeSize  int64  `json:"treeSize"`
+	Timestamp int64  `json:"timestamp"`
+	RootHash  []byte `json:"rootHash"`
+	Signature []byte `json:"signature"`
+}
+
+// treeHeadSignatureInput returns the RFC 6962 TreeHeadSignature structure of
+// the given tree head: the version v1, the signature type tree_hash, the
+// timestamp, the tree size and the root hash.
+func treeHeadSignatureInput(timestamp, treeSize int64, rootHash []byte) []byte {
+	b := make([]byte, 18, 18+len(rootHash))
+	b[0], b[1] = 0, 1
+	binary.BigEndian.PutUint64(b[2:], uint64(timestamp))
+	binary.BigEndian.PutUint64(b[10:], uint64(treeSize))
+	return append(b, rootHash...)
+}
+
+// signTreeHeadInput signs the given input with the given key, using SHA-256
+// for the keys that sign digests.
+func signTreeHeadInput(key interface{}, input []byte) ([]byte, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.Errorf("key type %T is not a crypto.Signer", key)
+	}
+	if _, ok := signer.Public().(ed25519.PublicKey); ok {
+		return signer.Sign(rand.Reader, input, crypto.Hash(0))
+	}
+	sum := sha256.Sum256(input)
+	return signer.Sign(rand.Reader, sum[:], crypto.SHA256)
+}
+
+// GetSignedTreeHead returns the current tree head of the transparency log of
+// the issued certificates signed with the intermediate key.
+func (a *Authority) GetSignedTreeHead() (*SignedTreeHead, error) {
+	th, err := a.getReadDB().GetTreeHead()
+	switch err {
+	case nil:
+	case db.ErrNotImplemented:
+		return nil, &apiError{errors.New("getSignedTreeHead: no persistence layer configured"),
+			http.StatusNotImplemented, apiCtx{}}
+	default:
+		return nil, &apiError{errors.Wrap(err, "getSignedTreeHead"),
+			http.StatusInternalServerError, apiCtx{}}
+	}
+
+	sth, err := a.signTreeHead(th.TreeSize, th.RootHash)
+	if err != nil {
+		return nil, &apiError{errors.Wrap(err, "getSignedTreeHead"),
+			http.StatusInternalServerError, apiCtx{}}
+	}
+	return sth, nil
+}
+
+// signTreeHead returns the tree head with the given size and root hash signed
+// with the intermediate key at the current time.
+func (a *Authority) signTreeHead(treeSize int64, rootHash []byte) (*SignedTreeHead, error) {
+	sth := &SignedTreeHead{
+		TreeSize:  treeSize,
+		Timestamp: time.Now().UnixNano() / int64(time.Millisecond),
+		RootHash:  rootHash,
+	}
+	input := treeHeadSignatureInput(sth.Timestamp, sth.TreeSize, sth.RootHash)
+	sig, err := signTreeHeadInput(a.getIntermediateIdentity().Key, input)
+	if err != nil {
+		return nil, errors.Wrap(err, "error signing tree head")
+	}
+	sth.Signature = sig
+	return sth, nil
+}
+
+// InclusionProof is the proof that a certificate is in the transparency log,
+// with the signed tree head the proof is relative to.
+type InclusionProof struct {
+	LeafIndex      int64           `json:"leafIndex"`
+	LeafHash       []byte          `json:"leafHash"`
+	AuditPath      [][]byte        `json:"auditPath"`
+	SignedTreeHead *SignedTreeHead `json:"sth"`
+}
+
+// GetInclusionProof returns the proof that the certificate with the given
+// serial number is in the transparency log of the given size, or of the
+// current size if treeSize is 0.
+func (a *Authority) GetInclusionProof(serial string, treeSize int64) (*InclusionProof, error) {
+	errContext := apiCtx{"serial": serial, "treeSize": treeSize}
+	p, err := a.getReadDB().GetInclusionProof(serial, treeSize)
+	switch {
+	case err == nil:
+	case err == db.ErrNotImplemented:
+		return nil, &apiError{errors.New("getInclusionProof: no persistence layer configured"),
+			http.StatusNotImplemented, errContext}
+	case err == db.ErrNotFound:
+		return nil, &apiError{errors.Errorf("getInclusionProof: certificate %s is not in the log", serial),
+			http.StatusNotFound, errContext}
+	case errors.Cause(err) == db.ErrInvalidTreeSize:
+		return nil, &apiError{errors.Wrap(err, "getInclusionProof"),
+			http.StatusBadRequest, errContext}
+	default:
+		return nil, &apiError{errors.Wrap(err, "getInclusionProof"),
+			http.StatusInternalServerError, errContext}
+	}
+
+	sth, err := a.signTreeHead(p.TreeSize, p.RootHash)
+	if err != nil {
+		return nil, &apiError{errors.Wrap(err, "getInclusionProof"),
+			http.StatusInternalServerError, errContext}
+	}
+	return &InclusionProof{
+		LeafIndex:      p.LeafIndex,
+		LeafHash:       p.LeafHash,
+		AuditPath:      p.AuditPath,
+		SignedTreeHead: sth,
+	}, nil
+}
+
+// GetLogEntries returns the entries of the transparency log from start to
+// end, both included, up to MaxLogEntries.
+func (a *Authority) GetLogEntries(start, end int64) ([]*db.LogEntry, error) {
+	errContext := apiCtx{"start": start, "end": end}
+	switch {
+	case start < 0:
+		return nil, &apiError{errors.New("getLogEntries: start cannot be negative"),
+			http.StatusBadRequest, errContext}
+	case end < start:
+		return nil, &apiError{errors.New("getLogEntries: end cannot be smaller than start"),
+			http.StatusBadRequest, errContext}
+	case end-start >= MaxLogEntries:
+		end = start + MaxLogEntries - 1
+	}
+
+	entries, err := a.getReadDB().GetLogEntries(start, end)
+	switch err {
+	case nil:
+		return entries, nil
+	case db.ErrNotImplemented:
+		return nil, &apiError{errors.New("getLogEntries: no persistence layer configured"),
+			http.StatusNotImplemented, errContext}
+	default:
+		return nil, &apiError{errors.Wrap(err, "getLogEntries"),
+			http.StatusInternalServerError, errContext}
+	}
+}
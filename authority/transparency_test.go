@@ -0,0 +1,175 @@
+package authority
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/hex"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"golang.org/x/crypto/ed25519"
+)
+
+func ecdsaVerifyASN1(pub *ecdsa.PublicKey, hash, sig []byte) bool {
+	var rs struct {
+		R, S *big.Int
+	}
+	if _, err := asn1.Unmarshal(sig, &rs); err != nil {
+		return false
+	}
+	return ecdsa.Verify(pub, hash, rs.R, rs.S)
+}
+
+func Test_treeHeadSignatureInput(t *testing.T) {
+	root := make([]byte, 32)
+	root[0] = 0xff
+	b := treeHeadSignatureInput(1569888000000, 5, root)
+	assert.Equals(t, "0001"+"0000016d849dd800"+"0000000000000005"+hex.EncodeToString(root), hex.EncodeToString(b))
+}
+
+func Test_signTreeHeadInput(t *testing.T) {
+	input := []byte("tree head")
+	_, key, err := ed25519.GenerateKey(nil)
+	assert.FatalError(t, err)
+	sig, err := signTreeHeadInput(key, input)
+	assert.FatalError(t, err)
+	assert.True(t, ed25519.Verify(key.Public().(ed25519.PublicKey), input, sig))
+
+	_, err = signTreeHeadInput("foo", input)
+	if assert.NotNil(t, err) {
+		assert.Equals(t, "key type string is not a crypto.Signer", err.Error())
+	}
+}
+
+func TestAuthority_GetSignedTreeHead(t *testing.T) {
+	a := testAuthority(t)
+	root := db.RootHash([][]byte{db.LeafHash([]byte("foo"))})
+	a.db = &MockAuthDB{ret1: &db.TreeHead{TreeSize: 1, RootHash: root}}
+	before := time.Now().UnixNano() / int64(time.Millisecond)
+	sth, err := a.GetSignedTreeHead()
+	assert.FatalError(t, err)
+	assert.Equals(t, int64(1), sth.TreeSize)
+	assert.Equals(t, root, sth.RootHash)
+	assert.True(t, sth.Timestamp >= before)
+
+	// The signature is verified with the intermediate certificate.
+	sum := sha256.Sum256(treeHeadSignatureInput(sth.Timestamp, sth.TreeSize, sth.RootHash))
+	pub, ok := a.getIntermediateIdentity().Crt.PublicKey.(*ecdsa.PublicKey)
+	if assert.True(t, ok) {
+		assert.True(t, ecdsaVerifyASN1(pub, sum[:], sth.Signature))
+	}
+
+	for _, tt := range []struct {
+		err  error
+		code int
+	}{
+		{db.ErrNotImplemented, http.StatusNotImplemented},
+		{errors.New("force"), http.StatusInternalServerError},
+	} {
+		a.db = &MockAuthDB{err: tt.err}
+		_, err := a.GetSignedTreeHead()
+		if assert.NotNil(t, err) {
+			if v, ok := err.(*apiError); assert.True(t, ok) {
+				assert.Equals(t, tt.code, v.code)
+			}
+		}
+	}
+}
+
+func TestAuthority_GetLogEntries(t *testing.T) {
+	entries := []*db.LogEntry{{Index: 0, Serial: "1", LeafHash: db.LeafHash([]byte("foo"))}}
+	tests := []struct {
+		name       string
+		db         *MockAuthDB
+		start, end int64
+		wantEnd    int64
+		code       int
+	}{
+		{"ok", &MockAuthDB{ret1: entries}, 0, 10, 10, 0},
+		{"ok/max", &MockAuthDB{ret1: entries}, 10, 5000, 1009, 0},
+		{"fail/start", &MockAuthDB{ret1: entries}, -1, 10, 0, http.StatusBadRequest},
+		{"fail/end", &MockAuthDB{ret1: entries}, 10, 9, 0, http.StatusBadRequest},
+		{"fail/not-implemented", &MockAuthDB{err: db.ErrNotImplemented}, 0, 1, 1, http.StatusNotImplemented},
+		{"fail/db", &MockAuthDB{err: errors.New("force")}, 0, 1, 1, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := testAuthority(t)
+			tt.db.getLogEntries = func(start, end int64) ([]*db.LogEntry, error) {
+				assert.Equals(t, tt.start, start)
+				assert.Equals(t, tt.wantEnd, end)
+				if tt.db.err != nil {
+					return nil, tt.db.err
+				}
+				return entries, nil
+			}
+			a.db = tt.db
+			got, err := a.GetLogEntries(tt.start, tt.end)
+			if tt.code != 0 {
+				if assert.NotNil(t, err) {
+					if v, ok := err.(*apiError); assert.True(t, ok) {
+						assert.Equals(t, tt.code, v.code)
+					}
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, entries, got)
+		})
+	}
+}
+
+func TestAuthority_GetInclusionProof(t *testing.T) {
+	leaves := [][]byte{db.LeafHash([]byte("foo")), db.LeafHash([]byte("bar")), db.LeafHash([]byte("baz"))}
+	proof := &db.InclusionProof{
+		LeafIndex: 1,
+		TreeSize:  3,
+		LeafHash:  leaves[1],
+		AuditPath: db.InclusionPath(1, leaves),
+		RootHash:  db.RootHash(leaves),
+	}
+	a := testAuthority(t)
+	a.db = &MockAuthDB{
+		getProof: func(sn string, treeSize int64) (*db.InclusionProof, error) {
+			assert.Equals(t, "1234", sn)
+			assert.Equals(t, int64(3), treeSize)
+			return proof, nil
+		},
+	}
+	p, err := a.GetInclusionProof("1234", 3)
+	assert.FatalError(t, err)
+	assert.Equals(t, proof.LeafIndex, p.LeafIndex)
+	assert.Equals(t, proof.LeafHash, p.LeafHash)
+	assert.Equals(t, proof.AuditPath, p.AuditPath)
+	if assert.NotNil(t, p.SignedTreeHead) {
+		sth := p.SignedTreeHead
+		assert.Equals(t, int64(3), sth.TreeSize)
+		assert.True(t, db.VerifyInclusion(p.LeafHash, p.LeafIndex, sth.TreeSize, p.AuditPath, sth.RootHash))
+		sum := sha256.Sum256(treeHeadSignatureInput(sth.Timestamp, sth.TreeSize, sth.RootHash))
+		assert.True(t, ecdsaVerifyASN1(a.getIntermediateIdentity().Crt.PublicKey.(*ecdsa.PublicKey), sum[:], sth.Signature))
+	}
+
+	for _, tt := range []struct {
+		err  error
+		code int
+	}{
+		{db.ErrNotImplemented, http.StatusNotImplemented},
+		{db.ErrNotFound, http.StatusNotFound},
+		{errors.Wrap(db.ErrInvalidTreeSize, "tree size 9 is not between 1 and 3"), http.StatusBadRequest},
+		{errors.New("force"), http.StatusInternalServerError},
+	} {
+		a.db = &MockAuthDB{err: tt.err}
+		_, err := a.GetInclusionProof("1234", 9)
+		if assert.NotNil(t, err) {
+			if v, ok := err.(*apiError); assert.True(t, ok) {
+				assert.Equals(t, tt.code, v.code)
+			}
+		}
+	}
+}
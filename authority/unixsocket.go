@@ -0,0 +1,78 @@
+package authority
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultUnixSocketMode is the default permissions of the Unix domain socket.
+const DefaultUnixSocketMode os.FileMode = 0600
+
+// UnixSocketConfig is the configuration of a listener of the CA API on a Unix
+// domain socket, for sidecar deployments. The socket is created at Path with
+// the permissions in Mode, an octal string, and optionally owned by Group, a
+// group name or id. If AdminOnly is set only the health and admin endpoints
+// are served on the socket.
+type UnixSocketConfig struct {
+	Path      string `json:"path"`
+	Mode      string `json:"mode,omitempty"`
+	Group     string `json:"group,omitempty"`
+	AdminOnly bool   `json:"adminOnly,omitempty"`
+}
+
+// Validate validates the Unix domain socket configuration.
+func (c *UnixSocketConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.Path == "" {
+		return errors.New("unixSocket.path cannot be empty")
+	}
+	if c.Mode != "" {
+		if m, err := strconv.ParseUint(c.Mode, 8, 32); err != nil || m > 0777 {
+			return errors.Errorf("unixSocket.mode %s is not valid", c.Mode)
+		}
+	}
+	if c.Group != "" {
+		if _, err := lookupGroupID(c.Group); err != nil {
+			return errors.Wrapf(err, "unixSocket.group %s is not valid", c.Group)
+		}
+	}
+	return nil
+}
+
+// GetMode returns the permissions of the socket.
+func (c *UnixSocketConfig) GetMode() os.FileMode {
+	if m, err := strconv.ParseUint(c.Mode, 8, 32); err == nil && m <= 0777 {
+		return os.FileMode(m)
+	}
+	return DefaultUnixSocketMode
+}
+
+// GetGroupID returns the group id of the socket, or -1 if the group is not
+// configured.
+func (c *UnixSocketConfig) GetGroupID() int {
+	if c.Group == "" {
+		return -1
+	}
+	gid, err := lookupGroupID(c.Group)
+	if err != nil {
+		return -1
+	}
+	return gid
+}
+
+// lookupGroupID returns the id of the given group name or id.
+func lookupGroupID(group string) (int, error) {
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(g.Gid)
+}
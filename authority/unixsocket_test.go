@@ -0,0 +1,39 @@
+package authority
+
+import (
+	"os"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestUnixSocketConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    *UnixSocketConfig
+		wantMode  os.FileMode
+		wantGroup int
+		wantErr   bool
+	}{
+		{"ok-defaults", &UnixSocketConfig{Path: "/run/step-ca/ca.sock"}, 0600, -1, false},
+		{"ok-mode", &UnixSocketConfig{Path: "/run/step-ca/ca.sock", Mode: "0660"}, 0660, -1, false},
+		{"ok-gid", &UnixSocketConfig{Path: "/run/step-ca/ca.sock", Mode: "660", Group: "1000"}, 0660, 1000, false},
+		{"fail-path", &UnixSocketConfig{}, 0, 0, true},
+		{"fail-mode", &UnixSocketConfig{Path: "/run/step-ca/ca.sock", Mode: "rw"}, 0, 0, true},
+		{"fail-mode-range", &UnixSocketConfig{Path: "/run/step-ca/ca.sock", Mode: "1777"}, 0, 0, true},
+		{"fail-group", &UnixSocketConfig{Path: "/run/step-ca/ca.sock", Group: "step-ca-missing-group"}, 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UnixSocketConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				assert.Equals(t, tt.wantMode, tt.config.GetMode())
+				assert.Equals(t, tt.wantGroup, tt.config.GetGroupID())
+			}
+		})
+	}
+	assert.NoError(t, (*UnixSocketConfig)(nil).Validate())
+}
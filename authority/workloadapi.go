@@ -0,0 +1,96 @@
+package authority
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/pkg/errors"
+)
+
+// DefaultWorkloadAttestor is the workload attestor used if none is configured.
+const DefaultWorkloadAttestor = "unix"
+
+// WorkloadAPIConfig is the configuration of the SPIFFE Workload API served on
+// the Unix domain socket at Socket. The workloads are attested by the
+// Attestors, unix by default, and they get an X.509 SVID for each of the
+// Entries whose selectors are all in the selectors of the workload. The SVIDs
+// are signed with one-time tokens minted with Provisioner, that must be in
+// authority.mint, and CertDuration is their validity, the default of the
+// provisioner if it is not set.
+type WorkloadAPIConfig struct {
+	Socket       string                `json:"socket"`
+	TrustDomain  string                `json:"trustDomain"`
+	Provisioner  string                `json:"provisioner"`
+	CertDuration *provisioner.Duration `json:"certDuration,omitempty"`
+	Attestors    []string              `json:"attestors,omitempty"`
+	Entries      []*WorkloadEntry      `json:"entries"`
+}
+
+// WorkloadEntry maps the selectors of a workload, e.g. unix:uid:1000, to a
+// SPIFFE ID in the trust domain.
+type WorkloadEntry struct {
+	SPIFFEID  string   `json:"spiffeID"`
+	Selectors []string `json:"selectors"`
+}
+
+// Validate validates the Workload API configuration.
+func (c *WorkloadAPIConfig) Validate(config *Config) error {
+	if c == nil {
+		return nil
+	}
+	if c.Socket == "" {
+		return errors.New("workloadAPI.socket cannot be empty")
+	}
+	if c.TrustDomain == "" || strings.ContainsAny(c.TrustDomain, ":/") {
+		return errors.Errorf("workloadAPI.trustDomain %s is not valid", c.TrustDomain)
+	}
+	if c.Provisioner == "" {
+		return errors.New("workloadAPI.provisioner cannot be empty")
+	}
+	if !config.AuthorityConfig.canMint(c.Provisioner) {
+		return errors.Errorf("workloadAPI.provisioner %s is not in authority.mint", c.Provisioner)
+	}
+	if c.CertDuration != nil && c.CertDuration.Duration <= 0 {
+		return errors.New("workloadAPI.certDuration must be greater than 0")
+	}
+	if len(c.Entries) == 0 {
+		return errors.New("workloadAPI.entries cannot be empty")
+	}
+	for _, e := range c.Entries {
+		if e == nil {
+			return errors.New("workloadAPI.entries cannot contain empty entries")
+		}
+		u, err := url.Parse(e.SPIFFEID)
+		if err != nil || u.Scheme != "spiffe" || u.Host != c.TrustDomain || u.Path == "" || u.RawQuery != "" || u.Fragment != "" {
+			return errors.Errorf("workloadAPI.entries: spiffeID %s is not valid in the trust domain %s", e.SPIFFEID, c.TrustDomain)
+		}
+		if len(e.Selectors) == 0 {
+			return errors.Errorf("workloadAPI.entries: selectors of %s cannot be empty", e.SPIFFEID)
+		}
+		for _, s := range e.Selectors {
+			if parts := strings.SplitN(s, ":", 2); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return errors.Errorf("workloadAPI.entries: selector %s is not valid", s)
+			}
+		}
+	}
+	return nil
+}
+
+// GetCertDuration returns the validity of the SVIDs, or 0 to use the default
+// of the provisioner.
+func (c *WorkloadAPIConfig) GetCertDuration() time.Duration {
+	if c == nil || c.CertDuration == nil {
+		return 0
+	}
+	return c.CertDuration.Duration
+}
+
+// GetAttestors returns the names of the workload attestors.
+func (c *WorkloadAPIConfig) GetAttestors() []string {
+	if c == nil || len(c.Attestors) == 0 {
+		return []string{DefaultWorkloadAttestor}
+	}
+	return c.Attestors
+}
@@ -0,0 +1,51 @@
+package authority
+
+import (
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestWorkloadAPIConfig_Validate(t *testing.T) {
+	config := &Config{
+		AuthorityConfig: &AuthConfig{
+			Mint: &MintConfig{Provisioners: []*MintProvisioner{{Name: "workload"}}},
+		},
+	}
+	newConfig := func(entries ...*WorkloadEntry) *WorkloadAPIConfig {
+		return &WorkloadAPIConfig{
+			Socket:      "/run/step-ca/workload.sock",
+			TrustDomain: "example.org",
+			Provisioner: "workload",
+			Entries:     entries,
+		}
+	}
+	web := &WorkloadEntry{SPIFFEID: "spiffe://example.org/web", Selectors: []string{"unix:uid:1000"}}
+
+	tests := []struct {
+		name    string
+		config  *WorkloadAPIConfig
+		wantErr bool
+	}{
+		{"ok", newConfig(web), false},
+		{"fail-socket", &WorkloadAPIConfig{TrustDomain: "example.org", Provisioner: "workload", Entries: []*WorkloadEntry{web}}, true},
+		{"fail-trust-domain", &WorkloadAPIConfig{Socket: "/run/step-ca/workload.sock", Provisioner: "workload", Entries: []*WorkloadEntry{web}}, true},
+		{"fail-provisioner", &WorkloadAPIConfig{Socket: "/run/step-ca/workload.sock", TrustDomain: "example.org", Provisioner: "foo", Entries: []*WorkloadEntry{web}}, true},
+		{"fail-no-entries", newConfig(), true},
+		{"fail-nil-entry", newConfig(nil), true},
+		{"fail-spiffe-id-scheme", newConfig(&WorkloadEntry{SPIFFEID: "https://example.org/web", Selectors: []string{"unix:uid:1000"}}), true},
+		{"fail-spiffe-id-trust-domain", newConfig(&WorkloadEntry{SPIFFEID: "spiffe://example.com/web", Selectors: []string{"unix:uid:1000"}}), true},
+		{"fail-spiffe-id-path", newConfig(&WorkloadEntry{SPIFFEID: "spiffe://example.org", Selectors: []string{"unix:uid:1000"}}), true},
+		{"fail-no-selectors", newConfig(&WorkloadEntry{SPIFFEID: "spiffe://example.org/web"}), true},
+		{"fail-selector", newConfig(&WorkloadEntry{SPIFFEID: "spiffe://example.org/web", Selectors: []string{"unix"}}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(config); (err != nil) != tt.wantErr {
+				t.Errorf("WorkloadAPIConfig.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+	assert.NoError(t, (*WorkloadAPIConfig)(nil).Validate(config))
+	assert.Equals(t, []string{"unix"}, newConfig(web).GetAttestors())
+}
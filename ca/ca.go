@@ -1,31 +1,55 @@
 package ca
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"reflect"
+	"sync"
+	"time"
 
 	"github.com/RTradeLtd/ca-certificates/acme"
 	acmeAPI "github.com/RTradeLtd/ca-certificates/acme/api"
 	"github.com/RTradeLtd/ca-certificates/api"
+	"github.com/RTradeLtd/ca-certificates/audit"
 	"github.com/RTradeLtd/ca-certificates/authority"
 	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/RTradeLtd/ca-certificates/events"
+	"github.com/RTradeLtd/ca-certificates/k8s"
 	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/RTradeLtd/ca-certificates/metrics"
 	"github.com/RTradeLtd/ca-certificates/monitoring"
+	"github.com/RTradeLtd/ca-certificates/rpc"
 	"github.com/RTradeLtd/ca-certificates/server"
+	"github.com/RTradeLtd/ca-certificates/systemd"
+	"github.com/RTradeLtd/ca-certificates/workload"
 	"github.com/go-chi/chi"
 	"github.com/pkg/errors"
 	"github.com/smallstep/nosql"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 type options struct {
 	configFile string
 	password   []byte
 	database   db.AuthDB
+	readDB     db.AuthDB
+	events     *events.Publisher
+	audit      *audit.Logger
+	gc         *db.GarbageCollector
+	writer     *db.BatchWriter
+	apiOptions []api.Option
+	// tenants are the tenants running before a reload.
+	tenants map[string]*tenant
+	// pause is the paused state of the CA, shared on reloads.
+	pause *pauseState
 }
 
 func (o *options) apply(opts []Option) {
@@ -60,14 +84,95 @@ func WithDatabase(db db.AuthDB) Option {
 	}
 }
 
+// WithReadDatabase sets the given read replica of the authority database to
+// the CA options.
+func WithReadDatabase(db db.AuthDB) Option {
+	return func(o *options) {
+		o.readDB = db
+	}
+}
+
+// WithEventPublisher sets the given event publisher to the CA options.
+func WithEventPublisher(p *events.Publisher) Option {
+	return func(o *options) {
+		o.events = p
+	}
+}
+
+// WithAuditLogger sets the given audit logger to the CA options.
+func WithAuditLogger(l *audit.Logger) Option {
+	return func(o *options) {
+		o.audit = l
+	}
+}
+
+// WithGarbageCollector sets the given database garbage collector to the CA
+// options.
+func WithGarbageCollector(gc *db.GarbageCollector) Option {
+	return func(o *options) {
+		o.gc = gc
+	}
+}
+
+// WithBatchWriter sets the given writer of the issued certificates to the CA
+// options.
+func WithBatchWriter(w *db.BatchWriter) Option {
+	return func(o *options) {
+		o.writer = w
+	}
+}
+
+// WithAPIOptions sets the options of the handlers of the CA API, e.g. the
+// middlewares and the routes added by the programs embedding the CA.
+func WithAPIOptions(opts ...api.Option) Option {
+	return func(o *options) {
+		o.apiOptions = append(o.apiOptions, opts...)
+	}
+}
+
+// withTenants sets the tenants running before a reload, the new tenants with
+// the same names reuse their databases.
+func withTenants(tenants map[string]*tenant) Option {
+	return func(o *options) {
+		o.tenants = tenants
+	}
+}
+
 // CA is the type used to build the complete certificate authority. It builds
-// the HTTP server, set ups the middlewares and the HTTP handlers.
+// the HTTP server, set ups the middlewares and the HTTP handlers. If a gRPC
+// or a metrics address is configured it also builds the gRPC or the metrics
+// server.
 type CA struct {
-	auth    *authority.Authority
-	config  *authority.Config
-	srv     *server.Server
-	opts    *options
-	renewer *TLSRenewer
+	auth        *authority.Authority
+	config      *authority.Config
+	srv         *server.Server
+	grpcSrv     *grpc.Server
+	metricsSrv  *http.Server
+	debugSrv    *server.Server
+	unixSrv     *server.Server
+	insecureSrv *server.Server
+	// unixSocket is the path of the Unix domain socket created by the CA,
+	// it is removed on Stop.
+	unixSocket string
+	rpcSrv     *rpc.Server
+	sdsSrv     *rpc.SDSServer
+	logger     *logging.Logger
+	opts       *options
+	renewer    *TLSRenewer
+	// workloadSrv serves the SPIFFE Workload API on workloadSocket.
+	workloadSrv    *grpc.Server
+	workloadAPI    *workload.Server
+	workloadSocket string
+	// k8sController writes certificates in Kubernetes Secrets until stopK8s
+	// is called.
+	k8sController *k8s.Controller
+	stopK8s       context.CancelFunc
+	// reloadMutex serializes the reloads triggered by signals and by the
+	// configuration watcher.
+	reloadMutex sync.Mutex
+	stopWatch   context.CancelFunc
+	// tenants are the independent authorities served with the main one.
+	tenants map[string]*tenant
 }
 
 // New creates and initializes the CA with the given configuration and options.
@@ -77,6 +182,9 @@ func New(config *authority.Config, opts ...Option) (*CA, error) {
 		opts:   new(options),
 	}
 	ca.opts.apply(opts)
+	if ca.opts.pause == nil {
+		ca.opts.pause = new(pauseState)
+	}
 	return ca.Init(config)
 }
 
@@ -90,6 +198,21 @@ func (ca *CA) Init(config *authority.Config) (*CA, error) {
 	if ca.opts.database != nil {
 		opts = append(opts, authority.WithDatabase(ca.opts.database))
 	}
+	if ca.opts.readDB != nil {
+		opts = append(opts, authority.WithReadDatabase(ca.opts.readDB))
+	}
+	if ca.opts.events != nil {
+		opts = append(opts, authority.WithEventPublisher(ca.opts.events))
+	}
+	if ca.opts.audit != nil {
+		opts = append(opts, authority.WithAuditLogger(ca.opts.audit))
+	}
+	if ca.opts.gc != nil {
+		opts = append(opts, authority.WithGarbageCollector(ca.opts.gc))
+	}
+	if ca.opts.writer != nil {
+		opts = append(opts, authority.WithBatchWriter(ca.opts.writer))
+	}
 
 	auth, err := authority.New(config, opts...)
 	if err != nil {
@@ -105,12 +228,16 @@ func (ca *CA) Init(config *authority.Config) (*CA, error) {
 	mux := chi.NewRouter()
 	handler := http.Handler(mux)
 
-	// Add regular CA api endpoints in / and /1.0
-	routerHandler := api.New(auth)
+	// Add regular CA api endpoints in /, /1.0 and /v1. See the api package
+	// for the compatibility policy of the versions.
+	routerHandler := api.New(auth, ca.opts.apiOptions...)
 	routerHandler.Route(mux)
 	mux.Route("/1.0", func(r chi.Router) {
 		routerHandler.Route(r)
 	})
+	mux.Route("/"+api.V1, func(r chi.Router) {
+		routerHandler.Route(r)
+	})
 
 	//Add ACME api endpoints in /acme and /1.0/acme
 	dns := config.DNSNames[0]
@@ -128,6 +255,11 @@ func (ca *CA) Init(config *authority.Config) (*CA, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating ACME authority")
 	}
+	if gc := auth.GetGarbageCollector(); gc != nil {
+		if d, ok := config.DB.Retention.Retention(db.RetentionACMEOrders); ok {
+			gc.Register(db.RetentionACMEOrders, d, acmeAuth.PruneOrders)
+		}
+	}
 	acmeRouterHandler := acmeAPI.New(acmeAuth)
 	mux.Route("/"+prefix, func(r chi.Router) {
 		acmeRouterHandler.Route(r)
@@ -149,13 +281,50 @@ func (ca *CA) Init(config *authority.Config) (*CA, error) {
 		}
 	*/
 
+	// Add the tenants if configured, each one with its own authority and
+	// server certificate. The server accepts the client certificates of all
+	// of them, but each authority only sees its own.
+	if len(config.Tenants) > 0 {
+		tenants := make([]*tenant, 0, len(config.Tenants))
+		for _, tc := range config.Tenants {
+			prev := ca.opts.tenants[tc.Name]
+			t, err := newTenant(tc, config, prev, ca.opts.apiOptions...)
+			if err != nil {
+				for _, t := range tenants {
+					t.stop(ca.opts.tenants[t.name] == nil)
+				}
+				return nil, err
+			}
+			tenants = append(tenants, t)
+		}
+		ca.tenants = make(map[string]*tenant, len(tenants))
+		for _, t := range tenants {
+			ca.tenants[t.name] = t
+			for _, crt := range t.auth.GetRootCertificates() {
+				tlsConfig.ClientCAs.AddCert(crt)
+			}
+		}
+		router := newTenantRouter(restrictClientCertificates(auth, handler), config.Tenants, tenants)
+		tlsConfig.GetCertificate = router.getCertificate(tlsConfig.GetCertificate)
+		handler = router
+	}
+
+	// Reject the requests while the CA is paused, and keep the address of the
+	// client for the audit log.
+	middlewares := []func(http.Handler) http.Handler{ca.opts.pause.middleware, logging.RemoteAddress}
+
+	// Record the metrics of the requests if configured.
+	if config.MetricsAddress != "" {
+		middlewares = append(middlewares, metrics.Middleware)
+	}
+
 	// Add monitoring if configured
 	if len(config.Monitoring) > 0 {
 		m, err := monitoring.New(config.Monitoring)
 		if err != nil {
 			return nil, err
 		}
-		handler = m.Middleware(handler)
+		middlewares = append(middlewares, m.Middleware)
 	}
 
 	// Add logger if configured
@@ -164,31 +333,344 @@ func (ca *CA) Init(config *authority.Config) (*CA, error) {
 		if err != nil {
 			return nil, err
 		}
-		handler = logger.Middleware(handler)
+		middlewares = append(middlewares, logger.Middleware)
+		ca.logger = logger
+	}
+
+	wrap := func(h http.Handler) http.Handler {
+		for _, m := range middlewares {
+			h = m(h)
+		}
+		return h
+	}
+	handler = wrap(handler)
+
+	// The connections of all the servers are tuned with the same options, h2c
+	// is only used by the insecure server, the only one without TLS.
+	serverOptions := server.Options{
+		KeepAlivePeriod:      config.HTTP.GetKeepAlivePeriod(),
+		IdleTimeout:          config.HTTP.GetIdleTimeout(),
+		ReadHeaderTimeout:    config.HTTP.GetReadHeaderTimeout(),
+		MaxConcurrentStreams: config.HTTP.GetMaxConcurrentStreams(),
+		DisableHTTP2:         config.HTTP.IsHTTP2Disabled(),
+		H2CTrustedProxies:    config.HTTP.GetH2CTrustedProxies(),
 	}
 
 	ca.auth = auth
 	ca.srv = server.New(config.Address, handler, tlsConfig)
+	// The handlers have their own timeouts, the write timeout of the server
+	// must give them time to write the response.
+	if d := config.Timeouts.Max() + 5*time.Second; d > ca.srv.WriteTimeout {
+		ca.srv.WriteTimeout = d
+	}
+	if err := ca.srv.Configure(serverOptions); err != nil {
+		return nil, err
+	}
+
+	// Add debug server if configured, it uses the same TLS configuration so
+	// admins can authenticate with a client certificate.
+	if config.DebugAddress != "" {
+		debugMux := chi.NewRouter()
+		api.NewDebug(auth).Route(debugMux)
+		ca.debugSrv = server.New(config.DebugAddress, debugMux, tlsConfig)
+		// CPU profiles and traces last longer than the default write timeout,
+		// the pprof handlers limit their duration.
+		ca.debugSrv.WriteTimeout = 0
+		if err := ca.debugSrv.Configure(serverOptions); err != nil {
+			return nil, err
+		}
+	}
+
+	// Add Unix domain socket server if configured, with all the endpoints or
+	// only the admin ones.
+	if config.UnixSocket != nil {
+		unixHandler := handler
+		if config.UnixSocket.AdminOnly {
+			adminMux := chi.NewRouter()
+			adminHandler := api.NewAdmin(auth, ca.opts.apiOptions...)
+			adminHandler.Route(adminMux)
+			adminMux.Route("/1.0", func(r chi.Router) {
+				adminHandler.Route(r)
+			})
+			adminMux.Route("/"+api.V1, func(r chi.Router) {
+				adminHandler.Route(r)
+			})
+			unixHandler = wrap(adminMux)
+		}
+		ca.unixSrv = server.New(config.UnixSocket.Path, unixHandler, tlsConfig)
+		ca.unixSrv.WriteTimeout = ca.srv.WriteTimeout
+		if err := ca.unixSrv.Configure(serverOptions); err != nil {
+			return nil, err
+		}
+	}
+
+	// Add insecure server if configured, it serves the roots, the health and
+	// the ACME challenges over plain HTTP so clients can bootstrap their trust.
+	if config.InsecureAddress != "" {
+		insecureMux := chi.NewRouter()
+		api.NewInsecure(auth, config.ACMEChallengeDir).Route(insecureMux)
+		ca.insecureSrv = server.New(config.InsecureAddress, wrap(insecureMux), nil)
+		if err := ca.insecureSrv.Configure(serverOptions); err != nil {
+			return nil, err
+		}
+	}
+
+	// Add metrics server if configured
+	if config.MetricsAddress != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", metrics.Default)
+		ca.metricsSrv = &http.Server{
+			Addr:              config.MetricsAddress,
+			Handler:           metricsMux,
+			ReadHeaderTimeout: 15 * time.Second,
+		}
+	}
+
+	// Add gRPC server if configured
+	if config.GRPCAddress != "" {
+		ca.rpcSrv = rpc.New(auth)
+		ca.grpcSrv = grpc.NewServer(grpc.Creds(credentials.NewTLS(ca.getGRPCTLSConfig(tlsConfig))))
+		rpc.RegisterCertificateAuthorityServer(ca.grpcSrv, ca.rpcSrv)
+		if config.SDS != nil {
+			ca.sdsSrv = rpc.NewSDS(auth, rpc.SDSOptions{
+				Provisioner:  config.SDS.Provisioner,
+				CertDuration: config.SDS.GetCertDuration(),
+				RootCAName:   config.SDS.GetRootCAName(),
+			})
+			rpc.RegisterSecretDiscoveryServiceServer(ca.grpcSrv, ca.sdsSrv)
+		}
+	}
+
+	// Add the SPIFFE Workload API if configured
+	if config.WorkloadAPI != nil {
+		if ca.workloadAPI, err = newWorkloadAPI(auth, config.WorkloadAPI); err != nil {
+			return nil, err
+		}
+		ca.workloadSrv = grpc.NewServer(grpc.Creds(workload.Credentials()))
+		workload.RegisterSpiffeWorkloadAPIServer(ca.workloadSrv, ca.workloadAPI)
+	}
+
+	// Add the Kubernetes controller if configured
+	if config.Kubernetes != nil {
+		if ca.k8sController, err = newKubernetesController(auth, config); err != nil {
+			return nil, err
+		}
+	}
+
 	return ca, nil
 }
 
-// Run starts the CA calling to the server ListenAndServe method.
+// Run starts the CA calling to the server Serve method. If configured, the
+// gRPC, metrics, debug, unix socket, insecure and Workload API servers and the
+// Kubernetes controller are started in the background. The listeners passed by systemd socket activation
+// are used instead of the configured addresses, and systemd is notified when
+// the CA is ready.
 func (ca *CA) Run() error {
-	return ca.srv.ListenAndServe()
+	activated, err := activatedListeners()
+	if err != nil {
+		return err
+	}
+	listen := func(name, addr string) (net.Listener, error) {
+		if ln, ok := activated[name]; ok {
+			delete(activated, name)
+			log.Printf("Using %s socket %s passed by systemd", name, ln.Addr())
+			return ln, nil
+		}
+		if name == systemd.UnixListener {
+			ln, err := server.ListenUnix(addr, ca.config.UnixSocket.GetMode(), ca.config.UnixSocket.GetGroupID())
+			if err == nil {
+				ca.unixSocket = addr
+			}
+			return ln, err
+		}
+		if name == systemd.WorkloadListener {
+			ln, err := server.ListenUnix(addr, workloadSocketMode, -1)
+			if err == nil {
+				ca.workloadSocket = addr
+			}
+			return ln, err
+		}
+		return net.Listen("tcp", addr)
+	}
+
+	if ca.metricsSrv != nil {
+		ln, err := listen(systemd.MetricsListener, ca.config.MetricsAddress)
+		if err != nil {
+			return errors.Wrap(err, "error listening on metricsAddress")
+		}
+		go func() {
+			log.Printf("Serving metrics on %s ...", ln.Addr())
+			if err := ca.metricsSrv.Serve(ln); err != nil && err != http.ErrServerClosed {
+				log.Println(errors.Wrap(err, "unexpected metrics server error"))
+			}
+		}()
+	}
+	if ca.debugSrv != nil {
+		ln, err := listen(systemd.DebugListener, ca.config.DebugAddress)
+		if err != nil {
+			return errors.Wrap(err, "error listening on debugAddress")
+		}
+		go func() {
+			if err := ca.debugSrv.Serve(ln); err != nil && err != http.ErrServerClosed {
+				log.Println(errors.Wrap(err, "unexpected debug server error"))
+			}
+		}()
+	}
+	if ca.unixSrv != nil {
+		ln, err := listen(systemd.UnixListener, ca.config.UnixSocket.Path)
+		if err != nil {
+			return errors.Wrap(err, "error listening on unixSocket")
+		}
+		go func() {
+			if err := ca.unixSrv.Serve(ln); err != nil && err != http.ErrServerClosed {
+				log.Println(errors.Wrap(err, "unexpected unix socket server error"))
+			}
+		}()
+	}
+	if ca.insecureSrv != nil {
+		ln, err := listen(systemd.InsecureListener, ca.config.InsecureAddress)
+		if err != nil {
+			return errors.Wrap(err, "error listening on insecureAddress")
+		}
+		go func() {
+			if err := ca.insecureSrv.Serve(ln); err != nil && err != http.ErrServerClosed {
+				log.Println(errors.Wrap(err, "unexpected insecure server error"))
+			}
+		}()
+	}
+	if ca.grpcSrv != nil {
+		ln, err := listen(systemd.GRPCListener, ca.config.GRPCAddress)
+		if err != nil {
+			return errors.Wrap(err, "error listening on grpcAddress")
+		}
+		go func() {
+			log.Printf("Serving gRPC on %s ...", ln.Addr())
+			if err := ca.grpcSrv.Serve(ln); err != nil {
+				log.Println(errors.Wrap(err, "unexpected gRPC error"))
+			}
+		}()
+	}
+	if ca.workloadSrv != nil {
+		ln, err := listen(systemd.WorkloadListener, ca.config.WorkloadAPI.Socket)
+		if err != nil {
+			return errors.Wrap(err, "error listening on workloadAPI.socket")
+		}
+		go func() {
+			log.Printf("Serving the SPIFFE Workload API on %s ...", ln.Addr())
+			if err := ca.workloadSrv.Serve(ln); err != nil {
+				log.Println(errors.Wrap(err, "unexpected workload api error"))
+			}
+		}()
+	}
+	ln, err := listen(systemd.APIListener, ca.config.Address)
+	if err != nil {
+		return err
+	}
+	for name, l := range activated {
+		log.Printf("Closing unused socket %s passed by systemd", name)
+		l.Close()
+	}
+	if err := systemd.Notify(systemd.Ready, systemd.Status("Serving on "+ln.Addr().String())); err != nil {
+		log.Println(err)
+	}
+	if ca.k8sController != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		ca.stopK8s = cancel
+		go ca.k8sController.Run(ctx)
+	}
+	// Reload on changes of the Consul and Vault values in the configuration.
+	if ca.opts.configFile != "" {
+		ctx, cancel := context.WithCancel(context.Background())
+		ca.stopWatch = cancel
+		go ca.watchConfig(ctx)
+	}
+	return ca.srv.Serve(ln)
+}
+
+// activatedListeners returns the listeners passed by systemd socket
+// activation. A single socket without one of the known names is used for the
+// API.
+func activatedListeners() (map[string]net.Listener, error) {
+	activated, err := systemd.Listeners()
+	if err != nil {
+		return nil, err
+	}
+	if len(activated) == 1 {
+		for name, ln := range activated {
+			switch name {
+			case systemd.APIListener, systemd.GRPCListener, systemd.MetricsListener, systemd.DebugListener, systemd.UnixListener, systemd.InsecureListener, systemd.WorkloadListener:
+			default:
+				return map[string]net.Listener{systemd.APIListener: ln}, nil
+			}
+		}
+	}
+	return activated, nil
 }
 
 // Stop stops the CA calling to the server Shutdown method.
 func (ca *CA) Stop() error {
+	if err := systemd.Notify(systemd.Stopping); err != nil {
+		log.Println(err)
+	}
+	if ca.stopWatch != nil {
+		ca.stopWatch()
+	}
+	if ca.stopK8s != nil {
+		ca.stopK8s()
+	}
 	ca.renewer.Stop()
+	for _, t := range ca.tenants {
+		t.stop(true)
+	}
+	if ca.grpcSrv != nil {
+		stopGRPC(ca.grpcSrv)
+	}
+	if ca.workloadSrv != nil {
+		stopGRPC(ca.workloadSrv)
+		if ca.workloadSocket != "" {
+			os.Remove(ca.workloadSocket)
+		}
+	}
+	if ca.metricsSrv != nil {
+		ca.metricsSrv.Close()
+	}
+	if ca.debugSrv != nil {
+		ca.debugSrv.Shutdown()
+	}
+	if ca.unixSrv != nil {
+		ca.unixSrv.Shutdown()
+		if ca.unixSocket != "" {
+			os.Remove(ca.unixSocket)
+		}
+	}
+	if ca.insecureSrv != nil {
+		ca.insecureSrv.Shutdown()
+	}
 	if err := ca.auth.Shutdown(); err != nil {
 		log.Printf("error stopping ca.Authority: %+v\n", err)
 	}
-	return ca.srv.Shutdown()
+	err := ca.srv.Shutdown()
+	if ca.logger != nil {
+		ca.logger.Close()
+	}
+	return err
 }
 
 // Reload reloads the configuration of the CA and calls to the server Reload
 // method.
 func (ca *CA) Reload() error {
+	ca.reloadMutex.Lock()
+	defer ca.reloadMutex.Unlock()
+	if err := systemd.Notify(systemd.Reloading); err != nil {
+		log.Println(err)
+	}
+	// The CA keeps running with the original or the new configuration.
+	defer func() {
+		if err := systemd.Notify(systemd.Ready); err != nil {
+			log.Println(err)
+		}
+	}()
+
 	config, err := authority.LoadConfiguration(ca.opts.configFile)
 	if err != nil {
 		return errors.Wrap(err, "error reloading ca configuration")
@@ -206,10 +688,83 @@ func (ca *CA) Reload() error {
 		return errors.New("error reloading ca: database configuration cannot change")
 	}
 
+	// Do not allow reload if the gRPC address has changed.
+	if ca.config.GRPCAddress != config.GRPCAddress {
+		logContinue("Reload failed because the grpcAddress has changed.")
+		return errors.New("error reloading ca: grpcAddress cannot change")
+	}
+
+	// Do not allow reload if the SDS configuration has changed, the service
+	// is registered in the gRPC server.
+	if !reflect.DeepEqual(ca.config.SDS, config.SDS) {
+		logContinue("Reload failed because the sds configuration has changed.")
+		return errors.New("error reloading ca: sds configuration cannot change")
+	}
+
+	// Do not allow reload if the socket of the workload api has changed.
+	if (ca.config.WorkloadAPI == nil) != (config.WorkloadAPI == nil) ||
+		(config.WorkloadAPI != nil && ca.config.WorkloadAPI.Socket != config.WorkloadAPI.Socket) {
+		logContinue("Reload failed because the workloadAPI.socket has changed.")
+		return errors.New("error reloading ca: workloadAPI.socket cannot change")
+	}
+
+	// Do not allow reload if the Kubernetes configuration has changed, the
+	// controller is already running.
+	if !reflect.DeepEqual(ca.config.Kubernetes, config.Kubernetes) {
+		logContinue("Reload failed because the kubernetes configuration has changed.")
+		return errors.New("error reloading ca: kubernetes configuration cannot change")
+	}
+
+	// Do not allow reload if the metrics address has changed.
+	if ca.config.MetricsAddress != config.MetricsAddress {
+		logContinue("Reload failed because the metricsAddress has changed.")
+		return errors.New("error reloading ca: metricsAddress cannot change")
+	}
+
+	// Do not allow reload if the debug address has changed.
+	if ca.config.DebugAddress != config.DebugAddress {
+		logContinue("Reload failed because the debugAddress has changed.")
+		return errors.New("error reloading ca: debugAddress cannot change")
+	}
+
+	// Do not allow reload if the unix socket has changed.
+	if !reflect.DeepEqual(ca.config.UnixSocket, config.UnixSocket) {
+		logContinue("Reload failed because the unixSocket has changed.")
+		return errors.New("error reloading ca: unixSocket cannot change")
+	}
+
+	// Do not allow reload if the insecure address has changed.
+	if ca.config.InsecureAddress != config.InsecureAddress {
+		logContinue("Reload failed because the insecureAddress has changed.")
+		return errors.New("error reloading ca: insecureAddress cannot change")
+	}
+
+	// Do not allow reload if the events configuration has changed, the event
+	// publisher is shared with the new authority.
+	if !reflect.DeepEqual(ca.config.Events, config.Events) {
+		logContinue("Reload failed because the events configuration has changed.")
+		return errors.New("error reloading ca: events configuration cannot change")
+	}
+
+	// Do not allow reload if the audit configuration has changed, the audit
+	// logger is shared with the new authority.
+	if !reflect.DeepEqual(ca.config.Audit, config.Audit) {
+		logContinue("Reload failed because the audit configuration has changed.")
+		return errors.New("error reloading ca: audit configuration cannot change")
+	}
+
 	newCA, err := New(config,
 		WithPassword(ca.opts.password),
 		WithConfigFile(ca.opts.configFile),
 		WithDatabase(ca.auth.GetDatabase()),
+		WithReadDatabase(ca.auth.GetReadDatabase()),
+		WithEventPublisher(ca.auth.GetEventPublisher()),
+		WithAuditLogger(ca.auth.GetAuditLogger()),
+		WithGarbageCollector(ca.auth.GetGarbageCollector()),
+		WithBatchWriter(ca.auth.GetBatchWriter()),
+		WithAPIOptions(ca.opts.apiOptions...),
+		withTenants(ca.tenants),
+		withPauseState(ca.opts.pause),
 	)
 	if err != nil {
 		logContinue("Reload failed because the CA with new configuration could not be initialized.")
@@ -221,17 +776,81 @@ func (ca *CA) Reload() error {
 		return errors.Wrap(err, "error reloading server")
 	}
 
+	// The debug server uses the authority to authorize the admins.
+	if ca.debugSrv != nil {
+		if err = ca.debugSrv.Reload(newCA.debugSrv); err != nil {
+			log.Println(errors.Wrap(err, "error reloading debug server"))
+		}
+	}
+	if ca.unixSrv != nil {
+		if err = ca.unixSrv.Reload(newCA.unixSrv); err != nil {
+			log.Println(errors.Wrap(err, "error reloading unix socket server"))
+		}
+	}
+	if ca.insecureSrv != nil {
+		if err = ca.insecureSrv.Reload(newCA.insecureSrv); err != nil {
+			log.Println(errors.Wrap(err, "error reloading insecure server"))
+		}
+	}
+
 	// 1. Stop previous renewer
 	// 2. Replace ca properties
-	// Do not replace ca.srv
+	// Do not replace ca.srv, ca.grpcSrv, ca.metricsSrv, ca.debugSrv,
+	// ca.unixSrv or ca.insecureSrv, the gRPC server will use the new
+	// authority and the new renewer.
 	ca.renewer.Stop()
+	newCA.auth.PublishProvisionerEvents(ca.config.AuthorityConfig.Provisioners)
+	if ca.rpcSrv != nil {
+		ca.rpcSrv.SetAuthority(newCA.auth)
+	}
+	if ca.sdsSrv != nil {
+		ca.sdsSrv.SetAuthority(newCA.auth)
+	}
+	// The new entries and attestors are used in the next rotation.
+	if ca.workloadAPI != nil {
+		ca.workloadAPI.Reload(newCA.workloadAPI)
+	}
+	if ca.k8sController != nil {
+		ca.k8sController.SetAuthority(newCA.auth)
+	}
+	// The tenants kept in the new configuration reuse their databases, the
+	// removed ones are stopped.
+	for name, t := range ca.tenants {
+		_, ok := newCA.tenants[name]
+		t.stop(!ok)
+	}
+	ca.tenants = newCA.tenants
+	// The new authority has its own notifier and federation syncer.
+	ca.auth.GetNotifier().Stop()
+	ca.auth.GetFederationSyncer().Stop()
 	ca.auth = newCA.auth
 	ca.config = newCA.config
 	ca.opts = newCA.opts
 	ca.renewer = newCA.renewer
+	// Close the syslog or journald connection of the previous logger.
+	if ca.logger != nil {
+		ca.logger.Close()
+	}
+	ca.logger = newCA.logger
 	return nil
 }
 
+// ReloadProvisioners reloads only the provisioners from the configuration
+// file, the rest of the configuration is ignored. The servers keep running and
+// the provisioners are replaced atomically.
+func (ca *CA) ReloadProvisioners() error {
+	ca.reloadMutex.Lock()
+	defer ca.reloadMutex.Unlock()
+	config, err := authority.LoadConfiguration(ca.opts.configFile)
+	if err != nil {
+		return errors.Wrap(err, "error reloading ca configuration")
+	}
+	if config.AuthorityConfig == nil {
+		return errors.New("error reloading provisioners: authority cannot be undefined")
+	}
+	return ca.auth.ReloadProvisioners(config.AuthorityConfig.Provisioners)
+}
+
 // getTLSConfig returns a TLSConfig for the CA server with a self-renewing
 // server certificate.
 func (ca *CA) getTLSConfig(auth *authority.Authority) (*tls.Config, error) {
@@ -247,20 +866,19 @@ func (ca *CA) getTLSConfig(auth *authority.Authority) (*tls.Config, error) {
 		ca.renewer.Stop()
 	}
 
-	ca.renewer, err = NewTLSRenewer(tlsCrt, auth.GetTLSCertificate)
+	var opts []tlsRenewerOptions
+	if d := ca.config.ServerTLS.GetRenewBefore(); d > 0 {
+		opts = append(opts, WithRenewBefore(d))
+	}
+	ca.renewer, err = NewTLSRenewer(tlsCrt, renewTLSCertificate(auth), opts...)
 	if err != nil {
 		return nil, err
 	}
 	ca.renewer.Run()
 
-	var tlsConfig *tls.Config
-	if ca.config.TLS != nil {
-		tlsConfig = ca.config.TLS.TLSConfig()
-	} else {
-		tlsConfig = &tls.Config{
-			MinVersion: tls.VersionTLS12,
-		}
-	}
+	// The versions, cipher suites, curves and client authentication policy
+	// are configurable.
+	tlsConfig := ca.config.ServerTLS.TLSConfig(ca.config.TLS)
 
 	certPool := x509.NewCertPool()
 	for _, crt := range auth.GetRootCertificates() {
@@ -277,12 +895,37 @@ func (ca *CA) getTLSConfig(auth *authority.Authority) (*tls.Config, error) {
 	tlsConfig.Certificates = []tls.Certificate{}
 	tlsConfig.GetCertificate = ca.renewer.GetCertificateForCA
 
-	// Add support for mutual tls to renew certificates
-	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	// Verify client certificates with the roots of the CA
 	tlsConfig.ClientCAs = certPool
 
-	// Use server's most preferred ciphersuite
-	tlsConfig.PreferServerCipherSuites = true
-
 	return tlsConfig, nil
 }
+
+// renewTLSCertificate returns the RenewFunc of the certificate of the CA
+// server. The new certificate has a new key and it is signed by the current
+// intermediate, so it is also rotated after importing a new intermediate. The
+// renewer retries on errors.
+func renewTLSCertificate(auth *authority.Authority) RenewFunc {
+	return func() (*tls.Certificate, error) {
+		crt, err := auth.GetTLSCertificate()
+		if err != nil {
+			metrics.ServerCertificateRenewals.Inc("error")
+			log.Println(errors.Wrap(err, "error renewing the CA server certificate"))
+			return nil, err
+		}
+		metrics.ServerCertificateRenewals.Inc("ok")
+		log.Printf("Renewed the CA server certificate, it expires at %s", crt.Leaf.NotAfter.Format(time.RFC3339))
+		return crt, nil
+	}
+}
+
+// getGRPCTLSConfig returns a copy of the given TLS configuration for the gRPC
+// server. The server certificate is always obtained from the current renewer,
+// so the configuration remains valid after a reload.
+func (ca *CA) getGRPCTLSConfig(tlsConfig *tls.Config) *tls.Config {
+	grpcConfig := tlsConfig.Clone()
+	grpcConfig.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return ca.renewer.GetCertificateForCA(hello)
+	}
+	return grpcConfig
+}
@@ -2,6 +2,7 @@ package ca
 
 import (
 	"bytes"
+	"context"
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
@@ -20,6 +21,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/RTradeLtd/ca-certificates/api"
 	"github.com/RTradeLtd/ca-certificates/authority"
@@ -37,6 +39,7 @@ type clientOptions struct {
 	rootSHA256   string
 	rootFilename string
 	rootBundle   []byte
+	version      string
 }
 
 func (o *clientOptions) apply(opts []ClientOption) (err error) {
@@ -103,6 +106,16 @@ func WithTransport(tr http.RoundTripper) ClientOption {
 	}
 }
 
+// WithAPIVersion makes the client use the given version of the CA API, e.g.
+// v1. By default the client uses the paths without version, served by all the
+// CAs. See also Client.NegotiateVersion.
+func WithAPIVersion(version string) ClientOption {
+	return func(o *clientOptions) error {
+		o.version = version
+		return nil
+	}
+}
+
 // WithRootFile will create the transport using the given root certificate. It
 // will fail if a previous option to create the transport has been configured.
 func WithRootFile(filename string) ClientOption {
@@ -162,12 +175,24 @@ func getTransportFromSHA256(endpoint, sum string) (http.RoundTripper, error) {
 		return nil, err
 	}
 	client := &Client{endpoint: u}
-	root, err := client.Root(sum)
-	if err != nil {
+	pool := x509.NewCertPool()
+	bootstrap, err := client.Bootstrap(sum)
+	switch e, ok := err.(*api.Error); {
+	case err == nil:
+		for _, crt := range bootstrap.Roots {
+			pool.AddCert(crt.Certificate)
+		}
+		pool.AddCert(bootstrap.RootPEM.Certificate)
+	case ok && e.StatusCode() == http.StatusNotFound:
+		// Older CAs only have the root endpoint.
+		root, err := client.Root(sum)
+		if err != nil {
+			return nil, err
+		}
+		pool.AddCert(root.RootPEM.Certificate)
+	default:
 		return nil, err
 	}
-	pool := x509.NewCertPool()
-	pool.AddCert(root.RootPEM.Certificate)
 	return getDefaultTransport(&tls.Config{
 		MinVersion:               tls.VersionTLS12,
 		PreferServerCipherSuites: true,
@@ -231,6 +256,7 @@ type ProvisionerOption func(o *provisionerOptions) error
 type provisionerOptions struct {
 	cursor string
 	limit  int
+	typ    string
 }
 
 func (o *provisionerOptions) apply(opts []ProvisionerOption) (err error) {
@@ -250,6 +276,9 @@ func (o *provisionerOptions) rawQuery() string {
 	if o.limit > 0 {
 		v.Set("limit", strconv.Itoa(o.limit))
 	}
+	if len(o.typ) > 0 {
+		v.Set("type", o.typ)
+	}
 	return v.Encode()
 }
 
@@ -269,10 +298,20 @@ func WithProvisionerLimit(limit int) ProvisionerOption {
 	}
 }
 
+// WithProvisionerType will request only the provisioners of the given type,
+// e.g. JWK or OIDC.
+func WithProvisionerType(typ string) ProvisionerOption {
+	return func(o *provisionerOptions) error {
+		o.typ = typ
+		return nil
+	}
+}
+
 // Client implements an HTTP client for the CA server.
 type Client struct {
 	client   *http.Client
 	endpoint *url.URL
+	version  string
 }
 
 // NewClient creates a new Client with the given endpoint and options.
@@ -296,6 +335,7 @@ func NewClient(endpoint string, opts ...ClientOption) (*Client, error) {
 			Transport: tr,
 		},
 		endpoint: u,
+		version:  o.version,
 	}, nil
 }
 
@@ -304,10 +344,61 @@ func (c *Client) SetTransport(tr http.RoundTripper) {
 	c.client.Transport = tr
 }
 
+// resolve returns the URL of the given reference in the CA, adding the version
+// prefix if the client uses a version of the API.
+func (c *Client) resolve(ref *url.URL) *url.URL {
+	if c.version != "" {
+		ref.Path = "/" + c.version + ref.Path
+	}
+	return c.endpoint.ResolveReference(ref)
+}
+
+// NegotiateVersion configures the client to use the first of the given
+// versions of the CA API that the CA supports, and returns it. The versions
+// must be sorted by preference, and by default all the versions known by the
+// client are used, starting with the latest one. CAs that do not support
+// versions are used without version, and in that case NegotiateVersion
+// returns an empty string. It must not be called concurrently with other
+// requests.
+func (c *Client) NegotiateVersion(versions ...string) (string, error) {
+	if len(versions) == 0 {
+		for i := len(api.SupportedVersions) - 1; i >= 0; i-- {
+			versions = append(versions, api.SupportedVersions[i])
+		}
+	}
+
+	u := c.endpoint.ResolveReference(&url.URL{Path: "/versions"})
+	resp, err := c.client.Get(u.String())
+	if err != nil {
+		return "", errors.Wrapf(err, "client GET %s failed", u)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		c.version = ""
+		return "", nil
+	}
+	if resp.StatusCode >= 400 {
+		return "", readError(resp.Body)
+	}
+	var res api.VersionsResponse
+	if err := readJSON(resp.Body, &res); err != nil {
+		return "", errors.Wrapf(err, "error reading %s", u)
+	}
+	for _, v := range versions {
+		for _, sv := range res.Versions {
+			if v == sv {
+				c.version = v
+				return v, nil
+			}
+		}
+	}
+	return "", errors.Errorf("the CA does not support any of the versions %s", strings.Join(versions, ", "))
+}
+
 // Health performs the health request to the CA and returns the
 // api.HealthResponse struct.
 func (c *Client) Health() (*api.HealthResponse, error) {
-	u := c.endpoint.ResolveReference(&url.URL{Path: "/health"})
+	u := c.resolve(&url.URL{Path: "/health"})
 	resp, err := c.client.Get(u.String())
 	if err != nil {
 		return nil, errors.Wrapf(err, "client GET %s failed", u)
@@ -328,7 +419,7 @@ func (c *Client) Health() (*api.HealthResponse, error) {
 // do not match.
 func (c *Client) Root(sha256Sum string) (*api.RootResponse, error) {
 	sha256Sum = strings.ToLower(strings.Replace(sha256Sum, "-", "", -1))
-	u := c.endpoint.ResolveReference(&url.URL{Path: "/root/" + sha256Sum})
+	u := c.resolve(&url.URL{Path: "/root/" + sha256Sum})
 	resp, err := getInsecureClient().Get(u.String())
 	if err != nil {
 		return nil, errors.Wrapf(err, "client GET %s failed", u)
@@ -348,6 +439,58 @@ func (c *Client) Root(sha256Sum string) (*api.RootResponse, error) {
 	return &root, nil
 }
 
+// Bootstrap performs the bootstrap request to the CA and returns the
+// api.BootstrapResponse struct. The request is done without TLS verification,
+// so the response is only trusted if it has the root with the given SHA256
+// fingerprint, and the certificate of the CA chains up to that root.
+func (c *Client) Bootstrap(sha256Sum string) (*api.BootstrapResponse, error) {
+	sha256Sum = strings.ToLower(strings.Replace(sha256Sum, "-", "", -1))
+	u := c.resolve(&url.URL{Path: "/bootstrap", RawQuery: url.Values{"fingerprint": {sha256Sum}}.Encode()})
+	resp, err := getInsecureClient().Get(u.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "client GET %s failed", u)
+	}
+	if resp.StatusCode >= 400 {
+		err := readError(resp.Body)
+		// Older CAs do not have the endpoint.
+		if _, ok := err.(*api.Error); !ok && resp.StatusCode == http.StatusNotFound {
+			err = api.NotFound(errors.Errorf("%s was not found", u))
+		}
+		return nil, err
+	}
+	var bootstrap api.BootstrapResponse
+	if err := readJSON(resp.Body, &bootstrap); err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", u)
+	}
+	// verify the sha256
+	root := bootstrap.RootPEM.Certificate
+	if root == nil {
+		return nil, errors.Errorf("error reading %s: root certificate is missing", u)
+	}
+	sum := sha256.Sum256(root.Raw)
+	if sha256Sum != strings.ToLower(hex.EncodeToString(sum[:])) {
+		return nil, errors.New("root certificate SHA256 fingerprint do not match")
+	}
+	// verify that the response comes from the CA
+	if resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+		return nil, errors.Errorf("error verifying %s: the CA certificate is missing", u)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	intermediates := x509.NewCertPool()
+	for _, crt := range resp.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(crt)
+	}
+	if _, err := resp.TLS.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       c.endpoint.Hostname(),
+		Roots:         roots,
+		Intermediates: intermediates,
+	}); err != nil {
+		return nil, errors.Wrapf(err, "error verifying %s", u)
+	}
+	return &bootstrap, nil
+}
+
 // Sign performs the sign request to the CA and returns the api.SignResponse
 // struct.
 func (c *Client) Sign(req *api.SignRequest) (*api.SignResponse, error) {
@@ -355,7 +498,7 @@ func (c *Client) Sign(req *api.SignRequest) (*api.SignResponse, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "error marshaling request")
 	}
-	u := c.endpoint.ResolveReference(&url.URL{Path: "/sign"})
+	u := c.resolve(&url.URL{Path: "/sign"})
 	resp, err := c.client.Post(u.String(), "application/json", bytes.NewReader(body))
 	if err != nil {
 		return nil, errors.Wrapf(err, "client POST %s failed", u)
@@ -363,6 +506,9 @@ func (c *Client) Sign(req *api.SignRequest) (*api.SignResponse, error) {
 	if resp.StatusCode >= 400 {
 		return nil, readError(resp.Body)
 	}
+	if resp.StatusCode == http.StatusAccepted {
+		return nil, readPending(resp.Body)
+	}
 	var sign api.SignResponse
 	if err := readJSON(resp.Body, &sign); err != nil {
 		return nil, errors.Wrapf(err, "error reading %s", u)
@@ -373,6 +519,60 @@ func (c *Client) Sign(req *api.SignRequest) (*api.SignResponse, error) {
 	return &sign, nil
 }
 
+// PendingError is the error returned by Sign and Pending when the certificate
+// request is waiting for the approval of an admin. The ID can be used to poll
+// the CA for the certificate.
+type PendingError struct {
+	ID string
+}
+
+// Error implements the error interface.
+func (e *PendingError) Error() string {
+	return "certificate request " + e.ID + " is pending approval"
+}
+
+// Pending performs the pending request to the CA and returns the
+// api.SignResponse struct if the certificate request with the given id has
+// been approved. If the request has not been reviewed yet it returns a
+// *PendingError.
+func (c *Client) Pending(id string) (*api.SignResponse, error) {
+	u := c.resolve(&url.URL{Path: "/pending/" + url.PathEscape(id)})
+	resp, err := c.client.Get(u.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "client GET %s failed", u)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, readError(resp.Body)
+	}
+	if resp.StatusCode == http.StatusAccepted {
+		return nil, readPending(resp.Body)
+	}
+	var sign api.SignResponse
+	if err := readJSON(resp.Body, &sign); err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", u)
+	}
+	sign.TLS = resp.TLS
+	return &sign, nil
+}
+
+// WaitPending polls the CA every interval until the certificate request with
+// the given id is approved or denied, or the context is done.
+func (c *Client) WaitPending(ctx context.Context, id string, interval time.Duration) (*api.SignResponse, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		sign, err := c.Pending(id)
+		if _, ok := err.(*PendingError); !ok {
+			return sign, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrapf(ctx.Err(), "error waiting for certificate request %s", id)
+		case <-ticker.C:
+		}
+	}
+}
+
 // SignSSH performs the SSH certificate sign request to the CA and returns the
 // api.SignSSHResponse struct.
 func (c *Client) SignSSH(req *api.SignSSHRequest) (*api.SignSSHResponse, error) {
@@ -380,7 +580,7 @@ func (c *Client) SignSSH(req *api.SignSSHRequest) (*api.SignSSHResponse, error)
 	if err != nil {
 		return nil, errors.Wrap(err, "error marshaling request")
 	}
-	u := c.endpoint.ResolveReference(&url.URL{Path: "/sign-ssh"})
+	u := c.resolve(&url.URL{Path: "/sign-ssh"})
 	resp, err := c.client.Post(u.String(), "application/json", bytes.NewReader(body))
 	if err != nil {
 		return nil, errors.Wrapf(err, "client POST %s failed", u)
@@ -398,7 +598,7 @@ func (c *Client) SignSSH(req *api.SignSSHRequest) (*api.SignSSHResponse, error)
 // Renew performs the renew request to the CA and returns the api.SignResponse
 // struct.
 func (c *Client) Renew(tr http.RoundTripper) (*api.SignResponse, error) {
-	u := c.endpoint.ResolveReference(&url.URL{Path: "/renew"})
+	u := c.resolve(&url.URL{Path: "/renew"})
 	client := &http.Client{Transport: tr}
 	resp, err := client.Post(u.String(), "application/json", http.NoBody)
 	if err != nil {
@@ -414,6 +614,57 @@ func (c *Client) Renew(tr http.RoundTripper) (*api.SignResponse, error) {
 	return &sign, nil
 }
 
+// RenewWithToken performs the renew request to the CA authenticated with the
+// given token instead of the certificate in the TLS connection, and returns the
+// api.SignResponse struct. The token must be signed with the key of the
+// certificate and contain the certificate chain in the x5c header; it allows
+// the renewal of a certificate expired within the renewal grace period.
+func (c *Client) RenewWithToken(token string) (*api.SignResponse, error) {
+	u := c.resolve(&url.URL{Path: "/renew"})
+	req, err := http.NewRequest("POST", u.String(), http.NoBody)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create POST %s request failed", u)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "client POST %s failed", u)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, readError(resp.Body)
+	}
+	var sign api.SignResponse
+	if err := readJSON(resp.Body, &sign); err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", u)
+	}
+	return &sign, nil
+}
+
+// Rekey performs the rekey request to the CA and returns the api.SignResponse
+// struct. The CSR contains the new public key, the transport must present the
+// current certificate.
+func (c *Client) Rekey(req *api.RekeyRequest, tr http.RoundTripper) (*api.SignResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling request")
+	}
+
+	u := c.resolve(&url.URL{Path: "/rekey"})
+	client := &http.Client{Transport: tr}
+	resp, err := client.Post(u.String(), "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrapf(err, "client POST %s failed", u)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, readError(resp.Body)
+	}
+	var sign api.SignResponse
+	if err := readJSON(resp.Body, &sign); err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", u)
+	}
+	return &sign, nil
+}
+
 // Revoke performs the revoke request to the CA and returns the api.RevokeResponse
 // struct.
 func (c *Client) Revoke(req *api.RevokeRequest, tr http.RoundTripper) (*api.RevokeResponse, error) {
@@ -429,7 +680,7 @@ func (c *Client) Revoke(req *api.RevokeRequest, tr http.RoundTripper) (*api.Revo
 		client = c.client
 	}
 
-	u := c.endpoint.ResolveReference(&url.URL{Path: "/revoke"})
+	u := c.resolve(&url.URL{Path: "/revoke"})
 	resp, err := client.Post(u.String(), "application/json", bytes.NewReader(body))
 	if err != nil {
 		return nil, errors.Wrapf(err, "client POST %s failed", u)
@@ -454,7 +705,7 @@ func (c *Client) Provisioners(opts ...ProvisionerOption) (*api.ProvisionersRespo
 	if err := o.apply(opts); err != nil {
 		return nil, err
 	}
-	u := c.endpoint.ResolveReference(&url.URL{
+	u := c.resolve(&url.URL{
 		Path:     "/provisioners",
 		RawQuery: o.rawQuery(),
 	})
@@ -476,7 +727,7 @@ func (c *Client) Provisioners(opts ...ProvisionerOption) (*api.ProvisionersRespo
 // the given provisioner kid and returns the api.ProvisionerKeyResponse struct
 // with the encrypted key.
 func (c *Client) ProvisionerKey(kid string) (*api.ProvisionerKeyResponse, error) {
-	u := c.endpoint.ResolveReference(&url.URL{Path: "/provisioners/" + kid + "/encrypted-key"})
+	u := c.resolve(&url.URL{Path: "/provisioners/" + kid + "/encrypted-key"})
 	resp, err := c.client.Get(u.String())
 	if err != nil {
 		return nil, errors.Wrapf(err, "client GET %s failed", u)
@@ -494,7 +745,7 @@ func (c *Client) ProvisionerKey(kid string) (*api.ProvisionerKeyResponse, error)
 // Roots performs the get roots request to the CA and returns the
 // api.RootsResponse struct.
 func (c *Client) Roots() (*api.RootsResponse, error) {
-	u := c.endpoint.ResolveReference(&url.URL{Path: "/roots"})
+	u := c.resolve(&url.URL{Path: "/roots"})
 	resp, err := c.client.Get(u.String())
 	if err != nil {
 		return nil, errors.Wrapf(err, "client GET %s failed", u)
@@ -509,10 +760,28 @@ func (c *Client) Roots() (*api.RootsResponse, error) {
 	return &roots, nil
 }
 
+// Intermediates performs the get intermediates request to the CA and returns
+// the api.IntermediatesResponse struct.
+func (c *Client) Intermediates() (*api.IntermediatesResponse, error) {
+	u := c.resolve(&url.URL{Path: "/intermediates"})
+	resp, err := c.client.Get(u.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "client GET %s failed", u)
+	}
+	if resp.StatusCode >= 400 {
+		return nil, readError(resp.Body)
+	}
+	var intermediates api.IntermediatesResponse
+	if err := readJSON(resp.Body, &intermediates); err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", u)
+	}
+	return &intermediates, nil
+}
+
 // Federation performs the get federation request to the CA and returns the
 // api.FederationResponse struct.
 func (c *Client) Federation() (*api.FederationResponse, error) {
-	u := c.endpoint.ResolveReference(&url.URL{Path: "/federation"})
+	u := c.resolve(&url.URL{Path: "/federation"})
 	resp, err := c.client.Get(u.String())
 	if err != nil {
 		return nil, errors.Wrapf(err, "client GET %s failed", u)
@@ -531,7 +800,7 @@ func (c *Client) Federation() (*api.FederationResponse, error) {
 // It does an health connection and gets the fingerprint from the TLS verified
 // chains.
 func (c *Client) RootFingerprint() (string, error) {
-	u := c.endpoint.ResolveReference(&url.URL{Path: "/health"})
+	u := c.resolve(&url.URL{Path: "/health"})
 	resp, err := c.client.Get(u.String())
 	if err != nil {
 		return "", errors.Wrapf(err, "client GET %s failed", u)
@@ -614,6 +883,14 @@ func readJSON(r io.ReadCloser, v interface{}) error {
 	return json.NewDecoder(r).Decode(v)
 }
 
+func readPending(r io.ReadCloser) error {
+	var pending api.PendingResponse
+	if err := readJSON(r, &pending); err != nil {
+		return errors.Wrap(err, "error reading pending response")
+	}
+	return &PendingError{ID: pending.ID}
+}
+
 func readError(r io.ReadCloser) error {
 	defer r.Close()
 	apiErr := new(api.Error)
@@ -14,7 +14,9 @@ import (
 	"time"
 
 	"github.com/RTradeLtd/ca-certificates/api"
+	"github.com/RTradeLtd/ca-certificates/authority"
 	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/crypto/pemutil"
 	"github.com/RTradeLtd/ca-cli/crypto/x509util"
 	"github.com/smallstep/assert"
 )
@@ -249,6 +251,71 @@ func TestClient_Root(t *testing.T) {
 	}
 }
 
+func TestClient_Bootstrap(t *testing.T) {
+	ca, caURL, err := startCAServer("testdata/ca.json")
+	assert.FatalError(t, err)
+	defer ca.Stop()
+
+	sha := "ef742f95dc0d8aa82d3cca4017af6dac3fce84290344159891952d18c53eefe7"
+	root, err := pemutil.ReadCertificate("testdata/secrets/root_ca.crt")
+	assert.FatalError(t, err)
+
+	// A server with a different certificate that returns the right root.
+	forged := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		api.JSON(w, &api.BootstrapResponse{
+			RootPEM: api.Certificate{Certificate: root},
+			Roots:   []api.Certificate{{Certificate: root}},
+		})
+	}))
+	defer forged.Close()
+	// A CA without the bootstrap endpoint.
+	old := httptest.NewTLSServer(http.NotFoundHandler())
+	defer old.Close()
+
+	tests := []struct {
+		name       string
+		caURL      string
+		sha        string
+		wantErr    bool
+		statusCode int
+	}{
+		{"ok", caURL, sha, false, 0},
+		{"ok-dashes", caURL, "EF742F95-dc0d8aa8-2d3cca40-17af6dac-3fce8429-0344159891952d18c53eefe7", false, 0},
+		{"fail-fingerprint", caURL, "a047a37fa2d2e118a4f5095fe074d6cfe0e352425a7632bf8659c03919a6c81d", true, http.StatusNotFound},
+		{"fail-forged", forged.URL, sha, true, 0},
+		{"fail-old", old.URL, sha, true, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClient(tt.caURL, WithTransport(http.DefaultTransport))
+			assert.FatalError(t, err)
+			got, err := c.Bootstrap(tt.sha)
+			if tt.wantErr {
+				assert.Error(t, err)
+				if tt.statusCode != 0 {
+					if e, ok := err.(*api.Error); assert.True(t, ok) {
+						assert.Equals(t, tt.statusCode, e.StatusCode())
+					}
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, root.Raw, got.RootPEM.Raw)
+			assert.Len(t, 1, got.Roots)
+			assert.Equals(t, root.Raw, got.Roots[0].Raw)
+			assert.Equals(t, api.CurrentVersion, got.Defaults.APIVersion)
+		})
+	}
+
+	// The client created with a fingerprint trusts the CA.
+	c, err := NewClient(caURL, WithRootSHA256(sha))
+	assert.FatalError(t, err)
+	_, err = c.Health()
+	assert.FatalError(t, err)
+	_, err = NewClient(old.URL, WithRootSHA256(sha))
+	assert.Error(t, err)
+}
+
 func TestClient_Sign(t *testing.T) {
 	ok := &api.SignResponse{
 		ServerPEM: api.Certificate{Certificate: parseCertificate(certPEM)},
@@ -332,6 +399,72 @@ func TestClient_Sign(t *testing.T) {
 	}
 }
 
+func TestClient_Pending(t *testing.T) {
+	ok := &api.SignResponse{
+		ServerPEM: api.Certificate{Certificate: parseCertificate(certPEM)},
+		CaPEM:     api.Certificate{Certificate: parseCertificate(rootPEM)},
+		CertChainPEM: []api.Certificate{
+			{Certificate: parseCertificate(certPEM)},
+			{Certificate: parseCertificate(rootPEM)},
+		},
+	}
+	pending := &api.PendingResponse{ID: "the-id", Status: authority.StatusPending}
+	forbidden := api.Forbidden(fmt.Errorf("Forbidden"))
+	notFound := api.NotFound(fmt.Errorf("Not Found"))
+
+	tests := []struct {
+		name         string
+		response     interface{}
+		responseCode int
+		wantErr      error
+	}{
+		{"ok", ok, 201, nil},
+		{"pending", pending, 202, &PendingError{ID: "the-id"}},
+		{"denied", forbidden, 403, forbidden},
+		{"not found", notFound, 404, notFound},
+	}
+
+	srv := httptest.NewServer(nil)
+	defer srv.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClient(srv.URL, WithTransport(http.DefaultTransport))
+			if err != nil {
+				t.Errorf("NewClient() error = %v", err)
+				return
+			}
+
+			srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.URL.Path != "/pending/the-id" {
+					t.Errorf("Client.Pending() path = %s, want /pending/the-id", req.URL.Path)
+				}
+				api.JSONStatus(w, tt.response, tt.responseCode)
+			})
+
+			got, err := c.Pending("the-id")
+			if (err != nil) != (tt.wantErr != nil) {
+				t.Errorf("Client.Pending() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			switch {
+			case err != nil:
+				if got != nil {
+					t.Errorf("Client.Pending() = %v, want nil", got)
+				}
+				if !reflect.DeepEqual(err, tt.wantErr) {
+					t.Errorf("Client.Pending() error = %v, want %v", err, tt.wantErr)
+				}
+			default:
+				if !reflect.DeepEqual(got, tt.response) {
+					t.Errorf("Client.Pending() = %v, want %v", got, tt.response)
+				}
+			}
+		})
+	}
+}
+
 func TestClient_Revoke(t *testing.T) {
 	ok := &api.RevokeResponse{Status: "ok"}
 	request := &api.RevokeRequest{
@@ -469,6 +602,148 @@ func TestClient_Renew(t *testing.T) {
 	}
 }
 
+func TestClient_RenewWithToken(t *testing.T) {
+	ok := &api.SignResponse{
+		ServerPEM: api.Certificate{Certificate: parseCertificate(certPEM)},
+		CaPEM:     api.Certificate{Certificate: parseCertificate(rootPEM)},
+		CertChainPEM: []api.Certificate{
+			{Certificate: parseCertificate(certPEM)},
+			{Certificate: parseCertificate(rootPEM)},
+		},
+	}
+	unauthorized := api.Unauthorized(fmt.Errorf("Unauthorized"))
+
+	tests := []struct {
+		name         string
+		response     interface{}
+		responseCode int
+		wantErr      bool
+	}{
+		{"ok", ok, 200, false},
+		{"unauthorized", unauthorized, 401, true},
+	}
+
+	srv := httptest.NewServer(nil)
+	defer srv.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClient(srv.URL, WithTransport(http.DefaultTransport))
+			if err != nil {
+				t.Errorf("NewClient() error = %v", err)
+				return
+			}
+
+			srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.Header.Get("Authorization") != "Bearer the-token" {
+					api.JSONStatus(w, api.BadRequest(fmt.Errorf("missing token")), 400)
+					return
+				}
+				api.JSONStatus(w, tt.response, tt.responseCode)
+			})
+
+			got, err := c.RenewWithToken("the-token")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.RenewWithToken() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			switch {
+			case err != nil:
+				if got != nil {
+					t.Errorf("Client.RenewWithToken() = %v, want nil", got)
+				}
+				if !reflect.DeepEqual(err, tt.response) {
+					t.Errorf("Client.RenewWithToken() error = %v, want %v", err, tt.response)
+				}
+			default:
+				if !reflect.DeepEqual(got, tt.response) {
+					t.Errorf("Client.RenewWithToken() = %v, want %v", got, tt.response)
+				}
+			}
+		})
+	}
+}
+
+func TestClient_Rekey(t *testing.T) {
+	ok := &api.SignResponse{
+		ServerPEM: api.Certificate{Certificate: parseCertificate(certPEM)},
+		CaPEM:     api.Certificate{Certificate: parseCertificate(rootPEM)},
+		CertChainPEM: []api.Certificate{
+			{Certificate: parseCertificate(certPEM)},
+			{Certificate: parseCertificate(rootPEM)},
+		},
+	}
+	request := &api.RekeyRequest{
+		CsrPEM: api.CertificateRequest{CertificateRequest: parseCertificateRequest(csrPEM)},
+	}
+	unauthorized := api.Unauthorized(fmt.Errorf("Unauthorized"))
+	badRequest := api.BadRequest(fmt.Errorf("Bad Request"))
+
+	tests := []struct {
+		name         string
+		request      *api.RekeyRequest
+		response     interface{}
+		responseCode int
+		wantErr      bool
+	}{
+		{"ok", request, ok, 200, false},
+		{"unauthorized", request, unauthorized, 401, true},
+		{"empty request", &api.RekeyRequest{}, badRequest, 400, true},
+		{"nil request", nil, badRequest, 400, true},
+	}
+
+	srv := httptest.NewServer(nil)
+	defer srv.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClient(srv.URL, WithTransport(http.DefaultTransport))
+			if err != nil {
+				t.Errorf("NewClient() error = %v", err)
+				return
+			}
+
+			srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				body := new(api.RekeyRequest)
+				if err := api.ReadJSON(req.Body, body); err != nil {
+					api.WriteError(w, badRequest)
+					return
+				} else if !reflect.DeepEqual(body, tt.request) {
+					if tt.request == nil {
+						if !reflect.DeepEqual(body, &api.RekeyRequest{}) {
+							t.Errorf("Client.Rekey() request = %v, wants %v", body, tt.request)
+						}
+					} else {
+						t.Errorf("Client.Rekey() request = %v, wants %v", body, tt.request)
+					}
+				}
+				api.JSONStatus(w, tt.response, tt.responseCode)
+			})
+
+			got, err := c.Rekey(tt.request, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.Rekey() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			switch {
+			case err != nil:
+				if got != nil {
+					t.Errorf("Client.Rekey() = %v, want nil", got)
+				}
+				if !reflect.DeepEqual(err, tt.response) {
+					t.Errorf("Client.Rekey() error = %v, want %v", err, tt.response)
+				}
+			default:
+				if !reflect.DeepEqual(got, tt.response) {
+					t.Errorf("Client.Rekey() = %v, want %v", got, tt.response)
+				}
+			}
+		})
+	}
+}
+
 func TestClient_Provisioners(t *testing.T) {
 	ok := &api.ProvisionersResponse{
 		Provisioners: provisioner.List{},
@@ -487,6 +762,7 @@ func TestClient_Provisioners(t *testing.T) {
 		{"ok with cursor", []ProvisionerOption{WithProvisionerCursor("abc")}, "/provisioners?cursor=abc", ok, 200, false},
 		{"ok with limit", []ProvisionerOption{WithProvisionerLimit(10)}, "/provisioners?limit=10", ok, 200, false},
 		{"ok with cursor+limit", []ProvisionerOption{WithProvisionerCursor("abc"), WithProvisionerLimit(10)}, "/provisioners?cursor=abc&limit=10", ok, 200, false},
+		{"ok with type", []ProvisionerOption{WithProvisionerType("JWK"), WithProvisionerLimit(10)}, "/provisioners?limit=10&type=JWK", ok, 200, false},
 		{"fail", nil, "/provisioners", internalServerError, 500, true},
 	}
 
@@ -650,6 +926,65 @@ func TestClient_Roots(t *testing.T) {
 	}
 }
 
+func TestClient_Intermediates(t *testing.T) {
+	ok := &api.IntermediatesResponse{
+		Certificates: []api.Certificate{
+			{Certificate: parseCertificate(certPEM)},
+		},
+	}
+	internalServerError := api.InternalServerError(fmt.Errorf("Internal Server Error"))
+
+	tests := []struct {
+		name         string
+		response     interface{}
+		responseCode int
+		wantErr      bool
+	}{
+		{"ok", ok, 200, false},
+		{"fail", internalServerError, 500, true},
+	}
+
+	srv := httptest.NewServer(nil)
+	defer srv.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClient(srv.URL, WithTransport(http.DefaultTransport))
+			if err != nil {
+				t.Errorf("NewClient() error = %v", err)
+				return
+			}
+
+			srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.RequestURI != "/intermediates" {
+					t.Errorf("RequestURI = %s, want /intermediates", req.RequestURI)
+				}
+				api.JSONStatus(w, tt.response, tt.responseCode)
+			})
+
+			got, err := c.Intermediates()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.Intermediates() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			switch {
+			case err != nil:
+				if got != nil {
+					t.Errorf("Client.Intermediates() = %v, want nil", got)
+				}
+				if !reflect.DeepEqual(err, tt.response) {
+					t.Errorf("Client.Intermediates() error = %v, want %v", err, tt.response)
+				}
+			default:
+				if !reflect.DeepEqual(got, tt.response) {
+					t.Errorf("Client.Intermediates() = %v, want %v", got, tt.response)
+				}
+			}
+		})
+	}
+}
+
 func TestClient_Federation(t *testing.T) {
 	ok := &api.FederationResponse{
 		Certificates: []api.Certificate{
@@ -809,3 +1144,85 @@ func TestClient_RootFingerprintWithServer(t *testing.T) {
 	assert.FatalError(t, err)
 	assert.Equals(t, "ef742f95dc0d8aa82d3cca4017af6dac3fce84290344159891952d18c53eefe7", fp)
 }
+
+func TestClient_NegotiateVersion(t *testing.T) {
+	ok := &api.VersionsResponse{Versions: []string{"v1", "v2"}, Current: "v2"}
+	internalServerError := api.InternalServerError(fmt.Errorf("Internal Server Error"))
+
+	tests := []struct {
+		name         string
+		versions     []string
+		response     interface{}
+		responseCode int
+		want         string
+		wantErr      bool
+	}{
+		{"ok", nil, ok, 200, "v1", false},
+		{"ok-preference", []string{"v2", "v1"}, ok, 200, "v2", false},
+		{"ok-legacy", nil, api.NotFound(fmt.Errorf("Not Found")), 404, "", false},
+		{"fail-unsupported", []string{"v3"}, ok, 200, "", true},
+		{"fail", nil, internalServerError, 500, "", true},
+	}
+
+	srv := httptest.NewServer(nil)
+	defer srv.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := NewClient(srv.URL, WithTransport(http.DefaultTransport))
+			if err != nil {
+				t.Errorf("NewClient() error = %v", err)
+				return
+			}
+
+			srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				if req.RequestURI != "/versions" {
+					t.Errorf("RequestURI = %s, want /versions", req.RequestURI)
+				}
+				api.JSONStatus(w, tt.response, tt.responseCode)
+			})
+
+			got, err := c.NegotiateVersion(tt.versions...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Client.NegotiateVersion() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("Client.NegotiateVersion() = %v, want %v", got, tt.want)
+			}
+			if !tt.wantErr {
+				srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+					want := "/health"
+					if tt.want != "" {
+						want = "/" + tt.want + "/health"
+					}
+					if req.RequestURI != want {
+						t.Errorf("RequestURI = %s, want %s", req.RequestURI, want)
+					}
+					api.JSON(w, api.HealthResponse{Status: "ok"})
+				})
+				if _, err := c.Health(); err != nil {
+					t.Errorf("Client.Health() error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestClient_WithAPIVersion(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.RequestURI != "/v1/roots" {
+			t.Errorf("RequestURI = %s, want /v1/roots", req.RequestURI)
+		}
+		api.JSON(w, &api.RootsResponse{})
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(srv.URL, WithTransport(http.DefaultTransport), WithAPIVersion(api.V1))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if _, err := c.Roots(); err != nil {
+		t.Errorf("Client.Roots() error = %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package ca
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/credentials"
+)
+
+// ServerCredentials returns the gRPC transport credentials of a server that
+// uses the managed certificate, and requires client certificates signed by
+// the roots of the CA.
+//
+// Usage:
+//
+//	srv := grpc.NewServer(grpc.Creds(m.ServerCredentials()))
+func (m *ManagedCertificate) ServerCredentials() credentials.TransportCredentials {
+	return credentials.NewTLS(m.serverTLSConfig([]string{"h2"}))
+}
+
+// ClientCredentials returns the gRPC transport credentials of a client that
+// uses the managed certificate as a client certificate, and only trusts the
+// roots of the CA.
+//
+// Usage:
+//
+//	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(m.ClientCredentials()))
+func (m *ManagedCertificate) ClientCredentials() credentials.TransportCredentials {
+	return credentials.NewTLS(m.ClientTLSConfig())
+}
+
+// TokenCredentials are gRPC per-RPC credentials that send a new one-time
+// token, signed with the key of a JWK provisioner, in the authorization
+// metadata of each call. The audience of the tokens is the URI of the called
+// service, and the subject is the given one.
+//
+// Usage:
+//
+//	conn, err := grpc.Dial(addr,
+//	    grpc.WithTransportCredentials(m.ClientCredentials()),
+//	    grpc.WithPerRPCCredentials(ca.NewTokenCredentials(p, "client.internal")))
+type TokenCredentials struct {
+	provisioner *Provisioner
+	subject     string
+}
+
+// NewTokenCredentials returns per-RPC credentials that sign the tokens for
+// the given subject with the given provisioner.
+func NewTokenCredentials(p *Provisioner, subject string) *TokenCredentials {
+	return &TokenCredentials{
+		provisioner: p,
+		subject:     subject,
+	}
+}
+
+// GetRequestMetadata implements the credentials.PerRPCCredentials interface.
+// It returns the authorization metadata with a new token.
+func (c *TokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	if len(uri) == 0 || uri[0] == "" {
+		return nil, errors.New("error generating token: missing service uri")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ott, err := c.provisioner.token(c.subject, uri[0], nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating token")
+	}
+	return map[string]string{
+		"authorization": "Bearer " + ott,
+	}, nil
+}
+
+// RequireTransportSecurity implements the credentials.PerRPCCredentials
+// interface. The tokens are only sent over TLS.
+func (c *TokenCredentials) RequireTransportSecurity() bool {
+	return true
+}
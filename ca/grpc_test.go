@@ -0,0 +1,110 @@
+package ca
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-cli/jose"
+	"github.com/smallstep/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestManagedCertificate_Credentials(t *testing.T) {
+	ca, caURL, err := startCAServer("testdata/ca.json")
+	assert.FatalError(t, err)
+	defer ca.Stop()
+
+	sha := "ef742f95dc0d8aa82d3cca4017af6dac3fce84290344159891952d18c53eefe7"
+	server, err := NewManagedCertificate(generateBootstrapToken(caURL, "127.0.0.1", sha))
+	assert.FatalError(t, err)
+	client, err := NewManagedCertificate(generateBootstrapToken(caURL, "client", sha))
+	assert.FatalError(t, err)
+	p := getTestProvisioner(t, caURL)
+
+	type call struct {
+		peer          string
+		authorization string
+	}
+	calls := make(chan call, 1)
+	srv := grpc.NewServer(grpc.Creds(server.ServerCredentials()),
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			var c call
+			if pr, ok := peer.FromContext(ctx); ok {
+				if info, ok := pr.AuthInfo.(credentials.TLSInfo); ok && len(info.State.PeerCertificates) > 0 {
+					c.peer = info.State.PeerCertificates[0].Subject.CommonName
+				}
+			}
+			if md, ok := metadata.FromIncomingContext(ctx); ok && len(md["authorization"]) > 0 {
+				c.authorization = md["authorization"][0]
+			}
+			calls <- c
+			return handler(ctx, req)
+		}))
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.FatalError(t, err)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, lis.Addr().String(),
+		grpc.WithTransportCredentials(client.ClientCredentials()),
+		grpc.WithPerRPCCredentials(NewTokenCredentials(p, "client")))
+	assert.FatalError(t, err)
+	defer conn.Close()
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.FatalError(t, err)
+	assert.Equals(t, healthpb.HealthCheckResponse_SERVING, resp.Status)
+
+	c := <-calls
+	assert.Equals(t, "client", c.peer)
+	assert.True(t, strings.HasPrefix(c.authorization, "Bearer "))
+	jwt, err := jose.ParseSigned(strings.TrimPrefix(c.authorization, "Bearer "))
+	assert.FatalError(t, err)
+	var claims jose.Claims
+	assert.FatalError(t, jwt.Claims(p.jwk.Public(), &claims))
+	assert.FatalError(t, claims.ValidateWithLeeway(jose.Expected{
+		Audience: []string{"https://" + lis.Addr().String() + "/grpc.health.v1.Health"},
+		Issuer:   "mariano",
+		Subject:  "client",
+		Time:     time.Now().UTC(),
+	}, time.Minute))
+
+	// Clients without a certificate are rejected.
+	tlsConfig := client.ClientTLSConfig()
+	tlsConfig.GetClientCertificate = nil
+	conn2, err := grpc.DialContext(ctx, lis.Addr().String(),
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	assert.FatalError(t, err)
+	defer conn2.Close()
+	_, err = healthpb.NewHealthClient(conn2).Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.Error(t, err)
+}
+
+func TestTokenCredentials(t *testing.T) {
+	p := getTestProvisioner(t, "https://127.0.0.1:9000")
+	creds := NewTokenCredentials(p, "client")
+	assert.True(t, creds.RequireTransportSecurity())
+
+	_, err := creds.GetRequestMetadata(context.Background())
+	assert.Error(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = creds.GetRequestMetadata(ctx, "https://127.0.0.1:9000/foo.Bar")
+	assert.Equals(t, context.Canceled, err)
+
+	md, err := creds.GetRequestMetadata(context.Background(), "https://127.0.0.1:9000/foo.Bar")
+	assert.FatalError(t, err)
+	assert.True(t, strings.HasPrefix(md["authorization"], "Bearer "))
+}
@@ -0,0 +1,139 @@
+package ca
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+
+	"github.com/RTradeLtd/ca-certificates/api"
+	"github.com/pkg/errors"
+)
+
+// IssuedCertificate is a certificate issued by an Issuer. It has the same
+// fields as certmagic.IssuedCertificate.
+type IssuedCertificate struct {
+	// The PEM encoding of the certificate chain.
+	Certificate []byte
+	// The sign response of the CA.
+	Metadata interface{}
+}
+
+// Issuer issues certificates for arbitrary CSRs using the key of a JWK
+// provisioner. Its methods have the signatures of the Issuer and Revoker
+// interfaces of certmagic, except for the certmagic types, so it can be used
+// by Caddy and other certmagic users with a small adapter:
+//
+//	type issuer struct{ *ca.Issuer }
+//
+//	func (i issuer) Issue(ctx context.Context, csr *x509.CertificateRequest) (*certmagic.IssuedCertificate, error) {
+//	    crt, err := i.Issuer.Issue(ctx, csr)
+//	    if err != nil {
+//	        return nil, err
+//	    }
+//	    return &certmagic.IssuedCertificate{Certificate: crt.Certificate, Metadata: crt.Metadata}, nil
+//	}
+//
+//	func (i issuer) Revoke(ctx context.Context, cert certmagic.CertificateResource, reason int) error {
+//	    return i.Issuer.Revoke(ctx, cert.CertificatePEM, reason)
+//	}
+type Issuer struct {
+	provisioner *Provisioner
+}
+
+// NewIssuer creates a new Issuer that signs the tokens with the given
+// provisioner.
+func NewIssuer(p *Provisioner) *Issuer {
+	return &Issuer{provisioner: p}
+}
+
+// IssuerKey returns a string that identifies the CA and the provisioner, it
+// is used by certmagic to separate the certificates of different issuers in
+// its storage.
+func (i *Issuer) IssuerKey() string {
+	return i.provisioner.endpoint.Host + "-" + i.provisioner.Name()
+}
+
+// Issue signs the given CSR. The token authorizes the common name and the
+// SANs of the CSR, so the provisioner policies decide the names allowed. The
+// CSR must have a common name, certmagic users must set it in the CSRs.
+func (i *Issuer) Issue(ctx context.Context, csr *x509.CertificateRequest) (*IssuedCertificate, error) {
+	// The JWK provisioners require the common name in the token subject.
+	subject := csr.Subject.CommonName
+	if subject == "" {
+		return nil, errors.New("error issuing certificate: csr does not have a common name")
+	}
+	ott, err := i.provisioner.Token(subject, csrSANs(csr)...)
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating token")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sign, err := i.provisioner.Sign(&api.SignRequest{
+		CsrPEM: api.CertificateRequest{CertificateRequest: csr},
+		OTT:    ott,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var chain []byte
+	for _, crt := range sign.CertChainPEM {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw})...)
+	}
+	// Responses of older CAs do not have the chain.
+	if len(chain) == 0 {
+		for _, crt := range []api.Certificate{sign.ServerPEM, sign.CaPEM} {
+			if crt.Certificate != nil {
+				chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw})...)
+			}
+		}
+	}
+	return &IssuedCertificate{
+		Certificate: chain,
+		Metadata:    sign,
+	}, nil
+}
+
+// Revoke revokes the first certificate in the given PEM encoded chain with
+// the given RFC 5280 reason code. The revocation is passive, the CA does not
+// publish it.
+func (i *Issuer) Revoke(ctx context.Context, certPEM []byte, reason int) error {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return errors.New("error revoking certificate: invalid PEM certificate")
+	}
+	crt, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return errors.Wrap(err, "error revoking certificate")
+	}
+	serial := crt.SerialNumber.String()
+	ott, err := i.provisioner.RevokeToken(serial)
+	if err != nil {
+		return errors.Wrap(err, "error generating token")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err = i.provisioner.Client.Revoke(&api.RevokeRequest{
+		Serial:     serial,
+		OTT:        ott,
+		ReasonCode: reason,
+		Passive:    true,
+	}, nil)
+	return err
+}
+
+// csrSANs returns the DNS names, IP addresses, emails and URIs of the CSR.
+func csrSANs(csr *x509.CertificateRequest) []string {
+	var sans []string
+	sans = append(sans, csr.DNSNames...)
+	for _, ip := range csr.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, csr.EmailAddresses...)
+	for _, u := range csr.URIs {
+		sans = append(sans, u.String())
+	}
+	return sans
+}
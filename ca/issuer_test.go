@@ -0,0 +1,119 @@
+package ca
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/RTradeLtd/ca-certificates/api"
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/smallstep/assert"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+func newTestCSR(t *testing.T, cn string, dnsNames ...string) *x509.CertificateRequest {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: cn},
+		DNSNames: dnsNames,
+	}, key)
+	assert.FatalError(t, err)
+	csr, err := x509.ParseCertificateRequest(der)
+	assert.FatalError(t, err)
+	return csr
+}
+
+func TestIssuer(t *testing.T) {
+	// The revocation requires a database.
+	dir, err := ioutil.TempDir("", "issuer")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+	config, err := authority.LoadConfiguration("testdata/ca.json")
+	assert.FatalError(t, err)
+	config.DB = &db.Config{Type: "bbolt", DataSource: filepath.Join(dir, "db")}
+	ca, err := New(config)
+	assert.FatalError(t, err)
+	defer ca.auth.Shutdown()
+	srv := startTestServer(ca.srv.TLSConfig, ca.srv.Handler)
+	defer srv.Close()
+	issuer := NewIssuer(getTestProvisioner(t, srv.URL))
+	assert.Equals(t, srv.Listener.Addr().String()+"-mariano", issuer.IssuerKey())
+
+	// Issue
+	got, err := issuer.Issue(context.Background(), newTestCSR(t, "test.smallstep.com", "test.smallstep.com", "www.smallstep.com"))
+	assert.FatalError(t, err)
+	block, rest := pem.Decode(got.Certificate)
+	assert.NotNil(t, block)
+	crt, err := x509.ParseCertificate(block.Bytes)
+	assert.FatalError(t, err)
+	assert.Equals(t, "test.smallstep.com", crt.Subject.CommonName)
+	assert.Equals(t, []string{"test.smallstep.com", "www.smallstep.com"}, crt.DNSNames)
+	block, _ = pem.Decode(rest)
+	if assert.NotNil(t, block) {
+		assert.Equals(t, "CERTIFICATE", block.Type)
+	}
+	_, ok := got.Metadata.(*api.SignResponse)
+	assert.True(t, ok)
+
+	_, err = issuer.Issue(context.Background(), newTestCSR(t, "", "test.smallstep.com"))
+	assert.Error(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = issuer.Issue(ctx, newTestCSR(t, "test.smallstep.com"))
+	assert.Equals(t, context.Canceled, err)
+
+	// Revoke
+	assert.FatalError(t, issuer.Revoke(context.Background(), got.Certificate, 1))
+	assert.Error(t, issuer.Revoke(context.Background(), []byte("foo"), 1))
+}
+
+func TestManager(t *testing.T) {
+	srv := startCATestServer()
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "manager")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	m := &Manager{
+		Issuer:     NewIssuer(getTestProvisioner(t, srv.URL)),
+		Cache:      autocert.DirCache(dir),
+		HostPolicy: autocert.HostWhitelist("test.smallstep.com", "127.0.0.1"),
+	}
+	assert.Equals(t, []string{"h2", "http/1.1"}, m.TLSConfig().NextProtos)
+
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "Test.Smallstep.com."})
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"test.smallstep.com"}, cert.Leaf.DNSNames)
+	again, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "test.smallstep.com"})
+	assert.FatalError(t, err)
+	assert.True(t, cert == again)
+
+	cert, err = m.GetCertificate(&tls.ClientHelloInfo{ServerName: "127.0.0.1"})
+	assert.FatalError(t, err)
+	assert.Equals(t, "127.0.0.1", cert.Leaf.IPAddresses[0].String())
+
+	// A new manager uses the certificates in the cache.
+	m2 := &Manager{Issuer: m.Issuer, Cache: m.Cache}
+	cached, err := m2.GetCertificate(&tls.ClientHelloInfo{ServerName: "127.0.0.1"})
+	assert.FatalError(t, err)
+	assert.Equals(t, cert.Certificate, cached.Certificate)
+	assert.Equals(t, cert.PrivateKey, cached.PrivateKey)
+
+	_, err = m.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.smallstep.com"})
+	assert.Error(t, err)
+	_, err = m.GetCertificate(&tls.ClientHelloInfo{})
+	assert.Error(t, err)
+	_, err = m.GetCertificate(&tls.ClientHelloInfo{ServerName: "../foo"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,26 @@
+package ca
+
+import (
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/k8s"
+	"github.com/pkg/errors"
+)
+
+// newKubernetesController creates the Kubernetes controller for the given
+// configuration.
+func newKubernetesController(auth *authority.Authority, config *authority.Config) (*k8s.Controller, error) {
+	c := config.Kubernetes
+	client, err := k8s.NewClient(c.APIServer, c.TokenFile, c.CAFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating kubernetes controller")
+	}
+	return k8s.New(client, auth, k8s.Options{
+		Provisioner:   c.Provisioner,
+		K8sSA:         c.IsK8sSA(config),
+		Namespaces:    c.Namespaces,
+		ClusterDomain: c.GetClusterDomain(),
+		CertDuration:  c.GetCertDuration(),
+		RenewBefore:   c.GetRenewBefore(),
+		Resync:        c.GetResync(),
+	}), nil
+}
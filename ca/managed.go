@@ -0,0 +1,241 @@
+package ca
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/RTradeLtd/ca-certificates/api"
+	"github.com/pkg/errors"
+)
+
+// ManagedCertificate keeps a certificate issued by the CA fresh in memory. It
+// renews the certificate in a background goroutine after two thirds of its
+// validity, or RenewBefore its expiration, and it refreshes the roots of the
+// CA on each renewal. Its methods can be used directly in a tls.Config, or
+// ServerTLSConfig and ClientTLSConfig can be used to get a tls.Config that
+// only trusts the roots of the CA.
+//
+// Usage:
+//
+//	m, err := ca.NewManagedCertificate(token)
+//	if err != nil {
+//	    return err
+//	}
+//	m.Start(ctx)
+//	srv := &http.Server{Addr: ":443", Handler: handler, TLSConfig: m.ServerTLSConfig()}
+//	return srv.ListenAndServeTLS("", "")
+type ManagedCertificate struct {
+	client    *Client
+	pk        crypto.PrivateKey
+	renewer   *TLSRenewer
+	tlsConfig *tls.Config
+	transport *http.Transport
+	mutex     sync.RWMutex
+	roots     []*x509.Certificate
+	pool      *x509.CertPool
+	hooks     []func(*tls.Certificate) error
+}
+
+// NewManagedCertificate gets a new certificate with the given bootstrap token
+// and returns a ManagedCertificate that renews it. The renewal does not start
+// until Start is called.
+func NewManagedCertificate(token string, opts ...tlsRenewerOptions) (*ManagedCertificate, error) {
+	client, err := Bootstrap(token)
+	if err != nil {
+		return nil, err
+	}
+	req, pk, err := CreateSignRequest(token)
+	if err != nil {
+		return nil, err
+	}
+	sign, err := client.Sign(req)
+	if err != nil {
+		return nil, err
+	}
+	return client.NewManagedCertificate(sign, pk, opts...)
+}
+
+// NewManagedCertificate returns a ManagedCertificate that renews the
+// certificate in the given sign response. The client transport is replaced by
+// one that uses the certificate. The renewal does not start until Start is
+// called.
+func (c *Client) NewManagedCertificate(sign *api.SignResponse, pk crypto.PrivateKey, opts ...tlsRenewerOptions) (*ManagedCertificate, error) {
+	cert, err := TLSCertificate(sign, pk)
+	if err != nil {
+		return nil, err
+	}
+	renewer, err := NewTLSRenewer(cert, nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// The renewals use mTLS with the current certificate.
+	tlsConfig := getDefaultTLSConfig(sign)
+	tlsConfig.GetClientCertificate = renewer.GetClientCertificate
+	tlsCtx := newTLSOptionCtx(c, tlsConfig, sign)
+	if err := tlsCtx.apply(nil); err != nil {
+		return nil, err
+	}
+	tr, err := getDefaultTransport(tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	tr.DialTLS = c.buildDialTLS(tlsCtx)
+	c.SetTransport(tr)
+
+	m := &ManagedCertificate{
+		client:    c,
+		pk:        pk,
+		renewer:   renewer,
+		tlsConfig: getDefaultTLSConfig(sign),
+		transport: tr,
+	}
+	if err := m.refreshRoots(); err != nil {
+		return nil, err
+	}
+
+	renew := getRenewFunc(tlsCtx, c, tr, pk)
+	renewer.RenewCertificate = func() (*tls.Certificate, error) {
+		cert, err := renew()
+		if err != nil {
+			log.Printf("error renewing certificate: %v", err)
+			return nil, err
+		}
+		// Keep the previous roots if the CA is not available.
+		if err := m.refreshRoots(); err != nil {
+			log.Println(err)
+		}
+		m.mutex.RLock()
+		hooks := m.hooks
+		m.mutex.RUnlock()
+		for _, fn := range hooks {
+			if err := fn(cert); err != nil {
+				return nil, err
+			}
+		}
+		return cert, nil
+	}
+	return m, nil
+}
+
+// OnRenew adds a function called with the new certificate after each
+// renewal, before the certificate is used. If the function returns an error
+// the certificate is discarded and the renewal is retried.
+func (m *ManagedCertificate) OnRenew(fn func(*tls.Certificate) error) {
+	m.mutex.Lock()
+	m.hooks = append(m.hooks, fn)
+	m.mutex.Unlock()
+}
+
+// Start starts the renewal goroutine, it stops when the given context is
+// done or when Stop is called.
+func (m *ManagedCertificate) Start(ctx context.Context) {
+	m.renewer.RunContext(ctx)
+}
+
+// Stop stops the renewal of the certificate.
+func (m *ManagedCertificate) Stop() {
+	m.renewer.Stop()
+}
+
+// Certificate returns the current certificate.
+func (m *ManagedCertificate) Certificate() *tls.Certificate {
+	return m.renewer.getCertificate()
+}
+
+// Roots returns the current roots of the CA.
+func (m *ManagedCertificate) Roots() []*x509.Certificate {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.roots
+}
+
+// RootPool returns a pool with the current roots of the CA.
+func (m *ManagedCertificate) RootPool() *x509.CertPool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.pool
+}
+
+// GetCertificate returns the current certificate, it can be used in the
+// tls.Config GetCertificate property.
+func (m *ManagedCertificate) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return m.renewer.getCertificate(), nil
+}
+
+// GetClientCertificate returns the current certificate, it can be used in the
+// tls.Config GetClientCertificate property.
+func (m *ManagedCertificate) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return m.renewer.getCertificate(), nil
+}
+
+// Transport returns the http.Transport that uses the certificate as a client
+// certificate and trusts the roots of the CA.
+func (m *ManagedCertificate) Transport() *http.Transport {
+	return m.transport
+}
+
+// ServerTLSConfig returns a tls.Config for servers that uses the current
+// certificate, and requires client certificates signed by the roots of the
+// CA. The roots are updated on each handshake, so root rotations do not
+// require a new tls.Config.
+func (m *ManagedCertificate) ServerTLSConfig() *tls.Config {
+	return m.serverTLSConfig(nil)
+}
+
+// serverTLSConfig returns the tls.Config of ServerTLSConfig with the given
+// application protocols. They cannot be added later, the config returned by
+// GetConfigForClient would not have them.
+func (m *ManagedCertificate) serverTLSConfig(nextProtos []string) *tls.Config {
+	tlsConfig := m.baseTLSConfig()
+	tlsConfig.NextProtos = nextProtos
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	tlsConfig.PreferServerCipherSuites = true
+	tlsConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		c := tlsConfig.Clone()
+		c.GetConfigForClient = nil
+		c.ClientCAs = m.RootPool()
+		c.RootCAs = c.ClientCAs
+		return c, nil
+	}
+	return tlsConfig
+}
+
+// ClientTLSConfig returns a tls.Config for clients that uses the current
+// certificate as a client certificate, and only trusts the current roots of
+// the CA.
+func (m *ManagedCertificate) ClientTLSConfig() *tls.Config {
+	return m.baseTLSConfig()
+}
+
+func (m *ManagedCertificate) baseTLSConfig() *tls.Config {
+	tlsConfig := m.tlsConfig.Clone()
+	tlsConfig.GetCertificate = m.GetCertificate
+	tlsConfig.GetClientCertificate = m.GetClientCertificate
+	tlsConfig.RootCAs = m.RootPool()
+	tlsConfig.ClientCAs = tlsConfig.RootCAs
+	return tlsConfig
+}
+
+// refreshRoots gets the current roots from the CA.
+func (m *ManagedCertificate) refreshRoots() error {
+	resp, err := m.client.Roots()
+	if err != nil {
+		return errors.Wrap(err, "error getting roots")
+	}
+	roots := make([]*x509.Certificate, 0, len(resp.Certificates))
+	pool := x509.NewCertPool()
+	for _, crt := range resp.Certificates {
+		roots = append(roots, crt.Certificate)
+		pool.AddCert(crt.Certificate)
+	}
+	m.mutex.Lock()
+	m.roots, m.pool = roots, pool
+	m.mutex.Unlock()
+	return nil
+}
@@ -0,0 +1,88 @@
+package ca
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func TestManagedCertificate(t *testing.T) {
+	reset := setMinCertDuration(1 * time.Second)
+	defer reset()
+
+	ca, caURL, err := startCAServer("testdata/rotate-ca-0.json")
+	assert.FatalError(t, err)
+	defer ca.Stop()
+
+	sha := "ef742f95dc0d8aa82d3cca4017af6dac3fce84290344159891952d18c53eefe7"
+	server, err := NewManagedCertificate(generateBootstrapToken(caURL, "127.0.0.1", sha))
+	assert.FatalError(t, err)
+	client, err := NewManagedCertificate(generateBootstrapToken(caURL, "client", sha))
+	assert.FatalError(t, err)
+	assert.Len(t, 1, server.Roots())
+	assert.Equals(t, server.Roots(), client.Roots())
+
+	var mutex sync.Mutex
+	var renewed []*tls.Certificate
+	server.OnRenew(func(cert *tls.Certificate) error {
+		mutex.Lock()
+		renewed = append(renewed, cert)
+		mutex.Unlock()
+		return nil
+	})
+
+	srv := startTestServer(server.ServerTLSConfig(), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	defer srv.Close()
+
+	get := func(tlsConfig *tls.Config) (string, error) {
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		resp, err := c.Get(srv.URL)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		return string(b), err
+	}
+
+	// mTLS with the roots of the CA.
+	body, err := get(client.ClientTLSConfig())
+	assert.FatalError(t, err)
+	assert.Equals(t, "client", body)
+
+	// The server requires a client certificate.
+	tlsConfig := client.ClientTLSConfig()
+	tlsConfig.GetClientCertificate = nil
+	_, err = get(tlsConfig)
+	assert.Error(t, err)
+
+	// The client only trusts the roots of the CA.
+	_, err = get(&tls.Config{GetClientCertificate: client.GetClientCertificate})
+	assert.Error(t, err)
+
+	// The certificates are valid for 5s and renewed before they expire.
+	ctx, cancel := context.WithCancel(context.Background())
+	server.Start(ctx)
+	client.Start(ctx)
+	first := server.Certificate()
+	time.Sleep(5 * time.Second)
+
+	body, err = get(client.ClientTLSConfig())
+	assert.FatalError(t, err)
+	assert.Equals(t, "client", body)
+	cancel()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if assert.True(t, len(renewed) > 0) {
+		assert.NotEquals(t, first.Leaf.Raw, renewed[0].Leaf.Raw)
+	}
+}
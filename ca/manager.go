@@ -0,0 +1,252 @@
+package ca
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// managerTimeout is the maximum duration of an issuance started in a TLS
+// handshake.
+var managerTimeout = time.Minute
+
+// Manager obtains and renews the certificates of a TLS server on demand, like
+// autocert.Manager, but it gets them from the CA with an Issuer instead of
+// ACME. The certificates are obtained in the first handshake for a server
+// name, stored in Cache if set, and renewed in the background in the first
+// handshake after two thirds of their validity.
+//
+// Usage:
+//
+//	p, err := ca.NewProvisioner("admin", "", caURL, password, ca.WithRootFile(rootFile))
+//	if err != nil {
+//	    return err
+//	}
+//	m := &ca.Manager{
+//	    Issuer:     ca.NewIssuer(p),
+//	    Cache:      autocert.DirCache("/var/lib/certs"),
+//	    HostPolicy: autocert.HostWhitelist("internal.example.com"),
+//	}
+//	srv := &http.Server{Addr: ":443", Handler: handler, TLSConfig: m.TLSConfig()}
+//	return srv.ListenAndServeTLS("", "")
+type Manager struct {
+	// Issuer gets the certificates from the CA.
+	Issuer *Issuer
+	// Cache optionally stores the certificates and keys, in the same format
+	// used by autocert.
+	Cache autocert.Cache
+	// HostPolicy controls the server names allowed, all by default.
+	HostPolicy autocert.HostPolicy
+	// RenewBefore is how long before the expiration the certificates are
+	// renewed, a third of their validity by default.
+	RenewBefore time.Duration
+
+	mutex sync.Mutex
+	state map[string]*managerState
+}
+
+type managerState struct {
+	sync.Mutex
+	cert     *tls.Certificate
+	renewing bool
+}
+
+// TLSConfig returns a tls.Config that uses GetCertificate and supports HTTP/2.
+func (m *Manager) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: m.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+}
+
+// GetCertificate implements the tls.Config GetCertificate callback. It
+// returns the certificate for the server name of the handshake, obtaining it
+// if necessary.
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := strings.TrimSuffix(strings.ToLower(hello.ServerName), ".")
+	if name == "" {
+		return nil, errors.New("ca/manager: missing server name")
+	}
+	if strings.ContainsAny(name, `+/\`) {
+		return nil, errors.Errorf("ca/manager: server name %s is not valid", name)
+	}
+
+	st := m.getState(name)
+	st.Lock()
+	defer st.Unlock()
+
+	now := time.Now()
+	if st.cert == nil {
+		st.cert = m.cacheGet(name)
+	}
+	if st.cert != nil && now.Before(st.cert.Leaf.NotAfter) {
+		if !st.renewing && !now.Before(m.renewAt(st.cert.Leaf)) {
+			st.renewing = true
+			go m.renew(name, st)
+		}
+		return st.cert, nil
+	}
+
+	// Missing or expired certificate.
+	ctx, cancel := context.WithTimeout(context.Background(), managerTimeout)
+	defer cancel()
+	if m.HostPolicy != nil {
+		if err := m.HostPolicy(ctx, name); err != nil {
+			return nil, err
+		}
+	}
+	cert, err := m.issue(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	st.cert = cert
+	return cert, nil
+}
+
+func (m *Manager) getState(name string) *managerState {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.state == nil {
+		m.state = make(map[string]*managerState)
+	}
+	st, ok := m.state[name]
+	if !ok {
+		st = new(managerState)
+		m.state[name] = st
+	}
+	return st
+}
+
+// renewAt returns the time when the given certificate should be renewed.
+func (m *Manager) renewAt(crt *x509.Certificate) time.Time {
+	if m.RenewBefore > 0 {
+		return crt.NotAfter.Add(-m.RenewBefore)
+	}
+	return crt.NotBefore.Add(crt.NotAfter.Sub(crt.NotBefore) * 2 / 3)
+}
+
+// renew replaces the certificate of the given state in the background, the
+// current one is used until then.
+func (m *Manager) renew(name string, st *managerState) {
+	ctx, cancel := context.WithTimeout(context.Background(), managerTimeout)
+	defer cancel()
+	cert, err := m.issue(ctx, name)
+	st.Lock()
+	defer st.Unlock()
+	st.renewing = false
+	if err != nil {
+		log.Printf("ca/manager: error renewing certificate for %s: %v", name, err)
+		return
+	}
+	st.cert = cert
+}
+
+// issue creates a new key and gets a certificate for the given name.
+func (m *Manager) issue(ctx context.Context, name string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "error generating key")
+	}
+	template := &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: name},
+	}
+	if ip := net.ParseIP(name); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{name}
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, key)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating certificate request")
+	}
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing certificate request")
+	}
+	issued, err := m.Issuer.Issue(ctx, csr)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPEM, err := getPEM(key)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := parseKeyPair(issued.Certificate, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	m.cachePut(ctx, name, keyPEM, issued.Certificate)
+	return cert, nil
+}
+
+// cacheGet returns the certificate in the cache for the given name, or nil if
+// it is not in the cache or it cannot be parsed. The data has the format of
+// autocert: the PEM encoded key followed by the chain.
+func (m *Manager) cacheGet(name string) *tls.Certificate {
+	if m.Cache == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), managerTimeout)
+	defer cancel()
+	data, err := m.Cache.Get(ctx, name)
+	if err != nil {
+		if err != autocert.ErrCacheMiss {
+			log.Printf("ca/manager: error reading certificate for %s: %v", name, err)
+		}
+		return nil
+	}
+	keyBlock, chain := pem.Decode(data)
+	if keyBlock == nil || !strings.Contains(keyBlock.Type, "PRIVATE") {
+		log.Printf("ca/manager: error parsing certificate for %s: missing private key", name)
+		return nil
+	}
+	cert, err := parseKeyPair(chain, pem.EncodeToMemory(keyBlock))
+	if err != nil {
+		log.Printf("ca/manager: error parsing certificate for %s: %v", name, err)
+		return nil
+	}
+	return cert
+}
+
+// cachePut stores the key and the chain for the given name in the cache.
+func (m *Manager) cachePut(ctx context.Context, name string, keyPEM, chain []byte) {
+	if m.Cache == nil {
+		return
+	}
+	var buf bytes.Buffer
+	buf.Write(keyPEM)
+	buf.Write(chain)
+	if err := m.Cache.Put(ctx, name, buf.Bytes()); err != nil {
+		log.Printf("ca/manager: error storing certificate for %s: %v", name, err)
+	}
+}
+
+// parseKeyPair returns the tls.Certificate with the given chain and key.
+func parseKeyPair(chainPEM, keyPEM []byte) (*tls.Certificate, error) {
+	cert, err := tls.X509KeyPair(chainPEM, keyPEM)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating tls certificate")
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing tls certificate")
+	}
+	cert.Leaf = leaf
+	return &cert, nil
+}
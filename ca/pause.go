@@ -0,0 +1,65 @@
+package ca
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/RTradeLtd/ca-certificates/api"
+	"github.com/pkg/errors"
+)
+
+// pauseRetryAfter is the value of the Retry-After header of the requests
+// rejected while the CA is paused.
+const pauseRetryAfter = "60"
+
+// pauseState is the paused state of the CA, it is kept on reloads.
+type pauseState struct {
+	paused int32
+}
+
+func (p *pauseState) set(paused bool) {
+	var v int32
+	if paused {
+		v = 1
+	}
+	atomic.StoreInt32(&p.paused, v)
+}
+
+func (p *pauseState) isPaused() bool {
+	return atomic.LoadInt32(&p.paused) == 1
+}
+
+// middleware rejects the requests with a 503 Service Unavailable while the CA
+// is paused.
+func (p *pauseState) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p.isPaused() {
+			w.Header().Set("Retry-After", pauseRetryAfter)
+			api.WriteError(w, api.NewError(http.StatusServiceUnavailable, errors.New("the CA is paused")))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// withPauseState sets the paused state of the CA running before a reload.
+func withPauseState(p *pauseState) Option {
+	return func(o *options) {
+		o.pause = p
+	}
+}
+
+// Pause pauses the CA. The servers keep listening, but the requests to the
+// API, the Unix socket and the insecure address are rejected with a 503
+// Service Unavailable until Continue is called, so the load balancers stop
+// sending requests to this instance.
+func (ca *CA) Pause() error {
+	ca.opts.pause.set(true)
+	return nil
+}
+
+// Continue resumes a paused CA.
+func (ca *CA) Continue() error {
+	ca.opts.pause.set(false)
+	return nil
+}
@@ -0,0 +1,29 @@
+package ca
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestCA_Pause(t *testing.T) {
+	ca := &CA{opts: &options{pause: new(pauseState)}}
+	handler := ca.opts.pause.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	serve := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/health", nil))
+		return w
+	}
+
+	assert.Equals(t, http.StatusOK, serve().Code)
+	assert.FatalError(t, ca.Pause())
+	w := serve()
+	assert.Equals(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equals(t, pauseRetryAfter, w.Header().Get("Retry-After"))
+	assert.FatalError(t, ca.Continue())
+	assert.Equals(t, http.StatusOK, serve().Code)
+}
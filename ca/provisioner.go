@@ -86,7 +86,17 @@ func (p *Provisioner) Token(subject string, sans ...string) (string, error) {
 	if len(sans) == 0 {
 		sans = []string{subject}
 	}
+	return p.token(subject, p.audience, sans)
+}
+
+// RevokeToken generates a token to revoke the certificate with the given
+// serial number.
+func (p *Provisioner) RevokeToken(serial string) (string, error) {
+	audience := p.endpoint.ResolveReference(&url.URL{Path: "/1.0/revoke"}).String()
+	return p.token(serial, audience, nil)
+}
 
+func (p *Provisioner) token(subject, audience string, sans []string) (string, error) {
 	// A random jwt id will be used to identify duplicated tokens
 	jwtID, err := randutil.Hex(64) // 256 bits
 	if err != nil {
@@ -99,9 +109,11 @@ func (p *Provisioner) Token(subject string, sans ...string) (string, error) {
 		token.WithJWTID(jwtID),
 		token.WithKid(p.kid),
 		token.WithIssuer(p.name),
-		token.WithAudience(p.audience),
+		token.WithAudience(audience),
 		token.WithValidity(notBefore, notAfter),
-		token.WithSANS(sans),
+	}
+	if len(sans) > 0 {
+		tokOptions = append(tokOptions, token.WithSANS(sans))
 	}
 
 	if p.fingerprint != "" {
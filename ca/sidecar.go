@@ -0,0 +1,262 @@
+package ca
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// sidecarExecTimeout is the maximum duration of the command run after writing
+// the certificate.
+var sidecarExecTimeout = time.Minute
+
+type sidecarOptions struct {
+	certFile    string
+	keyFile     string
+	rootFile    string
+	renewBefore time.Duration
+	pidFile     string
+	signal      os.Signal
+	command     []string
+	hooks       []func(*tls.Certificate)
+}
+
+// SidecarOption is the type of options passed to NewSidecar.
+type SidecarOption func(o *sidecarOptions)
+
+// WithSidecarFiles sets the files where the certificate chain, the private key
+// and the root certificates are written. The files are replaced atomically, so
+// they can be shared with the main process in a volume. Any of the names can
+// be empty to not write that file.
+func WithSidecarFiles(certFile, keyFile, rootFile string) SidecarOption {
+	return func(o *sidecarOptions) {
+		o.certFile, o.keyFile, o.rootFile = certFile, keyFile, rootFile
+	}
+}
+
+// WithSidecarRenewBefore sets how long before the expiration the certificate
+// is renewed, by default after two thirds of its validity.
+func WithSidecarRenewBefore(d time.Duration) SidecarOption {
+	return func(o *sidecarOptions) {
+		o.renewBefore = d
+	}
+}
+
+// WithSidecarSignal sends the given signal to the process whose pid is in
+// pidFile after the certificate is renewed. A missing pid file is ignored, the
+// main process may not be running yet.
+func WithSidecarSignal(pidFile string, sig os.Signal) SidecarOption {
+	return func(o *sidecarOptions) {
+		o.pidFile, o.signal = pidFile, sig
+	}
+}
+
+// WithSidecarExec runs the given command after the certificate is renewed.
+func WithSidecarExec(name string, args ...string) SidecarOption {
+	return func(o *sidecarOptions) {
+		o.command = append([]string{name}, args...)
+	}
+}
+
+// WithSidecarHook calls the given function with the new certificate after it
+// is renewed, it can be used to keep the certificate only in memory.
+func WithSidecarHook(fn func(*tls.Certificate)) SidecarOption {
+	return func(o *sidecarOptions) {
+		o.hooks = append(o.hooks, fn)
+	}
+}
+
+// Sidecar implements the autocert sidecar: it gets a certificate with a
+// bootstrap token, writes it and keeps renewing it, and notifies the main
+// process after each renewal with a signal, a command or a hook.
+//
+// Usage:
+//
+//	// Write the certificate and renew it until the context is canceled.
+//	s, err := ca.NewSidecar(token,
+//	    ca.WithSidecarFiles("/var/run/autocert/site.crt", "/var/run/autocert/site.key", "/var/run/autocert/root.crt"),
+//	    ca.WithSidecarSignal("/var/run/nginx.pid", syscall.SIGHUP))
+//	if err != nil {
+//	    return err
+//	}
+//	return s.Run(ctx)
+type Sidecar struct {
+	cert  *ManagedCertificate
+	opts  *sidecarOptions
+	mutex sync.Mutex
+}
+
+// NewSidecar gets a new certificate with the given bootstrap token and writes
+// it. The certificate is not renewed until Run is called.
+func NewSidecar(token string, options ...SidecarOption) (*Sidecar, error) {
+	opts := new(sidecarOptions)
+	for _, fn := range options {
+		fn(opts)
+	}
+
+	var renewerOptions []tlsRenewerOptions
+	if opts.renewBefore > 0 {
+		renewerOptions = append(renewerOptions, WithRenewBefore(opts.renewBefore))
+	}
+	m, err := NewManagedCertificate(token, renewerOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Sidecar{
+		cert: m,
+		opts: opts,
+	}
+	m.OnRenew(func(cert *tls.Certificate) error {
+		if err := s.write(cert); err != nil {
+			log.Printf("sidecar: %v", err)
+			return err
+		}
+		s.notify(cert)
+		return nil
+	})
+
+	if err := s.write(m.Certificate()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Certificate returns the current certificate.
+func (s *Sidecar) Certificate() *tls.Certificate {
+	return s.cert.Certificate()
+}
+
+// Run renews the certificate until the given context is done.
+func (s *Sidecar) Run(ctx context.Context) error {
+	s.cert.Start(ctx)
+	<-ctx.Done()
+	s.cert.Stop()
+	return ctx.Err()
+}
+
+// write writes the certificate chain, the key and the current roots in the
+// configured files.
+func (s *Sidecar) write(cert *tls.Certificate) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.opts.certFile != "" {
+		var chain []byte
+		for _, der := range cert.Certificate {
+			chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+		}
+		if err := writeFileAtomic(s.opts.certFile, chain, 0644); err != nil {
+			return err
+		}
+	}
+	if s.opts.keyFile != "" {
+		b, err := getPEM(s.cert.pk)
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(s.opts.keyFile, b, 0600); err != nil {
+			return err
+		}
+	}
+	if s.opts.rootFile != "" {
+		var b []byte
+		for _, crt := range s.cert.Roots() {
+			p, err := getPEM(crt)
+			if err != nil {
+				return err
+			}
+			b = append(b, p...)
+		}
+		if err := writeFileAtomic(s.opts.rootFile, b, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notify notifies the main process of a new certificate. The errors are
+// logged, the certificate is already written.
+func (s *Sidecar) notify(cert *tls.Certificate) {
+	for _, fn := range s.opts.hooks {
+		fn(cert)
+	}
+	if s.opts.pidFile != "" {
+		if err := signalPIDFile(s.opts.pidFile, s.opts.signal); err != nil {
+			log.Printf("sidecar: %v", err)
+		}
+	}
+	if len(s.opts.command) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), sidecarExecTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, s.opts.command[0], s.opts.command[1:]...)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		if err := cmd.Run(); err != nil {
+			log.Printf("sidecar: error running %s: %v", s.opts.command[0], err)
+		}
+	}
+}
+
+// signalPIDFile sends the given signal, SIGHUP if nil, to the process whose
+// pid is in the given file.
+func signalPIDFile(pidFile string, sig os.Signal) error {
+	b, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "error reading %s", pidFile)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil || pid <= 0 {
+		return errors.Errorf("error parsing %s: invalid pid", pidFile)
+	}
+	if sig == nil {
+		sig = syscall.SIGHUP
+	}
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return errors.Wrapf(err, "error finding process %d", pid)
+	}
+	if err := p.Signal(sig); err != nil {
+		return errors.Wrapf(err, "error signaling process %d", pid)
+	}
+	return nil
+}
+
+// writeFileAtomic writes the data in a temporary file in the same directory
+// and renames it to the given name, so the readers never see a partial file.
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name))
+	if err != nil {
+		return errors.Wrapf(err, "error writing %s", name)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "error writing %s", name)
+	}
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "error writing %s", name)
+	}
+	if err := f.Close(); err != nil {
+		return errors.Wrapf(err, "error writing %s", name)
+	}
+	if err := os.Rename(f.Name(), name); err != nil {
+		return errors.Wrapf(err, "error writing %s", name)
+	}
+	return nil
+}
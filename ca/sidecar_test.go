@@ -0,0 +1,123 @@
+package ca
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-cli/crypto/pemutil"
+	"github.com/smallstep/assert"
+)
+
+func TestSidecar(t *testing.T) {
+	reset := setMinCertDuration(1 * time.Second)
+	defer reset()
+
+	ca, caURL, err := startCAServer("testdata/rotate-ca-0.json")
+	assert.FatalError(t, err)
+	defer ca.Stop()
+
+	dir, err := ioutil.TempDir("", "sidecar")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "site.crt")
+	keyFile := filepath.Join(dir, "site.key")
+	rootFile := filepath.Join(dir, "root.crt")
+
+	var mutex sync.Mutex
+	var renewed []*tls.Certificate
+	token := generateBootstrapToken(caURL, "127.0.0.1", "ef742f95dc0d8aa82d3cca4017af6dac3fce84290344159891952d18c53eefe7")
+	s, err := NewSidecar(token,
+		WithSidecarFiles(certFile, keyFile, rootFile),
+		WithSidecarSignal(filepath.Join(dir, "missing.pid"), nil),
+		WithSidecarHook(func(cert *tls.Certificate) {
+			mutex.Lock()
+			renewed = append(renewed, cert)
+			mutex.Unlock()
+		}))
+	assert.FatalError(t, err)
+
+	readCertificate := func() *x509.Certificate {
+		b, err := ioutil.ReadFile(certFile)
+		assert.FatalError(t, err)
+		block, rest := pem.Decode(b)
+		assert.NotNil(t, block)
+		intermediate, _ := pem.Decode(rest)
+		assert.NotNil(t, intermediate)
+		crt, err := x509.ParseCertificate(block.Bytes)
+		assert.FatalError(t, err)
+		return crt
+	}
+	crt := readCertificate()
+	assert.Equals(t, s.Certificate().Leaf.Raw, crt.Raw)
+	assert.Equals(t, "127.0.0.1", crt.Subject.CommonName)
+
+	key, err := pemutil.Read(keyFile)
+	assert.FatalError(t, err)
+	assert.Equals(t, s.cert.pk, key)
+	fi, err := os.Stat(keyFile)
+	assert.FatalError(t, err)
+	assert.Equals(t, os.FileMode(0600), fi.Mode().Perm())
+
+	roots, err := pemutil.ReadCertificateBundle(rootFile)
+	assert.FatalError(t, err)
+	assert.Len(t, 1, roots)
+
+	// The certificate is valid for 5s and renewed before it expires.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.Run(ctx)
+	}()
+	time.Sleep(5 * time.Second)
+	cancel()
+	assert.Equals(t, context.Canceled, <-done)
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if assert.True(t, len(renewed) > 0) {
+		last := renewed[len(renewed)-1]
+		assert.Equals(t, last.Leaf.Raw, readCertificate().Raw)
+		assert.NotEquals(t, crt.Raw, last.Leaf.Raw)
+	}
+}
+
+func Test_signalPIDFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sidecar")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	invalid := filepath.Join(dir, "invalid.pid")
+	assert.FatalError(t, ioutil.WriteFile(invalid, []byte("foo\n"), 0600))
+	assert.NoError(t, signalPIDFile(filepath.Join(dir, "missing.pid"), nil))
+	assert.Error(t, signalPIDFile(invalid, nil))
+	assert.Error(t, signalPIDFile(dir, nil))
+}
+
+func Test_writeFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sidecar")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "file")
+	assert.FatalError(t, writeFileAtomic(name, []byte("foo"), 0600))
+	assert.FatalError(t, writeFileAtomic(name, []byte("bar"), 0644))
+	b, err := ioutil.ReadFile(name)
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("bar"), b)
+	fi, err := os.Stat(name)
+	assert.FatalError(t, err)
+	assert.Equals(t, os.FileMode(0644), fi.Mode().Perm())
+
+	files, err := ioutil.ReadDir(dir)
+	assert.FatalError(t, err)
+	assert.Len(t, 1, files)
+	assert.Error(t, writeFileAtomic(filepath.Join(dir, "missing", "file"), []byte("foo"), 0600))
+}
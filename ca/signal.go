@@ -20,6 +20,12 @@ type StopReloader interface {
 	Reload() error
 }
 
+// ProvisionerReloader is the interface that external commands can implement
+// to reload only the provisioners while running.
+type ProvisionerReloader interface {
+	ReloadProvisioners() error
+}
+
 // StopHandler watches SIGINT, SIGTERM on a list of servers implementing the
 // Stopper interface, and when one of those signals is caught we'll run Stop
 // (SIGINT, SIGTERM) on all servers.
@@ -46,9 +52,11 @@ func StopHandler(servers ...Stopper) {
 // StopReloaderHandler watches SIGINT, SIGTERM and SIGHUP on a list of servers
 // implementing the StopReloader interface, and when one of those signals is
 // caught we'll run Stop (SIGINT, SIGTERM) or Reload (SIGHUP) on all servers.
+// On platforms with SIGUSR1, that signal runs ReloadProvisioners on the
+// servers implementing the ProvisionerReloader interface.
 func StopReloaderHandler(servers ...StopReloader) {
 	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	signal.Notify(signals, append([]os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP}, reloadProvisionersSignals...)...)
 	defer signal.Stop(signals)
 
 	for sig := range signals {
@@ -70,6 +78,15 @@ func StopReloaderHandler(servers ...StopReloader) {
 				}
 			}
 			return
+		default:
+			log.Println("reloading provisioners ...")
+			for _, server := range servers {
+				if r, ok := server.(ProvisionerReloader); ok {
+					if err := r.ReloadProvisioners(); err != nil {
+						log.Printf("error reloading provisioners: %+v", err)
+					}
+				}
+			}
 		}
 	}
 }
@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package ca
+
+import (
+	"os"
+	"syscall"
+)
+
+// reloadProvisionersSignals are the signals that reload the provisioners.
+var reloadProvisionersSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,7 @@
+package ca
+
+import "os"
+
+// reloadProvisionersSignals are the signals that reload the provisioners,
+// there are none on Windows.
+var reloadProvisionersSignals []os.Signal
@@ -0,0 +1,216 @@
+package ca
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/RTradeLtd/ca-certificates/api"
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+)
+
+// tenant is an independent authority served by the CA, with its own server
+// certificate.
+type tenant struct {
+	name    string
+	config  *authority.Config
+	auth    *authority.Authority
+	renewer *TLSRenewer
+	handler http.Handler
+}
+
+// newTenant initializes the authority of the given tenant. If the tenant was
+// already running before a reload, prev is the previous tenant, its database,
+// event publisher and audit logger are reused. The API of the tenant is
+// created with the given options.
+func newTenant(tc *authority.TenantConfig, parent *authority.Config, prev *tenant, apiOpts ...api.Option) (*tenant, error) {
+	config, err := tc.Load(parent)
+	if err != nil {
+		return nil, err
+	}
+	if password := parent.Password; password != "" && config.Password == "" {
+		config.Password = password
+	}
+
+	var opts []authority.Option
+	if prev != nil {
+		switch {
+		case !reflect.DeepEqual(prev.config.DB, config.DB):
+			return nil, errors.Errorf("error loading tenant %s: database configuration cannot change", tc.Name)
+		case !reflect.DeepEqual(prev.config.Events, config.Events):
+			return nil, errors.Errorf("error loading tenant %s: events configuration cannot change", tc.Name)
+		case !reflect.DeepEqual(prev.config.Audit, config.Audit):
+			return nil, errors.Errorf("error loading tenant %s: audit configuration cannot change", tc.Name)
+		}
+		opts = append(opts,
+			authority.WithDatabase(prev.auth.GetDatabase()),
+			authority.WithReadDatabase(prev.auth.GetReadDatabase()),
+			authority.WithEventPublisher(prev.auth.GetEventPublisher()),
+			authority.WithAuditLogger(prev.auth.GetAuditLogger()),
+			authority.WithGarbageCollector(prev.auth.GetGarbageCollector()),
+			authority.WithBatchWriter(prev.auth.GetBatchWriter()),
+		)
+	}
+
+	auth, err := authority.New(config, opts...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error initializing tenant %s", tc.Name)
+	}
+	tlsCrt, err := auth.GetTLSCertificate()
+	if err != nil {
+		auth.Shutdown()
+		return nil, errors.Wrapf(err, "error initializing tenant %s", tc.Name)
+	}
+	var renewerOpts []tlsRenewerOptions
+	if d := parent.ServerTLS.GetRenewBefore(); d > 0 {
+		renewerOpts = append(renewerOpts, WithRenewBefore(d))
+	}
+	renewer, err := NewTLSRenewer(tlsCrt, renewTLSCertificate(auth), renewerOpts...)
+	if err != nil {
+		auth.Shutdown()
+		return nil, errors.Wrapf(err, "error initializing tenant %s", tc.Name)
+	}
+	renewer.Run()
+
+	mux := chi.NewRouter()
+	routerHandler := api.New(auth, apiOpts...)
+	routerHandler.Route(mux)
+	mux.Route("/1.0", func(r chi.Router) {
+		routerHandler.Route(r)
+	})
+	mux.Route("/"+api.V1, func(r chi.Router) {
+		routerHandler.Route(r)
+	})
+
+	return &tenant{
+		name:    tc.Name,
+		config:  config,
+		auth:    auth,
+		renewer: renewer,
+		handler: restrictClientCertificates(auth, mux),
+	}, nil
+}
+
+// stop stops the renewer of the server certificate of the tenant. If shutdown
+// is true the authority is also stopped, closing its database, otherwise only
+// its notifier and federation syncer are stopped.
+func (t *tenant) stop(shutdown bool) {
+	t.renewer.Stop()
+	if shutdown {
+		t.auth.Shutdown()
+	} else {
+		t.auth.GetNotifier().Stop()
+		t.auth.GetFederationSyncer().Stop()
+	}
+}
+
+// tenantRouter routes the requests to the tenants by the server name or host
+// of the request, or by the /tenants/<name> prefix of the path. The rest of
+// the requests are sent to the default handler.
+type tenantRouter struct {
+	next   http.Handler
+	byName map[string]*tenant
+	byHost map[string]*tenant
+}
+
+func newTenantRouter(next http.Handler, configs []*authority.TenantConfig, tenants []*tenant) *tenantRouter {
+	rt := &tenantRouter{
+		next:   next,
+		byName: make(map[string]*tenant),
+		byHost: make(map[string]*tenant),
+	}
+	for i, tc := range configs {
+		rt.byName[tc.Name] = tenants[i]
+		for _, h := range tc.Hosts {
+			rt.byHost[strings.ToLower(h)] = tenants[i]
+		}
+	}
+	return rt
+}
+
+// ServeHTTP implements the http.Handler interface.
+func (rt *tenantRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if t, ok := rt.byHost[requestHost(r)]; ok {
+		t.handler.ServeHTTP(w, r)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, authority.TenantPathPrefix) {
+		name := strings.TrimPrefix(r.URL.Path, authority.TenantPathPrefix)
+		if i := strings.IndexByte(name, '/'); i >= 0 {
+			name = name[:i]
+		}
+		t, ok := rt.byName[name]
+		if !ok {
+			api.WriteError(w, api.NotFound(errors.Errorf("tenant %s not found", name)))
+			return
+		}
+		http.StripPrefix(authority.TenantPathPrefix+name, t.handler).ServeHTTP(w, r)
+		return
+	}
+	rt.next.ServeHTTP(w, r)
+}
+
+// getCertificate returns the server certificate of the tenant with the server
+// name of the client hello, or the one of the default renewer.
+func (rt *tenantRouter) getCertificate(next func(*tls.ClientHelloInfo) (*tls.Certificate, error)) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		if t, ok := rt.byHost[strings.ToLower(hello.ServerName)]; ok {
+			return t.renewer.GetCertificateForCA(hello)
+		}
+		return next(hello)
+	}
+}
+
+// requestHost returns the server name of a TLS request, or the host of the
+// request without the port.
+func requestHost(r *http.Request) string {
+	if r.TLS != nil && r.TLS.ServerName != "" {
+		return strings.ToLower(r.TLS.ServerName)
+	}
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+// restrictClientCertificates removes from the requests the client
+// certificates that do not chain to the roots of the given authority. The
+// server accepts the client certificates of all the tenants, so a tenant must
+// not renew, rekey or revoke the certificates of another one.
+func restrictClientCertificates(auth *authority.Authority, next http.Handler) http.Handler {
+	roots := auth.GetRootCertificates()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 && !chainsToRoots(r.TLS.VerifiedChains, roots) {
+			state := *r.TLS
+			state.PeerCertificates = nil
+			state.VerifiedChains = nil
+			r = r.WithContext(r.Context())
+			r.TLS = &state
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// chainsToRoots returns true if one of the given verified chains ends in one
+// of the roots.
+func chainsToRoots(chains [][]*x509.Certificate, roots []*x509.Certificate) bool {
+	for _, chain := range chains {
+		if len(chain) == 0 {
+			continue
+		}
+		last := chain[len(chain)-1]
+		for _, root := range roots {
+			if bytes.Equal(last.Raw, root.Raw) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package ca
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RTradeLtd/ca-certificates/api"
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-cli/crypto/pemutil"
+	"github.com/smallstep/assert"
+)
+
+func TestCA_tenants(t *testing.T) {
+	config, err := authority.LoadConfiguration("testdata/ca.json")
+	assert.FatalError(t, err)
+	config.Tenants = []*authority.TenantConfig{
+		{Name: "rotated", Config: "testdata/federated-ca.json", Hosts: []string{"Rotated.Example.com"}},
+	}
+	ca, err := New(config)
+	assert.FatalError(t, err)
+	defer ca.Stop()
+
+	root, err := pemutil.ReadCertificate("testdata/secrets/root_ca.crt")
+	assert.FatalError(t, err)
+	rotatedRoot, err := pemutil.ReadCertificate("testdata/rotated/root_ca.crt")
+	assert.FatalError(t, err)
+	rotatedIntermediate, err := pemutil.ReadCertificate("testdata/rotated/intermediate_ca.crt")
+	assert.FatalError(t, err)
+
+	getRoots := func(t *testing.T, target, host string) []*x509.Certificate {
+		req := httptest.NewRequest("GET", target, nil)
+		if host != "" {
+			req.Host = host
+		}
+		w := httptest.NewRecorder()
+		ca.srv.Handler.ServeHTTP(w, req)
+		assert.Equals(t, http.StatusCreated, w.Code)
+		var body api.RootsResponse
+		assert.FatalError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		certs := make([]*x509.Certificate, len(body.Certificates))
+		for i, c := range body.Certificates {
+			certs[i] = c.Certificate
+		}
+		return certs
+	}
+
+	// Routed by the path prefix or the host.
+	assert.Equals(t, []*x509.Certificate{root}, getRoots(t, "/roots", ""))
+	assert.Equals(t, []*x509.Certificate{rotatedRoot}, getRoots(t, "/tenants/rotated/roots", ""))
+	assert.Equals(t, []*x509.Certificate{rotatedRoot}, getRoots(t, "/tenants/rotated/1.0/roots", ""))
+	assert.Equals(t, []*x509.Certificate{rotatedRoot}, getRoots(t, "/roots", "rotated.example.com:443"))
+
+	w := httptest.NewRecorder()
+	ca.srv.Handler.ServeHTTP(w, httptest.NewRequest("GET", "/tenants/missing/roots", nil))
+	assert.Equals(t, http.StatusNotFound, w.Code)
+
+	// The tenant has its own server certificate, and its client
+	// certificates are accepted.
+	crt, err := ca.srv.TLSConfig.GetCertificate(&tls.ClientHelloInfo{ServerName: "rotated.example.com"})
+	assert.FatalError(t, err)
+	assert.Equals(t, rotatedIntermediate.Subject, crt.Leaf.Issuer)
+	crt, err = ca.srv.TLSConfig.GetCertificate(&tls.ClientHelloInfo{ServerName: "127.0.0.1"})
+	assert.FatalError(t, err)
+	assert.NotEquals(t, rotatedIntermediate.Subject, crt.Leaf.Issuer)
+	_, err = rotatedIntermediate.Verify(x509.VerifyOptions{Roots: ca.srv.TLSConfig.ClientCAs})
+	assert.FatalError(t, err)
+}
+
+func Test_restrictClientCertificates(t *testing.T) {
+	config, err := authority.LoadConfiguration("testdata/ca.json")
+	assert.FatalError(t, err)
+	auth, err := authority.New(config)
+	assert.FatalError(t, err)
+	defer auth.Shutdown()
+
+	root, err := pemutil.ReadCertificate("testdata/secrets/root_ca.crt")
+	assert.FatalError(t, err)
+	intermediate, err := pemutil.ReadCertificate("testdata/secrets/intermediate_ca.crt")
+	assert.FatalError(t, err)
+	rotatedRoot, err := pemutil.ReadCertificate("testdata/rotated/root_ca.crt")
+	assert.FatalError(t, err)
+	rotatedIntermediate, err := pemutil.ReadCertificate("testdata/rotated/intermediate_ca.crt")
+	assert.FatalError(t, err)
+
+	var got *http.Request
+	h := restrictClientCertificates(auth, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	}))
+	tests := []struct {
+		name  string
+		state *tls.ConnectionState
+		want  bool
+	}{
+		{"no-tls", nil, false},
+		{"no-certificates", &tls.ConnectionState{}, false},
+		{"own-root", &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{intermediate},
+			VerifiedChains:   [][]*x509.Certificate{{intermediate, root}},
+		}, true},
+		{"other-root", &tls.ConnectionState{
+			PeerCertificates: []*x509.Certificate{rotatedIntermediate},
+			VerifiedChains:   [][]*x509.Certificate{{rotatedIntermediate, rotatedRoot}},
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/renew", nil)
+			req.TLS = tt.state
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			hasCertificates := got.TLS != nil && len(got.TLS.PeerCertificates) > 0
+			assert.Equals(t, tt.want, hasCertificates)
+			if tt.state != nil {
+				// The original state is not modified.
+				assert.Equals(t, tt.name == "own-root" || tt.name == "other-root", len(tt.state.PeerCertificates) > 0)
+			}
+		})
+	}
+}
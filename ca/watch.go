@@ -0,0 +1,45 @@
+package ca
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+
+	"github.com/RTradeLtd/ca-certificates/configsource"
+	"github.com/pkg/errors"
+)
+
+// watchConfig reloads the CA when the value of one of the Consul or Vault
+// references in the configuration file changes, until the context is done.
+// The references are read again after each reload, so the references added
+// or removed on a reload are taken into account.
+func (ca *CA) watchConfig(ctx context.Context) {
+	for {
+		b, err := ioutil.ReadFile(ca.opts.configFile)
+		if err != nil {
+			log.Println(errors.Wrap(err, "error watching the configuration"))
+			return
+		}
+		var refs []configsource.Reference
+		for _, ref := range configsource.References(b) {
+			if ref.IsRemote() {
+				refs = append(refs, ref)
+			}
+		}
+		if len(refs) == 0 {
+			return
+		}
+		resolver, err := configsource.NewResolver()
+		if err != nil {
+			log.Println(errors.Wrap(err, "error watching the configuration"))
+			return
+		}
+		if err := resolver.Watch(ctx, refs); err != nil {
+			return
+		}
+		log.Println("reloading ...")
+		if err := ca.Reload(); err != nil {
+			log.Printf("error reloading server: %+v", err)
+		}
+	}
+}
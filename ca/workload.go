@@ -0,0 +1,59 @@
+package ca
+
+import (
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/workload"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+// workloadSocketMode is the permissions of the socket of the Workload API, all
+// the users can connect to it as the workloads are attested.
+const workloadSocketMode = 0666
+
+// grpcStopTimeout is the time given to the gRPC servers to finish the requests
+// in progress on Stop, the streams of the SDS and Workload API services do not
+// end unless they are closed.
+const grpcStopTimeout = 5 * time.Second
+
+// newWorkloadAPI creates the Workload API server for the given configuration.
+func newWorkloadAPI(auth *authority.Authority, c *authority.WorkloadAPIConfig) (*workload.Server, error) {
+	opts := workload.Options{
+		TrustDomain:  c.TrustDomain,
+		Provisioner:  c.Provisioner,
+		CertDuration: c.GetCertDuration(),
+	}
+	for _, name := range c.GetAttestors() {
+		a, err := workload.GetAttestor(name)
+		if err != nil {
+			return nil, errors.Wrap(err, "error creating workload api")
+		}
+		opts.Attestors = append(opts.Attestors, a)
+	}
+	for _, e := range c.Entries {
+		opts.Entries = append(opts.Entries, workload.Entry{
+			SPIFFEID:  e.SPIFFEID,
+			Selectors: e.Selectors,
+		})
+	}
+	return workload.New(auth, opts), nil
+}
+
+// stopGRPC stops the given gRPC server gracefully, and closes the connections
+// still open after grpcStopTimeout.
+func stopGRPC(srv *grpc.Server) {
+	done := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+	t := time.NewTimer(grpcStopTimeout)
+	defer t.Stop()
+	select {
+	case <-done:
+	case <-t.C:
+		srv.Stop()
+	}
+}
@@ -0,0 +1,104 @@
+package catest
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/crypto/pemutil"
+	"github.com/RTradeLtd/ca-cli/jose"
+)
+
+const (
+	// DNSName is the name of the CA created by NewAuthority.
+	DNSName = "ca.example.com"
+	// ProvisionerName is the name of the JWK provisioner of the authority
+	// created by NewAuthority.
+	ProvisionerName = "test@example.com"
+	// SignAudience is the audience of the tokens used to sign certificates
+	// with the authority created by NewAuthority.
+	SignAudience = "https://" + DNSName + "/1.0/sign"
+)
+
+// Authority is an authority initialized for a test with a new PKI and a JWK
+// provisioner.
+type Authority struct {
+	*authority.Authority
+	Config         *authority.Config
+	PKI            *PKI
+	Provisioner    *provisioner.JWK
+	ProvisionerKey *jose.JSONWebKey
+}
+
+// NewAuthority returns a new authority for the DNSName with a new PKI and the
+// JWK provisioner ProvisionerName, without a database. The given functions can
+// modify the configuration before the authority is created, e.g. to add other
+// provisioners. The files of the PKI are removed once the authority is
+// initialized. The authority must be stopped with Shutdown.
+func NewAuthority(t testing.TB, fns ...func(c *authority.Config)) *Authority {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "catest")
+	if err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	pki := NewPKI(t)
+	password := []byte("password")
+	root := filepath.Join(dir, "root_ca.crt")
+	intermediate := filepath.Join(dir, "intermediate_ca.crt")
+	intermediateKey := filepath.Join(dir, "intermediate_ca_key")
+	if err := ioutil.WriteFile(root, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: pki.Root.Raw,
+	}), 0600); err != nil {
+		t.Fatalf("error writing root: %v", err)
+	}
+	if err := ioutil.WriteFile(intermediate, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: pki.Intermediate.Raw,
+	}), 0600); err != nil {
+		t.Fatalf("error writing intermediate: %v", err)
+	}
+	if _, err := pemutil.Serialize(pki.IntermediateKey, pemutil.WithPassword(password), pemutil.ToFile(intermediateKey, 0600)); err != nil {
+		t.Fatalf("error writing intermediate key: %v", err)
+	}
+
+	p, key := NewJWKProvisioner(t, ProvisionerName)
+	config := &authority.Config{
+		Address:          "127.0.0.1:443",
+		Root:             []string{root},
+		IntermediateCert: intermediate,
+		IntermediateKey:  intermediateKey,
+		DNSNames:         []string{DNSName},
+		Password:         string(password),
+		AuthorityConfig: &authority.AuthConfig{
+			Provisioners: provisioner.List{p},
+		},
+	}
+	for _, fn := range fns {
+		fn(config)
+	}
+	a, err := authority.New(config)
+	if err != nil {
+		t.Fatalf("error creating authority: %v", err)
+	}
+	return &Authority{
+		Authority:      a,
+		Config:         config,
+		PKI:            pki,
+		Provisioner:    p,
+		ProvisionerKey: key,
+	}
+}
+
+// SignToken returns a one-time token of the JWK provisioner of the authority
+// to sign a certificate with the given subject and SANs.
+func (a *Authority) SignToken(t testing.TB, subject string, sans ...string) string {
+	t.Helper()
+	return GenerateToken(t, a.ProvisionerKey, ProvisionerName, SignAudience, subject, sans...)
+}
@@ -0,0 +1,41 @@
+package catest
+
+import (
+	"context"
+	"crypto/x509"
+	"testing"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/smallstep/assert"
+)
+
+func TestNewAuthority(t *testing.T) {
+	a := NewAuthority(t)
+	defer a.Shutdown()
+
+	csr, key := NewCertificateRequest(t, "test.example.com", "test.example.com")
+	ctx := provisioner.NewContextWithMethod(context.Background(), provisioner.SignMethod)
+	signOpts, err := a.Authorize(ctx, a.SignToken(t, "test.example.com"))
+	assert.FatalError(t, err)
+	certChain, err := a.Sign(context.Background(), csr, provisioner.Options{}, signOpts...)
+	assert.FatalError(t, err)
+	assert.Equals(t, key.Public(), certChain[0].PublicKey)
+	assert.Equals(t, []string{"test.example.com"}, certChain[0].DNSNames)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(a.PKI.Root)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(a.PKI.Intermediate)
+	_, err = certChain[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		DNSName:       "test.example.com",
+	})
+	assert.FatalError(t, err)
+
+	// Tokens of other names are rejected by the provisioner.
+	signOpts, err = a.Authorize(ctx, a.SignToken(t, "other.example.com"))
+	assert.FatalError(t, err)
+	_, err = a.Sign(context.Background(), csr, provisioner.Options{}, signOpts...)
+	assert.Error(t, err)
+}
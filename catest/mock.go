@@ -0,0 +1,609 @@
+package catest
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/api"
+	"github.com/RTradeLtd/ca-certificates/audit"
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/RTradeLtd/ca-certificates/events"
+	"github.com/RTradeLtd/ca-cli/crypto/tlsutil"
+	"github.com/RTradeLtd/ca-cli/jose"
+	"golang.org/x/crypto/ssh"
+)
+
+var _ api.Authority = (*MockAuthority)(nil)
+
+// MockAuthority is a mock implementation of api.Authority. The methods call
+// the function field with the same name, e.g. MauthorizeSign, if it is set,
+// and return Mret1, Mret2 and Merr otherwise.
+type MockAuthority struct {
+	Mret1, Mret2                  interface{}
+	Merr                          error
+	MauthorizeSign                func(ott string) ([]provisioner.SignOption, error)
+	MgetTLSOptions                func() *tlsutil.TLSOptions
+	Mroot                         func(shasum string) (*x509.Certificate, error)
+	Msign                         func(cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
+	MsignSSH                      func(key ssh.PublicKey, opts provisioner.SSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error)
+	MsignSSHAddUser               func(key ssh.PublicKey, cert *ssh.Certificate) (*ssh.Certificate, error)
+	Mrenew                        func(cert *x509.Certificate) ([]*x509.Certificate, error)
+	Mrekey                        func(cert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error)
+	MauthorizeRenewToken          func(ott string) (*x509.Certificate, error)
+	MrenewAfter                   func(crt *x509.Certificate) time.Time
+	MloadProvisionerByCertificate func(cert *x509.Certificate) (provisioner.Interface, error)
+	MloadProvisionerByID          func(provID string) (provisioner.Interface, error)
+	MloadProvisionerByToken       func(ott string) (provisioner.Interface, error)
+	MgetProvisioners              func(nextCursor string, limit int) (provisioner.List, string, error)
+	MgetProvisionersByType        func(typ provisioner.Type, nextCursor string, limit int) (provisioner.List, string, error)
+	Mrevoke                       func(*authority.RevokeOptions) error
+	MgetEncryptedKey              func(kid string) (string, error)
+	MgetRoots                     func() ([]*x509.Certificate, error)
+	MgetFederation                func() ([]*x509.Certificate, error)
+	MgetIntermediates             func() ([]*x509.Certificate, error)
+	MgetIssuingRoot               func(intermediate *x509.Certificate) (*x509.Certificate, error)
+	MauthorizeAdmin               func(ott string) (string, error)
+	MauthorizeAdminCertificate    func(crt *x509.Certificate) (string, error)
+	MauthorizeAdminSSO            func(token string) (string, authority.AdminRole, error)
+	MintrospectToken              func(ott string) (*authority.TokenIntrospection, error)
+	MmintToken                    func(opts authority.MintOptions) (string, error)
+	MgetSanitizedConfig           func() (map[string]interface{}, error)
+	MimportCA                     func(opts authority.ImportCAOptions) error
+	MisApprovalRequired           func(signOpts []provisioner.SignOption) bool
+	MgenerateKey                  func(signOpts []provisioner.SignOption, kty, crv string, size int) (crypto.Signer, error)
+	McreatePendingRequest         func(cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) (*authority.PendingRequest, error)
+	MgetPendingRequest            func(id string) (*authority.PendingRequest, error)
+	MgetPendingRequests           func(status authority.PendingStatus) ([]*authority.PendingRequest, error)
+	MapprovePendingRequest        func(id, reviewer string) (*authority.PendingRequest, error)
+	MdenyPendingRequest           func(id, reviewer, reason string) (*authority.PendingRequest, error)
+	MgetCertificates              func(filter authority.CertificateFilter, cursor string, limit int) ([]*authority.CertificateInfo, string, error)
+	MgetCertificate               func(serial string) (*authority.CertificateInfo, error)
+	MgetExpiringCertificates      func(filter authority.CertificateFilter, within time.Duration) ([]*authority.CertificateInfo, error)
+	MgetStats                     func(from, to time.Time) ([]*authority.ProvisionerStats, error)
+	MsubscribeEvents              func(lastID string) (<-chan *events.Event, func())
+	MgetCacheControl              func() string
+	MgetRateLimitConfig           func() *authority.RateLimitConfig
+	MgetCORSConfig                func() *authority.CORSConfig
+	MgetBodyLimits                func() *authority.BodyLimitConfig
+	MgetTimeouts                  func() *authority.TimeoutConfig
+	MgetRetentionStats            func() []*db.PrunerStats
+	Mbackup                       func() (*authority.Backup, error)
+	Mrestore                      func(b *authority.Backup) error
+	McheckHealth                  func(ctx context.Context) *authority.Health
+	MgetJournal                   func(from, to time.Time) ([]*db.JournalEntry, error)
+	MgetSignedTreeHead            func() (*authority.SignedTreeHead, error)
+	MgetLogEntries                func(start, end int64) ([]*db.LogEntry, error)
+	MgetInclusionProof            func(serial string, treeSize int64) (*authority.InclusionProof, error)
+	MgetDiscovery                 func() *authority.Discovery
+	MsignJWTSVID                  func(ctx context.Context, spiffeID string, audience []string, signOpts ...provisioner.SignOption) (string, time.Time, error)
+	MgetJWTSVIDKeys               func() jose.JSONWebKeySet
+	MnewNonce                     func() (string, time.Time, error)
+	MgetCRL                       func() (*db.CRLInfo, error)
+	MregisterInventoryEntry       func(name string, opts authority.InventoryOptions) (*db.InventoryEntry, error)
+	MgetInventoryEntry            func(name string) (*db.InventoryEntry, error)
+	MgetInventoryEntries          func(filter authority.InventoryFilter, cursor string, limit int) ([]*db.InventoryEntry, string, error)
+	MdeleteInventoryEntry         func(name string) error
+	MlinkInventoryCertificate     func(name, serial string) (*db.InventoryEntry, error)
+	MgetAuditEntries              func(filter audit.Filter, cursor string, limit int) ([]*audit.Entry, string, error)
+}
+
+// Authorize mock
+func (m *MockAuthority) Authorize(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+	return m.AuthorizeSign(ott)
+}
+
+// AuthorizeSign mock
+func (m *MockAuthority) AuthorizeSign(ott string) ([]provisioner.SignOption, error) {
+	if m.MauthorizeSign != nil {
+		return m.MauthorizeSign(ott)
+	}
+	return m.Mret1.([]provisioner.SignOption), m.Merr
+}
+
+// GetTLSOptions mock
+func (m *MockAuthority) GetTLSOptions() *tlsutil.TLSOptions {
+	if m.MgetTLSOptions != nil {
+		return m.MgetTLSOptions()
+	}
+	return m.Mret1.(*tlsutil.TLSOptions)
+}
+
+// Root mock
+func (m *MockAuthority) Root(shasum string) (*x509.Certificate, error) {
+	if m.Mroot != nil {
+		return m.Mroot(shasum)
+	}
+	return m.Mret1.(*x509.Certificate), m.Merr
+}
+
+// Sign mock
+func (m *MockAuthority) Sign(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+	if m.Msign != nil {
+		return m.Msign(cr, opts, signOpts...)
+	}
+	return []*x509.Certificate{m.Mret1.(*x509.Certificate), m.Mret2.(*x509.Certificate)}, m.Merr
+}
+
+// SignSSH mock
+func (m *MockAuthority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisioner.SSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
+	if m.MsignSSH != nil {
+		return m.MsignSSH(key, opts, signOpts...)
+	}
+	return m.Mret1.(*ssh.Certificate), m.Merr
+}
+
+// SignSSHAddUser mock
+func (m *MockAuthority) SignSSHAddUser(ctx context.Context, key ssh.PublicKey, cert *ssh.Certificate) (*ssh.Certificate, error) {
+	if m.MsignSSHAddUser != nil {
+		return m.MsignSSHAddUser(key, cert)
+	}
+	return m.Mret1.(*ssh.Certificate), m.Merr
+}
+
+// Renew mock
+func (m *MockAuthority) Renew(ctx context.Context, cert *x509.Certificate) ([]*x509.Certificate, error) {
+	if m.Mrenew != nil {
+		return m.Mrenew(cert)
+	}
+	return []*x509.Certificate{m.Mret1.(*x509.Certificate), m.Mret2.(*x509.Certificate)}, m.Merr
+}
+
+// Rekey mock
+func (m *MockAuthority) Rekey(ctx context.Context, cert *x509.Certificate, pk crypto.PublicKey) ([]*x509.Certificate, error) {
+	if m.Mrekey != nil {
+		return m.Mrekey(cert, pk)
+	}
+	return []*x509.Certificate{m.Mret1.(*x509.Certificate), m.Mret2.(*x509.Certificate)}, m.Merr
+}
+
+// AuthorizeRenewToken mock
+func (m *MockAuthority) AuthorizeRenewToken(ctx context.Context, ott string) (*x509.Certificate, error) {
+	if m.MauthorizeRenewToken != nil {
+		return m.MauthorizeRenewToken(ott)
+	}
+	return m.Mret1.(*x509.Certificate), m.Merr
+}
+
+// RenewAfter mock
+func (m *MockAuthority) RenewAfter(crt *x509.Certificate) time.Time {
+	if m.MrenewAfter != nil {
+		return m.MrenewAfter(crt)
+	}
+	return time.Time{}
+}
+
+// GetProvisioners mock
+func (m *MockAuthority) GetProvisioners(nextCursor string, limit int) (provisioner.List, string, error) {
+	if m.MgetProvisioners != nil {
+		return m.MgetProvisioners(nextCursor, limit)
+	}
+	return m.Mret1.(provisioner.List), m.Mret2.(string), m.Merr
+}
+
+// GetProvisionersByType mock
+func (m *MockAuthority) GetProvisionersByType(typ provisioner.Type, nextCursor string, limit int) (provisioner.List, string, error) {
+	if m.MgetProvisionersByType != nil {
+		return m.MgetProvisionersByType(typ, nextCursor, limit)
+	}
+	return m.Mret1.(provisioner.List), m.Mret2.(string), m.Merr
+}
+
+// LoadProvisionerByCertificate mock
+func (m *MockAuthority) LoadProvisionerByCertificate(cert *x509.Certificate) (provisioner.Interface, error) {
+	if m.MloadProvisionerByCertificate != nil {
+		return m.MloadProvisionerByCertificate(cert)
+	}
+	return m.Mret1.(provisioner.Interface), m.Merr
+}
+
+// LoadProvisionerByToken mock
+func (m *MockAuthority) LoadProvisionerByToken(ott string) (provisioner.Interface, error) {
+	if m.MloadProvisionerByToken != nil {
+		return m.MloadProvisionerByToken(ott)
+	}
+	return m.Mret1.(provisioner.Interface), m.Merr
+}
+
+// LoadProvisionerByID mock
+func (m *MockAuthority) LoadProvisionerByID(provID string) (provisioner.Interface, error) {
+	if m.MloadProvisionerByID != nil {
+		return m.MloadProvisionerByID(provID)
+	}
+	return m.Mret1.(provisioner.Interface), m.Merr
+}
+
+// Revoke mock
+func (m *MockAuthority) Revoke(ctx context.Context, opts *authority.RevokeOptions) error {
+	if m.Mrevoke != nil {
+		return m.Mrevoke(opts)
+	}
+	return m.Merr
+}
+
+// GetEncryptedKey mock
+func (m *MockAuthority) GetEncryptedKey(kid string) (string, error) {
+	if m.MgetEncryptedKey != nil {
+		return m.MgetEncryptedKey(kid)
+	}
+	return m.Mret1.(string), m.Merr
+}
+
+// GetRoots mock
+func (m *MockAuthority) GetRoots() ([]*x509.Certificate, error) {
+	if m.MgetRoots != nil {
+		return m.MgetRoots()
+	}
+	return m.Mret1.([]*x509.Certificate), m.Merr
+}
+
+// GetFederation mock
+func (m *MockAuthority) GetFederation() ([]*x509.Certificate, error) {
+	if m.MgetFederation != nil {
+		return m.MgetFederation()
+	}
+	return m.Mret1.([]*x509.Certificate), m.Merr
+}
+
+// GetIntermediates mock
+func (m *MockAuthority) GetIntermediates() ([]*x509.Certificate, error) {
+	if m.MgetIntermediates != nil {
+		return m.MgetIntermediates()
+	}
+	return m.Mret1.([]*x509.Certificate), m.Merr
+}
+
+// GetIssuingRoot mock
+func (m *MockAuthority) GetIssuingRoot(intermediate *x509.Certificate) (*x509.Certificate, error) {
+	if m.MgetIssuingRoot != nil {
+		return m.MgetIssuingRoot(intermediate)
+	}
+	return m.Mret1.(*x509.Certificate), m.Merr
+}
+
+// AuthorizeAdmin mock
+func (m *MockAuthority) AuthorizeAdmin(ott string) (string, error) {
+	if m.MauthorizeAdmin != nil {
+		return m.MauthorizeAdmin(ott)
+	}
+	return m.Mret1.(string), m.Merr
+}
+
+// AuthorizeAdminCertificate mock
+func (m *MockAuthority) AuthorizeAdminCertificate(crt *x509.Certificate) (string, error) {
+	if m.MauthorizeAdminCertificate != nil {
+		return m.MauthorizeAdminCertificate(crt)
+	}
+	return m.Mret1.(string), m.Merr
+}
+
+// AuthorizeAdminSSO mock, by default the tokens are not single sign-on tokens
+func (m *MockAuthority) AuthorizeAdminSSO(token string) (string, authority.AdminRole, error) {
+	if m.MauthorizeAdminSSO != nil {
+		return m.MauthorizeAdminSSO(token)
+	}
+	return "", "", authority.ErrNotAdminSSOToken
+}
+
+// IntrospectToken mock
+func (m *MockAuthority) IntrospectToken(ott string) (*authority.TokenIntrospection, error) {
+	if m.MintrospectToken != nil {
+		return m.MintrospectToken(ott)
+	}
+	return m.Mret1.(*authority.TokenIntrospection), m.Merr
+}
+
+// MintToken mock
+func (m *MockAuthority) MintToken(opts authority.MintOptions) (string, error) {
+	if m.MmintToken != nil {
+		return m.MmintToken(opts)
+	}
+	return m.Mret1.(string), m.Merr
+}
+
+// GetSanitizedConfig mock
+func (m *MockAuthority) GetSanitizedConfig() (map[string]interface{}, error) {
+	if m.MgetSanitizedConfig != nil {
+		return m.MgetSanitizedConfig()
+	}
+	return m.Mret1.(map[string]interface{}), m.Merr
+}
+
+// ImportCA mock
+func (m *MockAuthority) ImportCA(opts authority.ImportCAOptions) error {
+	if m.MimportCA != nil {
+		return m.MimportCA(opts)
+	}
+	return m.Merr
+}
+
+// IsApprovalRequired mock
+func (m *MockAuthority) IsApprovalRequired(signOpts []provisioner.SignOption) bool {
+	if m.MisApprovalRequired != nil {
+		return m.MisApprovalRequired(signOpts)
+	}
+	return false
+}
+
+// GenerateKey mock
+func (m *MockAuthority) GenerateKey(signOpts []provisioner.SignOption, kty, crv string, size int) (crypto.Signer, error) {
+	if m.MgenerateKey != nil {
+		return m.MgenerateKey(signOpts, kty, crv, size)
+	}
+	return m.Mret1.(crypto.Signer), m.Merr
+}
+
+// CreatePendingRequest mock
+func (m *MockAuthority) CreatePendingRequest(cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) (*authority.PendingRequest, error) {
+	if m.McreatePendingRequest != nil {
+		return m.McreatePendingRequest(cr, opts, signOpts...)
+	}
+	return m.Mret1.(*authority.PendingRequest), m.Merr
+}
+
+// GetPendingRequest mock
+func (m *MockAuthority) GetPendingRequest(id string) (*authority.PendingRequest, error) {
+	if m.MgetPendingRequest != nil {
+		return m.MgetPendingRequest(id)
+	}
+	return m.Mret1.(*authority.PendingRequest), m.Merr
+}
+
+// GetPendingRequests mock
+func (m *MockAuthority) GetPendingRequests(status authority.PendingStatus) ([]*authority.PendingRequest, error) {
+	if m.MgetPendingRequests != nil {
+		return m.MgetPendingRequests(status)
+	}
+	return m.Mret1.([]*authority.PendingRequest), m.Merr
+}
+
+// ApprovePendingRequest mock
+func (m *MockAuthority) ApprovePendingRequest(ctx context.Context, id, reviewer string) (*authority.PendingRequest, error) {
+	if m.MapprovePendingRequest != nil {
+		return m.MapprovePendingRequest(id, reviewer)
+	}
+	return m.Mret1.(*authority.PendingRequest), m.Merr
+}
+
+// DenyPendingRequest mock
+func (m *MockAuthority) DenyPendingRequest(id, reviewer, reason string) (*authority.PendingRequest, error) {
+	if m.MdenyPendingRequest != nil {
+		return m.MdenyPendingRequest(id, reviewer, reason)
+	}
+	return m.Mret1.(*authority.PendingRequest), m.Merr
+}
+
+// GetCertificates mock
+func (m *MockAuthority) GetCertificates(filter authority.CertificateFilter, cursor string, limit int) ([]*authority.CertificateInfo, string, error) {
+	if m.MgetCertificates != nil {
+		return m.MgetCertificates(filter, cursor, limit)
+	}
+	return m.Mret1.([]*authority.CertificateInfo), "", m.Merr
+}
+
+// GetCertificate mock
+func (m *MockAuthority) GetCertificate(serial string) (*authority.CertificateInfo, error) {
+	if m.MgetCertificate != nil {
+		return m.MgetCertificate(serial)
+	}
+	return m.Mret1.(*authority.CertificateInfo), m.Merr
+}
+
+// GetExpiringCertificates mock
+func (m *MockAuthority) GetExpiringCertificates(filter authority.CertificateFilter, within time.Duration) ([]*authority.CertificateInfo, error) {
+	if m.MgetExpiringCertificates != nil {
+		return m.MgetExpiringCertificates(filter, within)
+	}
+	return m.Mret1.([]*authority.CertificateInfo), m.Merr
+}
+
+// GetStats mock
+func (m *MockAuthority) GetStats(from, to time.Time) ([]*authority.ProvisionerStats, error) {
+	if m.MgetStats != nil {
+		return m.MgetStats(from, to)
+	}
+	return m.Mret1.([]*authority.ProvisionerStats), m.Merr
+}
+
+// GetCacheControl mock
+func (m *MockAuthority) GetCacheControl() string {
+	if m.MgetCacheControl != nil {
+		return m.MgetCacheControl()
+	}
+	return ""
+}
+
+// GetRateLimitConfig mock
+func (m *MockAuthority) GetRateLimitConfig() *authority.RateLimitConfig {
+	if m.MgetRateLimitConfig != nil {
+		return m.MgetRateLimitConfig()
+	}
+	return nil
+}
+
+// GetDiscovery mock
+func (m *MockAuthority) GetDiscovery() *authority.Discovery {
+	if m.MgetDiscovery != nil {
+		return m.MgetDiscovery()
+	}
+	return &authority.Discovery{}
+}
+
+// SignJWTSVID mock
+func (m *MockAuthority) SignJWTSVID(ctx context.Context, spiffeID string, audience []string, signOpts ...provisioner.SignOption) (string, time.Time, error) {
+	if m.MsignJWTSVID != nil {
+		return m.MsignJWTSVID(ctx, spiffeID, audience, signOpts...)
+	}
+	return m.Mret1.(string), time.Time{}, m.Merr
+}
+
+// GetCRL mock
+func (m *MockAuthority) GetCRL() (*db.CRLInfo, error) {
+	if m.MgetCRL != nil {
+		return m.MgetCRL()
+	}
+	return m.Mret1.(*db.CRLInfo), m.Merr
+}
+
+// RegisterInventoryEntry mock
+func (m *MockAuthority) RegisterInventoryEntry(name string, opts authority.InventoryOptions) (*db.InventoryEntry, error) {
+	if m.MregisterInventoryEntry != nil {
+		return m.MregisterInventoryEntry(name, opts)
+	}
+	return m.Mret1.(*db.InventoryEntry), m.Merr
+}
+
+// GetInventoryEntry mock
+func (m *MockAuthority) GetInventoryEntry(name string) (*db.InventoryEntry, error) {
+	if m.MgetInventoryEntry != nil {
+		return m.MgetInventoryEntry(name)
+	}
+	return m.Mret1.(*db.InventoryEntry), m.Merr
+}
+
+// GetInventoryEntries mock
+func (m *MockAuthority) GetInventoryEntries(filter authority.InventoryFilter, cursor string, limit int) ([]*db.InventoryEntry, string, error) {
+	if m.MgetInventoryEntries != nil {
+		return m.MgetInventoryEntries(filter, cursor, limit)
+	}
+	return m.Mret1.([]*db.InventoryEntry), m.Mret2.(string), m.Merr
+}
+
+// DeleteInventoryEntry mock
+func (m *MockAuthority) DeleteInventoryEntry(name string) error {
+	if m.MdeleteInventoryEntry != nil {
+		return m.MdeleteInventoryEntry(name)
+	}
+	return m.Merr
+}
+
+// LinkInventoryCertificate mock
+func (m *MockAuthority) LinkInventoryCertificate(name, serial string) (*db.InventoryEntry, error) {
+	if m.MlinkInventoryCertificate != nil {
+		return m.MlinkInventoryCertificate(name, serial)
+	}
+	return m.Mret1.(*db.InventoryEntry), m.Merr
+}
+
+// GetAuditEntries mock
+func (m *MockAuthority) GetAuditEntries(filter audit.Filter, cursor string, limit int) ([]*audit.Entry, string, error) {
+	if m.MgetAuditEntries != nil {
+		return m.MgetAuditEntries(filter, cursor, limit)
+	}
+	return m.Mret1.([]*audit.Entry), m.Mret2.(string), m.Merr
+}
+
+// GetJWTSVIDKeys mock
+func (m *MockAuthority) GetJWTSVIDKeys() jose.JSONWebKeySet {
+	if m.MgetJWTSVIDKeys != nil {
+		return m.MgetJWTSVIDKeys()
+	}
+	return jose.JSONWebKeySet{Keys: []jose.JSONWebKey{}}
+}
+
+// NewNonce mock
+func (m *MockAuthority) NewNonce() (string, time.Time, error) {
+	if m.MnewNonce != nil {
+		return m.MnewNonce()
+	}
+	return m.Mret1.(string), time.Time{}, m.Merr
+}
+
+// GetCORSConfig mock
+func (m *MockAuthority) GetCORSConfig() *authority.CORSConfig {
+	if m.MgetCORSConfig != nil {
+		return m.MgetCORSConfig()
+	}
+	return nil
+}
+
+// GetBodyLimits mock
+func (m *MockAuthority) GetBodyLimits() *authority.BodyLimitConfig {
+	if m.MgetBodyLimits != nil {
+		return m.MgetBodyLimits()
+	}
+	return nil
+}
+
+// GetTimeouts mock
+func (m *MockAuthority) GetTimeouts() *authority.TimeoutConfig {
+	if m.MgetTimeouts != nil {
+		return m.MgetTimeouts()
+	}
+	return nil
+}
+
+// GetRetentionStats mock
+func (m *MockAuthority) GetRetentionStats() []*db.PrunerStats {
+	if m.MgetRetentionStats != nil {
+		return m.MgetRetentionStats()
+	}
+	return []*db.PrunerStats{}
+}
+
+// Backup mock
+func (m *MockAuthority) Backup() (*authority.Backup, error) {
+	if m.Mbackup != nil {
+		return m.Mbackup()
+	}
+	return m.Mret1.(*authority.Backup), m.Merr
+}
+
+// Restore mock
+func (m *MockAuthority) Restore(b *authority.Backup) error {
+	if m.Mrestore != nil {
+		return m.Mrestore(b)
+	}
+	return m.Merr
+}
+
+// CheckHealth mock
+func (m *MockAuthority) CheckHealth(ctx context.Context) *authority.Health {
+	if m.McheckHealth != nil {
+		return m.McheckHealth(ctx)
+	}
+	return nil
+}
+
+// GetJournal mock
+func (m *MockAuthority) GetJournal(from, to time.Time) ([]*db.JournalEntry, error) {
+	if m.MgetJournal != nil {
+		return m.MgetJournal(from, to)
+	}
+	return m.Mret1.([]*db.JournalEntry), m.Merr
+}
+
+// GetSignedTreeHead mock
+func (m *MockAuthority) GetSignedTreeHead() (*authority.SignedTreeHead, error) {
+	if m.MgetSignedTreeHead != nil {
+		return m.MgetSignedTreeHead()
+	}
+	return m.Mret1.(*authority.SignedTreeHead), m.Merr
+}
+
+// GetLogEntries mock
+func (m *MockAuthority) GetLogEntries(start, end int64) ([]*db.LogEntry, error) {
+	if m.MgetLogEntries != nil {
+		return m.MgetLogEntries(start, end)
+	}
+	return m.Mret1.([]*db.LogEntry), m.Merr
+}
+
+// GetInclusionProof mock
+func (m *MockAuthority) GetInclusionProof(serial string, treeSize int64) (*authority.InclusionProof, error) {
+	if m.MgetInclusionProof != nil {
+		return m.MgetInclusionProof(serial, treeSize)
+	}
+	return m.Mret1.(*authority.InclusionProof), m.Merr
+}
+
+// SubscribeEvents mock
+func (m *MockAuthority) SubscribeEvents(lastID string) (<-chan *events.Event, func()) {
+	if m.MsubscribeEvents != nil {
+		return m.MsubscribeEvents(lastID)
+	}
+	return m.Mret1.(<-chan *events.Event), func() {}
+}
@@ -0,0 +1,26 @@
+package catest
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/RTradeLtd/ca-certificates/api"
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/go-chi/chi"
+	"github.com/smallstep/assert"
+)
+
+func TestMockAuthority(t *testing.T) {
+	mux := chi.NewRouter()
+	api.New(&MockAuthority{
+		McheckHealth: func(ctx context.Context) *authority.Health {
+			return &authority.Health{Status: authority.HealthOK}
+		},
+	}).Route(mux)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "http://example.com/health", nil))
+	assert.Equals(t, http.StatusOK, w.Code)
+}
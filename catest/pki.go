@@ -0,0 +1,147 @@
+// Package catest provides mocks and fixtures to test the programs that embed
+// the CA: a mock of the authority used by the API, in-memory certificate
+// authorities, provisioners, tokens and certificate requests, and an
+// authority initialized with them.
+//
+// See provisioner.MockProvisioner for a mock of the provisioners.
+package catest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// PKI is a root and an intermediate certificate authority generated for a
+// test.
+type PKI struct {
+	Root            *x509.Certificate
+	RootKey         crypto.Signer
+	Intermediate    *x509.Certificate
+	IntermediateKey crypto.Signer
+}
+
+// NewPKI generates a new root and an intermediate certificate authority with
+// P-256 keys, valid for a day.
+func NewPKI(t testing.TB) *PKI {
+	t.Helper()
+	now := time.Now()
+	rootKey := newKey(t)
+	root := newCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test Root CA"},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            1,
+	}, nil, rootKey.Public(), rootKey)
+	intermediateKey := newKey(t)
+	intermediate := newCertificate(t, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "Test Intermediate CA"},
+		NotBefore:             now.Add(-time.Minute),
+		NotAfter:              now.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            0,
+		MaxPathLenZero:        true,
+	}, root, intermediateKey.Public(), rootKey)
+	return &PKI{
+		Root:            root,
+		RootKey:         rootKey,
+		Intermediate:    intermediate,
+		IntermediateKey: intermediateKey,
+	}
+}
+
+// NewCertificate returns a TLS certificate for the given key signed by the
+// intermediate, valid for an hour. The SANs are split in DNS names, IP
+// addresses, emails and URIs.
+func (p *PKI) NewCertificate(t testing.TB, pub crypto.PublicKey, commonName string, sans ...string) *x509.Certificate {
+	t.Helper()
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: commonName},
+		NotBefore:   now.Add(-time.Minute),
+		NotAfter:    now.Add(time.Hour),
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	tmpl.DNSNames, tmpl.IPAddresses, tmpl.EmailAddresses, tmpl.URIs = splitSANs(sans)
+	return newCertificate(t, tmpl, p.Intermediate, pub, p.IntermediateKey)
+}
+
+// NewCertificateRequest generates a new P-256 key and returns a certificate
+// request signed by it with the given common name and SANs.
+func NewCertificateRequest(t testing.TB, commonName string, sans ...string) (*x509.CertificateRequest, crypto.Signer) {
+	t.Helper()
+	key := newKey(t)
+	tmpl := &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: commonName},
+	}
+	tmpl.DNSNames, tmpl.IPAddresses, tmpl.EmailAddresses, tmpl.URIs = splitSANs(sans)
+	b, err := x509.CreateCertificateRequest(rand.Reader, tmpl, key)
+	if err != nil {
+		t.Fatalf("error creating certificate request: %v", err)
+	}
+	csr, err := x509.ParseCertificateRequest(b)
+	if err != nil {
+		t.Fatalf("error parsing certificate request: %v", err)
+	}
+	return csr, key
+}
+
+func newKey(t testing.TB) crypto.Signer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	return key
+}
+
+func newCertificate(t testing.TB, tmpl, parent *x509.Certificate, pub crypto.PublicKey, signer crypto.Signer) *x509.Certificate {
+	t.Helper()
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		t.Fatalf("error generating serial number: %v", err)
+	}
+	tmpl.SerialNumber = serial
+	if parent == nil {
+		parent = tmpl
+	}
+	b, err := x509.CreateCertificate(rand.Reader, tmpl, parent, pub, signer)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+	crt, err := x509.ParseCertificate(b)
+	if err != nil {
+		t.Fatalf("error parsing certificate: %v", err)
+	}
+	return crt
+}
+
+func splitSANs(sans []string) (dnsNames []string, ips []net.IP, emails []string, uris []*url.URL) {
+	for _, san := range sans {
+		if ip := net.ParseIP(san); ip != nil {
+			ips = append(ips, ip)
+		} else if u, err := url.Parse(san); err == nil && u.Scheme != "" {
+			uris = append(uris, u)
+		} else if strings.Contains(san, "@") {
+			emails = append(emails, san)
+		} else {
+			dnsNames = append(dnsNames, san)
+		}
+	}
+	return
+}
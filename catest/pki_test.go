@@ -0,0 +1,32 @@
+package catest
+
+import (
+	"crypto/x509"
+	"net"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestPKI_NewCertificate(t *testing.T) {
+	pki := NewPKI(t)
+	csr, key := NewCertificateRequest(t, "test", "test.example.com", "127.0.0.1", "test@example.com", "spiffe://example.com/test")
+	assert.FatalError(t, csr.CheckSignature())
+	assert.Equals(t, []string{"test.example.com"}, csr.DNSNames)
+	assert.Equals(t, []string{"test@example.com"}, csr.EmailAddresses)
+	assert.Equals(t, "spiffe://example.com/test", csr.URIs[0].String())
+	assert.True(t, csr.IPAddresses[0].Equal(net.ParseIP("127.0.0.1")))
+
+	crt := pki.NewCertificate(t, key.Public(), "test", "test.example.com")
+	roots := x509.NewCertPool()
+	roots.AddCert(pki.Root)
+	intermediates := x509.NewCertPool()
+	intermediates.AddCert(pki.Intermediate)
+	_, err := crt.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		DNSName:       "test.example.com",
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	assert.FatalError(t, err)
+}
@@ -0,0 +1,68 @@
+package catest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-cli/crypto/randutil"
+	"github.com/RTradeLtd/ca-cli/jose"
+)
+
+// NewJWKProvisioner returns a JWK provisioner with the given name and a new
+// P-256 key, and the private key used to sign its tokens.
+func NewJWKProvisioner(t testing.TB, name string) (*provisioner.JWK, *jose.JSONWebKey) {
+	t.Helper()
+	key, err := jose.GenerateJWK("EC", "P-256", "ES256", "sig", "", 0)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	pub := key.Public()
+	return &provisioner.JWK{
+		Type: "JWK",
+		Name: name,
+		Key:  &pub,
+	}, key
+}
+
+// GenerateToken returns a one-time token signed by the key of a JWK
+// provisioner, valid for five minutes. The issuer is the name of the
+// provisioner and the audience an url like https://ca.example.com/1.0/sign.
+func GenerateToken(t testing.TB, key *jose.JSONWebKey, issuer, audience, subject string, sans ...string) string {
+	t.Helper()
+	so := new(jose.SignerOptions)
+	so.WithType("JWT")
+	so.WithHeader("kid", key.KeyID)
+	sig, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: key.Key}, so)
+	if err != nil {
+		t.Fatalf("error creating signer: %v", err)
+	}
+	id, err := randutil.ASCII(64)
+	if err != nil {
+		t.Fatalf("error generating token id: %v", err)
+	}
+	if len(sans) == 0 {
+		sans = []string{subject}
+	}
+	now := time.Now()
+	claims := struct {
+		jose.Claims
+		SANs []string `json:"sans"`
+	}{
+		Claims: jose.Claims{
+			ID:        id,
+			Subject:   subject,
+			Issuer:    issuer,
+			IssuedAt:  jose.NewNumericDate(now),
+			NotBefore: jose.NewNumericDate(now),
+			Expiry:    jose.NewNumericDate(now.Add(5 * time.Minute)),
+			Audience:  []string{audience},
+		},
+		SANs: sans,
+	}
+	tok, err := jose.Signed(sig).Claims(claims).CompactSerialize()
+	if err != nil {
+		t.Fatalf("error signing token: %v", err)
+	}
+	return tok
+}
@@ -0,0 +1,70 @@
+// Package certstore adds and removes the certificates of the CA in the system
+// certificate stores of Windows, so the roots of the CA are trusted by the
+// native programs of the host. On other platforms it returns ErrNotSupported.
+package certstore
+
+import (
+	"bytes"
+	"crypto/x509"
+
+	"github.com/pkg/errors"
+)
+
+// Names of the system stores.
+const (
+	// RootStore is the store of the trusted root certificates.
+	RootStore = "ROOT"
+	// IntermediateStore is the store of the intermediate certificates.
+	IntermediateStore = "CA"
+	// PersonalStore is the store of the certificates with a private key.
+	PersonalStore = "MY"
+)
+
+// Location is the location of a system store.
+type Location int
+
+const (
+	// CurrentUser are the stores of the user running the process.
+	CurrentUser Location = iota
+	// LocalMachine are the stores shared by all the users, writing them
+	// requires administrator rights.
+	LocalMachine
+)
+
+// String returns the name of the location.
+func (l Location) String() string {
+	if l == LocalMachine {
+		return "LocalMachine"
+	}
+	return "CurrentUser"
+}
+
+// ErrNotSupported is returned on the platforms without system stores.
+var ErrNotSupported = errors.New("certificate stores are not supported on this platform")
+
+// StoreName returns the store of the given certificate: the self-signed CA
+// certificates are roots, the other CA certificates are intermediates.
+func StoreName(crt *x509.Certificate) string {
+	switch {
+	case !crt.IsCA:
+		return PersonalStore
+	case bytes.Equal(crt.RawIssuer, crt.RawSubject) && crt.CheckSignatureFrom(crt) == nil:
+		return RootStore
+	default:
+		return IntermediateStore
+	}
+}
+
+// AddChain adds the CA certificates of the given chain to their stores, e.g.
+// the roots of the CA, or an intermediate and its root. The leaf certificates
+// are skipped, they are only useful with their private key.
+func AddChain(location Location, chain ...*x509.Certificate) error {
+	for _, crt := range chain {
+		if name := StoreName(crt); name != PersonalStore {
+			if err := Add(location, name, crt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package certstore
+
+import "crypto/x509"
+
+// Add returns ErrNotSupported.
+func Add(location Location, store string, certs ...*x509.Certificate) error {
+	return ErrNotSupported
+}
+
+// Remove returns ErrNotSupported.
+func Remove(location Location, store string, certs ...*x509.Certificate) error {
+	return ErrNotSupported
+}
@@ -0,0 +1,50 @@
+package certstore
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func TestStoreName(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	now := time.Now()
+	create := func(cn string, isCA bool, parent *x509.Certificate) *x509.Certificate {
+		tmpl := &x509.Certificate{
+			SerialNumber:          big.NewInt(now.UnixNano()),
+			Subject:               pkix.Name{CommonName: cn},
+			NotBefore:             now,
+			NotAfter:              now.Add(time.Hour),
+			BasicConstraintsValid: true,
+			IsCA:                  isCA,
+		}
+		if parent == nil {
+			parent = tmpl
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), key)
+		assert.FatalError(t, err)
+		crt, err := x509.ParseCertificate(der)
+		assert.FatalError(t, err)
+		return crt
+	}
+
+	root := create("Root CA", true, nil)
+	intermediate := create("Intermediate CA", true, root)
+	leaf := create("leaf", false, intermediate)
+	assert.Equals(t, RootStore, StoreName(root))
+	assert.Equals(t, IntermediateStore, StoreName(intermediate))
+	assert.Equals(t, PersonalStore, StoreName(leaf))
+}
+
+func TestLocation_String(t *testing.T) {
+	assert.Equals(t, "CurrentUser", CurrentUser.String())
+	assert.Equals(t, "LocalMachine", LocalMachine.String())
+}
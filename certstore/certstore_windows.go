@@ -0,0 +1,88 @@
+package certstore
+
+import (
+	"crypto/x509"
+	"unsafe"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows"
+)
+
+var (
+	crypt32                              = windows.NewLazySystemDLL("crypt32.dll")
+	procCertAddEncodedCertificateToStore = crypt32.NewProc("CertAddEncodedCertificateToStore")
+	procCertDuplicateCertificateContext  = crypt32.NewProc("CertDuplicateCertificateContext")
+	procCertDeleteCertificateFromStore   = crypt32.NewProc("CertDeleteCertificateFromStore")
+)
+
+const encodingType = windows.X509_ASN_ENCODING | windows.PKCS_7_ASN_ENCODING
+
+// openStore opens the system store with the given name.
+func openStore(location Location, store string) (windows.Handle, error) {
+	name, err := windows.UTF16PtrFromString(store)
+	if err != nil {
+		return 0, errors.Wrapf(err, "error opening store %s", store)
+	}
+	flags := uint32(windows.CERT_SYSTEM_STORE_CURRENT_USER)
+	if location == LocalMachine {
+		flags = windows.CERT_SYSTEM_STORE_LOCAL_MACHINE
+	}
+	h, err := windows.CertOpenStore(windows.CERT_STORE_PROV_SYSTEM, 0, 0, flags, uintptr(unsafe.Pointer(name)))
+	if err != nil || h == 0 {
+		return 0, errors.Wrapf(err, "error opening store %s\\%s", location, store)
+	}
+	return h, nil
+}
+
+// Add adds the given certificates to the system store, replacing them if they
+// already exist.
+func Add(location Location, store string, certs ...*x509.Certificate) error {
+	h, err := openStore(location, store)
+	if err != nil {
+		return err
+	}
+	defer windows.CertCloseStore(h, 0)
+
+	for _, crt := range certs {
+		r, _, err := procCertAddEncodedCertificateToStore.Call(uintptr(h), encodingType,
+			uintptr(unsafe.Pointer(&crt.Raw[0])), uintptr(len(crt.Raw)),
+			windows.CERT_STORE_ADD_REPLACE_EXISTING, 0)
+		if r == 0 {
+			return errors.Wrapf(err, "error adding certificate %s to store %s\\%s", crt.Subject, location, store)
+		}
+	}
+	return nil
+}
+
+// Remove removes the given certificates from the system store, the
+// certificates not in the store are skipped.
+func Remove(location Location, store string, certs ...*x509.Certificate) error {
+	h, err := openStore(location, store)
+	if err != nil {
+		return err
+	}
+	defer windows.CertCloseStore(h, 0)
+
+	remove := make(map[string]bool, len(certs))
+	for _, crt := range certs {
+		remove[string(crt.Raw)] = true
+	}
+	var ctx *windows.CertContext
+	for {
+		if ctx, err = windows.CertEnumCertificatesInStore(h, ctx); err != nil {
+			// The enumeration ends with CRYPT_E_NOT_FOUND.
+			return nil
+		}
+		der := (*[1 << 24]byte)(unsafe.Pointer(ctx.EncodedCert))[:ctx.Length:ctx.Length]
+		if !remove[string(der)] {
+			continue
+		}
+		// The deletion always frees the context, the enumeration keeps using
+		// the original one.
+		dup, _, _ := procCertDuplicateCertificateContext.Call(uintptr(unsafe.Pointer(ctx)))
+		if r, _, err := procCertDeleteCertificateFromStore.Call(dup); r == 0 {
+			windows.CertFreeCertificateContext(ctx)
+			return errors.Wrapf(err, "error removing certificate from store %s\\%s", location, store)
+		}
+	}
+}
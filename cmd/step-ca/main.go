@@ -14,6 +14,7 @@ import (
 	"time"
 
 	"github.com/RTradeLtd/ca-certificates/commands"
+	"github.com/RTradeLtd/ca-certificates/logging"
 	"github.com/RTradeLtd/ca-cli/command"
 	"github.com/RTradeLtd/ca-cli/command/version"
 	"github.com/RTradeLtd/ca-cli/config"
@@ -143,6 +144,9 @@ $ step-ca $STEPPATH/config/ca.json --password-file ./password.txt
 	app.ErrWriter = os.Stderr
 	app.Commands = command.Retrieve()
 
+	// Redact tokens and keys in the errors written with the log package.
+	log.SetOutput(logging.NewRedactWriter(os.Stderr))
+
 	// Start the golang debug logger if environment variable is set.
 	// See https://golang.org/pkg/net/http/pprof/
 	debugProfAddr := os.Getenv("STEP_PROF_ADDR")
@@ -10,6 +10,7 @@ import (
 
 	"github.com/RTradeLtd/ca-certificates/authority"
 	"github.com/RTradeLtd/ca-certificates/ca"
+	"github.com/RTradeLtd/ca-certificates/winsvc"
 	"github.com/RTradeLtd/ca-cli/errs"
 	"github.com/pkg/errors"
 	"github.com/urfave/cli"
@@ -20,13 +21,19 @@ var AppCommand = cli.Command{
 	Name:   "start",
 	Action: appAction,
 	UsageText: `**step-ca** <config>
-	[**--password-file**=<file>]`,
+	[**--password-file**=<file>] [**--service-name**=<name>]`,
 	Flags: []cli.Flag{
 		cli.StringFlag{
 			Name: "password-file",
 			Usage: `path to the <file> containing the password to decrypt the
 intermediate private key.`,
 		},
+		cli.StringFlag{
+			Name:  "service-name",
+			Value: winsvc.DefaultName,
+			Usage: `the <name> of the Windows service, used as the source of the
+events in the event log when the CA runs as a service.`,
+		},
 	},
 }
 
@@ -50,10 +57,9 @@ func appAction(ctx *cli.Context) error {
 
 	var password []byte
 	if passFile != "" {
-		if password, err = ioutil.ReadFile(passFile); err != nil {
-			fatal(errors.Wrapf(err, "error reading %s", passFile))
+		if password, err = readPasswordFile(passFile); err != nil {
+			fatal(err)
 		}
-		password = bytes.TrimRightFunc(password, unicode.IsSpace)
 	}
 
 	srv, err := ca.New(config, ca.WithConfigFile(configFile), ca.WithPassword(password))
@@ -61,6 +67,18 @@ func appAction(ctx *cli.Context) error {
 		fatal(err)
 	}
 
+	// On Windows the service control manager stops, pauses and reloads the CA.
+	isService, err := winsvc.IsService()
+	if err != nil {
+		fatal(err)
+	}
+	if isService {
+		if err = winsvc.Run(ctx.String("service-name"), srv); err != nil {
+			fatal(err)
+		}
+		return nil
+	}
+
 	go ca.StopReloaderHandler(srv)
 	if err = srv.Run(); err != nil && err != http.ErrServerClosed {
 		fatal(err)
@@ -79,3 +97,13 @@ func fatal(err error) {
 	}
 	os.Exit(2)
 }
+
+// readPasswordFile returns the contents of the given file without the trailing
+// white spaces.
+func readPasswordFile(name string) ([]byte, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", name)
+	}
+	return bytes.TrimRightFunc(b, unicode.IsSpace), nil
+}
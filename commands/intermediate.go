@@ -0,0 +1,162 @@
+package commands
+
+import (
+	"encoding/pem"
+	"fmt"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/pki"
+	"github.com/RTradeLtd/ca-cli/command"
+	"github.com/RTradeLtd/ca-cli/errs"
+	"github.com/RTradeLtd/ca-cli/utils"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	command.Register(cli.Command{
+		Name:      "intermediate",
+		Usage:     "replace the intermediate with one signed by an external root",
+		UsageText: "**step-ca intermediate** <subcommand> [arguments] [global-flags] [subcommand-flags]",
+		Description: `**step-ca intermediate** replaces the intermediate certificate and key of the
+CA with ones signed by an external or offline root, e.g. a root kept in an
+air-gapped HSM.
+
+The **csr** subcommand generates a new key and a certificate signing request.
+Sign the request with the root, then use the **activate** subcommand to verify
+the certificate and install it with the key. The current intermediate is not
+modified until the new one is activated.
+
+'''
+$ step-ca intermediate csr --name "Example Intermediate CA" \
+	--key intermediate_ca_key.new --password-file password.txt \
+	intermediate.csr
+$ step-ca intermediate activate --key intermediate_ca_key.new \
+	--password-file password.txt \
+	$(step path)/config/ca.json intermediate_ca.crt
+'''`,
+		Subcommands: cli.Commands{
+			{
+				Name:      "csr",
+				Usage:     "generate a new intermediate key and certificate signing request",
+				UsageText: "**step-ca intermediate csr** <csr> **--name**=<name> **--key**=<file> **--password-file**=<file>",
+				Action:    intermediateCSRAction,
+				Description: `**step-ca intermediate csr** generates a new intermediate key, writes it
+encrypted to the <file> in **--key**, and writes a PEM encoded certificate
+signing request for an intermediate CA to <csr>.
+
+## POSITIONAL ARGUMENTS
+
+<csr>
+:  The path where the certificate signing request is written.`,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "name",
+						Usage: "The common name of the intermediate.",
+					},
+					cli.StringFlag{
+						Name:  "key",
+						Usage: "The path to the <file> where the new key is written.",
+					},
+					cli.StringFlag{
+						Name: "password-file",
+						Usage: `The path to the <file> containing the password to encrypt the key, the
+one used to start the CA.`,
+					},
+				},
+			},
+			{
+				Name:      "activate",
+				Usage:     "install a signed intermediate certificate",
+				UsageText: "**step-ca intermediate activate** <config> <crt> **--key**=<file> **--password-file**=<file>",
+				Action:    intermediateActivateAction,
+				Description: `**step-ca intermediate activate** verifies that the certificate in <crt> is
+an intermediate CA for the key in **--key** and that it chains to the roots of
+the CA, and installs both in the paths of the "crt" and "key" attributes of the
+configuration. The previous files are kept with the ".old" extension.
+
+Restart the CA, or send it a SIGHUP, to start signing with the new
+intermediate.
+
+## POSITIONAL ARGUMENTS
+
+<config>
+:  The path to the configuration file of the CA.
+
+<crt>
+:  The path to the signed certificate, optionally followed by the certificates
+between it and the root.`,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "key",
+						Usage: "The path to the <file> with the key generated by **csr**.",
+					},
+					cli.StringFlag{
+						Name:  "password-file",
+						Usage: "The path to the <file> containing the password of the key.",
+					},
+				},
+			},
+		},
+	})
+}
+
+func intermediateCSRAction(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return cli.ShowCommandHelp(ctx, "csr")
+	}
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+	for _, flag := range []string{"name", "key", "password-file"} {
+		if ctx.String(flag) == "" {
+			return errs.RequiredFlag(ctx, flag)
+		}
+	}
+	password, err := readPasswordFile(ctx.String("password-file"))
+	if err != nil {
+		return err
+	}
+
+	csr, err := pki.GenerateIntermediateCSR(ctx.String("name"), ctx.String("key"), password)
+	if err != nil {
+		return err
+	}
+	csrFile := ctx.Args().Get(0)
+	if err := utils.WriteFile(csrFile, pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE REQUEST",
+		Bytes: csr.Raw,
+	}), 0600); err != nil {
+		return err
+	}
+	fmt.Printf("Your certificate signing request has been saved in %s.\n", csrFile)
+	fmt.Printf("Your private key has been saved in %s.\n", ctx.String("key"))
+	return nil
+}
+
+func intermediateActivateAction(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return cli.ShowCommandHelp(ctx, "activate")
+	}
+	if err := errs.NumberOfArguments(ctx, 2); err != nil {
+		return err
+	}
+	for _, flag := range []string{"key", "password-file"} {
+		if ctx.String(flag) == "" {
+			return errs.RequiredFlag(ctx, flag)
+		}
+	}
+	config, err := authority.LoadConfiguration(ctx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	password, err := readPasswordFile(ctx.String("password-file"))
+	if err != nil {
+		return err
+	}
+
+	if err := pki.ActivateIntermediate(config, ctx.Args().Get(1), ctx.String("key"), password); err != nil {
+		return err
+	}
+	fmt.Printf("The intermediate has been installed in %s and %s.\n", config.IntermediateCert, config.IntermediateKey)
+	return nil
+}
@@ -0,0 +1,93 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/RTradeLtd/ca-cli/command"
+	"github.com/RTradeLtd/ca-cli/errs"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	command.Register(cli.Command{
+		Name:      "migrate",
+		Usage:     "migrate the schema of the database",
+		UsageText: "**step-ca migrate** <config> [**--dry-run**]",
+		Action:    migrateAction,
+		Description: `**step-ca migrate** applies the migrations of the database schema required
+by this release of step-ca.
+
+The migrations are applied automatically when the CA starts unless the
+"skipMigrations" attribute of the database configuration is set. The CA must be
+stopped while the migrations are applied.
+
+'''
+$ step-ca migrate --dry-run $(step path)/config/ca.json
+$ step-ca migrate $(step path)/config/ca.json
+'''
+
+## POSITIONAL ARGUMENTS
+
+<config>
+:  The path to the configuration file of the CA.`,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "Print the pending migrations without applying them.",
+			},
+		},
+	})
+}
+
+func migrateAction(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return cli.ShowCommandHelp(ctx, "migrate")
+	}
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+
+	config, err := authority.LoadConfiguration(ctx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	if config.DB == nil {
+		return errors.New("the configuration does not have a database")
+	}
+
+	// Apply the migrations explicitly.
+	config.DB.SkipMigrations = true
+	database, err := db.New(config.DB)
+	if err != nil {
+		return err
+	}
+	defer database.Shutdown()
+
+	migrator, ok := database.(db.Migrator)
+	if !ok {
+		return errors.New("the database does not support migrations")
+	}
+	version, err := migrator.GetSchemaVersion()
+	if err != nil {
+		return err
+	}
+	dryRun := ctx.Bool("dry-run")
+	migrations, err := migrator.Migrate(dryRun)
+	for _, m := range migrations {
+		if dryRun {
+			fmt.Printf("Pending migration %d: %s\n", m.Version, m.Description)
+		} else {
+			fmt.Printf("Applied migration %d: %s\n", m.Version, m.Description)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if len(migrations) == 0 {
+		fmt.Printf("Database schema version %d is up to date.\n", version)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/RTradeLtd/ca-cli/command"
+	"github.com/RTradeLtd/ca-cli/errs"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	command.Register(cli.Command{
+		Name:      "reindex",
+		Usage:     "rebuild the certificate indexes of the database",
+		UsageText: "**step-ca reindex** <config>",
+		Action:    reindexAction,
+		Description: `**step-ca reindex** rebuilds the common name and subject alternative names
+indexes of the issued certificates stored in the database.
+
+The indexes are updated every time a certificate is issued, use this command to
+index the certificates stored by a previous version of step-ca. The CA must be
+stopped while the indexes are rebuilt.
+
+'''
+$ step-ca reindex $(step path)/config/ca.json
+'''
+
+## POSITIONAL ARGUMENTS
+
+<config>
+:  The path to the configuration file of the CA.`,
+	})
+}
+
+func reindexAction(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return cli.ShowCommandHelp(ctx, "reindex")
+	}
+	if err := errs.NumberOfArguments(ctx, 1); err != nil {
+		return err
+	}
+
+	config, err := authority.LoadConfiguration(ctx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	if config.DB == nil {
+		return errors.New("the configuration does not have a database")
+	}
+
+	database, err := db.New(config.DB)
+	if err != nil {
+		return err
+	}
+	defer database.Shutdown()
+
+	n, err := database.RebuildIndexes()
+	if err != nil {
+		return errors.Wrap(err, "error rebuilding indexes")
+	}
+	fmt.Printf("Indexed %d certificates.\n", n)
+	return nil
+}
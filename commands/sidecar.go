@@ -0,0 +1,184 @@
+package commands
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/RTradeLtd/ca-certificates/ca"
+	"github.com/RTradeLtd/ca-cli/command"
+	"github.com/RTradeLtd/ca-cli/errs"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	command.Register(cli.Command{
+		Name:  "sidecar",
+		Usage: "get a certificate, write it and keep renewing it",
+		UsageText: `**step-ca sidecar** [<token>] [**--token-file**=<file>]
+[**--cert**=<file>] [**--key**=<file>] [**--root**=<file>]
+[**--renew-before**=<duration>] [**--pid-file**=<file>] [**--signal**=<signal>]
+[**--exec**=<command>] [**--once**]`,
+		Action: sidecarAction,
+		Description: `**step-ca sidecar** gets a certificate from the CA with a bootstrap token,
+writes the certificate chain, the private key and the root certificates in the
+given files, and renews the certificate after two thirds of its validity until
+it is stopped. It replaces the autocert sidecar: run it next to the main
+process and share the files with a volume.
+
+After each renewal the main process is notified with a signal, sent to the
+process in the pid file, and with a command, run with the shell. The files are
+replaced atomically.
+
+Use an init container with **--once** to write the first certificate before
+the main process starts:
+
+'''
+$ step-ca sidecar --once --token-file /var/run/autocert/token \
+    --cert /var/run/autocert/site.crt --key /var/run/autocert/site.key \
+    --root /var/run/autocert/root.crt
+'''
+
+And the sidecar to renew it and reload nginx:
+
+'''
+$ step-ca sidecar --token-file /var/run/autocert/token \
+    --cert /var/run/autocert/site.crt --key /var/run/autocert/site.key \
+    --root /var/run/autocert/root.crt --pid-file /var/run/nginx.pid --signal HUP
+'''
+
+## POSITIONAL ARGUMENTS
+
+<token>
+:  The bootstrap token, it can also be set with **--token-file** or in the
+STEP_TOKEN environment variable.`,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "token-file",
+				Usage: "path to the <file> with the bootstrap token.",
+			},
+			cli.StringFlag{
+				Name:  "cert",
+				Usage: "path to the <file> where the certificate chain is written.",
+			},
+			cli.StringFlag{
+				Name:  "key",
+				Usage: "path to the <file> where the private key is written.",
+			},
+			cli.StringFlag{
+				Name:  "root",
+				Usage: "path to the <file> where the root certificates are written.",
+			},
+			cli.DurationFlag{
+				Name: "renew-before",
+				Usage: `the <duration> before the expiration when the certificate is
+renewed, after two thirds of its validity by default.`,
+			},
+			cli.StringFlag{
+				Name:  "pid-file",
+				Usage: "path to the <file> with the pid of the process notified after a renewal.",
+			},
+			cli.StringFlag{
+				Name:  "signal",
+				Value: "HUP",
+				Usage: "the <signal> sent to the process in --pid-file, a name or a number.",
+			},
+			cli.StringFlag{
+				Name:  "exec",
+				Usage: "the <command> run with the shell after a renewal.",
+			},
+			cli.BoolFlag{
+				Name:  "once",
+				Usage: "exit after writing the first certificate.",
+			},
+		},
+	})
+}
+
+func sidecarAction(ctx *cli.Context) error {
+	if ctx.NArg() > 0 {
+		if err := errs.NumberOfArguments(ctx, 1); err != nil {
+			return err
+		}
+	}
+
+	token := ctx.Args().Get(0)
+	if filename := ctx.String("token-file"); filename != "" {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return errors.Wrapf(err, "error reading %s", filename)
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	if token == "" {
+		token = os.Getenv("STEP_TOKEN")
+	}
+	if token == "" {
+		return cli.ShowCommandHelp(ctx, "sidecar")
+	}
+
+	opts := []ca.SidecarOption{
+		ca.WithSidecarFiles(ctx.String("cert"), ctx.String("key"), ctx.String("root")),
+		ca.WithSidecarRenewBefore(ctx.Duration("renew-before")),
+	}
+	if pidFile := ctx.String("pid-file"); pidFile != "" {
+		sig, err := parseSignal(ctx.String("signal"))
+		if err != nil {
+			return err
+		}
+		opts = append(opts, ca.WithSidecarSignal(pidFile, sig))
+	}
+	if cmd := ctx.String("exec"); cmd != "" {
+		opts = append(opts, ca.WithSidecarExec("/bin/sh", "-c", cmd))
+	}
+
+	s, err := ca.NewSidecar(token, opts...)
+	if err != nil {
+		return err
+	}
+	log.Printf("Wrote certificate valid until %s", s.Certificate().Leaf.NotAfter)
+	if ctx.Bool("once") {
+		return nil
+	}
+
+	c, cancel := context.WithCancel(context.Background())
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+		cancel()
+	}()
+	if err := s.Run(c); err != nil && err != context.Canceled {
+		return err
+	}
+	return nil
+}
+
+// signalNames are the names of the signals accepted by parseSignal, other signals
+// can be given by number.
+var signalNames = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"TERM": syscall.SIGTERM,
+	"KILL": syscall.SIGKILL,
+}
+
+// parseSignal parses a signal name, with or without the SIG prefix, or a
+// signal number.
+func parseSignal(s string) (os.Signal, error) {
+	name := strings.TrimPrefix(strings.ToUpper(s), "SIG")
+	if sig, ok := signalNames[name]; ok {
+		return sig, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil && n > 0 {
+		return syscall.Signal(n), nil
+	}
+	return nil, errors.Errorf("unsupported signal %s", s)
+}
@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/RTradeLtd/ca-certificates/audit"
+	"github.com/RTradeLtd/ca-cli/command"
+	"github.com/RTradeLtd/ca-cli/crypto/pemutil"
+	"github.com/RTradeLtd/ca-cli/errs"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+func init() {
+	command.Register(cli.Command{
+		Name:      "verify-audit",
+		Usage:     "verify the signatures of a signed audit log",
+		UsageText: "**step-ca verify-audit** <log> <key>",
+		Action:    verifyAuditAction,
+		Description: `**step-ca verify-audit** verifies the hash chain and the signatures of the
+batches of an audit log written with the "signing" option.
+
+A modified, added or removed entry or batch breaks the chain, and the command
+fails with the line of the first batch that does not verify. The entries after
+the last batch are not verified. A rotated log starts with the hash of the last
+batch of the previous log, compare it with the last hash of that log.
+
+'''
+$ step-ca verify-audit /var/log/step-ca/audit.log audit_pub.pem
+'''
+
+## POSITIONAL ARGUMENTS
+
+<log>
+:  The path to the audit log.
+
+<key>
+:  The path to the public key, certificate or private key used to sign the log.`,
+	})
+}
+
+func verifyAuditAction(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return cli.ShowCommandHelp(ctx, "verify-audit")
+	}
+	if err := errs.NumberOfArguments(ctx, 2); err != nil {
+		return err
+	}
+
+	key, err := pemutil.Read(ctx.Args().Get(1))
+	if err != nil {
+		return err
+	}
+	var pub crypto.PublicKey
+	switch k := key.(type) {
+	case *x509.Certificate:
+		pub = k.PublicKey
+	case crypto.Signer:
+		pub = k.Public()
+	default:
+		pub = k
+	}
+
+	v, err := audit.VerifyFile(ctx.Args().Get(0), pub)
+	if err != nil {
+		return errors.Wrap(err, "error verifying audit log")
+	}
+	fmt.Printf("Verified %d entries in %d batches.\n", v.Entries, v.Batches)
+	if v.Last != nil {
+		fmt.Printf("First previous hash: %s\n", v.Previous)
+		fmt.Printf("Last hash: %s\n", v.Last.Hash)
+	}
+	if v.Unsealed > 0 {
+		fmt.Printf("%d entries after the last batch are not signed yet.\n", v.Unsealed)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+// Package configsource resolves the references to environment variables and
+// to the Consul and Vault key-value stores in the configuration of the CA, so
+// secrets and other values do not need to be written in the configuration
+// file.
+//
+// A reference has the form ${env:NAME}, ${consul:key} or ${vault:path#field},
+// and it can be used in any string of the configuration, e.g.
+//
+//	"password": "${env:STEP_CA_PASSWORD}",
+//	"dataSource": "postgres://step:${vault:secret/data/step-ca#db}@db/step"
+package configsource
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Sources of the references.
+const (
+	Env    = "env"
+	Consul = "consul"
+	Vault  = "vault"
+)
+
+// DefaultConsulAddress is the address of Consul if CONSUL_HTTP_ADDR is not
+// set.
+const DefaultConsulAddress = "http://127.0.0.1:8500"
+
+// DefaultVaultAddress is the address of Vault if VAULT_ADDR is not set.
+const DefaultVaultAddress = "https://127.0.0.1:8200"
+
+// DefaultPollInterval is the interval used to check the Vault secrets for
+// changes.
+const DefaultPollInterval = time.Minute
+
+var referenceRegexp = regexp.MustCompile(`\$\{(env|consul|vault):([^}]+)\}`)
+
+// Reference is a reference to a value in an environment variable, a Consul
+// key or a field of a Vault secret.
+type Reference struct {
+	Source string
+	Key    string
+	Field  string
+}
+
+// String returns the reference as it is written in the configuration.
+func (r Reference) String() string {
+	if r.Field != "" {
+		return "${" + r.Source + ":" + r.Key + "#" + r.Field + "}"
+	}
+	return "${" + r.Source + ":" + r.Key + "}"
+}
+
+// IsRemote returns true if the value of the reference is in Consul or Vault,
+// and it can change while the CA is running.
+func (r Reference) IsRemote() bool {
+	return r.Source != Env
+}
+
+// parseReference parses a reference matched by referenceRegexp.
+func parseReference(source, key string) Reference {
+	ref := Reference{Source: source, Key: key}
+	if source == Vault {
+		if i := strings.LastIndex(key, "#"); i >= 0 {
+			ref.Key, ref.Field = key[:i], key[i+1:]
+		}
+	}
+	return ref
+}
+
+// References returns the references in the given document without
+// duplicates.
+func References(data []byte) []Reference {
+	var refs []Reference
+	seen := make(map[Reference]bool)
+	for _, m := range referenceRegexp.FindAllSubmatch(data, -1) {
+		ref := parseReference(string(m[1]), string(m[2]))
+		if !seen[ref] {
+			seen[ref] = true
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// Resolver gets the values of the references.
+type Resolver struct {
+	LookupEnv     func(key string) (string, bool)
+	Client        *http.Client
+	ConsulAddress string
+	ConsulToken   string
+	VaultAddress  string
+	VaultToken    string
+	PollInterval  time.Duration
+}
+
+// NewResolver returns a Resolver configured with the environment variables
+// used by the Consul and Vault clients: CONSUL_HTTP_ADDR, CONSUL_HTTP_TOKEN,
+// CONSUL_CACERT, VAULT_ADDR, VAULT_TOKEN and VAULT_CACERT.
+func NewResolver() (*Resolver, error) {
+	r := &Resolver{
+		LookupEnv:     os.LookupEnv,
+		Client:        http.DefaultClient,
+		ConsulAddress: getenv("CONSUL_HTTP_ADDR", DefaultConsulAddress),
+		ConsulToken:   os.Getenv("CONSUL_HTTP_TOKEN"),
+		VaultAddress:  getenv("VAULT_ADDR", DefaultVaultAddress),
+		VaultToken:    os.Getenv("VAULT_TOKEN"),
+		PollInterval:  DefaultPollInterval,
+	}
+	if !strings.Contains(r.ConsulAddress, "://") {
+		r.ConsulAddress = "http://" + r.ConsulAddress
+	}
+
+	// The CA certificates of both services are trusted by the same client.
+	var pool *x509.CertPool
+	for _, name := range []string{"CONSUL_CACERT", "VAULT_CACERT"} {
+		filename := os.Getenv(name)
+		if filename == "" {
+			continue
+		}
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading %s", filename)
+		}
+		if pool == nil {
+			if pool, err = x509.SystemCertPool(); err != nil {
+				pool = x509.NewCertPool()
+			}
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, errors.Errorf("error parsing %s: no certificates found", filename)
+		}
+	}
+	if pool != nil {
+		r.Client = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			},
+		}
+	}
+	return r, nil
+}
+
+func getenv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return strings.TrimRight(v, "/")
+	}
+	return def
+}
+
+// Resolve returns the given JSON document with the references replaced by
+// their values. The values are escaped, so the references must be in JSON
+// strings.
+func (r *Resolver) Resolve(data []byte) ([]byte, error) {
+	values := make(map[Reference][]byte)
+	for _, ref := range References(data) {
+		v, err := r.Get(ref)
+		if err != nil {
+			return nil, err
+		}
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error encoding %s", ref)
+		}
+		// Remove the quotes, the reference is already in a string.
+		values[ref] = b[1 : len(b)-1]
+	}
+	return referenceRegexp.ReplaceAllFunc(data, func(b []byte) []byte {
+		m := referenceRegexp.FindSubmatch(b)
+		return values[parseReference(string(m[1]), string(m[2]))]
+	}), nil
+}
+
+// Get returns the value of the given reference.
+func (r *Resolver) Get(ref Reference) (string, error) {
+	switch ref.Source {
+	case Env:
+		v, ok := r.LookupEnv(ref.Key)
+		if !ok {
+			return "", errors.Errorf("error resolving %s: environment variable %s is not set", ref, ref.Key)
+		}
+		return v, nil
+	case Consul:
+		v, _, err := r.getConsul(context.Background(), ref.Key, 0)
+		return v, errors.Wrapf(err, "error resolving %s", ref)
+	case Vault:
+		v, err := r.getVault(context.Background(), ref)
+		return v, errors.Wrapf(err, "error resolving %s", ref)
+	default:
+		return "", errors.Errorf("unsupported reference %s", ref)
+	}
+}
@@ -0,0 +1,228 @@
+package configsource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// requestTimeout is the timeout of the requests to Consul and Vault, the
+// blocking queries of Consul wait up to consulWait longer.
+const requestTimeout = 30 * time.Second
+
+// consulWait is the maximum duration of the Consul blocking queries.
+const consulWait = 5 * time.Minute
+
+// maxValueSize is the maximum size of the responses of Consul and Vault.
+const maxValueSize = 1 << 20
+
+// getConsul returns the value and the index of the given Consul key. If index
+// is not zero it uses a blocking query that returns when the index of the key
+// is greater than the given one, or after consulWait. The trailing new lines
+// of the value are removed.
+func (r *Resolver) getConsul(ctx context.Context, key string, index uint64) (string, uint64, error) {
+	u := r.ConsulAddress + "/v1/kv/" + strings.TrimLeft(key, "/") + "?raw"
+	timeout := requestTimeout
+	if index > 0 {
+		u += "&index=" + strconv.FormatUint(index, 10) + "&wait=" + consulWait.String()
+		timeout += consulWait
+	}
+	header := http.Header{}
+	if r.ConsulToken != "" {
+		header.Set("X-Consul-Token", r.ConsulToken)
+	}
+	b, resp, err := r.get(ctx, u, header, timeout)
+	if err != nil {
+		return "", 0, err
+	}
+	newIndex, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	return strings.TrimRight(string(b), "\r\n"), newIndex, nil
+}
+
+// getVault returns the value of a field of a Vault secret. It supports the
+// versions 1 and 2 of the KV secrets engine, with the latter the path must
+// include the data prefix, e.g. secret/data/step-ca.
+func (r *Resolver) getVault(ctx context.Context, ref Reference) (string, error) {
+	if ref.Field == "" {
+		return "", errors.New("vault references require a field, e.g. ${vault:secret/data/step-ca#password}")
+	}
+	header := http.Header{}
+	if r.VaultToken != "" {
+		header.Set("X-Vault-Token", r.VaultToken)
+	}
+	b, _, err := r.get(ctx, r.VaultAddress+"/v1/"+strings.TrimLeft(ref.Key, "/"), header, requestTimeout)
+	if err != nil {
+		return "", err
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(b, &secret); err != nil {
+		return "", errors.Wrap(err, "error parsing vault response")
+	}
+	data := secret.Data
+	// KV version 2 wraps the data with its metadata.
+	if v2, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = v2
+		}
+	}
+	switch v := data[ref.Field].(type) {
+	case nil:
+		return "", errors.Errorf("field %s not found", ref.Field)
+	case string:
+		return v, nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// get sends a GET request and returns the body of a successful response.
+func (r *Resolver) get(ctx context.Context, u string, header http.Header, timeout time.Duration) ([]byte, *http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error creating request for %s", redactURL(u))
+	}
+	req.Header = header
+	resp, err := r.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error requesting %s", redactURL(u))
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxValueSize))
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error reading %s", redactURL(u))
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, nil, errors.Errorf("%s not found", redactURL(u))
+	case resp.StatusCode >= 400:
+		return nil, nil, errors.Errorf("error requesting %s: %s", redactURL(u), resp.Status)
+	}
+	return b, resp, nil
+}
+
+// redactURL removes the query of the given URL for the errors.
+func redactURL(u string) string {
+	if p, err := url.Parse(u); err == nil {
+		p.RawQuery = ""
+		return p.String()
+	}
+	return u
+}
+
+// Watch blocks until the value of one of the given remote references changes,
+// or until the context is done, then it returns the error of the context.
+// Consul keys are watched with blocking queries, and Vault secrets are polled
+// every PollInterval. The references to environment variables are ignored.
+func (r *Resolver) Watch(ctx context.Context, refs []Reference) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	changed := make(chan Reference, len(refs))
+	var watching bool
+	for _, ref := range refs {
+		switch ref.Source {
+		case Consul:
+			go r.watchConsul(ctx, ref, changed)
+			watching = true
+		case Vault:
+			go r.watchVault(ctx, ref, changed)
+			watching = true
+		}
+	}
+	if !watching {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	select {
+	case ref := <-changed:
+		log.Printf("The value of %s has changed", ref)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Resolver) watchConsul(ctx context.Context, ref Reference, changed chan<- Reference) {
+	var value string
+	var index uint64
+	var initialized bool
+	for {
+		v, i, err := r.getConsul(ctx, ref.Key, index)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			log.Println(errors.Wrapf(err, "error watching %s", ref))
+			if !r.sleep(ctx) {
+				return
+			}
+			continue
+		case !initialized:
+			value, initialized = v, true
+		case v != value:
+			changed <- ref
+			return
+		}
+		// Reset the index if it goes backwards, as the Consul documentation
+		// recommends.
+		if i < index {
+			i = 0
+		}
+		index = i
+	}
+}
+
+func (r *Resolver) watchVault(ctx context.Context, ref Reference, changed chan<- Reference) {
+	var value string
+	var initialized bool
+	for {
+		v, err := r.getVault(ctx, ref)
+		switch {
+		case ctx.Err() != nil:
+			return
+		case err != nil:
+			log.Println(errors.Wrapf(err, "error watching %s", ref))
+		case !initialized:
+			value, initialized = v, true
+		case v != value:
+			changed <- ref
+			return
+		}
+		if !r.sleep(ctx) {
+			return
+		}
+	}
+}
+
+// sleep waits for the poll interval, it returns false if the context is done.
+func (r *Resolver) sleep(ctx context.Context) bool {
+	d := r.PollInterval
+	if d <= 0 {
+		d = DefaultPollInterval
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,263 @@
+package db
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql/database"
+)
+
+// Default values of the asynchronous writes.
+const (
+	DefaultBatchSize          = 100
+	DefaultBatchFlushInterval = 100 * time.Millisecond
+	DefaultBatchQueueSize     = 10000
+)
+
+// ErrBatchWriterClosed is returned when a record is written after closing the
+// batch writer.
+var ErrBatchWriterClosed = errors.New("batch writer is closed")
+
+// AsyncWritesConfig is the configuration of the asynchronous writes of the
+// issued certificates. The certificates are queued and stored in batches of
+// BatchSize records, or every FlushInterval if there are less. QueueSize is
+// the maximum number of queued certificates, if the queue is full the
+// requests wait. Queued certificates are lost if the CA crashes.
+type AsyncWritesConfig struct {
+	BatchSize     int    `json:"batchSize,omitempty"`
+	FlushInterval string `json:"flushInterval,omitempty"`
+	QueueSize     int    `json:"queueSize,omitempty"`
+}
+
+// Validate validates the asynchronous writes configuration.
+func (c *AsyncWritesConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.BatchSize < 0:
+		return errors.New("asyncWrites batchSize cannot be negative")
+	case c.QueueSize < 0:
+		return errors.New("asyncWrites queueSize cannot be negative")
+	}
+	if c.FlushInterval != "" {
+		d, err := time.ParseDuration(c.FlushInterval)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing asyncWrites flushInterval %s", c.FlushInterval)
+		}
+		if d <= 0 {
+			return errors.New("asyncWrites flushInterval must be greater than 0")
+		}
+	}
+	return nil
+}
+
+// GetBatchSize returns the maximum number of certificates stored at once.
+func (c *AsyncWritesConfig) GetBatchSize() int {
+	if c == nil || c.BatchSize == 0 {
+		return DefaultBatchSize
+	}
+	return c.BatchSize
+}
+
+// GetFlushInterval returns the maximum time a certificate is queued.
+func (c *AsyncWritesConfig) GetFlushInterval() time.Duration {
+	if c == nil || c.FlushInterval == "" {
+		return DefaultBatchFlushInterval
+	}
+	d, err := time.ParseDuration(c.FlushInterval)
+	if err != nil || d <= 0 {
+		return DefaultBatchFlushInterval
+	}
+	return d
+}
+
+// GetQueueSize returns the maximum number of queued certificates.
+func (c *AsyncWritesConfig) GetQueueSize() int {
+	if c == nil || c.QueueSize == 0 {
+		return DefaultBatchQueueSize
+	}
+	return c.QueueSize
+}
+
+// CertificateRecord is an issued certificate and its metadata.
+type CertificateRecord struct {
+	Certificate *x509.Certificate
+	Data        *CertificateData
+}
+
+// StoreCertificates stores the given certificates and their metadata in one
+// transaction, and then adds them to the indexes and the transparency log.
+func (db *DB) StoreCertificates(records []*CertificateRecord) error {
+	tx := new(database.Tx)
+	for _, r := range records {
+		sn := []byte(r.Certificate.SerialNumber.String())
+		tx.Set(certsTable, sn, r.Certificate.Raw)
+		if r.Data != nil {
+			b, err := json.Marshal(r.Data)
+			if err != nil {
+				return errors.Wrap(err, "error marshaling certificate data")
+			}
+			tx.Set(certsDataTable, sn, b)
+		}
+	}
+	if err := db.Update(tx); err != nil {
+		return errors.Wrap(err, "database Update error")
+	}
+	for _, r := range records {
+		if err := db.indexCertificate(r.Certificate); err != nil {
+			return err
+		}
+		if err := db.appendToLog(r.Certificate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BatchWriter stores the issued certificates asynchronously in batches. It
+// also aggregates the increments of the stats counters, so the concurrent
+// requests do not compete to update the same counter.
+type BatchWriter struct {
+	db       AuthDB
+	size     int
+	interval time.Duration
+	queue    chan *CertificateRecord
+	mu       sync.RWMutex
+	closed   bool
+	done     chan struct{}
+	statsMu  sync.Mutex
+	stats    map[statsKey]*statsCount
+}
+
+type statsKey struct {
+	day, provisioner, event string
+}
+
+type statsCount struct {
+	t time.Time
+	n int64
+}
+
+// NewBatchWriter returns a BatchWriter for the given database and starts it.
+func NewBatchWriter(c *AsyncWritesConfig, db AuthDB) *BatchWriter {
+	w := &BatchWriter{
+		db:       db,
+		size:     c.GetBatchSize(),
+		interval: c.GetFlushInterval(),
+		queue:    make(chan *CertificateRecord, c.GetQueueSize()),
+		done:     make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Write queues the given certificate. It waits if the queue is full, and it
+// returns ErrBatchWriterClosed if the writer is closed.
+func (w *BatchWriter) Write(r *CertificateRecord) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return ErrBatchWriterClosed
+	}
+	w.queue <- r
+	return nil
+}
+
+// IncrementStats adds one to the counter of the given event for the
+// provisioner in the day of the given time. The counters are stored with the
+// next batch of certificates. It returns ErrBatchWriterClosed if the writer is
+// closed.
+func (w *BatchWriter) IncrementStats(t time.Time, provisioner, event string) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return ErrBatchWriterClosed
+	}
+	key := statsKey{day: t.UTC().Format("2006-01-02"), provisioner: provisioner, event: event}
+	w.statsMu.Lock()
+	if w.stats == nil {
+		w.stats = make(map[statsKey]*statsCount)
+	}
+	if c, ok := w.stats[key]; ok {
+		c.n++
+	} else {
+		w.stats[key] = &statsCount{t: t, n: 1}
+	}
+	w.statsMu.Unlock()
+	return nil
+}
+
+// Close stores the queued certificates and stops the writer.
+func (w *BatchWriter) Close() {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+	<-w.done
+}
+
+func (w *BatchWriter) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	batch := make([]*CertificateRecord, 0, w.size)
+	for {
+		select {
+		case r, ok := <-w.queue:
+			if !ok {
+				w.flush(batch)
+				w.flushStats()
+				return
+			}
+			if batch = append(batch, r); len(batch) >= w.size {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+			w.flushStats()
+		}
+	}
+}
+
+// flush stores a batch of certificates, the errors are logged.
+func (w *BatchWriter) flush(batch []*CertificateRecord) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := w.db.StoreCertificates(batch); err != nil && err != ErrNotImplemented {
+		log.Printf("error storing %d certificates: %v", len(batch), err)
+	}
+}
+
+// flushStats stores the aggregated stats counters, the errors are logged.
+func (w *BatchWriter) flushStats() {
+	w.statsMu.Lock()
+	stats := w.stats
+	w.stats = nil
+	w.statsMu.Unlock()
+
+	adder, ok := w.db.(StatsAdder)
+	for key, c := range stats {
+		var err error
+		if ok {
+			err = adder.AddStats(c.t, key.provisioner, key.event, c.n)
+		} else {
+			for i := int64(0); i < c.n && err == nil; i++ {
+				err = w.db.IncrementStats(c.t, key.provisioner, key.event)
+			}
+		}
+		if err != nil && err != ErrNotImplemented {
+			log.Printf("error updating %s stats of provisioner %s: %v", key.event, key.provisioner, err)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func TestAsyncWritesConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   *AsyncWritesConfig
+		size     int
+		interval time.Duration
+		queue    int
+		err      string
+	}{
+		{"nil", nil, DefaultBatchSize, DefaultBatchFlushInterval, DefaultBatchQueueSize, ""},
+		{"ok", &AsyncWritesConfig{BatchSize: 10, FlushInterval: "1s", QueueSize: 100}, 10, time.Second, 100, ""},
+		{"fail-size", &AsyncWritesConfig{BatchSize: -1}, 0, 0, 0, "asyncWrites batchSize cannot be negative"},
+		{"fail-queue", &AsyncWritesConfig{QueueSize: -1}, 0, 0, 0, "asyncWrites queueSize cannot be negative"},
+		{"fail-interval", &AsyncWritesConfig{FlushInterval: "foo"}, 0, 0, 0, "error parsing asyncWrites flushInterval foo"},
+		{"fail-interval-zero", &AsyncWritesConfig{FlushInterval: "0s"}, 0, 0, 0, "asyncWrites flushInterval must be greater than 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.err != "" {
+				if assert.NotNil(t, err) {
+					assert.HasPrefix(t, err.Error(), tt.err)
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.size, tt.config.GetBatchSize())
+			assert.Equals(t, tt.interval, tt.config.GetFlushInterval())
+			assert.Equals(t, tt.queue, tt.config.GetQueueSize())
+		})
+	}
+}
+
+func TestDB_StoreCertificates(t *testing.T) {
+	adb, err := New(&Config{Type: MemoryType})
+	assert.FatalError(t, err)
+	records := []*CertificateRecord{
+		{Certificate: newIndexedCertificate(t, 1, "db.internal", "db.internal"), Data: &CertificateData{TokenID: "1"}},
+		{Certificate: newIndexedCertificate(t, 2, "db.internal", "db.internal")},
+	}
+	assert.FatalError(t, adb.StoreCertificates(records))
+
+	certs, err := adb.GetCertificatesBySAN("db.internal")
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"1", "2"}, serialNumbers(certs))
+	data, err := adb.GetCertificateData("1")
+	assert.FatalError(t, err)
+	assert.Equals(t, "1", data.TokenID)
+	data, err = adb.GetCertificateData("2")
+	assert.FatalError(t, err)
+	assert.Nil(t, data)
+}
+
+type batchRecorder struct {
+	SimpleDB
+	batches chan []*CertificateRecord
+}
+
+func (b *batchRecorder) StoreCertificates(records []*CertificateRecord) error {
+	batch := make([]*CertificateRecord, len(records))
+	copy(batch, records)
+	b.batches <- batch
+	return nil
+}
+
+func TestBatchWriter(t *testing.T) {
+	db := &batchRecorder{batches: make(chan []*CertificateRecord, 10)}
+	w := NewBatchWriter(&AsyncWritesConfig{BatchSize: 2, FlushInterval: "50ms"}, db)
+	r1 := &CertificateRecord{Certificate: newIndexedCertificate(t, 1, "db.internal")}
+	r2 := &CertificateRecord{Certificate: newIndexedCertificate(t, 2, "db.internal")}
+	r3 := &CertificateRecord{Certificate: newIndexedCertificate(t, 3, "db.internal")}
+
+	// Full batches are stored immediately.
+	assert.FatalError(t, w.Write(r1))
+	assert.FatalError(t, w.Write(r2))
+	select {
+	case batch := <-db.batches:
+		assert.Equals(t, []*CertificateRecord{r1, r2}, batch)
+	case <-time.After(40 * time.Millisecond):
+		t.Fatal("batch was not stored")
+	}
+
+	// Partial batches are stored after the flush interval.
+	assert.FatalError(t, w.Write(r3))
+	select {
+	case batch := <-db.batches:
+		assert.Equals(t, []*CertificateRecord{r3}, batch)
+	case <-time.After(time.Second):
+		t.Fatal("batch was not flushed")
+	}
+
+	// The queue is stored on close.
+	w = NewBatchWriter(&AsyncWritesConfig{BatchSize: 10, FlushInterval: "1h"}, db)
+	assert.FatalError(t, w.Write(r1))
+	w.Close()
+	w.Close()
+	assert.Equals(t, []*CertificateRecord{r1}, <-db.batches)
+	assert.Equals(t, ErrBatchWriterClosed, w.Write(r2))
+}
+
+func TestBatchWriter_IncrementStats(t *testing.T) {
+	adb, err := New(&Config{Type: MemoryType})
+	assert.FatalError(t, err)
+	now := time.Date(2019, 10, 1, 23, 0, 0, 0, time.FixedZone("PDT", -7*60*60))
+
+	w := NewBatchWriter(&AsyncWritesConfig{FlushInterval: "1h"}, adb)
+	for i := 0; i < 3; i++ {
+		assert.FatalError(t, w.IncrementStats(now, "step-cli", StatsIssued))
+	}
+	assert.FatalError(t, w.IncrementStats(now, "step-cli", StatsRenewed))
+	assert.FatalError(t, w.IncrementStats(now.Add(24*time.Hour), "step-cli", StatsIssued))
+
+	// The counters are stored on close.
+	stats, err := adb.GetStats()
+	assert.FatalError(t, err)
+	assert.Len(t, 0, stats)
+	w.Close()
+	assert.Equals(t, ErrBatchWriterClosed, w.IncrementStats(now, "step-cli", StatsIssued))
+
+	stats, err = adb.GetStats()
+	assert.FatalError(t, err)
+	counts := make(map[string]int64)
+	for _, e := range stats {
+		counts[e.Day+"/"+e.Event+"/"+e.Provisioner] = e.Count
+	}
+	assert.Equals(t, map[string]int64{
+		"2019-10-02/issued/step-cli":  3,
+		"2019-10-02/renewed/step-cli": 1,
+		"2019-10-03/issued/step-cli":  1,
+	}, counts)
+}
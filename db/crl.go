@@ -0,0 +1,102 @@
+package db
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql"
+)
+
+var (
+	crlTable      = []byte("x509_crl")
+	crlCurrentKey = []byte("current")
+)
+
+// CRLInfo is a certificate revocation list generated by the CA. Number is the
+// value of the CRL number extension, it increases with each new list.
+type CRLInfo struct {
+	Number     int64     `json:"number"`
+	ThisUpdate time.Time `json:"thisUpdate"`
+	NextUpdate time.Time `json:"nextUpdate"`
+	DER        []byte    `json:"der"`
+}
+
+// CRLStore is the interface implemented by the databases that keep the
+// latest CRL, so it is served right after a restart and by all the instances
+// sharing the database.
+type CRLStore interface {
+	GetRevokedCertificates() ([]*RevokedCertificateInfo, error)
+	GetCRL() (*CRLInfo, error)
+	StoreCRL(crl *CRLInfo) error
+}
+
+// GetRevokedCertificates returns the revocation information of all the
+// revoked certificates sorted by revocation time.
+func (db *DB) GetRevokedCertificates() ([]*RevokedCertificateInfo, error) {
+	entries, err := db.List(revokedCertsTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "database List error")
+	}
+	revoked := make([]*RevokedCertificateInfo, 0, len(entries))
+	for _, e := range entries {
+		rci := new(RevokedCertificateInfo)
+		if err := json.Unmarshal(e.Value, rci); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling revoked certificate info %s", string(e.Key))
+		}
+		revoked = append(revoked, rci)
+	}
+	sort.Slice(revoked, func(i, j int) bool {
+		return revoked[i].RevokedAt.Before(revoked[j].RevokedAt)
+	})
+	return revoked, nil
+}
+
+// GetCRL returns the latest CRL, or nil if none has been stored.
+func (db *DB) GetCRL() (*CRLInfo, error) {
+	crl, _, err := db.getCRL()
+	return crl, err
+}
+
+func (db *DB) getCRL() (*CRLInfo, []byte, error) {
+	b, err := db.Get(crlTable, crlCurrentKey)
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, nil, nil
+	case err != nil:
+		return nil, nil, errors.Wrap(err, "database Get error")
+	}
+	crl := new(CRLInfo)
+	if err := json.Unmarshal(b, crl); err != nil {
+		return nil, nil, errors.Wrap(err, "error unmarshaling crl")
+	}
+	return crl, b, nil
+}
+
+// StoreCRL replaces the latest CRL with the given one. It returns
+// ErrAlreadyExists if the stored CRL has the same or a greater number, e.g.
+// if another instance stored a CRL concurrently.
+func (db *DB) StoreCRL(crl *CRLInfo) error {
+	current, old, err := db.getCRL()
+	if err != nil {
+		return err
+	}
+	if current != nil && current.Number >= crl.Number {
+		return ErrAlreadyExists
+	}
+	b, err := json.Marshal(crl)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling crl")
+	}
+	stored, swapped, err := db.CmpAndSwap(crlTable, crlCurrentKey, old, b)
+	switch {
+	case err != nil:
+		return errors.Wrap(err, "error AuthDB CmpAndSwap")
+	case !swapped && !bytes.Equal(stored, b):
+		return ErrAlreadyExists
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,55 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func TestDB_CRL(t *testing.T) {
+	db := &DB{newMemoryNoSQLDB(), true}
+	assert.FatalError(t, db.CreateTable(revokedCertsTable))
+	assert.FatalError(t, db.CreateTable(journalTable))
+	assert.FatalError(t, db.CreateTable(crlTable))
+
+	crl, err := db.GetCRL()
+	assert.FatalError(t, err)
+	assert.Nil(t, crl)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	crl1 := &CRLInfo{Number: 1, ThisUpdate: now, NextUpdate: now.Add(time.Hour), DER: []byte("crl-1")}
+	assert.FatalError(t, db.StoreCRL(crl1))
+	crl, err = db.GetCRL()
+	assert.FatalError(t, err)
+	assert.Equals(t, crl1, crl)
+
+	// The number must increase.
+	assert.Equals(t, ErrAlreadyExists, db.StoreCRL(&CRLInfo{Number: 1, DER: []byte("other")}))
+	crl2 := &CRLInfo{Number: 2, ThisUpdate: now, NextUpdate: now.Add(time.Hour), DER: []byte("crl-2")}
+	assert.FatalError(t, db.StoreCRL(crl2))
+	crl, err = db.GetCRL()
+	assert.FatalError(t, err)
+	assert.Equals(t, crl2, crl)
+}
+
+func TestDB_GetRevokedCertificates(t *testing.T) {
+	db := &DB{newMemoryNoSQLDB(), true}
+	assert.FatalError(t, db.CreateTable(revokedCertsTable))
+	assert.FatalError(t, db.CreateTable(journalTable))
+
+	revoked, err := db.GetRevokedCertificates()
+	assert.FatalError(t, err)
+	assert.Len(t, 0, revoked)
+
+	now := time.Now().UTC()
+	assert.FatalError(t, db.Revoke(&RevokedCertificateInfo{Serial: "2", ReasonCode: 1, RevokedAt: now}))
+	assert.FatalError(t, db.Revoke(&RevokedCertificateInfo{Serial: "1", RevokedAt: now.Add(-time.Minute)}))
+	revoked, err = db.GetRevokedCertificates()
+	assert.FatalError(t, err)
+	if assert.Len(t, 2, revoked) {
+		assert.Equals(t, "1", revoked[0].Serial)
+		assert.Equals(t, "2", revoked[1].Serial)
+		assert.Equals(t, 1, revoked[1].ReasonCode)
+	}
+}
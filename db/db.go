@@ -3,6 +3,9 @@ package db
 import (
 	"crypto/x509"
 	"encoding/json"
+	"log"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -11,21 +14,52 @@ import (
 )
 
 var (
-	certsTable        = []byte("x509_certs")
-	revokedCertsTable = []byte("revoked_x509_certs")
-	usedOTTTable      = []byte("used_ott")
+	certsTable         = []byte("x509_certs")
+	certsDataTable     = []byte("x509_certs_data")
+	revokedCertsTable  = []byte("revoked_x509_certs")
+	usedOTTTable       = []byte("used_ott")
+	statsTable         = []byte("x509_stats")
+	certsSANIndexTable = []byte("x509_certs_san_index")
+	certsCNIndexTable  = []byte("x509_certs_cn_index")
 )
 
+// Certificate events counted in the stats table.
+const (
+	StatsIssued  = "issued"
+	StatsRenewed = "renewed"
+	StatsRevoked = "revoked"
+)
+
+// maxStatsRetries is the number of attempts to increment a stats counter
+// updated concurrently.
+const maxStatsRetries = 10
+
 // ErrAlreadyExists can be returned if the DB attempts to set a key that has
 // been previously set.
 var ErrAlreadyExists = errors.New("already exists")
 
+// ErrNotFound is returned if the DB does not have a value for the requested
+// key.
+var ErrNotFound = errors.New("not found")
+
 // Config represents the JSON attributes used for configuring a step-ca DB.
 type Config struct {
-	Type       string `json:"type"`
-	DataSource string `json:"dataSource"`
-	ValueDir   string `json:"valueDir,omitempty"`
-	Database   string `json:"database,omitempty"`
+	Type        string             `json:"type"`
+	DataSource  string             `json:"dataSource"`
+	ValueDir    string             `json:"valueDir,omitempty"`
+	Database    string             `json:"database,omitempty"`
+	Replay      *ReplayConfig      `json:"replay,omitempty"`
+	Retention   *RetentionConfig   `json:"retention,omitempty"`
+	Encryption  *EncryptionConfig  `json:"encryption,omitempty"`
+	HA          *HAConfig          `json:"ha,omitempty"`
+	AsyncWrites *AsyncWritesConfig `json:"asyncWrites,omitempty"`
+	Pool        *PoolConfig        `json:"pool,omitempty"`
+	ReadReplica *ReplicaConfig     `json:"readReplica,omitempty"`
+	// TablePrefix is added to the name of all the tables, so several
+	// authorities can share the same database.
+	TablePrefix string `json:"tablePrefix,omitempty"`
+	// SkipMigrations disables the automatic migration of the schema.
+	SkipMigrations bool `json:"skipMigrations,omitempty"`
 }
 
 // AuthDB is an interface over an Authority DB client that implements a nosql.DB interface.
@@ -33,7 +67,27 @@ type AuthDB interface {
 	IsRevoked(sn string) (bool, error)
 	Revoke(rci *RevokedCertificateInfo) error
 	StoreCertificate(crt *x509.Certificate) error
+	StoreCertificates(records []*CertificateRecord) error
+	GetCertificate(sn string) (*x509.Certificate, error)
+	GetCertificates() ([]*x509.Certificate, error)
+	GetCertificatesBySAN(san string) ([]*x509.Certificate, error)
+	GetCertificatesByCommonName(cn string) ([]*x509.Certificate, error)
+	RebuildIndexes() (int, error)
+	StoreCertificateData(sn string, data *CertificateData) error
+	GetCertificateData(sn string) (*CertificateData, error)
+	GetRevokedCertificateInfo(sn string) (*RevokedCertificateInfo, error)
+	IncrementStats(t time.Time, provisioner, event string) error
+	GetStats() ([]*StatsEntry, error)
+	GetJournal() ([]*JournalEntry, error)
+	GetLogEntries(start, end int64) ([]*LogEntry, error)
+	GetTreeHead() (*TreeHead, error)
+	GetInclusionProof(sn string, treeSize int64) (*InclusionProof, error)
 	UseToken(id, tok string) (bool, error)
+	IsTokenUsed(id string) (bool, error)
+	PruneCertificates(before time.Time) (*PruneResult, error)
+	PruneTokens(before time.Time) (*PruneResult, error)
+	Export() (*Snapshot, error)
+	Import(snap *Snapshot) error
 	Shutdown() error
 }
 
@@ -49,13 +103,35 @@ func New(c *Config) (AuthDB, error) {
 		return newSimpleDB(c)
 	}
 
-	db, err := nosql.New(c.Type, c.DataSource, nosql.WithDatabase(c.Database),
-		nosql.WithValueDir(c.ValueDir))
-	if err != nil {
-		return nil, errors.Wrapf(err, "Error opening database of Type %s with source %s", c.Type, c.DataSource)
+	if err := ValidateTablePrefix(c.TablePrefix); err != nil {
+		return nil, err
+	}
+
+	var db nosql.DB
+	if c.Type == MemoryType {
+		db = newMemoryDB()
+	} else {
+		var err error
+		db, err = nosql.New(c.Type, c.DataSource, nosql.WithDatabase(c.Database),
+			nosql.WithValueDir(c.ValueDir))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Error opening database of Type %s with source %s", c.Type, c.DataSource)
+		}
+	}
+	// Record the latency and the errors of the operations.
+	db = newInstrumentedDB(db)
+	// Limit, time out and retry the operations if configured.
+	if c.Pool != nil {
+		db = newPooledDB(db, c.Pool)
 	}
+	// Use the tables with the given prefix if configured.
+	db = newPrefixedDB(db, c.TablePrefix)
+	// Keep track of the tables to export them.
+	db = newSnapshotDB(db)
 
-	tables := [][]byte{revokedCertsTable, certsTable, usedOTTTable}
+	tables := [][]byte{revokedCertsTable, certsTable, certsDataTable, usedOTTTable, statsTable,
+		certsSANIndexTable, certsCNIndexTable, schemaTable, leasesTable, healthTable, journalTable,
+		transparencyLogTable, transparencyLogSNTable, expiryNotificationsTable, crlTable, inventoryTable}
 	for _, b := range tables {
 		if err := db.CreateTable(b); err != nil {
 			return nil, errors.Wrapf(err, "error creating table %s",
@@ -63,7 +139,46 @@ func New(c *Config) (AuthDB, error) {
 		}
 	}
 
-	return &DB{db, true}, nil
+	// Encrypt the values stored if configured.
+	if c.Encryption != nil {
+		edb, err := newEncryptedDB(db, c.Encryption)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		db = edb
+		n, err := edb.encryptTables(tables)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		if n > 0 {
+			log.Printf("encrypted %d database values stored without encryption", n)
+		}
+	}
+
+	// Migrate the schema to the current version.
+	authDB := &DB{db, true}
+	pending, err := authDB.Migrate(c.SkipMigrations)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if c.SkipMigrations && len(pending) > 0 {
+		log.Printf("database schema is %d migrations behind, run step-ca migrate", len(pending))
+	}
+
+	// Use an external store for the used tokens if configured.
+	if c.Replay != nil {
+		store, err := NewReplayStore(c.Replay)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		return &replayDB{DB: authDB, store: store}, nil
+	}
+
+	return &tokenCacheDB{DB: authDB, usedTokens: newUsedTokenCache(true)}, nil
 }
 
 // RevokedCertificateInfo contains information regarding the certificate
@@ -76,6 +191,36 @@ type RevokedCertificateInfo struct {
 	RevokedAt     time.Time
 	TokenID       string
 	MTLS          bool
+	RevokedBy     string `json:",omitempty"`
+}
+
+// CertificateData contains the issuance metadata of a certificate.
+// RenewedFrom is the serial number of the certificate renewed or rekeyed to
+// issue this one.
+type CertificateData struct {
+	Provisioner  *ProvisionerData `json:"provisioner,omitempty"`
+	TokenSubject string           `json:"tokenSubject,omitempty"`
+	TokenID      string           `json:"tokenID,omitempty"`
+	NotBefore    time.Time        `json:"notBefore"`
+	NotAfter     time.Time        `json:"notAfter"`
+	RenewedFrom  string           `json:"renewedFrom,omitempty"`
+}
+
+// ProvisionerData contains the information of the provisioner used to issue
+// a certificate.
+type ProvisionerData struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// StatsEntry is the number of certificate events of one type for a
+// provisioner in one day.
+type StatsEntry struct {
+	Day         string
+	Provisioner string
+	Event       string
+	Count       int64
 }
 
 // IsRevoked returns whether or not a certificate with the given identifier
@@ -114,19 +259,180 @@ func (db *DB) Revoke(rci *RevokedCertificateInfo) error {
 		return errors.Wrap(err, "error AuthDB CmpAndSwap")
 	case !swapped:
 		return ErrAlreadyExists
-	default:
-		return nil
 	}
+
+	// The revocation is stored, the journal keeps who made it.
+	return db.appendJournal(&JournalEntry{
+		Time:      rci.RevokedAt,
+		Actor:     rci.RevokedBy,
+		Operation: JournalRevoke,
+		Table:     string(revokedCertsTable),
+		Key:       rci.Serial,
+		Value:     rcib,
+	})
+}
+
+// GetRevokedCertificateInfo returns the revocation information of the
+// certificate with the given serial number, or nil if the certificate has not
+// been revoked.
+func (db *DB) GetRevokedCertificateInfo(sn string) (*RevokedCertificateInfo, error) {
+	b, err := db.Get(revokedCertsTable, []byte(sn))
+	if err != nil {
+		if nosql.IsErrNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "error checking revocation bucket")
+	}
+	rci := new(RevokedCertificateInfo)
+	if err := json.Unmarshal(b, rci); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling revoked certificate info")
+	}
+	return rci, nil
 }
 
-// StoreCertificate stores a certificate PEM.
+// StoreCertificate stores a certificate PEM, adds it to the common name and
+// subject alternative names indexes, and appends it to the transparency log.
 func (db *DB) StoreCertificate(crt *x509.Certificate) error {
 	if err := db.Set(certsTable, []byte(crt.SerialNumber.String()), crt.Raw); err != nil {
 		return errors.Wrap(err, "database Set error")
 	}
+	if err := db.indexCertificate(crt); err != nil {
+		return err
+	}
+	return db.appendToLog(crt)
+}
+
+// GetCertificate returns the certificate with the given serial number. It
+// returns ErrNotFound if the certificate is not in the database.
+func (db *DB) GetCertificate(sn string) (*x509.Certificate, error) {
+	b, err := db.Get(certsTable, []byte(sn))
+	if err != nil {
+		if nosql.IsErrNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, errors.Wrap(err, "database Get error")
+	}
+	crt, err := x509.ParseCertificate(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing certificate %s", sn)
+	}
+	return crt, nil
+}
+
+// GetCertificates returns all the certificates stored in the database.
+func (db *DB) GetCertificates() ([]*x509.Certificate, error) {
+	entries, err := db.List(certsTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "database List error")
+	}
+	certs := make([]*x509.Certificate, 0, len(entries))
+	for _, e := range entries {
+		crt, err := x509.ParseCertificate(e.Value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing certificate %s", string(e.Key))
+		}
+		certs = append(certs, crt)
+	}
+	return certs, nil
+}
+
+// StoreCertificateData stores the issuance metadata of the certificate with
+// the given serial number.
+func (db *DB) StoreCertificateData(sn string, data *CertificateData) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling certificate data")
+	}
+	if err := db.Set(certsDataTable, []byte(sn), b); err != nil {
+		return errors.Wrap(err, "database Set error")
+	}
 	return nil
 }
 
+// GetCertificateData returns the issuance metadata of the certificate with the
+// given serial number, or nil if the metadata has not been stored.
+func (db *DB) GetCertificateData(sn string) (*CertificateData, error) {
+	b, err := db.Get(certsDataTable, []byte(sn))
+	if err != nil {
+		if nosql.IsErrNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "database Get error")
+	}
+	data := new(CertificateData)
+	if err := json.Unmarshal(b, data); err != nil {
+		return nil, errors.Wrap(err, "error unmarshaling certificate data")
+	}
+	return data, nil
+}
+
+// StatsAdder is implemented by the databases that can add more than one to a
+// stats counter in a single update.
+type StatsAdder interface {
+	AddStats(t time.Time, provisioner, event string, n int64) error
+}
+
+// IncrementStats adds one to the counter of the given event for the provisioner
+// in the day of the given time, in UTC.
+func (db *DB) IncrementStats(t time.Time, provisioner, event string) error {
+	return db.AddStats(t, provisioner, event, 1)
+}
+
+// AddStats adds n to the counter of the given event for the provisioner in the
+// day of the given time, in UTC.
+func (db *DB) AddStats(t time.Time, provisioner, event string, n int64) error {
+	key := []byte(t.UTC().Format("2006-01-02") + "/" + event + "/" + provisioner)
+	for i := 0; i < maxStatsRetries; i++ {
+		var count int64
+		old, err := db.Get(statsTable, key)
+		switch {
+		case err == nil:
+			if count, err = strconv.ParseInt(string(old), 10, 64); err != nil {
+				return errors.Wrapf(err, "error parsing stats %s", string(key))
+			}
+		case nosql.IsErrNotFound(err):
+			old = nil
+		default:
+			return errors.Wrap(err, "database Get error")
+		}
+
+		_, swapped, err := db.CmpAndSwap(statsTable, key, old, []byte(strconv.FormatInt(count+n, 10)))
+		if err != nil {
+			return errors.Wrap(err, "error AuthDB CmpAndSwap")
+		}
+		if swapped {
+			return nil
+		}
+	}
+	return errors.Errorf("error incrementing stats %s: too many concurrent updates", string(key))
+}
+
+// GetStats returns all the stats counters stored in the database.
+func (db *DB) GetStats() ([]*StatsEntry, error) {
+	entries, err := db.List(statsTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "database List error")
+	}
+	stats := make([]*StatsEntry, 0, len(entries))
+	for _, e := range entries {
+		parts := strings.SplitN(string(e.Key), "/", 3)
+		if len(parts) != 3 {
+			return nil, errors.Errorf("error parsing stats key %s", string(e.Key))
+		}
+		count, err := strconv.ParseInt(string(e.Value), 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing stats %s", string(e.Key))
+		}
+		stats = append(stats, &StatsEntry{
+			Day:         parts[0],
+			Event:       parts[1],
+			Provisioner: parts[2],
+			Count:       count,
+		})
+	}
+	return stats, nil
+}
+
 // UseToken returns true if we were able to successfully store the token for
 // for the first time, false otherwise.
 func (db *DB) UseToken(id, tok string) (bool, error) {
@@ -138,6 +444,19 @@ func (db *DB) UseToken(id, tok string) (bool, error) {
 	return swapped, nil
 }
 
+// IsTokenUsed returns true if the token with the given id has already been
+// used. Unlike UseToken it does not store the token.
+func (db *DB) IsTokenUsed(id string) (bool, error) {
+	if _, err := db.Get(usedOTTTable, []byte(id)); err != nil {
+		if nosql.IsErrNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "error loading used token %s/%s",
+			string(usedOTTTable), id)
+	}
+	return true, nil
+}
+
 // Shutdown sends a shutdown message to the database.
 func (db *DB) Shutdown() error {
 	if db.isUp {
@@ -1,8 +1,17 @@
 package db
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
 	"errors"
+	"math/big"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/smallstep/assert"
 	"github.com/smallstep/nosql/database"
@@ -158,3 +167,391 @@ func TestUseToken(t *testing.T) {
 		})
 	}
 }
+
+func TestGetCertificates(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1234),
+		Subject:      pkix.Name{CommonName: "test.smallstep.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	assert.FatalError(t, err)
+
+	tests := map[string]struct {
+		db    *DB
+		count int
+		err   error
+	}{
+		"fail/force-List-error": {
+			db: &DB{&MockNoSQLDB{
+				MList: func(bucket []byte) ([]*database.Entry, error) {
+					return nil, errors.New("force")
+				},
+			}, true},
+			err: errors.New("database List error: force"),
+		},
+		"fail/parse-error": {
+			db: &DB{&MockNoSQLDB{
+				MList: func(bucket []byte) ([]*database.Entry, error) {
+					return []*database.Entry{
+						{Bucket: certsTable, Key: []byte("1234"), Value: []byte("foo")},
+					}, nil
+				},
+			}, true},
+			err: errors.New("error parsing certificate 1234"),
+		},
+		"ok/empty": {
+			db: &DB{&MockNoSQLDB{
+				MList: func(bucket []byte) ([]*database.Entry, error) {
+					return []*database.Entry{}, nil
+				},
+			}, true},
+		},
+		"ok": {
+			db: &DB{&MockNoSQLDB{
+				MList: func(bucket []byte) ([]*database.Entry, error) {
+					assert.Equals(t, certsTable, bucket)
+					return []*database.Entry{
+						{Bucket: certsTable, Key: []byte("1234"), Value: der},
+					}, nil
+				},
+			}, true},
+			count: 1,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			certs, err := tc.db.GetCertificates()
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			if assert.Nil(t, tc.err) && assert.Len(t, tc.count, certs) && tc.count > 0 {
+				assert.Equals(t, der, certs[0].Raw)
+			}
+		})
+	}
+}
+
+func TestGetCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1234),
+		Subject:      pkix.Name{CommonName: "test.smallstep.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	assert.FatalError(t, err)
+
+	tests := map[string]struct {
+		db  *DB
+		err error
+	}{
+		"fail/not-found": {
+			db:  &DB{&MockNoSQLDB{Err: database.ErrNotFound}, true},
+			err: ErrNotFound,
+		},
+		"fail/force-Get-error": {
+			db:  &DB{&MockNoSQLDB{Err: errors.New("force")}, true},
+			err: errors.New("database Get error: force"),
+		},
+		"fail/parse-error": {
+			db:  &DB{&MockNoSQLDB{Ret1: []byte("foo")}, true},
+			err: errors.New("error parsing certificate 1234"),
+		},
+		"ok": {
+			db: &DB{&MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					assert.Equals(t, certsTable, bucket)
+					assert.Equals(t, []byte("1234"), key)
+					return der, nil
+				},
+			}, true},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			crt, err := tc.db.GetCertificate("1234")
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			if assert.Nil(t, tc.err) {
+				assert.Equals(t, der, crt.Raw)
+			}
+		})
+	}
+}
+
+func TestCertificateData(t *testing.T) {
+	data := &CertificateData{
+		Provisioner:  &ProvisionerData{ID: "id", Name: "step-cli", Type: "JWK"},
+		TokenSubject: "test.smallstep.com",
+		TokenID:      "token-id",
+	}
+	b, err := json.Marshal(data)
+	assert.FatalError(t, err)
+
+	t.Run("store", func(t *testing.T) {
+		db := &DB{&MockNoSQLDB{
+			MSet: func(bucket, key, value []byte) error {
+				assert.Equals(t, certsDataTable, bucket)
+				assert.Equals(t, []byte("1234"), key)
+				assert.Equals(t, b, value)
+				return nil
+			},
+		}, true}
+		assert.FatalError(t, db.StoreCertificateData("1234", data))
+
+		db = &DB{&MockNoSQLDB{Err: errors.New("force")}, true}
+		err := db.StoreCertificateData("1234", data)
+		if assert.NotNil(t, err) {
+			assert.HasPrefix(t, err.Error(), "database Set error: force")
+		}
+	})
+
+	tests := map[string]struct {
+		db   *DB
+		want *CertificateData
+		err  error
+	}{
+		"ok/not-found": {
+			db: &DB{&MockNoSQLDB{Err: database.ErrNotFound}, true},
+		},
+		"fail/force-Get-error": {
+			db:  &DB{&MockNoSQLDB{Err: errors.New("force")}, true},
+			err: errors.New("database Get error: force"),
+		},
+		"fail/unmarshal-error": {
+			db:  &DB{&MockNoSQLDB{Ret1: []byte("foo")}, true},
+			err: errors.New("error unmarshaling certificate data"),
+		},
+		"ok": {
+			db: &DB{&MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					assert.Equals(t, certsDataTable, bucket)
+					assert.Equals(t, []byte("1234"), key)
+					return b, nil
+				},
+			}, true},
+			want: data,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := tc.db.GetCertificateData("1234")
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			if assert.Nil(t, tc.err) {
+				assert.Equals(t, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestGetRevokedCertificateInfo(t *testing.T) {
+	rci := &RevokedCertificateInfo{
+		Serial:        "1234",
+		ProvisionerID: "id",
+		ReasonCode:    1,
+		Reason:        "key compromise",
+		RevokedAt:     time.Now().UTC().Truncate(time.Second),
+	}
+	b, err := json.Marshal(rci)
+	assert.FatalError(t, err)
+
+	tests := map[string]struct {
+		db   *DB
+		want *RevokedCertificateInfo
+		err  error
+	}{
+		"ok/not-revoked": {
+			db: &DB{&MockNoSQLDB{Err: database.ErrNotFound}, true},
+		},
+		"fail/force-Get-error": {
+			db:  &DB{&MockNoSQLDB{Err: errors.New("force")}, true},
+			err: errors.New("error checking revocation bucket: force"),
+		},
+		"fail/unmarshal-error": {
+			db:  &DB{&MockNoSQLDB{Ret1: []byte("foo")}, true},
+			err: errors.New("error unmarshaling revoked certificate info"),
+		},
+		"ok": {
+			db: &DB{&MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					assert.Equals(t, revokedCertsTable, bucket)
+					assert.Equals(t, []byte("1234"), key)
+					return b, nil
+				},
+			}, true},
+			want: rci,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := tc.db.GetRevokedCertificateInfo("1234")
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			if assert.Nil(t, tc.err) {
+				assert.Equals(t, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestIncrementStats(t *testing.T) {
+	now := time.Date(2019, 10, 1, 23, 0, 0, 0, time.FixedZone("PDT", -7*60*60))
+	key := []byte("2019-10-02/issued/step-cli")
+
+	tests := map[string]struct {
+		db  *DB
+		err error
+	}{
+		"fail/force-Get-error": {
+			db:  &DB{&MockNoSQLDB{Err: errors.New("force")}, true},
+			err: errors.New("database Get error: force"),
+		},
+		"fail/parse-error": {
+			db:  &DB{&MockNoSQLDB{Ret1: []byte("foo")}, true},
+			err: errors.New("error parsing stats 2019-10-02/issued/step-cli"),
+		},
+		"fail/force-CmpAndSwap-error": {
+			db: &DB{&MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					return nil, database.ErrNotFound
+				},
+				MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+					return nil, false, errors.New("force")
+				},
+			}, true},
+			err: errors.New("error AuthDB CmpAndSwap: force"),
+		},
+		"fail/too-many-retries": {
+			db: &DB{&MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					return []byte("1"), nil
+				},
+				MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+					return []byte("2"), false, nil
+				},
+			}, true},
+			err: errors.New("error incrementing stats 2019-10-02/issued/step-cli: too many concurrent updates"),
+		},
+		"ok/first": {
+			db: &DB{&MockNoSQLDB{
+				MGet: func(bucket, k []byte) ([]byte, error) {
+					assert.Equals(t, statsTable, bucket)
+					assert.Equals(t, key, k)
+					return nil, database.ErrNotFound
+				},
+				MCmpAndSwap: func(bucket, k, old, newval []byte) ([]byte, bool, error) {
+					assert.Equals(t, statsTable, bucket)
+					assert.Equals(t, key, k)
+					assert.Nil(t, old)
+					assert.Equals(t, []byte("1"), newval)
+					return newval, true, nil
+				},
+			}, true},
+		},
+		"ok/retry": {
+			db: func() *DB {
+				count := 4
+				return &DB{&MockNoSQLDB{
+					MGet: func(bucket, k []byte) ([]byte, error) {
+						return []byte(strconv.Itoa(count)), nil
+					},
+					MCmpAndSwap: func(bucket, k, old, newval []byte) ([]byte, bool, error) {
+						if count == 4 {
+							count = 5
+							return []byte("5"), false, nil
+						}
+						assert.Equals(t, []byte("5"), old)
+						assert.Equals(t, []byte("6"), newval)
+						return newval, true, nil
+					},
+				}, true}
+			}(),
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.db.IncrementStats(now, "step-cli", StatsIssued)
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			assert.Nil(t, tc.err)
+		})
+	}
+}
+
+func TestGetStats(t *testing.T) {
+	tests := map[string]struct {
+		entries []*database.Entry
+		listErr error
+		want    []*StatsEntry
+		err     error
+	}{
+		"fail/force-List-error": {
+			listErr: errors.New("force"),
+			err:     errors.New("database List error: force"),
+		},
+		"fail/key-error": {
+			entries: []*database.Entry{{Key: []byte("foo"), Value: []byte("1")}},
+			err:     errors.New("error parsing stats key foo"),
+		},
+		"fail/value-error": {
+			entries: []*database.Entry{{Key: []byte("2019-10-02/issued/step-cli"), Value: []byte("foo")}},
+			err:     errors.New("error parsing stats 2019-10-02/issued/step-cli"),
+		},
+		"ok": {
+			entries: []*database.Entry{
+				{Key: []byte("2019-10-02/issued/step-cli"), Value: []byte("3")},
+				{Key: []byte("2019-10-02/revoked/acme/prov"), Value: []byte("1")},
+			},
+			want: []*StatsEntry{
+				{Day: "2019-10-02", Event: StatsIssued, Provisioner: "step-cli", Count: 3},
+				{Day: "2019-10-02", Event: StatsRevoked, Provisioner: "acme/prov", Count: 1},
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			db := &DB{&MockNoSQLDB{
+				MList: func(bucket []byte) ([]*database.Entry, error) {
+					assert.Equals(t, statsTable, bucket)
+					return tc.entries, tc.listErr
+				},
+			}, true}
+			got, err := db.GetStats()
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			if assert.Nil(t, tc.err) {
+				assert.Equals(t, tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package db
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os/exec"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql"
+	"github.com/smallstep/nosql/database"
+)
+
+// encryptionKeySize is the size of the AES-256 key used to encrypt the values.
+const encryptionKeySize = 32
+
+// encryptedPrefix is the prefix of the encrypted values. The values without
+// it were stored before the encryption was enabled, they are encrypted by
+// encryptTables when the database is opened.
+var encryptedPrefix = []byte("\x00step-enc1")
+
+// EncryptionConfig is the configuration of the encryption at rest of the
+// database values. The 32 bytes AES-256 key, raw or encoded in hexadecimal or
+// base64, is read from a file, or from the standard output of a command, e.g.
+// a KMS client that decrypts a data key.
+type EncryptionConfig struct {
+	KeyFile    string   `json:"keyFile,omitempty"`
+	KeyCommand []string `json:"keyCommand,omitempty"`
+}
+
+// Validate validates the encryption configuration.
+func (c *EncryptionConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.KeyFile == "" && len(c.KeyCommand) == 0:
+		return errors.New("encryption requires a keyFile or a keyCommand")
+	case c.KeyFile != "" && len(c.KeyCommand) != 0:
+		return errors.New("encryption keyFile and keyCommand are mutually exclusive")
+	default:
+		return nil
+	}
+}
+
+// loadKey returns the encryption key.
+func (c *EncryptionConfig) loadKey() ([]byte, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	var b []byte
+	var err error
+	if c.KeyFile != "" {
+		if b, err = ioutil.ReadFile(c.KeyFile); err != nil {
+			return nil, errors.Wrapf(err, "error reading encryption key %s", c.KeyFile)
+		}
+	} else {
+		cmd := exec.Command(c.KeyCommand[0], c.KeyCommand[1:]...)
+		if b, err = cmd.Output(); err != nil {
+			return nil, errors.Wrapf(err, "error running encryption key command %s", c.KeyCommand[0])
+		}
+	}
+	return parseEncryptionKey(b)
+}
+
+// parseEncryptionKey returns the key in b, a raw key or a key encoded in
+// hexadecimal or base64.
+func parseEncryptionKey(b []byte) ([]byte, error) {
+	s := string(bytes.TrimSpace(b))
+	if key, err := hex.DecodeString(s); err == nil && len(key) == encryptionKeySize {
+		return key, nil
+	}
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if key, err := enc.DecodeString(s); err == nil && len(key) == encryptionKeySize {
+			return key, nil
+		}
+	}
+	if len(b) == encryptionKeySize {
+		return b, nil
+	}
+	return nil, errors.Errorf("encryption key must be %d bytes", encryptionKeySize)
+}
+
+// encryptedDB is a nosql.DB that encrypts the values using AES-GCM. The keys
+// are not encrypted, and the bucket and the key are authenticated with the
+// value, so values cannot be moved to a different key.
+type encryptedDB struct {
+	nosql.DB
+	aead cipher.AEAD
+}
+
+func newEncryptedDB(db nosql.DB, c *EncryptionConfig) (*encryptedDB, error) {
+	key, err := c.loadKey()
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating encryption cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating encryption cipher")
+	}
+	return &encryptedDB{DB: db, aead: aead}, nil
+}
+
+func additionalData(bucket, key []byte) []byte {
+	ad := make([]byte, 0, len(bucket)+len(key)+1)
+	ad = append(ad, bucket...)
+	ad = append(ad, '/')
+	return append(ad, key...)
+}
+
+func (e *encryptedDB) encrypt(bucket, key, value []byte) ([]byte, error) {
+	nonceSize := e.aead.NonceSize()
+	out := make([]byte, len(encryptedPrefix)+nonceSize, len(encryptedPrefix)+nonceSize+len(value)+e.aead.Overhead())
+	copy(out, encryptedPrefix)
+	nonce := out[len(encryptedPrefix):]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, errors.Wrap(err, "error generating encryption nonce")
+	}
+	return e.aead.Seal(out, nonce, value, additionalData(bucket, key)), nil
+}
+
+func (e *encryptedDB) decrypt(bucket, key, value []byte) ([]byte, error) {
+	// Values stored before enabling the encryption, or by an instance of the
+	// CA without encryption, are read as is.
+	if !bytes.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	b := value[len(encryptedPrefix):]
+	nonceSize := e.aead.NonceSize()
+	if len(b) < nonceSize {
+		return nil, errors.Errorf("error decrypting %s/%s: invalid value", string(bucket), string(key))
+	}
+	plain, err := e.aead.Open(nil, b[:nonceSize], b[nonceSize:], additionalData(bucket, key))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error decrypting %s/%s", string(bucket), string(key))
+	}
+	return plain, nil
+}
+
+// encryptTables encrypts the values of the given tables stored before the
+// encryption was enabled, and returns the number of values encrypted. Each
+// value is swapped with its encrypted version, so the values modified at the
+// same time by other instances of the CA are skipped.
+func (e *encryptedDB) encryptTables(tables [][]byte) (int, error) {
+	var n int
+	for _, bucket := range tables {
+		entries, err := e.DB.List(bucket)
+		if err != nil {
+			if nosql.IsErrNotFound(err) {
+				continue
+			}
+			return n, errors.Wrapf(err, "error listing table %s", string(bucket))
+		}
+		for _, entry := range entries {
+			if bytes.HasPrefix(entry.Value, encryptedPrefix) {
+				continue
+			}
+			b, err := e.encrypt(bucket, entry.Key, entry.Value)
+			if err != nil {
+				return n, err
+			}
+			_, swapped, err := e.DB.CmpAndSwap(bucket, entry.Key, entry.Value, b)
+			if err != nil {
+				return n, errors.Wrapf(err, "error encrypting %s/%s", string(bucket), string(entry.Key))
+			}
+			if swapped {
+				n++
+			}
+		}
+	}
+	return n, nil
+}
+
+// Get returns the decrypted value of the given bucket and key.
+func (e *encryptedDB) Get(bucket, key []byte) ([]byte, error) {
+	b, err := e.DB.Get(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	return e.decrypt(bucket, key, b)
+}
+
+// Set encrypts and stores the value of the given bucket and key.
+func (e *encryptedDB) Set(bucket, key, value []byte) error {
+	b, err := e.encrypt(bucket, key, value)
+	if err != nil {
+		return err
+	}
+	return e.DB.Set(bucket, key, b)
+}
+
+// CmpAndSwap compares the decrypted current value with oldValue and, if they
+// are equal, stores the encrypted newValue. The encryption is not
+// deterministic, so the stored value is compared and swapped instead of
+// oldValue.
+func (e *encryptedDB) CmpAndSwap(bucket, key, oldValue, newValue []byte) ([]byte, bool, error) {
+	var current []byte
+	if oldValue != nil {
+		b, err := e.DB.Get(bucket, key)
+		switch {
+		case nosql.IsErrNotFound(err):
+			return nil, false, nil
+		case err != nil:
+			return nil, false, err
+		}
+		plain, err := e.decrypt(bucket, key, b)
+		if err != nil {
+			return nil, false, err
+		}
+		if !bytes.Equal(plain, oldValue) {
+			return plain, false, nil
+		}
+		current = b
+	}
+
+	b, err := e.encrypt(bucket, key, newValue)
+	if err != nil {
+		return nil, false, err
+	}
+	ret, swapped, err := e.DB.CmpAndSwap(bucket, key, current, b)
+	if err != nil || ret == nil {
+		return nil, swapped, err
+	}
+	if swapped {
+		return newValue, true, nil
+	}
+	plain, err := e.decrypt(bucket, key, ret)
+	if err != nil {
+		return nil, false, err
+	}
+	return plain, false, nil
+}
+
+// List returns the decrypted entries of the given bucket.
+func (e *encryptedDB) List(bucket []byte) ([]*database.Entry, error) {
+	entries, err := e.DB.List(bucket)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.Value, err = e.decrypt(entry.Bucket, entry.Key, entry.Value); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// Update encrypts the values of the operations of the transaction and
+// decrypts the results. Compare operations are not supported.
+func (e *encryptedDB) Update(tx *database.Tx) error {
+	etx := &database.Tx{Operations: make([]*database.TxEntry, len(tx.Operations))}
+	for i, op := range tx.Operations {
+		eop := *op
+		switch op.Cmd {
+		case database.Set:
+			b, err := e.encrypt(op.Bucket, op.Key, op.Value)
+			if err != nil {
+				return err
+			}
+			eop.Value = b
+		case database.CmpAndSwap, database.CmpOrRollback:
+			return errors.Wrapf(database.ErrOpNotSupported,
+				"error updating %s/%s: compare operations are not supported with encryption", string(op.Bucket), string(op.Key))
+		}
+		etx.Operations[i] = &eop
+	}
+	if err := e.DB.Update(etx); err != nil {
+		return err
+	}
+	for i, op := range tx.Operations {
+		eop := etx.Operations[i]
+		op.Swapped = eop.Swapped
+		op.Result = eop.Result
+		if op.Cmd == database.Get && eop.Result != nil {
+			b, err := e.decrypt(op.Bucket, op.Key, eop.Result)
+			if err != nil {
+				return err
+			}
+			op.Result = b
+		} else if op.Cmd == database.Set {
+			op.Result = op.Value
+		}
+	}
+	return nil
+}
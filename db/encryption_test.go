@@ -0,0 +1,259 @@
+package db
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"github.com/smallstep/nosql"
+	"github.com/smallstep/nosql/database"
+)
+
+var testEncryptionKey = bytes.Repeat([]byte{0x42}, encryptionKeySize)
+
+func newTestEncryptedDB(t *testing.T) (*encryptedDB, *MockNoSQLDB) {
+	dir, err := ioutil.TempDir("", "encryption")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+	keyFile := filepath.Join(dir, "key")
+	assert.FatalError(t, ioutil.WriteFile(keyFile, []byte(hex.EncodeToString(testEncryptionKey)+"\n"), 0600))
+
+	mem := newMemoryNoSQLDB()
+	edb, err := newEncryptedDB(mem, &EncryptionConfig{KeyFile: keyFile})
+	assert.FatalError(t, err)
+	return edb, mem
+}
+
+func TestEncryptionConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *EncryptionConfig
+		err    string
+	}{
+		{"nil", nil, ""},
+		{"keyFile", &EncryptionConfig{KeyFile: "key"}, ""},
+		{"keyCommand", &EncryptionConfig{KeyCommand: []string{"echo"}}, ""},
+		{"fail-empty", &EncryptionConfig{}, "encryption requires a keyFile or a keyCommand"},
+		{"fail-both", &EncryptionConfig{KeyFile: "key", KeyCommand: []string{"echo"}}, "encryption keyFile and keyCommand are mutually exclusive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.err != "" {
+				if assert.NotNil(t, err) {
+					assert.Equals(t, tt.err, err.Error())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+		})
+	}
+}
+
+func TestParseEncryptionKey(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+		err  bool
+	}{
+		{"raw", testEncryptionKey, false},
+		{"hex", []byte(hex.EncodeToString(testEncryptionKey) + "\n"), false},
+		{"base64", []byte(base64.StdEncoding.EncodeToString(testEncryptionKey) + "\n"), false},
+		{"base64url", []byte(base64.RawURLEncoding.EncodeToString(testEncryptionKey)), false},
+		{"fail-short", []byte(hex.EncodeToString(testEncryptionKey[:8])), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := parseEncryptionKey(tt.b)
+			if tt.err {
+				if assert.NotNil(t, err) {
+					assert.Equals(t, "encryption key must be 32 bytes", err.Error())
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, testEncryptionKey, key)
+		})
+	}
+}
+
+func TestEncryptionConfig_loadKey(t *testing.T) {
+	key, err := (&EncryptionConfig{KeyCommand: []string{"echo", hex.EncodeToString(testEncryptionKey)}}).loadKey()
+	assert.FatalError(t, err)
+	assert.Equals(t, testEncryptionKey, key)
+
+	_, err = (&EncryptionConfig{KeyFile: "testdata/missing.key"}).loadKey()
+	if assert.NotNil(t, err) {
+		assert.HasPrefix(t, err.Error(), "error reading encryption key testdata/missing.key")
+	}
+}
+
+func TestEncryptedDB(t *testing.T) {
+	edb, mem := newTestEncryptedDB(t)
+	bucket, key, value := []byte("x509_certs"), []byte("1"), []byte("certificate")
+
+	// Values are encrypted at rest.
+	assert.FatalError(t, edb.Set(bucket, key, value))
+	raw, err := mem.Get(bucket, key)
+	assert.FatalError(t, err)
+	assert.True(t, bytes.HasPrefix(raw, encryptedPrefix))
+	assert.False(t, bytes.Contains(raw, value))
+	got, err := edb.Get(bucket, key)
+	assert.FatalError(t, err)
+	assert.Equals(t, value, got)
+
+	// Values cannot be moved to other keys.
+	assert.FatalError(t, mem.Set(bucket, []byte("2"), raw))
+	_, err = edb.Get(bucket, []byte("2"))
+	if assert.NotNil(t, err) {
+		assert.HasPrefix(t, err.Error(), "error decrypting x509_certs/2")
+	}
+	assert.FatalError(t, mem.Del(bucket, []byte("2")))
+
+	// Values stored before enabling the encryption are read as is.
+	assert.FatalError(t, mem.Set(bucket, []byte("3"), []byte("legacy")))
+	got, err = edb.Get(bucket, []byte("3"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("legacy"), got)
+
+	entries, err := edb.List(bucket)
+	assert.FatalError(t, err)
+	values := map[string]string{}
+	for _, e := range entries {
+		values[string(e.Key)] = string(e.Value)
+	}
+	assert.Equals(t, map[string]string{"1": "certificate", "3": "legacy"}, values)
+
+	_, err = edb.Get(bucket, []byte("missing"))
+	assert.True(t, nosql.IsErrNotFound(err))
+}
+
+func TestEncryptedDB_CmpAndSwap(t *testing.T) {
+	edb, mem := newTestEncryptedDB(t)
+	bucket, key := []byte("x509_stats"), []byte("counter")
+
+	ret, swapped, err := edb.CmpAndSwap(bucket, key, nil, []byte("1"))
+	assert.FatalError(t, err)
+	assert.True(t, swapped)
+	assert.Equals(t, []byte("1"), ret)
+
+	// Already exists.
+	ret, swapped, err = edb.CmpAndSwap(bucket, key, nil, []byte("1"))
+	assert.FatalError(t, err)
+	assert.False(t, swapped)
+	assert.Equals(t, []byte("1"), ret)
+
+	// Different current value.
+	ret, swapped, err = edb.CmpAndSwap(bucket, key, []byte("5"), []byte("6"))
+	assert.FatalError(t, err)
+	assert.False(t, swapped)
+	assert.Equals(t, []byte("1"), ret)
+
+	ret, swapped, err = edb.CmpAndSwap(bucket, key, []byte("1"), []byte("2"))
+	assert.FatalError(t, err)
+	assert.True(t, swapped)
+	assert.Equals(t, []byte("2"), ret)
+	got, err := edb.Get(bucket, key)
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("2"), got)
+
+	// Legacy plaintext values.
+	assert.FatalError(t, mem.Set(bucket, []byte("legacy"), []byte("7")))
+	_, swapped, err = edb.CmpAndSwap(bucket, []byte("legacy"), []byte("7"), []byte("8"))
+	assert.FatalError(t, err)
+	assert.True(t, swapped)
+	raw, err := mem.Get(bucket, []byte("legacy"))
+	assert.FatalError(t, err)
+	assert.True(t, bytes.HasPrefix(raw, encryptedPrefix))
+
+	// Missing value.
+	ret, swapped, err = edb.CmpAndSwap(bucket, []byte("missing"), []byte("1"), []byte("2"))
+	assert.FatalError(t, err)
+	assert.False(t, swapped)
+	assert.Nil(t, ret)
+}
+
+func TestEncryptedDB_encryptTables(t *testing.T) {
+	edb, mem := newTestEncryptedDB(t)
+	certs, stats := []byte("x509_certs"), []byte("x509_stats")
+	assert.FatalError(t, mem.Set(certs, []byte("1"), []byte("legacy")))
+	assert.FatalError(t, edb.Set(certs, []byte("2"), []byte("encrypted")))
+	assert.FatalError(t, mem.Set(stats, []byte("1"), []byte("10")))
+
+	// The values without encryption are encrypted, the tables that do not
+	// exist are skipped.
+	n, err := edb.encryptTables([][]byte{certs, stats, []byte("missing")})
+	assert.FatalError(t, err)
+	assert.Equals(t, 2, n)
+	for bucket, want := range map[string]string{"x509_certs": "legacy", "x509_stats": "10"} {
+		raw, err := mem.Get([]byte(bucket), []byte("1"))
+		assert.FatalError(t, err)
+		assert.True(t, bytes.HasPrefix(raw, encryptedPrefix))
+		got, err := edb.Get([]byte(bucket), []byte("1"))
+		assert.FatalError(t, err)
+		assert.Equals(t, []byte(want), got)
+	}
+	got, err := edb.Get(certs, []byte("2"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("encrypted"), got)
+
+	n, err = edb.encryptTables([][]byte{certs, stats})
+	assert.FatalError(t, err)
+	assert.Equals(t, 0, n)
+}
+
+func TestEncryptedDB_Update(t *testing.T) {
+	mem := newMemoryNoSQLDB()
+	mem.MUpdate = func(tx *database.Tx) error {
+		for _, op := range tx.Operations {
+			var err error
+			switch op.Cmd {
+			case database.Get:
+				op.Result, err = mem.Get(op.Bucket, op.Key)
+			case database.Set:
+				err = mem.Set(op.Bucket, op.Key, op.Value)
+			case database.Delete:
+				err = mem.Del(op.Bucket, op.Key)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	edb, _ := newTestEncryptedDB(t)
+	edb.DB = mem
+	bucket := []byte("nonces")
+
+	tx := &database.Tx{Operations: []*database.TxEntry{
+		{Bucket: bucket, Key: []byte("a"), Value: []byte("1"), Cmd: database.Set},
+	}}
+	assert.FatalError(t, edb.Update(tx))
+	raw, err := mem.Get(bucket, []byte("a"))
+	assert.FatalError(t, err)
+	assert.True(t, bytes.HasPrefix(raw, encryptedPrefix))
+
+	tx = &database.Tx{Operations: []*database.TxEntry{
+		{Bucket: bucket, Key: []byte("a"), Cmd: database.Get},
+		{Bucket: bucket, Key: []byte("a"), Cmd: database.Delete},
+	}}
+	assert.FatalError(t, edb.Update(tx))
+	assert.Equals(t, []byte("1"), tx.Operations[0].Result)
+	_, err = mem.Get(bucket, []byte("a"))
+	assert.True(t, nosql.IsErrNotFound(err))
+
+	tx = &database.Tx{Operations: []*database.TxEntry{
+		{Bucket: bucket, Key: []byte("a"), CmpValue: []byte("1"), Value: []byte("2"), Cmd: database.CmpAndSwap},
+	}}
+	err = edb.Update(tx)
+	if assert.NotNil(t, err) {
+		assert.Equals(t, database.ErrOpNotSupported, errors.Cause(err))
+		assert.HasPrefix(t, err.Error(), "error updating nonces/a: compare operations are not supported with encryption")
+	}
+}
@@ -0,0 +1,39 @@
+package db
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/pkg/errors"
+)
+
+var healthTable = []byte("health")
+
+// HealthChecker is the interface implemented by the databases that can probe
+// their backend.
+type HealthChecker interface {
+	CheckHealth() error
+}
+
+// CheckHealth writes, reads back and deletes a random value, so it fails if
+// the backend cannot be reached or it does not accept writes.
+func (db *DB) CheckHealth() error {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return errors.Wrap(err, "error generating health probe")
+	}
+	key := []byte(hex.EncodeToString(b))
+	if err := db.Set(healthTable, key, b); err != nil {
+		return errors.Wrap(err, "error writing health probe")
+	}
+	defer db.Del(healthTable, key)
+	v, err := db.Get(healthTable, key)
+	if err != nil {
+		return errors.Wrap(err, "error reading health probe")
+	}
+	if !bytes.Equal(v, b) {
+		return errors.New("health probe does not match the value written")
+	}
+	return nil
+}
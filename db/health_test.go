@@ -0,0 +1,48 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+func TestDB_CheckHealth(t *testing.T) {
+	db := &DB{newMemoryDB(), true}
+	assert.FatalError(t, db.CreateTable(healthTable))
+	assert.NoError(t, db.CheckHealth())
+	// The probe is deleted.
+	entries, err := db.List(healthTable)
+	assert.FatalError(t, err)
+	assert.Len(t, 0, entries)
+
+	// Encrypted values are compared in plaintext.
+	edb, _ := newTestEncryptedDB(t)
+	assert.NoError(t, (&DB{edb, true}).CheckHealth())
+
+	db = &DB{&MockNoSQLDB{
+		MSet: func(bucket, key, value []byte) error {
+			return errors.New("force")
+		},
+	}, true}
+	err = db.CheckHealth()
+	if assert.NotNil(t, err) {
+		assert.Equals(t, "error writing health probe: force", err.Error())
+	}
+
+	db = &DB{&MockNoSQLDB{
+		MSet: func(bucket, key, value []byte) error {
+			return nil
+		},
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			return []byte("foo"), nil
+		},
+		MDel: func(bucket, key []byte) error {
+			return nil
+		},
+	}, true}
+	err = db.CheckHealth()
+	if assert.NotNil(t, err) {
+		assert.Equals(t, "health probe does not match the value written", err.Error())
+	}
+}
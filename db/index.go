@@ -0,0 +1,212 @@
+package db
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql"
+)
+
+// indexCertificate adds the serial number of the certificate to the entries
+// of its common name and subject alternative names in the indexes.
+func (db *DB) indexCertificate(crt *x509.Certificate) error {
+	sn := crt.SerialNumber.String()
+	if cn := crt.Subject.CommonName; cn != "" {
+		if err := db.addToIndex(certsCNIndexTable, cn, sn); err != nil {
+			return err
+		}
+	}
+	for _, san := range certificateSANs(crt) {
+		if err := db.addToIndex(certsSANIndexTable, san, sn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unindexCertificate removes the serial number of the certificate from the
+// entries of its common name and subject alternative names in the indexes.
+func (db *DB) unindexCertificate(crt *x509.Certificate) error {
+	sn := crt.SerialNumber.String()
+	if cn := crt.Subject.CommonName; cn != "" {
+		if err := db.removeFromIndex(certsCNIndexTable, cn, sn); err != nil {
+			return err
+		}
+	}
+	for _, san := range certificateSANs(crt) {
+		if err := db.removeFromIndex(certsSANIndexTable, san, sn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addToIndex adds the serial number to the entry of the given value in the
+// index table. The values are case insensitive.
+func (db *DB) addToIndex(table []byte, value, sn string) error {
+	key := []byte(strings.ToLower(value))
+	for i := 0; i < maxStatsRetries; i++ {
+		var serials []string
+		old, err := db.Get(table, key)
+		switch {
+		case err == nil:
+			if err := json.Unmarshal(old, &serials); err != nil {
+				return errors.Wrapf(err, "error unmarshaling index %s/%s", string(table), string(key))
+			}
+		case nosql.IsErrNotFound(err):
+			old = nil
+		default:
+			return errors.Wrap(err, "database Get error")
+		}
+
+		for _, s := range serials {
+			if s == sn {
+				return nil
+			}
+		}
+		b, err := json.Marshal(append(serials, sn))
+		if err != nil {
+			return errors.Wrapf(err, "error marshaling index %s/%s", string(table), string(key))
+		}
+		_, swapped, err := db.CmpAndSwap(table, key, old, b)
+		if err != nil {
+			return errors.Wrap(err, "error AuthDB CmpAndSwap")
+		}
+		if swapped {
+			return nil
+		}
+	}
+	return errors.Errorf("error updating index %s/%s: too many concurrent updates", string(table), string(key))
+}
+
+// removeFromIndex removes the serial number from the entry of the given value
+// in the index table. The entry is deleted if it becomes empty; a certificate
+// indexed concurrently with the same value can be restored with
+// RebuildIndexes.
+func (db *DB) removeFromIndex(table []byte, value, sn string) error {
+	key := []byte(strings.ToLower(value))
+	for i := 0; i < maxStatsRetries; i++ {
+		old, err := db.Get(table, key)
+		switch {
+		case err == nil:
+		case nosql.IsErrNotFound(err):
+			return nil
+		default:
+			return errors.Wrap(err, "database Get error")
+		}
+		var serials []string
+		if err := json.Unmarshal(old, &serials); err != nil {
+			return errors.Wrapf(err, "error unmarshaling index %s/%s", string(table), string(key))
+		}
+
+		remaining := make([]string, 0, len(serials))
+		for _, s := range serials {
+			if s != sn {
+				remaining = append(remaining, s)
+			}
+		}
+		switch {
+		case len(remaining) == len(serials):
+			return nil
+		case len(remaining) == 0:
+			if err := db.Del(table, key); err != nil {
+				return errors.Wrap(err, "database Del error")
+			}
+			return nil
+		}
+		b, err := json.Marshal(remaining)
+		if err != nil {
+			return errors.Wrapf(err, "error marshaling index %s/%s", string(table), string(key))
+		}
+		_, swapped, err := db.CmpAndSwap(table, key, old, b)
+		if err != nil {
+			return errors.Wrap(err, "error AuthDB CmpAndSwap")
+		}
+		if swapped {
+			return nil
+		}
+	}
+	return errors.Errorf("error updating index %s/%s: too many concurrent updates", string(table), string(key))
+}
+
+// lookupIndex returns the certificates in the entry of the given value in the
+// index table. The serial numbers in the index of certificates not in the
+// database are ignored.
+func (db *DB) lookupIndex(table []byte, value string) ([]*x509.Certificate, error) {
+	b, err := db.Get(table, []byte(strings.ToLower(value)))
+	if err != nil {
+		if nosql.IsErrNotFound(err) {
+			return []*x509.Certificate{}, nil
+		}
+		return nil, errors.Wrap(err, "database Get error")
+	}
+	var serials []string
+	if err := json.Unmarshal(b, &serials); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling index %s/%s", string(table), value)
+	}
+	certs := make([]*x509.Certificate, 0, len(serials))
+	for _, sn := range serials {
+		crt, err := db.GetCertificate(sn)
+		switch err {
+		case nil:
+			certs = append(certs, crt)
+		case ErrNotFound:
+		default:
+			return nil, err
+		}
+	}
+	return certs, nil
+}
+
+// GetCertificatesBySAN returns the certificates with the given subject
+// alternative name, a DNS name, email address, IP address or URI. The
+// comparison is case insensitive.
+func (db *DB) GetCertificatesBySAN(san string) ([]*x509.Certificate, error) {
+	return db.lookupIndex(certsSANIndexTable, san)
+}
+
+// GetCertificatesByCommonName returns the certificates with the given common
+// name. The comparison is case insensitive.
+func (db *DB) GetCertificatesByCommonName(cn string) ([]*x509.Certificate, error) {
+	return db.lookupIndex(certsCNIndexTable, cn)
+}
+
+// RebuildIndexes deletes the common name and subject alternative names
+// indexes and builds them again from the stored certificates. It returns the
+// number of certificates indexed.
+func (db *DB) RebuildIndexes() (int, error) {
+	for _, table := range [][]byte{certsSANIndexTable, certsCNIndexTable} {
+		if err := db.DeleteTable(table); err != nil && !nosql.IsErrNotFound(err) {
+			return 0, errors.Wrapf(err, "error deleting table %s", string(table))
+		}
+		if err := db.CreateTable(table); err != nil {
+			return 0, errors.Wrapf(err, "error creating table %s", string(table))
+		}
+	}
+	certs, err := db.GetCertificates()
+	if err != nil {
+		return 0, err
+	}
+	for _, crt := range certs {
+		if err := db.indexCertificate(crt); err != nil {
+			return 0, err
+		}
+	}
+	return len(certs), nil
+}
+
+// certificateSANs returns the subject alternative names of the certificate.
+func certificateSANs(crt *x509.Certificate) []string {
+	sans := make([]string, 0, len(crt.DNSNames)+len(crt.EmailAddresses)+len(crt.IPAddresses)+len(crt.URIs))
+	sans = append(sans, crt.DNSNames...)
+	sans = append(sans, crt.EmailAddresses...)
+	for _, ip := range crt.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	for _, u := range crt.URIs {
+		sans = append(sans, u.String())
+	}
+	return sans
+}
@@ -0,0 +1,264 @@
+package db
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"net/url"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/nosql/database"
+)
+
+// newMemoryNoSQLDB returns a MockNoSQLDB that keeps the values in memory.
+func newMemoryNoSQLDB() *MockNoSQLDB {
+	var mu sync.Mutex
+	tables := map[string]map[string][]byte{}
+	table := func(bucket []byte) map[string][]byte {
+		t, ok := tables[string(bucket)]
+		if !ok {
+			t = map[string][]byte{}
+			tables[string(bucket)] = t
+		}
+		return t
+	}
+	return &MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if v, ok := table(bucket)[string(key)]; ok {
+				return v, nil
+			}
+			return nil, database.ErrNotFound
+		},
+		MSet: func(bucket, key, value []byte) error {
+			mu.Lock()
+			defer mu.Unlock()
+			table(bucket)[string(key)] = value
+			return nil
+		},
+		MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			t := table(bucket)
+			v, ok := t[string(key)]
+			if (old == nil && ok) || (old != nil && !bytes.Equal(old, v)) {
+				return v, false, nil
+			}
+			t[string(key)] = newval
+			return newval, true, nil
+		},
+		MDel: func(bucket, key []byte) error {
+			mu.Lock()
+			defer mu.Unlock()
+			delete(table(bucket), string(key))
+			return nil
+		},
+		MList: func(bucket []byte) ([]*database.Entry, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			var entries []*database.Entry
+			for k, v := range table(bucket) {
+				entries = append(entries, &database.Entry{Bucket: bucket, Key: []byte(k), Value: v})
+			}
+			return entries, nil
+		},
+		MCreateTable: func(bucket []byte) error {
+			mu.Lock()
+			defer mu.Unlock()
+			table(bucket)
+			return nil
+		},
+		MDeleteTable: func(bucket []byte) error {
+			mu.Lock()
+			defer mu.Unlock()
+			delete(tables, string(bucket))
+			return nil
+		},
+	}
+}
+
+func newIndexedCertificate(t *testing.T, sn int64, cn string, sans ...string) *x509.Certificate {
+	return newTestCertificate(t, sn, cn, time.Now().Add(time.Hour), sans...)
+}
+
+func newTestCertificate(t *testing.T, sn int64, cn string, notAfter time.Time, sans ...string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(sn),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    notAfter.Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	for _, san := range sans {
+		if ip := net.ParseIP(san); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if u, err := url.Parse(san); err == nil && u.Scheme != "" {
+			template.URIs = append(template.URIs, u)
+		} else if bytes.ContainsRune([]byte(san), '@') {
+			template.EmailAddresses = append(template.EmailAddresses, san)
+		} else {
+			template.DNSNames = append(template.DNSNames, san)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	assert.FatalError(t, err)
+	crt, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+	return crt
+}
+
+func serialNumbers(certs []*x509.Certificate) []string {
+	sns := []string{}
+	for _, crt := range certs {
+		sns = append(sns, crt.SerialNumber.String())
+	}
+	sort.Strings(sns)
+	return sns
+}
+
+func TestDB_indexes(t *testing.T) {
+	db := &DB{newMemoryNoSQLDB(), true}
+	certs := []*x509.Certificate{
+		newIndexedCertificate(t, 1, "db.internal", "db.internal", "10.0.0.1"),
+		newIndexedCertificate(t, 2, "DB.internal", "db.internal", "db-1.internal"),
+		newIndexedCertificate(t, 3, "jane@smallstep.com", "jane@smallstep.com", "spiffe://smallstep.com/jane"),
+	}
+	for _, crt := range certs {
+		assert.FatalError(t, db.StoreCertificate(crt))
+	}
+	// Storing the same certificate does not duplicate the index entries.
+	assert.FatalError(t, db.StoreCertificate(certs[0]))
+
+	tests := []struct {
+		name   string
+		lookup func(string) ([]*x509.Certificate, error)
+		value  string
+		want   []string
+	}{
+		{"san/dns", db.GetCertificatesBySAN, "db.internal", []string{"1", "2"}},
+		{"san/dns-case", db.GetCertificatesBySAN, "DB-1.Internal", []string{"2"}},
+		{"san/ip", db.GetCertificatesBySAN, "10.0.0.1", []string{"1"}},
+		{"san/email", db.GetCertificatesBySAN, "jane@smallstep.com", []string{"3"}},
+		{"san/uri", db.GetCertificatesBySAN, "spiffe://smallstep.com/jane", []string{"3"}},
+		{"san/none", db.GetCertificatesBySAN, "foo.internal", []string{}},
+		{"cn", db.GetCertificatesByCommonName, "db.internal", []string{"1", "2"}},
+		{"cn/email", db.GetCertificatesByCommonName, "jane@smallstep.com", []string{"3"}},
+		{"cn/none", db.GetCertificatesByCommonName, "10.0.0.1", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.lookup(tt.value)
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.want, serialNumbers(got))
+		})
+	}
+
+	t.Run("rebuild", func(t *testing.T) {
+		// Certificates stored before the indexes existed.
+		assert.FatalError(t, db.DeleteTable(certsSANIndexTable))
+		assert.FatalError(t, db.DeleteTable(certsCNIndexTable))
+		crt := newIndexedCertificate(t, 4, "db.internal", "db.internal")
+		assert.FatalError(t, db.Set(certsTable, []byte("4"), crt.Raw))
+		got, err := db.GetCertificatesBySAN("db.internal")
+		assert.FatalError(t, err)
+		assert.Len(t, 0, got)
+
+		n, err := db.RebuildIndexes()
+		assert.FatalError(t, err)
+		assert.Equals(t, 4, n)
+		got, err = db.GetCertificatesBySAN("db.internal")
+		assert.FatalError(t, err)
+		assert.Equals(t, []string{"1", "2", "4"}, serialNumbers(got))
+		got, err = db.GetCertificatesByCommonName("jane@smallstep.com")
+		assert.FatalError(t, err)
+		assert.Equals(t, []string{"3"}, serialNumbers(got))
+	})
+}
+
+func TestDB_addToIndex(t *testing.T) {
+	tests := map[string]struct {
+		db  *DB
+		err error
+	}{
+		"fail/force-Get-error": {
+			db:  &DB{&MockNoSQLDB{Err: errors.New("force")}, true},
+			err: errors.New("database Get error: force"),
+		},
+		"fail/unmarshal-error": {
+			db:  &DB{&MockNoSQLDB{Ret1: []byte("foo")}, true},
+			err: errors.New("error unmarshaling index x509_certs_san_index/db.internal"),
+		},
+		"fail/force-CmpAndSwap-error": {
+			db: &DB{&MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					return nil, database.ErrNotFound
+				},
+				MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+					return nil, false, errors.New("force")
+				},
+			}, true},
+			err: errors.New("error AuthDB CmpAndSwap: force"),
+		},
+		"fail/too-many-retries": {
+			db: &DB{&MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					return []byte(`["1"]`), nil
+				},
+				MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+					return []byte(`["1","3"]`), false, nil
+				},
+			}, true},
+			err: errors.New("error updating index x509_certs_san_index/db.internal: too many concurrent updates"),
+		},
+		"ok/first": {
+			db: &DB{&MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					assert.Equals(t, certsSANIndexTable, bucket)
+					assert.Equals(t, []byte("db.internal"), key)
+					return nil, database.ErrNotFound
+				},
+				MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+					assert.Nil(t, old)
+					assert.Equals(t, []byte(`["2"]`), newval)
+					return newval, true, nil
+				},
+			}, true},
+		},
+		"ok/append": {
+			db: &DB{&MockNoSQLDB{
+				MGet: func(bucket, key []byte) ([]byte, error) {
+					return []byte(`["1"]`), nil
+				},
+				MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+					assert.Equals(t, []byte(`["1"]`), old)
+					assert.Equals(t, []byte(`["1","2"]`), newval)
+					return newval, true, nil
+				},
+			}, true},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.db.addToIndex(certsSANIndexTable, "DB.internal", "2")
+			if err != nil {
+				if assert.NotNil(t, tc.err) {
+					assert.HasPrefix(t, err.Error(), tc.err.Error())
+				}
+				return
+			}
+			assert.Nil(t, tc.err)
+		})
+	}
+}
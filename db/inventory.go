@@ -0,0 +1,130 @@
+package db
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql"
+)
+
+var inventoryTable = []byte("inventory")
+
+// maxInventoryRetries is the number of attempts to update an inventory entry
+// updated concurrently.
+const maxInventoryRetries = 10
+
+// InventoryEntry is a host or a workload registered in the inventory, with
+// the serial numbers of the certificates linked to it.
+type InventoryEntry struct {
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	Tags      []string  `json:"tags,omitempty"`
+	Owner     string    `json:"owner,omitempty"`
+	Serials   []string  `json:"serials,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// InventoryStore is the interface implemented by the databases that keep the
+// inventory of hosts and workloads.
+type InventoryStore interface {
+	GetInventoryEntry(name string) (*InventoryEntry, error)
+	GetInventoryEntries() ([]*InventoryEntry, error)
+	UpdateInventoryEntry(name string, fn func(e *InventoryEntry) (*InventoryEntry, error)) (*InventoryEntry, error)
+	DeleteInventoryEntry(name string) error
+}
+
+// getInventoryEntry returns the entry with the given name and its raw value,
+// or nil if it does not exist.
+func (db *DB) getInventoryEntry(name string) (*InventoryEntry, []byte, error) {
+	b, err := db.Get(inventoryTable, []byte(name))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, nil, nil
+	case err != nil:
+		return nil, nil, errors.Wrap(err, "database Get error")
+	}
+	e := new(InventoryEntry)
+	if err := json.Unmarshal(b, e); err != nil {
+		return nil, nil, errors.Wrapf(err, "error unmarshaling inventory entry %s", name)
+	}
+	return e, b, nil
+}
+
+// GetInventoryEntry returns the inventory entry with the given name, or
+// ErrNotFound if it does not exist.
+func (db *DB) GetInventoryEntry(name string) (*InventoryEntry, error) {
+	e, _, err := db.getInventoryEntry(name)
+	switch {
+	case err != nil:
+		return nil, err
+	case e == nil:
+		return nil, ErrNotFound
+	default:
+		return e, nil
+	}
+}
+
+// GetInventoryEntries returns all the inventory entries sorted by name.
+func (db *DB) GetInventoryEntries() ([]*InventoryEntry, error) {
+	entries, err := db.List(inventoryTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "database List error")
+	}
+	list := make([]*InventoryEntry, 0, len(entries))
+	for _, e := range entries {
+		ie := new(InventoryEntry)
+		if err := json.Unmarshal(e.Value, ie); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling inventory entry %s", string(e.Key))
+		}
+		list = append(list, ie)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list, nil
+}
+
+// UpdateInventoryEntry stores the entry returned by fn for the current entry
+// with the given name, nil if it does not exist. The update is retried with
+// the new entry if another instance modifies it concurrently, and it is
+// aborted with the error returned by fn.
+func (db *DB) UpdateInventoryEntry(name string, fn func(e *InventoryEntry) (*InventoryEntry, error)) (*InventoryEntry, error) {
+	for i := 0; i < maxInventoryRetries; i++ {
+		current, old, err := db.getInventoryEntry(name)
+		if err != nil {
+			return nil, err
+		}
+		e, err := fn(current)
+		if err != nil {
+			return nil, err
+		}
+		b, err := json.Marshal(e)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error marshaling inventory entry %s", name)
+		}
+		_, swapped, err := db.CmpAndSwap(inventoryTable, []byte(name), old, b)
+		if err != nil {
+			return nil, errors.Wrap(err, "error AuthDB CmpAndSwap")
+		}
+		if swapped {
+			return e, nil
+		}
+	}
+	return nil, errors.Errorf("error updating inventory entry %s: too many concurrent updates", name)
+}
+
+// DeleteInventoryEntry deletes the inventory entry with the given name, it
+// returns ErrNotFound if it does not exist.
+func (db *DB) DeleteInventoryEntry(name string) error {
+	e, _, err := db.getInventoryEntry(name)
+	switch {
+	case err != nil:
+		return err
+	case e == nil:
+		return ErrNotFound
+	}
+	return errors.Wrap(db.Del(inventoryTable, []byte(name)), "database Del error")
+}
@@ -0,0 +1,61 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+func TestDB_Inventory(t *testing.T) {
+	db := &DB{newMemoryNoSQLDB(), true}
+	assert.FatalError(t, db.CreateTable(inventoryTable))
+
+	_, err := db.GetInventoryEntry("web1")
+	assert.Equals(t, ErrNotFound, err)
+	assert.Equals(t, ErrNotFound, db.DeleteInventoryEntry("web1"))
+	list, err := db.GetInventoryEntries()
+	assert.FatalError(t, err)
+	assert.Len(t, 0, list)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, name := range []string{"web2", "web1"} {
+		name := name
+		e, err := db.UpdateInventoryEntry(name, func(e *InventoryEntry) (*InventoryEntry, error) {
+			assert.Nil(t, e)
+			return &InventoryEntry{Name: name, Kind: "host", Tags: []string{"web"}, CreatedAt: now, UpdatedAt: now}, nil
+		})
+		assert.FatalError(t, err)
+		assert.Equals(t, name, e.Name)
+	}
+
+	// The current entry is passed to the update.
+	e, err := db.UpdateInventoryEntry("web1", func(e *InventoryEntry) (*InventoryEntry, error) {
+		assert.Equals(t, "web1", e.Name)
+		e.Serials = append(e.Serials, "1234")
+		return e, nil
+	})
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"1234"}, e.Serials)
+	e, err = db.GetInventoryEntry("web1")
+	assert.FatalError(t, err)
+	assert.Equals(t, &InventoryEntry{Name: "web1", Kind: "host", Tags: []string{"web"}, Serials: []string{"1234"}, CreatedAt: now, UpdatedAt: now}, e)
+
+	// The errors abort the update.
+	_, err = db.UpdateInventoryEntry("web1", func(e *InventoryEntry) (*InventoryEntry, error) {
+		return nil, errors.New("force")
+	})
+	assert.Equals(t, "force", err.Error())
+
+	list, err = db.GetInventoryEntries()
+	assert.FatalError(t, err)
+	if assert.Len(t, 2, list) {
+		assert.Equals(t, "web1", list[0].Name)
+		assert.Equals(t, "web2", list[1].Name)
+	}
+
+	assert.FatalError(t, db.DeleteInventoryEntry("web1"))
+	_, err = db.GetInventoryEntry("web1")
+	assert.Equals(t, ErrNotFound, err)
+}
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var journalTable = []byte("journal")
+
+// Operations recorded in the change journal.
+const (
+	JournalRevoke = "revoke"
+	JournalDelete = "delete"
+)
+
+// JournalRetention is the actor of the records deleted by the garbage
+// collector of the retention policy.
+const JournalRetention = "retention"
+
+// JournalEntry is a change of a record of the database made by an actor.
+// Deleted records leave a tombstone, an entry with the SHA-256 digest of
+// their last value, so their deletion can be verified against a backup
+// without keeping the data the retention policy removes.
+type JournalEntry struct {
+	ID        string          `json:"id"`
+	Time      time.Time       `json:"time"`
+	Actor     string          `json:"actor"`
+	Operation string          `json:"operation"`
+	Table     string          `json:"table"`
+	Key       string          `json:"key"`
+	Value     json.RawMessage `json:"value,omitempty"`
+	Digest    string          `json:"digest,omitempty"`
+}
+
+var (
+	journalMu       sync.Mutex
+	journalLastNano int64
+)
+
+// newJournalID returns a unique identifier that sorts the entries of the
+// journal in the order they are appended. The time part is monotonic in this
+// process and the random suffix keeps the identifiers of other instances
+// sharing the database unique.
+func newJournalID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "error generating journal id")
+	}
+	journalMu.Lock()
+	n := time.Now().UnixNano()
+	if n <= journalLastNano {
+		n = journalLastNano + 1
+	}
+	journalLastNano = n
+	journalMu.Unlock()
+	return fmt.Sprintf("%020d-%s", n, hex.EncodeToString(b)), nil
+}
+
+// appendJournal stores the given entry. The journal is append-only, entries
+// are never modified.
+func (db *DB) appendJournal(e *JournalEntry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	var err error
+	if e.ID, err = newJournalID(); err != nil {
+		return err
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "error marshaling journal entry")
+	}
+	if _, swapped, err := db.CmpAndSwap(journalTable, []byte(e.ID), nil, b); err != nil {
+		return errors.Wrap(err, "error storing journal entry")
+	} else if !swapped {
+		return errors.Errorf("journal entry %s already exists", e.ID)
+	}
+	return nil
+}
+
+// journalDelete records the tombstone of a deleted record.
+func (db *DB) journalDelete(actor string, table, key, value []byte) error {
+	sum := sha256.Sum256(value)
+	return db.appendJournal(&JournalEntry{
+		Actor:     actor,
+		Operation: JournalDelete,
+		Table:     string(table),
+		Key:       string(key),
+		Digest:    "sha256:" + hex.EncodeToString(sum[:]),
+	})
+}
+
+// GetJournal returns the entries of the change journal sorted by time.
+func (db *DB) GetJournal() ([]*JournalEntry, error) {
+	entries, err := db.List(journalTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "database List error")
+	}
+	journal := []*JournalEntry{}
+	for _, e := range entries {
+		je := new(JournalEntry)
+		if err := json.Unmarshal(e.Value, je); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling journal entry %s", string(e.Key))
+		}
+		journal = append(journal, je)
+	}
+	sort.Slice(journal, func(i, j int) bool {
+		return journal[i].ID < journal[j].ID
+	})
+	return journal, nil
+}
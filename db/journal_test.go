@@ -0,0 +1,65 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+func TestDB_GetJournal(t *testing.T) {
+	db := &DB{newMemoryDB(), true}
+	for _, table := range [][]byte{revokedCertsTable, journalTable} {
+		assert.FatalError(t, db.CreateTable(table))
+	}
+	journal, err := db.GetJournal()
+	assert.FatalError(t, err)
+	assert.Equals(t, []*JournalEntry{}, journal)
+
+	revokedAt := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+	rci := &RevokedCertificateInfo{Serial: "1", RevokedAt: revokedAt, RevokedBy: "provisioner:step-cli:foo"}
+	assert.FatalError(t, db.Revoke(rci))
+	// Revocations are never overwritten.
+	assert.Equals(t, ErrAlreadyExists, db.Revoke(&RevokedCertificateInfo{Serial: "1", RevokedBy: "admin:mallory"}))
+	assert.FatalError(t, db.journalDelete(JournalRetention, certsTable, []byte("1"), []byte("foo")))
+
+	journal, err = db.GetJournal()
+	assert.FatalError(t, err)
+	if assert.Len(t, 2, journal) {
+		value, err := json.Marshal(rci)
+		assert.FatalError(t, err)
+		assert.NotEquals(t, "", journal[0].ID)
+		assert.Equals(t, revokedAt, journal[0].Time)
+		assert.Equals(t, "provisioner:step-cli:foo", journal[0].Actor)
+		assert.Equals(t, JournalRevoke, journal[0].Operation)
+		assert.Equals(t, "revoked_x509_certs", journal[0].Table)
+		assert.Equals(t, "1", journal[0].Key)
+		assert.Equals(t, json.RawMessage(value), journal[0].Value)
+
+		sum := sha256.Sum256([]byte("foo"))
+		assert.True(t, journal[0].ID < journal[1].ID)
+		assert.Equals(t, JournalRetention, journal[1].Actor)
+		assert.Equals(t, JournalDelete, journal[1].Operation)
+		assert.Equals(t, "x509_certs", journal[1].Table)
+		assert.Equals(t, "1", journal[1].Key)
+		assert.Equals(t, "sha256:"+hex.EncodeToString(sum[:]), journal[1].Digest)
+		assert.Nil(t, journal[1].Value)
+	}
+
+	db = &DB{&MockNoSQLDB{
+		MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+			if string(bucket) == string(journalTable) {
+				return nil, false, errors.New("force")
+			}
+			return newval, true, nil
+		},
+	}, true}
+	err = db.Revoke(&RevokedCertificateInfo{Serial: "1"})
+	if assert.NotNil(t, err) {
+		assert.Equals(t, "error storing journal entry: force", err.Error())
+	}
+}
@@ -0,0 +1,179 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql"
+)
+
+var leasesTable = []byte("leases")
+
+// HAConfig is the configuration of the CA instances sharing the same
+// database. Singleton duties, like the garbage collection of expired records,
+// only run in the instance holding their lease. The InstanceID must be unique
+// for each instance, it defaults to the hostname and the process id.
+type HAConfig struct {
+	InstanceID string `json:"instanceID,omitempty"`
+}
+
+// GetInstanceID returns the identifier of this instance.
+func (c *HAConfig) GetInstanceID() string {
+	if c != nil && c.InstanceID != "" {
+		return c.InstanceID
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "step-ca"
+	}
+	return fmt.Sprintf("%s-%d", hostname, os.Getpid())
+}
+
+// Lease is the right of an instance to run a singleton duty until it
+// expires.
+type Lease struct {
+	Name    string    `json:"name"`
+	Holder  string    `json:"holder"`
+	Expires time.Time `json:"expires"`
+}
+
+// Leaser is the interface implemented by the databases that can coordinate
+// multiple CA instances using leases. The clocks of the instances must be
+// synchronized.
+type Leaser interface {
+	AcquireLease(name, holder string, ttl time.Duration) (bool, error)
+	ReleaseLease(name, holder string) error
+	GetLeases() ([]*Lease, error)
+}
+
+// getLease returns the stored lease with the given name and its raw value, or
+// nil if it does not exist.
+func (db *DB) getLease(name string) (*Lease, []byte, error) {
+	b, err := db.Get(leasesTable, []byte(name))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, nil, nil
+	case err != nil:
+		return nil, nil, errors.Wrapf(err, "error loading lease %s", name)
+	}
+	l := new(Lease)
+	if err := json.Unmarshal(b, l); err != nil {
+		return nil, nil, errors.Wrapf(err, "error unmarshaling lease %s", name)
+	}
+	return l, b, nil
+}
+
+// AcquireLease acquires or renews the lease with the given name for the given
+// holder. It returns false if another holder has a lease that has not expired.
+func (db *DB) AcquireLease(name, holder string, ttl time.Duration) (bool, error) {
+	current, old, err := db.getLease(name)
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	if current != nil && current.Holder != holder && now.Before(current.Expires) {
+		return false, nil
+	}
+	b, err := json.Marshal(&Lease{Name: name, Holder: holder, Expires: now.Add(ttl)})
+	if err != nil {
+		return false, errors.Wrapf(err, "error marshaling lease %s", name)
+	}
+	// Another instance might acquire it concurrently.
+	_, swapped, err := db.CmpAndSwap(leasesTable, []byte(name), old, b)
+	if err != nil {
+		return false, errors.Wrap(err, "error AuthDB CmpAndSwap")
+	}
+	return swapped, nil
+}
+
+// ReleaseLease expires the lease with the given name if it is held by the
+// given holder, so another instance can acquire it.
+func (db *DB) ReleaseLease(name, holder string) error {
+	current, old, err := db.getLease(name)
+	if err != nil || current == nil || current.Holder != holder {
+		return err
+	}
+	b, err := json.Marshal(&Lease{Name: name, Holder: holder, Expires: time.Now()})
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling lease %s", name)
+	}
+	if _, _, err := db.CmpAndSwap(leasesTable, []byte(name), old, b); err != nil {
+		return errors.Wrap(err, "error AuthDB CmpAndSwap")
+	}
+	return nil
+}
+
+// GetLeases returns all the leases sorted by name.
+func (db *DB) GetLeases() ([]*Lease, error) {
+	entries, err := db.List(leasesTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "database List error")
+	}
+	leases := []*Lease{}
+	for _, e := range entries {
+		l := new(Lease)
+		if err := json.Unmarshal(e.Value, l); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling lease %s", string(e.Key))
+		}
+		leases = append(leases, l)
+	}
+	sort.Slice(leases, func(i, j int) bool {
+		return leases[i].Name < leases[j].Name
+	})
+	return leases, nil
+}
+
+// Elector elects the instance that runs a singleton duty using a lease. The
+// leader renews the lease every time it checks its leadership, so the lease
+// duration must be longer than the interval between checks.
+type Elector struct {
+	db     Leaser
+	name   string
+	holder string
+	ttl    time.Duration
+	mu     sync.Mutex
+	leader bool
+}
+
+// NewElector returns an Elector for the lease with the given name.
+func NewElector(db Leaser, name, holder string, ttl time.Duration) *Elector {
+	return &Elector{db: db, name: name, holder: holder, ttl: ttl}
+}
+
+// IsLeader acquires or renews the lease and returns true if this instance
+// holds it. Errors are logged and this instance is not the leader.
+func (e *Elector) IsLeader() bool {
+	ok, err := e.db.AcquireLease(e.name, e.holder, e.ttl)
+	if err != nil {
+		log.Printf("error acquiring lease %s: %v", e.name, err)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if ok != e.leader {
+		if ok {
+			log.Printf("instance %s acquired lease %s", e.holder, e.name)
+		} else {
+			log.Printf("instance %s lost lease %s", e.holder, e.name)
+		}
+		e.leader = ok
+	}
+	return ok
+}
+
+// Resign releases the lease if this instance holds it.
+func (e *Elector) Resign() error {
+	e.mu.Lock()
+	leader := e.leader
+	e.leader = false
+	e.mu.Unlock()
+	if !leader {
+		return nil
+	}
+	return e.db.ReleaseLease(e.name, e.holder)
+}
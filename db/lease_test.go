@@ -0,0 +1,127 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"github.com/smallstep/nosql/database"
+)
+
+func TestDB_AcquireLease(t *testing.T) {
+	db := &DB{newMemoryDB(), true}
+	assert.FatalError(t, db.CreateTable(leasesTable))
+
+	ok, err := db.AcquireLease("gc", "ca-1", time.Minute)
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+	ok, err = db.AcquireLease("gc", "ca-2", time.Minute)
+	assert.FatalError(t, err)
+	assert.False(t, ok)
+	// The holder renews it.
+	ok, err = db.AcquireLease("gc", "ca-1", time.Minute)
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+
+	// Other holders only release their leases.
+	assert.FatalError(t, db.ReleaseLease("gc", "ca-2"))
+	ok, err = db.AcquireLease("gc", "ca-2", time.Minute)
+	assert.FatalError(t, err)
+	assert.False(t, ok)
+
+	assert.FatalError(t, db.ReleaseLease("gc", "ca-1"))
+	ok, err = db.AcquireLease("gc", "ca-2", time.Minute)
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+
+	// Expired leases are acquired by other holders.
+	ok, err = db.AcquireLease("crl", "ca-1", -time.Second)
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+	ok, err = db.AcquireLease("crl", "ca-2", time.Minute)
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+
+	leases, err := db.GetLeases()
+	assert.FatalError(t, err)
+	if assert.Len(t, 2, leases) {
+		assert.Equals(t, "crl", leases[0].Name)
+		assert.Equals(t, "ca-2", leases[0].Holder)
+		assert.Equals(t, "gc", leases[1].Name)
+		assert.Equals(t, "ca-2", leases[1].Holder)
+	}
+
+	db = &DB{&MockNoSQLDB{Err: errors.New("force")}, true}
+	_, err = db.AcquireLease("gc", "ca-1", time.Minute)
+	if assert.NotNil(t, err) {
+		assert.Equals(t, "error loading lease gc: force", err.Error())
+	}
+	db = &DB{&MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			return nil, database.ErrNotFound
+		},
+		MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+			return []byte(`{"name":"gc","holder":"ca-2"}`), false, nil
+		},
+	}, true}
+	ok, err = db.AcquireLease("gc", "ca-1", time.Minute)
+	assert.FatalError(t, err)
+	assert.False(t, ok)
+}
+
+func TestElector(t *testing.T) {
+	db := &DB{newMemoryDB(), true}
+	assert.FatalError(t, db.CreateTable(leasesTable))
+	e1 := NewElector(db, "gc", "ca-1", time.Minute)
+	e2 := NewElector(db, "gc", "ca-2", time.Minute)
+
+	assert.True(t, e1.IsLeader())
+	assert.False(t, e2.IsLeader())
+	assert.True(t, e1.IsLeader())
+	assert.NoError(t, e2.Resign())
+	assert.True(t, e1.IsLeader())
+
+	assert.NoError(t, e1.Resign())
+	assert.True(t, e2.IsLeader())
+	assert.False(t, e1.IsLeader())
+
+	e := NewElector(&DB{&MockNoSQLDB{Err: errors.New("force")}, true}, "gc", "ca-1", time.Minute)
+	assert.False(t, e.IsLeader())
+}
+
+func TestGarbageCollector_elector(t *testing.T) {
+	db := &DB{newMemoryDB(), true}
+	assert.FatalError(t, db.CreateTable(leasesTable))
+	// Another instance holds the lease.
+	ok, err := db.AcquireLease("gc", "ca-2", time.Minute)
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+
+	runs := make(chan time.Time, 10)
+	gc := NewGarbageCollector(&RetentionConfig{Interval: "10ms"}, nil)
+	gc.Register("test", time.Hour, func(before time.Time) (*PruneResult, error) {
+		runs <- before
+		return &PruneResult{}, nil
+	})
+	gc.SetElector(NewElector(db, "gc", "ca-1", time.Minute))
+	gc.Start()
+	select {
+	case <-runs:
+		t.Fatal("garbage collector run without the lease")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	assert.FatalError(t, db.ReleaseLease("gc", "ca-2"))
+	select {
+	case <-runs:
+	case <-time.After(time.Second):
+		t.Fatal("garbage collector did not run")
+	}
+	gc.Stop()
+
+	// The lease is released on stop.
+	ok, err = db.AcquireLease("gc", "ca-2", time.Minute)
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+}
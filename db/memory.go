@@ -0,0 +1,230 @@
+package db
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql/database"
+)
+
+// MemoryType is the type of the database that keeps all the data in memory.
+const MemoryType = "memory"
+
+// memoryDB is a nosql.DB that keeps all the tables in memory, the data is
+// lost when the CA stops. It is intended for tests and short-lived CAs.
+type memoryDB struct {
+	mu     sync.RWMutex
+	tables map[string]map[string][]byte
+}
+
+func newMemoryDB() *memoryDB {
+	return &memoryDB{tables: make(map[string]map[string][]byte)}
+}
+
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
+
+func (m *memoryDB) table(bucket []byte) (map[string][]byte, error) {
+	t, ok := m.tables[string(bucket)]
+	if !ok {
+		return nil, errors.Wrapf(database.ErrNotFound, "table %s does not exist", bucket)
+	}
+	return t, nil
+}
+
+func (m *memoryDB) get(bucket, key []byte) ([]byte, error) {
+	t, err := m.table(bucket)
+	if err != nil {
+		return nil, err
+	}
+	v, ok := t[string(key)]
+	if !ok {
+		return nil, errors.Wrapf(database.ErrNotFound, "%s/%s not found", bucket, key)
+	}
+	return cloneBytes(v), nil
+}
+
+func (m *memoryDB) cmpAndSwap(bucket, key, oldValue, newValue []byte) ([]byte, bool, error) {
+	t, err := m.table(bucket)
+	if err != nil {
+		return nil, false, err
+	}
+	current := t[string(key)]
+	if !bytes.Equal(current, oldValue) {
+		return cloneBytes(current), false, nil
+	}
+	t[string(key)] = cloneBytes(newValue)
+	return cloneBytes(newValue), true, nil
+}
+
+// Open does nothing, the data is always in memory.
+func (m *memoryDB) Open(dataSourceName string, opt ...database.Option) error {
+	return nil
+}
+
+// Close does nothing, the data is kept until the database is garbage
+// collected.
+func (m *memoryDB) Close() error {
+	return nil
+}
+
+// Get returns the value stored in the given bucket and key.
+func (m *memoryDB) Get(bucket, key []byte) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.get(bucket, key)
+}
+
+// Set stores the given value on bucket and key.
+func (m *memoryDB) Set(bucket, key, value []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, err := m.table(bucket)
+	if err != nil {
+		return err
+	}
+	t[string(key)] = cloneBytes(value)
+	return nil
+}
+
+// CmpAndSwap modifies the value at the given bucket and key (to newValue)
+// only if the existing (current) value matches oldValue.
+func (m *memoryDB) CmpAndSwap(bucket, key, oldValue, newValue []byte) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cmpAndSwap(bucket, key, oldValue, newValue)
+}
+
+// Del deletes the value stored in the given bucket and key.
+func (m *memoryDB) Del(bucket, key []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, err := m.table(bucket)
+	if err != nil {
+		return err
+	}
+	delete(t, string(key))
+	return nil
+}
+
+// List returns the full list of entries in a bucket sorted by key.
+func (m *memoryDB) List(bucket []byte) ([]*database.Entry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	t, err := m.table(bucket)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*database.Entry, 0, len(t))
+	for k, v := range t {
+		entries = append(entries, &database.Entry{
+			Bucket: cloneBytes(bucket),
+			Key:    []byte(k),
+			Value:  cloneBytes(v),
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].Key, entries[j].Key) < 0
+	})
+	return entries, nil
+}
+
+// Update performs multiple commands atomically, if one of them fails the
+// previous ones are rolled back.
+func (m *memoryDB) Update(tx *database.Tx) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Copy the tables to restore them on errors.
+	backup := make(map[string]map[string][]byte, len(m.tables))
+	for name, t := range m.tables {
+		c := make(map[string][]byte, len(t))
+		for k, v := range t {
+			c[k] = v
+		}
+		backup[name] = c
+	}
+	if err := m.update(tx); err != nil {
+		m.tables = backup
+		return err
+	}
+	return nil
+}
+
+func (m *memoryDB) update(tx *database.Tx) error {
+	for _, q := range tx.Operations {
+		switch q.Cmd {
+		case database.CreateTable:
+			if _, ok := m.tables[string(q.Bucket)]; !ok {
+				m.tables[string(q.Bucket)] = make(map[string][]byte)
+			}
+		case database.DeleteTable:
+			if _, err := m.table(q.Bucket); err != nil {
+				return err
+			}
+			delete(m.tables, string(q.Bucket))
+		case database.Get:
+			var err error
+			if q.Result, err = m.get(q.Bucket, q.Key); err != nil {
+				return err
+			}
+		case database.Set:
+			t, err := m.table(q.Bucket)
+			if err != nil {
+				return err
+			}
+			t[string(q.Key)] = cloneBytes(q.Value)
+		case database.Delete:
+			t, err := m.table(q.Bucket)
+			if err != nil {
+				return err
+			}
+			delete(t, string(q.Key))
+		case database.CmpAndSwap:
+			var err error
+			if q.Result, q.Swapped, err = m.cmpAndSwap(q.Bucket, q.Key, q.CmpValue, q.Value); err != nil {
+				return err
+			}
+		case database.CmpOrRollback:
+			current, err := m.get(q.Bucket, q.Key)
+			if err != nil && !database.IsErrNotFound(err) {
+				return err
+			}
+			if !bytes.Equal(current, q.CmpValue) {
+				return errors.Errorf("%s/%s does not match, rolling back", q.Bucket, q.Key)
+			}
+		default:
+			return database.ErrOpNotSupported
+		}
+	}
+	return nil
+}
+
+// CreateTable creates a table in the database.
+func (m *memoryDB) CreateTable(bucket []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.tables[string(bucket)]; !ok {
+		m.tables[string(bucket)] = make(map[string][]byte)
+	}
+	return nil
+}
+
+// DeleteTable deletes a table and all its values.
+func (m *memoryDB) DeleteTable(bucket []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := m.table(bucket); err != nil {
+		return err
+	}
+	delete(m.tables, string(bucket))
+	return nil
+}
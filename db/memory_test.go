@@ -0,0 +1,129 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/nosql"
+	"github.com/smallstep/nosql/database"
+)
+
+func TestNew_memory(t *testing.T) {
+	adb, err := New(&Config{Type: MemoryType})
+	assert.FatalError(t, err)
+	defer adb.Shutdown()
+
+	crt := newIndexedCertificate(t, 1, "db.internal", "db.internal")
+	assert.FatalError(t, adb.StoreCertificate(crt))
+	got, err := adb.GetCertificate("1")
+	assert.FatalError(t, err)
+	assert.Equals(t, crt.Raw, got.Raw)
+	certs, err := adb.GetCertificatesBySAN("db.internal")
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"1"}, serialNumbers(certs))
+
+	ok, err := adb.UseToken("id", "token")
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+	ok, err = adb.UseToken("id", "token")
+	assert.FatalError(t, err)
+	assert.False(t, ok)
+
+	v, err := adb.(Migrator).GetSchemaVersion()
+	assert.FatalError(t, err)
+	assert.Equals(t, SchemaVersion(), v)
+
+	// Every instance has its own data.
+	other, err := New(&Config{Type: MemoryType})
+	assert.FatalError(t, err)
+	_, err = other.GetCertificate("1")
+	assert.Equals(t, ErrNotFound, err)
+}
+
+func TestMemoryDB(t *testing.T) {
+	m := newMemoryDB()
+	bucket := []byte("bucket")
+
+	_, err := m.Get(bucket, []byte("a"))
+	assert.True(t, nosql.IsErrNotFound(err))
+	assert.True(t, nosql.IsErrNotFound(m.Set(bucket, []byte("a"), []byte("1"))))
+	_, err = m.List(bucket)
+	assert.True(t, nosql.IsErrNotFound(err))
+	assert.True(t, nosql.IsErrNotFound(m.DeleteTable(bucket)))
+
+	assert.FatalError(t, m.CreateTable(bucket))
+	entries, err := m.List(bucket)
+	assert.FatalError(t, err)
+	assert.Len(t, 0, entries)
+
+	// Values are copied.
+	value := []byte("1")
+	assert.FatalError(t, m.Set(bucket, []byte("a"), value))
+	value[0] = '2'
+	got, err := m.Get(bucket, []byte("a"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("1"), got)
+
+	ret, swapped, err := m.CmpAndSwap(bucket, []byte("a"), []byte("5"), []byte("6"))
+	assert.FatalError(t, err)
+	assert.False(t, swapped)
+	assert.Equals(t, []byte("1"), ret)
+	ret, swapped, err = m.CmpAndSwap(bucket, []byte("a"), []byte("1"), []byte("2"))
+	assert.FatalError(t, err)
+	assert.True(t, swapped)
+	assert.Equals(t, []byte("2"), ret)
+	_, swapped, err = m.CmpAndSwap(bucket, []byte("b"), nil, []byte("1"))
+	assert.FatalError(t, err)
+	assert.True(t, swapped)
+
+	entries, err = m.List(bucket)
+	assert.FatalError(t, err)
+	assert.Equals(t, []*database.Entry{
+		{Bucket: bucket, Key: []byte("a"), Value: []byte("2")},
+		{Bucket: bucket, Key: []byte("b"), Value: []byte("1")},
+	}, entries)
+
+	assert.FatalError(t, m.Del(bucket, []byte("b")))
+	_, err = m.Get(bucket, []byte("b"))
+	assert.True(t, nosql.IsErrNotFound(err))
+
+	assert.FatalError(t, m.DeleteTable(bucket))
+	_, err = m.Get(bucket, []byte("a"))
+	assert.True(t, nosql.IsErrNotFound(err))
+}
+
+func TestMemoryDB_Update(t *testing.T) {
+	m := newMemoryDB()
+	bucket := []byte("nonces")
+
+	tx := &database.Tx{Operations: []*database.TxEntry{
+		{Bucket: bucket, Cmd: database.CreateTable},
+		{Bucket: bucket, Key: []byte("a"), Value: []byte("1"), Cmd: database.Set},
+		{Bucket: bucket, Key: []byte("b"), CmpValue: nil, Value: []byte("2"), Cmd: database.CmpAndSwap},
+		{Bucket: bucket, Key: []byte("a"), Cmd: database.Get},
+	}}
+	assert.FatalError(t, m.Update(tx))
+	assert.True(t, tx.Operations[2].Swapped)
+	assert.Equals(t, []byte("1"), tx.Operations[3].Result)
+
+	// Failed transactions are rolled back.
+	tx = &database.Tx{Operations: []*database.TxEntry{
+		{Bucket: bucket, Key: []byte("a"), Cmd: database.Delete},
+		{Bucket: bucket, Key: []byte("b"), CmpValue: []byte("5"), Cmd: database.CmpOrRollback},
+	}}
+	err := m.Update(tx)
+	if assert.NotNil(t, err) {
+		assert.Equals(t, "nonces/b does not match, rolling back", err.Error())
+	}
+	got, err := m.Get(bucket, []byte("a"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("1"), got)
+
+	tx = &database.Tx{Operations: []*database.TxEntry{
+		{Bucket: bucket, Key: []byte("a"), Cmd: database.Delete},
+		{Bucket: bucket, Key: []byte("missing"), Cmd: database.Get},
+	}}
+	assert.True(t, nosql.IsErrNotFound(m.Update(tx)))
+	_, err = m.Get(bucket, []byte("a"))
+	assert.FatalError(t, err)
+}
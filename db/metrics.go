@@ -0,0 +1,91 @@
+package db
+
+import (
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/metrics"
+	"github.com/smallstep/nosql"
+	"github.com/smallstep/nosql/database"
+)
+
+// instrumentedDB is a nosql.DB that records the latency and the errors of the
+// operations of the backend in the metrics of the CA.
+type instrumentedDB struct {
+	nosql.DB
+}
+
+func newInstrumentedDB(db nosql.DB) *instrumentedDB {
+	return &instrumentedDB{DB: db}
+}
+
+func observe(op string, bucket []byte, start time.Time, err error) {
+	metrics.DBOperationDuration.ObserveDuration(time.Since(start), op, string(bucket))
+	if err != nil && !nosql.IsErrNotFound(err) {
+		metrics.DBOperationErrors.Inc(op, string(bucket))
+	}
+}
+
+// Get returns the value stored in the given bucket and key.
+func (db *instrumentedDB) Get(bucket, key []byte) ([]byte, error) {
+	start := time.Now()
+	ret, err := db.DB.Get(bucket, key)
+	observe("get", bucket, start, err)
+	return ret, err
+}
+
+// Set stores the given value on bucket and key.
+func (db *instrumentedDB) Set(bucket, key, value []byte) error {
+	start := time.Now()
+	err := db.DB.Set(bucket, key, value)
+	observe("set", bucket, start, err)
+	return err
+}
+
+// Del deletes the value stored in the given bucket and key.
+func (db *instrumentedDB) Del(bucket, key []byte) error {
+	start := time.Now()
+	err := db.DB.Del(bucket, key)
+	observe("del", bucket, start, err)
+	return err
+}
+
+// List returns the full list of entries in a bucket.
+func (db *instrumentedDB) List(bucket []byte) ([]*database.Entry, error) {
+	start := time.Now()
+	ret, err := db.DB.List(bucket)
+	observe("list", bucket, start, err)
+	return ret, err
+}
+
+// CmpAndSwap modifies the value at the given bucket and key (to newValue)
+// only if the existing (current) value matches oldValue.
+func (db *instrumentedDB) CmpAndSwap(bucket, key, oldValue, newValue []byte) ([]byte, bool, error) {
+	start := time.Now()
+	ret, swapped, err := db.DB.CmpAndSwap(bucket, key, oldValue, newValue)
+	observe("cmpAndSwap", bucket, start, err)
+	return ret, swapped, err
+}
+
+// Update performs multiple commands on one read-write transaction.
+func (db *instrumentedDB) Update(tx *database.Tx) error {
+	start := time.Now()
+	err := db.DB.Update(tx)
+	observe("update", nil, start, err)
+	return err
+}
+
+// CreateTable creates a table in the database.
+func (db *instrumentedDB) CreateTable(bucket []byte) error {
+	start := time.Now()
+	err := db.DB.CreateTable(bucket)
+	observe("createTable", bucket, start, err)
+	return err
+}
+
+// DeleteTable deletes a table in the database.
+func (db *instrumentedDB) DeleteTable(bucket []byte) error {
+	start := time.Now()
+	err := db.DB.DeleteTable(bucket)
+	observe("deleteTable", bucket, start, err)
+	return err
+}
@@ -0,0 +1,37 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/RTradeLtd/ca-certificates/metrics"
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"github.com/smallstep/nosql/database"
+)
+
+func TestInstrumentedDB(t *testing.T) {
+	table := []byte("instrumented")
+	mock := &MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			if string(key) == "missing" {
+				return nil, database.ErrNotFound
+			}
+			return nil, errors.New("force")
+		},
+		MSet: func(bucket, key, value []byte) error {
+			return nil
+		},
+	}
+	db := newInstrumentedDB(mock)
+
+	assert.FatalError(t, db.Set(table, []byte("foo"), []byte("bar")))
+	_, err := db.Get(table, []byte("missing"))
+	assert.Equals(t, database.ErrNotFound, err)
+	_, err = db.Get(table, []byte("foo"))
+	assert.Equals(t, "force", err.Error())
+
+	assert.Equals(t, uint64(1), metrics.DBOperationDuration.Count("set", "instrumented"))
+	assert.Equals(t, uint64(2), metrics.DBOperationDuration.Count("get", "instrumented"))
+	assert.Equals(t, float64(0), metrics.DBOperationErrors.Value("set", "instrumented"))
+	assert.Equals(t, float64(1), metrics.DBOperationErrors.Value("get", "instrumented"))
+}
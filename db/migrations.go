@@ -0,0 +1,127 @@
+package db
+
+import (
+	"log"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql"
+)
+
+var (
+	schemaTable      = []byte("schema")
+	schemaVersionKey = []byte("version")
+)
+
+// Migration is a change of the layout of the database between two releases.
+type Migration struct {
+	Version     int    `json:"version"`
+	Description string `json:"description"`
+	up          func(db *DB) error
+}
+
+// migrations is the ordered list of migrations, the version of the last one
+// is the current version of the schema. Migrations must only use the nosql.DB
+// interface, so they work with every backend, and must be idempotent as they
+// might be interrupted before the version is stored.
+var migrations = []*Migration{
+	{
+		Version:     1,
+		Description: "index certificates by common name and subject alternative names",
+		up: func(db *DB) error {
+			_, err := db.RebuildIndexes()
+			return err
+		},
+	},
+	{
+		Version:     2,
+		Description: "append the stored certificates to the transparency log",
+		up: func(db *DB) error {
+			certs, err := db.GetCertificates()
+			if err != nil {
+				return err
+			}
+			sort.Slice(certs, func(i, j int) bool {
+				if certs[i].NotBefore.Equal(certs[j].NotBefore) {
+					return certs[i].SerialNumber.Cmp(certs[j].SerialNumber) < 0
+				}
+				return certs[i].NotBefore.Before(certs[j].NotBefore)
+			})
+			for _, crt := range certs {
+				if err := db.appendToLog(crt); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+}
+
+// SchemaVersion returns the version of the schema supported by this release.
+func SchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// Migrator is the interface implemented by the databases with a versioned
+// schema.
+type Migrator interface {
+	GetSchemaVersion() (int, error)
+	Migrate(dryRun bool) ([]*Migration, error)
+}
+
+// GetSchemaVersion returns the version of the schema of the database, 0 if it
+// was created before the schema was versioned.
+func (db *DB) GetSchemaVersion() (int, error) {
+	b, err := db.Get(schemaTable, schemaVersionKey)
+	switch {
+	case nosql.IsErrNotFound(err):
+		return 0, nil
+	case err != nil:
+		return 0, errors.Wrap(err, "error loading schema version")
+	}
+	v, err := strconv.Atoi(string(b))
+	if err != nil {
+		return 0, errors.Wrapf(err, "error parsing schema version %s", string(b))
+	}
+	return v, nil
+}
+
+// pendingMigrations returns the migrations newer than the version of the
+// database. It fails if the database was migrated by a newer release.
+func (db *DB) pendingMigrations() ([]*Migration, error) {
+	version, err := db.GetSchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if version > SchemaVersion() {
+		return nil, errors.Errorf("database schema version %d is newer than the version %d supported by this release", version, SchemaVersion())
+	}
+	pending := []*Migration{}
+	for _, m := range migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Migrate applies in order the migrations newer than the version of the
+// database, storing the new version after each one. If dryRun is true the
+// pending migrations are returned without applying them.
+func (db *DB) Migrate(dryRun bool) ([]*Migration, error) {
+	pending, err := db.pendingMigrations()
+	if err != nil || dryRun {
+		return pending, err
+	}
+	for i, m := range pending {
+		if err := m.up(db); err != nil {
+			return pending[:i], errors.Wrapf(err, "error applying migration %d", m.Version)
+		}
+		if err := db.Set(schemaTable, schemaVersionKey, []byte(strconv.Itoa(m.Version))); err != nil {
+			return pending[:i], errors.Wrap(err, "error storing schema version")
+		}
+		log.Printf("applied database migration %d: %s", m.Version, m.Description)
+	}
+	return pending, nil
+}
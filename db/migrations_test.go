@@ -0,0 +1,71 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"github.com/smallstep/nosql/database"
+)
+
+func TestDB_Migrate(t *testing.T) {
+	db := &DB{newMemoryNoSQLDB(), true}
+	// Certificates stored before the schema was versioned.
+	crt := newIndexedCertificate(t, 1, "db.internal", "db.internal")
+	assert.FatalError(t, db.Set(certsTable, []byte("1"), crt.Raw))
+
+	v, err := db.GetSchemaVersion()
+	assert.FatalError(t, err)
+	assert.Equals(t, 0, v)
+
+	pending, err := db.Migrate(true)
+	assert.FatalError(t, err)
+	assert.Equals(t, migrations, pending)
+	certs, err := db.GetCertificatesBySAN("db.internal")
+	assert.FatalError(t, err)
+	assert.Len(t, 0, certs)
+
+	applied, err := db.Migrate(false)
+	assert.FatalError(t, err)
+	assert.Equals(t, migrations, applied)
+	v, err = db.GetSchemaVersion()
+	assert.FatalError(t, err)
+	assert.Equals(t, SchemaVersion(), v)
+	certs, err = db.GetCertificatesBySAN("db.internal")
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"1"}, serialNumbers(certs))
+	th, err := db.GetTreeHead()
+	assert.FatalError(t, err)
+	assert.Equals(t, &TreeHead{TreeSize: 1, RootHash: LeafHash(crt.Raw)}, th)
+
+	pending, err = db.Migrate(false)
+	assert.FatalError(t, err)
+	assert.Len(t, 0, pending)
+
+	// Databases migrated by a newer release are rejected.
+	assert.FatalError(t, db.Set(schemaTable, schemaVersionKey, []byte("1000")))
+	_, err = db.Migrate(true)
+	if assert.NotNil(t, err) {
+		assert.HasPrefix(t, err.Error(), "database schema version 1000 is newer than the version")
+	}
+
+	assert.FatalError(t, db.Set(schemaTable, schemaVersionKey, []byte("foo")))
+	_, err = db.GetSchemaVersion()
+	if assert.NotNil(t, err) {
+		assert.HasPrefix(t, err.Error(), "error parsing schema version foo")
+	}
+
+	db = &DB{&MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			return nil, database.ErrNotFound
+		},
+		MList: func(bucket []byte) ([]*database.Entry, error) {
+			return nil, errors.New("force")
+		},
+	}, true}
+	applied, err = db.Migrate(false)
+	if assert.NotNil(t, err) {
+		assert.HasPrefix(t, err.Error(), "error applying migration 1")
+	}
+	assert.Len(t, 0, applied)
+}
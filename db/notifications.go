@@ -0,0 +1,46 @@
+package db
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql"
+)
+
+var expiryNotificationsTable = []byte("expiry_notifications")
+
+// NotificationStore is the interface implemented by the databases that keep
+// the expiry notifications already sent for each certificate, so they are not
+// sent again after a restart or by another instance.
+type NotificationStore interface {
+	GetExpiryNotifications(serial string) ([]string, error)
+	SetExpiryNotifications(serial string, keys []string) error
+}
+
+// GetExpiryNotifications returns the keys of the expiry notifications sent
+// for the certificate with the given serial number.
+func (db *DB) GetExpiryNotifications(serial string) ([]string, error) {
+	b, err := db.Get(expiryNotificationsTable, []byte(serial))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, nil
+	case err != nil:
+		return nil, errors.Wrap(err, "database Get error")
+	}
+	var keys []string
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return nil, errors.Wrapf(err, "error unmarshaling expiry notifications of %s", serial)
+	}
+	return keys, nil
+}
+
+// SetExpiryNotifications stores the keys of the expiry notifications sent for
+// the certificate with the given serial number. The record is deleted with
+// the certificate by the garbage collector.
+func (db *DB) SetExpiryNotifications(serial string, keys []string) error {
+	b, err := json.Marshal(keys)
+	if err != nil {
+		return errors.Wrapf(err, "error marshaling expiry notifications of %s", serial)
+	}
+	return errors.Wrap(db.Set(expiryNotificationsTable, []byte(serial), b), "database Set error")
+}
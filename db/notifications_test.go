@@ -0,0 +1,26 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestDB_ExpiryNotifications(t *testing.T) {
+	db := &DB{newMemoryNoSQLDB(), true}
+	assert.FatalError(t, db.CreateTable(expiryNotificationsTable))
+
+	keys, err := db.GetExpiryNotifications("1")
+	assert.FatalError(t, err)
+	assert.Len(t, 0, keys)
+
+	assert.FatalError(t, db.SetExpiryNotifications("1", []string{"168h0m0s/email"}))
+	assert.FatalError(t, db.SetExpiryNotifications("1", []string{"168h0m0s/email", "24h0m0s/slack"}))
+	keys, err = db.GetExpiryNotifications("1")
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"168h0m0s/email", "24h0m0s/slack"}, keys)
+
+	keys, err = db.GetExpiryNotifications("2")
+	assert.FatalError(t, err)
+	assert.Len(t, 0, keys)
+}
@@ -0,0 +1,243 @@
+package db
+
+import (
+	"log"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql"
+	"github.com/smallstep/nosql/database"
+)
+
+// Default values of the database operations.
+const (
+	DefaultRetryBackoff       = 100 * time.Millisecond
+	DefaultSlowQueryThreshold = time.Second
+)
+
+// ErrTimeout is returned when a database operation does not finish before
+// the configured timeout.
+var ErrTimeout = errors.New("database operation timed out")
+
+// PoolConfig tunes the operations with the database backend. MaxOpenConns
+// limits the number of concurrent operations, and so the connections opened
+// by network backends, operations wait for a free slot. Timeout is the
+// maximum duration of an operation, including the wait. Reads, sets, deletes
+// and table creations that fail are retried up to Retries times, waiting
+// RetryBackoff, doubled on every attempt; compare-and-swaps and transactions
+// are never retried. Operations slower than SlowQueryThreshold are logged.
+type PoolConfig struct {
+	MaxOpenConns       int    `json:"maxOpenConns,omitempty"`
+	Timeout            string `json:"timeout,omitempty"`
+	Retries            int    `json:"retries,omitempty"`
+	RetryBackoff       string `json:"retryBackoff,omitempty"`
+	SlowQueryThreshold string `json:"slowQueryThreshold,omitempty"`
+}
+
+// Validate validates the pool configuration.
+func (c *PoolConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.MaxOpenConns < 0:
+		return errors.New("pool maxOpenConns cannot be negative")
+	case c.Retries < 0:
+		return errors.New("pool retries cannot be negative")
+	}
+	for name, s := range map[string]string{
+		"timeout":            c.Timeout,
+		"retryBackoff":       c.RetryBackoff,
+		"slowQueryThreshold": c.SlowQueryThreshold,
+	} {
+		if s == "" {
+			continue
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing pool %s %s", name, s)
+		}
+		if d <= 0 {
+			return errors.Errorf("pool %s must be greater than 0", name)
+		}
+	}
+	return nil
+}
+
+func parsePoolDuration(s string, def time.Duration) time.Duration {
+	if s == "" {
+		return def
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return def
+	}
+	return d
+}
+
+// GetTimeout returns the maximum duration of an operation, 0 if operations
+// do not time out.
+func (c *PoolConfig) GetTimeout() time.Duration {
+	if c == nil {
+		return 0
+	}
+	return parsePoolDuration(c.Timeout, 0)
+}
+
+// GetRetryBackoff returns the wait before the first retry.
+func (c *PoolConfig) GetRetryBackoff() time.Duration {
+	if c == nil {
+		return DefaultRetryBackoff
+	}
+	return parsePoolDuration(c.RetryBackoff, DefaultRetryBackoff)
+}
+
+// GetSlowQueryThreshold returns the duration from which operations are
+// logged.
+func (c *PoolConfig) GetSlowQueryThreshold() time.Duration {
+	if c == nil {
+		return DefaultSlowQueryThreshold
+	}
+	return parsePoolDuration(c.SlowQueryThreshold, DefaultSlowQueryThreshold)
+}
+
+// pooledDB is a nosql.DB that applies the pool configuration to the
+// operations of the backend.
+type pooledDB struct {
+	nosql.DB
+	slots     chan struct{}
+	timeout   time.Duration
+	retries   int
+	backoff   time.Duration
+	threshold time.Duration
+}
+
+func newPooledDB(db nosql.DB, c *PoolConfig) *pooledDB {
+	p := &pooledDB{
+		DB:        db,
+		timeout:   c.GetTimeout(),
+		retries:   c.Retries,
+		backoff:   c.GetRetryBackoff(),
+		threshold: c.GetSlowQueryThreshold(),
+	}
+	if c.MaxOpenConns > 0 {
+		p.slots = make(chan struct{}, c.MaxOpenConns)
+	}
+	return p
+}
+
+// do runs the given operation, waiting for a free slot and failing with
+// ErrTimeout if the timeout expires first. A timed out operation keeps its
+// slot until the backend returns, so stuck operations do not open more
+// connections.
+func (p *pooledDB) do(name string, bucket []byte, fn func() error) error {
+	start := time.Now()
+	var timer <-chan time.Time
+	if p.timeout > 0 {
+		t := time.NewTimer(p.timeout)
+		defer t.Stop()
+		timer = t.C
+	}
+	if p.slots != nil {
+		select {
+		case p.slots <- struct{}{}:
+		case <-timer:
+			return errors.Wrapf(ErrTimeout, "%s %s: waiting for a connection", name, bucket)
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		err := fn()
+		if p.slots != nil {
+			<-p.slots
+		}
+		if d := time.Since(start); d >= p.threshold {
+			log.Printf("slow database operation: %s %s took %s", name, bucket, d)
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-timer:
+		return errors.Wrapf(ErrTimeout, "%s %s", name, bucket)
+	}
+}
+
+// retry runs an idempotent operation, retrying it if it fails with an error
+// other than not found or a timeout.
+func (p *pooledDB) retry(name string, bucket []byte, fn func() error) error {
+	backoff := p.backoff
+	for i := 0; ; i++ {
+		err := p.do(name, bucket, fn)
+		if err == nil || i >= p.retries || nosql.IsErrNotFound(err) ||
+			database.IsErrOpNotSupported(err) || errors.Cause(err) == ErrTimeout {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// Get returns the value stored in the given bucket and key.
+func (p *pooledDB) Get(bucket, key []byte) (ret []byte, err error) {
+	err = p.retry("get", bucket, func() (err error) {
+		ret, err = p.DB.Get(bucket, key)
+		return
+	})
+	return
+}
+
+// Set stores the given value on bucket and key.
+func (p *pooledDB) Set(bucket, key, value []byte) error {
+	return p.retry("set", bucket, func() error {
+		return p.DB.Set(bucket, key, value)
+	})
+}
+
+// Del deletes the value stored in the given bucket and key.
+func (p *pooledDB) Del(bucket, key []byte) error {
+	return p.retry("del", bucket, func() error {
+		return p.DB.Del(bucket, key)
+	})
+}
+
+// List returns the full list of entries in a bucket.
+func (p *pooledDB) List(bucket []byte) (ret []*database.Entry, err error) {
+	err = p.retry("list", bucket, func() (err error) {
+		ret, err = p.DB.List(bucket)
+		return
+	})
+	return
+}
+
+// CmpAndSwap modifies the value at the given bucket and key (to newValue)
+// only if the existing (current) value matches oldValue.
+func (p *pooledDB) CmpAndSwap(bucket, key, oldValue, newValue []byte) (ret []byte, swapped bool, err error) {
+	err = p.do("cmpAndSwap", bucket, func() (err error) {
+		ret, swapped, err = p.DB.CmpAndSwap(bucket, key, oldValue, newValue)
+		return
+	})
+	return
+}
+
+// Update performs multiple commands on one read-write transaction.
+func (p *pooledDB) Update(tx *database.Tx) error {
+	return p.do("update", nil, func() error {
+		return p.DB.Update(tx)
+	})
+}
+
+// CreateTable creates a table in the database.
+func (p *pooledDB) CreateTable(bucket []byte) error {
+	return p.retry("createTable", bucket, func() error {
+		return p.DB.CreateTable(bucket)
+	})
+}
+
+// DeleteTable deletes a table in the database.
+func (p *pooledDB) DeleteTable(bucket []byte) error {
+	return p.do("deleteTable", bucket, func() error {
+		return p.DB.DeleteTable(bucket)
+	})
+}
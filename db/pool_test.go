@@ -0,0 +1,130 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"github.com/smallstep/nosql/database"
+)
+
+func TestPoolConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    *PoolConfig
+		timeout   time.Duration
+		backoff   time.Duration
+		threshold time.Duration
+		err       string
+	}{
+		{"nil", nil, 0, DefaultRetryBackoff, DefaultSlowQueryThreshold, ""},
+		{"ok", &PoolConfig{MaxOpenConns: 10, Timeout: "5s", Retries: 3, RetryBackoff: "10ms", SlowQueryThreshold: "500ms"},
+			5 * time.Second, 10 * time.Millisecond, 500 * time.Millisecond, ""},
+		{"fail-conns", &PoolConfig{MaxOpenConns: -1}, 0, 0, 0, "pool maxOpenConns cannot be negative"},
+		{"fail-retries", &PoolConfig{Retries: -1}, 0, 0, 0, "pool retries cannot be negative"},
+		{"fail-timeout", &PoolConfig{Timeout: "foo"}, 0, 0, 0, "error parsing pool timeout foo"},
+		{"fail-backoff-zero", &PoolConfig{RetryBackoff: "0s"}, 0, 0, 0, "pool retryBackoff must be greater than 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.err != "" {
+				if assert.NotNil(t, err) {
+					assert.HasPrefix(t, err.Error(), tt.err)
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.timeout, tt.config.GetTimeout())
+			assert.Equals(t, tt.backoff, tt.config.GetRetryBackoff())
+			assert.Equals(t, tt.threshold, tt.config.GetSlowQueryThreshold())
+		})
+	}
+}
+
+func TestPooledDB_Retry(t *testing.T) {
+	var calls int
+	mock := &MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			calls++
+			if calls < 3 {
+				return nil, errors.New("connection reset")
+			}
+			return []byte("bar"), nil
+		},
+		MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+			calls++
+			return nil, false, errors.New("connection reset")
+		},
+	}
+	p := newPooledDB(mock, &PoolConfig{Retries: 2, RetryBackoff: "1ms"})
+
+	b, err := p.Get([]byte("foo"), []byte("foo"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("bar"), b)
+	assert.Equals(t, 3, calls)
+
+	// Compare-and-swaps are not idempotent.
+	calls = 0
+	_, _, err = p.CmpAndSwap([]byte("foo"), []byte("foo"), nil, []byte("bar"))
+	assert.Equals(t, "connection reset", err.Error())
+	assert.Equals(t, 1, calls)
+
+	// Not found is not retried.
+	calls = 0
+	mock.MGet = func(bucket, key []byte) ([]byte, error) {
+		calls++
+		return nil, database.ErrNotFound
+	}
+	_, err = p.Get([]byte("foo"), []byte("foo"))
+	assert.Equals(t, database.ErrNotFound, err)
+	assert.Equals(t, 1, calls)
+
+	// Retries are limited.
+	calls = 0
+	mock.MGet = func(bucket, key []byte) ([]byte, error) {
+		calls++
+		return nil, errors.New("connection reset")
+	}
+	_, err = p.Get([]byte("foo"), []byte("foo"))
+	assert.Equals(t, "connection reset", err.Error())
+	assert.Equals(t, 3, calls)
+}
+
+func TestPooledDB_Timeout(t *testing.T) {
+	release := make(chan struct{})
+	mock := &MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			<-release
+			return []byte("bar"), nil
+		},
+		MSet: func(bucket, key, value []byte) error {
+			return nil
+		},
+	}
+	p := newPooledDB(mock, &PoolConfig{MaxOpenConns: 1, Timeout: "20ms", Retries: 2})
+
+	// The operation times out and is not retried.
+	_, err := p.Get([]byte("foo"), []byte("foo"))
+	assert.Equals(t, ErrTimeout, errors.Cause(err))
+	assert.Equals(t, "get foo: database operation timed out", err.Error())
+
+	// The stuck operation keeps the only connection.
+	err = p.Set([]byte("foo"), []byte("foo"), []byte("bar"))
+	assert.Equals(t, ErrTimeout, errors.Cause(err))
+	assert.Equals(t, "set foo: waiting for a connection: database operation timed out", err.Error())
+
+	close(release)
+	assert.FatalError(t, p.Set([]byte("foo"), []byte("foo"), []byte("bar")))
+}
+
+func TestNew_Pool(t *testing.T) {
+	adb, err := New(&Config{Type: MemoryType, Pool: &PoolConfig{MaxOpenConns: 2, Timeout: "1s", Retries: 1}})
+	assert.FatalError(t, err)
+	crt := newIndexedCertificate(t, 1, "db.internal", "db.internal")
+	assert.FatalError(t, adb.StoreCertificate(crt))
+	got, err := adb.GetCertificate("1")
+	assert.FatalError(t, err)
+	assert.Equals(t, crt.Raw, got.Raw)
+}
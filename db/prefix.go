@@ -0,0 +1,99 @@
+package db
+
+import (
+	"regexp"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql"
+	"github.com/smallstep/nosql/database"
+)
+
+var tablePrefixRegexp = regexp.MustCompile(`^[a-zA-Z0-9_]+$`)
+
+// ValidateTablePrefix validates the prefix of the tables, it can only contain
+// letters, numbers and underscores so it is a valid table name in all the
+// databases.
+func ValidateTablePrefix(prefix string) error {
+	if prefix != "" && !tablePrefixRegexp.MatchString(prefix) {
+		return errors.Errorf("db.tablePrefix %s is not valid, it can only contain letters, numbers and underscores", prefix)
+	}
+	return nil
+}
+
+// prefixedDB is a nosql.DB that adds a prefix to the name of all the tables,
+// so several authorities can share the same database.
+type prefixedDB struct {
+	nosql.DB
+	prefix string
+}
+
+func newPrefixedDB(db nosql.DB, prefix string) nosql.DB {
+	if prefix == "" {
+		return db
+	}
+	return &prefixedDB{DB: db, prefix: prefix}
+}
+
+func (p *prefixedDB) table(bucket []byte) []byte {
+	b := make([]byte, 0, len(p.prefix)+len(bucket))
+	b = append(b, p.prefix...)
+	return append(b, bucket...)
+}
+
+// Get returns the value of the given bucket and key.
+func (p *prefixedDB) Get(bucket, key []byte) ([]byte, error) {
+	return p.DB.Get(p.table(bucket), key)
+}
+
+// Set stores the value of the given bucket and key.
+func (p *prefixedDB) Set(bucket, key, value []byte) error {
+	return p.DB.Set(p.table(bucket), key, value)
+}
+
+// CmpAndSwap swaps the value of the given bucket and key if it is oldValue.
+func (p *prefixedDB) CmpAndSwap(bucket, key, oldValue, newValue []byte) ([]byte, bool, error) {
+	return p.DB.CmpAndSwap(p.table(bucket), key, oldValue, newValue)
+}
+
+// Del deletes the value of the given bucket and key.
+func (p *prefixedDB) Del(bucket, key []byte) error {
+	return p.DB.Del(p.table(bucket), key)
+}
+
+// List returns the entries of the given bucket, with the bucket without the
+// prefix.
+func (p *prefixedDB) List(bucket []byte) ([]*database.Entry, error) {
+	entries, err := p.DB.List(p.table(bucket))
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		e.Bucket = bucket
+	}
+	return entries, nil
+}
+
+// Update runs the given transaction on the prefixed buckets.
+func (p *prefixedDB) Update(tx *database.Tx) error {
+	buckets := make([][]byte, len(tx.Operations))
+	for i, op := range tx.Operations {
+		buckets[i] = op.Bucket
+		op.Bucket = p.table(op.Bucket)
+	}
+	defer func() {
+		for i, op := range tx.Operations {
+			op.Bucket = buckets[i]
+		}
+	}()
+	return p.DB.Update(tx)
+}
+
+// CreateTable creates the given bucket.
+func (p *prefixedDB) CreateTable(bucket []byte) error {
+	return p.DB.CreateTable(p.table(bucket))
+}
+
+// DeleteTable deletes the given bucket.
+func (p *prefixedDB) DeleteTable(bucket []byte) error {
+	return p.DB.DeleteTable(p.table(bucket))
+}
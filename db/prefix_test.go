@@ -0,0 +1,76 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/nosql"
+	"github.com/smallstep/nosql/database"
+)
+
+func TestValidateTablePrefix(t *testing.T) {
+	assert.NoError(t, ValidateTablePrefix(""))
+	assert.NoError(t, ValidateTablePrefix("tenant_1_"))
+	assert.Error(t, ValidateTablePrefix("tenant-1"))
+	assert.Error(t, ValidateTablePrefix("tenant 1"))
+	assert.Error(t, ValidateTablePrefix("tenant;"))
+}
+
+func Test_prefixedDB(t *testing.T) {
+	base := newMemoryDB()
+	assert.Equals(t, base, newPrefixedDB(base, ""))
+	a := newPrefixedDB(base, "a_")
+	b := newPrefixedDB(base, "b_")
+	table := []byte("table")
+	for _, db := range []nosql.DB{a, b} {
+		assert.FatalError(t, db.CreateTable(table))
+	}
+
+	assert.FatalError(t, a.Set(table, []byte("key"), []byte("a")))
+	assert.FatalError(t, b.Set(table, []byte("key"), []byte("b")))
+	v, err := a.Get(table, []byte("key"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("a"), v)
+	v, err = base.Get([]byte("b_table"), []byte("key"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("b"), v)
+
+	entries, err := a.List(table)
+	assert.FatalError(t, err)
+	assert.Len(t, 1, entries)
+	assert.Equals(t, table, entries[0].Bucket)
+
+	_, swapped, err := a.CmpAndSwap(table, []byte("key"), []byte("a"), []byte("aa"))
+	assert.FatalError(t, err)
+	assert.True(t, swapped)
+
+	tx := new(database.Tx)
+	tx.Set(table, []byte("other"), []byte("bb"))
+	tx.Del(table, []byte("key"))
+	assert.FatalError(t, b.Update(tx))
+	for _, op := range tx.Operations {
+		assert.Equals(t, table, op.Bucket)
+	}
+	_, err = b.Get(table, []byte("key"))
+	assert.True(t, nosql.IsErrNotFound(err))
+	v, err = a.Get(table, []byte("key"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("aa"), v)
+
+	assert.FatalError(t, a.Del(table, []byte("key")))
+	assert.FatalError(t, a.DeleteTable(table))
+	_, err = b.Get(table, []byte("other"))
+	assert.FatalError(t, err)
+}
+
+func TestNew_tablePrefix(t *testing.T) {
+	_, err := New(&Config{Type: MemoryType, TablePrefix: "tenant-1"})
+	assert.Error(t, err)
+
+	adb, err := New(&Config{Type: MemoryType, TablePrefix: "tenant_1_"})
+	assert.FatalError(t, err)
+	defer adb.Shutdown()
+	ok, err := adb.UseToken("id", "token")
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+}
@@ -0,0 +1,278 @@
+package db
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// redisTimeout is the maximum time to connect to redis or to run a command.
+const redisTimeout = 5 * time.Second
+
+// redisMaxIdle is the maximum number of idle connections kept open.
+const redisMaxIdle = 8
+
+// redisStore is a ReplayStore that keeps the used tokens in redis. The tokens
+// are stored with SET NX, so only the first use succeeds, and they expire
+// with the token, after a grace period for the clock skew, or after the ttl if
+// the token does not have an expiration.
+type redisStore struct {
+	addr     string
+	tls      *tls.Config
+	username string
+	password string
+	database int
+	prefix   string
+	ttl      time.Duration
+	timeout  time.Duration
+	idle     chan *redisConn
+}
+
+func newRedisStore(dataSource, prefix string, ttl time.Duration) (*redisStore, error) {
+	u, err := url.Parse(dataSource)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing redis data source %s", dataSource)
+	}
+	s := &redisStore{
+		addr:    u.Host,
+		prefix:  prefix,
+		ttl:     ttl,
+		timeout: redisTimeout,
+		idle:    make(chan *redisConn, redisMaxIdle),
+	}
+	switch u.Scheme {
+	case "redis":
+	case "rediss":
+		s.tls = &tls.Config{ServerName: u.Hostname()}
+	default:
+		return nil, errors.Errorf("unsupported redis data source %s: scheme must be redis or rediss", dataSource)
+	}
+	if u.Port() == "" {
+		s.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		if p, ok := u.User.Password(); ok {
+			s.username, s.password = u.User.Username(), p
+		} else {
+			s.password = u.User.Username()
+		}
+	}
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		if s.database, err = strconv.Atoi(path); err != nil {
+			return nil, errors.Errorf("error parsing redis data source %s: invalid database %s", dataSource, path)
+		}
+	}
+
+	// Check the connection.
+	if _, err := s.do("PING"); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// UseToken stores the token with the given id if it does not exist. It
+// returns true if the token was stored, false if it was already used.
+func (s *redisStore) UseToken(id, tok string) (bool, error) {
+	ttl := strconv.FormatInt(int64(s.tokenTTL(tok, time.Now())/time.Millisecond), 10)
+	reply, err := s.do("SET", s.prefix+id, tok, "NX", "PX", ttl)
+	if err != nil {
+		return false, errors.Wrapf(err, "error storing used token %s", id)
+	}
+	// SET NX returns OK or a nil reply if the key already exists.
+	switch reply {
+	case "OK":
+		return true, nil
+	case nil:
+		return false, nil
+	default:
+		return false, errors.Errorf("error storing used token %s: unexpected reply %v", id, reply)
+	}
+}
+
+// tokenTTL returns the time the given token must be kept, until it expires
+// and the grace period for the clock skew ends, or the ttl if the token does
+// not have an expiration.
+func (s *redisStore) tokenTTL(tok string, now time.Time) time.Duration {
+	exp, ok := tokenExpiration(tok)
+	if !ok {
+		return s.ttl
+	}
+	if d := exp.Add(tokenGracePeriod).Sub(now); d > time.Second {
+		return d
+	}
+	return time.Second
+}
+
+// IsTokenUsed returns true if the token with the given id exists.
+func (s *redisStore) IsTokenUsed(id string) (bool, error) {
+	reply, err := s.do("EXISTS", s.prefix+id)
+	if err != nil {
+		return false, errors.Wrapf(err, "error loading used token %s", id)
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return false, errors.Errorf("error loading used token %s: unexpected reply %v", id, reply)
+	}
+	return n > 0, nil
+}
+
+// Close closes the idle connections.
+func (s *redisStore) Close() error {
+	for {
+		select {
+		case c := <-s.idle:
+			c.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// do runs a command and returns the reply, a string, an int64 or nil.
+func (s *redisStore) do(args ...string) (interface{}, error) {
+	c, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+	reply, err := c.do(args...)
+	if err != nil {
+		// Errors returned by the server do not break the connection.
+		if _, ok := err.(redisError); ok {
+			s.put(c)
+		} else {
+			c.Close()
+		}
+		return nil, err
+	}
+	s.put(c)
+	return reply, nil
+}
+
+// get returns an idle connection or a new one.
+func (s *redisStore) get() (*redisConn, error) {
+	select {
+	case c := <-s.idle:
+		return c, nil
+	default:
+	}
+
+	dialer := &net.Dialer{Timeout: s.timeout}
+	var conn net.Conn
+	var err error
+	if s.tls != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.addr, s.tls)
+	} else {
+		conn, err = dialer.Dial("tcp", s.addr)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "error connecting to redis %s", s.addr)
+	}
+	c := &redisConn{Conn: conn, r: bufio.NewReader(conn), timeout: s.timeout}
+	if s.password != "" {
+		args := []string{"AUTH", s.password}
+		if s.username != "" {
+			args = []string{"AUTH", s.username, s.password}
+		}
+		if _, err := c.do(args...); err != nil {
+			c.Close()
+			return nil, errors.Wrap(err, "error authenticating to redis")
+		}
+	}
+	if s.database != 0 {
+		if _, err := c.do("SELECT", strconv.Itoa(s.database)); err != nil {
+			c.Close()
+			return nil, errors.Wrapf(err, "error selecting redis database %d", s.database)
+		}
+	}
+	return c, nil
+}
+
+// put returns the connection to the idle connections, or closes it if there
+// are too many.
+func (s *redisStore) put(c *redisConn) {
+	select {
+	case s.idle <- c:
+	default:
+		c.Close()
+	}
+}
+
+// redisError is an error reply from redis.
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// redisConn is a connection to redis that implements the subset of the RESP
+// protocol required by the redisStore.
+type redisConn struct {
+	net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+}
+
+// do sends a command and reads its reply.
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	if err := c.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.Conn, b.String()); err != nil {
+		return nil, errors.Wrap(err, "error writing redis command")
+	}
+	return c.readReply()
+}
+
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, errors.Wrap(err, "error reading redis reply")
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("error reading redis reply: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		n, err := strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading redis reply %s", line)
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, errors.Wrapf(err, "error reading redis reply %s", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, errors.Wrap(err, "error reading redis reply")
+		}
+		if buf[n] != '\r' || buf[n+1] != '\n' {
+			return nil, errors.Errorf("error reading redis reply %s: invalid bulk string", line)
+		}
+		return string(buf[:n]), nil
+	default:
+		return nil, errors.Errorf("error reading redis reply: unsupported reply %s", line)
+	}
+}
@@ -0,0 +1,375 @@
+package db
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"github.com/smallstep/nosql"
+)
+
+// fakeRedis is a redis server that supports the commands used by the
+// redisStore. The replies of a command can be replaced with raw replies, or
+// with fakeRedisNoReply to never reply.
+type fakeRedis struct {
+	ln       net.Listener
+	password string
+	mu       sync.Mutex
+	keys     map[string]string
+	replies  map[string]string
+	commands []string
+}
+
+const fakeRedisNoReply = "no-reply"
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.FatalError(t, err)
+	s := &fakeRedis{ln: ln, password: password, keys: make(map[string]string), replies: make(map[string]string)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeRedis) Close() {
+	s.ln.Close()
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authenticated := s.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, strings.Join(args, " "))
+		reply, override := s.replies[args[0]]
+		switch {
+		case override:
+		case args[0] == "AUTH":
+			if args[len(args)-1] == s.password {
+				authenticated = true
+				reply = "+OK\r\n"
+			} else {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authenticated:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case args[0] == "PING":
+			reply = "+PONG\r\n"
+		case args[0] == "SELECT":
+			reply = "+OK\r\n"
+		case args[0] == "SET":
+			if _, ok := s.keys[args[1]]; ok {
+				reply = "$-1\r\n"
+			} else {
+				s.keys[args[1]] = args[2]
+				reply = "+OK\r\n"
+			}
+		case args[0] == "EXISTS":
+			if _, ok := s.keys[args[1]]; ok {
+				reply = ":1\r\n"
+			} else {
+				reply = ":0\r\n"
+			}
+		case args[0] == "GET":
+			if v, ok := s.keys[args[1]]; ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+			} else {
+				reply = "$-1\r\n"
+			}
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		s.mu.Unlock()
+		if reply == fakeRedisNoReply {
+			continue
+		}
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func TestNewReplayStore(t *testing.T) {
+	srv := newFakeRedis(t, "")
+	defer srv.Close()
+	addr := srv.ln.Addr().String()
+
+	tests := []struct {
+		name   string
+		config *ReplayConfig
+		err    string
+	}{
+		{"ok", &ReplayConfig{Type: "redis", DataSource: "redis://" + addr}, ""},
+		{"ok-ttl", &ReplayConfig{Type: "Redis", DataSource: "redis://" + addr + "/2", TTL: "1h"}, ""},
+		{"fail-type", &ReplayConfig{Type: "memcached", DataSource: "redis://" + addr}, "unsupported replay store type memcached"},
+		{"fail-ttl", &ReplayConfig{Type: "redis", DataSource: "redis://" + addr, TTL: "foo"}, "error parsing replay ttl foo"},
+		{"fail-ttl-zero", &ReplayConfig{Type: "redis", DataSource: "redis://" + addr, TTL: "0s"}, "replay ttl must be greater than 0"},
+		{"fail-scheme", &ReplayConfig{Type: "redis", DataSource: "http://" + addr}, "unsupported redis data source http://" + addr},
+		{"fail-database", &ReplayConfig{Type: "redis", DataSource: "redis://" + addr + "/foo"}, "error parsing redis data source redis://" + addr + "/foo: invalid database foo"},
+		{"fail-connect", &ReplayConfig{Type: "redis", DataSource: "redis://127.0.0.1:1"}, "error connecting to redis 127.0.0.1:1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := NewReplayStore(tt.config)
+			if tt.err != "" {
+				if assert.NotNil(t, err) {
+					assert.HasPrefix(t, err.Error(), tt.err)
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.NoError(t, store.Close())
+		})
+	}
+}
+
+func TestRedisStore_UseToken(t *testing.T) {
+	srv := newFakeRedis(t, "secret")
+	defer srv.Close()
+	addr := srv.ln.Addr().String()
+
+	_, err := NewReplayStore(&ReplayConfig{Type: "redis", DataSource: "redis://" + addr})
+	if assert.NotNil(t, err) {
+		assert.HasPrefix(t, err.Error(), "redis: NOAUTH")
+	}
+	_, err = NewReplayStore(&ReplayConfig{Type: "redis", DataSource: "redis://:bad@" + addr})
+	if assert.NotNil(t, err) {
+		assert.HasPrefix(t, err.Error(), "error authenticating to redis")
+	}
+
+	store, err := NewReplayStore(&ReplayConfig{Type: "redis", DataSource: "redis://:secret@" + addr + "/1", TTL: "5m"})
+	assert.FatalError(t, err)
+	defer store.Close()
+
+	ok, err := store.UseToken("foo", "token")
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+	ok, err = store.UseToken("foo", "token")
+	assert.FatalError(t, err)
+	assert.False(t, ok)
+	ok, err = store.UseToken("bar", "token")
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+	ok, err = store.IsTokenUsed("foo")
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+	ok, err = store.IsTokenUsed("baz")
+	assert.FatalError(t, err)
+	assert.False(t, ok)
+
+	srv.mu.Lock()
+	assert.Equals(t, map[string]string{
+		DefaultReplayKeyPrefix + "foo": "token",
+		DefaultReplayKeyPrefix + "bar": "token",
+	}, srv.keys)
+	assert.Equals(t, "SET "+DefaultReplayKeyPrefix+"foo token NX PX "+strconv.Itoa(int(5*time.Minute/time.Millisecond)), srv.commands[len(srv.commands)-5])
+	srv.mu.Unlock()
+
+	// Connections are reused.
+	s := store.(*redisStore)
+	assert.Len(t, 1, s.idle)
+	reply, err := s.do("GET", DefaultReplayKeyPrefix+"foo")
+	assert.FatalError(t, err)
+	assert.Equals(t, "token", reply)
+	_, err = s.do("FOO")
+	assert.Equals(t, redisError("ERR unknown command"), err)
+	assert.Len(t, 1, s.idle)
+
+	// Reconnects if the connection is closed.
+	(<-s.idle).Close()
+	s.idle <- &redisConn{Conn: &closedConn{}, r: bufio.NewReader(strings.NewReader("")), timeout: redisTimeout}
+	_, err = store.UseToken("baz", "token")
+	assert.NotNil(t, err)
+	ok, err = store.UseToken("baz", "token")
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+}
+
+func TestRedisStore_tokenTTL(t *testing.T) {
+	srv := newFakeRedis(t, "")
+	defer srv.Close()
+	store, err := NewReplayStore(&ReplayConfig{Type: "redis", DataSource: "redis://" + srv.ln.Addr().String(), TTL: "1h"})
+	assert.FatalError(t, err)
+	defer store.Close()
+	s := store.(*redisStore)
+
+	// The tokens are kept until they expire, and the grace period ends.
+	now := time.Now().Truncate(time.Second)
+	assert.Equals(t, time.Hour, s.tokenTTL("opaque", now))
+	assert.Equals(t, 10*time.Minute+tokenGracePeriod, s.tokenTTL(testToken(now.Add(10*time.Minute)), now))
+	assert.Equals(t, 100*24*time.Hour+tokenGracePeriod, s.tokenTTL(testToken(now.Add(100*24*time.Hour)), now))
+	assert.Equals(t, time.Second, s.tokenTTL(testToken(now.Add(-time.Hour)), now))
+
+	ok, err := store.UseToken("foo", testToken(now.Add(10*time.Minute)))
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+	srv.mu.Lock()
+	args := strings.Split(srv.commands[len(srv.commands)-1], " ")
+	srv.mu.Unlock()
+	if assert.Len(t, 6, args) {
+		assert.Equals(t, "PX", args[4])
+		px, err := strconv.Atoi(args[5])
+		assert.FatalError(t, err)
+		assert.True(t, px > int((10*time.Minute+tokenGracePeriod-time.Minute)/time.Millisecond))
+		assert.True(t, px <= int((10*time.Minute+tokenGracePeriod)/time.Millisecond))
+	}
+}
+
+func TestRedisStore_replies(t *testing.T) {
+	srv := newFakeRedis(t, "")
+	defer srv.Close()
+	store, err := NewReplayStore(&ReplayConfig{Type: "redis", DataSource: "redis://" + srv.ln.Addr().String()})
+	assert.FatalError(t, err)
+	defer store.Close()
+	s := store.(*redisStore)
+	s.timeout = 100 * time.Millisecond
+	setReply := func(cmd, reply string) {
+		srv.mu.Lock()
+		srv.replies[cmd] = reply
+		srv.mu.Unlock()
+	}
+
+	// Error replies do not break the connection.
+	setReply("SET", "-OOM command not allowed when used memory > 'maxmemory'\r\n")
+	_, err = store.UseToken("foo", "token")
+	if assert.NotNil(t, err) {
+		assert.Equals(t, "error storing used token foo: redis: OOM command not allowed when used memory > 'maxmemory'", err.Error())
+	}
+	assert.Len(t, 1, s.idle)
+	setReply("EXISTS", "-ERR wrong number of arguments\r\n")
+	_, err = store.IsTokenUsed("foo")
+	if assert.NotNil(t, err) {
+		assert.Equals(t, "error loading used token foo: redis: ERR wrong number of arguments", err.Error())
+	}
+
+	// Unexpected replies are errors.
+	setReply("SET", "+QUEUED\r\n")
+	_, err = store.UseToken("foo", "token")
+	if assert.NotNil(t, err) {
+		assert.Equals(t, "error storing used token foo: unexpected reply QUEUED", err.Error())
+	}
+	setReply("EXISTS", "+OK\r\n")
+	_, err = store.IsTokenUsed("foo")
+	if assert.NotNil(t, err) {
+		assert.Equals(t, "error loading used token foo: unexpected reply OK", err.Error())
+	}
+
+	// Invalid replies close the connection.
+	for _, reply := range []string{"$3\r\nfooXX", "$x\r\n", "*1\r\n"} {
+		setReply("SET", reply)
+		_, err = store.UseToken("foo", "token")
+		if assert.NotNil(t, err) {
+			assert.HasPrefix(t, err.Error(), "error storing used token foo: error reading redis reply")
+		}
+		assert.Len(t, 0, s.idle)
+	}
+
+	// Commands time out if redis does not reply.
+	setReply("SET", fakeRedisNoReply)
+	start := time.Now()
+	_, err = store.UseToken("foo", "token")
+	if assert.NotNil(t, err) {
+		assert.HasPrefix(t, err.Error(), "error storing used token foo: error reading redis reply")
+		if ne, ok := errors.Cause(err).(net.Error); assert.True(t, ok) {
+			assert.True(t, ne.Timeout())
+		}
+	}
+	assert.True(t, time.Since(start) < 5*time.Second)
+	assert.Len(t, 0, s.idle)
+
+	// A new connection is used after the errors.
+	srv.mu.Lock()
+	delete(srv.replies, "SET")
+	delete(srv.replies, "EXISTS")
+	srv.mu.Unlock()
+	ok, err := store.UseToken("foo", "token")
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+	ok, err = store.IsTokenUsed("foo")
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+}
+
+func TestReplayDB(t *testing.T) {
+	srv := newFakeRedis(t, "")
+	defer srv.Close()
+	store, err := NewReplayStore(&ReplayConfig{Type: "redis", DataSource: "redis://" + srv.ln.Addr().String(), KeyPrefix: "test:"})
+	assert.FatalError(t, err)
+
+	nosqlDB := newMemoryNoSQLDB()
+	db := &replayDB{DB: &DB{nosqlDB, true}, store: store}
+	ok, err := db.UseToken("foo", "token")
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+	ok, err = db.UseToken("foo", "token")
+	assert.FatalError(t, err)
+	assert.False(t, ok)
+	ok, err = db.IsTokenUsed("foo")
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+	srv.mu.Lock()
+	assert.Equals(t, "token", srv.keys["test:foo"])
+	srv.mu.Unlock()
+	// The token is not stored in the database.
+	_, err = nosqlDB.Get(usedOTTTable, []byte("foo"))
+	assert.True(t, nosql.IsErrNotFound(err))
+	// The ACME authority uses the database as a nosql.DB.
+	var _ nosql.DB = db
+	assert.NoError(t, db.Shutdown())
+}
+
+// closedConn is a net.Conn that fails on every operation.
+type closedConn struct {
+	net.Conn
+}
+
+func (c *closedConn) Write(b []byte) (int, error)   { return 0, io.ErrClosedPipe }
+func (c *closedConn) Close() error                  { return nil }
+func (c *closedConn) SetDeadline(t time.Time) error { return nil }
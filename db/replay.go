@@ -0,0 +1,90 @@
+package db
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultReplayTTL is the default time that an external replay store keeps
+// the used tokens without an expiration. The other tokens are kept until they
+// expire.
+const DefaultReplayTTL = 24 * time.Hour
+
+// DefaultReplayKeyPrefix is the default prefix of the keys of the used tokens
+// in an external replay store.
+const DefaultReplayKeyPrefix = "step-ca:ott:"
+
+// ReplayConfig is the configuration of an external store for the used
+// one-time tokens. Multiple CAs sharing the same store will reject the tokens
+// used in any of them. The only supported type is redis, the data source is
+// a URL like redis://:password@localhost:6379/0, or rediss:// to use TLS.
+type ReplayConfig struct {
+	Type       string `json:"type"`
+	DataSource string `json:"dataSource"`
+	KeyPrefix  string `json:"keyPrefix,omitempty"`
+	TTL        string `json:"ttl,omitempty"`
+}
+
+// ReplayStore is the interface implemented by the stores of the used one-time
+// tokens.
+type ReplayStore interface {
+	UseToken(id, tok string) (bool, error)
+	IsTokenUsed(id string) (bool, error)
+	Close() error
+}
+
+// NewReplayStore returns the ReplayStore for the given configuration.
+func NewReplayStore(c *ReplayConfig) (ReplayStore, error) {
+	ttl := DefaultReplayTTL
+	if c.TTL != "" {
+		d, err := time.ParseDuration(c.TTL)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing replay ttl %s", c.TTL)
+		}
+		if d <= 0 {
+			return nil, errors.New("replay ttl must be greater than 0")
+		}
+		ttl = d
+	}
+	prefix := c.KeyPrefix
+	if prefix == "" {
+		prefix = DefaultReplayKeyPrefix
+	}
+	switch strings.ToLower(c.Type) {
+	case "redis":
+		return newRedisStore(c.DataSource, prefix, ttl)
+	default:
+		return nil, errors.Errorf("unsupported replay store type %s", c.Type)
+	}
+}
+
+// replayDB is an AuthDB that uses an external ReplayStore for the used
+// one-time tokens. It embeds a *DB so it can still be used as a nosql.DB by
+// the ACME authority.
+type replayDB struct {
+	*DB
+	store ReplayStore
+}
+
+// UseToken returns true if the token is stored for the first time in the
+// replay store, false otherwise.
+func (db *replayDB) UseToken(id, tok string) (bool, error) {
+	return db.store.UseToken(id, tok)
+}
+
+// IsTokenUsed returns true if the token with the given id is in the replay
+// store.
+func (db *replayDB) IsTokenUsed(id string) (bool, error) {
+	return db.store.IsTokenUsed(id)
+}
+
+// Shutdown closes the replay store and the database.
+func (db *replayDB) Shutdown() error {
+	err := db.store.Close()
+	if dbErr := db.DB.Shutdown(); dbErr != nil {
+		return dbErr
+	}
+	return errors.Wrap(err, "replay store shutdown error")
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql"
+	"github.com/smallstep/nosql/database"
+)
+
+// ErrReadOnly is returned when a write is attempted on a read replica.
+var ErrReadOnly = errors.New("database is read-only")
+
+// ReplicaConfig is the configuration of a read-only replica of the database,
+// used by the endpoints that report the issued certificates, the stats, the
+// journal and the transparency log. The type and the database default to the
+// ones of the primary database. The replica is kept up to date by the
+// database, the CA never writes to it.
+type ReplicaConfig struct {
+	Type       string `json:"type,omitempty"`
+	DataSource string `json:"dataSource"`
+	ValueDir   string `json:"valueDir,omitempty"`
+	Database   string `json:"database,omitempty"`
+}
+
+// Validate validates the replica configuration.
+func (c *ReplicaConfig) Validate() error {
+	switch {
+	case c == nil:
+		return nil
+	case c.DataSource == "":
+		return errors.New("readReplica dataSource cannot be empty")
+	case c.Type == MemoryType:
+		return errors.New("readReplica type memory is not supported")
+	default:
+		return nil
+	}
+}
+
+// NewReadReplica returns a read-only client of the replica configured in the
+// given database configuration. The pool, encryption and table prefix
+// settings of the primary database also apply to the replica. The tables are
+// not created and the schema is not migrated, the replica gets them from the
+// primary.
+func NewReadReplica(c *Config) (AuthDB, error) {
+	r := c.ReadReplica
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	typ, name := r.Type, r.Database
+	if typ == "" {
+		typ = c.Type
+	}
+	if name == "" {
+		name = c.Database
+	}
+	if typ == MemoryType {
+		return nil, errors.New("readReplica type memory is not supported")
+	}
+
+	db, err := nosql.New(typ, r.DataSource, nosql.WithDatabase(name),
+		nosql.WithValueDir(r.ValueDir))
+	if err != nil {
+		return nil, errors.Wrapf(err, "Error opening read replica of Type %s with source %s", typ, r.DataSource)
+	}
+	if c.Pool != nil {
+		db = newPooledDB(db, c.Pool)
+	}
+	db = newPrefixedDB(db, c.TablePrefix)
+	if c.Encryption != nil {
+		edb, err := newEncryptedDB(db, c.Encryption)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		db = edb
+	}
+	return &DB{&readOnlyDB{db}, true}, nil
+}
+
+// readOnlyDB is a nosql.DB that rejects the writes.
+type readOnlyDB struct {
+	nosql.DB
+}
+
+// Set returns ErrReadOnly.
+func (db *readOnlyDB) Set(bucket, key, value []byte) error {
+	return ErrReadOnly
+}
+
+// Del returns ErrReadOnly.
+func (db *readOnlyDB) Del(bucket, key []byte) error {
+	return ErrReadOnly
+}
+
+// CmpAndSwap returns ErrReadOnly.
+func (db *readOnlyDB) CmpAndSwap(bucket, key, oldValue, newValue []byte) ([]byte, bool, error) {
+	return nil, false, ErrReadOnly
+}
+
+// Update returns ErrReadOnly.
+func (db *readOnlyDB) Update(tx *database.Tx) error {
+	return ErrReadOnly
+}
+
+// CreateTable returns ErrReadOnly.
+func (db *readOnlyDB) CreateTable(bucket []byte) error {
+	return ErrReadOnly
+}
+
+// DeleteTable returns ErrReadOnly.
+func (db *readOnlyDB) DeleteTable(bucket []byte) error {
+	return ErrReadOnly
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/nosql"
+	"github.com/smallstep/nosql/database"
+)
+
+func TestReplicaConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name   string
+		config *ReplicaConfig
+		err    string
+	}{
+		{"nil", nil, ""},
+		{"ok", &ReplicaConfig{Type: "mysql", DataSource: "user:password@tcp(replica:3306)/"}, ""},
+		{"ok/primary-type", &ReplicaConfig{DataSource: "user:password@tcp(replica:3306)/"}, ""},
+		{"fail/data-source", &ReplicaConfig{Type: "mysql"}, "readReplica dataSource cannot be empty"},
+		{"fail/memory", &ReplicaConfig{Type: MemoryType, DataSource: "foo"}, "readReplica type memory is not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.err != "" {
+				if assert.NotNil(t, err) {
+					assert.Equals(t, tt.err, err.Error())
+				}
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestNewReadReplica(t *testing.T) {
+	_, err := NewReadReplica(&Config{Type: MemoryType, ReadReplica: &ReplicaConfig{DataSource: "foo"}})
+	assert.Equals(t, "readReplica type memory is not supported", err.Error())
+
+	_, err = NewReadReplica(&Config{Type: "mysql", ReadReplica: &ReplicaConfig{}})
+	assert.Equals(t, "readReplica dataSource cannot be empty", err.Error())
+}
+
+func TestReadOnlyDB(t *testing.T) {
+	mem := newMemoryNoSQLDB()
+	assert.FatalError(t, mem.Set(certsTable, []byte("1"), []byte("foo")))
+	adb := &DB{&readOnlyDB{mem}, true}
+
+	b, err := adb.Get(certsTable, []byte("1"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte("foo"), b)
+
+	assert.Equals(t, ErrReadOnly, adb.Set(certsTable, []byte("2"), []byte("bar")))
+	assert.Equals(t, ErrReadOnly, adb.Del(certsTable, []byte("1")))
+	_, _, err = adb.CmpAndSwap(certsTable, []byte("2"), nil, []byte("bar"))
+	assert.Equals(t, ErrReadOnly, err)
+	assert.Equals(t, ErrReadOnly, adb.Update(&database.Tx{}))
+	assert.Equals(t, ErrReadOnly, adb.CreateTable([]byte("foo")))
+	assert.Equals(t, ErrReadOnly, adb.DeleteTable(certsTable))
+	_, err = adb.Get(certsTable, []byte("2"))
+	assert.True(t, nosql.IsErrNotFound(err))
+}
@@ -0,0 +1,362 @@
+package db
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql"
+)
+
+// DefaultGCInterval is the default interval between the runs of the garbage
+// collector.
+const DefaultGCInterval = time.Hour
+
+// Kinds of records pruned by the garbage collector.
+const (
+	RetentionCertificates = "certificates"
+	RetentionTokens       = "tokens"
+	RetentionACMEOrders   = "acmeOrders"
+)
+
+// RetentionConfig is the retention policy of the database. Each attribute is
+// the time a kind of record is kept after it expires, records of a kind
+// without retention are never deleted. Certificates expire at their NotAfter,
+// used tokens at their exp claim and ACME orders at their expiration, or the
+// expiration of their certificate if it is later.
+type RetentionConfig struct {
+	Interval     string `json:"interval,omitempty"`
+	Certificates string `json:"certificates,omitempty"`
+	Tokens       string `json:"tokens,omitempty"`
+	ACMEOrders   string `json:"acmeOrders,omitempty"`
+}
+
+// Validate validates the retention policy.
+func (c *RetentionConfig) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.Interval != "" {
+		d, err := time.ParseDuration(c.Interval)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing retention interval %s", c.Interval)
+		}
+		if d <= 0 {
+			return errors.New("retention interval must be greater than 0")
+		}
+	}
+	for _, kind := range []string{RetentionCertificates, RetentionTokens, RetentionACMEOrders} {
+		if _, _, err := c.retention(kind); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetInterval returns the interval between the runs of the garbage collector.
+func (c *RetentionConfig) GetInterval() time.Duration {
+	if c == nil || c.Interval == "" {
+		return DefaultGCInterval
+	}
+	d, err := time.ParseDuration(c.Interval)
+	if err != nil || d <= 0 {
+		return DefaultGCInterval
+	}
+	return d
+}
+
+// Retention returns the retention of the given kind of record, and false if
+// the records are never deleted.
+func (c *RetentionConfig) Retention(kind string) (time.Duration, bool) {
+	d, ok, err := c.retention(kind)
+	if err != nil {
+		return 0, false
+	}
+	return d, ok
+}
+
+func (c *RetentionConfig) retention(kind string) (time.Duration, bool, error) {
+	if c == nil {
+		return 0, false, nil
+	}
+	var s string
+	switch kind {
+	case RetentionCertificates:
+		s = c.Certificates
+	case RetentionTokens:
+		s = c.Tokens
+	case RetentionACMEOrders:
+		s = c.ACMEOrders
+	}
+	if s == "" {
+		return 0, false, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, false, errors.Wrapf(err, "error parsing %s retention %s", kind, s)
+	}
+	if d < 0 {
+		return 0, false, errors.Errorf("%s retention cannot be negative", kind)
+	}
+	return d, true, nil
+}
+
+// PruneResult is the number of records deleted by a prune operation and their
+// size, the sum of the lengths of their keys and values.
+type PruneResult struct {
+	Records int
+	Bytes   int64
+}
+
+// add adds a deleted record to the result.
+func (r *PruneResult) add(key, value []byte) {
+	r.Records++
+	r.Bytes += int64(len(key) + len(value))
+}
+
+// PruneFunc deletes the records that expired before the given time.
+type PruneFunc func(before time.Time) (*PruneResult, error)
+
+// PrunerStats are the metrics of a pruner of the garbage collector since the
+// CA started.
+type PrunerStats struct {
+	Name      string     `json:"name"`
+	Retention string     `json:"retention"`
+	Runs      int64      `json:"runs"`
+	Records   int64      `json:"records"`
+	Bytes     int64      `json:"bytes"`
+	LastRun   *time.Time `json:"lastRun,omitempty"`
+	LastError string     `json:"lastError,omitempty"`
+}
+
+type pruner struct {
+	retention time.Duration
+	prune     PruneFunc
+	stats     PrunerStats
+}
+
+// GarbageCollector runs periodically the registered pruners.
+type GarbageCollector struct {
+	interval time.Duration
+	mu       sync.Mutex
+	pruners  map[string]*pruner
+	elector  *Elector
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewGarbageCollector returns a GarbageCollector for the given retention
+// policy, with the pruners of the certificates and the used tokens of the
+// database if they have a retention.
+func NewGarbageCollector(c *RetentionConfig, db AuthDB) *GarbageCollector {
+	gc := &GarbageCollector{
+		interval: c.GetInterval(),
+		pruners:  make(map[string]*pruner),
+	}
+	if d, ok := c.Retention(RetentionCertificates); ok {
+		gc.Register(RetentionCertificates, d, db.PruneCertificates)
+	}
+	if d, ok := c.Retention(RetentionTokens); ok {
+		gc.Register(RetentionTokens, d, db.PruneTokens)
+	}
+	return gc
+}
+
+// Register adds a pruner with the given name and retention, a pruner with the
+// same name is replaced.
+func (gc *GarbageCollector) Register(name string, retention time.Duration, fn PruneFunc) {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	p := &pruner{retention: retention, prune: fn}
+	if old, ok := gc.pruners[name]; ok {
+		p.stats = old.stats
+	}
+	p.stats.Name = name
+	p.stats.Retention = retention.String()
+	gc.pruners[name] = p
+}
+
+// SetElector sets the elector used by the background runs when multiple
+// instances share the database, only the leader runs the pruners. It must be
+// called before Start.
+func (gc *GarbageCollector) SetElector(e *Elector) {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	gc.elector = e
+}
+
+// Run runs all the pruners once. The errors are logged and recorded in the
+// stats of the pruner.
+func (gc *GarbageCollector) Run(now time.Time) {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	for name, p := range gc.pruners {
+		res, err := p.prune(now.Add(-p.retention))
+		p.stats.Runs++
+		p.stats.LastRun = &now
+		if err != nil {
+			p.stats.LastError = err.Error()
+			if err != ErrNotImplemented {
+				log.Printf("error pruning %s: %v", name, err)
+			}
+			continue
+		}
+		p.stats.LastError = ""
+		p.stats.Records += int64(res.Records)
+		p.stats.Bytes += res.Bytes
+		if res.Records > 0 {
+			log.Printf("pruned %d %s, %d bytes", res.Records, name, res.Bytes)
+		}
+	}
+}
+
+// Start runs the pruners in the background on every interval until Stop is
+// called.
+func (gc *GarbageCollector) Start() {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	if gc.stop != nil {
+		return
+	}
+	gc.stop = make(chan struct{})
+	gc.done = make(chan struct{})
+	go func(stop, done chan struct{}, elector *Elector) {
+		defer close(done)
+		ticker := time.NewTicker(gc.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				if elector == nil || elector.IsLeader() {
+					gc.Run(now)
+				}
+			}
+		}
+	}(gc.stop, gc.done, gc.elector)
+}
+
+// Stop stops the background runs, waits for the current one to finish and
+// releases the lease of the elector.
+func (gc *GarbageCollector) Stop() {
+	gc.mu.Lock()
+	stop, done, elector := gc.stop, gc.done, gc.elector
+	gc.stop, gc.done = nil, nil
+	gc.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+		if elector != nil {
+			if err := elector.Resign(); err != nil {
+				log.Printf("error releasing lease: %v", err)
+			}
+		}
+	}
+}
+
+// Stats returns the metrics of the pruners sorted by name.
+func (gc *GarbageCollector) Stats() []*PrunerStats {
+	gc.mu.Lock()
+	defer gc.mu.Unlock()
+	stats := make([]*PrunerStats, 0, len(gc.pruners))
+	for _, p := range gc.pruners {
+		s := p.stats
+		stats = append(stats, &s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+	return stats
+}
+
+// tokenExpiration returns the exp claim of a JWT without validating it. It
+// returns false if the token does not have an expiration.
+func tokenExpiration(tok string) (time.Time, bool) {
+	parts := strings.Split(tok, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Expiry int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(b, &claims); err != nil || claims.Expiry == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(claims.Expiry, 0), true
+}
+
+// PruneCertificates deletes the certificates that expired before the given
+// time, with their metadata, revocation information, expiry notifications and
+// index entries.
+func (db *DB) PruneCertificates(before time.Time) (*PruneResult, error) {
+	entries, err := db.List(certsTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "database List error")
+	}
+	res := new(PruneResult)
+	for _, e := range entries {
+		crt, err := x509.ParseCertificate(e.Value)
+		if err != nil {
+			return res, errors.Wrapf(err, "error parsing certificate %s", string(e.Key))
+		}
+		if !crt.NotAfter.Before(before) {
+			continue
+		}
+		if err := db.unindexCertificate(crt); err != nil {
+			return res, err
+		}
+		for _, table := range [][]byte{certsDataTable, revokedCertsTable, expiryNotificationsTable} {
+			b, err := db.Get(table, e.Key)
+			switch {
+			case err == nil:
+				if err := db.journalDelete(JournalRetention, table, e.Key, b); err != nil {
+					return res, err
+				}
+				if err := db.Del(table, e.Key); err != nil {
+					return res, errors.Wrap(err, "database Del error")
+				}
+				res.add(e.Key, b)
+			case !nosql.IsErrNotFound(err):
+				return res, errors.Wrap(err, "database Get error")
+			}
+		}
+		if err := db.journalDelete(JournalRetention, certsTable, e.Key, e.Value); err != nil {
+			return res, err
+		}
+		if err := db.Del(certsTable, e.Key); err != nil {
+			return res, errors.Wrap(err, "database Del error")
+		}
+		res.add(e.Key, e.Value)
+	}
+	return res, nil
+}
+
+// PruneTokens deletes the used one-time tokens that expired before the given
+// time. Tokens without an expiration are kept.
+func (db *DB) PruneTokens(before time.Time) (*PruneResult, error) {
+	entries, err := db.List(usedOTTTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "database List error")
+	}
+	res := new(PruneResult)
+	for _, e := range entries {
+		if exp, ok := tokenExpiration(string(e.Value)); ok && exp.Before(before) {
+			if err := db.Del(usedOTTTable, e.Key); err != nil {
+				return res, errors.Wrap(err, "database Del error")
+			}
+			res.add(e.Key, e.Value)
+		}
+	}
+	return res, nil
+}
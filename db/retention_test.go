@@ -0,0 +1,215 @@
+package db
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"github.com/smallstep/nosql"
+	"github.com/smallstep/nosql/database"
+)
+
+func testToken(exp time.Time) string {
+	payload := fmt.Sprintf(`{"sub":"test.smallstep.com","exp":%d}`, exp.Unix())
+	return "eyJhbGciOiJFUzI1NiJ9." + base64.RawURLEncoding.EncodeToString([]byte(payload)) + ".c2lnbmF0dXJl"
+}
+
+func TestRetentionConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   *RetentionConfig
+		interval time.Duration
+		certs    time.Duration
+		tokens   time.Duration
+		orders   time.Duration
+		err      string
+	}{
+		{"nil", nil, DefaultGCInterval, -1, -1, -1, ""},
+		{"empty", &RetentionConfig{}, DefaultGCInterval, -1, -1, -1, ""},
+		{"ok", &RetentionConfig{Interval: "10m", Certificates: "720h", Tokens: "0s", ACMEOrders: "24h"}, 10 * time.Minute, 720 * time.Hour, 0, 24 * time.Hour, ""},
+		{"fail-interval", &RetentionConfig{Interval: "foo"}, 0, 0, 0, 0, "error parsing retention interval foo"},
+		{"fail-interval-zero", &RetentionConfig{Interval: "0s"}, 0, 0, 0, 0, "retention interval must be greater than 0"},
+		{"fail-certificates", &RetentionConfig{Certificates: "foo"}, 0, 0, 0, 0, "error parsing certificates retention foo"},
+		{"fail-tokens", &RetentionConfig{Tokens: "-1h"}, 0, 0, 0, 0, "tokens retention cannot be negative"},
+		{"fail-orders", &RetentionConfig{ACMEOrders: "1d"}, 0, 0, 0, 0, "error parsing acmeOrders retention 1d"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.err != "" {
+				if assert.NotNil(t, err) {
+					assert.HasPrefix(t, err.Error(), tt.err)
+				}
+				return
+			}
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.interval, tt.config.GetInterval())
+			for kind, want := range map[string]time.Duration{
+				RetentionCertificates: tt.certs,
+				RetentionTokens:       tt.tokens,
+				RetentionACMEOrders:   tt.orders,
+			} {
+				d, ok := tt.config.Retention(kind)
+				if want < 0 {
+					assert.False(t, ok)
+				} else {
+					assert.True(t, ok)
+					assert.Equals(t, want, d)
+				}
+			}
+		})
+	}
+}
+
+func TestGarbageCollector(t *testing.T) {
+	now := time.Date(2019, 10, 1, 0, 0, 0, 0, time.UTC)
+	var befores []time.Time
+	gc := NewGarbageCollector(&RetentionConfig{Certificates: "24h"}, &DB{&MockNoSQLDB{
+		MList: func(bucket []byte) ([]*database.Entry, error) {
+			return nil, errors.New("force")
+		},
+	}, true})
+	gc.Register("test", time.Hour, func(before time.Time) (*PruneResult, error) {
+		befores = append(befores, before)
+		return &PruneResult{Records: 2, Bytes: 100}, nil
+	})
+	gc.Register("disabled", 0, func(before time.Time) (*PruneResult, error) {
+		return nil, ErrNotImplemented
+	})
+
+	gc.Run(now)
+	gc.Run(now)
+	assert.Equals(t, []time.Time{now.Add(-time.Hour), now.Add(-time.Hour)}, befores)
+	assert.Equals(t, []*PrunerStats{
+		{Name: "certificates", Retention: "24h0m0s", Runs: 2, LastRun: &now, LastError: "database List error: force"},
+		{Name: "disabled", Retention: "0s", Runs: 2, LastRun: &now, LastError: ErrNotImplemented.Error()},
+		{Name: "test", Retention: "1h0m0s", Runs: 2, Records: 4, Bytes: 200, LastRun: &now},
+	}, gc.Stats())
+
+	// The stats are kept if a pruner is replaced.
+	gc.Register("test", 2*time.Hour, func(before time.Time) (*PruneResult, error) {
+		return &PruneResult{}, nil
+	})
+	stats := gc.Stats()
+	assert.Equals(t, "2h0m0s", stats[2].Retention)
+	assert.Equals(t, int64(4), stats[2].Records)
+
+	// Background runs.
+	gc = NewGarbageCollector(&RetentionConfig{Interval: "10ms"}, nil)
+	runs := make(chan time.Time, 10)
+	gc.Register("test", time.Hour, func(before time.Time) (*PruneResult, error) {
+		runs <- before
+		return &PruneResult{}, nil
+	})
+	gc.Start()
+	gc.Start()
+	select {
+	case <-runs:
+	case <-time.After(time.Second):
+		t.Fatal("garbage collector did not run")
+	}
+	gc.Stop()
+	gc.Stop()
+}
+
+func TestDB_PruneCertificates(t *testing.T) {
+	now := time.Now()
+	db := &DB{newMemoryNoSQLDB(), true}
+	expired := newTestCertificate(t, 1, "db.internal", now.Add(-time.Hour), "db.internal", "10.0.0.1")
+	active := newTestCertificate(t, 2, "db.internal", now.Add(time.Hour), "db.internal")
+	assert.FatalError(t, db.StoreCertificate(expired))
+	assert.FatalError(t, db.StoreCertificate(active))
+	assert.FatalError(t, db.StoreCertificateData("1", &CertificateData{Provisioner: &ProvisionerData{Name: "step-cli"}}))
+	assert.FatalError(t, db.Revoke(&RevokedCertificateInfo{Serial: "1"}))
+
+	res, err := db.PruneCertificates(now.Add(-2 * time.Hour))
+	assert.FatalError(t, err)
+	assert.Equals(t, &PruneResult{}, res)
+
+	res, err = db.PruneCertificates(now)
+	assert.FatalError(t, err)
+	// The certificate, its data and its revocation info.
+	assert.Equals(t, 3, res.Records)
+	assert.True(t, res.Bytes > int64(len(expired.Raw)))
+
+	_, err = db.GetCertificate("1")
+	assert.Equals(t, ErrNotFound, err)
+	data, err := db.GetCertificateData("1")
+	assert.FatalError(t, err)
+	assert.Nil(t, data)
+	_, err = db.Get(revokedCertsTable, []byte("1"))
+	assert.True(t, nosql.IsErrNotFound(err))
+	_, err = db.Get(certsSANIndexTable, []byte("10.0.0.1"))
+	assert.True(t, nosql.IsErrNotFound(err))
+	certs, err := db.GetCertificatesBySAN("db.internal")
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"2"}, serialNumbers(certs))
+	certs, err = db.GetCertificatesByCommonName("db.internal")
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"2"}, serialNumbers(certs))
+
+	// The deleted records leave a tombstone.
+	journal, err := db.GetJournal()
+	assert.FatalError(t, err)
+	tombstones := []string{}
+	for _, e := range journal {
+		if e.Operation == JournalDelete {
+			assert.Equals(t, JournalRetention, e.Actor)
+			assert.Equals(t, "1", e.Key)
+			tombstones = append(tombstones, e.Table)
+		}
+	}
+	assert.Equals(t, []string{"x509_certs_data", "revoked_x509_certs", "x509_certs"}, tombstones)
+
+	db = &DB{&MockNoSQLDB{
+		MList: func(bucket []byte) ([]*database.Entry, error) {
+			return nil, errors.New("force")
+		},
+	}, true}
+	_, err = db.PruneCertificates(now)
+	if assert.NotNil(t, err) {
+		assert.Equals(t, "database List error: force", err.Error())
+	}
+}
+
+func TestDB_PruneTokens(t *testing.T) {
+	now := time.Now()
+	expired, active := testToken(now.Add(-time.Minute)), testToken(now.Add(time.Minute))
+
+	db := &DB{newMemoryNoSQLDB(), true}
+	for id, tok := range map[string]string{"expired": expired, "active": active, "opaque": "foo"} {
+		ok, err := db.UseToken(id, tok)
+		assert.FatalError(t, err)
+		assert.True(t, ok)
+	}
+	res, err := db.PruneTokens(now)
+	assert.FatalError(t, err)
+	assert.Equals(t, &PruneResult{Records: 1, Bytes: int64(len("expired") + len(expired))}, res)
+	_, err = db.Get(usedOTTTable, []byte("expired"))
+	assert.True(t, nosql.IsErrNotFound(err))
+	for _, id := range []string{"active", "opaque"} {
+		_, err = db.Get(usedOTTTable, []byte(id))
+		assert.FatalError(t, err)
+	}
+
+	sdb, err := newSimpleDB(nil)
+	assert.FatalError(t, err)
+	simple := sdb.(*SimpleDB)
+	for id, tok := range map[string]string{"expired": expired, "active": active} {
+		ok, err := simple.UseToken(id, tok)
+		assert.FatalError(t, err)
+		assert.True(t, ok)
+	}
+	res, err = simple.PruneTokens(now)
+	assert.FatalError(t, err)
+	assert.Equals(t, 1, res.Records)
+	ok, err := simple.UseToken("expired", expired)
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+	ok, err = simple.UseToken("active", active)
+	assert.FatalError(t, err)
+	assert.False(t, ok)
+}
@@ -2,7 +2,6 @@ package db
 
 import (
 	"crypto/x509"
-	"sync"
 	"time"
 
 	"github.com/pkg/errors"
@@ -16,12 +15,12 @@ var ErrNotImplemented = errors.Errorf("not implemented")
 // in memory implementation of the DB, but rather the bare minimum of
 // functionality that the CA requires to operate securely.
 type SimpleDB struct {
-	usedTokens *sync.Map
+	usedTokens *usedTokenCache
 }
 
 func newSimpleDB(c *Config) (AuthDB, error) {
 	db := &SimpleDB{}
-	db.usedTokens = new(sync.Map)
+	db.usedTokens = newUsedTokenCache(false)
 	return db, nil
 }
 
@@ -40,22 +39,116 @@ func (s *SimpleDB) StoreCertificate(crt *x509.Certificate) error {
 	return ErrNotImplemented
 }
 
+// GetCertificate returns a "NotImplemented" error.
+func (s *SimpleDB) GetCertificate(sn string) (*x509.Certificate, error) {
+	return nil, ErrNotImplemented
+}
+
+// GetCertificates returns a "NotImplemented" error.
+func (s *SimpleDB) GetCertificates() ([]*x509.Certificate, error) {
+	return nil, ErrNotImplemented
+}
+
+// GetCertificatesBySAN returns a "NotImplemented" error.
+func (s *SimpleDB) GetCertificatesBySAN(san string) ([]*x509.Certificate, error) {
+	return nil, ErrNotImplemented
+}
+
+// GetCertificatesByCommonName returns a "NotImplemented" error.
+func (s *SimpleDB) GetCertificatesByCommonName(cn string) ([]*x509.Certificate, error) {
+	return nil, ErrNotImplemented
+}
+
+// RebuildIndexes returns a "NotImplemented" error.
+func (s *SimpleDB) RebuildIndexes() (int, error) {
+	return 0, ErrNotImplemented
+}
+
+// StoreCertificateData returns a "NotImplemented" error.
+func (s *SimpleDB) StoreCertificateData(sn string, data *CertificateData) error {
+	return ErrNotImplemented
+}
+
+// GetCertificateData returns a "NotImplemented" error.
+func (s *SimpleDB) GetCertificateData(sn string) (*CertificateData, error) {
+	return nil, ErrNotImplemented
+}
+
+// GetRevokedCertificateInfo returns a "NotImplemented" error.
+func (s *SimpleDB) GetRevokedCertificateInfo(sn string) (*RevokedCertificateInfo, error) {
+	return nil, ErrNotImplemented
+}
+
+// IncrementStats returns a "NotImplemented" error.
+func (s *SimpleDB) IncrementStats(t time.Time, provisioner, event string) error {
+	return ErrNotImplemented
+}
+
+// GetStats returns a "NotImplemented" error.
+func (s *SimpleDB) GetStats() ([]*StatsEntry, error) {
+	return nil, ErrNotImplemented
+}
+
+// GetJournal returns a "NotImplemented" error.
+func (s *SimpleDB) GetJournal() ([]*JournalEntry, error) {
+	return nil, ErrNotImplemented
+}
+
+// GetLogEntries returns a "NotImplemented" error.
+func (s *SimpleDB) GetLogEntries(start, end int64) ([]*LogEntry, error) {
+	return nil, ErrNotImplemented
+}
+
+// GetTreeHead returns a "NotImplemented" error.
+func (s *SimpleDB) GetTreeHead() (*TreeHead, error) {
+	return nil, ErrNotImplemented
+}
+
+// GetInclusionProof returns a "NotImplemented" error.
+func (s *SimpleDB) GetInclusionProof(sn string, treeSize int64) (*InclusionProof, error) {
+	return nil, ErrNotImplemented
+}
+
 type usedToken struct {
 	UsedAt int64  `json:"ua,omitempty"`
 	Token  string `json:"tok,omitempty"`
 }
 
-// UseToken returns a "NotImplemented" error.
+// UseToken returns true if the token is stored for the first time, false
+// otherwise.
 func (s *SimpleDB) UseToken(id, tok string) (bool, error) {
-	if _, ok := s.usedTokens.LoadOrStore(id, &usedToken{
-		UsedAt: time.Now().Unix(),
-		Token:  tok,
-	}); ok {
-		// Token already exists in DB.
-		return false, nil
-	}
-	// Successfully stored token.
-	return true, nil
+	return s.usedTokens.Add(id, tok), nil
+}
+
+// IsTokenUsed returns true if the token with the given id has already been
+// used.
+func (s *SimpleDB) IsTokenUsed(id string) (bool, error) {
+	return s.usedTokens.Has(id), nil
+}
+
+// PruneCertificates returns a "NotImplemented" error.
+func (s *SimpleDB) PruneCertificates(before time.Time) (*PruneResult, error) {
+	return nil, ErrNotImplemented
+}
+
+// PruneTokens deletes the used tokens that expired before the given time.
+func (s *SimpleDB) PruneTokens(before time.Time) (*PruneResult, error) {
+	return s.usedTokens.Prune(before), nil
+}
+
+// StoreCertificates returns a "NotImplemented" error.
+func (s *SimpleDB) StoreCertificates(records []*CertificateRecord) error {
+	return ErrNotImplemented
+}
+
+// Export returns a "NotImplemented" error.
+func (s *SimpleDB) Export() (*Snapshot, error) {
+	return nil, ErrNotImplemented
+}
+
+// Import returns a "NotImplemented" error.
+func (s *SimpleDB) Import(snap *Snapshot) error {
+	return ErrNotImplemented
 }
 
 // Shutdown returns nil
@@ -2,6 +2,7 @@ package db
 
 import (
 	"testing"
+	"time"
 
 	"github.com/smallstep/assert"
 )
@@ -21,6 +22,37 @@ func TestSimpleDB(t *testing.T) {
 	// StoreCertificate
 	assert.Equals(t, ErrNotImplemented, db.StoreCertificate(nil))
 
+	// GetCertificate
+	crt, err := db.GetCertificate("foo")
+	assert.Nil(t, crt)
+	assert.Equals(t, ErrNotImplemented, err)
+
+	// GetCertificates
+	certs, err := db.GetCertificates()
+	assert.Nil(t, certs)
+	assert.Equals(t, ErrNotImplemented, err)
+
+	// StoreCertificateData
+	assert.Equals(t, ErrNotImplemented, db.StoreCertificateData("foo", &CertificateData{}))
+
+	// GetCertificateData
+	data, err := db.GetCertificateData("foo")
+	assert.Nil(t, data)
+	assert.Equals(t, ErrNotImplemented, err)
+
+	// GetRevokedCertificateInfo
+	rci, err := db.GetRevokedCertificateInfo("foo")
+	assert.Nil(t, rci)
+	assert.Equals(t, ErrNotImplemented, err)
+
+	// IncrementStats
+	assert.Equals(t, ErrNotImplemented, db.IncrementStats(time.Now(), "foo", StatsIssued))
+
+	// GetStats
+	stats, err := db.GetStats()
+	assert.Nil(t, stats)
+	assert.Equals(t, ErrNotImplemented, err)
+
 	// UseToken
 	ok, err := db.UseToken("foo", "bar")
 	assert.True(t, ok)
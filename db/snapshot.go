@@ -0,0 +1,281 @@
+package db
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql"
+	"github.com/smallstep/nosql/database"
+)
+
+// SnapshotVersion is the version of the format of the database snapshots.
+const SnapshotVersion = 1
+
+// SnapshotEntry is a record of a database snapshot.
+type SnapshotEntry struct {
+	Key   []byte `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// SnapshotTable is a table of a database snapshot.
+type SnapshotTable struct {
+	Name    string           `json:"name"`
+	Entries []*SnapshotEntry `json:"entries"`
+}
+
+// Snapshot is a copy of all the tables of the database. The values are
+// copied as they are stored, if the encryption at rest is enabled they can
+// only be imported in a database using the same key.
+type Snapshot struct {
+	Version  int              `json:"version"`
+	Tables   []*SnapshotTable `json:"tables"`
+	Checksum string           `json:"checksum"`
+}
+
+// Sum returns the SHA-256 checksum of the tables of the snapshot.
+func (s *Snapshot) Sum() string {
+	h := sha256.New()
+	writeSum := func(b []byte) {
+		binary.Write(h, binary.BigEndian, uint64(len(b)))
+		h.Write(b)
+	}
+	binary.Write(h, binary.BigEndian, uint64(s.Version))
+	for _, t := range s.Tables {
+		writeSum([]byte(t.Name))
+		binary.Write(h, binary.BigEndian, uint64(len(t.Entries)))
+		for _, e := range t.Entries {
+			writeSum(e.Key)
+			writeSum(e.Value)
+		}
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// Verify checks the version and the checksum of the snapshot.
+func (s *Snapshot) Verify() error {
+	switch {
+	case s == nil:
+		return errors.New("snapshot cannot be empty")
+	case s.Version != SnapshotVersion:
+		return errors.Errorf("unsupported snapshot version %d", s.Version)
+	case s.Checksum != s.Sum():
+		return errors.New("snapshot checksum does not match")
+	default:
+		return nil
+	}
+}
+
+// hasTable returns true if the snapshot contains the given table.
+func (s *Snapshot) hasTable(name []byte) bool {
+	for _, t := range s.Tables {
+		if t.Name == string(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshotDB is a nosql.DB that keeps track of the tables created and blocks
+// the writes while a snapshot is exported or imported.
+type snapshotDB struct {
+	nosql.DB
+	mu       sync.RWMutex
+	tablesMu sync.Mutex
+	tables   map[string]struct{}
+}
+
+func newSnapshotDB(db nosql.DB) *snapshotDB {
+	return &snapshotDB{DB: db, tables: make(map[string]struct{})}
+}
+
+// findSnapshotDB returns the snapshotDB wrapped by the given database.
+func findSnapshotDB(db nosql.DB) (*snapshotDB, bool) {
+	for {
+		switch v := db.(type) {
+		case *snapshotDB:
+			return v, true
+		case *encryptedDB:
+			db = v.DB
+		default:
+			return nil, false
+		}
+	}
+}
+
+// Set stores the value of the given bucket and key.
+func (s *snapshotDB) Set(bucket, key, value []byte) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.DB.Set(bucket, key, value)
+}
+
+// Del deletes the value of the given bucket and key.
+func (s *snapshotDB) Del(bucket, key []byte) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.DB.Del(bucket, key)
+}
+
+// CmpAndSwap swaps the value of the given bucket and key if it is oldValue.
+func (s *snapshotDB) CmpAndSwap(bucket, key, oldValue, newValue []byte) ([]byte, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.DB.CmpAndSwap(bucket, key, oldValue, newValue)
+}
+
+// Update runs the given transaction.
+func (s *snapshotDB) Update(tx *database.Tx) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.DB.Update(tx)
+}
+
+// CreateTable creates the given bucket and records it as part of the
+// snapshots.
+func (s *snapshotDB) CreateTable(bucket []byte) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if err := s.DB.CreateTable(bucket); err != nil {
+		return err
+	}
+	s.tablesMu.Lock()
+	s.tables[string(bucket)] = struct{}{}
+	s.tablesMu.Unlock()
+	return nil
+}
+
+// DeleteTable deletes the given bucket.
+func (s *snapshotDB) DeleteTable(bucket []byte) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if err := s.DB.DeleteTable(bucket); err != nil {
+		return err
+	}
+	s.tablesMu.Lock()
+	delete(s.tables, string(bucket))
+	s.tablesMu.Unlock()
+	return nil
+}
+
+// tableNames returns the sorted list of tables created.
+func (s *snapshotDB) tableNames() []string {
+	s.tablesMu.Lock()
+	defer s.tablesMu.Unlock()
+	names := make([]string, 0, len(s.tables))
+	for name := range s.tables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// list returns the entries of the given table sorted by key.
+func (s *snapshotDB) list(name string) ([]*SnapshotEntry, error) {
+	entries, err := s.DB.List([]byte(name))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return []*SnapshotEntry{}, nil
+	case err != nil:
+		return nil, errors.Wrapf(err, "error listing table %s", name)
+	}
+	list := make([]*SnapshotEntry, len(entries))
+	for i, e := range entries {
+		list[i] = &SnapshotEntry{Key: e.Key, Value: e.Value}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return bytes.Compare(list[i].Key, list[j].Key) < 0
+	})
+	return list, nil
+}
+
+// export returns a snapshot of all the tables. Writes are blocked until it
+// finishes.
+func (s *snapshotDB) export() (*Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap := &Snapshot{Version: SnapshotVersion, Tables: []*SnapshotTable{}}
+	for _, name := range s.tableNames() {
+		entries, err := s.list(name)
+		if err != nil {
+			return nil, err
+		}
+		snap.Tables = append(snap.Tables, &SnapshotTable{Name: name, Entries: entries})
+	}
+	snap.Checksum = snap.Sum()
+	return snap, nil
+}
+
+// restore writes the records of the given snapshot. The tables of the
+// snapshot must be empty, ErrAlreadyExists is returned otherwise. Writes are
+// blocked until it finishes.
+func (s *snapshotDB) restore(snap *Snapshot) error {
+	if err := snap.Verify(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range snap.Tables {
+		// The schema version of the snapshot replaces the current one.
+		if t.Name == string(schemaTable) {
+			continue
+		}
+		entries, err := s.list(t.Name)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return errors.Wrapf(ErrAlreadyExists, "error importing snapshot: table %s is not empty", t.Name)
+		}
+	}
+	// Snapshots taken before the schema was versioned are migrated from the
+	// first version.
+	if !snap.hasTable(schemaTable) {
+		if err := s.DB.Del(schemaTable, schemaVersionKey); err != nil && !nosql.IsErrNotFound(err) {
+			return errors.Wrap(err, "error deleting schema version")
+		}
+	}
+	for _, t := range snap.Tables {
+		if err := s.DB.CreateTable([]byte(t.Name)); err != nil {
+			return errors.Wrapf(err, "error creating table %s", t.Name)
+		}
+		s.tablesMu.Lock()
+		s.tables[t.Name] = struct{}{}
+		s.tablesMu.Unlock()
+		for _, e := range t.Entries {
+			if err := s.DB.Set([]byte(t.Name), e.Key, e.Value); err != nil {
+				return errors.Wrapf(err, "error importing %s/%s", t.Name, string(e.Key))
+			}
+		}
+	}
+	return nil
+}
+
+// Export returns a consistent snapshot of all the tables of the database,
+// including the ACME tables.
+func (db *DB) Export() (*Snapshot, error) {
+	s, ok := findSnapshotDB(db.DB)
+	if !ok {
+		return nil, ErrNotImplemented
+	}
+	return s.export()
+}
+
+// Import verifies the given snapshot and writes its records in the
+// database. The tables of the snapshot must be empty. The records are
+// migrated if the snapshot was taken by a previous release.
+func (db *DB) Import(snap *Snapshot) error {
+	s, ok := findSnapshotDB(db.DB)
+	if !ok {
+		return ErrNotImplemented
+	}
+	if err := s.restore(snap); err != nil {
+		return err
+	}
+	_, err := db.Migrate(false)
+	return err
+}
@@ -0,0 +1,104 @@
+package db
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"github.com/smallstep/nosql/database"
+)
+
+func TestDB_Export(t *testing.T) {
+	src := &DB{newSnapshotDB(newMemoryNoSQLDB()), true}
+	for _, table := range [][]byte{certsTable, certsDataTable, certsSANIndexTable, certsCNIndexTable, schemaTable, []byte("acme_accounts")} {
+		assert.FatalError(t, src.CreateTable(table))
+	}
+	_, err := src.Migrate(false)
+	assert.FatalError(t, err)
+	assert.FatalError(t, src.StoreCertificate(newIndexedCertificate(t, 2, "db.internal", "db.internal")))
+	assert.FatalError(t, src.StoreCertificate(newIndexedCertificate(t, 1, "db.internal", "db.internal")))
+	assert.FatalError(t, src.Set([]byte("acme_accounts"), []byte("abc"), []byte(`{"id":"abc"}`)))
+
+	snap, err := src.Export()
+	assert.FatalError(t, err)
+	assert.NoError(t, snap.Verify())
+	names := []string{}
+	for _, table := range snap.Tables {
+		names = append(names, table.Name)
+	}
+	assert.Equals(t, []string{"acme_accounts", "schema", "x509_certs", "x509_certs_cn_index", "x509_certs_data", "x509_certs_san_index"}, names)
+	// Entries are sorted by key.
+	assert.Equals(t, []byte("1"), snap.Tables[2].Entries[0].Key)
+	assert.Equals(t, []byte("2"), snap.Tables[2].Entries[1].Key)
+
+	// The schema version of the snapshot replaces the current one.
+	dst := &DB{newSnapshotDB(newMemoryNoSQLDB()), true}
+	assert.FatalError(t, dst.Set(schemaTable, schemaVersionKey, []byte("1")))
+	assert.FatalError(t, dst.Import(snap))
+	certs, err := dst.GetCertificatesBySAN("db.internal")
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"1", "2"}, serialNumbers(certs))
+	b, err := dst.Get([]byte("acme_accounts"), []byte("abc"))
+	assert.FatalError(t, err)
+	assert.Equals(t, []byte(`{"id":"abc"}`), b)
+
+	// The imported tables are exported again.
+	again, err := dst.Export()
+	assert.FatalError(t, err)
+	assert.Equals(t, snap.Checksum, again.Checksum)
+
+	// The tables must be empty.
+	err = dst.Import(snap)
+	if assert.NotNil(t, err) {
+		assert.Equals(t, ErrAlreadyExists, errors.Cause(err))
+	}
+
+	// Tampered snapshots are rejected.
+	snap.Tables[0].Entries[0].Value = []byte(`{"id":"xyz"}`)
+	err = (&DB{newSnapshotDB(newMemoryNoSQLDB()), true}).Import(snap)
+	if assert.NotNil(t, err) {
+		assert.Equals(t, "snapshot checksum does not match", err.Error())
+	}
+
+	// Only databases created by New support snapshots.
+	_, err = (&DB{newMemoryNoSQLDB(), true}).Export()
+	assert.Equals(t, ErrNotImplemented, err)
+	assert.Equals(t, ErrNotImplemented, (&DB{newMemoryNoSQLDB(), true}).Import(snap))
+
+	mem := newMemoryNoSQLDB()
+	mem.MList = func(bucket []byte) ([]*database.Entry, error) {
+		return nil, errors.New("force")
+	}
+	sdb := newSnapshotDB(mem)
+	assert.FatalError(t, sdb.CreateTable(certsTable))
+	_, err = (&DB{sdb, true}).Export()
+	if assert.NotNil(t, err) {
+		assert.Equals(t, "error listing table x509_certs: force", err.Error())
+	}
+}
+
+func TestDB_Export_encrypted(t *testing.T) {
+	edb, mem := newTestEncryptedDB(t)
+	sdb := newSnapshotDB(mem)
+	edb.DB = sdb
+	db := &DB{edb, true}
+	assert.FatalError(t, db.CreateTable(certsTable))
+	assert.FatalError(t, db.Set(certsTable, []byte("1"), []byte("certificate")))
+
+	// Values are exported encrypted.
+	snap, err := db.Export()
+	assert.FatalError(t, err)
+	assert.True(t, bytes.HasPrefix(snap.Tables[0].Entries[0].Value, encryptedPrefix))
+}
+
+func TestSnapshot_Verify(t *testing.T) {
+	var snap *Snapshot
+	if err := snap.Verify(); assert.NotNil(t, err) {
+		assert.Equals(t, "snapshot cannot be empty", err.Error())
+	}
+	snap = &Snapshot{Version: 2}
+	if err := snap.Verify(); assert.NotNil(t, err) {
+		assert.Equals(t, "unsupported snapshot version 2", err.Error())
+	}
+}
@@ -0,0 +1,282 @@
+package db
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+)
+
+// tokenWindow is the width of the expiry windows used to shard the used
+// tokens. All the tokens of a window are dropped at once when it expires.
+const tokenWindow = time.Minute
+
+// tokenStripes is the number of stripes of a window. Tokens that expire in
+// the same window, e.g. the ones of thousands of clients renewing in the
+// same minute, are spread across the stripes by id, so they do not contend
+// for the same lock.
+const tokenStripes = 32
+
+// tokenGracePeriod is the time a window is kept after it expires, so tokens
+// accepted with some clock skew are still rejected if they are reused.
+const tokenGracePeriod = 5 * time.Minute
+
+// noExpiryWindow is the window of the tokens without an expiration, it never
+// expires.
+const noExpiryWindow = math.MaxInt64
+
+// usedTokenCache is an in-memory set of used one-time tokens, striped by id.
+// Each stripe indexes its tokens by expiry window, so the expired tokens are
+// dropped a window at once, but an id is only stored once whatever the
+// expiration of its tokens. A nil cache does not store anything.
+type usedTokenCache struct {
+	stripes [tokenStripes]tokenStripe
+	// mu protects the set of windows with tokens in any stripe.
+	mu      sync.RWMutex
+	windows map[int64]bool
+	// expireWindows drops the expired windows when a new one is created.
+	expireWindows bool
+}
+
+type tokenStripe struct {
+	mu      sync.Mutex
+	tokens  map[string]*usedToken
+	windows map[int64]map[string]bool
+}
+
+// newUsedTokenCache returns a new cache. If expireWindows is true the windows
+// are dropped once their tokens expire, this is used when the cache is in
+// front of a database. Otherwise the tokens are kept until they are pruned.
+func newUsedTokenCache(expireWindows bool) *usedTokenCache {
+	c := &usedTokenCache{
+		windows:       make(map[int64]bool),
+		expireWindows: expireWindows,
+	}
+	for i := range c.stripes {
+		c.stripes[i].tokens = make(map[string]*usedToken)
+		c.stripes[i].windows = make(map[int64]map[string]bool)
+	}
+	return c
+}
+
+// tokenWindowOf returns the expiry window of the given token.
+func tokenWindowOf(tok string) int64 {
+	exp, ok := tokenExpiration(tok)
+	if !ok {
+		return noExpiryWindow
+	}
+	return exp.Unix() / int64(tokenWindow/time.Second)
+}
+
+// Add stores the token with the given id. It returns false if the id was
+// already stored, even with a token that expires in another window.
+func (c *usedTokenCache) Add(id, tok string) bool {
+	if c == nil {
+		return true
+	}
+	window := tokenWindowOf(tok)
+	c.addWindow(window)
+
+	s := c.stripe(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tokens[id]; ok {
+		return false
+	}
+	s.tokens[id] = &usedToken{
+		UsedAt: time.Now().Unix(),
+		Token:  tok,
+	}
+	ids, ok := s.windows[window]
+	if !ok {
+		ids = make(map[string]bool)
+		s.windows[window] = ids
+	}
+	ids[id] = true
+	return true
+}
+
+// Has returns true if the token with the given id is stored.
+func (c *usedTokenCache) Has(id string) bool {
+	if c == nil {
+		return false
+	}
+	s := c.stripe(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.tokens[id]
+	return ok
+}
+
+// Remove deletes the token with the given id, it is used if the token cannot
+// be stored in the database.
+func (c *usedTokenCache) Remove(id, tok string) {
+	if c == nil {
+		return
+	}
+	s := c.stripe(id)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ut, ok := s.tokens[id]; ok && ut.Token == tok {
+		s.delete(id, tokenWindowOf(tok))
+	}
+}
+
+// Prune deletes the tokens that expired before the given time. Tokens without
+// an expiration are kept.
+func (c *usedTokenCache) Prune(before time.Time) *PruneResult {
+	res := new(PruneResult)
+	if c == nil {
+		return res
+	}
+	last := before.Unix() / int64(tokenWindow/time.Second)
+	c.mu.Lock()
+	for w := range c.windows {
+		if w < last {
+			delete(c.windows, w)
+		}
+	}
+	c.mu.Unlock()
+
+	for i := range c.stripes {
+		s := &c.stripes[i]
+		s.mu.Lock()
+		for w, ids := range s.windows {
+			for id := range ids {
+				ut := s.tokens[id]
+				// The whole window expired, or only some tokens in the
+				// window of the given time.
+				if w < last || w == last && isExpiredBefore(ut.Token, before) {
+					res.add([]byte(id), []byte(ut.Token))
+					s.delete(id, w)
+				}
+			}
+		}
+		s.mu.Unlock()
+	}
+	return res
+}
+
+// Len returns the number of tokens in the cache.
+func (c *usedTokenCache) Len() int {
+	if c == nil {
+		return 0
+	}
+	var n int
+	for i := range c.stripes {
+		s := &c.stripes[i]
+		s.mu.Lock()
+		n += len(s.tokens)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// addWindow records a window with tokens. If the window is new and
+// expireWindows is set, the windows that expired before the grace period are
+// dropped, usually once a minute.
+func (c *usedTokenCache) addWindow(window int64) {
+	c.mu.RLock()
+	ok := c.windows[window]
+	c.mu.RUnlock()
+	if ok {
+		return
+	}
+
+	c.mu.Lock()
+	if c.windows[window] {
+		c.mu.Unlock()
+		return
+	}
+	var expired []int64
+	if c.expireWindows {
+		last := time.Now().Add(-tokenGracePeriod).Unix() / int64(tokenWindow/time.Second)
+		for w := range c.windows {
+			if w < last {
+				delete(c.windows, w)
+				expired = append(expired, w)
+			}
+		}
+	}
+	c.windows[window] = true
+	c.mu.Unlock()
+
+	if len(expired) == 0 {
+		return
+	}
+	for i := range c.stripes {
+		s := &c.stripes[i]
+		s.mu.Lock()
+		for _, w := range expired {
+			for id := range s.windows[w] {
+				delete(s.tokens, id)
+			}
+			delete(s.windows, w)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// stripe returns the stripe of the given id.
+func (c *usedTokenCache) stripe(id string) *tokenStripe {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return &c.stripes[h.Sum32()%tokenStripes]
+}
+
+// delete removes the id from the stripe and its window, the lock of the
+// stripe must be held.
+func (s *tokenStripe) delete(id string, window int64) {
+	delete(s.tokens, id)
+	if ids, ok := s.windows[window]; ok {
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(s.windows, window)
+		}
+	}
+}
+
+// isExpiredBefore returns true if the token has an expiration before the
+// given time.
+func isExpiredBefore(tok string, before time.Time) bool {
+	exp, ok := tokenExpiration(tok)
+	return ok && exp.Before(before)
+}
+
+// tokenCacheDB is an AuthDB with an in-memory cache of the used tokens in
+// front of the database, so reused tokens are rejected without a database
+// round trip. It embeds a *DB so it can still be used as a nosql.DB by the
+// ACME authority.
+type tokenCacheDB struct {
+	*DB
+	usedTokens *usedTokenCache
+}
+
+// UseToken returns true if the token is stored for the first time in the
+// cache and the database, false otherwise.
+func (db *tokenCacheDB) UseToken(id, tok string) (bool, error) {
+	if !db.usedTokens.Add(id, tok) {
+		return false, nil
+	}
+	ok, err := db.DB.UseToken(id, tok)
+	if err != nil {
+		db.usedTokens.Remove(id, tok)
+	}
+	return ok, err
+}
+
+// IsTokenUsed returns true if the token with the given id is in the cache or
+// in the database.
+func (db *tokenCacheDB) IsTokenUsed(id string) (bool, error) {
+	if db.usedTokens.Has(id) {
+		return true, nil
+	}
+	return db.DB.IsTokenUsed(id)
+}
+
+// PruneTokens deletes the used tokens that expired before the given time from
+// the cache and the database.
+func (db *tokenCacheDB) PruneTokens(before time.Time) (*PruneResult, error) {
+	db.usedTokens.Prune(before)
+	return db.DB.PruneTokens(before)
+}
@@ -0,0 +1,167 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+)
+
+func TestUsedTokenCache(t *testing.T) {
+	now := time.Now()
+	expired := testToken(now.Add(-time.Hour))
+	boundary := testToken(now.Add(-time.Second))
+	active := testToken(now.Add(time.Minute))
+
+	c := newUsedTokenCache(false)
+	for id, tok := range map[string]string{"expired": expired, "boundary": boundary, "active": active, "opaque": "foo"} {
+		assert.True(t, c.Add(id, tok))
+		assert.False(t, c.Add(id, tok))
+	}
+	assert.Equals(t, 4, c.Len())
+
+	// Tokens in a window are removed with the whole window, or one by one in
+	// the window of the given time.
+	res := c.Prune(now)
+	assert.Equals(t, 2, res.Records)
+	assert.Equals(t, int64(len("expired")+len(expired)+len("boundary")+len(boundary)), res.Bytes)
+	assert.Equals(t, 2, c.Len())
+	assert.True(t, c.Add("expired", expired))
+	assert.False(t, c.Add("active", active))
+	assert.False(t, c.Add("opaque", "foo"))
+
+	c.Remove("active", active)
+	c.Remove("missing", testToken(now.Add(24*time.Hour)))
+	assert.True(t, c.Add("active", active))
+
+	// A nil cache does not store anything.
+	var nc *usedTokenCache
+	assert.True(t, nc.Add("active", active))
+	assert.True(t, nc.Add("active", active))
+	nc.Remove("active", active)
+	assert.Equals(t, 0, nc.Prune(now).Records)
+	assert.Equals(t, 0, nc.Len())
+}
+
+func TestUsedTokenCache_reusedID(t *testing.T) {
+	now := time.Now()
+	for _, expireWindows := range []bool{false, true} {
+		c := newUsedTokenCache(expireWindows)
+		// The same id cannot be reused with a token that expires in another
+		// window.
+		assert.True(t, c.Add("nonce:abc", testToken(time.Unix(2000000000, 0))))
+		assert.False(t, c.Add("nonce:abc", testToken(now.Add(2*time.Minute))))
+		assert.False(t, c.Add("nonce:abc", "foo"))
+		assert.Equals(t, 1, c.Len())
+	}
+
+	sdb, err := newSimpleDB(nil)
+	assert.FatalError(t, err)
+	ok, err := sdb.UseToken("nonce:abc", testToken(time.Unix(2000000000, 0)))
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+	ok, err = sdb.UseToken("nonce:abc", testToken(now.Add(2*time.Minute)))
+	assert.FatalError(t, err)
+	assert.False(t, ok)
+	ok, err = sdb.IsTokenUsed("nonce:abc")
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+	ok, err = sdb.IsTokenUsed("nonce:def")
+	assert.FatalError(t, err)
+	assert.False(t, ok)
+}
+
+func TestUsedTokenCache_expireWindows(t *testing.T) {
+	now := time.Now()
+	old, recent := testToken(now.Add(-time.Hour)), testToken(now.Add(-time.Minute))
+	c := newUsedTokenCache(true)
+	assert.True(t, c.Add("old", old))
+	assert.Equals(t, 1, c.Len())
+
+	// Creating a new window drops the expired ones, but not the ones in the
+	// grace period or without an expiration.
+	assert.True(t, c.Add("recent", recent))
+	assert.Equals(t, 1, c.Len())
+	assert.True(t, c.Add("opaque", "foo"))
+	assert.True(t, c.Add("active", testToken(now.Add(time.Minute))))
+	assert.Equals(t, 3, c.Len())
+	assert.False(t, c.Add("recent", recent))
+	assert.False(t, c.Add("opaque", "foo"))
+	assert.True(t, c.Add("old", old))
+}
+
+func TestUsedTokenCache_concurrent(t *testing.T) {
+	c := newUsedTokenCache(true)
+	tok := testToken(time.Now().Add(5 * time.Minute))
+
+	// All the tokens expire in the same window, each one is only accepted
+	// once.
+	var wg sync.WaitGroup
+	accepted := make([]int, 100)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range accepted {
+				if c.Add(fmt.Sprintf("token-%d", j), tok) {
+					accepted[j]++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for j, n := range accepted {
+		if n != 1 {
+			t.Errorf("token-%d accepted %d times", j, n)
+		}
+	}
+}
+
+func TestTokenCacheDB(t *testing.T) {
+	now := time.Now()
+	tok := testToken(now.Add(time.Minute))
+
+	adb, err := New(&Config{Type: MemoryType})
+	assert.FatalError(t, err)
+	defer adb.Shutdown()
+	cdb, ok := adb.(*tokenCacheDB)
+	assert.Fatal(t, ok)
+
+	ok, err = cdb.IsTokenUsed("id")
+	assert.FatalError(t, err)
+	assert.False(t, ok)
+	ok, err = cdb.UseToken("id", tok)
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+	ok, err = cdb.IsTokenUsed("id")
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+	ok, err = cdb.UseToken("id", tok)
+	assert.FatalError(t, err)
+	assert.False(t, ok)
+
+	// The database is still used if the token is not in the cache, e.g. after
+	// a restart.
+	cdb.usedTokens = newUsedTokenCache(true)
+	ok, err = cdb.IsTokenUsed("id")
+	assert.FatalError(t, err)
+	assert.True(t, ok)
+	assert.Equals(t, 0, cdb.usedTokens.Len())
+	ok, err = cdb.UseToken("id", tok)
+	assert.FatalError(t, err)
+	assert.False(t, ok)
+	assert.Equals(t, 1, cdb.usedTokens.Len())
+
+	// Tokens are removed from the cache if the database fails.
+	cdb.DB = &DB{&MockNoSQLDB{
+		MCmpAndSwap: func(bucket, key, old, newval []byte) ([]byte, bool, error) {
+			return nil, false, errors.New("force")
+		},
+	}, true}
+	_, err = cdb.UseToken("other", tok)
+	assert.NotNil(t, err)
+	assert.Equals(t, 1, cdb.usedTokens.Len())
+}
@@ -0,0 +1,317 @@
+package db
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/nosql"
+)
+
+var (
+	transparencyLogTable   = []byte("x509_translog")
+	transparencyLogSNTable = []byte("x509_translog_serials")
+)
+
+// ErrInvalidTreeSize is returned when an inclusion proof is requested for a
+// tree larger than the transparency log.
+var ErrInvalidTreeSize = errors.New("invalid tree size")
+
+// LogEntry is a leaf of the transparency log of the issued certificates. The
+// leaf hash is the RFC 6962 hash of the DER of the certificate.
+type LogEntry struct {
+	Index     int64     `json:"index"`
+	Serial    string    `json:"serial"`
+	LeafHash  []byte    `json:"leafHash"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// TreeHead is the size and the RFC 6962 Merkle tree hash of the transparency
+// log.
+type TreeHead struct {
+	TreeSize int64  `json:"treeSize"`
+	RootHash []byte `json:"rootHash"`
+}
+
+// LeafHash returns the RFC 6962 hash of a leaf of the log.
+func LeafHash(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x00})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// nodeHash returns the RFC 6962 hash of an interior node of the log.
+func nodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0x01})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// splitPoint returns the largest power of two smaller than n.
+func splitPoint(n int) int {
+	k := 1
+	for k<<1 < n {
+		k <<= 1
+	}
+	return k
+}
+
+// RootHash returns the RFC 6962 Merkle tree hash of the given leaf hashes.
+func RootHash(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		sum := sha256.Sum256(nil)
+		return sum[:]
+	case 1:
+		return leaves[0]
+	default:
+		k := splitPoint(len(leaves))
+		return nodeHash(RootHash(leaves[:k]), RootHash(leaves[k:]))
+	}
+}
+
+// InclusionPath returns the RFC 6962 audit path of the leaf with the given
+// index in the tree of the given leaf hashes.
+func InclusionPath(index int, leaves [][]byte) [][]byte {
+	if len(leaves) <= 1 {
+		return [][]byte{}
+	}
+	k := splitPoint(len(leaves))
+	if index < k {
+		return append(InclusionPath(index, leaves[:k]), RootHash(leaves[k:]))
+	}
+	return append(InclusionPath(index-k, leaves[k:]), RootHash(leaves[:k]))
+}
+
+// VerifyInclusion returns true if the given audit path proves that the leaf
+// hash is at the given index of the tree with the given size and root hash.
+// It implements the verification algorithm of RFC 9162.
+func VerifyInclusion(leafHash []byte, index, treeSize int64, path [][]byte, rootHash []byte) bool {
+	if index < 0 || index >= treeSize {
+		return false
+	}
+	fn, sn, r := index, treeSize-1, leafHash
+	for _, p := range path {
+		if sn == 0 {
+			return false
+		}
+		if fn&1 == 1 || fn == sn {
+			r = nodeHash(p, r)
+			for fn&1 == 0 && fn != 0 {
+				fn >>= 1
+				sn >>= 1
+			}
+		} else {
+			r = nodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	return sn == 0 && bytes.Equal(r, rootHash)
+}
+
+func logIndexKey(i int64) []byte {
+	return []byte(fmt.Sprintf("%020d", i))
+}
+
+// logEntryExists returns true if the log has a leaf with the given index.
+func (db *DB) logEntryExists(i int64) (bool, error) {
+	_, err := db.Get(transparencyLogTable, logIndexKey(i))
+	switch {
+	case err == nil:
+		return true, nil
+	case nosql.IsErrNotFound(err):
+		return false, nil
+	default:
+		return false, errors.Wrap(err, "database Get error")
+	}
+}
+
+// getLogSize returns the number of leaves of the log. Leaves are appended
+// without gaps, so it searches the first index that does not exist.
+func (db *DB) getLogSize() (int64, error) {
+	// Find an upper bound, then search between the bounds.
+	lo, hi := int64(0), int64(1)
+	for {
+		ok, err := db.logEntryExists(hi - 1)
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			break
+		}
+		lo, hi = hi, hi*2
+	}
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		ok, err := db.logEntryExists(mid)
+		if err != nil {
+			return 0, err
+		}
+		if ok {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo, nil
+}
+
+// appendToLog appends the given certificate to the transparency log if it is
+// not already there. Every instance sharing the database appends to the
+// same log: the index is reserved with a compare-and-swap of the first free
+// leaf, so leaves are never overwritten.
+func (db *DB) appendToLog(crt *x509.Certificate) error {
+	sn := []byte(crt.SerialNumber.String())
+	if _, err := db.Get(transparencyLogSNTable, sn); err == nil {
+		return nil
+	} else if !nosql.IsErrNotFound(err) {
+		return errors.Wrap(err, "database Get error")
+	}
+
+	n, err := db.getLogSize()
+	if err != nil {
+		return err
+	}
+	e := &LogEntry{
+		Serial:    string(sn),
+		LeafHash:  LeafHash(crt.Raw),
+		Timestamp: time.Now().UTC(),
+	}
+	for ; ; n++ {
+		e.Index = n
+		b, err := json.Marshal(e)
+		if err != nil {
+			return errors.Wrap(err, "error marshaling log entry")
+		}
+		_, swapped, err := db.CmpAndSwap(transparencyLogTable, logIndexKey(n), nil, b)
+		if err != nil {
+			return errors.Wrap(err, "error AuthDB CmpAndSwap")
+		}
+		if swapped {
+			break
+		}
+	}
+	if err := db.Set(transparencyLogSNTable, sn, []byte(strconv.FormatInt(n, 10))); err != nil {
+		return errors.Wrap(err, "database Set error")
+	}
+	return nil
+}
+
+// GetLogEntries returns the leaves of the log from start to end, both
+// included. Indexes beyond the size of the log are ignored.
+func (db *DB) GetLogEntries(start, end int64) ([]*LogEntry, error) {
+	entries := []*LogEntry{}
+	for i := start; i <= end; i++ {
+		b, err := db.Get(transparencyLogTable, logIndexKey(i))
+		switch {
+		case nosql.IsErrNotFound(err):
+			return entries, nil
+		case err != nil:
+			return nil, errors.Wrap(err, "database Get error")
+		}
+		e := new(LogEntry)
+		if err := json.Unmarshal(b, e); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling log entry %d", i)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// getLeafHashes returns the hashes of all the leaves of the log in order.
+func (db *DB) getLeafHashes() ([][]byte, error) {
+	list, err := db.List(transparencyLogTable)
+	if err != nil {
+		return nil, errors.Wrap(err, "database List error")
+	}
+	entries := make([]*LogEntry, 0, len(list))
+	for _, l := range list {
+		e := new(LogEntry)
+		if err := json.Unmarshal(l.Value, e); err != nil {
+			return nil, errors.Wrapf(err, "error unmarshaling log entry %s", string(l.Key))
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Index < entries[j].Index
+	})
+	leaves := make([][]byte, len(entries))
+	for i, e := range entries {
+		if e.Index != int64(i) {
+			return nil, errors.Errorf("log entry %d is missing", i)
+		}
+		leaves[i] = e.LeafHash
+	}
+	return leaves, nil
+}
+
+// GetTreeHead returns the size and the root hash of the log. It reads all
+// the leaves of the log.
+func (db *DB) GetTreeHead() (*TreeHead, error) {
+	leaves, err := db.getLeafHashes()
+	if err != nil {
+		return nil, err
+	}
+	return &TreeHead{
+		TreeSize: int64(len(leaves)),
+		RootHash: RootHash(leaves),
+	}, nil
+}
+
+// InclusionProof is the audit path of a leaf of the transparency log in the
+// tree of the given size, and the root hash of that tree.
+type InclusionProof struct {
+	LeafIndex int64    `json:"leafIndex"`
+	TreeSize  int64    `json:"treeSize"`
+	LeafHash  []byte   `json:"leafHash"`
+	AuditPath [][]byte `json:"auditPath"`
+	RootHash  []byte   `json:"rootHash"`
+}
+
+// GetInclusionProof returns the proof that the certificate with the given
+// serial number is in the tree with the given size, or in the current tree
+// if the size is 0. It returns ErrNotFound if the certificate is not in the
+// log or it was logged after the tree.
+func (db *DB) GetInclusionProof(sn string, treeSize int64) (*InclusionProof, error) {
+	b, err := db.Get(transparencyLogSNTable, []byte(sn))
+	switch {
+	case nosql.IsErrNotFound(err):
+		return nil, ErrNotFound
+	case err != nil:
+		return nil, errors.Wrap(err, "database Get error")
+	}
+	index, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing log index of %s", sn)
+	}
+	leaves, err := db.getLeafHashes()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case treeSize == 0:
+		treeSize = int64(len(leaves))
+	case treeSize < 0 || treeSize > int64(len(leaves)):
+		return nil, errors.Wrapf(ErrInvalidTreeSize, "tree size %d is not between 1 and %d", treeSize, len(leaves))
+	}
+	if index >= treeSize {
+		return nil, ErrNotFound
+	}
+	return &InclusionProof{
+		LeafIndex: index,
+		TreeSize:  treeSize,
+		LeafHash:  leaves[index],
+		AuditPath: InclusionPath(int(index), leaves[:treeSize]),
+		RootHash:  RootHash(leaves[:treeSize]),
+	}, nil
+}
@@ -0,0 +1,194 @@
+package db
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/smallstep/assert"
+	"github.com/smallstep/nosql/database"
+)
+
+// rfc6962Leaves are the leaves of the reference tree of the RFC 6962 test
+// vectors.
+var rfc6962Leaves = []string{
+	"", "00", "10", "2021", "3031", "40414243", "5051525354555657", "606162636465666768696a6b6c6d6e6f",
+}
+
+func rfc6962LeafHashes(t *testing.T) [][]byte {
+	leaves := make([][]byte, len(rfc6962Leaves))
+	for i, s := range rfc6962Leaves {
+		b, err := hex.DecodeString(s)
+		assert.FatalError(t, err)
+		leaves[i] = LeafHash(b)
+	}
+	return leaves
+}
+
+func TestRootHash(t *testing.T) {
+	roots := []string{
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		"6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
+		"fac54203e7cc696cf0dfcb42c92a1d9dbaf70ad9e621f4bd8d98662f00e3c125",
+		"aeb6bcfe274b70a14fb067a5e5578264db0fa9b51af5e0ba159158f329e06e77",
+		"d37ee418976dd95753c1c73862b9398fa2a2cf9b4ff0fdfe8b30cd95209614b7",
+		"4e3bbb1f7b478dcfe71fb631631519a3bca12c9aefca1612bfce4c13a86264d4",
+		"76e67dadbcdf1e10e1b74ddc608abd2f98dfb16fbce75277b5232a127f2087ef",
+		"ddb89be403809e325750d3d263cd78929c2942b7942a34b77e122c9594a74c8c",
+		"5dc9da79a70659a9ad559cb701ded9a2ab9d823aad2f4960cfe370eff4604328",
+	}
+	leaves := rfc6962LeafHashes(t)
+	for n, root := range roots {
+		assert.Equals(t, root, hex.EncodeToString(RootHash(leaves[:n])), n)
+	}
+}
+
+func TestDB_transparencyLog(t *testing.T) {
+	db := &DB{newMemoryDB(), true}
+	for _, table := range [][]byte{certsTable, certsSANIndexTable, certsCNIndexTable, transparencyLogTable, transparencyLogSNTable} {
+		assert.FatalError(t, db.CreateTable(table))
+	}
+	th, err := db.GetTreeHead()
+	assert.FatalError(t, err)
+	assert.Equals(t, &TreeHead{TreeSize: 0, RootHash: RootHash(nil)}, th)
+
+	var leaves [][]byte
+	for i := int64(1); i <= 5; i++ {
+		crt := newIndexedCertificate(t, i, "db.internal", "db.internal")
+		assert.FatalError(t, db.StoreCertificate(crt))
+		leaves = append(leaves, LeafHash(crt.Raw))
+	}
+	// Certificates are only logged once.
+	crt, err := db.GetCertificate("3")
+	assert.FatalError(t, err)
+	assert.FatalError(t, db.appendToLog(crt))
+
+	size, err := db.getLogSize()
+	assert.FatalError(t, err)
+	assert.Equals(t, int64(5), size)
+	th, err = db.GetTreeHead()
+	assert.FatalError(t, err)
+	assert.Equals(t, &TreeHead{TreeSize: 5, RootHash: RootHash(leaves)}, th)
+
+	entries, err := db.GetLogEntries(1, 2)
+	assert.FatalError(t, err)
+	if assert.Len(t, 2, entries) {
+		assert.Equals(t, int64(1), entries[0].Index)
+		assert.Equals(t, "2", entries[0].Serial)
+		assert.Equals(t, leaves[1], entries[0].LeafHash)
+		assert.Equals(t, int64(2), entries[1].Index)
+		assert.Equals(t, "3", entries[1].Serial)
+	}
+	// Indexes beyond the log are ignored.
+	entries, err = db.GetLogEntries(4, 10)
+	assert.FatalError(t, err)
+	assert.Len(t, 1, entries)
+
+	// Logged leaves are never overwritten.
+	assert.FatalError(t, db.Del(transparencyLogSNTable, []byte("3")))
+	assert.FatalError(t, db.appendToLog(crt))
+	entries, err = db.GetLogEntries(0, 10)
+	assert.FatalError(t, err)
+	if assert.Len(t, 6, entries) {
+		assert.Equals(t, "3", entries[5].Serial)
+		assert.Equals(t, leaves[2], entries[5].LeafHash)
+	}
+
+	// Gaps are detected.
+	assert.FatalError(t, db.Del(transparencyLogTable, logIndexKey(2)))
+	_, err = db.GetTreeHead()
+	if assert.NotNil(t, err) {
+		assert.Equals(t, "log entry 2 is missing", err.Error())
+	}
+
+	db = &DB{&MockNoSQLDB{
+		MGet: func(bucket, key []byte) ([]byte, error) {
+			return nil, errors.New("force")
+		},
+		MList: func(bucket []byte) ([]*database.Entry, error) {
+			return nil, errors.New("force")
+		},
+	}, true}
+	_, err = db.GetTreeHead()
+	if assert.NotNil(t, err) {
+		assert.Equals(t, "database List error: force", err.Error())
+	}
+	_, err = db.GetLogEntries(0, 1)
+	if assert.NotNil(t, err) {
+		assert.Equals(t, "database Get error: force", err.Error())
+	}
+}
+
+func TestInclusionPath(t *testing.T) {
+	leaves := rfc6962LeafHashes(t)
+	// RFC 6962 reference proof of the first leaf in the tree of 8 leaves.
+	path := InclusionPath(0, leaves)
+	expected := []string{
+		"96a296d224f285c67bee93c30f8a309157f0daa35dc5b87e410b78630a09cfc7",
+		"5f083f0a1a33ca076a95279832580db3e0ef4584bdff1f54c8a360f50de3031e",
+		"6b47aaf29ee3c2af9af889bc1fb9254dabd31177f16232dd6aab035ca39bf6e4",
+	}
+	if assert.Len(t, len(expected), path) {
+		for i, p := range path {
+			assert.Equals(t, expected[i], hex.EncodeToString(p))
+		}
+	}
+
+	// Every leaf of every tree is verified.
+	for n := 1; n <= len(leaves); n++ {
+		root := RootHash(leaves[:n])
+		for m := 0; m < n; m++ {
+			path := InclusionPath(m, leaves[:n])
+			assert.True(t, VerifyInclusion(leaves[m], int64(m), int64(n), path, root), m, n)
+			// Wrong leaves, indexes, sizes and paths are rejected.
+			assert.False(t, VerifyInclusion(leaves[(m+1)%len(leaves)], int64(m), int64(n), path, root), m, n)
+			assert.False(t, VerifyInclusion(leaves[m], int64(n), int64(n), path, root), m, n)
+			if len(path) > 0 {
+				assert.False(t, VerifyInclusion(leaves[m], int64(m), int64(n), path[:len(path)-1], root), m, n)
+			}
+			assert.False(t, VerifyInclusion(leaves[m], int64(m), int64(n), append(path, root), root), m, n)
+		}
+	}
+}
+
+func TestDB_GetInclusionProof(t *testing.T) {
+	db := &DB{newMemoryDB(), true}
+	for _, table := range [][]byte{certsTable, certsSANIndexTable, certsCNIndexTable, transparencyLogTable, transparencyLogSNTable} {
+		assert.FatalError(t, db.CreateTable(table))
+	}
+	var leaves [][]byte
+	for i := int64(1); i <= 5; i++ {
+		crt := newIndexedCertificate(t, i, "db.internal", "db.internal")
+		assert.FatalError(t, db.StoreCertificate(crt))
+		leaves = append(leaves, LeafHash(crt.Raw))
+	}
+
+	p, err := db.GetInclusionProof("4", 0)
+	assert.FatalError(t, err)
+	assert.Equals(t, &InclusionProof{
+		LeafIndex: 3,
+		TreeSize:  5,
+		LeafHash:  leaves[3],
+		AuditPath: InclusionPath(3, leaves),
+		RootHash:  RootHash(leaves),
+	}, p)
+	assert.True(t, VerifyInclusion(p.LeafHash, p.LeafIndex, p.TreeSize, p.AuditPath, p.RootHash))
+
+	p, err = db.GetInclusionProof("4", 4)
+	assert.FatalError(t, err)
+	assert.Equals(t, int64(4), p.TreeSize)
+	assert.Equals(t, RootHash(leaves[:4]), p.RootHash)
+	assert.True(t, VerifyInclusion(p.LeafHash, p.LeafIndex, p.TreeSize, p.AuditPath, p.RootHash))
+
+	// The certificate was logged after the tree.
+	_, err = db.GetInclusionProof("4", 3)
+	assert.Equals(t, ErrNotFound, err)
+	_, err = db.GetInclusionProof("6", 0)
+	assert.Equals(t, ErrNotFound, err)
+	for _, size := range []int64{-1, 6} {
+		_, err = db.GetInclusionProof("4", size)
+		if assert.NotNil(t, err) {
+			assert.Equals(t, ErrInvalidTreeSize, errors.Cause(err))
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package events
+
+import (
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Type is the type of an event.
+type Type string
+
+const (
+	// CertificateIssued is the type of the event published when a certificate
+	// is signed.
+	CertificateIssued Type = "certificate.issued"
+	// CertificateRenewed is the type of the event published when a certificate
+	// is renewed.
+	CertificateRenewed Type = "certificate.renewed"
+	// CertificateRevoked is the type of the event published when a certificate
+	// is revoked.
+	CertificateRevoked Type = "certificate.revoked"
+	// ProvisionerChanged is the type of the event published when a provisioner
+	// is added, updated or removed.
+	ProvisionerChanged Type = "provisioner.changed"
+)
+
+// DefaultHistorySize is the default number of events kept in memory to resume
+// the streams of the subscribers.
+const DefaultHistorySize = 100
+
+// subscriberBufferSize is the number of events that can be queued for a
+// subscriber before it is considered too slow and its channel is closed.
+const subscriberBufferSize = 64
+
+// Event is the representation of an event. The Data is one of
+// CertificateData, RevocationData or ProvisionerData depending on the type.
+type Event struct {
+	ID   string      `json:"id"`
+	Type Type        `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// CertificateData is the data of the events of issued and renewed
+// certificates.
+type CertificateData struct {
+	Serial      string    `json:"serial"`
+	Subject     string    `json:"subject"`
+	SANs        []string  `json:"sans,omitempty"`
+	Provisioner string    `json:"provisioner,omitempty"`
+	NotBefore   time.Time `json:"notBefore"`
+	NotAfter    time.Time `json:"notAfter"`
+}
+
+// RevocationData is the data of the events of revoked certificates.
+type RevocationData struct {
+	Serial      string `json:"serial"`
+	Provisioner string `json:"provisioner,omitempty"`
+	ReasonCode  int    `json:"reasonCode"`
+	Reason      string `json:"reason,omitempty"`
+	MTLS        bool   `json:"mTLS"`
+}
+
+// ProvisionerData is the data of the events of changed provisioners. The
+// action is one of added, updated or removed.
+type ProvisionerData struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Action string `json:"action"`
+}
+
+// Config is the configuration of the events published by the CA.
+type Config struct {
+	Webhooks    []*WebhookConfig `json:"webhooks,omitempty"`
+	HistorySize int              `json:"historySize,omitempty"`
+}
+
+// WebhookConfig is the configuration of a webhook sink. The events are sent in
+// a POST request signed with the secret, if the list of events is empty all
+// the events are sent.
+type WebhookConfig struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+	Events []Type `json:"events,omitempty"`
+}
+
+// Validate validates the events configuration.
+func (c *Config) Validate() error {
+	if c == nil {
+		return nil
+	}
+	if c.HistorySize < 0 {
+		return errors.New("events.historySize cannot be negative")
+	}
+	for i, w := range c.Webhooks {
+		if w == nil {
+			return errors.Errorf("events.webhooks[%d] cannot be empty", i)
+		}
+		u, err := url.Parse(w.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return errors.Errorf("events.webhooks[%d].url %s is not a valid http or https url", i, w.URL)
+		}
+		if w.Secret == "" {
+			return errors.Errorf("events.webhooks[%d].secret cannot be empty", i)
+		}
+		for _, t := range w.Events {
+			switch t {
+			case CertificateIssued, CertificateRenewed, CertificateRevoked, ProvisionerChanged:
+			default:
+				return errors.Errorf("events.webhooks[%d].events contains an unsupported type %s", i, t)
+			}
+		}
+	}
+	return nil
+}
+
+// Publisher publishes events to the configured webhooks and to the
+// subscribers of the stream. The methods of a nil Publisher are no-ops.
+type Publisher struct {
+	mutex       sync.Mutex
+	seq         uint64
+	history     []*Event
+	historySize int
+	subscribers map[chan *Event]struct{}
+	webhooks    []*webhook
+	closed      bool
+	wg          sync.WaitGroup
+}
+
+// New creates a Publisher with the given configuration and starts the
+// delivery of the webhooks. The configuration can be nil.
+func New(config *Config) (*Publisher, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	p := &Publisher{
+		historySize: DefaultHistorySize,
+		subscribers: make(map[chan *Event]struct{}),
+	}
+	if config != nil {
+		if config.HistorySize > 0 {
+			p.historySize = config.HistorySize
+		}
+		for _, wc := range config.Webhooks {
+			w := newWebhook(wc)
+			p.webhooks = append(p.webhooks, w)
+			p.wg.Add(1)
+			go w.run(&p.wg)
+		}
+	}
+	return p, nil
+}
+
+// Publish creates and publishes a new event with the given type and data.
+// Subscribers that cannot keep up with the events are unsubscribed, and they
+// can resume the stream using the id of the last event received.
+func (p *Publisher) Publish(typ Type, data interface{}) {
+	if p == nil {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return
+	}
+
+	p.seq++
+	e := &Event{
+		ID:   strconv.FormatUint(p.seq, 10),
+		Type: typ,
+		Time: time.Now().UTC(),
+		Data: data,
+	}
+	p.history = append(p.history, e)
+	if len(p.history) > p.historySize {
+		p.history = p.history[len(p.history)-p.historySize:]
+	}
+	for ch := range p.subscribers {
+		select {
+		case ch <- e:
+		default:
+			delete(p.subscribers, ch)
+			close(ch)
+		}
+	}
+	for _, w := range p.webhooks {
+		w.enqueue(e)
+	}
+}
+
+// Subscribe returns a channel that receives the published events and a
+// function to cancel the subscription. If lastID is the id of an event still
+// in the history, the events published after it are sent first. The channel
+// is closed when the subscription is canceled, the subscriber is too slow, or
+// the publisher is closed.
+func (p *Publisher) Subscribe(lastID string) (<-chan *Event, func()) {
+	if p == nil {
+		ch := make(chan *Event)
+		close(ch)
+		return ch, func() {}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	var replay []*Event
+	if n, err := strconv.ParseUint(lastID, 10, 64); err == nil && n <= p.seq {
+		for _, e := range p.history {
+			if id, _ := strconv.ParseUint(e.ID, 10, 64); id > n {
+				replay = append(replay, e)
+			}
+		}
+	}
+
+	ch := make(chan *Event, len(replay)+subscriberBufferSize)
+	for _, e := range replay {
+		ch <- e
+	}
+	if p.closed {
+		close(ch)
+		return ch, func() {}
+	}
+
+	p.subscribers[ch] = struct{}{}
+	return ch, func() {
+		p.mutex.Lock()
+		defer p.mutex.Unlock()
+		if _, ok := p.subscribers[ch]; ok {
+			delete(p.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Close closes the channels of the subscribers and waits until the queued
+// webhooks are delivered.
+func (p *Publisher) Close() {
+	if p == nil {
+		return
+	}
+
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return
+	}
+	p.closed = true
+	for ch := range p.subscribers {
+		delete(p.subscribers, ch)
+		close(ch)
+	}
+	for _, w := range p.webhooks {
+		close(w.queue)
+	}
+	p.mutex.Unlock()
+
+	p.wg.Wait()
+}
@@ -0,0 +1,196 @@
+package events
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Config
+		wantErr bool
+	}{
+		{"ok-nil", nil, false},
+		{"ok-empty", &Config{}, false},
+		{"ok", &Config{HistorySize: 10, Webhooks: []*WebhookConfig{
+			{URL: "https://example.com/hook", Secret: "secret"},
+			{URL: "http://localhost:8080", Secret: "secret", Events: []Type{CertificateIssued, CertificateRevoked}},
+		}}, false},
+		{"fail-history", &Config{HistorySize: -1}, true},
+		{"fail-nil-webhook", &Config{Webhooks: []*WebhookConfig{nil}}, true},
+		{"fail-url", &Config{Webhooks: []*WebhookConfig{{URL: "example.com", Secret: "secret"}}}, true},
+		{"fail-scheme", &Config{Webhooks: []*WebhookConfig{{URL: "ftp://example.com", Secret: "secret"}}}, true},
+		{"fail-secret", &Config{Webhooks: []*WebhookConfig{{URL: "https://example.com"}}}, true},
+		{"fail-event", &Config{Webhooks: []*WebhookConfig{{URL: "https://example.com", Secret: "secret", Events: []Type{"foo"}}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Config.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPublisher_Subscribe(t *testing.T) {
+	p, err := New(&Config{HistorySize: 3})
+	assert.FatalError(t, err)
+	defer p.Close()
+
+	ch, cancel := p.Subscribe("")
+	p.Publish(CertificateIssued, &CertificateData{Serial: "1"})
+	p.Publish(CertificateRenewed, &CertificateData{Serial: "2"})
+	for i, typ := range []Type{CertificateIssued, CertificateRenewed} {
+		select {
+		case e := <-ch:
+			assert.Equals(t, typ, e.Type)
+			assert.Equals(t, string(rune('1'+i)), e.ID)
+		case <-time.After(time.Second):
+			t.Fatal("timeout waiting for event")
+		}
+	}
+	cancel()
+	_, ok := <-ch
+	assert.False(t, ok)
+	// Cancel can be called twice
+	cancel()
+
+	p.Publish(CertificateRevoked, &RevocationData{Serial: "3"})
+	p.Publish(ProvisionerChanged, &ProvisionerData{Name: "4"})
+
+	// History keeps the last 3 events
+	tests := []struct {
+		lastID string
+		want   []string
+	}{
+		{"", nil},
+		{"foo", nil},
+		{"1", []string{"2", "3", "4"}},
+		{"2", []string{"3", "4"}},
+		{"4", nil},
+		{"5", nil},
+	}
+	for _, tt := range tests {
+		ch, cancel := p.Subscribe(tt.lastID)
+		var got []string
+		for len(ch) > 0 {
+			got = append(got, (<-ch).ID)
+		}
+		assert.Equals(t, tt.want, got)
+		cancel()
+	}
+}
+
+func TestPublisher_slowSubscriber(t *testing.T) {
+	p, err := New(nil)
+	assert.FatalError(t, err)
+	ch, cancel := p.Subscribe("")
+	defer cancel()
+	for i := 0; i <= subscriberBufferSize; i++ {
+		p.Publish(CertificateIssued, nil)
+	}
+	n := 0
+	for range ch {
+		n++
+	}
+	assert.Equals(t, subscriberBufferSize, n)
+
+	// Close closes the channels of the subscribers.
+	ch, _ = p.Subscribe("")
+	p.Close()
+	_, ok := <-ch
+	assert.False(t, ok)
+
+	// Publish after close is a no-op
+	p.Publish(CertificateIssued, nil)
+	ch, _ = p.Subscribe("")
+	_, ok = <-ch
+	assert.False(t, ok)
+}
+
+func TestPublisher_nil(t *testing.T) {
+	var p *Publisher
+	p.Publish(CertificateIssued, nil)
+	ch, cancel := p.Subscribe("")
+	cancel()
+	_, ok := <-ch
+	assert.False(t, ok)
+	p.Close()
+}
+
+func TestPublisher_webhooks(t *testing.T) {
+	webhookRetryDelay = time.Millisecond
+	defer func() { webhookRetryDelay = time.Second }()
+
+	var (
+		mutex    sync.Mutex
+		received []*Event
+		failures = 1
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.FatalError(t, err)
+		assert.Equals(t, "application/json", r.Header.Get("Content-Type"))
+		assert.True(t, Verify("secret", body, r.Header.Get(SignatureHeader)))
+		assert.False(t, Verify("bad-secret", body, r.Header.Get(SignatureHeader)))
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		// Fail the first attempt to test the retries.
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var e Event
+		assert.FatalError(t, json.Unmarshal(body, &e))
+		assert.Equals(t, string(e.Type), r.Header.Get(EventTypeHeader))
+		assert.Equals(t, e.ID, r.Header.Get(EventIDHeader))
+		received = append(received, &e)
+	}))
+	defer srv.Close()
+
+	p, err := New(&Config{
+		Webhooks: []*WebhookConfig{
+			{URL: srv.URL, Secret: "secret", Events: []Type{CertificateIssued, CertificateRevoked}},
+		},
+	})
+	assert.FatalError(t, err)
+	p.Publish(CertificateIssued, &CertificateData{Serial: "1234"})
+	p.Publish(CertificateRenewed, &CertificateData{Serial: "1234"})
+	p.Publish(CertificateRevoked, &RevocationData{Serial: "1234"})
+	// Close waits until the events are delivered.
+	p.Close()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if assert.Len(t, 2, received) {
+		assert.Equals(t, "1", received[0].ID)
+		assert.Equals(t, CertificateIssued, received[0].Type)
+		assert.Equals(t, map[string]interface{}{
+			"serial":    "1234",
+			"subject":   "",
+			"notBefore": "0001-01-01T00:00:00Z",
+			"notAfter":  "0001-01-01T00:00:00Z",
+		}, received[0].Data)
+		assert.Equals(t, "3", received[1].ID)
+		assert.Equals(t, CertificateRevoked, received[1].Type)
+	}
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '{"id":"1"}' | openssl dgst -sha256 -hmac secret
+	sig := Sign("secret", []byte(`{"id":"1"}`))
+	assert.Equals(t, "sha256=6146142a2ce0159e84c0767881e4ec80bc397da62526e7d19f70795eb79460c0", sig)
+	assert.True(t, Verify("secret", []byte(`{"id":"1"}`), sig))
+	assert.False(t, Verify("secret", []byte(`{"id":"2"}`), sig))
+	assert.False(t, Verify("secret", []byte(`{"id":"1"}`), "sha256=foo"))
+}
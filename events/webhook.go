@@ -0,0 +1,145 @@
+package events
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// SignatureHeader is the header with the signature of the body of a
+	// webhook request.
+	SignatureHeader = "X-Step-Signature"
+	// EventTypeHeader is the header with the type of the event of a webhook
+	// request.
+	EventTypeHeader = "X-Step-Event"
+	// EventIDHeader is the header with the id of the event of a webhook
+	// request.
+	EventIDHeader = "X-Step-Event-Id"
+)
+
+const (
+	webhookQueueSize   = 100
+	webhookMaxAttempts = 3
+	webhookTimeout     = 10 * time.Second
+)
+
+// webhookRetryDelay is the delay before the second attempt to deliver an
+// event, the delay increases linearly with the number of attempts.
+var webhookRetryDelay = time.Second
+
+// Sign returns the signature of the given body using the given secret. The
+// signature is the hex encoded HMAC-SHA256 of the body prefixed with
+// "sha256=".
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify returns true if the given signature is the signature of the body
+// using the secret. Webhook receivers can use it to validate the value of the
+// X-Step-Signature header.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// webhook delivers the events to a webhook sink in the order they are
+// published.
+type webhook struct {
+	config *WebhookConfig
+	client *http.Client
+	queue  chan *Event
+}
+
+func newWebhook(config *WebhookConfig) *webhook {
+	return &webhook{
+		config: config,
+		client: &http.Client{Timeout: webhookTimeout},
+		queue:  make(chan *Event, webhookQueueSize),
+	}
+}
+
+// accepts returns true if the events of the given type must be sent to the
+// webhook.
+func (w *webhook) accepts(typ Type) bool {
+	if len(w.config.Events) == 0 {
+		return true
+	}
+	for _, t := range w.config.Events {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueue queues the event if the webhook accepts it. Events are dropped if
+// the queue is full.
+func (w *webhook) enqueue(e *Event) {
+	if !w.accepts(e.Type) {
+		return
+	}
+	select {
+	case w.queue <- e:
+	default:
+		log.Printf("events: webhook %s queue is full, dropping event %s", w.config.URL, e.ID)
+	}
+}
+
+// run delivers the queued events until the queue is closed.
+func (w *webhook) run(wg *sync.WaitGroup) {
+	defer wg.Done()
+	for e := range w.queue {
+		w.deliver(e)
+	}
+}
+
+func (w *webhook) deliver(e *Event) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("events: error marshaling event %s: %v", e.ID, err)
+		return
+	}
+	for i := 0; i < webhookMaxAttempts; i++ {
+		if i > 0 {
+			time.Sleep(time.Duration(i) * webhookRetryDelay)
+		}
+		if err = w.send(e, body); err == nil {
+			return
+		}
+	}
+	log.Printf("events: error sending event %s to webhook %s: %v", e.ID, w.config.URL, err)
+}
+
+func (w *webhook) send(e *Event, body []byte) error {
+	req, err := http.NewRequest("POST", w.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "error creating request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventTypeHeader, string(e.Type))
+	req.Header.Set(EventIDHeader, e.ID)
+	req.Header.Set(SignatureHeader, Sign(w.config.Secret, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "error sending request")
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
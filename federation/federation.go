@@ -0,0 +1,340 @@
+package federation
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/metrics"
+	"github.com/pkg/errors"
+)
+
+// DefaultInterval is the default interval between the synchronizations of the
+// federated roots.
+const DefaultInterval = time.Hour
+
+// DefaultTimeout is the maximum time of the requests to a peer.
+const DefaultTimeout = 30 * time.Second
+
+// maxResponseSize is the maximum size of the responses of the peers.
+const maxResponseSize = 10 << 20
+
+// Config is the configuration of the synchronization of the federated roots.
+// On every interval the roots of each peer are fetched and validated, and
+// they replace the ones fetched before from the same peer.
+type Config struct {
+	Interval string        `json:"interval,omitempty"`
+	Peers    []*PeerConfig `json:"peers"`
+	interval time.Duration
+}
+
+// PeerConfig is a CA whose roots are federated. With URL, the peer is a step
+// CA: its root with the given fingerprint is downloaded and used to verify
+// the connection to its /federation endpoint. With BundleURL, the PEM bundle
+// is downloaded over HTTPS with the system roots and it must contain the root
+// with the given fingerprint.
+type PeerConfig struct {
+	Name        string `json:"name"`
+	URL         string `json:"url,omitempty"`
+	BundleURL   string `json:"bundleURL,omitempty"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// Validate validates the federation configuration.
+func (c *Config) Validate() error {
+	if c == nil {
+		return nil
+	}
+	c.interval = DefaultInterval
+	if c.Interval != "" {
+		d, err := time.ParseDuration(c.Interval)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing federation.interval %s", c.Interval)
+		}
+		if d <= 0 {
+			return errors.New("federation.interval must be greater than 0")
+		}
+		c.interval = d
+	}
+
+	if len(c.Peers) == 0 {
+		return errors.New("federation.peers cannot be empty")
+	}
+	names := make(map[string]bool, len(c.Peers))
+	for i, p := range c.Peers {
+		if p == nil {
+			return errors.Errorf("federation.peers[%d] cannot be empty", i)
+		}
+		if p.Name == "" {
+			return errors.Errorf("federation.peers[%d].name cannot be empty", i)
+		}
+		if names[p.Name] {
+			return errors.Errorf("federation.peers[%d].name %s is duplicated", i, p.Name)
+		}
+		names[p.Name] = true
+		if err := p.validate(); err != nil {
+			return errors.Wrapf(err, "federation.peers[%d]", i)
+		}
+	}
+	return nil
+}
+
+// GetInterval returns the interval between the synchronizations.
+func (c *Config) GetInterval() time.Duration {
+	if c == nil || c.interval == 0 {
+		return DefaultInterval
+	}
+	return c.interval
+}
+
+func (p *PeerConfig) validate() error {
+	switch {
+	case p.URL == "" && p.BundleURL == "":
+		return errors.New("url or bundleURL is required")
+	case p.URL != "" && p.BundleURL != "":
+		return errors.New("url and bundleURL cannot be used together")
+	}
+	for _, s := range []string{p.URL, p.BundleURL} {
+		if s == "" {
+			continue
+		}
+		u, err := url.Parse(s)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return errors.Errorf("url %s is not a valid https url", s)
+		}
+	}
+	p.Fingerprint = strings.ToLower(strings.Replace(p.Fingerprint, ":", "", -1))
+	if b, err := hex.DecodeString(p.Fingerprint); err != nil || len(b) != sha256.Size {
+		return errors.New("fingerprint must be the hex encoded SHA-256 of a root certificate")
+	}
+	return nil
+}
+
+// Update receives the roots fetched from a peer.
+type Update func(peer string, roots []*x509.Certificate)
+
+// Syncer fetches periodically the roots of the peers.
+type Syncer struct {
+	config *Config
+	update Update
+	client *http.Client
+	mu     sync.Mutex
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// New creates a Syncer with the given configuration. The roots fetched from
+// every peer are sent to update.
+func New(c *Config, update Update) (*Syncer, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &Syncer{
+		config: c,
+		update: update,
+		client: &http.Client{Timeout: DefaultTimeout},
+	}, nil
+}
+
+// Run fetches the roots of all the peers. If the roots of a peer cannot be
+// fetched or validated, the error is logged and the roots fetched before are
+// kept. It returns the number of peers that failed.
+func (s *Syncer) Run() int {
+	var failed int
+	for _, p := range s.config.Peers {
+		roots, err := s.fetch(p)
+		if err != nil {
+			failed++
+			metrics.FederationSyncs.Inc(p.Name, "error")
+			log.Printf("error synchronizing federated roots from %s: %v", p.Name, err)
+			continue
+		}
+		metrics.FederationSyncs.Inc(p.Name, "ok")
+		s.update(p.Name, roots)
+	}
+	return failed
+}
+
+// fetch returns the validated roots of the given peer.
+func (s *Syncer) fetch(p *PeerConfig) ([]*x509.Certificate, error) {
+	if p.BundleURL != "" {
+		b, err := s.get(s.client, p.BundleURL)
+		if err != nil {
+			return nil, err
+		}
+		certs, err := parseBundle(b)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing %s", p.BundleURL)
+		}
+		return validateRoots(certs, p.Fingerprint)
+	}
+
+	// Download the root of the peer, the fingerprint is checked because the
+	// connection cannot be verified yet.
+	base := strings.TrimSuffix(p.URL, "/")
+	insecure := &http.Client{
+		Timeout: DefaultTimeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	b, err := s.get(insecure, base+"/root/"+p.Fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	var rootResp struct {
+		Root string `json:"ca"`
+	}
+	if err := json.Unmarshal(b, &rootResp); err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s/root response", base)
+	}
+	root, err := parseBundle([]byte(rootResp.Root))
+	if err != nil || len(root) != 1 {
+		return nil, errors.Errorf("error parsing %s/root response: invalid certificate", base)
+	}
+	if _, err := validateRoots(root, p.Fingerprint); err != nil {
+		return nil, err
+	}
+
+	// Download the federation verifying the connection with the root.
+	pool := x509.NewCertPool()
+	pool.AddCert(root[0])
+	verified := &http.Client{
+		Timeout: DefaultTimeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{RootCAs: pool},
+		},
+	}
+	if b, err = s.get(verified, base+"/federation"); err != nil {
+		return nil, err
+	}
+	var fedResp struct {
+		Certificates []string `json:"crts"`
+	}
+	if err := json.Unmarshal(b, &fedResp); err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s/federation response", base)
+	}
+	certs, err := parseBundle([]byte(strings.Join(fedResp.Certificates, "")))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing %s/federation response", base)
+	}
+	return validateRoots(append(certs, root[0]), p.Fingerprint)
+}
+
+// get returns the body of a GET request to the given url.
+func (s *Syncer) get(client *http.Client, u string) ([]byte, error) {
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error getting %s", u)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, errors.Errorf("error getting %s: status %d", u, resp.StatusCode)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
+	if err != nil {
+		return nil, errors.Wrapf(err, "error reading %s", u)
+	}
+	if len(b) > maxResponseSize {
+		return nil, errors.Errorf("error reading %s: response too large", u)
+	}
+	return b, nil
+}
+
+// parseBundle returns the certificates of a PEM bundle.
+func parseBundle(b []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		if block, b = pem.Decode(b); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		crt, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, crt)
+	}
+	return certs, nil
+}
+
+// validateRoots returns the valid CA certificates of the given list, without
+// duplicates. The root with the given fingerprint must be one of them.
+func validateRoots(certs []*x509.Certificate, fingerprint string) ([]*x509.Certificate, error) {
+	now := time.Now()
+	var found bool
+	var roots []*x509.Certificate
+	seen := make(map[string]bool, len(certs))
+	for _, crt := range certs {
+		sum := sha256.Sum256(crt.Raw)
+		fp := hex.EncodeToString(sum[:])
+		if seen[fp] || !crt.BasicConstraintsValid || !crt.IsCA ||
+			now.Before(crt.NotBefore) || now.After(crt.NotAfter) {
+			continue
+		}
+		seen[fp] = true
+		found = found || fp == fingerprint
+		roots = append(roots, crt)
+	}
+	if !found {
+		return nil, errors.Errorf("root with fingerprint %s was not found", fingerprint)
+	}
+	return roots, nil
+}
+
+// Start runs the synchronizations in the background, the first one right
+// away and then on every interval, until Stop is called.
+func (s *Syncer) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go func(stop, done chan struct{}) {
+		defer close(done)
+		ticker := time.NewTicker(s.config.GetInterval())
+		defer ticker.Stop()
+		for {
+			s.Run()
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}(s.stop, s.done)
+}
+
+// Stop stops the background synchronizations and waits for the current one
+// to finish.
+func (s *Syncer) Stop() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	stop, done := s.stop, s.done
+	s.stop, s.done = nil, nil
+	s.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
@@ -0,0 +1,267 @@
+package federation
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	fp := strings.Repeat("ab", 32)
+	tests := []struct {
+		name    string
+		config  *Config
+		wantErr bool
+	}{
+		{"ok-nil", nil, false},
+		{"ok", &Config{Interval: "10m", Peers: []*PeerConfig{
+			{Name: "a", URL: "https://ca.a.example.com", Fingerprint: fp},
+			{Name: "b", BundleURL: "https://b.example.com/roots.pem", Fingerprint: strings.ToUpper(fp)},
+		}}, false},
+		{"fail-interval", &Config{Interval: "foo", Peers: []*PeerConfig{{Name: "a", URL: "https://ca", Fingerprint: fp}}}, true},
+		{"fail-interval-zero", &Config{Interval: "0s", Peers: []*PeerConfig{{Name: "a", URL: "https://ca", Fingerprint: fp}}}, true},
+		{"fail-no-peers", &Config{}, true},
+		{"fail-nil-peer", &Config{Peers: []*PeerConfig{nil}}, true},
+		{"fail-name", &Config{Peers: []*PeerConfig{{URL: "https://ca", Fingerprint: fp}}}, true},
+		{"fail-duplicated", &Config{Peers: []*PeerConfig{
+			{Name: "a", URL: "https://ca", Fingerprint: fp}, {Name: "a", URL: "https://ca", Fingerprint: fp},
+		}}, true},
+		{"fail-no-url", &Config{Peers: []*PeerConfig{{Name: "a", Fingerprint: fp}}}, true},
+		{"fail-both-urls", &Config{Peers: []*PeerConfig{{Name: "a", URL: "https://ca", BundleURL: "https://ca/roots.pem", Fingerprint: fp}}}, true},
+		{"fail-http", &Config{Peers: []*PeerConfig{{Name: "a", URL: "http://ca", Fingerprint: fp}}}, true},
+		{"fail-bundle-http", &Config{Peers: []*PeerConfig{{Name: "a", BundleURL: "http://ca/roots.pem", Fingerprint: fp}}}, true},
+		{"fail-fingerprint", &Config{Peers: []*PeerConfig{{Name: "a", URL: "https://ca", Fingerprint: "abcd"}}}, true},
+		{"fail-no-fingerprint", &Config{Peers: []*PeerConfig{{Name: "a", URL: "https://ca"}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Config.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	c := &Config{Peers: []*PeerConfig{{Name: "a", URL: "https://ca", Fingerprint: "AB:" + strings.Repeat("ab", 31)}}}
+	assert.FatalError(t, c.Validate())
+	assert.Equals(t, fp, c.Peers[0].Fingerprint)
+	assert.Equals(t, DefaultInterval, c.GetInterval())
+	assert.Equals(t, DefaultInterval, (*Config)(nil).GetInterval())
+}
+
+type testCA struct {
+	root *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	assert.FatalError(t, err)
+	root, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+	return &testCA{root: root, key: key}
+}
+
+// serverCertificate returns a certificate for 127.0.0.1 signed by the root.
+func (c *testCA) serverCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, c.root, key.Public(), c.key)
+	assert.FatalError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func (c *testCA) fingerprint() string {
+	sum := sha256.Sum256(c.root.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func pemCert(crt *x509.Certificate) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw}))
+}
+
+// newPeer starts a step CA serving its root and the given federation.
+func newPeer(t *testing.T, ca *testCA, federation ...*x509.Certificate) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/root/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.TrimPrefix(r.URL.Path, "/root/") != ca.fingerprint() {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"ca": pemCert(ca.root)})
+	})
+	mux.HandleFunc("/federation", func(w http.ResponseWriter, r *http.Request) {
+		crts := make([]string, len(federation))
+		for i, crt := range federation {
+			crts[i] = pemCert(crt)
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string][]string{"crts": crts})
+	})
+	srv := httptest.NewUnstartedServer(mux)
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{ca.serverCertificate(t)}}
+	srv.StartTLS()
+	return srv
+}
+
+type updates struct {
+	mu    sync.Mutex
+	roots map[string][]*x509.Certificate
+}
+
+func (u *updates) update(peer string, roots []*x509.Certificate) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.roots[peer] = roots
+}
+
+func (u *updates) get(peer string) ([]*x509.Certificate, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	roots, ok := u.roots[peer]
+	return roots, ok
+}
+
+func TestSyncer_Run(t *testing.T) {
+	a := newTestCA(t, "A Root")
+	b := newTestCA(t, "B Root")
+	other := newTestCA(t, "Other Root")
+	srvA := newPeer(t, a, a.root, other.root, other.root)
+	defer srvA.Close()
+	// The federation of b does not have its own root.
+	srvB := newPeer(t, b)
+	defer srvB.Close()
+	// The peer serves a root that is not the expected one.
+	srvC := newPeer(t, other)
+	defer srvC.Close()
+
+	bundle := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(pemCert(b.root) + pemCert(a.root)))
+	}))
+	defer bundle.Close()
+
+	u := &updates{roots: make(map[string][]*x509.Certificate)}
+	s, err := New(&Config{Peers: []*PeerConfig{
+		{Name: "a", URL: srvA.URL, Fingerprint: a.fingerprint()},
+		{Name: "b", URL: srvB.URL + "/", Fingerprint: b.fingerprint()},
+		{Name: "c", URL: srvC.URL, Fingerprint: a.fingerprint()},
+		{Name: "bundle", BundleURL: bundle.URL, Fingerprint: b.fingerprint()},
+		{Name: "bundle-fail", BundleURL: bundle.URL, Fingerprint: other.fingerprint()},
+	}}, u.update)
+	assert.FatalError(t, err)
+	s.client = bundle.Client()
+
+	assert.Equals(t, 2, s.Run())
+	roots, ok := u.get("a")
+	assert.True(t, ok)
+	assert.Equals(t, []*x509.Certificate{a.root, other.root}, roots)
+	roots, ok = u.get("b")
+	assert.True(t, ok)
+	assert.Equals(t, []*x509.Certificate{b.root}, roots)
+	_, ok = u.get("c")
+	assert.False(t, ok)
+	roots, ok = u.get("bundle")
+	assert.True(t, ok)
+	assert.Equals(t, []*x509.Certificate{b.root, a.root}, roots)
+	_, ok = u.get("bundle-fail")
+	assert.False(t, ok)
+}
+
+func TestSyncer_Run_errors(t *testing.T) {
+	a := newTestCA(t, "A Root")
+	// The server certificate is not signed by the root of the peer.
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"ca": pemCert(a.root)})
+	}))
+	defer srv.Close()
+	notFound := httptest.NewTLSServer(http.NotFoundHandler())
+	defer notFound.Close()
+
+	u := &updates{roots: make(map[string][]*x509.Certificate)}
+	s, err := New(&Config{Peers: []*PeerConfig{
+		{Name: "untrusted", URL: srv.URL, Fingerprint: a.fingerprint()},
+		{Name: "not-found", URL: notFound.URL, Fingerprint: a.fingerprint()},
+		{Name: "bundle-not-found", BundleURL: notFound.URL, Fingerprint: a.fingerprint()},
+	}}, u.update)
+	assert.FatalError(t, err)
+	s.client = notFound.Client()
+	assert.Equals(t, 3, s.Run())
+	assert.Equals(t, 0, len(u.roots))
+}
+
+func Test_validateRoots(t *testing.T) {
+	a := newTestCA(t, "A Root")
+	expired := newTestCA(t, "Expired Root")
+	expired.root.NotAfter = time.Now().Add(-time.Second)
+	leaf, err := x509.ParseCertificate(a.serverCertificate(t).Certificate[0])
+	assert.FatalError(t, err)
+
+	roots, err := validateRoots([]*x509.Certificate{leaf, expired.root, a.root, a.root}, a.fingerprint())
+	assert.FatalError(t, err)
+	assert.Equals(t, []*x509.Certificate{a.root}, roots)
+
+	_, err = validateRoots([]*x509.Certificate{a.root}, expired.fingerprint())
+	assert.Error(t, err)
+}
+
+func TestSyncer_StartStop(t *testing.T) {
+	a := newTestCA(t, "A Root")
+	srv := newPeer(t, a, a.root)
+	defer srv.Close()
+
+	done := make(chan struct{})
+	var once sync.Once
+	s, err := New(&Config{Peers: []*PeerConfig{{Name: "a", URL: srv.URL, Fingerprint: a.fingerprint()}}},
+		func(peer string, roots []*x509.Certificate) {
+			once.Do(func() { close(done) })
+		})
+	assert.FatalError(t, err)
+
+	// The first synchronization runs right away.
+	s.Start()
+	s.Start()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the first synchronization")
+	}
+	s.Stop()
+	s.Stop()
+	(*Syncer)(nil).Stop()
+}
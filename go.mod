@@ -5,6 +5,7 @@ go 1.13
 require (
 	github.com/RTradeLtd/ca-cli v0.17.0
 	github.com/go-chi/chi v4.0.2+incompatible
+	github.com/golang/protobuf v1.3.2
 	github.com/newrelic/go-agent v2.15.0+incompatible
 	github.com/pkg/errors v0.8.1
 	github.com/rs/xid v1.2.1
@@ -14,5 +15,7 @@ require (
 	github.com/urfave/cli v1.20.1-0.20181029213200-b67dcf995b6a
 	golang.org/x/crypto v0.0.0-20191011191535-87dc89f01550
 	golang.org/x/net v0.0.0-20190620200207-3b0461eec859
+	golang.org/x/sys v0.0.0-20191008105621-543471e840be
+	google.golang.org/grpc v1.24.0
 	gopkg.in/square/go-jose.v2 v2.4.0
 )
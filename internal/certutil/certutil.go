@@ -0,0 +1,36 @@
+// Package certutil contains the helpers shared by the packages that deliver
+// certificates to workloads, like the Kubernetes controller and the SDS
+// server.
+package certutil
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"sort"
+)
+
+// EncodeCertificates returns the PEM encoding of the given certificates.
+func EncodeCertificates(certs []*x509.Certificate) []byte {
+	var b []byte
+	for _, crt := range certs {
+		b = append(b, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw})...)
+	}
+	return b
+}
+
+// EqualNames returns true if both lists have the same names in any order.
+func EqualNames(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
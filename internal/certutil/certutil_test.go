@@ -0,0 +1,47 @@
+package certutil
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestEncodeCertificates(t *testing.T) {
+	certs := []*x509.Certificate{{Raw: []byte("leaf")}, {Raw: []byte("intermediate")}}
+	b := EncodeCertificates(certs)
+	for _, crt := range certs {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if assert.NotNil(t, block) {
+			assert.Equals(t, "CERTIFICATE", block.Type)
+			assert.Equals(t, crt.Raw, block.Bytes)
+		}
+	}
+	assert.Len(t, 0, b)
+	assert.Nil(t, EncodeCertificates(nil))
+}
+
+func TestEqualNames(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want bool
+	}{
+		{"ok-empty", nil, []string{}, true},
+		{"ok-same-order", []string{"a", "b"}, []string{"a", "b"}, true},
+		{"ok-other-order", []string{"b", "a"}, []string{"a", "b"}, true},
+		{"fail-length", []string{"a"}, []string{"a", "b"}, false},
+		{"fail-names", []string{"a", "c"}, []string{"a", "b"}, false},
+		{"fail-duplicates", []string{"a", "a"}, []string{"a", "b"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := append([]string(nil), tt.a...)
+			assert.Equals(t, tt.want, EqualNames(tt.a, tt.b))
+			// The lists are not modified.
+			assert.Equals(t, a, append([]string(nil), tt.a...))
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Paths of the credentials of the service account of a pod.
+const (
+	InClusterTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+	InClusterCAFile    = "/var/run/secrets/kubernetes.io/serviceaccount/ca.crt"
+)
+
+// requestTimeout is the timeout of the requests to the Kubernetes API.
+const requestTimeout = 30 * time.Second
+
+// maxResponseSize is the maximum size of the responses of the Kubernetes API.
+const maxResponseSize = 32 << 20
+
+// Client is a minimal client of the Kubernetes API, it only implements the
+// requests used by the controller. The token is read from TokenFile on each
+// request, so the rotated service account tokens are used.
+type Client struct {
+	Server     string
+	TokenFile  string
+	HTTPClient *http.Client
+}
+
+// NewClient creates a new Kubernetes client. The empty arguments default to
+// the in-cluster configuration: the server in the KUBERNETES_SERVICE_HOST and
+// KUBERNETES_SERVICE_PORT environment variables, and the token and CA of the
+// service account of the pod.
+func NewClient(server, tokenFile, caFile string) (*Client, error) {
+	if server == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, errors.New("error creating kubernetes client: apiServer is not configured and KUBERNETES_SERVICE_HOST is not set")
+		}
+		server = "https://" + net.JoinHostPort(host, port)
+	}
+	if tokenFile == "" {
+		tokenFile = InClusterTokenFile
+	}
+	if caFile == "" {
+		caFile = InClusterCAFile
+	}
+
+	httpClient := http.DefaultClient
+	if b, err := ioutil.ReadFile(caFile); err == nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, errors.Errorf("error parsing %s: no certificates found", caFile)
+		}
+		httpClient = &http.Client{
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			},
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "error reading %s", caFile)
+	}
+
+	return &Client{
+		Server:     strings.TrimRight(server, "/"),
+		TokenFile:  tokenFile,
+		HTTPClient: httpClient,
+	}, nil
+}
+
+// Token returns the service account token used by the client.
+func (c *Client) Token() (string, error) {
+	b, err := ioutil.ReadFile(c.TokenFile)
+	if err != nil {
+		return "", errors.Wrapf(err, "error reading %s", c.TokenFile)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// StatusError is the error returned for the unsuccessful responses.
+type StatusError struct {
+	Code    int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return e.Message
+}
+
+// IsNotFound returns true if the error is a 404 Not Found response.
+func IsNotFound(err error) bool {
+	se, ok := errors.Cause(err).(*StatusError)
+	return ok && se.Code == http.StatusNotFound
+}
+
+// ObjectMeta contains the metadata of the Kubernetes objects used by the
+// controller.
+type ObjectMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+	ResourceVersion string            `json:"resourceVersion,omitempty"`
+}
+
+// Service is a Kubernetes Service, only the metadata is used.
+type Service struct {
+	Metadata ObjectMeta `json:"metadata"`
+}
+
+// Ingress is a Kubernetes Ingress, only the hosts are used.
+type Ingress struct {
+	Metadata ObjectMeta `json:"metadata"`
+	Spec     struct {
+		Rules []struct {
+			Host string `json:"host,omitempty"`
+		} `json:"rules,omitempty"`
+		TLS []struct {
+			Hosts []string `json:"hosts,omitempty"`
+		} `json:"tls,omitempty"`
+	} `json:"spec"`
+}
+
+// Secret is a Kubernetes Secret.
+type Secret struct {
+	APIVersion string            `json:"apiVersion"`
+	Kind       string            `json:"kind"`
+	Metadata   ObjectMeta        `json:"metadata"`
+	Type       string            `json:"type,omitempty"`
+	Data       map[string][]byte `json:"data,omitempty"`
+}
+
+// ListServices returns the Services in the given namespace, or in all the
+// namespaces if it is empty.
+func (c *Client) ListServices(ctx context.Context, namespace string) ([]Service, error) {
+	var list struct {
+		Items []Service `json:"items"`
+	}
+	if err := c.do(ctx, "GET", resourcePath("/api/v1", namespace, "services", ""), nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// ListIngresses returns the Ingresses in the given namespace, or in all the
+// namespaces if it is empty.
+func (c *Client) ListIngresses(ctx context.Context, namespace string) ([]Ingress, error) {
+	var list struct {
+		Items []Ingress `json:"items"`
+	}
+	if err := c.do(ctx, "GET", resourcePath("/apis/networking.k8s.io/v1", namespace, "ingresses", ""), nil, &list); err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// GetSecret returns the Secret with the given namespace and name.
+func (c *Client) GetSecret(ctx context.Context, namespace, name string) (*Secret, error) {
+	secret := new(Secret)
+	if err := c.do(ctx, "GET", resourcePath("/api/v1", namespace, "secrets", name), nil, secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+// CreateSecret creates the given Secret.
+func (c *Client) CreateSecret(ctx context.Context, secret *Secret) error {
+	return c.do(ctx, "POST", resourcePath("/api/v1", secret.Metadata.Namespace, "secrets", ""), secret, nil)
+}
+
+// UpdateSecret replaces the given Secret, the resource version of the Secret
+// must be the current one.
+func (c *Client) UpdateSecret(ctx context.Context, secret *Secret) error {
+	return c.do(ctx, "PUT", resourcePath("/api/v1", secret.Metadata.Namespace, "secrets", secret.Metadata.Name), secret, nil)
+}
+
+func resourcePath(prefix, namespace, resource, name string) string {
+	p := prefix
+	if namespace != "" {
+		p += "/namespaces/" + url.PathEscape(namespace)
+	}
+	p += "/" + resource
+	if name != "" {
+		p += "/" + url.PathEscape(name)
+	}
+	return p
+}
+
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return errors.Wrap(err, "error marshaling request")
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, c.Server+path, body)
+	if err != nil {
+		return errors.Wrapf(err, "error creating request %s %s", method, path)
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token, err := c.Token(); err == nil {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if !os.IsNotExist(errors.Cause(err)) {
+		return err
+	}
+
+	resp, err := c.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrapf(err, "error requesting %s %s", method, path)
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return errors.Wrapf(err, "error reading response of %s %s", method, path)
+	}
+	if resp.StatusCode >= 400 {
+		var status struct {
+			Message string `json:"message"`
+		}
+		json.Unmarshal(b, &status)
+		if status.Message == "" {
+			status.Message = resp.Status
+		}
+		return &StatusError{
+			Code:    resp.StatusCode,
+			Message: "error requesting " + method + " " + path + ": " + status.Message,
+		}
+	}
+	if out != nil {
+		if err := json.Unmarshal(b, out); err != nil {
+			return errors.Wrapf(err, "error parsing response of %s %s", method, path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,416 @@
+// Package k8s implements a controller that issues certificates for the
+// annotated Services and Ingresses of a Kubernetes cluster and writes them in
+// TLS Secrets, renewing them before they expire and when the roots of the CA
+// change.
+//
+// A Service or an Ingress is managed if it has the annotation
+// certificates.step.sm/secret-name with the name of the Secret, in the same
+// namespace, where the certificate is written. The certificate of a Service
+// is valid for its cluster DNS names and the one of an Ingress for its hosts,
+// additional names can be added with a comma separated list in the
+// certificates.step.sm/sans annotation.
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/internal/certutil"
+	"github.com/RTradeLtd/ca-cli/crypto/x509util"
+	"github.com/pkg/errors"
+)
+
+// Annotations of the Services and Ingresses managed by the controller.
+const (
+	SecretNameAnnotation = "certificates.step.sm/secret-name"
+	SANsAnnotation       = "certificates.step.sm/sans"
+)
+
+// ManagedByLabel is the label of the Secrets written by the controller, the
+// controller never overwrites a Secret without it.
+const (
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	ManagedByValue = "step-ca"
+)
+
+// Keys of the data of the TLS Secrets.
+const (
+	TLSCertKey = "tls.crt"
+	TLSKeyKey  = "tls.key"
+	CACertKey  = "ca.crt"
+)
+
+// SecretTypeTLS is the type of the Secrets written by the controller.
+const SecretTypeTLS = "kubernetes.io/tls"
+
+// Authority is the interface implemented by the CA authority used by the
+// controller.
+type Authority interface {
+	MintToken(opts authority.MintOptions) (string, error)
+	Authorize(ctx context.Context, ott string) ([]provisioner.SignOption, error)
+	Sign(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
+	GetRoots() ([]*x509.Certificate, error)
+}
+
+// Options are the options of the controller. The certificates are signed with
+// tokens minted with Provisioner or, if K8sSA is set, with the service account
+// token of the client. The certificates are renewed RenewBefore their
+// expiration, or after two thirds of their validity if it is 0.
+type Options struct {
+	Provisioner   string
+	K8sSA         bool
+	Namespaces    []string
+	ClusterDomain string
+	CertDuration  time.Duration
+	RenewBefore   time.Duration
+	Resync        time.Duration
+}
+
+// Controller writes the certificates of the annotated Services and Ingresses
+// in TLS Secrets.
+type Controller struct {
+	client *Client
+	mutex  sync.RWMutex
+	auth   Authority
+	opts   Options
+}
+
+// New creates a new controller with the given client, authority and options.
+func New(client *Client, auth Authority, opts Options) *Controller {
+	if opts.ClusterDomain == "" {
+		opts.ClusterDomain = authority.DefaultKubernetesClusterDomain
+	}
+	if opts.Resync <= 0 {
+		opts.Resync = authority.DefaultKubernetesResync
+	}
+	return &Controller{client: client, auth: auth, opts: opts}
+}
+
+// SetAuthority replaces the authority of the controller, it is used when the
+// CA configuration is reloaded.
+func (c *Controller) SetAuthority(auth Authority) {
+	c.mutex.Lock()
+	c.auth = auth
+	c.mutex.Unlock()
+}
+
+func (c *Controller) getAuthority() Authority {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.auth
+}
+
+// Run synchronizes the Secrets every resync interval until the context is
+// done.
+func (c *Controller) Run(ctx context.Context) {
+	for {
+		if err := c.Sync(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("kubernetes: %v", err)
+		}
+		t := time.NewTimer(c.opts.Resync)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return
+		}
+	}
+}
+
+// target is a Secret with the certificate of a Service or an Ingress.
+type target struct {
+	kind       string
+	namespace  string
+	name       string
+	secretName string
+	subject    string
+	sans       []string
+}
+
+func (t *target) String() string {
+	return t.kind + " " + t.namespace + "/" + t.name
+}
+
+// Sync issues the certificates of the annotated Services and Ingresses whose
+// Secrets are missing or need to be renewed. The errors of the individual
+// Secrets are logged, and it only returns the errors listing the resources.
+func (c *Controller) Sync(ctx context.Context) error {
+	targets, err := c.targets(ctx)
+	if err != nil {
+		return err
+	}
+	for _, t := range targets {
+		if err := c.reconcile(ctx, t); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("kubernetes: error writing secret %s/%s for %s: %v", t.namespace, t.secretName, t, err)
+		}
+	}
+	return nil
+}
+
+// targets returns the Secrets of the annotated Services and Ingresses.
+func (c *Controller) targets(ctx context.Context) ([]*target, error) {
+	namespaces := c.opts.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
+	var targets []*target
+	for _, ns := range namespaces {
+		services, err := c.client.ListServices(ctx, ns)
+		if err != nil {
+			return nil, err
+		}
+		for _, svc := range services {
+			if t := c.serviceTarget(svc); t != nil {
+				targets = append(targets, t)
+			}
+		}
+		// Clusters without the networking.k8s.io/v1 API do not have Ingresses.
+		ingresses, err := c.client.ListIngresses(ctx, ns)
+		if err != nil && !IsNotFound(err) {
+			return nil, err
+		}
+		for _, ing := range ingresses {
+			if t := ingressTarget(ing); t != nil {
+				targets = append(targets, t)
+			}
+		}
+	}
+	return targets, nil
+}
+
+// serviceTarget returns the target of an annotated Service, the certificate
+// is valid for the DNS names of the Service in the cluster.
+func (c *Controller) serviceTarget(svc Service) *target {
+	m := svc.Metadata
+	secretName := m.Annotations[SecretNameAnnotation]
+	if secretName == "" {
+		return nil
+	}
+	svcName := m.Name + "." + m.Namespace + ".svc"
+	return &target{
+		kind:       "service",
+		namespace:  m.Namespace,
+		name:       m.Name,
+		secretName: secretName,
+		subject:    svcName,
+		sans: uniqueNames([]string{
+			svcName, m.Name, m.Name + "." + m.Namespace, svcName + "." + c.opts.ClusterDomain,
+		}, m.Annotations[SANsAnnotation]),
+	}
+}
+
+// ingressTarget returns the target of an annotated Ingress, the certificate
+// is valid for the hosts of the Ingress. Ingresses without hosts are ignored.
+func ingressTarget(ing Ingress) *target {
+	m := ing.Metadata
+	secretName := m.Annotations[SecretNameAnnotation]
+	if secretName == "" {
+		return nil
+	}
+	var hosts []string
+	for _, r := range ing.Spec.Rules {
+		hosts = append(hosts, r.Host)
+	}
+	for _, t := range ing.Spec.TLS {
+		hosts = append(hosts, t.Hosts...)
+	}
+	sans := uniqueNames(hosts, m.Annotations[SANsAnnotation])
+	if len(sans) == 0 {
+		log.Printf("kubernetes: ingress %s/%s does not have hosts", m.Namespace, m.Name)
+		return nil
+	}
+	return &target{
+		kind:       "ingress",
+		namespace:  m.Namespace,
+		name:       m.Name,
+		secretName: secretName,
+		subject:    sans[0],
+		sans:       sans,
+	}
+}
+
+// uniqueNames returns the given names and the ones in the comma separated
+// list without empty names and duplicates. The IP addresses are normalized so
+// they can be compared with the ones in the certificates.
+func uniqueNames(names []string, list string) []string {
+	if list != "" {
+		names = append(names, strings.Split(list, ",")...)
+	}
+	var result []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if ip := net.ParseIP(name); ip != nil {
+			name = ip.String()
+		}
+		if name != "" && !seen[name] {
+			seen[name] = true
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// reconcile writes a new certificate in the Secret of the target if it is
+// missing, if it does not match the target, or if it needs to be renewed.
+func (c *Controller) reconcile(ctx context.Context, t *target) error {
+	secret, err := c.client.GetSecret(ctx, t.namespace, t.secretName)
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+	if secret != nil && secret.Metadata.Labels[ManagedByLabel] != ManagedByValue {
+		return errors.Errorf("secret is not managed by %s", ManagedByValue)
+	}
+
+	auth := c.getAuthority()
+	roots, err := auth.GetRoots()
+	if err != nil {
+		return errors.Wrap(err, "error getting roots")
+	}
+	rootsPEM := certutil.EncodeCertificates(roots)
+	if secret != nil && !needsRenewal(secret, t, rootsPEM, c.opts.RenewBefore, time.Now()) {
+		return nil
+	}
+
+	chain, key, err := c.issue(ctx, auth, t)
+	if err != nil {
+		return err
+	}
+	newSecret := &Secret{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata: ObjectMeta{
+			Name:      t.secretName,
+			Namespace: t.namespace,
+			Labels: map[string]string{
+				ManagedByLabel: ManagedByValue,
+			},
+		},
+		Type: SecretTypeTLS,
+		Data: map[string][]byte{
+			TLSCertKey: certutil.EncodeCertificates(chain),
+			TLSKeyKey:  key,
+			CACertKey:  rootsPEM,
+		},
+	}
+	if secret == nil {
+		err = c.client.CreateSecret(ctx, newSecret)
+	} else {
+		// Keep the labels and annotations added by other tools.
+		newSecret.Metadata.ResourceVersion = secret.Metadata.ResourceVersion
+		newSecret.Metadata.Annotations = secret.Metadata.Annotations
+		for k, v := range secret.Metadata.Labels {
+			newSecret.Metadata.Labels[k] = v
+		}
+		err = c.client.UpdateSecret(ctx, newSecret)
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("kubernetes: wrote secret %s/%s for %s, valid until %s", t.namespace, t.secretName, t, chain[0].NotAfter.Format(time.RFC3339))
+	return nil
+}
+
+// needsRenewal returns true if the certificate in the given Secret cannot be
+// parsed, if its names or the roots do not match the target, or if it is
+// time to renew it.
+func needsRenewal(secret *Secret, t *target, rootsPEM []byte, renewBefore time.Duration, now time.Time) bool {
+	if !bytes.Equal(secret.Data[CACertKey], rootsPEM) || len(secret.Data[TLSKeyKey]) == 0 {
+		return true
+	}
+	block, _ := pem.Decode(secret.Data[TLSCertKey])
+	if block == nil || block.Type != "CERTIFICATE" {
+		return true
+	}
+	crt, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return true
+	}
+
+	var names []string
+	names = append(names, crt.DNSNames...)
+	for _, ip := range crt.IPAddresses {
+		names = append(names, ip.String())
+	}
+	if !certutil.EqualNames(names, t.sans) {
+		return true
+	}
+
+	renewAt := crt.NotBefore.Add(crt.NotAfter.Sub(crt.NotBefore) * 2 / 3)
+	if renewBefore > 0 {
+		renewAt = crt.NotAfter.Add(-renewBefore)
+	}
+	return !now.Before(renewAt)
+}
+
+// issue creates a new key and signs a certificate for the target. It returns
+// the certificate chain and the PEM encoded key.
+func (c *Controller) issue(ctx context.Context, auth Authority, t *target) ([]*x509.Certificate, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error generating key")
+	}
+	dnsNames, ips, _ := x509util.SplitSANs(t.sans)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:     pkix.Name{CommonName: t.subject},
+		DNSNames:    dnsNames,
+		IPAddresses: ips,
+	}, key)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error creating csr")
+	}
+	cr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error parsing csr")
+	}
+
+	var ott string
+	if c.opts.K8sSA {
+		ott, err = c.client.Token()
+	} else {
+		ott, err = auth.MintToken(authority.MintOptions{
+			Provisioner: c.opts.Provisioner,
+			Subject:     t.subject,
+			SANs:        t.sans,
+		})
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	signOpts, err := auth.Authorize(provisioner.NewContextWithMethod(ctx, provisioner.SignMethod), ott)
+	if err != nil {
+		return nil, nil, err
+	}
+	var signOptions provisioner.Options
+	if c.opts.CertDuration > 0 {
+		signOptions.NotAfter.SetDuration(c.opts.CertDuration)
+	}
+	chain, err := auth.Sign(ctx, cr, signOptions, signOpts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(chain) == 0 {
+		return nil, nil, errors.New("empty certificate chain")
+	}
+	b, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error marshaling key")
+	}
+	return chain, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b}), nil
+}
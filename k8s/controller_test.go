@@ -0,0 +1,369 @@
+package k8s
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/internal/certutil"
+	"github.com/smallstep/assert"
+)
+
+type mockAuthority struct {
+	mintToken func(opts authority.MintOptions) (string, error)
+	authorize func(ctx context.Context, ott string) ([]provisioner.SignOption, error)
+	sign      func(cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
+	getRoots  func() ([]*x509.Certificate, error)
+}
+
+func (m *mockAuthority) MintToken(opts authority.MintOptions) (string, error) {
+	return m.mintToken(opts)
+}
+
+func (m *mockAuthority) Authorize(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+	return m.authorize(ctx, ott)
+}
+
+func (m *mockAuthority) Sign(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+	return m.sign(cr, opts, signOpts...)
+}
+
+func (m *mockAuthority) GetRoots() ([]*x509.Certificate, error) {
+	return m.getRoots()
+}
+
+func generateCertificate(t *testing.T, cr *x509.CertificateRequest, notBefore time.Time, d time.Duration) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.Add(d),
+	}
+	var pub interface{} = key.Public()
+	if cr != nil {
+		if cr.PublicKey != nil {
+			pub = cr.PublicKey
+		}
+		template.Subject = cr.Subject
+		template.DNSNames = cr.DNSNames
+		template.IPAddresses = cr.IPAddresses
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, pub, key)
+	assert.FatalError(t, err)
+	crt, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+	return crt
+}
+
+func newMockAuthority(t *testing.T, root *x509.Certificate) *mockAuthority {
+	return &mockAuthority{
+		mintToken: func(opts authority.MintOptions) (string, error) {
+			assert.Equals(t, "k8s", opts.Provisioner)
+			return "ott", nil
+		},
+		authorize: func(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+			assert.Equals(t, provisioner.SignMethod, provisioner.MethodFromContext(ctx))
+			assert.Equals(t, "ott", ott)
+			return []provisioner.SignOption{}, nil
+		},
+		sign: func(cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+			return []*x509.Certificate{generateCertificate(t, cr, time.Now(), time.Hour)}, nil
+		},
+		getRoots: func() ([]*x509.Certificate, error) {
+			return []*x509.Certificate{root}, nil
+		},
+	}
+}
+
+// fakeAPIServer is a Kubernetes API server with the resources used by the
+// controller.
+type fakeAPIServer struct {
+	mutex     sync.Mutex
+	services  []Service
+	ingresses []Ingress
+	secrets   map[string]*Secret
+	writes    int
+	version   int
+}
+
+func (f *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer token" {
+		http.Error(w, `{"message":"Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+	writeJSON := func(v interface{}) {
+		json.NewEncoder(w).Encode(v)
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/api/v1/services":
+		writeJSON(map[string]interface{}{"items": f.services})
+	case r.URL.Path == "/apis/networking.k8s.io/v1/ingresses":
+		if f.ingresses == nil {
+			http.Error(w, `{"message":"the server could not find the requested resource"}`, http.StatusNotFound)
+			return
+		}
+		writeJSON(map[string]interface{}{"items": f.ingresses})
+	case len(parts) >= 5 && parts[4] == "secrets":
+		var secret Secret
+		if r.Method != "GET" {
+			if err := json.NewDecoder(r.Body).Decode(&secret); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		switch {
+		case r.Method == "GET" && len(parts) == 6:
+			s, ok := f.secrets[parts[3]+"/"+parts[5]]
+			if !ok {
+				http.Error(w, `{"message":"secrets not found"}`, http.StatusNotFound)
+				return
+			}
+			writeJSON(s)
+		case r.Method == "POST" && len(parts) == 5:
+			f.version++
+			secret.Metadata.ResourceVersion = strconv.Itoa(f.version)
+			f.secrets[parts[3]+"/"+secret.Metadata.Name] = &secret
+			f.writes++
+			writeJSON(secret)
+		case r.Method == "PUT" && len(parts) == 6:
+			old, ok := f.secrets[parts[3]+"/"+parts[5]]
+			if !ok || old.Metadata.ResourceVersion != secret.Metadata.ResourceVersion {
+				http.Error(w, `{"message":"conflict"}`, http.StatusConflict)
+				return
+			}
+			f.version++
+			secret.Metadata.ResourceVersion = strconv.Itoa(f.version)
+			f.secrets[parts[3]+"/"+parts[5]] = &secret
+			f.writes++
+			writeJSON(secret)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newTestClient(t *testing.T, f *fakeAPIServer) (*Client, func()) {
+	srv := httptest.NewServer(f)
+	dir, err := ioutil.TempDir("", "k8s")
+	assert.FatalError(t, err)
+	tokenFile := filepath.Join(dir, "token")
+	assert.FatalError(t, ioutil.WriteFile(tokenFile, []byte("token\n"), 0600))
+	client, err := NewClient(srv.URL, tokenFile, filepath.Join(dir, "missing.crt"))
+	assert.FatalError(t, err)
+	return client, func() {
+		srv.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func parseSecretCertificate(t *testing.T, s *Secret) *x509.Certificate {
+	block, _ := pem.Decode(s.Data[TLSCertKey])
+	if block == nil {
+		t.Fatal("tls.crt does not have a certificate")
+	}
+	crt, err := x509.ParseCertificate(block.Bytes)
+	assert.FatalError(t, err)
+	return crt
+}
+
+func TestController_Sync(t *testing.T) {
+	root := generateCertificate(t, nil, time.Now(), time.Hour)
+	annotations := func(secret, sans string) map[string]string {
+		m := map[string]string{SecretNameAnnotation: secret}
+		if sans != "" {
+			m[SANsAnnotation] = sans
+		}
+		return m
+	}
+	f := &fakeAPIServer{
+		services: []Service{
+			{Metadata: ObjectMeta{Name: "web", Namespace: "default", Annotations: annotations("web-tls", "10.0.0.1")}},
+			{Metadata: ObjectMeta{Name: "db", Namespace: "default"}},
+			{Metadata: ObjectMeta{Name: "foreign", Namespace: "default", Annotations: annotations("foreign-tls", "")}},
+		},
+		ingresses: []Ingress{
+			{Metadata: ObjectMeta{Name: "www", Namespace: "prod", Annotations: annotations("www-tls", "")}},
+		},
+		secrets: map[string]*Secret{
+			"default/foreign-tls": {Metadata: ObjectMeta{Name: "foreign-tls", Namespace: "default", ResourceVersion: "1"}},
+		},
+	}
+	f.ingresses[0].Spec.Rules = append(f.ingresses[0].Spec.Rules, struct {
+		Host string `json:"host,omitempty"`
+	}{Host: "www.example.com"})
+
+	client, closer := newTestClient(t, f)
+	defer closer()
+	auth := newMockAuthority(t, root)
+	c := New(client, auth, Options{Provisioner: "k8s"})
+
+	assert.FatalError(t, c.Sync(context.Background()))
+	assert.Equals(t, 2, f.writes)
+	assert.Equals(t, 3, len(f.secrets))
+
+	web := f.secrets["default/web-tls"]
+	assert.Equals(t, SecretTypeTLS, web.Type)
+	assert.Equals(t, ManagedByValue, web.Metadata.Labels[ManagedByLabel])
+	assert.Equals(t, certutil.EncodeCertificates([]*x509.Certificate{root}), web.Data[CACertKey])
+	crt := parseSecretCertificate(t, web)
+	assert.Equals(t, "web.default.svc", crt.Subject.CommonName)
+	assert.Equals(t, []string{"web.default.svc", "web", "web.default", "web.default.svc.cluster.local"}, crt.DNSNames)
+	assert.Equals(t, "10.0.0.1", crt.IPAddresses[0].String())
+	block, _ := pem.Decode(web.Data[TLSKeyKey])
+	if assert.NotNil(t, block) {
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		assert.FatalError(t, err)
+		assert.Equals(t, crt.PublicKey, key.Public())
+	}
+
+	www := f.secrets["prod/www-tls"]
+	crt = parseSecretCertificate(t, www)
+	assert.Equals(t, "www.example.com", crt.Subject.CommonName)
+	assert.Equals(t, []string{"www.example.com"}, crt.DNSNames)
+
+	// The foreign secret is not modified.
+	assert.Nil(t, f.secrets["default/foreign-tls"].Data)
+
+	// Nothing to renew.
+	assert.FatalError(t, c.Sync(context.Background()))
+	assert.Equals(t, 2, f.writes)
+
+	// Changes in the names and the roots rotate the certificates.
+	f.mutex.Lock()
+	f.services[0].Metadata.Annotations[SANsAnnotation] = ""
+	f.mutex.Unlock()
+	assert.FatalError(t, c.Sync(context.Background()))
+	assert.Equals(t, 3, f.writes)
+	crt = parseSecretCertificate(t, f.secrets["default/web-tls"])
+	assert.Len(t, 0, crt.IPAddresses)
+
+	newRoot := generateCertificate(t, nil, time.Now(), time.Hour)
+	c.SetAuthority(newMockAuthority(t, newRoot))
+	assert.FatalError(t, c.Sync(context.Background()))
+	assert.Equals(t, 5, f.writes)
+	assert.Equals(t, certutil.EncodeCertificates([]*x509.Certificate{newRoot}), f.secrets["prod/www-tls"].Data[CACertKey])
+}
+
+func TestController_Sync_k8sSA(t *testing.T) {
+	root := generateCertificate(t, nil, time.Now(), time.Hour)
+	f := &fakeAPIServer{
+		services: []Service{
+			{Metadata: ObjectMeta{Name: "web", Namespace: "default", Annotations: map[string]string{SecretNameAnnotation: "web-tls"}}},
+		},
+		secrets: map[string]*Secret{},
+	}
+	client, closer := newTestClient(t, f)
+	defer closer()
+
+	auth := newMockAuthority(t, root)
+	auth.mintToken = func(opts authority.MintOptions) (string, error) {
+		t.Error("MintToken should not be called")
+		return "", nil
+	}
+	auth.authorize = func(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+		assert.Equals(t, "token", ott)
+		return []provisioner.SignOption{}, nil
+	}
+	c := New(client, auth, Options{Provisioner: "k8s", K8sSA: true, ClusterDomain: "example.org"})
+	assert.FatalError(t, c.Sync(context.Background()))
+	assert.Equals(t, 1, f.writes)
+	crt := parseSecretCertificate(t, f.secrets["default/web-tls"])
+	assert.Equals(t, "web.default.svc.example.org", crt.DNSNames[3])
+}
+
+func Test_needsRenewal(t *testing.T) {
+	root := generateCertificate(t, nil, time.Now(), time.Hour)
+	rootsPEM := certutil.EncodeCertificates([]*x509.Certificate{root})
+	tgt := &target{sans: []string{"b.example.com", "a.example.com", "127.0.0.1"}}
+	now := time.Now().Truncate(time.Second)
+	crt := generateCertificate(t, &x509.CertificateRequest{
+		DNSNames:    []string{"a.example.com", "b.example.com"},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+	}, now, 3*time.Hour)
+	secret := func(crt []byte, key []byte, ca []byte) *Secret {
+		return &Secret{Data: map[string][]byte{TLSCertKey: crt, TLSKeyKey: key, CACertKey: ca}}
+	}
+	crtPEM := certutil.EncodeCertificates([]*x509.Certificate{crt})
+
+	type args struct {
+		secret      *Secret
+		t           *target
+		renewBefore time.Duration
+		now         time.Time
+	}
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{"ok", args{secret(crtPEM, []byte("key"), rootsPEM), tgt, 0, now.Add(time.Hour)}, false},
+		{"ok renewBefore", args{secret(crtPEM, []byte("key"), rootsPEM), tgt, time.Hour, now.Add(119 * time.Minute)}, false},
+		{"renew", args{secret(crtPEM, []byte("key"), rootsPEM), tgt, 0, now.Add(2 * time.Hour)}, true},
+		{"renew renewBefore", args{secret(crtPEM, []byte("key"), rootsPEM), tgt, 30 * time.Minute, now.Add(150 * time.Minute)}, true},
+		{"fail roots", args{secret(crtPEM, []byte("key"), nil), tgt, 0, now}, true},
+		{"fail key", args{secret(crtPEM, nil, rootsPEM), tgt, 0, now}, true},
+		{"fail certificate", args{secret([]byte("foo"), []byte("key"), rootsPEM), tgt, 0, now}, true},
+		{"fail names", args{secret(crtPEM, []byte("key"), rootsPEM), &target{sans: []string{"a.example.com", "b.example.com"}}, 0, now}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := needsRenewal(tt.args.secret, tt.args.t, rootsPEM, tt.args.renewBefore, tt.args.now); got != tt.want {
+				t.Errorf("needsRenewal() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_uniqueNames(t *testing.T) {
+	assert.Equals(t, []string{"a", "b", "c", "::1"}, uniqueNames([]string{"a", "b", "", "a"}, " c, 0:0::1 ,b,"))
+	assert.Equals(t, []string{"::1", "c"}, uniqueNames(nil, "0:0::1,c"))
+	assert.Len(t, 0, uniqueNames(nil, ""))
+}
+
+func TestClient_errors(t *testing.T) {
+	f := &fakeAPIServer{secrets: map[string]*Secret{}}
+	client, closer := newTestClient(t, f)
+	defer closer()
+
+	_, err := client.GetSecret(context.Background(), "default", "missing")
+	assert.True(t, IsNotFound(err))
+	assert.Equals(t, "error requesting GET /api/v1/namespaces/default/secrets/missing: secrets not found", err.Error())
+
+	client.TokenFile = filepath.Join(filepath.Dir(client.TokenFile), "other")
+	assert.FatalError(t, ioutil.WriteFile(client.TokenFile, []byte("other"), 0600))
+	_, err = client.ListServices(context.Background(), "")
+	assert.False(t, IsNotFound(err))
+	assert.Equals(t, "error requesting GET /api/v1/services: Unauthorized", err.Error())
+
+	_, err = NewClient("", "", "")
+	if err == nil {
+		t.Error("NewClient() error = nil, want an error without KUBERNETES_SERVICE_HOST")
+	}
+}
@@ -0,0 +1,98 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// apacheTimeFormat is the format of the time in the Apache access logs.
+const apacheTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// ApacheLogFormat implements the logrus.Formatter interface, it writes logrus
+// entries using the Apache common or combined log formats.
+type ApacheLogFormat struct {
+	Combined bool
+}
+
+// Format implements the logrus.Formatter interface. It returns the given
+// logrus entry as a line in the common log format of the Apache HTTP server:
+// 	<remote-address> - <user-id> [<time>] "<method> <path> <protocol>" <status> <size>
+// If the format is combined the line ends with:
+// 	"<referer>" "<user-agent>"
+// If a field is not known, the hyphen symbol (-) will be used. The size is
+// also a hyphen if no bytes were sent.
+func (f *ApacheLogFormat) Format(entry *logrus.Entry) ([]byte, error) {
+	t := entry.Time
+	if s, ok := entry.Data["time"].(string); ok {
+		if v, err := time.Parse(time.RFC3339, s); err == nil {
+			t = v
+		}
+	}
+	size := apacheField(entry.Data, "size")
+	if size == "0" {
+		size = "-"
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(apacheField(entry.Data, "remote-address"))
+	buf.WriteString(" - ")
+	buf.WriteString(apacheField(entry.Data, "user-id"))
+	buf.WriteString(" [")
+	buf.WriteString(t.Format(apacheTimeFormat))
+	buf.WriteString("] \"")
+	buf.WriteString(apacheEscape(apacheField(entry.Data, "method")))
+	buf.WriteByte(' ')
+	buf.WriteString(apacheEscape(apacheField(entry.Data, "path")))
+	buf.WriteByte(' ')
+	buf.WriteString(apacheEscape(apacheField(entry.Data, "protocol")))
+	buf.WriteString("\" ")
+	buf.WriteString(apacheField(entry.Data, "status"))
+	buf.WriteByte(' ')
+	buf.WriteString(size)
+	if f.Combined {
+		buf.WriteString(" \"")
+		buf.WriteString(apacheEscape(apacheField(entry.Data, "referer")))
+		buf.WriteString("\" \"")
+		buf.WriteString(apacheEscape(apacheField(entry.Data, "user-agent")))
+		buf.WriteByte('"')
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// apacheField returns the value of the given field as a string, or a hyphen
+// if it is not known.
+func apacheField(data logrus.Fields, name string) string {
+	v, ok := data[name]
+	if !ok {
+		return "-"
+	}
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case int:
+		s = strconv.Itoa(v)
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	default:
+		s = fmt.Sprintf("%v", v)
+	}
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+var apacheReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// apacheEscape escapes the quotes, backslashes and control characters of a
+// quoted field.
+func apacheEscape(s string) string {
+	return apacheReplacer.Replace(s)
+}
@@ -0,0 +1,72 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/smallstep/assert"
+)
+
+func TestApacheLogFormat_Format(t *testing.T) {
+	data := logrus.Fields{
+		"remote-address": "10.0.0.1",
+		"user-id":        "",
+		"time":           "2019-10-10T13:55:36-07:00",
+		"method":         "POST",
+		"path":           "/1.0/sign",
+		"protocol":       "HTTP/1.1",
+		"status":         201,
+		"size":           int64(2326),
+		"referer":        "",
+		"user-agent":     `step/0.13 "test"`,
+	}
+	tests := []struct {
+		name     string
+		combined bool
+		data     logrus.Fields
+		want     string
+	}{
+		{"common", false, data, `10.0.0.1 - - [10/Oct/2019:13:55:36 -0700] "POST /1.0/sign HTTP/1.1" 201 2326` + "\n"},
+		{"combined", true, data, `10.0.0.1 - - [10/Oct/2019:13:55:36 -0700] "POST /1.0/sign HTTP/1.1" 201 2326 "-" "step/0.13 \"test\""` + "\n"},
+		{"empty", false, logrus.Fields{"size": 0}, `- - - [10/Oct/2019:20:55:36 +0000] "- - -" - -` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &ApacheLogFormat{Combined: tt.combined}
+			entry := &logrus.Entry{Data: tt.data, Time: time.Date(2019, 10, 10, 20, 55, 36, 0, time.UTC)}
+			b, err := f.Format(entry)
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.want, string(b))
+		})
+	}
+}
+
+func TestLoggerHandler_fields(t *testing.T) {
+	l, err := New("ca", json.RawMessage(`{"format":"json","fields":["method","path","status","error"]}`))
+	assert.FatalError(t, err)
+	assert.Equals(t, []string{"method", "path", "status", "error"}, l.GetFields())
+	var buf bytes.Buffer
+	l.Out = &buf
+
+	h := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/1.0/foo", nil))
+
+	var m map[string]interface{}
+	assert.FatalError(t, json.Unmarshal(buf.Bytes(), &m))
+	delete(m, "level")
+	delete(m, "msg")
+	delete(m, "time")
+	assert.Equals(t, map[string]interface{}{"method": "GET", "path": "/1.0/foo", "status": float64(404)}, m)
+
+	// The fields are ignored in the fixed formats
+	l, err = New("ca", json.RawMessage(`{"format":"apache-combined","fields":["method"]}`))
+	assert.FatalError(t, err)
+	assert.Len(t, 0, l.GetFields())
+}
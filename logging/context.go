@@ -2,6 +2,7 @@ package logging
 
 import (
 	"context"
+	"net"
 	"net/http"
 
 	"github.com/rs/xid"
@@ -14,6 +15,9 @@ const (
 	RequestIDKey key = iota
 	// UserIDKey is the context key that should store the user identifier.
 	UserIDKey
+	// RemoteAddressKey is the context key that should store the address of
+	// the client.
+	RemoteAddressKey
 )
 
 // NewRequestID creates a new request id using github.com/rs/xid.
@@ -64,3 +68,28 @@ func GetUserID(ctx context.Context) (string, bool) {
 	v, ok := ctx.Value(UserIDKey).(string)
 	return v, ok
 }
+
+// RemoteAddress is a middleware that sets the IP address of the client of the
+// request in the context.
+func RemoteAddress(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		addr, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			addr = req.RemoteAddr
+		}
+		next.ServeHTTP(w, req.WithContext(WithRemoteAddress(req.Context(), addr)))
+	})
+}
+
+// WithRemoteAddress returns a new context with the given address of the
+// client added to the context.
+func WithRemoteAddress(ctx context.Context, addr string) context.Context {
+	return context.WithValue(ctx, RemoteAddressKey, addr)
+}
+
+// GetRemoteAddress returns the address of the client from the context if it
+// exists.
+func GetRemoteAddress(ctx context.Context) (string, bool) {
+	v, ok := ctx.Value(RemoteAddressKey).(string)
+	return v, ok
+}
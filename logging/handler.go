@@ -12,15 +12,24 @@ import (
 type LoggerHandler struct {
 	name   string
 	logger *logrus.Logger
+	fields map[string]bool
 	next   http.Handler
 }
 
 // NewLoggerHandler returns the given http.Handler with the logger integrated.
 func NewLoggerHandler(name string, logger *Logger, next http.Handler) http.Handler {
+	var fields map[string]bool
+	if names := logger.GetFields(); len(names) > 0 {
+		fields = make(map[string]bool, len(names))
+		for _, name := range names {
+			fields[name] = true
+		}
+	}
 	h := RequestID(logger.GetTraceHeader())
 	return h(&LoggerHandler{
 		name:   name,
 		logger: logger.GetImpl(),
+		fields: fields,
 		next:   next,
 	})
 }
@@ -89,6 +98,15 @@ func (l *LoggerHandler) writeEntry(w ResponseLogger, r *http.Request, t time.Tim
 		fields[k] = v
 	}
 
+	// Write only the configured fields
+	if l.fields != nil {
+		for k := range fields {
+			if !l.fields[k] {
+				delete(fields, k)
+			}
+		}
+	}
+
 	switch {
 	case status < http.StatusBadRequest:
 		l.logger.WithFields(fields).Info()
@@ -2,6 +2,7 @@ package logging
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
 	"strings"
 
@@ -20,12 +21,21 @@ type Logger struct {
 	*logrus.Logger
 	name        string
 	traceHeader string
+	fields      []string
+	closer      io.Closer
 }
 
 // loggerConfig represents the configuration options for the logger.
 type loggerConfig struct {
-	Format      string `json:"format"`
-	TraceHeader string `json:"traceHeader"`
+	Format      string            `json:"format"`
+	TraceHeader string            `json:"traceHeader"`
+	Fields      []string          `json:"fields"`
+	Output      string            `json:"output"`
+	Network     string            `json:"network"`
+	Address     string            `json:"address"`
+	Facility    string            `json:"facility"`
+	Tag         string            `json:"tag"`
+	Priorities  map[string]string `json:"priorities"`
 }
 
 // New initializes the logger with the given options.
@@ -36,12 +46,19 @@ func New(name string, raw json.RawMessage) (*Logger, error) {
 	}
 
 	var formatter logrus.Formatter
+	var fields []string
 	switch strings.ToLower(config.Format) {
 	case "", "text":
+		fields = config.Fields
 	case "json":
 		formatter = new(logrus.JSONFormatter)
+		fields = config.Fields
 	case "common":
 		formatter = new(CommonLogFormat)
+	case "apache-common":
+		formatter = new(ApacheLogFormat)
+	case "apache-combined":
+		formatter = &ApacheLogFormat{Combined: true}
 	default:
 		return nil, errors.Errorf("unsupported logger.format '%s'", config.Format)
 	}
@@ -50,13 +67,29 @@ func New(name string, raw json.RawMessage) (*Logger, error) {
 		Logger:      logrus.New(),
 		name:        name,
 		traceHeader: config.TraceHeader,
+		fields:      fields,
 	}
 	if formatter != nil {
 		logger.Formatter = formatter
 	}
+	// Redact tokens and keys before the entries reach any output.
+	logger.Formatter = &RedactFormatter{Formatter: logger.Formatter}
+	closer, err := configureOutput(logger.Logger, &config)
+	if err != nil {
+		return nil, err
+	}
+	logger.closer = closer
 	return logger, nil
 }
 
+// Close closes the syslog or journald output of the logger.
+func (l *Logger) Close() error {
+	if l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
 // GetImpl returns the real implementation of the logger.
 func (l *Logger) GetImpl() *logrus.Logger {
 	return l.Logger
@@ -70,6 +103,12 @@ func (l *Logger) GetTraceHeader() string {
 	return l.traceHeader
 }
 
+// GetFields returns the fields written in the access log, all the fields if
+// it returns an empty list.
+func (l *Logger) GetFields() []string {
+	return l.fields
+}
+
 // Middleware returns the logger middleware that will trace the request of the
 // given handler.
 func (l *Logger) Middleware(next http.Handler) http.Handler {
@@ -0,0 +1,295 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Supported outputs of the logger.
+const (
+	OutputStdout   = "stdout"
+	OutputStderr   = "stderr"
+	OutputSyslog   = "syslog"
+	OutputJournald = "journald"
+)
+
+// DefaultJournaldSocket is the path of the socket of the native protocol of
+// systemd-journald.
+const DefaultJournaldSocket = "/run/systemd/journal/socket"
+
+var syslogSeverities = map[string]int{
+	"emerg": SeverityEmergency, "emergency": SeverityEmergency,
+	"alert": SeverityAlert,
+	"crit":  SeverityCritical, "critical": SeverityCritical,
+	"err": SeverityError, "error": SeverityError,
+	"warning": SeverityWarning, "warn": SeverityWarning,
+	"notice": SeverityNotice,
+	"info":   SeverityInfo,
+	"debug":  SeverityDebug,
+}
+
+// ParseSyslogSeverity returns the code of the syslog severity with the given
+// name, e.g. err or notice.
+func ParseSyslogSeverity(name string) (int, error) {
+	s, ok := syslogSeverities[strings.ToLower(name)]
+	if !ok {
+		return 0, errors.Errorf("unsupported syslog severity '%s'", name)
+	}
+	return s, nil
+}
+
+// defaultPriorities maps the log levels to syslog severities.
+var defaultPriorities = map[logrus.Level]int{
+	logrus.PanicLevel: SeverityEmergency,
+	logrus.FatalLevel: SeverityCritical,
+	logrus.ErrorLevel: SeverityError,
+	logrus.WarnLevel:  SeverityWarning,
+	logrus.InfoLevel:  SeverityInfo,
+	logrus.DebugLevel: SeverityDebug,
+	logrus.TraceLevel: SeverityDebug,
+}
+
+// parsePriorities returns the default mapping of log levels to syslog
+// severities overridden by the given one, e.g. {"info": "notice"}.
+func parsePriorities(m map[string]string) (map[logrus.Level]int, error) {
+	priorities := make(map[logrus.Level]int, len(defaultPriorities))
+	for l, s := range defaultPriorities {
+		priorities[l] = s
+	}
+	for level, severity := range m {
+		l, err := logrus.ParseLevel(level)
+		if err != nil {
+			return nil, errors.Errorf("unsupported logger.priorities level '%s'", level)
+		}
+		s, err := ParseSyslogSeverity(severity)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error parsing logger.priorities.%s", level)
+		}
+		priorities[l] = s
+	}
+	return priorities, nil
+}
+
+// configureOutput sets the output of the logger. For syslog and journald the
+// entries are written by a hook and the standard output is discarded. It
+// returns the closer of the output, nil for stdout and stderr.
+func configureOutput(logger *logrus.Logger, config *loggerConfig) (io.Closer, error) {
+	switch strings.ToLower(config.Output) {
+	case "", OutputStdout:
+		logger.Out = os.Stdout
+		return nil, nil
+	case OutputStderr:
+		logger.Out = os.Stderr
+		return nil, nil
+	}
+
+	facility, err := ParseSyslogFacility(config.Facility)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing logger.facility")
+	}
+	priorities, err := parsePriorities(config.Priorities)
+	if err != nil {
+		return nil, err
+	}
+
+	var hook interface {
+		logrus.Hook
+		io.Closer
+	}
+	switch strings.ToLower(config.Output) {
+	case OutputSyslog:
+		if config.Network != "" && config.Address == "" {
+			return nil, errors.New("logger.address cannot be empty")
+		}
+		w, err := NewSyslogWriter(strings.ToLower(config.Network), config.Address, facility, config.Tag)
+		if err != nil {
+			return nil, err
+		}
+		hook = &syslogHook{writer: w, priorities: priorities}
+	case OutputJournald:
+		w, err := NewJournaldWriter(config.Address, facility, config.Tag)
+		if err != nil {
+			return nil, err
+		}
+		hook = &journaldHook{writer: w, priorities: priorities}
+	default:
+		return nil, errors.Errorf("unsupported logger.output '%s'", config.Output)
+	}
+	logger.Out = ioutil.Discard
+	logger.AddHook(hook)
+	return hook, nil
+}
+
+// syslogHook sends the formatted entries to syslog.
+type syslogHook struct {
+	writer     *SyslogWriter
+	priorities map[logrus.Level]int
+}
+
+func (h *syslogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *syslogHook) Fire(entry *logrus.Entry) error {
+	line, err := entry.String()
+	if err != nil {
+		return err
+	}
+	return h.writer.WriteSeverity(h.priorities[entry.Level], line)
+}
+
+func (h *syslogHook) Close() error {
+	return h.writer.Close()
+}
+
+// journaldHook sends the formatted entries to journald with the fields of the
+// entry as journal fields.
+type journaldHook struct {
+	writer     *JournaldWriter
+	priorities map[logrus.Level]int
+}
+
+func (h *journaldHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *journaldHook) Fire(entry *logrus.Entry) error {
+	line, err := entry.String()
+	if err != nil {
+		return err
+	}
+	fields := make(map[string]string, len(entry.Data))
+	for k, v := range entry.Data {
+		fields[k] = fmt.Sprint(v)
+	}
+	return h.writer.WriteFields(h.priorities[entry.Level], line, fields)
+}
+
+func (h *journaldHook) Close() error {
+	return h.writer.Close()
+}
+
+// JournaldWriter writes messages to systemd-journald using its native
+// protocol. Messages that do not fit in a datagram are not supported.
+type JournaldWriter struct {
+	mutex    sync.Mutex
+	facility int
+	tag      string
+	conn     net.Conn
+}
+
+// NewJournaldWriter creates a JournaldWriter connected to the journald socket
+// at the given path, or the default one if the path is empty. The tag is the
+// SYSLOG_IDENTIFIER of the messages.
+func NewJournaldWriter(path string, facility int, tag string) (*JournaldWriter, error) {
+	if path == "" {
+		path = DefaultJournaldSocket
+	}
+	if tag == "" {
+		tag = "step-ca"
+	}
+	conn, err := net.Dial("unixgram", path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error connecting to journald %s", path)
+	}
+	return &JournaldWriter{facility: facility, tag: tag, conn: conn}, nil
+}
+
+// format returns the datagram of a message with the given priority, text and
+// extra fields. The names of the extra fields are converted to valid journal
+// field names.
+func (w *JournaldWriter) format(priority int, msg string, fields map[string]string) []byte {
+	var buf bytes.Buffer
+	writeJournaldField(&buf, "MESSAGE", strings.TrimSuffix(msg, "\n"))
+	writeJournaldField(&buf, "PRIORITY", fmt.Sprint(priority))
+	writeJournaldField(&buf, "SYSLOG_FACILITY", fmt.Sprint(w.facility))
+	writeJournaldField(&buf, "SYSLOG_IDENTIFIER", w.tag)
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if name := journaldFieldName(k); name != "" {
+			writeJournaldField(&buf, name, fields[k])
+		}
+	}
+	return buf.Bytes()
+}
+
+// WriteFields sends a message with the given priority and extra fields.
+func (w *JournaldWriter) WriteFields(priority int, msg string, fields map[string]string) error {
+	b := w.format(priority, msg, fields)
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.conn == nil {
+		return errors.New("error writing to journald: writer is closed")
+	}
+	_, err := w.conn.Write(b)
+	return errors.Wrap(err, "error writing to journald")
+}
+
+// Write implements io.Writer, it sends the given message with the info
+// priority.
+func (w *JournaldWriter) Write(p []byte) (int, error) {
+	if err := w.WriteFields(SeverityInfo, string(p), nil); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the connection to journald.
+func (w *JournaldWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+// writeJournaldField writes a field in the native journal format. Values with
+// new lines are written with their length as a little endian uint64.
+func writeJournaldField(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		buf.WriteByte('=')
+		buf.WriteString(value)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(value)))
+	buf.WriteString(value)
+	buf.WriteByte('\n')
+}
+
+// journaldFieldName returns the given name in upper case with the characters
+// not allowed in journal field names replaced by underscores. Field names
+// cannot start with an underscore or a digit.
+func journaldFieldName(name string) string {
+	b := []byte(strings.ToUpper(name))
+	for i, c := range b {
+		if !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') {
+			b[i] = '_'
+		}
+	}
+	s := strings.TrimLeft(string(b), "_0123456789")
+	if len(s) > 64 {
+		s = s[:64]
+	}
+	return s
+}
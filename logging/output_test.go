@@ -0,0 +1,125 @@
+package logging
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/smallstep/assert"
+)
+
+func TestNew_output(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr bool
+	}{
+		{"ok-default", `{}`, false},
+		{"ok-stdout", `{"output":"stdout"}`, false},
+		{"ok-stderr", `{"format":"json","output":"STDERR"}`, false},
+		{"ok-syslog", `{"output":"syslog","network":"udp","address":"127.0.0.1:514","facility":"local0","priorities":{"info":"notice"}}`, false},
+		{"fail-output", `{"output":"foo"}`, true},
+		{"fail-address", `{"output":"syslog","network":"tcp"}`, true},
+		{"fail-facility", `{"output":"syslog","network":"udp","address":"127.0.0.1:514","facility":"foo"}`, true},
+		{"fail-level", `{"output":"syslog","network":"udp","address":"127.0.0.1:514","priorities":{"foo":"notice"}}`, true},
+		{"fail-severity", `{"output":"syslog","network":"udp","address":"127.0.0.1:514","priorities":{"info":"foo"}}`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := New("ca", json.RawMessage(tt.raw))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil {
+				assert.NoError(t, l.Close())
+			}
+		})
+	}
+}
+
+func TestNew_syslog(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.FatalError(t, err)
+	defer conn.Close()
+
+	raw := `{"format":"json","output":"syslog","network":"udp","address":"` + conn.LocalAddr().String() +
+		`","facility":"local0","tag":"ca","priorities":{"info":"notice"}}`
+	l, err := New("ca", json.RawMessage(raw))
+	assert.FatalError(t, err)
+	defer l.Close()
+
+	buf := make([]byte, 1024)
+	for _, tc := range []struct {
+		log  func(args ...interface{})
+		want string
+	}{
+		{l.Info, `^<133>1 \S+ \S+ ca \d+ - - \{.*"msg":"hello".*\}$`},
+		{l.Error, `^<131>1 \S+ \S+ ca \d+ - - \{.*"msg":"hello".*\}$`},
+	} {
+		tc.log("hello")
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		assert.FatalError(t, err)
+		assert.True(t, regexp.MustCompile(tc.want).Match(buf[:n]), string(buf[:n]))
+	}
+}
+
+func TestNew_journald(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journald")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "socket")
+	conn, err := net.ListenPacket("unixgram", path)
+	assert.FatalError(t, err)
+	defer conn.Close()
+
+	raw := `{"output":"journald","address":"` + path + `"}`
+	l, err := New("ca", json.RawMessage(raw))
+	assert.FatalError(t, err)
+	defer l.Close()
+
+	l.WithField("request-id", "abc").Warn("hello")
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	assert.FatalError(t, err)
+	s := string(buf[:n])
+	assert.True(t, strings.HasPrefix(s, "MESSAGE="), s)
+	assert.True(t, strings.Contains(s, "\nPRIORITY=4\nSYSLOG_FACILITY=3\nSYSLOG_IDENTIFIER=step-ca\nREQUEST_ID=abc\n"), s)
+}
+
+func TestJournaldWriter_format(t *testing.T) {
+	w := &JournaldWriter{facility: 16, tag: "step-ca"}
+	b := w.format(SeverityNotice, "foo\nbar\n", map[string]string{"_private": "x", "0": "y", "a.b": "z"})
+
+	var want []byte
+	want = append(want, "MESSAGE\n"...)
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], 7)
+	want = append(want, size[:]...)
+	want = append(want, "foo\nbar\n"...)
+	want = append(want, "PRIORITY=5\nSYSLOG_FACILITY=16\nSYSLOG_IDENTIFIER=step-ca\nPRIVATE=x\nA_B=z\n"...)
+	assert.Equals(t, string(want), string(b))
+}
+
+func TestParsePriorities(t *testing.T) {
+	p, err := parsePriorities(nil)
+	assert.FatalError(t, err)
+	assert.Equals(t, defaultPriorities, p)
+
+	p, err = parsePriorities(map[string]string{"info": "notice", "warn": "err"})
+	assert.FatalError(t, err)
+	assert.Equals(t, SeverityNotice, p[logrus.InfoLevel])
+	assert.Equals(t, SeverityError, p[logrus.WarnLevel])
+	assert.Equals(t, SeverityDebug, p[logrus.DebugLevel])
+	assert.Equals(t, SeverityInfo, defaultPriorities[logrus.InfoLevel])
+}
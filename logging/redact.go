@@ -0,0 +1,115 @@
+package logging
+
+import (
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Redacted is the text that replaces the sensitive values in the logs.
+const Redacted = "[REDACTED]"
+
+var (
+	// PEM blocks of private keys, including truncated ones.
+	privateKeyRegexp = regexp.MustCompile(`-----BEGIN ([A-Z0-9 ]*)PRIVATE KEY-----[\s\S]*?(?:-----END [A-Z0-9 ]*PRIVATE KEY-----|$)`)
+	// Compact JWS and JWE, the one-time tokens and other JWTs.
+	jwtRegexp = regexp.MustCompile(`eyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]*\.[A-Za-z0-9_-]*(?:\.[A-Za-z0-9_-]*\.[A-Za-z0-9_-]*)?`)
+	// Authorization headers, with or without the scheme.
+	authorizationRegexp = regexp.MustCompile(`(?i)\b((?:proxy-)?authorization["']?\s*[:=]\s*["']?)(?:(bearer|basic|token)\s+)?[^\s"',;&]+`)
+	// Credentials after the authentication scheme.
+	credentialsRegexp = regexp.MustCompile(`(?i)\b(bearer|basic)\s+[A-Za-z0-9._~+/=-]{8,}`)
+	// Credentials in query strings and forms.
+	parameterRegexp = regexp.MustCompile(`(?i)\b(ott|token|access_token|id_token|password|secret|client_secret)=[^&\s"']+`)
+)
+
+// sensitiveFields are the names of the log fields whose values are always
+// redacted, without dashes and underscores.
+var sensitiveFields = map[string]bool{
+	"authorization": true,
+	"ott":           true,
+	"token":         true,
+	"password":      true,
+	"secret":        true,
+	"privatekey":    true,
+}
+
+// Redact returns the given text with the one-time tokens, authorization
+// credentials and private keys replaced.
+func Redact(s string) string {
+	if s == "" {
+		return s
+	}
+	s = privateKeyRegexp.ReplaceAllString(s, "-----BEGIN ${1}PRIVATE KEY-----"+Redacted+"-----END ${1}PRIVATE KEY-----")
+	s = jwtRegexp.ReplaceAllString(s, Redacted)
+	s = authorizationRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		sm := authorizationRegexp.FindStringSubmatch(m)
+		if sm[2] != "" {
+			return sm[1] + sm[2] + " " + Redacted
+		}
+		return sm[1] + Redacted
+	})
+	s = credentialsRegexp.ReplaceAllString(s, "$1 "+Redacted)
+	return parameterRegexp.ReplaceAllString(s, "${1}="+Redacted)
+}
+
+func isSensitiveField(name string) bool {
+	name = strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(name))
+	return sensitiveFields[name]
+}
+
+// redactFields returns a copy of the given fields with the sensitive values
+// redacted. Errors are converted to strings.
+func redactFields(data logrus.Fields) logrus.Fields {
+	fields := make(logrus.Fields, len(data))
+	for k, v := range data {
+		if isSensitiveField(k) {
+			fields[k] = Redacted
+			continue
+		}
+		switch v := v.(type) {
+		case string:
+			fields[k] = Redact(v)
+		case error:
+			fields[k] = Redact(v.Error())
+		default:
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+// RedactFormatter is a logrus.Formatter that redacts the tokens, credentials
+// and private keys of the entries before formatting them with the wrapped
+// formatter.
+type RedactFormatter struct {
+	Formatter logrus.Formatter
+}
+
+// Format implements logrus.Formatter.
+func (f *RedactFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	e := *entry
+	e.Message = Redact(entry.Message)
+	e.Data = redactFields(entry.Data)
+	return f.Formatter.Format(&e)
+}
+
+// redactWriter is an io.Writer that redacts each write.
+type redactWriter struct {
+	w io.Writer
+}
+
+// NewRedactWriter returns an io.Writer that redacts the tokens, credentials
+// and private keys of the text written to w. It is intended to be used as the
+// output of the log package, where each write is a log line.
+func NewRedactWriter(w io.Writer) io.Writer {
+	return &redactWriter{w: w}
+}
+
+func (r *redactWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
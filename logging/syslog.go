@@ -0,0 +1,170 @@
+package logging
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Syslog severities.
+const (
+	SeverityEmergency = iota
+	SeverityAlert
+	SeverityCritical
+	SeverityError
+	SeverityWarning
+	SeverityNotice
+	SeverityInfo
+	SeverityDebug
+)
+
+// DefaultSyslogFacility is the facility used if none is configured.
+const DefaultSyslogFacility = "daemon"
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+	"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// ParseSyslogFacility returns the code of the syslog facility with the given
+// name, e.g. daemon or local0.
+func ParseSyslogFacility(name string) (int, error) {
+	if name == "" {
+		name = DefaultSyslogFacility
+	}
+	f, ok := syslogFacilities[strings.ToLower(name)]
+	if !ok {
+		return 0, errors.Errorf("unsupported syslog facility '%s'", name)
+	}
+	return f, nil
+}
+
+// syslogSockets are the paths of the local syslog socket in the different
+// operating systems.
+var syslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// SyslogWriter writes RFC 5424 messages to a syslog server. The network is
+// udp, tcp, unix or unixgram; if it is empty the messages are sent to the
+// local syslog socket. On tcp the messages are framed with the octet counting
+// method of RFC 6587.
+type SyslogWriter struct {
+	mutex    sync.Mutex
+	network  string
+	address  string
+	facility int
+	tag      string
+	hostname string
+	conn     net.Conn
+	closed   bool
+}
+
+// NewSyslogWriter creates a SyslogWriter and connects to the server. The tag
+// is the APP-NAME of the messages.
+func NewSyslogWriter(network, address string, facility int, tag string) (*SyslogWriter, error) {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	if tag == "" {
+		tag = "step-ca"
+	}
+	w := &SyslogWriter{
+		network:  network,
+		address:  address,
+		facility: facility,
+		tag:      tag,
+		hostname: hostname,
+	}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *SyslogWriter) connect() error {
+	if w.network != "" {
+		conn, err := net.Dial(w.network, w.address)
+		if err != nil {
+			return errors.Wrapf(err, "error connecting to syslog %s://%s", w.network, w.address)
+		}
+		w.conn = conn
+		return nil
+	}
+	for _, network := range []string{"unixgram", "unix"} {
+		for _, path := range syslogSockets {
+			if conn, err := net.Dial(network, path); err == nil {
+				w.conn = conn
+				return nil
+			}
+		}
+	}
+	return errors.New("error connecting to syslog: local syslog socket not found")
+}
+
+// format returns the RFC 5424 message with the given severity and text.
+func (w *SyslogWriter) format(severity int, msg string) string {
+	msg = strings.TrimSuffix(msg, "\n")
+	s := fmt.Sprintf("<%d>1 %s %s %s %d - - %s", w.facility*8+severity,
+		time.Now().UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		w.hostname, w.tag, os.Getpid(), msg)
+	switch w.network {
+	case "tcp", "tcp4", "tcp6":
+		return fmt.Sprintf("%d %s", len(s), s)
+	case "unix":
+		return s + "\n"
+	default:
+		return s
+	}
+}
+
+// WriteSeverity sends a message with the given severity. If the connection is
+// broken it reconnects and tries again once.
+func (w *SyslogWriter) WriteSeverity(severity int, msg string) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closed {
+		return errors.New("error writing to syslog: writer is closed")
+	}
+	s := w.format(severity, msg)
+	if w.conn != nil {
+		if _, err := w.conn.Write([]byte(s)); err == nil {
+			return nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+	if err := w.connect(); err != nil {
+		return err
+	}
+	_, err := w.conn.Write([]byte(s))
+	return errors.Wrap(err, "error writing to syslog")
+}
+
+// Write implements io.Writer, it sends the given message with the info
+// severity.
+func (w *SyslogWriter) Write(p []byte) (int, error) {
+	if err := w.WriteSeverity(SeverityInfo, string(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the connection to the syslog server.
+func (w *SyslogWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.closed = true
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
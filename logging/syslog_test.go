@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"net"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func TestParseSyslogFacility(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    int
+		wantErr bool
+	}{
+		{"", 3, false},
+		{"daemon", 3, false},
+		{"AUTH", 4, false},
+		{"local7", 23, false},
+		{"foo", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSyslogFacility(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseSyslogFacility() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			assert.Equals(t, tt.want, got)
+		})
+	}
+}
+
+func TestSyslogWriter_format(t *testing.T) {
+	w := &SyslogWriter{network: "udp", facility: 16, tag: "step-ca", hostname: "ca"}
+	re := regexp.MustCompile(`^<134>1 \S+Z ca step-ca \d+ - - hello world$`)
+	assert.True(t, re.MatchString(w.format(SeverityInfo, "hello world\n")))
+
+	w.network = "tcp"
+	s := w.format(SeverityNotice, "hello")
+	re = regexp.MustCompile(`^(\d+) (<133>1 .* - - hello)$`)
+	m := re.FindStringSubmatch(s)
+	if assert.Len(t, 3, m) {
+		assert.Equals(t, m[1], strconv.Itoa(len(m[2])))
+	}
+
+	w.network = "unix"
+	re = regexp.MustCompile(`^<133>1 .* - - hello\n$`)
+	assert.True(t, re.MatchString(w.format(SeverityNotice, "hello")))
+}
+
+func TestSyslogWriter_udp(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.FatalError(t, err)
+	defer conn.Close()
+
+	w, err := NewSyslogWriter("udp", conn.LocalAddr().String(), 4, "")
+	assert.FatalError(t, err)
+	defer w.Close()
+
+	n, err := w.Write([]byte("hello world\n"))
+	assert.FatalError(t, err)
+	assert.Equals(t, 12, n)
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err = conn.ReadFrom(buf)
+	assert.FatalError(t, err)
+	re := regexp.MustCompile(`^<38>1 \S+ \S+ step-ca \d+ - - hello world$`)
+	assert.True(t, re.MatchString(string(buf[:n])))
+}
@@ -0,0 +1,56 @@
+package metrics
+
+// Default is the registry of the metrics of the CA.
+var Default = NewRegistry()
+
+// Metrics of the CA.
+var (
+	// X509Certificates counts the X.509 certificates issued, renewed and
+	// revoked by provisioner.
+	X509Certificates = Default.NewCounterVec("step_ca_x509_certificates_total",
+		"Number of X.509 certificates issued, renewed and revoked.", "provisioner", "event")
+	// SSHCertificates counts the SSH certificates signed by type, user or
+	// host.
+	SSHCertificates = Default.NewCounterVec("step_ca_ssh_certificates_total",
+		"Number of SSH certificates signed.", "type")
+	// Authorizations counts the tokens of every provisioner accepted and
+	// rejected by method.
+	Authorizations = Default.NewCounterVec("step_ca_provisioner_authorizations_total",
+		"Number of provisioner tokens authorized.", "provisioner", "method", "result")
+	// HTTPRequestDuration is the latency of the HTTP requests by method, route
+	// and status code.
+	HTTPRequestDuration = Default.NewHistogramVec("step_ca_http_request_duration_seconds",
+		"Latency of the HTTP requests.", DefaultBuckets, "method", "route", "code")
+	// HTTPRequestSize is the size of the body of the HTTP requests by method
+	// and route.
+	HTTPRequestSize = Default.NewHistogramVec("step_ca_http_request_size_bytes",
+		"Size of the body of the HTTP requests.", SizeBuckets, "method", "route")
+	// HTTPResponseSize is the size of the body of the HTTP responses by method
+	// and route.
+	HTTPResponseSize = Default.NewHistogramVec("step_ca_http_response_size_bytes",
+		"Size of the body of the HTTP responses.", SizeBuckets, "method", "route")
+	// HTTPResponses counts the HTTP responses by method, route and status
+	// class, e.g. 2xx or 5xx.
+	HTTPResponses = Default.NewCounterVec("step_ca_http_responses_total",
+		"Number of HTTP responses by status class.", "method", "route", "class")
+	// ExpiryNotifications counts the expiry notifications sent by channel and
+	// result.
+	ExpiryNotifications = Default.NewCounterVec("step_ca_expiry_notifications_total",
+		"Number of certificate expiry notifications sent.", "channel", "result")
+	// FederationSyncs counts the synchronizations of the federated roots by
+	// peer and result.
+	FederationSyncs = Default.NewCounterVec("step_ca_federation_syncs_total",
+		"Number of synchronizations of the federated roots.", "peer", "result")
+	// ServerCertificateRenewals counts the renewals of the certificate of the
+	// CA listeners by result.
+	ServerCertificateRenewals = Default.NewCounterVec("step_ca_server_certificate_renewals_total",
+		"Number of renewals of the certificate of the CA server.", "result")
+	// DBOperationDuration is the latency of the database operations by
+	// operation and table.
+	DBOperationDuration = Default.NewHistogramVec("step_ca_db_operation_duration_seconds",
+		"Latency of the database operations.", DefaultBuckets, "operation", "table")
+	// DBOperationErrors counts the database operations failed by operation and
+	// table. Reads of missing keys are not errors.
+	DBOperationErrors = Default.NewCounterVec("step_ca_db_operation_errors_total",
+		"Number of failed database operations.", "operation", "table")
+)
@@ -0,0 +1,311 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ContentType is the content type of the Prometheus text exposition format.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets are the upper bounds, in seconds, of the buckets of the
+// latency histograms.
+var DefaultBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// SizeBuckets are the upper bounds, in bytes, of the buckets of the size
+// histograms, from 64 bytes to 1MiB.
+var SizeBuckets = ExponentialBuckets(64, 4, 8)
+
+// ExponentialBuckets returns count bucket upper bounds, the first one is
+// start and each one is factor times the previous one.
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// Registry is a set of metrics exported in the Prometheus text exposition
+// format.
+type Registry struct {
+	mutex      sync.Mutex
+	collectors []collector
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return new(Registry)
+}
+
+func (r *Registry) register(c collector) {
+	r.mutex.Lock()
+	r.collectors = append(r.collectors, c)
+	r.mutex.Unlock()
+}
+
+// NewCounterVec creates and registers a counter with the given name, help and
+// label names.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec: newVec(name, help, labels)}
+	r.register(c)
+	return c
+}
+
+// NewHistogramVec creates and registers a histogram with the given name, help,
+// bucket upper bounds and label names.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{vec: newVec(name, help, labels), buckets: buckets}
+	r.register(h)
+	return h
+}
+
+// Write writes all the metrics of the registry to w in the Prometheus text
+// exposition format.
+func (r *Registry) Write(w io.Writer) error {
+	r.mutex.Lock()
+	collectors := append([]collector{}, r.collectors...)
+	r.mutex.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP implements http.Handler, it writes the metrics of the registry.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	r.Write(w)
+}
+
+// vec is the common part of the metrics with labels.
+type vec struct {
+	name   string
+	help   string
+	labels []string
+	mutex  sync.Mutex
+}
+
+func newVec(name, help string, labels []string) vec {
+	return vec{name: name, help: help, labels: labels}
+}
+
+// key returns the key of the series with the given label values.
+func (v *vec) key(labelValues []string) string {
+	if len(labelValues) != len(v.labels) {
+		panic("metrics: " + v.name + " expects " + strconv.Itoa(len(v.labels)) +
+			" label values, got " + strconv.Itoa(len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+func (v *vec) writeHeader(w *bufio.Writer, typ string) {
+	w.WriteString("# HELP " + v.name + " " + escapeHelp(v.help) + "\n")
+	w.WriteString("# TYPE " + v.name + " " + typ + "\n")
+}
+
+// labelPairs returns the label pairs of a series, with the given extra pair
+// if the name is not empty.
+func (v *vec) labelPairs(labelValues []string, name, value string) string {
+	pairs := make([]string, 0, len(labelValues)+1)
+	for i, l := range v.labels {
+		pairs = append(pairs, l+`="`+escapeLabelValue(labelValues[i])+`"`)
+	}
+	if name != "" {
+		pairs = append(pairs, name+`="`+value+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// CounterVec is a counter partitioned by labels.
+type CounterVec struct {
+	vec
+	series map[string]*counter
+}
+
+type counter struct {
+	labelValues []string
+	value       float64
+}
+
+// Inc increments by one the counter with the given label values.
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds the given value to the counter with the given label values.
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	key := c.key(labelValues)
+	c.mutex.Lock()
+	if c.series == nil {
+		c.series = make(map[string]*counter)
+	}
+	s, ok := c.series[key]
+	if !ok {
+		s = &counter{labelValues: append([]string{}, labelValues...)}
+		c.series[key] = s
+	}
+	s.value += v
+	c.mutex.Unlock()
+}
+
+// Value returns the value of the counter with the given label values.
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	key := c.key(labelValues)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if s, ok := c.series[key]; ok {
+		return s.value
+	}
+	return 0
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.writeHeader(w, "counter")
+	keys := make([]string, 0, len(c.series))
+	for k := range c.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := c.series[k]
+		w.WriteString(c.name + c.labelPairs(s.labelValues, "", "") + " " + formatFloat(s.value) + "\n")
+	}
+}
+
+// HistogramVec is a histogram partitioned by labels.
+type HistogramVec struct {
+	vec
+	buckets []float64
+	series  map[string]*histogram
+}
+
+type histogram struct {
+	labelValues []string
+	counts      []uint64
+	count       uint64
+	sum         float64
+}
+
+// Observe adds the given value to the histogram with the given label values.
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.mutex.Lock()
+	if h.series == nil {
+		h.series = make(map[string]*histogram)
+	}
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogram{
+			labelValues: append([]string{}, labelValues...),
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = s
+	}
+	for i, b := range h.buckets {
+		if v <= b {
+			s.counts[i]++
+			break
+		}
+	}
+	s.count++
+	s.sum += v
+	h.mutex.Unlock()
+}
+
+// ObserveDuration adds the given duration, in seconds, to the histogram with
+// the given label values.
+func (h *HistogramVec) ObserveDuration(d time.Duration, labelValues ...string) {
+	h.Observe(d.Seconds(), labelValues...)
+}
+
+// Count returns the number of values observed by the histogram with the given
+// label values.
+func (h *HistogramVec) Count(labelValues ...string) uint64 {
+	key := h.key(labelValues)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if s, ok := h.series[key]; ok {
+		return s.count
+	}
+	return 0
+}
+
+// Sum returns the sum of the values observed by the histogram with the given
+// label values.
+func (h *HistogramVec) Sum(labelValues ...string) float64 {
+	key := h.key(labelValues)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if s, ok := h.series[key]; ok {
+		return s.sum
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.writeHeader(w, "histogram")
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := h.series[k]
+		var cumulative uint64
+		for i, b := range h.buckets {
+			cumulative += s.counts[i]
+			w.WriteString(h.name + "_bucket" + h.labelPairs(s.labelValues, "le", formatFloat(b)) +
+				" " + strconv.FormatUint(cumulative, 10) + "\n")
+		}
+		w.WriteString(h.name + "_bucket" + h.labelPairs(s.labelValues, "le", "+Inf") +
+			" " + strconv.FormatUint(s.count, 10) + "\n")
+		w.WriteString(h.name + "_sum" + h.labelPairs(s.labelValues, "", "") + " " + formatFloat(s.sum) + "\n")
+		w.WriteString(h.name + "_count" + h.labelPairs(s.labelValues, "", "") + " " + strconv.FormatUint(s.count, 10) + "\n")
+	}
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+var (
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelReplacer.Replace(s)
+}
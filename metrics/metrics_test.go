@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("test_total", "Test counter.\nSecond line.", "name")
+	h := r.NewHistogramVec("test_seconds", "Test histogram.", []float64{.1, 1}, "name")
+	e := r.NewCounterVec("test_empty_total", "Empty counter.")
+
+	c.Inc(`b"\`)
+	c.Add(2, "a")
+	c.Inc("a")
+	h.Observe(.05, "a")
+	h.ObserveDuration(500*time.Millisecond, "a")
+	h.Observe(3, "a")
+	e.Inc()
+
+	assert.Equals(t, float64(3), c.Value("a"))
+	assert.Equals(t, float64(0), c.Value("c"))
+	assert.Equals(t, uint64(3), h.Count("a"))
+
+	var buf bytes.Buffer
+	assert.FatalError(t, r.Write(&buf))
+	assert.Equals(t, `# HELP test_total Test counter.\nSecond line.
+# TYPE test_total counter
+test_total{name="a"} 3
+test_total{name="b\"\\"} 1
+# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{name="a",le="0.1"} 1
+test_seconds_bucket{name="a",le="1"} 2
+test_seconds_bucket{name="a",le="+Inf"} 3
+test_seconds_sum{name="a"} 3.55
+test_seconds_count{name="a"} 3
+# HELP test_empty_total Empty counter.
+# TYPE test_empty_total counter
+test_empty_total 1
+`, buf.String())
+}
+
+func TestCounterVec_labels(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("test_total", "Test counter.", "a", "b")
+	defer func() {
+		assert.Equals(t, "metrics: test_total expects 2 label values, got 1", recover())
+	}()
+	c.Inc("a")
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("test_total", "Test counter.").Inc()
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equals(t, http.StatusOK, w.Code)
+	assert.Equals(t, ContentType, w.Header().Get("Content-Type"))
+	assert.Equals(t, "# HELP test_total Test counter.\n# TYPE test_total counter\ntest_total 1\n", w.Body.String())
+}
+
+func TestExponentialBuckets(t *testing.T) {
+	assert.Equals(t, []float64{64, 256, 1024}, ExponentialBuckets(64, 4, 3))
+	assert.Equals(t, float64(1<<20), SizeBuckets[len(SizeBuckets)-1])
+}
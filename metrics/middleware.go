@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/go-chi/chi"
+)
+
+// Middleware is an HTTP middleware that records the latency of the requests
+// in HTTPRequestDuration, the size of the requests and responses in
+// HTTPRequestSize and HTTPResponseSize, and the status class of the responses
+// in HTTPResponses. The route is the pattern of the chi route that served the
+// request, so the paths with parameters are not different series; requests
+// that do not match any route use the route "other".
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		// Set the routing context, chi reuses it and we can read the pattern
+		// after the request is served.
+		rctx, ok := r.Context().Value(chi.RouteCtxKey).(*chi.Context)
+		if !ok {
+			rctx = chi.NewRouteContext()
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+		}
+		// Count the bytes read, the content length is not always known.
+		var body *countingReader
+		if r.Body != nil && r.Body != http.NoBody {
+			body = &countingReader{ReadCloser: r.Body}
+			r.Body = body
+		}
+		rw := logging.NewResponseLogger(w)
+		next.ServeHTTP(rw, r)
+
+		route := rctx.RoutePattern()
+		if route == "" {
+			route = "other"
+		}
+		var requestSize int64
+		if body != nil {
+			requestSize = body.n
+		}
+		code := rw.StatusCode()
+		HTTPRequestDuration.ObserveDuration(time.Since(start), r.Method, route, strconv.Itoa(code))
+		HTTPRequestSize.Observe(float64(requestSize), r.Method, route)
+		HTTPResponseSize.Observe(float64(rw.Size()), r.Method, route)
+		HTTPResponses.Inc(r.Method, route, statusClass(code))
+	})
+}
+
+// statusClass returns the class of the given status code, e.g. 2xx.
+func statusClass(code int) string {
+	if code < 100 || code > 599 {
+		return "other"
+	}
+	return strconv.Itoa(code/100) + "xx"
+}
+
+// countingReader is an io.ReadCloser that counts the bytes read.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/smallstep/assert"
+)
+
+func TestMiddleware(t *testing.T) {
+	mux := chi.NewRouter()
+	mux.Get("/certificates/{serial}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.Route("/1.0", func(r chi.Router) {
+		r.Get("/health", func(w http.ResponseWriter, r *http.Request) {})
+	})
+	handler := Middleware(mux)
+
+	before := HTTPRequestDuration.Count("GET", "/certificates/{serial}", "404")
+	for _, path := range []string{"/certificates/1", "/certificates/2"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	assert.Equals(t, before+2, HTTPRequestDuration.Count("GET", "/certificates/{serial}", "404"))
+
+	before = HTTPRequestDuration.Count("GET", "/1.0/health", "200")
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/1.0/health", nil))
+	assert.Equals(t, before+1, HTTPRequestDuration.Count("GET", "/1.0/health", "200"))
+
+	before = HTTPRequestDuration.Count("GET", "other", "404")
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/foo", nil))
+	assert.Equals(t, before+1, HTTPRequestDuration.Count("GET", "other", "404"))
+}
+
+func TestMiddleware_sizes(t *testing.T) {
+	mux := chi.NewRouter()
+	mux.Post("/sign", func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(append(b, b...))
+	})
+	mux.Post("/fail", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	handler := Middleware(mux)
+
+	reqSize := HTTPRequestSize.Sum("POST", "/sign")
+	respSize := HTTPResponseSize.Sum("POST", "/sign")
+	created := HTTPResponses.Value("POST", "/sign", "2xx")
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/sign", strings.NewReader("0123456789")))
+	assert.Equals(t, reqSize+10, HTTPRequestSize.Sum("POST", "/sign"))
+	assert.Equals(t, respSize+20, HTTPResponseSize.Sum("POST", "/sign"))
+	assert.Equals(t, created+1, HTTPResponses.Value("POST", "/sign", "2xx"))
+
+	failed := HTTPResponses.Value("POST", "/fail", "5xx")
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/fail", nil))
+	assert.Equals(t, failed+1, HTTPResponses.Value("POST", "/fail", "5xx"))
+}
+
+func TestStatusClass(t *testing.T) {
+	assert.Equals(t, "1xx", statusClass(101))
+	assert.Equals(t, "2xx", statusClass(200))
+	assert.Equals(t, "4xx", statusClass(429))
+	assert.Equals(t, "5xx", statusClass(503))
+	assert.Equals(t, "other", statusClass(0))
+}
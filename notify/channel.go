@@ -0,0 +1,131 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/events"
+	"github.com/pkg/errors"
+)
+
+// NotificationType is the value of the X-Step-Event header and the type
+// attribute of the webhook notifications.
+const NotificationType = "certificates.expiring"
+
+const webhookTimeout = 10 * time.Second
+
+// channel is a destination of the notifications.
+type channel interface {
+	Send(n *Notification) error
+}
+
+func newChannel(c *ChannelConfig) channel {
+	switch strings.ToLower(c.Type) {
+	case EmailChannel:
+		return &emailChannel{config: c, sendMail: smtp.SendMail}
+	case SlackChannel:
+		return &slackChannel{url: c.URL, client: &http.Client{Timeout: webhookTimeout}}
+	default:
+		return &webhookChannel{url: c.URL, secret: c.Secret, client: &http.Client{Timeout: webhookTimeout}}
+	}
+}
+
+// emailChannel sends the notifications in plain text emails.
+type emailChannel struct {
+	config   *ChannelConfig
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func (c *emailChannel) Send(n *Notification) error {
+	var auth smtp.Auth
+	if c.config.SMTP.Username != "" {
+		host, _, err := net.SplitHostPort(c.config.SMTP.Address)
+		if err != nil {
+			host = c.config.SMTP.Address
+		}
+		auth = smtp.PlainAuth("", c.config.SMTP.Username, c.config.SMTP.Password, host)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", c.config.SMTP.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(c.config.To, ", "))
+	fmt.Fprintf(&msg, "Subject: [step-ca] %s\r\n", n.Subject())
+	fmt.Fprintf(&msg, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.Replace(n.Text(), "\n", "\r\n", -1))
+
+	return errors.Wrap(c.sendMail(c.config.SMTP.Address, auth, c.config.SMTP.From, c.config.To, msg.Bytes()),
+		"error sending email")
+}
+
+// webhookChannel sends the notifications as JSON signed like the event
+// webhooks.
+type webhookChannel struct {
+	url    string
+	secret string
+	client *http.Client
+}
+
+// webhookBody is the body of the webhook notifications.
+type webhookBody struct {
+	Type string `json:"type"`
+	*Notification
+}
+
+func (c *webhookChannel) Send(n *Notification) error {
+	body, err := json.Marshal(webhookBody{Type: NotificationType, Notification: n})
+	if err != nil {
+		return errors.Wrap(err, "error marshaling notification")
+	}
+	return post(c.client, c.url, body, map[string]string{
+		events.EventTypeHeader: NotificationType,
+		events.SignatureHeader: events.Sign(c.secret, body),
+	})
+}
+
+// slackChannel sends the notifications to a Slack-compatible incoming
+// webhook.
+type slackChannel struct {
+	url    string
+	client *http.Client
+}
+
+func (c *slackChannel) Send(n *Notification) error {
+	body, err := json.Marshal(map[string]string{"text": n.Text()})
+	if err != nil {
+		return errors.Wrap(err, "error marshaling notification")
+	}
+	return post(c.client, c.url, body, nil)
+}
+
+// post sends the given JSON body with the given headers.
+func post(client *http.Client, url string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "error creating request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "error sending request")
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,468 @@
+package notify
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/db"
+	"github.com/RTradeLtd/ca-certificates/metrics"
+	"github.com/pkg/errors"
+)
+
+// DefaultInterval is the default interval between the scans of the expiring
+// certificates.
+const DefaultInterval = time.Hour
+
+// Channel types.
+const (
+	EmailChannel   = "email"
+	WebhookChannel = "webhook"
+	SlackChannel   = "slack"
+)
+
+// Config is the configuration of the expiry notifications. The certificates
+// are scanned on every interval; when the time left of a certificate is less
+// than the before attribute of a window, a notification is sent to the
+// channels of the window. The windows escalate, only the channels of the most
+// urgent window reached are notified, and every channel is notified once per
+// certificate and window.
+type Config struct {
+	Interval     string                   `json:"interval,omitempty"`
+	Windows      []*Window                `json:"windows"`
+	Channels     []*ChannelConfig         `json:"channels"`
+	Provisioners map[string]*PolicyConfig `json:"provisioners,omitempty"`
+	interval     time.Duration
+}
+
+// Window is a notification window. If the list of channels is empty all the
+// channels are notified.
+type Window struct {
+	Before   string   `json:"before"`
+	Channels []string `json:"channels,omitempty"`
+	before   time.Duration
+}
+
+// key returns the key used to remember that the given channel has been
+// notified in this window.
+func (w *Window) key(channel string) string {
+	return w.before.String() + "/" + channel
+}
+
+// PolicyConfig overrides the windows of the certificates of a provisioner.
+// Certificates of disabled provisioners are not notified.
+type PolicyConfig struct {
+	Windows  []*Window `json:"windows,omitempty"`
+	Disabled bool      `json:"disabled,omitempty"`
+}
+
+// ChannelConfig is the configuration of a destination of the notifications.
+// Email channels send the notifications to the To addresses using the SMTP
+// server. Webhook channels POST them as JSON signed with the Secret like the
+// event webhooks. Slack channels POST them to a Slack-compatible incoming
+// webhook URL.
+type ChannelConfig struct {
+	Name   string      `json:"name"`
+	Type   string      `json:"type"`
+	URL    string      `json:"url,omitempty"`
+	Secret string      `json:"secret,omitempty"`
+	SMTP   *SMTPConfig `json:"smtp,omitempty"`
+	To     []string    `json:"to,omitempty"`
+}
+
+// SMTPConfig is the configuration of the SMTP server used to send emails. The
+// connection is upgraded with STARTTLS if the server supports it, and the
+// credentials are only sent over TLS or to localhost.
+type SMTPConfig struct {
+	Address  string `json:"address"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	From     string `json:"from"`
+}
+
+// Validate validates the notifications configuration.
+func (c *Config) Validate() error {
+	if c == nil {
+		return nil
+	}
+	c.interval = DefaultInterval
+	if c.Interval != "" {
+		d, err := time.ParseDuration(c.Interval)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing notifications.interval %s", c.Interval)
+		}
+		if d <= 0 {
+			return errors.New("notifications.interval must be greater than 0")
+		}
+		c.interval = d
+	}
+
+	if len(c.Channels) == 0 {
+		return errors.New("notifications.channels cannot be empty")
+	}
+	names := make(map[string]bool, len(c.Channels))
+	for i, ch := range c.Channels {
+		if ch == nil {
+			return errors.Errorf("notifications.channels[%d] cannot be empty", i)
+		}
+		if ch.Name == "" {
+			return errors.Errorf("notifications.channels[%d].name cannot be empty", i)
+		}
+		if names[ch.Name] {
+			return errors.Errorf("notifications.channels[%d].name %s is duplicated", i, ch.Name)
+		}
+		names[ch.Name] = true
+		if err := ch.validate(); err != nil {
+			return errors.Wrapf(err, "notifications.channels[%d]", i)
+		}
+	}
+
+	if len(c.Windows) == 0 {
+		return errors.New("notifications.windows cannot be empty")
+	}
+	if err := validateWindows("notifications.windows", c.Windows, names); err != nil {
+		return err
+	}
+	for name, p := range c.Provisioners {
+		if p == nil {
+			return errors.Errorf("notifications.provisioners.%s cannot be empty", name)
+		}
+		if err := validateWindows("notifications.provisioners."+name+".windows", p.Windows, names); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetInterval returns the interval between the scans of the certificates.
+func (c *Config) GetInterval() time.Duration {
+	if c == nil || c.interval == 0 {
+		return DefaultInterval
+	}
+	return c.interval
+}
+
+func validateWindows(prefix string, windows []*Window, channels map[string]bool) error {
+	for i, w := range windows {
+		if w == nil {
+			return errors.Errorf("%s[%d] cannot be empty", prefix, i)
+		}
+		d, err := time.ParseDuration(w.Before)
+		if err != nil {
+			return errors.Wrapf(err, "error parsing %s[%d].before %s", prefix, i, w.Before)
+		}
+		if d <= 0 {
+			return errors.Errorf("%s[%d].before must be greater than 0", prefix, i)
+		}
+		w.before = d
+		for _, name := range w.Channels {
+			if !channels[name] {
+				return errors.Errorf("%s[%d].channels: channel %s is not defined", prefix, i, name)
+			}
+		}
+	}
+	// Sort the windows from the most urgent.
+	sort.SliceStable(windows, func(i, j int) bool {
+		return windows[i].before < windows[j].before
+	})
+	return nil
+}
+
+func (c *ChannelConfig) validate() error {
+	switch strings.ToLower(c.Type) {
+	case EmailChannel:
+		if c.SMTP == nil || c.SMTP.Address == "" {
+			return errors.New("smtp.address cannot be empty")
+		}
+		if c.SMTP.From == "" {
+			return errors.New("smtp.from cannot be empty")
+		}
+		if len(c.To) == 0 {
+			return errors.New("to cannot be empty")
+		}
+	case WebhookChannel, SlackChannel:
+		u, err := url.Parse(c.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return errors.Errorf("url %s is not a valid http or https url", c.URL)
+		}
+		if strings.EqualFold(c.Type, WebhookChannel) && c.Secret == "" {
+			return errors.New("secret cannot be empty")
+		}
+	default:
+		return errors.Errorf("type '%s' is not supported", c.Type)
+	}
+	return nil
+}
+
+// Certificate is an expiring certificate included in a notification.
+type Certificate struct {
+	Serial      string    `json:"serial"`
+	Subject     string    `json:"subject,omitempty"`
+	SANs        []string  `json:"sans,omitempty"`
+	NotAfter    time.Time `json:"notAfter"`
+	Provisioner string    `json:"provisioner,omitempty"`
+}
+
+// Notification is the list of certificates that expire within a window.
+type Notification struct {
+	Time         time.Time      `json:"time"`
+	Window       string         `json:"window"`
+	Certificates []*Certificate `json:"certificates"`
+}
+
+// Subject returns a short description of the notification.
+func (n *Notification) Subject() string {
+	if len(n.Certificates) == 1 {
+		return fmt.Sprintf("1 certificate expires within %s", n.Window)
+	}
+	return fmt.Sprintf("%d certificates expire within %s", len(n.Certificates), n.Window)
+}
+
+// Text returns the description of the notification with one line per
+// certificate.
+func (n *Notification) Text() string {
+	var b strings.Builder
+	b.WriteString(n.Subject())
+	b.WriteString(":\n")
+	for _, c := range n.Certificates {
+		name := c.Subject
+		if name == "" && len(c.SANs) > 0 {
+			name = c.SANs[0]
+		}
+		fmt.Fprintf(&b, "- %s (serial %s", name, c.Serial)
+		if c.Provisioner != "" {
+			fmt.Fprintf(&b, ", provisioner %s", c.Provisioner)
+		}
+		fmt.Fprintf(&b, ") expires at %s, in %s\n", c.NotAfter.UTC().Format(time.RFC3339),
+			c.NotAfter.Sub(n.Time).Truncate(time.Minute))
+	}
+	return b.String()
+}
+
+// Source returns the active certificates that expire within the given
+// duration.
+type Source func(within time.Duration) ([]*Certificate, error)
+
+// Notifier scans periodically the expiring certificates and sends the
+// notifications.
+type Notifier struct {
+	config   *Config
+	source   Source
+	store    db.NotificationStore
+	channels map[string]channel
+	elector  *db.Elector
+	mu       sync.Mutex
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// New creates a Notifier with the given configuration. The certificates are
+// read from the source and the notifications sent are kept in the store.
+func New(c *Config, source Source, store db.NotificationStore) (*Notifier, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	n := &Notifier{
+		config:   c,
+		source:   source,
+		store:    store,
+		channels: make(map[string]channel, len(c.Channels)),
+	}
+	for _, ch := range c.Channels {
+		n.channels[ch.Name] = newChannel(ch)
+	}
+	return n, nil
+}
+
+// SetElector sets the elector used by the background scans when multiple
+// instances share the database, only the leader sends the notifications. It
+// must be called before Start.
+func (n *Notifier) SetElector(e *db.Elector) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.elector = e
+}
+
+// windows returns the windows that apply to the certificates of the given
+// provisioner, or nil if they are not notified.
+func (n *Notifier) windows(provisionerName string) []*Window {
+	if p, ok := n.config.Provisioners[provisionerName]; ok {
+		if p.Disabled {
+			return nil
+		}
+		if len(p.Windows) > 0 {
+			return p.Windows
+		}
+	}
+	return n.config.Windows
+}
+
+// maxWindow returns the largest window of the configuration.
+func (n *Notifier) maxWindow() time.Duration {
+	var max time.Duration
+	windows := append([]*Window{}, n.config.Windows...)
+	for _, p := range n.config.Provisioners {
+		windows = append(windows, p.Windows...)
+	}
+	for _, w := range windows {
+		if w.before > max {
+			max = w.before
+		}
+	}
+	return max
+}
+
+// pending is a notification to send and the certificates to mark when it is
+// delivered.
+type pending struct {
+	channel string
+	window  *Window
+	certs   []*Certificate
+}
+
+// Run scans the certificates and sends the notifications due at the given
+// time. Delivery errors are logged, the notifications that failed are sent
+// again on the next run.
+func (n *Notifier) Run(now time.Time) error {
+	certs, err := n.source(n.maxWindow())
+	if err != nil {
+		return errors.Wrap(err, "error getting the expiring certificates")
+	}
+
+	var list []*pending
+	index := make(map[string]*pending)
+	for _, crt := range certs {
+		left := crt.NotAfter.Sub(now)
+		if left <= 0 {
+			continue
+		}
+		// Find the most urgent window reached.
+		var window *Window
+		for _, w := range n.windows(crt.Provisioner) {
+			if left <= w.before {
+				window = w
+				break
+			}
+		}
+		if window == nil {
+			continue
+		}
+		sent, err := n.store.GetExpiryNotifications(crt.Serial)
+		if err != nil {
+			return err
+		}
+		for _, name := range n.windowChannels(window) {
+			if contains(sent, window.key(name)) {
+				continue
+			}
+			k := window.key(name)
+			p, ok := index[k]
+			if !ok {
+				p = &pending{channel: name, window: window}
+				index[k] = p
+				list = append(list, p)
+			}
+			p.certs = append(p.certs, crt)
+		}
+	}
+
+	for _, p := range list {
+		notification := &Notification{
+			Time:         now,
+			Window:       p.window.Before,
+			Certificates: p.certs,
+		}
+		if err := n.channels[p.channel].Send(notification); err != nil {
+			metrics.ExpiryNotifications.Inc(p.channel, "error")
+			log.Printf("error sending expiry notification to %s: %v", p.channel, err)
+			continue
+		}
+		metrics.ExpiryNotifications.Inc(p.channel, "ok")
+		for _, crt := range p.certs {
+			sent, err := n.store.GetExpiryNotifications(crt.Serial)
+			if err != nil {
+				return err
+			}
+			if err := n.store.SetExpiryNotifications(crt.Serial, append(sent, p.window.key(p.channel))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// windowChannels returns the names of the channels notified in the given
+// window.
+func (n *Notifier) windowChannels(w *Window) []string {
+	if len(w.Channels) > 0 {
+		return w.Channels
+	}
+	names := make([]string, len(n.config.Channels))
+	for i, ch := range n.config.Channels {
+		names[i] = ch.Name
+	}
+	return names
+}
+
+// Start runs the scans in the background on every interval until Stop is
+// called.
+func (n *Notifier) Start() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stop != nil {
+		return
+	}
+	n.stop = make(chan struct{})
+	n.done = make(chan struct{})
+	go func(stop, done chan struct{}, elector *db.Elector) {
+		defer close(done)
+		ticker := time.NewTicker(n.config.GetInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				if elector == nil || elector.IsLeader() {
+					if err := n.Run(now); err != nil {
+						log.Printf("error sending expiry notifications: %v", err)
+					}
+				}
+			}
+		}
+	}(n.stop, n.done, n.elector)
+}
+
+// Stop stops the background scans, waits for the current one to finish and
+// releases the lease of the elector.
+func (n *Notifier) Stop() {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	stop, done, elector := n.stop, n.done, n.elector
+	n.stop, n.done = nil, nil
+	n.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+		if elector != nil {
+			if err := elector.Resign(); err != nil {
+				log.Printf("error releasing lease: %v", err)
+			}
+		}
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,278 @@
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/events"
+	"github.com/smallstep/assert"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	channels := []*ChannelConfig{
+		{Name: "ops", Type: "email", SMTP: &SMTPConfig{Address: "smtp.example.com:587", From: "ca@example.com"}, To: []string{"ops@example.com"}},
+		{Name: "hook", Type: "webhook", URL: "https://example.com/hook", Secret: "secret"},
+		{Name: "chat", Type: "SLACK", URL: "https://hooks.slack.com/services/T0/B0/token"},
+	}
+	windows := []*Window{{Before: "720h"}, {Before: "24h", Channels: []string{"ops", "chat"}}}
+	tests := []struct {
+		name    string
+		config  *Config
+		wantErr bool
+	}{
+		{"ok-nil", nil, false},
+		{"ok", &Config{Interval: "10m", Channels: channels, Windows: windows, Provisioners: map[string]*PolicyConfig{
+			"acme":  {Windows: []*Window{{Before: "72h", Channels: []string{"chat"}}}},
+			"admin": {Disabled: true},
+		}}, false},
+		{"fail-interval", &Config{Interval: "foo", Channels: channels, Windows: windows}, true},
+		{"fail-interval-zero", &Config{Interval: "0s", Channels: channels, Windows: windows}, true},
+		{"fail-no-channels", &Config{Windows: windows}, true},
+		{"fail-nil-channel", &Config{Channels: []*ChannelConfig{nil}, Windows: windows}, true},
+		{"fail-channel-name", &Config{Channels: []*ChannelConfig{{Type: "slack", URL: "https://example.com"}}, Windows: windows}, true},
+		{"fail-channel-duplicated", &Config{Channels: []*ChannelConfig{
+			{Name: "a", Type: "slack", URL: "https://example.com"}, {Name: "a", Type: "slack", URL: "https://example.com"},
+		}, Windows: []*Window{{Before: "24h"}}}, true},
+		{"fail-channel-type", &Config{Channels: []*ChannelConfig{{Name: "a", Type: "sms"}}, Windows: []*Window{{Before: "24h"}}}, true},
+		{"fail-smtp", &Config{Channels: []*ChannelConfig{{Name: "a", Type: "email", To: []string{"ops@example.com"}}}, Windows: []*Window{{Before: "24h"}}}, true},
+		{"fail-smtp-from", &Config{Channels: []*ChannelConfig{{Name: "a", Type: "email", SMTP: &SMTPConfig{Address: "smtp:25"}, To: []string{"ops@example.com"}}}, Windows: []*Window{{Before: "24h"}}}, true},
+		{"fail-to", &Config{Channels: []*ChannelConfig{{Name: "a", Type: "email", SMTP: &SMTPConfig{Address: "smtp:25", From: "ca@example.com"}}}, Windows: []*Window{{Before: "24h"}}}, true},
+		{"fail-url", &Config{Channels: []*ChannelConfig{{Name: "a", Type: "slack", URL: "example.com"}}, Windows: []*Window{{Before: "24h"}}}, true},
+		{"fail-secret", &Config{Channels: []*ChannelConfig{{Name: "a", Type: "webhook", URL: "https://example.com"}}, Windows: []*Window{{Before: "24h"}}}, true},
+		{"fail-no-windows", &Config{Channels: channels}, true},
+		{"fail-window", &Config{Channels: channels, Windows: []*Window{{Before: "1 day"}}}, true},
+		{"fail-window-zero", &Config{Channels: channels, Windows: []*Window{{Before: "0s"}}}, true},
+		{"fail-window-channel", &Config{Channels: channels, Windows: []*Window{{Before: "24h", Channels: []string{"foo"}}}}, true},
+		{"fail-provisioner", &Config{Channels: channels, Windows: windows, Provisioners: map[string]*PolicyConfig{"acme": nil}}, true},
+		{"fail-provisioner-window", &Config{Channels: channels, Windows: windows, Provisioners: map[string]*PolicyConfig{
+			"acme": {Windows: []*Window{{Before: "foo"}}},
+		}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Config.Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfig_GetInterval(t *testing.T) {
+	var c *Config
+	assert.Equals(t, DefaultInterval, c.GetInterval())
+	c = &Config{Interval: "5m", Channels: []*ChannelConfig{{Name: "a", Type: "slack", URL: "https://example.com"}}, Windows: []*Window{{Before: "24h"}}}
+	assert.FatalError(t, c.Validate())
+	assert.Equals(t, 5*time.Minute, c.GetInterval())
+}
+
+type memoryStore struct {
+	sent map[string][]string
+}
+
+func (s *memoryStore) GetExpiryNotifications(serial string) ([]string, error) {
+	return s.sent[serial], nil
+}
+
+func (s *memoryStore) SetExpiryNotifications(serial string, keys []string) error {
+	s.sent[serial] = keys
+	return nil
+}
+
+type mockChannel struct {
+	err  error
+	sent []*Notification
+}
+
+func (c *mockChannel) Send(n *Notification) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.sent = append(c.sent, n)
+	return nil
+}
+
+func serials(n *Notification) []string {
+	var list []string
+	for _, c := range n.Certificates {
+		list = append(list, c.Serial)
+	}
+	return list
+}
+
+func TestNotifier_Run(t *testing.T) {
+	now := time.Now()
+	certs := []*Certificate{
+		{Serial: "1", Subject: "a.example.com", NotAfter: now.Add(20 * 24 * time.Hour), Provisioner: "jwk"},
+		{Serial: "2", Subject: "b.example.com", NotAfter: now.Add(12 * time.Hour), Provisioner: "jwk"},
+		{Serial: "3", Subject: "c.example.com", NotAfter: now.Add(2 * 24 * time.Hour), Provisioner: "acme"},
+		{Serial: "4", Subject: "d.example.com", NotAfter: now.Add(time.Hour), Provisioner: "admin"},
+		{Serial: "5", Subject: "e.example.com", NotAfter: now.Add(40 * 24 * time.Hour), Provisioner: "jwk"},
+	}
+	var within time.Duration
+	source := func(d time.Duration) ([]*Certificate, error) {
+		within = d
+		return certs, nil
+	}
+	store := &memoryStore{sent: make(map[string][]string)}
+	n, err := New(&Config{
+		Channels: []*ChannelConfig{
+			{Name: "ops", Type: "webhook", URL: "https://example.com/hook", Secret: "secret"},
+			{Name: "chat", Type: "slack", URL: "https://example.com/slack"},
+		},
+		Windows: []*Window{{Before: "24h"}, {Before: "720h", Channels: []string{"ops"}}},
+		Provisioners: map[string]*PolicyConfig{
+			"acme":  {Windows: []*Window{{Before: "72h", Channels: []string{"chat"}}}},
+			"admin": {Disabled: true},
+		},
+	}, source, store)
+	assert.FatalError(t, err)
+	ops, chat := &mockChannel{}, &mockChannel{}
+	n.channels = map[string]channel{"ops": ops, "chat": chat}
+
+	assert.FatalError(t, n.Run(now))
+	assert.Equals(t, 720*time.Hour, within)
+	// ops: 720h window with 1, 24h window with 2
+	if assert.Len(t, 2, ops.sent) {
+		assert.Equals(t, "720h", ops.sent[0].Window)
+		assert.Equals(t, []string{"1"}, serials(ops.sent[0]))
+		assert.Equals(t, "24h", ops.sent[1].Window)
+		assert.Equals(t, []string{"2"}, serials(ops.sent[1]))
+	}
+	// chat: 24h window with 2, acme 72h window with 3
+	if assert.Len(t, 2, chat.sent) {
+		assert.Equals(t, []string{"2"}, serials(chat.sent[0]))
+		assert.Equals(t, "72h", chat.sent[1].Window)
+		assert.Equals(t, []string{"3"}, serials(chat.sent[1]))
+	}
+	assert.Equals(t, []string{"720h0m0s/ops"}, store.sent["1"])
+	assert.Equals(t, []string{"24h0m0s/ops", "24h0m0s/chat"}, store.sent["2"])
+
+	// Nothing new is sent
+	assert.FatalError(t, n.Run(now.Add(time.Minute)))
+	assert.Len(t, 2, ops.sent)
+	assert.Len(t, 2, chat.sent)
+
+	// Escalation of 1 to the 24h window and 5 enters the 720h window, the
+	// chat fails and it's retried
+	chat.err = errors.New("connection refused")
+	later := now.Add(19*24*time.Hour + time.Hour)
+	assert.FatalError(t, n.Run(later))
+	if assert.Len(t, 4, ops.sent) {
+		assert.Equals(t, "24h", ops.sent[2].Window)
+		assert.Equals(t, []string{"1"}, serials(ops.sent[2]))
+		assert.Equals(t, "720h", ops.sent[3].Window)
+		assert.Equals(t, []string{"5"}, serials(ops.sent[3]))
+	}
+	assert.Len(t, 2, chat.sent)
+	chat.err = nil
+	assert.FatalError(t, n.Run(later))
+	assert.Len(t, 4, ops.sent)
+	if assert.Len(t, 3, chat.sent) {
+		assert.Equals(t, []string{"1"}, serials(chat.sent[2]))
+	}
+
+	// Source errors
+	n.source = func(d time.Duration) ([]*Certificate, error) {
+		return nil, errors.New("database is down")
+	}
+	assert.Error(t, n.Run(now))
+}
+
+func TestNotifier_StartStop(t *testing.T) {
+	var mu sync.Mutex
+	var runs int
+	source := func(d time.Duration) ([]*Certificate, error) {
+		mu.Lock()
+		runs++
+		mu.Unlock()
+		return nil, nil
+	}
+	c := &Config{Interval: "10ms", Channels: []*ChannelConfig{{Name: "chat", Type: "slack", URL: "https://example.com"}}, Windows: []*Window{{Before: "24h"}}}
+	n, err := New(c, source, &memoryStore{sent: make(map[string][]string)})
+	assert.FatalError(t, err)
+	n.Start()
+	time.Sleep(50 * time.Millisecond)
+	n.Stop()
+	mu.Lock()
+	assert.True(t, runs > 0)
+	mu.Unlock()
+
+	// Stop of a nil notifier
+	var nn *Notifier
+	nn.Stop()
+}
+
+func TestNotification_Text(t *testing.T) {
+	now := time.Date(2019, 10, 1, 12, 0, 0, 0, time.UTC)
+	n := &Notification{Time: now, Window: "24h", Certificates: []*Certificate{
+		{Serial: "1", Subject: "a.example.com", NotAfter: now.Add(10 * time.Hour), Provisioner: "jwk"},
+		{Serial: "2", SANs: []string{"b.example.com"}, NotAfter: now.Add(90 * time.Minute)},
+	}}
+	assert.Equals(t, "2 certificates expire within 24h", n.Subject())
+	assert.Equals(t, "2 certificates expire within 24h:\n"+
+		"- a.example.com (serial 1, provisioner jwk) expires at 2019-10-01T22:00:00Z, in 10h0m0s\n"+
+		"- b.example.com (serial 2) expires at 2019-10-01T13:30:00Z, in 1h30m0s\n", n.Text())
+	n.Certificates = n.Certificates[:1]
+	assert.Equals(t, "1 certificate expires within 24h", n.Subject())
+}
+
+func TestChannels(t *testing.T) {
+	n := &Notification{Time: time.Now(), Window: "24h", Certificates: []*Certificate{
+		{Serial: "1", Subject: "a.example.com", NotAfter: time.Now().Add(time.Hour)},
+	}}
+
+	var hookBody, slackBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		assert.FatalError(t, err)
+		switch r.URL.Path {
+		case "/hook":
+			assert.Equals(t, NotificationType, r.Header.Get(events.EventTypeHeader))
+			assert.True(t, events.Verify("secret", b, r.Header.Get(events.SignatureHeader)))
+			hookBody = b
+		case "/slack":
+			slackBody = b
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	assert.FatalError(t, newChannel(&ChannelConfig{Type: "webhook", URL: srv.URL + "/hook", Secret: "secret"}).Send(n))
+	var body map[string]interface{}
+	assert.FatalError(t, json.Unmarshal(hookBody, &body))
+	assert.Equals(t, NotificationType, body["type"])
+	assert.Equals(t, "24h", body["window"])
+	assert.Len(t, 1, body["certificates"])
+
+	assert.FatalError(t, newChannel(&ChannelConfig{Type: "slack", URL: srv.URL + "/slack"}).Send(n))
+	assert.FatalError(t, json.Unmarshal(slackBody, &body))
+	assert.Equals(t, n.Text(), body["text"])
+
+	assert.Error(t, newChannel(&ChannelConfig{Type: "slack", URL: srv.URL + "/foo"}).Send(n))
+
+	// Email
+	ch := newChannel(&ChannelConfig{Type: "email", SMTP: &SMTPConfig{
+		Address: "smtp.example.com:587", Username: "user", Password: "pass", From: "ca@example.com",
+	}, To: []string{"a@example.com", "b@example.com"}}).(*emailChannel)
+	ch.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		assert.Equals(t, "smtp.example.com:587", addr)
+		assert.NotNil(t, a)
+		assert.Equals(t, "ca@example.com", from)
+		assert.Equals(t, []string{"a@example.com", "b@example.com"}, to)
+		s := string(msg)
+		assert.True(t, strings.Contains(s, "To: a@example.com, b@example.com\r\n"))
+		assert.True(t, strings.Contains(s, "Subject: [step-ca] 1 certificate expires within 24h\r\n"))
+		assert.True(t, strings.Contains(s, "\r\n\r\n1 certificate expires within 24h:\r\n- a.example.com (serial 1)"))
+		return nil
+	}
+	assert.FatalError(t, ch.Send(n))
+}
@@ -0,0 +1,159 @@
+package pki
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"os"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-cli/crypto/keys"
+	"github.com/RTradeLtd/ca-cli/crypto/pemutil"
+	"github.com/RTradeLtd/ca-cli/utils"
+	"github.com/pkg/errors"
+)
+
+var (
+	oidExtensionKeyUsage         = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+)
+
+type basicConstraints struct {
+	IsCA       bool `asn1:"optional"`
+	MaxPathLen int  `asn1:"optional,default:-1"`
+}
+
+// GenerateIntermediateCSR generates a new intermediate key, writes it
+// encrypted with the given password to keyFile, and returns a certificate
+// signing request with the given name. The request asks for the extensions of
+// an intermediate CA, so it can be signed by an external or offline root.
+func GenerateIntermediateCSR(name, keyFile string, password []byte) (*x509.CertificateRequest, error) {
+	if len(password) == 0 {
+		return nil, errors.New("the password of the intermediate key cannot be empty")
+	}
+	_, priv, err := keys.GenerateDefaultKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return nil, errors.Errorf("key of type %T is not a crypto.Signer", priv)
+	}
+
+	// Certificate signing and CRL signing, the bits 5 and 6.
+	keyUsage, err := asn1.Marshal(asn1.BitString{Bytes: []byte{0x06}, BitLength: 7})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling key usage")
+	}
+	constraints, err := asn1.Marshal(basicConstraints{IsCA: true, MaxPathLen: 0})
+	if err != nil {
+		return nil, errors.Wrap(err, "error marshaling basic constraints")
+	}
+	b, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: name},
+		ExtraExtensions: []pkix.Extension{
+			{Id: oidExtensionKeyUsage, Critical: true, Value: keyUsage},
+			{Id: oidExtensionBasicConstraints, Critical: true, Value: constraints},
+		},
+	}, signer)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating certificate request")
+	}
+	csr, err := x509.ParseCertificateRequest(b)
+	if err != nil {
+		return nil, errors.Wrap(err, "error parsing certificate request")
+	}
+
+	if _, err := pemutil.Serialize(priv, pemutil.WithPassword(password), pemutil.ToFile(keyFile, 0600)); err != nil {
+		return nil, err
+	}
+	return csr, nil
+}
+
+// ActivateIntermediate verifies that the certificate bundle in crtFile is an
+// intermediate CA for the key in keyFile, signed by one of the roots of the
+// given configuration, and installs both as the intermediate of the CA. The
+// previous certificate and key are kept with the ".old" extension. The CA
+// must be restarted or reloaded to use the new intermediate.
+func ActivateIntermediate(config *authority.Config, crtFile, keyFile string, password []byte) error {
+	chain, err := pemutil.ReadCertificateBundle(crtFile)
+	if err != nil {
+		return err
+	}
+	priv, err := pemutil.Read(keyFile, pemutil.WithPassword(password))
+	if err != nil {
+		return err
+	}
+	if err := validateIntermediate(config, chain, priv); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	for _, crt := range chain {
+		if err := pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: crt.Raw}); err != nil {
+			return errors.Wrap(err, "error encoding certificate")
+		}
+	}
+	for _, name := range []string{config.IntermediateCert, config.IntermediateKey} {
+		if _, err := os.Stat(name); err == nil {
+			if err := os.Rename(name, name+".old"); err != nil {
+				return errors.Wrapf(err, "error backing up %s", name)
+			}
+		}
+	}
+	if err := utils.WriteFile(config.IntermediateCert, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	// The key is encrypted with the password the CA is started with.
+	_, err = pemutil.Serialize(priv, pemutil.WithPassword(password), pemutil.ToFile(config.IntermediateKey, 0600))
+	return err
+}
+
+// validateIntermediate returns an error if the first certificate of the chain
+// is not a CA for the given key, or if it does not chain to the roots of the
+// configuration.
+func validateIntermediate(config *authority.Config, chain []*x509.Certificate, priv interface{}) error {
+	if len(chain) == 0 {
+		return errors.New("the certificate bundle is empty")
+	}
+	crt := chain[0]
+	signer, ok := priv.(crypto.Signer)
+	if !ok {
+		return errors.Errorf("key of type %T is not a crypto.Signer", priv)
+	}
+	pub, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return errors.Wrap(err, "error marshaling public key")
+	}
+	if !bytes.Equal(pub, crt.RawSubjectPublicKeyInfo) {
+		return errors.New("the certificate does not match the intermediate key")
+	}
+	if !crt.BasicConstraintsValid || !crt.IsCA || crt.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return errors.New("the certificate is not a certificate authority")
+	}
+
+	roots := x509.NewCertPool()
+	for _, name := range config.Root {
+		root, err := pemutil.ReadCertificate(name)
+		if err != nil {
+			return err
+		}
+		roots.AddCert(root)
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+	if _, err := crt.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return errors.Wrap(err, "error verifying the certificate with the roots of the CA")
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package rpc
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+// The types in this file are the messages defined in ca.proto. They use the
+// same struct tags as the code generated by protoc-gen-go so they can be
+// encoded with the proto package.
+
+// SignRequest is the request message of the Sign method.
+type SignRequest struct {
+	CSR       []byte `protobuf:"bytes,1,opt,name=csr,proto3" json:"csr,omitempty"`
+	OTT       string `protobuf:"bytes,2,opt,name=ott,proto3" json:"ott,omitempty"`
+	NotBefore string `protobuf:"bytes,3,opt,name=not_before,json=notBefore,proto3" json:"not_before,omitempty"`
+	NotAfter  string `protobuf:"bytes,4,opt,name=not_after,json=notAfter,proto3" json:"not_after,omitempty"`
+}
+
+func (m *SignRequest) Reset()         { *m = SignRequest{} }
+func (m *SignRequest) String() string { return proto.CompactTextString(m) }
+func (*SignRequest) ProtoMessage()    {}
+
+// SignResponse is the response message of the Sign and Renew methods.
+type SignResponse struct {
+	Certificate   []byte   `protobuf:"bytes,1,opt,name=certificate,proto3" json:"certificate,omitempty"`
+	CA            []byte   `protobuf:"bytes,2,opt,name=ca,proto3" json:"ca,omitempty"`
+	CertChain     [][]byte `protobuf:"bytes,3,rep,name=cert_chain,json=certChain,proto3" json:"cert_chain,omitempty"`
+	PendingID     string   `protobuf:"bytes,4,opt,name=pending_id,json=pendingId,proto3" json:"pending_id,omitempty"`
+	PendingStatus string   `protobuf:"bytes,5,opt,name=pending_status,json=pendingStatus,proto3" json:"pending_status,omitempty"`
+	RenewAfter    string   `protobuf:"bytes,6,opt,name=renew_after,json=renewAfter,proto3" json:"renew_after,omitempty"`
+}
+
+func (m *SignResponse) Reset()         { *m = SignResponse{} }
+func (m *SignResponse) String() string { return proto.CompactTextString(m) }
+func (*SignResponse) ProtoMessage()    {}
+
+// RenewRequest is the request message of the Renew method.
+type RenewRequest struct{}
+
+func (m *RenewRequest) Reset()         { *m = RenewRequest{} }
+func (m *RenewRequest) String() string { return proto.CompactTextString(m) }
+func (*RenewRequest) ProtoMessage()    {}
+
+// RevokeRequest is the request message of the Revoke method.
+type RevokeRequest struct {
+	Serial     string `protobuf:"bytes,1,opt,name=serial,proto3" json:"serial,omitempty"`
+	OTT        string `protobuf:"bytes,2,opt,name=ott,proto3" json:"ott,omitempty"`
+	ReasonCode int32  `protobuf:"varint,3,opt,name=reason_code,json=reasonCode,proto3" json:"reason_code,omitempty"`
+	Reason     string `protobuf:"bytes,4,opt,name=reason,proto3" json:"reason,omitempty"`
+	Passive    bool   `protobuf:"varint,5,opt,name=passive,proto3" json:"passive,omitempty"`
+}
+
+func (m *RevokeRequest) Reset()         { *m = RevokeRequest{} }
+func (m *RevokeRequest) String() string { return proto.CompactTextString(m) }
+func (*RevokeRequest) ProtoMessage()    {}
+
+// RevokeResponse is the response message of the Revoke method.
+type RevokeResponse struct {
+	Status string `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
+}
+
+func (m *RevokeResponse) Reset()         { *m = RevokeResponse{} }
+func (m *RevokeResponse) String() string { return proto.CompactTextString(m) }
+func (*RevokeResponse) ProtoMessage()    {}
+
+// SignSSHRequest is the request message of the SignSSH method.
+type SignSSHRequest struct {
+	PublicKey        []byte   `protobuf:"bytes,1,opt,name=public_key,json=publicKey,proto3" json:"public_key,omitempty"`
+	OTT              string   `protobuf:"bytes,2,opt,name=ott,proto3" json:"ott,omitempty"`
+	CertType         string   `protobuf:"bytes,3,opt,name=cert_type,json=certType,proto3" json:"cert_type,omitempty"`
+	Principals       []string `protobuf:"bytes,4,rep,name=principals,proto3" json:"principals,omitempty"`
+	ValidAfter       string   `protobuf:"bytes,5,opt,name=valid_after,json=validAfter,proto3" json:"valid_after,omitempty"`
+	ValidBefore      string   `protobuf:"bytes,6,opt,name=valid_before,json=validBefore,proto3" json:"valid_before,omitempty"`
+	AddUserPublicKey []byte   `protobuf:"bytes,7,opt,name=add_user_public_key,json=addUserPublicKey,proto3" json:"add_user_public_key,omitempty"`
+}
+
+func (m *SignSSHRequest) Reset()         { *m = SignSSHRequest{} }
+func (m *SignSSHRequest) String() string { return proto.CompactTextString(m) }
+func (*SignSSHRequest) ProtoMessage()    {}
+
+// SignSSHResponse is the response message of the SignSSH method.
+type SignSSHResponse struct {
+	Certificate        []byte `protobuf:"bytes,1,opt,name=certificate,proto3" json:"certificate,omitempty"`
+	AddUserCertificate []byte `protobuf:"bytes,2,opt,name=add_user_certificate,json=addUserCertificate,proto3" json:"add_user_certificate,omitempty"`
+}
+
+func (m *SignSSHResponse) Reset()         { *m = SignSSHResponse{} }
+func (m *SignSSHResponse) String() string { return proto.CompactTextString(m) }
+func (*SignSSHResponse) ProtoMessage()    {}
+
+// RootsRequest is the request message of the Roots method.
+type RootsRequest struct{}
+
+func (m *RootsRequest) Reset()         { *m = RootsRequest{} }
+func (m *RootsRequest) String() string { return proto.CompactTextString(m) }
+func (*RootsRequest) ProtoMessage()    {}
+
+// RootsResponse is the response message of the Roots method.
+type RootsResponse struct {
+	Certificates [][]byte `protobuf:"bytes,1,rep,name=certificates,proto3" json:"certificates,omitempty"`
+}
+
+func (m *RootsResponse) Reset()         { *m = RootsResponse{} }
+func (m *RootsResponse) String() string { return proto.CompactTextString(m) }
+func (*RootsResponse) ProtoMessage()    {}
+
+// ProvisionersRequest is the request message of the Provisioners method.
+type ProvisionersRequest struct {
+	Cursor string `protobuf:"bytes,1,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	Limit  int32  `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+}
+
+func (m *ProvisionersRequest) Reset()         { *m = ProvisionersRequest{} }
+func (m *ProvisionersRequest) String() string { return proto.CompactTextString(m) }
+func (*ProvisionersRequest) ProtoMessage()    {}
+
+// Provisioner is the representation of a provisioner.
+type Provisioner struct {
+	ID   string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name string `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Type string `protobuf:"bytes,3,opt,name=type,proto3" json:"type,omitempty"`
+	JSON []byte `protobuf:"bytes,4,opt,name=json,proto3" json:"json,omitempty"`
+}
+
+func (m *Provisioner) Reset()         { *m = Provisioner{} }
+func (m *Provisioner) String() string { return proto.CompactTextString(m) }
+func (*Provisioner) ProtoMessage()    {}
+
+// ProvisionersResponse is the response message of the Provisioners method.
+type ProvisionersResponse struct {
+	Provisioners []*Provisioner `protobuf:"bytes,1,rep,name=provisioners,proto3" json:"provisioners,omitempty"`
+	NextCursor   string         `protobuf:"bytes,2,opt,name=next_cursor,json=nextCursor,proto3" json:"next_cursor,omitempty"`
+}
+
+func (m *ProvisionersResponse) Reset()         { *m = ProvisionersResponse{} }
+func (m *ProvisionersResponse) String() string { return proto.CompactTextString(m) }
+func (*ProvisionersResponse) ProtoMessage()    {}
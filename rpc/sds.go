@@ -0,0 +1,339 @@
+package rpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/api"
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/internal/certutil"
+	"github.com/RTradeLtd/ca-cli/crypto/randutil"
+	"github.com/RTradeLtd/ca-cli/crypto/x509util"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+	"github.com/pkg/errors"
+)
+
+// SDSDefaultSecretName is the name of the secret with the certificate of the
+// identity of the client certificate.
+const SDSDefaultSecretName = "default"
+
+// SDSAuthority is the interface implemented by the CA authority used by the
+// SDS server.
+type SDSAuthority interface {
+	MintToken(opts authority.MintOptions) (string, error)
+	Authorize(ctx context.Context, ott string) ([]provisioner.SignOption, error)
+	Sign(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
+	GetRoots() ([]*x509.Certificate, error)
+}
+
+// SDSOptions are the options of the SDS server. The certificates are signed
+// with tokens minted with Provisioner, with the validity in CertDuration or
+// the default of the provisioner. RootCAName is the name of the secret with
+// the root certificates.
+type SDSOptions struct {
+	Provisioner  string
+	CertDuration time.Duration
+	RootCAName   string
+}
+
+// SDSServer implements the Envoy SecretDiscoveryService. The clients, Envoy or
+// Istio sidecars, authenticate with a client certificate issued by the CA, and
+// they can request the secret named default, with a new certificate for the
+// identity of the client certificate, a secret named as one of the SANs of
+// the client certificate, and the secret with the root certificates. On the
+// streams the certificates are rotated after two thirds of their validity.
+type SDSServer struct {
+	mutex sync.RWMutex
+	auth  SDSAuthority
+	opts  SDSOptions
+}
+
+// NewSDS creates a new SDSServer with the given authority and options.
+func NewSDS(auth SDSAuthority, opts SDSOptions) *SDSServer {
+	if opts.RootCAName == "" {
+		opts.RootCAName = authority.DefaultSDSRootCAName
+	}
+	return &SDSServer{auth: auth, opts: opts}
+}
+
+// SetAuthority replaces the authority used by the server, it is used when the
+// CA configuration is reloaded.
+func (s *SDSServer) SetAuthority(auth SDSAuthority) {
+	s.mutex.Lock()
+	s.auth = auth
+	s.mutex.Unlock()
+}
+
+func (s *SDSServer) authority() SDSAuthority {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.auth
+}
+
+// FetchSecrets returns the requested secrets.
+func (s *SDSServer) FetchSecrets(ctx context.Context, req *DiscoveryRequest) (*DiscoveryResponse, error) {
+	if err := validateDiscoveryRequest(req); err != nil {
+		return nil, toStatusError("FetchSecrets", err)
+	}
+	res, _, err := s.discover(ctx, req.ResourceNames)
+	if err != nil {
+		return nil, toStatusError("FetchSecrets", err)
+	}
+	return res, nil
+}
+
+// StreamSecrets sends the requested secrets, and new certificates before the
+// previous ones expire. The requests that acknowledge a response only get a
+// new response if the names of the secrets have changed.
+func (s *SDSServer) StreamSecrets(stream SDSStream) error {
+	ctx := stream.Context()
+	requests := make(chan *DiscoveryRequest)
+	errs := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				errs <- err
+				return
+			}
+			select {
+			case requests <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var names []string
+	var nonce string
+	var rotate <-chan time.Time
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		select {
+		case req := <-requests:
+			if err := validateDiscoveryRequest(req); err != nil {
+				return toStatusError("StreamSecrets", err)
+			}
+			// Ignore the replies to old responses.
+			if req.ResponseNonce != "" && req.ResponseNonce != nonce {
+				continue
+			}
+			if req.ErrorDetail != nil {
+				log.Printf("sds: node %s rejected the secrets: %s", nodeID(req), req.ErrorDetail.Message)
+			}
+			if nonce != "" && certutil.EqualNames(names, req.ResourceNames) {
+				continue
+			}
+			names = req.ResourceNames
+		case <-rotate:
+		case err := <-errs:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		res, refresh, err := s.discover(ctx, names)
+		if err != nil {
+			return toStatusError("StreamSecrets", err)
+		}
+		if err := stream.Send(res); err != nil {
+			return err
+		}
+		nonce = res.Nonce
+
+		if timer != nil {
+			timer.Stop()
+			timer, rotate = nil, nil
+		}
+		if !refresh.IsZero() {
+			timer = time.NewTimer(time.Until(refresh))
+			rotate = timer.C
+		}
+	}
+}
+
+// discover returns the response with the given secrets, and the time when
+// the certificates in the response must be rotated, zero if there are no
+// certificates.
+func (s *SDSServer) discover(ctx context.Context, names []string) (*DiscoveryResponse, time.Time, error) {
+	auth := s.authority()
+	var refresh time.Time
+	resources := make([]*any.Any, 0, len(names))
+	for _, name := range names {
+		var secret *Secret
+		if name == s.opts.RootCAName {
+			roots, err := auth.GetRoots()
+			if err != nil {
+				return nil, refresh, api.Forbidden(err)
+			}
+			secret = &Secret{
+				Name: name,
+				ValidationContext: &CertificateValidationContext{
+					TrustedCA: &DataSource{InlineBytes: certutil.EncodeCertificates(roots)},
+				},
+			}
+		} else {
+			chain, key, err := s.issue(ctx, auth, name)
+			if err != nil {
+				return nil, refresh, err
+			}
+			secret = &Secret{
+				Name: name,
+				TLSCertificate: &TLSCertificate{
+					CertificateChain: &DataSource{InlineBytes: certutil.EncodeCertificates(chain)},
+					PrivateKey:       &DataSource{InlineBytes: key},
+				},
+			}
+			// Rotate the certificate after two thirds of its validity.
+			leaf := chain[0]
+			t := leaf.NotBefore.Add(leaf.NotAfter.Sub(leaf.NotBefore) * 2 / 3)
+			if refresh.IsZero() || t.Before(refresh) {
+				refresh = t
+			}
+		}
+
+		b, err := proto.Marshal(secret)
+		if err != nil {
+			return nil, refresh, api.InternalServerError(errors.Wrap(err, "error marshaling secret"))
+		}
+		resources = append(resources, &any.Any{TypeUrl: SecretTypeURL, Value: b})
+	}
+
+	nonce, err := randutil.Hex(32)
+	if err != nil {
+		return nil, refresh, api.InternalServerError(errors.Wrap(err, "error generating nonce"))
+	}
+	return &DiscoveryResponse{
+		VersionInfo: strconv.FormatInt(time.Now().UnixNano(), 10),
+		Resources:   resources,
+		TypeURL:     SecretTypeURL,
+		Nonce:       nonce,
+	}, refresh, nil
+}
+
+// issue creates a new key and signs a certificate for the identity of the
+// given secret. It returns the certificate chain and the PEM encoded key.
+func (s *SDSServer) issue(ctx context.Context, auth SDSAuthority, name string) ([]*x509.Certificate, []byte, error) {
+	crt, err := peerCertificate(ctx)
+	if err != nil {
+		return nil, nil, api.Unauthorized(errors.New("missing peer certificate"))
+	}
+	subject, sans, err := sdsIdentity(crt, name)
+	if err != nil {
+		return nil, nil, api.Forbidden(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, api.InternalServerError(errors.Wrap(err, "error generating key"))
+	}
+	dnsNames, ips, emails := x509util.SplitSANs(sans)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:        pkix.Name{CommonName: subject},
+		DNSNames:       dnsNames,
+		IPAddresses:    ips,
+		EmailAddresses: emails,
+	}, key)
+	if err != nil {
+		return nil, nil, api.InternalServerError(errors.Wrap(err, "error creating csr"))
+	}
+	cr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, nil, api.InternalServerError(errors.Wrap(err, "error parsing csr"))
+	}
+
+	ott, err := auth.MintToken(authority.MintOptions{
+		Provisioner: s.opts.Provisioner,
+		Subject:     subject,
+		SANs:        sans,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	signOpts, err := auth.Authorize(provisioner.NewContextWithMethod(ctx, provisioner.SignMethod), ott)
+	if err != nil {
+		return nil, nil, api.Unauthorized(err)
+	}
+	var opts provisioner.Options
+	if s.opts.CertDuration > 0 {
+		opts.NotAfter.SetDuration(s.opts.CertDuration)
+	}
+	chain, err := auth.Sign(withRemoteAddress(ctx), cr, opts, signOpts...)
+	if err != nil {
+		return nil, nil, api.Forbidden(err)
+	}
+	if len(chain) == 0 {
+		return nil, nil, api.InternalServerError(errors.New("error signing certificate: empty certificate chain"))
+	}
+
+	b, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, api.InternalServerError(errors.Wrap(err, "error marshaling key"))
+	}
+	return chain, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b}), nil
+}
+
+// sdsIdentity returns the subject and SANs of the certificate of the given
+// secret. The default secret uses the identity of the client certificate, any
+// other secret must be named as one of its DNS names, IP addresses or emails.
+func sdsIdentity(crt *x509.Certificate, name string) (string, []string, error) {
+	var sans []string
+	sans = append(sans, crt.DNSNames...)
+	for _, ip := range crt.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, crt.EmailAddresses...)
+
+	if name == SDSDefaultSecretName {
+		if len(sans) == 0 {
+			return "", nil, errors.New("peer certificate does not have SANs")
+		}
+		subject := crt.Subject.CommonName
+		if subject == "" {
+			subject = sans[0]
+		}
+		return subject, sans, nil
+	}
+	for _, san := range sans {
+		if san == name {
+			return name, []string{name}, nil
+		}
+	}
+	return "", nil, errors.Errorf("secret %s is not a SAN of the peer certificate", name)
+}
+
+// validateDiscoveryRequest validates the type of the requested resources.
+func validateDiscoveryRequest(req *DiscoveryRequest) error {
+	if req.TypeURL != "" && req.TypeURL != SecretTypeURL {
+		return api.BadRequest(errors.Errorf("unsupported type %s", req.TypeURL))
+	}
+	return nil
+}
+
+func nodeID(req *DiscoveryRequest) string {
+	if req.Node == nil {
+		return "unknown"
+	}
+	return req.Node.ID
+}
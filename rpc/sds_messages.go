@@ -0,0 +1,111 @@
+package rpc
+
+import (
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/any"
+)
+
+// The types in this file are the subset of the messages of the Envoy v3 xDS
+// API used by the Secret Discovery Service. They use the same names, numbers
+// and struct tags as the code generated by protoc-gen-go, the fields of the
+// Envoy messages not used by the CA are not defined and they are ignored when
+// a message is decoded. The oneof fields are defined as regular fields, they
+// have the same encoding.
+
+// SecretTypeURL is the type URL of the Envoy v3 Secret message.
+const SecretTypeURL = "type.googleapis.com/envoy.extensions.transport_sockets.tls.v3.Secret"
+
+// DiscoveryRequest is the request message of the SDS methods, it corresponds
+// to envoy.service.discovery.v3.DiscoveryRequest.
+type DiscoveryRequest struct {
+	VersionInfo   string   `protobuf:"bytes,1,opt,name=version_info,json=versionInfo,proto3" json:"version_info,omitempty"`
+	Node          *Node    `protobuf:"bytes,2,opt,name=node,proto3" json:"node,omitempty"`
+	ResourceNames []string `protobuf:"bytes,3,rep,name=resource_names,json=resourceNames,proto3" json:"resource_names,omitempty"`
+	TypeURL       string   `protobuf:"bytes,4,opt,name=type_url,json=typeUrl,proto3" json:"type_url,omitempty"`
+	ResponseNonce string   `protobuf:"bytes,5,opt,name=response_nonce,json=responseNonce,proto3" json:"response_nonce,omitempty"`
+	ErrorDetail   *Status  `protobuf:"bytes,6,opt,name=error_detail,json=errorDetail,proto3" json:"error_detail,omitempty"`
+}
+
+func (m *DiscoveryRequest) Reset()         { *m = DiscoveryRequest{} }
+func (m *DiscoveryRequest) String() string { return proto.CompactTextString(m) }
+func (*DiscoveryRequest) ProtoMessage()    {}
+
+// Node identifies the Envoy instance, it corresponds to
+// envoy.config.core.v3.Node.
+type Node struct {
+	ID      string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Cluster string `protobuf:"bytes,2,opt,name=cluster,proto3" json:"cluster,omitempty"`
+}
+
+func (m *Node) Reset()         { *m = Node{} }
+func (m *Node) String() string { return proto.CompactTextString(m) }
+func (*Node) ProtoMessage()    {}
+
+// Status is the error sent by Envoy when it rejects a response, it corresponds
+// to google.rpc.Status.
+type Status struct {
+	Code    int32  `protobuf:"varint,1,opt,name=code,proto3" json:"code,omitempty"`
+	Message string `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+}
+
+func (m *Status) Reset()         { *m = Status{} }
+func (m *Status) String() string { return proto.CompactTextString(m) }
+func (*Status) ProtoMessage()    {}
+
+// DiscoveryResponse is the response message of the SDS methods, it corresponds
+// to envoy.service.discovery.v3.DiscoveryResponse. The resources are Secret
+// messages.
+type DiscoveryResponse struct {
+	VersionInfo string     `protobuf:"bytes,1,opt,name=version_info,json=versionInfo,proto3" json:"version_info,omitempty"`
+	Resources   []*any.Any `protobuf:"bytes,2,rep,name=resources,proto3" json:"resources,omitempty"`
+	TypeURL     string     `protobuf:"bytes,4,opt,name=type_url,json=typeUrl,proto3" json:"type_url,omitempty"`
+	Nonce       string     `protobuf:"bytes,5,opt,name=nonce,proto3" json:"nonce,omitempty"`
+}
+
+func (m *DiscoveryResponse) Reset()         { *m = DiscoveryResponse{} }
+func (m *DiscoveryResponse) String() string { return proto.CompactTextString(m) }
+func (*DiscoveryResponse) ProtoMessage()    {}
+
+// Secret is a TLS certificate or a validation context, it corresponds to
+// envoy.extensions.transport_sockets.tls.v3.Secret.
+type Secret struct {
+	Name              string                        `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	TLSCertificate    *TLSCertificate               `protobuf:"bytes,2,opt,name=tls_certificate,json=tlsCertificate,proto3" json:"tls_certificate,omitempty"`
+	ValidationContext *CertificateValidationContext `protobuf:"bytes,4,opt,name=validation_context,json=validationContext,proto3" json:"validation_context,omitempty"`
+}
+
+func (m *Secret) Reset()         { *m = Secret{} }
+func (m *Secret) String() string { return proto.CompactTextString(m) }
+func (*Secret) ProtoMessage()    {}
+
+// TLSCertificate is a certificate chain and its private key, it corresponds
+// to envoy.extensions.transport_sockets.tls.v3.TlsCertificate.
+type TLSCertificate struct {
+	CertificateChain *DataSource `protobuf:"bytes,1,opt,name=certificate_chain,json=certificateChain,proto3" json:"certificate_chain,omitempty"`
+	PrivateKey       *DataSource `protobuf:"bytes,2,opt,name=private_key,json=privateKey,proto3" json:"private_key,omitempty"`
+}
+
+func (m *TLSCertificate) Reset()         { *m = TLSCertificate{} }
+func (m *TLSCertificate) String() string { return proto.CompactTextString(m) }
+func (*TLSCertificate) ProtoMessage()    {}
+
+// CertificateValidationContext contains the certificates used to validate the
+// peers, it corresponds to
+// envoy.extensions.transport_sockets.tls.v3.CertificateValidationContext.
+type CertificateValidationContext struct {
+	TrustedCA *DataSource `protobuf:"bytes,1,opt,name=trusted_ca,json=trustedCa,proto3" json:"trusted_ca,omitempty"`
+}
+
+func (m *CertificateValidationContext) Reset()         { *m = CertificateValidationContext{} }
+func (m *CertificateValidationContext) String() string { return proto.CompactTextString(m) }
+func (*CertificateValidationContext) ProtoMessage()    {}
+
+// DataSource contains inline data, it corresponds to
+// envoy.config.core.v3.DataSource.
+type DataSource struct {
+	InlineBytes []byte `protobuf:"bytes,2,opt,name=inline_bytes,json=inlineBytes,proto3" json:"inline_bytes,omitempty"`
+}
+
+func (m *DataSource) Reset()         { *m = DataSource{} }
+func (m *DataSource) String() string { return proto.CompactTextString(m) }
+func (*DataSource) ProtoMessage()    {}
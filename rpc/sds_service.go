@@ -0,0 +1,139 @@
+package rpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// SDSServiceName is the full name of the Envoy v3 SecretDiscoveryService.
+const SDSServiceName = "envoy.service.secret.v3.SecretDiscoveryService"
+
+// SecretDiscoveryServiceServer is the server API of the Envoy v3
+// SecretDiscoveryService. The incremental DeltaSecrets method is not
+// implemented.
+type SecretDiscoveryServiceServer interface {
+	StreamSecrets(SDSStream) error
+	FetchSecrets(context.Context, *DiscoveryRequest) (*DiscoveryResponse, error)
+}
+
+// SDSStream is the server side of a StreamSecrets stream.
+type SDSStream interface {
+	Send(*DiscoveryResponse) error
+	Recv() (*DiscoveryRequest, error)
+	grpc.ServerStream
+}
+
+// RegisterSecretDiscoveryServiceServer registers the given implementation of
+// the SecretDiscoveryService in the gRPC server.
+func RegisterSecretDiscoveryServiceServer(s *grpc.Server, srv SecretDiscoveryServiceServer) {
+	s.RegisterService(&sdsServiceDesc, srv)
+}
+
+var sdsServiceDesc = grpc.ServiceDesc{
+	ServiceName: SDSServiceName,
+	HandlerType: (*SecretDiscoveryServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "FetchSecrets",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := new(DiscoveryRequest)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(SecretDiscoveryServiceServer).FetchSecrets(ctx, req)
+				}
+				info := &grpc.UnaryServerInfo{
+					Server:     srv,
+					FullMethod: "/" + SDSServiceName + "/FetchSecrets",
+				}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(SecretDiscoveryServiceServer).FetchSecrets(ctx, req.(*DiscoveryRequest))
+				}
+				return interceptor(ctx, req, info, handler)
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "StreamSecrets",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				return srv.(SecretDiscoveryServiceServer).StreamSecrets(&sdsStream{stream})
+			},
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "envoy/service/secret/v3/sds.proto",
+}
+
+type sdsStream struct {
+	grpc.ServerStream
+}
+
+func (s *sdsStream) Send(m *DiscoveryResponse) error {
+	return s.ServerStream.SendMsg(m)
+}
+
+func (s *sdsStream) Recv() (*DiscoveryRequest, error) {
+	m := new(DiscoveryRequest)
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// SDSClient is a client of the SecretDiscoveryService.
+type SDSClient struct {
+	cc *grpc.ClientConn
+}
+
+// NewSDSClient creates a SecretDiscoveryService client that uses the given
+// connection. The connection must use a client certificate issued by the CA to
+// get certificates.
+func NewSDSClient(cc *grpc.ClientConn) *SDSClient {
+	return &SDSClient{cc: cc}
+}
+
+// FetchSecrets returns the requested secrets.
+func (c *SDSClient) FetchSecrets(ctx context.Context, in *DiscoveryRequest, opts ...grpc.CallOption) (*DiscoveryResponse, error) {
+	out := new(DiscoveryResponse)
+	if err := c.cc.Invoke(ctx, "/"+SDSServiceName+"/FetchSecrets", in, out, opts...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// StreamSecrets opens a stream that sends the requested secrets and their
+// updates.
+func (c *SDSClient) StreamSecrets(ctx context.Context, opts ...grpc.CallOption) (SDSClientStream, error) {
+	stream, err := c.cc.NewStream(ctx, &sdsServiceDesc.Streams[0], "/"+SDSServiceName+"/StreamSecrets", opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &sdsClientStream{stream}, nil
+}
+
+// SDSClientStream is the client side of a StreamSecrets stream.
+type SDSClientStream interface {
+	Send(*DiscoveryRequest) error
+	Recv() (*DiscoveryResponse, error)
+	grpc.ClientStream
+}
+
+type sdsClientStream struct {
+	grpc.ClientStream
+}
+
+func (s *sdsClientStream) Send(m *DiscoveryRequest) error {
+	return s.ClientStream.SendMsg(m)
+}
+
+func (s *sdsClientStream) Recv() (*DiscoveryResponse, error) {
+	m := new(DiscoveryResponse)
+	if err := s.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
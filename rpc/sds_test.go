@@ -0,0 +1,239 @@
+package rpc
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/internal/certutil"
+	"github.com/golang/protobuf/proto"
+	"github.com/smallstep/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newSDSAuthority(t *testing.T, roots []*x509.Certificate, ca *x509.Certificate) *mockAuthority {
+	return &mockAuthority{
+		mintToken: func(opts authority.MintOptions) (string, error) {
+			assert.Equals(t, "sds", opts.Provisioner)
+			return "ott:" + opts.Subject, nil
+		},
+		authorize: func(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+			assert.Equals(t, provisioner.SignMethod, provisioner.MethodFromContext(ctx))
+			return []provisioner.SignOption{}, nil
+		},
+		sign: func(cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+			crt, _ := generateCertificate(t, cr.Subject.CommonName)
+			return []*x509.Certificate{crt, ca}, nil
+		},
+		getRoots: func() ([]*x509.Certificate, error) {
+			return roots, nil
+		},
+	}
+}
+
+func decodeSecrets(t *testing.T, res *DiscoveryResponse) []*Secret {
+	assert.Equals(t, SecretTypeURL, res.TypeURL)
+	secrets := make([]*Secret, len(res.Resources))
+	for i, r := range res.Resources {
+		assert.Equals(t, SecretTypeURL, r.TypeUrl)
+		secrets[i] = new(Secret)
+		assert.FatalError(t, proto.Unmarshal(r.Value, secrets[i]))
+	}
+	return secrets
+}
+
+func TestSDSServer_FetchSecrets(t *testing.T) {
+	crt, _ := generateCertificate(t, "test.smallstep.com")
+	root, _ := generateCertificate(t, "Root CA")
+	ca, _ := generateCertificate(t, "Intermediate CA")
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		req      *DiscoveryRequest
+		auth     func(m *mockAuthority)
+		wantCN   string
+		wantCode codes.Code
+	}{
+		{"ok-default", peerContext(crt), &DiscoveryRequest{ResourceNames: []string{"default"}, TypeURL: SecretTypeURL}, nil, "test.smallstep.com", codes.OK},
+		{"ok-san", peerContext(crt), &DiscoveryRequest{ResourceNames: []string{"test.smallstep.com"}}, nil, "test.smallstep.com", codes.OK},
+		{"ok-roots", context.Background(), &DiscoveryRequest{ResourceNames: []string{"ROOTCA"}}, nil, "", codes.OK},
+		{"fail-type", peerContext(crt), &DiscoveryRequest{ResourceNames: []string{"default"}, TypeURL: "foo"}, nil, "", codes.InvalidArgument},
+		{"fail-no-peer", context.Background(), &DiscoveryRequest{ResourceNames: []string{"default"}}, nil, "", codes.Unauthenticated},
+		{"fail-san", peerContext(crt), &DiscoveryRequest{ResourceNames: []string{"other.smallstep.com"}}, nil, "", codes.PermissionDenied},
+		{"fail-mint", peerContext(crt), &DiscoveryRequest{ResourceNames: []string{"default"}}, func(m *mockAuthority) {
+			m.mintToken = func(opts authority.MintOptions) (string, error) {
+				return "", fmt.Errorf("an error")
+			}
+		}, "", codes.Internal},
+		{"fail-sign", peerContext(crt), &DiscoveryRequest{ResourceNames: []string{"default"}}, func(m *mockAuthority) {
+			m.sign = func(cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+				return nil, fmt.Errorf("an error")
+			}
+		}, "", codes.PermissionDenied},
+		{"fail-roots", context.Background(), &DiscoveryRequest{ResourceNames: []string{"ROOTCA"}}, func(m *mockAuthority) {
+			m.getRoots = func() ([]*x509.Certificate, error) {
+				return nil, fmt.Errorf("an error")
+			}
+		}, "", codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := newSDSAuthority(t, []*x509.Certificate{root}, ca)
+			if tt.auth != nil {
+				tt.auth(auth)
+			}
+			s := NewSDS(auth, SDSOptions{Provisioner: "sds", CertDuration: time.Hour})
+			res, err := s.FetchSecrets(tt.ctx, tt.req)
+			assert.Equals(t, tt.wantCode, status.Code(err))
+			if err != nil {
+				assert.Nil(t, res)
+				return
+			}
+
+			secrets := decodeSecrets(t, res)
+			assert.Len(t, 1, secrets)
+			assert.Equals(t, tt.req.ResourceNames[0], secrets[0].Name)
+			if tt.wantCN == "" {
+				assert.Equals(t, certutil.EncodeCertificates([]*x509.Certificate{root}), secrets[0].ValidationContext.TrustedCA.InlineBytes)
+				return
+			}
+			block, rest := pem.Decode(secrets[0].TLSCertificate.CertificateChain.InlineBytes)
+			leaf, err := x509.ParseCertificate(block.Bytes)
+			assert.FatalError(t, err)
+			assert.Equals(t, tt.wantCN, leaf.Subject.CommonName)
+			block, _ = pem.Decode(rest)
+			assert.Equals(t, ca.Raw, block.Bytes)
+			block, _ = pem.Decode(secrets[0].TLSCertificate.PrivateKey.InlineBytes)
+			_, err = x509.ParseECPrivateKey(block.Bytes)
+			assert.FatalError(t, err)
+		})
+	}
+}
+
+func Test_sdsIdentity(t *testing.T) {
+	crt, _ := generateCertificate(t, "test.smallstep.com")
+	noCN, _ := generateCertificate(t, "")
+	noCN.DNSNames = []string{"foo.smallstep.com"}
+	noSANs, _ := generateCertificate(t, "bar")
+	noSANs.DNSNames = nil
+
+	tests := []struct {
+		name        string
+		crt         *x509.Certificate
+		secret      string
+		wantSubject string
+		wantSANs    []string
+		wantErr     bool
+	}{
+		{"ok-default", crt, "default", "test.smallstep.com", []string{"test.smallstep.com"}, false},
+		{"ok-default-no-cn", noCN, "default", "foo.smallstep.com", []string{"foo.smallstep.com"}, false},
+		{"ok-san", crt, "test.smallstep.com", "test.smallstep.com", []string{"test.smallstep.com"}, false},
+		{"fail-no-sans", noSANs, "default", "", nil, true},
+		{"fail-san", crt, "foo.smallstep.com", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subject, sans, err := sdsIdentity(tt.crt, tt.secret)
+			assert.Equals(t, tt.wantErr, err != nil)
+			assert.Equals(t, tt.wantSubject, subject)
+			assert.Equals(t, tt.wantSANs, sans)
+		})
+	}
+}
+
+type mockSDSStream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	requests  chan *DiscoveryRequest
+	responses chan *DiscoveryResponse
+}
+
+func (s *mockSDSStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *mockSDSStream) Send(res *DiscoveryResponse) error {
+	select {
+	case s.responses <- res:
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+func (s *mockSDSStream) Recv() (*DiscoveryRequest, error) {
+	req, ok := <-s.requests
+	if !ok {
+		return nil, io.EOF
+	}
+	return req, nil
+}
+
+func TestSDSServer_StreamSecrets(t *testing.T) {
+	crt, _ := generateCertificate(t, "test.smallstep.com")
+	root, _ := generateCertificate(t, "Root CA")
+	ca, _ := generateCertificate(t, "Intermediate CA")
+
+	var signed int
+	auth := newSDSAuthority(t, []*x509.Certificate{root}, ca)
+	auth.sign = func(cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+		signed++
+		// The certificates are valid for 3s from the start of the current
+		// second, so they are rotated in at most 2s.
+		leaf, _ := generateCertificate(t, cr.Subject.CommonName)
+		leaf.NotBefore = time.Now().Truncate(time.Second)
+		leaf.NotAfter = leaf.NotBefore.Add(3 * time.Second)
+		return []*x509.Certificate{leaf, ca}, nil
+	}
+
+	ctx, cancel := context.WithCancel(peerContext(crt))
+	defer cancel()
+	stream := &mockSDSStream{
+		ctx:       ctx,
+		requests:  make(chan *DiscoveryRequest),
+		responses: make(chan *DiscoveryResponse),
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- NewSDS(auth, SDSOptions{Provisioner: "sds"}).StreamSecrets(stream)
+	}()
+
+	// Initial request.
+	stream.requests <- &DiscoveryRequest{ResourceNames: []string{"default", "ROOTCA"}, TypeURL: SecretTypeURL}
+	res := <-stream.responses
+	secrets := decodeSecrets(t, res)
+	assert.Len(t, 2, secrets)
+	assert.Equals(t, "default", secrets[0].Name)
+	assert.NotNil(t, secrets[0].TLSCertificate)
+	assert.Equals(t, "ROOTCA", secrets[1].Name)
+	assert.NotNil(t, secrets[1].ValidationContext)
+
+	// The acknowledgment does not get a response, the rotation does.
+	stream.requests <- &DiscoveryRequest{ResourceNames: []string{"default", "ROOTCA"}, ResponseNonce: res.Nonce, VersionInfo: res.VersionInfo}
+	select {
+	case res = <-stream.responses:
+		assert.Equals(t, 2, signed)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for rotation")
+	}
+
+	// Replies to old responses are ignored, new names get a response.
+	stream.requests <- &DiscoveryRequest{ResourceNames: []string{"ROOTCA"}, ResponseNonce: "old"}
+	stream.requests <- &DiscoveryRequest{ResourceNames: []string{"ROOTCA"}, ResponseNonce: res.Nonce}
+	res = <-stream.responses
+	secrets = decodeSecrets(t, res)
+	assert.Len(t, 1, secrets)
+	assert.Equals(t, "ROOTCA", secrets[0].Name)
+
+	close(stream.requests)
+	assert.FatalError(t, <-done)
+}
@@ -0,0 +1,340 @@
+package rpc
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/api"
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/RTradeLtd/ca-certificates/logging"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Authority is the interface implemented by the CA authority used by the gRPC
+// server.
+type Authority interface {
+	Authorize(ctx context.Context, ott string) ([]provisioner.SignOption, error)
+	Sign(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
+	Renew(ctx context.Context, peer *x509.Certificate) ([]*x509.Certificate, error)
+	RenewAfter(crt *x509.Certificate) time.Time
+	Revoke(context.Context, *authority.RevokeOptions) error
+	SignSSH(ctx context.Context, key ssh.PublicKey, opts provisioner.SSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error)
+	SignSSHAddUser(ctx context.Context, key ssh.PublicKey, cert *ssh.Certificate) (*ssh.Certificate, error)
+	GetRoots() ([]*x509.Certificate, error)
+	GetProvisioners(cursor string, limit int) (provisioner.List, string, error)
+	IsApprovalRequired(signOpts []provisioner.SignOption) bool
+	CreatePendingRequest(cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) (*authority.PendingRequest, error)
+}
+
+// Server implements the CertificateAuthority service using the same authority
+// as the HTTP API.
+type Server struct {
+	mutex sync.RWMutex
+	auth  Authority
+}
+
+// New creates a new Server with the given authority.
+func New(auth Authority) *Server {
+	return &Server{auth: auth}
+}
+
+// SetAuthority replaces the authority used by the server, it is used when the
+// CA configuration is reloaded.
+func (s *Server) SetAuthority(auth Authority) {
+	s.mutex.Lock()
+	s.auth = auth
+	s.mutex.Unlock()
+}
+
+func (s *Server) authority() Authority {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.auth
+}
+
+// Sign creates a new X.509 certificate using the CSR and one-time token in the
+// request. If the request requires the approval of an admin, the response
+// contains the id of the pending request instead of the certificates.
+func (s *Server) Sign(ctx context.Context, req *SignRequest) (*SignResponse, error) {
+	cr, err := x509.ParseCertificateRequest(req.CSR)
+	if err != nil {
+		return nil, toStatusError("Sign", api.BadRequest(errors.Wrap(err, "error parsing csr")))
+	}
+	body := api.SignRequest{
+		CsrPEM: api.CertificateRequest{CertificateRequest: cr},
+		OTT:    req.OTT,
+	}
+	if err := body.Validate(); err != nil {
+		return nil, toStatusError("Sign", err)
+	}
+
+	var opts provisioner.Options
+	if opts.NotBefore, err = provisioner.ParseTimeDuration(req.NotBefore); err != nil {
+		return nil, toStatusError("Sign", api.BadRequest(errors.Wrap(err, "error parsing notBefore")))
+	}
+	if opts.NotAfter, err = provisioner.ParseTimeDuration(req.NotAfter); err != nil {
+		return nil, toStatusError("Sign", api.BadRequest(errors.Wrap(err, "error parsing notAfter")))
+	}
+
+	auth := s.authority()
+	signOpts, err := auth.Authorize(provisioner.NewContextWithMethod(ctx, provisioner.SignMethod), req.OTT)
+	if err != nil {
+		return nil, toStatusError("Sign", api.Unauthorized(err))
+	}
+
+	// Queue the request if an admin must approve it.
+	if auth.IsApprovalRequired(signOpts) {
+		pr, err := auth.CreatePendingRequest(cr, opts, signOpts...)
+		if err != nil {
+			return nil, toStatusError("Sign", api.Forbidden(err))
+		}
+		return &SignResponse{
+			PendingID:     pr.ID,
+			PendingStatus: string(pr.Status),
+		}, nil
+	}
+
+	certChain, err := auth.Sign(withRemoteAddress(ctx), cr, opts, signOpts...)
+	if err != nil {
+		return nil, toStatusError("Sign", api.Forbidden(err))
+	}
+	return newSignResponse(auth, certChain), nil
+}
+
+// Renew renews the client certificate presented in the mTLS handshake.
+func (s *Server) Renew(ctx context.Context, req *RenewRequest) (*SignResponse, error) {
+	crt, err := peerCertificate(ctx)
+	if err != nil {
+		return nil, toStatusError("Renew", err)
+	}
+	auth := s.authority()
+	ctx = authority.NewContextWithRenewalKey(ctx, crt.PublicKey)
+	certChain, err := auth.Renew(withRemoteAddress(ctx), crt)
+	if err != nil {
+		return nil, toStatusError("Renew", api.Forbidden(err))
+	}
+	return newSignResponse(auth, certChain), nil
+}
+
+// Revoke revokes a certificate. If the request does not have a one-time token
+// the certificate to revoke must be the client certificate presented in the
+// mTLS handshake.
+func (s *Server) Revoke(ctx context.Context, req *RevokeRequest) (*RevokeResponse, error) {
+	body := api.RevokeRequest{
+		Serial:     req.Serial,
+		OTT:        req.OTT,
+		ReasonCode: int(req.ReasonCode),
+		Reason:     req.Reason,
+		Passive:    req.Passive,
+	}
+	if err := body.Validate(); err != nil {
+		return nil, toStatusError("Revoke", err)
+	}
+
+	opts := &authority.RevokeOptions{
+		Serial:      body.Serial,
+		Reason:      body.Reason,
+		ReasonCode:  body.ReasonCode,
+		PassiveOnly: body.Passive,
+	}
+	if len(body.OTT) > 0 {
+		opts.OTT = body.OTT
+	} else {
+		crt, err := peerCertificate(ctx)
+		if err != nil {
+			return nil, toStatusError("Revoke", api.BadRequest(errors.New("missing ott or peer certificate")))
+		}
+		opts.Crt = crt
+		opts.MTLS = true
+	}
+
+	if err := s.authority().Revoke(withRemoteAddress(ctx), opts); err != nil {
+		return nil, toStatusError("Revoke", api.Forbidden(err))
+	}
+	return &RevokeResponse{Status: "ok"}, nil
+}
+
+// SignSSH creates a new SSH certificate using the public key and one-time token
+// in the request.
+func (s *Server) SignSSH(ctx context.Context, req *SignSSHRequest) (*SignSSHResponse, error) {
+	body := api.SignSSHRequest{
+		PublicKey:        req.PublicKey,
+		OTT:              req.OTT,
+		CertType:         req.CertType,
+		Principals:       req.Principals,
+		AddUserPublicKey: req.AddUserPublicKey,
+	}
+	if err := body.Validate(); err != nil {
+		return nil, toStatusError("SignSSH", api.BadRequest(err))
+	}
+
+	publicKey, err := ssh.ParsePublicKey(body.PublicKey)
+	if err != nil {
+		return nil, toStatusError("SignSSH", api.BadRequest(errors.Wrap(err, "error parsing publicKey")))
+	}
+	var addUserPublicKey ssh.PublicKey
+	if len(body.AddUserPublicKey) > 0 {
+		if addUserPublicKey, err = ssh.ParsePublicKey(body.AddUserPublicKey); err != nil {
+			return nil, toStatusError("SignSSH", api.BadRequest(errors.Wrap(err, "error parsing addUserPublicKey")))
+		}
+	}
+
+	opts := provisioner.SSHOptions{
+		CertType:   body.CertType,
+		Principals: body.Principals,
+	}
+	if opts.ValidAfter, err = provisioner.ParseTimeDuration(req.ValidAfter); err != nil {
+		return nil, toStatusError("SignSSH", api.BadRequest(errors.Wrap(err, "error parsing validAfter")))
+	}
+	if opts.ValidBefore, err = provisioner.ParseTimeDuration(req.ValidBefore); err != nil {
+		return nil, toStatusError("SignSSH", api.BadRequest(errors.Wrap(err, "error parsing validBefore")))
+	}
+
+	auth := s.authority()
+	signOpts, err := auth.Authorize(provisioner.NewContextWithMethod(ctx, provisioner.SignSSHMethod), body.OTT)
+	if err != nil {
+		return nil, toStatusError("SignSSH", api.Unauthorized(err))
+	}
+	cert, err := auth.SignSSH(ctx, publicKey, opts, signOpts...)
+	if err != nil {
+		return nil, toStatusError("SignSSH", api.Forbidden(err))
+	}
+
+	res := &SignSSHResponse{Certificate: cert.Marshal()}
+	if addUserPublicKey != nil && cert.CertType == ssh.UserCert && len(cert.ValidPrincipals) == 1 {
+		addUserCert, err := auth.SignSSHAddUser(ctx, addUserPublicKey, cert)
+		if err != nil {
+			return nil, toStatusError("SignSSH", api.Forbidden(err))
+		}
+		res.AddUserCertificate = addUserCert.Marshal()
+	}
+	return res, nil
+}
+
+// Roots returns the root certificates of the CA.
+func (s *Server) Roots(ctx context.Context, req *RootsRequest) (*RootsResponse, error) {
+	roots, err := s.authority().GetRoots()
+	if err != nil {
+		return nil, toStatusError("Roots", api.Forbidden(err))
+	}
+	res := &RootsResponse{
+		Certificates: make([][]byte, len(roots)),
+	}
+	for i, crt := range roots {
+		res.Certificates[i] = crt.Raw
+	}
+	return res, nil
+}
+
+// Provisioners returns a page of the configured provisioners.
+func (s *Server) Provisioners(ctx context.Context, req *ProvisionersRequest) (*ProvisionersResponse, error) {
+	list, next, err := s.authority().GetProvisioners(req.Cursor, int(req.Limit))
+	if err != nil {
+		return nil, toStatusError("Provisioners", api.InternalServerError(err))
+	}
+	res := &ProvisionersResponse{
+		Provisioners: make([]*Provisioner, len(list)),
+		NextCursor:   next,
+	}
+	for i, p := range list {
+		b, err := json.Marshal(p)
+		if err != nil {
+			return nil, toStatusError("Provisioners", api.InternalServerError(errors.Wrap(err, "error marshaling provisioner")))
+		}
+		res.Provisioners[i] = &Provisioner{
+			ID:   p.GetID(),
+			Name: p.GetName(),
+			Type: p.GetType().String(),
+			JSON: b,
+		}
+	}
+	return res, nil
+}
+
+// newSignResponse returns the SignResponse for the given certificate chain,
+// with the time the certificate should be renewed.
+func newSignResponse(auth Authority, certChain []*x509.Certificate) *SignResponse {
+	res := &SignResponse{
+		CertChain: make([][]byte, len(certChain)),
+	}
+	for i, crt := range certChain {
+		res.CertChain[i] = crt.Raw
+	}
+	if len(certChain) > 0 {
+		res.Certificate = certChain[0].Raw
+		if renewAfter := auth.RenewAfter(certChain[0]); !renewAfter.IsZero() {
+			res.RenewAfter = renewAfter.UTC().Format(time.RFC3339)
+		}
+	}
+	if len(certChain) > 1 {
+		res.CA = certChain[1].Raw
+	}
+	return res
+}
+
+// withRemoteAddress returns a new context with the IP address of the client
+// of the connection, used in the audit log.
+func withRemoteAddress(ctx context.Context) context.Context {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ctx
+	}
+	addr, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		addr = p.Addr.String()
+	}
+	return logging.WithRemoteAddress(ctx, addr)
+}
+
+// peerCertificate returns the client certificate presented in the mTLS
+// handshake of the connection.
+func peerCertificate(ctx context.Context) (*x509.Certificate, error) {
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.PeerCertificates) > 0 {
+			return info.State.PeerCertificates[0], nil
+		}
+	}
+	return nil, api.BadRequest(errors.New("missing peer certificate"))
+}
+
+// toStatusError logs the given error and converts it to a gRPC status error.
+// As in the HTTP API, the details of the error are not sent to the client, the
+// message of the status is the text of the equivalent HTTP status code.
+func toStatusError(method string, err error) error {
+	code := http.StatusInternalServerError
+	if sc, ok := err.(api.StatusCoder); ok {
+		code = sc.StatusCode()
+	}
+	log.Printf("grpc: %s: %v", method, err)
+	return status.Error(grpcCode(code), http.StatusText(code))
+}
+
+// grpcCode returns the gRPC code equivalent to the given HTTP status code.
+func grpcCode(code int) codes.Code {
+	switch code {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	default:
+		return codes.Internal
+	}
+}
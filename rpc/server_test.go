@@ -0,0 +1,478 @@
+package rpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/api"
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/smallstep/assert"
+	"golang.org/x/crypto/ssh"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type mockAuthority struct {
+	ret1, ret2           interface{}
+	err                  error
+	authorize            func(ctx context.Context, ott string) ([]provisioner.SignOption, error)
+	sign                 func(cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
+	renew                func(cert *x509.Certificate) ([]*x509.Certificate, error)
+	renewAfter           func(cert *x509.Certificate) time.Time
+	revoke               func(*authority.RevokeOptions) error
+	signSSH              func(key ssh.PublicKey, opts provisioner.SSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error)
+	signSSHAddUser       func(key ssh.PublicKey, cert *ssh.Certificate) (*ssh.Certificate, error)
+	getRoots             func() ([]*x509.Certificate, error)
+	getProvisioners      func(nextCursor string, limit int) (provisioner.List, string, error)
+	isApprovalRequired   func(signOpts []provisioner.SignOption) bool
+	createPendingRequest func(cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) (*authority.PendingRequest, error)
+	mintToken            func(opts authority.MintOptions) (string, error)
+}
+
+func (m *mockAuthority) MintToken(opts authority.MintOptions) (string, error) {
+	if m.mintToken != nil {
+		return m.mintToken(opts)
+	}
+	return m.ret1.(string), m.err
+}
+
+func (m *mockAuthority) Authorize(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+	if m.authorize != nil {
+		return m.authorize(ctx, ott)
+	}
+	return m.ret1.([]provisioner.SignOption), m.err
+}
+
+func (m *mockAuthority) Sign(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+	if m.sign != nil {
+		return m.sign(cr, opts, signOpts...)
+	}
+	return m.ret1.([]*x509.Certificate), m.err
+}
+
+func (m *mockAuthority) RenewAfter(cert *x509.Certificate) time.Time {
+	if m.renewAfter != nil {
+		return m.renewAfter(cert)
+	}
+	return time.Time{}
+}
+
+func (m *mockAuthority) Renew(ctx context.Context, cert *x509.Certificate) ([]*x509.Certificate, error) {
+	if m.renew != nil {
+		return m.renew(cert)
+	}
+	return m.ret1.([]*x509.Certificate), m.err
+}
+
+func (m *mockAuthority) Revoke(ctx context.Context, opts *authority.RevokeOptions) error {
+	if m.revoke != nil {
+		return m.revoke(opts)
+	}
+	return m.err
+}
+
+func (m *mockAuthority) SignSSH(ctx context.Context, key ssh.PublicKey, opts provisioner.SSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
+	if m.signSSH != nil {
+		return m.signSSH(key, opts, signOpts...)
+	}
+	return m.ret1.(*ssh.Certificate), m.err
+}
+
+func (m *mockAuthority) SignSSHAddUser(ctx context.Context, key ssh.PublicKey, cert *ssh.Certificate) (*ssh.Certificate, error) {
+	if m.signSSHAddUser != nil {
+		return m.signSSHAddUser(key, cert)
+	}
+	return m.ret1.(*ssh.Certificate), m.err
+}
+
+func (m *mockAuthority) GetRoots() ([]*x509.Certificate, error) {
+	if m.getRoots != nil {
+		return m.getRoots()
+	}
+	return m.ret1.([]*x509.Certificate), m.err
+}
+
+func (m *mockAuthority) GetProvisioners(nextCursor string, limit int) (provisioner.List, string, error) {
+	if m.getProvisioners != nil {
+		return m.getProvisioners(nextCursor, limit)
+	}
+	return m.ret1.(provisioner.List), m.ret2.(string), m.err
+}
+
+func (m *mockAuthority) IsApprovalRequired(signOpts []provisioner.SignOption) bool {
+	if m.isApprovalRequired != nil {
+		return m.isApprovalRequired(signOpts)
+	}
+	return false
+}
+
+func (m *mockAuthority) CreatePendingRequest(cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) (*authority.PendingRequest, error) {
+	if m.createPendingRequest != nil {
+		return m.createPendingRequest(cr, opts, signOpts...)
+	}
+	return m.ret1.(*authority.PendingRequest), m.err
+}
+
+func generateCertificate(t *testing.T, cn string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(now.UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		NotBefore:    now,
+		NotAfter:     now.Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	assert.FatalError(t, err)
+	crt, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+	return crt, key
+}
+
+func generateCSR(t *testing.T, cn string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: cn},
+		DNSNames: []string{cn},
+	}, key)
+	assert.FatalError(t, err)
+	return der
+}
+
+func generateSSHCertificate(t *testing.T, certType uint32, principals ...string) (ssh.PublicKey, *ssh.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	pub, err := ssh.NewPublicKey(key.Public())
+	assert.FatalError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	assert.FatalError(t, err)
+	cert := &ssh.Certificate{
+		Key:             pub,
+		CertType:        certType,
+		ValidPrincipals: principals,
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	assert.FatalError(t, cert.SignCert(rand.Reader, signer))
+	return pub, cert
+}
+
+func peerContext(crt *x509.Certificate) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{PeerCertificates: []*x509.Certificate{crt}},
+		},
+	})
+}
+
+func TestServer_Sign(t *testing.T) {
+	crt, _ := generateCertificate(t, "test.smallstep.com")
+	ca, _ := generateCertificate(t, "Intermediate CA")
+	csr := generateCSR(t, "test.smallstep.com")
+
+	tests := []struct {
+		name     string
+		req      *SignRequest
+		auth     *mockAuthority
+		pending  bool
+		wantCode codes.Code
+	}{
+		{"ok", &SignRequest{CSR: csr, OTT: "ott", NotAfter: "1h"}, &mockAuthority{ret1: []*x509.Certificate{crt, ca}}, false, codes.OK},
+		{"ok-pending", &SignRequest{CSR: csr, OTT: "ott"}, &mockAuthority{
+			ret1:               &authority.PendingRequest{ID: "pending-id", Status: authority.StatusPending},
+			isApprovalRequired: func(signOpts []provisioner.SignOption) bool { return true },
+			authorize: func(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+				return []provisioner.SignOption{}, nil
+			},
+		}, true, codes.OK},
+		{"fail-csr", &SignRequest{CSR: []byte("foo"), OTT: "ott"}, &mockAuthority{}, false, codes.InvalidArgument},
+		{"fail-ott", &SignRequest{CSR: csr}, &mockAuthority{}, false, codes.InvalidArgument},
+		{"fail-notBefore", &SignRequest{CSR: csr, OTT: "ott", NotBefore: "foo"}, &mockAuthority{}, false, codes.InvalidArgument},
+		{"fail-authorize", &SignRequest{CSR: csr, OTT: "ott"}, &mockAuthority{
+			authorize: func(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+				return nil, fmt.Errorf("an error")
+			},
+		}, false, codes.Unauthenticated},
+		{"fail-sign", &SignRequest{CSR: csr, OTT: "ott"}, &mockAuthority{ret1: []*x509.Certificate{}, err: fmt.Errorf("an error")}, false, codes.PermissionDenied},
+		{"fail-sign-status", &SignRequest{CSR: csr, OTT: "ott"}, &mockAuthority{ret1: []*x509.Certificate{}, err: api.NotImplemented(fmt.Errorf("an error"))}, false, codes.Unimplemented},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.auth.authorize == nil {
+				tt.auth.authorize = func(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+					assert.Equals(t, provisioner.SignMethod, provisioner.MethodFromContext(ctx))
+					assert.Equals(t, "ott", ott)
+					return []provisioner.SignOption{}, nil
+				}
+			}
+			res, err := New(tt.auth).Sign(context.Background(), tt.req)
+			assert.Equals(t, tt.wantCode, status.Code(err))
+			switch {
+			case err != nil:
+				assert.Nil(t, res)
+			case tt.pending:
+				assert.Equals(t, &SignResponse{PendingID: "pending-id", PendingStatus: "pending"}, res)
+			default:
+				assert.Equals(t, crt.Raw, res.Certificate)
+				assert.Equals(t, ca.Raw, res.CA)
+				assert.Equals(t, [][]byte{crt.Raw, ca.Raw}, res.CertChain)
+			}
+		})
+	}
+}
+
+func TestServer_Renew(t *testing.T) {
+	crt, _ := generateCertificate(t, "test.smallstep.com")
+	ca, _ := generateCertificate(t, "Intermediate CA")
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		err      error
+		wantCode codes.Code
+	}{
+		{"ok", peerContext(crt), nil, codes.OK},
+		{"fail-no-peer", context.Background(), nil, codes.InvalidArgument},
+		{"fail-renew", peerContext(crt), fmt.Errorf("an error"), codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(&mockAuthority{
+				renew: func(cert *x509.Certificate) ([]*x509.Certificate, error) {
+					assert.Equals(t, crt, cert)
+					return []*x509.Certificate{crt, ca}, tt.err
+				},
+				renewAfter: func(cert *x509.Certificate) time.Time {
+					assert.Equals(t, crt, cert)
+					return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+				},
+			})
+			res, err := s.Renew(tt.ctx, &RenewRequest{})
+			assert.Equals(t, tt.wantCode, status.Code(err))
+			if err == nil {
+				assert.Equals(t, crt.Raw, res.Certificate)
+				assert.Equals(t, ca.Raw, res.CA)
+				assert.Equals(t, "2020-01-02T03:04:05Z", res.RenewAfter)
+			}
+		})
+	}
+}
+
+func TestServer_Revoke(t *testing.T) {
+	crt, _ := generateCertificate(t, "test.smallstep.com")
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		req      *RevokeRequest
+		mtls     bool
+		err      error
+		wantCode codes.Code
+	}{
+		{"ok-ott", context.Background(), &RevokeRequest{Serial: "1234", OTT: "ott", ReasonCode: 1, Reason: "foo", Passive: true}, false, nil, codes.OK},
+		{"ok-mtls", peerContext(crt), &RevokeRequest{Serial: "1234", ReasonCode: 1, Reason: "foo", Passive: true}, true, nil, codes.OK},
+		{"fail-serial", context.Background(), &RevokeRequest{OTT: "ott", Passive: true}, false, nil, codes.InvalidArgument},
+		{"fail-non-passive", context.Background(), &RevokeRequest{Serial: "1234", OTT: "ott"}, false, nil, codes.Unimplemented},
+		{"fail-no-peer", context.Background(), &RevokeRequest{Serial: "1234", Passive: true}, false, nil, codes.InvalidArgument},
+		{"fail-revoke", context.Background(), &RevokeRequest{Serial: "1234", OTT: "ott", ReasonCode: 1, Reason: "foo", Passive: true}, false, fmt.Errorf("an error"), codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(&mockAuthority{
+				revoke: func(opts *authority.RevokeOptions) error {
+					assert.Equals(t, "1234", opts.Serial)
+					assert.Equals(t, 1, opts.ReasonCode)
+					assert.Equals(t, "foo", opts.Reason)
+					assert.True(t, opts.PassiveOnly)
+					assert.Equals(t, tt.mtls, opts.MTLS)
+					if tt.mtls {
+						assert.Equals(t, crt, opts.Crt)
+						assert.Equals(t, "", opts.OTT)
+					} else {
+						assert.Equals(t, "ott", opts.OTT)
+					}
+					return tt.err
+				},
+			})
+			res, err := s.Revoke(tt.ctx, tt.req)
+			assert.Equals(t, tt.wantCode, status.Code(err))
+			if err == nil {
+				assert.Equals(t, &RevokeResponse{Status: "ok"}, res)
+			}
+		})
+	}
+}
+
+func TestServer_SignSSH(t *testing.T) {
+	userKey, userCert := generateSSHCertificate(t, ssh.UserCert, "user")
+	addUserKey, addUserCert := generateSSHCertificate(t, ssh.UserCert, "provisioner")
+	hostKey, hostCert := generateSSHCertificate(t, ssh.HostCert, "host.smallstep.com")
+
+	tests := []struct {
+		name        string
+		req         *SignSSHRequest
+		cert        *ssh.Certificate
+		authErr     error
+		signErr     error
+		wantAddUser bool
+		wantCode    codes.Code
+	}{
+		{"ok-user", &SignSSHRequest{PublicKey: userKey.Marshal(), OTT: "ott", CertType: "user", Principals: []string{"user"}, ValidBefore: "1h"}, userCert, nil, nil, false, codes.OK},
+		{"ok-add-user", &SignSSHRequest{PublicKey: userKey.Marshal(), OTT: "ott", AddUserPublicKey: addUserKey.Marshal()}, userCert, nil, nil, true, codes.OK},
+		{"ok-host", &SignSSHRequest{PublicKey: hostKey.Marshal(), OTT: "ott", CertType: "host", AddUserPublicKey: addUserKey.Marshal()}, hostCert, nil, nil, false, codes.OK},
+		{"fail-cert-type", &SignSSHRequest{PublicKey: userKey.Marshal(), OTT: "ott", CertType: "foo"}, nil, nil, nil, false, codes.InvalidArgument},
+		{"fail-public-key", &SignSSHRequest{PublicKey: []byte("foo"), OTT: "ott"}, nil, nil, nil, false, codes.InvalidArgument},
+		{"fail-add-user-public-key", &SignSSHRequest{PublicKey: userKey.Marshal(), OTT: "ott", AddUserPublicKey: []byte("foo")}, nil, nil, nil, false, codes.InvalidArgument},
+		{"fail-valid-after", &SignSSHRequest{PublicKey: userKey.Marshal(), OTT: "ott", ValidAfter: "foo"}, nil, nil, nil, false, codes.InvalidArgument},
+		{"fail-authorize", &SignSSHRequest{PublicKey: userKey.Marshal(), OTT: "ott"}, nil, fmt.Errorf("an error"), nil, false, codes.Unauthenticated},
+		{"fail-sign", &SignSSHRequest{PublicKey: userKey.Marshal(), OTT: "ott"}, nil, nil, fmt.Errorf("an error"), false, codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(&mockAuthority{
+				authorize: func(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+					assert.Equals(t, provisioner.SignSSHMethod, provisioner.MethodFromContext(ctx))
+					return []provisioner.SignOption{}, tt.authErr
+				},
+				signSSH: func(key ssh.PublicKey, opts provisioner.SSHOptions, signOpts ...provisioner.SignOption) (*ssh.Certificate, error) {
+					assert.Equals(t, tt.req.PublicKey, key.Marshal())
+					assert.Equals(t, tt.req.CertType, opts.CertType)
+					assert.Equals(t, tt.req.Principals, opts.Principals)
+					return tt.cert, tt.signErr
+				},
+				signSSHAddUser: func(key ssh.PublicKey, cert *ssh.Certificate) (*ssh.Certificate, error) {
+					assert.Equals(t, addUserKey.Marshal(), key.Marshal())
+					assert.Equals(t, tt.cert, cert)
+					return addUserCert, nil
+				},
+			})
+			res, err := s.SignSSH(context.Background(), tt.req)
+			assert.Equals(t, tt.wantCode, status.Code(err))
+			if err == nil {
+				assert.Equals(t, tt.cert.Marshal(), res.Certificate)
+				if tt.wantAddUser {
+					assert.Equals(t, addUserCert.Marshal(), res.AddUserCertificate)
+				} else {
+					assert.Len(t, 0, res.AddUserCertificate)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_Provisioners(t *testing.T) {
+	list := provisioner.List{
+		&provisioner.OIDC{Name: "google", Type: "OIDC", ClientID: "client-id"},
+	}
+	tests := []struct {
+		name     string
+		err      error
+		wantCode codes.Code
+	}{
+		{"ok", nil, codes.OK},
+		{"fail", fmt.Errorf("an error"), codes.Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(&mockAuthority{
+				getProvisioners: func(cursor string, limit int) (provisioner.List, string, error) {
+					assert.Equals(t, "cursor", cursor)
+					assert.Equals(t, 10, limit)
+					return list, "next", tt.err
+				},
+			})
+			res, err := s.Provisioners(context.Background(), &ProvisionersRequest{Cursor: "cursor", Limit: 10})
+			assert.Equals(t, tt.wantCode, status.Code(err))
+			if err == nil {
+				assert.Equals(t, "next", res.NextCursor)
+				if assert.Len(t, 1, res.Provisioners) {
+					p := res.Provisioners[0]
+					assert.Equals(t, "client-id", p.ID)
+					assert.Equals(t, "google", p.Name)
+					assert.Equals(t, "OIDC", p.Type)
+					assert.True(t, len(p.JSON) > 0)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_SetAuthority(t *testing.T) {
+	root1, _ := generateCertificate(t, "Root CA 1")
+	root2, _ := generateCertificate(t, "Root CA 2")
+	s := New(&mockAuthority{ret1: []*x509.Certificate{root1}})
+	res, err := s.Roots(context.Background(), &RootsRequest{})
+	assert.FatalError(t, err)
+	assert.Equals(t, [][]byte{root1.Raw}, res.Certificates)
+
+	s.SetAuthority(&mockAuthority{ret1: []*x509.Certificate{root2}})
+	res, err = s.Roots(context.Background(), &RootsRequest{})
+	assert.FatalError(t, err)
+	assert.Equals(t, [][]byte{root2.Raw}, res.Certificates)
+}
+
+func TestClient(t *testing.T) {
+	root, _ := generateCertificate(t, "Root CA")
+	crt, _ := generateCertificate(t, "test.smallstep.com")
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer()
+	RegisterCertificateAuthorityServer(srv, New(&mockAuthority{
+		getRoots: func() ([]*x509.Certificate, error) {
+			return []*x509.Certificate{root}, nil
+		},
+		authorize: func(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+			return []provisioner.SignOption{}, nil
+		},
+		sign: func(cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+			assert.Equals(t, "test.smallstep.com", cr.Subject.CommonName)
+			return []*x509.Certificate{crt, root}, nil
+		},
+		revoke: func(opts *authority.RevokeOptions) error {
+			return fmt.Errorf("an error")
+		},
+	}))
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	conn, err := grpc.Dial("bufnet", grpc.WithInsecure(), grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+		return lis.Dial()
+	}))
+	assert.FatalError(t, err)
+	defer conn.Close()
+	client := NewClient(conn)
+	ctx := context.Background()
+
+	roots, err := client.Roots(ctx, &RootsRequest{})
+	assert.FatalError(t, err)
+	assert.Equals(t, [][]byte{root.Raw}, roots.Certificates)
+
+	sign, err := client.Sign(ctx, &SignRequest{CSR: generateCSR(t, "test.smallstep.com"), OTT: "ott"})
+	assert.FatalError(t, err)
+	assert.Equals(t, crt.Raw, sign.Certificate)
+	assert.Equals(t, root.Raw, sign.CA)
+
+	_, err = client.Revoke(ctx, &RevokeRequest{Serial: "1234", OTT: "ott", Passive: true})
+	assert.Equals(t, codes.PermissionDenied, status.Code(err))
+
+	// Renew requires a TLS connection.
+	_, err = client.Renew(ctx, &RenewRequest{})
+	assert.Equals(t, codes.InvalidArgument, status.Code(err))
+}
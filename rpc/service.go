@@ -0,0 +1,159 @@
+package rpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// ServiceName is the full name of the CertificateAuthority service.
+const ServiceName = "ca.CertificateAuthority"
+
+// CertificateAuthorityServer is the server API of the CertificateAuthority
+// service defined in ca.proto.
+type CertificateAuthorityServer interface {
+	Sign(context.Context, *SignRequest) (*SignResponse, error)
+	Renew(context.Context, *RenewRequest) (*SignResponse, error)
+	Revoke(context.Context, *RevokeRequest) (*RevokeResponse, error)
+	SignSSH(context.Context, *SignSSHRequest) (*SignSSHResponse, error)
+	Roots(context.Context, *RootsRequest) (*RootsResponse, error)
+	Provisioners(context.Context, *ProvisionersRequest) (*ProvisionersResponse, error)
+}
+
+// RegisterCertificateAuthorityServer registers the given implementation of the
+// CertificateAuthority service in the gRPC server.
+func RegisterCertificateAuthorityServer(s *grpc.Server, srv CertificateAuthorityServer) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*CertificateAuthorityServer)(nil),
+	Methods: []grpc.MethodDesc{
+		newMethodDesc("Sign", func() interface{} { return new(SignRequest) },
+			func(srv CertificateAuthorityServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.Sign(ctx, req.(*SignRequest))
+			}),
+		newMethodDesc("Renew", func() interface{} { return new(RenewRequest) },
+			func(srv CertificateAuthorityServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.Renew(ctx, req.(*RenewRequest))
+			}),
+		newMethodDesc("Revoke", func() interface{} { return new(RevokeRequest) },
+			func(srv CertificateAuthorityServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.Revoke(ctx, req.(*RevokeRequest))
+			}),
+		newMethodDesc("SignSSH", func() interface{} { return new(SignSSHRequest) },
+			func(srv CertificateAuthorityServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.SignSSH(ctx, req.(*SignSSHRequest))
+			}),
+		newMethodDesc("Roots", func() interface{} { return new(RootsRequest) },
+			func(srv CertificateAuthorityServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.Roots(ctx, req.(*RootsRequest))
+			}),
+		newMethodDesc("Provisioners", func() interface{} { return new(ProvisionersRequest) },
+			func(srv CertificateAuthorityServer, ctx context.Context, req interface{}) (interface{}, error) {
+				return srv.Provisioners(ctx, req.(*ProvisionersRequest))
+			}),
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "ca.proto",
+}
+
+// newMethodDesc returns the description of a unary method that decodes the
+// request in the value returned by newRequest and calls the server using the
+// given function.
+func newMethodDesc(name string, newRequest func() interface{}, call func(CertificateAuthorityServer, context.Context, interface{}) (interface{}, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: name,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := newRequest()
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return call(srv.(CertificateAuthorityServer), ctx, req)
+			}
+			info := &grpc.UnaryServerInfo{
+				Server:     srv,
+				FullMethod: "/" + ServiceName + "/" + name,
+			}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return call(srv.(CertificateAuthorityServer), ctx, req)
+			}
+			return interceptor(ctx, req, info, handler)
+		},
+	}
+}
+
+// Client is a client of the CertificateAuthority service.
+type Client struct {
+	cc *grpc.ClientConn
+}
+
+// NewClient creates a CertificateAuthority client that uses the given
+// connection. The connection should use the transport credentials returned by
+// credentials.NewTLS with a configuration that trusts the CA roots, and a
+// client certificate if Renew or the mTLS version of Revoke are going to be
+// used.
+func NewClient(cc *grpc.ClientConn) *Client {
+	return &Client{cc: cc}
+}
+
+func (c *Client) invoke(ctx context.Context, method string, in, out interface{}, opts []grpc.CallOption) error {
+	return c.cc.Invoke(ctx, "/"+ServiceName+"/"+method, in, out, opts...)
+}
+
+// Sign creates a new X.509 certificate using a one-time token.
+func (c *Client) Sign(ctx context.Context, in *SignRequest, opts ...grpc.CallOption) (*SignResponse, error) {
+	out := new(SignResponse)
+	if err := c.invoke(ctx, "Sign", in, out, opts); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Renew renews the client certificate used in the connection.
+func (c *Client) Renew(ctx context.Context, in *RenewRequest, opts ...grpc.CallOption) (*SignResponse, error) {
+	out := new(SignResponse)
+	if err := c.invoke(ctx, "Renew", in, out, opts); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Revoke revokes a certificate using a one-time token or the client
+// certificate used in the connection.
+func (c *Client) Revoke(ctx context.Context, in *RevokeRequest, opts ...grpc.CallOption) (*RevokeResponse, error) {
+	out := new(RevokeResponse)
+	if err := c.invoke(ctx, "Revoke", in, out, opts); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SignSSH creates a new SSH certificate using a one-time token.
+func (c *Client) SignSSH(ctx context.Context, in *SignSSHRequest, opts ...grpc.CallOption) (*SignSSHResponse, error) {
+	out := new(SignSSHResponse)
+	if err := c.invoke(ctx, "SignSSH", in, out, opts); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Roots returns the root certificates of the CA.
+func (c *Client) Roots(ctx context.Context, in *RootsRequest, opts ...grpc.CallOption) (*RootsResponse, error) {
+	out := new(RootsResponse)
+	if err := c.invoke(ctx, "Roots", in, out, opts); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Provisioners returns a page of the configured provisioners.
+func (c *Client) Provisioners(ctx context.Context, in *ProvisionersRequest, opts ...grpc.CallOption) (*ProvisionersResponse, error) {
+	out := new(ProvisionersResponse)
+	if err := c.invoke(ctx, "Provisioners", in, out, opts); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// errListenerClosed is returned by the Accept of a closed listenerView.
+var errListenerClosed = errors.New("use of closed network connection")
+
+// acceptResult is the result of an Accept of the shared listener.
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+// sharedListener serves the connections of a listener to successive servers
+// without closing it. It is used where the file of a listener cannot be
+// duplicated, e.g. on Windows, so the server can be reloaded on the same
+// address. Each server accepts the connections from its own view, closing a
+// view stops its Accept but the listener keeps running until Close.
+type sharedListener struct {
+	net.Listener
+	conns chan acceptResult
+	once  sync.Once
+}
+
+func newSharedListener(ln net.Listener) *sharedListener {
+	return &sharedListener{
+		Listener: ln,
+		conns:    make(chan acceptResult),
+	}
+}
+
+// accept sends the connections of the listener to the views until it fails
+// with a non temporary error, e.g. when it is closed.
+func (sl *sharedListener) accept() {
+	defer close(sl.conns)
+	for {
+		conn, err := sl.Listener.Accept()
+		sl.conns <- acceptResult{conn, err}
+		if ne, ok := err.(net.Error); err != nil && (!ok || !ne.Temporary()) {
+			return
+		}
+	}
+}
+
+// view returns a new view of the listener, the accepted TCP connections use
+// the given keep-alive period.
+func (sl *sharedListener) view(keepAlivePeriod time.Duration) net.Listener {
+	sl.once.Do(func() {
+		go sl.accept()
+	})
+	return &listenerView{
+		sharedListener:  sl,
+		keepAlivePeriod: keepAlivePeriod,
+		done:            make(chan struct{}),
+	}
+}
+
+// listenerView is a view of a sharedListener used by a single server.
+type listenerView struct {
+	*sharedListener
+	keepAlivePeriod time.Duration
+	done            chan struct{}
+	closeOnce       sync.Once
+}
+
+// Accept waits for the next connection of the shared listener.
+func (v *listenerView) Accept() (net.Conn, error) {
+	select {
+	case <-v.done:
+		return nil, errListenerClosed
+	default:
+	}
+	select {
+	case <-v.done:
+		return nil, errListenerClosed
+	case res, ok := <-v.conns:
+		if !ok {
+			return nil, errListenerClosed
+		}
+		if tc, ok := res.conn.(*net.TCPConn); ok {
+			tc.SetKeepAlive(true)
+			tc.SetKeepAlivePeriod(v.keepAlivePeriod)
+		}
+		return res.conn, res.err
+	}
+}
+
+// Close closes the view, the shared listener is not closed.
+func (v *listenerView) Close() error {
+	v.closeOnce.Do(func() {
+		close(v.done)
+	})
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+// +build !windows
+
+package server
+
+import "net"
+
+// shareListener returns the given listener, a reload duplicates its file.
+func shareListener(ln net.Listener) net.Listener {
+	return ln
+}
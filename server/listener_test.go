@@ -0,0 +1,85 @@
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+)
+
+func Test_sharedListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.FatalError(t, err)
+	sl := newSharedListener(ln)
+
+	dial := func(l net.Listener) {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		assert.FatalError(t, err)
+		defer conn.Close()
+		c, err := l.Accept()
+		assert.FatalError(t, err)
+		c.Close()
+	}
+
+	// The views accept the connections until they are closed.
+	v1 := sl.view(time.Minute)
+	dial(v1)
+	assert.NoError(t, v1.Close())
+	assert.NoError(t, v1.Close())
+	_, err = v1.Accept()
+	assert.Equals(t, errListenerClosed, err)
+	v2 := sl.view(time.Minute)
+	dial(v2)
+
+	// Closing the shared listener closes the views.
+	assert.NoError(t, sl.Close())
+	_, err = v2.Accept()
+	assert.NotNil(t, err)
+	_, err = v2.Accept()
+	assert.Equals(t, errListenerClosed, err)
+}
+
+func TestServer_Reload_sharedListener(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.FatalError(t, err)
+	addr := ln.Addr().String()
+	handler := func(body string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(body))
+		})
+	}
+	get := func() (string, error) {
+		client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+		resp, err := client.Get("http://" + addr)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		return string(b), err
+	}
+
+	srv := New(addr, handler("old"), nil)
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Serve(newSharedListener(ln))
+	}()
+	body, err := get()
+	assert.FatalError(t, err)
+	assert.Equals(t, "old", body)
+
+	// The new server uses the same listener.
+	assert.FatalError(t, srv.Reload(New(addr, handler("new"), nil)))
+	body, err = get()
+	assert.FatalError(t, err)
+	assert.Equals(t, "new", body)
+
+	// The listener is closed on shutdown.
+	assert.FatalError(t, srv.Shutdown())
+	assert.Equals(t, http.ErrServerClosed, <-done)
+	_, err = get()
+	assert.NotNil(t, err)
+}
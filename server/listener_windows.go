@@ -0,0 +1,12 @@
+package server
+
+import "net"
+
+// shareListener returns a listener shared by the servers of successive
+// reloads, the listeners cannot be duplicated on Windows.
+func shareListener(ln net.Listener) net.Listener {
+	if _, ok := ln.(*sharedListener); ok {
+		return ln
+	}
+	return newSharedListener(ln)
+}
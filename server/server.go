@@ -10,29 +10,92 @@ import (
 	"time"
 
 	"github.com/pkg/errors"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
 // ServerShutdownTimeout is the default time to wait before closing
 // connections on shutdown.
 const ServerShutdownTimeout = 60 * time.Second
 
+// DefaultKeepAlivePeriod is the default period of the TCP keep-alives of the
+// accepted connections.
+const DefaultKeepAlivePeriod = 3 * time.Minute
+
 // Server is a incomplete component that implements a basic HTTP/HTTPS
 // server.
 type Server struct {
 	*http.Server
-	listener   *net.TCPListener
-	reloadCh   chan net.Listener
-	shutdownCh chan struct{}
+	listener        net.Listener
+	keepAlivePeriod time.Duration
+	reloadCh        chan net.Listener
+	shutdownCh      chan struct{}
+}
+
+// Options tunes the connections of a Server. Zero values keep the defaults.
+type Options struct {
+	// KeepAlivePeriod is the period of the TCP keep-alives.
+	KeepAlivePeriod time.Duration
+	// IdleTimeout is the maximum time an idle connection is kept open, for
+	// both HTTP/1.1 and HTTP/2.
+	IdleTimeout time.Duration
+	// ReadHeaderTimeout is the maximum time to read the headers of a request.
+	ReadHeaderTimeout time.Duration
+	// MaxConcurrentStreams is the maximum number of concurrent HTTP/2 streams
+	// per connection.
+	MaxConcurrentStreams uint32
+	// DisableHTTP2 serves only HTTP/1.1 over TLS.
+	DisableHTTP2 bool
+	// H2CTrustedProxies are the networks allowed to use HTTP/2 without TLS,
+	// h2c, on a server without TLS. Other clients only get HTTP/1.1.
+	H2CTrustedProxies []*net.IPNet
 }
 
 // New creates a new HTTP/HTTPS server configured with the passed
 // address, http.Handler and tls.Config.
 func New(addr string, handler http.Handler, tlsConfig *tls.Config) *Server {
 	return &Server{
-		reloadCh:   make(chan net.Listener),
-		shutdownCh: make(chan struct{}),
-		Server:     newHTTPServer(addr, handler, tlsConfig),
+		keepAlivePeriod: DefaultKeepAlivePeriod,
+		reloadCh:        make(chan net.Listener),
+		shutdownCh:      make(chan struct{}),
+		Server:          newHTTPServer(addr, handler, tlsConfig),
+	}
+}
+
+// Configure applies the given options to the server, it must be called
+// before Serve. Servers with TLS support HTTP/2 unless it is disabled.
+func (srv *Server) Configure(opts Options) error {
+	if opts.KeepAlivePeriod > 0 {
+		srv.keepAlivePeriod = opts.KeepAlivePeriod
+	}
+	if opts.IdleTimeout > 0 {
+		srv.IdleTimeout = opts.IdleTimeout
+	}
+	if opts.ReadHeaderTimeout > 0 {
+		srv.ReadHeaderTimeout = opts.ReadHeaderTimeout
+	}
+
+	h2s := &http2.Server{
+		MaxConcurrentStreams: opts.MaxConcurrentStreams,
+		IdleTimeout:          srv.IdleTimeout,
 	}
+	switch {
+	case opts.DisableHTTP2:
+		// A non-nil empty map disables the automatic HTTP/2 support.
+		srv.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	case srv.TLSConfig != nil:
+		if err := http2.ConfigureServer(srv.Server, h2s); err != nil {
+			return errors.Wrapf(err, "error configuring HTTP/2 on %s", srv.Addr)
+		}
+		// Older versions of x/net only advertise h2, keep HTTP/1.1 clients
+		// working when they negotiate the protocol with ALPN.
+		if !containsString(srv.TLSConfig.NextProtos, "http/1.1") {
+			srv.TLSConfig.NextProtos = append(srv.TLSConfig.NextProtos, "http/1.1")
+		}
+	case len(opts.H2CTrustedProxies) > 0:
+		srv.Handler = newH2CHandler(srv.Handler, h2s, opts.H2CTrustedProxies)
+	}
+	return nil
 }
 
 // newHTTPServer creates a new http.Server with the TCP address, handler and
@@ -66,16 +129,27 @@ func (srv *Server) Serve(ln net.Listener) error {
 	var err error
 	// Store the current listener.
 	// In reloads we'll create a copy of the underlying os.File so the close of the server one does not affect the copy.
-	srv.listener = ln.(*net.TCPListener)
+	// On platforms that cannot copy it the listener is shared instead.
+	ln = shareListener(ln)
+	srv.listener = ln
 
 	for {
+		// TCP connections use keep-alives, Unix domain sockets do not.
+		l := ln
+		switch tl := ln.(type) {
+		case *net.TCPListener:
+			l = tcpKeepAliveListener{tl, srv.keepAlivePeriod}
+		case *sharedListener:
+			l = tl.view(srv.keepAlivePeriod)
+		}
+
 		// Start server
 		if srv.TLSConfig == nil || (len(srv.TLSConfig.Certificates) == 0 && srv.TLSConfig.GetCertificate == nil) {
 			log.Printf("Serving HTTP on %s ...", srv.Addr)
-			err = srv.Server.Serve(tcpKeepAliveListener{ln.(*net.TCPListener)})
+			err = srv.Server.Serve(l)
 		} else {
 			log.Printf("Serving HTTPS on %s ...", srv.Addr)
-			err = srv.Server.ServeTLS(tcpKeepAliveListener{ln.(*net.TCPListener)}, "", "")
+			err = srv.Server.ServeTLS(l, "", "")
 		}
 
 		// log unexpected errors
@@ -85,7 +159,8 @@ func (srv *Server) Serve(ln net.Listener) error {
 
 		select {
 		case ln = <-srv.reloadCh:
-			srv.listener = ln.(*net.TCPListener)
+			ln = shareListener(ln)
+			srv.listener = ln
 		case <-srv.shutdownCh:
 			return http.ErrServerClosed
 		}
@@ -98,7 +173,12 @@ func (srv *Server) Shutdown() error {
 	ctx, cancel := context.WithTimeout(context.Background(), ServerShutdownTimeout)
 	defer cancel()              // release resources if Shutdown ends before the timeout
 	defer close(srv.shutdownCh) // close shutdown channel
-	return srv.Server.Shutdown(ctx)
+	err := srv.Server.Shutdown(ctx)
+	// A shared listener is not closed by the server.
+	if sl, ok := srv.listener.(*sharedListener); ok {
+		sl.Close()
+	}
+	return err
 }
 
 func (srv *Server) reloadShutdown() error {
@@ -119,9 +199,16 @@ func (srv *Server) Reload(ns *Server) error {
 		if err != nil {
 			return errors.WithStack(err)
 		}
+	} else if sl, ok := srv.listener.(*sharedListener); ok {
+		// Serve the same listener with the new server
+		ln = sl
 	} else {
+		fl, ok := srv.listener.(fileListener)
+		if !ok {
+			return errors.Errorf("listener of type %T cannot be reloaded", srv.listener)
+		}
 		// Get a copy of the underlying os.File
-		fd, err := srv.listener.File()
+		fd, err := fl.File()
 		if err != nil {
 			return errors.WithStack(err)
 		}
@@ -139,9 +226,13 @@ func (srv *Server) Reload(ns *Server) error {
 	if err := srv.reloadShutdown(); err != nil {
 		return err
 	}
+	if sl, ok := srv.listener.(*sharedListener); ok && sl != ln {
+		sl.Close()
+	}
 
 	// Update old server
 	srv.Server = ns.Server
+	srv.keepAlivePeriod = ns.keepAlivePeriod
 	srv.reloadCh <- ln
 	return nil
 }
@@ -156,12 +247,20 @@ func (srv *Server) Forbidden(w http.ResponseWriter) {
 	w.Write([]byte("Forbidden.\n"))
 }
 
+// fileListener is a listener that can return a copy of its underlying file,
+// *net.TCPListener and *net.UnixListener implement it.
+type fileListener interface {
+	net.Listener
+	File() (*os.File, error)
+}
+
 // tcpKeepAliveListener sets TCP keep-alive timeouts on accepted
 // connections. It's used by ListenAndServe and ListenAndServeTLS so
 // dead TCP connections (e.g. closing laptop mid-download) eventually
 // go away.
 type tcpKeepAliveListener struct {
 	*net.TCPListener
+	period time.Duration
 }
 
 func (ln tcpKeepAliveListener) Accept() (c net.Conn, err error) {
@@ -170,6 +269,49 @@ func (ln tcpKeepAliveListener) Accept() (c net.Conn, err error) {
 		return
 	}
 	tc.SetKeepAlive(true)
-	tc.SetKeepAlivePeriod(3 * time.Minute)
+	tc.SetKeepAlivePeriod(ln.period)
 	return tc, nil
 }
+
+// newH2CHandler returns a handler that serves HTTP/2 without TLS to the
+// clients in the trusted networks, typically proxies terminating TLS, and
+// HTTP/1.1 to the rest.
+func newH2CHandler(next http.Handler, h2s *http2.Server, trusted []*net.IPNet) http.Handler {
+	h2cHandler := h2c.NewHandler(next, h2s)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isTrustedProxy(r.RemoteAddr, trusted) {
+			h2cHandler.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isTrustedProxy returns true if the host of the given address is in one of
+// the trusted networks.
+func isTrustedProxy(addr string, trusted []*net.IPNet) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString returns true if the slice contains the given string.
+func containsString(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
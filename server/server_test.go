@@ -0,0 +1,116 @@
+package server
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/smallstep/assert"
+	"golang.org/x/net/http2"
+)
+
+func TestServer_Configure(t *testing.T) {
+	handler := http.NotFoundHandler()
+
+	// Defaults
+	srv := New("127.0.0.1:0", handler, &tls.Config{})
+	assert.FatalError(t, srv.Configure(Options{}))
+	assert.Equals(t, DefaultKeepAlivePeriod, srv.keepAlivePeriod)
+	assert.Equals(t, 15*time.Second, srv.IdleTimeout)
+	assert.Equals(t, []string{"h2", "http/1.1"}, srv.TLSConfig.NextProtos)
+	assert.NotNil(t, srv.TLSNextProto["h2"])
+
+	// Custom options
+	srv = New("127.0.0.1:0", handler, &tls.Config{})
+	assert.FatalError(t, srv.Configure(Options{
+		KeepAlivePeriod:      time.Minute,
+		IdleTimeout:          5 * time.Minute,
+		ReadHeaderTimeout:    10 * time.Second,
+		MaxConcurrentStreams: 100,
+	}))
+	assert.Equals(t, time.Minute, srv.keepAlivePeriod)
+	assert.Equals(t, 5*time.Minute, srv.IdleTimeout)
+	assert.Equals(t, 10*time.Second, srv.ReadHeaderTimeout)
+	assert.NotNil(t, srv.TLSNextProto["h2"])
+
+	// HTTP/2 disabled
+	srv = New("127.0.0.1:0", handler, &tls.Config{})
+	assert.FatalError(t, srv.Configure(Options{DisableHTTP2: true}))
+	assert.Len(t, 0, srv.TLSNextProto)
+	assert.Len(t, 0, srv.TLSConfig.NextProtos)
+
+	// Without TLS HTTP/2 is not configured
+	srv = New("127.0.0.1:0", handler, nil)
+	assert.FatalError(t, srv.Configure(Options{}))
+	assert.Nil(t, srv.TLSNextProto)
+}
+
+func TestServer_Configure_h2c(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+	_, trusted, err := net.ParseCIDR("127.0.0.0/8")
+	assert.FatalError(t, err)
+	_, untrusted, err := net.ParseCIDR("10.0.0.0/8")
+	assert.FatalError(t, err)
+
+	// h2c client with prior knowledge
+	h2cClient := &http.Client{
+		Transport: &http2.Transport{
+			AllowHTTP: true,
+			DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+				return net.Dial(network, addr)
+			},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		trusted []*net.IPNet
+		wantErr bool
+	}{
+		{"ok", []*net.IPNet{untrusted, trusted}, false},
+		{"fail-untrusted", []*net.IPNet{untrusted}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := New("127.0.0.1:0", handler, nil)
+			assert.FatalError(t, srv.Configure(Options{H2CTrustedProxies: tt.trusted}))
+			ts := httptest.NewServer(srv.Handler)
+			defer ts.Close()
+
+			// HTTP/1.1 is always available
+			resp, err := http.Get(ts.URL)
+			assert.FatalError(t, err)
+			resp.Body.Close()
+			assert.Equals(t, 1, resp.ProtoMajor)
+
+			resp, err = h2cClient.Get(ts.URL)
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.FatalError(t, err)
+			resp.Body.Close()
+			assert.Equals(t, 2, resp.ProtoMajor)
+		})
+	}
+}
+
+func Test_isTrustedProxy(t *testing.T) {
+	_, n4, err := net.ParseCIDR("10.0.0.0/8")
+	assert.FatalError(t, err)
+	_, n6, err := net.ParseCIDR("fd00::/8")
+	assert.FatalError(t, err)
+	trusted := []*net.IPNet{n4, n6}
+
+	assert.True(t, isTrustedProxy("10.1.2.3:4567", trusted))
+	assert.True(t, isTrustedProxy("[fd00::1]:4567", trusted))
+	assert.True(t, isTrustedProxy("10.1.2.3", trusted))
+	assert.False(t, isTrustedProxy("192.168.1.1:4567", trusted))
+	assert.False(t, isTrustedProxy("not-an-ip:4567", trusted))
+	assert.False(t, isTrustedProxy("10.1.2.3:4567", nil))
+}
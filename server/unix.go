@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ListenUnix listens on the Unix domain socket at the given path and sets its
+// permissions and group; a negative gid keeps the group of the process. On
+// Windows the access to the socket is controlled by the directory, the mode
+// is ignored and the group is not supported. A
+// stale socket at the path is removed, but it fails if the socket is in use.
+// The socket is not removed when the listener is closed, so it can be used
+// after a reload, the caller must remove it on shutdown.
+func ListenUnix(path string, mode os.FileMode, gid int) (net.Listener, error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if !isSocket(fi) {
+			return nil, errors.Errorf("error listening on %s: file exists and it is not a socket", path)
+		}
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, errors.Errorf("error listening on %s: socket is in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, errors.Wrapf(err, "error removing stale socket %s", path)
+		}
+	}
+
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, errors.Wrapf(err, "error listening on %s", path)
+	}
+	ln.SetUnlinkOnClose(false)
+
+	fail := func(err error) (net.Listener, error) {
+		ln.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	if err := setSocketPermissions(path, mode, gid); err != nil {
+		return fail(err)
+	}
+	return ln, nil
+}
@@ -0,0 +1,29 @@
+//go:build !windows
+// +build !windows
+
+package server
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// isSocket returns true if the file is a Unix domain socket.
+func isSocket(fi os.FileInfo) bool {
+	return fi.Mode()&os.ModeSocket != 0
+}
+
+// setSocketPermissions sets the permissions and the group of the socket; a
+// negative gid keeps the group of the process.
+func setSocketPermissions(path string, mode os.FileMode, gid int) error {
+	if err := os.Chmod(path, mode); err != nil {
+		return errors.Wrapf(err, "error setting permissions of %s", path)
+	}
+	if gid >= 0 {
+		if err := os.Chown(path, -1, gid); err != nil {
+			return errors.Wrapf(err, "error setting group of %s", path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+//go:build !windows
+// +build !windows
+
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestListenUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "server")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ca.sock")
+
+	ln, err := ListenUnix(path, 0660, -1)
+	assert.FatalError(t, err)
+	fi, err := os.Stat(path)
+	assert.FatalError(t, err)
+	assert.Equals(t, os.FileMode(0660), fi.Mode().Perm())
+
+	// The socket is in use.
+	_, err = ListenUnix(path, 0660, -1)
+	assert.NotNil(t, err)
+
+	// The socket is kept after closing the listener, and it is replaced if
+	// it is stale.
+	assert.NoError(t, ln.Close())
+	_, err = os.Stat(path)
+	assert.FatalError(t, err)
+	ln, err = ListenUnix(path, 0600, os.Getgid())
+	assert.FatalError(t, err)
+	conn, err := net.Dial("unix", path)
+	assert.FatalError(t, err)
+	conn.Close()
+	ln.Close()
+
+	// Other files are not replaced.
+	file := filepath.Join(dir, "file")
+	assert.FatalError(t, ioutil.WriteFile(file, []byte("foo"), 0600))
+	_, err = ListenUnix(file, 0600, -1)
+	assert.NotNil(t, err)
+}
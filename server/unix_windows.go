@@ -0,0 +1,22 @@
+package server
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// isSocket returns true if the file is a Unix domain socket. Older versions of
+// Go report the sockets as irregular files.
+func isSocket(fi os.FileInfo) bool {
+	return fi.Mode()&(os.ModeSocket|os.ModeIrregular) != 0
+}
+
+// setSocketPermissions only checks that the group is not set, the access to
+// the sockets is controlled by the permissions of the directory on Windows.
+func setSocketPermissions(path string, mode os.FileMode, gid int) error {
+	if gid >= 0 {
+		return errors.Errorf("error setting group of %s: not supported on windows", path)
+	}
+	return nil
+}
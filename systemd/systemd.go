@@ -0,0 +1,114 @@
+// Package systemd implements the systemd socket activation and service
+// notification protocols, see sd_listen_fds(3) and sd_notify(3).
+package systemd
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Names of the activated sockets used by the CA, set with the
+// FileDescriptorName option of the socket units.
+const (
+	APIListener      = "api"
+	GRPCListener     = "grpc"
+	MetricsListener  = "metrics"
+	DebugListener    = "debug"
+	UnixListener     = "unix"
+	InsecureListener = "insecure"
+	WorkloadListener = "workload"
+)
+
+// Service states sent with Notify.
+const (
+	Ready     = "READY=1"
+	Reloading = "RELOADING=1"
+	Stopping  = "STOPPING=1"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd.
+var listenFDsStart = 3
+
+// Listeners returns the sockets passed by systemd to the process, by the name
+// in LISTEN_FDNAMES. Sockets without a name use the name of the socket unit,
+// the default of systemd. It returns an empty map if the process was not
+// activated by systemd. The environment variables are unset so the sockets are
+// only returned once and they are not inherited by child processes.
+func Listeners() (map[string]net.Listener, error) {
+	pid, fds, names := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getenv("LISTEN_FDNAMES")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make(map[string]net.Listener)
+	if pid == "" || fds == "" {
+		return listeners, nil
+	}
+	if p, err := strconv.Atoi(pid); err != nil || p != os.Getpid() {
+		return listeners, nil
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 0 {
+		return nil, errors.Errorf("invalid LISTEN_FDS %s", fds)
+	}
+
+	var fdNames []string
+	if names != "" {
+		fdNames = strings.Split(names, ":")
+	}
+	for i := 0; i < n; i++ {
+		name := "unknown"
+		if i < len(fdNames) && fdNames[i] != "" {
+			name = fdNames[i]
+		}
+		f := os.NewFile(uintptr(listenFDsStart+i), name)
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, errors.Wrapf(err, "error using socket %s passed by systemd", name)
+		}
+		if _, ok := listeners[name]; ok {
+			ln.Close()
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, errors.Errorf("socket %s passed by systemd is duplicated", name)
+		}
+		listeners[name] = ln
+	}
+	return listeners, nil
+}
+
+// Notify sends the given states to the service manager in NOTIFY_SOCKET. It
+// does nothing if the process is not run by systemd with Type=notify.
+func Notify(states ...string) error {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil
+	}
+	// Abstract sockets start with @.
+	if addr[0] == '@' {
+		addr = "\x00" + addr[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return errors.Wrap(err, "error connecting to systemd")
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(strings.Join(states, "\n"))); err != nil {
+		return errors.Wrap(err, "error notifying systemd")
+	}
+	return nil
+}
+
+// Status returns the state with a status message.
+func Status(msg string) string {
+	return "STATUS=" + msg
+}
@@ -0,0 +1,85 @@
+package systemd
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func setListenEnv(pid, fds, names string) {
+	os.Setenv("LISTEN_PID", pid)
+	os.Setenv("LISTEN_FDS", fds)
+	os.Setenv("LISTEN_FDNAMES", names)
+}
+
+func TestListeners(t *testing.T) {
+	// Not activated
+	setListenEnv("", "", "")
+	listeners, err := Listeners()
+	assert.FatalError(t, err)
+	assert.Len(t, 0, listeners)
+
+	// Other process
+	setListenEnv("1", "1", "api")
+	listeners, err = Listeners()
+	assert.FatalError(t, err)
+	assert.Len(t, 0, listeners)
+	assert.Equals(t, "", os.Getenv("LISTEN_FDS"))
+
+	// Invalid number of sockets
+	setListenEnv(strconv.Itoa(os.Getpid()), "foo", "")
+	_, err = Listeners()
+	assert.NotNil(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.FatalError(t, err)
+	defer ln.Close()
+	f, err := ln.(*net.TCPListener).File()
+	assert.FatalError(t, err)
+	defer f.Close()
+
+	old := listenFDsStart
+	listenFDsStart = int(f.Fd())
+	defer func() { listenFDsStart = old }()
+
+	setListenEnv(strconv.Itoa(os.Getpid()), "1", "api")
+	listeners, err = Listeners()
+	assert.FatalError(t, err)
+	if assert.Len(t, 1, listeners) {
+		assert.Equals(t, ln.Addr().String(), listeners[APIListener].Addr().String())
+		listeners[APIListener].Close()
+	}
+	for _, k := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		_, ok := os.LookupEnv(k)
+		assert.False(t, ok)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	os.Unsetenv("NOTIFY_SOCKET")
+	assert.NoError(t, Notify(Ready))
+
+	dir, err := ioutil.TempDir("", "systemd")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	assert.FatalError(t, err)
+	defer conn.Close()
+
+	os.Setenv("NOTIFY_SOCKET", path)
+	defer os.Unsetenv("NOTIFY_SOCKET")
+	assert.NoError(t, Notify(Ready, Status("Serving on 127.0.0.1:443")))
+	b := make([]byte, 1024)
+	n, err := conn.Read(b)
+	assert.FatalError(t, err)
+	assert.Equals(t, "READY=1\nSTATUS=Serving on 127.0.0.1:443", string(b[:n]))
+
+	os.Setenv("NOTIFY_SOCKET", filepath.Join(dir, "missing.sock"))
+	assert.NotNil(t, Notify(Stopping))
+}
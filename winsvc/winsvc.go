@@ -0,0 +1,18 @@
+// Package winsvc runs the CA as a Windows service, handling the start, stop,
+// pause, continue and parameter change requests of the service control
+// manager. On other platforms the process is never a service.
+package winsvc
+
+// DefaultName is the default name of the service.
+const DefaultName = "step-ca"
+
+// Service is the interface implemented by the programs run as a service. Run
+// blocks while the service is running and it returns after Stop. Reload runs on
+// parameter changes, and Pause and Continue stop and resume serving requests.
+type Service interface {
+	Run() error
+	Stop() error
+	Reload() error
+	Pause() error
+	Continue() error
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+// +build !windows
+
+package winsvc
+
+import "github.com/pkg/errors"
+
+// IsService returns false, the process is only a service on Windows.
+func IsService() (bool, error) {
+	return false, nil
+}
+
+// Run returns an error, services are only supported on Windows.
+func Run(name string, s Service) error {
+	return errors.Errorf("error running service %s: not supported on this platform", name)
+}
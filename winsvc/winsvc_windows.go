@@ -0,0 +1,127 @@
+package winsvc
+
+import (
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// stopWaitHint is the time the service control manager waits for the service
+// to stop, the servers wait up to a minute for the active connections.
+const stopWaitHint = 65 * time.Second
+
+// accepted are the requests accepted by a running or paused service.
+const accepted = svc.AcceptStop | svc.AcceptShutdown | svc.AcceptPauseAndContinue | svc.AcceptParamChange
+
+// IsService returns true if the process was started by the service control
+// manager.
+func IsService() (bool, error) {
+	interactive, err := svc.IsAnInteractiveSession()
+	if err != nil {
+		return false, errors.Wrap(err, "error checking the windows session")
+	}
+	return !interactive, nil
+}
+
+// Run runs the given service until it is stopped by the service control
+// manager. The standard logger writes to the Windows event log with the name
+// of the service as source.
+func Run(name string, s Service) error {
+	if elog, err := eventlog.Open(name); err == nil {
+		defer elog.Close()
+		w := log.Writer()
+		log.SetOutput(eventLogWriter{elog})
+		defer log.SetOutput(w)
+	}
+	if err := svc.Run(name, &handler{service: s}); err != nil {
+		return errors.Wrapf(err, "error running service %s", name)
+	}
+	return nil
+}
+
+// handler implements the svc.Handler interface.
+type handler struct {
+	service Service
+}
+
+// Execute runs the service and handles the requests of the service control
+// manager until it stops.
+func (h *handler) Execute(args []string, requests <-chan svc.ChangeRequest, changes chan<- svc.Status) (bool, uint32) {
+	changes <- svc.Status{State: svc.StartPending}
+	done := make(chan error, 1)
+	go func() {
+		done <- h.service.Run()
+	}()
+	changes <- svc.Status{State: svc.Running, Accepts: accepted}
+
+	for {
+		select {
+		case err := <-done:
+			if err != nil && err != http.ErrServerClosed {
+				log.Printf("error running service: %v", err)
+				return true, 1
+			}
+			return false, 0
+		case r := <-requests:
+			switch r.Cmd {
+			case svc.Interrogate:
+				changes <- r.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				changes <- svc.Status{State: svc.StopPending, WaitHint: uint32(stopWaitHint.Milliseconds())}
+				log.Println("shutting down ...")
+				if err := h.service.Stop(); err != nil {
+					log.Printf("error stopping service: %v", err)
+				}
+				<-done
+				return false, 0
+			case svc.Pause:
+				changes <- svc.Status{State: svc.PausePending}
+				if err := h.service.Pause(); err != nil {
+					log.Printf("error pausing service: %v", err)
+					changes <- svc.Status{State: svc.Running, Accepts: accepted}
+				} else {
+					changes <- svc.Status{State: svc.Paused, Accepts: accepted}
+				}
+			case svc.Continue:
+				changes <- svc.Status{State: svc.ContinuePending}
+				if err := h.service.Continue(); err != nil {
+					log.Printf("error continuing service: %v", err)
+					changes <- svc.Status{State: svc.Paused, Accepts: accepted}
+				} else {
+					changes <- svc.Status{State: svc.Running, Accepts: accepted}
+				}
+			case svc.ParamChange:
+				log.Println("reloading ...")
+				if err := h.service.Reload(); err != nil {
+					log.Printf("error reloading service: %+v", err)
+				}
+				changes <- r.CurrentStatus
+			}
+		}
+	}
+}
+
+// eventLogWriter writes the lines of the standard logger as information
+// events, or as error events if they contain an error.
+type eventLogWriter struct {
+	elog *eventlog.Log
+}
+
+func (w eventLogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(string(p))
+	var err error
+	if strings.Contains(msg, "error") {
+		err = w.elog.Error(1, msg)
+	} else {
+		err = w.elog.Info(1, msg)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
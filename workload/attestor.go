@@ -0,0 +1,85 @@
+package workload
+
+import (
+	"context"
+	"os"
+	"os/user"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Workload contains the credentials of the process of a client of the
+// Workload API, read from the Unix domain socket.
+type Workload struct {
+	PID int32
+	UID uint32
+	GID uint32
+}
+
+// Attestor returns the selectors of a workload, e.g. unix:uid:1000. The
+// selectors must be prefixed with the type of the attestor.
+type Attestor interface {
+	Attest(ctx context.Context, w Workload) ([]string, error)
+}
+
+// AttestorFunc is an adapter to use a function as an Attestor.
+type AttestorFunc func(ctx context.Context, w Workload) ([]string, error)
+
+// Attest calls f(ctx, w).
+func (f AttestorFunc) Attest(ctx context.Context, w Workload) ([]string, error) {
+	return f(ctx, w)
+}
+
+var attestors = struct {
+	sync.RWMutex
+	m map[string]Attestor
+}{
+	m: map[string]Attestor{
+		"unix": UnixAttestor{},
+	},
+}
+
+// RegisterAttestor registers an attestor with the given name, it can be used
+// in the attestors of the workloadAPI configuration. It must be called before
+// the CA is created, usually in an init function.
+func RegisterAttestor(name string, a Attestor) {
+	attestors.Lock()
+	attestors.m[name] = a
+	attestors.Unlock()
+}
+
+// GetAttestor returns the attestor registered with the given name.
+func GetAttestor(name string) (Attestor, error) {
+	attestors.RLock()
+	defer attestors.RUnlock()
+	if a, ok := attestors.m[name]; ok {
+		return a, nil
+	}
+	return nil, errors.Errorf("workload attestor %s is not registered", name)
+}
+
+// UnixAttestor is the unix attestor, it returns the selectors unix:uid,
+// unix:gid, unix:user, unix:group, and unix:path with the path of the
+// executable of the process if it can be read.
+type UnixAttestor struct{}
+
+// Attest returns the unix selectors of the workload.
+func (UnixAttestor) Attest(ctx context.Context, w Workload) ([]string, error) {
+	uid := strconv.FormatUint(uint64(w.UID), 10)
+	gid := strconv.FormatUint(uint64(w.GID), 10)
+	selectors := []string{"unix:uid:" + uid, "unix:gid:" + gid}
+	if u, err := user.LookupId(uid); err == nil {
+		selectors = append(selectors, "unix:user:"+u.Username)
+	}
+	if g, err := user.LookupGroupId(gid); err == nil {
+		selectors = append(selectors, "unix:group:"+g.Name)
+	}
+	if w.PID > 0 {
+		if path, err := os.Readlink("/proc/" + strconv.Itoa(int(w.PID)) + "/exe"); err == nil {
+			selectors = append(selectors, "unix:path:"+path)
+		}
+	}
+	return selectors, nil
+}
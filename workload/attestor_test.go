@@ -0,0 +1,44 @@
+package workload
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"strconv"
+	"testing"
+
+	"github.com/smallstep/assert"
+)
+
+func TestUnixAttestor_Attest(t *testing.T) {
+	w := Workload{PID: int32(os.Getpid()), UID: uint32(os.Getuid()), GID: uint32(os.Getgid())}
+	selectors, err := UnixAttestor{}.Attest(context.Background(), w)
+	assert.FatalError(t, err)
+	assert.True(t, len(selectors) >= 2)
+	assert.Equals(t, "unix:uid:"+strconv.Itoa(os.Getuid()), selectors[0])
+	assert.Equals(t, "unix:gid:"+strconv.Itoa(os.Getgid()), selectors[1])
+	if runtime.GOOS == "linux" {
+		exe, err := os.Executable()
+		assert.FatalError(t, err)
+		assert.Equals(t, "unix:path:"+exe, selectors[len(selectors)-1])
+	}
+}
+
+func TestGetAttestor(t *testing.T) {
+	a, err := GetAttestor("unix")
+	assert.FatalError(t, err)
+	assert.Equals(t, UnixAttestor{}, a)
+
+	_, err = GetAttestor("foo")
+	assert.Error(t, err)
+
+	RegisterAttestor("foo", AttestorFunc(uidAttestor))
+	defer func() {
+		attestors.Lock()
+		delete(attestors.m, "foo")
+		attestors.Unlock()
+	}()
+	a, err = GetAttestor("foo")
+	assert.FatalError(t, err)
+	assert.NotNil(t, a)
+}
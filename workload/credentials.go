@@ -0,0 +1,60 @@
+package workload
+
+import (
+	"context"
+	"net"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/credentials"
+)
+
+// AuthInfo is the authentication information of a connection to the
+// Workload API, it contains the credentials of the peer process.
+type AuthInfo struct {
+	Workload Workload
+}
+
+// AuthType returns the type of the authentication.
+func (AuthInfo) AuthType() string {
+	return "unix"
+}
+
+// Credentials returns the gRPC transport credentials of the Workload API. They
+// read the credentials of the peer process of the Unix domain socket
+// connections, and make them available to the server in the AuthInfo of the
+// peer.
+func Credentials() credentials.TransportCredentials {
+	return peerCredentials{}
+}
+
+type peerCredentials struct{}
+
+func (peerCredentials) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return conn, nil, nil
+}
+
+func (peerCredentials) ServerHandshake(conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		conn.Close()
+		return nil, nil, errors.Errorf("workload api: unsupported connection %T", conn)
+	}
+	w, err := readPeerCredentials(uc)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, AuthInfo{Workload: w}, nil
+}
+
+func (peerCredentials) Info() credentials.ProtocolInfo {
+	return credentials.ProtocolInfo{SecurityProtocol: "unix"}
+}
+
+func (c peerCredentials) Clone() credentials.TransportCredentials {
+	return c
+}
+
+func (peerCredentials) OverrideServerName(string) error {
+	return nil
+}
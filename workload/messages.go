@@ -0,0 +1,61 @@
+package workload
+
+import (
+	"github.com/golang/protobuf/proto"
+)
+
+// The types in this file are the X.509 messages of the SPIFFE Workload API
+// defined in workload.proto. They use the same names, numbers and struct tags
+// as the code generated by protoc-gen-go so they can be encoded with the proto
+// package.
+
+// X509SVIDRequest is the request message of the FetchX509SVID method.
+type X509SVIDRequest struct{}
+
+func (m *X509SVIDRequest) Reset()         { *m = X509SVIDRequest{} }
+func (m *X509SVIDRequest) String() string { return proto.CompactTextString(m) }
+func (*X509SVIDRequest) ProtoMessage()    {}
+
+// X509SVIDResponse is the response message of the FetchX509SVID method.
+type X509SVIDResponse struct {
+	SVIDs            []*X509SVID       `protobuf:"bytes,1,rep,name=svids,proto3" json:"svids,omitempty"`
+	CRL              [][]byte          `protobuf:"bytes,2,rep,name=crl,proto3" json:"crl,omitempty"`
+	FederatedBundles map[string][]byte `protobuf:"bytes,3,rep,name=federated_bundles,json=federatedBundles,proto3" json:"federated_bundles,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+}
+
+func (m *X509SVIDResponse) Reset()         { *m = X509SVIDResponse{} }
+func (m *X509SVIDResponse) String() string { return proto.CompactTextString(m) }
+func (*X509SVIDResponse) ProtoMessage()    {}
+
+// X509SVID is an X.509 SVID with its key and the bundle of its trust domain.
+// The certificates are ASN.1 DER encoded and concatenated, and the key is a
+// PKCS #8 ASN.1 DER encoded private key.
+type X509SVID struct {
+	SPIFFEID    string `protobuf:"bytes,1,opt,name=spiffe_id,json=spiffeId,proto3" json:"spiffe_id,omitempty"`
+	X509SVID    []byte `protobuf:"bytes,2,opt,name=x509_svid,json=x509Svid,proto3" json:"x509_svid,omitempty"`
+	X509SVIDKey []byte `protobuf:"bytes,3,opt,name=x509_svid_key,json=x509SvidKey,proto3" json:"x509_svid_key,omitempty"`
+	Bundle      []byte `protobuf:"bytes,4,opt,name=bundle,proto3" json:"bundle,omitempty"`
+	Hint        string `protobuf:"bytes,5,opt,name=hint,proto3" json:"hint,omitempty"`
+}
+
+func (m *X509SVID) Reset()         { *m = X509SVID{} }
+func (m *X509SVID) String() string { return proto.CompactTextString(m) }
+func (*X509SVID) ProtoMessage()    {}
+
+// X509BundlesRequest is the request message of the FetchX509Bundles method.
+type X509BundlesRequest struct{}
+
+func (m *X509BundlesRequest) Reset()         { *m = X509BundlesRequest{} }
+func (m *X509BundlesRequest) String() string { return proto.CompactTextString(m) }
+func (*X509BundlesRequest) ProtoMessage()    {}
+
+// X509BundlesResponse is the response message of the FetchX509Bundles method,
+// the bundles are indexed by the SPIFFE ID of the trust domain.
+type X509BundlesResponse struct {
+	CRL     [][]byte          `protobuf:"bytes,1,rep,name=crl,proto3" json:"crl,omitempty"`
+	Bundles map[string][]byte `protobuf:"bytes,2,rep,name=bundles,proto3" json:"bundles,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+}
+
+func (m *X509BundlesResponse) Reset()         { *m = X509BundlesResponse{} }
+func (m *X509BundlesResponse) String() string { return proto.CompactTextString(m) }
+func (*X509BundlesResponse) ProtoMessage()    {}
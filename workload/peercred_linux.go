@@ -0,0 +1,28 @@
+package workload
+
+import (
+	"net"
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// readPeerCredentials returns the credentials of the peer process of the
+// connection using SO_PEERCRED.
+func readPeerCredentials(conn *net.UnixConn) (Workload, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return Workload{}, errors.Wrap(err, "error reading peer credentials")
+	}
+	var cred *syscall.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return Workload{}, errors.Wrap(err, "error reading peer credentials")
+	}
+	if credErr != nil {
+		return Workload{}, errors.Wrap(credErr, "error reading peer credentials")
+	}
+	return Workload{PID: cred.Pid, UID: cred.Uid, GID: cred.Gid}, nil
+}
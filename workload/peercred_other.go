@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package workload
+
+import (
+	"net"
+
+	"github.com/pkg/errors"
+)
+
+// readPeerCredentials is only supported on Linux.
+func readPeerCredentials(conn *net.UnixConn) (Workload, error) {
+	return Workload{}, errors.New("error reading peer credentials: not supported on this platform")
+}
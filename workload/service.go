@@ -0,0 +1,101 @@
+package workload
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ServiceName is the full name of the SPIFFE Workload API service.
+const ServiceName = "SpiffeWorkloadAPI"
+
+// SecurityHeader is the metadata key that the clients of the Workload API must
+// send with the value true.
+const SecurityHeader = "workload.spiffe.io"
+
+// SpiffeWorkloadAPIServer is the server API of the X.509 methods of the SPIFFE
+// Workload API. The JWT methods are not implemented.
+type SpiffeWorkloadAPIServer interface {
+	FetchX509SVID(*X509SVIDRequest, X509SVIDStream) error
+	FetchX509Bundles(*X509BundlesRequest, X509BundlesStream) error
+}
+
+// X509SVIDStream is the server side of a FetchX509SVID stream.
+type X509SVIDStream interface {
+	Send(*X509SVIDResponse) error
+	grpc.ServerStream
+}
+
+// X509BundlesStream is the server side of a FetchX509Bundles stream.
+type X509BundlesStream interface {
+	Send(*X509BundlesResponse) error
+	grpc.ServerStream
+}
+
+// RegisterSpiffeWorkloadAPIServer registers the given implementation of the
+// Workload API in the gRPC server.
+func RegisterSpiffeWorkloadAPIServer(s *grpc.Server, srv SpiffeWorkloadAPIServer) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*SpiffeWorkloadAPIServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "FetchX509SVID",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				req := new(X509SVIDRequest)
+				if err := stream.RecvMsg(req); err != nil {
+					return err
+				}
+				return srv.(SpiffeWorkloadAPIServer).FetchX509SVID(req, &x509SVIDStream{stream})
+			},
+			ServerStreams: true,
+		},
+		{
+			StreamName: "FetchX509Bundles",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				req := new(X509BundlesRequest)
+				if err := stream.RecvMsg(req); err != nil {
+					return err
+				}
+				return srv.(SpiffeWorkloadAPIServer).FetchX509Bundles(req, &x509BundlesStream{stream})
+			},
+			ServerStreams: true,
+		},
+	},
+	Metadata: "workload.proto",
+}
+
+type x509SVIDStream struct {
+	grpc.ServerStream
+}
+
+func (s *x509SVIDStream) Send(m *X509SVIDResponse) error {
+	return s.ServerStream.SendMsg(m)
+}
+
+type x509BundlesStream struct {
+	grpc.ServerStream
+}
+
+func (s *x509BundlesStream) Send(m *X509BundlesResponse) error {
+	return s.ServerStream.SendMsg(m)
+}
+
+// checkSecurityHeader returns an error if the request does not have the
+// security header, it prevents server-side request forgery attacks.
+func checkSecurityHeader(ctx context.Context) error {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if ok {
+		if v := md.Get(SecurityHeader); len(v) == 1 && v[0] == "true" {
+			return nil
+		}
+	}
+	return status.Error(codes.InvalidArgument, "security header missing from request")
+}
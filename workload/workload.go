@@ -0,0 +1,316 @@
+// Package workload implements the X.509 part of the SPIFFE Workload API backed
+// by the CA authority, so SPIFFE-aware workloads can get their SVIDs from the
+// CA without SPIRE. The API is served on a Unix domain socket, the workloads
+// are identified by the credentials of their process and attested by
+// pluggable attestors, and the registration entries map their selectors to
+// SPIFFE IDs.
+package workload
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// bundleRefresh is the interval used to check the bundle for changes in the
+// FetchX509Bundles streams.
+var bundleRefresh = time.Minute
+
+// Authority is the interface implemented by the CA authority used by the
+// Workload API.
+type Authority interface {
+	MintToken(opts authority.MintOptions) (string, error)
+	Authorize(ctx context.Context, ott string) ([]provisioner.SignOption, error)
+	Sign(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
+	GetRoots() ([]*x509.Certificate, error)
+}
+
+// Entry maps a set of selectors to a SPIFFE ID. A workload gets the SPIFFE ID
+// if all the selectors of the entry are in the selectors of the workload.
+type Entry struct {
+	SPIFFEID  string
+	Selectors []string
+}
+
+// Options are the options of the Workload API server. The SVIDs are signed
+// with tokens minted with Provisioner, with the validity in CertDuration or
+// the default of the provisioner.
+type Options struct {
+	TrustDomain  string
+	Provisioner  string
+	CertDuration time.Duration
+	Attestors    []Attestor
+	Entries      []Entry
+}
+
+// Server implements the X.509 methods of the SPIFFE Workload API. The SVIDs
+// are rotated on the streams after two thirds of their validity.
+type Server struct {
+	mutex sync.RWMutex
+	auth  Authority
+	opts  Options
+}
+
+// New creates a new Workload API server with the given authority and options.
+func New(auth Authority, opts Options) *Server {
+	return &Server{auth: auth, opts: opts}
+}
+
+// Reload replaces the authority and the options of the server with the ones
+// of the given server, it is used when the CA configuration is reloaded. The
+// open streams use them in the next rotation.
+func (s *Server) Reload(ns *Server) {
+	auth, opts := ns.state()
+	s.mutex.Lock()
+	s.auth, s.opts = auth, opts
+	s.mutex.Unlock()
+}
+
+func (s *Server) state() (Authority, Options) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.auth, s.opts
+}
+
+// FetchX509SVID sends the X.509 SVIDs of the workload, and new ones before the
+// previous ones expire.
+func (s *Server) FetchX509SVID(req *X509SVIDRequest, stream X509SVIDStream) error {
+	ctx := stream.Context()
+	if err := checkSecurityHeader(ctx); err != nil {
+		return err
+	}
+	for {
+		res, refresh, err := s.fetchX509SVID(ctx)
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(res); err != nil {
+			return err
+		}
+		if !sleep(ctx, time.Until(refresh)) {
+			return nil
+		}
+	}
+}
+
+// FetchX509Bundles sends the bundle of the trust domain, and the new bundle
+// when it changes.
+func (s *Server) FetchX509Bundles(req *X509BundlesRequest, stream X509BundlesStream) error {
+	ctx := stream.Context()
+	if err := checkSecurityHeader(ctx); err != nil {
+		return err
+	}
+	var last []byte
+	for {
+		auth, opts := s.state()
+		bundle, err := getBundle(auth)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(bundle, last) {
+			if err := stream.Send(&X509BundlesResponse{
+				Bundles: map[string][]byte{"spiffe://" + opts.TrustDomain: bundle},
+			}); err != nil {
+				return err
+			}
+			last = bundle
+		}
+		if !sleep(ctx, bundleRefresh) {
+			return nil
+		}
+	}
+}
+
+// fetchX509SVID attests the workload and signs its SVIDs. It returns the
+// response and the time when the SVIDs must be rotated.
+func (s *Server) fetchX509SVID(ctx context.Context) (*X509SVIDResponse, time.Time, error) {
+	auth, opts := s.state()
+	selectors, err := attest(ctx, opts.Attestors)
+	if err != nil {
+		log.Printf("workload: %v", err)
+		return nil, time.Time{}, status.Error(codes.PermissionDenied, "workload attestation failed")
+	}
+	ids := matchEntries(opts.Entries, selectors)
+	if len(ids) == 0 {
+		log.Printf("workload: no entries match the selectors %v", selectors)
+		return nil, time.Time{}, status.Error(codes.PermissionDenied, "no identity issued")
+	}
+	bundle, err := getBundle(auth)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var refresh time.Time
+	res := &X509SVIDResponse{
+		SVIDs: make([]*X509SVID, len(ids)),
+	}
+	for i, id := range ids {
+		chain, key, err := issue(ctx, auth, opts, id)
+		if err != nil {
+			log.Printf("workload: error signing %s: %v", id, err)
+			return nil, time.Time{}, status.Error(codes.Unavailable, "error signing x509 svid")
+		}
+		var der []byte
+		for _, crt := range chain {
+			der = append(der, crt.Raw...)
+		}
+		res.SVIDs[i] = &X509SVID{
+			SPIFFEID:    id,
+			X509SVID:    der,
+			X509SVIDKey: key,
+			Bundle:      bundle,
+		}
+		// Rotate the SVIDs after two thirds of the validity of the first one
+		// to expire.
+		leaf := chain[0]
+		t := leaf.NotBefore.Add(leaf.NotAfter.Sub(leaf.NotBefore) * 2 / 3)
+		if refresh.IsZero() || t.Before(refresh) {
+			refresh = t
+		}
+	}
+	return res, refresh, nil
+}
+
+// issue creates a new key and signs an SVID with the given SPIFFE ID. It
+// returns the certificate chain and the PKCS #8 encoded key.
+func issue(ctx context.Context, auth Authority, opts Options, id string) ([]*x509.Certificate, []byte, error) {
+	u, err := url.Parse(id)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "error parsing %s", id)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error generating key")
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: id},
+		URIs:    []*url.URL{u},
+	}, key)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error creating csr")
+	}
+	cr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error parsing csr")
+	}
+
+	ott, err := auth.MintToken(authority.MintOptions{
+		Provisioner: opts.Provisioner,
+		Subject:     id,
+		SANs:        []string{id},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	signOpts, err := auth.Authorize(provisioner.NewContextWithMethod(ctx, provisioner.SignMethod), ott)
+	if err != nil {
+		return nil, nil, err
+	}
+	var signOptions provisioner.Options
+	if opts.CertDuration > 0 {
+		signOptions.NotAfter.SetDuration(opts.CertDuration)
+	}
+	chain, err := auth.Sign(ctx, cr, signOptions, signOpts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(chain) == 0 {
+		return nil, nil, errors.New("empty certificate chain")
+	}
+	b, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "error marshaling key")
+	}
+	return chain, b, nil
+}
+
+// attest returns the selectors of the workload of the connection.
+func attest(ctx context.Context, attestors []Attestor) ([]string, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, errors.New("missing peer")
+	}
+	info, ok := p.AuthInfo.(AuthInfo)
+	if !ok {
+		return nil, errors.New("missing peer credentials")
+	}
+	var selectors []string
+	for _, a := range attestors {
+		s, err := a.Attest(ctx, info.Workload)
+		if err != nil {
+			return nil, errors.Wrapf(err, "error attesting workload with pid %d", info.Workload.PID)
+		}
+		selectors = append(selectors, s...)
+	}
+	return selectors, nil
+}
+
+// matchEntries returns the SPIFFE IDs of the entries whose selectors are all
+// in the given selectors.
+func matchEntries(entries []Entry, selectors []string) []string {
+	set := make(map[string]bool, len(selectors))
+	for _, s := range selectors {
+		set[s] = true
+	}
+	var ids []string
+	seen := make(map[string]bool)
+	for _, e := range entries {
+		if len(e.Selectors) == 0 || seen[e.SPIFFEID] {
+			continue
+		}
+		match := true
+		for _, s := range e.Selectors {
+			if !set[s] {
+				match = false
+				break
+			}
+		}
+		if match {
+			seen[e.SPIFFEID] = true
+			ids = append(ids, e.SPIFFEID)
+		}
+	}
+	return ids
+}
+
+// getBundle returns the concatenated ASN.1 DER encoding of the roots.
+func getBundle(auth Authority) ([]byte, error) {
+	roots, err := auth.GetRoots()
+	if err != nil {
+		log.Printf("workload: error getting roots: %v", err)
+		return nil, status.Error(codes.Unavailable, "error getting bundle")
+	}
+	var b []byte
+	for _, crt := range roots {
+		b = append(b, crt.Raw...)
+	}
+	return b, nil
+}
+
+// sleep waits for the given duration, it returns false if the context is
+// done.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
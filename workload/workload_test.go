@@ -0,0 +1,362 @@
+package workload
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/RTradeLtd/ca-certificates/authority"
+	"github.com/RTradeLtd/ca-certificates/authority/provisioner"
+	"github.com/smallstep/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type mockAuthority struct {
+	mintToken func(opts authority.MintOptions) (string, error)
+	authorize func(ctx context.Context, ott string) ([]provisioner.SignOption, error)
+	sign      func(cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error)
+	getRoots  func() ([]*x509.Certificate, error)
+}
+
+func (m *mockAuthority) MintToken(opts authority.MintOptions) (string, error) {
+	return m.mintToken(opts)
+}
+
+func (m *mockAuthority) Authorize(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+	return m.authorize(ctx, ott)
+}
+
+func (m *mockAuthority) Sign(ctx context.Context, cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+	return m.sign(cr, opts, signOpts...)
+}
+
+func (m *mockAuthority) GetRoots() ([]*x509.Certificate, error) {
+	return m.getRoots()
+}
+
+func generateCertificate(t *testing.T, cn string, d time.Duration) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.FatalError(t, err)
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(now.UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    now,
+		NotAfter:     now.Add(d),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	assert.FatalError(t, err)
+	crt, err := x509.ParseCertificate(der)
+	assert.FatalError(t, err)
+	return crt
+}
+
+func newMockAuthority(t *testing.T, root, ca *x509.Certificate, d time.Duration) *mockAuthority {
+	return &mockAuthority{
+		mintToken: func(opts authority.MintOptions) (string, error) {
+			assert.Equals(t, "workload", opts.Provisioner)
+			assert.Equals(t, []string{opts.Subject}, opts.SANs)
+			return "ott", nil
+		},
+		authorize: func(ctx context.Context, ott string) ([]provisioner.SignOption, error) {
+			assert.Equals(t, provisioner.SignMethod, provisioner.MethodFromContext(ctx))
+			return []provisioner.SignOption{}, nil
+		},
+		sign: func(cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+			if assert.Len(t, 1, cr.URIs) {
+				assert.Equals(t, cr.Subject.CommonName, cr.URIs[0].String())
+			}
+			return []*x509.Certificate{generateCertificate(t, cr.Subject.CommonName, d), ca}, nil
+		},
+		getRoots: func() ([]*x509.Certificate, error) {
+			return []*x509.Certificate{root}, nil
+		},
+	}
+}
+
+func workloadContext(ctx context.Context, header bool) context.Context {
+	if header {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(SecurityHeader, "true"))
+	}
+	return peer.NewContext(ctx, &peer.Peer{
+		AuthInfo: AuthInfo{Workload: Workload{PID: 1, UID: 1000, GID: 1000}},
+	})
+}
+
+type mockX509SVIDStream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	responses chan *X509SVIDResponse
+}
+
+func (s *mockX509SVIDStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *mockX509SVIDStream) Send(res *X509SVIDResponse) error {
+	select {
+	case s.responses <- res:
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+type mockX509BundlesStream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	responses chan *X509BundlesResponse
+}
+
+func (s *mockX509BundlesStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *mockX509BundlesStream) Send(res *X509BundlesResponse) error {
+	select {
+	case s.responses <- res:
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+func uidAttestor(ctx context.Context, w Workload) ([]string, error) {
+	return []string{"unix:uid:" + strconv.Itoa(int(w.UID))}, nil
+}
+
+func TestServer_FetchX509SVID(t *testing.T) {
+	root := generateCertificate(t, "Root CA", time.Hour)
+	ca := generateCertificate(t, "Intermediate CA", time.Hour)
+	entries := []Entry{
+		{SPIFFEID: "spiffe://example.org/web", Selectors: []string{"unix:uid:1000"}},
+		{SPIFFEID: "spiffe://example.org/db", Selectors: []string{"unix:uid:1000", "unix:gid:0"}},
+		{SPIFFEID: "spiffe://example.org/admin", Selectors: []string{"unix:uid:0"}},
+	}
+
+	tests := []struct {
+		name     string
+		header   bool
+		attestor AttestorFunc
+		auth     func(m *mockAuthority)
+		wantIDs  []string
+		wantCode codes.Code
+	}{
+		{"ok", true, uidAttestor, nil, []string{"spiffe://example.org/web"}, codes.OK},
+		{"ok-multiple", true, func(ctx context.Context, w Workload) ([]string, error) {
+			return []string{"unix:uid:1000", "unix:gid:0"}, nil
+		}, nil, []string{"spiffe://example.org/web", "spiffe://example.org/db"}, codes.OK},
+		{"fail-header", false, uidAttestor, nil, nil, codes.InvalidArgument},
+		{"fail-attest", true, func(ctx context.Context, w Workload) ([]string, error) {
+			return nil, fmt.Errorf("an error")
+		}, nil, nil, codes.PermissionDenied},
+		{"fail-no-entries", true, func(ctx context.Context, w Workload) ([]string, error) {
+			return []string{"unix:uid:1"}, nil
+		}, nil, nil, codes.PermissionDenied},
+		{"fail-mint", true, uidAttestor, func(m *mockAuthority) {
+			m.mintToken = func(opts authority.MintOptions) (string, error) {
+				return "", fmt.Errorf("an error")
+			}
+		}, nil, codes.Unavailable},
+		{"fail-sign", true, uidAttestor, func(m *mockAuthority) {
+			m.sign = func(cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+				return nil, fmt.Errorf("an error")
+			}
+		}, nil, codes.Unavailable},
+		{"fail-roots", true, uidAttestor, func(m *mockAuthority) {
+			m.getRoots = func() ([]*x509.Certificate, error) {
+				return nil, fmt.Errorf("an error")
+			}
+		}, nil, codes.Unavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth := newMockAuthority(t, root, ca, time.Hour)
+			if tt.auth != nil {
+				tt.auth(auth)
+			}
+			s := New(auth, Options{
+				TrustDomain: "example.org",
+				Provisioner: "workload",
+				Attestors:   []Attestor{tt.attestor},
+				Entries:     entries,
+			})
+
+			ctx, cancel := context.WithCancel(workloadContext(context.Background(), tt.header))
+			defer cancel()
+			stream := &mockX509SVIDStream{ctx: ctx, responses: make(chan *X509SVIDResponse, 1)}
+			done := make(chan error, 1)
+			go func() {
+				done <- s.FetchX509SVID(&X509SVIDRequest{}, stream)
+			}()
+
+			if tt.wantCode != codes.OK {
+				assert.Equals(t, tt.wantCode, status.Code(<-done))
+				return
+			}
+			res := <-stream.responses
+			if assert.Len(t, len(tt.wantIDs), res.SVIDs) {
+				for i, svid := range res.SVIDs {
+					assert.Equals(t, tt.wantIDs[i], svid.SPIFFEID)
+					assert.Equals(t, root.Raw, svid.Bundle)
+					certs, err := x509.ParseCertificates(svid.X509SVID)
+					assert.FatalError(t, err)
+					assert.Len(t, 2, certs)
+					assert.Equals(t, tt.wantIDs[i], certs[0].Subject.CommonName)
+					_, err = x509.ParsePKCS8PrivateKey(svid.X509SVIDKey)
+					assert.FatalError(t, err)
+				}
+			}
+			cancel()
+			assert.FatalError(t, <-done)
+		})
+	}
+}
+
+func TestServer_FetchX509SVID_rotation(t *testing.T) {
+	root := generateCertificate(t, "Root CA", time.Hour)
+	ca := generateCertificate(t, "Intermediate CA", time.Hour)
+	// The certificates are valid for 3s from the start of the current second,
+	// so they are rotated in at most 2s.
+	auth := newMockAuthority(t, root, ca, time.Hour)
+	auth.sign = func(cr *x509.CertificateRequest, opts provisioner.Options, signOpts ...provisioner.SignOption) ([]*x509.Certificate, error) {
+		crt := generateCertificate(t, cr.Subject.CommonName, time.Hour)
+		crt.NotBefore = time.Now().Truncate(time.Second)
+		crt.NotAfter = crt.NotBefore.Add(3 * time.Second)
+		return []*x509.Certificate{crt, ca}, nil
+	}
+	s := New(auth, Options{
+		TrustDomain: "example.org",
+		Provisioner: "workload",
+		Attestors:   []Attestor{AttestorFunc(uidAttestor)},
+		Entries:     []Entry{{SPIFFEID: "spiffe://example.org/web", Selectors: []string{"unix:uid:1000"}}},
+	})
+
+	ctx, cancel := context.WithCancel(workloadContext(context.Background(), true))
+	defer cancel()
+	stream := &mockX509SVIDStream{ctx: ctx, responses: make(chan *X509SVIDResponse)}
+	done := make(chan error, 1)
+	go func() {
+		done <- s.FetchX509SVID(&X509SVIDRequest{}, stream)
+	}()
+
+	first := <-stream.responses
+	select {
+	case second := <-stream.responses:
+		assert.NotEquals(t, first.SVIDs[0].X509SVID, second.SVIDs[0].X509SVID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for rotation")
+	}
+	cancel()
+	assert.FatalError(t, <-done)
+}
+
+func TestServer_FetchX509Bundles(t *testing.T) {
+	root := generateCertificate(t, "Root CA", time.Hour)
+	ca := generateCertificate(t, "Intermediate CA", time.Hour)
+	s := New(newMockAuthority(t, root, ca, time.Hour), Options{TrustDomain: "example.org"})
+
+	stream := &mockX509BundlesStream{ctx: context.Background(), responses: make(chan *X509BundlesResponse, 1)}
+	assert.Equals(t, codes.InvalidArgument, status.Code(s.FetchX509Bundles(&X509BundlesRequest{}, stream)))
+
+	ctx, cancel := context.WithCancel(workloadContext(context.Background(), true))
+	defer cancel()
+	stream.ctx = ctx
+	done := make(chan error, 1)
+	go func() {
+		done <- s.FetchX509Bundles(&X509BundlesRequest{}, stream)
+	}()
+	res := <-stream.responses
+	assert.Equals(t, map[string][]byte{"spiffe://example.org": root.Raw}, res.Bundles)
+	cancel()
+	assert.FatalError(t, <-done)
+}
+
+func Test_matchEntries(t *testing.T) {
+	entries := []Entry{
+		{SPIFFEID: "spiffe://example.org/web", Selectors: []string{"unix:uid:1000"}},
+		{SPIFFEID: "spiffe://example.org/web", Selectors: []string{"unix:gid:1000"}},
+		{SPIFFEID: "spiffe://example.org/db", Selectors: []string{"unix:uid:1000", "unix:path:/usr/bin/db"}},
+		{SPIFFEID: "spiffe://example.org/empty"},
+	}
+	tests := []struct {
+		name      string
+		selectors []string
+		want      []string
+	}{
+		{"one", []string{"unix:uid:1000", "unix:gid:1000"}, []string{"spiffe://example.org/web"}},
+		{"all", []string{"unix:uid:1000", "unix:path:/usr/bin/db"}, []string{"spiffe://example.org/web", "spiffe://example.org/db"}},
+		{"none", []string{"unix:uid:0"}, nil},
+		{"empty", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equals(t, tt.want, matchEntries(entries, tt.selectors))
+		})
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("peer credentials are only supported on linux")
+	}
+	dir, err := ioutil.TempDir("", "workload")
+	assert.FatalError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "workload.sock")
+	ln, err := net.Listen("unix", path)
+	assert.FatalError(t, err)
+
+	root := generateCertificate(t, "Root CA", time.Hour)
+	ca := generateCertificate(t, "Intermediate CA", time.Hour)
+	var got Workload
+	s := New(newMockAuthority(t, root, ca, time.Hour), Options{
+		TrustDomain: "example.org",
+		Provisioner: "workload",
+		Attestors: []Attestor{AttestorFunc(func(ctx context.Context, w Workload) ([]string, error) {
+			got = w
+			return []string{"test:ok"}, nil
+		})},
+		Entries: []Entry{{SPIFFEID: "spiffe://example.org/test", Selectors: []string{"test:ok"}}},
+	})
+	srv := grpc.NewServer(grpc.Creds(Credentials()))
+	RegisterSpiffeWorkloadAPIServer(srv, s)
+	go srv.Serve(ln)
+	defer srv.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cc, err := grpc.DialContext(ctx, "unix://"+path, grpc.WithInsecure(), grpc.WithDialer(func(addr string, timeout time.Duration) (net.Conn, error) {
+		return net.DialTimeout("unix", path, timeout)
+	}))
+	assert.FatalError(t, err)
+	defer cc.Close()
+
+	stream, err := cc.NewStream(metadata.AppendToOutgoingContext(ctx, SecurityHeader, "true"), &serviceDesc.Streams[0], "/"+ServiceName+"/FetchX509SVID")
+	assert.FatalError(t, err)
+	assert.FatalError(t, stream.SendMsg(&X509SVIDRequest{}))
+	assert.FatalError(t, stream.CloseSend())
+	res := new(X509SVIDResponse)
+	assert.FatalError(t, stream.RecvMsg(res))
+	if assert.Len(t, 1, res.SVIDs) {
+		assert.Equals(t, "spiffe://example.org/test", res.SVIDs[0].SPIFFEID)
+	}
+	assert.Equals(t, Workload{PID: int32(os.Getpid()), UID: uint32(os.Getuid()), GID: uint32(os.Getgid())}, got)
+}